@@ -0,0 +1,67 @@
+// Описание: Утилита нормализации трек-номеров в существующих строках базы данных.
+// Приводит трек-номера заказов и товаров к виду, в котором их записывает приём заказов (trim, NFKC, верхний регистр),
+// и сообщает, сколько строк изменено; трек-номера, которые и после нормализации не соответствуют
+// validation.track_number.pattern, не удаляются, а только подсчитываются
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/internal/validation"
+	"l0_test_self/pkg/client/postgres"
+)
+
+func main() {
+	configPath := flag.String("config", "../../config.yaml", "путь к файлу конфигурации")
+	batchSize := flag.Int("batch", 500, "число заказов в одной транзакции")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pattern, _, err := cfg.Validation.TrackNumber.Compile()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pool, err := postgres.NewClient(ctx, cfg.Database.ToPostgresConfig(), max(cfg.Database.ConnectAttempts, 1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+	if err := postgres.EnsureSchema(ctx, pool); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("normalizing track numbers (batch %d)", *batchSize)
+	var mismatched int
+	normalize := func(s string) string {
+		n := validation.NormalizeTrackNumber(s)
+		if !pattern.MatchString(n) {
+			mismatched++
+		}
+		return n
+	}
+	total, err := postgres.NormalizeTrackNumbers(ctx, pool, normalize, *batchSize, func(p postgres.TrackNumberProgress) {
+		log.Printf("scanned %d orders, changed %d orders and %d items (last order %s)", p.Scanned, p.Orders, p.Items, tenant.Key(p.LastTenant, p.LastUID))
+	})
+	if err != nil {
+		// Обработанные пачки уже сохранены: повторный запуск пропустит их без изменений
+		log.Fatalf("stopped after %d orders: %v", total.Scanned, err)
+	}
+	log.Printf("done: scanned %d orders, changed %d orders and %d items", total.Scanned, total.Orders, total.Items)
+	if mismatched > 0 {
+		log.Printf("%d track numbers (orders and items) do not match %s after normalization", mismatched, pattern)
+	}
+}
@@ -1,96 +1,66 @@
-// Описание: Интеграционные тесты для Kafka Producer
+//go:build integration
+
+// Описание: Интеграционные тесты для Kafka Producer: каждый тест пишет в собственный топик, созданный kafkatest,
+// и читает отправленные сообщения обратно
+// Запуск: go test -tags integration ./cmd/producer/
 package main
 
 import (
 	"context"
 	"testing"
-	"time"
 
 	"l0_test_self/internal/config"
 	kafkaClient "l0_test_self/pkg/client/kafka"
+	"l0_test_self/pkg/kafkatest"
 
 	"github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// GenerateTestOrderJSON - функция для генерации тестового заказа в формате JSON
-func TestKafkaIntegration(t *testing.T) {
+// newTestWriter - писатель продюсера в топик теста; закрывается по завершении теста
+func newTestWriter(t *testing.T) (*kafka.Writer, *kafkatest.Harness) {
+	t.Helper()
 	if testing.Short() {
 		t.Skip("Skipping integration test in short mode")
 	}
-
-	ctx := context.Background()
-	time.Sleep(5 * time.Second)
-
-	// Загружаем конфиг из файла
 	cfg, err := config.Load("../../config.yaml")
 	require.NoError(t, err)
 
-	kafkaCfg := kafkaClient.Config{
-		Brokers: cfg.Test.Kafka.Brokers,
-		Topic:   cfg.Test.Kafka.Topic,
-		GroupID: cfg.Test.Kafka.IntegrationGroupID,
-	}
-
-	writer := kafkaClient.NewWriter(kafkaCfg)
-	require.NotNil(t, writer)
+	h := kafkatest.New(t, cfg.Test.Kafka.Brokers)
+	writer := kafkaClient.NewWriter(kafkaClient.Config{Brokers: h.Brokers, Topic: h.Topic})
+	t.Cleanup(func() { assert.NoError(t, writer.Close()) })
+	return writer, h
+}
 
-	defer func() {
-		err := writer.Close()
-		assert.NoError(t, err)
-	}()
+// TestKafkaIntegration - отправленный продюсером заказ читается из топика без изменений
+func TestKafkaIntegration(t *testing.T) {
+	writer, h := newTestWriter(t)
 
 	orderJSON, err := GenerateTestOrderJSON()
 	require.NoError(t, err)
 	require.NotEmpty(t, orderJSON)
+	require.NoError(t, writer.WriteMessages(context.Background(), kafka.Message{Value: orderJSON}))
 
-	msg := kafka.Message{
-		Value: orderJSON,
-	}
-
-	err = writer.WriteMessages(ctx, msg)
-	assert.NoError(t, err)
+	got := h.ConsumeN(1)
+	assert.JSONEq(t, string(orderJSON), string(got[0].Value))
 }
 
-// TestGenerateTestOrderJSON - тест для проверки генерации тестового заказа в формате JSON
+// TestMultipleMessagesSending - несколько заказов, отправленных по одному, читаются в порядке отправки
 func TestMultipleMessagesSending(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping integration test in short mode")
-	}
-
-	ctx := context.Background()
-	time.Sleep(2 * time.Second)
-
-	cfg, err := config.Load("../../config.yaml")
-	require.NoError(t, err)
-
-	kafkaCfg := kafkaClient.Config{
-		Brokers: cfg.Test.Kafka.Brokers,
-		Topic:   cfg.Test.Kafka.Topic,
-		GroupID: cfg.Test.Kafka.MultipleGroupID,
-	}
-
-	writer := kafkaClient.NewWriter(kafkaCfg)
-	require.NotNil(t, writer)
-
-	defer func() {
-		err := writer.Close()
-		assert.NoError(t, err)
-	}()
+	writer, h := newTestWriter(t)
 
-	messagesCount := 3
+	const messagesCount = 3
+	var sent [][]byte
 	for i := 0; i < messagesCount; i++ {
 		orderJSON, err := GenerateTestOrderJSON()
 		require.NoError(t, err)
+		require.NoError(t, writer.WriteMessages(context.Background(), kafka.Message{Value: orderJSON}))
+		sent = append(sent, orderJSON)
+	}
 
-		msg := kafka.Message{
-			Value: orderJSON,
-		}
-
-		err = writer.WriteMessages(ctx, msg)
-		assert.NoError(t, err)
-
-		time.Sleep(100 * time.Millisecond)
+	got := h.ConsumeN(messagesCount)
+	for i, msg := range got {
+		assert.JSONEq(t, string(sent[i]), string(msg.Value), "message %d", i)
 	}
 }
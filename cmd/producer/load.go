@@ -0,0 +1,232 @@
+// Описание: Режим нагрузочного тестирования продюсера: параллельная отправка большого числа заказов пачками
+// несколькими writer'ами и сводка: пропускная способность, квантили задержки подтверждения сообщений и ошибки по кодам
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	kafkaClient "l0_test_self/pkg/client/kafka"
+	"l0_test_self/pkg/codec"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// loadBatchTimeout - сколько writer ждёт заполнения пачки Kafka перед отправкой неполной
+const loadBatchTimeout = 10 * time.Millisecond
+
+// maxLoggedErrors - сколько ошибок записи логируется за прогон; остальные только подсчитываются
+const maxLoggedErrors = 10
+
+// messageWriter - отправка сообщений в Kafka, реализуется *kafka.Writer и обёртками kafkaClient, учитывающими задержки
+type messageWriter = kafkaClient.MessageWriter
+
+// loadConfig - параметры нагрузочного прогона: либо Total сообщений, либо отправка в течение Duration
+type loadConfig struct {
+	Total       int
+	Duration    time.Duration
+	Concurrency int
+	BatchSize   int
+	Acks        kafka.RequiredAcks // подтверждения, которых writer ждёт от брокеров
+	Async       bool               // асинхронные писатели: WriteMessages не ждёт подтверждения
+}
+
+// validate - проверяет параметры прогона
+func (c loadConfig) validate() error {
+	if c.Concurrency <= 0 || c.BatchSize <= 0 {
+		return fmt.Errorf("concurrency and batch-size must be positive")
+	}
+	if c.Duration <= 0 && c.Total <= 0 {
+		return fmt.Errorf("either total or duration must be positive")
+	}
+	return nil
+}
+
+// workRange - диапазон сообщений [start, end) одного воркера
+type workRange struct {
+	start, end int
+}
+
+// partitionWork - делит total сообщений между workers воркерами почти поровну: первые total%workers воркеров
+// получают на одно сообщение больше. Воркеры без сообщений не получают диапазона.
+func partitionWork(total, workers int) []workRange {
+	if total <= 0 || workers <= 0 {
+		return nil
+	}
+	workers = min(workers, total)
+	ranges := make([]workRange, workers)
+	base, extra := total/workers, total%workers
+	start := 0
+	for i := range ranges {
+		n := base
+		if i < extra {
+			n++
+		}
+		ranges[i] = workRange{start: start, end: start + n}
+		start += n
+	}
+	return ranges
+}
+
+// errorLogger - логирует первые maxLoggedErrors ошибок записи всех воркеров
+type errorLogger struct {
+	mu     sync.Mutex
+	logged int
+}
+
+func (l *errorLogger) log(err error, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.logged < maxLoggedErrors {
+		l.logged++
+		log.Printf("write error (%d messages): %v", n, err)
+	}
+}
+
+// writeBatches - отправляет пачки, полученные от next, до их окончания; ошибка записи пачки логируется
+// и не прерывает воркер. Задержки и ошибки учитывает writer (kafkaClient.NewMeasuredWriter или MeasureAsync).
+func writeBatches(ctx context.Context, w messageWriter, next func() ([]kafka.Message, bool), errs *errorLogger) {
+	for {
+		batch, ok := next()
+		if !ok {
+			return
+		}
+		if err := w.WriteMessages(ctx, batch...); err != nil {
+			errs.log(err, len(batch))
+		}
+	}
+}
+
+// runLoadTotal - отправляет заранее сгенерированные сообщения msgs: каждому писателю достаётся свой диапазон
+func runLoadTotal(ctx context.Context, writers []messageWriter, msgs []kafka.Message, batchSize int) {
+	ranges := partitionWork(len(msgs), len(writers))
+	errs := &errorLogger{}
+	var wg sync.WaitGroup
+	for i, rg := range ranges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pos := rg.start
+			writeBatches(ctx, writers[i], func() ([]kafka.Message, bool) {
+				if pos >= rg.end || ctx.Err() != nil {
+					return nil, false
+				}
+				end := min(pos+batchSize, rg.end)
+				batch := msgs[pos:end]
+				pos = end
+				return batch, true
+			}, errs)
+		}()
+	}
+	wg.Wait()
+}
+
+// runLoadDuration - отправляет сообщения в течение duration; пачки генерируются заранее в отдельной горутине
+// и раздаются свободным писателям через буферизованный канал
+func runLoadDuration(parent context.Context, writers []messageWriter, duration time.Duration, batchSize int, generate func() kafka.Message) {
+	ctx, cancel := context.WithTimeout(parent, duration)
+	defer cancel()
+
+	batches := make(chan []kafka.Message, 4*len(writers))
+	go func() {
+		defer close(batches)
+		for {
+			batch := make([]kafka.Message, batchSize)
+			for i := range batch {
+				batch[i] = generate()
+			}
+			select {
+			case batches <- batch:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	errs := &errorLogger{}
+	var wg sync.WaitGroup
+	for _, w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Пачка, начатая до окончания прогона, дописывается с родительским контекстом, чтобы не считать её ошибкой
+			writeBatches(parent, w, func() ([]kafka.Message, bool) {
+				select {
+				case <-ctx.Done():
+					return nil, false
+				case batch, ok := <-batches:
+					return batch, ok && ctx.Err() == nil
+				}
+			}, errs)
+		}()
+	}
+	wg.Wait()
+}
+
+// orderMessageSource - возвращает генератор сообщений с заказами сценария в формате format
+func orderMessageSource(gen *testorders.Generator, scenario testorders.Scenario, format codec.Codec) func() kafka.Message {
+	return func() kafka.Message {
+		msg, err := orderMessage(format, gen.Order(scenario))
+		if err != nil {
+			// Заказ генератора всегда кодируется; паника означает ошибку в генераторе
+			panic(fmt.Sprintf("encode generated order: %v", err))
+		}
+		return msg
+	}
+}
+
+// runLoadMode - выполняет нагрузочный прогон: создаёт cfg.Concurrency писателей с пачками Kafka размера cfg.BatchSize,
+// подтверждениями cfg.Acks и стратегией выбора партиции strategy, генерирует сообщения и печатает сводку: квантили
+// задержки подтверждения сообщений, ошибки по кодам и объём в секунду. С cfg.Async писатели асинхронные, и задержка
+// считается до подтверждения в Writer.Completion; прогон завершается, когда подтверждены все переданные сообщения.
+func runLoadMode(ctx context.Context, kafkaCfg kafkaClient.Config, strategy kafkaClient.PartitionStrategy, cfg loadConfig, gen *testorders.Generator, scenario testorders.Scenario, format codec.Codec) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	stats := kafkaClient.NewSendStats()
+	writers := make([]messageWriter, cfg.Concurrency)
+	for i := range writers {
+		w := newWriter(kafkaCfg, strategy)
+		w.BatchSize = cfg.BatchSize
+		w.BatchTimeout = loadBatchTimeout
+		w.RequiredAcks = cfg.Acks
+		if cfg.Async {
+			writers[i] = kafkaClient.MeasureAsync(w, stats)
+		} else {
+			writers[i] = kafkaClient.NewMeasuredWriter(w, stats)
+		}
+	}
+	closeWriters := func() {
+		for _, w := range writers {
+			if err := w.Close(); err != nil {
+				log.Printf("close writer: %v", err)
+			}
+		}
+	}
+
+	generate := orderMessageSource(gen, scenario, format)
+	mode := fmt.Sprintf("%d writers, batch %d, acks %s, async %t", cfg.Concurrency, cfg.BatchSize, cfg.Acks, cfg.Async)
+	var start time.Time
+	if cfg.Duration > 0 {
+		log.Printf("load: sending for %s with %s", cfg.Duration, mode)
+		start = time.Now()
+		runLoadDuration(ctx, writers, cfg.Duration, cfg.BatchSize, generate)
+	} else {
+		log.Printf("load: generating %d orders", cfg.Total)
+		msgs := make([]kafka.Message, cfg.Total)
+		for i := range msgs {
+			msgs[i] = generate()
+		}
+		log.Printf("load: sending %d orders with %s", cfg.Total, mode)
+		start = time.Now()
+		runLoadTotal(ctx, writers, msgs, cfg.BatchSize)
+	}
+	// Закрытие дожидается отправки накопленных пачек и подтверждений асинхронных писателей
+	closeWriters()
+	log.Printf("load report: %s", stats.Summary(time.Since(start)))
+	return nil
+}
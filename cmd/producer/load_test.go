@@ -0,0 +1,150 @@
+// Описание: Тесты нагрузочного режима продюсера: разбиение работы между писателями, учёт отправок в сводке и формат сообщений
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"l0_test_self/models/orders"
+	kafkaClient "l0_test_self/pkg/client/kafka"
+	"l0_test_self/pkg/codec"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLoadWriter - писатель, запоминающий отправленные сообщения; каждый failEvery-й вызов завершается ошибкой
+type fakeLoadWriter struct {
+	mu        sync.Mutex
+	calls     int
+	failEvery int
+	delay     time.Duration
+	written   []string
+}
+
+func (w *fakeLoadWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	time.Sleep(w.delay)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.calls++
+	if w.failEvery > 0 && w.calls%w.failEvery == 0 {
+		return errors.New("broker not available")
+	}
+	for _, m := range msgs {
+		w.written = append(w.written, string(m.Value))
+	}
+	return nil
+}
+
+func (w *fakeLoadWriter) Close() error { return nil }
+
+// measured - писатели fakes, учитывающие отправки в stats
+func measured(stats *kafkaClient.SendStats, fakes ...*fakeLoadWriter) []messageWriter {
+	writers := make([]messageWriter, len(fakes))
+	for i, w := range fakes {
+		writers[i] = kafkaClient.NewMeasuredWriter(w, stats)
+	}
+	return writers
+}
+
+func TestPartitionWork(t *testing.T) {
+	assert.Equal(t, []workRange{{0, 4}, {4, 7}, {7, 10}}, partitionWork(10, 3))
+	assert.Equal(t, []workRange{{0, 2}, {2, 4}}, partitionWork(4, 2))
+	assert.Equal(t, []workRange{{0, 1}, {1, 2}}, partitionWork(2, 5), "no empty workers")
+	assert.Nil(t, partitionWork(0, 3))
+	assert.Nil(t, partitionWork(5, 0))
+
+	for _, tc := range [][2]int{{1, 1}, {1000, 7}, {5000, 16}, {17, 17}} {
+		ranges := partitionWork(tc[0], tc[1])
+		covered, sizes := 0, map[int]bool{}
+		for i, r := range ranges {
+			assert.Equal(t, covered, r.start, "ranges are contiguous")
+			covered = r.end
+			sizes[r.end-r.start] = true
+			if i > 0 {
+				assert.LessOrEqual(t, r.end-r.start, ranges[i-1].end-ranges[i-1].start)
+			}
+		}
+		assert.Equal(t, tc[0], covered, "every message is assigned")
+		assert.LessOrEqual(t, len(sizes), 2, "sizes differ by at most one")
+	}
+}
+
+func TestRunLoadTotalContinuesAfterErrors(t *testing.T) {
+	msgs := make([]kafka.Message, 1000)
+	for i := range msgs {
+		msgs[i] = kafka.Message{Value: []byte(fmt.Sprint(i))}
+	}
+	fakes := []*fakeLoadWriter{{failEvery: 3}, {}, {}, {}}
+	stats := kafkaClient.NewSendStats()
+
+	runLoadTotal(context.Background(), measured(stats, fakes...), msgs, 50)
+
+	// Первому писателю достаются 250 сообщений, то есть 5 пачек; третья из них завершается ошибкой, остальные отправляются
+	report := stats.Summary(time.Second)
+	assert.Equal(t, 1000, report.Sent+report.Failed)
+	assert.Equal(t, 50, report.Failed)
+	assert.Equal(t, map[string]int{kafkaClient.SendErrorOther: 50}, report.Errors)
+	assert.Equal(t, 20, report.Writes)
+	// Значения 0..999 занимают 10*1+90*2+900*3 байт, из них не отправлены 100..149
+	assert.Equal(t, int64(2890-50*3), report.Bytes)
+
+	seen := map[string]bool{}
+	for _, w := range fakes[1:] {
+		for _, v := range w.written {
+			assert.False(t, seen[v], "message %s written twice", v)
+			seen[v] = true
+		}
+	}
+	assert.Len(t, seen, 750)
+}
+
+func TestRunLoadDurationStops(t *testing.T) {
+	var n int
+	var mu sync.Mutex
+	generate := func() kafka.Message {
+		mu.Lock()
+		defer mu.Unlock()
+		n++
+		return kafka.Message{Value: []byte(fmt.Sprint(n))}
+	}
+	stats := kafkaClient.NewSendStats()
+	writers := measured(stats, &fakeLoadWriter{delay: time.Millisecond}, &fakeLoadWriter{delay: time.Millisecond, failEvery: 2})
+
+	start := time.Now()
+	runLoadDuration(context.Background(), writers, 100*time.Millisecond, 10, generate)
+
+	assert.Less(t, time.Since(start), time.Second)
+	report := stats.Summary(time.Since(start))
+	assert.Positive(t, report.Sent)
+	assert.Positive(t, report.Failed)
+	assert.Equal(t, report.Writes*10, report.Sent+report.Failed)
+	assert.GreaterOrEqual(t, report.P50, time.Millisecond, "each message waits for its batch write")
+}
+
+func TestLoadConfigValidate(t *testing.T) {
+	require.NoError(t, loadConfig{Total: 10, Concurrency: 1, BatchSize: 1}.validate())
+	require.NoError(t, loadConfig{Duration: time.Second, Concurrency: 1, BatchSize: 1}.validate())
+	assert.Error(t, loadConfig{Concurrency: 1, BatchSize: 1}.validate())
+	assert.Error(t, loadConfig{Total: 10, BatchSize: 1}.validate())
+	assert.Error(t, loadConfig{Total: 10, Concurrency: 1}.validate())
+}
+
+func TestOrderMessageSourceFormats(t *testing.T) {
+	for _, format := range []codec.Codec{codec.JSON, codec.Protobuf} {
+		msg := orderMessageSource(testorders.NewGenerator(5), testorders.ScenarioDefault, format)()
+
+		selected, err := codec.ForMessage(msg.Headers, codec.JSON)
+		require.NoError(t, err)
+		assert.Equal(t, format.Name(), selected.Name())
+		var order orders.Order
+		require.NoError(t, selected.Decode(msg.Value, &order), format.Name())
+		assert.NotEmpty(t, order.OrderUid)
+	}
+}
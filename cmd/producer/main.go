@@ -4,15 +4,53 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"time"
 
+	"l0_test_self/models/orders"
 	kafkaClient "l0_test_self/pkg/client/kafka"
+	"l0_test_self/pkg/codec"
+	"l0_test_self/pkg/testorders"
 
 	"github.com/segmentio/kafka-go"
 )
 
 func main() {
+	scenarioName := flag.String("scenario", string(testorders.ScenarioDefault), "сценарий генерации заказов (default, minimal, maximal, unicode, zero-amounts, max-amounts, mismatched-totals)")
+	seed := flag.Int64("seed", 0, "seed генератора (0 - случайный)")
+	maxItems := flag.Int("max-items", testorders.DefaultMaxItems, "количество товаров в сценарии maximal")
+	count := flag.Int("count", 10, "количество отправляемых заказов")
+	load := flag.Bool("load", false, "режим нагрузочного тестирования: параллельная отправка пачками и отчёт о пропускной способности")
+	total := flag.Int("total", 10000, "число заказов в режиме -load")
+	duration := flag.Duration("duration", 0, "длительность прогона в режиме -load вместо -total")
+	concurrency := flag.Int("concurrency", 8, "число параллельных writer'ов в режиме -load")
+	batchSize := flag.Int("batch-size", 100, "размер пачки сообщений в режиме -load")
+	formatName := flag.String("format", codec.FormatJSON, "формат сообщений (json, protobuf); передаётся в заголовке content-type")
+	async := flag.Bool("async", false, "асинхронные writer'ы в режиме -load: WriteMessages не ждёт подтверждения, задержка считается до вызова Completion")
+	acksName := flag.String("acks", "none", "подтверждения, которых writer ждёт от брокеров: none, one или all")
+	strategyName := flag.String("partition-strategy", kafkaClient.PartitionKeyHash, "выбор партиции: key-hash (по хэшу order_uid), round-robin или explicit:N (все сообщения в партицию N)")
+	flag.Parse()
+
+	scenario, err := testorders.ParseScenario(*scenarioName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	format, err := codec.ByName(*formatName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	strategy, err := kafkaClient.ParsePartitionStrategy(*strategyName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	acks, err := kafkaClient.ParseRequiredAcks(*acksName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gen := testorders.NewGenerator(*seed)
+	gen.MaxItems = *maxItems
+
 	ctx := context.Background()
 
 	// Конфигурация Kafka
@@ -22,8 +60,19 @@ func main() {
 		GroupID: "test_producer",
 	}
 
-	writer := kafkaClient.NewWriter(kafkaCfg)
-	defer func(writer *kafka.Writer) {
+	if *load {
+		cfg := loadConfig{Total: *total, Duration: *duration, Concurrency: *concurrency, BatchSize: *batchSize, Acks: acks, Async: *async}
+		if err := runLoadMode(ctx, kafkaCfg, strategy, cfg, gen, scenario, format); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	kw := newWriter(kafkaCfg, strategy)
+	kw.RequiredAcks = acks
+	stats := kafkaClient.NewSendStats()
+	writer := kafkaClient.NewMeasuredWriter(kw, stats)
+	defer func(writer *kafkaClient.MeasuredWriter) {
 		err := writer.Close()
 		if err != nil {
 			log.Fatal(err)
@@ -31,25 +80,40 @@ func main() {
 	}(writer)
 
 	// Генерируем и отправляем тестовые заказы
-	for i := 0; i < 10; i++ {
-		orderJSON, err := GenerateTestOrderJSON()
+	start := time.Now()
+	for i := 0; i < *count; i++ {
+		msg, err := orderMessage(format, gen.Order(scenario))
 		if err != nil {
 			log.Printf("Error generating test order: %v", err)
 			continue
 		}
 
-		msg := kafka.Message{
-			Value: orderJSON,
-		}
-
+		sent := time.Now()
 		if err := writer.WriteMessages(ctx, msg); err != nil {
-			log.Printf("Error sending message: %v", err)
+			log.Printf("Error sending message (%s): %v", kafkaClient.SendErrorCode(err), err)
 		} else {
-			log.Printf("Test order %d sent successfully", i+1)
+			log.Printf("Test order %d (%s) confirmed in %s", i+1, scenario, time.Since(sent).Round(time.Microsecond))
 		}
 
 		time.Sleep(2 * time.Second)
 	}
 
-	log.Println("All test orders sent")
+	log.Printf("All test orders sent: %s", stats.Summary(time.Since(start)))
+}
+
+// newWriter - writer топика cfg.Topic, выбирающий партицию сообщений по стратегии strategy
+func newWriter(cfg kafkaClient.Config, strategy kafkaClient.PartitionStrategy) *kafka.Writer {
+	w := kafkaClient.NewWriter(cfg)
+	w.Balancer = strategy.Balancer()
+	return w
+}
+
+// orderMessage - сообщение Kafka с заказом в формате format и заголовком content-type этого формата.
+// Ключ сообщения - order_uid: при стратегии key-hash сообщения одного заказа попадают в одну партицию
+func orderMessage(format codec.Codec, order orders.Order) (kafka.Message, error) {
+	value, err := format.Encode(&order)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	return kafka.Message{Key: []byte(order.OrderUid), Value: value, Headers: []kafka.Header{codec.Header(format)}}, nil
 }
@@ -6,12 +6,16 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"l0_test_self/models/orders"
 	kafkaClient "l0_test_self/pkg/client/kafka"
+	"l0_test_self/pkg/codec"
+	"l0_test_self/pkg/testorders"
 	"testing"
 
 	"github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockWriter для тестирования Kafka writer
@@ -83,3 +87,57 @@ func TestMessageSending(t *testing.T) {
 	assert.Equal(t, testOrderJSON, msg.Value)
 	assert.Empty(t, msg.Key) // Ключ не устанавливается в коде
 }
+
+func TestNewWriterPartitionStrategy(t *testing.T) {
+	cfg := kafkaClient.Config{Brokers: []string{"localhost:9092"}, Topic: "orders"}
+	partitions := []int{0, 1, 2, 3, 4, 5}
+	order := testorders.NewGenerator(1).Order(testorders.ScenarioDefault)
+	msg, err := orderMessage(codec.JSON, order)
+	require.NoError(t, err)
+	assert.Equal(t, order.OrderUid, string(msg.Key), "messages are keyed by order_uid")
+
+	// key-hash: партиция определяется ключом и совпадает с вычисленной сервером
+	strategy, err := kafkaClient.ParsePartitionStrategy(kafkaClient.PartitionKeyHash)
+	require.NoError(t, err)
+	w := newWriter(cfg, strategy)
+	want := kafkaClient.PartitionForKey(msg.Key, len(partitions))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, want, w.Balancer.Balance(msg, partitions...))
+	}
+
+	// round-robin: сообщения с одним ключом расходятся по партициям
+	strategy, err = kafkaClient.ParsePartitionStrategy(kafkaClient.PartitionRoundRobin)
+	require.NoError(t, err)
+	w = newWriter(cfg, strategy)
+	seen := make(map[int]bool)
+	for range partitions {
+		seen[w.Balancer.Balance(msg, partitions...)] = true
+	}
+	assert.Len(t, seen, len(partitions))
+
+	// explicit:N: все сообщения в партицию N
+	strategy, err = kafkaClient.ParsePartitionStrategy("explicit:4")
+	require.NoError(t, err)
+	w = newWriter(cfg, strategy)
+	for _, key := range []string{"a", "b", "c"} {
+		assert.Equal(t, 4, w.Balancer.Balance(kafka.Message{Key: []byte(key)}, partitions...))
+	}
+}
+
+// TestOrderMessageMatchesSchema - контракт с консьюмером: сообщения продюсера во всех сценариях соответствуют
+// схеме заказа сервера (orders.OrderSchema), поэтому переименование поля заказа обнаруживается до отправки
+func TestOrderMessageMatchesSchema(t *testing.T) {
+	schema := orders.OrderSchema()
+	gen := testorders.NewGenerator(182)
+	for _, scenario := range testorders.Scenarios() {
+		msg, err := orderMessage(codec.JSON, gen.Order(scenario))
+		require.NoError(t, err)
+		assert.NoError(t, schema.Validate(msg.Value), scenario)
+	}
+	msg := orderMessageSource(gen, testorders.ScenarioDefault, codec.JSON)()
+	assert.NoError(t, schema.Validate(msg.Value))
+
+	orderJSON, err := GenerateTestOrderJSON()
+	require.NoError(t, err)
+	assert.NoError(t, schema.Validate(orderJSON))
+}
@@ -0,0 +1,133 @@
+// Описание: Подтверждения записи заказов: после записи заказа в базу данных и кэш консьюмер публикует событие
+// в топик kafka.topics.order_ack. Публикация повторяется ограниченное число раз и не мешает коммиту смещений:
+// неудачи только учитываются в метриках и журнале ошибок консьюмера
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/jsonpool"
+	"l0_test_self/internal/metrics"
+	"l0_test_self/pkg/codec"
+
+	kafka2 "github.com/segmentio/kafka-go"
+)
+
+const (
+	// defaultOrderAckAttempts - попытки публикации, если kafka.consumer.order_ack.attempts не задан
+	defaultOrderAckAttempts = 3
+	// defaultOrderAckAttemptTimeout - ограничение одной попытки, если kafka.consumer.order_ack.attempt_timeout не задан
+	defaultOrderAckAttemptTimeout = 2 * time.Second
+	// orderAckBackoff - пауза между попытками публикации
+	orderAckBackoff = 100 * time.Millisecond
+)
+
+// orderAck - событие подтверждения записи заказа в топике kafka.topics.order_ack
+type orderAck struct {
+	OrderUid   string    `json:"order_uid"`
+	Tenant     string    `json:"tenant"`
+	StoredAt   time.Time `json:"stored_at"`   // время записи заказа в базу данных
+	InstanceID string    `json:"instance_id"` // экземпляр консьюмера, записавший заказ
+	LatencyMs  int64     `json:"latency_ms"`  // задержка от публикации исходного сообщения до появления заказа в кэше
+}
+
+// orderAcker - публикация подтверждений записи заказов. nil выключает подтверждения
+type orderAcker struct {
+	writer     MessageWriter
+	instanceID string
+	attempts   int
+	timeout    time.Duration
+	backoff    time.Duration
+
+	sent   *metrics.Counter // опубликованные подтверждения
+	failed *metrics.Counter // подтверждения, не опубликованные за все попытки
+}
+
+// newOrderAcker - публикация подтверждений писателем writer по cfg; nil, если подтверждения выключены или писатель не создан
+func newOrderAcker(cfg config.OrderAckConfig, writer MessageWriter) *orderAcker {
+	if !cfg.Enabled || writer == nil {
+		return nil
+	}
+	instanceID := cfg.InstanceID
+	if instanceID == "" {
+		instanceID, _ = os.Hostname()
+	}
+	attempts := cfg.Attempts
+	if attempts == 0 {
+		attempts = defaultOrderAckAttempts
+	}
+	timeout := cfg.AttemptTimeout
+	if timeout == 0 {
+		timeout = defaultOrderAckAttemptTimeout
+	}
+	return &orderAcker{
+		writer:     writer,
+		instanceID: instanceID,
+		attempts:   attempts,
+		timeout:    timeout,
+		backoff:    orderAckBackoff,
+		sent:       &metrics.Counter{},
+		failed:     &metrics.Counter{},
+	}
+}
+
+// register - регистрирует счётчики подтверждений в реестре метрик
+func (a *orderAcker) register(reg *metrics.Registry) {
+	if a == nil {
+		return
+	}
+	reg.RegisterCounter("order_acks_total", "Order acknowledgment events published to kafka.topics.order_ack.", a.sent)
+	reg.RegisterCounter("order_acks_failed_total", "Order acknowledgment events dropped after exhausting kafka.consumer.order_ack.attempts.", a.failed)
+}
+
+// event - подтверждение записи заказа orderUID арендатора tenantID
+func (a *orderAcker) event(tenantID, orderUID string, storedAt time.Time, latency time.Duration) orderAck {
+	return orderAck{OrderUid: orderUID, Tenant: tenantID, StoredAt: storedAt.UTC(), InstanceID: a.instanceID, LatencyMs: latency.Milliseconds()}
+}
+
+// publish - публикует подтверждения одной записью в Kafka, повторяя неудачную попытку не больше attempts раз.
+// Время публикации ограничено attempts попытками по timeout и паузами между ними, поэтому коммит смещений
+// задерживается не дольше этого бюджета.
+func (a *orderAcker) publish(ctx context.Context, acks []orderAck) error {
+	msgs := make([]kafka2.Message, 0, len(acks))
+	for _, ack := range acks {
+		value, err := jsonpool.Marshal(ack)
+		if err != nil {
+			a.failed.Add(uint64(len(acks)))
+			return fmt.Errorf("encode order ack: %w", err)
+		}
+		msgs = append(msgs, kafka2.Message{Key: []byte(ack.OrderUid), Value: value, Headers: []kafka2.Header{codec.Header(codec.JSON)}})
+	}
+
+	var err error
+	for attempt := 1; attempt <= a.attempts; attempt++ {
+		if attempt > 1 && !sleepCtx(ctx, clock.Real, a.backoff) {
+			break
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, a.timeout)
+		err = a.writer.WriteMessages(attemptCtx, msgs...)
+		cancel()
+		if err == nil {
+			a.sent.Add(uint64(len(acks)))
+			return nil
+		}
+	}
+	a.failed.Add(uint64(len(acks)))
+	return fmt.Errorf("%d attempts: %w", a.attempts, err)
+}
+
+// acknowledge - публикует подтверждения записи заказов, если они включены. Неудача только учитывается и логируется:
+// заказы уже записаны, а смещения их сообщений коммитятся. msg - сообщение единственного заказа или nil для пачки.
+func (c *consumer) acknowledge(ctx context.Context, msg *kafka2.Message, orderUID string, acks []orderAck) {
+	if c.acks == nil || len(acks) == 0 {
+		return
+	}
+	if err := c.acks.publish(ctx, acks); err != nil {
+		c.fail(stageAck, "ack", msg, orderUID, "order ack not published (orders=%d): %v", len(acks), err)
+	}
+}
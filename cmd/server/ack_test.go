@@ -0,0 +1,141 @@
+// Описание: Тесты подтверждений записи заказов: событие на каждый записанный заказ в режимах sync и batched,
+// отсутствие подтверждений пропущенных и отправленных в очередь недоставленных сообщений и обработка без подтверждений,
+// когда их не удаётся опубликовать
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestOrderAcker - подтверждения экземпляра consumer-1 с двумя попытками публикации
+func newTestOrderAcker(w MessageWriter) *orderAcker {
+	a := newOrderAcker(config.OrderAckConfig{Enabled: true, InstanceID: "consumer-1", Attempts: 2, AttemptTimeout: time.Second}, w)
+	a.backoff = time.Millisecond
+	return a
+}
+
+// ackedOrders - идентификаторы заказов опубликованных подтверждений по порядку; проверяет ключ и поля событий
+func ackedOrders(t *testing.T, w *fakeWriter) []string {
+	t.Helper()
+	var uids []string
+	for _, msg := range w.written() {
+		var ack orderAck
+		require.NoError(t, json.Unmarshal(msg.Value, &ack))
+		assert.Equal(t, ack.OrderUid, string(msg.Key), "acks are keyed by order_uid")
+		assert.Equal(t, tenant.Default, ack.Tenant)
+		assert.Equal(t, "consumer-1", ack.InstanceID)
+		assert.False(t, ack.StoredAt.IsZero())
+		assert.GreaterOrEqual(t, ack.LatencyMs, int64(0))
+		uids = append(uids, ack.OrderUid)
+	}
+	return uids
+}
+
+// ackTestMessages - четыре сообщения: два заказа, некорректное сообщение и заказ poison, запись которого не удаётся
+func ackTestMessages(t *testing.T) ([]kafka2.Message, map[int64]string, *fakeRepository) {
+	msgs, uids := newOrderMessages(t, 31, 3)
+	msgs = append(msgs, kafka2.Message{Topic: "orders", Offset: 3, Value: []byte("not json")})
+	repo := &fakeRepository{poisonUIDs: map[string]bool{uids[1]: true}}
+	return msgs, uids, repo
+}
+
+func TestConsumerPublishesOrderAcks(t *testing.T) {
+	for _, mode := range []string{config.PipelineModeSync, config.PipelineModeBatched} {
+		t.Run(mode, func(t *testing.T) {
+			msgs, uids, repo := ackTestMessages(t)
+			reader := &sliceReader{msgs: msgs}
+			cfg := newConsumerTestConfig()
+			if mode == config.PipelineModeBatched {
+				cfg = newBatchedTestConfig(4, time.Hour)
+			}
+			cfg = withMaxAttempts(cfg, 1)
+			acks := &fakeWriter{}
+			monitor := newConsumerMonitor(cfg)
+			monitor.acks = newTestOrderAcker(acks)
+			ctx, cancel := context.WithCancel(context.Background())
+			wg := startKafkaConsumer(ctx, reader, &fakeWriter{}, repo, newTestCache(t), newTestLogger(), cfg, monitor)
+
+			require.Eventually(t, func() bool { return len(reader.committedOffsets()) == 4 }, 5*time.Second, time.Millisecond)
+			cancel()
+			wg.Wait()
+
+			got := ackedOrders(t, acks)
+			sort.Strings(got)
+			want := []string{uids[0], uids[2]}
+			sort.Strings(want)
+			assert.Equal(t, want, got, "one ack per stored order, none for the invalid and the dead-lettered message")
+			assert.Equal(t, uint64(1), monitor.poison.Value())
+			assert.Equal(t, uint64(2), monitor.acks.sent.Value())
+		})
+	}
+}
+
+func TestConsumerSkipsAckOfRecentDuplicate(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 32, 1)
+	dup := msgs[0]
+	dup.Offset = 1
+	reader := &sliceReader{msgs: append(msgs, dup)}
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.Consumer.RecentOrdersSize = 10
+	cfg.Kafka.Consumer.RecentOrdersWindow = time.Minute
+	acks := &fakeWriter{}
+	monitor := newConsumerMonitor(cfg)
+	monitor.acks = newTestOrderAcker(acks)
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, &fakeRepository{}, newTestCache(t), newTestLogger(), cfg, monitor)
+
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) == 2 }, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+	assert.Equal(t, []string{uids[0]}, ackedOrders(t, acks))
+}
+
+func TestOrderAckFailureDoesNotFailProcessing(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 33, 3)
+	repo := &fakeRepository{}
+	reader := &sliceReader{msgs: msgs}
+	reader.onCommit = requireStoredBeforeCommit(t, repo, uids)
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.Consumer.ErrorBufferSize = 16
+	acks := &fakeWriter{err: errors.New("kafka: leader not available")}
+	monitor := newConsumerMonitor(cfg)
+	monitor.acks = newTestOrderAcker(acks)
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), cfg, monitor)
+
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) == 3 }, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	_, stored := repo.stats()
+	assert.Equal(t, 3, stored)
+	assert.Empty(t, acks.written())
+	assert.Equal(t, uint64(3), monitor.acks.failed.Value())
+	assert.Zero(t, monitor.acks.sent.Value())
+	entries := monitor.errors.Entries(stageAck)
+	require.Len(t, entries, 3)
+	assert.Equal(t, uids[0], entries[0].OrderUid)
+	assert.Contains(t, entries[0].Message, "2 attempts")
+}
+
+func TestOrderAcksDisabled(t *testing.T) {
+	assert.Nil(t, newOrderAcker(config.OrderAckConfig{}, &fakeWriter{}))
+	assert.Nil(t, newOrderAcker(config.OrderAckConfig{Enabled: true}, nil))
+	a := newOrderAcker(config.OrderAckConfig{Enabled: true}, &fakeWriter{})
+	require.NotNil(t, a)
+	assert.Equal(t, defaultOrderAckAttempts, a.attempts)
+	assert.Equal(t, defaultOrderAckAttemptTimeout, a.timeout)
+	assert.NotEmpty(t, a.instanceID, "the host name by default")
+}
@@ -0,0 +1,1070 @@
+// Описание: Административные HTTP обработчики сервера
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"l0_test_self/internal/breaker"
+	"l0_test_self/internal/cache"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/diff"
+	"l0_test_self/internal/goroutines"
+	"l0_test_self/internal/ids"
+	"l0_test_self/internal/leader"
+	"l0_test_self/internal/logging"
+	"l0_test_self/internal/ratelimit"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/internal/validation"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/buildinfo"
+	"l0_test_self/pkg/client/postgres"
+)
+
+// makeOrderRefreshHandler - HTTP обработчик, принудительно перечитывающий заказ из базы данных в кэш.
+// Если заказа больше нет в базе, запись удаляется из кэша и возвращается 404.
+func makeOrderRefreshHandler(repo OrderRepository, orderCache OrderCache, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		id, err := ids.Parse(r.PathValue("id"))
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeOrderIDInvalid)
+			return
+		}
+		orderID := id.String()
+
+		// Версия — момент начала чтения: запись консьюмера, зафиксированная позже, не будет перезаписана
+		version := time.Now().UnixNano()
+		tenantID := tenantFromContext(r.Context())
+		order, err := repo.GetOrderByUID(withPrimaryRead(r.Context()), tenantID, orderID)
+		if err != nil {
+			if errors.Is(err, postgres.ErrOrderNotFound) {
+				orderCache.Delete(tenantID, orderID)
+				logger.Printf("[%s] refresh: order %s not found in db, cache entry removed", reqID, orderID)
+				writeAPIError(w, r, http.StatusNotFound, errCodeOrderNotFound)
+				return
+			}
+			logger.Printf("[%s] refresh: db error (order=%s): %v", reqID, orderID, err)
+			if !writeUnavailable(w, r, err) {
+				writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			}
+			return
+		}
+
+		if orderCache.SetIfNewer(tenantID, order, version) {
+			logger.Printf("[%s] refresh: order %s reloaded into cache", reqID, orderID)
+		} else {
+			logger.Printf("[%s] refresh: order %s has a newer cached version, kept it", reqID, orderID)
+			if cached, ok := orderCache.Get(tenantID, orderID); ok {
+				order = cached
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(adminOrder{order}); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+		}
+	}
+}
+
+// orderETag - ETag заказа: время его последнего изменения в базе данных
+func orderETag(o orders.Order) string {
+	return strconv.Quote(o.UpdatedAt.UTC().Format(time.RFC3339Nano))
+}
+
+// parseIfMatch - разбирает заголовок If-Match со значением ETag заказа; кавычки необязательны
+func parseIfMatch(value string) (time.Time, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// deliveryPatch - частичное изменение доставки заказа: заданные поля заменяют текущие значения
+type deliveryPatch struct {
+	Name    *string `json:"name"`
+	Phone   *string `json:"phone"`
+	Zip     *string `json:"zip"`
+	City    *string `json:"city"`
+	Address *string `json:"address"`
+	Region  *string `json:"region"`
+	Email   *string `json:"email"`
+}
+
+// apply - возвращает доставку d с полями, заданными в изменении
+func (p deliveryPatch) apply(d orders.Delivery) orders.Delivery {
+	for _, f := range []struct {
+		dst *string
+		src *string
+	}{
+		{&d.Name, p.Name}, {&d.Phone, p.Phone}, {&d.Zip, p.Zip}, {&d.City, p.City},
+		{&d.Address, p.Address}, {&d.Region, p.Region}, {&d.Email, p.Email},
+	} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	return d
+}
+
+// makeOrderDeliveryPatchHandler - HTTP обработчик, изменяющий доставку заказа. Заголовок If-Match обязателен и должен
+// содержать ETag заказа (его updated_at): если заказ изменён после чтения клиентом, возвращается 412 и изменение
+// не применяется. После изменения заказ обновляется в кэше, а новый ETag возвращается в ответе. Прежняя доставка
+// попадает в историю с идентификатором ключа API запроса (apiKeyID).
+func makeOrderDeliveryPatchHandler(repo OrderRepository, orderCache OrderCache, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		id, err := ids.Parse(r.PathValue("id"))
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeOrderIDInvalid)
+			return
+		}
+		orderID := id.String()
+		ifMatch := r.Header.Get("If-Match")
+		if ifMatch == "" || ifMatch == "*" {
+			writeAPIError(w, r, http.StatusPreconditionRequired, errCodeIfMatchRequired)
+			return
+		}
+		expected, err := parseIfMatch(ifMatch)
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeIfMatchInvalid)
+			return
+		}
+
+		var patch deliveryPatch
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&patch); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeRequestBodyInvalid, err)
+			return
+		}
+
+		// Версия — момент начала чтения: запись консьюмера, зафиксированная позже, не будет перезаписана
+		version := time.Now().UnixNano()
+		tenantID := tenantFromContext(r.Context())
+		order, err := repo.GetOrderByUID(withPrimaryRead(r.Context()), tenantID, orderID)
+		if err != nil {
+			if errors.Is(err, postgres.ErrOrderNotFound) {
+				writeAPIError(w, r, http.StatusNotFound, errCodeOrderNotFound)
+				return
+			}
+			logger.Printf("[%s] delivery patch: db error (order=%s): %v", reqID, orderID, err)
+			if !writeUnavailable(w, r, err) {
+				writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			}
+			return
+		}
+		if !order.UpdatedAt.Equal(expected) {
+			w.Header().Set("ETag", orderETag(order))
+			writeAPIError(w, r, http.StatusPreconditionFailed, errCodeOrderModified)
+			return
+		}
+
+		delivery := patch.apply(order.Delivery)
+		if err := validation.ValidateDelivery(delivery); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeOrderInvalid, err)
+			return
+		}
+
+		updatedAt, err := repo.UpdateDelivery(r.Context(), tenantID, orderID, expected, delivery, apiKeyID(requestAPIKey(r)))
+		switch {
+		case errors.Is(err, postgres.ErrConflict):
+			logger.Printf("[%s] delivery patch: order %s modified concurrently", reqID, orderID)
+			writeAPIError(w, r, http.StatusPreconditionFailed, errCodeOrderModified)
+			return
+		case errors.Is(err, postgres.ErrOrderNotFound):
+			writeAPIError(w, r, http.StatusNotFound, errCodeOrderNotFound)
+			return
+		case err != nil:
+			logger.Printf("[%s] delivery patch: db error (order=%s): %v", reqID, orderID, err)
+			if !writeUnavailable(w, r, err) {
+				writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			}
+			return
+		}
+
+		order.Delivery, order.UpdatedAt = delivery, updatedAt
+		orderCache.SetIfNewer(tenantID, order, version)
+		logger.Printf("[%s] delivery patch: order %s delivery updated", reqID, orderID)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", orderETag(order))
+		if err := json.NewEncoder(w).Encode(adminOrder{order}); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+		}
+	}
+}
+
+// deliveryHistoryResponse - ответ эндпоинта истории доставки заказа
+type deliveryHistoryResponse struct {
+	OrderUid string                    `json:"order_uid"`
+	Changes  []postgres.DeliveryChange `json:"changes"` // от старых изменений к новым
+}
+
+// makeDeliveryHistoryHandler - HTTP обработчик, возвращающий историю доставки заказа: значения доставки до каждого
+// изменения, время изменения и его автора (идентификатор ключа API или postgres.ChangedByOrderUpdate)
+func makeDeliveryHistoryHandler(repo OrderRepository, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		id, err := ids.Parse(r.PathValue("id"))
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeOrderIDInvalid)
+			return
+		}
+		orderID := id.String()
+
+		changes, err := repo.ListDeliveryHistory(r.Context(), tenantFromContext(r.Context()), orderID)
+		if err != nil {
+			if errors.Is(err, postgres.ErrOrderNotFound) {
+				writeAPIError(w, r, http.StatusNotFound, errCodeOrderNotFound)
+				return
+			}
+			logger.Printf("[%s] delivery history: db error (order=%s): %v", reqID, orderID, err)
+			if !writeUnavailable(w, r, err) {
+				writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			}
+			return
+		}
+		if changes == nil {
+			changes = []postgres.DeliveryChange{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(deliveryHistoryResponse{OrderUid: orderID, Changes: changes}); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+		}
+	}
+}
+
+// orderDiffResponse - ответ эндпоинта сравнения заказа в кэше и в базе данных
+type orderDiffResponse struct {
+	OrderUid    string            `json:"order_uid"`
+	InSync      bool              `json:"in_sync"`
+	InCache     bool              `json:"in_cache"`
+	InDB        bool              `json:"in_db"`
+	Differences []orderDifference `json:"differences"`
+}
+
+// orderDifference - различие заказа в одном поле; kind added — поле есть только в базе данных, removed — только в кэше
+type orderDifference struct {
+	Path   string    `json:"path"`
+	Kind   diff.Kind `json:"kind"`
+	Cached any       `json:"cached"`
+	Stored any       `json:"stored"`
+}
+
+// makeOrderDiffHandler - HTTP обработчик, сравнивающий заказ в кэше с заказом в базе данных.
+// Заказ, которого нет с одной из сторон, не совпадает (in_cache/in_db); если его нет нигде, возвращается 404.
+func makeOrderDiffHandler(repo OrderRepository, orderCache OrderCache, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		id, err := ids.Parse(r.PathValue("id"))
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeOrderIDInvalid)
+			return
+		}
+		orderID := id.String()
+
+		tenantID := tenantFromContext(r.Context())
+		cached, inCache := orderCache.Get(tenantID, orderID)
+		stored, err := repo.GetOrderByUID(withPrimaryRead(r.Context()), tenantID, orderID)
+		inDB := err == nil
+		if err != nil && !errors.Is(err, postgres.ErrOrderNotFound) {
+			logger.Printf("[%s] diff: db error (order=%s): %v", reqID, orderID, err)
+			if !writeUnavailable(w, r, err) {
+				writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			}
+			return
+		}
+		if !inCache && !inDB {
+			writeAPIError(w, r, http.StatusNotFound, errCodeOrderNotFound)
+			return
+		}
+
+		resp := orderDiffResponse{OrderUid: orderID, InCache: inCache, InDB: inDB, Differences: []orderDifference{}}
+		if inCache && inDB {
+			diffs, err := diff.Compare(utcTimes(cached), utcTimes(stored))
+			if err != nil {
+				logger.Printf("[%s] diff: compare error (order=%s): %v", reqID, orderID, err)
+				writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+				return
+			}
+			for _, d := range diffs {
+				resp.Differences = append(resp.Differences, orderDifference{Path: d.Path, Kind: d.Kind, Cached: d.A, Stored: d.B})
+			}
+			resp.InSync = len(diffs) == 0
+		}
+		logger.Printf("[%s] diff: order %s in_cache=%t in_db=%t differences=%d", reqID, orderID, inCache, inDB, len(resp.Differences))
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+		}
+	}
+}
+
+// utcTimes - приводит время заказа к UTC: заказ из сообщения хранит часовой пояс продюсера, а из базы данных —
+// часовой пояс соединения, и один и тот же момент не должен считаться различием
+func utcTimes(o orders.Order) orders.Order {
+	o.DateCreated = o.DateCreated.UTC()
+	o.StoredAt = o.StoredAt.UTC()
+	o.UpdatedAt = o.UpdatedAt.UTC()
+	return o
+}
+
+const (
+	defaultCacheKeysLimit = 100
+	maxCacheKeysLimit     = 10000
+)
+
+// cacheKeysResponse - ответ эндпоинта со списком ключей кэша
+type cacheKeysResponse struct {
+	Total int      `json:"total"`
+	Keys  []string `json:"keys"`
+}
+
+// makeCacheKeysHandler - HTTP обработчик, возвращающий число заказов арендатора запроса в кэше и до limit их
+// идентификаторов (слабо согласованный снимок)
+func makeCacheKeysHandler(orderCache OrderCache, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultCacheKeysLimit
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 || n > maxCacheKeysLimit {
+				writeAPIError(w, r, http.StatusBadRequest, errCodeLimitInvalid, maxCacheKeysLimit)
+				return
+			}
+			limit = n
+		}
+
+		tenantID := tenantFromContext(r.Context())
+		resp := cacheKeysResponse{Keys: make([]string, 0, limit)}
+		orderCache.Range(func(t, id string, _ orders.Order) bool {
+			if t != tenantID {
+				return true
+			}
+			resp.Total++
+			if len(resp.Keys) < limit {
+				resp.Keys = append(resp.Keys, id)
+			}
+			return true
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", requestIDFromContext(r.Context()), err)
+		}
+	}
+}
+
+// resizableCache - кэш, число шардов которого можно изменить во время работы
+type resizableCache interface {
+	ShardCount() int
+	Resize(shardCount int) error
+}
+
+// cacheResizeResponse - ответ эндпоинта изменения числа шардов кэша
+type cacheResizeResponse struct {
+	Previous   int   `json:"previous"`
+	ShardCount int   `json:"shard_count"`
+	Entries    int   `json:"entries"`
+	DurationMs int64 `json:"duration_ms"`
+}
+
+// makeCacheResizeHandler - HTTP обработчик, перестраивающий кэш под число шардов из параметра shard_count
+// (число или auto; без параметра — значение cache.shard_count из конфигурации). Перестройка приостанавливает
+// все обращения к кэшу, поэтому вызывается только при изменении настройки.
+func makeCacheResizeHandler(orderCache OrderCache, configured config.ShardCount, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		rc, ok := orderCache.(resizableCache)
+		if !ok {
+			writeAPIError(w, r, http.StatusNotImplemented, errCodeCacheResizeUnsupported)
+			return
+		}
+
+		shards := configured
+		if raw := r.URL.Query().Get("shard_count"); raw != "" {
+			n, err := config.ParseShardCount(raw)
+			if err != nil {
+				writeAPIError(w, r, http.StatusBadRequest, errCodeShardCountInvalid, err)
+				return
+			}
+			shards = n
+		}
+
+		resp := cacheResizeResponse{Previous: rc.ShardCount()}
+		start := time.Now()
+		if err := rc.Resize(shards.Resolve()); err != nil {
+			logger.Printf("[%s] cache resize error: %v", reqID, err)
+			writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			return
+		}
+		resp.DurationMs = time.Since(start).Milliseconds()
+		resp.ShardCount = rc.ShardCount()
+		resp.Entries = orderCache.Len()
+		logger.Printf("[%s] cache resized from %d to %d shards (%d entries) in %s", reqID, resp.Previous, resp.ShardCount,
+			resp.Entries, time.Since(start).Round(time.Microsecond))
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+		}
+	}
+}
+
+// cleanableCache - кэш, проход очистки которого можно запустить вручную
+type cleanableCache interface {
+	RunCleanup() (cache.CleanupReport, error)
+}
+
+// shardCleanupResponse - результат очистки одного шарда в ответе POST /admin/cache/cleanup
+type shardCleanupResponse struct {
+	Shard      int     `json:"shard"`
+	Expired    int     `json:"expired"`
+	Evicted    int     `json:"evicted"`
+	Demoted    int     `json:"demoted"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// cacheCleanupResponse - ответ эндпоинта ручной очистки кэша
+type cacheCleanupResponse struct {
+	Expired    int                    `json:"expired"`
+	Evicted    int                    `json:"evicted"`
+	Demoted    int                    `json:"demoted"`
+	Entries    int                    `json:"entries"` // записей после очистки
+	DurationMs float64                `json:"duration_ms"`
+	Shards     []shardCleanupResponse `json:"shards"`
+}
+
+// makeCacheCleanupHandler - HTTP обработчик, синхронно выполняющий проход очистки кэша (устаревание по TTL,
+// вытеснение сверх лимита, понижение холодных записей) и возвращающий его итоги по шардам. Если очистка уже
+// выполняется, фоновая или запущенная другим запросом, отвечает 409.
+func makeCacheCleanupHandler(orderCache OrderCache, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		cc, ok := orderCache.(cleanableCache)
+		if !ok {
+			writeAPIError(w, r, http.StatusNotImplemented, errCodeCacheCleanupUnsupported)
+			return
+		}
+
+		report, err := cc.RunCleanup()
+		if errors.Is(err, cache.ErrCleanupRunning) {
+			writeAPIError(w, r, http.StatusConflict, errCodeCacheCleanupRunning)
+			return
+		}
+		if err != nil {
+			logger.Printf("[%s] cache cleanup error: %v", reqID, err)
+			writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			return
+		}
+		resp := cacheCleanupResponse{
+			Expired:    report.Expired,
+			Evicted:    report.Evicted,
+			Demoted:    report.Demoted,
+			Entries:    orderCache.Len(),
+			DurationMs: durationMs(report.Duration),
+			Shards:     make([]shardCleanupResponse, 0, len(report.Shards)),
+		}
+		for _, sc := range report.Shards {
+			resp.Shards = append(resp.Shards, shardCleanupResponse{Shard: sc.Shard, Expired: sc.Expired, Evicted: sc.Evicted,
+				Demoted: sc.Demoted, DurationMs: durationMs(sc.Duration)})
+		}
+		logger.Printf("[%s] cache cleanup: %d expired, %d evicted, %d demoted in %s", reqID, report.Expired, report.Evicted,
+			report.Demoted, report.Duration.Round(time.Microsecond))
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+		}
+	}
+}
+
+// pinnableCache - кэш, записи которого можно закрепить от вытеснения по LRU и TTL
+type pinnableCache interface {
+	Pin(tenantID, id string) error
+	Unpin(tenantID, id string) bool
+	Pinned() []string
+	MaxPinned() int
+}
+
+// makeCachePinHandler - HTTP обработчик, закрепляющий заказ арендатора запроса в кэше (POST /admin/cache/{id}/pin),
+// чтобы он не вытеснялся, пока его изучают. Отсутствующий в кэше заказ сначала загружается из базы данных.
+func makeCachePinHandler(repo OrderRepository, orderCache OrderCache, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		pc, ok := orderCache.(pinnableCache)
+		if !ok {
+			writeAPIError(w, r, http.StatusNotImplemented, errCodeCachePinUnsupported)
+			return
+		}
+		id, err := ids.Parse(r.PathValue("id"))
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeOrderIDInvalid)
+			return
+		}
+		orderID := id.String()
+		tenantID := tenantFromContext(r.Context())
+
+		err = pc.Pin(tenantID, orderID)
+		if errors.Is(err, cache.ErrNotCached) {
+			// Как и при refresh, версия — момент начала чтения, чтобы не перезаписать более новую запись консьюмера
+			version := time.Now().UnixNano()
+			order, dbErr := repo.GetOrderByUID(withPrimaryRead(r.Context()), tenantID, orderID)
+			if dbErr != nil {
+				if errors.Is(dbErr, postgres.ErrOrderNotFound) {
+					writeAPIError(w, r, http.StatusNotFound, errCodeOrderNotFound)
+					return
+				}
+				logger.Printf("[%s] cache pin: db error (order=%s): %v", reqID, orderID, dbErr)
+				if !writeUnavailable(w, r, dbErr) {
+					writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+				}
+				return
+			}
+			orderCache.SetIfNewer(tenantID, order, version)
+			err = pc.Pin(tenantID, orderID)
+		}
+		switch {
+		case errors.Is(err, cache.ErrPinLimit):
+			writeAPIError(w, r, http.StatusConflict, errCodePinLimitReached, pc.MaxPinned())
+			return
+		case err != nil:
+			logger.Printf("[%s] cache pin error (order=%s): %v", reqID, orderID, err)
+			writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			return
+		}
+		logger.Printf("[%s] cache: order %s pinned", reqID, tenant.Key(tenantID, orderID))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// makeCacheUnpinHandler - HTTP обработчик, снимающий закрепление заказа арендатора запроса в кэше
+// (DELETE /admin/cache/{id}/pin); 404 — заказ не был закреплён.
+func makeCacheUnpinHandler(orderCache OrderCache, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pc, ok := orderCache.(pinnableCache)
+		if !ok {
+			writeAPIError(w, r, http.StatusNotImplemented, errCodeCachePinUnsupported)
+			return
+		}
+		id, err := ids.Parse(r.PathValue("id"))
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeOrderIDInvalid)
+			return
+		}
+		tenantID := tenantFromContext(r.Context())
+		if !pc.Unpin(tenantID, id.String()) {
+			writeAPIError(w, r, http.StatusNotFound, errCodeOrderNotPinned)
+			return
+		}
+		logger.Printf("[%s] cache: order %s unpinned", requestIDFromContext(r.Context()), tenant.Key(tenantID, id.String()))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// cacheStatsResponse - ответ эндпоинта состояния кэша
+type cacheStatsResponse struct {
+	Status     string       `json:"status"` // enabled или disabled (cache.enabled, POST /admin/cache/disable)
+	Entries    int          `json:"entries"`
+	ShardCount int          `json:"shard_count,omitempty"`
+	Pinned     []string     `json:"pinned"`
+	MaxPinned  int          `json:"max_pinned,omitempty"`
+	Shadow     *shadowStats `json:"shadow,omitempty"` // теневая проверка (cache.shadow_verify_rate), если включена
+
+	Demotion *cache.DemotionStats `json:"demotion,omitempty"` // понижение записей до заголовка (cache.demote_after), если включено
+	Balance  *cache.Stats         `json:"balance,omitempty"`  // распределение по шардам; список шардов — только с detail=shards
+}
+
+// shardStatsCache - кэш, сообщающий распределение записей и обращений по шардам
+type shardStatsCache interface {
+	Stats() cache.Stats
+}
+
+// demotingCache - кэш, понижающий записи без обращений до заголовка заказа
+type demotingCache interface {
+	DemoteAfter() time.Duration
+	DemotionStats() cache.DemotionStats
+}
+
+// Состояния кэша в ответе GET /admin/cache/stats.
+const (
+	cacheStatusEnabled  = "enabled"
+	cacheStatusDisabled = "disabled" // кэш выключен: остальные поля ответа пусты
+)
+
+// makeCacheStatsHandler - HTTP обработчик, возвращающий состояние кэша, число записей и шардов кэша и закреплённые заказы
+// всех арендаторов (ключи вида <арендатор>/<order_uid>), счётчики понижения записей и теневой проверки shadow,
+// неравномерность распределения по шардам и, с параметром detail=shards, записи и обращения каждого шарда
+func makeCacheStatsHandler(orderCache OrderCache, shadow *shadowVerifier, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		detail := r.URL.Query().Get("detail")
+		if detail != "" && detail != "shards" {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeDetailInvalid)
+			return
+		}
+		resp := cacheStatsResponse{Status: cacheStatusEnabled, Entries: orderCache.Len(), Pinned: []string{}, Shadow: shadow.stats()}
+		if sc, ok := orderCache.(switchingCache); ok && !sc.Enabled() {
+			resp.Status = cacheStatusDisabled
+			writeCacheStats(w, r, resp, logger)
+			return
+		}
+		if rc, ok := orderCache.(resizableCache); ok {
+			resp.ShardCount = rc.ShardCount()
+		}
+		if pc, ok := orderCache.(pinnableCache); ok {
+			if pinned := pc.Pinned(); pinned != nil {
+				resp.Pinned = pinned
+			}
+			resp.MaxPinned = pc.MaxPinned()
+		}
+		if dc, ok := orderCache.(demotingCache); ok && dc.DemoteAfter() > 0 {
+			stats := dc.DemotionStats()
+			resp.Demotion = &stats
+		}
+		if sc, ok := orderCache.(shardStatsCache); ok {
+			stats := sc.Stats()
+			if detail != "shards" {
+				stats.Shards = nil
+			}
+			resp.Balance = &stats
+		}
+		writeCacheStats(w, r, resp, logger)
+	}
+}
+
+// writeCacheStats - записывает ответ GET /admin/cache/stats
+func writeCacheStats(w http.ResponseWriter, r *http.Request, resp cacheStatsResponse, logger *log.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Printf("[%s] encode error: %v", requestIDFromContext(r.Context()), err)
+	}
+}
+
+// versionResponse - ответ эндпоинта с информацией о сборке и используемых зависимостях
+type versionResponse struct {
+	Build           buildinfo.Info `json:"build"`
+	PostgresVersion string         `json:"postgres_version,omitempty"`
+	PostgresError   string         `json:"postgres_error,omitempty"`
+	KafkaBrokers    []string       `json:"kafka_brokers"`
+	Instance        string         `json:"instance"`
+	Leadership      *leader.Status `json:"leadership,omitempty"` // состояние лидерства; пусто, если лидер не выбирается
+}
+
+// makeVersionHandler - HTTP обработчик, возвращающий метаданные сборки, версию сервера PostgreSQL, список брокеров Kafka,
+// идентификатор экземпляра и, если лидер выбирается (elector не nil), состояние лидерства экземпляра
+func makeVersionHandler(dbVersion func(ctx context.Context) (string, error), brokers []string, instance string, elector *leader.Elector, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		resp := versionResponse{
+			Build:        buildinfo.Get(),
+			KafkaBrokers: brokers,
+			Instance:     instance,
+		}
+		if elector != nil {
+			status := elector.Status()
+			resp.Leadership = &status
+		}
+		version, err := dbVersion(r.Context())
+		if err != nil {
+			logger.Printf("[%s] version: db error: %v", reqID, err)
+			resp.PostgresError = err.Error()
+		} else {
+			resp.PostgresVersion = version
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+		}
+	}
+}
+
+// defaultBreakdownRange - интервал статистики по умолчанию, если from не задан
+const defaultBreakdownRange = 24 * time.Hour
+
+// approxUSDNote - пояснение к approx_total_usd в ответе статистики
+const approxUSDNote = "approx_total_usd is an estimate at static admin.stats.usd_rates, not an accounting figure; currencies without a rate are listed in approx_unconverted and excluded"
+
+// breakdownResponse - ответ эндпоинта статистики заказов в разрезе ключа группировки
+type breakdownResponse struct {
+	By         string           `json:"by"`
+	From       time.Time        `json:"from"`
+	To         time.Time        `json:"to"`
+	Groups     []breakdownGroup `json:"groups"`
+	ApproxNote string           `json:"approx_note,omitempty"`
+}
+
+// breakdownGroup - группа статистики: количество заказов, суммы платежей по валютам и, если заданы курсы,
+// приблизительная сумма в долларах
+type breakdownGroup struct {
+	postgres.GroupCount
+	ApproxTotalUSD    *float64 `json:"approx_total_usd,omitempty"`
+	ApproxUnconverted []string `json:"approx_unconverted,omitempty"` // валюты без курса, не вошедшие в approx_total_usd
+}
+
+// newBreakdownGroup - группа статистики gc с приблизительной суммой по курсам rates (nil — без суммы)
+func newBreakdownGroup(gc postgres.GroupCount, rates map[string]float64) breakdownGroup {
+	if gc.Totals == nil {
+		gc.Totals = []postgres.CurrencyTotal{}
+	}
+	g := breakdownGroup{GroupCount: gc}
+	if rates == nil {
+		return g
+	}
+	var usd float64
+	for _, t := range gc.Totals {
+		rate, ok := rates[t.Currency]
+		if !ok {
+			g.ApproxUnconverted = append(g.ApproxUnconverted, t.Currency)
+			continue
+		}
+		usd += float64(t.Amount) * rate
+	}
+	usd = math.Round(usd*100) / 100
+	g.ApproxTotalUSD = &usd
+	return g
+}
+
+// makeBreakdownHandler - HTTP обработчик, возвращающий количество заказов за интервал [from, to), сгруппированных по ключу by,
+// и суммы их платежей по валютам. Если заданы курсы rates (admin.stats.usd_rates), к группам добавляется приблизительная
+// сумма в долларах.
+func makeBreakdownHandler(repo OrderRepository, rates map[string]float64, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		q := r.URL.Query()
+		by := q.Get("by")
+
+		to := time.Now()
+		if raw := q.Get("to"); raw != "" {
+			t, err := parseTimeParam(raw)
+			if err != nil {
+				writeAPIError(w, r, http.StatusBadRequest, errCodeTimeInvalid, "to")
+				return
+			}
+			to = t
+		}
+		from := to.Add(-defaultBreakdownRange)
+		if raw := q.Get("from"); raw != "" {
+			t, err := parseTimeParam(raw)
+			if err != nil {
+				writeAPIError(w, r, http.StatusBadRequest, errCodeTimeInvalid, "from")
+				return
+			}
+			from = t
+		}
+
+		groups, err := repo.CountOrdersBy(r.Context(), tenantFromContext(r.Context()), by, from, to)
+		if err != nil {
+			if errors.Is(err, postgres.ErrUnknownGroupKey) {
+				writeAPIError(w, r, http.StatusBadRequest, errCodeGroupKeyInvalid, by, strings.Join(postgres.BreakdownKeys(), ", "))
+				return
+			}
+			logger.Printf("[%s] breakdown: db error: %v", reqID, err)
+			if !writeUnavailable(w, r, err) {
+				writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			}
+			return
+		}
+		resp := breakdownResponse{By: by, From: from, To: to, Groups: make([]breakdownGroup, 0, len(groups))}
+		for _, gc := range groups {
+			resp.Groups = append(resp.Groups, newBreakdownGroup(gc, rates))
+		}
+		if rates != nil {
+			resp.ApproxNote = approxUSDNote
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+		}
+	}
+}
+
+// consumerStatusResponse - ответ эндпоинта состояния обработки заказов
+type consumerStatusResponse struct {
+	PipelineMode  string           `json:"pipeline_mode"`
+	DBReadBreaker breaker.Snapshot `json:"db_read_breaker"`
+	E2ELatency    *latencyStatus   `json:"e2e_latency,omitempty"` // нет в режиме api: заказы из Kafka не читаются
+	// ThrottledCustomers - покупатели (арендатор/customer_id) с наибольшим числом заказов сверх kafka.consumer.customer_limit
+	ThrottledCustomers []ratelimit.Offender `json:"throttled_customers,omitempty"`
+	// CacheOnIngest - сколько полученных заказов помещено в кэш и сколько пропущено по pipeline.cache_on_ingest
+	CacheOnIngest *ingestCacheStatus `json:"cache_on_ingest,omitempty"`
+	// StartupGap - заказы последних закоммиченных сообщений, не найденные в базе при запуске (pipeline.startup_gap_check)
+	StartupGap *startupGapReport `json:"startup_gap,omitempty"`
+}
+
+// makeConsumerStatusHandler - HTTP обработчик, возвращающий режим записи консьюмера, состояние выключателя чтений
+// из базы данных, p99 задержки обработки заказов (latency равен nil, если процесс не читает Kafka), покупателей,
+// чаще всего превышавших ограничение частоты заказов (throttle равен nil, если ограничение выключено), и решения
+// о кэшировании полученных заказов (ingest равен nil, если процесс не читает Kafka), а также результат проверки
+// разрыва при запуске (gap равен nil, если проверка не выполнялась)
+func makeConsumerStatusHandler(pipelineMode string, readBreaker *breaker.Breaker, latency *latencyMonitor, throttle *customerThrottle, ingest *ingestCache, gap *startupGapReport, logger *log.Logger) http.HandlerFunc {
+	if pipelineMode == "" {
+		pipelineMode = config.PipelineModeSync
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := consumerStatusResponse{PipelineMode: pipelineMode, DBReadBreaker: readBreaker.Snapshot(), ThrottledCustomers: throttle.top(), StartupGap: gap}
+		if latency != nil {
+			status := latency.status()
+			resp.E2ELatency = &status
+		}
+		if ingest != nil {
+			status := ingest.status()
+			resp.CacheOnIngest = &status
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", requestIDFromContext(r.Context()), err)
+		}
+	}
+}
+
+// errorStages - этапы обработки, по которым можно отфильтровать GET /admin/errors
+var errorStages = []string{stageFetch, stageDecode, stageValidate, stageStore, stageCommit, stageAudit, stageSkip, stageAck}
+
+// errorsResponse - ответ эндпоинта последних ошибок обработки
+type errorsResponse struct {
+	Size   int                  `json:"size"`  // вместимость буфера (kafka.consumer.error_buffer_size)
+	Total  uint64               `json:"total"` // ошибок с запуска, включая вытесненные из буфера
+	Errors []logging.ErrorEntry `json:"errors"`
+}
+
+// makeErrorsHandler - HTTP обработчик, возвращающий последние ошибки обработки сообщений от старых к новым.
+// Параметр stage оставляет ошибки одного этапа обработки.
+func makeErrorsHandler(ring *logging.ErrorRing, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stage := r.URL.Query().Get("stage")
+		if stage != "" && !slices.Contains(errorStages, stage) {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeStageInvalid, stage, strings.Join(errorStages, ", "))
+			return
+		}
+
+		resp := errorsResponse{Size: ring.Size(), Total: ring.Total(), Errors: ring.Entries(stage)}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", requestIDFromContext(r.Context()), err)
+		}
+	}
+}
+
+// makeErrorsClearHandler - HTTP обработчик, очищающий буфер последних ошибок обработки; ответ {"cleared": n}
+func makeErrorsClearHandler(ring *logging.ErrorRing, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := ring.Clear()
+		logger.Printf("[%s] error buffer cleared: %d entries", requestIDFromContext(r.Context()), n)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]int{"cleared": n}); err != nil {
+			logger.Printf("[%s] encode error: %v", requestIDFromContext(r.Context()), err)
+		}
+	}
+}
+
+// makeRawPayloadHandler - HTTP обработчик, возвращающий исходное сообщение Kafka заказа без изменений.
+// Координаты сообщения передаются в заголовках X-Kafka-Topic, X-Kafka-Partition, X-Kafka-Offset и X-Received-At.
+func makeRawPayloadHandler(repo OrderRepository, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		id, err := ids.Parse(r.PathValue("id"))
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeOrderIDInvalid)
+			return
+		}
+		orderID := id.String()
+
+		raw, err := repo.GetRawPayload(r.Context(), tenantFromContext(r.Context()), orderID)
+		if err != nil {
+			if errors.Is(err, postgres.ErrRawPayloadNotFound) {
+				writeAPIError(w, r, http.StatusNotFound, errCodeRawPayloadNotFound)
+				return
+			}
+			logger.Printf("[%s] raw payload: db error (order=%s): %v", reqID, orderID, err)
+			if !writeUnavailable(w, r, err) {
+				writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			}
+			return
+		}
+
+		h := w.Header()
+		// Формат исходного сообщения не хранится: сообщения Protobuf отдаются как двоичные данные
+		if json.Valid(raw.Payload) {
+			h.Set("Content-Type", "application/json")
+		} else {
+			h.Set("Content-Type", "application/octet-stream")
+		}
+		h.Set("Content-Length", strconv.Itoa(len(raw.Payload)))
+		h.Set("X-Kafka-Topic", raw.Topic)
+		h.Set("X-Kafka-Partition", strconv.Itoa(raw.Partition))
+		h.Set("X-Kafka-Offset", strconv.FormatInt(raw.Offset, 10))
+		h.Set("X-Received-At", raw.ReceivedAt.UTC().Format(time.RFC3339Nano))
+		if _, err := w.Write(raw.Payload); err != nil {
+			logger.Printf("[%s] raw payload: write error: %v", reqID, err)
+		}
+	}
+}
+
+const (
+	defaultPreloadMaxUIDs     = 1000
+	defaultPreloadConcurrency = 8
+
+	preloadBytesPerUID = 256
+)
+
+// goroutinesResponse - ответ GET /admin/goroutines
+type goroutinesResponse struct {
+	Runtime    int               `json:"runtime"`         // все горутины процесса, включая горутины библиотек и запросов
+	Registered int               `json:"registered"`      // горутины в реестре
+	Limit      int               `json:"limit,omitempty"` // лимит server.goroutine_limit
+	Goroutines []goroutines.Info `json:"goroutines"`
+}
+
+// makeGoroutinesHandler - HTTP обработчик, возвращающий зарегистрированные горутины с именем, временем запуска и состоянием
+func makeGoroutinesHandler(registry *goroutines.Registry, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list := registry.Snapshot()
+		resp := goroutinesResponse{
+			Runtime:    runtime.NumGoroutine(),
+			Registered: len(list),
+			Limit:      registry.Limit(),
+			Goroutines: list,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", requestIDFromContext(r.Context()), err)
+		}
+	}
+}
+
+// preloadResponse - отчёт о предварительной загрузке заказов в кэш
+type preloadResponse struct {
+	Loaded  int               `json:"loaded"`
+	Missing []string          `json:"missing"`
+	Errors  map[string]string `json:"errors"`
+}
+
+// makeCachePreloadHandler - HTTP обработчик, загружающий в кэш заказы из JSON массива идентификаторов.
+// Заказы читаются из базы данных параллельно (не больше cfg.Concurrency чтений одновременно); по истечении срока или отмене
+// запроса необработанные идентификаторы попадают в errors с причиной остановки.
+func makeCachePreloadHandler(repo OrderRepository, orderCache OrderCache, cfg config.PreloadConfig, logger *log.Logger) http.HandlerFunc {
+	maxUIDs := cfg.MaxUIDs
+	if maxUIDs <= 0 {
+		maxUIDs = defaultPreloadMaxUIDs
+	}
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultPreloadConcurrency
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+
+		// Размер тела ограничен с запасом по preloadBytesPerUID на идентификатор
+		var uids []string
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, int64(maxUIDs)*preloadBytesPerUID)).Decode(&uids); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeOrderUIDsInvalid)
+			return
+		}
+		if len(uids) > maxUIDs {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeOrderUIDsTooMany, maxUIDs)
+			return
+		}
+
+		ctx := r.Context()
+		if cfg.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+			defer cancel()
+		}
+
+		tenantID := tenantFromContext(r.Context())
+		resp := preloadResponse{Missing: []string{}, Errors: map[string]string{}}
+		var mu sync.Mutex
+		seen := make(map[string]bool, len(uids))
+		queue := make(chan string)
+		var wg sync.WaitGroup
+		// Число рабочих горутин ограничено и лимитом реестра горутин; без единой запущенной запрос отклоняется
+		workers := 0
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			err := goroutines.TryGo("cache preload worker", ctx.Done(), func() {
+				defer wg.Done()
+				for uid := range queue {
+					// Версия — момент начала чтения, как при обновлении одного заказа
+					version := time.Now().UnixNano()
+					order, err := repo.GetOrderByUID(withPrimaryRead(ctx), tenantID, uid)
+					mu.Lock()
+					switch {
+					case err == nil:
+						orderCache.SetIfNewer(tenantID, order, version)
+						resp.Loaded++
+					case errors.Is(err, postgres.ErrOrderNotFound):
+						resp.Missing = append(resp.Missing, uid)
+					default:
+						resp.Errors[uid] = err.Error()
+					}
+					mu.Unlock()
+				}
+			})
+			if err != nil {
+				wg.Done()
+				break
+			}
+			workers++
+		}
+		if workers == 0 {
+			close(queue)
+			logger.Printf("[%s] preload: no worker started: %v", reqID, goroutines.ErrLimitReached)
+			writeAPIError(w, r, http.StatusServiceUnavailable, errCodeGoroutineLimit)
+			return
+		}
+
+		for _, raw := range uids {
+			uid := ids.Normalize(raw)
+			if seen[uid] {
+				continue
+			}
+			seen[uid] = true
+			if _, err := ids.Parse(raw); err != nil {
+				mu.Lock()
+				resp.Errors[raw] = "invalid order id format"
+				mu.Unlock()
+				continue
+			}
+			if ctx.Err() == nil {
+				select {
+				case queue <- uid:
+					continue
+				case <-ctx.Done():
+				}
+			}
+			mu.Lock()
+			resp.Errors[uid] = ctx.Err().Error()
+			mu.Unlock()
+		}
+		close(queue)
+		wg.Wait()
+
+		sort.Strings(resp.Missing)
+		logger.Printf("[%s] preload: %d requested, %d loaded, %d missing, %d errors",
+			reqID, len(seen), resp.Loaded, len(resp.Missing), len(resp.Errors))
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+		}
+	}
+}
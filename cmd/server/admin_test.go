@@ -0,0 +1,688 @@
+// Описание: Тесты административных обработчиков сервера
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/cache"
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/goroutines"
+	"l0_test_self/internal/leader"
+	"l0_test_self/internal/logging"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAdminKey = "test-admin-key"
+
+func newAdminMux(repo OrderRepository, c OrderCache) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("POST /admin/orders/{id}/refresh", requireAdmin(testAdminKey, withDefaultTenant(makeOrderRefreshHandler(repo, c, newTestLogger()))))
+	mux.Handle("PATCH /admin/orders/{id}/delivery", requireAdmin(testAdminKey, withDefaultTenant(makeOrderDeliveryPatchHandler(repo, c, newTestLogger()))))
+	mux.Handle("GET /admin/orders/{id}/delivery/history", requireAdmin(testAdminKey, withDefaultTenant(makeDeliveryHistoryHandler(repo, newTestLogger()))))
+	mux.Handle("GET /admin/orders/{id}/diff", requireAdmin(testAdminKey, withDefaultTenant(makeOrderDiffHandler(repo, c, newTestLogger()))))
+	mux.Handle("GET /admin/cache/keys", requireAdmin(testAdminKey, withDefaultTenant(makeCacheKeysHandler(c, newTestLogger()))))
+	mux.Handle("POST /admin/cache/resize", requireAdmin(testAdminKey, makeCacheResizeHandler(c, 8, newTestLogger())))
+	mux.Handle("GET /admin/cache/stats", requireAdmin(testAdminKey, makeCacheStatsHandler(c, nil, newTestLogger())))
+	mux.Handle("POST /admin/cache/cleanup", requireAdmin(testAdminKey, makeCacheCleanupHandler(c, newTestLogger())))
+	mux.Handle("POST /admin/cache/{id}/pin", requireAdmin(testAdminKey, withDefaultTenant(makeCachePinHandler(repo, c, newTestLogger()))))
+	mux.Handle("DELETE /admin/cache/{id}/pin", requireAdmin(testAdminKey, withDefaultTenant(makeCacheUnpinHandler(c, newTestLogger()))))
+	return withRequestID(mux)
+}
+
+func TestOrderRefreshReplacesStaleEntry(t *testing.T) {
+	c := newTestCache(t)
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-1", TrackNumber: "STALE"})
+
+	repo := &fakeRepository{orders: map[string]orders.Order{
+		"order-1": {OrderUid: "order-1", TrackNumber: "FRESH"},
+	}}
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/orders/order-1/refresh", nil)
+	req.Header.Set("X-API-Key", testAdminKey)
+	rec := httptest.NewRecorder()
+	newAdminMux(repo, c).ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get(requestIDHeader))
+
+	var got orders.Order
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, "FRESH", got.TrackNumber)
+
+	cached, ok := c.Get(tenant.Default, "order-1")
+	require.True(t, ok)
+	assert.Equal(t, "FRESH", cached.TrackNumber)
+}
+
+func TestOrderRefreshMissingDeletesEntry(t *testing.T) {
+	c := newTestCache(t)
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-2"})
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/orders/order-2/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminKey)
+	rec := httptest.NewRecorder()
+	newAdminMux(&fakeRepository{}, c).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	_, ok := c.Get(tenant.Default, "order-2")
+	assert.False(t, ok)
+}
+
+func TestOrderRefreshRequiresAdminKey(t *testing.T) {
+	c := newTestCache(t)
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-3", TrackNumber: "STALE"})
+	repo := &fakeRepository{orders: map[string]orders.Order{
+		"order-3": {OrderUid: "order-3", TrackNumber: "FRESH"},
+	}}
+
+	for _, key := range []string{"", "wrong"} {
+		req := httptest.NewRequest(http.MethodPost, "/admin/orders/order-3/refresh", nil)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		newAdminMux(repo, c).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+
+	cached, _ := c.Get(tenant.Default, "order-3")
+	assert.Equal(t, "STALE", cached.TrackNumber)
+}
+
+// patchDelivery - отправляет PATCH доставки заказа id с телом body и заголовком If-Match ifMatch (пустой — без заголовка)
+func patchDelivery(t *testing.T, h http.Handler, id, ifMatch, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPatch, "/admin/orders/"+id+"/delivery", strings.NewReader(body))
+	req.Header.Set("X-API-Key", testAdminKey)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// staleReadRepository - репозиторий, чтение заказа из которого возвращает устаревшую версию stale
+type staleReadRepository struct {
+	*fakeRepository
+	stale orders.Order
+}
+
+func (r staleReadRepository) GetOrderByUID(context.Context, string, string) (orders.Order, error) {
+	return r.stale, nil
+}
+
+func TestOrderDeliveryPatch(t *testing.T) {
+	updated := time.Date(2024, 3, 1, 12, 0, 0, 123456000, time.UTC)
+	stored := orders.Order{OrderUid: "order-1", UpdatedAt: updated,
+		Delivery: orders.Delivery{Name: "Test Testov", City: "Kiryat Mozkin", Zip: "2639809"}}
+	etag := orderETag(stored)
+	assert.Equal(t, `"2024-03-01T12:00:00.123456Z"`, etag)
+
+	t.Run("successful edit refreshes cache", func(t *testing.T) {
+		c := newTestCache(t)
+		c.Set(tenant.Default, stored)
+		repo := &fakeRepository{orders: map[string]orders.Order{"order-1": stored}}
+		h := newAdminMux(repo, c)
+
+		rec := patchDelivery(t, h, "order-1", etag, `{"city":"Haifa","zip":"3100000"}`)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var got orders.Order
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		assert.Equal(t, orders.Delivery{Name: "Test Testov", City: "Haifa", Zip: "3100000"}, got.Delivery)
+		assert.True(t, got.UpdatedAt.After(updated))
+		assert.Equal(t, orderETag(got), rec.Header().Get("ETag"))
+
+		cached, ok := c.Get(tenant.Default, "order-1")
+		require.True(t, ok)
+		assert.Equal(t, "Haifa", cached.Delivery.City)
+		assert.True(t, cached.UpdatedAt.Equal(got.UpdatedAt))
+		assert.Equal(t, "Haifa", repo.orders["order-1"].Delivery.City)
+
+		// Прежний ETag после изменения устарел
+		rec = patchDelivery(t, h, "order-1", etag, `{"city":"Akko"}`)
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+		assert.Equal(t, orderETag(got), rec.Header().Get("ETag"))
+	})
+
+	t.Run("stale If-Match", func(t *testing.T) {
+		c := newTestCache(t)
+		repo := &fakeRepository{orders: map[string]orders.Order{"order-1": stored}}
+		rec := patchDelivery(t, newAdminMux(repo, c), "order-1", orderETag(orders.Order{UpdatedAt: updated.Add(-time.Second)}), `{"city":"Haifa"}`)
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+		assert.Equal(t, "Kiryat Mozkin", repo.orders["order-1"].Delivery.City)
+		_, ok := c.Get(tenant.Default, "order-1")
+		assert.False(t, ok)
+	})
+
+	t.Run("concurrent modification", func(t *testing.T) {
+		// Заказ изменён между чтением обработчиком и записью: чтение возвращает прежнюю версию
+		modified := stored
+		modified.UpdatedAt = updated.Add(time.Second)
+		repo := &fakeRepository{orders: map[string]orders.Order{"order-1": modified}}
+		h := newAdminMux(staleReadRepository{fakeRepository: repo, stale: stored}, newTestCache(t))
+		rec := patchDelivery(t, h, "order-1", etag, `{"city":"Haifa"}`)
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+		assert.Equal(t, "Kiryat Mozkin", repo.orders["order-1"].Delivery.City)
+	})
+
+	t.Run("missing If-Match", func(t *testing.T) {
+		repo := &fakeRepository{orders: map[string]orders.Order{"order-1": stored}}
+		h := newAdminMux(repo, newTestCache(t))
+		for _, ifMatch := range []string{"", "*"} {
+			rec := patchDelivery(t, h, "order-1", ifMatch, `{"city":"Haifa"}`)
+			assert.Equal(t, http.StatusPreconditionRequired, rec.Code, "If-Match %q", ifMatch)
+		}
+		assert.Equal(t, "Kiryat Mozkin", repo.orders["order-1"].Delivery.City)
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		repo := &fakeRepository{orders: map[string]orders.Order{"order-1": stored}}
+		h := newAdminMux(repo, newTestCache(t))
+		assert.Equal(t, http.StatusBadRequest, patchDelivery(t, h, "order-1", `"yesterday"`, `{}`).Code)
+		assert.Equal(t, http.StatusBadRequest, patchDelivery(t, h, "order-1", etag, `{"country":"IL"}`).Code)
+		assert.Equal(t, http.StatusNotFound, patchDelivery(t, h, "order-2", etag, `{"city":"Haifa"}`).Code)
+		// Значение без кавычек тоже принимается
+		assert.Equal(t, http.StatusOK, patchDelivery(t, h, "order-1", strings.Trim(etag, `"`), `{"city":"Haifa"}`).Code)
+	})
+}
+
+func TestDeliveryHistoryRecordsEdits(t *testing.T) {
+	updated := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	first := orders.Delivery{Name: "Test Testov", City: "Kiryat Mozkin", Zip: "2639809"}
+	repo := &fakeRepository{orders: map[string]orders.Order{"order-1": {OrderUid: "order-1", UpdatedAt: updated, Delivery: first}}}
+	h := newAdminMux(repo, newTestCache(t))
+
+	history := func(id string) (int, deliveryHistoryResponse) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/admin/orders/"+id+"/delivery/history", nil)
+		req.Header.Set("X-API-Key", testAdminKey)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var resp deliveryHistoryResponse
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		}
+		return rec.Code, resp
+	}
+	code, resp := history("order-1")
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, resp.Changes)
+	assert.NotNil(t, resp.Changes, "no changes are an empty list")
+
+	rec := patchDelivery(t, h, "order-1", orderETag(repo.orders["order-1"]), `{"city":"Haifa"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = patchDelivery(t, h, "order-1", rec.Header().Get("ETag"), `{"zip":"3100000"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	code, resp = history("order-1")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "order-1", resp.OrderUid)
+	require.Len(t, resp.Changes, 2)
+	second := first
+	second.City = "Haifa"
+	assert.Equal(t, &first, resp.Changes[0].Previous)
+	assert.Equal(t, &second, resp.Changes[1].Previous)
+	for _, c := range resp.Changes {
+		assert.Equal(t, apiKeyID(testAdminKey), c.ChangedBy)
+		assert.NotContains(t, c.ChangedBy, testAdminKey, "the key itself is not stored")
+	}
+	assert.True(t, resp.Changes[0].ChangedAt.Before(resp.Changes[1].ChangedAt))
+
+	code, _ = history("missing")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestOrderDiff(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(t)
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-1", TrackNumber: "STALE", DateCreated: created.In(time.FixedZone("MSK", 3*3600))})
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-2", DateCreated: created})
+	c.Set(tenant.Default, orders.Order{OrderUid: "cache-only"})
+	repo := &fakeRepository{orders: map[string]orders.Order{
+		"order-1": {OrderUid: "order-1", TrackNumber: "FRESH", DateCreated: created},
+		"order-2": {OrderUid: "order-2", DateCreated: created},
+		"db-only": {OrderUid: "db-only"},
+	}}
+	get := func(id string) (int, orderDiffResponse) {
+		req := httptest.NewRequest(http.MethodGet, "/admin/orders/"+id+"/diff", nil)
+		req.Header.Set("X-API-Key", testAdminKey)
+		rec := httptest.NewRecorder()
+		newAdminMux(repo, c).ServeHTTP(rec, req)
+		var resp orderDiffResponse
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		}
+		return rec.Code, resp
+	}
+
+	code, resp := get("order-1")
+	require.Equal(t, http.StatusOK, code)
+	assert.False(t, resp.InSync)
+	assert.Equal(t, []orderDifference{{Path: "track_number", Kind: "changed", Cached: "STALE", Stored: "FRESH"}}, resp.Differences,
+		"the same instant in another time zone is not a difference")
+
+	_, resp = get("order-2")
+	assert.True(t, resp.InSync)
+	assert.Empty(t, resp.Differences)
+
+	_, resp = get("cache-only")
+	assert.Equal(t, orderDiffResponse{OrderUid: "cache-only", InCache: true, Differences: []orderDifference{}}, resp)
+	_, resp = get("db-only")
+	assert.Equal(t, orderDiffResponse{OrderUid: "db-only", InDB: true, Differences: []orderDifference{}}, resp)
+
+	code, _ = get("missing")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	repo.err = errors.New("connection refused")
+	code, _ = get("order-1")
+	assert.Equal(t, http.StatusInternalServerError, code)
+}
+
+func TestCacheKeysLimit(t *testing.T) {
+	c := newTestCache(t)
+	for i := 0; i < 10; i++ {
+		c.Set(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("order-%d", i)})
+	}
+	mux := newAdminMux(&fakeRepository{}, c)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/cache/keys?limit=3", nil)
+	req.Header.Set("X-API-Key", testAdminKey)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp cacheKeysResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 10, resp.Total)
+	assert.Len(t, resp.Keys, 3)
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/cache/keys?limit=abc", nil)
+	req.Header.Set("X-API-Key", testAdminKey)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestVersionHandler(t *testing.T) {
+	handler := makeVersionHandler(func(context.Context) (string, error) {
+		return "PostgreSQL 16.1", nil
+	}, []string{"kafka:9092"}, "host-1a2b3c4d", nil, newTestLogger())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/version", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp versionResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "PostgreSQL 16.1", resp.PostgresVersion)
+	assert.Equal(t, []string{"kafka:9092"}, resp.KafkaBrokers)
+	assert.Equal(t, "host-1a2b3c4d", resp.Instance)
+	assert.Nil(t, resp.Leadership, "leadership is omitted without leader election")
+	assert.NotEmpty(t, resp.Build.Version)
+	assert.NotEmpty(t, resp.Build.GoVersion)
+}
+
+// fixedLock - блокировка лидера, захват которой всегда удаётся или всегда не удаётся
+type fixedLock bool
+
+func (l fixedLock) TryLock(context.Context) (bool, error) { return bool(l), nil }
+func (l fixedLock) Held(context.Context) (bool, error)    { return bool(l), nil }
+func (fixedLock) Unlock(context.Context) error            { return nil }
+
+func TestVersionHandlerLeadership(t *testing.T) {
+	dbVersion := func(context.Context) (string, error) { return "PostgreSQL 16.1", nil }
+	for _, isLeader := range []bool{true, false} {
+		elector := leader.NewElector("host-1a2b3c4d", fixedLock(isLeader), nil)
+		_, err := elector.TryAcquire(context.Background())
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		makeVersionHandler(dbVersion, nil, "host-1a2b3c4d", elector, newTestLogger()).
+			ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/version", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var resp versionResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "host-1a2b3c4d", resp.Instance)
+		require.NotNil(t, resp.Leadership)
+		assert.Equal(t, isLeader, resp.Leadership.Leader)
+		assert.Equal(t, isLeader, resp.Leadership.Since != nil)
+	}
+}
+
+func TestSingletonJobsRunOnlyOnLeader(t *testing.T) {
+	for _, isLeader := range []bool{true, false} {
+		elector := leader.NewElector("host-1a2b3c4d", fixedLock(isLeader), nil)
+		_, err := elector.TryAcquire(context.Background())
+		require.NoError(t, err)
+		var runs atomic.Int32
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		runPeriodic(ctx, elector, time.Hour, time.Millisecond, func(context.Context, time.Time) { runs.Add(1) })
+		cancel()
+		assert.Equal(t, isLeader, runs.Load() > 0, "leader=%t", isLeader)
+	}
+}
+
+func TestVersionHandlerDBError(t *testing.T) {
+	handler := makeVersionHandler(func(context.Context) (string, error) {
+		return "", errors.New("connection refused")
+	}, nil, "", nil, newTestLogger())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/version", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp versionResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Empty(t, resp.PostgresVersion)
+	assert.Equal(t, "connection refused", resp.PostgresError)
+}
+
+// postPreload - отправляет запрос предварительной загрузки со списком идентификаторов
+func postPreload(t *testing.T, h http.Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/admin/cache/preload", strings.NewReader(body))
+	req.Header.Set("X-API-Key", testAdminKey)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCachePreloadPartialFailures(t *testing.T) {
+	c := newTestCache(t)
+	repo := &fakeRepository{
+		orders: map[string]orders.Order{
+			"order-1": {OrderUid: "order-1"},
+			"order-2": {OrderUid: "order-2"},
+			"order-5": {OrderUid: "order-5"},
+		},
+		uidErrs: map[string]error{"order-5": errors.New("connection reset by peer")},
+	}
+	h := requireAdmin(testAdminKey, withDefaultTenant(makeCachePreloadHandler(repo, c, config.PreloadConfig{Concurrency: 2}, newTestLogger())))
+
+	rec := postPreload(t, h, `["order-1", "order-2", "order-3", "order-4", "order-5", "bad id", "order-1"]`)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp preloadResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Loaded)
+	assert.Equal(t, []string{"order-3", "order-4"}, resp.Missing)
+	assert.Equal(t, map[string]string{
+		"order-5": "connection reset by peer",
+		"bad id":  "invalid order id format",
+	}, resp.Errors)
+
+	for _, uid := range []string{"order-1", "order-2"} {
+		_, ok := c.Get(tenant.Default, uid)
+		assert.True(t, ok, uid)
+	}
+	_, ok := c.Get(tenant.Default, "order-5")
+	assert.False(t, ok)
+}
+
+func TestCachePreloadCap(t *testing.T) {
+	repo := &fakeRepository{}
+	h := requireAdmin(testAdminKey, withDefaultTenant(makeCachePreloadHandler(repo, newTestCache(t), config.PreloadConfig{MaxUIDs: 2}, newTestLogger())))
+
+	rec := postPreload(t, h, `["order-1", "order-2", "order-3"]`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "max 2")
+	assert.Zero(t, repo.reads, "nothing is read when the cap is exceeded")
+
+	rec = postPreload(t, h, `{"uids": ["order-1"]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = postPreload(t, h, `["order-1", "order-2"]`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestCachePreloadCancelled(t *testing.T) {
+	repo := &fakeRepository{orders: map[string]orders.Order{"order-1": {OrderUid: "order-1"}}}
+	h := withDefaultTenant(makeCachePreloadHandler(repo, newTestCache(t), config.PreloadConfig{Concurrency: 1}, newTestLogger()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodPost, "/admin/cache/preload", strings.NewReader(`["order-1", "order-2"]`)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp preloadResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Zero(t, resp.Loaded)
+	assert.Len(t, resp.Errors, 2)
+	assert.Equal(t, context.Canceled.Error(), resp.Errors["order-1"])
+}
+
+func TestCachePreloadGoroutineLimit(t *testing.T) {
+	registry := goroutines.Default()
+	registry.SetLimit(1)
+	t.Cleanup(func() { registry.SetLimit(0) })
+	stop := make(chan struct{})
+	defer close(stop)
+	goroutines.Go("test blocker", stop, func() { <-stop })
+
+	repo := &fakeRepository{orders: map[string]orders.Order{"order-1": {OrderUid: "order-1"}}}
+	h := requireAdmin(testAdminKey, withDefaultTenant(makeCachePreloadHandler(repo, newTestCache(t), config.PreloadConfig{Concurrency: 2}, newTestLogger())))
+	rec := postPreload(t, h, `["order-1"]`)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Zero(t, repo.reads)
+
+	registry.SetLimit(0)
+	assert.Equal(t, http.StatusOK, postPreload(t, h, `["order-1"]`).Code)
+}
+
+func TestCacheResize(t *testing.T) {
+	c := newTestCache(t)
+	for i := 0; i < 50; i++ {
+		c.Set(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("order-%d", i)})
+	}
+	mux := newAdminMux(&fakeRepository{}, c)
+	resize := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/cache/resize"+query, nil)
+		req.Header.Set("X-API-Key", testAdminKey)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := resize("?shard_count=32")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp cacheResizeResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 4, resp.Previous)
+	assert.Equal(t, 32, resp.ShardCount)
+	assert.Equal(t, 50, resp.Entries)
+	_, ok := c.Get(tenant.Default, "order-7")
+	assert.True(t, ok)
+
+	// Без параметра применяется значение из конфигурации
+	require.Equal(t, http.StatusOK, resize("").Code)
+	assert.Equal(t, 8, c.ShardCount())
+
+	require.Equal(t, http.StatusOK, resize("?shard_count=auto").Code)
+	assert.Equal(t, cache.AutoShardCount(), c.ShardCount())
+
+	assert.Equal(t, http.StatusBadRequest, resize("?shard_count=0").Code)
+	assert.Equal(t, http.StatusBadRequest, resize("?shard_count=many").Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/cache/resize?shard_count=2", nil)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, cache.AutoShardCount(), c.ShardCount())
+}
+
+func TestCacheResizeUnsupported(t *testing.T) {
+	rec := httptest.NewRecorder()
+	makeCacheResizeHandler(discardCache{}, 8, newTestLogger()).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/cache/resize", nil))
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+}
+
+func TestCacheCleanupReportsExpiredEntries(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	c, err := cache.NewWithOptions(cache.WithShards(2), cache.WithTTL(20*time.Millisecond), cache.WithCleanupInterval(time.Hour), cache.WithClock(clk))
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+	for i := 0; i < 5; i++ {
+		c.Set(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("order-%d", i)})
+	}
+	clk.Advance(40 * time.Millisecond)
+	c.Set(tenant.Default, orders.Order{OrderUid: "fresh"})
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/cache/cleanup", nil)
+	req.Header.Set("X-API-Key", testAdminKey)
+	rec := httptest.NewRecorder()
+	newAdminMux(&fakeRepository{}, c).ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp cacheCleanupResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 5, resp.Expired)
+	assert.Zero(t, resp.Evicted)
+	assert.Equal(t, 1, resp.Entries)
+	require.Len(t, resp.Shards, 2)
+	assert.Equal(t, 5, resp.Shards[0].Expired+resp.Shards[1].Expired)
+	assert.Equal(t, 1, resp.Shards[1].Shard)
+
+	rec = httptest.NewRecorder()
+	newAdminMux(&fakeRepository{}, c).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/cache/cleanup", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+// busyCleanupCache - кэш, очистка которого всегда уже выполняется
+type busyCleanupCache struct{ discardCache }
+
+func (busyCleanupCache) RunCleanup() (cache.CleanupReport, error) {
+	return cache.CleanupReport{}, cache.ErrCleanupRunning
+}
+
+func TestCacheCleanupConflictAndUnsupported(t *testing.T) {
+	rec := httptest.NewRecorder()
+	makeCacheCleanupHandler(busyCleanupCache{}, newTestLogger()).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/cache/cleanup", nil))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = httptest.NewRecorder()
+	makeCacheCleanupHandler(discardCache{}, newTestLogger()).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/cache/cleanup", nil))
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+}
+
+func TestCachePinLoadsMissingOrderAndShowsInStats(t *testing.T) {
+	c, err := cache.NewWithOptions(cache.WithShards(1), cache.WithMaxItems(2))
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+	c.SetMaxPinned(1)
+	repo := &fakeRepository{orders: map[string]orders.Order{"order-1": {OrderUid: "order-1", TrackNumber: "DB"}}}
+	mux := newAdminMux(repo, c)
+	call := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-API-Key", testAdminKey)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Заказа нет в кэше: он загружается из базы и закрепляется
+	require.Equal(t, http.StatusNoContent, call(http.MethodPost, "/admin/cache/order-1/pin").Code)
+	assert.Equal(t, 1, repo.reads)
+	for i := 0; i < 5; i++ {
+		c.Set(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("other-%d", i)})
+	}
+	got, ok := c.Get(tenant.Default, "order-1")
+	require.True(t, ok, "pinned order survives capacity pressure")
+	assert.Equal(t, "DB", got.TrackNumber)
+
+	rec := call(http.MethodGet, "/admin/cache/stats")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var stats cacheStatsResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	assert.Equal(t, []string{tenant.Key(tenant.Default, "order-1")}, stats.Pinned)
+	assert.Equal(t, 1, stats.MaxPinned)
+	assert.Equal(t, 2, stats.Entries)
+
+	assert.Equal(t, http.StatusConflict, call(http.MethodPost, "/admin/cache/other-4/pin").Code, "limit of pinned entries")
+	assert.Equal(t, http.StatusNotFound, call(http.MethodPost, "/admin/cache/missing/pin").Code)
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/admin/cache/bad_id/pin").Code)
+
+	require.Equal(t, http.StatusNoContent, call(http.MethodDelete, "/admin/cache/order-1/pin").Code)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodDelete, "/admin/cache/order-1/pin").Code)
+	assert.Empty(t, c.Pinned())
+}
+
+func TestCachePinUnsupported(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/admin/cache/order-1/pin", nil)
+	req.SetPathValue("id", "order-1")
+	makeCachePinHandler(&fakeRepository{}, discardCache{}, newTestLogger()).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+}
+
+func TestAdminErrorsCollectsConsumerFailures(t *testing.T) {
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.Consumer.ErrorBufferSize = 10
+	monitor := newConsumerMonitor(cfg)
+
+	msgs, uids := newOrderMessages(t, 31, 1)
+	msgs = append(msgs, kafka2.Message{Topic: "orders", Partition: 2, Offset: 1, Value: []byte(`{"order_uid": "x", "delivery": {"phone": "+9720000000"`)})
+	repo := &fakeRepository{err: errBatchFailed}
+	reader := &sliceReader{msgs: msgs}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), cfg, monitor)
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) == len(msgs) }, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /admin/errors", requireAdmin(testAdminKey, makeErrorsHandler(monitor.errors, newTestLogger())))
+	mux.Handle("POST /admin/errors/clear", requireAdmin(testAdminKey, makeErrorsClearHandler(monitor.errors, newTestLogger())))
+	get := func(url string) errorsResponse {
+		rec := getWithKey(t, mux, url, testAdminKey)
+		assert.NotContains(t, rec.Body.String(), "+9720000000", "payloads are not retained")
+		var resp errorsResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp
+	}
+
+	resp := get("/admin/errors")
+	assert.Equal(t, 10, resp.Size)
+	assert.Equal(t, uint64(2), resp.Total)
+	require.Len(t, resp.Errors, 2)
+	assert.Equal(t, stageStore, resp.Errors[0].Stage)
+	assert.Equal(t, "db_insert", resp.Errors[0].Class)
+	assert.Equal(t, uids[0], resp.Errors[0].OrderUid)
+	assert.Equal(t, &logging.KafkaRef{Topic: "orders", Offset: 0}, resp.Errors[0].Kafka)
+	assert.Contains(t, resp.Errors[0].Message, errBatchFailed.Error())
+	assert.Equal(t, stageDecode, resp.Errors[1].Stage)
+	assert.Equal(t, &logging.KafkaRef{Topic: "orders", Partition: 2, Offset: 1}, resp.Errors[1].Kafka)
+
+	decodeOnly := get("/admin/errors?stage=decode")
+	require.Len(t, decodeOnly.Errors, 1)
+	assert.Equal(t, "decode", decodeOnly.Errors[0].Class)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/errors?stage=parse", nil)
+	req.Header.Set("X-API-Key", testAdminKey)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/errors/clear", nil)
+	req.Header.Set("X-API-Key", testAdminKey)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"cleared": 2}`, rec.Body.String())
+	assert.Empty(t, get("/admin/errors").Errors)
+}
@@ -0,0 +1,110 @@
+// Описание: Тесты клиента API (pkg/apiclient) против настоящих обработчиков сервера, чтобы клиент и сервер не расходились
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/apiclient"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAPIClientTestServer - сервер с маршрутами режима api поверх репозитория repo и клиент к нему
+func newAPIClientTestServer(t *testing.T, repo OrderRepository, apiKey string) *apiclient.Client {
+	t.Helper()
+	cfg := newConsumerTestConfig()
+	cfg.Admin.APIKey = testAdminKey
+	cfg.Admin.Export = config.ExportConfig{MaxRange: 24 * time.Hour}
+	app := &App{mode: modeAPI, cfg: cfg, logger: newTestLogger(), repo: repo, cache: newTestCache(t)}
+	srv := httptest.NewServer(app.handler())
+	t.Cleanup(srv.Close)
+
+	c, err := apiclient.New(apiclient.Config{BaseURL: srv.URL, APIKey: apiKey, RetryBackoff: time.Millisecond})
+	require.NoError(t, err)
+	return c
+}
+
+func TestAPIClientGetOrder(t *testing.T) {
+	order := testorders.NewGenerator(31).Order(testorders.ScenarioDefault)
+	repo := &fakeRepository{orders: map[string]orders.Order{order.OrderUid: order}}
+	c := newAPIClientTestServer(t, repo, "")
+	ctx := context.Background()
+
+	got, err := c.GetOrder(ctx, order.OrderUid)
+	require.NoError(t, err)
+	assert.Equal(t, order.OrderUid, got.OrderUid)
+	assert.Equal(t, order.TrackNumber, got.TrackNumber)
+	assert.Equal(t, order.Items, got.Items, "item statuses survive the JSON round trip")
+
+	_, err = c.GetOrder(ctx, "missing-order")
+	assert.True(t, errors.Is(err, apiclient.ErrNotFound), "%v", err)
+
+	_, err = c.GetOrder(ctx, "bad id")
+	var vErr *apiclient.ValidationError
+	require.ErrorAs(t, err, &vErr)
+	assert.Contains(t, vErr.Message, "invalid order id format")
+}
+
+func TestAPIClientSearchByTrack(t *testing.T) {
+	g := testorders.NewGenerator(32)
+	a, b, other := g.Order(testorders.ScenarioDefault), g.Order(testorders.ScenarioDefault), g.Order(testorders.ScenarioDefault)
+	a.TrackNumber, b.TrackNumber, other.TrackNumber = "TRACK-1", "TRACK-1", "TRACK-2"
+	repo := &fakeRepository{orders: map[string]orders.Order{a.OrderUid: a, b.OrderUid: b, other.OrderUid: other}}
+	c := newAPIClientTestServer(t, repo, "")
+
+	list, err := c.SearchByTrack(context.Background(), "TRACK-1")
+	require.NoError(t, err)
+	uids := []string{list[0].OrderUid, list[1].OrderUid}
+	assert.ElementsMatch(t, []string{a.OrderUid, b.OrderUid}, uids)
+
+	list, err = c.SearchByTrack(context.Background(), "TRACK-3")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	// Выдача больше одной страницы собирается по курсорам
+	for i := 0; i < 150; i++ {
+		o := g.Order(testorders.ScenarioDefault)
+		o.TrackNumber = "TRACK-4"
+		repo.orders[o.OrderUid] = o
+	}
+	list, err = c.SearchByTrack(context.Background(), "TRACK-4")
+	require.NoError(t, err)
+	seen := map[string]bool{}
+	for _, o := range list {
+		seen[o.OrderUid] = true
+	}
+	assert.Len(t, list, 150)
+	assert.Len(t, seen, 150)
+}
+
+func TestAPIClientListOrders(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	g := testorders.NewGenerator(33)
+	repo := &fakeRepository{orders: map[string]orders.Order{}}
+	for i := 0; i < 3; i++ {
+		o := g.Order(testorders.ScenarioDefault)
+		o.DateCreated = now.Add(-time.Duration(i+1) * time.Hour)
+		repo.orders[o.OrderUid] = o
+	}
+
+	c := newAPIClientTestServer(t, repo, testAdminKey)
+	list, err := c.ListOrders(context.Background(), apiclient.ListFilter{From: now.Add(-150 * time.Minute), To: now})
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	// Без ключа административного API выгрузка недоступна
+	c = newAPIClientTestServer(t, repo, "")
+	_, err = c.ListOrders(context.Background(), apiclient.ListFilter{})
+	var apiErr *apiclient.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+}
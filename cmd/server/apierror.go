@@ -0,0 +1,108 @@
+// Описание: Ошибки API: JSON ответ со стабильным кодом ошибки для программ и сообщением на языке клиента,
+// выбранном по заголовку Accept-Language из встроенного каталога internal/i18n
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"l0_test_self/internal/i18n"
+)
+
+// Коды ошибок API; сообщения к ним - в internal/i18n/messages/*.json
+const (
+	errCodeOrderIDRequired          = "order_id_required"
+	errCodeOrderIDInvalid           = "order_id_invalid"
+	errCodeOrderNotFound            = "order_not_found"
+	errCodeInternal                 = "internal_error"
+	errCodeDBUnavailable            = "db_unavailable"
+	errCodeDBTimeout                = "db_timeout"
+	errCodeTrackNumberRequired      = "track_number_required"
+	errCodeCustomerIDRequired       = "customer_id_required"
+	errCodeSortInvalid              = "sort_invalid"
+	errCodeLimitInvalid             = "limit_invalid"
+	errCodeIncludeInvalid           = "include_invalid"
+	errCodeCursorInvalid            = "cursor_invalid"
+	errCodeCursorExpired            = "cursor_expired"
+	errCodeCursorMismatch           = "cursor_mismatch"
+	errCodeUnauthorized             = "unauthorized"
+	errCodeTenantRequired           = "tenant_required"
+	errCodeTenantUnknown            = "tenant_unknown"
+	errCodeTenantForbidden          = "tenant_forbidden"
+	errCodeClientCertRequired       = "client_cert_required"
+	errCodePrefixInvalid            = "prefix_invalid"
+	errCodeRateLimited              = "rate_limited"
+	errCodeNotAcceptable            = "not_acceptable"
+	errCodeRequestTooLarge          = "request_too_large"
+	errCodeRequestBodyInvalid       = "request_body_invalid"
+	errCodeSchemaVersionInvalid     = "schema_version_invalid"
+	errCodeOrderJSONInvalid         = "order_json_invalid"
+	errCodeOrderDecodeFailed        = "order_decode_failed"
+	errCodeOrderInvalid             = "order_invalid"
+	errCodeOrderExists              = "order_exists"
+	errCodeOrderModified            = "order_modified"
+	errCodeIdempotencyKeyInvalid    = "idempotency_key_invalid"
+	errCodeIdempotencyKeyInProgress = "idempotency_key_in_progress"
+	errCodeIdempotencyKeyReused     = "idempotency_key_reused"
+	errCodeIfMatchRequired          = "if_match_required"
+	errCodeIfMatchInvalid           = "if_match_invalid"
+	errCodeExportFormatInvalid      = "export_format_invalid"
+	errCodeSourceInvalid            = "source_invalid"
+	errCodeTimeInvalid              = "time_invalid"
+	errCodeFromRequired             = "from_required"
+	errCodeRangeInvalid             = "range_invalid"
+	errCodeRangeTooLarge            = "range_too_large"
+	errCodeGroupKeyInvalid          = "group_key_invalid"
+	errCodeStageInvalid             = "stage_invalid"
+	errCodeDetailInvalid            = "detail_invalid"
+	errCodeShardCountInvalid        = "shard_count_invalid"
+	errCodeCacheResizeUnsupported   = "cache_resize_unsupported"
+	errCodeCacheCleanupUnsupported  = "cache_cleanup_unsupported"
+	errCodeCacheCleanupRunning      = "cache_cleanup_running"
+	errCodeCachePinUnsupported      = "cache_pin_unsupported"
+	errCodeCacheSwitchUnsupported   = "cache_switch_unsupported"
+	errCodePinLimitReached          = "pin_limit_reached"
+	errCodeOrderNotPinned           = "order_not_pinned"
+	errCodeRawPayloadNotFound       = "raw_payload_not_found"
+	errCodeOrderUIDsInvalid         = "order_uids_invalid"
+	errCodeOrderUIDsTooMany         = "order_uids_too_many"
+	errCodeGoroutineLimit           = "goroutine_limit"
+	errCodeKeyRequired              = "key_required"
+	errCodeTopicUnknown             = "topic_unknown"
+	errCodeTopicNoPartitions        = "topic_no_partitions"
+	errCodeKafkaUnavailable         = "kafka_unavailable"
+	errCodeOffsetInvalid            = "offset_invalid"
+	errCodeMessageAlreadyProcessed  = "message_already_processed"
+)
+
+// apiErrorResponse - тело ответа с ошибкой API
+type apiErrorResponse struct {
+	Code    string `json:"code"`    // стабильный код ошибки, например order_not_found
+	Message string `json:"message"` // сообщение на языке из Accept-Language (по умолчанию en)
+}
+
+// writeAPIError - отвечает ошибкой status с кодом code. Сообщение берётся из каталога на языке, выбранном
+// по Accept-Language запроса r, с подстановкой args; язык указывается в Content-Language. Каталог проверяется
+// при запуске сервера, поэтому сообщение есть для любого кода из списка выше.
+func writeAPIError(w http.ResponseWriter, r *http.Request, status int, code string, args ...any) {
+	lang, body := apiErrorBody(r, code, args...)
+
+	h := w.Header()
+	// Как и http.Error: заголовки успешного ответа, выставленные до ошибки, к ней не относятся
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	h.Set("Content-Language", lang)
+	h.Add("Vary", "Accept-Language")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// apiErrorBody - JSON тело ошибки с кодом code и сообщением на языке, выбранном по Accept-Language запроса r,
+// и этот язык. Нужно отдельно от writeAPIError, когда тело ответа сохраняется для повторов (POST /orders).
+func apiErrorBody(r *http.Request, code string, args ...any) (string, []byte) {
+	messages, _ := i18n.Embedded()
+	lang := messages.Negotiate(r.Header.Get("Accept-Language"))
+	body, _ := json.Marshal(apiErrorResponse{Code: code, Message: messages.Message(lang, code, args...)})
+	return lang, append(body, '\n')
+}
@@ -0,0 +1,96 @@
+// Описание: Тесты ошибок API: код ошибки не зависит от языка, сообщение выбирается по Accept-Language
+// с откатом на английский, а каждый код ошибки сервера есть во встроенном каталоге
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/i18n"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getAPIError - выполняет GET target с заголовком Accept-Language и разбирает JSON ответ с ошибкой
+func getAPIError(t *testing.T, h http.Handler, target, acceptLanguage string) (*httptest.ResponseRecorder, apiErrorResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if acceptLanguage != "" {
+		req.Header.Set("Accept-Language", acceptLanguage)
+	}
+	rec := serve(h, req)
+	assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+	var resp apiErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), rec.Body.String())
+	return rec, resp
+}
+
+func TestAPIErrorLanguage(t *testing.T) {
+	h := newSecuredMux(t, config.SecurityHeadersConfig{})
+
+	for _, tc := range []struct {
+		acceptLanguage string
+		lang           string
+		message        string
+	}{
+		{acceptLanguage: "", lang: "en", message: "order not found"},
+		{acceptLanguage: "ru-RU,ru;q=0.9,en;q=0.8", lang: "ru", message: "заказ не найден"},
+		{acceptLanguage: "en-GB", lang: "en", message: "order not found"},
+		{acceptLanguage: "de-DE,de;q=0.9", lang: "en", message: "order not found"},
+	} {
+		rec, resp := getAPIError(t, h, "/order?id=missing", tc.acceptLanguage)
+		assert.Equal(t, http.StatusNotFound, rec.Code, tc.acceptLanguage)
+		assert.Equal(t, errCodeOrderNotFound, resp.Code, "the code does not depend on the language")
+		assert.Equal(t, tc.message, resp.Message, tc.acceptLanguage)
+		assert.Equal(t, tc.lang, rec.Header().Get("Content-Language"), tc.acceptLanguage)
+		assert.Equal(t, "Accept-Language", rec.Header().Get("Vary"))
+	}
+}
+
+func TestAPIErrorMessageArguments(t *testing.T) {
+	h := withDefaultTenant(makeOrderSearchHandler(&fakeRepository{}, piiPolicy{}, newTestCursorSigner(t), newTestLogger()))
+
+	rec, resp := getAPIError(t, h, "/orders?track_number=WBILMTESTTRACK&limit=1000", "ru")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errCodeLimitInvalid, resp.Code)
+	assert.Equal(t, "limit должен быть от 1 до 100", resp.Message)
+
+	rec, resp = getAPIError(t, h, "/orders?track_number=WBILMTESTTRACK&include=delivery,gifts", "en")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errCodeIncludeInvalid, resp.Code)
+	assert.Contains(t, resp.Message, `"gifts"`)
+
+	rec, resp = getAPIError(t, h, "/orders?track_number=WBILMTESTTRACK&cursor=garbage", "ru")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errCodeCursorInvalid, resp.Code)
+}
+
+func TestAPIErrorCodesAreInCatalog(t *testing.T) {
+	catalog, err := i18n.Embedded()
+	require.NoError(t, err)
+	codes := catalog.Codes()
+	for _, code := range []string{
+		errCodeOrderIDRequired, errCodeOrderIDInvalid, errCodeOrderNotFound, errCodeInternal, errCodeDBUnavailable,
+		errCodeTrackNumberRequired, errCodeSortInvalid, errCodeLimitInvalid, errCodeIncludeInvalid,
+		errCodeCursorInvalid, errCodeCursorExpired, errCodeCursorMismatch, errCodeUnauthorized,
+		errCodeTenantRequired, errCodeTenantUnknown, errCodeTenantForbidden, errCodeClientCertRequired,
+		errCodeDBTimeout, errCodeCustomerIDRequired, errCodePrefixInvalid, errCodeRateLimited, errCodeNotAcceptable,
+		errCodeRequestTooLarge, errCodeRequestBodyInvalid, errCodeSchemaVersionInvalid, errCodeOrderJSONInvalid,
+		errCodeOrderDecodeFailed, errCodeOrderInvalid, errCodeOrderExists, errCodeOrderModified,
+		errCodeIdempotencyKeyInvalid, errCodeIdempotencyKeyInProgress, errCodeIdempotencyKeyReused,
+		errCodeIfMatchRequired, errCodeIfMatchInvalid, errCodeExportFormatInvalid, errCodeSourceInvalid,
+		errCodeTimeInvalid, errCodeFromRequired, errCodeRangeInvalid, errCodeRangeTooLarge, errCodeGroupKeyInvalid,
+		errCodeStageInvalid, errCodeDetailInvalid, errCodeShardCountInvalid, errCodeCacheResizeUnsupported,
+		errCodeCacheCleanupUnsupported, errCodeCacheCleanupRunning, errCodeCachePinUnsupported,
+		errCodeCacheSwitchUnsupported, errCodePinLimitReached, errCodeOrderNotPinned, errCodeRawPayloadNotFound,
+		errCodeOrderUIDsInvalid, errCodeOrderUIDsTooMany, errCodeGoroutineLimit, errCodeKeyRequired,
+		errCodeTopicUnknown, errCodeTopicNoPartitions, errCodeKafkaUnavailable, errCodeOffsetInvalid,
+		errCodeMessageAlreadyProcessed,
+	} {
+		assert.Contains(t, codes, code)
+	}
+}
@@ -0,0 +1,488 @@
+// Описание: Приложение сервера в выбранном режиме запуска: HTTP API, Kafka consumer или оба компонента в одном процессе
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/goroutines"
+	"l0_test_self/internal/jsonpool"
+	"l0_test_self/internal/leader"
+	"l0_test_self/internal/metrics"
+	"l0_test_self/internal/validation"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/kafka"
+)
+
+// Режимы запуска сервера.
+const (
+	modeAll      = "all"      // HTTP API и Kafka consumer в одном процессе
+	modeAPI      = "api"      // только HTTP API, читатель Kafka не создаётся
+	modeConsumer = "consumer" // только Kafka consumer и порт проверки состояния и метрик
+)
+
+const (
+	// defaultShutdownTimeout - ограничение остановки сервера, если server.shutdown_timeout не задан
+	defaultShutdownTimeout = 10 * time.Second
+	// defaultReaderCloseTimeout - ограничение закрытия читателя Kafka, если kafka.close_timeout не задан
+	defaultReaderCloseTimeout = 5 * time.Second
+)
+
+// defaultHealthPort - адрес порта проверки состояния и метрик в режиме consumer, если server.health_port не задан
+const defaultHealthPort = ":8081"
+
+// parseMode - проверяет значение флага -mode
+func parseMode(mode string) (string, error) {
+	switch mode {
+	case modeAll, modeAPI, modeConsumer:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid mode %q: must be %s, %s or %s", mode, modeAll, modeAPI, modeConsumer)
+	}
+}
+
+// App - компоненты сервера, запускаемые в одном из режимов. Поля, не нужные режиму, могут быть пустыми:
+// reader не используется в режиме api, а в режиме consumer кэш только принимает записи.
+type App struct {
+	mode      string
+	cfg       *config.Config
+	logger    *log.Logger
+	repo      OrderRepository
+	cache     OrderCache
+	reader    MessageReader
+	dlq       MessageWriter // очередь недоставленных сообщений; создаётся, если задан kafka.consumer.max_attempts
+	acks      MessageWriter // писатель подтверждений записи заказов; создаётся, если включён kafka.consumer.order_ack
+	dbVersion func(ctx context.Context) (string, error)
+	db        *dbRecovery          // восстановление пула после потери соединений с базой данных; nil — без него
+	replica   *replicaPool         // реплика базы данных для чтений (database.replica); nil — без неё
+	monitor   *consumerMonitor     // состояние консьюмера для HTTP обработчиков; создаётся при первом обращении
+	inflight  *inflightRequests    // выполняющиеся запросы по маршрутам; создаётся вместе с маршрутами в handler
+	tls       *tls.Config          // настройки HTTPS из server.tls; nil — сервер обслуживает HTTP
+	balance   *shardBalanceMonitor // проверка распределения кэша по шардам; создаётся в Run, nil — выключена
+	archiver  *orderArchiver       // архивирование заказов старше database.retention; создаётся в Run, nil — выключено
+	instance  string               // идентификатор экземпляра сервера (имя хоста и случайный суффикс)
+	leader    *leader.Elector      // выбор лидера для фоновых задач одного экземпляра; nil — задачи выполняет каждый экземпляр
+	gap       *startupGapReport    // результат проверки разрыва при запуске (pipeline.startup_gap_check); nil — не выполнялась
+}
+
+// runsAPI - сообщает, обслуживает ли режим HTTP API
+func (a *App) runsAPI() bool { return a.mode != modeConsumer }
+
+// runsConsumer - сообщает, читает ли режим сообщения из Kafka
+func (a *App) runsConsumer() bool { return a.mode != modeAPI }
+
+// consumerMonitor - состояние консьюмера, общее для консьюмера, метрик и административных эндпоинтов
+func (a *App) consumerMonitor() *consumerMonitor {
+	if a.monitor == nil {
+		a.monitor = newConsumerMonitor(a.cfg)
+		a.monitor.db = a.db
+		a.monitor.acks = newOrderAcker(a.cfg.Kafka.Consumer.OrderAck, a.acks)
+		a.monitor.webhooks = newWebhookDispatcher(a.cfg.Webhooks, a.repo, a.logger)
+		a.monitor.throttle = newCustomerThrottle(a.cfg.Kafka.Consumer.CustomerLimit)
+		a.monitor.ingestStats = newIngestStats(a.cfg.Kafka.Consumer.IngestStats, a.repo, a.logger)
+		a.monitor.kafka.readiness = newLagReadiness(a.cfg.Kafka.Consumer, a.logger)
+	}
+	return a.monitor
+}
+
+// addr - адрес HTTP сервера режима: порт API или, в режиме consumer, порт проверки состояния и метрик
+func (a *App) addr() string {
+	if a.runsAPI() {
+		return a.cfg.Server.Port
+	}
+	if a.cfg.Server.HealthPort != "" {
+		return a.cfg.Server.HealthPort
+	}
+	return defaultHealthPort
+}
+
+// Run - запускает компоненты режима и HTTP сервер на ln, а после отмены ctx останавливает их в пределах
+// server.shutdown_timeout: HTTP сервер завершает текущие запросы (раз в секунду сообщая в лог, сколько их осталось,
+// а к дедлайну закрывая соединения незавершённых), одновременно консьюмер прекращает чтение,
+// дорабатывает и коммитит полученные сообщения, после чего закрывается читатель Kafka (не дольше kafka.close_timeout).
+func (a *App) Run(ctx context.Context, ln net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wg := &sync.WaitGroup{}
+	if a.runsConsumer() {
+		wg = startKafkaConsumer(ctx, a.reader, a.dlq, a.repo, a.cache, a.logger, a.cfg, a.consumerMonitor())
+	}
+
+	// Проверяем реплику: пока она недоступна, чтения выполняются на основной базе
+	if a.replica != nil {
+		wg.Add(1)
+		goroutines.Go("db replica health check", ctx.Done(), func() {
+			defer wg.Done()
+			a.replica.run(ctx)
+		})
+	}
+
+	// Выбираем лидера, который один выполняет удаление устаревших записей
+	if a.leader != nil {
+		wg.Add(1)
+		goroutines.Go("leader election", ctx.Done(), func() {
+			defer wg.Done()
+			a.leader.Run(ctx, a.cfg.Leader.Interval(), func(err error) { a.logger.Printf("leader election error: %v", err) })
+		})
+	}
+
+	if a.runsConsumer() {
+
+		// Удаляем исходные сообщения Kafka с истёкшим сроком хранения
+		if a.cfg.RawPayloads.Enabled {
+			wg.Add(1)
+			goroutines.Go("raw payload cleanup", ctx.Done(), func() {
+				defer wg.Done()
+				runRawPayloadCleanup(ctx, a.repo, a.leader, a.cfg.RawPayloads.Retention, a.cfg.RawPayloads.CleanupInterval, a.logger)
+			})
+		}
+
+		// Выгружаем в архив и удаляем заказы старше database.retention
+		if a.archiver = newOrderArchiver(a.cfg, a.repo, a.cache, a.logger); a.archiver != nil {
+			wg.Add(1)
+			goroutines.Go("order archive", ctx.Done(), func() {
+				defer wg.Done()
+				a.archiver.run(ctx, a.leader)
+			})
+		}
+
+		// Дописываем почасовые счётчики сообщений по отправителям в ingest_stats
+		if stats := a.consumerMonitor().ingestStats; stats != nil {
+			wg.Add(1)
+			goroutines.Go("ingest stats flush", ctx.Done(), func() {
+				defer wg.Done()
+				stats.run(ctx)
+			})
+		}
+
+		// Доставляем уведомления webhooks о записанных заказах
+		if webhooks := a.consumerMonitor().webhooks; webhooks != nil {
+			wg.Add(1)
+			goroutines.Go("webhook dispatcher", ctx.Done(), func() {
+				defer wg.Done()
+				webhooks.run(ctx)
+			})
+		}
+	}
+
+	if a.runsAPI() {
+		// Удаляем истёкшие ключи идемпотентности запросов создания заказов
+		wg.Add(1)
+		goroutines.Go("idempotency key cleanup", ctx.Done(), func() {
+			defer wg.Done()
+			idem := a.cfg.Server.Idempotency
+			runIdempotencyKeyCleanup(ctx, a.repo, a.leader, idempotencyTTL(idem), idem.CleanupInterval, a.logger)
+		})
+
+		// Удаляем записи истории доставки старше admin.delivery_history.retention
+		wg.Add(1)
+		goroutines.Go("delivery history cleanup", ctx.Done(), func() {
+			defer wg.Done()
+			history := a.cfg.Admin.DeliveryHistory
+			runDeliveryHistoryCleanup(ctx, a.repo, a.leader, history.Retention, history.CleanupInterval, a.logger)
+		})
+	}
+
+	// Следим за распределением записей и обращений кэша по шардам
+	if a.balance = newShardBalanceMonitor(a.cfg.Cache, a.cache, a.logger); a.balance != nil {
+		wg.Add(1)
+		goroutines.Go("cache shard balance", ctx.Done(), func() {
+			defer wg.Done()
+			a.balance.run(ctx, a.cfg.Cache.CheckInterval())
+		})
+	}
+
+	server := &http.Server{Handler: a.handler(), TLSConfig: a.tls}
+	serveErr := make(chan error, 1)
+	if a.tls != nil {
+		// Сертификат выдаёт TLSConfig.GetCertificate, поэтому файлы ServeTLS не передаются
+		goroutines.Go("https server", ctx.Done(), func() { serveErr <- server.ServeTLS(ln, "", "") })
+		a.logger.Printf("https server (mode=%s) starting on %s", a.mode, ln.Addr())
+	} else {
+		goroutines.Go("http server", ctx.Done(), func() { serveErr <- server.Serve(ln) })
+		a.logger.Printf("http server (mode=%s) starting on %s", a.mode, ln.Addr())
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-serveErr:
+		cancel()
+	}
+
+	shutdownTimeout := a.cfg.Server.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+	shCtx, shCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shCancel()
+
+	// HTTP сервер и консьюмер останавливаются одновременно, чтобы вся остановка укладывалась в server.shutdown_timeout
+	httpDone := make(chan struct{})
+	goroutines.Go("http shutdown", nil, func() {
+		defer close(httpDone)
+		shutdownDone, reportDone := make(chan struct{}), make(chan struct{})
+		goroutines.Go("http drain report", shutdownDone, func() {
+			defer close(reportDone)
+			a.inflight.reportDrain(shCtx, shutdownDone, a.logger)
+		})
+		serr := server.Shutdown(shCtx)
+		close(shutdownDone)
+		<-reportDone
+		if serr == nil {
+			a.logger.Println("http server stopped gracefully")
+			return
+		}
+		a.logger.Printf("http shutdown error: %v", serr)
+		// Незавершённые к дедлайну запросы прерываются закрытием их соединений
+		if busy := a.inflight.busy(); busy != "" {
+			a.logger.Printf("http shutdown: deadline reached with %d requests in flight (%s), closing connections", a.inflight.total(), busy)
+		}
+		if cerr := server.Close(); cerr != nil {
+			a.logger.Printf("http server close error: %v", cerr)
+		}
+	})
+
+	// Консьюмер уже не запрашивает новые сообщения и коммитит смещения обработанных; читатель закрывается только после этого
+	consumerDone := make(chan struct{})
+	goroutines.Go("consumer stop wait", nil, func() {
+		wg.Wait()
+		close(consumerDone)
+	})
+	select {
+	case <-consumerDone:
+		if a.runsConsumer() {
+			closeReader(shCtx, a.reader, a.cfg.Kafka.CloseTimeout, a.logger)
+			// Консьюмер больше не учитывает сообщения: записываем последний прирост счётчиков
+			a.consumerMonitor().ingestStats.flush(shCtx)
+		}
+		// Консьюмер больше не отправляет сообщения в очередь недоставленных и подтверждения
+		if a.dlq != nil {
+			if err := a.dlq.Close(); err != nil {
+				a.logger.Printf("kafka dlq writer close error: %v", err)
+			}
+		}
+		if a.acks != nil {
+			if err := a.acks.Close(); err != nil {
+				a.logger.Printf("kafka order ack writer close error: %v", err)
+			}
+		}
+	case <-shCtx.Done():
+		a.logger.Printf("consumer did not stop within shutdown timeout %s, kafka reader left open", shutdownTimeout)
+	}
+	<-httpDone
+	if err == nil {
+		// Serve возвращается сразу после Shutdown или Close; его горутина не переживает Run
+		err = <-serveErr
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// closeReader - закрывает читатель Kafka, ожидая не дольше timeout (0 — defaultReaderCloseTimeout) и дедлайна ctx:
+// при недоступных брокерах Close может зависнуть, и тогда остановка продолжается без него
+func closeReader(ctx context.Context, reader MessageReader, timeout time.Duration, logger *log.Logger) {
+	if timeout <= 0 {
+		timeout = defaultReaderCloseTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	closed := make(chan error, 1)
+	goroutines.Go("kafka reader close", nil, func() { closed <- reader.Close() })
+	select {
+	case err := <-closed:
+		if err != nil {
+			logger.Printf("kafka reader close error: %v", err)
+			return
+		}
+		logger.Println("kafka reader closed")
+	case <-ctx.Done():
+		logger.Printf("kafka reader close did not finish within %s, continuing shutdown", timeout)
+	}
+}
+
+// handler - маршруты HTTP сервера режима. В режиме consumer доступны только проверка состояния, метрики
+// и выполняющиеся запросы.
+func (a *App) handler() http.Handler {
+	cfg := a.cfg
+	reg := metrics.NewRegistry()
+	mux := http.NewServeMux()
+	// Каждый маршрут учитывается в таблице выполняющихся запросов, которую читают метрики, /admin/requests и остановка
+	inflight := &inflightRequests{}
+	a.inflight = inflight
+	handle := func(pattern string, h http.Handler) { mux.Handle(pattern, inflight.track(pattern, h)) }
+	handle("GET /healthz", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }))
+	var lagReady *lagReadiness
+	if a.runsConsumer() {
+		lagReady = a.consumerMonitor().kafka.readiness
+	}
+	handle("GET /readyz", makeReadinessHandler(a.db, a.replica, lagReady, a.logger))
+	a.db.register(reg)
+	a.replica.register(reg)
+	lagReady.register(reg)
+	a.balance.register(reg)
+	if a.leader != nil {
+		reg.GaugeFunc("leader", "Whether this instance holds the leadership for singleton background jobs (1) or not (0).", func() float64 {
+			if a.leader.IsLeader() {
+				return 1
+			}
+			return 0
+		})
+		reg.RegisterCounter("leader_changes_total", "Times this instance acquired or lost the leadership for singleton background jobs.", a.leader.Changes())
+	}
+	handle("GET /admin/metrics", requireAdmin(cfg.Admin.APIKey, reg.Handler()))
+	handle("GET /admin/requests", requireAdmin(cfg.Admin.APIKey, makeInflightHandler(inflight, a.logger)))
+	handle("GET /admin/goroutines", requireAdmin(cfg.Admin.APIKey, makeGoroutinesHandler(goroutines.Default(), a.logger)))
+	jsonpool.Default.RegisterMetrics(reg, "json_buffer_pool")
+	reg.GaugeFunc("goroutines", "Goroutines that currently exist in the process.", func() float64 { return float64(runtime.NumGoroutine()) })
+	reg.GaugeVecFunc("background_goroutines", "Registered background goroutines, by name.", "name", func() map[string]float64 {
+		counts := goroutines.Default().CountByName()
+		values := make(map[string]float64, len(counts))
+		for name, n := range counts {
+			values[name] = float64(n)
+		}
+		return values
+	})
+	reg.GaugeVecFunc("http_requests_in_flight", "Requests currently being served, by route.", "route", func() map[string]float64 {
+		counts := inflight.snapshot()
+		values := make(map[string]float64, len(counts))
+		for route, n := range counts {
+			values[route] = float64(n)
+		}
+		return values
+	})
+	var latency *latencyMonitor
+	var throttle *customerThrottle
+	var ingest *ingestCache
+	if a.runsConsumer() {
+		monitor := a.consumerMonitor()
+		latency, throttle, ingest = monitor.latency, monitor.throttle, monitor.ingest
+		latency.register(reg)
+		monitor.kafka.register(reg)
+		monitor.acks.register(reg)
+		monitor.webhooks.register(reg)
+		throttle.register(reg)
+		monitor.queues.register(reg)
+		monitor.ingestStats.register(reg)
+		reg.RegisterCounter("consumer_poison_messages_total", "Messages sent to the DLQ after exhausting kafka.consumer.max_attempts.", monitor.poison)
+		reg.RegisterCounter("consumer_ingest_cached_total", "Ingested orders put into the cache (pipeline.cache_on_ingest).", monitor.ingest.cached)
+		reg.RegisterCounter("consumer_ingest_cache_skipped_total", "Ingested orders left for read-through caching by pipeline.cache_on_ingest.", monitor.ingest.skipped)
+		reg.RegisterCounter("consumer_skipped_messages_total", "Messages skipped without processing by POST /admin/consumer/skip and saved to the spill file.", monitor.skipped)
+		reg.RegisterCounter("order_total_price_corrections_total", "Order items whose total_price disagreed with price and sale (corrected or flagged per validation.total_price.mode).", validation.TotalPriceCorrections())
+		reg.RegisterCounter("order_postal_code_invalid_total", "Orders whose delivery zip does not match the format of its region (rejected or flagged per validation.postal_codes.mode).", validation.PostalInvalidCodes())
+		reg.RegisterCounter("order_payment_currency_unknown_total", "Payments whose currency is not an ISO 4217 code after normalization (rejected or flagged per validation.currency.mode).", validation.UnknownCurrencies())
+		reg.RegisterCounter("order_track_number_invalid_total", "Orders whose normalized track_number does not match validation.track_number.pattern (rejected or flagged per validation.track_number.mode).", validation.InvalidTrackNumbers())
+		reg.RegisterCounter("order_postal_code_unknown_region_total", "Orders whose delivery zip was not checked because validation.postal_codes has no format for the region.", validation.PostalUnknownRegions())
+		handle("GET /admin/errors", requireAdmin(cfg.Admin.APIKey, makeErrorsHandler(monitor.errors, a.logger)))
+		handle("POST /admin/errors/clear", requireAdmin(cfg.Admin.APIKey, makeErrorsClearHandler(monitor.errors, a.logger)))
+		handle("POST /admin/consumer/skip", requireAdmin(cfg.Admin.APIKey, makeConsumerSkipHandler(a.repo, monitor.skips, consumedTopics(cfg), a.logger)))
+		handle("GET /admin/webhooks/status", requireAdmin(cfg.Admin.APIKey, makeWebhooksStatusHandler(monitor.webhooks, a.logger)))
+		handle("GET /admin/ingest/anomalies", requireAdmin(cfg.Admin.APIKey, makeIngestAnomaliesHandler(monitor.ingestStats, a.logger)))
+		a.archiver.register(reg)
+		handle("GET /admin/retention/status", requireAdmin(cfg.Admin.APIKey, makeRetentionStatusHandler(a.archiver, a.logger)))
+	}
+	if !a.runsAPI() {
+		return withRequestID(withSecurityHeaders(cfg.Server.SecurityHeaders, requireClientCert(cfg.Server.TLS, mux)))
+	}
+
+	// Чтения HTTP обработчиков идут через общий выключатель, не затрагивающий запись консьюмера
+	readBreaker := newReadBreaker(cfg.Server.DBFallback.Breaker, clock.Real, a.logger)
+	readRepo := newBreakerRepository(a.repo, readBreaker, cfg.Server.DBFallback.Timeout)
+	readRepo.db = a.db
+	reg.GaugeFunc("db_read_breaker_state", "State of the DB read circuit breaker (0 closed, 1 open, 2 half-open).",
+		func() float64 { return float64(readBreaker.State()) })
+
+	logger, cc := a.logger, a.cache
+	handle("/", withContentSecurityPolicy(cfg.Server.SecurityHeaders, http.FileServer(http.Dir("../../web"))))
+	pii := newPIIPolicy(cfg.Admin)
+	tenants := newTenantResolver(cfg)
+	shadow := newShadowVerifier(cfg.Cache, cc, readRepo, logger)
+	shadow.register(reg)
+	handle("/order", tenants.withTenant(makeOrderHandler(cc, readRepo, pii, shadow, logger)))
+	handle("HEAD /orders/{id}", tenants.withTenant(makeOrderExistsHandler(cc, readRepo, logger)))
+	handle("GET /orders/{id}/delivery", tenants.withTenant(makeOrderSectionHandler(deliverySection, cc, readRepo, pii, logger)))
+	handle("GET /orders/{id}/payment", tenants.withTenant(makeOrderSectionHandler(paymentSection, cc, readRepo, pii, logger)))
+	handle("GET /orders/{id}/items", tenants.withTenant(makeOrderSectionHandler(itemsSection, cc, readRepo, pii, logger)))
+	cursors := newCursorSigner(cfg.Server.Cursor, logger)
+	handle("GET /orders", tenants.withTenant(makeOrderSearchHandler(readRepo, pii, cursors, logger)))
+	handle("GET /customers/{id}/orders", tenants.withTenant(makeCustomerOrdersHandler(readRepo, pii, cursors, logger)))
+	handle("GET /meta/statuses", makeItemStatusesHandler(logger))
+	// Публичные эндпоинты страницы web/ с краткими сведениями о заказах; кольцо последних заказов ведёт консьюмер
+	var processed *recentOrders
+	if a.runsConsumer() {
+		processed = a.consumerMonitor().processed
+	}
+	webLimiter := newWebAPILimiter(cfg.Server.WebAPI.Rate())
+	handle("GET /api/recent", withClientRateLimit(webLimiter, tenants.withTenant(makeRecentOrdersHandler(processed, readRepo, logger))))
+	handle("GET /api/suggest", withClientRateLimit(webLimiter, tenants.withTenant(makeSuggestHandler(cc, readRepo, logger))))
+	handle("POST /orders", requireAdmin(cfg.Admin.APIKey, tenants.withTenant(makeOrderCreateHandler(a.repo, cc, cfg.Server.Idempotency, clock.Real, logger))))
+	// Проверка заказа без сохранения: доступ как у создания заказа, частота запросов с одного адреса ограничена
+	validateLimiter := newWebAPILimiter(cfg.Server.OrderValidate.Rate())
+	handle("POST /orders/validate", requireAdmin(cfg.Admin.APIKey, withClientRateLimit(validateLimiter, tenants.withTenant(makeOrderValidateHandler(logger)))))
+
+	// Административные эндпоинты; эндпоинты заказов и кэша работают с заказами арендатора запроса
+	handle("POST /admin/orders/{id}/refresh", requireAdmin(cfg.Admin.APIKey, tenants.withTenant(makeOrderRefreshHandler(readRepo, cc, logger))))
+	handle("PATCH /admin/orders/{id}/delivery", requireAdmin(cfg.Admin.APIKey, tenants.withTenant(makeOrderDeliveryPatchHandler(a.repo, cc, logger))))
+	handle("GET /admin/orders/{id}/delivery/history", requireAdmin(cfg.Admin.APIKey, tenants.withTenant(makeDeliveryHistoryHandler(readRepo, logger))))
+	handle("GET /admin/orders/{id}/raw", requireAdmin(cfg.Admin.APIKey, tenants.withTenant(makeRawPayloadHandler(readRepo, logger))))
+	handle("GET /admin/orders/{id}/diff", requireAdmin(cfg.Admin.APIKey, tenants.withTenant(makeOrderDiffHandler(readRepo, cc, logger))))
+	handle("GET /admin/orders/incomplete", requireAdmin(cfg.Admin.APIKey, tenants.withTenant(makeIncompleteOrdersHandler(readRepo, logger))))
+	handle("GET /admin/cache/keys", requireAdmin(cfg.Admin.APIKey, tenants.withTenant(makeCacheKeysHandler(cc, logger))))
+	handle("POST /admin/cache/resize", requireAdmin(cfg.Admin.APIKey, makeCacheResizeHandler(cc, cfg.Cache.ShardCount, logger)))
+	handle("GET /admin/cache/stats", requireAdmin(cfg.Admin.APIKey, makeCacheStatsHandler(cc, shadow, logger)))
+	handle("POST /admin/cache/cleanup", requireAdmin(cfg.Admin.APIKey, makeCacheCleanupHandler(cc, logger)))
+	handle("POST /admin/cache/enable", requireAdmin(cfg.Admin.APIKey, makeCacheSwitchHandler(cc, true, logger)))
+	handle("POST /admin/cache/disable", requireAdmin(cfg.Admin.APIKey, makeCacheSwitchHandler(cc, false, logger)))
+	handle("POST /admin/cache/{id}/pin", requireAdmin(cfg.Admin.APIKey, tenants.withTenant(makeCachePinHandler(readRepo, cc, logger))))
+	handle("DELETE /admin/cache/{id}/pin", requireAdmin(cfg.Admin.APIKey, tenants.withTenant(makeCacheUnpinHandler(cc, logger))))
+	handle("POST /admin/cache/preload", requireAdmin(cfg.Admin.APIKey, tenants.withTenant(makeCachePreloadHandler(readRepo, cc, cfg.Admin.Preload, logger))))
+	handle("GET /admin/orders/export", requireAdmin(cfg.Admin.APIKey, tenants.withTenant(makeOrderExportHandler(readRepo, cfg.Admin.Export, logger))))
+	// Курсы проверены при загрузке конфигурации (config.Validate)
+	usdRates, err := cfg.Admin.Stats.Rates()
+	if err != nil {
+		logger.Printf("stats: %v, approx_total_usd disabled", err)
+	}
+	handle("GET /admin/stats/breakdown", requireAdmin(cfg.Admin.APIKey, tenants.withTenant(makeBreakdownHandler(readRepo, usdRates, logger))))
+	handle("GET /admin/ingest/stats", requireAdmin(cfg.Admin.APIKey, tenants.withTenant(makeIngestStatsHandler(readRepo, logger))))
+	handle("GET /admin/version", requireAdmin(cfg.Admin.APIKey, makeVersionHandler(a.dbVersion, cfg.Kafka.Brokers, a.instance, a.leader, logger)))
+	topicPartitions := func(ctx context.Context, topic string) ([]kafka.PartitionInfo, error) {
+		kc := cfg.Kafka.ToKafkaConfig()
+		kc.Topic = topic
+		return kafka.TopicPartitions(ctx, kc)
+	}
+	handle("GET /admin/kafka/partition", requireAdmin(cfg.Admin.APIKey, makeKafkaPartitionHandler(topicPartitions, consumedTopics(cfg), logger)))
+	handle("GET /admin/consumer/status", requireAdmin(cfg.Admin.APIKey, makeConsumerStatusHandler(cfg.Pipeline.Mode, readBreaker, latency, throttle, ingest, a.gap, logger)))
+
+	return withRequestID(withSecurityHeaders(cfg.Server.SecurityHeaders, requireClientCert(cfg.Server.TLS, mux)))
+}
+
+// discardCache - кэш режима consumer, где заказы из него никто не читает, и выключенный кэш API (cache.enabled: false):
+// записи отбрасываются, чтения промахиваются
+type discardCache struct{}
+
+func (discardCache) Set(string, orders.Order)                             {}
+func (discardCache) SetIfNewer(string, orders.Order, int64) bool          { return false }
+func (discardCache) Get(string, string) (orders.Order, bool)              { return orders.Order{}, false }
+func (discardCache) GetJSON(string, string) ([]byte, bool)                { return nil, false }
+func (discardCache) MarkMissing(string, string)                           {}
+func (discardCache) IsMissing(string, string) bool                        { return false }
+func (discardCache) Contains(string, string) bool                         { return false }
+func (discardCache) Delete(string, string)                                {}
+func (discardCache) LoadFromSlice(string, []orders.Order)                 {}
+func (discardCache) Range(func(tenantID, id string, o orders.Order) bool) {}
+func (discardCache) Len() int                                             { return 0 }
@@ -0,0 +1,285 @@
+// Описание: Тесты режимов запуска сервера: в каждом режиме запускаются только его компоненты, а после остановки
+// не остаётся их горутин
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/cache"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/goroutines"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+// startTestApp - запускает приложение на свободном порту и возвращает базовый URL и функцию остановки,
+// которая дожидается завершения Run и возвращает его ошибку. Незаданный server.shutdown_timeout равен 1s;
+// с настройками TLS (app.tls) URL начинается с https://.
+func startTestApp(t *testing.T, app *App) (string, func() error) {
+	t.Helper()
+	if app.cfg.Server.ShutdownTimeout == 0 {
+		app.cfg.Server.ShutdownTimeout = time.Second
+	}
+	app.cfg.Admin.APIKey = testAdminKey
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- app.Run(ctx, ln) }()
+	stop := func() error {
+		cancel()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("app did not stop")
+			return nil
+		}
+	}
+	if app.tls != nil {
+		return "https://" + ln.Addr().String(), stop
+	}
+	return "http://" + ln.Addr().String(), stop
+}
+
+// getStatus - выполняет GET запрос с ключом администратора и возвращает код ответа
+func getStatus(t *testing.T, url string) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	req.Header.Set("X-API-Key", testAdminKey)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func (r *redeliveringReader) fetches() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pos
+}
+
+func newAppTestReader(t *testing.T) *redeliveringReader {
+	return &redeliveringReader{msgs: []kafka2.Message{
+		{Topic: "orders", Offset: 0, Value: mustOrderJSON(t, testorders.NewGenerator(11))},
+	}}
+}
+
+func TestAppAPIModeDoesNotReadKafka(t *testing.T) {
+	reader := newAppTestReader(t)
+	repo := &fakeRepository{orders: map[string]orders.Order{"order-1": {OrderUid: "order-1"}}}
+	app := &App{mode: modeAPI, cfg: newConsumerTestConfig(), logger: newTestLogger(), repo: repo, cache: newTestCache(t), reader: reader}
+	url, stop := startTestApp(t, app)
+
+	assert.Equal(t, http.StatusOK, getStatus(t, url+"/order?id=order-1"))
+	assert.Equal(t, http.StatusOK, getStatus(t, url+"/admin/cache/keys"))
+	assert.Equal(t, http.StatusOK, getStatus(t, url+"/healthz"))
+	require.NoError(t, stop())
+
+	assert.Zero(t, reader.fetches(), "api mode must not fetch messages")
+	inserts, _ := repo.stats()
+	assert.Zero(t, inserts)
+}
+
+func TestAppConsumerModeServesOnlyHealthAndMetrics(t *testing.T) {
+	reader := newAppTestReader(t)
+	repo := &fakeRepository{}
+	app := &App{mode: modeConsumer, cfg: newConsumerTestConfig(), logger: newTestLogger(), repo: repo, cache: discardCache{}, reader: reader}
+	url, stop := startTestApp(t, app)
+
+	require.Eventually(t, func() bool {
+		_, stored := repo.stats()
+		return stored == 1
+	}, 5*time.Second, time.Millisecond)
+
+	assert.Equal(t, http.StatusOK, getStatus(t, url+"/healthz"))
+	assert.Equal(t, http.StatusOK, getStatus(t, url+"/admin/metrics"))
+	for _, path := range []string{"/", "/order?id=order-1", "/admin/cache/keys", "/admin/version", "/admin/consumer/status"} {
+		assert.Equal(t, http.StatusNotFound, getStatus(t, url+path), path)
+	}
+	require.NoError(t, stop())
+}
+
+func TestAppAllModeRunsBoth(t *testing.T) {
+	reader := newAppTestReader(t)
+	repo := &fakeRepository{}
+	c := newTestCache(t)
+	app := &App{mode: modeAll, cfg: newConsumerTestConfig(), logger: newTestLogger(), repo: repo, cache: c, reader: reader}
+	url, stop := startTestApp(t, app)
+
+	require.Eventually(t, func() bool { return c.Len() == 1 }, 5*time.Second, time.Millisecond)
+	var uid string
+	c.Range(func(_, id string, _ orders.Order) bool {
+		uid = id
+		return false
+	})
+	assert.Equal(t, http.StatusOK, getStatus(t, url+"/order?id="+uid))
+	require.NoError(t, stop())
+}
+
+func TestAppStopLeavesNoGoroutines(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	registry := goroutines.Default()
+	require.Eventually(t, func() bool { return registry.Len() == 0 }, time.Second, time.Millisecond, "goroutines of the previous tests have stopped")
+
+	c, err := cache.NewWithOptions(cache.WithShards(4), cache.WithTTL(time.Hour), cache.WithCleanupInterval(time.Hour))
+	require.NoError(t, err)
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.Consumer.StatsInterval = time.Hour
+	cfg.Server.Idempotency.CleanupInterval = time.Hour
+	app := &App{mode: modeAll, cfg: cfg, logger: newTestLogger(), repo: &fakeRepository{}, cache: c, reader: newAppTestReader(t)}
+	url, stop := startTestApp(t, app)
+	require.Eventually(t, func() bool { return c.Len() == 1 }, 5*time.Second, time.Millisecond)
+
+	req, err := http.NewRequest(http.MethodGet, url+"/admin/goroutines", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-API-Key", testAdminKey)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	var got goroutinesResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	resp.Body.Close()
+	names := make([]string, 0, len(got.Goroutines))
+	for _, g := range got.Goroutines {
+		assert.Equal(t, goroutines.StateRunning, g.State, g.Name)
+		assert.False(t, g.StartedAt.IsZero(), g.Name)
+		names = append(names, g.Name)
+	}
+	assert.ElementsMatch(t, []string{"cache cleaner", "kafka consumer", "kafka client stats", "idempotency key cleanup", "http server"}, names)
+	assert.Equal(t, len(names), got.Registered)
+	assert.GreaterOrEqual(t, got.Runtime, got.Registered)
+
+	require.NoError(t, stop())
+	c.Close()
+	require.Eventually(t, func() bool { return registry.Len() == 0 }, time.Second, time.Millisecond,
+		"registered goroutines left running: %v", registry.Snapshot())
+}
+
+func TestAppAddr(t *testing.T) {
+	cfg := &config.Config{Server: config.ServerConfig{Port: ":8080"}}
+	assert.Equal(t, ":8080", (&App{mode: modeAll, cfg: cfg}).addr())
+	assert.Equal(t, ":8080", (&App{mode: modeAPI, cfg: cfg}).addr())
+	assert.Equal(t, defaultHealthPort, (&App{mode: modeConsumer, cfg: cfg}).addr())
+
+	cfg.Server.HealthPort = ":9100"
+	assert.Equal(t, ":9100", (&App{mode: modeConsumer, cfg: cfg}).addr())
+}
+
+func TestParseMode(t *testing.T) {
+	for _, mode := range []string{modeAll, modeAPI, modeConsumer} {
+		got, err := parseMode(mode)
+		require.NoError(t, err)
+		assert.Equal(t, mode, got)
+	}
+	_, err := parseMode("worker")
+	assert.ErrorContains(t, err, "invalid mode")
+}
+
+// blockingCloseReader - читатель, выдающий одно сообщение; Close блокируется до закрытия unblock, как при недоступных брокерах.
+// events фиксирует порядок остановки: завершение чтения, коммит и закрытие.
+type blockingCloseReader struct {
+	mu      sync.Mutex
+	msg     kafka2.Message
+	fetched bool
+	events  []string
+	unblock chan struct{}
+}
+
+func (r *blockingCloseReader) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *blockingCloseReader) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func (r *blockingCloseReader) FetchMessage(ctx context.Context) (kafka2.Message, error) {
+	r.mu.Lock()
+	if !r.fetched {
+		r.fetched = true
+		r.mu.Unlock()
+		return r.msg, nil
+	}
+	r.mu.Unlock()
+	<-ctx.Done()
+	r.record("fetch stopped")
+	return kafka2.Message{}, ctx.Err()
+}
+
+func (r *blockingCloseReader) CommitMessages(context.Context, ...kafka2.Message) error {
+	r.record("commit")
+	return nil
+}
+
+func (r *blockingCloseReader) Stats() kafka2.ReaderStats { return kafka2.ReaderStats{} }
+
+func (r *blockingCloseReader) Close() error {
+	r.record("close")
+	<-r.unblock
+	return nil
+}
+
+func TestAppShutdownHonorsReaderCloseTimeout(t *testing.T) {
+	reader := &blockingCloseReader{msg: kafka2.Message{Topic: "orders", Value: mustOrderJSON(t, testorders.NewGenerator(12))}, unblock: make(chan struct{})}
+	t.Cleanup(func() { close(reader.unblock) })
+	repo := &fakeRepository{}
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.CloseTimeout = 50 * time.Millisecond
+	app := &App{mode: modeConsumer, cfg: cfg, logger: newTestLogger(), repo: repo, cache: discardCache{}, reader: reader}
+	_, stop := startTestApp(t, app)
+
+	require.Eventually(t, func() bool {
+		_, stored := repo.stats()
+		return stored == 1
+	}, 5*time.Second, time.Millisecond)
+
+	start := time.Now()
+	require.NoError(t, stop())
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 50*time.Millisecond, "close is awaited up to the deadline")
+	assert.Less(t, elapsed, 500*time.Millisecond, "a hanging close must not block shutdown")
+	assert.Equal(t, []string{"commit", "fetch stopped", "close"}, reader.recorded())
+}
+
+func TestAppShutdownBoundedByShutdownTimeout(t *testing.T) {
+	reader := &blockingCloseReader{msg: kafka2.Message{Topic: "orders", Value: mustOrderJSON(t, testorders.NewGenerator(13))}, unblock: make(chan struct{})}
+	t.Cleanup(func() { close(reader.unblock) })
+	// Запись заказа зависает, поэтому консьюмер не успевает остановиться
+	insertStarted := make(chan struct{})
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	repo := &fakeRepository{onInsert: func() {
+		close(insertStarted)
+		<-release
+	}}
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.CloseTimeout = time.Minute
+	app := &App{mode: modeAll, cfg: cfg, logger: newTestLogger(), repo: repo, cache: newTestCache(t), reader: reader}
+	_, stop := startTestApp(t, app)
+	<-insertStarted
+
+	start := time.Now()
+	require.NoError(t, stop())
+	elapsed := time.Since(start)
+	// startTestApp задаёт server.shutdown_timeout в 1s
+	assert.GreaterOrEqual(t, elapsed, time.Second)
+	assert.Less(t, elapsed, 2*time.Second)
+	assert.NotContains(t, reader.recorded(), "close", "the reader is not closed while messages are still being processed")
+}
@@ -0,0 +1,385 @@
+// Описание: Архивирование заказов старше database.retention: полные документы заказов выгружаются в сжатые файлы
+// NDJSON (по файлу на арендатора и день date_created), файл сверяется по числу строк и контрольной сумме, после чего
+// заказы удаляются из базы данных пачками транзакций. При выборе лидера (секция leader) архивирует только лидер
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/jsonpool"
+	"l0_test_self/internal/leader"
+	"l0_test_self/internal/metrics"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+)
+
+// orderArchiver - выгрузка заказов старше retention в архив и их удаление; последний запуск показывает
+// GET /admin/retention/status
+type orderArchiver struct {
+	repo      OrderRepository
+	cache     OrderCache // из кэша удаляются удалённые из базы заказы
+	tenants   []string
+	retention time.Duration
+	cfg       config.ArchiveConfig
+	clock     clock.Clock // время запусков в статусе, в тестах подменяется
+	logger    *log.Logger
+
+	archived *metrics.Counter // заказов выгружено и удалено
+	written  *metrics.Counter // байт записано в файлы архива
+
+	mu   sync.Mutex
+	last *archiveRun
+}
+
+// archiveRun - итог запуска архивирования
+type archiveRun struct {
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Before     time.Time     `json:"before"` // архивируются заказы с date_created раньше этой границы
+	DryRun     bool          `json:"dry_run"`
+	Orders     int64         `json:"orders"`  // заказов выгружено в архив; при dry_run — было бы выгружено и удалено
+	Deleted    int64         `json:"deleted"` // заказов удалено из базы данных
+	Bytes      int64         `json:"bytes"`   // байт записано в файлы архива
+	Files      []archiveFile `json:"files,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// archiveFile - файл архива, записанный запуском (при dry_run — файл, который был бы записан)
+type archiveFile struct {
+	Name   string `json:"name"`
+	Tenant string `json:"tenant"`
+	Day    string `json:"day"`
+	Orders int    `json:"orders"`
+	Bytes  int64  `json:"bytes,omitempty"`
+	SHA256 string `json:"sha256,omitempty"` // контрольная сумма несжатого NDJSON
+}
+
+// newOrderArchiver - создает архивирование по настройкам database; nil, если database.retention не задан
+func newOrderArchiver(cfg *config.Config, repo OrderRepository, orderCache OrderCache, logger *log.Logger) *orderArchiver {
+	if cfg.Database.Retention <= 0 {
+		return nil
+	}
+	return &orderArchiver{
+		repo:      repo,
+		cache:     orderCache,
+		tenants:   cfg.TenantIDs(),
+		retention: cfg.Database.Retention,
+		cfg:       cfg.Database.Archive,
+		clock:     clock.Real,
+		logger:    logger,
+		archived:  &metrics.Counter{},
+		written:   &metrics.Counter{},
+	}
+}
+
+// run - архивирует заказы каждые archive.interval до отмены контекста; при выборе лидера — только на лидере
+func (a *orderArchiver) run(ctx context.Context, jobs *leader.Elector) {
+	runPeriodic(ctx, jobs, a.retention, a.cfg.RunInterval(), func(ctx context.Context, before time.Time) { a.archive(ctx, before) })
+}
+
+// register - регистрирует метрики архивирования в реестре
+func (a *orderArchiver) register(reg *metrics.Registry) {
+	if a == nil {
+		return
+	}
+	reg.RegisterCounter("orders_archived_total", "Orders older than database.retention exported to the archive and deleted.", a.archived)
+	reg.RegisterCounter("orders_archive_bytes_written_total", "Compressed bytes written to archive files.", a.written)
+}
+
+// archive - выгружает и удаляет заказы всех арендаторов с date_created раньше before. Первая ошибка прекращает
+// запуск: заказы, которые не удалось выгрузить и сверить, остаются в базе до следующего запуска.
+func (a *orderArchiver) archive(ctx context.Context, before time.Time) archiveRun {
+	run := archiveRun{StartedAt: a.clock.Now(), Before: before, DryRun: a.cfg.DryRun}
+	var err error
+	if !a.cfg.DryRun {
+		err = os.MkdirAll(a.cfg.Dir, 0o755)
+	}
+	for _, tenantID := range a.tenants {
+		if err != nil {
+			break
+		}
+		err = a.archiveTenant(ctx, tenantID, before, &run)
+	}
+	run.FinishedAt = a.clock.Now()
+	if err != nil {
+		run.Error = err.Error()
+		a.logger.Printf("order archive error: %v", err)
+	}
+	switch {
+	case run.DryRun && run.Orders > 0:
+		a.logger.Printf("order archive (dry run): %d orders created before %s would be archived and deleted", run.Orders, before.Format(time.RFC3339))
+	case run.Orders > 0:
+		a.logger.Printf("order archive: archived %d orders created before %s (deleted=%d bytes=%d files=%d)",
+			run.Orders, before.Format(time.RFC3339), run.Deleted, run.Bytes, len(run.Files))
+	}
+
+	a.mu.Lock()
+	a.last = &run
+	a.mu.Unlock()
+	return run
+}
+
+// archiveTenant - выгружает заказы арендатора tenantID постранично в порядке date_created; заказы дня удаляются после
+// сверки его файла, до чтения заказов следующего дня
+func (a *orderArchiver) archiveTenant(ctx context.Context, tenantID string, before time.Time, run *archiveRun) error {
+	include := postgres.IncludeAll
+	if a.cfg.DryRun {
+		include = 0
+	}
+	batch := a.cfg.Batch()
+	var cursor *postgres.OrderCursor
+	var day *archiveDay
+	defer func() {
+		if day != nil {
+			day.discard()
+		}
+	}()
+	for {
+		page, err := a.repo.ListOrdersAfter(ctx, tenantID, cursor, time.Time{}, before, batch, include, "")
+		if err != nil {
+			return fmt.Errorf("list orders of tenant %s: %w", tenantID, err)
+		}
+		for _, o := range page {
+			d := o.DateCreated.UTC().Format(time.DateOnly)
+			if day != nil && day.day != d {
+				finished := day
+				day = nil
+				if err := a.finishDay(ctx, finished, before, run); err != nil {
+					return err
+				}
+			}
+			if day == nil {
+				if day, err = a.startDay(tenantID, d); err != nil {
+					return err
+				}
+			}
+			if err := day.write(o); err != nil {
+				return fmt.Errorf("write archive %s: %w", day.name, err)
+			}
+		}
+		if len(page) < batch {
+			break
+		}
+		last := page[len(page)-1]
+		cursor = &postgres.OrderCursor{DateCreated: last.DateCreated, OrderUid: last.OrderUid}
+	}
+	if day == nil {
+		return nil
+	}
+	finished := day
+	day = nil
+	return a.finishDay(ctx, finished, before, run)
+}
+
+// archiveDay - файл архива заказов одного дня арендатора, который ещё пишется во временный файл
+type archiveDay struct {
+	tenant string
+	day    string
+	name   string
+	uids   []string
+
+	file *os.File // nil при dry_run
+	gz   *gzip.Writer
+	out  *ndjsonExportWriter
+	sum  hash.Hash // контрольная сумма несжатого NDJSON
+}
+
+// startDay - начинает файл архива дня day арендатора tenantID во временном файле каталога архива
+func (a *orderArchiver) startDay(tenantID, day string) (*archiveDay, error) {
+	d := &archiveDay{tenant: tenantID, day: day, name: archiveFileName(tenantID, day, 0)}
+	if a.cfg.DryRun {
+		return d, nil
+	}
+	f, err := os.CreateTemp(a.cfg.Dir, ".orders-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("create archive file: %w", err)
+	}
+	d.file, d.gz, d.sum = f, gzip.NewWriter(f), sha256.New()
+	d.out = &ndjsonExportWriter{w: io.MultiWriter(d.gz, d.sum), buf: jsonpool.Get()}
+	return d, nil
+}
+
+// archiveFileName - имя файла архива дня day арендатора tenantID; n > 0 — n-й файл дня, если прежние уже есть
+func archiveFileName(tenantID, day string, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("orders_%s_%s.ndjson.gz", tenantID, day)
+	}
+	return fmt.Sprintf("orders_%s_%s.%d.ndjson.gz", tenantID, day, n)
+}
+
+// write - добавляет заказ в файл дня
+func (d *archiveDay) write(o orders.Order) error {
+	d.uids = append(d.uids, o.OrderUid)
+	if d.file == nil {
+		return nil
+	}
+	return d.out.Write(o)
+}
+
+// close - дописывает и закрывает временный файл и возвращает его размер
+func (d *archiveDay) close() (int64, error) {
+	defer jsonpool.Put(d.out.buf)
+	err := errors.Join(d.out.Flush(), d.gz.Close(), d.file.Sync())
+	info, statErr := d.file.Stat()
+	if err = errors.Join(err, statErr, d.file.Close()); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// discard - удаляет временный файл недописанного дня
+func (d *archiveDay) discard() {
+	if d.file == nil {
+		return
+	}
+	jsonpool.Put(d.out.buf)
+	d.file.Close()
+	os.Remove(d.file.Name())
+}
+
+// finishDay - закрывает и сверяет файл дня, переименовывает его в постоянное имя и удаляет заказы дня пачками
+// по archive.batch_size. При dry_run только учитывает заказы дня в итоге запуска.
+func (a *orderArchiver) finishDay(ctx context.Context, d *archiveDay, before time.Time, run *archiveRun) error {
+	file := archiveFile{Name: d.name, Tenant: d.tenant, Day: d.day, Orders: len(d.uids)}
+	if d.file == nil {
+		run.Orders += int64(len(d.uids))
+		run.Files = append(run.Files, file)
+		return nil
+	}
+
+	tmp := d.file.Name()
+	size, err := d.close()
+	if err == nil {
+		err = verifyArchive(tmp, len(d.uids), d.sum.Sum(nil))
+	}
+	if err == nil {
+		file.Name, err = a.publish(tmp, d.tenant, d.day)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("archive %s: %w", d.name, err)
+	}
+	file.Bytes, file.SHA256 = size, hex.EncodeToString(d.sum.Sum(nil))
+	run.Files = append(run.Files, file)
+	run.Orders += int64(len(d.uids))
+	run.Bytes += size
+	a.written.Add(uint64(size))
+
+	for start := 0; start < len(d.uids); start += a.cfg.Batch() {
+		chunk := d.uids[start:min(start+a.cfg.Batch(), len(d.uids))]
+		deleted, err := a.repo.DeleteArchivedOrders(ctx, d.tenant, chunk, before)
+		if err != nil {
+			return fmt.Errorf("delete archived orders of %s: %w", file.Name, err)
+		}
+		for _, uid := range chunk {
+			a.cache.Delete(d.tenant, uid)
+		}
+		run.Deleted += deleted
+		a.archived.Add(uint64(deleted))
+	}
+	return nil
+}
+
+// publish - переименовывает сверенный временный файл tmp в первое свободное имя файла дня и возвращает это имя
+func (a *orderArchiver) publish(tmp, tenantID, day string) (string, error) {
+	for n := 0; ; n++ {
+		name := archiveFileName(tenantID, day, n)
+		path := filepath.Join(a.cfg.Dir, name)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		return name, os.Rename(tmp, path)
+	}
+}
+
+// verifyArchive - перечитывает сжатый файл path и сверяет число строк и контрольную сумму несжатого NDJSON
+// с записанными
+func verifyArchive(path string, lines int, sum []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	h, counter := sha256.New(), &lineCounter{}
+	if _, err := io.Copy(io.MultiWriter(h, counter), zr); err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	if counter.n != lines {
+		return fmt.Errorf("verify: %d lines written, %d read back", lines, counter.n)
+	}
+	if !bytes.Equal(h.Sum(nil), sum) {
+		return fmt.Errorf("verify: checksum mismatch")
+	}
+	return nil
+}
+
+// lineCounter - io.Writer, считающий переводы строк
+type lineCounter struct{ n int }
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	c.n += bytes.Count(p, []byte{'\n'})
+	return len(p), nil
+}
+
+// retentionStatus - ответ GET /admin/retention/status
+type retentionStatus struct {
+	Enabled      bool        `json:"enabled"`
+	Retention    string      `json:"retention,omitempty"`
+	Dir          string      `json:"dir,omitempty"`
+	DryRun       bool        `json:"dry_run"`
+	RowsArchived uint64      `json:"rows_archived"` // заказов выгружено и удалено с запуска процесса
+	BytesWritten uint64      `json:"bytes_written"` // байт записано в архив с запуска процесса
+	LastRun      *archiveRun `json:"last_run,omitempty"`
+}
+
+// status - настройки, итоги с запуска процесса и последний запуск; для выключенного архивирования — enabled false
+func (a *orderArchiver) status() retentionStatus {
+	if a == nil {
+		return retentionStatus{}
+	}
+	s := retentionStatus{
+		Enabled:      true,
+		Retention:    a.retention.String(),
+		Dir:          a.cfg.Dir,
+		DryRun:       a.cfg.DryRun,
+		RowsArchived: a.archived.Value(),
+		BytesWritten: a.written.Value(),
+	}
+	a.mu.Lock()
+	s.LastRun = a.last
+	a.mu.Unlock()
+	return s
+}
+
+// makeRetentionStatusHandler - HTTP обработчик GET /admin/retention/status
+func makeRetentionStatusHandler(a *orderArchiver, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(a.status()); err != nil {
+			logger.Printf("[%s] encode error: %v", requestIDFromContext(r.Context()), err)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Описание: Тесты архивирования заказов старше database.retention: содержимое и сверка файлов архива, удаление
+// заказов пачками, сохранность недавних заказов, режим dry_run и GET /admin/retention/status
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/cache"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// archiveBefore - граница архивирования в тестах: заказы 1 и 2 марта старые, 10 марта — недавние
+var archiveBefore = time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+
+// seedArchiveRepository - три старых заказа 1 марта, два 2 марта и два недавних заказа 10 марта с исходными сообщениями
+func seedArchiveRepository() *fakeRepository {
+	repo := &fakeRepository{orders: make(map[string]orders.Order), raws: make(map[string]postgres.RawPayload)}
+	add := func(uid string, created time.Time) {
+		repo.orders[uid] = orders.Order{
+			OrderUid:    uid,
+			CustomerId:  "cust",
+			DateCreated: created,
+			Delivery:    orders.Delivery{Name: "Test Testov", City: "Moscow"},
+			Payments:    []orders.Payment{{Transaction: uid, Amount: 100}},
+			Items:       []orders.Item{{ChrtId: 1, Name: "Mascaras"}},
+		}
+		repo.raws[fakeKey(tenant.Default, uid)] = postgres.RawPayload{Payload: []byte(`{}`), ReceivedAt: created}
+	}
+	for i := 0; i < 3; i++ {
+		add(fmt.Sprintf("old-a%d", i), time.Date(2024, 3, 1, 10, i, 0, 0, time.UTC))
+	}
+	for i := 0; i < 2; i++ {
+		add(fmt.Sprintf("old-b%d", i), time.Date(2024, 3, 2, 10, i, 0, 0, time.UTC))
+	}
+	for i := 0; i < 2; i++ {
+		add(fmt.Sprintf("recent%d", i), time.Date(2024, 3, 10, 10, i, 0, 0, time.UTC))
+	}
+	return repo
+}
+
+func newTestArchiver(t *testing.T, repo *fakeRepository, archive config.ArchiveConfig) (*orderArchiver, *cache.OrderCache) {
+	t.Helper()
+	cfg := newConsumerTestConfig()
+	cfg.Database.Retention = 30 * 24 * time.Hour
+	cfg.Database.Archive = archive
+	c := newTestCache(t)
+	a := newOrderArchiver(cfg, repo, c, newTestLogger())
+	require.NotNil(t, a)
+	return a, c
+}
+
+// readArchive - заказы из сжатого файла архива NDJSON
+func readArchive(t *testing.T, path string) []orders.Order {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	var list []orders.Order
+	sc := bufio.NewScanner(zr)
+	for sc.Scan() {
+		var o orders.Order
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &o))
+		list = append(list, o)
+	}
+	require.NoError(t, sc.Err())
+	return list
+}
+
+func TestOrderArchiverExportsAndDeletesOldOrders(t *testing.T) {
+	repo := seedArchiveRepository()
+	dir := filepath.Join(t.TempDir(), "archive")
+	a, c := newTestArchiver(t, repo, config.ArchiveConfig{Dir: dir, BatchSize: 2})
+	for _, o := range repo.orders {
+		c.Set(tenant.Default, o)
+	}
+
+	run := a.archive(context.Background(), archiveBefore)
+	require.Empty(t, run.Error)
+	assert.Equal(t, int64(5), run.Orders)
+	assert.Equal(t, int64(5), run.Deleted)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"orders_default_2024-03-01.ndjson.gz", "orders_default_2024-03-02.ndjson.gz"}, names,
+		"one file per day, no temporary files left")
+
+	day1 := readArchive(t, filepath.Join(dir, names[0]))
+	require.Len(t, day1, 3)
+	assert.Equal(t, "old-a0", day1[0].OrderUid)
+	assert.Equal(t, "Moscow", day1[0].Delivery.City, "full documents are exported")
+	assert.Equal(t, "old-a0", day1[0].Payments[0].Transaction)
+	assert.Equal(t, "Mascaras", day1[0].Items[0].Name)
+	assert.Len(t, readArchive(t, filepath.Join(dir, names[1])), 2)
+
+	var bytes int64
+	for _, f := range run.Files {
+		info, err := os.Stat(filepath.Join(dir, f.Name))
+		require.NoError(t, err)
+		assert.Equal(t, info.Size(), f.Bytes)
+		assert.Len(t, f.SHA256, 64)
+		bytes += f.Bytes
+	}
+	assert.Equal(t, bytes, run.Bytes)
+
+	repo.mu.Lock()
+	assert.Equal(t, []int{2, 1, 2}, repo.deleteCalls, "each day is deleted in batches of batch_size")
+	assert.Len(t, repo.orders, 2)
+	assert.Contains(t, repo.orders, "recent0")
+	assert.Contains(t, repo.orders, "recent1")
+	assert.Len(t, repo.raws, 2, "raw payloads of archived orders are deleted")
+	repo.mu.Unlock()
+	assert.False(t, c.Contains(tenant.Default, "old-a0"), "archived orders leave the cache")
+	assert.True(t, c.Contains(tenant.Default, "recent0"))
+
+	// Заказ прошедшего дня, появившийся позже, попадает в следующий файл того же дня
+	repo.mu.Lock()
+	repo.orders["late"] = orders.Order{OrderUid: "late", DateCreated: time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)}
+	repo.mu.Unlock()
+	run = a.archive(context.Background(), archiveBefore)
+	require.Empty(t, run.Error)
+	require.Len(t, run.Files, 1)
+	assert.Equal(t, "orders_default_2024-03-01.1.ndjson.gz", run.Files[0].Name)
+
+	s := a.status()
+	assert.True(t, s.Enabled)
+	assert.Equal(t, uint64(6), s.RowsArchived)
+	assert.Equal(t, uint64(bytes+run.Bytes), s.BytesWritten)
+}
+
+func TestOrderArchiverDryRun(t *testing.T) {
+	repo := seedArchiveRepository()
+	dir := filepath.Join(t.TempDir(), "archive")
+	a, _ := newTestArchiver(t, repo, config.ArchiveConfig{Dir: dir, DryRun: true})
+
+	run := a.archive(context.Background(), archiveBefore)
+	require.Empty(t, run.Error)
+	assert.True(t, run.DryRun)
+	assert.Equal(t, int64(5), run.Orders, "the orders that would be removed are reported")
+	assert.Zero(t, run.Deleted)
+	require.Len(t, run.Files, 2)
+	assert.Equal(t, archiveFile{Name: "orders_default_2024-03-01.ndjson.gz", Tenant: tenant.Default, Day: "2024-03-01", Orders: 3}, run.Files[0])
+
+	_, err := os.Stat(dir)
+	assert.ErrorIs(t, err, os.ErrNotExist, "a dry run writes nothing")
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	assert.Len(t, repo.orders, 7)
+	assert.Empty(t, repo.deleteCalls)
+}
+
+func TestOrderArchiverKeepsOrdersWhenListingFails(t *testing.T) {
+	repo := seedArchiveRepository()
+	repo.err = errors.New("database is down")
+	a, _ := newTestArchiver(t, repo, config.ArchiveConfig{Dir: t.TempDir()})
+
+	run := a.archive(context.Background(), archiveBefore)
+	assert.Contains(t, run.Error, "database is down")
+	assert.Zero(t, run.Orders)
+	assert.Equal(t, &run, a.status().LastRun)
+}
+
+func TestVerifyArchiveDetectsMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.ndjson.gz")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	zw := gzip.NewWriter(f)
+	_, err = zw.Write([]byte("{}\n{}\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+
+	sum := sha256.Sum256([]byte("{}\n{}\n"))
+	assert.NoError(t, verifyArchive(path, 2, sum[:]))
+	assert.ErrorContains(t, verifyArchive(path, 3, sum[:]), "2 read back")
+	other := sha256.Sum256([]byte("{}\n{}\r\n"))
+	assert.ErrorContains(t, verifyArchive(path, 2, other[:]), "checksum mismatch")
+}
+
+func TestRetentionStatusHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	makeRetentionStatusHandler(nil, newTestLogger())(rec, httptest.NewRequest(http.MethodGet, "/admin/retention/status", nil))
+	assert.JSONEq(t, `{"enabled":false,"dry_run":false,"rows_archived":0,"bytes_written":0}`, rec.Body.String())
+
+	a, _ := newTestArchiver(t, seedArchiveRepository(), config.ArchiveConfig{Dir: t.TempDir()})
+	a.archive(context.Background(), archiveBefore)
+	rec = httptest.NewRecorder()
+	makeRetentionStatusHandler(a, newTestLogger())(rec, httptest.NewRequest(http.MethodGet, "/admin/retention/status", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var got retentionStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, "720h0m0s", got.Retention)
+	assert.Equal(t, uint64(5), got.RowsArchived)
+	require.NotNil(t, got.LastRun)
+	assert.Equal(t, int64(5), got.LastRun.Deleted)
+	assert.Len(t, got.LastRun.Files, 2)
+}
@@ -0,0 +1,144 @@
+// Описание: Выключаемый кэш API (cache.enabled): обращения к кэшу идут через атомарный указатель на текущий кэш,
+// которым во время работы можно сделать discardCache и обратно (POST /admin/cache/disable и /admin/cache/enable).
+// Выключенный кэш всегда промахивается, и каждое чтение GET /order идёт в базу данных через совместную загрузку
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"l0_test_self/internal/cache"
+	"l0_test_self/models/orders"
+)
+
+// activeCache - текущий кэш за атомарным указателем switchableCache
+type activeCache struct {
+	OrderCache
+}
+
+// switchableCache - кэш API, который можно выключить и включить во время работы. Методы OrderCache обращаются
+// к текущему кэшу; остальные методы (закрепление, перестройка, очистка, статистика) относятся к встроенному кэшу,
+// который, пока кэш выключен, пуст.
+type switchableCache struct {
+	*cache.OrderCache
+
+	mu      sync.Mutex // упорядочивает переключения
+	current atomic.Pointer[activeCache]
+}
+
+// newSwitchableCache - кэш поверх cc, включённый или выключенный по enabled
+func newSwitchableCache(cc *cache.OrderCache, enabled bool) *switchableCache {
+	c := &switchableCache{OrderCache: cc}
+	c.current.Store(&activeCache{cc})
+	if !enabled {
+		c.current.Store(&activeCache{discardCache{}})
+	}
+	return c
+}
+
+// Enabled - сообщает, включён ли кэш
+func (c *switchableCache) Enabled() bool {
+	_, disabled := c.active().(discardCache)
+	return !disabled
+}
+
+// SetEnabled - включает или выключает кэш и возвращает прежнее состояние. Пока кэш выключен, изменения заказов
+// в него не попадают, поэтому записи удаляются и при выключении, и перед включением (запись, начатая до выключения,
+// могла завершиться позже): включённый кэш заполняется заново при чтениях.
+func (c *switchableCache) SetEnabled(enabled bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	previous := c.Enabled()
+	if previous == enabled {
+		return previous
+	}
+	if enabled {
+		c.clear()
+		c.current.Store(&activeCache{c.OrderCache})
+	} else {
+		c.current.Store(&activeCache{discardCache{}})
+		c.clear()
+	}
+	return previous
+}
+
+// clear - удаляет записи встроенного кэша
+func (c *switchableCache) clear() {
+	c.OrderCache.Range(func(tenantID, id string, _ orders.Order) bool {
+		c.OrderCache.Delete(tenantID, id)
+		return true
+	})
+}
+
+// active - текущий кэш
+func (c *switchableCache) active() OrderCache {
+	return c.current.Load().OrderCache
+}
+
+func (c *switchableCache) Set(tenantID string, order orders.Order) { c.active().Set(tenantID, order) }
+
+func (c *switchableCache) SetIfNewer(tenantID string, order orders.Order, version int64) bool {
+	return c.active().SetIfNewer(tenantID, order, version)
+}
+
+func (c *switchableCache) Get(tenantID, id string) (orders.Order, bool) {
+	return c.active().Get(tenantID, id)
+}
+
+func (c *switchableCache) GetJSON(tenantID, id string) ([]byte, bool) {
+	return c.active().GetJSON(tenantID, id)
+}
+
+func (c *switchableCache) MarkMissing(tenantID, id string) { c.active().MarkMissing(tenantID, id) }
+func (c *switchableCache) IsMissing(tenantID, id string) bool {
+	return c.active().IsMissing(tenantID, id)
+}
+func (c *switchableCache) Contains(tenantID, id string) bool {
+	return c.active().Contains(tenantID, id)
+}
+func (c *switchableCache) Delete(tenantID, id string) { c.active().Delete(tenantID, id) }
+
+func (c *switchableCache) LoadFromSlice(tenantID string, list []orders.Order) {
+	c.active().LoadFromSlice(tenantID, list)
+}
+
+func (c *switchableCache) Range(fn func(tenantID, id string, o orders.Order) bool) {
+	c.active().Range(fn)
+}
+func (c *switchableCache) Len() int { return c.active().Len() }
+
+// switchingCache - кэш, который можно выключить во время работы
+type switchingCache interface {
+	Enabled() bool
+	SetEnabled(enabled bool) bool
+}
+
+// cacheSwitchResponse - ответ POST /admin/cache/enable и /admin/cache/disable
+type cacheSwitchResponse struct {
+	Enabled  bool `json:"enabled"`
+	Previous bool `json:"previous"`
+}
+
+// makeCacheSwitchHandler - HTTP обработчик, включающий (enabled) или выключающий кэш API во время работы
+func makeCacheSwitchHandler(orderCache OrderCache, enabled bool, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		sc, ok := orderCache.(switchingCache)
+		if !ok {
+			writeAPIError(w, r, http.StatusNotImplemented, errCodeCacheSwitchUnsupported)
+			return
+		}
+		resp := cacheSwitchResponse{Enabled: enabled, Previous: sc.SetEnabled(enabled)}
+		if resp.Previous != enabled {
+			logger.Printf("[%s] cache enabled changed from %t to %t", reqID, resp.Previous, enabled)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+		}
+	}
+}
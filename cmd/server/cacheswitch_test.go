@@ -0,0 +1,162 @@
+// Описание: Тесты выключаемого кэша: пустые реализации discardCache, общий набор проверок кэша (cachetest) для
+// discardCache и switchableCache, переключение кэша во время работы, чтения GET /order из базы при выключенном кэше
+// и приём заказов без кэширования
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/cache"
+	"l0_test_self/internal/cache/cachetest"
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscardCache(t *testing.T) {
+	var c OrderCache = discardCache{}
+	order := testorders.NewGenerator(60).Order(testorders.ScenarioDefault)
+
+	c.Set(tenant.Default, order)
+	assert.False(t, c.SetIfNewer(tenant.Default, order, 1))
+	c.LoadFromSlice(tenant.Default, []orders.Order{order})
+	c.MarkMissing(tenant.Default, "absent")
+	_, ok := c.Get(tenant.Default, order.OrderUid)
+	assert.False(t, ok)
+	_, ok = c.GetJSON(tenant.Default, order.OrderUid)
+	assert.False(t, ok)
+	assert.False(t, c.Contains(tenant.Default, order.OrderUid))
+	assert.False(t, c.IsMissing(tenant.Default, "absent"))
+	assert.Zero(t, c.Len())
+	c.Range(func(string, string, orders.Order) bool {
+		t.Fatal("discard cache has no entries")
+		return false
+	})
+}
+
+func TestDiscardCacheConformance(t *testing.T) {
+	cachetest.Run(t, func(*testing.T, cachetest.Options) cachetest.Cache { return discardCache{} }, cachetest.Deviations{Discards: true})
+}
+
+func TestSwitchableCacheConformance(t *testing.T) {
+	cachetest.Run(t, func(t *testing.T, opts cachetest.Options) cachetest.Cache {
+		options := []cache.Option{cache.WithShards(1), cache.WithTTL(opts.TTL), cache.WithCleanupInterval(time.Hour), cache.WithClock(opts.Clock)}
+		if opts.MaxItems > 0 {
+			options = append(options, cache.WithMaxItems(opts.MaxItems))
+		}
+		cc, err := cache.NewWithOptions(options...)
+		require.NoError(t, err)
+		t.Cleanup(cc.Close)
+		cc.SetMissingTTL(opts.MissingTTL)
+		cc.SetKeepJSON(true)
+		return newSwitchableCache(cc, true)
+	}, cachetest.Deviations{})
+}
+
+func TestSwitchableCacheRuntimeSwap(t *testing.T) {
+	cc := newTestCache(t)
+	c := newSwitchableCache(cc, true)
+	gen := testorders.NewGenerator(61)
+	first, second := gen.Order(testorders.ScenarioDefault), gen.Order(testorders.ScenarioDefault)
+
+	c.Set(tenant.Default, first)
+	_, ok := c.Get(tenant.Default, first.OrderUid)
+	require.True(t, ok)
+
+	assert.True(t, c.SetEnabled(false))
+	assert.False(t, c.Enabled())
+	_, ok = c.Get(tenant.Default, first.OrderUid)
+	assert.False(t, ok)
+	c.Set(tenant.Default, second)
+	assert.Zero(t, cc.Len(), "a disabled cache is emptied and accepts no writes")
+	assert.False(t, c.SetEnabled(false), "disabling twice keeps the state")
+
+	assert.False(t, c.SetEnabled(true))
+	assert.True(t, c.Enabled())
+	_, ok = c.Get(tenant.Default, first.OrderUid)
+	assert.False(t, ok, "a re-enabled cache starts empty")
+	c.Set(tenant.Default, second)
+	_, ok = c.Get(tenant.Default, second.OrderUid)
+	assert.True(t, ok)
+	assert.Equal(t, 1, cc.Len())
+}
+
+func TestCacheSwitchEndpoints(t *testing.T) {
+	c := newSwitchableCache(newTestCache(t), true)
+	stats := func() cacheStatsResponse {
+		rec := httptest.NewRecorder()
+		makeCacheStatsHandler(c, nil, newTestLogger()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/cache/stats", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var resp cacheStatsResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp
+	}
+	toggle := func(enabled bool) cacheSwitchResponse {
+		rec := httptest.NewRecorder()
+		makeCacheSwitchHandler(c, enabled, newTestLogger()).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/cache/toggle", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var resp cacheSwitchResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp
+	}
+
+	assert.Equal(t, cacheStatusEnabled, stats().Status)
+	assert.Equal(t, cacheSwitchResponse{Enabled: false, Previous: true}, toggle(false))
+	assert.Equal(t, cacheStatsResponse{Status: cacheStatusDisabled, Pinned: []string{}}, stats())
+	assert.Equal(t, cacheSwitchResponse{Enabled: true, Previous: false}, toggle(true))
+	assert.Equal(t, cacheStatusEnabled, stats().Status)
+
+	rec := httptest.NewRecorder()
+	makeCacheSwitchHandler(newTestCache(t), false, newTestLogger()).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/cache/disable", nil))
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+}
+
+func TestOrderReadsBypassDisabledCache(t *testing.T) {
+	order := piiTestOrder()
+	repo := &fakeRepository{orders: map[string]orders.Order{order.OrderUid: order}}
+	c := newSwitchableCache(newTestCache(t), false)
+	h := withDefaultTenant(makeOrderHandler(c, repo, piiPolicy{}, nil, newTestLogger()))
+
+	for range 3 {
+		rec := getAccept(h, "/order?id="+order.OrderUid, "")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	}
+	repo.mu.Lock()
+	reads := repo.reads
+	repo.mu.Unlock()
+	assert.Equal(t, 3, reads, "every read goes to the repository")
+	assert.Zero(t, c.Len())
+}
+
+func TestIngestionWithDisabledCache(t *testing.T) {
+	c := newSwitchableCache(newTestCache(t), false)
+
+	// Kafka
+	msgs, uids := newOrderMessages(t, 62, 3)
+	repo := &fakeRepository{}
+	reader := &sliceReader{msgs: msgs}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, c, newTestLogger(), newConsumerTestConfig(), nil)
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) == len(msgs) }, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+	_, stored := repo.stats()
+	assert.Equal(t, len(uids), stored)
+
+	// POST /orders
+	h := withDefaultTenant(makeOrderCreateHandler(repo, c, config.IdempotencyConfig{}, clock.Real, newTestLogger()))
+	require.Equal(t, http.StatusCreated, postOrder(h, "", mustOrderJSON(t, testorders.NewGenerator(63))).Code)
+	_, stored = repo.stats()
+	assert.Equal(t, len(uids)+1, stored)
+	assert.Zero(t, c.Len(), "stored orders are not cached")
+}
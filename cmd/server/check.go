@@ -0,0 +1,166 @@
+// Описание: Предстартовая самопроверка сервера (флаг -check): конфигурация, схема базы данных и доступность Kafka.
+// Результат печатается в stdout в виде JSON отчёта, при любой неудачной проверке сервер завершается с ошибкой
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/goroutines"
+	"l0_test_self/pkg/client/kafka"
+	"l0_test_self/pkg/client/postgres"
+)
+
+// defaultCheckTimeout - ограничение одной проверки, если флаг -check-timeout не задан
+const defaultCheckTimeout = 5 * time.Second
+
+// errPreflightFailed - ошибка запуска с -check, если хотя бы одна проверка не прошла
+var errPreflightFailed = errors.New("preflight check failed")
+
+// preflightCheck - одна проверка: run возвращает подробности для отчёта (может быть nil) и ошибку при неудаче
+type preflightCheck struct {
+	name string
+	run  func(ctx context.Context) (any, error)
+}
+
+// checkResult - результат одной проверки в отчёте
+type checkResult struct {
+	Name       string `json:"name"`
+	OK         bool   `json:"ok"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	Details    any    `json:"details,omitempty"`
+}
+
+// checkReport - отчёт самопроверки; OK истинно, только если прошли все проверки
+type checkReport struct {
+	OK     bool          `json:"ok"`
+	Checks []checkResult `json:"checks"`
+}
+
+// runChecks - выполняет проверки по очереди, ограничивая каждую timeout. Проверка, не уложившаяся в timeout,
+// считается неудачной, даже если она не реагирует на отмену контекста.
+func runChecks(ctx context.Context, checks []preflightCheck, timeout time.Duration) checkReport {
+	report := checkReport{OK: true, Checks: make([]checkResult, 0, len(checks))}
+	for _, c := range checks {
+		res := runCheck(ctx, c, timeout)
+		report.OK = report.OK && res.OK
+		report.Checks = append(report.Checks, res)
+	}
+	return report
+}
+
+// runCheck - выполняет одну проверку с ограничением timeout
+func runCheck(ctx context.Context, c preflightCheck, timeout time.Duration) checkResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type outcome struct {
+		details any
+		err     error
+	}
+	done := make(chan outcome, 1)
+	start := time.Now()
+	goroutines.Go("preflight check "+c.name, ctx.Done(), func() {
+		details, err := c.run(ctx)
+		done <- outcome{details, err}
+	})
+
+	res := checkResult{Name: c.name}
+	select {
+	case o := <-done:
+		res.Details = o.details
+		if o.err != nil {
+			res.Error = o.err.Error()
+		}
+	case <-ctx.Done():
+		res.Error = fmt.Sprintf("timed out after %s", timeout)
+	}
+	res.OK = res.Error == ""
+	res.DurationMs = time.Since(start).Milliseconds()
+	return res
+}
+
+// preflightChecks - проверки базы данных и, если режим читает Kafka, брокеров, топика заказов и очереди недоставленных сообщений
+func preflightChecks(cfg *config.Config, mode string) []preflightCheck {
+	checks := []preflightCheck{{name: "database", run: func(ctx context.Context) (any, error) {
+		pool, err := postgres.NewClient(ctx, cfg.Database.ToPostgresConfig(), 1)
+		if err != nil {
+			return nil, err
+		}
+		defer pool.Close()
+		report, err := postgres.CheckSchema(ctx, pool)
+		if err != nil {
+			return nil, err
+		}
+		if len(report.Missing) > 0 {
+			return report, fmt.Errorf("missing columns: %s", strings.Join(report.Missing, ", "))
+		}
+		return report, nil
+	}}}
+
+	if mode != modeAPI {
+		checks = append(checks, preflightCheck{name: "kafka", run: func(ctx context.Context) (any, error) {
+			topics := cfg.KafkaTopics()
+			details := map[string]any{"brokers": cfg.Kafka.Brokers, "topics": topics}
+			err := kafka.VerifyTopics(ctx, cfg.Kafka.Brokers, topics, cfg.Kafka.Topics.MinPartitions)
+			if err != nil && cfg.Kafka.EnsureTopics && errors.Is(err, kafka.ErrTopicNotReady) {
+				// Отсутствующие топики будут созданы при запуске
+				details["created_at_startup"] = err.Error()
+				return details, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			return details, nil
+		}})
+	}
+	return checks
+}
+
+// loadCheckedConfig - загружает конфигурацию и проверяет настройки, которые иначе проверяются только при запуске
+func loadCheckedConfig(path string) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := cfg.Database.Encryption.Keyring(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// runPreflight - выполняет самопроверку и печатает отчёт в out. Если конфигурацию не удалось загрузить,
+// остальные проверки не выполняются. Возвращает errPreflightFailed, если хотя бы одна проверка не прошла.
+func runPreflight(ctx context.Context, configPath, mode string, timeout time.Duration, out io.Writer) error {
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	var cfg *config.Config
+	report := runChecks(ctx, []preflightCheck{{name: "config", run: func(context.Context) (any, error) {
+		var err error
+		cfg, err = loadCheckedConfig(configPath)
+		return nil, err
+	}}}, timeout)
+	if report.OK {
+		more := runChecks(ctx, preflightChecks(cfg, mode), timeout)
+		report.OK = more.OK
+		report.Checks = append(report.Checks, more.Checks...)
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return fmt.Errorf("write check report: %w", err)
+	}
+	if !report.OK {
+		return errPreflightFailed
+	}
+	return nil
+}
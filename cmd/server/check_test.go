@@ -0,0 +1,105 @@
+// Описание: Тесты самопроверки -check: структура отчёта, ограничение времени проверок и результат при недоступных зависимостях
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunChecksReport(t *testing.T) {
+	hang := make(chan struct{})
+	defer close(hang)
+	checks := []preflightCheck{
+		{name: "ok", run: func(context.Context) (any, error) { return map[string]int{"n": 1}, nil }},
+		{name: "failing", run: func(context.Context) (any, error) { return nil, errors.New("connection refused") }},
+		// Проверка, не реагирующая на отмену контекста, всё равно ограничена timeout
+		{name: "hanging", run: func(context.Context) (any, error) { <-hang; return nil, nil }},
+	}
+
+	start := time.Now()
+	report := runChecks(context.Background(), checks, 50*time.Millisecond)
+	assert.Less(t, time.Since(start), time.Second)
+
+	assert.False(t, report.OK)
+	require.Len(t, report.Checks, 3)
+	assert.Equal(t, checkResult{Name: "ok", OK: true, Details: map[string]int{"n": 1}}, withoutDuration(report.Checks[0]))
+	assert.Equal(t, checkResult{Name: "failing", Error: "connection refused"}, withoutDuration(report.Checks[1]))
+	assert.Equal(t, "hanging", report.Checks[2].Name)
+	assert.False(t, report.Checks[2].OK)
+	assert.Contains(t, report.Checks[2].Error, "timed out")
+
+	assert.True(t, runChecks(context.Background(), checks[:1], time.Second).OK)
+}
+
+func withoutDuration(r checkResult) checkResult {
+	r.DurationMs = 0
+	return r
+}
+
+// decodeReport - декодирует JSON отчёт самопроверки
+func decodeReport(t *testing.T, out *bytes.Buffer) checkReport {
+	t.Helper()
+	var report checkReport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report), out.String())
+	return report
+}
+
+func TestRunPreflightInvalidConfig(t *testing.T) {
+	var out bytes.Buffer
+	err := runPreflight(context.Background(), filepath.Join(t.TempDir(), "missing.yaml"), modeAll, time.Second, &out)
+	require.ErrorIs(t, err, errPreflightFailed)
+
+	report := decodeReport(t, &out)
+	assert.False(t, report.OK)
+	require.Len(t, report.Checks, 1, "other checks need a valid config")
+	assert.Equal(t, "config", report.Checks[0].Name)
+	assert.NotEmpty(t, report.Checks[0].Error)
+}
+
+func TestRunPreflightUnreachableDependencies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+database:
+  host: "127.0.0.1"
+  port: "1"
+  user: "u"
+  password: "p"
+  db_name: "db"
+  ssl_mode: "disable"
+kafka:
+  brokers: ["127.0.0.1:1"]
+  topic: "orders"
+`), 0o600))
+
+	for mode, names := range map[string][]string{
+		modeAll: {"config", "database", "kafka"},
+		modeAPI: {"config", "database"},
+	} {
+		var out bytes.Buffer
+		err := runPreflight(context.Background(), path, mode, 2*time.Second, &out)
+		require.ErrorIs(t, err, errPreflightFailed, mode)
+
+		report := decodeReport(t, &out)
+		assert.False(t, report.OK)
+		var got []string
+		for _, c := range report.Checks {
+			got = append(got, c.Name)
+			if c.Name == "config" {
+				assert.True(t, c.OK)
+			} else {
+				assert.False(t, c.OK, c.Name)
+				assert.NotEmpty(t, c.Error, c.Name)
+			}
+		}
+		assert.Equal(t, names, got, mode)
+	}
+}
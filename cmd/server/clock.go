@@ -0,0 +1,66 @@
+// Описание: Проверка часов сервера при запуске: сравнение со временем PostgreSQL и метками времени сообщений Kafka
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// defaultClockWarnSkew - расхождение часов, при котором пишется предупреждение, если clock_warn_skew не задан
+	defaultClockWarnSkew = time.Minute
+	// clockCheckTimeout - ограничение времени получения времени одного источника
+	clockCheckTimeout = 5 * time.Second
+)
+
+// clockSource - внешний источник времени для сравнения с часами сервера
+type clockSource struct {
+	name string
+	now  func(ctx context.Context) (time.Time, error)
+	// aheadOnly - источник сообщает время в прошлом (например, метку последнего сообщения),
+	// поэтому проблемой считается только опережение источником часов сервера
+	aheadOnly bool
+}
+
+// checkClocks - сравнивает часы сервера с источниками и возвращает предупреждения о расхождении больше threshold
+// (0 — defaultClockWarnSkew). Ошибки получения времени тоже возвращаются как предупреждения: запуск они не прерывают.
+func checkClocks(ctx context.Context, sources []clockSource, threshold time.Duration, local func() time.Time) []string {
+	if threshold <= 0 {
+		threshold = defaultClockWarnSkew
+	}
+	var warnings []string
+	for _, src := range sources {
+		sctx, cancel := context.WithTimeout(ctx, clockCheckTimeout)
+		before := local()
+		remote, err := src.now(sctx)
+		after := local()
+		cancel()
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("clock check: %s time unavailable: %v", src.name, err))
+			continue
+		}
+		if remote.IsZero() {
+			continue
+		}
+
+		// Время источника сравнивается с серединой запроса, чтобы не учитывать сетевую задержку как расхождение
+		skew := remote.Sub(before.Add(after.Sub(before) / 2))
+		if skew > threshold {
+			warnings = append(warnings, fmt.Sprintf("clock check: %s time is %s ahead of server clock (threshold %s)",
+				src.name, skew.Round(time.Millisecond), threshold))
+		} else if -skew > threshold && !src.aheadOnly {
+			warnings = append(warnings, fmt.Sprintf("clock check: %s time is %s behind server clock (threshold %s)",
+				src.name, (-skew).Round(time.Millisecond), threshold))
+		}
+	}
+	return warnings
+}
+
+// logClockWarnings - выполняет проверку часов и пишет предупреждения в лог
+func logClockWarnings(ctx context.Context, sources []clockSource, threshold time.Duration, logger *log.Logger) {
+	for _, w := range checkClocks(ctx, sources, threshold, time.Now) {
+		logger.Printf("WARNING: %s", w)
+	}
+}
@@ -0,0 +1,52 @@
+// Описание: Тесты проверки часов сервера при запуске
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixedClock - источник, время которого отличается от local на skew
+func fixedClock(name string, local time.Time, skew time.Duration, aheadOnly bool) clockSource {
+	return clockSource{name: name, aheadOnly: aheadOnly, now: func(context.Context) (time.Time, error) { return local.Add(skew), nil }}
+}
+
+func TestCheckClocks(t *testing.T) {
+	local := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return local }
+	ctx := context.Background()
+
+	assert.Empty(t, checkClocks(ctx, []clockSource{
+		fixedClock("postgres", local, time.Minute, false),
+		fixedClock("postgres", local, -time.Minute, false),
+	}, time.Minute, clock), "skew equal to the threshold is tolerated")
+
+	warnings := checkClocks(ctx, []clockSource{
+		fixedClock("postgres", local, time.Minute+time.Millisecond, false),
+		fixedClock("replica", local, -2*time.Minute, false),
+	}, time.Minute, clock)
+	require.Len(t, warnings, 2)
+	assert.Contains(t, warnings[0], "postgres time is 1m0.001s ahead")
+	assert.Contains(t, warnings[1], "replica time is 2m0s behind")
+
+	// Последнее сообщение Kafka обычно записано в прошлом: предупреждение только об опережении
+	warnings = checkClocks(ctx, []clockSource{
+		fixedClock("kafka", local, -24*time.Hour, true),
+		fixedClock("kafka", local, 10*time.Minute, true),
+		{name: "empty topic", aheadOnly: true, now: func(context.Context) (time.Time, error) { return time.Time{}, nil }},
+	}, 0, clock)
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "kafka time is 10m0s ahead of server clock (threshold 1m0s)")
+}
+
+func TestCheckClocksReportsUnavailableSource(t *testing.T) {
+	src := clockSource{name: "postgres", now: func(context.Context) (time.Time, error) { return time.Time{}, errors.New("connection refused") }}
+	warnings := checkClocks(context.Background(), []clockSource{src}, time.Minute, time.Now)
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "postgres time unavailable: connection refused")
+}
@@ -0,0 +1,542 @@
+// Описание: Kafka consumer сервера: чтение сообщений, валидация, сохранение заказов в базу данных и кэш,
+// ручной коммит смещений и подавление повторной обработки после ребалансировки группы
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/dedup"
+	"l0_test_self/internal/goroutines"
+	"l0_test_self/internal/ingeststats"
+	"l0_test_self/internal/logging"
+	"l0_test_self/internal/metrics"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/internal/validation"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+	"l0_test_self/pkg/codec"
+	"l0_test_self/pkg/kafkautil"
+
+	kafka2 "github.com/segmentio/kafka-go"
+)
+
+// drainTimeout - сколько времени даётся на завершение обработки и коммит уже полученного сообщения при остановке
+const drainTimeout = 10 * time.Second
+
+// Этапы обработки сообщения в буфере последних ошибок (GET /admin/errors?stage=)
+const (
+	stageFetch    = "fetch"    // чтение сообщения из Kafka
+	stageDecode   = "decode"   // декодирование тела сообщения
+	stageValidate = "validate" // валидация заказа
+	stageStore    = "store"    // запись в базу данных
+	stageCommit   = "commit"   // коммит смещения
+	stageAudit    = "audit"    // запись задержки обработки в журнал
+	stageSkip     = "skip"     // пропуск сообщения по указанию администратора
+	stageAck      = "ack"      // публикация подтверждения записи заказа
+)
+
+// decodeAttempts - сколько раз декодируется сообщение при временной ошибке декодера, прежде чем оно будет пропущено
+const decodeAttempts = 3
+
+// MessageReader - интерфейс читателя Kafka, используемый консьюмером (реализуется *kafka.Reader и фейками в тестах)
+type MessageReader interface {
+	FetchMessage(ctx context.Context) (kafka2.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka2.Message) error
+	Stats() kafka2.ReaderStats
+	Close() error
+}
+
+// consumer - обработчик сообщений с заказами из Kafka
+type consumer struct {
+	reader     MessageReader
+	dlq        MessageWriter // очередь недоставленных сообщений; nil — сообщения в неё не отправляются
+	repo       OrderRepository
+	cache      OrderCache
+	logger     *log.Logger
+	cfg        config.ConsumerConfig
+	pipeline   config.PipelineConfig
+	storeRaw   bool // сохранять исходные сообщения вместе с заказами
+	retryDelay time.Duration
+	clock      clock.Clock // время пауз между повторами, отметок ошибок и версий заказов в кэше, в тестах подменяется
+	format     codec.Codec // формат сообщений без заголовка content-type, в тестах подменяется
+	source     string      // источник сохраняемых заказов: orders.SourceKafka, при повторе топика — orders.SourceReplay
+	// tenants - арендатор по топику сообщения; nil — арендаторы не объявлены и все сообщения принадлежат tenant.Default
+	tenants map[string]string
+
+	sampler *logging.Sampler
+	seen    *dedup.Window
+	recent  *dedup.ContentWindow // недавно сохранённые заказы: tenant.Key(арендатор, order_uid) → отпечаток тела сообщения
+	latency *latencyMonitor
+	errors  *logging.ErrorRing
+	poison  *metrics.Counter
+	skips   *skipList
+	skipped *metrics.Counter
+	ingest  *ingestCache
+	db      *dbRecovery // восстановление пула после потери соединений с базой данных; nil — без него
+	acks    *orderAcker // подтверждения записи заказов; nil — выключены
+	// webhooks - уведомления внешних получателей о записанных заказах; nil — выключены
+	webhooks *webhookDispatcher
+	// throttler - ограничение частоты заказов покупателей (kafka.consumer.customer_limit); nil — выключено
+	throttler *customerThrottle
+	// processed - последние записанные заказы для GET /api/recent
+	processed *recentOrders
+	// priority - службы доставки срочных заказов пакетного режима в нижнем регистре; nil — приоритет выключен
+	priority map[string]bool
+	queues   *queueStats // метрики очередей пакетного режима по классам сообщений
+	// ingestStats - почасовые счётчики сообщений по отправителям (kafka.consumer.ingest_stats); nil — выключены
+	ingestStats *ingestStats
+	// spillPath - файл, в который дописываются пропущенные по указанию сообщения (kafka.consumer.skip_spill_file)
+	spillPath string
+
+	// attempts - неудачные попытки записи сообщений, ещё не записанных и не отправленных в очередь недоставленных.
+	// Используется только горутиной, записывающей заказы в базу данных.
+	attempts map[postgres.MessageKey]int
+}
+
+// consumerMonitor - состояние консьюмера, которое показывают HTTP обработчики: задержка обработки заказов,
+// последние ошибки обработки, число сообщений, отправленных в очередь недоставленных, и указания пропустить сообщения
+type consumerMonitor struct {
+	latency *latencyMonitor
+	errors  *logging.ErrorRing
+	poison  *metrics.Counter
+	kafka   *kafkaStats // статистика читателя и писателя очереди недоставленных сообщений
+	skips   *skipList
+	skipped *metrics.Counter // сообщения, пропущенные по указанию
+	ingest  *ingestCache     // решения о кэшировании полученных заказов (pipeline.cache_on_ingest)
+	db      *dbRecovery      // восстановление пула соединений; nil — консьюмер повторяет запись без него
+	acks    *orderAcker      // подтверждения записи заказов; nil — выключены
+	// webhooks - уведомления внешних получателей о записанных заказах; nil — выключены
+	webhooks *webhookDispatcher
+	// throttle - ограничение частоты заказов покупателей; nil — выключено
+	throttle *customerThrottle
+	// processed - последние записанные заказы для GET /api/recent
+	processed *recentOrders
+	// queues - глубина очередей и время обработки сообщений пакетного режима по классам (pipeline.priority)
+	queues *queueStats
+	// ingestStats - почасовые счётчики сообщений по отправителям; nil — выключены
+	ingestStats *ingestStats
+}
+
+// newConsumerMonitor - создает состояние консьюмера по конфигурации приложения
+func newConsumerMonitor(cfg *config.Config) *consumerMonitor {
+	return &consumerMonitor{
+		latency: newLatencyMonitor(cfg.Kafka.Consumer.Latency),
+		errors:  logging.NewErrorRing(cfg.Kafka.Consumer.ErrorBufferSize),
+		poison:  &metrics.Counter{},
+		kafka:   newKafkaStats(),
+		skips:   newSkipList(),
+		skipped: &metrics.Counter{},
+		ingest:  newIngestCache(cfg.Pipeline),
+
+		processed: newRecentOrders(cfg.Server.WebAPI.Recent()),
+		queues:    newQueueStats(),
+	}
+}
+
+// newConsumer - создает консьюмер по конфигурации приложения. Если monitor равен nil, состояние консьюмера
+// ведётся в собственном экземпляре.
+func newConsumer(reader MessageReader, dlq MessageWriter, repo OrderRepository, orderCache OrderCache, logger *log.Logger, cfg *config.Config, monitor *consumerMonitor) *consumer {
+	if monitor == nil {
+		monitor = newConsumerMonitor(cfg)
+	}
+	format, err := codec.ByName(cfg.Kafka.Consumer.Format)
+	if err != nil {
+		// Формат проверяется при загрузке конфигурации; сюда попадают только конфигурации, собранные вручную
+		format = codec.JSON
+	}
+	spillPath := cfg.Kafka.Consumer.SkipSpillFile
+	if spillPath == "" {
+		spillPath = defaultSkipSpillFile
+	}
+	var tenants map[string]string
+	if len(cfg.Tenants) > 0 {
+		tenants = cfg.TenantTopics()
+	}
+	return &consumer{
+		reader:     reader,
+		dlq:        dlq,
+		repo:       repo,
+		cache:      orderCache,
+		logger:     logger,
+		cfg:        cfg.Kafka.Consumer,
+		pipeline:   cfg.Pipeline,
+		storeRaw:   cfg.RawPayloads.Enabled,
+		retryDelay: cfg.Kafka.Reader.ReadBatchTimeout,
+		clock:      clock.Real,
+		format:     format,
+		source:     orders.SourceKafka,
+		tenants:    tenants,
+		// Повторяющиеся ошибки одного класса логируются выборочно, чтобы не раздувать логи
+		sampler: logging.NewSampler(cfg.Kafka.Consumer.ErrorLogFirst, cfg.Kafka.Consumer.ErrorLogEvery),
+		seen:    dedup.NewWindow(cfg.Kafka.Consumer.DedupSize, cfg.Kafka.Consumer.DedupWindow),
+		recent:  dedup.NewContentWindow(cfg.Kafka.Consumer.RecentOrdersSize, cfg.Kafka.Consumer.RecentOrdersWindow),
+		latency: monitor.latency,
+		errors:  monitor.errors,
+		poison:  monitor.poison,
+		skips:   monitor.skips,
+		skipped: monitor.skipped,
+		ingest:  monitor.ingest,
+		db:      monitor.db,
+		acks:    monitor.acks,
+
+		webhooks:  monitor.webhooks,
+		throttler: monitor.throttle,
+		processed: monitor.processed,
+		priority:  priorityServices(cfg.Pipeline.Priority),
+		queues:    monitor.queues,
+		spillPath: spillPath,
+		attempts:  make(map[postgres.MessageKey]int),
+
+		ingestStats: monitor.ingestStats,
+	}
+}
+
+// startKafkaConsumer - запускает Kafka consumer и наблюдение за статистикой читателя в отдельных горутинах
+func startKafkaConsumer(
+	ctx context.Context,
+	reader MessageReader,
+	dlq MessageWriter,
+	repo OrderRepository,
+	orderCache OrderCache,
+	logger *log.Logger,
+	cfg *config.Config,
+	monitor *consumerMonitor,
+) *sync.WaitGroup {
+	c := newConsumer(reader, dlq, repo, orderCache, logger, cfg, monitor)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	goroutines.Go("kafka consumer", ctx.Done(), func() {
+		defer wg.Done()
+		c.loadSkips(ctx)
+		if cfg.Pipeline.Mode == config.PipelineModeBatched {
+			c.runBatched(ctx)
+			return
+		}
+		c.run(ctx)
+	})
+
+	if cfg.Kafka.Consumer.StatsInterval > 0 {
+		if monitor == nil {
+			monitor = newConsumerMonitor(cfg)
+		}
+		startKafkaStats(ctx, wg, reader, dlq, logger, cfg, monitor)
+	}
+
+	return wg
+}
+
+// logError - логирует ошибку с учётом выборки по классу ошибки
+func (c *consumer) logError(class string, format string, args ...interface{}) {
+	if ok, n := c.sampler.Allow(class); ok {
+		c.logger.Printf("%s (class=%s occurrence=%d)", fmt.Sprintf(format, args...), class, n)
+	}
+}
+
+// fail - сохраняет ошибку этапа stage в буфер последних ошибок и логирует её с учётом выборки.
+// msg - сообщение, к которому относится ошибка (nil для ошибок чтения и пачек); его тело не сохраняется.
+func (c *consumer) fail(stage, class string, msg *kafka2.Message, orderUID string, format string, args ...interface{}) {
+	entry := logging.ErrorEntry{Time: c.clock.Now(), Stage: stage, Class: class, OrderUid: orderUID, Message: fmt.Sprintf(format, args...)}
+	if msg != nil {
+		entry.Kafka = &logging.KafkaRef{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset}
+	}
+	c.errors.Add(entry)
+	c.logError(class, format, args...)
+}
+
+// run - цикл чтения сообщений до отмены контекста.
+// Каждое полученное сообщение обрабатывается до конца и коммитится до чтения следующего, поэтому при
+// ребалансировке или остановке партиция передаётся другому участнику группы без незавершённой работы.
+func (c *consumer) run(ctx context.Context) {
+	for {
+		msg, err := c.fetch(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+				c.logger.Println("kafka consumer stopping (context canceled)")
+				return
+			}
+			c.fail(stageFetch, "read", nil, "", "kafka read error: %v", err)
+			c.clock.Sleep(c.retryDelay)
+			continue
+		}
+
+		if !c.skipMessage(ctx, msg) && !c.handle(ctx, msg) {
+			c.logger.Printf("message left uncommitted at shutdown: %s", kafkautil.MessageRef(msg))
+			continue
+		}
+		// Уже полученное сообщение дорабатывается даже при остановке, чтобы закоммитить его смещение
+		procCtx, cancel := opContext(ctx)
+		if err := c.reader.CommitMessages(procCtx, msg); err != nil {
+			c.fail(stageCommit, "commit", &msg, "", "kafka commit error (%s): %v", kafkautil.MessageRef(msg), err)
+		} else {
+			c.committed(procCtx, []kafka2.Message{msg})
+		}
+		cancel()
+	}
+}
+
+// fetch - читает следующее сообщение, если консьюмер не остановлен. Читатель kafka-go может вернуть уже полученное
+// от брокера сообщение и после отмены ctx, а при остановке дорабатываются только сообщения, полученные до неё.
+func (c *consumer) fetch(ctx context.Context) (kafka2.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return kafka2.Message{}, err
+	}
+	return c.reader.FetchMessage(ctx)
+}
+
+// handle - обрабатывает одно сообщение: декодирует, валидирует, сохраняет в базу данных и кэш.
+// Ошибки логируются, и сообщение считается обработанным. Если задан kafka.consumer.max_attempts, неудачная запись
+// повторяется, пока сообщение не будет записано, отправлено в очередь недоставленных или пропущено по указанию
+// (skipMessage). Запись, не удавшаяся из-за потери соединения с базой данных, повторяется после восстановления пула
+// в любом случае; false означает, что повторы прерваны остановкой консьюмера и смещение сообщения коммитить нельзя.
+func (c *consumer) handle(ctx context.Context, msg kafka2.Message) bool {
+	tenantID, order, ok, handled := c.decode(ctx, msg)
+	if !ok {
+		return handled
+	}
+	key := tenant.Key(tenantID, order.OrderUid)
+	hash := dedup.HashOf(msg.Value)
+	if c.recentDuplicate(key, hash, msg) {
+		c.ingestStats.record(tenantID, &msg, order.CustomerId, ingeststats.Duplicate)
+		return true
+	}
+	throttled, ok := c.throttle(ctx, msg, tenantID, &order)
+	if !ok {
+		return false
+	}
+	if throttled && c.throttler.rejects() {
+		return true
+	}
+
+	// Заказ публикуется (кэш, подтверждение, уведомления webhooks) только после фиксации транзакции записи
+	var latency postgres.LatencyRecord
+	onCommit := func() {
+		// Версия — момент после фиксации транзакции: любое чтение базы, начатое раньше, не перезапишет этот заказ в кэше
+		c.cacheIngested(tenantID, order)
+		c.processed.add(tenantID, &order)
+		latency = c.latency.observe(msg, order.OrderUid)
+		if throttled {
+			// Заказ сверх ограничения частоты заказов покупателя сохранён с замечанием, но не подтверждается
+			return
+		}
+		opCtx, cancel := opContext(ctx)
+		defer cancel()
+		if c.acks != nil {
+			c.acknowledge(opCtx, &msg, order.OrderUid, []orderAck{c.acks.event(tenantID, order.OrderUid, order.StoredAt, latency.Latency)})
+		}
+		c.webhooks.notify(config.WebhookEventOrderStored, tenantID, &order)
+	}
+	for {
+		err := c.insertOrder(ctx, tenantID, &order, c.rawPayload(msg, order.OrderUid), onCommit)
+		if err == nil {
+			break
+		}
+		if c.db.report(err) {
+			// Соединения потеряны при переключении или перезапуске базы данных: запись повторяется после
+			// восстановления пула, не расходуя попытки сообщения, даже если kafka.consumer.max_attempts не задан
+			c.fail(stageStore, "db_connection", &msg, order.OrderUid, "db connection lost, waiting for pool recovery (order=%s): %v", order.OrderUid, err)
+			if !c.db.wait(ctx) {
+				return false
+			}
+			continue
+		}
+		if errors.Is(err, postgres.ErrOrderExists) || c.cfg.MaxAttempts == 0 {
+			if errors.Is(err, postgres.ErrOrderExists) {
+				// Заказ уже в базе: повтор того же содержимого незачем снова отправлять в базу
+				c.recent.Remember(key, hash)
+				c.ingestStats.record(tenantID, &msg, order.CustomerId, ingeststats.Duplicate)
+			}
+			c.fail(stageStore, "db_insert", &msg, order.OrderUid, "db insert error (order=%s): %v", order.OrderUid, err)
+			return true
+		}
+		c.fail(stageStore, "db_insert", &msg, order.OrderUid, "db insert error, retrying (order=%s): %v", order.OrderUid, err)
+		if c.storeFailed(ctx, msg, tenantID, &order, err) || c.skipMessage(ctx, msg) {
+			return true
+		}
+		if !sleepCtx(ctx, c.clock, c.retryDelay) {
+			return false
+		}
+	}
+	c.recent.Remember(key, hash)
+	c.ingestStats.record(tenantID, &msg, order.CustomerId, ingeststats.Accepted)
+	c.logger.Printf("order %s stored", key)
+
+	opCtx, cancel := opContext(ctx)
+	defer cancel()
+	c.clearAttempts(opCtx, []kafka2.Message{msg})
+	c.recordLatencies(opCtx, tenantID, []postgres.LatencyRecord{latency})
+	return true
+}
+
+// cacheIngested - помещает полученный заказ в кэш, если это разрешает pipeline.cache_on_ingest. Иначе снимается
+// только отметка об отсутствии заказа, чтобы чтение сразу нашло его в базе данных.
+func (c *consumer) cacheIngested(tenantID string, order orders.Order) {
+	if !c.ingest.admit(&order) {
+		c.cache.Delete(tenantID, order.OrderUid)
+		return
+	}
+	if c.cache.SetIfNewer(tenantID, order, c.clock.Now().UnixNano()) {
+		c.logger.Printf("order %s cached", tenant.Key(tenantID, order.OrderUid))
+	}
+}
+
+// insertOrder - записывает заказ арендатора tenantID и после фиксации вызывает onCommit; уже полученное сообщение
+// дорабатывается даже при остановке консьюмера
+func (c *consumer) insertOrder(ctx context.Context, tenantID string, order *orders.Order, raw *postgres.RawPayload, onCommit func()) error {
+	opCtx, cancel := opContext(ctx)
+	defer cancel()
+	return c.repo.InsertOrder(opCtx, tenantID, order, raw, onCommit)
+}
+
+// recordLatencies - сохраняет задержки обработки заказов арендатора tenantID в журнал, если это включено
+// (kafka.consumer.latency.record). Ошибка только логируется: заказы уже сохранены и доступны.
+func (c *consumer) recordLatencies(ctx context.Context, tenantID string, list []postgres.LatencyRecord) {
+	if !c.cfg.Latency.Record || len(list) == 0 {
+		return
+	}
+	if err := c.repo.RecordLatencies(ctx, tenantID, list); err != nil {
+		c.fail(stageAudit, "audit", nil, "", "order latency record error (tenant=%s orders=%d): %v", tenantID, len(list), err)
+	}
+}
+
+// recentDuplicate - сообщает, что заказ с ключом key (tenant.Key) с тем же отпечатком тела сообщения недавно сохранён
+// и сообщение можно пропустить без обращения к базе данных. Заказ с изменившимся содержимым обрабатывается как обычно.
+// Окно не переживает перезапуск, поэтому после него повторы снова доходят до базы данных.
+func (c *consumer) recentDuplicate(key string, hash dedup.Hash, msg kafka2.Message) bool {
+	switch c.recent.Check(key, hash) {
+	case dedup.Duplicate:
+		c.logger.Printf("duplicate order skipped: order=%s %s (skipped total=%d)", key, kafkautil.MessageRef(msg), c.recent.Duplicates())
+		return true
+	case dedup.Changed:
+		c.logger.Printf("order %s received again with changed content: %s", key, kafkautil.MessageRef(msg))
+	}
+	return false
+}
+
+// decode - логирует полученное сообщение, отсеивает повторную доставку, определяет арендатора по топику, декодирует
+// заказ в формате из заголовка content-type (без заголовка — в формате kafka.consumer.format), переводя его в текущую
+// версию схемы, валидирует его и записывает в него источник. Возвращает арендатора и заказ или false третьим значением, если сообщение не содержит
+// заказа для сохранения. Четвёртое значение false означает, что сообщение неизвестной версии схемы не отправлено
+// в очередь недоставленных до остановки консьюмера и его смещение коммитить нельзя.
+func (c *consumer) decode(ctx context.Context, msg kafka2.Message) (string, orders.Order, bool, bool) {
+	// Тело сообщения содержит персональные данные, поэтому по умолчанию логируются только его длина и хэш.
+	// Маскирование работает только для JSON, тела в других форматах не логируются.
+	ref := kafkautil.MessageRef(msg)
+	format, formatErr := codec.ForMessage(msg.Headers, c.format)
+	if c.cfg.LogPayloads && formatErr == nil && format.Name() == codec.FormatJSON {
+		c.logger.Printf("kafka message received: %s len=%d body=%s",
+			ref, len(msg.Value), logging.RedactPayload(msg.Value, c.cfg.LogPayloadMaxBytes))
+	} else {
+		c.logger.Printf("kafka message received: %s len=%d", ref, len(msg.Value))
+	}
+
+	// Сразу после ребалансировки группа может повторно выдать уже обработанные, но ещё не закоммиченные сообщения
+	if c.seen.Seen(fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset)) {
+		c.logger.Printf("duplicate delivery skipped: %s", ref)
+		return "", orders.Order{}, false, true
+	}
+
+	tenantID, ok := c.tenantOf(msg.Topic)
+	if !ok {
+		c.fail(stageDecode, "tenant", &msg, "", "topic of no declared tenant, message skipped (%s)", ref)
+		return "", orders.Order{}, false, true
+	}
+
+	if formatErr != nil {
+		c.fail(stageDecode, "decode", &msg, "", "message format error, permanent (%s): %v", ref, formatErr)
+		c.ingestStats.record(tenantID, &msg, "", ingeststats.Invalid)
+		return "", orders.Order{}, false, true
+	}
+	data, err := upgradeMessageSchema(format, msg)
+	if errors.Is(err, orders.ErrUnknownSchemaVersion) {
+		handled := c.rejectSchema(ctx, msg, tenantID, err)
+		if handled {
+			c.ingestStats.record(tenantID, &msg, "", ingeststats.Invalid)
+		}
+		return "", orders.Order{}, false, handled
+	}
+	if err != nil {
+		c.fail(stageDecode, "decode", &msg, "", "schema version error, permanent (%s): %v", ref, err)
+		c.ingestStats.record(tenantID, &msg, "", ingeststats.Invalid)
+		return "", orders.Order{}, false, true
+	}
+	order, err := c.decodeOrder(format, data)
+	if err != nil {
+		c.ingestStats.record(tenantID, &msg, "", ingeststats.Invalid)
+		if isRetryableDecodeError(err) {
+			c.fail(stageDecode, "decode_retryable", &msg, "", "%s decode failed after %d attempts, message skipped (%s): %v", format.Name(), decodeAttempts, ref, err)
+		} else {
+			c.fail(stageDecode, "decode", &msg, "", "%s decode error, permanent (%s): %v", format.Name(), ref, err)
+		}
+		return "", orders.Order{}, false, true
+	}
+	if err := validation.ValidateOrder(&order); err != nil {
+		c.fail(stageValidate, "validation", &msg, order.OrderUid, "validation error (skip message, order=%s, %s): %v", order.OrderUid, ref, err)
+		c.ingestStats.record(tenantID, &msg, order.CustomerId, ingeststats.Invalid)
+		return "", orders.Order{}, false, true
+	}
+	order.Source, order.SourceDetail = c.source, messageSourceDetail(msg)
+	if len(order.Coerced) > 0 {
+		// Приведённые поля не мешают записи заказа, но говорят о неаккуратном отправителе
+		c.logError("coerced", "order %s decoded with coerced fields (%s): %s", order.OrderUid, ref, strings.Join(order.Coerced, "; "))
+	}
+	return tenantID, order, true, true
+}
+
+// tenantOf - арендатор сообщения из топика topic; false, если арендаторы объявлены, но топик не принадлежит ни одному из них
+func (c *consumer) tenantOf(topic string) (string, bool) {
+	if c.tenants == nil {
+		return tenant.Default, true
+	}
+	tenantID, ok := c.tenants[topic]
+	return tenantID, ok
+}
+
+// decodeOrder - декодирует заказ форматом format, повторяя попытку с паузой retryDelay, пока ошибка декодера временная
+func (c *consumer) decodeOrder(format codec.Codec, data []byte) (order orders.Order, err error) {
+	for attempt := 1; ; attempt++ {
+		order = orders.Order{}
+		err = format.Decode(data, &order)
+		if err == nil || !isRetryableDecodeError(err) || attempt == decodeAttempts {
+			return order, err
+		}
+		c.clock.Sleep(c.retryDelay)
+	}
+}
+
+// isRetryableDecodeError - сообщает, вызвана ли ошибка декодирования чтением данных (ввод-вывод, отмена контекста),
+// а не содержимым сообщения. Синтаксические ошибки и несоответствие типов постоянны: повторное декодирование не поможет.
+func isRetryableDecodeError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return false
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// rawPayload - возвращает исходное сообщение заказа для сохранения или nil, если хранение отключено
+func (c *consumer) rawPayload(msg kafka2.Message, orderUID string) *postgres.RawPayload {
+	if !c.storeRaw {
+		return nil
+	}
+	return &postgres.RawPayload{
+		OrderUid:   orderUID,
+		Payload:    msg.Value,
+		ReceivedAt: c.clock.Now(),
+		Topic:      msg.Topic,
+		Partition:  msg.Partition,
+		Offset:     msg.Offset,
+	}
+}
@@ -0,0 +1,500 @@
+// Описание: Тесты Kafka consumer: коммит после обработки, подавление повторной доставки и ребалансировка между двумя консьюмерами
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/logging"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/codec"
+	"l0_test_self/pkg/testorders"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errRebalanceInProgress - ошибка коммита смещения партиции, которая уже передана другому участнику
+var errRebalanceInProgress = errors.New("rebalance in progress")
+
+// fakeTopic - топик в памяти с партициями, закоммиченными смещениями и назначением партиций участникам группы.
+// Как и в Kafka, отзыв партиции у участника завершается только при его следующем обращении за сообщениями,
+// после чего новый владелец начинает чтение с закоммиченного смещения.
+type fakeTopic struct {
+	mu         sync.Mutex
+	name       string
+	partitions [][]kafka2.Message
+	committed  map[int]int64
+	owner      map[int]string
+	revoking   map[int]string
+	cursors    map[string]map[int]int64
+}
+
+func newFakeTopic(name string, partitions int) *fakeTopic {
+	return &fakeTopic{
+		name:       name,
+		partitions: make([][]kafka2.Message, partitions),
+		committed:  make(map[int]int64),
+		owner:      make(map[int]string),
+		revoking:   make(map[int]string),
+		cursors:    make(map[string]map[int]int64),
+	}
+}
+
+// produce - добавляет сообщение в конец партиции
+func (ft *fakeTopic) produce(partition int, value []byte) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.partitions[partition] = append(ft.partitions[partition], kafka2.Message{
+		Topic:     ft.name,
+		Partition: partition,
+		Offset:    int64(len(ft.partitions[partition])),
+		Value:     value,
+	})
+}
+
+// assign - назначает партицию участнику; если у неё есть владелец, партиция будет передана после его следующего FetchMessage
+func (ft *fakeTopic) assign(partition int, member string) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	if _, ok := ft.owner[partition]; !ok {
+		ft.owner[partition] = member
+		return
+	}
+	ft.revoking[partition] = member
+}
+
+// member - возвращает читателя для участника группы
+func (ft *fakeTopic) member(id string) *fakeMemberReader {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.cursors[id] = make(map[int]int64)
+	return &fakeMemberReader{topic: ft, id: id}
+}
+
+// fakeMemberReader - MessageReader одного участника группы поверх fakeTopic
+type fakeMemberReader struct {
+	topic *fakeTopic
+	id    string
+}
+
+func (r *fakeMemberReader) next() (kafka2.Message, bool) {
+	ft := r.topic
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	cursors := ft.cursors[r.id]
+	for p, newOwner := range ft.revoking {
+		if ft.owner[p] == r.id {
+			ft.owner[p] = newOwner
+			delete(ft.revoking, p)
+			delete(cursors, p)
+		}
+	}
+
+	owned := make([]int, 0, len(ft.partitions))
+	for p, o := range ft.owner {
+		if o == r.id {
+			owned = append(owned, p)
+		}
+	}
+	sort.Ints(owned)
+	for _, p := range owned {
+		cur, ok := cursors[p]
+		if !ok {
+			cur = ft.committed[p]
+		}
+		if cur < int64(len(ft.partitions[p])) {
+			cursors[p] = cur + 1
+			return ft.partitions[p][cur], true
+		}
+		cursors[p] = cur
+	}
+	return kafka2.Message{}, false
+}
+
+func (r *fakeMemberReader) FetchMessage(ctx context.Context) (kafka2.Message, error) {
+	for {
+		if msg, ok := r.next(); ok {
+			return msg, nil
+		}
+		select {
+		case <-ctx.Done():
+			return kafka2.Message{}, ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func (r *fakeMemberReader) CommitMessages(_ context.Context, msgs ...kafka2.Message) error {
+	ft := r.topic
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	for _, m := range msgs {
+		if ft.owner[m.Partition] != r.id {
+			return errRebalanceInProgress
+		}
+		if m.Offset+1 > ft.committed[m.Partition] {
+			ft.committed[m.Partition] = m.Offset + 1
+		}
+	}
+	return nil
+}
+
+func (r *fakeMemberReader) Stats() kafka2.ReaderStats { return kafka2.ReaderStats{} }
+
+func (r *fakeMemberReader) Close() error { return nil }
+
+// redeliveringReader - читатель, повторно выдающий каждое сообщение (как после ребалансировки до коммита)
+type redeliveringReader struct {
+	mu        sync.Mutex
+	msgs      []kafka2.Message
+	pos       int
+	committed []int64
+}
+
+func (r *redeliveringReader) FetchMessage(ctx context.Context) (kafka2.Message, error) {
+	r.mu.Lock()
+	if r.pos < len(r.msgs)*2 {
+		msg := r.msgs[r.pos/2]
+		r.pos++
+		r.mu.Unlock()
+		return msg, nil
+	}
+	r.mu.Unlock()
+	<-ctx.Done()
+	return kafka2.Message{}, ctx.Err()
+}
+
+func (r *redeliveringReader) CommitMessages(_ context.Context, msgs ...kafka2.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range msgs {
+		r.committed = append(r.committed, m.Offset)
+	}
+	return nil
+}
+
+func (r *redeliveringReader) Stats() kafka2.ReaderStats { return kafka2.ReaderStats{} }
+
+func (r *redeliveringReader) Close() error { return nil }
+
+func newConsumerTestConfig() *config.Config {
+	return &config.Config{Kafka: config.KafkaConfig{Consumer: config.ConsumerConfig{
+		DedupSize:   1000,
+		DedupWindow: time.Minute,
+	}}}
+}
+
+func mustOrderJSON(t *testing.T, g *testorders.Generator) []byte {
+	t.Helper()
+	b, err := json.Marshal(g.Order(testorders.ScenarioDefault))
+	require.NoError(t, err)
+	return b
+}
+
+func (f *fakeRepository) stats() (inserts, stored int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.inserts, len(f.orders)
+}
+
+func TestConsumerRebalanceProcessesEachOffsetOnce(t *testing.T) {
+	const perPartition = 50
+	topic := newFakeTopic("orders", 2)
+	gen := testorders.NewGenerator(7)
+	for p := 0; p < 2; p++ {
+		for i := 0; i < perPartition; i++ {
+			topic.produce(p, mustOrderJSON(t, gen))
+		}
+	}
+	topic.assign(0, "a")
+	topic.assign(1, "a")
+
+	repo := &fakeRepository{}
+	cfg := newConsumerTestConfig()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wgA := startKafkaConsumer(ctx, topic.member("a"), nil, repo, newTestCache(t), newTestLogger(), cfg, nil)
+
+	require.Eventually(t, func() bool {
+		inserts, _ := repo.stats()
+		return inserts >= 20
+	}, 5*time.Second, time.Millisecond)
+
+	// Второй экземпляр присоединяется к группе и получает партицию 1
+	memberB := topic.member("b")
+	topic.assign(1, "b")
+	wgB := startKafkaConsumer(ctx, memberB, nil, repo, newTestCache(t), newTestLogger(), cfg, nil)
+
+	require.Eventually(t, func() bool {
+		_, stored := repo.stats()
+		return stored == 2*perPartition
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	wgA.Wait()
+	wgB.Wait()
+
+	inserts, stored := repo.stats()
+	assert.Equal(t, 2*perPartition, stored)
+	assert.Equal(t, 2*perPartition, inserts, "every offset must be processed exactly once")
+	assert.Equal(t, int64(perPartition), topic.committed[0])
+	assert.Equal(t, int64(perPartition), topic.committed[1])
+}
+
+func TestConsumerSuppressesImmediateRedelivery(t *testing.T) {
+	gen := testorders.NewGenerator(8)
+	reader := &redeliveringReader{}
+	for i := 0; i < 5; i++ {
+		reader.msgs = append(reader.msgs, kafka2.Message{Topic: "orders", Offset: int64(i), Value: mustOrderJSON(t, gen)})
+	}
+	reader.msgs = append(reader.msgs, kafka2.Message{Topic: "orders", Offset: 5, Value: []byte("not json")})
+
+	repo := &fakeRepository{}
+	orderCache := newTestCache(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, orderCache, newTestLogger(), newConsumerTestConfig(), nil)
+
+	require.Eventually(t, func() bool {
+		reader.mu.Lock()
+		defer reader.mu.Unlock()
+		return len(reader.committed) == 12
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	inserts, stored := repo.stats()
+	assert.Equal(t, 5, inserts)
+	assert.Equal(t, 5, stored)
+	assert.Equal(t, 5, orderCache.Len())
+}
+
+func TestIsRetryableDecodeError(t *testing.T) {
+	var target orders.Order
+	syntaxErr := json.Unmarshal([]byte("not json"), &target)
+	typeErr := json.Unmarshal([]byte(`{"order_uid": 1}`), &target)
+
+	assert.False(t, isRetryableDecodeError(syntaxErr))
+	assert.False(t, isRetryableDecodeError(typeErr))
+	assert.False(t, isRetryableDecodeError(errors.New("unknown")))
+	assert.True(t, isRetryableDecodeError(io.ErrUnexpectedEOF))
+	assert.True(t, isRetryableDecodeError(fmt.Errorf("read body: %w", context.DeadlineExceeded)))
+}
+
+// decodeFunc - формат сообщений JSON с подменённым декодированием
+type decodeFunc func(data []byte, order *orders.Order) error
+
+func (decodeFunc) Name() string                                    { return codec.FormatJSON }
+func (decodeFunc) ContentType() string                             { return codec.JSON.ContentType() }
+func (decodeFunc) Encode(order *orders.Order) ([]byte, error)      { return codec.JSON.Encode(order) }
+func (f decodeFunc) Decode(data []byte, order *orders.Order) error { return f(data, order) }
+
+// newDecodeTestConsumer - консьюмер для проверки декодирования с логгером, пишущим в буфер
+func newDecodeTestConsumer() (*consumer, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return newConsumer(nil, nil, &fakeRepository{}, nil, log.New(&buf, "", 0), newConsumerTestConfig(), nil), &buf
+}
+
+func TestDecodePermanentErrorLogsMessageRef(t *testing.T) {
+	c, logs := newDecodeTestConsumer()
+	calls := 0
+	c.format = decodeFunc(func(data []byte, order *orders.Order) error {
+		calls++
+		return codec.JSON.Decode(data, order)
+	})
+	msg := kafka2.Message{Topic: "orders", Partition: 2, Offset: 7, Value: []byte("not json")}
+
+	_, _, ok, _ := c.decode(context.Background(), msg)
+
+	assert.False(t, ok)
+	assert.Equal(t, 1, calls, "permanent errors are not retried")
+	assert.Contains(t, logs.String(), "json decode error, permanent (topic=orders partition=2 offset=7 hash="+logging.PayloadHash(msg.Value)+")")
+	assert.Contains(t, logs.String(), "class=decode ")
+}
+
+func TestDecodeRetriesTransientErrors(t *testing.T) {
+	body := mustOrderJSON(t, testorders.NewGenerator(9))
+
+	c, logs := newDecodeTestConsumer()
+	calls := 0
+	c.format = decodeFunc(func(data []byte, order *orders.Order) error {
+		if calls++; calls == 1 {
+			return io.ErrUnexpectedEOF
+		}
+		return codec.JSON.Decode(data, order)
+	})
+	_, order, ok, _ := c.decode(context.Background(), kafka2.Message{Topic: "orders", Offset: 1, Value: body})
+	require.True(t, ok)
+	assert.NotEmpty(t, order.OrderUid)
+	assert.Equal(t, 2, calls)
+	assert.NotContains(t, logs.String(), "decode")
+
+	c, logs = newDecodeTestConsumer()
+	calls = 0
+	c.format = decodeFunc(func([]byte, *orders.Order) error {
+		calls++
+		return context.DeadlineExceeded
+	})
+	_, _, ok, _ = c.decode(context.Background(), kafka2.Message{Topic: "orders", Partition: 1, Offset: 3, Value: body})
+	assert.False(t, ok)
+	assert.Equal(t, decodeAttempts, calls)
+	assert.Contains(t, logs.String(), "message skipped (topic=orders partition=1 offset=3 hash="+logging.PayloadHash(body)+")")
+	assert.Contains(t, logs.String(), "class=decode_retryable")
+}
+
+// newRecentOrderMessages - сообщения с повтором заказа: тот же заказ, он же с изменённым содержимым, другой заказ
+// и повтор изменённого заказа
+func newRecentOrderMessages(t *testing.T) []kafka2.Message {
+	t.Helper()
+	gen := testorders.NewGenerator(12)
+	a, b := gen.Order(testorders.ScenarioDefault), gen.Order(testorders.ScenarioDefault)
+	bodyA, err := json.Marshal(a)
+	require.NoError(t, err)
+	a.Entry = "CHANGED"
+	changedA, err := json.Marshal(a)
+	require.NoError(t, err)
+	bodyB, err := json.Marshal(b)
+	require.NoError(t, err)
+
+	var msgs []kafka2.Message
+	for i, body := range [][]byte{bodyA, bodyA, changedA, bodyB, changedA} {
+		msgs = append(msgs, kafka2.Message{Topic: "orders", Offset: int64(i), Value: body})
+	}
+	return msgs
+}
+
+func TestConsumerSkipsRecentDuplicateOrders(t *testing.T) {
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.Consumer.RecentOrdersSize = 100
+	cfg.Kafka.Consumer.RecentOrdersWindow = time.Minute
+	reader := &sliceReader{msgs: newRecentOrderMessages(t)}
+	repo := &fakeRepository{}
+	var insertCalls int
+	repo.onInsert = func() { insertCalls++ }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), cfg, nil)
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) == 5 }, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	// Повторы с тем же содержимым (смещения 1 и 4) не доходят до базы данных, изменённый заказ доходит
+	assert.Equal(t, 3, insertCalls)
+	_, stored := repo.stats()
+	assert.Equal(t, 2, stored)
+}
+
+func TestConsumerRecentOrdersDisabled(t *testing.T) {
+	reader := &sliceReader{msgs: newRecentOrderMessages(t)}
+	repo := &fakeRepository{}
+	var insertCalls int
+	repo.onInsert = func() { insertCalls++ }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), newConsumerTestConfig(), nil)
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) == 5 }, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	assert.Equal(t, 5, insertCalls)
+}
+
+func TestBatchedConsumerSkipsRecentDuplicateOrders(t *testing.T) {
+	cfg := newBatchedTestConfig(5, time.Hour)
+	cfg.Kafka.Consumer.RecentOrdersSize = 100
+	cfg.Kafka.Consumer.RecentOrdersWindow = time.Minute
+	reader := &sliceReader{msgs: newRecentOrderMessages(t)}
+	repo := &fakeRepository{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), cfg, nil)
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) == 5 }, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	assert.Equal(t, []int{3}, repo.batches, "only the first and changed copies are written")
+}
+
+func TestConsumerSelectsFormatPerMessage(t *testing.T) {
+	gen := testorders.NewGenerator(23)
+	list := make([]orders.Order, 4)
+	for i := range list {
+		list[i] = gen.Order(testorders.ScenarioDefault)
+	}
+	encode := func(c codec.Codec, order orders.Order) []byte {
+		data, err := c.Encode(&order)
+		require.NoError(t, err)
+		return data
+	}
+	protoHeader := []kafka2.Header{codec.Header(codec.Protobuf)}
+	msgs := []kafka2.Message{
+		{Offset: 0, Value: encode(codec.JSON, list[0])},
+		{Offset: 1, Value: encode(codec.Protobuf, list[1]), Headers: protoHeader},
+		{Offset: 2, Value: encode(codec.JSON, list[2]), Headers: []kafka2.Header{codec.Header(codec.JSON)}},
+		{Offset: 3, Value: encode(codec.Protobuf, list[3]), Headers: []kafka2.Header{{Key: codec.ContentTypeHeader, Value: []byte("application/avro")}}},
+		{Offset: 4, Value: encode(codec.Protobuf, list[3])},
+		{Offset: 5, Value: []byte(`{"order_uid": "x"}`), Headers: protoHeader},
+	}
+	for i := range msgs {
+		msgs[i].Topic = "orders"
+	}
+
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.Consumer.ErrorBufferSize = 10
+	monitor := newConsumerMonitor(cfg)
+	repo := &fakeRepository{}
+	reader := &sliceReader{msgs: msgs}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), cfg, monitor)
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) == len(msgs) }, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	_, stored := repo.stats()
+	assert.Equal(t, 3, stored)
+	for _, o := range list[:3] {
+		got, err := repo.GetOrderByUID(context.Background(), tenant.Default, o.OrderUid)
+		require.NoError(t, err)
+		assert.Equal(t, o.Items, got.Items)
+		assert.True(t, o.DateCreated.Equal(got.DateCreated))
+	}
+
+	entries := monitor.errors.Entries(stageDecode)
+	require.Len(t, entries, 3)
+	assert.Contains(t, entries[0].Message, `unknown content type "application/avro"`)
+	assert.Contains(t, entries[1].Message, "json decode error", "messages without a header use the default format")
+	assert.Contains(t, entries[2].Message, "protobuf decode error")
+	assert.Equal(t, int64(5), entries[2].Kafka.Offset)
+}
+
+func TestConsumerDefaultFormat(t *testing.T) {
+	order := testorders.NewGenerator(24).Order(testorders.ScenarioDefault)
+	data, err := codec.Protobuf.Encode(&order)
+	require.NoError(t, err)
+
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.Consumer.Format = codec.FormatProtobuf
+	cfg.Kafka.Consumer.LogPayloads = true
+	var logs bytes.Buffer
+	c := newConsumer(nil, nil, &fakeRepository{}, nil, log.New(&logs, "", 0), cfg, nil)
+	_, got, ok, _ := c.decode(context.Background(), kafka2.Message{Topic: "orders", Value: data})
+	require.True(t, ok)
+	assert.Equal(t, order.OrderUid, got.OrderUid)
+	assert.NotContains(t, logs.String(), order.Delivery.Phone, "protobuf bodies cannot be masked and are not logged")
+	assert.NotContains(t, logs.String(), "body=")
+}
@@ -0,0 +1,98 @@
+// Описание: Контрактные тесты формата сообщений между продюсером и консьюмером: заказы генератора продюсера
+// во всех форматах проходят декодирование консьюмера (consumer.decode) без потерь, повторное кодирование
+// совпадает с сообщением побайтно, а JSON сообщений соответствует схеме orders.OrderSchema
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/codec"
+	"l0_test_self/pkg/testorders"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withDecodeMode - задаёт режим декодирования заказов на время теста
+func withDecodeMode(t *testing.T, mode orders.DecodeMode) {
+	t.Helper()
+	prev := orders.CurrentDecodeMode()
+	orders.SetDecodeMode(mode)
+	t.Cleanup(func() { orders.SetDecodeMode(prev) })
+}
+
+// producerMessage - сообщение с заказом в формате format так, как его публикует продюсер (cmd/producer)
+func producerMessage(t *testing.T, format codec.Codec, order orders.Order, offset int64) kafka2.Message {
+	t.Helper()
+	value, err := format.Encode(&order)
+	require.NoError(t, err)
+	return kafka2.Message{Topic: "orders", Offset: offset, Key: []byte(order.OrderUid), Value: value, Headers: []kafka2.Header{codec.Header(format)}}
+}
+
+func TestContractProducerOrdersRoundTrip(t *testing.T) {
+	withDecodeMode(t, orders.DecodeStrict)
+	gen := testorders.NewGenerator(182)
+	c, logs := newDecodeTestConsumer()
+
+	offset := int64(0)
+	for _, format := range []codec.Codec{codec.JSON, codec.Protobuf} {
+		// Сценарии с несходящимися суммами намеренно исправляются валидацией и в побайтное сравнение не входят
+		for _, scenario := range []testorders.Scenario{testorders.ScenarioDefault, testorders.ScenarioMinimal,
+			testorders.ScenarioMaximal, testorders.ScenarioUnicode, testorders.ScenarioZeroAmounts} {
+			t.Run(fmt.Sprintf("%s/%s", format.Name(), scenario), func(t *testing.T) {
+				order := gen.Order(scenario)
+				offset++
+				msg := producerMessage(t, format, order, offset)
+
+				_, got, ok, _ := c.decode(context.Background(), msg)
+				require.True(t, ok, logs.String())
+				assert.Empty(t, got.Coerced, "strictly decoded orders are not coerced")
+				assert.Empty(t, got.Corrections)
+				assert.Empty(t, got.Warnings)
+				again, err := format.Encode(&got)
+				require.NoError(t, err)
+				assert.Equal(t, string(msg.Value), string(again), "the consumer reads every field the producer writes")
+			})
+		}
+	}
+}
+
+func TestContractProducerPayloadsMatchSchema(t *testing.T) {
+	schema := orders.OrderSchema()
+	gen := testorders.NewGenerator(182)
+	for _, scenario := range testorders.Scenarios() {
+		order := gen.Order(scenario)
+		msg := producerMessage(t, codec.JSON, order, 1)
+		assert.NoError(t, schema.Validate(msg.Value), scenario)
+	}
+}
+
+func TestContractRenamedFieldRejected(t *testing.T) {
+	withDecodeMode(t, orders.DecodeStrict)
+	order := testorders.NewGenerator(182).Order(testorders.ScenarioDefault)
+	msg := producerMessage(t, codec.JSON, order, 1)
+
+	// Продюсер со своей структурой заказа, в которой поле переименовано (order_uid -> orderUID)
+	var obj map[string]any
+	require.NoError(t, json.Unmarshal(msg.Value, &obj))
+	obj["orderUID"] = obj["order_uid"]
+	delete(obj, "order_uid")
+	renamed, err := json.Marshal(obj)
+	require.NoError(t, err)
+
+	err = orders.OrderSchema().Validate(renamed)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "orderUID: unknown field")
+	assert.Contains(t, err.Error(), "order_uid: required field is missing")
+
+	c, logs := newDecodeTestConsumer()
+	msg.Value = renamed
+	_, _, ok, _ := c.decode(context.Background(), msg)
+	assert.False(t, ok, "the consumer does not half-parse a renamed order")
+	assert.Contains(t, logs.String(), "orderUID: unknown field")
+}
@@ -0,0 +1,48 @@
+// Описание: Заказы покупателя GET /customers/{id}/orders: страницы заказов арендатора с customer_id покупателя
+// по подписанным курсорам, как у поиска по трек-номеру GET /orders
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"l0_test_self/internal/pagination"
+)
+
+// makeCustomerOrdersHandler - HTTP обработчик, возвращающий страницу заказов покупателя из пути запроса. Параметры
+// sort, limit, include и cursor те же, что у GET /orders; курсор привязан к арендатору и покупателю, поэтому курсор
+// другого покупателя или поиска по трек-номеру отклоняется с 400. Заказы в карантине не выводятся.
+func makeCustomerOrdersHandler(repo OrderRepository, pii piiPolicy, cursors *pagination.Signer, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, ok := negotiateFormat(w, r)
+		if !ok {
+			return
+		}
+		reqID := requestIDFromContext(r.Context())
+		customerID := strings.TrimSpace(r.PathValue("id"))
+		if customerID == "" {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeCustomerIDRequired)
+			return
+		}
+
+		tenantID := tenantFromContext(r.Context())
+		scope := tenantID + "/customers/" + url.PathEscape(customerID) + "/orders"
+		p, ok := parseListPage(w, r, cursors, scope)
+		if !ok {
+			return
+		}
+
+		// Лишний заказ показывает, есть ли следующая страница
+		list, err := repo.FindOrdersByCustomer(r.Context(), tenantID, customerID, p.sortBy, p.after, p.limit+1, p.include)
+		if err != nil {
+			logger.Printf("[%s] customer orders: db error (customer_id=%q): %v", reqID, customerID, err)
+			if !writeUnavailable(w, r, err) {
+				writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			}
+			return
+		}
+		writeListPage(w, r, format, list, p, scope, cursors, pii, logger)
+	}
+}
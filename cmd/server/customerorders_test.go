@@ -0,0 +1,125 @@
+// Описание: Тесты GET /customers/{id}/orders: постраничная выдача заказов покупателя по курсорам и отклонение
+// курсоров другого покупателя или запроса
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/pagination"
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCustomerOrdersMux - маршрутизатор с GET /customers/{id}/orders и поиском по трек-номеру GET /orders
+func newCustomerOrdersMux(repo OrderRepository, signer *pagination.Signer) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("GET /customers/{id}/orders", withDefaultTenant(makeCustomerOrdersHandler(repo, piiPolicy{}, signer, newTestLogger())))
+	mux.Handle("GET /orders", withDefaultTenant(makeOrderSearchHandler(repo, piiPolicy{}, signer, newTestLogger())))
+	return mux
+}
+
+// customerPage - выполняет GET target и декодирует страницу заказов
+func customerPage(t *testing.T, h http.Handler, target string) orderSearchPage {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var page orderSearchPage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	return page
+}
+
+func TestCustomerOrdersPaginationStableAcrossInserts(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	repo := &fakeRepository{orders: map[string]orders.Order{}}
+	add := func(uid, customer string, created time.Time, quarantined bool) {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		repo.orders[uid] = orders.Order{OrderUid: uid, CustomerId: customer, TrackNumber: "TRACK-" + uid, DateCreated: created, Quarantined: quarantined}
+	}
+	for i := 0; i < 5; i++ {
+		add(fmt.Sprintf("order-%d", i), "customer-1", base.Add(time.Duration(i)*time.Minute), false)
+	}
+	add("order-other", "customer-2", base, false)
+	add("order-quarantined", "customer-1", base.Add(30*time.Second), true)
+	h := newCustomerOrdersMux(repo, newTestCursorSigner(t))
+
+	page := customerPage(t, h, "/customers/customer-1/orders?limit=2")
+	var got []string
+	for _, o := range page.Orders {
+		got = append(got, o.OrderUid)
+	}
+	require.NotEmpty(t, page.NextCursor)
+
+	// Заказ раньше курсора не сдвигает следующие страницы, заказ позже курсора попадает в выдачу
+	add("order-early", "customer-1", base.Add(-time.Hour), false)
+	add("order-late", "customer-1", base.Add(time.Hour), false)
+
+	for cursor := page.NextCursor; cursor != ""; cursor = page.NextCursor {
+		page = customerPage(t, h, "/customers/customer-1/orders?limit=2&cursor="+url.QueryEscape(cursor))
+		for _, o := range page.Orders {
+			got = append(got, o.OrderUid)
+		}
+	}
+	assert.Equal(t, []string{"order-0", "order-1", "order-2", "order-3", "order-4", "order-late"}, got)
+	assert.Equal(t, orders.Sections(0), repo.include, "only order headers are loaded by default")
+
+	// Последняя страница, заполненная ровно до limit, не выдаёт курсор
+	page = customerPage(t, h, "/customers/customer-2/orders?limit=1")
+	require.Len(t, page.Orders, 1)
+	assert.Empty(t, page.NextCursor)
+
+	page = customerPage(t, h, "/customers/nobody/orders")
+	assert.Empty(t, page.Orders)
+	assert.NotNil(t, page.Orders, "an empty page lists no orders rather than null")
+}
+
+func TestCustomerOrdersRejectsForeignCursors(t *testing.T) {
+	repo := &fakeRepository{orders: map[string]orders.Order{}}
+	for i := 0; i < 3; i++ {
+		for _, customer := range []string{"customer-1", "customer-2"} {
+			uid := fmt.Sprintf("%s-order-%d", customer, i)
+			repo.orders[uid] = orders.Order{OrderUid: uid, CustomerId: customer, TrackNumber: "TRACK-1"}
+		}
+	}
+	h := newCustomerOrdersMux(repo, newTestCursorSigner(t))
+	cursor := customerPage(t, h, "/customers/customer-1/orders?limit=1").NextCursor
+	require.NotEmpty(t, cursor)
+	trackCursor := customerPage(t, h, "/orders?track_number=TRACK-1&limit=1").NextCursor
+	require.NotEmpty(t, trackCursor)
+
+	for name, target := range map[string]string{
+		"tampered":        "/customers/customer-1/orders?cursor=" + url.QueryEscape(cursor[:len(cursor)-2]+"AA"),
+		"garbage":         "/customers/customer-1/orders?cursor=abc",
+		"other customer":  "/customers/customer-2/orders?cursor=" + url.QueryEscape(cursor),
+		"track search":    "/customers/customer-1/orders?cursor=" + url.QueryEscape(trackCursor),
+		"other sort":      "/customers/customer-1/orders?sort=updated_at&cursor=" + url.QueryEscape(cursor),
+		"blank customer":  "/customers/%20/orders",
+		"limit too large": "/customers/customer-1/orders?limit=101",
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, name)
+	}
+
+	// Курсор покупателя не применяется к поиску по трек-номеру
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders?track_number=TRACK-1&cursor="+url.QueryEscape(cursor), nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var apiErr apiErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &apiErr))
+	assert.Equal(t, errCodeCursorMismatch, apiErr.Code)
+
+	page := customerPage(t, h, "/customers/customer-1/orders?limit=5&cursor="+url.QueryEscape(cursor))
+	require.Len(t, page.Orders, 2)
+	assert.Equal(t, "customer-1-order-1", page.Orders[0].OrderUid)
+	assert.Empty(t, page.NextCursor)
+}
@@ -0,0 +1,174 @@
+// Описание: Восстановление пула соединений после потери соединений с базой данных (переключение основного сервера
+// PostgreSQL, перезапуск): простаивающие соединения сбрасываются, база проверяется с нарастающей паузой, а консьюмер
+// на это время приостанавливает запись, не расходуя попытки сообщений
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"l0_test_self/internal/goroutines"
+	"l0_test_self/internal/metrics"
+	"l0_test_self/pkg/client/postgres"
+)
+
+const (
+	// dbRecoveryMinBackoff - пауза перед первой проверкой базы данных после потери соединения
+	dbRecoveryMinBackoff = 200 * time.Millisecond
+	// dbRecoveryMaxBackoff - наибольшая пауза между проверками базы данных
+	dbRecoveryMaxBackoff = 5 * time.Second
+	// dbRecoveryPingTimeout - предельное время сброса соединений и одной проверки базы данных
+	dbRecoveryPingTimeout = 2 * time.Second
+)
+
+// dbRecovery - восстановление пула после потери соединений с базой данных. Пока оно идёт, база считается
+// деградировавшей (db_degraded в GET /readyz). nil выключает восстановление: методы nil получателя ничего не делают
+type dbRecovery struct {
+	reset      func(ctx context.Context) int // закрывает простаивающие соединения пула и возвращает их число
+	ping       func(ctx context.Context) error
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	logger     *log.Logger
+	stop       chan struct{} // закрывается close: идущее восстановление прекращается
+	stopOnce   sync.Once
+
+	degraded atomic.Bool
+	mu       sync.Mutex
+	// recovered закрывается, когда база данных снова отвечает; nil — восстановление не идёт
+	recovered chan struct{}
+
+	recoveries *metrics.Counter // начатые восстановления пула
+	resets     *metrics.Counter // простаивающие соединения, закрытые при восстановлении
+}
+
+// newDBRecovery - восстановление пула, сбрасывающее простаивающие соединения функцией reset и проверяющее базу ping
+func newDBRecovery(reset func(ctx context.Context) int, ping func(ctx context.Context) error, logger *log.Logger) *dbRecovery {
+	return &dbRecovery{
+		reset:      reset,
+		ping:       ping,
+		minBackoff: dbRecoveryMinBackoff,
+		maxBackoff: dbRecoveryMaxBackoff,
+		logger:     logger,
+		stop:       make(chan struct{}),
+		recoveries: &metrics.Counter{},
+		resets:     &metrics.Counter{},
+	}
+}
+
+// register - регистрирует метрики восстановления пула в реестре метрик
+func (r *dbRecovery) register(reg *metrics.Registry) {
+	if r == nil {
+		return
+	}
+	reg.RegisterCounter("db_pool_recoveries_total", "Pool recoveries started after losing database connections (failover, restart).", r.recoveries)
+	reg.RegisterCounter("db_pool_reset_connections_total", "Idle pool connections closed by pool recovery.", r.resets)
+	reg.GaugeFunc("db_degraded", "1 while the pool is recovering after losing database connections, 0 otherwise.", func() float64 {
+		if r.isDegraded() {
+			return 1
+		}
+		return 0
+	})
+}
+
+// isDegraded - сообщает, идёт ли восстановление пула
+func (r *dbRecovery) isDegraded() bool {
+	return r != nil && r.degraded.Load()
+}
+
+// report - сообщает, вызвана ли ошибка err потерей соединения с базой данных (postgres.IsConnectionLost), и в этом
+// случае начинает восстановление пула, если оно ещё не идёт
+func (r *dbRecovery) report(err error) bool {
+	if r == nil || !postgres.IsConnectionLost(err) {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.recovered != nil {
+		return true
+	}
+	done := make(chan struct{})
+	r.recovered = done
+	r.degraded.Store(true)
+	r.recoveries.Inc()
+	r.logger.Printf("db connection lost, recovering pool: %v", err)
+	if err := goroutines.TryGo("db pool recovery", r.stop, func() { r.restore(done) }); err != nil {
+		// Без фоновой проверки восстановление не завершилось бы: запись продолжит обычные повторы
+		r.logger.Printf("db pool recovery not started: %v", err)
+		r.finishLocked(done)
+	}
+	return true
+}
+
+// restore - сбрасывает простаивающие соединения пула и проверяет базу данных с паузой от minBackoff, удваивающейся
+// до maxBackoff, пока проверка не пройдёт или восстановление не будет остановлено close
+func (r *dbRecovery) restore(done chan struct{}) {
+	defer func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.finishLocked(done)
+	}()
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), dbRecoveryPingTimeout)
+	n := r.reset(ctx)
+	cancel()
+	r.resets.Add(uint64(n))
+	r.logger.Printf("db pool recovery: %d idle connections closed", n)
+
+	backoff := r.minBackoff
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-r.stop:
+			r.logger.Printf("db pool recovery stopped after %s", time.Since(start).Round(time.Millisecond))
+			return
+		case <-time.After(backoff):
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), dbRecoveryPingTimeout)
+		err := r.ping(ctx)
+		cancel()
+		if err == nil {
+			r.logger.Printf("db pool recovered after %s (%d checks)", time.Since(start).Round(time.Millisecond), attempt)
+			return
+		}
+		if attempt == 1 || attempt%10 == 0 {
+			r.logger.Printf("db pool recovery: database still unavailable (check %d): %v", attempt, err)
+		}
+		backoff = min(backoff*2, r.maxBackoff)
+	}
+}
+
+// finishLocked - завершает восстановление done; вызывается под r.mu
+func (r *dbRecovery) finishLocked(done chan struct{}) {
+	close(done)
+	r.recovered = nil
+	r.degraded.Store(false)
+}
+
+// close - останавливает идущее восстановление пула при остановке сервера
+func (r *dbRecovery) close() {
+	if r == nil {
+		return
+	}
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+// wait - ожидает завершения идущего восстановления пула; false, если ctx отменён раньше
+func (r *dbRecovery) wait(ctx context.Context) bool {
+	if r == nil {
+		return true
+	}
+	r.mu.Lock()
+	done := r.recovered
+	r.mu.Unlock()
+	if done == nil {
+		return true
+	}
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,176 @@
+// Описание: Тесты восстановления пула после потери соединений с базой данных: запуск только для ошибок соединения,
+// ожидание консьюмером восстановления без расхода попыток сообщений в обоих режимах и флаг db_degraded в GET /readyz
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errTerminating - ошибка соединения, оборванного остановкой основного сервера PostgreSQL
+var errTerminating = &pgconn.PgError{Severity: "FATAL", Code: "57P01", Message: "terminating connection due to administrator command"}
+
+// newTestDBRecovery - восстановление пула с короткими паузами; проверка базы вызывает ping, сброс закрывает 2 соединения
+func newTestDBRecovery(t *testing.T, ping func(ctx context.Context) error) *dbRecovery {
+	r := newDBRecovery(func(context.Context) int { return 2 }, ping, newTestLogger())
+	r.minBackoff, r.maxBackoff = time.Millisecond, 5*time.Millisecond
+	t.Cleanup(r.close)
+	return r
+}
+
+// recoverAfter - проверка базы, проходящая с checks-го вызова; перед успешной проверкой вызывается onUp
+func recoverAfter(checks int32, onUp func()) func(ctx context.Context) error {
+	var calls atomic.Int32
+	return func(context.Context) error {
+		if calls.Add(1) < checks {
+			return errors.New("connection refused")
+		}
+		if onUp != nil {
+			onUp()
+		}
+		return nil
+	}
+}
+
+func TestDBRecoveryStartsOnConnectionLossOnly(t *testing.T) {
+	release := make(chan struct{})
+	r := newTestDBRecovery(t, func(ctx context.Context) error {
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	assert.False(t, r.report(errors.New("duplicate key")))
+	assert.False(t, r.report(context.DeadlineExceeded))
+	assert.False(t, r.isDegraded())
+	assert.True(t, r.wait(context.Background()), "nothing to wait for")
+
+	require.True(t, r.report(errTerminating))
+	require.True(t, r.report(errTerminating), "a second loss joins the running recovery")
+	assert.True(t, r.isDegraded())
+	assert.Equal(t, uint64(1), r.recoveries.Value())
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, r.wait(canceled), "wait gives up on a canceled context")
+
+	close(release)
+	assert.True(t, r.wait(context.Background()))
+	assert.False(t, r.isDegraded())
+	assert.Equal(t, uint64(2), r.resets.Value())
+
+	var disabled *dbRecovery
+	assert.False(t, disabled.report(errTerminating))
+	assert.False(t, disabled.isDegraded())
+	assert.True(t, disabled.wait(context.Background()))
+}
+
+func TestConsumerWaitsForPoolRecovery(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 21, 3)
+	repo := &fakeRepository{err: errTerminating}
+	reader := &sliceReader{msgs: msgs}
+	reader.onCommit = requireStoredBeforeCommit(t, repo, uids)
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.Consumer.MaxAttempts = 2
+	monitor := newConsumerMonitor(cfg)
+	monitor.db = newTestDBRecovery(t, recoverAfter(3, func() {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		repo.err = nil
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), cfg, monitor)
+
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) == 3 }, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	_, stored := repo.stats()
+	assert.Equal(t, 3, stored)
+	assert.Empty(t, repo.attempts, "attempts are not spent while the pool recovers")
+	assert.Zero(t, monitor.poison.Value())
+	assert.Equal(t, uint64(1), monitor.db.recoveries.Value())
+}
+
+func TestConsumerLostConnectionRetriedWithoutMaxAttempts(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 22, 1)
+	repo := &fakeRepository{err: errTerminating}
+	reader := &sliceReader{msgs: msgs}
+	reader.onCommit = requireStoredBeforeCommit(t, repo, uids)
+	cfg := newConsumerTestConfig()
+	monitor := newConsumerMonitor(cfg)
+	// База данных не возвращается: при остановке сообщение остаётся незакоммиченным, а не теряется
+	monitor.db = newTestDBRecovery(t, func(context.Context) error { return errors.New("connection refused") })
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), cfg, monitor)
+
+	require.Eventually(t, func() bool { return monitor.db.isDegraded() }, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+	assert.Empty(t, reader.committedOffsets())
+}
+
+func TestBatchedConsumerWaitsForPoolRecovery(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 23, 4)
+	repo := &fakeRepository{err: errTerminating}
+	reader := &sliceReader{msgs: msgs}
+	reader.onCommit = requireStoredBeforeCommit(t, repo, uids)
+	cfg := newBatchedTestConfig(4, time.Hour)
+	cfg.Kafka.Consumer.MaxAttempts = 1
+	monitor := newConsumerMonitor(cfg)
+	monitor.db = newTestDBRecovery(t, recoverAfter(3, func() {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		repo.err = nil
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), cfg, monitor)
+
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) == 4 }, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	assert.Equal(t, []int{4}, repo.batches, "the batch is stored whole, not one by one")
+	assert.Empty(t, repo.attempts)
+	assert.Zero(t, monitor.poison.Value())
+}
+
+func TestReadinessReportsDBDegraded(t *testing.T) {
+	release := make(chan struct{})
+	r := newTestDBRecovery(t, func(context.Context) error { <-release; return nil })
+	h := makeReadinessHandler(r, nil, nil, newTestLogger())
+	readiness := func() readinessResponse {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var resp readinessResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp
+	}
+
+	assert.Equal(t, readinessResponse{Status: "ok"}, readiness())
+	r.report(errTerminating)
+	assert.Equal(t, readinessResponse{Status: "degraded", DBDegraded: true}, readiness())
+	close(release)
+	r.wait(context.Background())
+	assert.Equal(t, readinessResponse{Status: "ok"}, readiness())
+
+	// Без восстановления пула база данных не считается деградировавшей
+	h = makeReadinessHandler(nil, nil, nil, newTestLogger())
+	assert.Equal(t, readinessResponse{Status: "ok"}, readiness())
+}
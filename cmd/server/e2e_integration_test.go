@@ -0,0 +1,89 @@
+//go:build integration
+
+// Описание: Сквозной тест сервера: заказ, отправленный в Kafka, проходит консьюмер, сохраняется в PostgreSQL
+// и отдаётся GET /order. Требует локальных Kafka и PostgreSQL из config.yaml.
+// Запуск: go test -tags integration -run EndToEnd ./cmd/server/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/cache"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	kafkaClient "l0_test_self/pkg/client/kafka"
+	"l0_test_self/pkg/client/postgres"
+	"l0_test_self/pkg/kafkatest"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndToEndProduceConsumeGetOrder(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	ctx := context.Background()
+	cfg, err := config.Load("../../config.yaml")
+	require.NoError(t, err)
+
+	pool, err := postgres.NewClient(ctx, cfg.Database.ToPostgresConfig(), 1)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	require.NoError(t, postgres.EnsureSchema(ctx, pool))
+
+	// Консьюмер читает топик теста отдельной группой; очередь недоставленных сообщений не нужна
+	h := kafkatest.New(t, cfg.Kafka.Brokers)
+	cfg.Tenants = nil
+	cfg.Kafka.Topic = h.Topic
+	cfg.Kafka.GroupID = h.Topic
+	cfg.Kafka.Consumer.StartOffset = kafkaClient.StartOffsetEarliest
+	cfg.Kafka.Consumer.MaxAttempts = 0
+
+	cc, err := cache.NewWithOptions(cache.WithShards(4))
+	require.NoError(t, err)
+	t.Cleanup(cc.Close)
+	app := &App{
+		mode:   modeAll,
+		cfg:    cfg,
+		logger: newTestLogger(),
+		repo:   &pgOrderRepository{pool: pool},
+		cache:  cc,
+		reader: kafkaClient.NewKafkaReader(cfg.ConsumerKafkaConfig()),
+	}
+	url, stop := startTestApp(t, app)
+
+	order := testorders.NewGenerator(time.Now().UnixNano()).Order(testorders.ScenarioDefault)
+	t.Cleanup(func() {
+		for _, table := range []string{"items", "payment", "delivery", "raw_payloads", "order_audit", "orders"} {
+			_, err := pool.Exec(ctx, `DELETE FROM `+table+` WHERE order_uid = $1`, order.OrderUid)
+			assert.NoError(t, err, table)
+		}
+	})
+	h.ProduceJSON(order)
+
+	var got orders.Order
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(url + "/order?id=" + order.OrderUid)
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&got) == nil
+	}, kafkatest.DefaultTimeout, 100*time.Millisecond, "the order becomes available through the API")
+	require.NoError(t, stop())
+
+	assert.Equal(t, order.OrderUid, got.OrderUid)
+	assert.Equal(t, order.TrackNumber, got.TrackNumber)
+	assert.Len(t, got.Items, len(order.Items))
+
+	stored, err := postgres.GetOrderByUID(ctx, pool, tenant.Default, order.OrderUid)
+	require.NoError(t, err, "the consumer stored the order")
+	assert.Equal(t, order.TrackNumber, stored.TrackNumber)
+}
@@ -0,0 +1,273 @@
+// Описание: Сквозные тесты сервера без внешних сервисов: настоящее приложение в режиме all читает заказы из канала
+// вместо Kafka, записывает их в репозиторий в памяти и отдаёт через HTTP API из настоящего кэша.
+// Те же сценарии с Kafka и PostgreSQL — в e2e_integration_test.go.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/cache"
+	"l0_test_self/internal/logging"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+// e2eTimeout - сколько ждать обработки опубликованного сообщения
+const e2eTimeout = 2 * time.Second
+
+// chanReader - читатель Kafka, выдающий сообщения из канала; смещения назначаются в порядке публикации
+type chanReader struct {
+	msgs chan kafka2.Message
+
+	mu        sync.Mutex
+	next      int64
+	committed []int64
+}
+
+func newChanReader() *chanReader {
+	return &chanReader{msgs: make(chan kafka2.Message, 64)}
+}
+
+// publish - отправляет сообщение с телом value в топик orders и возвращает его смещение
+func (r *chanReader) publish(value []byte) int64 {
+	r.mu.Lock()
+	offset := r.next
+	r.next++
+	r.mu.Unlock()
+	r.msgs <- kafka2.Message{Topic: "orders", Offset: offset, Value: value, Time: time.Now()}
+	return offset
+}
+
+func (r *chanReader) FetchMessage(ctx context.Context) (kafka2.Message, error) {
+	select {
+	case msg := <-r.msgs:
+		return msg, nil
+	case <-ctx.Done():
+		return kafka2.Message{}, ctx.Err()
+	}
+}
+
+func (r *chanReader) CommitMessages(_ context.Context, msgs ...kafka2.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range msgs {
+		r.committed = append(r.committed, m.Offset)
+	}
+	return nil
+}
+
+func (r *chanReader) Stats() kafka2.ReaderStats { return kafka2.ReaderStats{} }
+
+func (r *chanReader) Close() error { return nil }
+
+// isCommitted - сообщает, закоммичено ли смещение offset
+func (r *chanReader) isCommitted(offset int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, o := range r.committed {
+		if o == offset {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *chanReader) committedOffsets() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64(nil), r.committed...)
+}
+
+// e2eHarness - приложение в режиме all с chanReader вместо Kafka, fakeRepository вместо PostgreSQL и настоящим кэшем
+type e2eHarness struct {
+	url    string
+	stop   func() error
+	reader *chanReader
+	repo   *fakeRepository
+	cache  *cache.OrderCache
+}
+
+// newE2EHarness - запускает приложение; остановка при завершении теста, если тест не остановил его сам
+func newE2EHarness(t *testing.T) *e2eHarness {
+	t.Helper()
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.Consumer.ErrorBufferSize = 10
+	cfg.Kafka.Consumer.RecentOrdersSize = 100
+	cfg.Kafka.Consumer.RecentOrdersWindow = time.Minute
+	h := &e2eHarness{reader: newChanReader(), repo: &fakeRepository{}, cache: newTestCache(t)}
+	app := &App{mode: modeAll, cfg: cfg, logger: newTestLogger(), repo: h.repo, cache: h.cache, reader: h.reader}
+	url, stop := startTestApp(t, app)
+	var once sync.Once
+	var stopErr error
+	h.url = url
+	h.stop = func() error {
+		once.Do(func() { stopErr = stop() })
+		return stopErr
+	}
+	t.Cleanup(func() { _ = h.stop() })
+	return h
+}
+
+// PublishOrder - публикует заказ в формате JSON и возвращает смещение сообщения
+func (h *e2eHarness) PublishOrder(t *testing.T, order orders.Order) int64 {
+	t.Helper()
+	b, err := json.Marshal(order)
+	require.NoError(t, err)
+	return h.reader.publish(b)
+}
+
+// WaitCommitted - дожидается коммита смещения offset, то есть окончания обработки сообщения
+func (h *e2eHarness) WaitCommitted(t *testing.T, offset int64) {
+	t.Helper()
+	require.Eventually(t, func() bool { return h.reader.isCommitted(offset) }, e2eTimeout, time.Millisecond,
+		"offset %d committed", offset)
+}
+
+// GetOrderHTTP - запрашивает заказ через GET /order и возвращает код ответа и заказ (при 200)
+func (h *e2eHarness) GetOrderHTTP(t *testing.T, id string) (int, orders.Order) {
+	t.Helper()
+	resp, err := http.Get(h.url + "/order?id=" + id)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var got orders.Order
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	}
+	return resp.StatusCode, got
+}
+
+func TestE2EValidOrder(t *testing.T) {
+	h := newE2EHarness(t)
+	order := testorders.NewGenerator(1).Order(testorders.ScenarioDefault)
+
+	h.WaitCommitted(t, h.PublishOrder(t, order))
+
+	code, got := h.GetOrderHTTP(t, order.OrderUid)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, order.TrackNumber, got.TrackNumber)
+	assert.Len(t, got.Items, len(order.Items))
+	stored, ok := h.repo.ordersOf(tenant.Default)[order.OrderUid]
+	require.True(t, ok, "the consumer stored the order")
+	assert.Equal(t, order.TrackNumber, stored.TrackNumber)
+}
+
+func TestE2EInvalidOrderSkipped(t *testing.T) {
+	h := newE2EHarness(t)
+	invalid := testorders.NewGenerator(2).Order(testorders.ScenarioDefault)
+	invalid.TrackNumber = ""
+	valid := testorders.NewGenerator(3).Order(testorders.ScenarioDefault)
+
+	h.PublishOrder(t, invalid)
+	// Сообщение с ошибкой валидации коммитится и не мешает следующим
+	h.WaitCommitted(t, h.PublishOrder(t, valid))
+
+	code, _ := h.GetOrderHTTP(t, invalid.OrderUid)
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.NotContains(t, h.repo.ordersOf(tenant.Default), invalid.OrderUid)
+	assert.Equal(t, []int64{0, 1}, h.reader.committedOffsets())
+	code, _ = h.GetOrderHTTP(t, valid.OrderUid)
+	assert.Equal(t, http.StatusOK, code)
+
+	req, err := http.NewRequest(http.MethodGet, h.url+"/admin/errors?stage="+stageValidate, nil)
+	require.NoError(t, err)
+	req.Header.Set("X-API-Key", testAdminKey)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var errs struct {
+		Errors []logging.ErrorEntry `json:"errors"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&errs))
+	require.Len(t, errs.Errors, 1)
+	assert.Equal(t, invalid.OrderUid, errs.Errors[0].OrderUid)
+}
+
+func TestE2EDuplicateOrder(t *testing.T) {
+	h := newE2EHarness(t)
+	order := testorders.NewGenerator(4).Order(testorders.ScenarioDefault)
+
+	h.PublishOrder(t, order)
+	// Повтор того же сообщения (например, после ребалансировки) не записывается повторно
+	h.WaitCommitted(t, h.PublishOrder(t, order))
+	inserts, stored := h.repo.stats()
+	assert.Equal(t, 1, inserts)
+	assert.Equal(t, 1, stored)
+
+	// Заказ с тем же order_uid и другим содержимым доходит до базы, но уже сохранённый заказ консьюмер не заменяет
+	changed := order
+	changed.TrackNumber = "CHANGEDTRACK"
+	h.WaitCommitted(t, h.PublishOrder(t, changed))
+	inserts, stored = h.repo.stats()
+	assert.Equal(t, 2, inserts)
+	assert.Equal(t, 1, stored)
+
+	code, got := h.GetOrderHTTP(t, order.OrderUid)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, order.TrackNumber, got.TrackNumber)
+}
+
+func TestE2EShutdownMidStream(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	h := newE2EHarness(t)
+	gen := testorders.NewGenerator(5)
+
+	// Запись заказа из третьего сообщения ждёт, пока приложение не начнёт остановку
+	blocked, stopping := make(chan struct{}), make(chan struct{})
+	h.repo.mu.Lock()
+	h.repo.onInsert = func() {
+		h.repo.mu.Lock()
+		n := h.repo.inserts
+		h.repo.mu.Unlock()
+		if n == 2 {
+			close(blocked)
+			<-stopping
+		}
+	}
+	h.repo.mu.Unlock()
+
+	sent := make([]orders.Order, 5)
+	for i := range sent {
+		sent[i] = gen.Order(testorders.ScenarioDefault)
+		h.PublishOrder(t, sent[i])
+	}
+	select {
+	case <-blocked:
+	case <-time.After(e2eTimeout):
+		t.Fatal("the third order was not fetched")
+	}
+
+	// Запись отпускается, когда приложение уже начало остановку: HTTP сервер закрыл порт и не принимает соединения
+	stopErr := make(chan error, 1)
+	go func() { stopErr <- h.stop() }()
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(h.url, "http://"))
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	}, e2eTimeout, time.Millisecond, "the app did not start shutting down")
+	close(stopping)
+	require.NoError(t, <-stopErr)
+
+	// Полученное до остановки сообщение дорабатывается и коммитится, следующие не читаются
+	committed := h.reader.committedOffsets()
+	assert.Equal(t, []int64{0, 1, 2}, committed)
+	stored := h.repo.ordersOf(tenant.Default)
+	assert.Len(t, stored, len(committed))
+	for _, offset := range committed {
+		assert.Contains(t, stored, sent[offset].OrderUid)
+	}
+}
@@ -0,0 +1,233 @@
+// Описание: Потоковая выгрузка заказов в CSV и NDJSON для офлайн-анализа
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/jsonpool"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+)
+
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+
+	defaultExportPageSize = 500
+)
+
+// exportCSVHeader - колонки CSV выгрузки
+var exportCSVHeader = []string{"order_uid", "customer_id", "amount", "date_created", "item_count"}
+
+// exportWriter - запись заказов в выбранном формате выгрузки
+type exportWriter interface {
+	Write(o orders.Order) error
+	Flush() error
+	// Include - разделы заказа, которые нужны формату: остальные не читаются из базы данных
+	Include() postgres.Include
+}
+
+// csvExportWriter - запись заказов в CSV с плоским набором колонок
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (e *csvExportWriter) Write(o orders.Order) error {
+	// amount - сумма всех платежей заказа
+	amount := 0
+	for _, p := range o.Payments {
+		amount += p.Amount
+	}
+	return e.w.Write([]string{
+		o.OrderUid,
+		o.CustomerId,
+		strconv.Itoa(amount),
+		o.DateCreated.UTC().Format(time.RFC3339),
+		strconv.Itoa(len(o.Items)),
+	})
+}
+
+func (e *csvExportWriter) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// Include - CSV выводит сумму платежей и число товаров, доставка не нужна
+func (e *csvExportWriter) Include() postgres.Include {
+	return postgres.IncludePayment | postgres.IncludeItems
+}
+
+// exportChunkBytes - объём строк NDJSON, накопив который ndjsonExportWriter пишет их в ответ до конца страницы
+const exportChunkBytes = 32 << 10
+
+// ndjsonExportWriter - запись полных документов заказов с источником по одному JSON на строку. Строки кодируются в буфер из jsonpool
+// и пишутся в ответ частями по exportChunkBytes и в Flush, поэтому буфер не растёт до размера страницы.
+type ndjsonExportWriter struct {
+	w   io.Writer
+	buf *jsonpool.Buffer
+}
+
+func (e *ndjsonExportWriter) Write(o orders.Order) error {
+	if err := e.buf.Encode(adminOrder{o}); err != nil {
+		return err
+	}
+	if e.buf.Len() < exportChunkBytes {
+		return nil
+	}
+	return e.Flush()
+}
+
+func (e *ndjsonExportWriter) Flush() error {
+	_, err := e.buf.WriteTo(e.w)
+	return err
+}
+
+func (e *ndjsonExportWriter) Include() postgres.Include { return postgres.IncludeAll }
+
+// parseTimeParam - разбирает границу интервала из параметра запроса в формате RFC3339 или YYYY-MM-DD
+func parseTimeParam(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, raw)
+}
+
+// makeOrderExportHandler - HTTP обработчик, потоково выгружающий заказы за интервал [from, to) без буферизации всего набора;
+// параметр source оставляет заказы одного источника.
+// Заказы читаются постранично, после каждой страницы ответ сбрасывается клиенту; отключение клиента прекращает выгрузку.
+func makeOrderExportHandler(repo OrderRepository, cfg config.ExportConfig, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		q := r.URL.Query()
+
+		format := q.Get("format")
+		if format == "" {
+			format = exportFormatNDJSON
+		}
+		if format != exportFormatCSV && format != exportFormatNDJSON {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeExportFormatInvalid)
+			return
+		}
+
+		source, err := parseSourceParam(q.Get(sourceParam))
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeSourceInvalid, strings.Join(orderSources, ", "))
+			return
+		}
+
+		to := time.Now()
+		if raw := q.Get("to"); raw != "" {
+			t, err := parseTimeParam(raw)
+			if err != nil {
+				writeAPIError(w, r, http.StatusBadRequest, errCodeTimeInvalid, "to")
+				return
+			}
+			to = t
+		}
+		from := to.Add(-cfg.MaxRange)
+		if raw := q.Get("from"); raw != "" {
+			t, err := parseTimeParam(raw)
+			if err != nil {
+				writeAPIError(w, r, http.StatusBadRequest, errCodeTimeInvalid, "from")
+				return
+			}
+			from = t
+		} else if cfg.MaxRange <= 0 {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeFromRequired)
+			return
+		}
+		if !from.Before(to) {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeRangeInvalid)
+			return
+		}
+		if cfg.MaxRange > 0 && to.Sub(from) > cfg.MaxRange {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeRangeTooLarge, cfg.MaxRange)
+			return
+		}
+
+		pageSize := cfg.PageSize
+		if pageSize <= 0 {
+			pageSize = defaultExportPageSize
+		}
+
+		filename := fmt.Sprintf("orders_%s_%s.%s", from.UTC().Format("20060102T150405"), to.UTC().Format("20060102T150405"), format)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+		var out exportWriter
+		if format == exportFormatCSV {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			cw := csv.NewWriter(w)
+			if err := cw.Write(exportCSVHeader); err != nil {
+				logger.Printf("[%s] export: write error: %v", reqID, err)
+				return
+			}
+			out = &csvExportWriter{w: cw}
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			buf := jsonpool.Get()
+			defer jsonpool.Put(buf)
+			out = &ndjsonExportWriter{w: w, buf: buf}
+		}
+		rc := http.NewResponseController(w)
+
+		var cursor *postgres.OrderCursor
+		rows := 0
+		for {
+			limit := pageSize
+			if cfg.MaxRows > 0 && cfg.MaxRows-rows < limit {
+				limit = cfg.MaxRows - rows
+			}
+			if limit <= 0 {
+				logger.Printf("[%s] export: row cap %d reached, output truncated", reqID, cfg.MaxRows)
+				break
+			}
+
+			page, err := repo.ListOrdersAfter(r.Context(), tenantFromContext(r.Context()), cursor, from, to, limit, out.Include(), source)
+			if err != nil {
+				if r.Context().Err() != nil {
+					logger.Printf("[%s] export: client disconnected after %d rows", reqID, rows)
+				} else {
+					logger.Printf("[%s] export: db error after %d rows: %v", reqID, rows, err)
+				}
+				return
+			}
+
+			for _, o := range page {
+				if err := out.Write(o); err != nil {
+					logger.Printf("[%s] export: write error after %d rows: %v", reqID, rows, err)
+					return
+				}
+				rows++
+			}
+			if err := out.Flush(); err != nil {
+				logger.Printf("[%s] export: write error after %d rows: %v", reqID, rows, err)
+				return
+			}
+			if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				logger.Printf("[%s] export: flush error after %d rows: %v", reqID, rows, err)
+				return
+			}
+
+			if len(page) < limit {
+				break
+			}
+			last := page[len(page)-1]
+			cursor = &postgres.OrderCursor{DateCreated: last.DateCreated, OrderUid: last.OrderUid}
+
+			if r.Context().Err() != nil {
+				logger.Printf("[%s] export: client disconnected after %d rows", reqID, rows)
+				return
+			}
+		}
+		logger.Printf("[%s] export: %d orders exported as %s", reqID, rows, format)
+	}
+}
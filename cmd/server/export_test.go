@@ -0,0 +1,130 @@
+// Описание: Тесты потоковой выгрузки заказов
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var exportBase = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// seedExportRepository - репозиторий с n заказами, созданными с интервалом в минуту начиная с exportBase
+func seedExportRepository(n int) *fakeRepository {
+	repo := &fakeRepository{orders: make(map[string]orders.Order, n)}
+	for i := 0; i < n; i++ {
+		uid := fmt.Sprintf("order-%03d", i)
+		repo.orders[uid] = orders.Order{
+			OrderUid:    uid,
+			CustomerId:  "cust",
+			DateCreated: exportBase.Add(time.Duration(i) * time.Minute),
+			Payments:    []orders.Payment{{Amount: 100 + i}},
+			Items:       make([]orders.Item, i%3+1),
+		}
+	}
+	return repo
+}
+
+func exportRequest(query string) *http.Request {
+	return httptest.NewRequest(http.MethodGet, "/admin/orders/export?"+query, nil)
+}
+
+func TestExportCSV(t *testing.T) {
+	repo := seedExportRepository(25)
+	handler := withDefaultTenant(makeOrderExportHandler(repo, config.ExportConfig{PageSize: 10, MaxRange: 48 * time.Hour}, newTestLogger()))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, exportRequest("format=csv&from=2024-01-01&to=2024-01-02"))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), `attachment; filename="orders_`)
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 26)
+	assert.Equal(t, exportCSVHeader, records[0])
+	assert.Equal(t, []string{"order-001", "cust", "101", "2024-01-01T00:01:00Z", "2"}, records[2])
+	assert.Equal(t, postgres.IncludePayment|postgres.IncludeItems, repo.include, "CSV does not read deliveries")
+	assert.Equal(t, 3, repo.pageCalls)
+}
+
+func TestExportNDJSON(t *testing.T) {
+	repo := seedExportRepository(12)
+	handler := withDefaultTenant(makeOrderExportHandler(repo, config.ExportConfig{PageSize: 5, MaxRange: 48 * time.Hour}, newTestLogger()))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, exportRequest("format=ndjson&from=2024-01-01T00:00:00Z&to=2024-01-01T00:10:00Z"))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+
+	var uids []string
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var o orders.Order
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &o))
+		uids = append(uids, o.OrderUid)
+	}
+	require.Len(t, uids, 10)
+	assert.Equal(t, "order-000", uids[0])
+	assert.Equal(t, "order-009", uids[9])
+}
+
+func TestExportRowCap(t *testing.T) {
+	repo := seedExportRepository(30)
+	handler := withDefaultTenant(makeOrderExportHandler(repo, config.ExportConfig{PageSize: 10, MaxRows: 15, MaxRange: 48 * time.Hour}, newTestLogger()))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, exportRequest("format=ndjson&from=2024-01-01&to=2024-01-02"))
+
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	assert.Len(t, lines, 15)
+}
+
+func TestExportValidation(t *testing.T) {
+	handler := withDefaultTenant(makeOrderExportHandler(seedExportRepository(1), config.ExportConfig{MaxRange: 24 * time.Hour}, newTestLogger()))
+
+	for _, query := range []string{
+		"format=xml&from=2024-01-01&to=2024-01-02",
+		"format=csv&from=bad&to=2024-01-02",
+		"format=csv&from=2024-01-02&to=2024-01-01",
+		"format=csv&from=2024-01-01&to=2024-01-05",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, exportRequest(query))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func TestExportStopsOnClientDisconnect(t *testing.T) {
+	repo := seedExportRepository(50)
+	ctx, cancel := context.WithCancel(context.Background())
+	repo.onPage = func(call int) {
+		if call == 2 {
+			cancel()
+		}
+	}
+	handler := withDefaultTenant(makeOrderExportHandler(repo, config.ExportConfig{PageSize: 10, MaxRange: 48 * time.Hour}, newTestLogger()))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, exportRequest("format=ndjson&from=2024-01-01&to=2024-01-02").WithContext(ctx))
+
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	assert.Len(t, lines, 10)
+	assert.Equal(t, 2, repo.pageCalls)
+}
@@ -0,0 +1,133 @@
+//go:build integration
+
+// Описание: Интеграционный тест переключения базы данных: PostgreSQL в Docker перезапускается, пока консьюмер пишет
+// заказы; консьюмер продолжает работу без перезапуска, все сообщения с закоммиченными смещениями записаны в базу.
+// Требует локальных Kafka и PostgreSQL из config.yaml и Docker; контейнер базы задаётся POSTGRES_CONTAINER
+// (по умолчанию postgres_container из docker-compose.yml).
+// Запуск: go test -tags integration -run Failover ./cmd/server/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	kafkaClient "l0_test_self/pkg/client/kafka"
+	"l0_test_self/pkg/client/postgres"
+	"l0_test_self/pkg/kafkatest"
+	"l0_test_self/pkg/testorders"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failoverTimeout - ограничение ожидания перезапуска PostgreSQL и записи всех заказов после него
+const failoverTimeout = 2 * time.Minute
+
+func TestFailoverConsumerResumesAfterPostgresRestart(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is not available")
+	}
+	container := os.Getenv("POSTGRES_CONTAINER")
+	if container == "" {
+		container = "postgres_container"
+	}
+	ctx := context.Background()
+	cfg, err := config.Load("../../config.yaml")
+	require.NoError(t, err)
+
+	pool, err := postgres.NewClient(ctx, cfg.Database.ToPostgresConfig(), 1)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	require.NoError(t, postgres.EnsureSchema(ctx, pool))
+	recovery := newDBRecovery(func(ctx context.Context) int { return postgres.ResetIdleConns(ctx, pool) }, pool.Ping, newTestLogger())
+	t.Cleanup(recovery.close)
+
+	// Без kafka.consumer.max_attempts неудачная запись раньше коммитилась и заказ терялся
+	h := kafkatest.New(t, cfg.Kafka.Brokers)
+	cfg.Tenants = nil
+	cfg.Kafka.Topic = h.Topic
+	cfg.Kafka.GroupID = h.Topic
+	cfg.Kafka.Consumer.StartOffset = kafkaClient.StartOffsetEarliest
+	cfg.Kafka.Consumer.MaxAttempts = 0
+	app := &App{
+		mode:   modeConsumer,
+		cfg:    cfg,
+		logger: newTestLogger(),
+		repo:   &pgOrderRepository{pool: pool},
+		cache:  discardCache{},
+		reader: kafkaClient.NewKafkaReader(cfg.ConsumerKafkaConfig()),
+		db:     recovery,
+	}
+	url, stop := startTestApp(t, app)
+
+	gen := testorders.NewGenerator(time.Now().UnixNano())
+	var list []orders.Order
+	produce := func(n int) {
+		for i := 0; i < n; i++ {
+			o := gen.Order(testorders.ScenarioDefault)
+			list = append(list, o)
+			h.ProduceJSON(o)
+		}
+	}
+	t.Cleanup(func() {
+		for _, o := range list {
+			for _, table := range []string{"items", "payment", "delivery", "raw_payloads", "order_audit", "orders"} {
+				_, err := pool.Exec(ctx, `DELETE FROM `+table+` WHERE order_uid = $1`, o.OrderUid)
+				assert.NoError(t, err, table)
+			}
+		}
+	})
+	stored := func() int {
+		n := 0
+		for _, o := range list {
+			if exists, err := postgres.ExistsOrder(ctx, pool, tenant.Default, o.OrderUid); err == nil && exists {
+				n++
+			}
+		}
+		return n
+	}
+
+	produce(5)
+	require.Eventually(t, func() bool { return stored() == 5 }, kafkatest.DefaultTimeout, 100*time.Millisecond)
+
+	// Перезапуск обрывает соединения пула ошибкой terminating connection; заказы отправляются, пока база недоступна
+	restart := exec.Command("docker", "restart", container)
+	require.NoError(t, restart.Start())
+	produce(5)
+	require.NoError(t, restart.Wait(), "docker restart %s", container)
+	produce(5)
+
+	require.Eventually(t, func() bool { return stored() == len(list) }, failoverTimeout, 500*time.Millisecond,
+		"the consumer resumes without restart and stores every order")
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(url + "/readyz")
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		var ready readinessResponse
+		return json.NewDecoder(resp.Body).Decode(&ready) == nil && !ready.DBDegraded
+	}, failoverTimeout, 100*time.Millisecond, "db_degraded clears after recovery")
+	require.NoError(t, stop())
+	t.Logf("pool recoveries: %d, idle connections reset: %d", recovery.recoveries.Value(), recovery.resets.Value())
+
+	// Смещение группы подтверждает все сообщения, и каждое из них записано
+	client := &kafka2.Client{Addr: kafka2.TCP(cfg.Kafka.Brokers...)}
+	offsets, err := client.OffsetFetch(ctx, &kafka2.OffsetFetchRequest{GroupID: cfg.Kafka.GroupID, Topics: map[string][]int{h.Topic: {0}}})
+	require.NoError(t, err)
+	require.Len(t, offsets.Topics[h.Topic], 1)
+	assert.Equal(t, int64(len(list)), offsets.Topics[h.Topic][0].CommittedOffset)
+	assert.Equal(t, len(list), stored())
+}
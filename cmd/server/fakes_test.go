@@ -0,0 +1,919 @@
+// Описание: Фейковые зависимости сервера для тестов: репозиторий заказов в памяти и вспомогательные конструкторы
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/cache"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/pagination"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+// errDuplicateOrder - ошибка фейкового репозитория при повторной вставке заказа
+var errDuplicateOrder = fmt.Errorf("%w: duplicate key value violates unique constraint", postgres.ErrOrderExists)
+
+// errBatchFailed - ошибка фейкового репозитория при сценарной неудаче записи пачки
+var errBatchFailed = errors.New("connection reset by peer")
+
+// errItemConstraint - ошибка фейкового репозитория при нарушении ограничения последним товаром заказа: транзакция откатывается
+var errItemConstraint = errors.New(`failed to insert item: ERROR: duplicate key value violates unique constraint "items_pkey" (SQLSTATE 23505)`)
+
+// fakeRepository - репозиторий заказов в памяти для тестов. Заказы tenant.Default хранятся в orders, остальных
+// арендаторов — в tenantOrders; исходные сообщения, задержки и ключи идемпотентности — по ключам fakeKey.
+type fakeRepository struct {
+	mu           sync.Mutex
+	orders       map[string]orders.Order
+	tenantOrders map[string]map[string]orders.Order
+	raws         map[string]postgres.RawPayload
+	err          error
+
+	readErrs     []error          // сценарий ошибок GetOrderByUID: по одному элементу на вызов, nil — обычное чтение
+	uidErrs      map[string]error // ошибки GetOrderByUID для отдельных заказов
+	reads        int
+	sectionReads int // чтения отдельных разделов заказа (GetDelivery, GetPayments, GetItems)
+	existsCalls  int
+	inserts      int
+	batches      []int      // размеры успешно записанных пачек
+	batchUIDs    [][]string // order_uid заказов успешно записанных пачек в порядке записи
+	deleteCalls  []int      // размеры пачек DeleteArchivedOrders
+	failBatches  int        // сколько ближайших вызовов InsertOrders завершатся ошибкой
+	pageCalls    int
+	onPage       func(call int)   // вызывается перед каждым чтением страницы
+	onInsert     func()           // вызывается перед каждой вставкой InsertOrder без блокировки репозитория
+	onRead       func()           // вызывается перед каждым чтением GetOrderByUID без блокировки репозитория
+	include      postgres.Include // разделы, запрошенные последним чтением списка заказов
+
+	idempotency map[string]postgres.IdempotencyRecord
+	onKeyBusy   func()                            // вызывается под блокировкой, когда ReserveIdempotencyKey находит ключ занятым
+	latencies   map[string]postgres.LatencyRecord // последняя задержка обработки каждого заказа
+
+	poisonUIDs map[string]bool // заказы, запись которых всегда завершается errBatchFailed
+	// rollbackUIDs - заказы, запись которых доходит до последнего товара и откатывается с errItemConstraint
+	rollbackUIDs map[string]bool
+	attempts     map[postgres.MessageKey]int // журнал неудачных попыток записи сообщений
+
+	checkpoints     map[string]map[int]int64 // позиции чтения по "читатель/топик" и партициям
+	checkpointSaves int
+
+	skips map[postgres.MessageKey]postgres.MessageSkip // указания пропустить сообщения
+
+	deliveryHistory map[string][]postgres.DeliveryChange // история доставки по ключам fakeKey
+
+	webhookFailures []postgres.WebhookFailure // журнал недоставленных уведомлений
+
+	ingestStats []postgres.IngestStats // почасовые счётчики сообщений, сложенные как в таблице ingest_stats
+	statsErr    error                  // ошибка AddIngestStats
+}
+
+// fakeKey - ключ записи id арендатора tenantID: для tenant.Default совпадает с id, как до появления арендаторов
+func fakeKey(tenantID, id string) string {
+	if tenantID == tenant.Default {
+		return id
+	}
+	return tenant.Key(tenantID, id)
+}
+
+// ordersOfLocked - заказы арендатора tenantID, создаваемые при первом обращении
+func (f *fakeRepository) ordersOfLocked(tenantID string) map[string]orders.Order {
+	if tenantID == tenant.Default {
+		if f.orders == nil {
+			f.orders = make(map[string]orders.Order)
+		}
+		return f.orders
+	}
+	if f.tenantOrders == nil {
+		f.tenantOrders = make(map[string]map[string]orders.Order)
+	}
+	if f.tenantOrders[tenantID] == nil {
+		f.tenantOrders[tenantID] = make(map[string]orders.Order)
+	}
+	return f.tenantOrders[tenantID]
+}
+
+// ordersOf - копия заказов арендатора tenantID
+func (f *fakeRepository) ordersOf(tenantID string) map[string]orders.Order {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list := make(map[string]orders.Order)
+	for uid, o := range f.ordersOfLocked(tenantID) {
+		list[uid] = o
+	}
+	return list
+}
+
+func (f *fakeRepository) InsertOrder(_ context.Context, tenantID string, order *orders.Order, raw *postgres.RawPayload, onCommit ...func()) error {
+	if f.onInsert != nil {
+		f.onInsert()
+	}
+	if err := f.insertOrder(tenantID, order, raw); err != nil {
+		return err
+	}
+	runFakeCommitHooks(onCommit)
+	return nil
+}
+
+// insertOrder - записывает заказ, как транзакция InsertOrder: при ошибке ничего не сохраняется
+func (f *fakeRepository) insertOrder(tenantID string, order *orders.Order, raw *postgres.RawPayload) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inserts++
+	if f.err != nil {
+		return f.err
+	}
+	if f.poisonUIDs[order.OrderUid] {
+		return errBatchFailed
+	}
+	list := f.ordersOfLocked(tenantID)
+	if _, ok := list[order.OrderUid]; ok {
+		return errDuplicateOrder
+	}
+	if f.rollbackUIDs[order.OrderUid] {
+		return errItemConstraint
+	}
+	order.StoredAt = time.Now()
+	list[order.OrderUid] = *order
+	f.storeRawLocked(tenantID, raw)
+	return nil
+}
+
+// runFakeCommitHooks - вызывает onCommit после «фиксации» записи без блокировки репозитория, как это делает база данных
+func runFakeCommitHooks(onCommit []func()) {
+	for _, fn := range onCommit {
+		if fn != nil {
+			fn()
+		}
+	}
+}
+
+// storeRawLocked - сохраняет копию исходного сообщения, как это делает база данных
+func (f *fakeRepository) storeRawLocked(tenantID string, raw *postgres.RawPayload) {
+	if raw == nil {
+		return
+	}
+	if f.raws == nil {
+		f.raws = make(map[string]postgres.RawPayload)
+	}
+	stored := *raw
+	stored.Payload = append([]byte(nil), raw.Payload...)
+	f.raws[fakeKey(tenantID, raw.OrderUid)] = stored
+}
+
+func (f *fakeRepository) InsertOrders(_ context.Context, list []postgres.OrderRecord, onCommit ...func()) (int, error) {
+	inserted, err := f.insertOrders(list)
+	if err != nil {
+		return 0, err
+	}
+	runFakeCommitHooks(onCommit)
+	return inserted, nil
+}
+
+// insertOrders - записывает пачку, как транзакция InsertOrders: при ошибке не сохраняется ни один заказ пачки
+func (f *fakeRepository) insertOrders(list []postgres.OrderRecord) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+	if f.failBatches > 0 {
+		f.failBatches--
+		return 0, errBatchFailed
+	}
+	for _, rec := range list {
+		if f.poisonUIDs[rec.Order.OrderUid] {
+			return 0, errBatchFailed
+		}
+		if f.rollbackUIDs[rec.Order.OrderUid] {
+			return 0, fmt.Errorf("order %s: %w", rec.Order.OrderUid, errItemConstraint)
+		}
+	}
+	inserted := 0
+	for i := range list {
+		rec := &list[i]
+		stored := f.ordersOfLocked(rec.Tenant)
+		if _, ok := stored[rec.Order.OrderUid]; ok {
+			continue
+		}
+		// Как и база данных, время записи получают только вставленные заказы
+		rec.Order.StoredAt = time.Now()
+		stored[rec.Order.OrderUid] = rec.Order
+		f.storeRawLocked(rec.Tenant, rec.Raw)
+		inserted++
+	}
+	f.inserts += inserted
+	f.batches = append(f.batches, len(list))
+	uids := make([]string, 0, len(list))
+	for _, rec := range list {
+		uids = append(uids, rec.Order.OrderUid)
+	}
+	f.batchUIDs = append(f.batchUIDs, uids)
+	return inserted, nil
+}
+
+func (f *fakeRepository) GetOrderByUID(_ context.Context, tenantID, uid string) (orders.Order, error) {
+	if f.onRead != nil {
+		f.onRead()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reads++
+	if len(f.readErrs) > 0 {
+		err := f.readErrs[0]
+		f.readErrs = f.readErrs[1:]
+		if err != nil {
+			return orders.Order{}, err
+		}
+	}
+	if err := f.uidErrs[uid]; err != nil {
+		return orders.Order{}, err
+	}
+	if f.err != nil {
+		return orders.Order{}, f.err
+	}
+	o, ok := f.ordersOfLocked(tenantID)[uid]
+	if !ok {
+		return orders.Order{}, postgres.ErrOrderNotFound
+	}
+	return o, nil
+}
+
+// sectionOrder - заказ, раздел которого читается отдельно, или ошибка чтения
+func (f *fakeRepository) sectionOrder(tenantID, uid string) (orders.Order, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sectionReads++
+	if err := f.uidErrs[uid]; err != nil {
+		return orders.Order{}, err
+	}
+	if f.err != nil {
+		return orders.Order{}, f.err
+	}
+	o, ok := f.ordersOfLocked(tenantID)[uid]
+	if !ok {
+		return orders.Order{}, postgres.ErrOrderNotFound
+	}
+	return o, nil
+}
+
+func (f *fakeRepository) GetDelivery(_ context.Context, tenantID, uid string) (*orders.Delivery, error) {
+	o, err := f.sectionOrder(tenantID, uid)
+	if err != nil || o.Delivery == (orders.Delivery{}) {
+		return nil, err
+	}
+	return &o.Delivery, nil
+}
+
+func (f *fakeRepository) GetPayments(_ context.Context, tenantID, uid string) ([]orders.Payment, error) {
+	o, err := f.sectionOrder(tenantID, uid)
+	return o.Payments, err
+}
+
+func (f *fakeRepository) GetItems(_ context.Context, tenantID, uid string) ([]orders.Item, error) {
+	o, err := f.sectionOrder(tenantID, uid)
+	return o.Items, err
+}
+
+func (f *fakeRepository) ExistsOrder(_ context.Context, tenantID, uid string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.existsCalls++
+	if f.err != nil {
+		return false, f.err
+	}
+	_, ok := f.ordersOfLocked(tenantID)[uid]
+	return ok, nil
+}
+
+func (f *fakeRepository) UpdateDelivery(_ context.Context, tenantID, uid string, expected time.Time, d orders.Delivery, changedBy string) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return time.Time{}, f.err
+	}
+	list := f.ordersOfLocked(tenantID)
+	o, ok := list[uid]
+	if !ok {
+		return time.Time{}, postgres.ErrOrderNotFound
+	}
+	if !o.UpdatedAt.Equal(expected) {
+		return time.Time{}, fmt.Errorf("%w: %s", postgres.ErrConflict, uid)
+	}
+	if o.Delivery != d {
+		if f.deliveryHistory == nil {
+			f.deliveryHistory = make(map[string][]postgres.DeliveryChange)
+		}
+		prev := o.Delivery
+		key := fakeKey(tenantID, uid)
+		f.deliveryHistory[key] = append(f.deliveryHistory[key], postgres.DeliveryChange{Previous: &prev, ChangedAt: o.UpdatedAt.Add(time.Second), ChangedBy: changedBy})
+	}
+	o.Delivery = d
+	o.UpdatedAt = o.UpdatedAt.Add(time.Second)
+	list[uid] = o
+	return o.UpdatedAt, nil
+}
+
+func (f *fakeRepository) ListDeliveryHistory(_ context.Context, tenantID, uid string) ([]postgres.DeliveryChange, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	if _, ok := f.ordersOfLocked(tenantID)[uid]; !ok {
+		return nil, postgres.ErrOrderNotFound
+	}
+	return slices.Clone(f.deliveryHistory[fakeKey(tenantID, uid)]), nil
+}
+
+func (f *fakeRepository) DeleteDeliveryHistoryBefore(_ context.Context, before time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+	var deleted int64
+	for key, list := range f.deliveryHistory {
+		kept := list[:0]
+		for _, c := range list {
+			if c.ChangedAt.Before(before) {
+				deleted++
+				continue
+			}
+			kept = append(kept, c)
+		}
+		f.deliveryHistory[key] = kept
+	}
+	return deleted, nil
+}
+
+func (f *fakeRepository) ListOrdersAfter(ctx context.Context, tenantID string, after *postgres.OrderCursor, from, to time.Time, limit int, include postgres.Include, source string) ([]orders.Order, error) {
+	f.mu.Lock()
+	f.pageCalls++
+	call := f.pageCalls
+	f.mu.Unlock()
+	if f.onPage != nil {
+		f.onPage(call)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.include = include
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	all := make([]orders.Order, 0, len(f.orders))
+	for _, o := range f.ordersOfLocked(tenantID) {
+		if o.Quarantined || o.DateCreated.Before(from) || !o.DateCreated.Before(to) || source != "" && storedSource(o) != source {
+			continue
+		}
+		all = append(all, o)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if !all[i].DateCreated.Equal(all[j].DateCreated) {
+			return all[i].DateCreated.Before(all[j].DateCreated)
+		}
+		return all[i].OrderUid < all[j].OrderUid
+	})
+
+	page := make([]orders.Order, 0, limit)
+	for _, o := range all {
+		if after != nil && (o.DateCreated.Before(after.DateCreated) ||
+			o.DateCreated.Equal(after.DateCreated) && o.OrderUid <= after.OrderUid) {
+			continue
+		}
+		page = append(page, o.Omit(postgres.IncludeAll&^include))
+		if len(page) == limit {
+			break
+		}
+	}
+	return page, nil
+}
+
+func (f *fakeRepository) FindOrdersByTrackNumber(_ context.Context, tenantID, trackNumber, sortBy string, after *postgres.SortCursor, limit int, include postgres.Include, source string) ([]orders.Order, error) {
+	return f.findOrdersPage(tenantID, func(o orders.Order) bool {
+		return o.TrackNumber == trackNumber && (source == "" || storedSource(o) == source)
+	}, sortBy, after, limit, include)
+}
+
+func (f *fakeRepository) FindOrdersByCustomer(_ context.Context, tenantID, customerID, sortBy string, after *postgres.SortCursor, limit int, include postgres.Include) ([]orders.Order, error) {
+	return f.findOrdersPage(tenantID, func(o orders.Order) bool { return o.CustomerId == customerID }, sortBy, after, limit, include)
+}
+
+// findOrdersPage - страница заказов арендатора, отобранных match, как у postgres.FindOrdersByTrackNumber
+func (f *fakeRepository) findOrdersPage(tenantID string, match func(orders.Order) bool, sortBy string, after *postgres.SortCursor, limit int, include postgres.Include) ([]orders.Order, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.include = include
+	if f.err != nil {
+		return nil, f.err
+	}
+	less := func(a, b orders.Order) bool {
+		if ka, kb := postgres.SortValue(a, sortBy), postgres.SortValue(b, sortBy); !ka.Equal(kb) {
+			return ka.Before(kb)
+		}
+		return a.OrderUid < b.OrderUid
+	}
+	var list []orders.Order
+	for _, o := range f.ordersOfLocked(tenantID) {
+		if !match(o) || o.Quarantined {
+			continue
+		}
+		if after != nil && !less(orders.Order{OrderUid: after.OrderUid, DateCreated: after.Value, StoredAt: after.Value, UpdatedAt: after.Value}, o) {
+			continue
+		}
+		list = append(list, o)
+	}
+	sort.Slice(list, func(i, j int) bool { return less(list[i], list[j]) })
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	for i := range list {
+		list[i] = list[i].Omit(postgres.IncludeAll &^ include)
+	}
+	return list, nil
+}
+
+func (f *fakeRepository) CountOrdersBy(_ context.Context, tenantID, groupBy string, from, to time.Time) ([]postgres.GroupCount, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	counts := make(map[string]int)
+	totals := make(map[string]map[string]int64)
+	add := func(key string, payments []orders.Payment) {
+		counts[key]++
+		if totals[key] == nil {
+			totals[key] = make(map[string]int64)
+		}
+		for _, p := range payments {
+			totals[key][strings.ToUpper(p.Currency)] += int64(p.Amount)
+		}
+	}
+	for _, o := range f.ordersOfLocked(tenantID) {
+		if o.Quarantined || o.DateCreated.Before(from) || !o.DateCreated.Before(to) {
+			continue
+		}
+		switch groupBy {
+		case "delivery_service":
+			add(o.DeliveryService, o.Payments)
+		case "locale":
+			add(o.Locale, o.Payments)
+		case "status":
+			seen := make(map[orders.ItemStatus]bool)
+			for _, it := range o.Items {
+				if !seen[it.Status] {
+					seen[it.Status] = true
+					add(strconv.Itoa(int(it.Status)), o.Payments)
+				}
+			}
+		case "currency":
+			byCurrency := make(map[string][]orders.Payment)
+			for _, p := range o.Payments {
+				c := strings.ToUpper(p.Currency)
+				byCurrency[c] = append(byCurrency[c], p)
+			}
+			for c, payments := range byCurrency {
+				add(c, payments)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %q", postgres.ErrUnknownGroupKey, groupBy)
+		}
+	}
+
+	result := make([]postgres.GroupCount, 0, len(counts))
+	for k, n := range counts {
+		gc := postgres.GroupCount{Key: k, Count: n}
+		for c, amount := range totals[k] {
+			gc.Totals = append(gc.Totals, postgres.CurrencyTotal{Currency: c, Amount: amount})
+		}
+		sort.Slice(gc.Totals, func(i, j int) bool { return gc.Totals[i].Currency < gc.Totals[j].Currency })
+		result = append(result, gc)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result, nil
+}
+
+func (f *fakeRepository) ListIncompleteOrders(_ context.Context, tenantID, after string, limit int) ([]postgres.IncompleteOrder, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	var list []postgres.IncompleteOrder
+	for uid, o := range f.ordersOfLocked(tenantID) {
+		entry := postgres.IncompleteOrder{
+			OrderUid:        uid,
+			ItemsMissing:    len(o.Items) == 0,
+			DeliveryMissing: o.Delivery == (orders.Delivery{}),
+			PaymentMissing:  len(o.Payments) == 0,
+		}
+		if uid > after && (entry.ItemsMissing || entry.DeliveryMissing || entry.PaymentMissing) {
+			list = append(list, entry)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].OrderUid < list[j].OrderUid })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (f *fakeRepository) RecentOrders(_ context.Context, tenantID string, limit int) ([]postgres.OrderSummary, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	var list []postgres.OrderSummary
+	for _, o := range f.ordersOfLocked(tenantID) {
+		if !o.Quarantined {
+			list = append(list, postgres.Summarize(&o))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].StoredAt.Equal(list[j].StoredAt) {
+			return list[i].StoredAt.After(list[j].StoredAt)
+		}
+		return list[i].OrderUid > list[j].OrderUid
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (f *fakeRepository) OrderUIDsWithPrefix(_ context.Context, tenantID, prefix string, limit int) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	var list []string
+	for uid, o := range f.ordersOfLocked(tenantID) {
+		if strings.HasPrefix(uid, prefix) && !o.Quarantined {
+			list = append(list, uid)
+		}
+	}
+	sort.Strings(list)
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (f *fakeRepository) GetRawPayload(_ context.Context, tenantID, uid string) (postgres.RawPayload, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return postgres.RawPayload{}, f.err
+	}
+	raw, ok := f.raws[fakeKey(tenantID, uid)]
+	if !ok {
+		return postgres.RawPayload{}, postgres.ErrRawPayloadNotFound
+	}
+	return raw, nil
+}
+
+func (f *fakeRepository) DeleteRawPayloadsBefore(_ context.Context, before time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+	var deleted int64
+	for uid, raw := range f.raws {
+		if raw.ReceivedAt.Before(before) {
+			delete(f.raws, uid)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (f *fakeRepository) DeleteArchivedOrders(_ context.Context, tenantID string, uids []string, before time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.deleteCalls = append(f.deleteCalls, len(uids))
+	stored := f.ordersOfLocked(tenantID)
+	var deleted int64
+	for _, uid := range uids {
+		if o, ok := stored[uid]; ok && o.DateCreated.Before(before) {
+			delete(stored, uid)
+			delete(f.raws, fakeKey(tenantID, uid))
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (f *fakeRepository) ReserveIdempotencyKey(_ context.Context, tenantID, key, requestHash string, expiredBefore time.Time) (postgres.IdempotencyRecord, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return postgres.IdempotencyRecord{}, false, f.err
+	}
+	if f.idempotency == nil {
+		f.idempotency = make(map[string]postgres.IdempotencyRecord)
+	}
+	if rec, ok := f.idempotency[fakeKey(tenantID, key)]; ok && !rec.CreatedAt.Before(expiredBefore) {
+		if f.onKeyBusy != nil {
+			f.onKeyBusy()
+		}
+		return rec, false, nil
+	}
+	rec := postgres.IdempotencyRecord{Tenant: tenantID, Key: key, RequestHash: requestHash, CreatedAt: time.Now()}
+	f.idempotency[fakeKey(tenantID, key)] = rec
+	return rec, true, nil
+}
+
+func (f *fakeRepository) CompleteIdempotencyKey(_ context.Context, rec postgres.IdempotencyRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if stored, ok := f.idempotency[fakeKey(rec.Tenant, rec.Key)]; ok && stored.RequestHash == rec.RequestHash {
+		rec.CreatedAt = stored.CreatedAt
+		f.idempotency[fakeKey(rec.Tenant, rec.Key)] = rec
+	}
+	return nil
+}
+
+func (f *fakeRepository) ReleaseIdempotencyKey(_ context.Context, tenantID, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if rec, ok := f.idempotency[fakeKey(tenantID, key)]; ok && rec.Status == 0 {
+		delete(f.idempotency, fakeKey(tenantID, key))
+	}
+	return nil
+}
+
+func (f *fakeRepository) DeleteIdempotencyKeysBefore(_ context.Context, before time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var deleted int64
+	for key, rec := range f.idempotency {
+		if rec.CreatedAt.Before(before) {
+			delete(f.idempotency, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (f *fakeRepository) RecordLatencies(_ context.Context, tenantID string, list []postgres.LatencyRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	if f.latencies == nil {
+		f.latencies = make(map[string]postgres.LatencyRecord)
+	}
+	for _, rec := range list {
+		f.latencies[fakeKey(tenantID, rec.OrderUid)] = rec
+	}
+	return nil
+}
+
+func (f *fakeRepository) RecordWebhookFailure(_ context.Context, failure postgres.WebhookFailure) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.webhookFailures = append(f.webhookFailures, failure)
+	return nil
+}
+
+func (f *fakeRepository) AddIngestStats(_ context.Context, list []postgres.IngestStats) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.statsErr != nil {
+		return f.statsErr
+	}
+next:
+	for _, s := range list {
+		s.Hour = s.Hour.UTC().Truncate(time.Hour)
+		for i := range f.ingestStats {
+			row := &f.ingestStats[i]
+			if row.Tenant == s.Tenant && row.Producer == s.Producer && row.Customer == s.Customer && row.Hour.Equal(s.Hour) {
+				row.Accepted += s.Accepted
+				row.Invalid += s.Invalid
+				row.Duplicate += s.Duplicate
+				continue next
+			}
+		}
+		f.ingestStats = append(f.ingestStats, s)
+	}
+	return nil
+}
+
+func (f *fakeRepository) ListIngestStats(_ context.Context, tenantID string, filter postgres.IngestStatsFilter, limit int) ([]postgres.IngestStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	var list []postgres.IngestStats
+	for _, s := range f.ingestStats {
+		if s.Tenant != tenantID || s.Hour.Before(filter.From) || !s.Hour.Before(filter.To) ||
+			filter.Producer != "" && s.Producer != filter.Producer || filter.Customer != "" && s.Customer != filter.Customer {
+			continue
+		}
+		list = append(list, s)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Hour.After(list[j].Hour) })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (f *fakeRepository) RecordMessageAttempt(_ context.Context, key postgres.MessageKey, _, _ string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+	if f.attempts == nil {
+		f.attempts = make(map[postgres.MessageKey]int)
+	}
+	f.attempts[key]++
+	return f.attempts[key], nil
+}
+
+func (f *fakeRepository) ClearMessageAttempts(_ context.Context, keys []postgres.MessageKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, k := range keys {
+		delete(f.attempts, k)
+	}
+	return nil
+}
+
+func (f *fakeRepository) SaveCheckpoint(_ context.Context, cp postgres.Checkpoint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	if f.checkpoints == nil {
+		f.checkpoints = make(map[string]map[int]int64)
+	}
+	key := cp.Reader + "/" + cp.Topic
+	if f.checkpoints[key] == nil {
+		f.checkpoints[key] = make(map[int]int64)
+	}
+	f.checkpoints[key][cp.Partition] = cp.Offset
+	f.checkpointSaves++
+	return nil
+}
+
+func (f *fakeRepository) LoadCheckpoints(_ context.Context, reader, topic string) (map[int]int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	offsets := make(map[int]int64)
+	for p, o := range f.checkpoints[reader+"/"+topic] {
+		offsets[p] = o
+	}
+	return offsets, nil
+}
+
+func (f *fakeRepository) AddMessageSkip(_ context.Context, skip postgres.MessageSkip) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	if f.skips == nil {
+		f.skips = make(map[postgres.MessageKey]postgres.MessageSkip)
+	}
+	f.skips[skip.Key] = skip
+	return nil
+}
+
+func (f *fakeRepository) ListMessageSkips(context.Context) ([]postgres.MessageSkip, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	list := make([]postgres.MessageSkip, 0, len(f.skips))
+	for _, s := range f.skips {
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+func (f *fakeRepository) DeleteMessageSkip(_ context.Context, key postgres.MessageKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.skips, key)
+	return nil
+}
+
+// pendingSkips - ключи сохранённых указаний пропустить сообщения
+func (f *fakeRepository) pendingSkips() []postgres.MessageKey {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]postgres.MessageKey, 0, len(f.skips))
+	for k := range f.skips {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// fakeWriter - писатель Kafka, запоминающий отправленные сообщения; пока задан err, запись завершается ошибкой
+type fakeWriter struct {
+	mu       sync.Mutex
+	msgs     []kafka2.Message
+	err      error
+	attempts int // вызовы WriteMessages, включая неудачные
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka2.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.attempts++
+	if w.err != nil {
+		return w.err
+	}
+	w.msgs = append(w.msgs, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error { return nil }
+
+func (w *fakeWriter) written() []kafka2.Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]kafka2.Message(nil), w.msgs...)
+}
+
+func (w *fakeWriter) writeAttempts() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.attempts
+}
+
+func (w *fakeWriter) setErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.err = err
+}
+
+func newTestCache(t *testing.T) *cache.OrderCache {
+	t.Helper()
+	c, err := cache.NewWithOptions(cache.WithShards(4))
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+	return c
+}
+
+func newTestLogger() *log.Logger {
+	return log.New(io.Discard, "", 0)
+}
+
+// withDefaultTenant - обработчик h, запросы к которому относятся к tenant.Default, как в развёртывании без секции tenants
+func withDefaultTenant(h http.Handler) http.HandlerFunc {
+	return newTenantResolver(&config.Config{}).withTenant(h).ServeHTTP
+}
+
+// newTestCursorSigner - подпись курсоров GET /orders с постоянным секретом
+func newTestCursorSigner(t *testing.T) *pagination.Signer {
+	t.Helper()
+	signer, err := pagination.NewSigner([]byte("test-cursor-secret"), time.Hour)
+	require.NoError(t, err)
+	return signer
+}
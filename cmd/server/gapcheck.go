@@ -0,0 +1,278 @@
+// Описание: Проверка разрыва между смещениями группы консьюмера и базой данных при запуске (pipeline.startup_gap_check).
+// После восстановления базы из резервной копии группа могла уже закоммитить сообщения, заказов которых в базе нет:
+// консьюмер их больше не прочитает. Последние сообщения перед закоммиченным смещением каждой партиции читаются
+// без группы, и их заказы ищутся в базе; отсутствующие заказы пишутся в лог и в GET /admin/consumer/status,
+// а с auto_replay сообщения партиции от первого отсутствующего заказа повторяются так же, как флагом -replay
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/validation"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/kafka"
+	"l0_test_self/pkg/codec"
+
+	kafka2 "github.com/segmentio/kafka-go"
+)
+
+// gapReplayReader - имя читателя повтора разрыва в таблице checkpoints
+const gapReplayReader = "startup-gap"
+
+// gapSource - границы партиций, смещения группы и читатели партиций топиков без группы
+type gapSource interface {
+	PartitionOffsets(ctx context.Context, topic string) (map[int]kafka.PartitionOffsets, error)
+	GroupOffsets(ctx context.Context, topic string, partitions []int) (map[int]int64, error)
+	Open(topic string, partition int, offset int64) (MessageReader, error)
+}
+
+// kafkaGapSource - gapSource поверх брокеров Kafka из конфигурации
+type kafkaGapSource struct {
+	cfg kafka.Config
+}
+
+func (s kafkaGapSource) topicConfig(topic string) kafka.Config {
+	cfg := s.cfg
+	cfg.Topic = topic
+	return cfg
+}
+
+func (s kafkaGapSource) PartitionOffsets(ctx context.Context, topic string) (map[int]kafka.PartitionOffsets, error) {
+	return kafka.ListPartitionOffsets(ctx, s.topicConfig(topic))
+}
+
+func (s kafkaGapSource) GroupOffsets(ctx context.Context, topic string, partitions []int) (map[int]int64, error) {
+	return kafka.GroupOffsets(ctx, s.topicConfig(topic), partitions)
+}
+
+func (s kafkaGapSource) Open(topic string, partition int, offset int64) (MessageReader, error) {
+	reader, err := kafka.NewPartitionReader(s.topicConfig(topic), partition, offset)
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// gapPartition - партиция в отчёте проверки разрыва
+type gapPartition struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Committed int64  `json:"committed"`  // смещение, закоммиченное группой; -1 — группа в партиции ничего не коммитила
+	HighWater int64  `json:"high_water"` // смещение, которое получит следующее сообщение
+	Lag       int64  `json:"lag"`
+	Scanned   int    `json:"scanned"` // проверено сообщений перед закоммиченным смещением
+}
+
+// gapOrder - заказ закоммиченного группой сообщения, которого нет в базе данных
+type gapOrder struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+	OrderUID  string `json:"order_uid"`
+}
+
+// startupGapReport - результат проверки разрыва при запуске в ответе GET /admin/consumer/status
+type startupGapReport struct {
+	CheckedAt  time.Time      `json:"checked_at"`
+	Partitions []gapPartition `json:"partitions"`
+	Missing    []gapOrder     `json:"missing"`
+	// Replayed - число повторённых сообщений (auto_replay); повтор обрабатывает и сообщения с уже сохранёнными заказами
+	Replayed int64  `json:"replayed"`
+	Error    string `json:"error,omitempty"` // проверка или повтор не завершены; запуск при этом продолжается
+}
+
+// messageOrderUID - идентификатор заказа из сообщения msg в том виде, в котором его сохранил бы консьюмер; false —
+// консьюмер пропустил бы сообщение: оно не декодируется или заказ не проходит валидацию
+func messageOrderUID(msg kafka2.Message, fallback codec.Codec) (string, bool) {
+	format, err := codec.ForMessage(msg.Headers, fallback)
+	if err != nil {
+		return "", false
+	}
+	data, err := upgradeMessageSchema(format, msg)
+	if err != nil {
+		return "", false
+	}
+	var order orders.Order
+	if err := format.Decode(data, &order); err != nil {
+		return "", false
+	}
+	if err := validation.ValidateOrder(&order); err != nil {
+		return "", false
+	}
+	return order.OrderUid, true
+}
+
+// scanGap - читает сообщения партиции [from, until) читателем reader и возвращает заказы, которых нет в базе данных
+// у арендатора tenantID (каждый заказ один раз, с первым смещением), и число прочитанных сообщений
+func scanGap(ctx context.Context, reader MessageReader, repo OrderRepository, tenantID string, format codec.Codec,
+	topic string, partition int, from, until int64) ([]gapOrder, int, error) {
+	var missing []gapOrder
+	seen := make(map[string]bool)
+	scanned := 0
+	for offset := from; offset < until; {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			return nil, scanned, fmt.Errorf("read partition %d of %s at offset %d: %w", partition, topic, offset, err)
+		}
+		offset = msg.Offset + 1
+		if msg.Offset >= until {
+			break
+		}
+		scanned++
+		uid, ok := messageOrderUID(msg, format)
+		if !ok || seen[uid] {
+			continue
+		}
+		seen[uid] = true
+		exists, err := repo.ExistsOrder(ctx, tenantID, uid)
+		if err != nil {
+			return nil, scanned, err
+		}
+		if !exists {
+			missing = append(missing, gapOrder{Topic: topic, Partition: partition, Offset: msg.Offset, OrderUID: uid})
+		}
+	}
+	return missing, scanned, nil
+}
+
+// checkTopicGap - проверяет последние sample сообщений перед смещением группы в каждой партиции топика topic
+// арендатора tenantID. Возвращает состояние партиций и отсутствующие в базе заказы.
+func checkTopicGap(ctx context.Context, src gapSource, repo OrderRepository, tenantID, topic string, sample int,
+	format codec.Codec) ([]gapPartition, []gapOrder, error) {
+	offsets, err := src.PartitionOffsets(ctx, topic)
+	if err != nil {
+		return nil, nil, err
+	}
+	partitionIDs := make([]int, 0, len(offsets))
+	for partition := range offsets {
+		partitionIDs = append(partitionIDs, partition)
+	}
+	slices.Sort(partitionIDs)
+	committed, err := src.GroupOffsets(ctx, topic, partitionIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		partitions []gapPartition
+		missing    []gapOrder
+	)
+	for _, partition := range partitionIDs {
+		po := offsets[partition]
+		state := gapPartition{Topic: topic, Partition: partition, Committed: -1, HighWater: po.Last, Lag: po.Last - po.First}
+		next, ok := committed[partition]
+		if ok {
+			state.Committed = next
+			state.Lag = max(po.Last-max(next, po.First), 0)
+		}
+		from := max(next-int64(sample), po.First)
+		if ok && from < next {
+			reader, err := src.Open(topic, partition, from)
+			if err != nil {
+				return nil, nil, err
+			}
+			found, scanned, err := scanGap(ctx, reader, repo, tenantID, format, topic, partition, from, next)
+			reader.Close()
+			if err != nil {
+				return nil, nil, err
+			}
+			state.Scanned = scanned
+			missing = append(missing, found...)
+		}
+		partitions = append(partitions, state)
+	}
+	return partitions, missing, nil
+}
+
+// planGapReplay - диапазоны повтора топика topic: в каждой партиции с отсутствующими заказами — от первого такого
+// сообщения до смещения группы
+func planGapReplay(topic string, partitions []gapPartition, missing []gapOrder) []replayRange {
+	var ranges []replayRange
+	for _, p := range partitions {
+		if p.Topic != topic {
+			continue
+		}
+		from := int64(-1)
+		for _, m := range missing {
+			if m.Topic == topic && m.Partition == p.Partition && (from < 0 || m.Offset < from) {
+				from = m.Offset
+			}
+		}
+		if from >= 0 {
+			ranges = append(ranges, replayRange{Partition: p.Partition, From: from, Until: p.Committed})
+		}
+	}
+	return ranges
+}
+
+// checkStartupGap - проверяет разрыв между смещениями группы и базой данных во всех топиках заказов консьюмера
+// (топики арендаторов или kafka.topic) и, с auto_replay, повторяет найденный разрыв. Ошибки не прерывают запуск:
+// они записываются в лог и в отчёт.
+func checkStartupGap(ctx context.Context, cfg *config.Config, src gapSource, dlq MessageWriter, repo OrderRepository,
+	logger *log.Logger) *startupGapReport {
+	gapCfg := cfg.Pipeline.StartupGapCheck
+	report := &startupGapReport{CheckedAt: time.Now(), Partitions: []gapPartition{}, Missing: []gapOrder{}}
+	format, err := codec.ByName(cfg.Kafka.Consumer.Format)
+	if err != nil {
+		format = codec.JSON
+	}
+	topics := cfg.TenantTopics()
+	names := make([]string, 0, len(topics))
+	for topic := range topics {
+		names = append(names, topic)
+	}
+	slices.Sort(names)
+
+	checkCtx, cancel := context.WithTimeout(ctx, gapCfg.CheckTimeout())
+	defer cancel()
+	for _, topic := range names {
+		partitions, missing, err := checkTopicGap(checkCtx, src, repo, topics[topic], topic, gapCfg.SampleSize(), format)
+		if err != nil {
+			report.Error = fmt.Sprintf("check topic %s: %v", topic, err)
+			logger.Printf("startup gap check: %s", report.Error)
+			return report
+		}
+		report.Partitions = append(report.Partitions, partitions...)
+		report.Missing = append(report.Missing, missing...)
+	}
+	if len(report.Missing) == 0 {
+		logger.Printf("startup gap check: orders of the last %d committed messages per partition are in the database", gapCfg.SampleSize())
+		return report
+	}
+	for _, m := range report.Missing {
+		logger.Printf("startup gap check: order %s of committed message %s/%d@%d is missing in the database", m.OrderUID, m.Topic, m.Partition, m.Offset)
+	}
+	if !gapCfg.AutoReplay {
+		logger.Printf("startup gap check: %d orders missing, replay the topic with -replay or enable pipeline.startup_gap_check.auto_replay", len(report.Missing))
+		return report
+	}
+
+	for _, topic := range names {
+		ranges := planGapReplay(topic, report.Partitions, report.Missing)
+		if len(ranges) == 0 {
+			continue
+		}
+		topicCfg := *cfg
+		topicCfg.Kafka.Topic = topic
+		open := func(partition int, offset int64) (MessageReader, error) { return src.Open(topic, partition, offset) }
+		err := runReplay(ctx, gapReplayReader, ranges, open, dlq, repo, logger, &topicCfg, orders.SourceReplay)
+		if err == nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			report.Error = fmt.Sprintf("replay topic %s: %v", topic, err)
+			logger.Printf("startup gap check: %s", report.Error)
+			return report
+		}
+		for _, r := range ranges {
+			report.Replayed += r.Until - r.From
+		}
+	}
+	logger.Printf("startup gap check: %d orders missing, replayed %d messages", len(report.Missing), report.Replayed)
+	return report
+}
@@ -0,0 +1,154 @@
+// Описание: Тесты проверки разрыва при запуске: после восстановления базы из резервной копии заказы последних
+// закоммиченных сообщений не найдены в базе, попадают в отчёт GET /admin/consumer/status и повторяются с auto_replay
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/kafka"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGapSource - топик orders с сообщениями msgs по партициям и смещениями группы committed
+type fakeGapSource struct {
+	msgs      map[int][]kafka2.Message
+	committed map[int]int64
+}
+
+func (s *fakeGapSource) PartitionOffsets(context.Context, string) (map[int]kafka.PartitionOffsets, error) {
+	offsets := make(map[int]kafka.PartitionOffsets, len(s.msgs))
+	for partition, msgs := range s.msgs {
+		offsets[partition] = kafka.PartitionOffsets{First: 0, Last: int64(len(msgs))}
+	}
+	return offsets, nil
+}
+
+func (s *fakeGapSource) GroupOffsets(context.Context, string, []int) (map[int]int64, error) {
+	return s.committed, nil
+}
+
+func (s *fakeGapSource) Open(topic string, partition int, offset int64) (MessageReader, error) {
+	msgs, ok := s.msgs[partition]
+	if topic != "orders" || !ok {
+		return nil, errors.New("unexpected partition")
+	}
+	return stoppingReader{&sliceReader{msgs: msgs[offset:]}}, nil
+}
+
+// newGapTestSource - две партиции по 10 сообщений, полностью закоммиченные группой, и база, восстановленная
+// из резервной копии: в ней нет заказов последних lost сообщений партиции 1
+func newGapTestSource(t *testing.T, lost int) (*fakeGapSource, *fakeRepository, []string) {
+	t.Helper()
+	src := &fakeGapSource{msgs: map[int][]kafka2.Message{}, committed: map[int]int64{0: 10, 1: 10}}
+	repo := &fakeRepository{orders: map[string]orders.Order{}}
+	var missing []string
+	for partition := range 2 {
+		msgs, uids := newOrderMessages(t, int64(50+partition), 10)
+		for i := range msgs {
+			msgs[i].Partition = partition
+			if partition == 1 && i >= len(msgs)-lost {
+				missing = append(missing, uids[int64(i)])
+				continue
+			}
+			var o orders.Order
+			require.NoError(t, json.Unmarshal(msgs[i].Value, &o))
+			repo.orders[o.OrderUid] = o
+		}
+		src.msgs[partition] = msgs
+	}
+	return src, repo, missing
+}
+
+// newGapTestConfig - конфигурация проверки разрыва последних sample сообщений партиции
+func newGapTestConfig(sample int, autoReplay bool) *config.Config {
+	cfg := newReplayTestConfig(100)
+	cfg.Pipeline.StartupGapCheck = config.StartupGapCheckConfig{Enabled: true, Sample: sample, AutoReplay: autoReplay, Timeout: time.Second}
+	return cfg
+}
+
+func TestStartupGapCheckDetectsRestoredBackup(t *testing.T) {
+	src, repo, missing := newGapTestSource(t, 4)
+	src.committed[0] = 8 // у партиции 0 остались непрочитанные сообщения
+
+	report := checkStartupGap(context.Background(), newGapTestConfig(5, false), src, nil, repo, newTestLogger())
+	require.Empty(t, report.Error)
+	assert.Equal(t, []gapPartition{
+		{Topic: "orders", Partition: 0, Committed: 8, HighWater: 10, Lag: 2, Scanned: 5},
+		{Topic: "orders", Partition: 1, Committed: 10, HighWater: 10, Lag: 0, Scanned: 5},
+	}, report.Partitions)
+	uids := make([]string, len(report.Missing))
+	for i, m := range report.Missing {
+		uids[i] = m.OrderUID
+		assert.Equal(t, int64(6+i), m.Offset)
+	}
+	assert.Equal(t, missing, uids)
+	assert.Zero(t, report.Replayed)
+	inserts, stored := repo.stats()
+	assert.Zero(t, inserts, "without auto_replay the gap is only reported")
+	assert.Equal(t, 16, stored)
+
+	// Отчёт доступен в GET /admin/consumer/status
+	rec := httptest.NewRecorder()
+	makeConsumerStatusHandler("", newTestReadBreaker(time.Minute), nil, nil, nil, report, newTestLogger()).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/consumer/status", nil))
+	var resp consumerStatusResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.NotNil(t, resp.StartupGap)
+	assert.Len(t, resp.StartupGap.Missing, 4)
+}
+
+func TestStartupGapCheckSampleWindow(t *testing.T) {
+	src, repo, _ := newGapTestSource(t, 4)
+
+	// Разрыв глубже окна проверки не виден, а в партиции без коммитов группы проверять нечего
+	delete(src.committed, 0)
+	report := checkStartupGap(context.Background(), newGapTestConfig(2, false), src, nil, repo, newTestLogger())
+	require.Empty(t, report.Error)
+	assert.Equal(t, int64(-1), report.Partitions[0].Committed)
+	assert.Zero(t, report.Partitions[0].Scanned)
+	assert.Len(t, report.Missing, 2)
+}
+
+func TestStartupGapCheckAutoReplay(t *testing.T) {
+	src, repo, missing := newGapTestSource(t, 3)
+
+	report := checkStartupGap(context.Background(), newGapTestConfig(5, true), src, nil, repo, newTestLogger())
+	require.Empty(t, report.Error)
+	assert.Len(t, report.Missing, 3)
+	assert.Equal(t, int64(3), report.Replayed, "partition 1 is replayed from the first missing order")
+
+	inserts, stored := repo.stats()
+	assert.Equal(t, 3, inserts)
+	assert.Equal(t, 20, stored)
+	for _, uid := range missing {
+		exists, err := repo.ExistsOrder(context.Background(), tenant.Default, uid)
+		require.NoError(t, err)
+		assert.True(t, exists, uid)
+	}
+
+	// Повторная проверка разрыва не находит
+	report = checkStartupGap(context.Background(), newGapTestConfig(5, true), src, nil, repo, newTestLogger())
+	assert.Empty(t, report.Missing)
+	assert.Zero(t, report.Replayed)
+}
+
+func TestStartupGapCheckReportsErrors(t *testing.T) {
+	src, repo, _ := newGapTestSource(t, 1)
+	repo.err = errors.New("connection refused")
+
+	report := checkStartupGap(context.Background(), newGapTestConfig(5, true), src, nil, repo, newTestLogger())
+	assert.Contains(t, report.Error, "connection refused")
+	assert.Empty(t, report.Missing)
+}
@@ -0,0 +1,65 @@
+// Описание: Отчёт о неполных заказах GET /admin/orders/incomplete: заказы арендатора без товаров, доставки или платежей,
+// постранично в порядке идентификаторов
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"l0_test_self/pkg/client/postgres"
+)
+
+const (
+	// defaultIncompleteLimit и maxIncompleteLimit - размер страницы отчёта о неполных заказах по умолчанию и наибольший
+	defaultIncompleteLimit = 100
+	maxIncompleteLimit     = 1000
+)
+
+// incompleteOrdersResponse - ответ эндпоинта отчёта о неполных заказах
+type incompleteOrdersResponse struct {
+	Orders    []postgres.IncompleteOrder `json:"orders"`
+	NextAfter string                     `json:"next_after,omitempty"` // значение параметра after следующей страницы; пусто на последней
+}
+
+// makeIncompleteOrdersHandler - HTTP обработчик, возвращающий до limit заказов арендатора запроса без товаров,
+// доставки или платежей, идентификаторы которых следуют за параметром after
+func makeIncompleteOrdersHandler(repo OrderRepository, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		limit := defaultIncompleteLimit
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 || n > maxIncompleteLimit {
+				writeAPIError(w, r, http.StatusBadRequest, errCodeLimitInvalid, maxIncompleteLimit)
+				return
+			}
+			limit = n
+		}
+		after := r.URL.Query().Get("after")
+
+		// Лишняя запись показывает, есть ли следующая страница
+		list, err := repo.ListIncompleteOrders(r.Context(), tenantFromContext(r.Context()), after, limit+1)
+		if err != nil {
+			logger.Printf("[%s] incomplete orders: db error: %v", reqID, err)
+			if !writeUnavailable(w, r, err) {
+				writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			}
+			return
+		}
+		resp := incompleteOrdersResponse{Orders: list}
+		if len(list) > limit {
+			resp.Orders = list[:limit]
+			resp.NextAfter = list[limit-1].OrderUid
+		}
+		if resp.Orders == nil {
+			resp.Orders = []postgres.IncompleteOrder{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+		}
+	}
+}
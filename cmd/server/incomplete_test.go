@@ -0,0 +1,119 @@
+// Описание: Тесты заказов без товаров и отчёта GET /admin/orders/incomplete: заказ с пустым списком товаров
+// отдаётся с "items": [] и признаком items_missing, а отчёт постранично перечисляет неполные заказы
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedIncompleteOrders - заполняет repo полным заказом и заказами без товаров, доставки и платежей;
+// возвращает ожидаемые записи отчёта в порядке идентификаторов
+func seedIncompleteOrders(repo *fakeRepository) []postgres.IncompleteOrder {
+	gen := testorders.NewGenerator(193)
+	complete := gen.Order(testorders.ScenarioDefault)
+	noItems := gen.Order(testorders.ScenarioDefault)
+	noItems.Items = []orders.Item{}
+	noDelivery := gen.Order(testorders.ScenarioDefault)
+	noDelivery.Delivery = orders.Delivery{}
+	bare := gen.Order(testorders.ScenarioDefault)
+	bare.Items, bare.Payments, bare.Delivery = nil, nil, orders.Delivery{}
+
+	repo.orders = map[string]orders.Order{}
+	for _, o := range []orders.Order{complete, noItems, noDelivery, bare} {
+		repo.orders[o.OrderUid] = o
+	}
+	want := []postgres.IncompleteOrder{
+		{OrderUid: noItems.OrderUid, ItemsMissing: true},
+		{OrderUid: noDelivery.OrderUid, DeliveryMissing: true},
+		{OrderUid: bare.OrderUid, ItemsMissing: true, DeliveryMissing: true, PaymentMissing: true},
+	}
+	sort.Slice(want, func(i, j int) bool { return want[i].OrderUid < want[j].OrderUid })
+	return want
+}
+
+func getIncompleteOrders(t *testing.T, h http.Handler, target string) (*httptest.ResponseRecorder, incompleteOrdersResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	var resp incompleteOrdersResponse
+	if rec.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	}
+	return rec, resp
+}
+
+func TestOrderWithoutItemsResponse(t *testing.T) {
+	repo := &fakeRepository{}
+	c := newTestCache(t)
+	order := testorders.NewGenerator(193).Order(testorders.ScenarioDefault)
+	order.Items = []orders.Item{}
+	body, err := json.Marshal(order)
+	require.NoError(t, err)
+	create := withDefaultTenant(makeOrderCreateHandler(repo, c, config.IdempotencyConfig{}, clock.Real, newTestLogger()))
+	require.Equal(t, http.StatusCreated, postOrder(create, "", body).Code)
+
+	stored, err := repo.GetOrderByUID(context.Background(), tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+	assert.True(t, stored.ItemsMissing)
+
+	// Из кэша и из базы данных заказ отдаётся одинаково: с пустым списком товаров и признаком items_missing
+	for name, orderCache := range map[string]OrderCache{"cache": c, "db": newTestCache(t)} {
+		rec := getOrder(t, withDefaultTenant(makeOrderHandler(orderCache, repo, piiPolicy{}, nil, newTestLogger())), order.OrderUid)
+		require.Equal(t, http.StatusOK, rec.Code, name)
+		var fields map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &fields), name)
+		assert.JSONEq(t, `[]`, string(fields["items"]), name)
+		assert.JSONEq(t, `true`, string(fields["items_missing"]), name)
+	}
+}
+
+func TestIncompleteOrdersReport(t *testing.T) {
+	repo := &fakeRepository{}
+	want := seedIncompleteOrders(repo)
+	h := withDefaultTenant(makeIncompleteOrdersHandler(repo, newTestLogger()))
+
+	rec, resp := getIncompleteOrders(t, h, "/admin/orders/incomplete")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, want, resp.Orders)
+	assert.Empty(t, resp.NextAfter)
+
+	// Постраничное чтение по next_after
+	_, first := getIncompleteOrders(t, h, "/admin/orders/incomplete?limit=2")
+	assert.Equal(t, want[:2], first.Orders)
+	require.Equal(t, want[1].OrderUid, first.NextAfter)
+	_, second := getIncompleteOrders(t, h, "/admin/orders/incomplete?limit=2&after="+first.NextAfter)
+	assert.Equal(t, want[2:], second.Orders)
+	assert.Empty(t, second.NextAfter)
+
+	_, empty := getIncompleteOrders(t, h, "/admin/orders/incomplete?after="+want[2].OrderUid)
+	assert.NotNil(t, empty.Orders, "an empty report is an empty array")
+	assert.Empty(t, empty.Orders)
+
+	for _, limit := range []string{"0", "-1", "x", "1001"} {
+		rec, _ := getIncompleteOrders(t, h, "/admin/orders/incomplete?limit="+limit)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, limit)
+	}
+}
+
+func TestIncompleteOrdersReportDBError(t *testing.T) {
+	h := withDefaultTenant(makeIncompleteOrdersHandler(&fakeRepository{err: errors.New("connection refused")}, newTestLogger()))
+	rec, _ := getIncompleteOrders(t, h, "/admin/orders/incomplete")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
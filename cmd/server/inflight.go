@@ -0,0 +1,124 @@
+// Описание: Учёт запросов, выполняющихся в данный момент, по маршрутам HTTP сервера и отчёт об их завершении
+// при остановке сервера
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// drainReportInterval - период записи в лог числа запросов, которые HTTP сервер ещё завершает при остановке
+const drainReportInterval = time.Second
+
+// inflightRoute - счётчик выполняющихся запросов одного маршрута
+type inflightRoute struct {
+	pattern string
+	n       atomic.Int64
+}
+
+// inflightRequests - таблица счётчиков выполняющихся запросов по маршрутам. Маршруты добавляются track при построении
+// обработчика до запуска сервера, после чего таблица только читается, а запрос лишь меняет атомарный счётчик своего
+// маршрута без выделения памяти.
+type inflightRequests struct {
+	routes []*inflightRoute
+}
+
+// track - оборачивает обработчик маршрута pattern учётом выполняющихся запросов
+func (t *inflightRequests) track(pattern string, next http.Handler) http.Handler {
+	route := &inflightRoute{pattern: pattern}
+	t.routes = append(t.routes, route)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route.n.Add(1)
+		defer route.n.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// total - число выполняющихся запросов всех маршрутов
+func (t *inflightRequests) total() int64 {
+	var n int64
+	for _, route := range t.routes {
+		n += route.n.Load()
+	}
+	return n
+}
+
+// snapshot - число выполняющихся запросов каждого маршрута, включая маршруты без запросов
+func (t *inflightRequests) snapshot() map[string]int64 {
+	counts := make(map[string]int64, len(t.routes))
+	for _, route := range t.routes {
+		counts[route.pattern] = route.n.Load()
+	}
+	return counts
+}
+
+// busy - маршруты с выполняющимися запросами в виде "GET /order: 2, POST /orders: 1", отсортированные по маршруту
+func (t *inflightRequests) busy() string {
+	var parts []string
+	for pattern, n := range t.snapshot() {
+		if n > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d", pattern, n))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// reportDrain - пока HTTP сервер завершает запросы при остановке, раз в drainReportInterval пишет в лог число ещё
+// выполняющихся запросов и время, оставшееся до дедлайна ctx. Возвращается, когда запросов не осталось,
+// наступил дедлайн или закрыт done.
+func (t *inflightRequests) reportDrain(ctx context.Context, done <-chan struct{}, logger *log.Logger) {
+	n := t.total()
+	if n == 0 {
+		return
+	}
+	logger.Printf("http shutdown: waiting for %d in-flight requests (%s)", n, t.busy())
+	ticker := time.NewTicker(drainReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n = t.total()
+		if n == 0 {
+			logger.Println("http shutdown: all in-flight requests finished")
+			return
+		}
+		left := "no deadline"
+		if deadline, ok := ctx.Deadline(); ok {
+			left = time.Until(deadline).Round(100*time.Millisecond).String() + " until deadline"
+		}
+		logger.Printf("http shutdown: %d requests still in flight, %s", n, left)
+	}
+}
+
+// inflightResponse - ответ GET /admin/requests
+type inflightResponse struct {
+	Total  int64            `json:"total"`  // выполняющихся запросов всех маршрутов, включая этот
+	Routes map[string]int64 `json:"routes"` // выполняющихся запросов по маршрутам
+}
+
+// makeInflightHandler - HTTP обработчик, возвращающий число выполняющихся запросов по маршрутам
+func makeInflightHandler(t *inflightRequests, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := inflightResponse{Routes: t.snapshot()}
+		for _, n := range resp.Routes {
+			resp.Total += n
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", requestIDFromContext(r.Context()), err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Описание: Тесты учёта выполняющихся запросов по маршрутам: счётчики в /admin/requests и метриках, отчёт об остановке
+// HTTP сервера, дожидающейся запросов, и закрытие соединений незавершённых к дедлайну запросов
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer - буфер лога, который можно читать, пока в него пишут обработчики
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newBlockingReadRepository - репозиторий, чтение заказа из которого ждёт закрытия release; started закрывается
+// при начале первого чтения
+func newBlockingReadRepository(t *testing.T) (repo *fakeRepository, started, release chan struct{}) {
+	started, release = make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	t.Cleanup(func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	})
+	repo = &fakeRepository{
+		orders: map[string]orders.Order{"order-1": {OrderUid: "order-1"}},
+		onRead: func() {
+			once.Do(func() { close(started) })
+			<-release
+		},
+	}
+	return repo, started, release
+}
+
+func TestInflightRequestsByRoute(t *testing.T) {
+	repo, started, release := newBlockingReadRepository(t)
+	cfg := newConsumerTestConfig()
+	cfg.Admin.APIKey = testAdminKey
+	app := &App{mode: modeAPI, cfg: cfg, logger: newTestLogger(), repo: repo, cache: newTestCache(t)}
+	h := app.handler()
+
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/order?id=order-1", nil))
+		done <- rec.Code
+	}()
+	<-started
+
+	var got inflightResponse
+	require.NoError(t, json.Unmarshal(getWithKey(t, h, "/admin/requests", testAdminKey).Body.Bytes(), &got))
+	assert.Equal(t, int64(2), got.Total, "the held order request and this one")
+	assert.Equal(t, int64(1), got.Routes["/order"])
+	assert.Equal(t, int64(1), got.Routes["GET /admin/requests"])
+	assert.Equal(t, int64(0), got.Routes["GET /orders"])
+
+	metrics := getWithKey(t, h, "/admin/metrics", testAdminKey).Body.String()
+	assert.Contains(t, metrics, `http_requests_in_flight{route="/order"} 1`+"\n")
+	assert.Contains(t, metrics, `http_requests_in_flight{route="GET /healthz"} 0`+"\n")
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Zero(t, app.inflight.total())
+}
+
+func TestInflightTrackDoesNotAllocate(t *testing.T) {
+	var inflight inflightRequests
+	h := inflight.track("GET /healthz", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	assert.Zero(t, testing.AllocsPerRun(100, func() { h.ServeHTTP(nil, req) }))
+}
+
+func TestAppShutdownReportsDrain(t *testing.T) {
+	// startShutdown - запускает приложение, удерживает запрос к /order и начинает остановку
+	startShutdown := func(t *testing.T, timeout time.Duration) (logs *syncBuffer, release chan struct{}, stopped chan error, resp chan error) {
+		repo, started, release := newBlockingReadRepository(t)
+		cfg := newConsumerTestConfig()
+		cfg.Server.ShutdownTimeout = timeout
+		logs = &syncBuffer{}
+		app := &App{mode: modeAPI, cfg: cfg, logger: log.New(logs, "", 0), repo: repo, cache: newTestCache(t)}
+		url, stop := startTestApp(t, app)
+
+		resp = make(chan error, 1)
+		go func() {
+			r, err := http.Get(url + "/order?id=order-1")
+			if err == nil {
+				r.Body.Close()
+			}
+			resp <- err
+		}()
+		<-started
+
+		stopped = make(chan error, 1)
+		go func() { stopped <- stop() }()
+		return logs, release, stopped, resp
+	}
+
+	t.Run("drained", func(t *testing.T) {
+		logs, release, stopped, resp := startShutdown(t, 3*time.Second)
+		require.Eventually(t, func() bool {
+			return strings.Contains(logs.String(), "http shutdown: 1 requests still in flight")
+		}, 2*time.Second, 10*time.Millisecond, "the countdown is logged every second")
+		close(release)
+
+		require.NoError(t, <-stopped)
+		require.NoError(t, <-resp, "the request finishes before the server stops")
+		out := logs.String()
+		assert.Contains(t, out, "http shutdown: waiting for 1 in-flight requests (/order: 1)")
+		assert.Contains(t, out, "until deadline")
+		assert.Contains(t, out, "http server stopped gracefully")
+		assert.NotContains(t, out, "deadline reached")
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		logs, _, stopped, resp := startShutdown(t, 1500*time.Millisecond)
+
+		require.NoError(t, <-stopped)
+		assert.Error(t, <-resp, "the connection of the unfinished request is closed")
+		out := logs.String()
+		assert.Contains(t, out, "http shutdown: 1 requests still in flight")
+		assert.Contains(t, out, "http shutdown: deadline reached with 1 requests in flight (/order: 1), closing connections")
+		assert.NotContains(t, out, "stopped gracefully")
+	})
+}
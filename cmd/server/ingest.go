@@ -0,0 +1,227 @@
+// Описание: Приём заказов по HTTP (POST /orders) с поддержкой ключей идемпотентности для безопасных повторов клиентов
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/validation"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLen      = 255
+
+	defaultIdempotencyTTL         = 24 * time.Hour
+	defaultIdempotencyWaitTimeout = 5 * time.Second
+	idempotencyPollInterval       = 50 * time.Millisecond
+
+	// maxOrderBodyBytes - максимальный размер тела запроса создания заказа
+	maxOrderBodyBytes = 1 << 20
+)
+
+// errIdempotencyInProgress - исходный запрос с тем же ключом не завершился за время ожидания
+var errIdempotencyInProgress = errors.New("request with this idempotency key is still in progress")
+
+// orderCreatedResponse - ответ на успешное создание заказа
+type orderCreatedResponse struct {
+	OrderUid string `json:"order_uid"`
+}
+
+// makeOrderCreateHandler - HTTP обработчик, сохраняющий заказ из тела запроса в базу данных и кэш. Заказ может быть
+// в любой известной версии схемы (параметр schema_version, заголовок Schema-Version или поле тела schema_version).
+// С заголовком Idempotency-Key результат первого запроса (код и тело ответа) сохраняется, и повторы с тем же ключом
+// в течение cfg.TTL получают его без повторной обработки; повтор с другим телом получает 409. Конкурентный повтор
+// ждёт завершения исходного запроса до cfg.WaitTimeout. Результат с кодом 5xx не сохраняется, чтобы повтор мог выполниться.
+// Версия заказа в кэше берётся из clk, как у консьюмера.
+func makeOrderCreateHandler(repo OrderRepository, orderCache OrderCache, cfg config.IdempotencyConfig, clk clock.Clock, logger *log.Logger) http.HandlerFunc {
+	ttl := idempotencyTTL(cfg)
+	waitTimeout := cfg.WaitTimeout
+	if waitTimeout <= 0 {
+		waitTimeout = defaultIdempotencyWaitTimeout
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxOrderBodyBytes))
+		if err != nil {
+			writeAPIError(w, r, http.StatusRequestEntityTooLarge, errCodeRequestTooLarge)
+			return
+		}
+		// Тело переводится в текущую версию схемы до ключа идемпотентности: повтор в другой версии — тот же запрос
+		if body, err = upgradeRequestSchema(r, body); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeSchemaVersionInvalid, err)
+			return
+		}
+
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			_, status, resp := createOrder(r, repo, orderCache, clk, body, reqID, logger)
+			writeOrderCreateResponse(w, status, resp)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen || !isPrintableASCII(key) {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeIdempotencyKeyInvalid)
+			return
+		}
+
+		hash := bodyHash(body)
+		rec, reserved, err := reserveIdempotencyKey(r.Context(), repo, tenantFromContext(r.Context()), key, hash, ttl, waitTimeout)
+		switch {
+		case errors.Is(err, errIdempotencyInProgress):
+			writeAPIError(w, r, http.StatusConflict, errCodeIdempotencyKeyInProgress)
+			return
+		case err != nil:
+			logger.Printf("[%s] create order: idempotency key error: %v", reqID, err)
+			writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			return
+		case !reserved && rec.RequestHash != hash:
+			writeAPIError(w, r, http.StatusConflict, errCodeIdempotencyKeyReused)
+			return
+		case !reserved:
+			logger.Printf("[%s] create order: replaying response for idempotency key (order=%s)", reqID, rec.OrderUid)
+			w.Header().Set(idempotencyReplayedHeader, "true")
+			writeOrderCreateResponse(w, rec.Status, rec.Response)
+			return
+		}
+
+		rec.OrderUid, rec.Status, rec.Response = createOrder(r, repo, orderCache, clk, body, reqID, logger)
+		// Сохранение результата не должно зависеть от отключения клиента: иначе ключ останется незавершённым до истечения TTL
+		storeCtx := context.WithoutCancel(r.Context())
+		if rec.Status >= http.StatusInternalServerError {
+			if err := repo.ReleaseIdempotencyKey(storeCtx, rec.Tenant, key); err != nil {
+				logger.Printf("[%s] create order: release idempotency key error: %v", reqID, err)
+			}
+		} else if err := repo.CompleteIdempotencyKey(storeCtx, rec); err != nil {
+			logger.Printf("[%s] create order: store idempotency result error: %v", reqID, err)
+		}
+		writeOrderCreateResponse(w, rec.Status, rec.Response)
+	}
+}
+
+// idempotencyTTL - срок хранения результатов запросов с ключом идемпотентности с учётом значения по умолчанию
+func idempotencyTTL(cfg config.IdempotencyConfig) time.Duration {
+	if cfg.TTL <= 0 {
+		return defaultIdempotencyTTL
+	}
+	return cfg.TTL
+}
+
+// reserveIdempotencyKey - резервирует ключ арендатора tenantID за запросом. Если ключ занят незавершённым запросом с тем же телом,
+// ждёт его завершения (или освобождения ключа) до waitTimeout и возвращает errIdempotencyInProgress по истечении.
+func reserveIdempotencyKey(ctx context.Context, repo OrderRepository, tenantID, key, hash string, ttl, waitTimeout time.Duration) (postgres.IdempotencyRecord, bool, error) {
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		rec, reserved, err := repo.ReserveIdempotencyKey(ctx, tenantID, key, hash, time.Now().Add(-ttl))
+		if err != nil || reserved || rec.Status != 0 || rec.RequestHash != hash {
+			return rec, reserved, err
+		}
+		if time.Now().After(deadline) {
+			return rec, false, errIdempotencyInProgress
+		}
+		select {
+		case <-ctx.Done():
+			return rec, false, ctx.Err()
+		case <-time.After(idempotencyPollInterval):
+		}
+	}
+}
+
+// checkOrder - декодирует заказ из тела запроса и валидирует его той же цепочкой, что и консьюмер: декодирование
+// в режиме pipeline.decode, затем ValidateOrder с правилами развёртывания, нормализацией идентификатора, трек-номеров
+// и валют и замечаниями проверок в режиме flag. Возвращает этап, на котором заказ отклонён (stageDecode или
+// stageValidate), и ошибку; при ошибке валидации возвращается и декодированный заказ.
+func checkOrder(body []byte) (orders.Order, string, error) {
+	var order orders.Order
+	if err := json.Unmarshal(body, &order); err != nil {
+		return orders.Order{}, stageDecode, err
+	}
+	if err := validation.ValidateOrder(&order); err != nil {
+		return order, stageValidate, err
+	}
+	return order, "", nil
+}
+
+// createOrder - декодирует, валидирует и сохраняет заказ из тела запроса r. Возвращает идентификатор заказа (если он
+// известен), код и тело ответа, чтобы их можно было сохранить для повторов с тем же ключом идемпотентности. Тело ответа
+// с ошибкой - JSON ошибки API на языке запроса r. Версия заказа в кэше - время clk на момент фиксации.
+func createOrder(r *http.Request, repo OrderRepository, orderCache OrderCache, clk clock.Clock, body []byte, reqID string, logger *log.Logger) (string, int, []byte) {
+	ctx := r.Context()
+	order, stage, err := checkOrder(body)
+	if stage == stageDecode {
+		// Ошибки режима pipeline.decode указывают пути полей, которые нужно исправить
+		var decodeErr *orders.DecodeError
+		if errors.As(err, &decodeErr) {
+			fields := make([]string, len(decodeErr.Fields))
+			for i, fe := range decodeErr.Fields {
+				fields[i] = fe.Error()
+			}
+			_, resp := apiErrorBody(r, errCodeOrderDecodeFailed, strings.Join(fields, "; "))
+			return "", http.StatusBadRequest, resp
+		}
+		_, resp := apiErrorBody(r, errCodeOrderJSONInvalid)
+		return "", http.StatusBadRequest, resp
+	}
+	if err != nil {
+		_, resp := apiErrorBody(r, errCodeOrderInvalid, err)
+		return order.OrderUid, http.StatusBadRequest, resp
+	}
+
+	order.Source, order.SourceDetail = orders.SourceHTTP, reqID
+	// Заказ попадает в кэш только после фиксации транзакции; версия — этот момент, как при записи консьюмером
+	onCommit := func() { orderCache.SetIfNewer(tenantFromContext(ctx), order, clk.Now().UnixNano()) }
+	if err := repo.InsertOrder(ctx, tenantFromContext(ctx), &order, nil, onCommit); err != nil {
+		if errors.Is(err, postgres.ErrOrderExists) {
+			_, resp := apiErrorBody(r, errCodeOrderExists)
+			return order.OrderUid, http.StatusConflict, resp
+		}
+		logger.Printf("[%s] create order: db insert error (order=%s): %v", reqID, order.OrderUid, err)
+		_, resp := apiErrorBody(r, errCodeInternal)
+		return order.OrderUid, http.StatusInternalServerError, resp
+	}
+	logger.Printf("[%s] create order: order %s stored", reqID, order.OrderUid)
+
+	resp, _ := json.Marshal(orderCreatedResponse{OrderUid: order.OrderUid})
+	return order.OrderUid, http.StatusCreated, resp
+}
+
+// writeOrderCreateResponse - пишет ответ создания заказа: JSON созданного заказа при успехе, иначе JSON ошибки API,
+// как writeAPIError
+func writeOrderCreateResponse(w http.ResponseWriter, status int, body []byte) {
+	if status == http.StatusCreated {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// bodyHash - хэш тела запроса, по которому повтор с тем же ключом идемпотентности отличается от другого запроса
+func bodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// isPrintableASCII - сообщает, состоит ли строка только из печатных символов ASCII
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
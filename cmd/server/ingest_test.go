@@ -0,0 +1,362 @@
+// Описание: Тесты приёма заказов по HTTP с ключами идемпотентности
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/internal/validation"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/apiclient"
+	"l0_test_self/pkg/client/postgres"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postOrder - отправляет запрос создания заказа с ключом идемпотентности key (пустой — без ключа)
+func postOrder(h http.Handler, key string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(string(body)))
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOrderCreateReplaysIdenticalRequest(t *testing.T) {
+	repo := &fakeRepository{}
+	c := newTestCache(t)
+	h := withDefaultTenant(makeOrderCreateHandler(repo, c, config.IdempotencyConfig{}, clock.Real, newTestLogger()))
+	body := mustOrderJSON(t, testorders.NewGenerator(21))
+
+	first := postOrder(h, "key-1", body)
+	require.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(idempotencyReplayedHeader))
+	assert.Equal(t, 1, c.Len())
+
+	second := postOrder(h, "key-1", body)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, "true", second.Header().Get(idempotencyReplayedHeader))
+	assert.Equal(t, first.Body.String(), second.Body.String())
+
+	inserts, _ := repo.stats()
+	assert.Equal(t, 1, inserts, "replayed request must not be processed again")
+
+	// Без ключа повтор обрабатывается заново и упирается в уже сохранённый заказ
+	assert.Equal(t, http.StatusConflict, postOrder(h, "", body).Code)
+}
+
+func TestOrderCreateReplaysStoredError(t *testing.T) {
+	repo := &fakeRepository{}
+	h := withDefaultTenant(makeOrderCreateHandler(repo, newTestCache(t), config.IdempotencyConfig{}, clock.Real, newTestLogger()))
+
+	first := postOrder(h, "key-bad", []byte(`{"order_uid": `))
+	require.Equal(t, http.StatusBadRequest, first.Code)
+
+	second := postOrder(h, "key-bad", []byte(`{"order_uid": `))
+	assert.Equal(t, http.StatusBadRequest, second.Code)
+	assert.Equal(t, "true", second.Header().Get(idempotencyReplayedHeader))
+	assert.Equal(t, first.Body.String(), second.Body.String())
+}
+
+func TestOrderCreateConflictingBody(t *testing.T) {
+	repo := &fakeRepository{}
+	h := withDefaultTenant(makeOrderCreateHandler(repo, newTestCache(t), config.IdempotencyConfig{}, clock.Real, newTestLogger()))
+	gen := testorders.NewGenerator(22)
+
+	require.Equal(t, http.StatusCreated, postOrder(h, "key-2", mustOrderJSON(t, gen)).Code)
+
+	rec := postOrder(h, "key-2", mustOrderJSON(t, gen))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "different request body")
+	inserts, stored := repo.stats()
+	assert.Equal(t, 1, inserts)
+	assert.Equal(t, 1, stored)
+}
+
+func TestOrderCreateExpiredKeyIsProcessedAgain(t *testing.T) {
+	repo := &fakeRepository{}
+	ttl := time.Hour
+	h := withDefaultTenant(makeOrderCreateHandler(repo, newTestCache(t), config.IdempotencyConfig{TTL: ttl}, clock.Real, newTestLogger()))
+	gen := testorders.NewGenerator(23)
+
+	require.Equal(t, http.StatusCreated, postOrder(h, "key-3", mustOrderJSON(t, gen)).Code)
+
+	// Ключ старше TTL: повтор с другим телом обрабатывается как новый запрос
+	repo.mu.Lock()
+	rec := repo.idempotency["key-3"]
+	rec.CreatedAt = time.Now().Add(-2 * ttl)
+	repo.idempotency["key-3"] = rec
+	repo.mu.Unlock()
+
+	resp := postOrder(h, "key-3", mustOrderJSON(t, gen))
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	assert.Empty(t, resp.Header().Get(idempotencyReplayedHeader))
+	_, stored := repo.stats()
+	assert.Equal(t, 2, stored)
+
+}
+
+func TestIdempotencyKeyCleanupRemovesExpiredKeys(t *testing.T) {
+	now := time.Now()
+	repo := &fakeRepository{idempotency: map[string]postgres.IdempotencyRecord{
+		"old":   {Key: "old", Status: http.StatusCreated, CreatedAt: now.Add(-2 * time.Hour)},
+		"fresh": {Key: "fresh", Status: http.StatusCreated, CreatedAt: now},
+	}}
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runIdempotencyKeyCleanup(ctx, repo, nil, time.Hour, time.Millisecond, newTestLogger())
+	}()
+
+	require.Eventually(t, func() bool {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		_, ok := repo.idempotency["old"]
+		return !ok
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Contains(t, repo.idempotency, "fresh")
+}
+
+func TestOrderCreateConcurrentDuplicateWaits(t *testing.T) {
+	release := make(chan struct{})
+	entered := make(chan struct{}, 2)
+	waiting := make(chan struct{}, 1)
+	repo := &fakeRepository{onInsert: func() {
+		entered <- struct{}{}
+		<-release
+	}, onKeyBusy: func() {
+		select {
+		case waiting <- struct{}{}:
+		default:
+		}
+	}}
+	h := withDefaultTenant(makeOrderCreateHandler(repo, newTestCache(t), config.IdempotencyConfig{WaitTimeout: 5 * time.Second}, clock.Real, newTestLogger()))
+	body := mustOrderJSON(t, testorders.NewGenerator(24))
+
+	results := make([]*httptest.ResponseRecorder, 2)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0] = postOrder(h, "key-4", body)
+	}()
+	<-entered
+
+	// Второй запрос с тем же ключом ждёт завершения первого, а не вставляет заказ повторно
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[1] = postOrder(h, "key-4", body)
+	}()
+	<-waiting
+	close(release)
+	wg.Wait()
+
+	assert.Len(t, entered, 0, "second request must not reach InsertOrder")
+	assert.Equal(t, http.StatusCreated, results[0].Code)
+	assert.Equal(t, http.StatusCreated, results[1].Code)
+	assert.Equal(t, "true", results[1].Header().Get(idempotencyReplayedHeader))
+	assert.Equal(t, results[0].Body.String(), results[1].Body.String())
+	inserts, _ := repo.stats()
+	assert.Equal(t, 1, inserts)
+}
+
+func TestOrderCreateWaitTimeout(t *testing.T) {
+	repo := &fakeRepository{}
+	h := withDefaultTenant(makeOrderCreateHandler(repo, newTestCache(t), config.IdempotencyConfig{WaitTimeout: idempotencyPollInterval}, clock.Real, newTestLogger()))
+	body := mustOrderJSON(t, testorders.NewGenerator(25))
+
+	// Ключ зарезервирован запросом, который ещё не завершился
+	_, reserved, err := reserveIdempotencyKey(t.Context(), repo, tenant.Default, "key-5", bodyHash(body), time.Hour, time.Second)
+	require.NoError(t, err)
+	require.True(t, reserved)
+
+	rec := postOrder(h, "key-5", body)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "still in progress")
+}
+
+func TestOrderCreateUnknownItemStatus(t *testing.T) {
+	t.Cleanup(func() { validation.SetAllowUnknownStatuses(false) })
+	repo := &fakeRepository{}
+	h := withDefaultTenant(makeOrderCreateHandler(repo, newTestCache(t), config.IdempotencyConfig{}, clock.Real, newTestLogger()))
+	g := testorders.NewGenerator(24)
+
+	order := g.Order(testorders.ScenarioDefault)
+	order.Items[0].Status = 999
+	body, err := json.Marshal(order)
+	require.NoError(t, err)
+	rec := postOrder(h, "", body)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "unknown item status")
+
+	validation.SetAllowUnknownStatuses(true)
+	require.Equal(t, http.StatusCreated, postOrder(h, "", body).Code)
+	stored, err := repo.GetOrderByUID(context.Background(), tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+	assert.Equal(t, orders.ItemStatus(999), stored.Items[0].Status)
+}
+
+func TestOrderCreateFutureDateCreated(t *testing.T) {
+	t.Cleanup(func() { validation.SetFutureDatePolicy(0, false) })
+	repo := &fakeRepository{}
+	c := newTestCache(t)
+	h := withDefaultTenant(makeOrderCreateHandler(repo, c, config.IdempotencyConfig{}, clock.Real, newTestLogger()))
+	g := testorders.NewGenerator(25)
+
+	future := g.Order(testorders.ScenarioDefault)
+	future.DateCreated = time.Now().AddDate(10, 0, 0)
+	body, err := json.Marshal(future)
+	require.NoError(t, err)
+
+	validation.SetFutureDatePolicy(time.Minute, false)
+	rec := postOrder(h, "", body)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "in the future")
+
+	// В режиме flag заказ сохраняется в карантин и не попадает в списки
+	validation.SetFutureDatePolicy(time.Minute, true)
+	require.Equal(t, http.StatusCreated, postOrder(h, "", body).Code)
+	stored, err := repo.GetOrderByUID(context.Background(), tenant.Default, future.OrderUid)
+	require.NoError(t, err)
+	assert.True(t, stored.Quarantined)
+	cached, ok := c.Get(tenant.Default, future.OrderUid)
+	require.True(t, ok)
+	assert.True(t, cached.Quarantined)
+
+	ctx := context.Background()
+	found, err := repo.FindOrdersByTrackNumber(ctx, tenant.Default, future.TrackNumber, "", nil, 0, postgres.IncludeAll, "")
+	require.NoError(t, err)
+	assert.Empty(t, found)
+	page, err := repo.ListOrdersAfter(ctx, tenant.Default, nil, time.Time{}, future.DateCreated.Add(time.Hour), 100, postgres.IncludeAll, "")
+	require.NoError(t, err)
+	assert.Empty(t, page)
+
+	rec = getOrder(t, withDefaultTenant(makeOrderHandler(c, repo, piiPolicy{}, nil, newTestLogger())), future.OrderUid)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"quarantined":true`)
+}
+
+func TestOrderCreateRolledBackOrderIsNotCached(t *testing.T) {
+	order := testorders.NewGenerator(27).Order(testorders.ScenarioDefault)
+	repo := &fakeRepository{rollbackUIDs: map[string]bool{order.OrderUid: true}}
+	c := newTestCache(t)
+	h := withDefaultTenant(makeOrderCreateHandler(repo, c, config.IdempotencyConfig{}, clock.Real, newTestLogger()))
+	body, err := json.Marshal(order)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusInternalServerError, postOrder(h, "", body).Code)
+	_, cached := c.Get(tenant.Default, order.OrderUid)
+	assert.False(t, cached, "an order whose transaction rolled back is not cached")
+
+	repo.mu.Lock()
+	repo.rollbackUIDs = nil
+	repo.mu.Unlock()
+	require.Equal(t, http.StatusCreated, postOrder(h, "", body).Code)
+	cachedOrder, cached := c.Get(tenant.Default, order.OrderUid)
+	require.True(t, cached)
+	assert.False(t, cachedOrder.StoredAt.IsZero(), "the committed order is cached")
+}
+
+func TestOrderCreateAndConsumerVersionCacheWithSharedClock(t *testing.T) {
+	// Часы в прошлом: версия по реальному времени перезаписала бы любую запись с версией этих часов
+	clk := clock.NewFake(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	repo := &fakeRepository{}
+	c := newTestCache(t)
+	h := withDefaultTenant(makeOrderCreateHandler(repo, c, config.IdempotencyConfig{}, clk, newTestLogger()))
+	cfg := newConsumerTestConfig()
+	cfg.Pipeline.CacheOnIngest = config.CacheOnIngestAlways
+	cons := newConsumer(&sliceReader{}, nil, repo, c, newTestLogger(), cfg, nil)
+	cons.clock = clk
+
+	order := testorders.NewGenerator(28).Order(testorders.ScenarioDefault)
+	body, err := json.Marshal(order)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, postOrder(h, "", body).Code)
+
+	updated := order
+	updated.TrackNumber = "UPDATEDTRACK1"
+	cons.cacheIngested(tenant.Default, updated)
+	cached, ok := c.Get(tenant.Default, order.OrderUid)
+	require.True(t, ok)
+	assert.Equal(t, order.TrackNumber, cached.TrackNumber, "a write at the same clock time is not newer")
+
+	clk.Advance(time.Second)
+	cons.cacheIngested(tenant.Default, updated)
+	cached, ok = c.Get(tenant.Default, order.OrderUid)
+	require.True(t, ok)
+	assert.Equal(t, updated.TrackNumber, cached.TrackNumber, "a later write by the clock replaces the cached order")
+}
+
+func TestOrderCreateDecodeMode(t *testing.T) {
+	t.Cleanup(func() { orders.SetDecodeMode("") })
+	repo := &fakeRepository{}
+	h := withDefaultTenant(makeOrderCreateHandler(repo, newTestCache(t), config.IdempotencyConfig{}, clock.Real, newTestLogger()))
+
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(mustOrderJSON(t, testorders.NewGenerator(26)), &fields))
+	fields["sm_id"] = "99"
+	fields["delivery"].(map[string]any)["floor"] = 3
+	body, err := json.Marshal(fields)
+	require.NoError(t, err)
+
+	orders.SetDecodeMode(orders.DecodeStrict)
+	rec := postOrder(h, "", body)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var apiErr apiErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &apiErr))
+	assert.Equal(t, errCodeOrderDecodeFailed, apiErr.Code)
+	assert.Equal(t, "invalid order: delivery.floor: unknown field; sm_id: expected integer, got string", apiErr.Message)
+
+	orders.SetDecodeMode(orders.DecodeLenient)
+	require.Equal(t, http.StatusCreated, postOrder(h, "", body).Code)
+	stored, err := repo.GetOrderByUID(context.Background(), tenant.Default, fields["order_uid"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, 99, stored.SmId)
+}
+
+func TestOrderCreateErrorsDecodedByAPIClient(t *testing.T) {
+	srv := httptest.NewServer(withDefaultTenant(makeOrderCreateHandler(&fakeRepository{}, newTestCache(t), config.IdempotencyConfig{}, clock.Real, newTestLogger())))
+	defer srv.Close()
+	client, err := apiclient.New(apiclient.Config{BaseURL: srv.URL, HTTPClient: srv.Client(), AcceptLanguage: "ru"})
+	require.NoError(t, err)
+
+	order := testorders.NewGenerator(28).Order(testorders.ScenarioDefault)
+	uid, err := client.CreateOrder(context.Background(), &order)
+	require.NoError(t, err)
+	assert.Equal(t, order.OrderUid, uid)
+
+	_, err = client.CreateOrder(context.Background(), &order)
+	var apiErr *apiclient.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusConflict, apiErr.StatusCode)
+	assert.Equal(t, errCodeOrderExists, apiErr.Code)
+	assert.Equal(t, "заказ уже существует", apiErr.Message)
+
+	invalid := testorders.NewGenerator(29).Order(testorders.ScenarioDefault)
+	invalid.Items[0].Status = 999
+	_, err = client.CreateOrder(context.Background(), &invalid)
+	var vErr *apiclient.ValidationError
+	require.ErrorAs(t, err, &vErr)
+	assert.Equal(t, http.StatusBadRequest, vErr.StatusCode)
+	assert.Equal(t, errCodeOrderInvalid, vErr.Code)
+	assert.Contains(t, vErr.Message, "заказ не прошёл проверку")
+	assert.Contains(t, vErr.Message, "unknown item status")
+}
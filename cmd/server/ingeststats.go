@@ -0,0 +1,238 @@
+// Описание: Почасовые счётчики принятых, некорректных и повторных сообщений консьюмера по отправителям
+// (kafka.consumer.ingest_stats): покупатель заказа и заголовок producer_id сообщения. Счётчики периодически
+// дописываются в таблицу ingest_stats, а отправители, доля некорректных сообщений которых в текущем часе резко
+// выросла, показываются в GET /admin/ingest/anomalies и метрике ingest_anomalous_senders
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/ingeststats"
+	"l0_test_self/internal/metrics"
+	"l0_test_self/pkg/client/postgres"
+
+	kafka2 "github.com/segmentio/kafka-go"
+)
+
+const (
+	// producerIDHeader - заголовок сообщения Kafka с идентификатором продюсера
+	producerIDHeader = "producer_id"
+	// ingestStatsListLimit - сколько строк возвращает GET /admin/ingest/stats
+	ingestStatsListLimit = 1000
+	// defaultIngestStatsRange - интервал GET /admin/ingest/stats без параметра from
+	defaultIngestStatsRange = 24 * time.Hour
+)
+
+// ingestStats - счётчики сообщений по отправителям. nil выключает учёт
+type ingestStats struct {
+	tracker     *ingeststats.Tracker
+	repo        OrderRepository
+	cfg         config.IngestStatsConfig
+	clock       clock.Clock // час учитываемых сообщений и граница аномалий, в тестах подменяется
+	logger      *log.Logger
+	flushErrors *metrics.Counter // неудачные записи счётчиков в ingest_stats
+}
+
+// newIngestStats - счётчики сообщений по настройкам cfg; nil, если учёт выключен
+func newIngestStats(cfg config.IngestStatsConfig, repo OrderRepository, logger *log.Logger) *ingestStats {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &ingestStats{
+		tracker:     ingeststats.NewTracker(cfg.Keys(), cfg.Factor(), cfg.Minimum()),
+		repo:        repo,
+		cfg:         cfg,
+		clock:       clock.Real,
+		logger:      logger,
+		flushErrors: &metrics.Counter{},
+	}
+}
+
+// producerOf - продюсер сообщения из заголовка producer_id; "" — заголовка нет
+func producerOf(msg *kafka2.Message) string {
+	for _, h := range msg.Headers {
+		if strings.EqualFold(h.Key, producerIDHeader) {
+			return strings.TrimSpace(string(h.Value))
+		}
+	}
+	return ""
+}
+
+// record - учитывает сообщение msg арендатора tenantID от покупателя customer ("" — заказ не декодирован) с итогом outcome
+func (s *ingestStats) record(tenantID string, msg *kafka2.Message, customer string, outcome ingeststats.Outcome) {
+	if s == nil {
+		return
+	}
+	key := ingeststats.Key{Tenant: tenantID, Producer: producerOf(msg), Customer: customer}
+	s.tracker.Record(key, outcome, s.clock.Now())
+}
+
+// run - дописывает счётчики в ingest_stats каждые flush_interval до отмены контекста. Последний прирост после
+// остановки консьюмера записывает flush.
+func (s *ingestStats) run(ctx context.Context) {
+	ticker := s.clock.NewTicker(s.cfg.Interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			s.flush(ctx)
+		}
+	}
+}
+
+// flush - дописывает прирост счётчиков в ingest_stats. При ошибке прирост остаётся в памяти до следующей записи.
+func (s *ingestStats) flush(ctx context.Context) {
+	if s == nil {
+		return
+	}
+	err := s.tracker.Flush(func(rows []ingeststats.Row) error {
+		list := make([]postgres.IngestStats, 0, len(rows))
+		for _, r := range rows {
+			list = append(list, postgres.IngestStats{
+				Tenant:    r.Tenant,
+				Producer:  r.Producer,
+				Customer:  r.Customer,
+				Hour:      r.Hour,
+				Accepted:  int64(r.Accepted),
+				Invalid:   int64(r.Invalid),
+				Duplicate: int64(r.Duplicate),
+			})
+		}
+		opCtx, cancel := opContext(ctx)
+		defer cancel()
+		return s.repo.AddIngestStats(opCtx, list)
+	})
+	if err != nil {
+		s.flushErrors.Inc()
+		s.logger.Printf("ingest stats flush error, counters kept for the next flush: %v", err)
+	}
+}
+
+// anomalies - отправители с аномальной долей некорректных сообщений в текущем часе
+func (s *ingestStats) anomalies() []ingeststats.Anomaly {
+	if s == nil {
+		return nil
+	}
+	return s.tracker.Anomalies(s.clock.Now())
+}
+
+// register - регистрирует метрики счётчиков в реестре
+func (s *ingestStats) register(reg *metrics.Registry) {
+	if s == nil {
+		return
+	}
+	reg.GaugeFunc("ingest_anomalous_senders", "Senders (producer_id, customer_id) whose invalid message rate this hour exceeds kafka.consumer.ingest_stats.threshold times their trailing 24h rate.",
+		func() float64 { return float64(len(s.anomalies())) })
+	reg.GaugeFunc("ingest_stats_senders", "Senders whose hourly message counters are kept in memory (kafka.consumer.ingest_stats.size).",
+		func() float64 { return float64(s.tracker.Len()) })
+	reg.RegisterCounter("ingest_stats_flush_errors_total", "Failed writes of hourly message counters to the ingest_stats table.", s.flushErrors)
+}
+
+// countBatch - учитывает заказы пачки batch, записанные InsertOrders из list: заказ, уже сохранённый раньше,
+// остаётся без времени записи и считается повтором
+func (c *consumer) countBatch(batch []pendingMessage, list []postgres.OrderRecord) {
+	if c.ingestStats == nil {
+		return
+	}
+	i := 0
+	for j := range batch {
+		p := &batch[j]
+		if !p.ok {
+			continue
+		}
+		outcome := ingeststats.Accepted
+		if list[i].Order.StoredAt.IsZero() {
+			outcome = ingeststats.Duplicate
+		}
+		c.ingestStats.record(p.tenant, &p.msg, p.order.CustomerId, outcome)
+		i++
+	}
+}
+
+// ingestAnomaliesResponse - ответ GET /admin/ingest/anomalies
+type ingestAnomaliesResponse struct {
+	Enabled     bool                  `json:"enabled"`
+	Threshold   float64               `json:"threshold,omitempty"`
+	MinMessages int                   `json:"min_messages,omitempty"`
+	Senders     int                   `json:"senders"` // отправителей, счётчики которых хранятся в памяти
+	Anomalies   []ingeststats.Anomaly `json:"anomalies"`
+}
+
+// makeIngestAnomaliesHandler - HTTP обработчик, возвращающий отправителей с аномальной долей некорректных сообщений
+// в текущем часе (s равен nil, если учёт выключен)
+func makeIngestAnomaliesHandler(s *ingestStats, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := ingestAnomaliesResponse{Anomalies: []ingeststats.Anomaly{}}
+		if s != nil {
+			resp.Enabled, resp.Threshold, resp.MinMessages = true, s.cfg.Factor(), s.cfg.Minimum()
+			resp.Senders = s.tracker.Len()
+			if list := s.anomalies(); list != nil {
+				resp.Anomalies = list
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", requestIDFromContext(r.Context()), err)
+		}
+	}
+}
+
+// ingestStatsResponse - ответ GET /admin/ingest/stats
+type ingestStatsResponse struct {
+	From  time.Time              `json:"from"`
+	To    time.Time              `json:"to"`
+	Hours []postgres.IngestStats `json:"hours"`
+}
+
+// makeIngestStatsHandler - HTTP обработчик, возвращающий из ingest_stats почасовые счётчики сообщений арендатора
+// за интервал [from, to) (по умолчанию последние сутки), при необходимости только продюсера producer_id и покупателя
+// customer_id, от новых часов к старым
+func makeIngestStatsHandler(repo OrderRepository, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		q := r.URL.Query()
+		filter := postgres.IngestStatsFilter{Producer: q.Get("producer_id"), Customer: q.Get("customer_id"), To: time.Now()}
+		if raw := q.Get("to"); raw != "" {
+			t, err := parseTimeParam(raw)
+			if err != nil {
+				writeAPIError(w, r, http.StatusBadRequest, errCodeTimeInvalid, "to")
+				return
+			}
+			filter.To = t
+		}
+		filter.From = filter.To.Add(-defaultIngestStatsRange)
+		if raw := q.Get("from"); raw != "" {
+			t, err := parseTimeParam(raw)
+			if err != nil {
+				writeAPIError(w, r, http.StatusBadRequest, errCodeTimeInvalid, "from")
+				return
+			}
+			filter.From = t
+		}
+
+		list, err := repo.ListIngestStats(r.Context(), tenantFromContext(r.Context()), filter, ingestStatsListLimit)
+		if err != nil {
+			logger.Printf("[%s] ingest stats: db error: %v", reqID, err)
+			if !writeUnavailable(w, r, err) {
+				writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			}
+			return
+		}
+		if list == nil {
+			list = []postgres.IngestStats{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(ingestStatsResponse{From: filter.From, To: filter.To, Hours: list}); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+		}
+	}
+}
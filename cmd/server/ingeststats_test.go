@@ -0,0 +1,255 @@
+// Описание: Тесты почасовых счётчиков сообщений по отправителям (kafka.consumer.ingest_stats): учёт принятых,
+// некорректных и повторных сообщений в обоих режимах записи, запись счётчиков в ingest_stats, отметка аномалий
+// на заданном пороге, GET /admin/ingest/anomalies и GET /admin/ingest/stats
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/ingeststats"
+	"l0_test_self/internal/metrics"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/pkg/client/postgres"
+	"l0_test_self/pkg/testorders"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statsStart - начало суток синтетического трафика
+var statsStart = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+// trafficSource - синтетический отправитель: покупатель и продюсер сообщений своей партиции
+type trafficSource struct {
+	customer  string
+	producer  string
+	partition int
+	gen       *testorders.Generator
+	offset    int64
+}
+
+// messages - accepted корректных заказов отправителя, invalid заказов без order_uid и duplicate повторов первого
+// из корректных
+func (s *trafficSource) messages(t *testing.T, accepted, invalid, duplicate int) []kafka2.Message {
+	t.Helper()
+	header := []kafka2.Header{{Key: "Producer_ID", Value: []byte(s.producer)}}
+	var msgs []kafka2.Message
+	add := func(value []byte) {
+		s.offset++
+		msgs = append(msgs, kafka2.Message{Topic: "orders", Partition: s.partition, Offset: s.offset, Value: value, Headers: header})
+	}
+	var first []byte
+	for i := 0; i < accepted+invalid; i++ {
+		o := s.gen.Order(testorders.ScenarioDefault)
+		o.CustomerId = s.customer
+		if i >= accepted {
+			o.OrderUid = ""
+		}
+		b, err := json.Marshal(o)
+		require.NoError(t, err)
+		if first == nil {
+			first = b
+		}
+		add(b)
+	}
+	for i := 0; i < duplicate; i++ {
+		add(first)
+	}
+	return msgs
+}
+
+// newIngestStatsConsumer - консьюмер режима sync со счётчиками отправителей на часах clk
+func newIngestStatsConsumer(t *testing.T, cfg *config.Config, repo *fakeRepository, clk clock.Clock) (*consumer, *ingestStats) {
+	t.Helper()
+	cfg.Kafka.Consumer.RecentOrdersSize = 100
+	cfg.Kafka.Consumer.RecentOrdersWindow = time.Hour
+	monitor := newConsumerMonitor(cfg)
+	monitor.ingestStats = newIngestStats(cfg.Kafka.Consumer.IngestStats, repo, newTestLogger())
+	require.NotNil(t, monitor.ingestStats)
+	monitor.ingestStats.clock = clk
+	return newConsumer(&sliceReader{}, nil, repo, newTestCache(t), newTestLogger(), cfg, monitor), monitor.ingestStats
+}
+
+// storedStats - счётчики ingest_stats фейкового репозитория по покупателям и часам
+func storedStats(repo *fakeRepository) map[string]map[time.Time]postgres.IngestStats {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	out := make(map[string]map[time.Time]postgres.IngestStats)
+	for _, s := range repo.ingestStats {
+		if out[s.Customer] == nil {
+			out[s.Customer] = make(map[time.Time]postgres.IngestStats)
+		}
+		out[s.Customer][s.Hour] = s
+	}
+	return out
+}
+
+func TestIngestStatsPersistsCountersAndFlagsAnomalies(t *testing.T) {
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.Consumer.IngestStats = config.IngestStatsConfig{Enabled: true, Threshold: 2, MinMessages: 10}
+	repo := &fakeRepository{}
+	clk := clock.NewFake(statsStart)
+	c, stats := newIngestStatsConsumer(t, cfg, repo, clk)
+	steady := &trafficSource{customer: "steady", producer: "shop-a", gen: testorders.NewGenerator(31)}
+	spiky := &trafficSource{customer: "spiky", producer: "shop-b", partition: 1, gen: testorders.NewGenerator(32)}
+	feed := func(msgs []kafka2.Message) {
+		for _, m := range msgs {
+			require.True(t, c.handle(context.Background(), m))
+		}
+	}
+
+	// Сутки ровного трафика: в каждом часе 19 заказов, одно некорректное сообщение и один повтор (доля ошибок 1/21)
+	for h := 0; h < ingeststats.WindowHours; h++ {
+		clk.Set(statsStart.Add(time.Duration(h)*time.Hour + 10*time.Minute))
+		feed(steady.messages(t, 19, 1, 1))
+		feed(spiky.messages(t, 19, 1, 1))
+		stats.flush(context.Background())
+	}
+	assert.Empty(t, stats.anomalies(), "a steady error rate is no anomaly")
+
+	// Текущий час: доля ошибок steady (2/22) выросла меньше чем в два раза, spiky (3/20) — больше чем в три
+	now := statsStart.Add(ingeststats.WindowHours*time.Hour + 20*time.Minute)
+	clk.Set(now)
+	feed(steady.messages(t, 19, 2, 1))
+	feed(spiky.messages(t, 17, 3, 0))
+	feed([]kafka2.Message{{Topic: "orders", Offset: 9999, Value: []byte("not json")}})
+
+	list := stats.anomalies()
+	require.Len(t, list, 1)
+	assert.Equal(t, ingeststats.Key{Tenant: tenant.Default, Producer: "shop-b", Customer: "spiky"}, list[0].Key)
+	assert.Equal(t, ingeststats.Counts{Accepted: 17, Invalid: 3}, list[0].Current)
+	assert.InDelta(t, 0.15, list[0].ErrorRate, 1e-9)
+	assert.InDelta(t, 1.0/21, list[0].TrailingErrorRate, 1e-9)
+
+	reg := metrics.NewRegistry()
+	stats.register(reg)
+	var buf bytes.Buffer
+	require.NoError(t, reg.WriteText(&buf))
+	assert.Contains(t, buf.String(), "ingest_anomalous_senders 1")
+	assert.Contains(t, buf.String(), "ingest_stats_senders 3")
+
+	rec := httptest.NewRecorder()
+	makeIngestAnomaliesHandler(stats, newTestLogger())(rec, httptest.NewRequest(http.MethodGet, "/admin/ingest/anomalies", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp ingestAnomaliesResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.True(t, resp.Enabled)
+	assert.Equal(t, 2.0, resp.Threshold)
+	require.Len(t, resp.Anomalies, 1)
+	assert.Equal(t, "spiky", resp.Anomalies[0].Customer)
+
+	// Счётчики каждого часа записаны по мере записи и дописываются приростом
+	stats.flush(context.Background())
+	stored := storedStats(repo)
+	require.Len(t, stored["spiky"], ingeststats.WindowHours+1)
+	first := stored["spiky"][statsStart]
+	assert.Equal(t, postgres.IngestStats{Tenant: tenant.Default, Producer: "shop-b", Customer: "spiky", Hour: statsStart, Accepted: 19, Invalid: 1, Duplicate: 1}, first)
+	current := stored["spiky"][now.Truncate(time.Hour)]
+	assert.Equal(t, [3]int64{17, 3, 0}, [3]int64{current.Accepted, current.Invalid, current.Duplicate})
+	assert.Equal(t, int64(1), stored[""][now.Truncate(time.Hour)].Invalid, "undecodable messages are counted without a customer")
+	assert.Empty(t, stored[""][now.Truncate(time.Hour)].Producer)
+}
+
+func TestIngestStatsCountsBatchedPipeline(t *testing.T) {
+	cfg := newBatchedTestConfig(3, time.Hour)
+	cfg.Kafka.Consumer.IngestStats = config.IngestStatsConfig{Enabled: true}
+	repo := &fakeRepository{}
+	src := &trafficSource{customer: "bulk", producer: "importer", gen: testorders.NewGenerator(33)}
+	msgs := src.messages(t, 4, 2, 0)
+	// Повтор заказа без окна недавних заказов доходит до базы и не записывается: это тоже повтор
+	msgs = append(msgs, kafka2.Message{Topic: "orders", Offset: 100, Value: msgs[0].Value, Headers: msgs[0].Headers})
+
+	monitor := newConsumerMonitor(cfg)
+	monitor.ingestStats = newIngestStats(cfg.Kafka.Consumer.IngestStats, repo, newTestLogger())
+	reader := &sliceReader{msgs: msgs}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), cfg, monitor)
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) == 6 }, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	monitor.ingestStats.flush(context.Background())
+	var got postgres.IngestStats
+	for _, byHour := range storedStats(repo) {
+		for _, s := range byHour {
+			assert.Equal(t, "importer", s.Producer)
+			assert.Equal(t, "bulk", s.Customer)
+			got.Accepted += s.Accepted
+			got.Invalid += s.Invalid
+			got.Duplicate += s.Duplicate
+		}
+	}
+	assert.Equal(t, [3]int64{4, 2, 1}, [3]int64{got.Accepted, got.Invalid, got.Duplicate})
+}
+
+func TestIngestStatsKeepsCountersWhenFlushFails(t *testing.T) {
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.Consumer.IngestStats = config.IngestStatsConfig{Enabled: true}
+	repo := &fakeRepository{statsErr: errors.New("db is down")}
+	c, stats := newIngestStatsConsumer(t, cfg, repo, clock.NewFake(statsStart))
+	src := &trafficSource{customer: "c1", producer: "p1", gen: testorders.NewGenerator(34)}
+	for _, m := range src.messages(t, 2, 1, 0) {
+		c.handle(context.Background(), m)
+	}
+
+	stats.flush(context.Background())
+	assert.Equal(t, uint64(1), stats.flushErrors.Value())
+	assert.Empty(t, storedStats(repo))
+
+	repo.mu.Lock()
+	repo.statsErr = nil
+	repo.mu.Unlock()
+	stats.flush(context.Background())
+	s := storedStats(repo)["c1"][statsStart]
+	assert.Equal(t, [3]int64{2, 1, 0}, [3]int64{s.Accepted, s.Invalid, s.Duplicate})
+}
+
+func TestIngestAnomaliesHandlerDisabled(t *testing.T) {
+	rec := httptest.NewRecorder()
+	makeIngestAnomaliesHandler(nil, newTestLogger())(rec, httptest.NewRequest(http.MethodGet, "/admin/ingest/anomalies", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"enabled":false,"senders":0,"anomalies":[]}`, rec.Body.String())
+}
+
+func TestIngestStatsHandler(t *testing.T) {
+	hour := time.Now().UTC().Truncate(time.Hour)
+	repo := &fakeRepository{ingestStats: []postgres.IngestStats{
+		{Tenant: tenant.Default, Producer: "p1", Customer: "c1", Hour: hour.Add(-2 * time.Hour), Accepted: 5},
+		{Tenant: tenant.Default, Producer: "p1", Customer: "c1", Hour: hour, Accepted: 3, Invalid: 1},
+		{Tenant: tenant.Default, Producer: "p2", Customer: "c2", Hour: hour, Duplicate: 2},
+		{Tenant: tenant.Default, Producer: "p1", Customer: "c1", Hour: hour.Add(-48 * time.Hour), Accepted: 9},
+	}}
+	get := func(query string) (int, ingestStatsResponse) {
+		rec := httptest.NewRecorder()
+		withDefaultTenant(makeIngestStatsHandler(repo, newTestLogger())).
+			ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/ingest/stats?"+query, nil))
+		var resp ingestStatsResponse
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		}
+		return rec.Code, resp
+	}
+
+	code, resp := get("customer_id=c1")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, resp.Hours, 2, "the last day by default")
+	assert.Equal(t, int64(3), resp.Hours[0].Accepted, "newest hours first")
+	assert.Equal(t, int64(5), resp.Hours[1].Accepted)
+
+	_, resp = get("producer_id=p2")
+	require.Len(t, resp.Hours, 1)
+	assert.Equal(t, int64(2), resp.Hours[0].Duplicate)
+
+	code, _ = get("from=yesterday")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
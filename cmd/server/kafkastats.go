@@ -0,0 +1,199 @@
+// Описание: Статистика клиентов Kafka: периодическая сводка в логе и метрики
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/goroutines"
+	"l0_test_self/internal/logging"
+	"l0_test_self/internal/metrics"
+
+	kafka2 "github.com/segmentio/kafka-go"
+)
+
+// KafkaClientStats - статистика клиента Kafka. Счётчики (Dials–Rebalances) — приращения за интервал,
+// Lag — текущее отставание читателя.
+type KafkaClientStats struct {
+	Dials      int64 // установленные соединения с брокерами
+	Requests   int64 // запросы чтения (fetch) читателя или записи писателя
+	Messages   int64
+	Bytes      int64
+	Errors     int64
+	Rebalances int64 // ребалансировки группы консьюмеров; у писателя всегда 0
+	Lag        int64
+}
+
+// idle - сообщает, что за интервал клиент ничего не делал
+func (s KafkaClientStats) idle() bool {
+	return s.Dials == 0 && s.Requests == 0 && s.Messages == 0 && s.Bytes == 0 && s.Errors == 0 && s.Rebalances == 0
+}
+
+// StatsProvider - источник статистики клиента Kafka. Как Reader.Stats и Writer.Stats в kafka-go, каждый вызов
+// ClientStats возвращает приращения счётчиков с предыдущего вызова, поэтому у источника должен быть один потребитель.
+type StatsProvider interface {
+	ClientStats() KafkaClientStats
+}
+
+// readerStatsProvider - StatsProvider читателя Kafka
+type readerStatsProvider struct {
+	reader interface{ Stats() kafka2.ReaderStats }
+}
+
+func (p readerStatsProvider) ClientStats() KafkaClientStats {
+	s := p.reader.Stats()
+	return KafkaClientStats{
+		Dials:      s.Dials,
+		Requests:   s.Fetches,
+		Messages:   s.Messages,
+		Bytes:      s.Bytes,
+		Errors:     s.Errors,
+		Rebalances: s.Rebalances,
+		Lag:        s.Lag,
+	}
+}
+
+// writerStatsProvider - StatsProvider писателя Kafka
+type writerStatsProvider struct {
+	writer interface{ Stats() kafka2.WriterStats }
+}
+
+func (p writerStatsProvider) ClientStats() KafkaClientStats {
+	s := p.writer.Stats()
+	return KafkaClientStats{
+		Dials:    s.Dials,
+		Requests: s.Writes,
+		Messages: s.Messages,
+		Bytes:    s.Bytes,
+		Errors:   s.Errors,
+	}
+}
+
+// kafkaStats - статистика клиентов Kafka процесса по именам клиентов (reader, dlq). Снимки приращений
+// складываются в накопленные значения, которые выводятся метриками.
+type kafkaStats struct {
+	mu        sync.Mutex
+	providers map[string]StatsProvider
+	totals    map[string]KafkaClientStats // накопленные счётчики и последнее отставание
+	readiness *lagReadiness               // получает отставание читателя reader при каждом снятии статистики
+}
+
+// newKafkaStats - создает пустую статистику клиентов
+func newKafkaStats() *kafkaStats {
+	return &kafkaStats{providers: make(map[string]StatsProvider), totals: make(map[string]KafkaClientStats)}
+}
+
+// add - добавляет клиент name; метрики клиента появляются сразу, с нулевыми значениями
+func (k *kafkaStats) add(name string, p StatsProvider) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.providers[name] = p
+	if _, ok := k.totals[name]; !ok {
+		k.totals[name] = KafkaClientStats{}
+	}
+}
+
+// collect - снимает статистику всех клиентов, добавляет приращения к накопленным значениям
+// и пишет в лог сводку каждого клиента: интервал без активности — с уровнем debug
+func (k *kafkaStats) collect(logger *logging.Leveled) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	names := make([]string, 0, len(k.providers))
+	for name := range k.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := k.providers[name].ClientStats()
+		t := k.totals[name]
+		t.Dials += s.Dials
+		t.Requests += s.Requests
+		t.Messages += s.Messages
+		t.Bytes += s.Bytes
+		t.Errors += s.Errors
+		t.Rebalances += s.Rebalances
+		t.Lag = s.Lag
+		k.totals[name] = t
+		if name == "reader" {
+			k.readiness.observe(s.Lag, time.Now())
+		}
+
+		level := logging.LevelInfo
+		if s.idle() {
+			level = logging.LevelDebug
+		}
+		logger.Logf(level, "kafka %s stats: dials=%d requests=%d messages=%d bytes=%d errors=%d rebalances=%d lag=%d",
+			name, s.Dials, s.Requests, s.Messages, s.Bytes, s.Errors, s.Rebalances, s.Lag)
+	}
+}
+
+// run - снимает статистику каждые interval до отмены ctx
+func (k *kafkaStats) run(ctx context.Context, interval time.Duration, logger *logging.Leveled) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			k.collect(logger)
+		}
+	}
+}
+
+// values - значение поля накопленной статистики каждого клиента для метрик
+func (k *kafkaStats) values(field func(KafkaClientStats) int64) map[string]float64 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	out := make(map[string]float64, len(k.totals))
+	for name, t := range k.totals {
+		out[name] = float64(field(t))
+	}
+	return out
+}
+
+// register - регистрирует метрики накопленной статистики клиентов с меткой client
+func (k *kafkaStats) register(reg *metrics.Registry) {
+	for _, m := range []struct {
+		name, help string
+		field      func(KafkaClientStats) int64
+	}{
+		{"kafka_client_dials_total", "Connections opened to Kafka brokers, by client.", func(s KafkaClientStats) int64 { return s.Dials }},
+		{"kafka_client_requests_total", "Fetch (reader) or produce (writer) requests sent to Kafka, by client.", func(s KafkaClientStats) int64 { return s.Requests }},
+		{"kafka_client_messages_total", "Messages read or written, by client.", func(s KafkaClientStats) int64 { return s.Messages }},
+		{"kafka_client_bytes_total", "Message bytes read or written, by client.", func(s KafkaClientStats) int64 { return s.Bytes }},
+		{"kafka_client_errors_total", "Errors reported by the Kafka client, by client.", func(s KafkaClientStats) int64 { return s.Errors }},
+		{"kafka_client_rebalances_total", "Consumer group rebalances seen by the reader, by client.", func(s KafkaClientStats) int64 { return s.Rebalances }},
+	} {
+		reg.CounterVecFunc(m.name, m.help, "client", func() map[string]float64 { return k.values(m.field) })
+	}
+	reg.GaugeVecFunc("kafka_client_lag", "Reader lag in messages at the last stats snapshot, by client.", "client", func() map[string]float64 {
+		return k.values(func(s KafkaClientStats) int64 { return s.Lag })
+	})
+}
+
+// startKafkaStats - добавляет в статистику монитора читатель и, если он сообщает статистику, писатель очереди
+// недоставленных сообщений, и снимает её каждые kafka.consumer.stats_interval до отмены ctx
+func startKafkaStats(ctx context.Context, wg *sync.WaitGroup, reader MessageReader, dlq MessageWriter, logger *log.Logger, cfg *config.Config, monitor *consumerMonitor) {
+	stats := monitor.kafka
+	stats.add("reader", readerStatsProvider{reader: reader})
+	if w, ok := dlq.(interface{ Stats() kafka2.WriterStats }); ok {
+		stats.add("dlq", writerStatsProvider{writer: w})
+	}
+	level, err := logging.ParseLevel(cfg.Kafka.Consumer.StatsLogLevel)
+	if err != nil {
+		// Уровень проверяется при загрузке конфигурации; сюда попадают только конфигурации, собранные вручную
+		level = logging.LevelInfo
+	}
+	leveled := logging.NewLeveled(logger, level)
+
+	wg.Add(1)
+	goroutines.Go("kafka client stats", ctx.Done(), func() {
+		defer wg.Done()
+		stats.run(ctx, cfg.Kafka.Consumer.StatsInterval, leveled)
+	})
+}
@@ -0,0 +1,123 @@
+// Описание: Тесты статистики клиентов Kafka: накопление приращений kafka-go, сводка в логе и метрики
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/logging"
+	"l0_test_self/internal/metrics"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedStats - StatsProvider, возвращающий приращения из списка по одному на вызов, а после его конца — нулевые
+type scriptedStats struct {
+	deltas []KafkaClientStats
+}
+
+func (s *scriptedStats) ClientStats() KafkaClientStats {
+	if len(s.deltas) == 0 {
+		return KafkaClientStats{}
+	}
+	d := s.deltas[0]
+	s.deltas = s.deltas[1:]
+	return d
+}
+
+func TestKafkaStatsAccumulatesDeltas(t *testing.T) {
+	stats := newKafkaStats()
+	stats.add("reader", &scriptedStats{deltas: []KafkaClientStats{
+		{Dials: 1, Requests: 4, Messages: 10, Bytes: 1000, Lag: 50},
+		{Requests: 2, Messages: 5, Bytes: 500, Errors: 1, Rebalances: 1, Lag: 20},
+	}})
+	stats.add("dlq", &scriptedStats{deltas: []KafkaClientStats{{Dials: 1, Requests: 1, Messages: 1, Bytes: 100}}})
+	reg := metrics.NewRegistry()
+	stats.register(reg)
+
+	logger := logging.NewLeveled(newTestLogger(), logging.LevelInfo)
+	stats.collect(logger)
+	stats.collect(logger)
+	// Пустой интервал не уменьшает накопленные значения, а отставание берётся из последнего снимка
+	stats.collect(logger)
+
+	assert.Equal(t, map[string]float64{"reader": 15, "dlq": 1}, stats.values(func(s KafkaClientStats) int64 { return s.Messages }))
+	assert.Equal(t, map[string]float64{"reader": 1500, "dlq": 100}, stats.values(func(s KafkaClientStats) int64 { return s.Bytes }))
+	assert.Equal(t, map[string]float64{"reader": 0, "dlq": 0}, stats.values(func(s KafkaClientStats) int64 { return s.Lag }))
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.WriteText(&buf))
+	text := buf.String()
+	assert.Contains(t, text, `kafka_client_requests_total{client="reader"} 6`)
+	assert.Contains(t, text, `kafka_client_errors_total{client="reader"} 1`)
+	assert.Contains(t, text, `kafka_client_rebalances_total{client="reader"} 1`)
+	assert.Contains(t, text, `kafka_client_dials_total{client="dlq"} 1`)
+	assert.Contains(t, text, "# TYPE kafka_client_lag gauge")
+}
+
+func TestKafkaStatsIdleIntervalLogsAtDebug(t *testing.T) {
+	collect := func(min logging.Level, deltas ...KafkaClientStats) string {
+		var buf strings.Builder
+		stats := newKafkaStats()
+		stats.add("reader", &scriptedStats{deltas: deltas})
+		stats.collect(logging.NewLeveled(log.New(&buf, "", 0), min))
+		return buf.String()
+	}
+
+	assert.Equal(t, "kafka reader stats: dials=0 requests=3 messages=2 bytes=200 errors=0 rebalances=0 lag=5\n",
+		collect(logging.LevelInfo, KafkaClientStats{Requests: 3, Messages: 2, Bytes: 200, Lag: 5}))
+	// Отставание без активности за интервал — тоже простой
+	assert.Empty(t, collect(logging.LevelInfo, KafkaClientStats{Lag: 5}))
+	assert.Equal(t, "debug: kafka reader stats: dials=0 requests=0 messages=0 bytes=0 errors=0 rebalances=0 lag=5\n",
+		collect(logging.LevelDebug, KafkaClientStats{Lag: 5}))
+}
+
+// writerWithStats - писатель очереди недоставленных сообщений, сообщающий статистику kafka-go
+type writerWithStats struct {
+	*fakeWriter
+	stats kafka2.WriterStats
+}
+
+func (w writerWithStats) Stats() kafka2.WriterStats { return w.stats }
+
+func TestStatsProviders(t *testing.T) {
+	r := readerStatsProvider{reader: &sliceReader{}}
+	assert.Equal(t, KafkaClientStats{}, r.ClientStats())
+
+	w := writerStatsProvider{writer: writerWithStats{stats: kafka2.WriterStats{Dials: 1, Writes: 2, Messages: 3, Bytes: 4, Errors: 5}}}
+	assert.Equal(t, KafkaClientStats{Dials: 1, Requests: 2, Messages: 3, Bytes: 4, Errors: 5}, w.ClientStats())
+}
+
+func TestStartKafkaStatsAddsWriterWithStats(t *testing.T) {
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.Consumer.StatsInterval = time.Hour
+
+	for _, tc := range []struct {
+		dlq     MessageWriter
+		clients []string
+	}{
+		{nil, []string{"reader"}},
+		{&fakeWriter{}, []string{"reader"}},
+		{writerWithStats{fakeWriter: &fakeWriter{}}, []string{"dlq", "reader"}},
+	} {
+		monitor := newConsumerMonitor(cfg)
+		ctx, cancel := context.WithCancel(context.Background())
+		wg := &sync.WaitGroup{}
+		startKafkaStats(ctx, wg, &sliceReader{}, tc.dlq, newTestLogger(), cfg, monitor)
+		cancel()
+		wg.Wait()
+
+		clients := make([]string, 0, len(monitor.kafka.providers))
+		for name := range monitor.kafka.providers {
+			clients = append(clients, name)
+		}
+		assert.ElementsMatch(t, tc.clients, clients)
+	}
+}
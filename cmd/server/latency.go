@@ -0,0 +1,118 @@
+// Описание: Сквозная задержка обработки заказов: от публикации сообщения в Kafka до появления заказа в кэше.
+// Задержка учитывается в гистограмме метрик, в скользящем окне для p99 и порога SLO и в журнале order_audit
+package main
+
+import (
+	"math"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/metrics"
+	"l0_test_self/pkg/client/postgres"
+
+	kafka2 "github.com/segmentio/kafka-go"
+)
+
+// producedAtHeader - заголовок сообщения с моментом публикации заказа (RFC 3339). Без него задержка отсчитывается
+// от метки времени сообщения Kafka
+const producedAtHeader = "produced_at"
+
+const (
+	// defaultLatencyWindow - окно p99 задержки, если kafka.consumer.latency.window не задан
+	defaultLatencyWindow = 5 * time.Minute
+	// defaultLatencyWindowSize - число хранимых измерений окна, если kafka.consumer.latency.window_size не задан
+	defaultLatencyWindowSize = 10000
+)
+
+// latencyBuckets - верхние границы корзин гистограммы задержки в секундах
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// latencyMonitor - учёт сквозной задержки обработки заказов, общий для консьюмера и HTTP обработчиков
+type latencyMonitor struct {
+	slo    time.Duration
+	span   time.Duration
+	hist   *metrics.Histogram
+	window *metrics.QuantileWindow
+	clock  clock.Clock // время появления заказа в кэше, в тестах подменяется
+}
+
+// latencyStatus - задержка обработки заказов в ответе /admin/consumer/status
+type latencyStatus struct {
+	P99Ms         float64 `json:"p99_ms"`
+	Samples       int     `json:"samples"`
+	WindowSeconds float64 `json:"window_seconds"`
+	SLOMs         float64 `json:"slo_ms,omitempty"`
+	SLOBreached   bool    `json:"slo_breached"`
+}
+
+// newLatencyMonitor - создает учёт задержки по настройкам kafka.consumer.latency
+func newLatencyMonitor(cfg config.LatencyConfig) *latencyMonitor {
+	span, size := cfg.Window, cfg.WindowSize
+	if span <= 0 {
+		span = defaultLatencyWindow
+	}
+	if size <= 0 {
+		size = defaultLatencyWindowSize
+	}
+	return &latencyMonitor{
+		slo:    cfg.SLO,
+		span:   span,
+		hist:   metrics.NewHistogram(latencyBuckets),
+		window: metrics.NewQuantileWindow(span, size),
+		clock:  clock.Real,
+	}
+}
+
+// observe - учитывает задержку заказа uid из сообщения msg, который только что появился в кэше, и возвращает её.
+// Отрицательная задержка (часы продюсера спешат) считается нулевой.
+func (m *latencyMonitor) observe(msg kafka2.Message, uid string) postgres.LatencyRecord {
+	now := m.clock.Now()
+	latency := max(now.Sub(messageProducedAt(msg)), 0)
+	m.hist.Observe(latency.Seconds())
+	m.window.Observe(latency.Seconds(), now)
+	return postgres.LatencyRecord{OrderUid: uid, Latency: latency, MeasuredAt: now}
+}
+
+// messageProducedAt - момент публикации сообщения: заголовок produced_at или, если его нет или он неверен, метка времени Kafka
+func messageProducedAt(msg kafka2.Message) time.Time {
+	for _, h := range msg.Headers {
+		if h.Key != producedAtHeader {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339Nano, string(h.Value)); err == nil {
+			return t
+		}
+	}
+	return msg.Time
+}
+
+// status - p99 задержки за окно и признак превышения порога SLO
+func (m *latencyMonitor) status() latencyStatus {
+	s := latencyStatus{WindowSeconds: m.span.Seconds(), SLOMs: durationMs(m.slo)}
+	p99, n := m.window.Quantile(0.99, m.clock.Now())
+	if n == 0 {
+		return s
+	}
+	s.Samples = n
+	s.P99Ms = math.Round(p99 * 1000)
+	s.SLOBreached = m.slo > 0 && p99 > m.slo.Seconds()
+	return s
+}
+
+// register - регистрирует метрики задержки в реестре
+func (m *latencyMonitor) register(reg *metrics.Registry) {
+	reg.RegisterHistogram("order_e2e_latency_seconds", "Latency from Kafka produce time to order availability in cache.", m.hist)
+	reg.GaugeFunc("order_e2e_latency_slo_breached", "Whether p99 order latency over the window exceeds the SLO (0 or 1).",
+		func() float64 {
+			if m.status().SLOBreached {
+				return 1
+			}
+			return 0
+		})
+}
+
+// durationMs - длительность в миллисекундах
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
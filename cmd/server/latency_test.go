@@ -0,0 +1,145 @@
+// Описание: Тесты учёта сквозной задержки обработки заказов: расчёт по метке времени Kafka и заголовку produced_at,
+// журнал последних задержек, p99 за окно и превышение порога SLO в /admin/consumer/status
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// latencyTestMessages - три заказа, опубликованные за 100ms, 3s и (по заголовку produced_at) 500ms до now
+func latencyTestMessages(t *testing.T, now time.Time) ([]kafka2.Message, []string) {
+	msgs, uids := newOrderMessages(t, 21, 3)
+	msgs[0].Time = now.Add(-100 * time.Millisecond)
+	msgs[1].Time = now.Add(-3 * time.Second)
+	msgs[2].Time = now.Add(-10 * time.Millisecond)
+	msgs[2].Headers = []kafka2.Header{{Key: producedAtHeader, Value: []byte(now.Add(-500 * time.Millisecond).Format(time.RFC3339Nano))}}
+	return msgs, []string{uids[0], uids[1], uids[2]}
+}
+
+// newTestLatencyMonitor - учёт задержки с остановленными часами now
+func newTestLatencyMonitor(cfg config.LatencyConfig, now time.Time) *latencyMonitor {
+	m := newLatencyMonitor(cfg)
+	m.clock = clock.NewFake(now)
+	return m
+}
+
+func TestConsumerRecordsEndToEndLatency(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for name, cfg := range map[string]*config.Config{
+		"sync":    newConsumerTestConfig(),
+		"batched": newBatchedTestConfig(2, 10*time.Millisecond),
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg.Kafka.Consumer.Latency = config.LatencyConfig{SLO: time.Second, Record: true}
+			msgs, uids := latencyTestMessages(t, now)
+			monitor := newTestLatencyMonitor(cfg.Kafka.Consumer.Latency, now)
+			consumerState := newConsumerMonitor(cfg)
+			consumerState.latency = monitor
+
+			repo := &fakeRepository{}
+			reader := &sliceReader{msgs: msgs}
+			ctx, cancel := context.WithCancel(context.Background())
+			wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), cfg, consumerState)
+			require.Eventually(t, func() bool { return len(reader.committedOffsets()) == len(msgs) }, 5*time.Second, time.Millisecond)
+			cancel()
+			wg.Wait()
+
+			repo.mu.Lock()
+			defer repo.mu.Unlock()
+			for i, want := range []time.Duration{100 * time.Millisecond, 3 * time.Second, 500 * time.Millisecond} {
+				assert.Equal(t, want, repo.latencies[uids[i]].Latency, uids[i])
+				assert.Equal(t, now, repo.latencies[uids[i]].MeasuredAt)
+			}
+
+			status := monitor.status()
+			assert.Equal(t, 3, status.Samples)
+			assert.Equal(t, 3000.0, status.P99Ms)
+			assert.True(t, status.SLOBreached)
+			assert.Equal(t, uint64(3), monitor.hist.Count())
+		})
+	}
+}
+
+func TestConsumerLatencyRecordDisabled(t *testing.T) {
+	now := time.Now()
+	msgs, _ := latencyTestMessages(t, now)
+	cfg := newConsumerTestConfig()
+	monitor := newTestLatencyMonitor(cfg.Kafka.Consumer.Latency, now)
+
+	repo := &fakeRepository{}
+	reader := &sliceReader{msgs: msgs}
+	ctx, cancel := context.WithCancel(context.Background())
+	consumerState := newConsumerMonitor(cfg)
+	consumerState.latency = monitor
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), cfg, consumerState)
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) == len(msgs) }, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	assert.Empty(t, repo.latencies)
+	status := monitor.status()
+	assert.Equal(t, 3, status.Samples, "latency is still measured")
+	assert.False(t, status.SLOBreached, "no SLO configured")
+}
+
+func TestLatencyStatusWindowAndSLO(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	monitor := newTestLatencyMonitor(config.LatencyConfig{SLO: 250 * time.Millisecond, Window: time.Minute}, now)
+
+	assert.Equal(t, latencyStatus{WindowSeconds: 60, SLOMs: 250}, monitor.status(), "no samples yet")
+
+	// 99 быстрых заказов и один медленный: медленный определяет p99 только при меньшем числе измерений
+	for i := 0; i < 99; i++ {
+		monitor.observe(kafka2.Message{Time: now.Add(-50 * time.Millisecond)}, "fast")
+	}
+	assert.False(t, monitor.status().SLOBreached)
+	monitor.observe(kafka2.Message{Time: now.Add(-2 * time.Second)}, "slow")
+	status := monitor.status()
+	assert.Equal(t, 100, status.Samples)
+	assert.Equal(t, 50.0, status.P99Ms)
+	assert.False(t, status.SLOBreached)
+
+	monitor.observe(kafka2.Message{Time: now.Add(-2 * time.Second)}, "slow")
+	status = monitor.status()
+	assert.Equal(t, 2000.0, status.P99Ms)
+	assert.True(t, status.SLOBreached)
+
+	// Измерения старше окна не учитываются
+	monitor.clock.(*clock.Fake).Advance(2 * time.Minute)
+	assert.False(t, monitor.status().SLOBreached)
+
+	// Сообщение из будущего (часы продюсера спешат) даёт нулевую задержку
+	assert.Zero(t, monitor.observe(kafka2.Message{Time: now.Add(time.Hour)}, "skewed").Latency)
+}
+
+func TestConsumerStatusReportsLatency(t *testing.T) {
+	now := time.Now()
+	monitor := newTestLatencyMonitor(config.LatencyConfig{SLO: time.Second}, now)
+	monitor.observe(kafka2.Message{Time: now.Add(-1500 * time.Millisecond)}, "order-1")
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /admin/consumer/status", requireAdmin(testAdminKey,
+		makeConsumerStatusHandler("", newTestReadBreaker(time.Minute), monitor, nil, nil, nil, newTestLogger())))
+	req := httptest.NewRequest(http.MethodGet, "/admin/consumer/status", nil)
+	req.Header.Set("X-API-Key", testAdminKey)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var got consumerStatusResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	require.NotNil(t, got.E2ELatency)
+	assert.Equal(t, latencyStatus{P99Ms: 1500, Samples: 1, WindowSeconds: 300, SLOMs: 1000, SLOBreached: true}, *got.E2ELatency)
+}
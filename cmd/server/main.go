@@ -4,34 +4,51 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"l0_test_self/internal/cache"
 	"l0_test_self/internal/config"
+	"l0_test_self/internal/goroutines"
+	"l0_test_self/internal/i18n"
+	"l0_test_self/internal/ids"
+	"l0_test_self/internal/leader"
+	"l0_test_self/internal/pagination"
 	"l0_test_self/internal/validation"
 	"l0_test_self/models/orders"
+	"l0_test_self/pkg/buildinfo"
 	"l0_test_self/pkg/client/kafka"
 	"l0_test_self/pkg/client/postgres"
-
-	"github.com/jackc/pgx/v4/pgxpool"
-	kafka2 "github.com/segmentio/kafka-go"
 )
 
 const configPath = "../../config.yaml"
 
 // OrderCache - интерфейс для кэша заказов
 type OrderCache interface {
-	Set(order orders.Order)
-	Get(id string) (orders.Order, bool)
-	LoadFromSlice([]orders.Order)
+	Set(tenantID string, order orders.Order)
+	SetIfNewer(tenantID string, order orders.Order, version int64) bool
+	Get(tenantID, id string) (orders.Order, bool)
+	GetJSON(tenantID, id string) ([]byte, bool)
+	MarkMissing(tenantID, id string)
+	IsMissing(tenantID, id string) bool
+	Contains(tenantID, id string) bool
+	Delete(tenantID, id string)
+	LoadFromSlice(tenantID string, list []orders.Order)
+	Range(fn func(tenantID, id string, o orders.Order) bool)
+	Len() int
 }
 
 func main() {
@@ -42,176 +59,608 @@ func main() {
 
 // run - основная функция запуска сервера
 func run() error {
-	// Создаем контекст с возможностью отмены
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	modeFlag := flag.String("mode", modeAll, "режим запуска: all (API и consumer), api или consumer")
+	checkFlag := flag.Bool("check", false, "проверить конфигурацию, схему базы данных и Kafka, напечатать JSON отчёт и выйти")
+	checkTimeout := flag.Duration("check-timeout", defaultCheckTimeout, "ограничение каждой проверки -check")
+	replayFlag := flag.String("replay", "", "повторить топик kafka.topic без группы под именем читателя и выйти")
+	resumeFlag := flag.Bool("resume", false, "продолжить -replay с сохранённой позиции чтения")
+	replayDLQFlag := flag.Bool("replay-dlq", false, "повторить в -replay очередь недоставленных kafka.dlq_topic вместо kafka.topic")
+	flag.Parse()
+	mode, err := parseMode(*modeFlag)
+	if err != nil {
+		return err
+	}
+	if *resumeFlag && *replayFlag == "" {
+		return fmt.Errorf("-resume requires -replay")
+	}
+	if *replayDLQFlag && *replayFlag == "" {
+		return fmt.Errorf("-replay-dlq requires -replay")
+	}
+
+	// Контекст отменяется по сигналу остановки
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *checkFlag {
+		return runPreflight(ctx, configPath, mode, *checkTimeout, os.Stdout)
+	}
 
 	// Настраиваем логирование
 	logger := log.New(os.Stdout, "[srv] ", log.LstdFlags|log.Lmicroseconds)
+	logger.Printf("starting order server (mode=%s): %s", mode, buildinfo.Get())
 
 	// Загружаем конфигурацию
 	cfg, err := config.Load(configPath)
 	if err != nil {
 		return err
 	}
+	logger.Printf("config: %+v", cfg.Redacted())
+
+	// Каталог сообщений об ошибках API должен быть полным: иначе клиенты получили бы коды вместо сообщений
+	if _, err := i18n.Embedded(); err != nil {
+		return err
+	}
 
 	// Инициализируем компоненты приложения
 	dbCfg := cfg.Database.ToPostgresConfig()
-	pool, err := postgres.NewClient(ctx, dbCfg, cfg.Database.MaxConnections) // returns v4 pool
+	pool, err := postgres.NewClient(ctx, dbCfg, max(cfg.Database.ConnectAttempts, 1)) // returns v4 pool
 	if err != nil {
 		return err
 	}
 	defer pool.Close()
+	// В базу пишет один воркер: цикл консьюмера в режиме sync или фоновый сброс пачек в режиме batched
+	if warning := postgres.PoolSizeWarning(cfg.Database.MaxConnections, 1); warning != "" {
+		logger.Printf("warning: %s", warning)
+	}
+	if err := postgres.EnsureSchema(ctx, pool); err != nil {
+		return err
+	}
 	logger.Println("database pool ready")
 
-	// Инициализируем кэш
-	cc, err := cache.New(cfg.Cache.ShardCount, cfg.Cache.MaxItems, cfg.Cache.TTL, cfg.Cache.CleanupInterval)
+	// Неверный или отсутствующий ключ шифрования обнаруживается при запуске, а не при первом чтении заказа
+	keyring, err := cfg.Database.Encryption.Keyring()
 	if err != nil {
 		return err
 	}
-	defer cc.Close()
-	logger.Println("cache initialized")
+	if err := postgres.VerifyFieldEncryption(ctx, pool, keyring); err != nil {
+		return err
+	}
+	postgres.SetFieldEncryption(keyring)
+	if keyring != nil {
+		logger.Printf("delivery PII encryption enabled (active key %s)", keyring.ActiveKeyID())
+	}
 
-	// Загружаем существующие заказы в кэш
-	existingOrders, err := postgres.GetAllOrders(ctx, pool)
+	goroutines.Default().SetLimit(cfg.Server.GoroutineLimit)
+	validation.SetPaymentOptionalEntries(cfg.Validation.PaymentOptionalEntries...)
+	validation.SetAllowUnknownStatuses(cfg.Validation.AllowUnknownStatuses)
+	futureDate := cfg.Validation.FutureDate
+	validation.SetFutureDatePolicy(futureDate.MaxSkew, futureDate.Mode == config.FutureDateFlag)
+	totalPriceMode, err := validation.ParseTotalPriceMode(cfg.Validation.TotalPrice.Mode)
 	if err != nil {
 		return err
 	}
-	cc.LoadFromSlice(existingOrders)
-	logger.Printf("loaded %d orders into cache", len(existingOrders))
+	validation.SetTotalPriceMode(totalPriceMode)
+	postalTable, postalMode, err := cfg.Validation.PostalCodes.Compile()
+	if err != nil {
+		return err
+	}
+	validation.SetPostalValidator(postalTable, postalMode)
+	currencyMode, err := validation.ParseCurrencyMode(cfg.Validation.Currency.Mode)
+	if err != nil {
+		return err
+	}
+	validation.SetCurrencyMode(currencyMode)
+	trackPattern, trackMode, err := cfg.Validation.TrackNumber.Compile()
+	if err != nil {
+		return err
+	}
+	validation.SetTrackNumberPolicy(trackPattern, trackMode)
+	rules, err := cfg.Validation.Rules.Compile()
+	if err != nil {
+		return err
+	}
+	validation.SetRules(rules)
+	decodeMode, err := orders.ParseDecodeMode(cfg.Pipeline.Decode)
+	if err != nil {
+		return err
+	}
+	orders.SetDecodeMode(decodeMode)
+
+	if *replayFlag != "" {
+		return replayTopic(ctx, cfg, &pgOrderRepository{pool: pool, timeout: cfg.Database.QueryTimeout}, *replayFlag, *resumeFlag, *replayDLQFlag, logger)
+	}
 
-	// Инициализируем Kafka reader
-	reader := kafka.NewKafkaReader(cfg.Kafka.ToKafkaConfig())
-	defer func() {
-		if cerr := reader.Close(); cerr != nil {
-			logger.Printf("kafka reader close error: %v", cerr)
+	// После переключения основного сервера PostgreSQL пул сбрасывает соединения, не дожидаясь их замены по одному
+	recovery := newDBRecovery(func(ctx context.Context) int { return postgres.ResetIdleConns(ctx, pool) }, pool.Ping, logger)
+	defer recovery.close()
+
+	// Чтения эндпоинтов API выполняются на реплике, если она настроена; недоступная реплика запуск не останавливает
+	var replica *replicaPool
+	if cfg.Database.Replica.Enabled() {
+		replicaConns, err := postgres.NewReplicaClient(cfg.Database.ReplicaPostgresConfig())
+		if err != nil {
+			return err
 		}
-	}()
-	logger.Println("kafka reader ready")
+		defer replicaConns.Close()
+		replica = newReplicaPool(replicaConns, cfg.Database.Replica.Interval(), logger)
+		logger.Printf("database replica %s configured for reads", cfg.Database.Replica.Host)
+	}
 
-	// Проверяем подключение к Kafka
-	wg := startKafkaConsumer(ctx, reader, pool, cc, logger, cfg)
+	app := &App{
+		mode:      mode,
+		cfg:       cfg,
+		logger:    logger,
+		repo:      &pgOrderRepository{pool: pool, replica: replica, timeout: cfg.Database.QueryTimeout},
+		cache:     discardCache{},
+		dbVersion: func(ctx context.Context) (string, error) { return postgres.ServerVersion(ctx, pool) },
+		db:        recovery,
+		replica:   replica,
+		instance:  leader.Instance(),
+	}
+	logger.Printf("instance %s", app.instance)
+	// Удаление устаревших записей выполняет один экземпляр — владелец рекомендательной блокировки PostgreSQL;
+	// блокировка удерживает одно соединение пула
+	if cfg.Leader.Enabled {
+		lockName := cfg.Leader.Lock()
+		app.leader = leader.NewElector(app.instance, leader.NewAdvisoryLock(pool, lockName), func(isLeader bool) {
+			if isLeader {
+				logger.Printf("leader: instance %s acquired lock %q, running singleton jobs", app.instance, lockName)
+			} else {
+				logger.Printf("leader: instance %s lost lock %q, singleton jobs yield", app.instance, lockName)
+			}
+		})
+	}
+	if app.tls, err = newServerTLSConfig(cfg.Server.TLS, logger); err != nil {
+		return err
+	}
+
+	// Кэш нужен только для ответов API
+	if app.runsAPI() {
+		cc, err := cache.NewWithOptions(cfg.Cache.Options()...)
+		if err != nil {
+			return err
+		}
+		defer cc.Close()
+		cc.SetKeepJSON(cfg.Cache.SerializedJSON)
+		cc.SetMissingTTL(cfg.Cache.NegativeTTL)
+		cc.SetMaxPinned(cfg.Cache.MaxPinned)
+		logger.Printf("cache initialized (%d shards, eviction=%s, serialized_json=%t, negative_ttl=%s)", cc.ShardCount(), cc.EvictionPolicy(), cfg.Cache.SerializedJSON, cfg.Cache.NegativeTTL)
+		if d := cc.DemoteAfter(); d > 0 {
+			logger.Printf("cache: entries not accessed for %s are demoted to order headers", d)
+		}
+		if d := cc.L1TTL(); d > 0 {
+			logger.Printf("cache: L1 enabled (%d entries, ttl %s)", cache.L1Size, d)
+		}
+
+		// Загружаем существующие заказы всех арендаторов в кэш; выключенный кэш заполнять незачем
+		if cfg.Cache.IsEnabled() {
+			for _, tenantID := range cfg.TenantIDs() {
+				existingOrders, err := postgres.GetAllOrders(ctx, pool, tenantID)
+				if err != nil {
+					return err
+				}
+				cc.LoadFromSlice(tenantID, existingOrders)
+				logger.Printf("loaded %d orders of tenant %s into cache", len(existingOrders), tenantID)
+			}
+		} else {
+			logger.Println("cache disabled (cache.enabled: false): every read goes to the database")
+		}
+		app.cache = newSwitchableCache(cc, cfg.Cache.IsEnabled())
+	}
 
-	// Запускаем HTTP сервер
-	mux := http.NewServeMux()
-	mux.Handle("/", http.FileServer(http.Dir("../../web")))
-	mux.HandleFunc("/order", makeOrderHandler(cc, logger))
+	// Сравниваем часы сервера с PostgreSQL и, если читаем Kafka, с меткой времени последнего сообщения топика
+	clocks := []clockSource{{name: "postgres", now: func(ctx context.Context) (time.Time, error) { return postgres.ServerTime(ctx, pool) }}}
+	if app.runsConsumer() {
+		clocks = append(clocks, clockSource{name: "kafka latest message", aheadOnly: true, now: func(ctx context.Context) (time.Time, error) {
+			return kafka.LatestMessageTime(ctx, cfg.Kafka.ToKafkaConfig())
+		}})
+	}
+	logClockWarnings(ctx, clocks, futureDate.ClockWarnSkew, logger)
 
-	server := &http.Server{
-		Addr:    cfg.Server.Port,
-		Handler: mux,
+	// Порт открывается до создания читателя Kafka, чтобы при ошибке не оставлять его незакрытым
+	ln, err := net.Listen("tcp", app.addr())
+	if err != nil {
+		return err
 	}
+	defer ln.Close()
 
-	// Настраиваем таймауты для сервера
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+	if app.runsConsumer() {
+		// Топики создаются или проверяются до подключения читателя, чтобы не получать от него невнятных ошибок
+		if err := prepareTopics(ctx, cfg, logger); err != nil {
+			return err
+		}
 
-	// Устанавливаем таймауты для сервера
-	go func() {
-		sig := <-sigCh
-		logger.Printf("shutdown signal: %v", sig)
-		cancel()
+		// Однократный сброс смещений группы (по явному подтверждению)
+		if cfg.Kafka.Consumer.ResetOffsets {
+			if err := resetConsumerOffsets(ctx, cfg, logger); err != nil {
+				return err
+			}
+		}
 
-		shCtx, shCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
-		defer shCancel()
+		// Инициализируем Kafka reader; его закрывает app.Run после остановки консьюмера, не дольше kafka.close_timeout
+		app.reader = kafka.NewKafkaReader(cfg.ConsumerKafkaConfig())
+		logger.Println("kafka reader ready")
 
-		if err := server.Shutdown(shCtx); err != nil {
-			logger.Printf("http shutdown error: %v", err)
-		} else {
-			logger.Println("http server stopped gracefully")
+		// Писатель очереди недоставленных сообщений; его закрывает app.Run после остановки консьюмера
+		if cfg.Kafka.Consumer.UsesDLQ() {
+			dlqCfg := cfg.Kafka.ToKafkaConfig()
+			dlqCfg.Topic = cfg.Kafka.DLQTopic
+			app.dlq = kafka.NewWriter(dlqCfg)
+			logger.Printf("kafka dlq writer ready (topic=%s, max_attempts=%d)", dlqCfg.Topic, cfg.Kafka.Consumer.MaxAttempts)
 		}
-	}()
 
-	// Запускаем HTTP сервер
-	logger.Printf("http server starting on %s", cfg.Server.Port)
-	err = server.ListenAndServe()
-	if err != nil && !errors.Is(err, http.ErrServerClosed) {
-		return err
+		// Писатель подтверждений записи заказов; его закрывает app.Run после остановки консьюмера
+		if cfg.Kafka.Consumer.OrderAck.Enabled {
+			ackCfg := cfg.Kafka.ToKafkaConfig()
+			ackCfg.Topic = cfg.Kafka.Topics.OrderAck
+			app.acks = kafka.NewWriter(ackCfg)
+			logger.Printf("kafka order ack writer ready (topic=%s)", ackCfg.Topic)
+		}
+
+		// После восстановления базы из резервной копии группа могла закоммитить сообщения, заказов которых в базе нет
+		if cfg.Pipeline.StartupGapCheck.Enabled {
+			app.gap = checkStartupGap(ctx, cfg, kafkaGapSource{cfg: cfg.Kafka.ToKafkaConfig()}, app.dlq, app.repo, logger)
+		}
 	}
 
-	// Ждем завершения работы Kafka consumer
-	wg.Wait()
+	if err := app.Run(ctx, ln); err != nil {
+		return err
+	}
 	logger.Println("graceful shutdown complete")
 	return nil
 }
 
-// startKafkaConsumer - запускает Kafka consumer в отдельной горутине
-func startKafkaConsumer(
-	ctx context.Context,
-	reader *kafka2.Reader,
-	pool *pgxpool.Pool, // now v4
-	orderCache OrderCache,
-	logger *log.Logger,
-	cfg *config.Config,
-) *sync.WaitGroup {
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-
-	// Запускаем Kafka consumer в отдельной горутине
-	go func() {
-		defer wg.Done()
-		for {
-			msg, err := reader.ReadMessage(ctx)
-			if err != nil {
-				if errors.Is(err, context.Canceled) || ctx.Err() != nil {
-					logger.Println("kafka consumer stopping (context canceled)")
-					return
+// resetOffsetsConfirmEnv - переменная окружения, значение которой должно совпадать с group_id для сброса смещений
+const resetOffsetsConfirmEnv = "KAFKA_RESET_OFFSETS_CONFIRM"
+
+// resetConsumerOffsets - сбрасывает смещения группы консьюмера на kafka.consumer.start_offset.
+// Операция необратима, поэтому выполняется только при KAFKA_RESET_OFFSETS_CONFIRM=<group_id>.
+func resetConsumerOffsets(ctx context.Context, cfg *config.Config, logger *log.Logger) error {
+	if confirm := os.Getenv(resetOffsetsConfirmEnv); confirm != cfg.Kafka.GroupID {
+		return fmt.Errorf("kafka.consumer.reset_offsets is set: confirm by setting %s=%s", resetOffsetsConfirmEnv, cfg.Kafka.GroupID)
+	}
+
+	resetCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	offsets, err := kafka.ResetGroupOffsets(resetCtx, cfg.Kafka.ToKafkaConfig())
+	if err != nil {
+		return err
+	}
+	logger.Printf("WARNING: consumer group %s offsets reset on topic %s: %v (remove kafka.consumer.reset_offsets from config)",
+		cfg.Kafka.GroupID, cfg.Kafka.Topic, offsets)
+	return nil
+}
+
+// topicsTimeout - ограничение создания и проверки топиков при запуске
+const topicsTimeout = 30 * time.Second
+
+// prepareTopics - при kafka.ensure_topics создает отсутствующие топики консьюмера (cfg.KafkaTopics), иначе проверяет,
+// что они существуют и содержат не меньше kafka.topics.min_partitions партиций
+func prepareTopics(ctx context.Context, cfg *config.Config, logger *log.Logger) error {
+	topicsCtx, cancel := context.WithTimeout(ctx, topicsTimeout)
+	defer cancel()
+
+	topics := cfg.KafkaTopics()
+	if cfg.Kafka.EnsureTopics {
+		if err := kafka.EnsureTopics(topicsCtx, cfg.Kafka.Brokers, topics, cfg.Kafka.Topics.ToTopicSpec()); err != nil {
+			return fmt.Errorf("kafka topics: %w", err)
+		}
+		logger.Printf("kafka topics ensured: %s", strings.Join(topics, ", "))
+		return nil
+	}
+	if err := kafka.VerifyTopics(topicsCtx, cfg.Kafka.Brokers, topics, cfg.Kafka.Topics.MinPartitions); err != nil {
+		if errors.Is(err, kafka.ErrTopicNotReady) {
+			return fmt.Errorf("kafka topics: %w (create the topics or set kafka.ensure_topics: true)", err)
+		}
+		return fmt.Errorf("kafka topics: %w", err)
+	}
+	logger.Printf("kafka topics verified: %s", strings.Join(topics, ", "))
+	return nil
+}
+
+// makeOrderHandler - HTTP обработчик для получения заказа по ID в формате, выбранном по заголовку Accept (render.go).
+// При промахе кэша заказ читается из базы данных через repo; одновременные промахи одного заказа, в том числе
+// пониженного в кэше до заголовка (cache.demote_after), ждут одного чтения. Если база недоступна, возвращается 503.
+// Персональные данные доставки маскируются в ответе согласно pii; заказ в кэше не изменяется. Ответ без маскирования
+// в JSON при попадании в кэш пишется из сериализованного кэшем JSON, если его хранение включено. Выборка попаданий в кэш
+// проверяется по базе данных в фоне (shadow, nil — без проверки); ответ от её результата не зависит.
+func makeOrderHandler(orderCache OrderCache, repo OrderRepository, pii piiPolicy, shadow *shadowVerifier, logger *log.Logger) http.HandlerFunc {
+	loader := newOrderLoader(repo, orderCache)
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, ok := negotiateFormat(w, r)
+		if !ok {
+			return
+		}
+		rawID := r.URL.Query().Get("id")
+		if rawID == "" {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeOrderIDRequired)
+			return
+		}
+
+		id, err := ids.Parse(rawID)
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeOrderIDInvalid)
+			return
+		}
+		orderID := id.String()
+
+		tenantID := tenantFromContext(r.Context())
+		fullAccess := pii.fullAccess(r)
+		if fullAccess && format.mediaType == formatJSON.mediaType {
+			// Заказ без маскирования отдаётся из кэша уже сериализованным (cache.serialized_json)
+			if body, ok := orderCache.GetJSON(tenantID, orderID); ok {
+				if shadow.sample() {
+					if cached, ok := orderCache.Get(tenantID, orderID); ok {
+						shadow.verify(tenantID, orderID, cached, body)
+					}
+				}
+				writeRendered(w, r, formatJSON, body, logger)
+				return
+			}
+		}
+
+		order, ok := orderCache.Get(tenantID, orderID)
+		if !ok {
+			var err error
+			order, err = loader.load(r.Context(), tenantID, orderID)
+			switch {
+			case errors.Is(err, postgres.ErrOrderNotFound):
+				logger.Printf("order %s not found", orderID)
+				writeAPIError(w, r, http.StatusNotFound, errCodeOrderNotFound)
+				return
+			case err != nil:
+				logger.Printf("order %s: db fallback error: %v", orderID, err)
+				if !writeUnavailable(w, r, err) {
+					writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
 				}
-				logger.Printf("kafka read error: %v", err)
-				time.Sleep(cfg.Kafka.Reader.ReadBatchTimeout)
-				continue
+				return
 			}
+		} else if shadow.sample() {
+			shadow.verify(tenantID, orderID, order, nil)
+		}
+		if !fullAccess {
+			order = redactOrder(order)
+		}
+
+		render(w, r, format, order, logger)
+	}
+}
 
-			logger.Printf("kafka message received: %s", string(msg.Value))
+// orderExistsHeader - заголовок ответа HEAD /orders/{id} с результатом проверки для прокси, искажающих ответы на HEAD
+const orderExistsHeader = "X-Order-Exists"
 
-			var order orders.Order
-			if err := json.Unmarshal(msg.Value, &order); err != nil {
-				logger.Printf("json unmarshal error: %v", err)
-				continue
+// makeOrderExistsHandler - HTTP обработчик HEAD /orders/{id}: 200 или 404 без тела и заголовок X-Order-Exists.
+// Сначала проверяется кэш, в том числе запомненное отсутствие заказа и заказы, пониженные до заголовка, затем база
+// данных запросом без загрузки заказа; найденный в базе заказ в кэш не попадает, а отсутствующий запоминается
+// (cache.negative_ttl).
+func makeOrderExistsHandler(orderCache OrderCache, repo OrderRepository, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := ids.Parse(r.PathValue("id"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		orderID := id.String()
+
+		tenantID := tenantFromContext(r.Context())
+		exists := false
+		switch {
+		case orderCache.Contains(tenantID, orderID):
+			exists = true
+		case orderCache.IsMissing(tenantID, orderID):
+		default:
+			var err error
+			// Отсутствие заказа запоминается в кэше, поэтому проверяется на основной базе, а не на отставшей реплике
+			exists, err = repo.ExistsOrder(withPrimaryRead(r.Context()), tenantID, orderID)
+			if err != nil {
+				logger.Printf("[%s] order %s: exists check error: %v", requestIDFromContext(r.Context()), orderID, err)
+				if !writeUnavailable(w, r, err) {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+				return
 			}
-			if err := validation.ValidateOrder(&order); err != nil {
-				logger.Printf("validation error (skip message): %v", err)
-				continue
+			if !exists {
+				orderCache.MarkMissing(tenantID, orderID)
 			}
+		}
 
-			if err := postgres.InsertOrder(ctx, pool, &order); err != nil {
-				logger.Printf("db insert error (order=%s): %v", order.OrderUid, err)
-				continue
-			}
-			logger.Printf("order %s stored", order.OrderUid)
+		w.Header().Set(orderExistsHeader, strconv.FormatBool(exists))
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// maxSearchPageSize - наибольший (и используемый по умолчанию) размер страницы GET /orders
+const maxSearchPageSize = 100
+
+// orderSearchPage - страница ответа GET /orders; NextCursor пуст на последней странице
+type orderSearchPage struct {
+	XMLName    xml.Name       `json:"-" xml:"orders"`
+	Orders     []orders.Order `json:"orders" xml:"order"`
+	NextCursor string         `json:"next_cursor,omitempty" xml:"next_cursor,omitempty"`
+}
 
-			orderCache.Set(order)
-			logger.Printf("order %s cached", order.OrderUid)
+// newCursorSigner - создает подпись курсоров по конфигурации; без секрета используется случайный секрет процесса
+func newCursorSigner(cfg config.CursorConfig, logger *log.Logger) *pagination.Signer {
+	secret := cfg.SigningSecret()
+	if secret == nil {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(fmt.Sprintf("generate cursor secret: %v", err))
 		}
-	}()
+		logger.Printf("server.cursor.secret is not set: cursors are signed with a random key and become invalid after restart (set %s)", config.CursorSecretEnv)
+	}
+	signer, err := pagination.NewSigner(secret, cfg.TTL)
+	if err != nil {
+		panic(err) // секрет выше всегда непустой
+	}
+	return signer
+}
+
+// includeSections - значения параметра include списков заказов
+var includeSections = map[string]postgres.Include{
+	"delivery": postgres.IncludeDelivery,
+	"payment":  postgres.IncludePayment,
+	"items":    postgres.IncludeItems,
+	"all":      postgres.IncludeAll,
+}
+
+// parseInclude - разбирает параметр include: разделы заказа через запятую (delivery, payment, items или all).
+// Пустое значение — только заголовки заказов. false вторым значением, если раздел name неизвестен.
+func parseInclude(raw string) (include postgres.Include, name string, ok bool) {
+	include = postgres.IncludeNone
+	if raw == "" {
+		return include, "", true
+	}
+	for _, name := range strings.Split(raw, ",") {
+		section, ok := includeSections[strings.TrimSpace(name)]
+		if !ok {
+			return 0, name, false
+		}
+		include |= section
+	}
+	return include, "", true
+}
+
+// listPageParams - параметры страницы списка заказов: порядок, размер страницы, разделы и позиция после курсора
+type listPageParams struct {
+	sortBy  string
+	limit   int
+	include postgres.Include
+	after   *postgres.SortCursor // nil — первая страница
+}
+
+// parseListPage - разбирает параметры sort, limit, include и cursor страницы списка заказов. Курсор должен быть выдан
+// для того же запроса scope и того же порядка. При ошибке отвечает 400 и возвращает false.
+func parseListPage(w http.ResponseWriter, r *http.Request, cursors *pagination.Signer, scope string) (listPageParams, bool) {
+	q := r.URL.Query()
+	p := listPageParams{sortBy: q.Get("sort"), limit: maxSearchPageSize}
+	if p.sortBy != "" && !postgres.ValidSort(p.sortBy) {
+		writeAPIError(w, r, http.StatusBadRequest, errCodeSortInvalid)
+		return p, false
+	}
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxSearchPageSize {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeLimitInvalid, maxSearchPageSize)
+			return p, false
+		}
+		p.limit = n
+	}
+	include, name, ok := parseInclude(q.Get("include"))
+	if !ok {
+		writeAPIError(w, r, http.StatusBadRequest, errCodeIncludeInvalid, name)
+		return p, false
+	}
+	p.include = include
+
+	if token := q.Get("cursor"); token != "" {
+		c, err := cursors.Decode(token)
+		if errors.Is(err, pagination.ErrExpiredCursor) {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeCursorExpired)
+			return p, false
+		} else if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeCursorInvalid)
+			return p, false
+		}
+		if c.Scope != scope || (p.sortBy != "" && p.sortBy != c.Sort) {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeCursorMismatch)
+			return p, false
+		}
+		p.sortBy = c.Sort
+		p.after = &postgres.SortCursor{Value: c.Value, OrderUid: c.OrderUid}
+	}
+	if p.sortBy == "" {
+		p.sortBy = postgres.SortDateCreated
+	}
+	return p, true
+}
+
+// writeListPage - отвечает страницей списка заказов list, прочитанного с ограничением p.limit+1: лишний заказ
+// показывает, что есть следующая страница, и её курсор выдаётся для запроса scope
+func writeListPage(w http.ResponseWriter, r *http.Request, format responseFormat, list []orders.Order, p listPageParams, scope string,
+	cursors *pagination.Signer, pii piiPolicy, logger *log.Logger) {
+	page := orderSearchPage{Orders: list}
+	if len(list) > p.limit {
+		page.Orders = list[:p.limit]
+		last := page.Orders[p.limit-1]
+		page.NextCursor = cursors.Encode(pagination.Cursor{Scope: scope, Sort: p.sortBy, Value: postgres.SortValue(last, p.sortBy), OrderUid: last.OrderUid})
+	}
+	if page.Orders == nil {
+		page.Orders = []orders.Order{}
+	}
+	if !pii.fullAccess(r) {
+		for i := range page.Orders {
+			page.Orders[i] = redactOrder(page.Orders[i])
+		}
+	}
 
-	return wg
+	render(w, r, format, page, logger)
 }
 
-// makeOrderHandler - HTTP обработчик для получения заказа по ID
-func makeOrderHandler(orderCache OrderCache, logger *log.Logger) http.HandlerFunc {
+// makeOrderSearchHandler - HTTP обработчик, возвращающий страницу заказов с трек-номером из параметра track_number.
+// Трек-номер нормализуется так же, как при приёме заказов (validation.NormalizeTrackNumber), поэтому поиск не зависит
+// от регистра и пробелов по краям.
+// Параметр sort задаёт порядок: date_created (по умолчанию), stored_at или updated_at; limit — размер страницы (до 100).
+// Список содержит заголовки заказов: доставка, платежи и товары загружаются и выводятся, только если они перечислены
+// в параметре include; это действует в любом формате ответа (render.go).
+// Параметр source оставляет только заказы с этим источником (kafka, http, replay, dlq_replay или unknown); сам источник
+// в ответе не выводится.
+// Следующая страница запрашивается с параметром cursor из next_cursor предыдущего ответа; поддельный, просроченный
+// или относящийся к другому запросу курсор отклоняется с 400.
+func makeOrderSearchHandler(repo OrderRepository, pii piiPolicy, cursors *pagination.Signer, logger *log.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		orderID := r.URL.Query().Get("id")
-		if orderID == "" {
-			http.Error(w, "order id is required", http.StatusBadRequest)
+		format, ok := negotiateFormat(w, r)
+		if !ok {
+			return
+		}
+		reqID := requestIDFromContext(r.Context())
+		trackNumber := validation.NormalizeTrackNumber(r.URL.Query().Get("track_number"))
+		if trackNumber == "" {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeTrackNumberRequired)
 			return
 		}
 
-		if !validation.ValidateOrderID(orderID) {
-			http.Error(w, "invalid order id format", http.StatusBadRequest)
+		source, err := parseSourceParam(r.URL.Query().Get(sourceParam))
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeSourceInvalid, strings.Join(orderSources, ", "))
 			return
 		}
 
-		order, ok := orderCache.Get(orderID)
+		// Курсор привязан к арендатору, трек-номеру и источнику: его нельзя применить к другому запросу
+		tenantID := tenantFromContext(r.Context())
+		scope := tenantID + "/orders?track_number=" + trackNumber
+		if source != "" {
+			scope += "&source=" + source
+		}
+		p, ok := parseListPage(w, r, cursors, scope)
 		if !ok {
-			logger.Printf("order %s not found", orderID)
-			http.Error(w, "order not found", http.StatusNotFound)
 			return
 		}
 
+		// Лишний заказ показывает, есть ли следующая страница
+		list, err := repo.FindOrdersByTrackNumber(r.Context(), tenantID, trackNumber, p.sortBy, p.after, p.limit+1, p.include, source)
+		if err != nil {
+			logger.Printf("[%s] search: db error (track_number=%q): %v", reqID, trackNumber, err)
+			if !writeUnavailable(w, r, err) {
+				writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			}
+			return
+		}
+		writeListPage(w, r, format, list, p, scope, cursors, pii, logger)
+	}
+}
+
+// makeItemStatusesHandler - HTTP обработчик, возвращающий известные статусы товаров с метками для отображения в веб интерфейсе
+func makeItemStatusesHandler(logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(order); err != nil {
-			logger.Printf("encode error: %v", err)
+		if err := json.NewEncoder(w).Encode(orders.ItemStatuses()); err != nil {
+			logger.Printf("[%s] encode error: %v", requestIDFromContext(r.Context()), err)
 		}
 	}
 }
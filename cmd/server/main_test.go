@@ -0,0 +1,12 @@
+package main
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// TestMain - после тестов пакета проверяет, что они не оставили работающих горутин
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
@@ -0,0 +1,214 @@
+// Описание: HTTP middleware сервера: идентификатор запроса, заголовки безопасности, авторизация административных эндпоинтов
+// и определение арендатора запроса
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength - максимальная длина идентификатора запроса, принимаемого от клиента
+	maxRequestIDLength = 64
+)
+
+type requestIDKey struct{}
+
+// withRequestID - middleware, присваивающее каждому запросу идентификатор (из заголовка X-Request-ID или сгенерированный)
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Идентификатор клиента возвращается в заголовке ответа и попадает в логи, поэтому принимается только безопасный
+		id := r.Header.Get(requestIDHeader)
+		if !isValidRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestIDFromContext - возвращает идентификатор запроса из контекста или "-", если он не задан
+func requestIDFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok && id != "" {
+		return id
+	}
+	return "-"
+}
+
+// isValidRequestID - проверяет, что идентификатор запроса непустой, не длиннее maxRequestIDLength
+// и состоит только из букв, цифр и символов '-', '_', '.', ':'
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r == '-' || r == '_' || r == '.' || r == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID - генерирует случайный идентификатор запроса
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestAPIKey - возвращает ключ API из заголовка X-API-Key или Authorization: Bearer
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// apiKeyID - несекретный идентификатор ключа API для журналов и истории изменений: префикс SHA-256 ключа
+func apiKeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:6])
+}
+
+// requireAdmin - middleware, пропускающее запрос только при наличии корректного административного ключа
+// в заголовке X-API-Key или Authorization: Bearer. Пустой ключ в конфигурации запрещает доступ полностью.
+func requireAdmin(apiKey string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiKey == "" || subtle.ConstantTimeCompare([]byte(requestAPIKey(r)), []byte(apiKey)) != 1 {
+			writeAPIError(w, r, http.StatusUnauthorized, errCodeUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tenantHeader - заголовок, которым запрос явно указывает арендатора
+const tenantHeader = "X-Tenant-ID"
+
+type tenantKey struct{}
+
+// tenantResolver - определяет арендатора запроса по ключу API или заголовку X-Tenant-ID
+type tenantResolver struct {
+	declared map[string]bool   // объявленные арендаторы; пусто — единственный арендатор tenant.Default
+	keys     map[string]string // арендаторы по ключам API
+}
+
+// newTenantResolver - создает tenantResolver по секции tenants конфигурации
+func newTenantResolver(cfg *config.Config) *tenantResolver {
+	tr := &tenantResolver{declared: make(map[string]bool), keys: cfg.TenantAPIKeys()}
+	for _, t := range cfg.Tenants {
+		tr.declared[t.ID] = true
+	}
+	return tr
+}
+
+// resolve - возвращает арендатора запроса либо HTTP статус и код ошибки. Ключ API, привязанный к арендатору, определяет его
+// сам, а заголовок X-Tenant-ID с другим арендатором отклоняется с 403. Без такого ключа арендатор берётся из заголовка
+// и должен быть объявлен. Без секции tenants все запросы относятся к tenant.Default.
+func (tr *tenantResolver) resolve(r *http.Request) (string, int, string) {
+	header := r.Header.Get(tenantHeader)
+	if len(tr.declared) == 0 {
+		if header != "" && header != tenant.Default {
+			return "", http.StatusBadRequest, errCodeTenantUnknown
+		}
+		return tenant.Default, 0, ""
+	}
+	if id, ok := tr.keys[requestAPIKey(r)]; ok {
+		if header != "" && header != id {
+			return "", http.StatusForbidden, errCodeTenantForbidden
+		}
+		return id, 0, ""
+	}
+	if header == "" {
+		return "", http.StatusBadRequest, errCodeTenantRequired
+	}
+	if !tr.declared[header] {
+		return "", http.StatusBadRequest, errCodeTenantUnknown
+	}
+	return header, 0, ""
+}
+
+// withTenant - middleware, определяющее арендатора запроса; обработчики читают и записывают только его заказы
+func (tr *tenantResolver) withTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, status, code := tr.resolve(r)
+		if status != 0 {
+			writeAPIError(w, r, status, code)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, id)))
+	})
+}
+
+// tenantFromContext - возвращает арендатора запроса или пустую строку, если запрос не прошёл через withTenant:
+// функции репозитория отклоняют пустого арендатора
+func tenantFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(tenantKey{}).(string)
+	return id
+}
+
+// Значения заголовков безопасности по умолчанию
+const (
+	defaultContentTypeOptions    = "nosniff"
+	defaultFrameOptions          = "DENY"
+	defaultReferrerPolicy        = "no-referrer"
+	defaultContentSecurityPolicy = "default-src 'self'; object-src 'none'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'"
+)
+
+// securityHeaderValue - возвращает значение заголовка с учётом конфигурации: пустое — значение по умолчанию,
+// config.SecurityHeaderOff — пустая строка (заголовок не выставляется)
+func securityHeaderValue(configured, def string) string {
+	switch {
+	case configured == "":
+		return def
+	case strings.EqualFold(configured, config.SecurityHeaderOff):
+		return ""
+	default:
+		return configured
+	}
+}
+
+// withSecurityHeaders - middleware, выставляющее заголовки безопасности X-Content-Type-Options, X-Frame-Options и Referrer-Policy
+// для всех ответов
+func withSecurityHeaders(cfg config.SecurityHeadersConfig, next http.Handler) http.Handler {
+	headers := map[string]string{
+		"X-Content-Type-Options": securityHeaderValue(cfg.ContentTypeOptions, defaultContentTypeOptions),
+		"X-Frame-Options":        securityHeaderValue(cfg.FrameOptions, defaultFrameOptions),
+		"Referrer-Policy":        securityHeaderValue(cfg.ReferrerPolicy, defaultReferrerPolicy),
+	}
+	for name, value := range headers {
+		if value == "" {
+			delete(headers, name)
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, value := range headers {
+			w.Header().Set(name, value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withContentSecurityPolicy - middleware, выставляющее Content-Security-Policy для статических страниц
+func withContentSecurityPolicy(cfg config.SecurityHeadersConfig, next http.Handler) http.Handler {
+	csp := securityHeaderValue(cfg.ContentSecurityPolicy, defaultContentSecurityPolicy)
+	if csp == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", csp)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,143 @@
+// Описание: Тесты HTTP middleware сервера: заголовки безопасности и защита от внедрения заголовков через идентификаторы
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSecuredMux - собирает статические страницы и /order с теми же middleware, что и сервер
+func newSecuredMux(t *testing.T, cfg config.SecurityHeadersConfig) http.Handler {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html></html>"), 0o644))
+
+	c := newTestCache(t)
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-1"})
+
+	mux := http.NewServeMux()
+	mux.Handle("/", withContentSecurityPolicy(cfg, http.FileServer(http.Dir(dir))))
+	mux.HandleFunc("/order", withDefaultTenant(makeOrderHandler(c, &fakeRepository{}, piiPolicy{}, nil, newTestLogger())))
+	return withRequestID(withSecurityHeaders(cfg, mux))
+}
+
+func serve(h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSecurityHeadersDefaults(t *testing.T) {
+	h := newSecuredMux(t, config.SecurityHeadersConfig{})
+
+	static := serve(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, static.Code)
+	api := serve(h, httptest.NewRequest(http.MethodGet, "/order?id=order-1", nil))
+	require.Equal(t, http.StatusOK, api.Code)
+	notFound := serve(h, httptest.NewRequest(http.MethodGet, "/order?id=missing", nil))
+	require.Equal(t, http.StatusNotFound, notFound.Code)
+
+	for name, rec := range map[string]*httptest.ResponseRecorder{"static": static, "api": api, "error": notFound} {
+		assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"), name)
+		assert.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"), name)
+		assert.Equal(t, "no-referrer", rec.Header().Get("Referrer-Policy"), name)
+	}
+	assert.Equal(t, defaultContentSecurityPolicy, static.Header().Get("Content-Security-Policy"))
+	assert.Empty(t, api.Header().Get("Content-Security-Policy"), "CSP applies to static pages only")
+}
+
+func TestSecurityHeadersOverrideAndDisable(t *testing.T) {
+	h := newSecuredMux(t, config.SecurityHeadersConfig{
+		FrameOptions:          "SAMEORIGIN",
+		ReferrerPolicy:        config.SecurityHeaderOff,
+		ContentSecurityPolicy: "OFF",
+	})
+
+	rec := serve(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "SAMEORIGIN", rec.Header().Get("X-Frame-Options"))
+	assert.NotContains(t, rec.Header(), "Referrer-Policy")
+	assert.NotContains(t, rec.Header(), "Content-Security-Policy")
+}
+
+func TestOrderIDCannotInjectHeaders(t *testing.T) {
+	h := newSecuredMux(t, config.SecurityHeadersConfig{})
+
+	for _, id := range []string{
+		"order-1%0d%0aSet-Cookie:%20session=evil",
+		"order-1%0aX-Injected:%201",
+		"%3Cscript%3Ealert(1)%3C/script%3E",
+	} {
+		rec := serve(h, httptest.NewRequest(http.MethodGet, "/order?id="+id, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, id)
+		assert.NotContains(t, rec.Header(), "Set-Cookie", id)
+		assert.NotContains(t, rec.Header(), "X-Injected", id)
+		body := rec.Body.String()
+		assert.NotContains(t, body, "Set-Cookie", id)
+		assert.NotContains(t, body, "<script>", id)
+	}
+}
+
+func TestRequestIDHeaderIsSanitized(t *testing.T) {
+	h := newSecuredMux(t, config.SecurityHeadersConfig{})
+
+	req := httptest.NewRequest(http.MethodGet, "/order?id=order-1", nil)
+	req.Header.Set(requestIDHeader, "abc\r\nSet-Cookie: session=evil")
+	rec := serve(h, req)
+	got := rec.Header().Get(requestIDHeader)
+	assert.NotEmpty(t, got)
+	assert.False(t, strings.ContainsAny(got, "\r\n :"), "client id with CRLF must be replaced, got %q", got)
+	assert.NotContains(t, rec.Header(), "Set-Cookie")
+
+	req = httptest.NewRequest(http.MethodGet, "/order?id=order-1", nil)
+	req.Header.Set(requestIDHeader, "trace-42.a_b")
+	assert.Equal(t, "trace-42.a_b", serve(h, req).Header().Get(requestIDHeader))
+
+	req = httptest.NewRequest(http.MethodGet, "/order?id=order-1", nil)
+	req.Header.Set(requestIDHeader, strings.Repeat("a", maxRequestIDLength+1))
+	assert.Len(t, serve(h, req).Header().Get(requestIDHeader), 16)
+}
+
+func TestTenantResolver(t *testing.T) {
+	single := newTenantResolver(&config.Config{})
+	multi := newTenantResolver(withTestTenants(newConsumerTestConfig()))
+	cases := map[string]struct {
+		resolver *tenantResolver
+		headers  map[string]string
+		want     string
+		status   int
+	}{
+		"single tenant without header":      {single, nil, tenant.Default, 0},
+		"single tenant with default header": {single, map[string]string{tenantHeader: tenant.Default}, tenant.Default, 0},
+		"single tenant with other header":   {single, map[string]string{tenantHeader: "market-a"}, "", http.StatusBadRequest},
+		"header":                            {multi, map[string]string{tenantHeader: "market-b"}, "market-b", 0},
+		"api key":                           {multi, map[string]string{"Authorization": "Bearer key-a"}, "market-a", 0},
+		"api key with matching header":      {multi, map[string]string{"X-API-Key": "key-a", tenantHeader: "market-a"}, "market-a", 0},
+		"api key of another tenant":         {multi, map[string]string{"X-API-Key": "key-a", tenantHeader: "market-b"}, "", http.StatusForbidden},
+		"unmapped key without header":       {multi, map[string]string{"X-API-Key": testAdminKey}, "", http.StatusBadRequest},
+		"undeclared tenant":                 {multi, map[string]string{tenantHeader: "market-c"}, "", http.StatusBadRequest},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/order", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			id, status, _ := tc.resolver.resolve(req)
+			assert.Equal(t, tc.want, id)
+			assert.Equal(t, tc.status, status)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// Описание: Бенчмарки горячих путей с JSON для крупного заказа: ответ /order на попадание в кэш (сериализация в буфер
+// из jsonpool при каждом запросе против JSON, сохранённого в кэше, cache.serialized_json) и декодирование сообщения
+// консьюмером.
+// Запуск: go test -run '^$' -bench 'OrderHandlerCacheHit|ConsumerDecode' -benchmem ./cmd/server/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"l0_test_self/internal/cache"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	kafka2 "github.com/segmentio/kafka-go"
+)
+
+// BenchmarkOrderHandlerCacheHit - бенчмарк чтения заказа из кэша с testorders.DefaultMaxItems товарами
+func BenchmarkOrderHandlerCacheHit(b *testing.B) {
+	order := testorders.NewGenerator(1).Order(testorders.ScenarioMaximal)
+	for name, keepJSON := range map[string]bool{"encoder": false, "serialized": true} {
+		b.Run(name, func(b *testing.B) {
+			c, err := cache.NewWithOptions(cache.WithShards(4))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Cleanup(c.Close)
+			c.SetKeepJSON(keepJSON)
+			c.Set(tenant.Default, order)
+			h := withDefaultTenant(makeOrderHandler(c, &fakeRepository{}, piiPolicy{}, nil, newTestLogger()))
+			req := httptest.NewRequest(http.MethodGet, "/order?id="+order.OrderUid, nil)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+				if rec.Code != http.StatusOK {
+					b.Fatalf("status %d", rec.Code)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkConsumerDecode - бенчмарк декодирования и валидации сообщения с заказом из testorders.DefaultMaxItems
+// товаров в режиме декодирования по умолчанию (lenient)
+func BenchmarkConsumerDecode(b *testing.B) {
+	prev := orders.CurrentDecodeMode()
+	orders.SetDecodeMode(orders.DecodeLenient)
+	b.Cleanup(func() { orders.SetDecodeMode(prev) })
+	value, err := json.Marshal(testorders.NewGenerator(1).Order(testorders.ScenarioMaximal))
+	if err != nil {
+		b.Fatal(err)
+	}
+	c := newConsumer(nil, nil, &fakeRepository{}, nil, newTestLogger(), newConsumerTestConfig(), nil)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Каждое сообщение со своим смещением, чтобы его не отсеяла проверка повторной доставки
+		msg := kafka2.Message{Topic: "orders", Offset: int64(i), Value: value}
+		if _, _, ok, _ := c.decode(ctx, msg); !ok {
+			b.Fatal("message not decoded")
+		}
+	}
+}
@@ -0,0 +1,459 @@
+// Описание: Тесты обработчиков /order и /orders: чтение из базы при промахе кэша, выключатель чтений при отказах базы,
+// сортировка и постраничная выдача по курсорам
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/breaker"
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/pagination"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errDBOverloaded = errors.New("too many connections")
+
+func getOrder(t *testing.T, h http.Handler, id string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/order?id="+id, nil))
+	return rec
+}
+
+func newTestReadBreaker(cooldown time.Duration) *breaker.Breaker {
+	return newTestReadBreakerClock(cooldown, clock.Real)
+}
+
+// newTestReadBreakerClock - выключатель чтений тестов с часами clk
+func newTestReadBreakerClock(cooldown time.Duration, clk clock.Clock) *breaker.Breaker {
+	return newReadBreaker(config.BreakerConfig{
+		WindowSize:       4,
+		MinRequests:      4,
+		FailureRate:      0.5,
+		Cooldown:         cooldown,
+		HalfOpenRequests: 1,
+	}, clk, newTestLogger())
+}
+
+func TestOrderHandlerFallsBackToDB(t *testing.T) {
+	c := newTestCache(t)
+	repo := &fakeRepository{orders: map[string]orders.Order{"order-1": {OrderUid: "order-1", TrackNumber: "DB"}}}
+	h := withDefaultTenant(makeOrderHandler(c, newBreakerRepository(repo, newTestReadBreaker(time.Minute), time.Second), piiPolicy{}, nil, newTestLogger()))
+
+	rec := getOrder(t, h, "order-1")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var got orders.Order
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, "DB", got.TrackNumber)
+
+	// Второй запрос обслуживается из кэша
+	require.Equal(t, http.StatusOK, getOrder(t, h, "order-1").Code)
+	assert.Equal(t, 1, repo.reads)
+
+	assert.Equal(t, http.StatusNotFound, getOrder(t, h, "missing").Code)
+}
+
+func TestOrderHandlerServesMixedCaseOrdersLowercase(t *testing.T) {
+	// Заказ, сохранённый до единых правил идентификаторов, загружается в кэш с буквами в верхнем регистре
+	c := newTestCache(t)
+	c.LoadFromSlice(tenant.Default, []orders.Order{{OrderUid: "Legacy-ORDER-1", TrackNumber: "OLD"}})
+	repo := &fakeRepository{}
+	h := withDefaultTenant(makeOrderHandler(c, repo, piiPolicy{}, nil, newTestLogger()))
+
+	for _, id := range []string{"legacy-order-1", "LEGACY-ORDER-1", "Legacy-ORDER-1"} {
+		rec := getOrder(t, h, id)
+		require.Equal(t, http.StatusOK, rec.Code, id)
+		var got orders.Order
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		assert.Equal(t, "legacy-order-1", got.OrderUid)
+		assert.Equal(t, "OLD", got.TrackNumber)
+	}
+	assert.Zero(t, repo.reads, "every spelling is served from the cache")
+
+	assert.Equal(t, http.StatusBadRequest, getOrder(t, h, "legacy_order_1").Code)
+	assert.Equal(t, http.StatusBadRequest, getOrder(t, h, strings.Repeat("a", 65)).Code)
+}
+
+func TestOrderHandlerBreakerOpensAndRecovers(t *testing.T) {
+	c := newTestCache(t)
+	repo := &fakeRepository{
+		orders:   map[string]orders.Order{"order-1": {OrderUid: "order-1"}},
+		readErrs: []error{errDBOverloaded, nil, errDBOverloaded, errDBOverloaded, errDBOverloaded},
+	}
+	clk := clock.NewFake(time.Now())
+	br := newTestReadBreakerClock(time.Second, clk)
+	h := withDefaultTenant(makeOrderHandler(c, newBreakerRepository(repo, br, time.Second), piiPolicy{}, nil, newTestLogger()))
+
+	// Промахи по несуществующим заказам — ответы базы, а не отказы
+	assert.Equal(t, http.StatusInternalServerError, getOrder(t, h, "a").Code)
+	assert.Equal(t, http.StatusNotFound, getOrder(t, h, "b").Code)
+	assert.Equal(t, http.StatusInternalServerError, getOrder(t, h, "c").Code)
+	assert.Equal(t, breaker.StateClosed, br.State())
+	assert.Equal(t, http.StatusInternalServerError, getOrder(t, h, "d").Code)
+	assert.Equal(t, breaker.StateOpen, br.State())
+
+	// В разомкнутом состоянии промах кэша не доходит до базы
+	reads := repo.reads
+	rec := getOrder(t, h, "order-1")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.Equal(t, reads, repo.reads)
+
+	// После паузы неудачная проба снова размыкает выключатель, а успешная замыкает
+	clk.Advance(time.Second)
+	assert.Equal(t, http.StatusInternalServerError, getOrder(t, h, "order-1").Code)
+	assert.Equal(t, breaker.StateOpen, br.State())
+	clk.Advance(time.Second)
+	assert.Equal(t, http.StatusOK, getOrder(t, h, "order-1").Code)
+	assert.Equal(t, breaker.StateClosed, br.State())
+}
+
+func TestBreakerRepositoryDoesNotGuardWrites(t *testing.T) {
+	br := newTestReadBreaker(time.Minute)
+	repo := &fakeRepository{err: errDBOverloaded}
+	readRepo := newBreakerRepository(repo, br, time.Second)
+	for i := 0; i < 4; i++ {
+		_, _ = readRepo.GetOrderByUID(t.Context(), tenant.Default, "order-1")
+	}
+	require.Equal(t, breaker.StateOpen, br.State())
+
+	// Запись консьюмера идёт мимо выключателя и доходит до базы
+	repo.err = nil
+	require.NoError(t, readRepo.InsertOrder(t.Context(), tenant.Default, &orders.Order{OrderUid: "order-1"}, nil))
+	assert.Equal(t, 1, repo.inserts)
+}
+
+func TestConsumerStatusReportsBreakerState(t *testing.T) {
+	br := newTestReadBreaker(time.Minute)
+	mux := http.NewServeMux()
+	mux.Handle("GET /admin/consumer/status", requireAdmin(testAdminKey, makeConsumerStatusHandler("", br, nil, nil, nil, nil, newTestLogger())))
+
+	readRepo := newBreakerRepository(&fakeRepository{err: errDBOverloaded}, br, time.Second)
+	for i := 0; i < 4; i++ {
+		_, _ = readRepo.GetOrderByUID(t.Context(), tenant.Default, "order-1")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/consumer/status", nil)
+	req.Header.Set("X-API-Key", testAdminKey)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var got consumerStatusResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, config.PipelineModeSync, got.PipelineMode)
+	assert.Equal(t, "open", got.DBReadBreaker.State)
+	assert.Equal(t, 4, got.DBReadBreaker.Failures)
+	assert.Greater(t, got.DBReadBreaker.RetryAfter, 0.0)
+}
+
+func TestItemStatusesHandler(t *testing.T) {
+	app := &App{mode: modeAPI, cfg: newConsumerTestConfig(), logger: newTestLogger(), repo: &fakeRepository{}, cache: newTestCache(t)}
+	rec := httptest.NewRecorder()
+	app.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/meta/statuses", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var got []orders.StatusLabel
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, orders.ItemStatuses(), got)
+	assert.Contains(t, rec.Body.String(), `{"code":202,"label":"in_transit"}`)
+}
+
+func TestOrderHandlerReturnsItemStatusLabels(t *testing.T) {
+	c := newTestCache(t)
+	order := orders.Order{OrderUid: "order-1", Items: []orders.Item{{Status: orders.ItemStatusDelivered}, {Status: 999}}}
+	c.Set(tenant.Default, order)
+
+	rec := getOrder(t, withDefaultTenant(makeOrderHandler(c, &fakeRepository{}, piiPolicy{}, nil, newTestLogger())), "order-1")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Items []struct {
+			Status orders.StatusLabel `json:"status"`
+		} `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Len(t, body.Items, 2)
+	assert.Equal(t, orders.StatusLabel{Code: orders.ItemStatusDelivered, Label: "delivered"}, body.Items[0].Status)
+	assert.Equal(t, orders.StatusLabel{Code: 999, Label: "unknown"}, body.Items[1].Status)
+
+	var decoded orders.Order
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &decoded))
+	assert.Equal(t, order.Items, decoded.Items)
+}
+
+func TestOrderSearchHandlerSort(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	repo := &fakeRepository{orders: map[string]orders.Order{
+		"order-a": {OrderUid: "order-a", TrackNumber: "TRACK-1", DateCreated: base, StoredAt: base.Add(time.Hour), UpdatedAt: base.Add(3 * time.Hour)},
+		"order-b": {OrderUid: "order-b", TrackNumber: "TRACK-1", DateCreated: base.Add(-time.Hour), StoredAt: base.Add(2 * time.Hour), UpdatedAt: base.Add(2 * time.Hour)},
+	}}
+	h := withDefaultTenant(makeOrderSearchHandler(repo, piiPolicy{}, newTestCursorSigner(t), newTestLogger()))
+
+	for sortBy, want := range map[string][]string{
+		"":             {"order-b", "order-a"},
+		"date_created": {"order-b", "order-a"},
+		"stored_at":    {"order-a", "order-b"},
+		"updated_at":   {"order-b", "order-a"},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders?track_number=TRACK-1&sort="+sortBy, nil))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var page orderSearchPage
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		require.Len(t, page.Orders, 2)
+		assert.Equal(t, want, []string{page.Orders[0].OrderUid, page.Orders[1].OrderUid}, sortBy)
+		assert.Empty(t, page.NextCursor)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders?track_number=TRACK-1&sort=price", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestOrderSearchHandlerNormalizesTrackNumber(t *testing.T) {
+	// Трек-номер хранится в нормализованном виде: при приёме или после cmd/normalizetracks
+	repo := &fakeRepository{orders: map[string]orders.Order{
+		"order-a": {OrderUid: "order-a", TrackNumber: "WBILMTESTTRACK"},
+	}}
+	h := withDefaultTenant(makeOrderSearchHandler(repo, piiPolicy{}, newTestCursorSigner(t), newTestLogger()))
+
+	for _, query := range []string{"WBILMTESTTRACK", "wbilmtesttrack", "%20WbIlmTestTrack%20", "%EF%BD%97%EF%BD%82ILMTESTTRACK"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders?track_number="+query, nil))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var page orderSearchPage
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		require.Len(t, page.Orders, 1, query)
+		assert.Equal(t, "order-a", page.Orders[0].OrderUid)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders?track_number=%20%20", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "a blank track number is missing")
+}
+
+func TestOrderSearchHandlerIncludeSections(t *testing.T) {
+	repo := &fakeRepository{orders: map[string]orders.Order{"order-1": {
+		OrderUid:    "order-1",
+		TrackNumber: "TRACK-1",
+		Delivery:    orders.Delivery{Name: "Test Testov"},
+		Payments:    []orders.Payment{{Transaction: "order-1"}},
+		Items:       []orders.Item{{ChrtId: 1}},
+	}}}
+	h := withDefaultTenant(makeOrderSearchHandler(repo, piiPolicy{}, newTestCursorSigner(t), newTestLogger()))
+
+	for query, want := range map[string][]string{
+		"":                          nil,
+		"&include=items":            {"items"},
+		"&include=delivery,payment": {"delivery", "payments", "payment"},
+		"&include=all":              {"delivery", "payments", "payment", "items"},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders?track_number=TRACK-1"+query, nil))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		// Незагруженные разделы отсутствуют в ответе, а не выводятся пустыми
+		var page struct {
+			Orders []map[string]json.RawMessage `json:"orders"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		require.Len(t, page.Orders, 1)
+		var got []string
+		for _, key := range []string{"delivery", "payments", "payment", "items"} {
+			if _, ok := page.Orders[0][key]; ok {
+				got = append(got, key)
+			}
+		}
+		assert.Equal(t, want, got, query)
+		assert.Contains(t, page.Orders[0], "track_number")
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders?track_number=TRACK-1&include=customer", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestOrderHandlerReturnsBookkeepingTimes(t *testing.T) {
+	c := newTestCache(t)
+	stored := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-1", DateCreated: stored.Add(-time.Hour), StoredAt: stored, UpdatedAt: stored.Add(time.Minute)})
+
+	rec := getOrder(t, withDefaultTenant(makeOrderHandler(c, &fakeRepository{}, piiPolicy{}, nil, newTestLogger())), "order-1")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"date_created":"2024-05-01T11:00:00Z"`)
+	assert.Contains(t, rec.Body.String(), `"stored_at":"2024-05-01T12:00:00Z"`)
+	assert.Contains(t, rec.Body.String(), `"updated_at":"2024-05-01T12:01:00Z"`)
+}
+
+// searchPage - выполняет GET /orders и декодирует страницу
+func searchPage(t *testing.T, h http.Handler, url string) orderSearchPage {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var page orderSearchPage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	return page
+}
+
+func TestOrderSearchCursorPaginationStableAcrossInserts(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	repo := &fakeRepository{orders: map[string]orders.Order{}}
+	add := func(uid string, created time.Time) {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		repo.orders[uid] = orders.Order{OrderUid: uid, TrackNumber: "TRACK-1", DateCreated: created}
+	}
+	for i := 0; i < 5; i++ {
+		add(fmt.Sprintf("order-%d", i), base.Add(time.Duration(i)*time.Minute))
+	}
+	h := withDefaultTenant(makeOrderSearchHandler(repo, piiPolicy{}, newTestCursorSigner(t), newTestLogger()))
+
+	page := searchPage(t, h, "/orders?track_number=TRACK-1&limit=2")
+	var got []string
+	for _, o := range page.Orders {
+		got = append(got, o.OrderUid)
+	}
+	require.NotEmpty(t, page.NextCursor)
+
+	// Заказ раньше курсора не сдвигает следующие страницы, заказ позже курсора попадает в выдачу
+	add("order-early", base.Add(-time.Hour))
+	add("order-late", base.Add(time.Hour))
+
+	for cursor := page.NextCursor; cursor != ""; cursor = page.NextCursor {
+		page = searchPage(t, h, "/orders?track_number=TRACK-1&limit=2&cursor="+url.QueryEscape(cursor))
+		for _, o := range page.Orders {
+			got = append(got, o.OrderUid)
+		}
+	}
+	assert.Equal(t, []string{"order-0", "order-1", "order-2", "order-3", "order-4", "order-late"}, got)
+}
+
+func TestOrderSearchRejectsBadCursors(t *testing.T) {
+	repo := &fakeRepository{orders: map[string]orders.Order{}}
+	for i := 0; i < 3; i++ {
+		uid := fmt.Sprintf("order-%d", i)
+		repo.orders[uid] = orders.Order{OrderUid: uid, TrackNumber: "TRACK-1"}
+	}
+	signer := newTestCursorSigner(t)
+	h := withDefaultTenant(makeOrderSearchHandler(repo, piiPolicy{}, signer, newTestLogger()))
+	cursor := searchPage(t, h, "/orders?track_number=TRACK-1&limit=1").NextCursor
+	require.NotEmpty(t, cursor)
+
+	for name, query := range map[string]string{
+		"tampered":        "track_number=TRACK-1&cursor=" + url.QueryEscape(cursor[:len(cursor)-2]+"AA"),
+		"garbage":         "track_number=TRACK-1&cursor=abc",
+		"other track":     "track_number=TRACK-2&cursor=" + url.QueryEscape(cursor),
+		"other sort":      "track_number=TRACK-1&sort=updated_at&cursor=" + url.QueryEscape(cursor),
+		"limit too large": "track_number=TRACK-1&limit=101",
+		"limit zero":      "track_number=TRACK-1&limit=0",
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, name)
+	}
+
+	page := searchPage(t, h, "/orders?track_number=TRACK-1&sort=date_created&limit=5&cursor="+url.QueryEscape(cursor))
+	require.Len(t, page.Orders, 2)
+	assert.Equal(t, "order-1", page.Orders[0].OrderUid)
+	assert.Empty(t, page.NextCursor)
+
+	// Курсор старше времени жизни подписи отклоняется
+	expiring, err := pagination.NewSigner([]byte("test-cursor-secret"), time.Nanosecond)
+	require.NoError(t, err)
+	hExpiring := withDefaultTenant(makeOrderSearchHandler(repo, piiPolicy{}, expiring, newTestLogger()))
+	cursor = searchPage(t, hExpiring, "/orders?track_number=TRACK-1&limit=1").NextCursor
+	rec := httptest.NewRecorder()
+	hExpiring.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders?track_number=TRACK-1&cursor="+url.QueryEscape(cursor), nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "cursor expired")
+}
+
+func TestOrderHandlerServesSerializedJSON(t *testing.T) {
+	c := newTestCache(t)
+	c.SetKeepJSON(true)
+	c.Set(tenant.Default, piiTestOrder())
+	cached, ok := c.GetJSON(tenant.Default, "order-1")
+	require.True(t, ok)
+
+	h := withDefaultTenant(makeOrderHandler(c, &fakeRepository{}, piiPolicy{}, nil, newTestLogger()))
+	rec := getOrder(t, h, "order-1")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, string(cached), rec.Body.String())
+	assert.Equal(t, strconv.Itoa(len(cached)), rec.Header().Get("Content-Length"))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	// Маскированный ответ сериализуется заново, сохранённый JSON не используется
+	h = withDefaultTenant(makeOrderHandler(c, &fakeRepository{}, newTestPIIPolicy(), nil, newTestLogger()))
+	rec = getWithKey(t, h, "/order?id=order-1", testSupportKey)
+	assert.NotEqual(t, string(cached), rec.Body.String())
+	var got orders.Order
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, "+972*****00", got.Delivery.Phone)
+	assert.Equal(t, string(cached), string(getWithKey(t, h, "/order?id=order-1", testFullKey).Body.Bytes()))
+}
+
+// headOrder - выполняет HEAD /orders/{id} через маршрутизатор, заполняющий параметр пути
+func headOrder(t *testing.T, h http.Handler, id string) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("HEAD /orders/{id}", h)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/orders/"+id, nil))
+	return rec
+}
+
+func TestOrderExistsHandler(t *testing.T) {
+	c := newTestCache(t)
+	c.SetMissingTTL(time.Minute)
+	c.Set(tenant.Default, orders.Order{OrderUid: "cached"})
+	repo := &fakeRepository{orders: map[string]orders.Order{"stored": {OrderUid: "stored"}}}
+	h := withDefaultTenant(makeOrderExistsHandler(c, repo, newTestLogger()))
+
+	for _, tc := range []struct {
+		name, id    string
+		code        int
+		exists      string
+		existsCalls int // обращений к базе после запроса
+	}{
+		{"cache hit", "cached", http.StatusOK, "true", 0},
+		{"db only", "stored", http.StatusOK, "true", 1},
+		{"not found", "missing", http.StatusNotFound, "false", 2},
+		{"negative cache", "missing", http.StatusNotFound, "false", 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := headOrder(t, h, tc.id)
+			assert.Equal(t, tc.code, rec.Code)
+			assert.Equal(t, tc.exists, rec.Header().Get(orderExistsHeader))
+			assert.Empty(t, rec.Body.Bytes())
+			assert.Equal(t, tc.existsCalls, repo.existsCalls)
+		})
+	}
+
+	_, ok := c.Get(tenant.Default, "stored")
+	assert.False(t, ok, "an existence check does not load the order into the cache")
+	assert.Zero(t, repo.reads, "the order itself is never read")
+
+	// Заказ, записанный в кэш после проверки, снова существует
+	c.Set(tenant.Default, orders.Order{OrderUid: "missing"})
+	assert.Equal(t, http.StatusOK, headOrder(t, h, "missing").Code)
+
+	assert.Equal(t, http.StatusBadRequest, headOrder(t, h, "bad%20id").Code)
+	repo.err = errDBOverloaded
+	assert.Equal(t, http.StatusInternalServerError, headOrder(t, h, "other").Code)
+}
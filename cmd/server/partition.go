@@ -0,0 +1,77 @@
+// Описание: Административный эндпоинт проверки партиционирования: в какую партицию топика writer с балансировщиком
+// hash (стратегия key-hash продюсера) отправит сообщение с заданным ключом и какие брокеры сейчас лидируют в партициях
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"l0_test_self/pkg/client/kafka"
+)
+
+// partitionMetadata - партиции топика с их лидерами по метаданным брокеров; реализуется kafka.TopicPartitions
+type partitionMetadata func(ctx context.Context, topic string) ([]kafka.PartitionInfo, error)
+
+// kafkaPartitionResponse - ответ GET /admin/kafka/partition
+type kafkaPartitionResponse struct {
+	Topic      string                `json:"topic"`
+	Key        string                `json:"key"`
+	Partition  int                   `json:"partition"` // партиция ключа по kafka.PartitionForKey
+	Leader     kafka.PartitionInfo   `json:"leader"`    // лидер и реплики партиции ключа
+	Partitions []kafka.PartitionInfo `json:"partitions"`
+}
+
+// makeKafkaPartitionHandler - HTTP обработчик, вычисляющий партицию ключа из параметра key тем же хэшем, что и writer
+// (kafka.PartitionForKey), по текущему числу партиций топика. Топик задаётся параметром topic и должен быть одним
+// из topics; по умолчанию — первый из них. Если метаданные брокеров недоступны, отвечает 503.
+func makeKafkaPartitionHandler(metadata partitionMetadata, topics []string, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		q := r.URL.Query()
+		key := q.Get("key")
+		if key == "" {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeKeyRequired)
+			return
+		}
+		topic := q.Get("topic")
+		if topic == "" {
+			topic = topics[0]
+		}
+		if !slices.Contains(topics, topic) {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeTopicUnknown, topic, strings.Join(topics, ", "))
+			return
+		}
+
+		partitions, err := metadata(r.Context(), topic)
+		if err != nil {
+			logger.Printf("[%s] kafka partition: metadata error (topic=%s): %v", reqID, topic, err)
+			writeAPIError(w, r, http.StatusServiceUnavailable, errCodeKafkaUnavailable)
+			return
+		}
+		if len(partitions) == 0 {
+			writeAPIError(w, r, http.StatusServiceUnavailable, errCodeTopicNoPartitions, topic)
+			return
+		}
+
+		resp := kafkaPartitionResponse{
+			Topic:      topic,
+			Key:        key,
+			Partition:  kafka.PartitionForKey([]byte(key), len(partitions)),
+			Partitions: partitions,
+		}
+		for _, p := range partitions {
+			if p.ID == resp.Partition {
+				resp.Leader = p
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+		}
+	}
+}
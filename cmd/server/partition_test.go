@@ -0,0 +1,77 @@
+// Описание: Тесты эндпоинта партиции ключа: партиция совпадает с выбором writer'а с балансировщиком hash,
+// ответ содержит лидеров партиций, а неизвестный топик, пустой ключ и недоступные метаданные отклоняются
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"l0_test_self/pkg/client/kafka"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePartitions - метаданные топика из n партиций; лидер партиции i - брокер i%3+1
+func fakePartitions(n int) []kafka.PartitionInfo {
+	list := make([]kafka.PartitionInfo, n)
+	for i := range list {
+		leader := i%3 + 1
+		list[i] = kafka.PartitionInfo{ID: i, Leader: leader, LeaderHost: fmt.Sprintf("kafka-%d:9092", leader), Replicas: []int{leader}, ISR: []int{leader}}
+	}
+	return list
+}
+
+func TestKafkaPartitionHandlerMatchesWriter(t *testing.T) {
+	var asked []string
+	h := makeKafkaPartitionHandler(func(_ context.Context, topic string) ([]kafka.PartitionInfo, error) {
+		asked = append(asked, topic)
+		return fakePartitions(6), nil
+	}, []string{"orders", "orders-b"}, newTestLogger())
+	writer := kafka.NewWriter(kafka.Config{Topic: "orders", Writer: kafka.WriterConfig{Balancer: "hash"}})
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("b563feb7b2b84b6test%d", i)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/kafka/partition?key="+key, nil))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var resp kafkaPartitionResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+		want := writer.Balancer.Balance(kafka2.Message{Key: []byte(key)}, 0, 1, 2, 3, 4, 5)
+		assert.Equal(t, want, resp.Partition, key)
+		assert.Equal(t, "orders", resp.Topic)
+		assert.Equal(t, key, resp.Key)
+		assert.Equal(t, want, resp.Leader.ID)
+		assert.Equal(t, want%3+1, resp.Leader.Leader)
+		assert.Len(t, resp.Partitions, 6)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/kafka/partition?key=a&topic=orders-b", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "orders-b", asked[len(asked)-1])
+}
+
+func TestKafkaPartitionHandlerErrors(t *testing.T) {
+	var metadataErr error
+	h := makeKafkaPartitionHandler(func(context.Context, string) ([]kafka.PartitionInfo, error) {
+		return fakePartitions(3), metadataErr
+	}, []string{"orders"}, newTestLogger())
+	get := func(target string) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, get("/admin/kafka/partition"))
+	assert.Equal(t, http.StatusBadRequest, get("/admin/kafka/partition?key=a&topic=other"))
+	metadataErr = errors.New("dial tcp: connection refused")
+	assert.Equal(t, http.StatusServiceUnavailable, get("/admin/kafka/partition?key=a"))
+}
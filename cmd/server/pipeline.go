@@ -0,0 +1,395 @@
+// Описание: Пакетный режим консьюмера (pipeline.mode: batched): заказы записываются в базу данных пачками фоновым
+// процессом, после фиксации пачки попадают в кэш, а затем коммитятся смещения соответствующих сообщений. Здесь же
+// общее для обоих режимов решение, какие полученные заказы помещать в кэш (pipeline.cache_on_ingest)
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/dedup"
+	"l0_test_self/internal/goroutines"
+	"l0_test_self/internal/ingeststats"
+	"l0_test_self/internal/metrics"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+	"l0_test_self/pkg/kafkautil"
+
+	kafka2 "github.com/segmentio/kafka-go"
+)
+
+// pendingMessage - полученное сообщение, ожидающее записи в базу данных и коммита смещения
+type pendingMessage struct {
+	msg     kafka2.Message
+	tenant  string // арендатор заказа, определённый по топику сообщения
+	order   orders.Order
+	raw     *postgres.RawPayload
+	latency postgres.LatencyRecord // задержка до фиксации записи заказа, измеряется после неё
+	ok      bool                   // false — сообщение не содержит заказа для сохранения, но его смещение тоже коммитится
+	// throttled - заказ сверх ограничения частоты заказов покупателя, сохраняемый с замечанием и без подтверждения
+	throttled bool
+	priority  bool         // срочный заказ (pipeline.priority), поставленный в очередь срочных
+	fetched   time.Time    // момент получения сообщения, от которого отсчитывается время обработки
+	commit    *commitEntry // место сообщения в порядке коммитов его партиции
+}
+
+// runBatched - цикл чтения сообщений в пакетном режиме до отмены контекста.
+// Заказ валидируется и ставится в ограниченную очередь: когда фоновая запись не успевает, чтение блокируется.
+// В кэш заказ попадает только после фиксации записи его пачки (cacheBatch). Смещения коммитятся только после
+// успешной записи пачки, поэтому при сбое процесса незаписанные заказы будут прочитаны из Kafka повторно.
+// Срочные заказы (pipeline.priority) ставятся в отдельную очередь, которую процесс записи разбирает первой.
+func (c *consumer) runBatched(ctx context.Context) {
+	queues := newPipelineQueues(c.pipeline.QueueSize, c.pipeline.Priority)
+	order := newCommitOrder()
+	done := make(chan struct{})
+	goroutines.Go("kafka consumer batch writer", ctx.Done(), func() {
+		defer close(done)
+		c.flushLoop(ctx, queues, order)
+	})
+	defer func() {
+		queues.close()
+		<-done
+	}()
+
+	for {
+		msg, err := c.fetch(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+				c.logger.Println("kafka consumer stopping (context canceled)")
+				return
+			}
+			c.fail(stageFetch, "read", nil, "", "kafka read error: %v", err)
+			c.clock.Sleep(c.retryDelay)
+			continue
+		}
+
+		p := pendingMessage{msg: msg, fetched: c.clock.Now(), commit: order.track(msg)}
+		if c.skipMessage(ctx, msg) {
+			c.enqueue(queues, p)
+			continue
+		}
+		var handled bool
+		if p.tenant, p.order, p.ok, handled = c.decode(ctx, msg); !handled {
+			// Сообщение не отправлено в очередь недоставленных до остановки: оно и последующие не коммитятся
+			c.logger.Printf("message left uncommitted at shutdown: %s", kafkautil.MessageRef(msg))
+			return
+		}
+		if p.ok {
+			key := tenant.Key(p.tenant, p.order.OrderUid)
+			hash := dedup.HashOf(msg.Value)
+			p.ok = !c.recentDuplicate(key, hash, msg)
+			if !p.ok {
+				c.ingestStats.record(p.tenant, &msg, p.order.CustomerId, ingeststats.Duplicate)
+			}
+			if p.ok {
+				if p.throttled, handled = c.throttle(ctx, msg, p.tenant, &p.order); !handled {
+					// Сообщение не отправлено в очередь недоставленных до остановки: оно и последующие не коммитятся
+					c.logger.Printf("message left uncommitted at shutdown: %s", kafkautil.MessageRef(msg))
+					return
+				}
+				p.ok = !(p.throttled && c.throttler.rejects())
+			}
+			if p.ok {
+				// Заказ регистрируется в окне сразу, чтобы повтор, полученный до записи пачки, не попал в неё ещё раз
+				c.recent.Remember(key, hash)
+			}
+		}
+		if p.ok {
+			p.raw = c.rawPayload(msg, p.order.OrderUid)
+		}
+		c.enqueue(queues, p)
+	}
+}
+
+// enqueue - ставит сообщение в очередь его класса: заказ службы доставки из pipeline.priority.delivery_services —
+// в очередь срочных, остальные сообщения — в обычную. Заказ к этому моменту уже декодирован, поэтому класс
+// определяется без повторного разбора тела. Блокируется, пока в очереди нет места.
+func (c *consumer) enqueue(queues *pipelineQueues, p pendingMessage) {
+	p.priority = queues.priority != nil && p.ok && c.priority[strings.ToLower(p.order.DeliveryService)]
+	stats := c.queues.class(p.priority)
+	stats.depth.Add(1)
+	if p.priority {
+		queues.priority <- p
+		return
+	}
+	queues.regular <- p
+}
+
+// flushLoop - собирает сообщения из очередей в пачки и записывает их при заполнении пачки, по таймеру и при закрытии очередей.
+// Если пачку не удалось записать к моменту остановки, её смещения и смещения всех последующих сообщений не коммитятся:
+// коммит более позднего смещения партиции подтвердил бы и пропущенные сообщения.
+func (c *consumer) flushLoop(ctx context.Context, queues *pipelineQueues, order *commitOrder) {
+	ticker := c.clock.NewTicker(c.pipeline.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]pendingMessage, 0, c.pipeline.BatchSize)
+	abandoned := false
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if abandoned {
+			c.logger.Printf("batch of %d messages dropped without commit after failed flush", len(batch))
+		} else if !c.flushWithRetry(ctx, batch, order) {
+			abandoned = true
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		p, ok, ticked := queues.next(ticker.C())
+		switch {
+		case ticked:
+			flush()
+		case !ok:
+			flush()
+			return
+		default:
+			c.queues.class(p.priority).depth.Add(-1)
+			batch = append(batch, p)
+			if len(batch) >= c.pipeline.BatchSize {
+				flush()
+			}
+		}
+	}
+}
+
+// flushWithRetry - записывает пачку, повторяя попытки с паузой retry_delay, пока не отменён контекст.
+// После отмены контекста делается ещё одна попытка; при неудаче возвращается false, а смещения пачки остаются незакоммиченными.
+// Если задан kafka.consumer.max_attempts, после неудачи заказы пачки записываются по одному (storeEach). При потере
+// соединения с базой данных пачка повторяется целиком после восстановления пула, без пауз retry_delay и записи по одному.
+func (c *consumer) flushWithRetry(ctx context.Context, batch []pendingMessage, order *commitOrder) bool {
+	for {
+		err := c.flushBatch(ctx, batch, order)
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			c.logger.Printf("batch flush failed during shutdown, %d messages left uncommitted: %v", len(batch), err)
+			return false
+		}
+		if c.db.report(err) {
+			// Пачка повторяется после восстановления пула; запись по одному расходовала бы попытки сообщений впустую
+			c.fail(stageStore, "db_connection", nil, "", "batch flush: db connection lost, waiting for pool recovery (messages=%d): %v", len(batch), err)
+			c.db.wait(ctx)
+			continue
+		}
+		c.fail(stageStore, "db_insert", nil, "", "batch flush error (messages=%d), retrying: %v", len(batch), err)
+		c.skipBatch(ctx, batch)
+		if c.cfg.MaxAttempts > 0 {
+			c.storeEach(ctx, batch)
+		}
+		select {
+		case <-ctx.Done():
+		case <-c.clock.After(c.pipeline.RetryDelay):
+		}
+	}
+}
+
+// storeEach - записывает по одному заказы пачки, которую не удалось записать целиком. Пачка записывается в одной
+// транзакции, и сообщение, которое не удаётся записать, иначе блокировало бы её бесконечно: неудачи записи по одному
+// расходуют попытки сообщения (storeFailed). Записанные и отправленные в очередь недоставленных сообщения больше
+// не записываются, а их смещения коммитятся вместе с пачкой.
+func (c *consumer) storeEach(ctx context.Context, batch []pendingMessage) {
+	for i := range batch {
+		p := &batch[i]
+		if !p.ok {
+			continue
+		}
+		opCtx, cancel := opContext(ctx)
+		one := batch[i : i+1]
+		list := []postgres.OrderRecord{{Tenant: p.tenant, Order: p.order, Raw: p.raw}}
+		onCommit := func() {
+			c.cacheBatch(one, list)
+			c.countBatch(one, list)
+			c.acknowledge(opCtx, &p.msg, p.order.OrderUid, c.batchAcks(one, list))
+			c.notifyBatch(one, list)
+		}
+		if _, err := c.repo.InsertOrders(opCtx, list, onCommit); err == nil {
+			c.recordLatencies(opCtx, p.tenant, []postgres.LatencyRecord{p.latency})
+			c.clearAttempts(opCtx, []kafka2.Message{p.msg})
+			p.ok = false
+		} else if c.db.report(err) {
+			// База данных недоступна: неудачи остальных заказов не говорят о них ничего
+			cancel()
+			return
+		} else if c.storeFailed(ctx, p.msg, p.tenant, &p.order, err) {
+			// В базе данных заказа не будет: повтор сообщения снова нужно записать
+			c.recent.Forget(tenant.Key(p.tenant, p.order.OrderUid))
+			p.ok = false
+		}
+		cancel()
+	}
+}
+
+// flushBatch - записывает заказы пачки в одной транзакции, после её фиксации помещает заказы в кэш и публикует
+// подтверждения записи и уведомления, а затем коммитит смещения сообщений, все предшественники которых в партиции
+// уже записаны (order). Ошибка коммита только логируется: заказы уже сохранены, а повторная запись после повторной
+// доставки идемпотентна.
+func (c *consumer) flushBatch(ctx context.Context, batch []pendingMessage, order *commitOrder) error {
+	flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), drainTimeout)
+	defer cancel()
+
+	list := make([]postgres.OrderRecord, 0, len(batch))
+	msgs := make([]kafka2.Message, 0, len(batch))
+	entries := make([]*commitEntry, 0, len(batch))
+	for _, p := range batch {
+		if p.ok {
+			list = append(list, postgres.OrderRecord{Tenant: p.tenant, Order: p.order, Raw: p.raw})
+		}
+		msgs = append(msgs, p.msg)
+		entries = append(entries, p.commit)
+	}
+
+	if len(list) > 0 {
+		onCommit := func() {
+			c.cacheBatch(batch, list)
+			c.countBatch(batch, list)
+			c.acknowledge(flushCtx, nil, "", c.batchAcks(batch, list))
+			c.notifyBatch(batch, list)
+		}
+		inserted, err := c.repo.InsertOrders(flushCtx, list, onCommit)
+		if err != nil {
+			return err
+		}
+		c.logger.Printf("batch stored: messages=%d orders=%d inserted=%d", len(msgs), len(list), inserted)
+		c.recordBatchLatencies(flushCtx, batch)
+	}
+	c.clearAttempts(flushCtx, msgs)
+	now := c.clock.Now()
+	for _, p := range batch {
+		c.queues.class(p.priority).latency.Observe(now.Sub(p.fetched).Seconds())
+	}
+
+	ready := order.complete(entries)
+	if len(ready) == 0 {
+		// Раньше полученные сообщения партиций ещё не записаны: смещения закоммитит их пачка
+		return nil
+	}
+	if err := c.reader.CommitMessages(flushCtx, ready...); err != nil {
+		c.fail(stageCommit, "commit", nil, "", "kafka commit error (messages=%d): %v", len(ready), err)
+	} else {
+		c.committed(flushCtx, ready)
+	}
+	return nil
+}
+
+// cacheBatch - помещает в кэш заказы пачки batch, записанные InsertOrders из list, и измеряет задержку их обработки.
+// Вызывается после фиксации записи пачки: заказ из откаченной транзакции не должен попасть в кэш.
+func (c *consumer) cacheBatch(batch []pendingMessage, list []postgres.OrderRecord) {
+	i := 0
+	for j := range batch {
+		p := &batch[j]
+		if !p.ok {
+			continue
+		}
+		// Версия — момент после фиксации транзакции, как в режиме sync
+		c.cacheIngested(p.tenant, list[i].Order)
+		c.processed.add(p.tenant, &list[i].Order)
+		p.latency = c.latency.observe(p.msg, p.order.OrderUid)
+		i++
+	}
+}
+
+// recordBatchLatencies - сохраняет задержки обработки заказов пачки в журнал отдельно для каждого арендатора
+func (c *consumer) recordBatchLatencies(ctx context.Context, batch []pendingMessage) {
+	latencies := make(map[string][]postgres.LatencyRecord)
+	var tenants []string
+	for _, p := range batch {
+		if !p.ok {
+			continue
+		}
+		if _, ok := latencies[p.tenant]; !ok {
+			tenants = append(tenants, p.tenant)
+		}
+		latencies[p.tenant] = append(latencies[p.tenant], p.latency)
+	}
+	for _, tenantID := range tenants {
+		c.recordLatencies(ctx, tenantID, latencies[tenantID])
+	}
+}
+
+// batchAcks - подтверждения заказов пачки batch, записанных InsertOrders из list. Заказ, уже сохранённый раньше,
+// пропускается без времени записи и не подтверждается повторно, а заказ сверх ограничения покупателя не подтверждается.
+func (c *consumer) batchAcks(batch []pendingMessage, list []postgres.OrderRecord) []orderAck {
+	if c.acks == nil {
+		return nil
+	}
+	acks := make([]orderAck, 0, len(list))
+	i := 0
+	for _, p := range batch {
+		if !p.ok {
+			continue
+		}
+		if rec := list[i]; !rec.Order.StoredAt.IsZero() && !p.throttled {
+			acks = append(acks, c.acks.event(rec.Tenant, rec.Order.OrderUid, rec.Order.StoredAt, p.latency.Latency))
+		}
+		i++
+	}
+	return acks
+}
+
+// ingestCache - общее для обоих режимов записи решение, помещать ли полученный консьюмером заказ в кэш
+// (pipeline.cache_on_ingest), и счётчики этих решений для GET /admin/consumer/status
+type ingestCache struct {
+	mode    string
+	window  time.Duration
+	clock   clock.Clock // время отсчёта давности заказов, в тестах подменяется
+	cached  *metrics.Counter
+	skipped *metrics.Counter
+}
+
+// newIngestCache - создает ingestCache по настройкам pipeline; пустой режим означает always
+func newIngestCache(cfg config.PipelineConfig) *ingestCache {
+	mode := cfg.CacheOnIngest
+	if mode == "" {
+		mode = config.CacheOnIngestAlways
+	}
+	return &ingestCache{mode: mode, window: cfg.RecentWindow(), clock: clock.Real, cached: &metrics.Counter{}, skipped: &metrics.Counter{}}
+}
+
+// cacheOnIngest - сообщает, помещать ли в кэш заказ с датой создания dateCreated в момент now в режиме mode.
+// В режиме recent кэшируются заказы не старше window, включая границу, и заказы с датой в будущем;
+// заказ без даты создания не считается недавним.
+func cacheOnIngest(mode string, window time.Duration, dateCreated, now time.Time) bool {
+	switch mode {
+	case config.CacheOnIngestNever:
+		return false
+	case config.CacheOnIngestRecent:
+		return !dateCreated.IsZero() && now.Sub(dateCreated) <= window
+	default:
+		return true
+	}
+}
+
+// admit - решает, помещать ли заказ в кэш, и учитывает решение в счётчиках
+func (p *ingestCache) admit(order *orders.Order) bool {
+	if !cacheOnIngest(p.mode, p.window, order.DateCreated, p.clock.Now()) {
+		p.skipped.Inc()
+		return false
+	}
+	p.cached.Inc()
+	return true
+}
+
+// ingestCacheStatus - решения о кэшировании полученных заказов в ответе GET /admin/consumer/status
+type ingestCacheStatus struct {
+	Mode    string `json:"mode"`
+	Window  string `json:"window,omitempty"` // окно режима recent
+	Cached  uint64 `json:"cached"`           // заказов помещено в кэш при получении
+	Skipped uint64 `json:"skipped"`          // заказов не помещено: они попадут в кэш при чтении
+}
+
+// status - режим и счётчики решений
+func (p *ingestCache) status() ingestCacheStatus {
+	s := ingestCacheStatus{Mode: p.mode, Cached: p.cached.Value(), Skipped: p.skipped.Value()}
+	if p.mode == config.CacheOnIngestRecent {
+		s.Window = p.window.String()
+	}
+	return s
+}
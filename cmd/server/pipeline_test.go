@@ -0,0 +1,396 @@
+// Описание: Тесты пакетного режима консьюмера: границы пачек, коммит смещений только после записи и поведение при сбоях записи;
+// решение о кэшировании полученных заказов (pipeline.cache_on_ingest) и публикация в кэш, подтверждения и уведомления
+// только заказов, транзакция записи которых зафиксирована, в обоих режимах записи
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sliceReader - читатель, выдающий сообщения из среза по одному разу; onCommit вызывается перед фиксацией коммита
+type sliceReader struct {
+	mu        sync.Mutex
+	msgs      []kafka2.Message
+	pos       int
+	committed []int64
+	onCommit  func(msgs []kafka2.Message)
+}
+
+func (r *sliceReader) FetchMessage(ctx context.Context) (kafka2.Message, error) {
+	r.mu.Lock()
+	if r.pos < len(r.msgs) {
+		msg := r.msgs[r.pos]
+		r.pos++
+		r.mu.Unlock()
+		return msg, nil
+	}
+	r.mu.Unlock()
+	<-ctx.Done()
+	return kafka2.Message{}, ctx.Err()
+}
+
+func (r *sliceReader) CommitMessages(_ context.Context, msgs ...kafka2.Message) error {
+	if r.onCommit != nil {
+		r.onCommit(msgs)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range msgs {
+		r.committed = append(r.committed, m.Offset)
+	}
+	return nil
+}
+
+func (r *sliceReader) Stats() kafka2.ReaderStats { return kafka2.ReaderStats{} }
+
+func (r *sliceReader) Close() error { return nil }
+
+// fetched - сколько сообщений уже выдано консьюмеру
+func (r *sliceReader) fetched() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pos
+}
+
+func (r *sliceReader) committedOffsets() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64(nil), r.committed...)
+}
+
+func newBatchedTestConfig(batchSize int, flushInterval time.Duration) *config.Config {
+	cfg := newConsumerTestConfig()
+	cfg.Pipeline = config.PipelineConfig{
+		Mode:          config.PipelineModeBatched,
+		BatchSize:     batchSize,
+		FlushInterval: flushInterval,
+		QueueSize:     16,
+		RetryDelay:    5 * time.Millisecond,
+	}
+	return cfg
+}
+
+// newOrderMessages - создает n сообщений с заказами и возвращает их вместе с идентификаторами заказов по смещениям
+func newOrderMessages(t *testing.T, seed int64, n int) ([]kafka2.Message, map[int64]string) {
+	t.Helper()
+	gen := testorders.NewGenerator(seed)
+	msgs := make([]kafka2.Message, 0, n)
+	uids := make(map[int64]string, n)
+	for i := 0; i < n; i++ {
+		o := gen.Order(testorders.ScenarioDefault)
+		b, err := json.Marshal(o)
+		require.NoError(t, err)
+		msgs = append(msgs, kafka2.Message{Topic: "orders", Offset: int64(i), Value: b})
+		uids[int64(i)] = o.OrderUid
+	}
+	return msgs, uids
+}
+
+// requireStoredBeforeCommit - проверяет при каждом коммите, что заказы коммитящихся сообщений уже записаны в репозиторий
+func requireStoredBeforeCommit(t *testing.T, repo *fakeRepository, uids map[int64]string) func([]kafka2.Message) {
+	return func(msgs []kafka2.Message) {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		for _, m := range msgs {
+			uid, ok := uids[m.Offset]
+			if !ok {
+				continue
+			}
+			if _, stored := repo.orders[uid]; !stored {
+				t.Errorf("offset %d committed before order %s was stored", m.Offset, uid)
+			}
+		}
+	}
+}
+
+func TestBatchedConsumerFlushesOnBatchSizeAndShutdown(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 11, 9)
+	// невалидное сообщение не попадает в пачку заказов, но его смещение коммитится вместе с пачкой
+	msgs = append(msgs, kafka2.Message{Topic: "orders", Offset: 9, Value: []byte("not json")})
+
+	repo := &fakeRepository{}
+	reader := &sliceReader{msgs: msgs}
+	reader.onCommit = requireStoredBeforeCommit(t, repo, uids)
+	orderCache := newTestCache(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, orderCache, newTestLogger(), newBatchedTestConfig(4, time.Hour), nil)
+
+	require.Eventually(t, func() bool {
+		return len(reader.committedOffsets()) == 8
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, 8, orderCache.Len(), "orders are cached only after their batch is stored")
+
+	// Оставшаяся неполная пачка записывается при остановке. Консьюмер не читает после отмены контекста,
+	// поэтому остановка начинается, только когда он получил все сообщения
+	require.Eventually(t, func() bool {
+		return reader.fetched() == len(msgs)
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+	assert.Equal(t, 9, orderCache.Len())
+
+	assert.Equal(t, []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, reader.committedOffsets())
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	assert.Equal(t, []int{4, 4, 1}, repo.batches)
+	assert.Len(t, repo.orders, 9)
+}
+
+func TestBatchedConsumerFlushesOnInterval(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 12, 3)
+	repo := &fakeRepository{}
+	reader := &sliceReader{msgs: msgs}
+	reader.onCommit = requireStoredBeforeCommit(t, repo, uids)
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), newBatchedTestConfig(100, 10*time.Millisecond), nil)
+
+	require.Eventually(t, func() bool {
+		return len(reader.committedOffsets()) == 3
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	_, stored := repo.stats()
+	assert.Equal(t, 3, stored)
+}
+
+func TestBatchedConsumerRetriesFailedFlush(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 13, 4)
+	repo := &fakeRepository{failBatches: 3}
+	reader := &sliceReader{msgs: msgs}
+	reader.onCommit = requireStoredBeforeCommit(t, repo, uids)
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), newBatchedTestConfig(4, time.Hour), nil)
+
+	require.Eventually(t, func() bool {
+		return len(reader.committedOffsets()) == 4
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	assert.Equal(t, 0, repo.failBatches)
+	assert.Equal(t, []int{4}, repo.batches)
+}
+
+func TestBatchedConsumerWaitsRetryDelayOnClock(t *testing.T) {
+	msgs, _ := newOrderMessages(t, 15, 4)
+	repo := &fakeRepository{failBatches: 1}
+	reader := &sliceReader{msgs: msgs}
+	cfg := newBatchedTestConfig(4, time.Hour)
+	cfg.Pipeline.RetryDelay = time.Minute
+	c := newConsumer(reader, nil, repo, newTestCache(t), newTestLogger(), cfg, nil)
+	clk := clock.NewFake(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	c.clock = clk
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.runBatched(ctx)
+	}()
+
+	// Тикер сброса пачек и пауза перед повтором неудачной записи
+	clk.BlockUntil(2)
+	assert.Empty(t, reader.committedOffsets(), "the failed batch waits for the retry delay")
+	clk.Advance(time.Minute)
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) == 4 }, 5*time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	assert.Equal(t, []int{4}, repo.batches)
+}
+
+func TestBatchedConsumerLeavesOffsetsUncommittedWhenFlushNeverSucceeds(t *testing.T) {
+	msgs, _ := newOrderMessages(t, 14, 10)
+	repo := &fakeRepository{err: errors.New("database is down")}
+	reader := &sliceReader{msgs: msgs}
+	orderCache := newTestCache(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, orderCache, newTestLogger(), newBatchedTestConfig(3, time.Hour), nil)
+
+	// Запись первой пачки повторяется, пока не остановлен консьюмер; остальные сообщения ждут в очереди
+	require.Eventually(t, func() bool {
+		reader.mu.Lock()
+		defer reader.mu.Unlock()
+		return reader.pos == len(msgs)
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	assert.Empty(t, reader.committedOffsets(), "no offset may be committed while orders are not stored")
+	_, stored := repo.stats()
+	assert.Equal(t, 0, stored)
+	assert.Zero(t, orderCache.Len(), "orders of batches that were never stored are not cached")
+}
+
+func TestConsumerPublishesOnlyCommittedOrders(t *testing.T) {
+	for _, mode := range []string{config.PipelineModeSync, config.PipelineModeBatched} {
+		t.Run(mode, func(t *testing.T) {
+			msgs, uids := newOrderMessages(t, 15, 3)
+			// Запись заказа uids[1] откатывается из-за нарушения ограничения последним товаром
+			repo := &fakeRepository{rollbackUIDs: map[string]bool{uids[1]: true}}
+			reader := &sliceReader{msgs: msgs}
+			cfg := newConsumerTestConfig()
+			if mode == config.PipelineModeBatched {
+				cfg = newBatchedTestConfig(3, time.Hour)
+			}
+			cfg = withMaxAttempts(cfg, 1)
+			acks := &fakeWriter{}
+			rcv := newWebhookReceiver(t)
+			monitor := newConsumerMonitor(cfg)
+			monitor.acks = newTestOrderAcker(acks)
+			monitor.webhooks = startTestWebhooks(t, repo, config.WebhookEndpointConfig{URL: rcv.URL})
+			orderCache := newTestCache(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			wg := startKafkaConsumer(ctx, reader, &fakeWriter{}, repo, orderCache, newTestLogger(), cfg, monitor)
+
+			require.Eventually(t, func() bool { return len(reader.committedOffsets()) == 3 }, 5*time.Second, time.Millisecond)
+			require.Eventually(t, func() bool { return monitor.webhooks.endpoints[0].delivered.Value() == 2 }, 5*time.Second, time.Millisecond)
+			cancel()
+			wg.Wait()
+
+			_, cached := orderCache.Get(tenant.Default, uids[1])
+			assert.False(t, cached, "a rolled back order is not cached")
+			for _, offset := range []int64{0, 2} {
+				_, cached := orderCache.Get(tenant.Default, uids[offset])
+				assert.True(t, cached, offset)
+			}
+			assert.NotContains(t, ackedOrders(t, acks), uids[1], "a rolled back order is not acknowledged")
+			assert.Len(t, acks.written(), 2)
+			for _, req := range rcv.received() {
+				var order orders.Order
+				require.NoError(t, json.Unmarshal(req.body, &order))
+				assert.NotEqual(t, uids[1], order.OrderUid, "no notification about a rolled back order")
+			}
+			assert.Equal(t, uint64(1), monitor.poison.Value())
+			assert.ElementsMatch(t, []string{uids[0], uids[2]}, recentUIDs(monitor.processed, tenant.Default, 10),
+				"only committed orders are listed as recent")
+		})
+	}
+}
+
+func TestCacheOnIngestWindowBoundaries(t *testing.T) {
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	window := 24 * time.Hour
+	for name, tc := range map[string]struct {
+		dateCreated time.Time
+		want        bool
+	}{
+		"just created":        {now, true},
+		"inside the window":   {now.Add(-window + time.Nanosecond), true},
+		"on the boundary":     {now.Add(-window), true},
+		"just outside":        {now.Add(-window - time.Nanosecond), false},
+		"long ago":            {now.AddDate(-1, 0, 0), false},
+		"in the future":       {now.Add(time.Hour), true},
+		"without create date": {time.Time{}, false},
+	} {
+		assert.Equal(t, tc.want, cacheOnIngest(config.CacheOnIngestRecent, window, tc.dateCreated, now), name)
+	}
+}
+
+func TestCacheOnIngestModes(t *testing.T) {
+	now := time.Now()
+	recent, old := now.Add(-time.Hour), now.Add(-72*time.Hour)
+	for mode, want := range map[string][2]bool{ // решение для недавнего и для старого заказа
+		"":                         {true, true},
+		config.CacheOnIngestAlways: {true, true},
+		config.CacheOnIngestRecent: {true, false},
+		config.CacheOnIngestNever:  {false, false},
+	} {
+		p := newIngestCache(config.PipelineConfig{CacheOnIngest: mode})
+		p.clock = clock.NewFake(now)
+		assert.Equal(t, want[0], p.admit(&orders.Order{DateCreated: recent}), "mode %q, recent order", mode)
+		assert.Equal(t, want[1], p.admit(&orders.Order{DateCreated: old}), "mode %q, old order", mode)
+	}
+}
+
+func TestConsumerCachesIngestedOrdersByMode(t *testing.T) {
+	gen := testorders.NewGenerator(186)
+	var msgs []kafka2.Message
+	var recentUIDs, oldUIDs []string
+	for i := 0; i < 6; i++ {
+		o := gen.Order(testorders.ScenarioDefault)
+		if i%2 == 0 {
+			o.DateCreated = time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+			recentUIDs = append(recentUIDs, o.OrderUid)
+		} else {
+			o.DateCreated = time.Now().Add(-72 * time.Hour).UTC().Truncate(time.Second)
+			oldUIDs = append(oldUIDs, o.OrderUid)
+		}
+		b, err := json.Marshal(o)
+		require.NoError(t, err)
+		msgs = append(msgs, kafka2.Message{Topic: "orders", Offset: int64(i), Value: b})
+	}
+
+	for _, pipelineMode := range []string{config.PipelineModeSync, config.PipelineModeBatched} {
+		for _, mode := range []string{config.CacheOnIngestAlways, config.CacheOnIngestRecent, config.CacheOnIngestNever} {
+			t.Run(pipelineMode+"/"+mode, func(t *testing.T) {
+				cfg := newBatchedTestConfig(2, 10*time.Millisecond)
+				cfg.Pipeline.Mode = pipelineMode
+				cfg.Pipeline.CacheOnIngest = mode
+				monitor := newConsumerMonitor(cfg)
+				reader := &sliceReader{msgs: msgs}
+				orderCache := newTestCache(t)
+				orderCache.SetMissingTTL(time.Minute)
+				orderCache.MarkMissing(tenant.Default, oldUIDs[0])
+				ctx, cancel := context.WithCancel(context.Background())
+				wg := startKafkaConsumer(ctx, reader, nil, &fakeRepository{}, orderCache, newTestLogger(), cfg, monitor)
+				require.Eventually(t, func() bool { return len(reader.committedOffsets()) == len(msgs) }, 5*time.Second, time.Millisecond)
+				cancel()
+				wg.Wait()
+
+				cached := func(uids []string) int {
+					n := 0
+					for _, uid := range uids {
+						if _, ok := orderCache.Get(tenant.Default, uid); ok {
+							n++
+						}
+					}
+					return n
+				}
+				status := monitor.ingest.status()
+				assert.Equal(t, mode, status.Mode)
+				switch mode {
+				case config.CacheOnIngestAlways:
+					assert.Equal(t, [2]int{3, 3}, [2]int{cached(recentUIDs), cached(oldUIDs)})
+					assert.Equal(t, [2]uint64{6, 0}, [2]uint64{status.Cached, status.Skipped})
+				case config.CacheOnIngestRecent:
+					assert.Equal(t, [2]int{3, 0}, [2]int{cached(recentUIDs), cached(oldUIDs)})
+					assert.Equal(t, [2]uint64{3, 3}, [2]uint64{status.Cached, status.Skipped})
+					assert.Equal(t, "24h0m0s", status.Window)
+				case config.CacheOnIngestNever:
+					assert.Zero(t, orderCache.Len())
+					assert.Equal(t, [2]uint64{0, 6}, [2]uint64{status.Cached, status.Skipped})
+				}
+				assert.False(t, orderCache.IsMissing(tenant.Default, oldUIDs[0]), "a skipped order is not reported missing")
+
+				rec := httptest.NewRecorder()
+				makeConsumerStatusHandler("", newTestReadBreaker(time.Minute), nil, nil, monitor.ingest, nil, newTestLogger()).
+					ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/consumer/status", nil))
+				var resp consumerStatusResponse
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+				assert.Equal(t, &status, resp.CacheOnIngest)
+			})
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Описание: Обнаружение сообщений, которые не удаётся записать в базу данных (poison message): подсчёт неудачных
+// попыток записи каждого сообщения и отправка исчерпавших kafka.consumer.max_attempts в очередь недоставленных сообщений
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+	"l0_test_self/pkg/kafkautil"
+
+	kafka2 "github.com/segmentio/kafka-go"
+)
+
+// Заголовки метаданных сообщения в очереди недоставленных сообщений; заголовки исходного сообщения сохраняются
+const (
+	dlqReasonHeader    = "dlq-reason"
+	dlqAttemptsHeader  = "dlq-attempts"
+	dlqErrorHeader     = "dlq-error"
+	dlqTopicHeader     = "dlq-source-topic"
+	dlqPartitionHeader = "dlq-source-partition"
+	dlqOffsetHeader    = "dlq-source-offset"
+	dlqOrderHeader     = "dlq-order-uid"
+	dlqTenantHeader    = "dlq-tenant"
+	dlqFailedAtHeader  = "dlq-failed-at"
+	dlqCoercedHeader   = "dlq-coerced"
+)
+
+// Причины отправки в очередь недоставленных (заголовок dlq-reason)
+const (
+	dlqReasonPoison    = "poison"    // сообщение исчерпало попытки записи в базу данных
+	dlqReasonThrottled = "throttled" // заказ покупателя сверх kafka.consumer.customer_limit при политике dlq
+)
+
+// errNoDLQWriter - ошибка отправки в очередь недоставленных сообщений, если писатель не создан
+var errNoDLQWriter = errors.New("dlq writer is not configured")
+
+// MessageWriter - интерфейс писателя Kafka для очереди недоставленных сообщений (реализуется *kafka.Writer и фейками в тестах)
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka2.Message) error
+	Close() error
+}
+
+// messageKey - положение сообщения в Kafka для журнала попыток
+func messageKey(msg kafka2.Message) postgres.MessageKey {
+	return postgres.MessageKey{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset}
+}
+
+// opContext - контекст одной операции с базой данных или Kafka: она завершается даже при остановке консьюмера,
+// но не дольше drainTimeout
+func opContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), drainTimeout)
+}
+
+// storeFailed - учитывает неудачную попытку записи заказа order арендатора tenantID из сообщения msg и, если попытки исчерпаны,
+// отправляет сообщение в очередь недоставленных. Возвращает true, если сообщение отправлено и его смещение можно коммитить.
+// Попытка учитывается, только если она сохранена в журнале message_attempts: когда база данных недоступна, ошибка
+// записи говорит об отказе базы, а не о сообщении, и сообщения не должны уходить в очередь недоставленных.
+func (c *consumer) storeFailed(ctx context.Context, msg kafka2.Message, tenantID string, order *orders.Order, storeErr error) bool {
+	opCtx, cancel := opContext(ctx)
+	defer cancel()
+
+	orderUID := order.OrderUid
+	key := messageKey(msg)
+	attempts, err := c.repo.RecordMessageAttempt(opCtx, key, orderUID, storeErr.Error())
+	if err != nil {
+		c.fail(stageStore, "attempt_record", &msg, orderUID, "message attempt not counted (order=%s, %s): %v", orderUID, kafkautil.MessageRef(msg), err)
+		return false
+	}
+	// Журнал продолжает счёт попыток предыдущих запусков, а счётчик в памяти — если строку журнала удалили
+	attempts = max(attempts, c.attempts[key]+1)
+	c.attempts[key] = attempts
+	if attempts < c.cfg.MaxAttempts {
+		return false
+	}
+
+	if err := c.sendToDLQ(opCtx, msg, tenantID, order, dlqReasonPoison, attempts, storeErr); err != nil {
+		c.fail(stageStore, "dlq", &msg, orderUID, "dlq write error, message will be retried (order=%s, %s): %v", orderUID, kafkautil.MessageRef(msg), err)
+		return false
+	}
+	c.poison.Inc()
+	c.fail(stageStore, dlqReasonPoison, &msg, orderUID, "poison message sent to dlq after %d attempts (order=%s, %s): %v", attempts, orderUID, kafkautil.MessageRef(msg), storeErr)
+	c.clearAttempts(opCtx, []kafka2.Message{msg})
+	return true
+}
+
+// sendToDLQ - отправляет исходное сообщение в очередь недоставленных с причиной reason, числом попыток, последней ошибкой,
+// арендатором и полями, приведёнными при декодировании в режиме pipeline.decode: lenient, в заголовках
+func (c *consumer) sendToDLQ(ctx context.Context, msg kafka2.Message, tenantID string, order *orders.Order, reason string, attempts int, cause error) error {
+	if c.dlq == nil {
+		return errNoDLQWriter
+	}
+	headers := append(slices.Clone(msg.Headers),
+		kafka2.Header{Key: dlqReasonHeader, Value: []byte(reason)},
+		kafka2.Header{Key: dlqAttemptsHeader, Value: []byte(strconv.Itoa(attempts))},
+		kafka2.Header{Key: dlqErrorHeader, Value: []byte(cause.Error())},
+		kafka2.Header{Key: dlqTopicHeader, Value: []byte(msg.Topic)},
+		kafka2.Header{Key: dlqPartitionHeader, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka2.Header{Key: dlqOffsetHeader, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		kafka2.Header{Key: dlqOrderHeader, Value: []byte(order.OrderUid)},
+		kafka2.Header{Key: dlqTenantHeader, Value: []byte(tenantID)},
+		kafka2.Header{Key: dlqFailedAtHeader, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+	)
+	if len(order.Coerced) > 0 {
+		headers = append(headers, kafka2.Header{Key: dlqCoercedHeader, Value: []byte(strings.Join(order.Coerced, "; "))})
+	}
+	return c.dlq.WriteMessages(ctx, kafka2.Message{Key: msg.Key, Value: msg.Value, Headers: headers})
+}
+
+// clearAttempts - забывает попытки сообщений msgs после их записи или отправки в очередь недоставленных.
+// Журнал очищается только для сообщений, неудачные попытки которых учтены в этом запуске.
+func (c *consumer) clearAttempts(ctx context.Context, msgs []kafka2.Message) {
+	var keys []postgres.MessageKey
+	for _, msg := range msgs {
+		key := messageKey(msg)
+		if _, ok := c.attempts[key]; ok {
+			delete(c.attempts, key)
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	if err := c.repo.ClearMessageAttempts(ctx, keys); err != nil {
+		c.fail(stageStore, "attempt_record", nil, "", "message attempts not cleared (messages=%d): %v", len(keys), err)
+	}
+}
+
+// sleepCtx - ждёт d по часам clk или отмены ctx; возвращает false, если контекст отменён
+func sleepCtx(ctx context.Context, clk clock.Clock, d time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-clk.After(d):
+		return true
+	}
+}
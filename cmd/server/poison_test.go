@@ -0,0 +1,248 @@
+// Описание: Тесты отправки сообщений, которые не удаётся записать, в очередь недоставленных сообщений: подсчёт попыток,
+// изоляция сообщения в пачке, поведение при недоступной базе данных и очереди недоставленных
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withMaxAttempts - включает отправку в очередь недоставленных после maxAttempts неудачных записей
+func withMaxAttempts(cfg *config.Config, maxAttempts int) *config.Config {
+	cfg.Kafka.DLQTopic = "orders.dlq"
+	cfg.Kafka.Consumer.MaxAttempts = maxAttempts
+	return cfg
+}
+
+// headerValue - значение заголовка сообщения или пустая строка
+func headerValue(msg kafka2.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestConsumerSendsPoisonMessageToDLQ(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 21, 3)
+	msgs[1].Headers = []kafka2.Header{{Key: "trace-id", Value: []byte("abc")}}
+	repo := &fakeRepository{poisonUIDs: map[string]bool{uids[1]: true}}
+	reader := &sliceReader{msgs: msgs}
+	dlq := &fakeWriter{}
+	cfg := withMaxAttempts(newConsumerTestConfig(), 3)
+	cfg.Kafka.Consumer.ErrorBufferSize = 16
+	monitor := newConsumerMonitor(cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, dlq, repo, newTestCache(t), newTestLogger(), cfg, monitor)
+
+	require.Eventually(t, func() bool {
+		return len(reader.committedOffsets()) == 3
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	written := dlq.written()
+	require.Len(t, written, 1)
+	assert.Equal(t, msgs[1].Value, written[0].Value)
+	assert.Equal(t, "abc", headerValue(written[0], "trace-id"), "original headers are kept")
+	assert.Equal(t, dlqReasonPoison, headerValue(written[0], dlqReasonHeader))
+	assert.Equal(t, "3", headerValue(written[0], dlqAttemptsHeader))
+	assert.Equal(t, "1", headerValue(written[0], dlqOffsetHeader))
+	assert.Equal(t, uids[1], headerValue(written[0], dlqOrderHeader))
+	assert.Equal(t, errBatchFailed.Error(), headerValue(written[0], dlqErrorHeader))
+
+	assert.Equal(t, uint64(1), monitor.poison.Value())
+	poisonEntries := 0
+	for _, e := range monitor.errors.Entries(stageStore) {
+		if e.Class == dlqReasonPoison {
+			poisonEntries++
+			assert.Equal(t, uids[1], e.OrderUid)
+		}
+	}
+	assert.Equal(t, 1, poisonEntries)
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	assert.Equal(t, 5, repo.inserts, "two good orders and three attempts of the poison one")
+	assert.Len(t, repo.orders, 2)
+	assert.Empty(t, repo.attempts, "attempts are cleared after the message is quarantined")
+}
+
+func TestBatchedConsumerIsolatesPoisonMessage(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 22, 4)
+	repo := &fakeRepository{poisonUIDs: map[string]bool{uids[1]: true}}
+	reader := &sliceReader{msgs: msgs}
+	reader.onCommit = func(committed []kafka2.Message) {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		for _, m := range committed {
+			if _, stored := repo.orders[uids[m.Offset]]; !stored && m.Offset != 1 {
+				t.Errorf("offset %d committed before order was stored", m.Offset)
+			}
+		}
+	}
+	dlq := &fakeWriter{}
+	orderCache := newTestCache(t)
+	cfg := withMaxAttempts(newBatchedTestConfig(3, time.Hour), 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, dlq, repo, orderCache, newTestLogger(), cfg, nil)
+
+	require.Eventually(t, func() bool {
+		return len(reader.committedOffsets()) == 3
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	assert.Equal(t, []int64{0, 1, 2, 3}, reader.committedOffsets())
+	written := dlq.written()
+	require.Len(t, written, 1)
+	assert.Equal(t, "2", headerValue(written[0], dlqAttemptsHeader))
+	assert.Equal(t, uids[1], headerValue(written[0], dlqOrderHeader))
+
+	_, cached := orderCache.Get(tenant.Default, uids[1])
+	assert.False(t, cached, "quarantined order is evicted from the cache")
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	assert.Len(t, repo.orders, 3)
+	assert.Empty(t, repo.attempts)
+}
+
+func TestConsumerDoesNotQuarantineWhileDatabaseIsDown(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 23, 1)
+	repo := &fakeRepository{err: errors.New("database is down")}
+	reader := &sliceReader{msgs: msgs}
+	dlq := &fakeWriter{}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, dlq, repo, newTestCache(t), newTestLogger(), withMaxAttempts(newConsumerTestConfig(), 2), nil)
+
+	// Попытки не учитываются, пока журнал попыток недоступен вместе с базой данных
+	require.Eventually(t, func() bool {
+		inserts, _ := repo.stats()
+		return inserts >= 10
+	}, 5*time.Second, time.Millisecond)
+	assert.Empty(t, dlq.written())
+	assert.Empty(t, reader.committedOffsets())
+
+	repo.mu.Lock()
+	repo.err = nil
+	repo.mu.Unlock()
+	require.Eventually(t, func() bool {
+		return len(reader.committedOffsets()) == 1
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	assert.Empty(t, dlq.written())
+	_, stored := repo.stats()
+	assert.Equal(t, 1, stored, "order %s is stored after the database recovers", uids[0])
+}
+
+func TestConsumerContinuesAttemptCountAfterRestart(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 24, 1)
+	repo := &fakeRepository{
+		poisonUIDs: map[string]bool{uids[0]: true},
+		attempts:   map[postgres.MessageKey]int{messageKey(msgs[0]): 2},
+	}
+	reader := &sliceReader{msgs: msgs}
+	dlq := &fakeWriter{}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, dlq, repo, newTestCache(t), newTestLogger(), withMaxAttempts(newConsumerTestConfig(), 3), nil)
+
+	require.Eventually(t, func() bool {
+		return len(reader.committedOffsets()) == 1
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	inserts, _ := repo.stats()
+	assert.Equal(t, 1, inserts, "attempts recorded before the restart are counted")
+	require.Len(t, dlq.written(), 1)
+	assert.Equal(t, "3", headerValue(dlq.written()[0], dlqAttemptsHeader))
+}
+
+func TestConsumerRetriesPoisonMessageWhileDLQIsUnavailable(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 25, 1)
+	repo := &fakeRepository{poisonUIDs: map[string]bool{uids[0]: true}}
+	reader := &sliceReader{msgs: msgs}
+	dlq := &fakeWriter{err: errors.New("broker unavailable")}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, dlq, repo, newTestCache(t), newTestLogger(), withMaxAttempts(newConsumerTestConfig(), 2), nil)
+
+	require.Eventually(t, func() bool {
+		inserts, _ := repo.stats()
+		return inserts >= 5
+	}, 5*time.Second, time.Millisecond)
+	assert.Empty(t, reader.committedOffsets(), "message is not committed until it reaches the dlq")
+
+	dlq.setErr(nil)
+	require.Eventually(t, func() bool {
+		return len(reader.committedOffsets()) == 1
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	require.Len(t, dlq.written(), 1)
+}
+
+func TestConsumerWithoutMaxAttemptsSkipsFailedMessage(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 26, 2)
+	repo := &fakeRepository{poisonUIDs: map[string]bool{uids[0]: true}}
+	reader := &sliceReader{msgs: msgs}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), newConsumerTestConfig(), nil)
+
+	require.Eventually(t, func() bool {
+		return len(reader.committedOffsets()) == 2
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	inserts, stored := repo.stats()
+	assert.Equal(t, 2, inserts, "failed write is not retried")
+	assert.Equal(t, 1, stored)
+	assert.Empty(t, repo.attempts)
+}
+
+func TestDLQRecordsCoercedFields(t *testing.T) {
+	t.Cleanup(func() { orders.SetDecodeMode("") })
+	orders.SetDecodeMode(orders.DecodeLenient)
+	msgs, uids := newOrderMessages(t, 27, 1)
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(msgs[0].Value, &fields))
+	fields["sm_id"] = "99"
+	fields["delivery"].(map[string]any)["zip"] = 2639809
+	value, err := json.Marshal(fields)
+	require.NoError(t, err)
+	msgs[0].Value = value
+
+	repo := &fakeRepository{poisonUIDs: map[string]bool{uids[0]: true}}
+	reader := &sliceReader{msgs: msgs}
+	dlq := &fakeWriter{}
+	cfg := withMaxAttempts(newConsumerTestConfig(), 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, dlq, repo, newTestCache(t), newTestLogger(), cfg, nil)
+
+	require.Eventually(t, func() bool {
+		return len(reader.committedOffsets()) == 1
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	written := dlq.written()
+	require.Len(t, written, 1)
+	assert.Equal(t, "delivery.zip: number to string; sm_id: string to integer", headerValue(written[0], dlqCoercedHeader))
+	assert.Equal(t, value, written[0].Value, "the original message is kept")
+}
@@ -0,0 +1,215 @@
+// Описание: Первоочередная запись срочных заказов в пакетном режиме (pipeline.priority): заказы служб доставки из
+// настроек ставятся в отдельную очередь, которую процесс записи пачек разбирает раньше обычной, но не более burst
+// сообщений подряд, пока ждут обычные. Смещения по-прежнему коммитятся по порядку внутри каждой партиции.
+package main
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/metrics"
+
+	kafka2 "github.com/segmentio/kafka-go"
+)
+
+// Классы сообщений очереди пакетного режима в метриках
+const (
+	classPriority = "priority" // заказы служб доставки pipeline.priority.delivery_services
+	classRegular  = "regular"  // остальные сообщения, в том числе без заказа для сохранения
+)
+
+// queueClassStats - глубина очереди и время обработки сообщений одного класса
+type queueClassStats struct {
+	depth   atomic.Int64       // сообщений в очереди, включая ожидающее в ней места
+	latency *metrics.Histogram // от получения сообщения до записи его пачки
+}
+
+// queueStats - метрики очередей пакетного режима по классам сообщений
+type queueStats struct {
+	priority queueClassStats
+	regular  queueClassStats
+}
+
+// newQueueStats - создает пустые метрики очередей
+func newQueueStats() *queueStats {
+	return &queueStats{
+		priority: queueClassStats{latency: metrics.NewHistogram(latencyBuckets)},
+		regular:  queueClassStats{latency: metrics.NewHistogram(latencyBuckets)},
+	}
+}
+
+// class - метрики класса priority или regular
+func (s *queueStats) class(priority bool) *queueClassStats {
+	if priority {
+		return &s.priority
+	}
+	return &s.regular
+}
+
+// register - регистрирует метрики очередей в реестре
+func (s *queueStats) register(reg *metrics.Registry) {
+	reg.GaugeVecFunc("consumer_queue_depth", "Messages waiting in the batched pipeline queues, by class (pipeline.priority).", "class",
+		func() map[string]float64 {
+			return map[string]float64{
+				classPriority: float64(s.priority.depth.Load()),
+				classRegular:  float64(s.regular.depth.Load()),
+			}
+		})
+	reg.RegisterHistogramVec("consumer_queue_processing_seconds", "Time from fetching a message to storing its batch in the batched pipeline, by class.", "class",
+		map[string]*metrics.Histogram{classPriority: s.priority.latency, classRegular: s.regular.latency})
+}
+
+// priorityServices - множество служб доставки срочных заказов в нижнем регистре; nil — приоритет выключен
+func priorityServices(cfg config.PriorityConfig) map[string]bool {
+	if !cfg.Enabled() {
+		return nil
+	}
+	services := make(map[string]bool, len(cfg.DeliveryServices))
+	for _, s := range cfg.DeliveryServices {
+		services[strings.ToLower(strings.TrimSpace(s))] = true
+	}
+	return services
+}
+
+// pipelineQueues - очереди пакетного режима: срочные заказы и все остальные сообщения. Разбирается одной горутиной.
+type pipelineQueues struct {
+	priority chan pendingMessage // nil — приоритет выключен или очередь закрыта и разобрана
+	regular  chan pendingMessage // nil — очередь закрыта и разобрана
+	burst    int                 // сколько срочных сообщений подряд берётся, пока ждут обычные
+	streak   int                 // срочных сообщений взято подряд
+}
+
+// newPipelineQueues - создает очереди ёмкостью size каждая; очередь срочных заказов — только при включённом приоритете
+func newPipelineQueues(size int, cfg config.PriorityConfig) *pipelineQueues {
+	q := &pipelineQueues{regular: make(chan pendingMessage, size), burst: cfg.BurstSize()}
+	if cfg.Enabled() {
+		q.priority = make(chan pendingMessage, size)
+	}
+	return q
+}
+
+// close - закрывает очереди; оставшиеся в них сообщения ещё выдаёт next
+func (q *pipelineQueues) close() {
+	if q.priority != nil {
+		close(q.priority)
+	}
+	close(q.regular)
+}
+
+// next - следующее сообщение для пачки: срочное, пока их взято подряд меньше burst, иначе обычное; если нужной
+// очереди нечего выдать, ждёт сообщения любой из них или срабатывания tick. ok равен false, когда обе очереди
+// закрыты и разобраны; ticked — когда сработал tick.
+func (q *pipelineQueues) next(tick <-chan time.Time) (p pendingMessage, ok, ticked bool) {
+	for {
+		if q.priority == nil && q.regular == nil {
+			return pendingMessage{}, false, false
+		}
+		if q.priority != nil && q.streak < q.burst {
+			select {
+			case p, ok := <-q.priority:
+				if q.take(ok, true) {
+					return p, true, false
+				}
+				continue
+			default:
+			}
+		}
+		if q.regular != nil {
+			select {
+			case p, ok := <-q.regular:
+				if q.take(ok, false) {
+					return p, true, false
+				}
+				continue
+			default:
+			}
+		}
+		select {
+		case p, ok := <-q.priority:
+			if q.take(ok, true) {
+				return p, true, false
+			}
+		case p, ok := <-q.regular:
+			if q.take(ok, false) {
+				return p, true, false
+			}
+		case <-tick:
+			return pendingMessage{}, false, true
+		}
+	}
+}
+
+// take - учитывает получение из очереди срочных (priority) или обычных сообщений; при закрытой очереди забывает её
+// и возвращает false
+func (q *pipelineQueues) take(ok, priority bool) bool {
+	switch {
+	case !ok && priority:
+		q.priority = nil
+	case !ok:
+		q.regular = nil
+	case priority:
+		q.streak++
+	default:
+		q.streak = 0
+	}
+	return ok
+}
+
+// commitOrder - порядок полученных сообщений по партициям. Срочные заказы записываются раньше полученных до них
+// обычных, а коммит смещения подтверждает все предыдущие сообщения партиции, поэтому сообщение коммитится, только
+// когда записаны все полученные раньше сообщения его партиции. Безопасен для конкурентного использования.
+type commitOrder struct {
+	mu      sync.Mutex
+	pending map[topicPartition][]*commitEntry // незакоммиченные сообщения партиций в порядке получения
+}
+
+// commitEntry - сообщение, ожидающее коммита смещения
+type commitEntry struct {
+	msg    kafka2.Message
+	stored bool // сообщение записано (или пропущено) вместе со своей пачкой
+}
+
+// newCommitOrder - создает пустой порядок коммитов
+func newCommitOrder() *commitOrder {
+	return &commitOrder{pending: make(map[topicPartition][]*commitEntry)}
+}
+
+// track - ставит полученное сообщение в конец порядка его партиции
+func (o *commitOrder) track(msg kafka2.Message) *commitEntry {
+	e := &commitEntry{msg: msg}
+	key := topicPartition{topic: msg.Topic, partition: msg.Partition}
+	o.mu.Lock()
+	o.pending[key] = append(o.pending[key], e)
+	o.mu.Unlock()
+	return e
+}
+
+// complete - отмечает сообщения entries записанными и возвращает сообщения, которые можно закоммитить: записанные
+// сообщения от начала порядка каждой партиции до первого незаписанного, по возрастанию смещений
+func (o *commitOrder) complete(entries []*commitEntry) []kafka2.Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	touched := make(map[topicPartition]bool)
+	for _, e := range entries {
+		e.stored = true
+		touched[topicPartition{topic: e.msg.Topic, partition: e.msg.Partition}] = true
+	}
+	var ready []kafka2.Message
+	for key := range touched {
+		list := o.pending[key]
+		n := 0
+		for n < len(list) && list[n].stored {
+			ready = append(ready, list[n].msg)
+			n++
+		}
+		if n == len(list) {
+			delete(o.pending, key)
+		} else {
+			o.pending[key] = list[n:]
+		}
+	}
+	return ready
+}
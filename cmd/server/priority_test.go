@@ -0,0 +1,145 @@
+// Описание: Тесты первоочередной записи срочных заказов (pipeline.priority): выбор очереди с ограничением серии
+// срочных сообщений, порядок записи пачек и коммит смещений по порядку внутри партиций
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/pkg/testorders"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipelineQueuesPreferPriorityWithinBurst(t *testing.T) {
+	q := newPipelineQueues(8, config.PriorityConfig{DeliveryServices: []string{"express"}, Burst: 2})
+	for i := 0; i < 4; i++ {
+		q.regular <- pendingMessage{msg: kafka2.Message{Offset: int64(i)}}
+	}
+	for i := 10; i < 15; i++ {
+		q.priority <- pendingMessage{msg: kafka2.Message{Offset: int64(i)}, priority: true}
+	}
+	q.close()
+
+	var got []int64
+	for {
+		p, ok, ticked := q.next(nil)
+		require.False(t, ticked)
+		if !ok {
+			break
+		}
+		got = append(got, p.msg.Offset)
+	}
+	// Не более двух срочных подряд, пока ждут обычные; после срочных — оставшиеся обычные
+	assert.Equal(t, []int64{10, 11, 0, 12, 13, 1, 14, 2, 3}, got)
+}
+
+func TestPipelineQueuesWaitForTick(t *testing.T) {
+	q := newPipelineQueues(1, config.PriorityConfig{})
+	assert.Nil(t, q.priority, "no priority queue without delivery services")
+	tick := make(chan time.Time, 1)
+	tick <- time.Now()
+	_, ok, ticked := q.next(tick)
+	assert.False(t, ok)
+	assert.True(t, ticked)
+}
+
+func TestCommitOrderCommitsContiguousPrefix(t *testing.T) {
+	o := newCommitOrder()
+	var p0, p1 []*commitEntry
+	for i := 0; i < 4; i++ {
+		p0 = append(p0, o.track(kafka2.Message{Topic: "orders", Partition: 0, Offset: int64(i)}))
+	}
+	for i := 0; i < 2; i++ {
+		p1 = append(p1, o.track(kafka2.Message{Topic: "orders", Partition: 1, Offset: int64(i)}))
+	}
+	offsets := func(msgs []kafka2.Message) []int64 {
+		var out []int64
+		for _, m := range msgs {
+			out = append(out, m.Offset)
+		}
+		return out
+	}
+
+	assert.Empty(t, o.complete(p0[2:]), "later offsets wait for earlier ones of the partition")
+	assert.Equal(t, []int64{0}, offsets(o.complete(p1[:1])), "partitions are independent")
+	assert.Equal(t, []int64{0}, offsets(o.complete(p0[:1])))
+	assert.Equal(t, []int64{1, 2, 3}, offsets(o.complete(p0[1:2])))
+	assert.Equal(t, []int64{1}, offsets(o.complete(p1[1:])))
+	assert.Empty(t, o.pending)
+}
+
+func TestBatchedConsumerStoresPriorityOrdersFirst(t *testing.T) {
+	cfg := newBatchedTestConfig(1, time.Hour)
+	cfg.Pipeline.Priority = config.PriorityConfig{DeliveryServices: []string{"express"}, Burst: 2}
+	reader := &sliceReader{}
+	var commits [][]int64
+	reader.onCommit = func(msgs []kafka2.Message) {
+		var offsets []int64
+		for _, m := range msgs {
+			offsets = append(offsets, m.Offset)
+		}
+		commits = append(commits, offsets)
+	}
+	repo := &fakeRepository{}
+	c := newConsumer(reader, nil, repo, newTestCache(t), newTestLogger(), cfg, nil)
+	queues := newPipelineQueues(cfg.Pipeline.QueueSize, cfg.Pipeline.Priority)
+	order := newCommitOrder()
+
+	// Шесть обычных заказов массовой загрузки, за ними три срочных; сообщения одной партиции
+	gen := testorders.NewGenerator(21)
+	uids := make(map[string]int64)
+	for i := 0; i < 9; i++ {
+		o := gen.Order(testorders.ScenarioDefault)
+		o.DeliveryService = "meest"
+		if i == 7 {
+			o.DeliveryService = "EXPRESS"
+		} else if i > 5 {
+			o.DeliveryService = "express"
+		}
+		msg := kafka2.Message{Topic: "orders", Offset: int64(i)}
+		uids[o.OrderUid] = msg.Offset
+		c.enqueue(queues, pendingMessage{msg: msg, tenant: tenant.Default, order: o, ok: true, fetched: time.Now(), commit: order.track(msg)})
+	}
+	assert.Equal(t, int64(3), c.queues.priority.depth.Load())
+	assert.Equal(t, int64(6), c.queues.regular.depth.Load())
+	queues.close()
+
+	c.flushLoop(context.Background(), queues, order)
+
+	var stored []int64
+	repo.mu.Lock()
+	for _, batch := range repo.batchUIDs {
+		for _, uid := range batch {
+			stored = append(stored, uids[uid])
+		}
+	}
+	repo.mu.Unlock()
+	assert.Equal(t, []int64{6, 7, 0, 8, 1, 2, 3, 4, 5}, stored, "priority orders are stored ahead of the backlog")
+	// Смещение срочного заказа коммитится только вместе с предшествующими ему обычными
+	assert.Equal(t, [][]int64{{0}, {1}, {2}, {3}, {4}, {5, 6, 7, 8}}, commits)
+
+	assert.Zero(t, c.queues.priority.depth.Load())
+	assert.Zero(t, c.queues.regular.depth.Load())
+	assert.Equal(t, uint64(3), c.queues.priority.latency.Count())
+	assert.Equal(t, uint64(6), c.queues.regular.latency.Count())
+}
+
+func TestBatchedConsumerQueuesUnstoredMessagesAsRegular(t *testing.T) {
+	cfg := newBatchedTestConfig(1, time.Hour)
+	cfg.Pipeline.Priority = config.PriorityConfig{DeliveryServices: []string{"express"}}
+	c := newConsumer(&sliceReader{}, nil, &fakeRepository{}, newTestCache(t), newTestLogger(), cfg, nil)
+	queues := newPipelineQueues(cfg.Pipeline.QueueSize, cfg.Pipeline.Priority)
+
+	o := testorders.NewGenerator(22).Order(testorders.ScenarioDefault)
+	o.DeliveryService = "express"
+	// Повтор или отклонённый заказ не записывается: ему незачем опережать очередь
+	c.enqueue(queues, pendingMessage{order: o, ok: false})
+	assert.Len(t, queues.regular, 1)
+	assert.Empty(t, queues.priority)
+}
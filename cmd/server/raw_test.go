@@ -0,0 +1,123 @@
+// Описание: Тесты хранения исходных сообщений Kafka: побайтовое сохранение, выдача через API и удаление по сроку хранения
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/pkg/client/postgres"
+	"l0_test_self/pkg/testorders"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRawOrderMessage - создает сообщение с заказом в форматировании, отличном от повторной сериализации
+func newRawOrderMessage(t *testing.T, seed int64, offset int64) (kafka2.Message, string) {
+	t.Helper()
+	o := testorders.NewGenerator(seed).Order(testorders.ScenarioDefault)
+	compact, err := json.Marshal(o)
+	require.NoError(t, err)
+	var indented bytes.Buffer
+	require.NoError(t, json.Indent(&indented, compact, "", "\t"))
+	indented.WriteString("\n")
+	return kafka2.Message{Topic: "orders", Partition: 3, Offset: offset, Value: indented.Bytes()}, o.OrderUid
+}
+
+func runConsumerUntilCommitted(t *testing.T, cfg *config.Config, repo *fakeRepository, msgs []kafka2.Message) {
+	t.Helper()
+	reader := &sliceReader{msgs: msgs}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), cfg, nil)
+	require.Eventually(t, func() bool {
+		return len(reader.committedOffsets()) == len(msgs)
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+}
+
+func TestConsumerStoresRawPayloadByteIdentical(t *testing.T) {
+	for _, mode := range []string{config.PipelineModeSync, config.PipelineModeBatched} {
+		t.Run(mode, func(t *testing.T) {
+			msg, uid := newRawOrderMessage(t, 21, 42)
+			original := append([]byte(nil), msg.Value...)
+
+			cfg := newBatchedTestConfig(1, time.Hour)
+			cfg.Pipeline.Mode = mode
+			cfg.RawPayloads.Enabled = true
+			repo := &fakeRepository{}
+			runConsumerUntilCommitted(t, cfg, repo, []kafka2.Message{msg})
+
+			raw, err := repo.GetRawPayload(context.Background(), tenant.Default, uid)
+			require.NoError(t, err)
+			assert.Equal(t, original, raw.Payload)
+			assert.Equal(t, "orders", raw.Topic)
+			assert.Equal(t, 3, raw.Partition)
+			assert.Equal(t, int64(42), raw.Offset)
+			assert.WithinDuration(t, time.Now(), raw.ReceivedAt, time.Minute)
+		})
+	}
+}
+
+func TestConsumerSkipsRawPayloadWhenDisabled(t *testing.T) {
+	msg, uid := newRawOrderMessage(t, 22, 0)
+	repo := &fakeRepository{}
+	runConsumerUntilCommitted(t, newConsumerTestConfig(), repo, []kafka2.Message{msg})
+
+	_, stored := repo.stats()
+	assert.Equal(t, 1, stored)
+	_, err := repo.GetRawPayload(context.Background(), tenant.Default, uid)
+	assert.ErrorIs(t, err, postgres.ErrRawPayloadNotFound)
+}
+
+func TestRawPayloadEndpointReturnsOriginalBytes(t *testing.T) {
+	payload := []byte("{\n  \"order_uid\": \"order-1\",  \"unknown\": [1.50, 2e3]\n}\n")
+	receivedAt := time.Date(2024, 5, 1, 12, 30, 0, 123, time.UTC)
+	repo := &fakeRepository{raws: map[string]postgres.RawPayload{
+		"order-1": {OrderUid: "order-1", Payload: payload, ReceivedAt: receivedAt, Topic: "orders", Partition: 2, Offset: 1234},
+	}}
+	mux := http.NewServeMux()
+	mux.Handle("GET /admin/orders/{id}/raw", requireAdmin(testAdminKey, withDefaultTenant(makeRawPayloadHandler(repo, newTestLogger()))))
+
+	get := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/orders/"+id+"/raw", nil)
+		req.Header.Set("X-API-Key", testAdminKey)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("order-1")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, payload, rec.Body.Bytes())
+	assert.Equal(t, "orders", rec.Header().Get("X-Kafka-Topic"))
+	assert.Equal(t, "2", rec.Header().Get("X-Kafka-Partition"))
+	assert.Equal(t, "1234", rec.Header().Get("X-Kafka-Offset"))
+	assert.Equal(t, "2024-05-01T12:30:00.000000123Z", rec.Header().Get("X-Received-At"))
+
+	assert.Equal(t, http.StatusNotFound, get("order-2").Code)
+	assert.Equal(t, http.StatusBadRequest, get("order%201").Code)
+}
+
+func TestCleanupRawPayloadsDeletesOnlyExpired(t *testing.T) {
+	now := time.Now()
+	repo := &fakeRepository{raws: map[string]postgres.RawPayload{
+		"old":   {OrderUid: "old", ReceivedAt: now.Add(-48 * time.Hour)},
+		"fresh": {OrderUid: "fresh", ReceivedAt: now.Add(-time.Hour)},
+	}}
+
+	cleanupRawPayloads(context.Background(), repo, now.Add(-24*time.Hour), newTestLogger())
+
+	_, err := repo.GetRawPayload(context.Background(), tenant.Default, "old")
+	assert.ErrorIs(t, err, postgres.ErrRawPayloadNotFound)
+	_, err = repo.GetRawPayload(context.Background(), tenant.Default, "fresh")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,142 @@
+// Описание: Готовность экземпляра в GET /readyz: флаг db_degraded на время восстановления пула соединений, флаг
+// replica_degraded, пока реплика базы данных недоступна, и флаг consumer_lag_degraded, когда отставание читателя
+// Kafka дольше допустимого превышает kafka.consumer.max_ready_lag
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/metrics"
+)
+
+// lagReadiness - деградация консьюмера по отставанию читателя. Деградация наступает, когда отставание превышает maxLag
+// непрерывно не меньше grace, и снимается, только когда оно опустится до clearLag: отставание между порогами
+// не переключает флаг. nil выключает проверку: методы nil получателя ничего не делают
+type lagReadiness struct {
+	maxLag   int64
+	clearLag int64
+	grace    time.Duration
+	unready  bool // при деградации GET /readyz отвечает 503
+	logger   *log.Logger
+
+	mu         sync.Mutex
+	lag        int64     // последнее отставание читателя
+	aboveSince time.Time // начало непрерывного превышения maxLag; нулевое — отставание не выше max
+	degraded   bool
+
+	degradations *metrics.Counter // переходы в деградацию
+}
+
+// newLagReadiness - проверка отставания читателя по настройкам консьюмера cfg; nil, если max_ready_lag не задан
+func newLagReadiness(cfg config.ConsumerConfig, logger *log.Logger) *lagReadiness {
+	if cfg.MaxReadyLag <= 0 {
+		return nil
+	}
+	clearLag := cfg.ReadyLagClear
+	if clearLag == 0 {
+		clearLag = cfg.MaxReadyLag / 2
+	}
+	return &lagReadiness{
+		maxLag:       cfg.MaxReadyLag,
+		clearLag:     clearLag,
+		grace:        cfg.ReadyLagGrace,
+		unready:      cfg.ReadyLagUnready,
+		logger:       logger,
+		degradations: &metrics.Counter{},
+	}
+}
+
+// register - регистрирует метрики деградации по отставанию в реестре метрик
+func (l *lagReadiness) register(reg *metrics.Registry) {
+	if l == nil {
+		return
+	}
+	reg.RegisterCounter("consumer_lag_degradations_total", "Times the reader lag stayed above kafka.consumer.max_ready_lag for ready_lag_grace.", l.degradations)
+	reg.GaugeFunc("consumer_lag_degraded", "1 while the consumer is degraded by reader lag (see kafka.consumer.max_ready_lag), 0 otherwise.", func() float64 {
+		if _, degraded := l.state(); degraded {
+			return 1
+		}
+		return 0
+	})
+}
+
+// observe - учитывает отставание читателя lag, снятое в момент now
+func (l *lagReadiness) observe(lag int64, now time.Time) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lag = lag
+	if lag <= l.maxLag {
+		l.aboveSince = time.Time{}
+		if l.degraded && lag <= l.clearLag {
+			l.degraded = false
+			l.logger.Printf("consumer lag %d is back at or below %d, consumer is ready", lag, l.clearLag)
+		}
+		return
+	}
+	if l.aboveSince.IsZero() {
+		l.aboveSince = now
+	}
+	if !l.degraded && now.Sub(l.aboveSince) >= l.grace {
+		l.degraded = true
+		l.degradations.Inc()
+		l.logger.Printf("consumer lag %d has been above %d for %s, consumer is degraded", lag, l.maxLag, now.Sub(l.aboveSince))
+	}
+}
+
+// state - последнее отставание читателя и флаг деградации
+func (l *lagReadiness) state() (lag int64, degraded bool) {
+	if l == nil {
+		return 0, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lag, l.degraded
+}
+
+// readinessResponse - ответ GET /readyz
+type readinessResponse struct {
+	Status     string `json:"status"`      // ok или degraded
+	DBDegraded bool   `json:"db_degraded"` // идёт восстановление пула после потери соединений с базой данных
+	// ReplicaDegraded - реплика настроена, но не прошла проверку: чтения выполняются на основной базе
+	ReplicaDegraded bool `json:"replica_degraded"`
+	// ConsumerLagDegraded - отставание читателя дольше ready_lag_grace превышает max_ready_lag
+	ConsumerLagDegraded bool `json:"consumer_lag_degraded"`
+	// ConsumerLag - последнее отставание читателя; нет, если проверка отставания выключена
+	ConsumerLag *int64 `json:"consumer_lag,omitempty"`
+}
+
+// makeReadinessHandler - HTTP обработчик GET /readyz: состояние готовности с флагом db_degraded на время
+// восстановления пула, флагом replica_degraded, пока реплика недоступна, и флагом consumer_lag_degraded при большом
+// отставании читателя. Ответ 200: ответы из кэша и чтение Kafka во время восстановления продолжаются, чтения
+// без реплики выполняются на основной базе, а снятие нагрузки с экземпляра отставание не уменьшает, поэтому
+// решение принимается по флагам. 503 возвращается только при деградации по отставанию с ready_lag_unready.
+func makeReadinessHandler(db *dbRecovery, replica *replicaPool, lag *lagReadiness, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := readinessResponse{Status: "ok", DBDegraded: db.isDegraded(), ReplicaDegraded: replica.isDegraded()}
+		if lag != nil {
+			current, degraded := lag.state()
+			resp.ConsumerLag, resp.ConsumerLagDegraded = &current, degraded
+		}
+		status := http.StatusOK
+		if resp.DBDegraded || resp.ReplicaDegraded || resp.ConsumerLagDegraded {
+			resp.Status = "degraded"
+		}
+		if resp.ConsumerLagDegraded && lag.unready {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", requestIDFromContext(r.Context()), err)
+		}
+	}
+}
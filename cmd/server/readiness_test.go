@@ -0,0 +1,145 @@
+// Описание: Тесты готовности по отставанию читателя: деградация только после grace, снятие с гистерезисом,
+// ответ GET /readyz (флаг или 503) и передача отставания из статистики клиентов Kafka
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/logging"
+	"l0_test_self/internal/metrics"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lagSample - отставание читателя, снятое через at после начала ряда, и ожидаемый флаг деградации после него
+type lagSample struct {
+	at       time.Duration
+	lag      int64
+	degraded bool
+}
+
+// replayLag - передаёт проверке ряд отставаний и сверяет флаг деградации после каждого
+func replayLag(t *testing.T, l *lagReadiness, series []lagSample) {
+	t.Helper()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, s := range series {
+		l.observe(s.lag, start.Add(s.at))
+		lag, degraded := l.state()
+		assert.Equal(t, s.lag, lag)
+		assert.Equal(t, s.degraded, degraded, "lag %d at %s", s.lag, s.at)
+	}
+}
+
+func TestLagReadinessGracePeriod(t *testing.T) {
+	l := newLagReadiness(config.ConsumerConfig{MaxReadyLag: 1000, ReadyLagGrace: time.Minute}, newTestLogger())
+	replayLag(t, l, []lagSample{
+		{at: 0, lag: 5000},
+		{at: 30 * time.Second, lag: 5000},
+		// Кратковременный спад ниже порога начинает отсчёт grace заново
+		{at: 45 * time.Second, lag: 900},
+		{at: 60 * time.Second, lag: 1500},
+		{at: 90 * time.Second, lag: 2000},
+		{at: 2 * time.Minute, lag: 2500, degraded: true},
+		{at: 3 * time.Minute, lag: 3000, degraded: true},
+	})
+	assert.Equal(t, uint64(1), l.degradations.Value(), "staying degraded is one degradation")
+}
+
+func TestLagReadinessHysteresis(t *testing.T) {
+	l := newLagReadiness(config.ConsumerConfig{MaxReadyLag: 1000, ReadyLagClear: 200}, newTestLogger())
+	replayLag(t, l, []lagSample{
+		{at: 0, lag: 1001, degraded: true},
+		// Отставание между порогами не снимает деградацию
+		{at: 30 * time.Second, lag: 999, degraded: true},
+		{at: time.Minute, lag: 500, degraded: true},
+		{at: 90 * time.Second, lag: 1200, degraded: true},
+		{at: 2 * time.Minute, lag: 201, degraded: true},
+		{at: 150 * time.Second, lag: 200},
+		// Отставание между порогами не возвращает деградацию
+		{at: 3 * time.Minute, lag: 1000},
+		{at: 210 * time.Second, lag: 600},
+		{at: 4 * time.Minute, lag: 1001, degraded: true},
+	})
+	assert.Equal(t, uint64(2), l.degradations.Value())
+
+	// Без ready_lag_clear деградация снимается на половине max_ready_lag
+	l = newLagReadiness(config.ConsumerConfig{MaxReadyLag: 1000}, newTestLogger())
+	replayLag(t, l, []lagSample{
+		{at: 0, lag: 1500, degraded: true},
+		{at: time.Second, lag: 501, degraded: true},
+		{at: 2 * time.Second, lag: 500},
+	})
+
+	var disabled *lagReadiness
+	disabled.observe(1_000_000, time.Now())
+	_, degraded := disabled.state()
+	assert.False(t, degraded)
+	assert.Nil(t, newLagReadiness(config.ConsumerConfig{}, newTestLogger()))
+}
+
+func TestReadinessReportsConsumerLag(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		unready bool
+		status  int
+	}{
+		{name: "flag", status: http.StatusOK},
+		{name: "unready", unready: true, status: http.StatusServiceUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newLagReadiness(config.ConsumerConfig{MaxReadyLag: 100, ReadyLagUnready: tc.unready}, newTestLogger())
+			h := makeReadinessHandler(nil, nil, l, newTestLogger())
+			readiness := func(wantStatus int) readinessResponse {
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+				require.Equal(t, wantStatus, rec.Code)
+				var resp readinessResponse
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+				return resp
+			}
+
+			l.observe(40, time.Now())
+			resp := readiness(http.StatusOK)
+			assert.Equal(t, "ok", resp.Status)
+			assert.False(t, resp.ConsumerLagDegraded)
+			require.NotNil(t, resp.ConsumerLag)
+			assert.Equal(t, int64(40), *resp.ConsumerLag)
+
+			l.observe(400, time.Now())
+			resp = readiness(tc.status)
+			assert.Equal(t, "degraded", resp.Status)
+			assert.True(t, resp.ConsumerLagDegraded)
+			assert.False(t, resp.DBDegraded)
+		})
+	}
+}
+
+func TestKafkaStatsFeedsLagReadiness(t *testing.T) {
+	stats := newKafkaStats()
+	stats.readiness = newLagReadiness(config.ConsumerConfig{MaxReadyLag: 100}, newTestLogger())
+	stats.add("reader", &scriptedStats{deltas: []KafkaClientStats{{Lag: 150}, {Lag: 80}, {Lag: 10}}})
+	stats.add("dlq", &scriptedStats{deltas: []KafkaClientStats{{Lag: 1000}}})
+	reg := metrics.NewRegistry()
+	stats.readiness.register(reg)
+	logger := logging.NewLeveled(newTestLogger(), logging.LevelInfo)
+
+	gauge := func() string {
+		var buf bytes.Buffer
+		require.NoError(t, reg.WriteText(&buf))
+		return buf.String()
+	}
+	stats.collect(logger)
+	assert.Contains(t, gauge(), "consumer_lag_degraded 1")
+	stats.collect(logger)
+	assert.Contains(t, gauge(), "consumer_lag_degraded 1", "80 is above the clear threshold of 50")
+	stats.collect(logger)
+	assert.Contains(t, gauge(), "consumer_lag_degraded 0")
+	assert.Contains(t, gauge(), "consumer_lag_degradations_total 1")
+}
@@ -0,0 +1,63 @@
+// Описание: Кольцо кратких сведений о последних заказах, записанных консьюмером, для GET /api/recent
+package main
+
+import (
+	"sync"
+
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+)
+
+// recentOrder - запись кольца последних заказов
+type recentOrder struct {
+	tenant  string
+	summary postgres.OrderSummary
+}
+
+// recentOrders - кольцо фиксированного размера с краткими сведениями о последних записанных заказах всех арендаторов;
+// новая запись вытесняет самую старую. Безопасно для конкурентного использования; nil кольцо ничего не хранит.
+type recentOrders struct {
+	mu      sync.Mutex
+	entries []recentOrder
+	next    int // позиция следующей записи
+	count   int // число занятых позиций
+}
+
+// newRecentOrders - создает кольцо на size заказов (не меньше одного)
+func newRecentOrders(size int) *recentOrders {
+	return &recentOrders{entries: make([]recentOrder, max(size, 1))}
+}
+
+// add - запоминает заказ арендатора tenantID как самый новый; заказы в карантине не запоминаются
+func (r *recentOrders) add(tenantID string, order *orders.Order) {
+	if r == nil || order.Quarantined {
+		return
+	}
+	entry := recentOrder{tenant: tenantID, summary: postgres.Summarize(order)}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+	r.count = min(r.count+1, len(r.entries))
+}
+
+// list - возвращает до limit последних заказов арендатора tenantID, начиная с самого нового; повторно записанный
+// заказ возвращается один раз
+func (r *recentOrders) list(tenantID string, limit int) []postgres.OrderSummary {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var list []postgres.OrderSummary
+	seen := make(map[string]bool)
+	for i := 1; i <= r.count && len(list) < limit; i++ {
+		e := r.entries[(r.next-i+len(r.entries))%len(r.entries)]
+		if e.tenant != tenantID || seen[e.summary.OrderUid] {
+			continue
+		}
+		seen[e.summary.OrderUid] = true
+		list = append(list, e.summary)
+	}
+	return list
+}
@@ -0,0 +1,85 @@
+// Описание: Тесты кольца последних записанных заказов: порядок от новых к старым, вытеснение старых записей,
+// разделение по арендаторам и конкурентные запись и чтение
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recentUIDs - идентификаторы заказов из кольца в порядке выдачи
+func recentUIDs(r *recentOrders, tenantID string, limit int) []string {
+	var uids []string
+	for _, s := range r.list(tenantID, limit) {
+		uids = append(uids, s.OrderUid)
+	}
+	return uids
+}
+
+func TestRecentOrdersRing(t *testing.T) {
+	r := newRecentOrders(3)
+	assert.Empty(t, r.list(tenant.Default, 10))
+
+	for _, uid := range []string{"a", "b", "c", "d"} {
+		r.add(tenant.Default, &orders.Order{OrderUid: uid, Items: []orders.Item{{}, {}}})
+	}
+	assert.Equal(t, []string{"d", "c", "b"}, recentUIDs(r, tenant.Default, 10), "the oldest order is evicted")
+	assert.Equal(t, []string{"d", "c"}, recentUIDs(r, tenant.Default, 2))
+	assert.Equal(t, 2, r.list(tenant.Default, 1)[0].ItemCount)
+
+	// Повторно записанный заказ выдаётся один раз на месте последней записи; заказы в карантине не запоминаются
+	r.add(tenant.Default, &orders.Order{OrderUid: "C"})
+	r.add(tenant.Default, &orders.Order{OrderUid: "q", Quarantined: true})
+	assert.Equal(t, []string{"c", "d"}, recentUIDs(r, tenant.Default, 10))
+
+	// Заказы других арендаторов не выдаются
+	r.add("market-a", &orders.Order{OrderUid: "m"})
+	assert.Equal(t, []string{"m"}, recentUIDs(r, "market-a", 10))
+	assert.Equal(t, []string{"c", "d"}, recentUIDs(r, tenant.Default, 10))
+
+	var disabled *recentOrders
+	disabled.add(tenant.Default, &orders.Order{OrderUid: "a"})
+	assert.Nil(t, disabled.list(tenant.Default, 10))
+}
+
+func TestRecentOrdersConcurrentAccess(t *testing.T) {
+	const writers, perWriter, size = 8, 500, 64
+	r := newRecentOrders(size)
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := range perWriter {
+				r.add(tenant.Default, &orders.Order{OrderUid: fmt.Sprintf("w%d-%04d", w, i)})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range perWriter {
+				list := r.list(tenant.Default, size)
+				assert.LessOrEqual(t, len(list), size)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Кольцо заполнено последними записями: у каждого писателя записи выдаются от новых к старым
+	list := r.list(tenant.Default, size+1)
+	require.Len(t, list, size)
+	last := make(map[byte]string)
+	for _, s := range list {
+		writer := s.OrderUid[1]
+		if prev, ok := last[writer]; ok {
+			assert.Less(t, s.OrderUid, prev, "orders of one writer are listed newest first")
+		}
+		last[writer] = s.OrderUid
+	}
+}
@@ -0,0 +1,52 @@
+// Описание: Маскирование персональных данных доставки в ответах API в зависимости от роли ключа вызывающего
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/redact"
+	"l0_test_self/models/orders"
+)
+
+// piiPolicy - определяет по ключу запроса, видит ли вызывающий телефон и email доставки без маскирования.
+// Нулевое значение не маскирует данные.
+type piiPolicy struct {
+	enabled  bool
+	adminKey string
+	roleKeys map[string]string
+}
+
+// newPIIPolicy - создаёт политику из настроек административного API: полный доступ у admin.api_key и ключей с ролью full
+func newPIIPolicy(cfg config.AdminConfig) piiPolicy {
+	return piiPolicy{enabled: cfg.RedactPII, adminKey: cfg.APIKey, roleKeys: cfg.RoleKeys}
+}
+
+// fullAccess - сообщает, получает ли запрос данные заказа без маскирования
+func (p piiPolicy) fullAccess(r *http.Request) bool {
+	if !p.enabled {
+		return true
+	}
+	key := requestAPIKey(r)
+	if key == "" {
+		return false
+	}
+	if p.adminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(p.adminKey)) == 1 {
+		return true
+	}
+	for k, role := range p.roleKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			return role == config.RoleFull
+		}
+	}
+	return false
+}
+
+// redactOrder - возвращает копию заказа с замаскированными телефоном и email доставки.
+// Delivery хранится в заказе по значению, поэтому исходный заказ (в том числе в кэше) не изменяется.
+func redactOrder(o orders.Order) orders.Order {
+	o.Delivery.Phone = redact.Phone(o.Delivery.Phone)
+	o.Delivery.Email = redact.Email(o.Delivery.Email)
+	return o
+}
@@ -0,0 +1,97 @@
+// Описание: Тесты маскирования персональных данных доставки в ответах /order и /orders по роли ключа
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testSupportKey = "support-key"
+	testFullKey    = "full-key"
+)
+
+func newTestPIIPolicy() piiPolicy {
+	return newPIIPolicy(config.AdminConfig{
+		APIKey:    testAdminKey,
+		RedactPII: true,
+		RoleKeys:  map[string]string{testSupportKey: config.RoleSupport, testFullKey: config.RoleFull},
+	})
+}
+
+func piiTestOrder() orders.Order {
+	return orders.Order{OrderUid: "order-1", TrackNumber: "TRACK-1", Delivery: orders.Delivery{
+		Name: "Test Testov", Phone: "+9720000000", Email: "test@gmail.com", City: "Kiryat Mozkin",
+	}}
+}
+
+// getWithKey - выполняет GET запрос к обработчику с ключом API (пустой — без ключа)
+func getWithKey(t *testing.T, h http.Handler, url, key string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	return rec
+}
+
+func TestOrderHandlerRedactsPIIByRole(t *testing.T) {
+	c := newTestCache(t)
+	c.Set(tenant.Default, piiTestOrder())
+	h := withDefaultTenant(makeOrderHandler(c, &fakeRepository{}, newTestPIIPolicy(), nil, newTestLogger()))
+
+	for _, key := range []string{"", testSupportKey, "unknown-key"} {
+		var got orders.Order
+		require.NoError(t, json.Unmarshal(getWithKey(t, h, "/order?id=order-1", key).Body.Bytes(), &got))
+		assert.Equal(t, "+972*****00", got.Delivery.Phone, key)
+		assert.Equal(t, "t***@gmail.com", got.Delivery.Email, key)
+		assert.Equal(t, "Test Testov", got.Delivery.Name, "other fields are not masked")
+	}
+
+	for _, key := range []string{testAdminKey, testFullKey} {
+		var got orders.Order
+		require.NoError(t, json.Unmarshal(getWithKey(t, h, "/order?id=order-1", key).Body.Bytes(), &got))
+		assert.Equal(t, piiTestOrder().Delivery, got.Delivery, key)
+	}
+
+	cached, ok := c.Get(tenant.Default, "order-1")
+	require.True(t, ok)
+	assert.Equal(t, piiTestOrder().Delivery, cached.Delivery, "the cache keeps raw values")
+}
+
+func TestOrderSearchHandlerRedactsPIIByRole(t *testing.T) {
+	repo := &fakeRepository{orders: map[string]orders.Order{"order-1": piiTestOrder()}}
+	h := withDefaultTenant(makeOrderSearchHandler(repo, newTestPIIPolicy(), newTestCursorSigner(t), newTestLogger()))
+
+	var page orderSearchPage
+	require.NoError(t, json.Unmarshal(getWithKey(t, h, "/orders?track_number=TRACK-1&include=delivery", testSupportKey).Body.Bytes(), &page))
+	require.Len(t, page.Orders, 1)
+	assert.Equal(t, "+972*****00", page.Orders[0].Delivery.Phone)
+	assert.Equal(t, "t***@gmail.com", page.Orders[0].Delivery.Email)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders?track_number=TRACK-1&include=delivery", nil)
+	req.Header.Set("Authorization", "Bearer "+testFullKey)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	page = orderSearchPage{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	require.Len(t, page.Orders, 1)
+	assert.Equal(t, piiTestOrder().Delivery, page.Orders[0].Delivery)
+}
+
+func TestPIIPolicyDisabled(t *testing.T) {
+	p := newPIIPolicy(config.AdminConfig{APIKey: testAdminKey})
+	assert.True(t, p.fullAccess(httptest.NewRequest(http.MethodGet, "/order", nil)), "without redact_pii everyone sees raw data")
+}
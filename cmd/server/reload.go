@@ -0,0 +1,71 @@
+// Описание: Совместная загрузка заказа при промахе кэша GET /order: одновременные запросы одного заказа ждут одного
+// чтения из базы данных, результат которого записывается в кэш. Так же в кэш возвращаются заказы, у которых после
+// cache.demote_after без обращений остался только заголовок
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+)
+
+// orderLoad - выполняющееся чтение заказа; order и err заполняются до закрытия done
+type orderLoad struct {
+	done    chan struct{}
+	order   orders.Order
+	err     error
+	waiters int // запросы, ждущие результата этого чтения; изменяется под orderLoader.mu
+}
+
+// orderLoader - объединяет одновременные чтения одного заказа из базы данных и записывает прочитанный заказ в кэш
+type orderLoader struct {
+	repo  OrderRepository
+	cache OrderCache
+
+	mu    sync.Mutex
+	loads map[string]*orderLoad // выполняющиеся чтения по tenant.Key
+}
+
+// newOrderLoader - создает загрузчик заказов из repo в orderCache
+func newOrderLoader(repo OrderRepository, orderCache OrderCache) *orderLoader {
+	return &orderLoader{repo: repo, cache: orderCache, loads: make(map[string]*orderLoad)}
+}
+
+// load - читает заказ из базы данных и записывает его в кэш с версией момента начала чтения. Если тот же заказ
+// уже читается другим запросом, ждёт результата этого чтения вместо нового запроса к базе; ожидание прерывается
+// отменой ctx. Чтение выполняется с контекстом первого запроса, и его ошибка достаётся всем ждущим.
+func (l *orderLoader) load(ctx context.Context, tenantID, orderID string) (orders.Order, error) {
+	key := tenant.Key(tenantID, orderID)
+	l.mu.Lock()
+	if ld, ok := l.loads[key]; ok {
+		ld.waiters++
+		l.mu.Unlock()
+		select {
+		case <-ld.done:
+			return ld.order, ld.err
+		case <-ctx.Done():
+			return orders.Order{}, ctx.Err()
+		}
+	}
+	ld := &orderLoad{done: make(chan struct{})}
+	l.loads[key] = ld
+	l.mu.Unlock()
+
+	// Версия — момент начала чтения, как и при принудительном обновлении заказа
+	version := time.Now().UnixNano()
+	// Прочитанный заказ попадает в кэш, поэтому читается с основной базы: отставшая реплика могла ещё не получить
+	// только что записанный заказ
+	ld.order, ld.err = l.repo.GetOrderByUID(withPrimaryRead(ctx), tenantID, orderID)
+	if ld.err == nil {
+		l.cache.SetIfNewer(tenantID, ld.order, version)
+	}
+
+	l.mu.Lock()
+	delete(l.loads, key)
+	l.mu.Unlock()
+	close(ld.done)
+	return ld.order, ld.err
+}
@@ -0,0 +1,127 @@
+// Описание: Тесты совместной загрузки заказов: одновременные промахи одного заказа читают базу данных один раз,
+// ожидание прерывается отменой контекста запроса, а пониженный в кэше заказ отвечает на HEAD без базы данных
+// и возвращается в кэш при GET /order
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/cache"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadWaiters - число запросов, ждущих чтения заказа id арендатора по умолчанию
+func loadWaiters(l *orderLoader, id string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ld, ok := l.loads[tenant.Key(tenant.Default, id)]; ok {
+		return ld.waiters
+	}
+	return 0
+}
+
+func TestOrderLoaderSharesConcurrentReads(t *testing.T) {
+	repo, started, release := newBlockingReadRepository(t)
+	c := newTestCache(t)
+	l := newOrderLoader(repo, c)
+
+	const requests = 5
+	var wg sync.WaitGroup
+	results := make(chan orders.Order, requests)
+	load := func() {
+		defer wg.Done()
+		o, err := l.load(context.Background(), tenant.Default, "order-1")
+		assert.NoError(t, err)
+		results <- o
+	}
+	wg.Add(requests)
+	go load()
+	<-started
+	for i := 1; i < requests; i++ {
+		go load()
+	}
+	require.Eventually(t, func() bool { return loadWaiters(l, "order-1") == requests-1 }, 5*time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	for o := range results {
+		assert.Equal(t, "order-1", o.OrderUid)
+	}
+	assert.Equal(t, 1, repo.reads, "concurrent misses share one database read")
+	_, ok := c.Get(tenant.Default, "order-1")
+	assert.True(t, ok)
+	assert.Empty(t, l.loads)
+}
+
+func TestOrderLoaderWaiterCancel(t *testing.T) {
+	repo, started, release := newBlockingReadRepository(t)
+	l := newOrderLoader(repo, newTestCache(t))
+
+	leader := make(chan error, 1)
+	go func() {
+		_, err := l.load(context.Background(), tenant.Default, "order-1")
+		leader <- err
+	}()
+	<-started
+	ctx, cancel := context.WithCancel(context.Background())
+	waiter := make(chan error, 1)
+	go func() {
+		_, err := l.load(ctx, tenant.Default, "order-1")
+		waiter <- err
+	}()
+	require.Eventually(t, func() bool { return loadWaiters(l, "order-1") == 1 }, 5*time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-waiter, context.Canceled)
+
+	// Отменённое ожидание не прерывает чтение первого запроса
+	close(release)
+	assert.NoError(t, <-leader)
+	assert.Equal(t, 1, repo.reads)
+}
+
+func TestDemotedOrderReloadedOnGet(t *testing.T) {
+	c, err := cache.NewWithOptions(cache.WithShards(4), cache.WithDemoteAfter(time.Millisecond), cache.WithCleanupInterval(time.Millisecond))
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+	full := orders.Order{OrderUid: "order-1", Items: []orders.Item{{ChrtId: 1, Name: "Mascaras"}, {ChrtId: 2, Name: "Lipstick"}}}
+	c.Set(tenant.Default, full)
+	require.Eventually(t, func() bool { return c.DemotionStats().Demoted == 1 }, 5*time.Second, time.Millisecond)
+	repo := &fakeRepository{orders: map[string]orders.Order{"order-1": full}}
+
+	// Пониженный заказ отвечает на проверку существования без обращения к базе данных
+	rec := headOrder(t, withDefaultTenant(makeOrderExistsHandler(c, repo, newTestLogger())), "order-1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Zero(t, repo.existsCalls)
+	assert.Zero(t, repo.reads)
+
+	rec = getOrder(t, withDefaultTenant(makeOrderHandler(c, repo, piiPolicy{}, nil, newTestLogger())), "order-1")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var got orders.Order
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, full.Items, got.Items, "the full order is read back from the database")
+	assert.Equal(t, 1, repo.reads)
+
+	rec = httptest.NewRecorder()
+	makeCacheStatsHandler(c, nil, newTestLogger()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/cache/stats", nil))
+	var stats cacheStatsResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	require.NotNil(t, stats.Demotion)
+	assert.Equal(t, uint64(1), stats.Demotion.Repromotions)
+	assert.GreaterOrEqual(t, stats.Demotion.Demotions, uint64(1))
+
+	// Без cache.demote_after счётчики понижения не выводятся
+	rec = httptest.NewRecorder()
+	makeCacheStatsHandler(newTestCache(t), nil, newTestLogger()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/cache/stats", nil))
+	assert.NotContains(t, rec.Body.String(), "demotion")
+}
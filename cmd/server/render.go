@@ -0,0 +1,145 @@
+// Описание: Формат ответа эндпоинтов чтения заказов по заголовку Accept: JSON (по умолчанию), XML или MessagePack.
+// Обработчик выбирает формат negotiateFormat до обработки запроса и пишет ответ общим помощником render,
+// поэтому новый эндпоинт поддерживает все форматы, если его тип ответа размечен тегами json и xml
+package main
+
+import (
+	"encoding/xml"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"l0_test_self/internal/jsonpool"
+	"l0_test_self/models/orders"
+)
+
+// responseFormat - формат тела ответа
+type responseFormat struct {
+	mediaType string                                // тип в Content-Type ответа
+	aliases   []string                              // другие типы в Accept, выбирающие этот формат
+	encode    func(b *jsonpool.Buffer, v any) error // дописывает тело ответа в буфер
+}
+
+// Форматы ответа. MessagePack повторяет структуру JSON: ключи берутся из тегов json (orders.NewMsgpackEncoder).
+var (
+	formatJSON = responseFormat{mediaType: "application/json", encode: func(b *jsonpool.Buffer, v any) error {
+		return b.Encode(v)
+	}}
+	formatXML = responseFormat{mediaType: "application/xml", aliases: []string{"text/xml"}, encode: func(b *jsonpool.Buffer, v any) error {
+		b.WriteString(xml.Header)
+		return xml.NewEncoder(b).Encode(v)
+	}}
+	formatMsgpack = responseFormat{mediaType: "application/msgpack", aliases: []string{"application/x-msgpack", "application/vnd.msgpack"}, encode: func(b *jsonpool.Buffer, v any) error {
+		return orders.NewMsgpackEncoder(b).Encode(v)
+	}}
+)
+
+// responseFormats - поддерживаемые форматы в порядке предпочтения сервера
+var responseFormats = []responseFormat{formatJSON, formatXML, formatMsgpack}
+
+// supportedMediaTypes - поддерживаемые типы ответа через запятую для сообщения об ошибке 406
+func supportedMediaTypes() string {
+	types := make([]string, len(responseFormats))
+	for i, f := range responseFormats {
+		types[i] = f.mediaType
+	}
+	return strings.Join(types, ", ")
+}
+
+// negotiateFormat - выбирает формат ответа по заголовку Accept запроса. Если ни один формат не приемлем, отвечает 406
+// со списком поддерживаемых типов и возвращает false.
+func negotiateFormat(w http.ResponseWriter, r *http.Request) (responseFormat, bool) {
+	f, ok := selectFormat(r.Header.Get("Accept"))
+	if !ok {
+		w.Header().Add("Vary", "Accept")
+		writeAPIError(w, r, http.StatusNotAcceptable, errCodeNotAcceptable, supportedMediaTypes())
+	}
+	return f, ok
+}
+
+// selectFormat - выбирает формат по значению заголовка Accept (RFC 9110): формат с наибольшим q, при равном q —
+// названный точнее (тип, затем type/*, затем */*), а при равной точности — первый в responseFormats. Качество формата
+// задаёт самый точный подходящий ему диапазон; q=0 исключает формат. Пустой заголовок выбирает JSON.
+func selectFormat(accept string) (responseFormat, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return formatJSON, true
+	}
+	best, bestQ, bestSpecificity := -1, 0.0, -1
+	for i, f := range responseFormats {
+		q, specificity := acceptQuality(accept, f)
+		if q > bestQ || q > 0 && q == bestQ && specificity > bestSpecificity {
+			best, bestQ, bestSpecificity = i, q, specificity
+		}
+	}
+	if best < 0 {
+		return responseFormat{}, false
+	}
+	return responseFormats[best], true
+}
+
+// acceptQuality - качество формата f по заголовку Accept и точность задавшего его диапазона: 2 — тип формата,
+// 1 — type/*, 0 — */*; -1, если формату не подходит ни один диапазон. Некорректные диапазоны пропускаются.
+func acceptQuality(accept string, f responseFormat) (q float64, specificity int) {
+	q, specificity = 0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		s := rangeSpecificity(mediaRange, f)
+		if s <= specificity {
+			continue
+		}
+		rangeQ := 1.0
+		if raw, ok := params["q"]; ok {
+			if rangeQ, err = strconv.ParseFloat(raw, 64); err != nil || rangeQ < 0 || rangeQ > 1 {
+				continue
+			}
+		}
+		q, specificity = rangeQ, s
+	}
+	return q, specificity
+}
+
+// rangeSpecificity - точность диапазона mediaRange, подходящего формату f, или -1, если он не подходит
+func rangeSpecificity(mediaRange string, f responseFormat) int {
+	if mediaRange == "*/*" {
+		return 0
+	}
+	for _, t := range append([]string{f.mediaType}, f.aliases...) {
+		if mediaRange == t {
+			return 2
+		}
+		if typ, _, _ := strings.Cut(t, "/"); mediaRange == typ+"/*" {
+			return 1
+		}
+	}
+	return -1
+}
+
+// render - кодирует v в формате f и отвечает 200; если закодировать не удалось, отвечает 500. Тело кодируется в буфер
+// из jsonpool, который возвращается в пул после записи ответа.
+func render(w http.ResponseWriter, r *http.Request, f responseFormat, v any, logger *log.Logger) {
+	b := jsonpool.Get()
+	defer jsonpool.Put(b)
+	if err := f.encode(b, v); err != nil {
+		logger.Printf("[%s] encode %s error: %v", requestIDFromContext(r.Context()), f.mediaType, err)
+		writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+		return
+	}
+	writeRendered(w, r, f, b.Bytes(), logger)
+}
+
+// writeRendered - отвечает 200 телом body, уже закодированным в формате f. Ответ зависит от Accept, что указывается
+// в Vary для кэшей.
+func writeRendered(w http.ResponseWriter, r *http.Request, f responseFormat, body []byte, logger *log.Logger) {
+	h := w.Header()
+	h.Set("Content-Type", f.mediaType)
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	h.Add("Vary", "Accept")
+	if _, err := w.Write(body); err != nil {
+		logger.Printf("[%s] write error: %v", requestIDFromContext(r.Context()), err)
+	}
+}
@@ -0,0 +1,285 @@
+// Описание: Тесты формата ответа эндпоинтов чтения заказов: выбор по Accept, кодирование заказа в JSON, XML
+// и MessagePack без потерь, 406 для неподдерживаемых типов, параметр include в каждом формате и ответы
+// одновременных запросов, закодированные в буферы из jsonpool
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// formatTestOrder - заказ, в котором заполнены все выводимые поля, включая дополнительные
+func formatTestOrder() orders.Order {
+	date := time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)
+	return orders.Order{
+		OrderUid:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: orders.Delivery{Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com"},
+		Payments: []orders.Payment{
+			{Transaction: "b563feb7b2b84b6test", Currency: "USD", Provider: "wbpay", Amount: 1817, PaymentDt: 1637907727,
+				Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317},
+			{Transaction: "b563feb7b2b84b6test-2", RequestId: "r-2", Currency: "USD", Provider: "wbpay", Amount: 100,
+				PaymentDt: 1637907800, Bank: "alpha", CustomFee: 10},
+		},
+		Items: []orders.Item{
+			{ChrtId: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, Rid: "ab4219087a764ae0btest", Name: "Mascaras",
+				Sale: 30, Size: "0", TotalPrice: 317, NmId: 2389212, Brand: "Vivienne Sabo", Status: orders.ItemStatusInTransit},
+			{ChrtId: 9934931, TrackNumber: "WBILMTESTTRACK", Price: 100, Rid: "ab4219087a764ae0btest-2", Name: "Brush <&>",
+				Size: "M", TotalPrice: 100, NmId: 2389213, Brand: "Vivienne Sabo", Status: orders.ItemStatus(999)},
+		},
+		Locale:            "en",
+		InternalSignature: "sig-1",
+		CustomerId:        "test",
+		DeliveryService:   "meest",
+		Shardkey:          "9",
+		SmId:              99,
+		DateCreated:       date,
+		OofShard:          "1",
+		Corrections:       []orders.Correction{{Field: "items[0].total_price", Original: 300, Corrected: 317, Applied: true}},
+		Warnings:          []orders.Warning{{Field: "delivery.zip", Value: "2639809", Message: "zip does not match the region format"}},
+		StoredAt:          date.Add(time.Minute),
+		UpdatedAt:         date.Add(time.Hour),
+		Extras: map[string]any{
+			"warehouse_hint": "KZN-2",
+			"campaign":       map[string]any{"id": json.Number("12345678901234567890"), "ratio": json.Number("0.25"), "tags": []any{"promo", true, nil}},
+		},
+	}
+}
+
+// getAccept - выполняет GET target с заголовком Accept (пустой — без заголовка)
+func getAccept(h http.Handler, target, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	return serve(h, req)
+}
+
+// decodeResponse - декодирует тело ответа rec в v по его Content-Type
+func decodeResponse(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	switch contentType := rec.Header().Get("Content-Type"); contentType {
+	case formatJSON.mediaType:
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v))
+	case formatXML.mediaType:
+		require.NoError(t, xml.Unmarshal(rec.Body.Bytes(), v))
+	case formatMsgpack.mediaType:
+		require.NoError(t, orders.NewMsgpackDecoder(bytes.NewReader(rec.Body.Bytes())).Decode(v))
+	default:
+		t.Fatalf("unexpected content type %q", contentType)
+	}
+}
+
+func TestSelectFormat(t *testing.T) {
+	for _, tc := range []struct {
+		accept string
+		want   string // "" — ни один формат не приемлем
+	}{
+		{accept: "", want: "application/json"},
+		{accept: "*/*", want: "application/json"},
+		{accept: "application/*", want: "application/json"},
+		{accept: "application/json", want: "application/json"},
+		{accept: "application/xml", want: "application/xml"},
+		{accept: "text/xml", want: "application/xml"},
+		{accept: "Application/XML; charset=utf-8", want: "application/xml"},
+		{accept: "application/msgpack", want: "application/msgpack"},
+		{accept: "application/x-msgpack", want: "application/msgpack"},
+		{accept: "application/xml;q=0.9, application/json;q=0.5", want: "application/xml"},
+		{accept: "application/xml, */*", want: "application/xml"},
+		{accept: "text/html, */*;q=0.1", want: "application/json"},
+		{accept: "application/json;q=0, */*", want: "application/xml"},
+		// Браузер, открывший адрес напрямую, предпочитает XML
+		{accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", want: "application/xml"},
+		{accept: "text/html"},
+		{accept: "application/msgpack;q=0"},
+		{accept: "*/*;q=0"},
+		{accept: "application/json;q=abc"},
+	} {
+		f, ok := selectFormat(tc.accept)
+		assert.Equal(t, tc.want != "", ok, tc.accept)
+		assert.Equal(t, tc.want, f.mediaType, tc.accept)
+	}
+}
+
+func TestOrderEndpointsRoundTripEachFormat(t *testing.T) {
+	order := formatTestOrder()
+	c := newTestCache(t)
+	c.SetKeepJSON(true)
+	c.Set(tenant.Default, order)
+	repo := &fakeRepository{orders: map[string]orders.Order{order.OrderUid: order}}
+	orderHandler := withDefaultTenant(makeOrderHandler(c, repo, piiPolicy{}, nil, newTestLogger()))
+	search := withDefaultTenant(makeOrderSearchHandler(repo, piiPolicy{}, newTestCursorSigner(t), newTestLogger()))
+	sections := newSectionsMux(c, repo, piiPolicy{})
+
+	etags := make(map[string]bool)
+	for _, f := range responseFormats {
+		t.Run(f.mediaType, func(t *testing.T) {
+			rec := getAccept(orderHandler, "/order?id="+order.OrderUid, f.mediaType)
+			assert.Equal(t, f.mediaType, rec.Header().Get("Content-Type"))
+			assert.Contains(t, rec.Header().Values("Vary"), "Accept")
+			var got orders.Order
+			decodeResponse(t, rec, &got)
+			assert.Equal(t, order, got)
+
+			rec = getAccept(search, "/orders?track_number=WBILMTESTTRACK&include=all", f.mediaType)
+			var page orderSearchPage
+			decodeResponse(t, rec, &page)
+			assert.Equal(t, []orders.Order{order}, page.Orders)
+
+			rec = getAccept(sections, "/orders/"+order.OrderUid+"/items", f.mediaType)
+			var section itemsSectionResponse
+			decodeResponse(t, rec, &section)
+			assert.Equal(t, order.OrderUid, section.OrderUid)
+			assert.Equal(t, order.Items, section.Items)
+			etags[rec.Header().Get("ETag")] = true
+		})
+	}
+	assert.Len(t, etags, len(responseFormats), "each format has its own ETag")
+}
+
+func TestOrderXMLWrapsLists(t *testing.T) {
+	order := formatTestOrder()
+	c := newTestCache(t)
+	c.Set(tenant.Default, order)
+	h := withDefaultTenant(makeOrderHandler(c, &fakeRepository{}, piiPolicy{}, nil, newTestLogger()))
+
+	body := getAccept(h, "/order?id="+order.OrderUid, "application/xml").Body.String()
+	assert.True(t, strings.HasPrefix(body, xml.Header+"<order><order_uid>b563feb7b2b84b6test</order_uid>"), body)
+	assert.Contains(t, body, "<items><item><chrt_id>9934930</chrt_id>")
+	assert.Contains(t, body, "<name>Brush &lt;&amp;&gt;</name>")
+	assert.Contains(t, body, `<status code="999">unknown</status></item></items>`)
+	assert.Contains(t, body, "<payments><payment><transaction>b563feb7b2b84b6test</transaction>")
+}
+
+func TestOrderEndpointsRejectUnsupportedAccept(t *testing.T) {
+	repo := &fakeRepository{orders: map[string]orders.Order{"order-1": piiTestOrder()}}
+	for target, h := range map[string]http.Handler{
+		"/order?id=order-1":            withDefaultTenant(makeOrderHandler(newTestCache(t), repo, piiPolicy{}, nil, newTestLogger())),
+		"/orders?track_number=TRACK-1": withDefaultTenant(makeOrderSearchHandler(repo, piiPolicy{}, newTestCursorSigner(t), newTestLogger())),
+		"/orders/order-1/delivery":     newSectionsMux(newTestCache(t), repo, piiPolicy{}),
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept", "text/html")
+		rec, resp := serve(h, req), apiErrorResponse{}
+		assert.Equal(t, http.StatusNotAcceptable, rec.Code, target)
+		assert.Contains(t, rec.Header().Values("Vary"), "Accept", target)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), target)
+		assert.Equal(t, errCodeNotAcceptable, resp.Code, target)
+		assert.Contains(t, resp.Message, "application/json, application/xml, application/msgpack", target)
+	}
+	assert.Zero(t, repo.reads+repo.sectionReads, "the order is not read for an unacceptable response")
+}
+
+// TestOrderSearchIncludeComposesWithFormats - параметр include ограничивает разделы заказа в любом формате ответа
+func TestOrderSearchIncludeComposesWithFormats(t *testing.T) {
+	order := formatTestOrder()
+	repo := &fakeRepository{orders: map[string]orders.Order{order.OrderUid: order}}
+	h := withDefaultTenant(makeOrderSearchHandler(repo, piiPolicy{}, newTestCursorSigner(t), newTestLogger()))
+	target := "/orders?track_number=WBILMTESTTRACK&include=items"
+
+	for _, f := range responseFormats {
+		var page orderSearchPage
+		decodeResponse(t, getAccept(h, target, f.mediaType), &page)
+		require.Len(t, page.Orders, 1, f.mediaType)
+		assert.Equal(t, order.Items, page.Orders[0].Items, f.mediaType)
+		assert.Empty(t, page.Orders[0].Payments, f.mediaType)
+		assert.Equal(t, orders.Delivery{}, page.Orders[0].Delivery, f.mediaType)
+	}
+
+	xmlBody := getAccept(h, target, "application/xml").Body.String()
+	assert.Contains(t, xmlBody, "<items><item>")
+	assert.NotContains(t, xmlBody, "<delivery>")
+	assert.NotContains(t, xmlBody, "<payments>")
+
+	var pageFields struct {
+		Orders []map[string]any `msgpack:"orders"`
+	}
+	require.NoError(t, msgpack.Unmarshal(getAccept(h, target, "application/msgpack").Body.Bytes(), &pageFields))
+	require.Len(t, pageFields.Orders, 1)
+	assert.Contains(t, pageFields.Orders[0], "items")
+	for _, key := range []string{"delivery", "payments", "payment"} {
+		assert.NotContains(t, pageFields.Orders[0], key)
+	}
+}
+
+// slowRecorder - запись ответа, которая уступает процессор перед копированием тела: тело, буфер которого вернули
+// в пул до записи, успевает перезаписать другой запрос
+type slowRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (r *slowRecorder) Write(b []byte) (int, error) {
+	runtime.Gosched()
+	return r.ResponseRecorder.Write(b)
+}
+
+func TestPooledResponsesDoNotBleed(t *testing.T) {
+	gen := testorders.NewGenerator(64)
+	for name, keepJSON := range map[string]bool{"encoder": false, "serialized": true} {
+		t.Run(name, func(t *testing.T) {
+			c := newTestCache(t)
+			c.SetKeepJSON(keepJSON)
+			var uids []string
+			for i := range 8 {
+				scenario := testorders.ScenarioDefault
+				if i%2 == 1 {
+					scenario = testorders.ScenarioMaximal
+				}
+				order := gen.Order(scenario)
+				c.Set(tenant.Default, order)
+				uids = append(uids, order.OrderUid)
+			}
+			h := withDefaultTenant(makeOrderHandler(c, &fakeRepository{}, piiPolicy{}, nil, newTestLogger()))
+			accepts := []string{"", "application/xml", "application/msgpack"}
+			want := make(map[string]string)
+			for _, uid := range uids {
+				for _, accept := range accepts {
+					rec := getAccept(h, "/order?id="+uid, accept)
+					require.Equal(t, http.StatusOK, rec.Code)
+					want[uid+accept] = rec.Body.String()
+				}
+			}
+
+			var wg sync.WaitGroup
+			for g := range 16 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := range 50 {
+						uid, accept := uids[(g+i)%len(uids)], accepts[(g*i)%len(accepts)]
+						rec := &slowRecorder{httptest.NewRecorder()}
+						req := httptest.NewRequest(http.MethodGet, "/order?id="+uid, nil)
+						if accept != "" {
+							req.Header.Set("Accept", accept)
+						}
+						h.ServeHTTP(rec, req)
+						if rec.Body.String() != want[uid+accept] {
+							t.Errorf("response for %s (%q) differs from the serial response", uid, accept)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
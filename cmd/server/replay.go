@@ -0,0 +1,246 @@
+// Описание: Повтор топика заказов читателями без группы (флаг -replay): каждая партиция читается до смещения,
+// на котором она заканчивалась при запуске, а позиция чтения сохраняется в таблицу checkpoints для продолжения с -resume
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/goroutines"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/kafka"
+	"l0_test_self/pkg/client/postgres"
+
+	kafka2 "github.com/segmentio/kafka-go"
+)
+
+const (
+	// defaultCheckpointEvery и defaultCheckpointInterval - периодичность сохранения позиции чтения,
+	// если kafka.replay не задаёт её
+	defaultCheckpointEvery    = 1000
+	defaultCheckpointInterval = 5 * time.Second
+)
+
+// replayRange - смещения партиции, которые нужно прочитать при повторе: [From, Until)
+type replayRange struct {
+	Partition int
+	From      int64
+	Until     int64
+}
+
+// planReplay - определяет диапазоны повтора партиций топика по их границам offsets. Без resume партиции читаются
+// с начала, с resume — с сохранённой позиции читателя name; позиция, удалённая политикой хранения Kafka, заменяется
+// началом партиции. Партиции, в которых нечего читать, пропускаются.
+func planReplay(ctx context.Context, repo OrderRepository, name, topic string, offsets map[int]kafka.PartitionOffsets, resume bool) ([]replayRange, error) {
+	var checkpoints map[int]int64
+	if resume {
+		var err error
+		if checkpoints, err = repo.LoadCheckpoints(ctx, name, topic); err != nil {
+			return nil, err
+		}
+	}
+
+	ranges := make([]replayRange, 0, len(offsets))
+	for partition, po := range offsets {
+		from := po.First
+		if next, ok := checkpoints[partition]; ok {
+			from = max(next, po.First)
+		}
+		if from < po.Last {
+			ranges = append(ranges, replayRange{Partition: partition, From: from, Until: po.Last})
+		}
+	}
+	slices.SortFunc(ranges, func(a, b replayRange) int { return a.Partition - b.Partition })
+	return ranges, nil
+}
+
+// checkpointReader - читатель партиции без группы, который вместо коммита смещений в Kafka сохраняет позицию чтения
+// в таблицу checkpoints: каждые every сообщений или не реже interval. Когда прочитано смещение until, вызывается done.
+// Используется одной горутиной консьюмера.
+type checkpointReader struct {
+	MessageReader
+	repo     OrderRepository
+	cp       postgres.Checkpoint
+	until    int64
+	every    int
+	interval time.Duration
+	done     func()
+
+	pending int // обработано сообщений после последнего сохранения позиции
+	savedAt time.Time
+}
+
+// CommitMessages - запоминает позицию после сообщений msgs и сохраняет её, если накопилось every сообщений
+// или прошло interval с последнего сохранения
+func (r *checkpointReader) CommitMessages(ctx context.Context, msgs ...kafka2.Message) error {
+	for _, m := range msgs {
+		r.cp.Offset = m.Offset + 1
+		r.pending++
+	}
+	var err error
+	if r.pending >= r.every || time.Since(r.savedAt) >= r.interval {
+		err = r.flush(ctx)
+	}
+	if r.cp.Offset >= r.until {
+		r.done()
+	}
+	return err
+}
+
+// flush - сохраняет позицию чтения, если после последнего сохранения обработаны сообщения
+func (r *checkpointReader) flush(ctx context.Context) error {
+	if r.pending == 0 {
+		return nil
+	}
+	r.cp.UpdatedAt = time.Now()
+	if err := r.repo.SaveCheckpoint(ctx, r.cp); err != nil {
+		return err
+	}
+	r.pending = 0
+	r.savedAt = r.cp.UpdatedAt
+	return nil
+}
+
+// partitionOpener - открывает читатель партиции без группы со смещения offset
+type partitionOpener func(partition int, offset int64) (MessageReader, error)
+
+// runReplay - читает диапазоны ranges топика, обрабатывая сообщения так же, как консьюмер в режиме sync,
+// по одному читателю на партицию. Возвращается, когда все партиции прочитаны или отменён ctx; позиция чтения каждой
+// партиции сохраняется при остановке. Заказы записываются только в базу данных с источником source
+// (orders.SourceReplay или orders.SourceDLQReplay).
+func runReplay(ctx context.Context, name string, ranges []replayRange, open partitionOpener, dlq MessageWriter,
+	repo OrderRepository, logger *log.Logger, cfg *config.Config, source string) error {
+	every, interval := cfg.Kafka.Replay.CheckpointEvery, cfg.Kafka.Replay.CheckpointInterval
+	if every == 0 {
+		every = defaultCheckpointEvery
+	}
+	if interval == 0 {
+		interval = defaultCheckpointInterval
+	}
+
+	readers := make([]*checkpointReader, 0, len(ranges))
+	defer func() {
+		for _, r := range readers {
+			if err := r.Close(); err != nil {
+				logger.Printf("replay %s: close reader of partition %d: %v", name, r.cp.Partition, err)
+			}
+		}
+	}()
+	for _, rng := range ranges {
+		reader, err := open(rng.Partition, rng.From)
+		if err != nil {
+			return err
+		}
+		readers = append(readers, &checkpointReader{
+			MessageReader: reader,
+			repo:          repo,
+			cp:            postgres.Checkpoint{Reader: name, Topic: cfg.Kafka.Topic, Partition: rng.Partition, Offset: rng.From},
+			until:         rng.Until,
+			every:         every,
+			interval:      interval,
+			savedAt:       time.Now(),
+		})
+		logger.Printf("replay %s: partition %d offsets [%d, %d)", name, rng.Partition, rng.From, rng.Until)
+	}
+
+	monitor := newConsumerMonitor(cfg)
+	// Повтор не вытесняет из кэша горячие заказы: без явного pipeline.cache_on_ingest заказы в кэш не помещаются
+	if cfg.Pipeline.CacheOnIngest == "" {
+		pipeline := cfg.Pipeline
+		pipeline.CacheOnIngest = config.CacheOnIngestNever
+		monitor.ingest = newIngestCache(pipeline)
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		saveErr error
+	)
+	for _, r := range readers {
+		partCtx, cancel := context.WithCancel(ctx)
+		r.done = cancel
+		c := newConsumer(r, dlq, repo, discardCache{}, logger, cfg, monitor)
+		c.source = source
+		wg.Add(1)
+		goroutines.Go(fmt.Sprintf("replay %s partition %d", name, r.cp.Partition), partCtx.Done(), func() {
+			defer wg.Done()
+			defer cancel()
+			c.run(partCtx)
+
+			// Последняя позиция сохраняется и при остановке по сигналу
+			flushCtx, flushCancel := opContext(ctx)
+			defer flushCancel()
+			if err := r.flush(flushCtx); err != nil {
+				mu.Lock()
+				saveErr = errors.Join(saveErr, err)
+				mu.Unlock()
+				return
+			}
+			logger.Printf("replay %s: partition %d stopped at offset %d of %d", name, r.cp.Partition, r.cp.Offset, r.until)
+		})
+	}
+	wg.Wait()
+
+	if saveErr != nil {
+		return fmt.Errorf("replay %s: final checkpoint not saved: %w", name, saveErr)
+	}
+	if ctx.Err() != nil {
+		logger.Printf("replay %s interrupted, continue with -replay %s -resume", name, name)
+		return nil
+	}
+	logger.Printf("replay %s finished", name)
+	return nil
+}
+
+// replayTopic - повторяет топик kafka.topic читателем name (флаг -replay): с начала партиций или, с resume,
+// с сохранённой позиции. С fromDLQ (флаг -replay-dlq) повторяется очередь недоставленных сообщений kafka.dlq_topic,
+// и заказы сохраняются с источником orders.SourceDLQReplay.
+func replayTopic(ctx context.Context, cfg *config.Config, repo OrderRepository, name string, resume, fromDLQ bool, logger *log.Logger) error {
+	source := orders.SourceReplay
+	if fromDLQ {
+		if cfg.Kafka.DLQTopic == "" {
+			return errors.New("-replay-dlq requires kafka.dlq_topic")
+		}
+		// Позиция чтения сохраняется для топика очереди, поэтому повтор очереди не сдвигает повтор kafka.topic
+		dlqCfg := *cfg
+		dlqCfg.Kafka.Topic = cfg.Kafka.DLQTopic
+		cfg, source = &dlqCfg, orders.SourceDLQReplay
+	}
+	kafkaCfg := cfg.Kafka.ToKafkaConfig()
+	offsets, err := kafka.ListPartitionOffsets(ctx, kafkaCfg)
+	if err != nil {
+		return err
+	}
+	ranges, err := planReplay(ctx, repo, name, kafkaCfg.Topic, offsets, resume)
+	if err != nil {
+		return err
+	}
+	if len(ranges) == 0 {
+		logger.Printf("replay %s: nothing to replay in topic %s", name, kafkaCfg.Topic)
+		return nil
+	}
+
+	// Сообщения, которые не удаётся записать, отправляются в очередь недоставленных так же, как консьюмером
+	var dlq MessageWriter
+	if cfg.Kafka.Consumer.MaxAttempts > 0 {
+		dlqCfg := kafkaCfg
+		dlqCfg.Topic = cfg.Kafka.DLQTopic
+		w := kafka.NewWriter(dlqCfg)
+		defer w.Close()
+		dlq = w
+	}
+
+	open := func(partition int, offset int64) (MessageReader, error) {
+		reader, err := kafka.NewPartitionReader(kafkaCfg, partition, offset)
+		if err != nil {
+			return nil, err
+		}
+		return reader, nil
+	}
+	return runReplay(ctx, name, ranges, open, dlq, repo, logger, cfg, source)
+}
@@ -0,0 +1,124 @@
+// Описание: Тесты повтора топика без группы: план по сохранённым позициям, периодическое сохранение позиции
+// и продолжение прерванного повтора с -resume без повторной обработки и пропусков
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/kafka"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newReplayTestConfig - конфигурация повтора, сохраняющего позицию каждые every сообщений
+func newReplayTestConfig(every int) *config.Config {
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.Topic = "orders"
+	cfg.Kafka.Replay = config.ReplayConfig{CheckpointEvery: every, CheckpointInterval: time.Hour}
+	return cfg
+}
+
+// stoppingReader - sliceReader, который, как читатель Kafka, перестаёт выдавать сообщения после отмены контекста
+type stoppingReader struct {
+	*sliceReader
+}
+
+func (r stoppingReader) FetchMessage(ctx context.Context) (kafka2.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return kafka2.Message{}, err
+	}
+	return r.sliceReader.FetchMessage(ctx)
+}
+
+// sliceOpener - открывает читатели партиции 0 поверх msgs с нужного смещения
+func sliceOpener(msgs []kafka2.Message) partitionOpener {
+	return func(partition int, offset int64) (MessageReader, error) {
+		if partition != 0 {
+			return nil, errors.New("unexpected partition")
+		}
+		return stoppingReader{&sliceReader{msgs: msgs[offset:]}}, nil
+	}
+}
+
+func TestPlanReplay(t *testing.T) {
+	repo := &fakeRepository{checkpoints: map[string]map[int]int64{"nightly/orders": {0: 40, 1: 5, 2: 70}}}
+	offsets := map[int]kafka.PartitionOffsets{
+		0: {First: 0, Last: 100},
+		1: {First: 10, Last: 20}, // позиция удалена политикой хранения
+		2: {First: 0, Last: 70},  // партиция уже прочитана
+		3: {First: 0, Last: 0},
+	}
+
+	ranges, err := planReplay(context.Background(), repo, "nightly", "orders", offsets, true)
+	require.NoError(t, err)
+	assert.Equal(t, []replayRange{{Partition: 0, From: 40, Until: 100}, {Partition: 1, From: 10, Until: 20}}, ranges)
+
+	ranges, err = planReplay(context.Background(), repo, "nightly", "orders", offsets, false)
+	require.NoError(t, err)
+	assert.Equal(t, []replayRange{{Partition: 0, From: 0, Until: 100}, {Partition: 1, From: 10, Until: 20}, {Partition: 2, From: 0, Until: 70}}, ranges)
+}
+
+func TestReplaySavesCheckpointsPeriodically(t *testing.T) {
+	msgs, _ := newOrderMessages(t, 31, 10)
+	repo := &fakeRepository{}
+	err := runReplay(context.Background(), "nightly", []replayRange{{Partition: 0, From: 0, Until: 10}},
+		sliceOpener(msgs), nil, repo, newTestLogger(), newReplayTestConfig(3), orders.SourceReplay)
+	require.NoError(t, err)
+
+	inserts, stored := repo.stats()
+	assert.Equal(t, 10, inserts)
+	assert.Equal(t, 10, stored)
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	assert.Equal(t, 4, repo.checkpointSaves, "after offsets 2, 5, 8 and the final one")
+	assert.Equal(t, map[int]int64{0: 10}, repo.checkpoints["nightly/orders"])
+}
+
+func TestReplayResumesFromCheckpoint(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 32, 10)
+	offsets := map[int]kafka.PartitionOffsets{0: {First: 0, Last: 10}}
+	cfg := newReplayTestConfig(3)
+	repo := &fakeRepository{}
+
+	// Первый запуск прерывается на пятом заказе
+	ctx, cancel := context.WithCancel(context.Background())
+	inserted := 0
+	repo.onInsert = func() {
+		if inserted++; inserted == 5 {
+			cancel()
+		}
+	}
+	ranges, err := planReplay(ctx, repo, "nightly", "orders", offsets, true)
+	require.NoError(t, err)
+	require.NoError(t, runReplay(ctx, "nightly", ranges, sliceOpener(msgs), nil, repo, newTestLogger(), cfg, orders.SourceReplay))
+	cancel()
+	repo.onInsert = nil
+
+	// Сообщения обрабатываются по порядку, поэтому позиция равна числу записанных заказов
+	_, firstRun := repo.stats()
+	require.Less(t, firstRun, len(msgs), "the run stopped midway")
+	checkpoint := repo.checkpoints["nightly/orders"][0]
+	assert.Equal(t, int64(firstRun), checkpoint, "the final checkpoint is saved on shutdown")
+
+	// Повторный запуск с -resume начинает с сохранённой позиции и дочитывает партицию
+	ranges, err = planReplay(context.Background(), repo, "nightly", "orders", offsets, true)
+	require.NoError(t, err)
+	require.Equal(t, []replayRange{{Partition: 0, From: checkpoint, Until: 10}}, ranges)
+	require.NoError(t, runReplay(context.Background(), "nightly", ranges, sliceOpener(msgs), nil, repo, newTestLogger(), cfg, orders.SourceReplay))
+
+	inserts, stored := repo.stats()
+	assert.Equal(t, 10, inserts, "no message is processed twice")
+	assert.Equal(t, 10, stored)
+	for _, uid := range uids {
+		_, ok := repo.orders[uid]
+		assert.True(t, ok, "order %s is not skipped", uid)
+	}
+	assert.Equal(t, int64(10), repo.checkpoints["nightly/orders"][0])
+}
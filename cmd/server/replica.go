@@ -0,0 +1,126 @@
+// Описание: Чтения с реплики PostgreSQL (database.replica): методы репозитория, только читающие данные, выполняются
+// на реплике, пока она проходит проверку, и на основной базе, если реплика не настроена, недоступна или вызывающему
+// нужны свежие данные (withPrimaryRead). Запись всегда выполняется на основной базе
+package main
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"l0_test_self/internal/metrics"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// replicaPingTimeout - предельное время одной проверки реплики
+const replicaPingTimeout = 2 * time.Second
+
+// primaryReadKey - ключ контекста, требующего чтения с основной базы данных
+type primaryReadKey struct{}
+
+// withPrimaryRead - контекст, чтения репозитория в котором выполняются на основной базе данных, а не на реплике.
+// Так читаются заказы, которые затем записываются в кэш или сравниваются с ним (промах кэша GET /order, обновление
+// и закрепление заказа, проверка кэша): отставшая реплика ещё не видит только что записанный заказ или его изменения.
+func withPrimaryRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryReadKey{}, true)
+}
+
+// primaryReadRequested - сообщает, требует ли ctx чтения с основной базы данных
+func primaryReadRequested(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryReadKey{}).(bool)
+	return v
+}
+
+// replicaPool - пул соединений с репликой и состояние её проверки. Реплика проверяется каждые interval; чтения
+// выполняются на ней, только пока последняя проверка прошла. nil — реплики нет: методы nil получателя ничего не делают
+type replicaPool struct {
+	pool     *pgxpool.Pool
+	ping     func(ctx context.Context) error
+	interval time.Duration
+	logger   *log.Logger
+
+	healthy atomic.Bool // до первой проверки реплика считается недоступной
+
+	reads     *metrics.Counter // чтения, выполненные на реплике
+	fallbacks *metrics.Counter // чтения, повторённые на основной базе из-за недоступности реплики
+}
+
+// newReplicaPool - реплика с пулом pool, проверяемая каждые interval
+func newReplicaPool(pool *pgxpool.Pool, interval time.Duration, logger *log.Logger) *replicaPool {
+	return &replicaPool{
+		pool:      pool,
+		ping:      pool.Ping,
+		interval:  interval,
+		logger:    logger,
+		reads:     &metrics.Counter{},
+		fallbacks: &metrics.Counter{},
+	}
+}
+
+// register - регистрирует метрики реплики в реестре метрик
+func (p *replicaPool) register(reg *metrics.Registry) {
+	if p == nil {
+		return
+	}
+	reg.RegisterCounter("db_replica_reads_total", "Repository reads served by the database replica.", p.reads)
+	reg.RegisterCounter("db_replica_fallbacks_total", "Replica reads retried on the primary because the replica was unavailable.", p.fallbacks)
+	reg.GaugeFunc("db_replica_healthy", "1 while the database replica passes health checks and serves reads, 0 otherwise.", func() float64 {
+		if p.isHealthy() {
+			return 1
+		}
+		return 0
+	})
+}
+
+// isHealthy - сообщает, прошла ли реплика последнюю проверку
+func (p *replicaPool) isHealthy() bool {
+	return p != nil && p.healthy.Load()
+}
+
+// isDegraded - сообщает, что реплика настроена, но чтения с неё перенаправляются на основную базу
+func (p *replicaPool) isDegraded() bool {
+	return p != nil && !p.healthy.Load()
+}
+
+// check - проверяет реплику и меняет её состояние, записывая переходы в лог
+func (p *replicaPool) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, replicaPingTimeout)
+	defer cancel()
+	if err := p.ping(ctx); err != nil {
+		if p.healthy.Swap(false) {
+			p.logger.Printf("db replica check failed, reads go to the primary: %v", err)
+		}
+		return
+	}
+	if !p.healthy.Swap(true) {
+		p.logger.Println("db replica is available, serving reads")
+	}
+}
+
+// fail - отмечает реплику недоступной после потери соединения во время чтения err; до следующей успешной
+// проверки чтения выполняются на основной базе
+func (p *replicaPool) fail(err error) {
+	p.fallbacks.Inc()
+	if p.healthy.Swap(false) {
+		p.logger.Printf("db replica read failed, reads go to the primary until the next check: %v", err)
+	}
+}
+
+// run - проверяет реплику сразу и затем каждые interval, пока ctx не отменён
+func (p *replicaPool) run(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
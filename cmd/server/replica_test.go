@@ -0,0 +1,130 @@
+// Описание: Тесты чтений с реплики: выбор пула для чтения, повтор на основной базе при недоступной реплике,
+// чтение с основной базы по withPrimaryRead, проверка реплики и флаг replica_degraded в GET /readyz
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPool - пул без соединений с сервером host: он только различает пулы в проверках выбора пула
+func newTestPool(t *testing.T, host string) *pgxpool.Pool {
+	t.Helper()
+	pool, err := postgres.NewReplicaClient(postgres.DBConfig{Host: host, Port: "5432", User: "u", DBName: "db", SSLMode: "disable"})
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// newTestReplicaRepository - репозиторий с основной базой и репликой, прошедшей проверку
+func newTestReplicaRepository(t *testing.T) *pgOrderRepository {
+	t.Helper()
+	replica := newReplicaPool(newTestPool(t, "replica"), time.Minute, newTestLogger())
+	replica.ping = func(context.Context) error { return nil }
+	replica.check(context.Background())
+	return &pgOrderRepository{pool: newTestPool(t, "primary"), replica: replica}
+}
+
+func TestReadPoolRouting(t *testing.T) {
+	repo := newTestReplicaRepository(t)
+	ctx := context.Background()
+	assert.Same(t, repo.replica.pool, repo.readPool(ctx))
+	assert.Same(t, repo.pool, repo.readPool(withPrimaryRead(ctx)), "a fresh read goes to the primary")
+
+	repo.replica.ping = func(context.Context) error { return syscall.ECONNREFUSED }
+	repo.replica.check(ctx)
+	assert.Same(t, repo.pool, repo.readPool(ctx), "an unhealthy replica is skipped")
+
+	unconfigured := &pgOrderRepository{pool: repo.pool}
+	assert.Same(t, repo.pool, unconfigured.readPool(ctx))
+}
+
+func TestQueryReadFallsBackToPrimary(t *testing.T) {
+	repo := newTestReplicaRepository(t)
+	var used []*pgxpool.Pool
+	read := func(replicaErr error) (string, error) {
+		return queryRead(context.Background(), repo, func(_ context.Context, pool *pgxpool.Pool) (string, error) {
+			used = append(used, pool)
+			if pool == repo.replica.pool {
+				return "", replicaErr
+			}
+			return "primary", nil
+		})
+	}
+
+	// Ответ реплики, а не её отказ, на основной базе не повторяется
+	_, err := read(postgres.ErrOrderNotFound)
+	assert.ErrorIs(t, err, postgres.ErrOrderNotFound)
+	assert.Equal(t, []*pgxpool.Pool{repo.replica.pool}, used)
+	assert.Equal(t, uint64(1), repo.replica.reads.Value())
+
+	used = nil
+	v, err := read(syscall.ECONNREFUSED)
+	require.NoError(t, err)
+	assert.Equal(t, "primary", v)
+	assert.Equal(t, []*pgxpool.Pool{repo.replica.pool, repo.pool}, used)
+	assert.Equal(t, uint64(1), repo.replica.fallbacks.Value())
+	assert.False(t, repo.replica.isHealthy(), "the failed replica is skipped until the next check")
+
+	used = nil
+	_, err = read(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []*pgxpool.Pool{repo.pool}, used)
+}
+
+// primaryReadRepository - репозиторий, запоминающий, требовал ли контекст чтения заказа основной базы
+type primaryReadRepository struct {
+	OrderRepository
+	primary []bool
+}
+
+func (r *primaryReadRepository) GetOrderByUID(ctx context.Context, tenantID, uid string) (orders.Order, error) {
+	r.primary = append(r.primary, primaryReadRequested(ctx))
+	return r.OrderRepository.GetOrderByUID(ctx, tenantID, uid)
+}
+
+func TestOrderLoaderReadsFromPrimary(t *testing.T) {
+	order := piiTestOrder()
+	repo := &primaryReadRepository{OrderRepository: &fakeRepository{orders: map[string]orders.Order{order.OrderUid: order}}}
+	h := withDefaultTenant(makeOrderHandler(newTestCache(t), repo, piiPolicy{}, nil, newTestLogger()))
+
+	rec := getAccept(h, "/order?id="+order.OrderUid, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, []bool{true}, repo.primary, "a cache miss is filled from the primary")
+}
+
+func TestReadinessReportsReplicaDegraded(t *testing.T) {
+	replica := newReplicaPool(newTestPool(t, "replica"), time.Minute, newTestLogger())
+	pingErr := errors.New("connection refused")
+	replica.ping = func(context.Context) error { return pingErr }
+	h := makeReadinessHandler(nil, replica, nil, newTestLogger())
+	readiness := func() readinessResponse {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		require.Equal(t, http.StatusOK, rec.Code, "reads fall back to the primary")
+		var resp readinessResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp
+	}
+
+	assert.Equal(t, readinessResponse{Status: "degraded", ReplicaDegraded: true}, readiness(), "unchecked replica serves no reads")
+	pingErr = nil
+	replica.check(context.Background())
+	assert.Equal(t, readinessResponse{Status: "ok"}, readiness())
+	pingErr = errors.New("connection refused")
+	replica.check(context.Background())
+	assert.Equal(t, readinessResponse{Status: "degraded", ReplicaDegraded: true}, readiness())
+}
@@ -0,0 +1,563 @@
+// Описание: Доступ сервера к заказам в базе данных через интерфейс, подменяемый в тестах
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"l0_test_self/internal/breaker"
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// OrderRepository - интерфейс для чтения и записи заказов в базе данных. Заказы читаются и записываются только
+// в пределах арендатора tenantID (записи пачки — арендатора OrderRecord.Tenant), поэтому чужие заказы недоступны.
+type OrderRepository interface {
+	// InsertOrder и InsertOrders вызывают onCommit только после фиксации транзакции записи: кэш, подтверждения
+	// и уведомления о заказе публикуются в них, чтобы наружу не попал заказ из откаченной транзакции
+	InsertOrder(ctx context.Context, tenantID string, order *orders.Order, raw *postgres.RawPayload, onCommit ...func()) error
+	InsertOrders(ctx context.Context, list []postgres.OrderRecord, onCommit ...func()) (int, error)
+	GetOrderByUID(ctx context.Context, tenantID, uid string) (orders.Order, error)
+	ExistsOrder(ctx context.Context, tenantID, uid string) (bool, error)
+	GetDelivery(ctx context.Context, tenantID, uid string) (*orders.Delivery, error)
+	GetPayments(ctx context.Context, tenantID, uid string) ([]orders.Payment, error)
+	GetItems(ctx context.Context, tenantID, uid string) ([]orders.Item, error)
+	UpdateDelivery(ctx context.Context, tenantID, uid string, expected time.Time, d orders.Delivery, changedBy string) (time.Time, error)
+	ListDeliveryHistory(ctx context.Context, tenantID, uid string) ([]postgres.DeliveryChange, error)
+	DeleteDeliveryHistoryBefore(ctx context.Context, before time.Time) (int64, error)
+	ListOrdersAfter(ctx context.Context, tenantID string, after *postgres.OrderCursor, from, to time.Time, limit int, include postgres.Include, source string) ([]orders.Order, error)
+	FindOrdersByTrackNumber(ctx context.Context, tenantID, trackNumber, sortBy string, after *postgres.SortCursor, limit int, include postgres.Include, source string) ([]orders.Order, error)
+	FindOrdersByCustomer(ctx context.Context, tenantID, customerID, sortBy string, after *postgres.SortCursor, limit int, include postgres.Include) ([]orders.Order, error)
+	CountOrdersBy(ctx context.Context, tenantID, groupBy string, from, to time.Time) ([]postgres.GroupCount, error)
+	ListIncompleteOrders(ctx context.Context, tenantID, after string, limit int) ([]postgres.IncompleteOrder, error)
+	RecentOrders(ctx context.Context, tenantID string, limit int) ([]postgres.OrderSummary, error)
+	OrderUIDsWithPrefix(ctx context.Context, tenantID, prefix string, limit int) ([]string, error)
+	GetRawPayload(ctx context.Context, tenantID, uid string) (postgres.RawPayload, error)
+	DeleteRawPayloadsBefore(ctx context.Context, before time.Time) (int64, error)
+	DeleteArchivedOrders(ctx context.Context, tenantID string, uids []string, before time.Time) (int64, error)
+	ReserveIdempotencyKey(ctx context.Context, tenantID, key, requestHash string, expiredBefore time.Time) (postgres.IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, rec postgres.IdempotencyRecord) error
+	ReleaseIdempotencyKey(ctx context.Context, tenantID, key string) error
+	DeleteIdempotencyKeysBefore(ctx context.Context, before time.Time) (int64, error)
+	RecordLatencies(ctx context.Context, tenantID string, list []postgres.LatencyRecord) error
+	RecordWebhookFailure(ctx context.Context, f postgres.WebhookFailure) error
+	AddIngestStats(ctx context.Context, list []postgres.IngestStats) error
+	ListIngestStats(ctx context.Context, tenantID string, filter postgres.IngestStatsFilter, limit int) ([]postgres.IngestStats, error)
+	RecordMessageAttempt(ctx context.Context, key postgres.MessageKey, orderUID, lastErr string) (int, error)
+	ClearMessageAttempts(ctx context.Context, keys []postgres.MessageKey) error
+	SaveCheckpoint(ctx context.Context, cp postgres.Checkpoint) error
+	LoadCheckpoints(ctx context.Context, reader, topic string) (map[int]int64, error)
+	AddMessageSkip(ctx context.Context, skip postgres.MessageSkip) error
+	ListMessageSkips(ctx context.Context) ([]postgres.MessageSkip, error)
+	DeleteMessageSkip(ctx context.Context, key postgres.MessageKey) error
+}
+
+// pgOrderRepository - реализация OrderRepository поверх пула PostgreSQL. Каждый вызов ограничен по времени timeout
+// (database.query_timeout), если дедлайн вызывающего не раньше, а ошибки истечения времени и потери соединения
+// приводятся к postgres.ErrQueryTimeout и postgres.ErrUnavailable. Методы, только читающие данные, выполняются
+// на реплике replica, если она есть (см. readPool).
+type pgOrderRepository struct {
+	pool    *pgxpool.Pool
+	replica *replicaPool  // реплика для чтений; nil — все запросы выполняются на pool
+	timeout time.Duration // 0 — без ограничения, кроме дедлайна вызывающего
+}
+
+// withTimeout - контекст вызова, ограниченный r.timeout. context.WithTimeout сохраняет более ранний дедлайн ctx.
+func (r *pgOrderRepository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.timeout)
+}
+
+// exec - выполняет вызов fn с ограничением времени и классифицирует его ошибку
+func (r *pgOrderRepository) exec(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return postgres.ClassifyError(ctx, fn(ctx))
+}
+
+// query - выполняет вызов fn, возвращающий значение, с ограничением времени r.timeout и классифицирует его ошибку
+func query[T any](ctx context.Context, r *pgOrderRepository, fn func(ctx context.Context) (T, error)) (T, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	v, err := fn(ctx)
+	return v, postgres.ClassifyError(ctx, err)
+}
+
+// readPool - пул для чтения: реплика, если она настроена, прошла последнюю проверку и ctx не требует основной базы
+// (withPrimaryRead), иначе основная база
+func (r *pgOrderRepository) readPool(ctx context.Context) *pgxpool.Pool {
+	if !r.replica.isHealthy() || primaryReadRequested(ctx) {
+		return r.pool
+	}
+	return r.replica.pool
+}
+
+// queryRead - выполняет чтение fn на пуле readPool, как query. Если реплика недоступна (postgres.ErrUnavailable),
+// она отмечается непрошедшей проверку, а чтение повторяется на основной базе
+func queryRead[T any](ctx context.Context, r *pgOrderRepository, fn func(ctx context.Context, pool *pgxpool.Pool) (T, error)) (T, error) {
+	pool := r.readPool(ctx)
+	v, err := query(ctx, r, func(ctx context.Context) (T, error) { return fn(ctx, pool) })
+	if pool == r.pool {
+		return v, err
+	}
+	if !errors.Is(err, postgres.ErrUnavailable) {
+		r.replica.reads.Inc()
+		return v, err
+	}
+	r.replica.fail(err)
+	return query(ctx, r, func(ctx context.Context) (T, error) { return fn(ctx, r.pool) })
+}
+
+// GetOrderByUID - возвращает заказ арендатора по идентификатору или postgres.ErrOrderNotFound
+func (r *pgOrderRepository) GetOrderByUID(ctx context.Context, tenantID, uid string) (orders.Order, error) {
+	return queryRead(ctx, r, func(ctx context.Context, pool *pgxpool.Pool) (orders.Order, error) {
+		return postgres.GetOrderByUID(ctx, pool, tenantID, uid)
+	})
+}
+
+// ExistsOrder - сообщает, есть ли у арендатора заказ с идентификатором uid, не загружая его
+func (r *pgOrderRepository) ExistsOrder(ctx context.Context, tenantID, uid string) (bool, error) {
+	return queryRead(ctx, r, func(ctx context.Context, pool *pgxpool.Pool) (bool, error) {
+		return postgres.ExistsOrder(ctx, pool, tenantID, uid)
+	})
+}
+
+// GetDelivery - возвращает доставку заказа арендатора (nil, если её нет) или postgres.ErrOrderNotFound
+func (r *pgOrderRepository) GetDelivery(ctx context.Context, tenantID, uid string) (*orders.Delivery, error) {
+	return queryRead(ctx, r, func(ctx context.Context, pool *pgxpool.Pool) (*orders.Delivery, error) {
+		return postgres.GetDelivery(ctx, pool, tenantID, uid)
+	})
+}
+
+// GetPayments - возвращает платежи заказа арендатора или postgres.ErrOrderNotFound
+func (r *pgOrderRepository) GetPayments(ctx context.Context, tenantID, uid string) ([]orders.Payment, error) {
+	return queryRead(ctx, r, func(ctx context.Context, pool *pgxpool.Pool) ([]orders.Payment, error) {
+		return postgres.GetPayments(ctx, pool, tenantID, uid)
+	})
+}
+
+// GetItems - возвращает товары заказа арендатора или postgres.ErrOrderNotFound
+func (r *pgOrderRepository) GetItems(ctx context.Context, tenantID, uid string) ([]orders.Item, error) {
+	return queryRead(ctx, r, func(ctx context.Context, pool *pgxpool.Pool) ([]orders.Item, error) {
+		return postgres.GetItems(ctx, pool, tenantID, uid)
+	})
+}
+
+// UpdateDelivery - заменяет доставку заказа, если его updated_at равен expected, записывает прежнюю доставку в историю
+// с автором changedBy и возвращает новый updated_at
+func (r *pgOrderRepository) UpdateDelivery(ctx context.Context, tenantID, uid string, expected time.Time, d orders.Delivery, changedBy string) (time.Time, error) {
+	return query(ctx, r, func(ctx context.Context) (time.Time, error) {
+		return postgres.UpdateDelivery(ctx, r.pool, tenantID, uid, expected, d, changedBy)
+	})
+}
+
+// ListDeliveryHistory - возвращает историю доставки заказа арендатора или postgres.ErrOrderNotFound
+func (r *pgOrderRepository) ListDeliveryHistory(ctx context.Context, tenantID, uid string) ([]postgres.DeliveryChange, error) {
+	return queryRead(ctx, r, func(ctx context.Context, pool *pgxpool.Pool) ([]postgres.DeliveryChange, error) {
+		return postgres.ListDeliveryHistory(ctx, pool, tenantID, uid)
+	})
+}
+
+// DeleteDeliveryHistoryBefore - удаляет записи истории доставки, сделанные раньше before
+func (r *pgOrderRepository) DeleteDeliveryHistoryBefore(ctx context.Context, before time.Time) (int64, error) {
+	return query(ctx, r, func(ctx context.Context) (int64, error) {
+		return postgres.DeleteDeliveryHistoryBefore(ctx, r.pool, before)
+	})
+}
+
+// ListOrdersAfter - возвращает страницу заказов арендатора из интервала [from, to) после курсора after с разделами include;
+// непустой source оставляет заказы с этим источником
+func (r *pgOrderRepository) ListOrdersAfter(ctx context.Context, tenantID string, after *postgres.OrderCursor, from, to time.Time, limit int, include postgres.Include, source string) ([]orders.Order, error) {
+	return queryRead(ctx, r, func(ctx context.Context, pool *pgxpool.Pool) ([]orders.Order, error) {
+		return postgres.ListOrdersAfter(ctx, pool, tenantID, after, from, to, limit, include, source)
+	})
+}
+
+// FindOrdersByTrackNumber - возвращает до limit заказов арендатора с указанным трек-номером в порядке sortBy
+// после курсора after с разделами include
+func (r *pgOrderRepository) FindOrdersByTrackNumber(ctx context.Context, tenantID, trackNumber, sortBy string, after *postgres.SortCursor, limit int, include postgres.Include, source string) ([]orders.Order, error) {
+	return queryRead(ctx, r, func(ctx context.Context, pool *pgxpool.Pool) ([]orders.Order, error) {
+		return postgres.FindOrdersByTrackNumber(ctx, pool, tenantID, trackNumber, sortBy, after, limit, include, source)
+	})
+}
+
+// FindOrdersByCustomer - возвращает до limit заказов покупателя арендатора в порядке sortBy после курсора after
+// с разделами include
+func (r *pgOrderRepository) FindOrdersByCustomer(ctx context.Context, tenantID, customerID, sortBy string, after *postgres.SortCursor, limit int, include postgres.Include) ([]orders.Order, error) {
+	return queryRead(ctx, r, func(ctx context.Context, pool *pgxpool.Pool) ([]orders.Order, error) {
+		return postgres.FindOrdersByCustomer(ctx, pool, tenantID, customerID, sortBy, after, limit, include)
+	})
+}
+
+// InsertOrder - сохраняет новый заказ арендатора со всеми связанными данными и, если raw не nil, исходное сообщение;
+// после фиксации транзакции вызывает onCommit
+func (r *pgOrderRepository) InsertOrder(ctx context.Context, tenantID string, order *orders.Order, raw *postgres.RawPayload, onCommit ...func()) error {
+	return r.exec(ctx, func(ctx context.Context) error {
+		return postgres.InsertOrder(ctx, r.pool, tenantID, order, raw, onCommit...)
+	})
+}
+
+// CountOrdersBy - возвращает количество заказов арендатора за интервал, сгруппированных по ключу из белого списка
+func (r *pgOrderRepository) CountOrdersBy(ctx context.Context, tenantID, groupBy string, from, to time.Time) ([]postgres.GroupCount, error) {
+	return queryRead(ctx, r, func(ctx context.Context, pool *pgxpool.Pool) ([]postgres.GroupCount, error) {
+		return postgres.CountOrdersBy(ctx, pool, tenantID, groupBy, from, to)
+	})
+}
+
+// ListIncompleteOrders - возвращает до limit заказов арендатора без товаров, доставки или платежа после after
+func (r *pgOrderRepository) ListIncompleteOrders(ctx context.Context, tenantID, after string, limit int) ([]postgres.IncompleteOrder, error) {
+	return queryRead(ctx, r, func(ctx context.Context, pool *pgxpool.Pool) ([]postgres.IncompleteOrder, error) {
+		return postgres.ListIncompleteOrders(ctx, pool, tenantID, after, limit)
+	})
+}
+
+// RecentOrders - возвращает краткие сведения о limit последних сохранённых заказах арендатора
+func (r *pgOrderRepository) RecentOrders(ctx context.Context, tenantID string, limit int) ([]postgres.OrderSummary, error) {
+	return queryRead(ctx, r, func(ctx context.Context, pool *pgxpool.Pool) ([]postgres.OrderSummary, error) {
+		return postgres.RecentOrders(ctx, pool, tenantID, limit)
+	})
+}
+
+// OrderUIDsWithPrefix - возвращает до limit идентификаторов заказов арендатора, начинающихся с prefix
+func (r *pgOrderRepository) OrderUIDsWithPrefix(ctx context.Context, tenantID, prefix string, limit int) ([]string, error) {
+	return queryRead(ctx, r, func(ctx context.Context, pool *pgxpool.Pool) ([]string, error) {
+		return postgres.OrderUIDsWithPrefix(ctx, pool, tenantID, prefix, limit)
+	})
+}
+
+// InsertOrders - сохраняет пачку заказов в одной транзакции, пропуская уже существующие; после фиксации вызывает onCommit
+func (r *pgOrderRepository) InsertOrders(ctx context.Context, list []postgres.OrderRecord, onCommit ...func()) (int, error) {
+	return query(ctx, r, func(ctx context.Context) (int, error) {
+		return postgres.InsertOrders(ctx, r.pool, list, onCommit...)
+	})
+}
+
+// GetRawPayload - возвращает исходное сообщение заказа арендатора или postgres.ErrRawPayloadNotFound
+func (r *pgOrderRepository) GetRawPayload(ctx context.Context, tenantID, uid string) (postgres.RawPayload, error) {
+	return queryRead(ctx, r, func(ctx context.Context, pool *pgxpool.Pool) (postgres.RawPayload, error) {
+		return postgres.GetRawPayload(ctx, pool, tenantID, uid)
+	})
+}
+
+// DeleteRawPayloadsBefore - удаляет исходные сообщения, полученные раньше before
+func (r *pgOrderRepository) DeleteRawPayloadsBefore(ctx context.Context, before time.Time) (int64, error) {
+	return query(ctx, r, func(ctx context.Context) (int64, error) {
+		return postgres.DeleteRawPayloadsBefore(ctx, r.pool, before)
+	})
+}
+
+// DeleteArchivedOrders - удаляет выгруженные в архив заказы арендатора с датой создания раньше before вместе с их разделами
+func (r *pgOrderRepository) DeleteArchivedOrders(ctx context.Context, tenantID string, uids []string, before time.Time) (int64, error) {
+	return query(ctx, r, func(ctx context.Context) (int64, error) {
+		return postgres.DeleteArchivedOrders(ctx, r.pool, tenantID, uids, before)
+	})
+}
+
+// ReserveIdempotencyKey - резервирует ключ идемпотентности арендатора или возвращает существующую запись
+func (r *pgOrderRepository) ReserveIdempotencyKey(ctx context.Context, tenantID, key, requestHash string, expiredBefore time.Time) (postgres.IdempotencyRecord, bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rec, reserved, err := postgres.ReserveIdempotencyKey(ctx, r.pool, tenantID, key, requestHash, expiredBefore)
+	return rec, reserved, postgres.ClassifyError(ctx, err)
+}
+
+// CompleteIdempotencyKey - сохраняет результат запроса с ключом идемпотентности
+func (r *pgOrderRepository) CompleteIdempotencyKey(ctx context.Context, rec postgres.IdempotencyRecord) error {
+	return r.exec(ctx, func(ctx context.Context) error {
+		return postgres.CompleteIdempotencyKey(ctx, r.pool, rec)
+	})
+}
+
+// ReleaseIdempotencyKey - удаляет незавершённую резервацию ключа идемпотентности арендатора
+func (r *pgOrderRepository) ReleaseIdempotencyKey(ctx context.Context, tenantID, key string) error {
+	return r.exec(ctx, func(ctx context.Context) error {
+		return postgres.ReleaseIdempotencyKey(ctx, r.pool, tenantID, key)
+	})
+}
+
+// DeleteIdempotencyKeysBefore - удаляет ключи идемпотентности, созданные раньше before
+func (r *pgOrderRepository) DeleteIdempotencyKeysBefore(ctx context.Context, before time.Time) (int64, error) {
+	return query(ctx, r, func(ctx context.Context) (int64, error) {
+		return postgres.DeleteIdempotencyKeysBefore(ctx, r.pool, before)
+	})
+}
+
+// RecordLatencies - сохраняет последнюю задержку обработки заказов арендатора в журнал order_audit
+func (r *pgOrderRepository) RecordLatencies(ctx context.Context, tenantID string, list []postgres.LatencyRecord) error {
+	return r.exec(ctx, func(ctx context.Context) error {
+		return postgres.RecordLatencies(ctx, r.pool, tenantID, list)
+	})
+}
+
+// RecordWebhookFailure - сохраняет недоставленное уведомление webhook в журнал webhook_failures
+func (r *pgOrderRepository) RecordWebhookFailure(ctx context.Context, f postgres.WebhookFailure) error {
+	return r.exec(ctx, func(ctx context.Context) error {
+		return postgres.RecordWebhookFailure(ctx, r.pool, f)
+	})
+}
+
+// AddIngestStats - прибавляет почасовые счётчики сообщений консьюмера к таблице ingest_stats
+func (r *pgOrderRepository) AddIngestStats(ctx context.Context, list []postgres.IngestStats) error {
+	return r.exec(ctx, func(ctx context.Context) error {
+		return postgres.AddIngestStats(ctx, r.pool, list)
+	})
+}
+
+// ListIngestStats - возвращает до limit почасовых счётчиков сообщений арендатора, отобранных filter
+func (r *pgOrderRepository) ListIngestStats(ctx context.Context, tenantID string, filter postgres.IngestStatsFilter, limit int) ([]postgres.IngestStats, error) {
+	return queryRead(ctx, r, func(ctx context.Context, pool *pgxpool.Pool) ([]postgres.IngestStats, error) {
+		return postgres.ListIngestStats(ctx, pool, tenantID, filter, limit)
+	})
+}
+
+// RecordMessageAttempt - учитывает неудачную попытку записи сообщения в журнале message_attempts
+func (r *pgOrderRepository) RecordMessageAttempt(ctx context.Context, key postgres.MessageKey, orderUID, lastErr string) (int, error) {
+	return query(ctx, r, func(ctx context.Context) (int, error) {
+		return postgres.RecordMessageAttempt(ctx, r.pool, key, orderUID, lastErr)
+	})
+}
+
+// ClearMessageAttempts - удаляет счётчики попыток записанных или отправленных в очередь недоставленных сообщений
+func (r *pgOrderRepository) ClearMessageAttempts(ctx context.Context, keys []postgres.MessageKey) error {
+	return r.exec(ctx, func(ctx context.Context) error {
+		return postgres.ClearMessageAttempts(ctx, r.pool, keys)
+	})
+}
+
+// SaveCheckpoint - сохраняет позицию чтения партиции читателем без группы
+func (r *pgOrderRepository) SaveCheckpoint(ctx context.Context, cp postgres.Checkpoint) error {
+	return r.exec(ctx, func(ctx context.Context) error {
+		return postgres.SaveCheckpoint(ctx, r.pool, cp)
+	})
+}
+
+// LoadCheckpoints - возвращает сохранённые позиции чтения топика читателем reader по партициям
+func (r *pgOrderRepository) LoadCheckpoints(ctx context.Context, reader, topic string) (map[int]int64, error) {
+	return query(ctx, r, func(ctx context.Context) (map[int]int64, error) {
+		return postgres.LoadCheckpoints(ctx, r.pool, reader, topic)
+	})
+}
+
+// AddMessageSkip - сохраняет указание пропустить сообщение в таблице message_skips
+func (r *pgOrderRepository) AddMessageSkip(ctx context.Context, skip postgres.MessageSkip) error {
+	return r.exec(ctx, func(ctx context.Context) error {
+		return postgres.AddMessageSkip(ctx, r.pool, skip)
+	})
+}
+
+// ListMessageSkips - возвращает сохранённые указания пропустить сообщения
+func (r *pgOrderRepository) ListMessageSkips(ctx context.Context) ([]postgres.MessageSkip, error) {
+	return query(ctx, r, func(ctx context.Context) ([]postgres.MessageSkip, error) {
+		return postgres.ListMessageSkips(ctx, r.pool)
+	})
+}
+
+// DeleteMessageSkip - удаляет выполненное или устаревшее указание пропустить сообщение
+func (r *pgOrderRepository) DeleteMessageSkip(ctx context.Context, key postgres.MessageKey) error {
+	return r.exec(ctx, func(ctx context.Context) error {
+		return postgres.DeleteMessageSkip(ctx, r.pool, key)
+	})
+}
+
+// newReadBreaker - создает выключатель чтений из базы данных для HTTP обработчиков.
+// Отсутствие заказа или исходного сообщения и неизвестный ключ группировки — ответы базы, а не её отказы, поэтому не учитываются как ошибки.
+func newReadBreaker(cfg config.BreakerConfig, clk clock.Clock, logger *log.Logger) *breaker.Breaker {
+	bc := cfg.ToBreakerConfig()
+	bc.Clock = clk
+	bc.IsFailure = func(err error) bool {
+		return !errors.Is(err, postgres.ErrOrderNotFound) && !errors.Is(err, postgres.ErrUnknownGroupKey) &&
+			!errors.Is(err, postgres.ErrRawPayloadNotFound)
+	}
+	bc.OnStateChange = func(from, to breaker.State) {
+		logger.Printf("db read circuit breaker: %s -> %s", from, to)
+	}
+	return breaker.New(bc)
+}
+
+// breakerRepository - OrderRepository, пропускающий чтения через выключатель и ограничивающий их время.
+// Запись выполняется напрямую: выключатель защищает базу от HTTP нагрузки и не должен останавливать консьюмер.
+type breakerRepository struct {
+	OrderRepository
+	breaker *breaker.Breaker
+	timeout time.Duration // 0 — без ограничения, кроме дедлайна запроса
+	db      *dbRecovery   // восстановление пула, начинаемое при потере соединения во время чтения; nil — без него
+}
+
+// newBreakerRepository - оборачивает чтения repo выключателем br с ограничением времени timeout
+func newBreakerRepository(repo OrderRepository, br *breaker.Breaker, timeout time.Duration) *breakerRepository {
+	return &breakerRepository{OrderRepository: repo, breaker: br, timeout: timeout}
+}
+
+// read - выполняет чтение fn через выключатель. Время запроса ограничено меньшим из timeout и дедлайна ctx.
+func (r *breakerRepository) read(ctx context.Context, fn func(ctx context.Context) error) error {
+	done, err := r.breaker.Allow()
+	if err != nil {
+		return err
+	}
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	err = fn(ctx)
+	done(err)
+	r.db.report(err)
+	return err
+}
+
+// GetOrderByUID - возвращает заказ по идентификатору через выключатель
+func (r *breakerRepository) GetOrderByUID(ctx context.Context, tenantID, uid string) (order orders.Order, err error) {
+	err = r.read(ctx, func(ctx context.Context) error {
+		order, err = r.OrderRepository.GetOrderByUID(ctx, tenantID, uid)
+		return err
+	})
+	return order, err
+}
+
+// ExistsOrder - проверяет наличие заказа через выключатель
+func (r *breakerRepository) ExistsOrder(ctx context.Context, tenantID, uid string) (exists bool, err error) {
+	err = r.read(ctx, func(ctx context.Context) error {
+		exists, err = r.OrderRepository.ExistsOrder(ctx, tenantID, uid)
+		return err
+	})
+	return exists, err
+}
+
+// GetDelivery - возвращает доставку заказа через выключатель
+func (r *breakerRepository) GetDelivery(ctx context.Context, tenantID, uid string) (d *orders.Delivery, err error) {
+	err = r.read(ctx, func(ctx context.Context) error {
+		d, err = r.OrderRepository.GetDelivery(ctx, tenantID, uid)
+		return err
+	})
+	return d, err
+}
+
+// GetPayments - возвращает платежи заказа через выключатель
+func (r *breakerRepository) GetPayments(ctx context.Context, tenantID, uid string) (list []orders.Payment, err error) {
+	err = r.read(ctx, func(ctx context.Context) error {
+		list, err = r.OrderRepository.GetPayments(ctx, tenantID, uid)
+		return err
+	})
+	return list, err
+}
+
+// GetItems - возвращает товары заказа через выключатель
+func (r *breakerRepository) GetItems(ctx context.Context, tenantID, uid string) (list []orders.Item, err error) {
+	err = r.read(ctx, func(ctx context.Context) error {
+		list, err = r.OrderRepository.GetItems(ctx, tenantID, uid)
+		return err
+	})
+	return list, err
+}
+
+// ListOrdersAfter - возвращает страницу заказов через выключатель
+func (r *breakerRepository) ListOrdersAfter(ctx context.Context, tenantID string, after *postgres.OrderCursor, from, to time.Time, limit int, include postgres.Include, source string) (page []orders.Order, err error) {
+	err = r.read(ctx, func(ctx context.Context) error {
+		page, err = r.OrderRepository.ListOrdersAfter(ctx, tenantID, after, from, to, limit, include, source)
+		return err
+	})
+	return page, err
+}
+
+// FindOrdersByTrackNumber - возвращает страницу заказов с указанным трек-номером через выключатель
+func (r *breakerRepository) FindOrdersByTrackNumber(ctx context.Context, tenantID, trackNumber, sortBy string, after *postgres.SortCursor, limit int, include postgres.Include, source string) (list []orders.Order, err error) {
+	err = r.read(ctx, func(ctx context.Context) error {
+		list, err = r.OrderRepository.FindOrdersByTrackNumber(ctx, tenantID, trackNumber, sortBy, after, limit, include, source)
+		return err
+	})
+	return list, err
+}
+
+// FindOrdersByCustomer - возвращает страницу заказов покупателя через выключатель
+func (r *breakerRepository) FindOrdersByCustomer(ctx context.Context, tenantID, customerID, sortBy string, after *postgres.SortCursor, limit int, include postgres.Include) (list []orders.Order, err error) {
+	err = r.read(ctx, func(ctx context.Context) error {
+		list, err = r.OrderRepository.FindOrdersByCustomer(ctx, tenantID, customerID, sortBy, after, limit, include)
+		return err
+	})
+	return list, err
+}
+
+// CountOrdersBy - возвращает количество заказов по ключу группировки через выключатель
+func (r *breakerRepository) CountOrdersBy(ctx context.Context, tenantID, groupBy string, from, to time.Time) (groups []postgres.GroupCount, err error) {
+	err = r.read(ctx, func(ctx context.Context) error {
+		groups, err = r.OrderRepository.CountOrdersBy(ctx, tenantID, groupBy, from, to)
+		return err
+	})
+	return groups, err
+}
+
+// ListIngestStats - возвращает почасовые счётчики сообщений через выключатель
+func (r *breakerRepository) ListIngestStats(ctx context.Context, tenantID string, filter postgres.IngestStatsFilter, limit int) (list []postgres.IngestStats, err error) {
+	err = r.read(ctx, func(ctx context.Context) error {
+		list, err = r.OrderRepository.ListIngestStats(ctx, tenantID, filter, limit)
+		return err
+	})
+	return list, err
+}
+
+// ListIncompleteOrders - возвращает страницу неполных заказов через выключатель
+func (r *breakerRepository) ListIncompleteOrders(ctx context.Context, tenantID, after string, limit int) (list []postgres.IncompleteOrder, err error) {
+	err = r.read(ctx, func(ctx context.Context) error {
+		list, err = r.OrderRepository.ListIncompleteOrders(ctx, tenantID, after, limit)
+		return err
+	})
+	return list, err
+}
+
+// RecentOrders - возвращает последние сохранённые заказы через выключатель
+func (r *breakerRepository) RecentOrders(ctx context.Context, tenantID string, limit int) (list []postgres.OrderSummary, err error) {
+	err = r.read(ctx, func(ctx context.Context) error {
+		list, err = r.OrderRepository.RecentOrders(ctx, tenantID, limit)
+		return err
+	})
+	return list, err
+}
+
+// OrderUIDsWithPrefix - возвращает идентификаторы заказов по началу через выключатель
+func (r *breakerRepository) OrderUIDsWithPrefix(ctx context.Context, tenantID, prefix string, limit int) (list []string, err error) {
+	err = r.read(ctx, func(ctx context.Context) error {
+		list, err = r.OrderRepository.OrderUIDsWithPrefix(ctx, tenantID, prefix, limit)
+		return err
+	})
+	return list, err
+}
+
+// GetRawPayload - возвращает исходное сообщение заказа через выключатель
+func (r *breakerRepository) GetRawPayload(ctx context.Context, tenantID, uid string) (raw postgres.RawPayload, err error) {
+	err = r.read(ctx, func(ctx context.Context) error {
+		raw, err = r.OrderRepository.GetRawPayload(ctx, tenantID, uid)
+		return err
+	})
+	return raw, err
+}
+
+// writeUnavailable - отвечает на запрос r ошибкой, если err означает недоступность базы данных: 504 db_timeout, если запрос
+// не уложился во время (postgres.ErrQueryTimeout), и 503 db_unavailable при разомкнутом выключателе, потере соединения
+// или истёкшем дедлайне. Для разомкнутого выключателя выставляется Retry-After.
+// Возвращает false, если err не относится к недоступности.
+func writeUnavailable(w http.ResponseWriter, r *http.Request, err error) bool {
+	var open *breaker.OpenError
+	switch {
+	case errors.Is(err, postgres.ErrQueryTimeout):
+		writeAPIError(w, r, http.StatusGatewayTimeout, errCodeDBTimeout)
+		return true
+	case errors.As(err, &open):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(open.RetryAfter.Seconds()))))
+	case errors.Is(err, postgres.ErrUnavailable), errors.Is(err, context.DeadlineExceeded):
+	default:
+		return false
+	}
+	writeAPIError(w, r, http.StatusServiceUnavailable, errCodeDBUnavailable)
+	return true
+}
@@ -0,0 +1,78 @@
+// Описание: Тесты ограничения времени вызовов репозитория PostgreSQL и ответов обработчиков на истечение времени
+// запроса (504) и недоступность базы (503)
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockUntilDone - вызов репозитория, который ждёт истечения контекста и возвращает оставшееся ему время
+func blockUntilDone(ctx context.Context) (time.Duration, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, nil
+	}
+	left := time.Until(deadline)
+	<-ctx.Done()
+	return left, fmt.Errorf("failed to query orders: %w", ctx.Err())
+}
+
+func TestPgRepositoryQueryTimeout(t *testing.T) {
+	r := &pgOrderRepository{timeout: 30 * time.Millisecond}
+
+	left, err := query(context.Background(), r, blockUntilDone)
+	assert.ErrorIs(t, err, postgres.ErrQueryTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.LessOrEqual(t, left, 30*time.Millisecond)
+
+	// Более ранний дедлайн вызывающего сохраняется
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	left, err = query(ctx, r, blockUntilDone)
+	assert.ErrorIs(t, err, postgres.ErrQueryTimeout)
+	assert.LessOrEqual(t, left, 5*time.Millisecond)
+
+	// Без query_timeout вызов ограничен только дедлайном вызывающего
+	left, err = query(context.Background(), &pgOrderRepository{}, blockUntilDone)
+	require.NoError(t, err)
+	assert.Zero(t, left)
+
+	// Ошибки, не связанные со временем, возвращаются как есть
+	err = r.exec(context.Background(), func(context.Context) error { return postgres.ErrOrderExists })
+	assert.Same(t, postgres.ErrOrderExists, err)
+}
+
+func TestOrderHandlerDatabaseTimeouts(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"client deadline", postgres.ClassifyError(context.Background(), fmt.Errorf("query: %w", context.DeadlineExceeded)), http.StatusGatewayTimeout, errCodeDBTimeout},
+		{"statement_timeout", postgres.ClassifyError(context.Background(), &pgconn.PgError{Code: "57014"}), http.StatusGatewayTimeout, errCodeDBTimeout},
+		{"connection lost", postgres.ClassifyError(context.Background(), &pgconn.PgError{Code: "57P01"}), http.StatusServiceUnavailable, errCodeDBUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeRepository{orders: map[string]orders.Order{}, readErrs: []error{tc.err}}
+			h := withDefaultTenant(makeOrderHandler(newTestCache(t), repo, piiPolicy{}, nil, newTestLogger()))
+			rec := getOrder(t, h, "order-1")
+			assert.Equal(t, tc.status, rec.Code)
+			var body apiErrorResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+			assert.Equal(t, tc.code, body.Code)
+		})
+	}
+}
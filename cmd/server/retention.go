@@ -0,0 +1,75 @@
+// Описание: Периодическое удаление исходных сообщений Kafka, ключей идемпотентности и записей истории доставки,
+// срок хранения которых истёк; при выборе лидера (секция leader) удаление выполняет только лидер
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"l0_test_self/internal/leader"
+)
+
+// runRawPayloadCleanup - удаляет исходные сообщения старше retention каждые interval до отмены контекста
+func runRawPayloadCleanup(ctx context.Context, repo OrderRepository, jobs *leader.Elector, retention, interval time.Duration, logger *log.Logger) {
+	runPeriodic(ctx, jobs, retention, interval, func(ctx context.Context, before time.Time) { cleanupRawPayloads(ctx, repo, before, logger) })
+}
+
+// runIdempotencyKeyCleanup - удаляет ключи идемпотентности старше ttl каждые interval до отмены контекста
+func runIdempotencyKeyCleanup(ctx context.Context, repo OrderRepository, jobs *leader.Elector, ttl, interval time.Duration, logger *log.Logger) {
+	runPeriodic(ctx, jobs, ttl, interval, func(ctx context.Context, before time.Time) {
+		deleted, err := repo.DeleteIdempotencyKeysBefore(ctx, before)
+		if err != nil {
+			logger.Printf("idempotency key cleanup error: %v", err)
+			return
+		}
+		if deleted > 0 {
+			logger.Printf("idempotency key cleanup: deleted %d keys created before %s", deleted, before.Format(time.RFC3339))
+		}
+	})
+}
+
+// runDeliveryHistoryCleanup - удаляет записи истории доставки старше retention каждые interval до отмены контекста
+func runDeliveryHistoryCleanup(ctx context.Context, repo OrderRepository, jobs *leader.Elector, retention, interval time.Duration, logger *log.Logger) {
+	runPeriodic(ctx, jobs, retention, interval, func(ctx context.Context, before time.Time) {
+		deleted, err := repo.DeleteDeliveryHistoryBefore(ctx, before)
+		if err != nil {
+			logger.Printf("delivery history cleanup error: %v", err)
+			return
+		}
+		if deleted > 0 {
+			logger.Printf("delivery history cleanup: deleted %d changes made before %s", deleted, before.Format(time.RFC3339))
+		}
+	})
+}
+
+// runPeriodic - каждые interval вызывает cleanup с границей now-retention до отмены контекста; нулевые значения отключают очистку.
+// Если jobs задан, cleanup вызывается, только пока экземпляр — лидер, и прерывается отменой контекста при потере лидерства.
+func runPeriodic(ctx context.Context, jobs *leader.Elector, retention, interval time.Duration, cleanup func(ctx context.Context, before time.Time)) {
+	if retention <= 0 || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			before := time.Now().Add(-retention)
+			jobs.Do(ctx, func(ctx context.Context) { cleanup(ctx, before) })
+		}
+	}
+}
+
+// cleanupRawPayloads - удаляет исходные сообщения, полученные раньше before
+func cleanupRawPayloads(ctx context.Context, repo OrderRepository, before time.Time, logger *log.Logger) {
+	deleted, err := repo.DeleteRawPayloadsBefore(ctx, before)
+	if err != nil {
+		logger.Printf("raw payload cleanup error: %v", err)
+		return
+	}
+	if deleted > 0 {
+		logger.Printf("raw payload cleanup: deleted %d payloads received before %s", deleted, before.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,78 @@
+// Описание: Версии схемы заказа: консьюмер и POST /orders переводят JSON заказа из версии, указанной в заголовке
+// schema-version, параметре schema_version или поле schema_version, в текущую версию модели (orders.UpgradeOrderJSON).
+// Сообщения неизвестной версии отправляются в очередь недоставленных сообщений с причиной unknown_schema_version
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/codec"
+	"l0_test_self/pkg/kafkautil"
+
+	kafka2 "github.com/segmentio/kafka-go"
+)
+
+// dlqReasonSchemaVersion - причина отправки в очередь недоставленных сообщения в неизвестной версии схемы заказа
+const dlqReasonSchemaVersion = "unknown_schema_version"
+
+// schemaVersionParam - параметр запроса POST /orders с версией схемы заказа; заголовок запроса — codec.SchemaVersionHeader
+const schemaVersionParam = "schema_version"
+
+// upgradeMessageSchema - тело сообщения msg в текущей версии схемы заказа. Версии схемы определены для JSON: сообщения
+// других форматов принимаются только в текущей версии.
+func upgradeMessageSchema(format codec.Codec, msg kafka2.Message) ([]byte, error) {
+	version, err := codec.SchemaVersion(msg.Headers)
+	if err != nil {
+		return nil, err
+	}
+	if format.Name() != codec.FormatJSON {
+		if version != 0 && version != orders.CurrentSchemaVersion {
+			return nil, fmt.Errorf("%w %d for %s messages", orders.ErrUnknownSchemaVersion, version, format.Name())
+		}
+		return msg.Value, nil
+	}
+	data, _, err := orders.UpgradeOrderJSON(msg.Value, version)
+	return data, err
+}
+
+// rejectSchema - отправляет сообщение msg арендатора tenantID в неизвестной версии схемы в очередь недоставленных:
+// его можно будет переиграть, когда сервис узнает эту версию. Отправка повторяется, пока не удастся или консьюмер
+// не будет остановлен; false — сообщение не отправлено до остановки. Без очереди недоставленных сообщение пропускается.
+func (c *consumer) rejectSchema(ctx context.Context, msg kafka2.Message, tenantID string, cause error) bool {
+	ref := kafkautil.MessageRef(msg)
+	if c.dlq == nil {
+		c.fail(stageDecode, dlqReasonSchemaVersion, &msg, "", "%v, message skipped without dlq (%s)", cause, ref)
+		return true
+	}
+	for {
+		opCtx, cancel := opContext(ctx)
+		err := c.sendToDLQ(opCtx, msg, tenantID, &orders.Order{}, dlqReasonSchemaVersion, 0, cause)
+		cancel()
+		if err == nil {
+			c.fail(stageDecode, dlqReasonSchemaVersion, &msg, "", "%v, message sent to dlq (%s)", cause, ref)
+			return true
+		}
+		c.fail(stageDecode, "dlq", &msg, "", "dlq write error, message of unknown schema version will be retried (%s): %v", ref, err)
+		if !sleepCtx(ctx, c.clock, c.retryDelay) {
+			return false
+		}
+	}
+}
+
+// upgradeRequestSchema - тело запроса создания заказа в текущей версии схемы. Версия берётся из параметра
+// schema_version, заголовка Schema-Version или поля schema_version тела.
+func upgradeRequestSchema(r *http.Request, body []byte) ([]byte, error) {
+	raw := r.URL.Query().Get(schemaVersionParam)
+	if raw == "" {
+		raw = r.Header.Get(codec.SchemaVersionHeader)
+	}
+	version, err := orders.ParseSchemaVersion(raw)
+	if err != nil {
+		return nil, err
+	}
+	body, _, err = orders.UpgradeOrderJSON(body, version)
+	return body, err
+}
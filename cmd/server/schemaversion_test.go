@@ -0,0 +1,172 @@
+// Описание: Тесты версий схемы заказа: консьюмер принимает заказы версии 2 из заголовка и поля schema_version,
+// отправляет сообщения неизвестной версии в очередь недоставленных с отдельной причиной, а POST /orders принимает
+// версию из параметра, заголовка и тела
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/pkg/codec"
+	"l0_test_self/pkg/testorders"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// orderJSONV2 - JSON заказа в версии схемы 2 (customer_id перенесён в customer.id); withField добавляет поле schema_version
+func orderJSONV2(t *testing.T, g *testorders.Generator, withField bool) ([]byte, string, string) {
+	t.Helper()
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(mustOrderJSON(t, g), &fields))
+	customer := fields["customer_id"].(string)
+	delete(fields, "customer_id")
+	fields["customer"] = map[string]any{"id": customer}
+	if withField {
+		fields["schema_version"] = 2
+	}
+	b, err := json.Marshal(fields)
+	require.NoError(t, err)
+	return b, fields["order_uid"].(string), customer
+}
+
+func schemaHeader(version string) []kafka2.Header {
+	return []kafka2.Header{{Key: codec.SchemaVersionHeader, Value: []byte(version)}}
+}
+
+func TestConsumerSchemaVersions(t *testing.T) {
+	gen := testorders.NewGenerator(61)
+	byHeader, headerUID, headerCustomer := orderJSONV2(t, gen, false)
+	byField, fieldUID, fieldCustomer := orderJSONV2(t, gen, true)
+	future := mustOrderJSON(t, gen)
+	protoOrder := gen.Order(testorders.ScenarioDefault)
+	protobufV2, err := codec.Protobuf.Encode(&protoOrder)
+	require.NoError(t, err)
+	msgs := []kafka2.Message{
+		{Topic: "orders", Offset: 0, Value: byHeader, Headers: schemaHeader("2")},
+		{Topic: "orders", Offset: 1, Value: byField},
+		{Topic: "orders", Offset: 2, Value: future, Headers: schemaHeader("3")},
+		{Topic: "orders", Offset: 3, Value: protobufV2, Headers: append(schemaHeader("2"), codec.Header(codec.Protobuf))},
+		{Topic: "orders", Offset: 4, Value: byField, Headers: schemaHeader("1")},
+	}
+
+	for _, mode := range []string{config.PipelineModeSync, config.PipelineModeBatched} {
+		t.Run(mode, func(t *testing.T) {
+			repo := &fakeRepository{}
+			reader := &sliceReader{msgs: msgs}
+			cfg := newConsumerTestConfig()
+			if mode == config.PipelineModeBatched {
+				cfg = newBatchedTestConfig(len(msgs), time.Hour)
+			}
+			cfg.Kafka.Consumer.ErrorBufferSize = 10
+			dlq := &fakeWriter{}
+			monitor := newConsumerMonitor(cfg)
+			ctx, cancel := context.WithCancel(context.Background())
+			wg := startKafkaConsumer(ctx, reader, dlq, repo, newTestCache(t), newTestLogger(), cfg, monitor)
+
+			require.Eventually(t, func() bool { return len(reader.committedOffsets()) == len(msgs) }, 5*time.Second, time.Millisecond)
+			cancel()
+			wg.Wait()
+
+			// Заказы версии 2 записаны в текущей модели
+			for uid, customer := range map[string]string{headerUID: headerCustomer, fieldUID: fieldCustomer} {
+				stored, err := repo.GetOrderByUID(context.Background(), tenant.Default, uid)
+				require.NoError(t, err)
+				assert.Equal(t, customer, stored.CustomerId)
+				assert.Empty(t, stored.Extras, "schema_version and customer are not kept as extra fields")
+			}
+
+			// Неизвестная версия и версия 2 в Protobuf уходят в очередь недоставленных с отдельной причиной
+			written := dlq.written()
+			require.Len(t, written, 2)
+			for i, offset := range []int64{2, 3} {
+				assert.Equal(t, msgs[offset].Value, written[i].Value)
+				assert.Equal(t, dlqReasonSchemaVersion, headerValue(written[i], dlqReasonHeader))
+				assert.Contains(t, headerValue(written[i], dlqErrorHeader), "unknown schema version")
+			}
+
+			// Поле, противоречащее заголовку, — постоянная ошибка декодирования
+			entries := monitor.errors.Entries(stageDecode)
+			var classes []string
+			for _, e := range entries {
+				classes = append(classes, e.Class)
+			}
+			assert.ElementsMatch(t, []string{dlqReasonSchemaVersion, dlqReasonSchemaVersion, "decode"}, classes)
+		})
+	}
+}
+
+func TestConsumerSchemaVersionWithoutDLQ(t *testing.T) {
+	c, logs := newDecodeTestConsumer()
+	msg := kafka2.Message{Topic: "orders", Offset: 5, Value: []byte(`{"schema_version":9}`)}
+
+	_, _, ok, handled := c.decode(context.Background(), msg)
+	assert.False(t, ok)
+	assert.True(t, handled, "without a dlq the message is skipped")
+	assert.Contains(t, logs.String(), "unknown schema version 9, message skipped without dlq")
+}
+
+func TestConsumerSchemaVersionDLQRetryStopsAtShutdown(t *testing.T) {
+	c, _ := newDecodeTestConsumer()
+	c.dlq = &fakeWriter{err: errors.New("broker unavailable")}
+	c.retryDelay = time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, _, ok, handled := c.decode(ctx, kafka2.Message{Topic: "orders", Value: []byte(`{}`), Headers: schemaHeader("3")})
+	assert.False(t, ok)
+	assert.False(t, handled, "the message stays uncommitted until the dlq accepts it")
+}
+
+func TestOrderCreateSchemaVersion(t *testing.T) {
+	gen := testorders.NewGenerator(63)
+	for _, tc := range []struct {
+		name   string
+		target string
+		header string
+		field  bool
+	}{
+		{"query", "/orders?schema_version=2", "", false},
+		{"header", "/orders", "2", false},
+		{"body field", "/orders", "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeRepository{}
+			h := withDefaultTenant(makeOrderCreateHandler(repo, newTestCache(t), config.IdempotencyConfig{}, clock.Real, newTestLogger()))
+			body, uid, customer := orderJSONV2(t, gen, tc.field)
+			req := httptest.NewRequest(http.MethodPost, tc.target, strings.NewReader(string(body)))
+			if tc.header != "" {
+				req.Header.Set("Schema-Version", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+			stored, err := repo.GetOrderByUID(context.Background(), tenant.Default, uid)
+			require.NoError(t, err)
+			assert.Equal(t, customer, stored.CustomerId)
+		})
+	}
+
+	h := withDefaultTenant(makeOrderCreateHandler(&fakeRepository{}, newTestCache(t), config.IdempotencyConfig{}, clock.Real, newTestLogger()))
+	body, _, _ := orderJSONV2(t, gen, false)
+	for target, want := range map[string]string{
+		"/orders?schema_version=3":  "unknown schema version 3",
+		"/orders?schema_version=v2": "invalid schema version",
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader(string(body))))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+		assert.Contains(t, rec.Body.String(), want, target)
+	}
+}
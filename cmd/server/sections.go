@@ -0,0 +1,174 @@
+// Описание: Разделы заказа отдельными эндпоинтами GET /orders/{id}/delivery, /orders/{id}/payment и /orders/{id}/items
+// для ленивой загрузки в веб-интерфейсе: раздел берётся из заказа в кэше или читается из базы данных отдельным запросом
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"l0_test_self/internal/ids"
+	"l0_test_self/internal/jsonpool"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+)
+
+// orderSection - раздел заказа, отдаваемый отдельным эндпоинтом
+type orderSection struct {
+	// load - читает из базы данных только раздел и возвращает заказ, в котором заполнен лишь он
+	load func(ctx context.Context, repo OrderRepository, tenantID, id string) (orders.Order, error)
+	// response - тело ответа с разделом заказа o
+	response func(o orders.Order) any
+}
+
+// deliverySectionResponse - ответ GET /orders/{id}/delivery
+type deliverySectionResponse struct {
+	XMLName  xml.Name         `json:"-" xml:"order_delivery"`
+	OrderUid string           `json:"order_uid" xml:"order_uid"`
+	Delivery *orders.Delivery `json:"delivery" xml:"delivery"` // null (в XML — нет элемента), если у заказа нет доставки
+}
+
+// paymentSectionResponse - ответ GET /orders/{id}/payment
+type paymentSectionResponse struct {
+	XMLName  xml.Name         `json:"-" xml:"order_payment"`
+	OrderUid string           `json:"order_uid" xml:"order_uid"`
+	Payment  *orders.Payment  `json:"payment" xml:"-"` // основной (первый) платёж; null, если платежей нет
+	Payments []orders.Payment `json:"payments" xml:"payments>payment"`
+}
+
+// itemsSectionResponse - ответ GET /orders/{id}/items
+type itemsSectionResponse struct {
+	XMLName  xml.Name      `json:"-" xml:"order_items"`
+	OrderUid string        `json:"order_uid" xml:"order_uid"`
+	Items    []orders.Item `json:"items" xml:"items>item"`
+}
+
+// Разделы заказа для makeOrderSectionHandler. Отсутствующий у существующего заказа раздел отдаётся с кодом 200
+// явным null (доставка, основной платёж) или пустым списком, а 404 означает, что нет самого заказа.
+var (
+	deliverySection = orderSection{
+		load: func(ctx context.Context, repo OrderRepository, tenantID, id string) (orders.Order, error) {
+			d, err := repo.GetDelivery(ctx, tenantID, id)
+			o := orders.Order{OrderUid: id}
+			if d != nil {
+				o.Delivery = *d
+			}
+			return o, err
+		},
+		response: func(o orders.Order) any {
+			resp := deliverySectionResponse{OrderUid: o.OrderUid}
+			if o.Delivery != (orders.Delivery{}) {
+				resp.Delivery = &o.Delivery
+			}
+			return resp
+		},
+	}
+	paymentSection = orderSection{
+		load: func(ctx context.Context, repo OrderRepository, tenantID, id string) (orders.Order, error) {
+			payments, err := repo.GetPayments(ctx, tenantID, id)
+			return orders.Order{OrderUid: id, Payments: payments}, err
+		},
+		response: func(o orders.Order) any {
+			resp := paymentSectionResponse{OrderUid: o.OrderUid, Payment: o.Payment(), Payments: o.Payments}
+			if resp.Payments == nil {
+				resp.Payments = []orders.Payment{}
+			}
+			return resp
+		},
+	}
+	itemsSection = orderSection{
+		load: func(ctx context.Context, repo OrderRepository, tenantID, id string) (orders.Order, error) {
+			items, err := repo.GetItems(ctx, tenantID, id)
+			return orders.Order{OrderUid: id, Items: items}, err
+		},
+		response: func(o orders.Order) any {
+			resp := itemsSectionResponse{OrderUid: o.OrderUid, Items: o.Items}
+			if resp.Items == nil {
+				resp.Items = []orders.Item{}
+			}
+			return resp
+		},
+	}
+)
+
+// makeOrderSectionHandler - HTTP обработчик раздела section заказа. Раздел берётся из заказа в кэше, а при промахе
+// читается из базы данных без загрузки остального заказа; в кэш он не попадает. Формат ответа выбирается по заголовку
+// Accept (render.go). ETag ответа вычисляется по его телу, поэтому не меняется, пока не изменится раздел, и различается
+// в разных форматах; запрос с совпадающим If-None-Match получает 304 без тела.
+// Персональные данные доставки маскируются согласно pii.
+func makeOrderSectionHandler(section orderSection, orderCache OrderCache, repo OrderRepository, pii piiPolicy, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, ok := negotiateFormat(w, r)
+		if !ok {
+			return
+		}
+		reqID := requestIDFromContext(r.Context())
+		id, err := ids.Parse(r.PathValue("id"))
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeOrderIDInvalid)
+			return
+		}
+		orderID := id.String()
+
+		tenantID := tenantFromContext(r.Context())
+		order, ok := orderCache.Get(tenantID, orderID)
+		if !ok {
+			order, err = section.load(r.Context(), repo, tenantID, orderID)
+			switch {
+			case errors.Is(err, postgres.ErrOrderNotFound):
+				writeAPIError(w, r, http.StatusNotFound, errCodeOrderNotFound)
+				return
+			case err != nil:
+				logger.Printf("[%s] order section %s: db error (order=%s): %v", reqID, r.URL.Path, orderID, err)
+				if !writeUnavailable(w, r, err) {
+					writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+				}
+				return
+			}
+		}
+		if !pii.fullAccess(r) {
+			order = redactOrder(order)
+		}
+
+		b := jsonpool.Get()
+		defer jsonpool.Put(b)
+		if err := format.encode(b, section.response(order)); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+			writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			return
+		}
+		body := b.Bytes()
+		etag := sectionETag(body)
+		w.Header().Set("ETag", etag)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.Header().Add("Vary", "Accept")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writeRendered(w, r, format, body, logger)
+	}
+}
+
+// sectionETag - ETag раздела заказа: первые 16 байт SHA-256 тела ответа
+func sectionETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return strconv.Quote(hex.EncodeToString(sum[:16]))
+}
+
+// etagMatches - сообщает, совпадает ли etag с одним из значений заголовка If-None-Match (слабое сравнение, как
+// требует RFC 9110 для If-None-Match) или заголовок равен "*"
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+// Описание: Тесты эндпоинтов разделов заказа GET /orders/{id}/delivery, /payment и /items: чтение из кэша и из базы
+// данных, явный null для отсутствующего раздела, ETag по содержимому раздела и маскирование персональных данных
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSectionsMux - маршрутизатор трёх эндпоинтов разделов заказа, заполняющий параметр пути
+func newSectionsMux(c OrderCache, repo OrderRepository, pii piiPolicy) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("GET /orders/{id}/delivery", withDefaultTenant(makeOrderSectionHandler(deliverySection, c, repo, pii, newTestLogger())))
+	mux.Handle("GET /orders/{id}/payment", withDefaultTenant(makeOrderSectionHandler(paymentSection, c, repo, pii, newTestLogger())))
+	mux.Handle("GET /orders/{id}/items", withDefaultTenant(makeOrderSectionHandler(itemsSection, c, repo, pii, newTestLogger())))
+	return mux
+}
+
+// getSection - выполняет GET запрос раздела с заголовками headers (пары имя, значение)
+func getSection(t *testing.T, h http.Handler, url string, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// sectionsTestOrder - заказ со всеми разделами
+func sectionsTestOrder() orders.Order {
+	o := piiTestOrder()
+	o.Payments = []orders.Payment{{Transaction: "order-1", Currency: "RUB", Amount: 100}, {Transaction: "order-1-2", Currency: "RUB", Amount: 50}}
+	o.Items = []orders.Item{{ChrtId: 1, Name: "Mascaras", Price: 453}}
+	return o
+}
+
+func TestOrderSectionsFromCacheAndDB(t *testing.T) {
+	order := sectionsTestOrder()
+	cached := newTestCache(t)
+	cached.Set(tenant.Default, order)
+	cacheRepo := &fakeRepository{}
+	dbRepo := &fakeRepository{orders: map[string]orders.Order{"order-1": order}}
+	dbCache := newTestCache(t)
+	fromCache := newSectionsMux(cached, cacheRepo, piiPolicy{})
+	fromDB := newSectionsMux(dbCache, dbRepo, piiPolicy{})
+
+	for _, section := range []string{"delivery", "payment", "items"} {
+		url := "/orders/ORDER-1/" + section
+		recCache := getSection(t, fromCache, url)
+		recDB := getSection(t, fromDB, url)
+		require.Equal(t, http.StatusOK, recCache.Code, section)
+		require.Equal(t, http.StatusOK, recDB.Code, section)
+		assert.JSONEq(t, recCache.Body.String(), recDB.Body.String(), section)
+		assert.NotEmpty(t, recCache.Header().Get("ETag"), section)
+		assert.Equal(t, recCache.Header().Get("ETag"), recDB.Header().Get("ETag"), "ETag depends only on the section content")
+	}
+	assert.Zero(t, cacheRepo.sectionReads, "cached order is served without the database")
+	assert.Equal(t, 3, dbRepo.sectionReads)
+	assert.Zero(t, dbRepo.reads, "the whole order is not assembled")
+	assert.Zero(t, dbCache.Len(), "a section does not populate the cache")
+
+	var delivery deliverySectionResponse
+	require.NoError(t, json.Unmarshal(getSection(t, fromDB, "/orders/order-1/delivery").Body.Bytes(), &delivery))
+	assert.Equal(t, "order-1", delivery.OrderUid)
+	require.NotNil(t, delivery.Delivery)
+	assert.Equal(t, order.Delivery, *delivery.Delivery)
+
+	var payment paymentSectionResponse
+	require.NoError(t, json.Unmarshal(getSection(t, fromCache, "/orders/order-1/payment").Body.Bytes(), &payment))
+	assert.Equal(t, order.Payments, payment.Payments)
+	require.NotNil(t, payment.Payment)
+	assert.Equal(t, order.Payments[0], *payment.Payment)
+
+	var items itemsSectionResponse
+	require.NoError(t, json.Unmarshal(getSection(t, fromDB, "/orders/order-1/items").Body.Bytes(), &items))
+	assert.Equal(t, order.Items, items.Items)
+}
+
+func TestOrderSectionsAbsentSectionIsExplicitNull(t *testing.T) {
+	empty := orders.Order{OrderUid: "order-1"}
+	cached := newTestCache(t)
+	cached.Set(tenant.Default, empty)
+	for name, h := range map[string]http.Handler{
+		"cache": newSectionsMux(cached, &fakeRepository{}, piiPolicy{}),
+		"db":    newSectionsMux(newTestCache(t), &fakeRepository{orders: map[string]orders.Order{"order-1": empty}}, piiPolicy{}),
+	} {
+		rec := getSection(t, h, "/orders/order-1/delivery")
+		require.Equal(t, http.StatusOK, rec.Code, name)
+		assert.JSONEq(t, `{"order_uid":"order-1","delivery":null}`, rec.Body.String(), name)
+		rec = getSection(t, h, "/orders/order-1/payment")
+		require.Equal(t, http.StatusOK, rec.Code, name)
+		assert.JSONEq(t, `{"order_uid":"order-1","payment":null,"payments":[]}`, rec.Body.String(), name)
+		rec = getSection(t, h, "/orders/order-1/items")
+		require.Equal(t, http.StatusOK, rec.Code, name)
+		assert.JSONEq(t, `{"order_uid":"order-1","items":[]}`, rec.Body.String(), name)
+	}
+}
+
+func TestOrderSectionsErrors(t *testing.T) {
+	repo := &fakeRepository{}
+	h := newSectionsMux(newTestCache(t), repo, piiPolicy{})
+	for _, section := range []string{"delivery", "payment", "items"} {
+		assert.Equal(t, http.StatusNotFound, getSection(t, h, "/orders/missing/"+section).Code, section)
+		assert.Equal(t, http.StatusBadRequest, getSection(t, h, "/orders/bad_id/"+section).Code, section)
+	}
+
+	repo.err = errors.New("connection refused")
+	assert.Equal(t, http.StatusInternalServerError, getSection(t, h, "/orders/order-1/items").Code)
+	br := newTestReadBreaker(time.Minute)
+	h = newSectionsMux(newTestCache(t), newBreakerRepository(repo, br, time.Second), piiPolicy{})
+	for i := 0; i < 4; i++ {
+		getSection(t, h, "/orders/order-1/payment")
+	}
+	rec := getSection(t, h, "/orders/order-1/payment")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "open breaker")
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+}
+
+func TestOrderSectionsETag(t *testing.T) {
+	c := newTestCache(t)
+	order := sectionsTestOrder()
+	c.Set(tenant.Default, order)
+	h := newSectionsMux(c, &fakeRepository{}, piiPolicy{})
+
+	rec := getSection(t, h, "/orders/order-1/items")
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	notModified := getSection(t, h, "/orders/order-1/items", "If-None-Match", `"other", `+etag)
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Empty(t, notModified.Body.String())
+	assert.Equal(t, etag, notModified.Header().Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, getSection(t, h, "/orders/order-1/items", "If-None-Match", "W/"+etag).Code)
+
+	// Изменение другого раздела не меняет ETag товаров, а изменение товаров — меняет
+	order.TrackNumber = "TRACK-2"
+	order.Delivery.City = "Haifa"
+	c.Set(tenant.Default, order)
+	assert.Equal(t, http.StatusNotModified, getSection(t, h, "/orders/order-1/items", "If-None-Match", etag).Code)
+	order.Items = []orders.Item{{ChrtId: 1, Name: "Mascaras", Price: 500}}
+	c.Set(tenant.Default, order)
+	rec = getSection(t, h, "/orders/order-1/items", "If-None-Match", etag)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+}
+
+func TestOrderDeliverySectionRedactsPII(t *testing.T) {
+	c := newTestCache(t)
+	c.Set(tenant.Default, piiTestOrder())
+	h := newSectionsMux(c, &fakeRepository{}, newTestPIIPolicy())
+
+	var redacted deliverySectionResponse
+	support := getWithKey(t, h, "/orders/order-1/delivery", testSupportKey)
+	require.NoError(t, json.Unmarshal(support.Body.Bytes(), &redacted))
+	assert.Equal(t, "+972*****00", redacted.Delivery.Phone)
+
+	var full deliverySectionResponse
+	rec := getWithKey(t, h, "/orders/order-1/delivery", testFullKey)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &full))
+	assert.Equal(t, piiTestOrder().Delivery, *full.Delivery)
+	assert.NotEqual(t, support.Header().Get("ETag"), rec.Header().Get("ETag"), "redacted and raw sections have different ETags")
+}
@@ -0,0 +1,189 @@
+// Описание: Теневая проверка кэша: для выборки попаданий в кэш GET /order заказ в фоне читается из базы данных
+// и сравнивается с отданным из кэша; расхождения пишутся в лог и учитываются в метриках, а ответ всегда берётся из кэша
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/diff"
+	"l0_test_self/internal/goroutines"
+	"l0_test_self/internal/metrics"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+)
+
+const (
+	// defaultShadowVerifyConcurrency - число одновременных фоновых чтений, если cache.shadow_verify_concurrency не задан
+	defaultShadowVerifyConcurrency = 4
+	// shadowVerifyTimeout - предельное время фонового чтения заказа
+	shadowVerifyTimeout = 5 * time.Second
+	// shadowLoggedPaths - сколько путей различающихся полей попадает в запись лога о расхождении
+	shadowLoggedPaths = 5
+)
+
+// shadowVerifier - теневая проверка попаданий в кэш. nil выключает проверку: методы nil получателя ничего не делают
+type shadowVerifier struct {
+	rate   float64
+	sem    chan struct{} // ограничивает число одновременных фоновых чтений
+	cache  OrderCache
+	repo   OrderRepository
+	logger *log.Logger
+
+	checks     *metrics.Counter // завершённые сравнения
+	mismatches *metrics.Counter // сравнения, в которых кэш разошёлся с базой данных или со своим JSON
+	readErrs   *metrics.Counter // фоновые чтения и сравнения, завершившиеся ошибкой
+	dropped    *metrics.Counter // выбранные попадания, не проверенные из-за занятых слотов чтения
+}
+
+// newShadowVerifier - теневая проверка по cfg.ShadowVerifyRate; nil, если доля проверяемых попаданий равна нулю
+func newShadowVerifier(cfg config.CacheConfig, orderCache OrderCache, repo OrderRepository, logger *log.Logger) *shadowVerifier {
+	if cfg.ShadowVerifyRate <= 0 {
+		return nil
+	}
+	concurrency := cfg.ShadowVerifyConcurrency
+	if concurrency == 0 {
+		concurrency = defaultShadowVerifyConcurrency
+	}
+	return &shadowVerifier{
+		rate:       cfg.ShadowVerifyRate,
+		sem:        make(chan struct{}, concurrency),
+		cache:      orderCache,
+		repo:       repo,
+		logger:     logger,
+		checks:     &metrics.Counter{},
+		mismatches: &metrics.Counter{},
+		readErrs:   &metrics.Counter{},
+		dropped:    &metrics.Counter{},
+	}
+}
+
+// register - регистрирует счётчики теневой проверки в реестре метрик
+func (v *shadowVerifier) register(reg *metrics.Registry) {
+	if v == nil {
+		return
+	}
+	reg.RegisterCounter("cache_shadow_checks_total", "Sampled cache hits compared with the database (cache.shadow_verify_rate).", v.checks)
+	reg.RegisterCounter("cache_shadow_mismatches_total", "Sampled cache hits whose order differed from the database or from its serialized JSON.", v.mismatches)
+	reg.RegisterCounter("cache_shadow_errors_total", "Shadow database reads or comparisons that failed.", v.readErrs)
+	reg.RegisterCounter("cache_shadow_dropped_total", "Sampled cache hits not checked because all shadow read slots were busy.", v.dropped)
+}
+
+// sample - выбирает попадание в кэш для проверки с вероятностью rate
+func (v *shadowVerifier) sample() bool {
+	return v != nil && rand.Float64() < v.rate
+}
+
+// verify - запускает в фоне сравнение заказа cached, отданного из кэша, с заказом в базе данных. body - JSON,
+// которым заказ был отдан из кэша (cache.serialized_json), или nil; он дополнительно сравнивается с cached.
+// Если все слоты чтения заняты, проверка пропускается, а не ждёт
+func (v *shadowVerifier) verify(tenantID, orderID string, cached orders.Order, body []byte) {
+	select {
+	case v.sem <- struct{}{}:
+	default:
+		v.dropped.Inc()
+		return
+	}
+	err := goroutines.TryGo("cache shadow verify", nil, func() {
+		defer func() { <-v.sem }()
+		v.check(tenantID, orderID, cached, body)
+	})
+	if err != nil {
+		<-v.sem
+		v.dropped.Inc()
+	}
+}
+
+// check - сравнивает заказ из кэша с его JSON и с заказом в базе данных
+func (v *shadowVerifier) check(tenantID, orderID string, cached orders.Order, body []byte) {
+	if body != nil {
+		diffs, err := diff.Compare(json.RawMessage(body), cached)
+		if err != nil {
+			v.readErrs.Inc()
+			v.logger.Printf("cache shadow: order %s (tenant %s): compare serialized JSON: %v", orderID, tenantID, err)
+			return
+		}
+		if len(diffs) > 0 {
+			v.checks.Inc()
+			v.mismatches.Inc()
+			v.logger.Printf("cache shadow: order %s (tenant %s): serialized JSON differs from the cached order: %s", orderID, tenantID, diffPaths(diffs))
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shadowVerifyTimeout)
+	defer cancel()
+	stored, err := v.repo.GetOrderByUID(withPrimaryRead(ctx), tenantID, orderID)
+	switch {
+	case errors.Is(err, postgres.ErrOrderNotFound):
+		v.checks.Inc()
+		v.mismatches.Inc()
+		v.logger.Printf("cache shadow: order %s (tenant %s) is cached but not found in the database", orderID, tenantID)
+		return
+	case err != nil:
+		v.readErrs.Inc()
+		v.logger.Printf("cache shadow: order %s (tenant %s): db error: %v", orderID, tenantID, err)
+		return
+	}
+	diffs, err := diff.Compare(utcTimes(cached), utcTimes(stored))
+	if err == nil && len(diffs) > 0 {
+		// Заказ мог измениться во время чтения: консьюмер пишет в базу, а затем в кэш. Расхождение учитывается,
+		// только если и текущий заказ в кэше отличается от прочитанного из базы
+		if fresh, ok := v.cache.Get(tenantID, orderID); ok {
+			diffs, err = diff.Compare(utcTimes(fresh), utcTimes(stored))
+		}
+	}
+	if err != nil {
+		v.readErrs.Inc()
+		v.logger.Printf("cache shadow: order %s (tenant %s): compare: %v", orderID, tenantID, err)
+		return
+	}
+	v.checks.Inc()
+	if len(diffs) > 0 {
+		v.mismatches.Inc()
+		v.logger.Printf("cache shadow: order %s (tenant %s) differs from the database: %s", orderID, tenantID, diffPaths(diffs))
+	}
+}
+
+// diffPaths - первые shadowLoggedPaths путей различий для лога и общее их число
+func diffPaths(diffs []diff.Difference) string {
+	paths := make([]string, 0, shadowLoggedPaths)
+	for _, d := range diffs {
+		if len(paths) == shadowLoggedPaths {
+			paths = append(paths, "...")
+			break
+		}
+		paths = append(paths, string(d.Kind)+" "+d.Path)
+	}
+	return fmt.Sprintf("%s (%d differences)", strings.Join(paths, ", "), len(diffs))
+}
+
+// shadowStats - состояние теневой проверки в ответе /admin/cache/stats
+type shadowStats struct {
+	Rate       float64 `json:"rate"`
+	Checks     uint64  `json:"checks"`
+	Mismatches uint64  `json:"mismatches"`
+	Errors     uint64  `json:"errors"`
+	Dropped    uint64  `json:"dropped"`
+}
+
+// stats - текущие значения счётчиков; nil, если проверка выключена
+func (v *shadowVerifier) stats() *shadowStats {
+	if v == nil {
+		return nil
+	}
+	return &shadowStats{
+		Rate:       v.rate,
+		Checks:     v.checks.Value(),
+		Mismatches: v.mismatches.Value(),
+		Errors:     v.readErrs.Value(),
+		Dropped:    v.dropped.Value(),
+	}
+}
@@ -0,0 +1,104 @@
+// Описание: Тесты теневой проверки кэша: обнаружение расхождения с базой данных без влияния на ответ,
+// проверка сериализованного JSON, пропуск проверок при занятых слотах чтения и счётчики в /admin/cache/stats
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestShadow - теневая проверка каждого попадания в кэш
+func newTestShadow(c OrderCache, repo OrderRepository, concurrency int) *shadowVerifier {
+	return newShadowVerifier(config.CacheConfig{ShadowVerifyRate: 1, ShadowVerifyConcurrency: concurrency}, c, repo, newTestLogger())
+}
+
+func TestShadowVerifyDetectsMismatch(t *testing.T) {
+	c := newTestCache(t)
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-1", TrackNumber: "CACHE"})
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-2", TrackNumber: "SAME"})
+	repo := &fakeRepository{orders: map[string]orders.Order{
+		"order-1": {OrderUid: "order-1", TrackNumber: "DB"},
+		"order-2": {OrderUid: "order-2", TrackNumber: "SAME"},
+	}}
+	shadow := newTestShadow(c, repo, 0)
+	h := withDefaultTenant(makeOrderHandler(c, repo, piiPolicy{}, shadow, newTestLogger()))
+
+	rec := getOrder(t, h, "order-1")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var got orders.Order
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, "CACHE", got.TrackNumber, "the cached value is served despite the mismatch")
+	require.Eventually(t, func() bool { return shadow.checks.Value() == 1 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, uint64(1), shadow.mismatches.Value())
+
+	require.Equal(t, http.StatusOK, getOrder(t, h, "order-2").Code)
+	require.Eventually(t, func() bool { return shadow.checks.Value() == 2 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, uint64(1), shadow.mismatches.Value(), "equal orders are not a mismatch")
+
+	// Заказ, которого нет в базе данных, тоже расходится с кэшем
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-3"})
+	require.Equal(t, http.StatusOK, getOrder(t, h, "order-3").Code)
+	require.Eventually(t, func() bool { return shadow.checks.Value() == 3 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, uint64(2), shadow.mismatches.Value())
+
+	repo.uidErrs = map[string]error{"order-2": errors.New("connection refused")}
+	require.Equal(t, http.StatusOK, getOrder(t, h, "order-2").Code)
+	require.Eventually(t, func() bool { return shadow.readErrs.Value() == 1 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, uint64(3), shadow.checks.Value())
+
+	stats := httptest.NewRecorder()
+	makeCacheStatsHandler(c, shadow, newTestLogger()).ServeHTTP(stats, httptest.NewRequest(http.MethodGet, "/admin/cache/stats", nil))
+	var resp cacheStatsResponse
+	require.NoError(t, json.Unmarshal(stats.Body.Bytes(), &resp))
+	assert.Equal(t, &shadowStats{Rate: 1, Checks: 3, Mismatches: 2, Errors: 1}, resp.Shadow)
+}
+
+func TestShadowVerifySerializedJSON(t *testing.T) {
+	c := newTestCache(t)
+	c.SetKeepJSON(true)
+	order := piiTestOrder()
+	c.Set(tenant.Default, order)
+	repo := &fakeRepository{orders: map[string]orders.Order{order.OrderUid: order}}
+	shadow := newTestShadow(c, repo, 0)
+	h := withDefaultTenant(makeOrderHandler(c, repo, piiPolicy{}, shadow, newTestLogger()))
+
+	require.Equal(t, http.StatusOK, getOrder(t, h, order.OrderUid).Code)
+	require.Eventually(t, func() bool { return shadow.checks.Value() == 1 }, 5*time.Second, time.Millisecond)
+	assert.Zero(t, shadow.mismatches.Value(), "JSON served from the cache matches the cached and stored order")
+	assert.Zero(t, shadow.readErrs.Value())
+}
+
+func TestShadowVerifyDropsWhenSlotsBusy(t *testing.T) {
+	c := newTestCache(t)
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-1"})
+	release := make(chan struct{})
+	repo := &fakeRepository{orders: map[string]orders.Order{"order-1": {OrderUid: "order-1"}}, onRead: func() { <-release }}
+	shadow := newTestShadow(c, repo, 1)
+	h := withDefaultTenant(makeOrderHandler(c, repo, piiPolicy{}, shadow, newTestLogger()))
+
+	// Первая проверка занимает единственный слот, пока чтение не отпущено; ответы при этом не ждут
+	require.Equal(t, http.StatusOK, getOrder(t, h, "order-1").Code)
+	require.Equal(t, http.StatusOK, getOrder(t, h, "order-1").Code)
+	assert.Equal(t, uint64(1), shadow.dropped.Value())
+	close(release)
+	require.Eventually(t, func() bool { return shadow.checks.Value() == 1 }, 5*time.Second, time.Millisecond)
+	assert.Zero(t, shadow.mismatches.Value())
+}
+
+func TestShadowVerifyDisabled(t *testing.T) {
+	assert.Nil(t, newShadowVerifier(config.CacheConfig{}, nil, nil, newTestLogger()))
+	var shadow *shadowVerifier
+	assert.False(t, shadow.sample())
+	assert.Nil(t, shadow.stats())
+}
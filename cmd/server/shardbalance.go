@@ -0,0 +1,87 @@
+// Описание: Мягкий предел неравномерности шардов кэша: периодически сравнивает число записей и обращений самого
+// загруженного шарда со средним и предупреждает в логе, если превышение больше cache.imbalance_factor
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/metrics"
+)
+
+// shardBalanceMinMean - наименьшее среднее число записей (или обращений) на шард, при котором распределение
+// проверяется: в почти пустом кэше несколько записей в одном шарде дают большое, но ничего не значащее превышение
+const shardBalanceMinMean = 8
+
+// shardBalanceMonitor - проверка распределения записей и обращений кэша по шардам. nil выключает проверку:
+// методы nil получателя ничего не делают
+type shardBalanceMonitor struct {
+	factor float64
+	cache  shardStatsCache
+	logger *log.Logger
+
+	imbalanced bool             // при прошлой проверке превышение было; предупреждение пишется при переходе
+	warnings   *metrics.Counter // переходы в состояние неравномерного распределения
+}
+
+// newShardBalanceMonitor - проверка по cfg.ImbalanceFactor; nil, если она выключена или кэш не сообщает статистику шардов
+func newShardBalanceMonitor(cfg config.CacheConfig, orderCache OrderCache, logger *log.Logger) *shardBalanceMonitor {
+	sc, ok := orderCache.(shardStatsCache)
+	if !ok || cfg.ImbalanceFactor <= 0 {
+		return nil
+	}
+	return &shardBalanceMonitor{factor: cfg.ImbalanceFactor, cache: sc, logger: logger, warnings: &metrics.Counter{}}
+}
+
+// register - регистрирует счётчик предупреждений и текущую неравномерность шардов в реестре метрик
+func (m *shardBalanceMonitor) register(reg *metrics.Registry) {
+	if m == nil {
+		return
+	}
+	reg.RegisterCounter("cache_shard_imbalance_warnings_total", "Times the busiest cache shard exceeded the mean by cache.imbalance_factor.", m.warnings)
+	reg.GaugeFunc("cache_shard_item_imbalance", "Entries in the fullest cache shard divided by the mean per shard.", func() float64 {
+		return m.cache.Stats().ItemImbalance
+	})
+	reg.GaugeFunc("cache_shard_access_imbalance", "Accesses of the hottest cache shard divided by the mean per shard.", func() float64 {
+		return m.cache.Stats().AccessImbalance
+	})
+}
+
+// run - проверяет распределение каждые interval до отмены контекста
+func (m *shardBalanceMonitor) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.check()
+		}
+	}
+}
+
+// check - сравнивает самый загруженный шард со средним и при переходе через порог пишет в лог предупреждение
+// или сообщение о восстановлении. Возвращает, превышен ли порог.
+func (m *shardBalanceMonitor) check() bool {
+	stats := m.cache.Stats()
+	shards := float64(len(stats.Shards))
+	items := float64(stats.Items) >= shardBalanceMinMean*shards && stats.ItemImbalance > m.factor
+	accesses := float64(stats.Accesses) >= shardBalanceMinMean*shards && stats.AccessImbalance > m.factor
+	imbalanced := items || accesses
+	switch {
+	case imbalanced && !m.imbalanced:
+		m.warnings.Inc()
+		m.logger.Printf("WARNING: cache shards are imbalanced (limit %.1fx the mean): shard %d holds %d of %d entries (%.1fx), "+
+			"shard %d served %d of %d accesses (%.1fx); order ids may share a structure the shard hash spreads poorly, "+
+			"see GET /admin/cache/stats?detail=shards",
+			m.factor, stats.FullestShard, stats.Shards[stats.FullestShard].Items, stats.Items, stats.ItemImbalance,
+			stats.HottestShard, stats.Shards[stats.HottestShard].Accesses, stats.Accesses, stats.AccessImbalance)
+	case !imbalanced && m.imbalanced:
+		m.logger.Printf("cache shards are balanced again: entries %.1fx, accesses %.1fx the mean", stats.ItemImbalance, stats.AccessImbalance)
+	}
+	m.imbalanced = imbalanced
+	return imbalanced
+}
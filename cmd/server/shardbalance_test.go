@@ -0,0 +1,110 @@
+// Описание: Тесты проверки распределения кэша по шардам: предупреждение при переходе через cache.imbalance_factor,
+// молчание на почти пустом кэше и разбивка по шардам в GET /admin/cache/stats?detail=shards
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"l0_test_self/internal/cache"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collidingOrderIDs - n идентификаторов заказов с общим префиксом, которые кэш c помещает в шард 0; подбираются
+// по статистике шардов, как это сделал бы неудачный формат идентификаторов
+func collidingOrderIDs(t *testing.T, c *cache.OrderCache, n int) []string {
+	t.Helper()
+	var ids []string
+	for i := 0; len(ids) < n; i++ {
+		id := fmt.Sprintf("b563feb7b2b84b6test%06d", i)
+		before := c.Stats().Shards[0].Items
+		c.Set(tenant.Default, orders.Order{OrderUid: id})
+		if c.Stats().Shards[0].Items > before {
+			ids = append(ids, id)
+		}
+		c.Delete(tenant.Default, id)
+	}
+	return ids
+}
+
+func TestShardBalanceMonitorWarnsOnTransitions(t *testing.T) {
+	assert.Nil(t, newShardBalanceMonitor(config.CacheConfig{}, newTestCache(t), newTestLogger()), "disabled without imbalance_factor")
+
+	c := newTestCache(t)
+	var logs bytes.Buffer
+	m := newShardBalanceMonitor(config.CacheConfig{ImbalanceFactor: 2}, c, log.New(&logs, "", 0))
+	require.NotNil(t, m)
+	ids := collidingOrderIDs(t, c, 40)
+
+	// Несколько записей в одном шарде почти пустого кэша — не повод для предупреждения
+	for _, id := range ids[:8] {
+		c.Set(tenant.Default, orders.Order{OrderUid: id})
+	}
+	assert.False(t, m.check())
+	assert.Empty(t, logs.String())
+
+	for _, id := range ids[8:] {
+		c.Set(tenant.Default, orders.Order{OrderUid: id})
+	}
+	assert.True(t, m.check())
+	assert.Contains(t, logs.String(), "WARNING: cache shards are imbalanced (limit 2.0x the mean): shard 0 holds 40 of 40 entries (4.0x)")
+	assert.True(t, m.check())
+	assert.Equal(t, uint64(1), m.warnings.Value(), "the warning is logged once per transition")
+
+	// Resize перераспределяет записи и начинает счёт обращений заново
+	logs.Reset()
+	require.NoError(t, c.Resize(64))
+	for i := 0; i < 600; i++ {
+		c.Set(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("order-%d", i)})
+	}
+	assert.False(t, m.check())
+	assert.Contains(t, logs.String(), "cache shards are balanced again")
+	assert.Equal(t, uint64(1), m.warnings.Value())
+}
+
+func TestCacheStatsShardDetail(t *testing.T) {
+	c := newTestCache(t)
+	ids := collidingOrderIDs(t, c, 10)
+	for _, id := range ids {
+		c.Set(tenant.Default, orders.Order{OrderUid: id})
+		c.Get(tenant.Default, id)
+	}
+	mux := newAdminMux(&fakeRepository{}, c)
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-API-Key", testAdminKey)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var resp cacheStatsResponse
+	rec := get("/admin/cache/stats")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.NotNil(t, resp.Balance)
+	assert.Equal(t, 4.0, resp.Balance.ItemImbalance)
+	assert.Zero(t, resp.Balance.FullestShard)
+	assert.Nil(t, resp.Balance.Shards, "the per-shard breakdown is only returned with detail=shards")
+
+	rec = get("/admin/cache/stats?detail=shards")
+	require.Equal(t, http.StatusOK, rec.Code)
+	resp = cacheStatsResponse{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Balance.Shards, 4)
+	assert.Equal(t, cache.ShardStats{Shard: 0, Items: 10, Accesses: resp.Balance.Shards[0].Accesses}, resp.Balance.Shards[0])
+	assert.GreaterOrEqual(t, resp.Balance.Shards[0].Accesses, uint64(20))
+	assert.Zero(t, resp.Balance.Shards[1].Items)
+
+	assert.Equal(t, http.StatusBadRequest, get("/admin/cache/stats?detail=tenants").Code)
+}
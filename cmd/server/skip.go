@@ -0,0 +1,344 @@
+// Описание: Пропуск застрявшего сообщения по указанию администратора (POST /admin/consumer/skip): консьюмер,
+// прочитав указанное сообщение, не обрабатывает его, а дописывает в файл пропущенных сообщений и коммитит смещение
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/pkg/client/postgres"
+	"l0_test_self/pkg/kafkautil"
+
+	kafka2 "github.com/segmentio/kafka-go"
+)
+
+// defaultSkipSpillFile - файл пропущенных сообщений, если kafka.consumer.skip_spill_file не задан
+const defaultSkipSpillFile = "skipped_messages.ndjson"
+
+// errSkipPast - указание относится к сообщению, смещение которого уже закоммичено или которое уже пропущено
+var errSkipPast = errors.New("offset already committed")
+
+// topicPartition - партиция топика Kafka
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// skipEntry - указание пропустить сообщение; applied - сообщение уже сохранено в файл, но смещение ещё не закоммичено
+type skipEntry struct {
+	skip    postgres.MessageSkip
+	applied bool
+}
+
+// skipList - указания пропустить сообщения и последние закоммиченные смещения партиций, общие для консьюмера
+// и HTTP обработчика. Указания сохраняются в таблице message_skips и загружаются при запуске консьюмера.
+type skipList struct {
+	mu        sync.Mutex
+	entries   map[postgres.MessageKey]*skipEntry
+	committed map[topicPartition]int64 // смещение последнего закоммиченного сообщения партиции
+}
+
+// newSkipList - создает пустой список указаний
+func newSkipList() *skipList {
+	return &skipList{entries: make(map[postgres.MessageKey]*skipEntry), committed: make(map[topicPartition]int64)}
+}
+
+// add - добавляет указание или заменяет причину ещё не выполненного. Возвращает errSkipPast, если смещение сообщения
+// уже закоммичено этим процессом или сообщение уже пропущено.
+func (s *skipList) add(skip postgres.MessageSkip) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := skip.Key
+	if last, ok := s.committed[topicPartition{k.Topic, k.Partition}]; ok && k.Offset <= last {
+		return fmt.Errorf("%w: %s/%d is at offset %d", errSkipPast, k.Topic, k.Partition, last)
+	}
+	if e, ok := s.entries[k]; ok && e.applied {
+		return fmt.Errorf("%w: message %s/%d@%d is already skipped", errSkipPast, k.Topic, k.Partition, k.Offset)
+	}
+	s.entries[k] = &skipEntry{skip: skip}
+	return nil
+}
+
+// remove - удаляет невыполненное указание, например если его не удалось сохранить
+func (s *skipList) remove(key postgres.MessageKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && !e.applied {
+		delete(s.entries, key)
+	}
+}
+
+// load - добавляет указания, сохранённые предыдущими запусками
+func (s *skipList) load(list []postgres.MessageSkip) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, skip := range list {
+		if _, ok := s.entries[skip.Key]; !ok {
+			s.entries[skip.Key] = &skipEntry{skip: skip}
+		}
+	}
+}
+
+// pending - невыполненное указание пропустить сообщение key
+func (s *skipList) pending(key postgres.MessageKey) (postgres.MessageSkip, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || e.applied {
+		return postgres.MessageSkip{}, false
+	}
+	return e.skip, true
+}
+
+// apply - отмечает указание выполненным: сообщение сохранено в файл и больше не пропускается повторно
+func (s *skipList) apply(key postgres.MessageKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.applied = true
+	}
+}
+
+// commit - запоминает закоммиченные смещения msgs и убирает указания, ставшие ненужными: выполненные
+// и устаревшие (сообщение закоммичено без пропуска). Возвращает убранные указания, устаревшие — отдельно.
+func (s *skipList) commit(msgs []kafka2.Message) (applied, stale []postgres.MessageSkip) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, msg := range msgs {
+		tp := topicPartition{msg.Topic, msg.Partition}
+		if last, ok := s.committed[tp]; !ok || msg.Offset > last {
+			s.committed[tp] = msg.Offset
+		}
+	}
+	for key, e := range s.entries {
+		last, ok := s.committed[topicPartition{key.Topic, key.Partition}]
+		if !ok || key.Offset > last {
+			continue
+		}
+		delete(s.entries, key)
+		if e.applied {
+			applied = append(applied, e.skip)
+		} else {
+			stale = append(stale, e.skip)
+		}
+	}
+	return applied, stale
+}
+
+// spilledHeader - заголовок пропущенного сообщения в файле
+type spilledHeader struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// spilledMessage - строка файла пропущенных сообщений; ключ, тело и значения заголовков — в base64
+type spilledMessage struct {
+	SkippedAt time.Time       `json:"skipped_at"`
+	Reason    string          `json:"reason,omitempty"`
+	Topic     string          `json:"topic"`
+	Partition int             `json:"partition"`
+	Offset    int64           `json:"offset"`
+	Time      time.Time       `json:"time"`
+	Key       []byte          `json:"key,omitempty"`
+	Value     []byte          `json:"value"`
+	Headers   []spilledHeader `json:"headers,omitempty"`
+}
+
+// spillMessage - дописывает сообщение msg строкой JSON в конец файла path и сбрасывает файл на диск
+func spillMessage(path string, msg kafka2.Message, reason string) (err error) {
+	rec := spilledMessage{
+		SkippedAt: time.Now().UTC(),
+		Reason:    reason,
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Time:      msg.Time,
+		Key:       msg.Key,
+		Value:     msg.Value,
+	}
+	for _, h := range msg.Headers {
+		rec.Headers = append(rec.Headers, spilledHeader{Key: h.Key, Value: h.Value})
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// loadSkips - загружает указания пропустить сообщения, сохранённые предыдущими запусками.
+// Ошибка только логируется: консьюмер работает и без них, а новые указания принимает HTTP обработчик.
+func (c *consumer) loadSkips(ctx context.Context) {
+	opCtx, cancel := opContext(ctx)
+	defer cancel()
+	list, err := c.repo.ListMessageSkips(opCtx)
+	if err != nil {
+		c.logger.Printf("message skip instructions not loaded: %v", err)
+		return
+	}
+	c.skips.load(list)
+	if len(list) > 0 {
+		c.logger.Printf("message skip instructions loaded: %d", len(list))
+	}
+}
+
+// skipMessage - если для сообщения msg есть указание пропустить его, дописывает сообщение в файл пропущенных
+// сообщений и возвращает true: его смещение нужно закоммитить без обработки. Если сообщение не удалось сохранить
+// в файл, оно не пропускается.
+func (c *consumer) skipMessage(ctx context.Context, msg kafka2.Message) bool {
+	key := messageKey(msg)
+	skip, ok := c.skips.pending(key)
+	if !ok {
+		return false
+	}
+	ref := kafkautil.MessageRef(msg)
+	if err := spillMessage(c.spillPath, msg, skip.Reason); err != nil {
+		c.fail(stageSkip, "spill", &msg, "", "message NOT skipped, spill file %s write error (%s): %v", c.spillPath, ref, err)
+		return false
+	}
+	c.skips.apply(key)
+	c.skipped.Inc()
+
+	opCtx, cancel := opContext(ctx)
+	defer cancel()
+	c.clearAttempts(opCtx, []kafka2.Message{msg})
+	c.fail(stageSkip, "skip", &msg, "", "MESSAGE SKIPPED by operator instruction without processing, saved to %s (%s, reason=%q)", c.spillPath, ref, skip.Reason)
+	return true
+}
+
+// skipBatch - пропускает сообщения пачки, для которых есть указание: их заказы удаляются из кэша и окна недавних
+// заказов, как у отправленных в очередь недоставленных, а смещения коммитятся вместе с пачкой
+func (c *consumer) skipBatch(ctx context.Context, batch []pendingMessage) {
+	for i := range batch {
+		p := &batch[i]
+		if !p.ok || !c.skipMessage(ctx, p.msg) {
+			continue
+		}
+		c.cache.Delete(p.tenant, p.order.OrderUid)
+		c.recent.Forget(tenant.Key(p.tenant, p.order.OrderUid))
+		p.ok = false
+	}
+}
+
+// committed - учитывает закоммиченные смещения msgs: удаляет из базы данных выполненные указания и устаревшие,
+// сообщения которых закоммичены без пропуска
+func (c *consumer) committed(ctx context.Context, msgs []kafka2.Message) {
+	applied, stale := c.skips.commit(msgs)
+	if len(applied) == 0 && len(stale) == 0 {
+		return
+	}
+	opCtx, cancel := opContext(ctx)
+	defer cancel()
+	for _, skip := range stale {
+		k := skip.Key
+		c.logger.Printf("message skip instruction dropped: %s/%d@%d was committed without skipping", k.Topic, k.Partition, k.Offset)
+	}
+	for _, skip := range slices.Concat(applied, stale) {
+		if err := c.repo.DeleteMessageSkip(opCtx, skip.Key); err != nil {
+			c.fail(stageSkip, "skip_record", nil, "", "message skip instruction not deleted: %v", err)
+		}
+	}
+}
+
+// skipRequest - тело запроса POST /admin/consumer/skip
+type skipRequest struct {
+	Topic     string `json:"topic"`
+	Partition *int   `json:"partition"`
+	Offset    *int64 `json:"offset"`
+	Reason    string `json:"reason"`
+}
+
+// skipResponse - ответ POST /admin/consumer/skip
+type skipResponse struct {
+	Topic     string    `json:"topic"`
+	Partition int       `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// consumedTopics - топики заказов, которые читает консьюмер: топики арендаторов или kafka.topic
+func consumedTopics(cfg *config.Config) []string {
+	if len(cfg.Tenants) == 0 {
+		return []string{cfg.Kafka.Topic}
+	}
+	topics := make([]string, 0, len(cfg.Tenants))
+	for _, t := range cfg.Tenants {
+		topics = append(topics, t.Topic)
+	}
+	return topics
+}
+
+// makeConsumerSkipHandler - HTTP обработчик, сохраняющий указание пропустить сообщение {topic, partition, offset}.
+// Указание выполняется, когда консьюмер прочитает это сообщение, в том числе если оно уже застряло в повторах записи.
+// Указание для смещения, которое уже закоммичено, отклоняется с кодом 409.
+func makeConsumerSkipHandler(repo OrderRepository, skips *skipList, topics []string, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		var req skipRequest
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeRequestBodyInvalid, err)
+			return
+		}
+		if !slices.Contains(topics, req.Topic) {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeTopicUnknown, req.Topic, strings.Join(topics, ", "))
+			return
+		}
+		if req.Partition == nil || *req.Partition < 0 || req.Offset == nil || *req.Offset < 0 {
+			writeAPIError(w, r, http.StatusBadRequest, errCodeOffsetInvalid)
+			return
+		}
+
+		skip := postgres.MessageSkip{
+			Key:       postgres.MessageKey{Topic: req.Topic, Partition: *req.Partition, Offset: *req.Offset},
+			Reason:    req.Reason,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := skips.add(skip); err != nil {
+			writeAPIError(w, r, http.StatusConflict, errCodeMessageAlreadyProcessed, err)
+			return
+		}
+		if err := repo.AddMessageSkip(r.Context(), skip); err != nil {
+			skips.remove(skip.Key)
+			logger.Printf("[%s] consumer skip: db error: %v", reqID, err)
+			if !writeUnavailable(w, r, err) {
+				writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+			}
+			return
+		}
+		logger.Printf("[%s] consumer skip: message %s/%d@%d will be skipped (reason=%q)", reqID, req.Topic, *req.Partition, *req.Offset, req.Reason)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		resp := skipResponse{Topic: req.Topic, Partition: *req.Partition, Offset: *req.Offset, Reason: req.Reason, CreatedAt: skip.CreatedAt}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+		}
+	}
+}
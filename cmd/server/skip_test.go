@@ -0,0 +1,187 @@
+// Описание: Тесты пропуска застрявшего сообщения по указанию администратора: файл пропущенных сообщений,
+// коммит смещения, однократное выполнение указания и его сохранение между запусками
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/pkg/client/postgres"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postSkip - отправляет указание пропустить сообщение и возвращает код ответа
+func postSkip(t *testing.T, h http.Handler, body string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/admin/consumer/skip", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// readSpill - строки файла пропущенных сообщений
+func readSpill(t *testing.T, path string) []spilledMessage {
+	t.Helper()
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	require.NoError(t, err)
+	defer f.Close()
+	var out []spilledMessage
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec spilledMessage
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &rec))
+		out = append(out, rec)
+	}
+	require.NoError(t, sc.Err())
+	return out
+}
+
+func TestConsumerSkipUnblocksStuckMessage(t *testing.T) {
+	for _, mode := range []string{config.PipelineModeSync, config.PipelineModeBatched} {
+		t.Run(mode, func(t *testing.T) {
+			msgs, uids := newOrderMessages(t, 31, 3)
+			// Первое сообщение не записывается, а очередь недоставленных недоступна: без указания оно повторяется бесконечно
+			repo := &fakeRepository{poisonUIDs: map[string]bool{uids[0]: true}}
+			reader := &sliceReader{msgs: msgs}
+			dlq := &fakeWriter{err: errors.New("broker unavailable")}
+			cfg := withMaxAttempts(newBatchedTestConfig(3, 10*time.Millisecond), 2)
+			cfg.Pipeline.Mode = mode
+			cfg.Kafka.Topic = "orders"
+			cfg.Kafka.Reader.ReadBatchTimeout = time.Millisecond
+			cfg.Kafka.Consumer.ErrorBufferSize = 16
+			cfg.Kafka.Consumer.SkipSpillFile = filepath.Join(t.TempDir(), "skipped.ndjson")
+			monitor := newConsumerMonitor(cfg)
+			orderCache := newTestCache(t)
+			skip := makeConsumerSkipHandler(repo, monitor.skips, consumedTopics(cfg), newTestLogger())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			wg := startKafkaConsumer(ctx, reader, dlq, repo, orderCache, newTestLogger(), cfg, monitor)
+
+			require.Eventually(t, func() bool {
+				repo.mu.Lock()
+				defer repo.mu.Unlock()
+				return repo.attempts[postgres.MessageKey{Topic: "orders", Offset: 0}] >= 3
+			}, 5*time.Second, time.Millisecond)
+			assert.Empty(t, reader.committedOffsets(), "stuck message blocks the partition")
+
+			require.Equal(t, http.StatusAccepted, postSkip(t, skip, `{"topic":"orders","partition":0,"offset":0,"reason":"bad data"}`))
+			require.Eventually(t, func() bool {
+				return len(reader.committedOffsets()) == 3
+			}, 5*time.Second, time.Millisecond)
+			// Указание удаляется после коммита пропущенного сообщения
+			require.Eventually(t, func() bool {
+				return len(repo.pendingSkips()) == 0
+			}, 5*time.Second, time.Millisecond)
+			cancel()
+			wg.Wait()
+
+			assert.Equal(t, []int64{0, 1, 2}, reader.committedOffsets(), "every offset is committed once")
+			spilled := readSpill(t, cfg.Kafka.Consumer.SkipSpillFile)
+			require.Len(t, spilled, 1)
+			assert.Equal(t, int64(0), spilled[0].Offset)
+			assert.Equal(t, "bad data", spilled[0].Reason)
+			assert.Equal(t, msgs[0].Value, spilled[0].Value)
+			assert.Equal(t, uint64(1), monitor.skipped.Value())
+			assert.Empty(t, dlq.written())
+
+			stored := repo.ordersOf(tenant.Default)
+			assert.Len(t, stored, 2)
+			assert.NotContains(t, stored, uids[0])
+			_, cached := orderCache.Get(tenant.Default, uids[0])
+			assert.False(t, cached, "skipped order is not served")
+			require.Len(t, monitor.errors.Entries(stageSkip), 1)
+
+			// Сообщение уже пропущено и закоммичено: повторное указание отклоняется
+			assert.Equal(t, http.StatusConflict, postSkip(t, skip, `{"topic":"orders","partition":0,"offset":0}`))
+			assert.Equal(t, http.StatusConflict, postSkip(t, skip, `{"topic":"orders","partition":0,"offset":1}`))
+		})
+	}
+}
+
+func TestConsumerSkipInstructionSurvivesRestart(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 32, 2)
+	repo := &fakeRepository{}
+	key := postgres.MessageKey{Topic: "orders", Partition: 0, Offset: 0}
+	require.NoError(t, repo.AddMessageSkip(context.Background(), postgres.MessageSkip{Key: key, Reason: "saved", CreatedAt: time.Now()}))
+	reader := &sliceReader{msgs: msgs}
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.Consumer.SkipSpillFile = filepath.Join(t.TempDir(), "skipped.ndjson")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), cfg, nil)
+	require.Eventually(t, func() bool {
+		return len(reader.committedOffsets()) == 2
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	stored := repo.ordersOf(tenant.Default)
+	assert.NotContains(t, stored, uids[0], "message is skipped when fetched, before processing")
+	assert.Contains(t, stored, uids[1])
+	spilled := readSpill(t, cfg.Kafka.Consumer.SkipSpillFile)
+	require.Len(t, spilled, 1)
+	assert.Equal(t, "saved", spilled[0].Reason)
+	assert.Empty(t, repo.pendingSkips())
+}
+
+func TestConsumerSkipNotAppliedWithoutSpillFile(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 33, 1)
+	repo := &fakeRepository{}
+	key := postgres.MessageKey{Topic: "orders", Partition: 0, Offset: 0}
+	require.NoError(t, repo.AddMessageSkip(context.Background(), postgres.MessageSkip{Key: key, CreatedAt: time.Now()}))
+	reader := &sliceReader{msgs: msgs}
+	cfg := newConsumerTestConfig()
+	cfg.Kafka.Consumer.SkipSpillFile = filepath.Join(t.TempDir(), "missing", "skipped.ndjson")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), cfg, nil)
+	require.Eventually(t, func() bool {
+		return len(reader.committedOffsets()) == 1
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	// Сообщение, которое не удалось сохранить в файл, обрабатывается как обычно, а указание становится ненужным
+	assert.Contains(t, repo.ordersOf(tenant.Default), uids[0])
+	assert.Empty(t, repo.pendingSkips())
+}
+
+func TestConsumerSkipHandlerValidation(t *testing.T) {
+	repo := &fakeRepository{}
+	skips := newSkipList()
+	h := makeConsumerSkipHandler(repo, skips, []string{"orders"}, newTestLogger())
+
+	for _, body := range []string{
+		`not json`,
+		`{"topic":"other","partition":0,"offset":1}`,
+		`{"topic":"orders","offset":1}`,
+		`{"topic":"orders","partition":-1,"offset":1}`,
+		`{"topic":"orders","partition":0,"offset":-1}`,
+		`{"topic":"orders","partition":0,"offset":1,"extra":true}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, postSkip(t, h, body), body)
+	}
+	assert.Empty(t, repo.pendingSkips())
+
+	repo.err = errors.New("connection refused")
+	assert.Equal(t, http.StatusInternalServerError, postSkip(t, h, `{"topic":"orders","partition":0,"offset":1}`))
+	_, ok := skips.pending(postgres.MessageKey{Topic: "orders", Offset: 1})
+	assert.False(t, ok, "instruction that was not saved is forgotten")
+}
@@ -0,0 +1,70 @@
+// Описание: Источник поступления заказа: консьюмер, POST /orders, повтор топика и повтор очереди недоставленных сообщений
+// записывают в заказ путь, которым он пришёл (kafka, http, replay, dlq_replay), и подробности (сообщение
+// topic/partition/offset или идентификатор запроса). Источник сохраняется вместе с заказом и выводится только
+// административными эндпоинтами; по нему можно отобрать заказы выгрузки и поиска GET /orders (параметр source)
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"l0_test_self/models/orders"
+
+	kafka2 "github.com/segmentio/kafka-go"
+)
+
+// sourceParam - параметр запроса с источником заказов для отбора
+const sourceParam = "source"
+
+// orderSources - значения параметра source
+var orderSources = []string{orders.SourceKafka, orders.SourceHTTP, orders.SourceReplay, orders.SourceDLQReplay, orders.SourceUnknown}
+
+// parseSourceParam - проверяет значение параметра source; пустое значение означает заказы любого источника
+func parseSourceParam(raw string) (string, error) {
+	if raw == "" || slices.Contains(orderSources, raw) {
+		return raw, nil
+	}
+	return "", fmt.Errorf("source must be one of %s", strings.Join(orderSources, ", "))
+}
+
+// messageSourceDetail - подробности источника заказа из сообщения Kafka: topic/partition/offset
+func messageSourceDetail(msg kafka2.Message) string {
+	return fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset)
+}
+
+// storedSource - источник заказа так, как его сохраняет хранилище: без источника — orders.SourceUnknown
+func storedSource(o orders.Order) string {
+	if o.Source == "" {
+		return orders.SourceUnknown
+	}
+	return o.Source
+}
+
+// adminOrder - заказ в ответах административных эндпоинтов: JSON заказа с полями source и source_detail
+type adminOrder struct {
+	orders.Order
+}
+
+// orderSourceJSON - поля источника заказа в ответах административных эндпоинтов
+type orderSourceJSON struct {
+	Source       string `json:"source"`
+	SourceDetail string `json:"source_detail"`
+}
+
+func (o adminOrder) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(o.Order)
+	if err != nil {
+		return nil, err
+	}
+	source, err := json.Marshal(orderSourceJSON{Source: storedSource(o.Order), SourceDetail: o.SourceDetail})
+	if err != nil {
+		return nil, err
+	}
+	// Заказ кодируется объектом JSON: поля источника дописываются перед закрывающей скобкой
+	out := make([]byte, 0, len(data)+len(source))
+	out = append(out, data[:len(data)-1]...)
+	out = append(out, ',')
+	return append(out, source[1:]...), nil
+}
@@ -0,0 +1,212 @@
+// Описание: Тесты источника поступления заказа: отметка источника консьюмером, POST /orders и повтором топика,
+// поля источника в административных ответах и их отсутствие в публичном GET /order, отбор выгрузки и поиска GET /orders
+// по source
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// storedOrders - копия заказов репозитория
+func storedOrders(repo *fakeRepository) map[string]orders.Order {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	out := make(map[string]orders.Order, len(repo.orders))
+	for uid, o := range repo.orders {
+		out[uid] = o
+	}
+	return out
+}
+
+func TestConsumerStampsKafkaSource(t *testing.T) {
+	msgs, uids := newOrderMessages(t, 70, 3)
+	repo := &fakeRepository{}
+	reader := &sliceReader{msgs: msgs}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), newConsumerTestConfig(), nil)
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) == len(msgs) }, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	stored := storedOrders(repo)
+	for offset, uid := range uids {
+		require.Contains(t, stored, uid)
+		assert.Equal(t, orders.SourceKafka, stored[uid].Source)
+		assert.Equal(t, messageSourceDetail(msgs[offset]), stored[uid].SourceDetail)
+	}
+	assert.Equal(t, "orders/0/2", messageSourceDetail(msgs[2]))
+}
+
+func TestReplayStampsReplaySource(t *testing.T) {
+	for _, source := range []string{orders.SourceReplay, orders.SourceDLQReplay} {
+		msgs, uids := newOrderMessages(t, 71, 4)
+		repo := &fakeRepository{}
+		err := runReplay(context.Background(), "nightly", []replayRange{{Partition: 0, From: 0, Until: 4}},
+			sliceOpener(msgs), nil, repo, newTestLogger(), newReplayTestConfig(10), source)
+		require.NoError(t, err)
+
+		stored := storedOrders(repo)
+		for offset, uid := range uids {
+			require.Contains(t, stored, uid)
+			assert.Equal(t, source, stored[uid].Source)
+			assert.Equal(t, messageSourceDetail(msgs[offset]), stored[uid].SourceDetail)
+		}
+	}
+}
+
+func TestOrderCreateStampsHTTPSource(t *testing.T) {
+	repo := &fakeRepository{}
+	h := withRequestID(withDefaultTenant(makeOrderCreateHandler(repo, newTestCache(t), config.IdempotencyConfig{}, clock.Real, newTestLogger())))
+	gen := testorders.NewGenerator(72)
+	body := mustOrderJSON(t, gen)
+	var order orders.Order
+	require.NoError(t, json.Unmarshal(body, &order))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(string(body)))
+	req.Header.Set(requestIDHeader, "req-source-1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	stored := storedOrders(repo)[order.OrderUid]
+	assert.Equal(t, orders.SourceHTTP, stored.Source)
+	assert.Equal(t, "req-source-1", stored.SourceDetail)
+	assert.NotContains(t, rec.Body.String(), `"source"`, "the create response is public")
+}
+
+func TestOrderSourceVisibility(t *testing.T) {
+	order := testorders.NewGenerator(73).Order(testorders.ScenarioDefault)
+	order.Source, order.SourceDetail = orders.SourceKafka, "orders/1/42"
+	repo := &fakeRepository{orders: map[string]orders.Order{order.OrderUid: order}}
+	c := newTestCache(t)
+
+	public := getAccept(withDefaultTenant(makeOrderHandler(c, repo, piiPolicy{}, nil, newTestLogger())), "/order?id="+order.OrderUid, "")
+	require.Equal(t, http.StatusOK, public.Code, public.Body.String())
+	assert.NotContains(t, public.Body.String(), `"source`)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/orders/"+order.OrderUid+"/refresh", nil)
+	req.Header.Set("X-API-Key", testAdminKey)
+	rec := httptest.NewRecorder()
+	newAdminMux(repo, c).ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, orders.SourceKafka, got["source"])
+	assert.Equal(t, "orders/1/42", got["source_detail"])
+	assert.Equal(t, order.OrderUid, got["order_uid"])
+}
+
+func TestAdminOrderJSONWithoutSource(t *testing.T) {
+	data, err := json.Marshal(adminOrder{orders.Order{OrderUid: "order-1"}})
+	require.NoError(t, err)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, orders.SourceUnknown, got["source"])
+	assert.Equal(t, "", got["source_detail"])
+
+	// Ключи источника во входящем JSON не попадают ни в заказ, ни в Extras
+	var decoded orders.Order
+	require.NoError(t, json.Unmarshal([]byte(`{"order_uid":"order-2","source":"http","source_detail":"x"}`), &decoded))
+	assert.Empty(t, decoded.Source)
+	assert.Empty(t, decoded.SourceDetail)
+	assert.Empty(t, decoded.Extras)
+}
+
+func TestExportFiltersBySource(t *testing.T) {
+	repo := seedExportRepository(6)
+	for uid, o := range repo.orders {
+		switch uid {
+		case "order-001", "order-004":
+			o.Source = orders.SourceHTTP
+		case "order-002":
+			o.Source = orders.SourceReplay
+		case "order-003":
+			o.Source = orders.SourceDLQReplay
+		}
+		repo.orders[uid] = o
+	}
+	handler := withDefaultTenant(makeOrderExportHandler(repo, config.ExportConfig{PageSize: 2, MaxRange: 48 * time.Hour}, newTestLogger()))
+	export := func(source string) []map[string]any {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, exportRequest("format=ndjson&from=2024-01-01&to=2024-01-02&source="+source))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var out []map[string]any
+		sc := bufio.NewScanner(rec.Body)
+		for sc.Scan() {
+			var row map[string]any
+			require.NoError(t, json.Unmarshal(sc.Bytes(), &row))
+			out = append(out, row)
+		}
+		return out
+	}
+
+	rows := export(orders.SourceHTTP)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "order-001", rows[0]["order_uid"])
+	assert.Equal(t, "order-004", rows[1]["order_uid"])
+	assert.Equal(t, orders.SourceHTTP, rows[0]["source"])
+	assert.Len(t, export(orders.SourceDLQReplay), 1)
+	assert.Len(t, export(orders.SourceUnknown), 2, "orders without a source are exported as unknown")
+	assert.Len(t, export(""), 6)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, exportRequest("format=ndjson&from=2024-01-01&to=2024-01-02&source=ftp"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestOrderSearchFiltersBySource(t *testing.T) {
+	repo := &fakeRepository{orders: map[string]orders.Order{}}
+	for i, source := range []string{orders.SourceKafka, orders.SourceDLQReplay, "", orders.SourceDLQReplay, orders.SourceHTTP, orders.SourceDLQReplay} {
+		uid := fmt.Sprintf("order-%d", i)
+		repo.orders[uid] = orders.Order{OrderUid: uid, TrackNumber: "TRACK-1", Source: source}
+	}
+	h := newCustomerOrdersMux(repo, newTestCursorSigner(t))
+	search := func(query string) []string {
+		var uids []string
+		page := customerPage(t, h, "/orders?track_number=TRACK-1&limit=2"+query)
+		for {
+			for _, o := range page.Orders {
+				uids = append(uids, o.OrderUid)
+			}
+			if page.NextCursor == "" {
+				return uids
+			}
+			page = customerPage(t, h, "/orders?track_number=TRACK-1&limit=2"+query+"&cursor="+url.QueryEscape(page.NextCursor))
+		}
+	}
+
+	assert.Equal(t, []string{"order-1", "order-3", "order-5"}, search("&source="+orders.SourceDLQReplay))
+	assert.Equal(t, []string{"order-2"}, search("&source="+orders.SourceUnknown), "orders without a source match unknown")
+	assert.Len(t, search(""), 6)
+
+	// Курсор отбора по источнику не применяется к поиску без отбора или с другим источником
+	cursor := customerPage(t, h, "/orders?track_number=TRACK-1&limit=1&source="+orders.SourceDLQReplay).NextCursor
+	require.NotEmpty(t, cursor)
+	for _, query := range []string{"", "&source=" + orders.SourceKafka} {
+		rec, resp := getAPIError(t, h, "/orders?track_number=TRACK-1&cursor="+url.QueryEscape(cursor)+query, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		assert.Equal(t, errCodeCursorMismatch, resp.Code, query)
+	}
+
+	rec, resp := getAPIError(t, h, "/orders?track_number=TRACK-1&source=ftp", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errCodeSourceInvalid, resp.Code)
+	assert.Contains(t, resp.Message, orders.SourceDLQReplay)
+}
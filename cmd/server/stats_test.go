@@ -0,0 +1,132 @@
+// Описание: Тесты статистики заказов в разрезе ключа группировки
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedBreakdownRepository() *fakeRepository {
+	day := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	usd := []orders.Payment{{Currency: "USD", Amount: 100}}
+	return &fakeRepository{orders: map[string]orders.Order{
+		"a": {OrderUid: "a", DeliveryService: "meest", Locale: "en", DateCreated: day, Items: []orders.Item{{Status: 202}, {Status: 202}}, Payments: usd},
+		"b": {OrderUid: "b", DeliveryService: "meest", Locale: "ru", DateCreated: day, Items: []orders.Item{{Status: 200}},
+			Payments: []orders.Payment{{Currency: "RUB", Amount: 5000}}},
+		"c": {OrderUid: "c", DeliveryService: "cdek", Locale: "ru", DateCreated: day, Items: []orders.Item{{Status: 200}, {Status: 202}},
+			Payments: []orders.Payment{{Currency: "USD", Amount: 30}, {Currency: "EUR", Amount: 20}}},
+		// вне интервала
+		"d": {OrderUid: "d", DeliveryService: "cdek", Locale: "en", DateCreated: day.AddDate(0, 1, 0), Items: []orders.Item{{Status: 200}}, Payments: usd},
+	}}
+}
+
+func getBreakdown(t *testing.T, query string) (*httptest.ResponseRecorder, breakdownResponse) {
+	t.Helper()
+	return getBreakdownWithRates(t, query, nil)
+}
+
+func getBreakdownWithRates(t *testing.T, query string, rates map[string]float64) (*httptest.ResponseRecorder, breakdownResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	withDefaultTenant(makeBreakdownHandler(seedBreakdownRepository(), rates, newTestLogger())).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/stats/breakdown?"+query, nil))
+
+	var resp breakdownResponse
+	if rec.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	}
+	return rec, resp
+}
+
+// totals - суммы платежей по валютам в виде "USD": 100
+func totals(amounts map[string]int64) []postgres.CurrencyTotal {
+	out := []postgres.CurrencyTotal{}
+	for c, a := range amounts {
+		out = append(out, postgres.CurrencyTotal{Currency: c, Amount: a})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Currency < out[j].Currency })
+	return out
+}
+
+func TestBreakdownGroups(t *testing.T) {
+	tests := []struct {
+		by   string
+		want []postgres.GroupCount
+	}{
+		{by: "delivery_service", want: []postgres.GroupCount{
+			{Key: "meest", Count: 2, Totals: totals(map[string]int64{"RUB": 5000, "USD": 100})},
+			{Key: "cdek", Count: 1, Totals: totals(map[string]int64{"EUR": 20, "USD": 30})},
+		}},
+		{by: "locale", want: []postgres.GroupCount{
+			{Key: "ru", Count: 2, Totals: totals(map[string]int64{"EUR": 20, "RUB": 5000, "USD": 30})},
+			{Key: "en", Count: 1, Totals: totals(map[string]int64{"USD": 100})},
+		}},
+		{by: "status", want: []postgres.GroupCount{
+			{Key: "202", Count: 2, Totals: totals(map[string]int64{"EUR": 20, "USD": 130})},
+			{Key: "200", Count: 2, Totals: totals(map[string]int64{"EUR": 20, "RUB": 5000, "USD": 30})},
+		}},
+		{by: "currency", want: []postgres.GroupCount{
+			{Key: "USD", Count: 2, Totals: totals(map[string]int64{"USD": 130})},
+			{Key: "EUR", Count: 1, Totals: totals(map[string]int64{"EUR": 20})},
+			{Key: "RUB", Count: 1, Totals: totals(map[string]int64{"RUB": 5000})},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.by, func(t *testing.T) {
+			rec, resp := getBreakdown(t, "by="+tt.by+"&from=2024-03-01&to=2024-03-02")
+			require.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.by, resp.By)
+			got := make([]postgres.GroupCount, 0, len(resp.Groups))
+			for _, g := range resp.Groups {
+				assert.Nil(t, g.ApproxTotalUSD, "no rates configured")
+				got = append(got, g.GroupCount)
+			}
+			assert.ElementsMatch(t, tt.want, got)
+			assert.Empty(t, resp.ApproxNote)
+		})
+	}
+}
+
+func TestBreakdownApproxTotalUSD(t *testing.T) {
+	rec, resp := getBreakdownWithRates(t, "by=delivery_service&from=2024-03-01&to=2024-03-02", map[string]float64{"USD": 1, "EUR": 1.5})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEmpty(t, resp.ApproxNote, "estimate is labeled")
+
+	byKey := make(map[string]breakdownGroup)
+	for _, g := range resp.Groups {
+		byKey[g.Key] = g
+	}
+	require.NotNil(t, byKey["cdek"].ApproxTotalUSD)
+	assert.Equal(t, 60.0, *byKey["cdek"].ApproxTotalUSD)
+	assert.Empty(t, byKey["cdek"].ApproxUnconverted)
+	// Рубли без курса не складываются с долларами, а перечисляются отдельно
+	require.NotNil(t, byKey["meest"].ApproxTotalUSD)
+	assert.Equal(t, 100.0, *byKey["meest"].ApproxTotalUSD)
+	assert.Equal(t, []string{"RUB"}, byKey["meest"].ApproxUnconverted)
+}
+
+func TestBreakdownRejectsUnknownKey(t *testing.T) {
+	rec, _ := getBreakdown(t, "by=customer_id&from=2024-03-01&to=2024-03-02")
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "delivery_service, locale, status")
+}
+
+func TestBreakdownEmptyRange(t *testing.T) {
+	rec, resp := getBreakdown(t, "by=locale&from=2020-01-01&to=2020-01-02")
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotNil(t, resp.Groups)
+	assert.Empty(t, resp.Groups)
+}
@@ -0,0 +1,126 @@
+// Описание: Тесты арендаторов: заказы с одинаковым order_uid из топиков разных арендаторов хранятся и кэшируются
+// раздельно, а HTTP запросы читают только заказы арендатора из заголовка X-Tenant-ID или ключа API
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withTestTenants - объявляет в cfg арендаторов market-a и market-b с топиками orders-a и orders-b
+func withTestTenants(cfg *config.Config) *config.Config {
+	cfg.Tenants = []config.TenantConfig{
+		{ID: "market-a", Topic: "orders-a", APIKeys: []string{"key-a"}},
+		{ID: "market-b", Topic: "orders-b", APIKeys: []string{"key-b"}},
+	}
+	return cfg
+}
+
+// topicTrackNumber - трек-номер заказа из сообщения топика topic в newCollidingTenantMessages
+func topicTrackNumber(topic string) string {
+	return "WB" + strings.ToUpper(strings.ReplaceAll(topic, "-", ""))
+}
+
+// newCollidingTenantMessages - сообщения с одним и тем же заказом в топиках обоих арендаторов: трек-номер заказа
+// получен из топика (topicTrackNumber). Последнее сообщение пришло из топика, не принадлежащего ни одному арендатору.
+func newCollidingTenantMessages(t *testing.T) (string, []kafka2.Message) {
+	t.Helper()
+	order := testorders.NewGenerator(41).Order(testorders.ScenarioDefault)
+	var msgs []kafka2.Message
+	for _, topic := range []string{"orders-a", "orders-b", "orders-x"} {
+		order.TrackNumber = topicTrackNumber(topic)
+		b, err := json.Marshal(order)
+		require.NoError(t, err)
+		msgs = append(msgs, kafka2.Message{Topic: topic, Offset: int64(len(msgs)), Value: b})
+	}
+	return order.OrderUid, msgs
+}
+
+func TestTenantsWithSameOrderUIDAreIsolated(t *testing.T) {
+	for name, cfg := range map[string]*config.Config{
+		"sync":    withTestTenants(newConsumerTestConfig()),
+		"batched": withTestTenants(newBatchedTestConfig(2, 10*time.Millisecond)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			uid, msgs := newCollidingTenantMessages(t)
+			repo := &fakeRepository{}
+			c := newTestCache(t)
+			reader := &sliceReader{msgs: msgs}
+			ctx, cancel := context.WithCancel(context.Background())
+			wg := startKafkaConsumer(ctx, reader, nil, repo, c, newTestLogger(), cfg, nil)
+			require.Eventually(t, func() bool {
+				return len(reader.committedOffsets()) == len(msgs)
+			}, 5*time.Second, time.Millisecond, "the message of an unknown topic is skipped and committed too")
+			cancel()
+			wg.Wait()
+
+			for id, topic := range map[string]string{"market-a": "orders-a", "market-b": "orders-b"} {
+				stored := repo.ordersOf(id)
+				require.Contains(t, stored, uid)
+				assert.Equal(t, topicTrackNumber(topic), stored[uid].TrackNumber)
+				cached, ok := c.Get(id, uid)
+				require.True(t, ok)
+				assert.Equal(t, topicTrackNumber(topic), cached.TrackNumber)
+			}
+			assert.Empty(t, repo.ordersOf(tenant.Default))
+			_, ok := c.Get(tenant.Default, uid)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestTenantRequestsReadOnlyTheirOrders(t *testing.T) {
+	a := testorders.NewGenerator(42).Order(testorders.ScenarioDefault)
+	b := a
+	a.TrackNumber, b.TrackNumber = "TRACK-A", "TRACK-B"
+	repo := &fakeRepository{tenantOrders: map[string]map[string]orders.Order{
+		"market-a": {a.OrderUid: a},
+		"market-b": {b.OrderUid: b},
+	}}
+	cfg := withTestTenants(newConsumerTestConfig())
+	app := &App{mode: modeAPI, cfg: cfg, logger: newTestLogger(), repo: repo, cache: newTestCache(t)}
+	h := app.handler()
+
+	get := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/order?id="+a.OrderUid, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	trackOf := func(rec *httptest.ResponseRecorder) string {
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var got orders.Order
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		return got.TrackNumber
+	}
+
+	assert.Equal(t, "TRACK-A", trackOf(get(map[string]string{tenantHeader: "market-a"})))
+	assert.Equal(t, "TRACK-B", trackOf(get(map[string]string{"X-API-Key": "key-b"})))
+	assert.Equal(t, "TRACK-A", trackOf(get(map[string]string{"X-API-Key": "key-a", tenantHeader: "market-a"})), "from the cache filled by the first read")
+
+	rec := get(map[string]string{"X-API-Key": "key-b", tenantHeader: "market-a"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = get(nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "tenant is required")
+	rec = get(map[string]string{tenantHeader: tenant.Default})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "unknown tenant")
+}
@@ -0,0 +1,118 @@
+// Описание: Защита приёма заказов от продюсера, отправляющего заказы одного покупателя без остановки: частота заказов
+// каждого покупателя ограничивается kafka.consumer.customer_limit, а заказы сверх ограничения сохраняются с замечанием
+// и не подтверждаются или отправляются в очередь недоставленных сообщений
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/metrics"
+	"l0_test_self/internal/ratelimit"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/kafkautil"
+
+	kafka2 "github.com/segmentio/kafka-go"
+)
+
+const (
+	// defaultCustomerLimitSize - сколько покупателей отслеживается, если kafka.consumer.customer_limit.size не задан
+	defaultCustomerLimitSize = 10000
+	// throttledTopSize - сколько покупателей с наибольшим числом превышений показывает /admin/consumer/status
+	throttledTopSize = 10
+)
+
+// customerThrottle - ограничение частоты заказов покупателей. nil выключает ограничение
+type customerThrottle struct {
+	limiter *ratelimit.Limiter // ключ - tenant.Key(арендатор, customer_id)
+	limit   int
+	reject  bool // заказы сверх ограничения отправляются в очередь недоставленных, а не сохраняются с замечанием
+
+	throttled *metrics.Counter // заказы сверх ограничения
+}
+
+// newCustomerThrottle - ограничение частоты заказов покупателей по cfg; nil, если оно выключено
+func newCustomerThrottle(cfg config.CustomerLimitConfig) *customerThrottle {
+	if !cfg.Enabled() {
+		return nil
+	}
+	size := cfg.Size
+	if size == 0 {
+		size = defaultCustomerLimitSize
+	}
+	return &customerThrottle{
+		limiter:   ratelimit.NewLimiter(cfg.MaxPerMinute, time.Minute, size),
+		limit:     cfg.MaxPerMinute,
+		reject:    cfg.Policy == config.CustomerLimitPolicyDLQ,
+		throttled: &metrics.Counter{},
+	}
+}
+
+// register - регистрирует счётчик заказов сверх ограничения в реестре метрик
+func (t *customerThrottle) register(reg *metrics.Registry) {
+	if t == nil {
+		return
+	}
+	reg.RegisterCounter("consumer_throttled_orders_total", "Orders of customers over kafka.consumer.customer_limit.max_per_minute (flagged or sent to the DLQ per policy).", t.throttled)
+}
+
+// check - учитывает заказ order арендатора tenantID и сообщает, превышает ли он ограничение частоты заказов покупателя.
+// При политике flag к такому заказу добавляется замечание к полю customer_id.
+func (t *customerThrottle) check(tenantID string, order *orders.Order) bool {
+	if t == nil || t.limiter.Allow(tenant.Key(tenantID, order.CustomerId)) {
+		return false
+	}
+	t.throttled.Inc()
+	if !t.reject {
+		order.Warnings = append(order.Warnings, orders.Warning{
+			Field:   "customer_id",
+			Value:   order.CustomerId,
+			Message: fmt.Sprintf("throttled: customer exceeded %d orders per minute", t.limit),
+		})
+	}
+	return true
+}
+
+// rejects - сообщает, отправляются ли заказы сверх ограничения в очередь недоставленных
+func (t *customerThrottle) rejects() bool {
+	return t != nil && t.reject
+}
+
+// top - покупатели с наибольшим числом заказов сверх ограничения; nil, если ограничение выключено
+func (t *customerThrottle) top() []ratelimit.Offender {
+	if t == nil {
+		return nil
+	}
+	return t.limiter.Top(throttledTopSize)
+}
+
+// throttle - проверяет ограничение частоты заказов покупателя для заказа order из сообщения msg. Возвращает, превышено ли
+// ограничение, и false вторым значением, если сообщение не обработано до конца: оно остаётся незакоммиченным.
+// При политике dlq заказ сверх ограничения не сохраняется, а сообщение отправляется в очередь недоставленных; отправка
+// повторяется, пока не удастся или консьюмер не будет остановлен.
+func (c *consumer) throttle(ctx context.Context, msg kafka2.Message, tenantID string, order *orders.Order) (throttled, ok bool) {
+	if !c.throttler.check(tenantID, order) {
+		return false, true
+	}
+	ref := kafkautil.MessageRef(msg)
+	if !c.throttler.rejects() {
+		c.logError("throttled", "order %s of customer %s over the customer limit, stored flagged without ack (%s)", order.OrderUid, order.CustomerId, ref)
+		return true, true
+	}
+	for {
+		opCtx, cancel := opContext(ctx)
+		err := c.sendToDLQ(opCtx, msg, tenantID, order, dlqReasonThrottled, 0, fmt.Errorf("customer %s exceeded %d orders per minute", order.CustomerId, c.throttler.limit))
+		cancel()
+		if err == nil {
+			c.fail(stageValidate, dlqReasonThrottled, &msg, order.OrderUid, "order of customer %s over the customer limit sent to dlq (order=%s, %s)", order.CustomerId, order.OrderUid, ref)
+			return true, true
+		}
+		c.fail(stageValidate, "dlq", &msg, order.OrderUid, "dlq write error, throttled message will be retried (order=%s, %s): %v", order.OrderUid, ref, err)
+		if !sleepCtx(ctx, c.clock, c.retryDelay) {
+			return true, false
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Описание: Тесты ограничения частоты заказов покупателя: всплеск заказов одного покупателя помечается
+// или отправляется в очередь недоставленных сообщений, заказы остальных покупателей обрабатываются как обычно,
+// а покупатели с превышениями видны в /admin/consumer/status
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	kafka2 "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCustomerMessages - сообщения с заказами покупателей customers (по заказу на элемент) и идентификаторы заказов по смещению
+func newCustomerMessages(t *testing.T, seed int64, customers []string) ([]kafka2.Message, map[int64]string) {
+	t.Helper()
+	gen := testorders.NewGenerator(seed)
+	msgs := make([]kafka2.Message, 0, len(customers))
+	uids := make(map[int64]string, len(customers))
+	for i, customer := range customers {
+		o := gen.Order(testorders.ScenarioDefault)
+		o.CustomerId = customer
+		b, err := json.Marshal(o)
+		require.NoError(t, err)
+		msgs = append(msgs, kafka2.Message{Topic: "orders", Offset: int64(i), Value: b})
+		uids[int64(i)] = o.OrderUid
+	}
+	return msgs, uids
+}
+
+// burstCustomers - всплеск из пяти заказов покупателя runaway вперемешку с двумя заказами покупателя regular
+var burstCustomers = []string{"runaway", "runaway", "regular", "runaway", "runaway", "regular", "runaway"}
+
+func TestCustomerLimitFlagsBurst(t *testing.T) {
+	msgs, uids := newCustomerMessages(t, 41, burstCustomers)
+	repo := &fakeRepository{}
+	reader := &sliceReader{msgs: msgs}
+	cfg := newConsumerTestConfig()
+	acks := &fakeWriter{}
+	monitor := newConsumerMonitor(cfg)
+	monitor.acks = newTestOrderAcker(acks)
+	monitor.throttle = newCustomerThrottle(config.CustomerLimitConfig{MaxPerMinute: 2})
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, nil, repo, newTestCache(t), newTestLogger(), cfg, monitor)
+
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) == len(msgs) }, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	repo.mu.Lock()
+	var flagged []string
+	for offset, uid := range uids {
+		o, ok := repo.orders[uid]
+		require.True(t, ok, "every order is stored under the flag policy (offset %d)", offset)
+		for _, w := range o.Warnings {
+			if w.Field == "customer_id" {
+				assert.Equal(t, "runaway", w.Value)
+				assert.True(t, strings.HasPrefix(w.Message, "throttled"))
+				flagged = append(flagged, uid)
+			}
+		}
+	}
+	repo.mu.Unlock()
+	assert.ElementsMatch(t, []string{uids[3], uids[4], uids[6]}, flagged, "orders over 2 per minute of one customer are flagged")
+
+	acked := ackedOrders(t, acks)
+	assert.ElementsMatch(t, []string{uids[0], uids[1], uids[2], uids[5]}, acked, "flagged orders are not acknowledged")
+	assert.Equal(t, uint64(3), monitor.throttle.throttled.Value())
+
+	top := monitor.throttle.top()
+	require.Len(t, top, 1, "the regular customer is not throttled")
+	assert.Equal(t, tenant.Key(tenant.Default, "runaway"), top[0].Key)
+	assert.Equal(t, uint64(3), top[0].Throttled)
+}
+
+func TestCustomerLimitSendsBurstToDLQ(t *testing.T) {
+	for _, mode := range []string{config.PipelineModeSync, config.PipelineModeBatched} {
+		t.Run(mode, func(t *testing.T) {
+			msgs, uids := newCustomerMessages(t, 42, burstCustomers)
+			repo := &fakeRepository{}
+			reader := &sliceReader{msgs: msgs}
+			cfg := newConsumerTestConfig()
+			if mode == config.PipelineModeBatched {
+				cfg = newBatchedTestConfig(len(msgs), time.Hour)
+			}
+			dlq := &fakeWriter{}
+			monitor := newConsumerMonitor(cfg)
+			monitor.throttle = newCustomerThrottle(config.CustomerLimitConfig{MaxPerMinute: 2, Policy: config.CustomerLimitPolicyDLQ})
+			ctx, cancel := context.WithCancel(context.Background())
+			wg := startKafkaConsumer(ctx, reader, dlq, repo, newTestCache(t), newTestLogger(), cfg, monitor)
+
+			require.Eventually(t, func() bool { return len(reader.committedOffsets()) == len(msgs) }, 5*time.Second, time.Millisecond)
+			cancel()
+			wg.Wait()
+
+			repo.mu.Lock()
+			var stored []string
+			for uid, o := range repo.orders {
+				stored = append(stored, uid)
+				assert.Empty(t, o.Warnings, "rejected orders are not stored flagged")
+			}
+			repo.mu.Unlock()
+			assert.ElementsMatch(t, []string{uids[0], uids[1], uids[2], uids[5]}, stored)
+
+			written := dlq.written()
+			require.Len(t, written, 3)
+			for i, offset := range []int64{3, 4, 6} {
+				assert.Equal(t, msgs[offset].Value, written[i].Value)
+				assert.Equal(t, dlqReasonThrottled, headerValue(written[i], dlqReasonHeader))
+				assert.Equal(t, uids[offset], headerValue(written[i], dlqOrderHeader))
+			}
+			assert.Zero(t, monitor.poison.Value(), "throttled messages are not poison")
+		})
+	}
+}
+
+func TestCustomerLimitRetriesDLQUntilShutdown(t *testing.T) {
+	msgs, _ := newCustomerMessages(t, 43, []string{"runaway", "runaway"})
+	reader := &sliceReader{msgs: msgs}
+	cfg := newConsumerTestConfig()
+	dlq := &fakeWriter{}
+	dlq.setErr(errBatchFailed)
+	monitor := newConsumerMonitor(cfg)
+	monitor.throttle = newCustomerThrottle(config.CustomerLimitConfig{MaxPerMinute: 1, Policy: config.CustomerLimitPolicyDLQ})
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := startKafkaConsumer(ctx, reader, dlq, &fakeRepository{}, newTestCache(t), newTestLogger(), cfg, monitor)
+
+	require.Eventually(t, func() bool { return len(reader.committedOffsets()) == 1 }, 5*time.Second, time.Millisecond)
+	// Отправка в очередь недоставленных повторяется, пока она недоступна
+	require.Eventually(t, func() bool { return dlq.writeAttempts() >= 3 }, 5*time.Second, time.Millisecond)
+	cancel()
+	wg.Wait()
+	assert.Equal(t, []int64{0}, reader.committedOffsets(), "the throttled message stays uncommitted while the dlq is down")
+	assert.Equal(t, uint64(1), monitor.throttle.throttled.Value(), "retries do not count the order again")
+}
+
+func TestConsumerStatusShowsThrottledCustomers(t *testing.T) {
+	throttle := newCustomerThrottle(config.CustomerLimitConfig{MaxPerMinute: 1})
+	for _, customer := range []string{"a", "a", "a", "b", "b", "c"} {
+		throttle.check(tenant.Default, &orders.Order{CustomerId: customer})
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /admin/consumer/status", requireAdmin(testAdminKey,
+		makeConsumerStatusHandler("", newTestReadBreaker(time.Minute), nil, throttle, nil, nil, newTestLogger())))
+	req := httptest.NewRequest(http.MethodGet, "/admin/consumer/status", nil)
+	req.Header.Set("X-API-Key", testAdminKey)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp consumerStatusResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.ThrottledCustomers, 2)
+	assert.Equal(t, tenant.Key(tenant.Default, "a"), resp.ThrottledCustomers[0].Key)
+	assert.Equal(t, uint64(2), resp.ThrottledCustomers[0].Throttled)
+	assert.Equal(t, tenant.Key(tenant.Default, "b"), resp.ThrottledCustomers[1].Key)
+
+	// Без ограничения поле не выводится
+	rec = httptest.NewRecorder()
+	makeConsumerStatusHandler("", newTestReadBreaker(time.Minute), nil, nil, nil, nil, newTestLogger()).ServeHTTP(rec, req)
+	assert.NotContains(t, rec.Body.String(), "throttled_customers")
+}
@@ -0,0 +1,136 @@
+// Описание: HTTPS сервера: сертификат из server.tls перечитывается с диска при изменении файлов без перезапуска,
+// а при заданном client_ca административные эндпоинты требуют клиентский сертификат (mTLS)
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"l0_test_self/internal/config"
+)
+
+// certReloader - источник сертификата сервера для tls.Config.GetCertificate. При каждом новом TLS соединении
+// сравнивает время изменения файлов сертификата и ключа с загруженными и при расхождении перечитывает пару,
+// поэтому обновлённый сертификат (например, выпущенный certbot) применяется к новым соединениям без перезапуска.
+type certReloader struct {
+	certFile, keyFile string
+	logger            *log.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time // время изменения файлов при последней попытке загрузки
+	keyMod  time.Time
+}
+
+// newCertReloader - загружает пару сертификат-ключ; ошибка загрузки не даёт серверу запуститься
+func newCertReloader(certFile, keyFile string, logger *log.Logger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return nil, fmt.Errorf("server.tls: %w", err)
+	}
+	if err := r.load(certMod, keyMod); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// modTimes - время изменения файлов сертификата и ключа
+func (r *certReloader) modTimes() (certMod, keyMod time.Time, err error) {
+	ci, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	ki, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return ci.ModTime(), ki.ModTime(), nil
+}
+
+// load - читает пару сертификат-ключ и запоминает время изменения файлов; вызывается под r.mu или до публикации r
+func (r *certReloader) load(certMod, keyMod time.Time) error {
+	r.certMod, r.keyMod = certMod, keyMod
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("server.tls: load certificate %s and key %s: %w", r.certFile, r.keyFile, err)
+	}
+	r.cert = &cert
+	return nil
+}
+
+// GetCertificate - возвращает текущий сертификат, перечитав файлы, если они изменились. Ошибка перезагрузки
+// (например, ключ уже заменён, а сертификат ещё нет) записывается в лог, и соединения продолжают получать
+// прежний сертификат; повторная попытка делается при следующем изменении файлов.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		r.logger.Printf("tls: stat certificate files: %v, serving the loaded certificate", err)
+		return r.cert, nil
+	}
+	if certMod.Equal(r.certMod) && keyMod.Equal(r.keyMod) {
+		return r.cert, nil
+	}
+	if err := r.load(certMod, keyMod); err != nil {
+		r.logger.Printf("tls: %v, serving the previous certificate", err)
+		return r.cert, nil
+	}
+	r.logger.Printf("tls: certificate %s reloaded (expires %s)", r.certFile, r.cert.Leaf.NotAfter.Format(time.RFC3339))
+	return r.cert, nil
+}
+
+// newServerTLSConfig - настройки TLS сервера по server.tls или nil, если HTTPS не включён. При заданном client_ca
+// клиентский сертификат запрашивается, но не обязателен: его наличие проверяет requireClientCert только
+// для административных эндпоинтов.
+func newServerTLSConfig(cfg config.TLSConfig, logger *log.Logger) (*tls.Config, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	// Версия проверена при загрузке конфигурации (config.Validate)
+	version, err := cfg.Version()
+	if err != nil {
+		return nil, err
+	}
+	certs, err := newCertReloader(cfg.CertFile, cfg.KeyFile, logger)
+	if err != nil {
+		return nil, err
+	}
+	tc := &tls.Config{MinVersion: version, GetCertificate: certs.GetCertificate}
+	if cfg.ClientCA != "" {
+		pem, err := os.ReadFile(cfg.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("server.tls: read client_ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("server.tls: client_ca %s contains no PEM certificates", cfg.ClientCA)
+		}
+		tc.ClientAuth, tc.ClientCAs = tls.VerifyClientCertIfGiven, pool
+	}
+	return tc, nil
+}
+
+// requireClientCert - middleware, отклоняющее запросы к /admin/ без клиентского сертификата, подписанного
+// server.tls.client_ca. Без client_ca возвращает next без изменений.
+func requireClientCert(cfg config.TLSConfig, next http.Handler) http.Handler {
+	if !cfg.Enabled() || cfg.ClientCA == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/admin/") && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			writeAPIError(w, r, http.StatusForbidden, errCodeClientCertRequired)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
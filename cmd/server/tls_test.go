@@ -0,0 +1,211 @@
+// Описание: Тесты HTTPS сервера: сертификат перечитывается после замены файлов для новых соединений, некорректная
+// пара не даёт запуститься, а при заданном client_ca административные эндпоинты требуют клиентский сертификат
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert - самоподписанный сертификат с ключом в PEM; подходит и как сертификат сервера или клиента, и как CA
+type testCert struct {
+	certPEM, keyPEM []byte
+}
+
+// newTestCert - создаёт самоподписанный сертификат ECDSA с серийным номером serial для 127.0.0.1
+func newTestCert(t *testing.T, serial int64) testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return testCert{
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// write - записывает сертификат и ключ в файлы dir/server.crt и dir/server.key и сдвигает время их изменения
+// на mod, чтобы замена файлов была заметна при любой точности времени файловой системы
+func (c testCert) write(t *testing.T, dir string, mod time.Time) (certFile, keyFile string) {
+	t.Helper()
+	certFile, keyFile = filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	require.NoError(t, os.WriteFile(certFile, c.certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, c.keyPEM, 0o600))
+	require.NoError(t, os.Chtimes(certFile, mod, mod))
+	require.NoError(t, os.Chtimes(keyFile, mod, mod))
+	return certFile, keyFile
+}
+
+// servedSerial - серийный номер сертификата, который сервер addr выдаёт новому TLS соединению
+func servedSerial(t *testing.T, addr string) int64 {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestHTTPSServesReloadedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	certFile, keyFile := newTestCert(t, 1).write(t, dir, start)
+
+	cfg := newConsumerTestConfig()
+	cfg.Server.TLS = config.TLSConfig{CertFile: certFile, KeyFile: keyFile}
+	tc, err := newServerTLSConfig(cfg.Server.TLS, newTestLogger())
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), tc.MinVersion)
+
+	repo := &fakeRepository{orders: map[string]orders.Order{"order-1": {OrderUid: "order-1"}}}
+	app := &App{mode: modeAPI, cfg: cfg, logger: newTestLogger(), repo: repo, cache: newTestCache(t), tls: tc}
+	url, stop := startTestApp(t, app)
+	defer func() { require.NoError(t, stop()) }()
+	require.True(t, strings.HasPrefix(url, "https://"))
+	addr := strings.TrimPrefix(url, "https://")
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get(url + "/order?id=order-1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int64(1), servedSerial(t, addr))
+
+	// Замена файлов подхватывается новыми соединениями без перезапуска
+	newTestCert(t, 2).write(t, dir, start.Add(time.Minute))
+	assert.Equal(t, int64(2), servedSerial(t, addr))
+	assert.Equal(t, int64(2), servedSerial(t, addr))
+
+	// Plain HTTP на порту HTTPS не обслуживается
+	resp, err = http.Get("http://" + addr + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestCertReloaderKeepsCertificateOnBadRotation(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	first := newTestCert(t, 1)
+	certFile, keyFile := first.write(t, dir, start)
+
+	var logs bytes.Buffer
+	r, err := newCertReloader(certFile, keyFile, log.New(&logs, "", 0))
+	require.NoError(t, err)
+
+	// Сертификат заменён, а ключ остался от прежнего: пара не сходится
+	second := newTestCert(t, 2)
+	testCert{certPEM: second.certPEM, keyPEM: first.keyPEM}.write(t, dir, start.Add(time.Minute))
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cert.Leaf.SerialNumber.Int64(), "the previous certificate is still served")
+	assert.Contains(t, logs.String(), "serving the previous certificate")
+
+	// Когда замена завершена, новая пара загружается
+	second.write(t, dir, start.Add(2*time.Minute))
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cert.Leaf.SerialNumber.Int64())
+}
+
+func TestServerTLSConfigRejectsInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	first, second := newTestCert(t, 1), newTestCert(t, 2)
+	certFile, keyFile := testCert{certPEM: first.certPEM, keyPEM: second.keyPEM}.write(t, dir, time.Now())
+
+	_, err := newServerTLSConfig(config.TLSConfig{CertFile: certFile, KeyFile: keyFile}, newTestLogger())
+	assert.ErrorContains(t, err, "server.tls: load certificate "+certFile)
+
+	_, err = newServerTLSConfig(config.TLSConfig{CertFile: certFile, KeyFile: filepath.Join(dir, "missing.key")}, newTestLogger())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	certFile, keyFile = first.write(t, dir, time.Now())
+	_, err = newServerTLSConfig(config.TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCA: keyFile}, newTestLogger())
+	assert.ErrorContains(t, err, "contains no PEM certificates")
+
+	tc, err := newServerTLSConfig(config.TLSConfig{}, newTestLogger())
+	require.NoError(t, err)
+	assert.Nil(t, tc, "TLS is disabled without cert_file")
+}
+
+func TestHTTPSAdminRequiresClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := newTestCert(t, 1).write(t, dir, time.Now())
+	clientCert := newTestCert(t, 10)
+	caFile := filepath.Join(dir, "clients.pem")
+	require.NoError(t, os.WriteFile(caFile, clientCert.certPEM, 0o600))
+
+	cfg := newConsumerTestConfig()
+	cfg.Server.TLS = config.TLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.3", ClientCA: caFile}
+	tc, err := newServerTLSConfig(cfg.Server.TLS, newTestLogger())
+	require.NoError(t, err)
+	app := &App{mode: modeAPI, cfg: cfg, logger: newTestLogger(), repo: &fakeRepository{}, cache: newTestCache(t), tls: tc}
+	url, stop := startTestApp(t, app)
+	defer func() { require.NoError(t, stop()) }()
+
+	get := func(path string, certs ...tls.Certificate) *http.Response {
+		t.Helper()
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, Certificates: certs}}}
+		req, err := http.NewRequest(http.MethodGet, url+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("X-API-Key", testAdminKey)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := get("/admin/cache/keys")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	var body apiErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, errCodeClientCertRequired, body.Code)
+	assert.Equal(t, http.StatusOK, get("/healthz").StatusCode, "public routes do not need a client certificate")
+
+	pair, err := tls.X509KeyPair(clientCert.certPEM, clientCert.keyPEM)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, get("/admin/cache/keys", pair).StatusCode)
+
+	// Сертификат, не подписанный client_ca, отклоняется при рукопожатии
+	other := newTestCert(t, 11)
+	otherPair, err := tls.X509KeyPair(other.certPEM, other.keyPEM)
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{otherPair}}}}
+	_, err = client.Get(url + "/healthz")
+	assert.Error(t, err)
+}
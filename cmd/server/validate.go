@@ -0,0 +1,91 @@
+// Описание: Проверка заказа без сохранения (POST /orders/validate) для партнёров, отлаживающих интеграцию: тело
+// проходит ту же цепочку, что и в POST /orders (версия схемы, декодирование, ValidateOrder с правилами развёртывания),
+// а ответ перечисляет ошибки по полям, замечания и заказ в том виде, в котором он был бы сохранён. В базу и кэш
+// ничего не записывается, подтверждения и уведомления не отправляются
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"l0_test_self/internal/validation"
+	"l0_test_self/models/orders"
+)
+
+// orderValidationReport - ответ проверки заказа
+type orderValidationReport struct {
+	Valid bool `json:"valid"` // заказ был бы принят POST /orders
+	// Stage - этап, на котором заказ отклонён: decode (версия схемы и декодирование) или validate
+	Stage    string            `json:"stage,omitempty"`
+	Errors   []orderFieldIssue `json:"errors"`
+	Warnings []orders.Warning  `json:"warnings"` // замечания проверок в режиме flag: заказ сохраняется с ними
+	// Corrections - расхождения total_price с ценой и скидкой (validation.total_price.mode correct или flag)
+	Corrections []orders.Correction `json:"corrections"`
+	Coerced     []string            `json:"coerced,omitempty"` // поля, приведённые в режиме pipeline.decode: lenient
+	Quarantined bool                `json:"quarantined"`       // заказ был бы сохранён в карантин (date_created в будущем)
+	// Order - заказ после нормализации идентификатора, трек-номеров и валют, как он был бы сохранён; нет, если отклонён
+	Order *orders.Order `json:"order,omitempty"`
+}
+
+// orderFieldIssue - ошибка в поле заказа
+type orderFieldIssue struct {
+	Path    string `json:"path"` // путь поля в JSON заказа, например "items[0].total_price"; пусто — тело целиком
+	Rule    string `json:"rule"` // нарушенное правило или проверка
+	Message string `json:"message"`
+}
+
+// makeOrderValidateHandler - HTTP обработчик POST /orders/validate: проверяет заказ из тела запроса, как POST /orders,
+// и отвечает 200 с отчётом orderValidationReport, принят заказ или нет. Тело ограничено тем же размером, что и при
+// создании заказа.
+func makeOrderValidateHandler(logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxOrderBodyBytes))
+		if err != nil {
+			writeAPIError(w, r, http.StatusRequestEntityTooLarge, errCodeRequestTooLarge)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(validateOrderRequest(r, body)); err != nil {
+			logger.Printf("[%s] encode error: %v", requestIDFromContext(r.Context()), err)
+		}
+	}
+}
+
+// validateOrderRequest - проверяет заказ из тела запроса r цепочкой POST /orders и составляет отчёт
+func validateOrderRequest(r *http.Request, body []byte) orderValidationReport {
+	report := orderValidationReport{Errors: []orderFieldIssue{}, Warnings: []orders.Warning{}, Corrections: []orders.Correction{}}
+	body, err := upgradeRequestSchema(r, body)
+	if err != nil {
+		report.Stage = stageDecode
+		report.Errors = append(report.Errors, orderFieldIssue{Path: schemaVersionParam, Rule: "schema_version", Message: err.Error()})
+		return report
+	}
+	order, stage, err := checkOrder(body)
+	report.Stage = stage
+	var decodeErr *orders.DecodeError
+	switch {
+	case stage == stageDecode && errors.As(err, &decodeErr):
+		for _, f := range decodeErr.Fields {
+			report.Errors = append(report.Errors, orderFieldIssue{Path: f.Path, Rule: "decode", Message: f.Reason})
+		}
+		return report
+	case stage == stageDecode:
+		report.Errors = append(report.Errors, orderFieldIssue{Rule: "json", Message: err.Error()})
+		return report
+	case err != nil:
+		for _, f := range validation.FieldErrors(err) {
+			report.Errors = append(report.Errors, orderFieldIssue{Path: f.Path, Rule: f.Rule, Message: f.Message})
+		}
+	default:
+		report.Valid = true
+		report.Order = &order
+	}
+	report.Warnings = append(report.Warnings, order.Warnings...)
+	report.Corrections = append(report.Corrections, order.Corrections...)
+	report.Coerced = order.Coerced
+	report.Quarantined = order.Quarantined
+	return report
+}
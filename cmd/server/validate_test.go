@@ -0,0 +1,142 @@
+// Описание: Тесты проверки заказа без сохранения (POST /orders/validate): отчёт совпадает с решением POST /orders
+// для тех же тел, ошибки указывают поле и правило, заказ в отчёте совпадает с сохранённым
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/internal/validation"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postValidate - отправляет тело body в POST /orders/validate и разбирает отчёт
+func postValidate(t *testing.T, body []byte) (int, orderValidationReport) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h := withDefaultTenant(makeOrderValidateHandler(newTestLogger()))
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orders/validate", strings.NewReader(string(body))))
+	var report orderValidationReport
+	if rec.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report), rec.Body.String())
+	}
+	return rec.Code, report
+}
+
+// marshalOrder - JSON заказа order
+func marshalOrder(t *testing.T, order orders.Order) []byte {
+	t.Helper()
+	b, err := json.Marshal(order)
+	require.NoError(t, err)
+	return b
+}
+
+func TestOrderValidateMatchesCreate(t *testing.T) {
+	t.Cleanup(func() { validation.SetTrackNumberPolicy(nil, validation.TrackNumberReject) })
+	g := testorders.NewGenerator(27)
+
+	lowerCurrency := g.Order(testorders.ScenarioDefault)
+	lowerCurrency.Payments[0].Currency = " usd "
+	missingField := g.Order(testorders.ScenarioDefault)
+	missingField.CustomerId = ""
+	badTrack := g.Order(testorders.ScenarioDefault)
+	badTrack.TrackNumber = "wb-1"
+	unknownStatus := g.Order(testorders.ScenarioDefault)
+	unknownStatus.Items[0].Status = 999
+
+	cases := []struct {
+		name      string
+		body      []byte
+		trackFlag bool
+		path      string
+		rule      string
+	}{
+		{name: "valid", body: mustOrderJSON(t, g)},
+		{name: "normalized currency", body: marshalOrder(t, lowerCurrency)},
+		{name: "missing field", body: marshalOrder(t, missingField), path: "customer_id", rule: "required"},
+		{name: "track number rejected", body: marshalOrder(t, badTrack), path: "track_number", rule: "track_number"},
+		{name: "track number flagged", body: marshalOrder(t, badTrack), trackFlag: true},
+		{name: "unknown item status", body: marshalOrder(t, unknownStatus), path: "items[0].status", rule: "item_status"},
+		{name: "invalid json", body: []byte(`{"order_uid": `), rule: "json"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mode := validation.TrackNumberReject
+			if tc.trackFlag {
+				mode = validation.TrackNumberFlag
+			}
+			validation.SetTrackNumberPolicy(nil, mode)
+
+			code, report := postValidate(t, tc.body)
+			require.Equal(t, http.StatusOK, code)
+
+			repo := &fakeRepository{}
+			c := newTestCache(t)
+			create := withDefaultTenant(makeOrderCreateHandler(repo, c, config.IdempotencyConfig{}, clock.Real, newTestLogger()))
+			rec := postOrder(create, "", tc.body)
+			assert.Equal(t, report.Valid, rec.Code == http.StatusCreated, rec.Body.String())
+			if !report.Valid {
+				require.Len(t, report.Errors, 1)
+				assert.Equal(t, tc.path, report.Errors[0].Path)
+				assert.Equal(t, tc.rule, report.Errors[0].Rule)
+				assert.Nil(t, report.Order)
+				return
+			}
+
+			// Отчёт показывает заказ таким, каким его сохранил POST /orders
+			require.NotNil(t, report.Order)
+			assert.Empty(t, report.Errors)
+			stored, err := repo.GetOrderByUID(context.Background(), tenant.Default, report.Order.OrderUid)
+			require.NoError(t, err)
+			// Время сохранения и источник выставляет запись заказа
+			stored.StoredAt, stored.UpdatedAt = time.Time{}, time.Time{}
+			stored.Source, stored.SourceDetail = "", ""
+			assert.Equal(t, stored, *report.Order)
+			assert.Len(t, report.Warnings, len(stored.Warnings))
+		})
+	}
+}
+
+func TestOrderValidateReport(t *testing.T) {
+	t.Cleanup(func() { validation.SetTrackNumberPolicy(nil, validation.TrackNumberReject) })
+	g := testorders.NewGenerator(28)
+
+	order := g.Order(testorders.ScenarioDefault)
+	order.Payments[0].Currency = "usd"
+	order.TrackNumber = "wb-1"
+	validation.SetTrackNumberPolicy(nil, validation.TrackNumberFlag)
+	code, report := postValidate(t, marshalOrder(t, order))
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, report.Valid)
+	assert.Empty(t, report.Stage)
+	assert.Equal(t, "USD", report.Order.Payments[0].Currency)
+	require.Len(t, report.Warnings, 1)
+	assert.Equal(t, "track_number", report.Warnings[0].Field)
+
+	withDecodeMode(t, orders.DecodeStrict)
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(mustOrderJSON(t, g), &fields))
+	fields["delivery"].(map[string]any)["floor"] = 3
+	body, err := json.Marshal(fields)
+	require.NoError(t, err)
+	code, report = postValidate(t, body)
+	require.Equal(t, http.StatusOK, code)
+	assert.False(t, report.Valid)
+	assert.Equal(t, stageDecode, report.Stage)
+	assert.Equal(t, []orderFieldIssue{{Path: "delivery.floor", Rule: "decode", Message: "unknown field"}}, report.Errors)
+
+	code, _ = postValidate(t, []byte(`{"order_uid": "`+strings.Repeat("x", maxOrderBodyBytes)+`"}`))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+}
@@ -0,0 +1,168 @@
+// Описание: Публичные эндпоинты страницы web/: GET /api/recent — последние обработанные заказы и GET /api/suggest —
+// идентификаторы заказов по началу. Ответы содержат только краткие сведения о заказах без персональных данных,
+// а частота запросов с одного адреса ограничена (server.web_api.rate_per_minute)
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"l0_test_self/internal/ids"
+	"l0_test_self/internal/ratelimit"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+)
+
+const (
+	// defaultRecentLimit и maxRecentLimit - число последних заказов в ответе /api/recent по умолчанию и наибольшее
+	defaultRecentLimit = 20
+	maxRecentLimit     = 100
+	// maxSuggestions - наибольшее число идентификаторов в ответе /api/suggest
+	maxSuggestions = 10
+	// webAPIClients - число адресов клиентов, частоту запросов которых помнит ограничение
+	webAPIClients = 10000
+)
+
+// Источники последних заказов в ответе /api/recent.
+const (
+	recentSourceMemory = "memory" // кольцо заказов, записанных консьюмером этого экземпляра
+	recentSourceDB     = "db"     // база данных: кольцо ещё не заполнено (например, после запуска) или не ведётся
+)
+
+// recentOrdersResponse - ответ эндпоинта последних заказов
+type recentOrdersResponse struct {
+	Orders []postgres.OrderSummary `json:"orders"`
+	Source string                  `json:"source"`
+}
+
+// suggestResponse - ответ эндпоинта подсказок идентификаторов заказов
+type suggestResponse struct {
+	OrderUIDs []string `json:"order_uids"`
+}
+
+// newWebAPILimiter - создает ограничение частоты запросов к публичным эндпоинтам с одного адреса
+func newWebAPILimiter(perMinute int) *ratelimit.Limiter {
+	return ratelimit.NewLimiter(perMinute, time.Minute, webAPIClients)
+}
+
+// withClientRateLimit - пропускает запрос к next, только если частота запросов с адреса клиента укладывается
+// в ограничение limiter, иначе отвечает 429. Адрес берётся из соединения: заголовки прокси не учитываются
+func withClientRateLimit(limiter *ratelimit.Limiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if !limiter.Allow(host) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Minute.Seconds())))
+			writeAPIError(w, r, http.StatusTooManyRequests, errCodeRateLimited)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// makeRecentOrdersHandler - HTTP обработчик, возвращающий до limit последних записанных заказов арендатора запроса,
+// начиная с самого нового. Заказы берутся из кольца ring, если в нём их достаточно, иначе из базы данных; если база
+// недоступна, возвращается то, что есть в кольце.
+func makeRecentOrdersHandler(ring *recentOrders, repo OrderRepository, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		limit := defaultRecentLimit
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 || n > maxRecentLimit {
+				writeAPIError(w, r, http.StatusBadRequest, errCodeLimitInvalid, maxRecentLimit)
+				return
+			}
+			limit = n
+		}
+
+		tenantID := tenantFromContext(r.Context())
+		resp := recentOrdersResponse{Orders: ring.list(tenantID, limit), Source: recentSourceMemory}
+		if len(resp.Orders) < limit {
+			list, err := repo.RecentOrders(r.Context(), tenantID, limit)
+			switch {
+			case err == nil:
+				resp.Orders, resp.Source = list, recentSourceDB
+			case len(resp.Orders) > 0:
+				logger.Printf("[%s] recent orders: db error, serving %d orders from memory: %v", reqID, len(resp.Orders), err)
+			default:
+				logger.Printf("[%s] recent orders: db error: %v", reqID, err)
+				if !writeUnavailable(w, r, err) {
+					writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+				}
+				return
+			}
+		}
+		if resp.Orders == nil {
+			resp.Orders = []postgres.OrderSummary{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+		}
+	}
+}
+
+// makeSuggestHandler - HTTP обработчик, возвращающий до maxSuggestions идентификаторов заказов арендатора запроса,
+// начинающихся с параметра prefix, по возрастанию. Идентификаторы берутся из кэша и, если их там меньше
+// maxSuggestions, дополняются из базы данных; если база недоступна, возвращаются найденные в кэше.
+func makeSuggestHandler(orderCache OrderCache, repo OrderRepository, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := requestIDFromContext(r.Context())
+		parsed, err := ids.Parse(r.URL.Query().Get("prefix"))
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, errCodePrefixInvalid, ids.MaxLen)
+			return
+		}
+		prefix := parsed.String()
+
+		tenantID := tenantFromContext(r.Context())
+		found := make(map[string]bool)
+		orderCache.Range(func(t, id string, o orders.Order) bool {
+			if t == tenantID && !o.Quarantined && strings.HasPrefix(id, prefix) {
+				found[id] = true
+			}
+			return true
+		})
+		if len(found) < maxSuggestions {
+			list, err := repo.OrderUIDsWithPrefix(r.Context(), tenantID, prefix, maxSuggestions)
+			switch {
+			case err == nil:
+				for _, uid := range list {
+					found[uid] = true
+				}
+			case len(found) > 0:
+				logger.Printf("[%s] suggest: db error, serving %d cached ids: %v", reqID, len(found), err)
+			default:
+				logger.Printf("[%s] suggest: db error (prefix=%q): %v", reqID, prefix, err)
+				if !writeUnavailable(w, r, err) {
+					writeAPIError(w, r, http.StatusInternalServerError, errCodeInternal)
+				}
+				return
+			}
+		}
+
+		resp := suggestResponse{OrderUIDs: make([]string, 0, len(found))}
+		for uid := range found {
+			resp.OrderUIDs = append(resp.OrderUIDs, uid)
+		}
+		sort.Strings(resp.OrderUIDs)
+		if len(resp.OrderUIDs) > maxSuggestions {
+			resp.OrderUIDs = resp.OrderUIDs[:maxSuggestions]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Printf("[%s] encode error: %v", reqID, err)
+		}
+	}
+}
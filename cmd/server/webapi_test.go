@@ -0,0 +1,180 @@
+// Описание: Тесты публичных эндпоинтов страницы web/: последние заказы из кольца и из базы данных при холодном старте,
+// подсказки идентификаторов из кэша и базы данных, отсутствие персональных данных в ответах и ограничение частоты запросов
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// summaryFields - поля кратких сведений о заказе; других полей (в том числе персональных данных) в ответах нет
+var summaryFields = []string{"order_uid", "track_number", "date_created", "stored_at", "item_count"}
+
+func getWebAPI(t *testing.T, h http.Handler, target string) (*httptest.ResponseRecorder, map[string]json.RawMessage) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	var body map[string]json.RawMessage
+	if rec.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	}
+	return rec, body
+}
+
+// decodeRecent - заказы и источник ответа /api/recent; каждый заказ проверяется на отсутствие лишних полей
+func decodeRecent(t *testing.T, body map[string]json.RawMessage) ([]string, string) {
+	t.Helper()
+	var list []map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(body["orders"], &list))
+	var uids []string
+	for _, fields := range list {
+		var names []string
+		for name := range fields {
+			names = append(names, name)
+		}
+		assert.ElementsMatch(t, summaryFields, names)
+		var uid string
+		require.NoError(t, json.Unmarshal(fields["order_uid"], &uid))
+		uids = append(uids, uid)
+	}
+	var source string
+	require.NoError(t, json.Unmarshal(body["source"], &source))
+	return uids, source
+}
+
+// storeOrders - записывает n заказов в repo с возрастающим временем сохранения и возвращает их от новых к старым
+func storeOrders(repo *fakeRepository, seed int64, n int) []orders.Order {
+	gen := testorders.NewGenerator(seed)
+	repo.orders = map[string]orders.Order{}
+	start := time.Now().Add(-time.Hour)
+	list := make([]orders.Order, n)
+	for i := range list {
+		o := gen.Order(testorders.ScenarioDefault)
+		o.StoredAt = start.Add(time.Duration(i) * time.Minute)
+		repo.orders[o.OrderUid] = o
+		list[n-1-i] = o
+	}
+	return list
+}
+
+func TestRecentOrdersEndpoint(t *testing.T) {
+	repo := &fakeRepository{}
+	stored := storeOrders(repo, 196, 5)
+	ring := newRecentOrders(10)
+	h := withDefaultTenant(makeRecentOrdersHandler(ring, repo, newTestLogger()))
+
+	// Холодный старт: кольцо пусто, заказы читаются из базы данных
+	rec, body := getWebAPI(t, h, "/api/recent?limit=3")
+	require.Equal(t, http.StatusOK, rec.Code)
+	uids, source := decodeRecent(t, body)
+	assert.Equal(t, recentSourceDB, source)
+	assert.Equal(t, []string{stored[0].OrderUid, stored[1].OrderUid, stored[2].OrderUid}, uids)
+
+	// Заказы, записанные консьюмером, выдаются из кольца, пока их достаточно
+	for i := len(stored) - 1; i >= 0; i-- {
+		ring.add(tenant.Default, &stored[i])
+	}
+	_, body = getWebAPI(t, h, "/api/recent?limit=2")
+	uids, source = decodeRecent(t, body)
+	assert.Equal(t, recentSourceMemory, source)
+	assert.Equal(t, []string{stored[0].OrderUid, stored[1].OrderUid}, uids)
+	_, body = getWebAPI(t, h, "/api/recent?limit=10")
+	_, source = decodeRecent(t, body)
+	assert.Equal(t, recentSourceDB, source, "a ring with fewer orders than requested falls back to the db")
+
+	// Без базы данных выдаётся то, что есть в кольце
+	repo.err = errors.New("connection refused")
+	rec, body = getWebAPI(t, h, "/api/recent?limit=10")
+	require.Equal(t, http.StatusOK, rec.Code)
+	uids, source = decodeRecent(t, body)
+	assert.Equal(t, recentSourceMemory, source)
+	assert.Len(t, uids, len(stored))
+	rec, _ = getWebAPI(t, withDefaultTenant(makeRecentOrdersHandler(nil, repo, newTestLogger())), "/api/recent")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	for _, limit := range []string{"0", "-1", "x", "101"} {
+		rec, _ := getWebAPI(t, h, "/api/recent?limit="+limit)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, limit)
+	}
+}
+
+func TestSuggestEndpoint(t *testing.T) {
+	repo := &fakeRepository{orders: map[string]orders.Order{}}
+	c := newTestCache(t)
+	// Часть заказов есть только в базе данных, часть — только в кэше
+	var want []string
+	for i := range 12 {
+		uid := fmt.Sprintf("ab%02d", i)
+		want = append(want, uid)
+		if i%2 == 0 {
+			repo.orders[uid] = orders.Order{OrderUid: uid}
+		} else {
+			c.Set(tenant.Default, orders.Order{OrderUid: uid})
+		}
+	}
+	repo.orders["ac00"] = orders.Order{OrderUid: "ac00"}
+	repo.orders["ab99"] = orders.Order{OrderUid: "ab99", Quarantined: true}
+	c.Set("market-a", orders.Order{OrderUid: "ab-other-tenant"})
+	sort.Strings(want)
+	h := withDefaultTenant(makeSuggestHandler(c, repo, newTestLogger()))
+
+	rec, body := getWebAPI(t, h, "/api/suggest?prefix=AB0")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var uids []string
+	require.NoError(t, json.Unmarshal(body["order_uids"], &uids))
+	assert.Equal(t, want[:maxSuggestions], uids, "cache and db matches are merged, sorted and capped")
+
+	_, body = getWebAPI(t, h, "/api/suggest?prefix=ab1")
+	require.NoError(t, json.Unmarshal(body["order_uids"], &uids))
+	assert.Equal(t, []string{"ab10", "ab11"}, uids)
+
+	_, body = getWebAPI(t, h, "/api/suggest?prefix=zz")
+	assert.JSONEq(t, `[]`, string(body["order_uids"]))
+
+	// Без базы данных подсказки берутся из кэша
+	repo.err = errors.New("connection refused")
+	_, body = getWebAPI(t, h, "/api/suggest?prefix=ab1")
+	require.NoError(t, json.Unmarshal(body["order_uids"], &uids))
+	assert.Equal(t, []string{"ab11"}, uids)
+	rec, _ = getWebAPI(t, h, "/api/suggest?prefix=zz")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	for _, prefix := range []string{"", "a%20b", "a_", fmt.Sprintf("%065d", 0)} {
+		rec, _ := getWebAPI(t, h, "/api/suggest?prefix="+prefix)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, prefix)
+		assert.Contains(t, rec.Body.String(), errCodePrefixInvalid, prefix)
+	}
+}
+
+func TestWebAPIRateLimit(t *testing.T) {
+	limiter := newWebAPILimiter(2)
+	h := withClientRateLimit(limiter, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	request := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/recent", nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, request("10.0.0.1:5000").Code)
+	assert.Equal(t, http.StatusOK, request("10.0.0.1:5001").Code, "the limit is per address, not per connection")
+	rec := request("10.0.0.1:5002")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	assert.Contains(t, rec.Body.String(), errCodeRateLimited)
+	assert.Equal(t, http.StatusOK, request("10.0.0.2:5000").Code)
+}
@@ -0,0 +1,392 @@
+// Описание: Уведомления webhooks о записанных заказах: консьюмер ставит уведомления получателям из webhooks.endpoints
+// в ограниченную очередь в памяти, а фоновые обработчики отправляют JSON заказа POST запросом с подписью HMAC-SHA256,
+// повторяя неудачные попытки с растущей паузой. Уведомления не задерживают и не прерывают запись заказов: при
+// заполненной очереди уведомление отбрасывается, а прекращённая доставка записывается в журнал webhook_failures
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/goroutines"
+	"l0_test_self/internal/jsonpool"
+	"l0_test_self/internal/metrics"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+)
+
+const (
+	// defaultWebhookQueueSize - вместимость очереди, если webhooks.queue_size не задан
+	defaultWebhookQueueSize = 1000
+	// defaultWebhookWorkers - число обработчиков очереди, если webhooks.workers не задан
+	defaultWebhookWorkers = 4
+	// defaultWebhookMaxAttempts - попытки доставки уведомления, если webhooks.max_attempts не задан
+	defaultWebhookMaxAttempts = 5
+	// defaultWebhookBackoff - пауза перед второй попыткой, если webhooks.backoff не задан
+	defaultWebhookBackoff = time.Second
+	// maxWebhookBackoff - наибольшая пауза между попытками
+	maxWebhookBackoff = time.Minute
+	// defaultWebhookTimeout - ограничение одной попытки, если timeout получателя не задан
+	defaultWebhookTimeout = 5 * time.Second
+)
+
+// Заголовки запроса уведомления
+const (
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookDeliveryHeader  = "X-Webhook-Delivery" // идентификатор уведомления, одинаковый во всех попытках
+	webhookTenantHeader    = "X-Webhook-Tenant"
+	webhookSignatureHeader = "X-Webhook-Signature" // "sha256=" и HMAC-SHA256 тела запроса в hex с ключом secret получателя
+)
+
+// signWebhook - значение заголовка X-Webhook-Signature для тела body
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookEndpoint - получатель уведомлений и счётчики доставки ему
+type webhookEndpoint struct {
+	cfg  config.WebhookEndpointConfig
+	name string // адрес без параметров запроса: в них может быть токен, а имя попадает в логи, метрики и журнал
+
+	delivered *metrics.Counter // доставленные уведомления
+	failed    *metrics.Counter // уведомления, доставка которых прекращена
+	retries   *metrics.Counter // повторные попытки
+	dropped   *metrics.Counter // уведомления, не поставленные в заполненную очередь
+
+	mu            sync.Mutex
+	lastError     string
+	lastFailureAt time.Time
+}
+
+// endpointName - адрес получателя rawURL без параметров запроса и фрагмента
+func endpointName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.RawQuery, u.Fragment, u.User = "", "", nil
+	return u.String()
+}
+
+// webhookJob - уведомление одного получателя о событии заказа
+type webhookJob struct {
+	endpoint *webhookEndpoint
+	id       string
+	event    string
+	tenant   string
+	orderUID string
+	body     []byte
+}
+
+// webhookDispatcher - очередь уведомлений и её обработчики. nil выключает уведомления
+type webhookDispatcher struct {
+	endpoints []*webhookEndpoint
+	queue     chan webhookJob
+	workers   int
+	attempts  int
+	backoff   time.Duration
+	client    *http.Client
+	repo      OrderRepository
+	logger    *log.Logger
+	now       func() time.Time
+	seq       atomic.Uint64 // номер последнего уведомления для X-Webhook-Delivery
+}
+
+// newWebhookDispatcher - уведомления по cfg с журналом недоставленных уведомлений в repo; nil, если получатели не заданы
+func newWebhookDispatcher(cfg config.WebhooksConfig, repo OrderRepository, logger *log.Logger) *webhookDispatcher {
+	if len(cfg.Endpoints) == 0 {
+		return nil
+	}
+	queueSize := cfg.QueueSize
+	if queueSize == 0 {
+		queueSize = defaultWebhookQueueSize
+	}
+	workers := cfg.Workers
+	if workers == 0 {
+		workers = defaultWebhookWorkers
+	}
+	attempts := cfg.MaxAttempts
+	if attempts == 0 {
+		attempts = defaultWebhookMaxAttempts
+	}
+	backoff := cfg.Backoff
+	if backoff == 0 {
+		backoff = defaultWebhookBackoff
+	}
+	d := &webhookDispatcher{
+		queue:    make(chan webhookJob, queueSize),
+		workers:  workers,
+		attempts: attempts,
+		backoff:  backoff,
+		// Время попытки ограничивается контекстом запроса по timeout получателя
+		client: &http.Client{},
+		repo:   repo,
+		logger: logger,
+		now:    time.Now,
+	}
+	for _, e := range cfg.Endpoints {
+		d.endpoints = append(d.endpoints, &webhookEndpoint{
+			cfg:       e,
+			name:      endpointName(e.URL),
+			delivered: &metrics.Counter{},
+			failed:    &metrics.Counter{},
+			retries:   &metrics.Counter{},
+			dropped:   &metrics.Counter{},
+		})
+	}
+	return d
+}
+
+// register - регистрирует метрики уведомлений по получателям
+func (d *webhookDispatcher) register(reg *metrics.Registry) {
+	if d == nil {
+		return
+	}
+	byEndpoint := func(counter func(e *webhookEndpoint) *metrics.Counter) func() map[string]float64 {
+		return func() map[string]float64 {
+			values := make(map[string]float64, len(d.endpoints))
+			for _, e := range d.endpoints {
+				values[e.name] += float64(counter(e).Value())
+			}
+			return values
+		}
+	}
+	reg.CounterVecFunc("webhook_deliveries_total", "Webhook notifications delivered, by endpoint.", "endpoint",
+		byEndpoint(func(e *webhookEndpoint) *metrics.Counter { return e.delivered }))
+	reg.CounterVecFunc("webhook_failures_total", "Webhook notifications given up after webhooks.max_attempts or a permanent error, by endpoint.", "endpoint",
+		byEndpoint(func(e *webhookEndpoint) *metrics.Counter { return e.failed }))
+	reg.CounterVecFunc("webhook_dropped_total", "Webhook notifications dropped because the queue was full, by endpoint.", "endpoint",
+		byEndpoint(func(e *webhookEndpoint) *metrics.Counter { return e.dropped }))
+	reg.GaugeFunc("webhook_queue_length", "Webhook notifications waiting in the queue.", func() float64 { return float64(len(d.queue)) })
+}
+
+// notify - ставит в очередь уведомления о событии event заказа order арендатора tenantID всем подписанным получателям.
+// Не блокируется: если очередь заполнена, уведомление отбрасывается и учитывается в счётчике dropped получателя.
+func (d *webhookDispatcher) notify(event, tenantID string, order *orders.Order) {
+	if d == nil {
+		return
+	}
+	var body []byte
+	for _, e := range d.endpoints {
+		if !e.cfg.Subscribed(event) || (e.cfg.Tenant != "" && e.cfg.Tenant != tenantID) {
+			continue
+		}
+		if body == nil {
+			var err error
+			if body, err = jsonpool.Marshal(order); err != nil {
+				d.logger.Printf("webhook: encode order %s: %v", tenant.Key(tenantID, order.OrderUid), err)
+				return
+			}
+		}
+		job := webhookJob{endpoint: e, id: strconv.FormatUint(d.seq.Add(1), 10), event: event, tenant: tenantID, orderUID: order.OrderUid, body: body}
+		select {
+		case d.queue <- job:
+		default:
+			e.dropped.Inc()
+			d.logger.Printf("webhook: queue full, %s notification for order %s to %s dropped", event, tenant.Key(tenantID, order.OrderUid), e.name)
+		}
+	}
+}
+
+// run - обрабатывает очередь workers обработчиками до отмены ctx. Уведомления, оставшиеся в очереди, не доставляются:
+// очередь не переживает перезапуск.
+func (d *webhookDispatcher) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < d.workers; i++ {
+		wg.Add(1)
+		goroutines.Go("webhook worker", ctx.Done(), func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-d.queue:
+					d.deliver(ctx, job)
+				}
+			}
+		})
+	}
+	wg.Wait()
+	if n := len(d.queue); n > 0 {
+		d.logger.Printf("webhook: stopped with %d notifications left in the queue", n)
+	}
+}
+
+// errWebhookStatus - ответ получателя с кодом не из 2xx
+type errWebhookStatus struct{ code int }
+
+func (e errWebhookStatus) Error() string { return fmt.Sprintf("HTTP %d", e.code) }
+
+// permanent - сообщает, что повторная отправка не поможет: получатель отклонил запрос (4xx, кроме 408 и 429)
+func (e errWebhookStatus) permanent() bool {
+	return e.code >= 400 && e.code < 500 && e.code != http.StatusRequestTimeout && e.code != http.StatusTooManyRequests
+}
+
+// deliver - отправляет уведомление, повторяя неудачные попытки не больше attempts раз с паузой backoff, удваивающейся
+// с каждой попыткой. После постоянной ошибки или последней попытки доставка прекращается и записывается в журнал.
+// Попытка, прерванная остановкой сервера, не считается неудачей.
+func (d *webhookDispatcher) deliver(ctx context.Context, job webhookJob) {
+	e := job.endpoint
+	pause := d.backoff
+	for attempt := 1; ; attempt++ {
+		err := d.post(ctx, job)
+		if err == nil {
+			e.delivered.Inc()
+			return
+		}
+		if ctx.Err() != nil {
+			d.logger.Printf("webhook: %s notification for order %s to %s interrupted by shutdown", job.event, tenant.Key(job.tenant, job.orderUID), e.name)
+			return
+		}
+		var status errWebhookStatus
+		if attempt == d.attempts || (errors.As(err, &status) && status.permanent()) {
+			d.giveUp(ctx, job, attempt, err)
+			return
+		}
+		e.retries.Inc()
+		if !sleepCtx(ctx, clock.Real, pause) {
+			return
+		}
+		pause = min(2*pause, maxWebhookBackoff)
+	}
+}
+
+// post - одна попытка доставки уведомления
+func (d *webhookDispatcher) post(ctx context.Context, job webhookJob) error {
+	timeout := job.endpoint.cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultWebhookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.endpoint.cfg.URL, bytes.NewReader(job.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, job.event)
+	req.Header.Set(webhookDeliveryHeader, job.id)
+	req.Header.Set(webhookTenantHeader, job.tenant)
+	req.Header.Set(webhookSignatureHeader, signWebhook(job.endpoint.cfg.Secret, job.body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	// Тело ответа дочитывается ограниченно, чтобы соединение вернулось в пул
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errWebhookStatus{code: resp.StatusCode}
+	}
+	return nil
+}
+
+// giveUp - учитывает прекращённую доставку и записывает её в журнал webhook_failures. Ошибка записи только логируется
+func (d *webhookDispatcher) giveUp(ctx context.Context, job webhookJob, attempts int, err error) {
+	e := job.endpoint
+	now := d.now()
+	e.failed.Inc()
+	e.mu.Lock()
+	e.lastError, e.lastFailureAt = err.Error(), now
+	e.mu.Unlock()
+	d.logger.Printf("webhook: %s notification for order %s to %s failed after %d attempts: %v",
+		job.event, tenant.Key(job.tenant, job.orderUID), e.name, attempts, err)
+
+	opCtx, cancel := opContext(ctx)
+	defer cancel()
+	failure := postgres.WebhookFailure{Tenant: job.tenant, OrderUid: job.orderUID, Event: job.event, Endpoint: e.name,
+		Attempts: attempts, LastError: err.Error(), FailedAt: now}
+	if rerr := d.repo.RecordWebhookFailure(opCtx, failure); rerr != nil {
+		d.logger.Printf("webhook: record failure of order %s: %v", tenant.Key(job.tenant, job.orderUID), rerr)
+	}
+}
+
+// webhookEndpointStatus - счётчики получателя в ответе GET /admin/webhooks/status
+type webhookEndpointStatus struct {
+	URL           string     `json:"url"`
+	Events        []string   `json:"events,omitempty"` // пусто — все события
+	Tenant        string     `json:"tenant,omitempty"` // пусто — все арендаторы
+	Delivered     uint64     `json:"delivered"`
+	Failed        uint64     `json:"failed"`
+	Retries       uint64     `json:"retries"`
+	Dropped       uint64     `json:"dropped"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastFailureAt *time.Time `json:"last_failure_at,omitempty"`
+}
+
+// webhooksStatusResponse - ответ GET /admin/webhooks/status
+type webhooksStatusResponse struct {
+	Enabled       bool                    `json:"enabled"`
+	QueueLength   int                     `json:"queue_length"`
+	QueueCapacity int                     `json:"queue_capacity"`
+	Endpoints     []webhookEndpointStatus `json:"endpoints"`
+}
+
+// status - состояние очереди и счётчики получателей в порядке конфигурации
+func (d *webhookDispatcher) status() webhooksStatusResponse {
+	resp := webhooksStatusResponse{Endpoints: []webhookEndpointStatus{}}
+	if d == nil {
+		return resp
+	}
+	resp.Enabled, resp.QueueLength, resp.QueueCapacity = true, len(d.queue), cap(d.queue)
+	for _, e := range d.endpoints {
+		s := webhookEndpointStatus{URL: e.name, Events: e.cfg.Events, Tenant: e.cfg.Tenant,
+			Delivered: e.delivered.Value(), Failed: e.failed.Value(), Retries: e.retries.Value(), Dropped: e.dropped.Value()}
+		e.mu.Lock()
+		if !e.lastFailureAt.IsZero() {
+			at := e.lastFailureAt.UTC()
+			s.LastError, s.LastFailureAt = e.lastError, &at
+		}
+		e.mu.Unlock()
+		resp.Endpoints = append(resp.Endpoints, s)
+	}
+	return resp
+}
+
+// makeWebhooksStatusHandler - HTTP обработчик, возвращающий счётчики доставки уведомлений по получателям
+func makeWebhooksStatusHandler(d *webhookDispatcher, logger *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(d.status()); err != nil {
+			logger.Printf("[%s] encode error: %v", requestIDFromContext(r.Context()), err)
+		}
+	}
+}
+
+// notifyBatch - ставит в очередь уведомления о заказах пачки batch, записанных InsertOrders из list. Как и
+// подтверждения (batchAcks), пропускаются заказы, уже сохранённые раньше, и заказы сверх ограничения покупателя.
+func (c *consumer) notifyBatch(batch []pendingMessage, list []postgres.OrderRecord) {
+	if c.webhooks == nil {
+		return
+	}
+	i := 0
+	for _, p := range batch {
+		if !p.ok {
+			continue
+		}
+		if rec := list[i]; !rec.Order.StoredAt.IsZero() && !p.throttled {
+			c.webhooks.notify(config.WebhookEventOrderStored, rec.Tenant, &rec.Order)
+		}
+		i++
+	}
+}
@@ -0,0 +1,262 @@
+// Описание: Тесты уведомлений webhooks: подпись и доставка заказа, повтор после временной ошибки, прекращение
+// доставки с записью в журнал, фильтры получателей, переполнение очереди, уведомления консьюмера и
+// GET /admin/webhooks/status
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookRequest - запрос, полученный тестовым получателем
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver - тестовый получатель, отвечающий кодами statuses по очереди (после них — 200)
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []webhookRequest
+	statuses []int
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	t.Helper()
+	rcv := &webhookReceiver{statuses: statuses}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rcv.mu.Lock()
+		rcv.requests = append(rcv.requests, webhookRequest{header: r.Header.Clone(), body: body})
+		status := http.StatusOK
+		if len(rcv.statuses) > 0 {
+			status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+		}
+		rcv.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (r *webhookReceiver) received() []webhookRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]webhookRequest(nil), r.requests...)
+}
+
+// startTestWebhooks - запускает уведомления получателям endpoints с тремя попытками и короткой паузой
+func startTestWebhooks(t *testing.T, repo OrderRepository, endpoints ...config.WebhookEndpointConfig) *webhookDispatcher {
+	t.Helper()
+	d := newWebhookDispatcher(config.WebhooksConfig{Endpoints: endpoints, MaxAttempts: 3, Backoff: time.Millisecond}, repo, newTestLogger())
+	require.NotNil(t, d)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return d
+}
+
+func TestWebhookDeliversSignedOrder(t *testing.T) {
+	rcv := newWebhookReceiver(t)
+	d := startTestWebhooks(t, &fakeRepository{}, config.WebhookEndpointConfig{URL: rcv.URL, Secret: "s3cret"})
+
+	order := orders.Order{OrderUid: "order-1", TrackNumber: "WBILMTESTTRACK"}
+	d.notify(config.WebhookEventOrderStored, tenant.Default, &order)
+	require.Eventually(t, func() bool { return d.endpoints[0].delivered.Value() == 1 }, 5*time.Second, time.Millisecond)
+
+	reqs := rcv.received()
+	require.Len(t, reqs, 1)
+	req := reqs[0]
+	assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+	assert.Equal(t, config.WebhookEventOrderStored, req.header.Get(webhookEventHeader))
+	assert.Equal(t, tenant.Default, req.header.Get(webhookTenantHeader))
+	assert.NotEmpty(t, req.header.Get(webhookDeliveryHeader))
+
+	// Получатель проверяет подпись, вычисляя HMAC тела запроса своим ключом
+	signature := req.header.Get(webhookSignatureHeader)
+	assert.True(t, hmac.Equal([]byte(signWebhook("s3cret", req.body)), []byte(signature)))
+	assert.False(t, hmac.Equal([]byte(signWebhook("other", req.body)), []byte(signature)))
+
+	var got orders.Order
+	require.NoError(t, json.Unmarshal(req.body, &got))
+	assert.Equal(t, order.OrderUid, got.OrderUid)
+	assert.Equal(t, order.TrackNumber, got.TrackNumber)
+}
+
+func TestWebhookRetriesTransientErrors(t *testing.T) {
+	rcv := newWebhookReceiver(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	repo := &fakeRepository{}
+	d := startTestWebhooks(t, repo, config.WebhookEndpointConfig{URL: rcv.URL, Secret: "s"})
+
+	d.notify(config.WebhookEventOrderStored, tenant.Default, &orders.Order{OrderUid: "order-1"})
+	require.Eventually(t, func() bool { return d.endpoints[0].delivered.Value() == 1 }, 5*time.Second, time.Millisecond)
+
+	reqs := rcv.received()
+	require.Len(t, reqs, 3)
+	assert.Equal(t, reqs[0].header.Get(webhookDeliveryHeader), reqs[2].header.Get(webhookDeliveryHeader), "retries keep the delivery id")
+	assert.Equal(t, uint64(2), d.endpoints[0].retries.Value())
+	assert.Zero(t, d.endpoints[0].failed.Value())
+	assert.Empty(t, repo.webhookFailures)
+}
+
+func TestWebhookGivesUpAndRecordsFailure(t *testing.T) {
+	failing := newWebhookReceiver(t, 500, 500, 500)
+	rejecting := newWebhookReceiver(t, http.StatusBadRequest)
+	repo := &fakeRepository{}
+	d := startTestWebhooks(t, repo,
+		config.WebhookEndpointConfig{URL: failing.URL + "/hook?token=secret", Secret: "s"},
+		config.WebhookEndpointConfig{URL: rejecting.URL, Secret: "s"})
+
+	d.notify(config.WebhookEventOrderStored, tenant.Default, &orders.Order{OrderUid: "order-1"})
+	require.Eventually(t, func() bool {
+		return d.endpoints[0].failed.Value() == 1 && d.endpoints[1].failed.Value() == 1
+	}, 5*time.Second, time.Millisecond)
+
+	assert.Len(t, failing.received(), 3, "max_attempts attempts")
+	assert.Len(t, rejecting.received(), 1, "a 4xx response is not retried")
+	assert.Zero(t, d.endpoints[1].retries.Value())
+
+	repo.mu.Lock()
+	failures := append([]postgres.WebhookFailure(nil), repo.webhookFailures...)
+	repo.mu.Unlock()
+	require.Len(t, failures, 2)
+	sort.Slice(failures, func(i, j int) bool { return failures[i].Attempts > failures[j].Attempts })
+	assert.Equal(t, failing.URL+"/hook", failures[0].Endpoint, "the query string is not recorded")
+	assert.Equal(t, 3, failures[0].Attempts)
+	assert.Equal(t, "HTTP 500", failures[0].LastError)
+	assert.Equal(t, "order-1", failures[0].OrderUid)
+	assert.Equal(t, tenant.Default, failures[0].Tenant)
+	assert.Equal(t, config.WebhookEventOrderStored, failures[0].Event)
+	assert.Equal(t, 1, failures[1].Attempts)
+	assert.Equal(t, "HTTP 400", failures[1].LastError)
+}
+
+func TestWebhookNotifyFiltersAndNeverBlocks(t *testing.T) {
+	cfg := config.WebhooksConfig{QueueSize: 1, Endpoints: []config.WebhookEndpointConfig{
+		{URL: "http://all.example.com", Secret: "s"},
+		{URL: "http://acme.example.com", Secret: "s", Tenant: "acme"},
+		{URL: "http://other.example.com", Secret: "s", Events: []string{"order.deleted"}},
+	}}
+	d := newWebhookDispatcher(cfg, &fakeRepository{}, newTestLogger())
+	assert.Nil(t, newWebhookDispatcher(config.WebhooksConfig{}, &fakeRepository{}, newTestLogger()), "no endpoints disable webhooks")
+
+	// Обработчики не запущены: первое уведомление занимает очередь, остальные отбрасываются без ожидания
+	done := make(chan struct{})
+	go func() {
+		d.notify(config.WebhookEventOrderStored, "acme", &orders.Order{OrderUid: "order-1"})
+		d.notify(config.WebhookEventOrderStored, tenant.Default, &orders.Order{OrderUid: "order-2"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("notify blocked on a full queue")
+	}
+
+	job := <-d.queue
+	assert.Equal(t, "http://all.example.com", job.endpoint.name)
+	assert.Equal(t, "order-1", job.orderUID)
+	assert.Equal(t, uint64(1), d.endpoints[0].dropped.Value())
+	assert.Equal(t, uint64(1), d.endpoints[1].dropped.Value(), "the acme endpoint gets acme orders only")
+	assert.Zero(t, d.endpoints[2].dropped.Value(), "unsubscribed endpoints are not notified")
+
+	var nilDispatcher *webhookDispatcher
+	nilDispatcher.notify(config.WebhookEventOrderStored, tenant.Default, &orders.Order{OrderUid: "order-3"})
+}
+
+func TestConsumerNotifiesWebhooks(t *testing.T) {
+	for _, mode := range []string{config.PipelineModeSync, config.PipelineModeBatched} {
+		t.Run(mode, func(t *testing.T) {
+			msgs, uids, repo := ackTestMessages(t)
+			reader := &sliceReader{msgs: msgs}
+			cfg := newConsumerTestConfig()
+			if mode == config.PipelineModeBatched {
+				cfg = newBatchedTestConfig(4, time.Hour)
+			}
+			cfg = withMaxAttempts(cfg, 1)
+			rcv := newWebhookReceiver(t)
+			monitor := newConsumerMonitor(cfg)
+			monitor.webhooks = startTestWebhooks(t, repo, config.WebhookEndpointConfig{URL: rcv.URL, Secret: "s"})
+			ctx, cancel := context.WithCancel(context.Background())
+			wg := startKafkaConsumer(ctx, reader, &fakeWriter{}, repo, newTestCache(t), newTestLogger(), cfg, monitor)
+
+			require.Eventually(t, func() bool { return len(reader.committedOffsets()) == 4 }, 5*time.Second, time.Millisecond)
+			require.Eventually(t, func() bool { return monitor.webhooks.endpoints[0].delivered.Value() == 2 }, 5*time.Second, time.Millisecond)
+			cancel()
+			wg.Wait()
+
+			var got []string
+			for _, req := range rcv.received() {
+				var order orders.Order
+				require.NoError(t, json.Unmarshal(req.body, &order))
+				got = append(got, order.OrderUid)
+			}
+			sort.Strings(got)
+			want := []string{uids[0], uids[2]}
+			sort.Strings(want)
+			assert.Equal(t, want, got, "one notification per stored order, none for the invalid and the dead-lettered message")
+		})
+	}
+}
+
+func TestWebhooksStatusHandler(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	defer srv.Close()
+	d := startTestWebhooks(t, &fakeRepository{}, config.WebhookEndpointConfig{URL: srv.URL, Secret: "s", Events: []string{config.WebhookEventOrderStored}})
+	d.notify(config.WebhookEventOrderStored, tenant.Default, &orders.Order{OrderUid: "order-1"})
+	d.notify(config.WebhookEventOrderStored, tenant.Default, &orders.Order{OrderUid: "order-2"})
+	require.Eventually(t, func() bool {
+		e := d.endpoints[0]
+		return e.failed.Value()+e.delivered.Value() == 2
+	}, 5*time.Second, time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	makeWebhooksStatusHandler(d, newTestLogger())(rec, httptest.NewRequest(http.MethodGet, "/admin/webhooks/status", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp webhooksStatusResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.True(t, resp.Enabled)
+	assert.Equal(t, defaultWebhookQueueSize, resp.QueueCapacity)
+	require.Len(t, resp.Endpoints, 1)
+	e := resp.Endpoints[0]
+	assert.Equal(t, srv.URL, e.URL)
+	assert.Equal(t, []string{config.WebhookEventOrderStored}, e.Events)
+	assert.Equal(t, uint64(1), e.Delivered)
+	assert.Equal(t, uint64(1), e.Failed)
+	assert.Equal(t, "HTTP 410", e.LastError)
+	assert.NotNil(t, e.LastFailureAt)
+
+	rec = httptest.NewRecorder()
+	makeWebhooksStatusHandler(nil, newTestLogger())(rec, httptest.NewRequest(http.MethodGet, "/admin/webhooks/status", nil))
+	assert.JSONEq(t, `{"enabled":false,"queue_length":0,"queue_capacity":0,"endpoints":[]}`, rec.Body.String())
+}
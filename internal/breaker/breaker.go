@@ -0,0 +1,244 @@
+// Package breaker реализует автоматический выключатель (circuit breaker) для защиты перегруженной зависимости
+// от дополнительной нагрузки: после превышения доли ошибок вызовы отклоняются без обращения к зависимости.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"l0_test_self/internal/clock"
+)
+
+// State - состояние выключателя.
+type State int
+
+const (
+	StateClosed   State = iota // вызовы разрешены, результаты учитываются в скользящем окне
+	StateOpen                  // вызовы отклоняются до истечения Cooldown
+	StateHalfOpen              // разрешено ограниченное число пробных вызовов
+)
+
+// String возвращает название состояния.
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("state(%d)", int(s))
+	}
+}
+
+// ErrOpen - вызов отклонён, так как выключатель разомкнут. Конкретная ошибка имеет тип *OpenError.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// OpenError - ошибка отклонённого вызова с рекомендуемой паузой перед повтором.
+type OpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%v: retry after %s", ErrOpen, e.RetryAfter)
+}
+
+// Is позволяет проверять ошибку через errors.Is(err, ErrOpen).
+func (e *OpenError) Is(target error) bool { return target == ErrOpen }
+
+// Config содержит параметры выключателя. Нулевые значения заменяются значениями по умолчанию.
+type Config struct {
+	WindowSize       int           // число последних вызовов, по которым считается доля ошибок (по умолчанию 20)
+	MinRequests      int           // минимальное число вызовов в окне для размыкания (по умолчанию 10)
+	FailureRate      float64       // доля ошибок в окне, при которой выключатель размыкается (по умолчанию 0.5)
+	Cooldown         time.Duration // время в разомкнутом состоянии до пробных вызовов (по умолчанию 5s)
+	HalfOpenRequests int           // число успешных пробных вызовов для замыкания (по умолчанию 1)
+	Clock            clock.Clock   // часы отсчёта Cooldown (по умолчанию clock.Real)
+
+	// IsFailure определяет, считается ли ошибка отказом зависимости; nil — любая ошибка является отказом.
+	// Ошибка context.Canceled (клиент прервал запрос) не учитывается никогда.
+	IsFailure func(err error) bool
+	// OnStateChange вызывается при смене состояния (под блокировкой выключателя, поэтому не должен к нему обращаться).
+	OnStateChange func(from, to State)
+}
+
+// Snapshot - текущее состояние выключателя для диагностики.
+type Snapshot struct {
+	State      string  `json:"state"`
+	Requests   int     `json:"requests"`    // вызовов в скользящем окне
+	Failures   int     `json:"failures"`    // отказов в скользящем окне
+	RetryAfter float64 `json:"retry_after"` // секунд до пробных вызовов, если выключатель разомкнут
+}
+
+// Breaker - автоматический выключатель с тремя состояниями: closed, open и half-open.
+// Breaker безопасен для конкурентного использования.
+type Breaker struct {
+	mu  sync.Mutex
+	cfg Config
+	now func() time.Time
+
+	state      State
+	generation uint64 // увеличивается при каждой смене состояния, чтобы игнорировать запоздавшие результаты
+
+	// скользящее окно результатов в состоянии closed: true — отказ
+	outcomes []bool
+	next     int
+	count    int
+	failures int
+
+	openedAt  time.Time
+	probes    int // пробных вызовов в процессе
+	successes int // успешных пробных вызовов
+}
+
+// New создает замкнутый выключатель.
+func New(cfg Config) *Breaker {
+	if cfg.WindowSize <= 0 {
+		cfg.WindowSize = 20
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 10
+	}
+	if cfg.MinRequests > cfg.WindowSize {
+		cfg.MinRequests = cfg.WindowSize
+	}
+	if cfg.FailureRate <= 0 || cfg.FailureRate > 1 {
+		cfg.FailureRate = 0.5
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 5 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = clock.Real
+	}
+	return &Breaker{
+		cfg:      cfg,
+		now:      cfg.Clock.Now,
+		outcomes: make([]bool, cfg.WindowSize),
+	}
+}
+
+// Allow запрашивает разрешение на вызов. Если вызов разрешён, после его завершения нужно вызвать done
+// с результатом вызова; иначе возвращается *OpenError.
+func (b *Breaker) Allow() (done func(err error), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen {
+		if wait := b.cfg.Cooldown - b.now().Sub(b.openedAt); wait > 0 {
+			return nil, &OpenError{RetryAfter: wait}
+		}
+		b.setStateLocked(StateHalfOpen)
+	}
+	if b.state == StateHalfOpen {
+		if b.probes >= b.cfg.HalfOpenRequests-b.successes {
+			return nil, &OpenError{RetryAfter: b.cfg.Cooldown}
+		}
+		b.probes++
+	}
+
+	gen := b.generation
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { b.record(gen, err) })
+	}, nil
+}
+
+// record учитывает результат вызова, разрешённого в поколении gen.
+func (b *Breaker) record(gen uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.generation {
+		return
+	}
+
+	ignored := errors.Is(err, context.Canceled)
+	failure := !ignored && err != nil && (b.cfg.IsFailure == nil || b.cfg.IsFailure(err))
+
+	switch b.state {
+	case StateClosed:
+		if ignored {
+			return
+		}
+		if b.count == len(b.outcomes) {
+			if b.outcomes[b.next] {
+				b.failures--
+			}
+		} else {
+			b.count++
+		}
+		b.outcomes[b.next] = failure
+		if failure {
+			b.failures++
+		}
+		b.next = (b.next + 1) % len(b.outcomes)
+
+		if b.count >= b.cfg.MinRequests && float64(b.failures)/float64(b.count) >= b.cfg.FailureRate {
+			b.setStateLocked(StateOpen)
+		}
+	case StateHalfOpen:
+		b.probes--
+		switch {
+		case ignored:
+		case failure:
+			b.setStateLocked(StateOpen)
+		default:
+			b.successes++
+			if b.successes >= b.cfg.HalfOpenRequests {
+				b.setStateLocked(StateClosed)
+			}
+		}
+	}
+}
+
+// setStateLocked переводит выключатель в состояние to и сбрасывает счётчики.
+func (b *Breaker) setStateLocked(to State) {
+	from := b.state
+	b.state = to
+	b.generation++
+	b.probes, b.successes = 0, 0
+	switch to {
+	case StateOpen:
+		b.openedAt = b.now()
+	case StateClosed:
+		b.next, b.count, b.failures = 0, 0, 0
+		clear(b.outcomes)
+	}
+	if b.cfg.OnStateChange != nil && from != to {
+		b.cfg.OnStateChange(from, to)
+	}
+}
+
+// State возвращает текущее состояние. Разомкнутый выключатель с истёкшим Cooldown сообщается как half-open.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stateLocked()
+}
+
+func (b *Breaker) stateLocked() State {
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cfg.Cooldown {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// Snapshot возвращает состояние и счётчики выключателя.
+func (b *Breaker) Snapshot() Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := Snapshot{State: b.stateLocked().String(), Requests: b.count, Failures: b.failures}
+	if b.state == StateOpen {
+		if wait := b.cfg.Cooldown - b.now().Sub(b.openedAt); wait > 0 {
+			s.RetryAfter = wait.Seconds()
+		}
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errDown = errors.New("db is down")
+
+// fakeClock - управляемые тестом часы
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(cfg Config) (*Breaker, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	b := New(cfg)
+	b.now = clock.now
+	return b, clock
+}
+
+// call выполняет вызов с результатом err, если выключатель его разрешает
+func call(b *Breaker, err error) error {
+	done, openErr := b.Allow()
+	if openErr != nil {
+		return openErr
+	}
+	done(err)
+	return nil
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	var transitions []string
+	b, clock := newTestBreaker(Config{
+		WindowSize:       4,
+		MinRequests:      4,
+		FailureRate:      0.5,
+		Cooldown:         10 * time.Second,
+		HalfOpenRequests: 2,
+		OnStateChange: func(from, to State) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	})
+
+	// Ниже MinRequests выключатель не размыкается даже при сплошных ошибках
+	require.NoError(t, call(b, errDown))
+	require.NoError(t, call(b, nil))
+	require.NoError(t, call(b, nil))
+	assert.Equal(t, StateClosed, b.State())
+	require.NoError(t, call(b, errDown))
+	assert.Equal(t, StateOpen, b.State(), "2 of 4 failed reaches the 0.5 failure rate")
+
+	err := call(b, nil)
+	require.ErrorIs(t, err, ErrOpen)
+	var open *OpenError
+	require.ErrorAs(t, err, &open)
+	assert.Equal(t, 10*time.Second, open.RetryAfter)
+
+	clock.advance(4 * time.Second)
+	require.ErrorAs(t, call(b, nil), &open)
+	assert.Equal(t, 6*time.Second, open.RetryAfter)
+
+	// После Cooldown разрешены пробные вызовы; неудачная проба снова размыкает выключатель
+	clock.advance(6 * time.Second)
+	assert.Equal(t, StateHalfOpen, b.State())
+	require.NoError(t, call(b, errDown))
+	assert.Equal(t, StateOpen, b.State())
+
+	clock.advance(10 * time.Second)
+	done1, err := b.Allow()
+	require.NoError(t, err)
+	done2, err := b.Allow()
+	require.NoError(t, err)
+	_, err = b.Allow()
+	require.ErrorIs(t, err, ErrOpen, "only HalfOpenRequests probes may run concurrently")
+	done1(nil)
+	assert.Equal(t, StateHalfOpen, b.State())
+	done2(nil)
+	assert.Equal(t, StateClosed, b.State())
+
+	assert.Equal(t, []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}, transitions)
+	assert.Equal(t, Snapshot{State: "closed"}, b.Snapshot())
+}
+
+func TestBreakerSlidingWindow(t *testing.T) {
+	b, _ := newTestBreaker(Config{WindowSize: 4, MinRequests: 4, FailureRate: 0.75})
+
+	for _, err := range []error{errDown, errDown, nil, nil, nil} {
+		require.NoError(t, call(b, err))
+	}
+	// В окне остались nil, nil, nil и одна ошибка из первых двух вытеснена
+	assert.Equal(t, Snapshot{State: "closed", Requests: 4, Failures: 1}, b.Snapshot())
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, call(b, errDown))
+	}
+	assert.Equal(t, StateOpen, b.State())
+}
+
+func TestBreakerIgnoresNonFailures(t *testing.T) {
+	errNotFound := errors.New("not found")
+	b, _ := newTestBreaker(Config{
+		WindowSize:  2,
+		MinRequests: 2,
+		FailureRate: 0.5,
+		IsFailure:   func(err error) bool { return !errors.Is(err, errNotFound) },
+	})
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, call(b, errNotFound))
+		require.NoError(t, call(b, context.Canceled))
+	}
+	assert.Equal(t, StateClosed, b.State())
+	assert.Equal(t, 2, b.Snapshot().Requests, "canceled calls are not counted")
+	assert.Zero(t, b.Snapshot().Failures)
+}
+
+func TestBreakerIgnoresResultsFromPreviousState(t *testing.T) {
+	b, clock := newTestBreaker(Config{WindowSize: 1, MinRequests: 1, FailureRate: 1, Cooldown: time.Second})
+
+	slow, err := b.Allow()
+	require.NoError(t, err)
+	require.NoError(t, call(b, errDown))
+	require.Equal(t, StateOpen, b.State())
+
+	clock.advance(time.Second)
+	probe, err := b.Allow()
+	require.NoError(t, err)
+
+	// Запоздавшая ошибка вызова, начатого до размыкания, не влияет на пробу
+	slow(errDown)
+	assert.Equal(t, StateHalfOpen, b.State())
+	probe(nil)
+	assert.Equal(t, StateClosed, b.State())
+}
@@ -1,93 +1,164 @@
 // Package cache реализует кэш для заказов с поддержкой LRU и TTL.
+// Заказы хранятся по ключам с префиксом арендатора (tenant.Key), поэтому одинаковые идентификаторы заказов
+// разных арендаторов не пересекаются.
 package cache
 
 import (
 	"container/list"
 	"errors"
 	"hash/fnv"
+	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/goroutines"
+	"l0_test_self/internal/ids"
+	"l0_test_self/internal/jsonpool"
+	"l0_test_self/internal/tenant"
 	"l0_test_self/models/orders"
 )
 
 // orderEntry представляет собой элемент кэша, который хранит заказ и метаданные.
 type orderEntry struct {
-	key       string
+	key       string // tenant.Key(tenant, value.OrderUid)
+	tenant    string
 	value     orders.Order
 	createdAt time.Time
-	elem      *list.Element
+	version   int64  // версия данных для SetIfNewer, 0 — версия неизвестна
+	encoded   []byte // JSON заказа для GetJSON, nil — ещё не сериализован; после записи не изменяется
+	gen       uint64 // счётчик изменений value: сериализация сохраняется, только если заказ не изменился за время кодирования
+	pinned    bool   // закреплён Pin: не вытесняется по LRU и TTL
+	// accessedAt - время последней записи или чтения заказа; по нему очистка понижает холодные записи (WithDemoteAfter)
+	accessedAt time.Time
+	demoted    bool // понижена до заголовка: товары удалены, Get считает запись отсутствующей
+	elem       *list.Element
 }
 
 // Shard представляет собой отдельный сегмент кэша, который использует блокировку для обеспечения потокобезопасности.
 type shard struct {
-	mu    sync.RWMutex
-	items map[string]*orderEntry
-	lru   *list.List
+	mu      sync.RWMutex
+	items   map[string]*orderEntry
+	lru     *list.List
+	cap     int                  // максимальное число элементов в шарде, 0 — без ограничения
+	retired bool                 // записи перенесены Resize в новую таблицу шардов, изменения нужно выполнять в ней
+	missing map[string]time.Time // ключи заказов, отсутствие которых подтверждено, со сроком действия; nil — пусто
+
+	accesses atomic.Uint64 // чтений (Get, GetJSON) и записей (Set и варианты) шарда с создания таблицы
+}
+
+// maxMissingPerShard - наибольшее число отсутствующих заказов, запоминаемых шардом: запросы несуществующих
+// идентификаторов не должны неограниченно занимать память
+const maxMissingPerShard = 1024
+
+// shardTable - массив шардов кэша. Resize не изменяет таблицу, а заменяет её новой.
+type shardTable struct {
+	shards []*shard
+	mask   uint32
 }
 
 // OrderCache представляет собой кэш заказов, который использует шардирование для повышения производительности и масштабируемости.
 type OrderCache struct {
-	shards         []*shard
-	mask           uint32
-	perShardCap    int
+	tbl            atomic.Pointer[shardTable]
+	resizeMu       sync.Mutex // упорядочивает конкурентные вызовы Resize
+	maxItems       int
 	ttl            time.Duration
 	cleanupEvery   time.Duration
+	eviction       EvictionPolicy // EvictFIFO: чтения и обновления не меняют порядок вытеснения
 	stopCh         chan struct{}
+	stopOnce       sync.Once
 	cleanupStarted sync.Once
+	cleanupMu      sync.Mutex   // не допускает одновременных проходов очистки: фонового и RunCleanup
+	keepJSON       atomic.Bool  // хранить сериализованный JSON заказов для GetJSON
+	missingTTL     atomic.Int64 // срок, в течение которого MarkMissing помнит отсутствие заказа; 0 — не помнит
+	maxPinned      atomic.Int64 // наибольшее число закреплённых записей
+	pinned         atomic.Int64 // число закреплённых записей
+	demoteAfter    time.Duration
+	demoted        atomic.Int64  // число пониженных записей
+	demotions      atomic.Uint64 // понижений за всё время
+	repromotions   atomic.Uint64 // возвращений пониженных записей к полному виду
+	l1             *l1Cache      // слой горячих заказов перед шардами (WithL1); nil — выключен
+	clock          clock.Clock   // время TTL, отметок отсутствия, понижения и L1, тикер фоновой очистки
 }
 
+// DefaultMaxPinned - наибольшее число закреплённых записей (Pin), если SetMaxPinned не вызывался
+const DefaultMaxPinned = 100
+
+var (
+	// ErrNotCached возвращается Pin, если заказа нет в кэше или он устарел: заказ нужно сначала загрузить.
+	ErrNotCached = errors.New("order is not cached")
+	// ErrPinLimit возвращается Pin, если закреплено уже SetMaxPinned записей.
+	ErrPinLimit = errors.New("pinned entries limit reached")
+)
+
 // New создает новый экземпляр OrderCache с заданным количеством шардов, максимальным количеством элементов, временем жизни элементов и интервалом очистки.
+// Количество шардов округляется вверх до степени двойки, а если maxItems меньше получившегося числа шардов —
+// уменьшается до наибольшей степени двойки, не превышающей maxItems. Ёмкость распределяется между шардами так,
+// что сумма их лимитов в точности равна maxItems, поэтому общий лимит соблюдается строго.
+// New сохранён для совместимости и равносилен NewWithOptions с WithShards, WithMaxItems, WithTTL и WithCleanupInterval.
 func New(shardCount int, maxItems int, ttl time.Duration, cleanupInterval time.Duration) (*OrderCache, error) {
-	if shardCount <= 0 {
-		return nil, errors.New("shardCount must be > 0")
-	}
-	if maxItems < 0 {
-		return nil, errors.New("maxItems must be >= 0")
-	}
-	if ttl < 0 {
-		return nil, errors.New("ttl must be >= 0")
-	}
-	if cleanupInterval < 0 {
-		return nil, errors.New("cleanupInterval must be >= 0")
-	}
-	if maxItems > 0 && maxItems < shardCount {
-		return nil, errors.New("maxItems must be >= shardCount (or 0 for unlimited)")
-	}
+	return NewWithOptions(WithShards(shardCount), WithMaxItems(maxItems), WithTTL(ttl), WithCleanupInterval(cleanupInterval))
+}
 
-	// round shards to power of two
-	sc := 1
-	for sc < shardCount {
-		sc <<= 1
+// AutoShardCount возвращает число шардов для автоматического выбора: 4 шарда на каждый процессор, доступный
+// планировщику (runtime.GOMAXPROCS), с округлением вверх до степени двойки.
+func AutoShardCount() int {
+	return nextPowerOfTwo(4 * runtime.GOMAXPROCS(0))
+}
+
+// nextPowerOfTwo возвращает наименьшую степень двойки, не меньшую n.
+func nextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
 	}
+	return p
+}
 
-	c := &OrderCache{
-		shards:       make([]*shard, sc),
-		mask:         uint32(sc - 1),
-		ttl:          ttl,
-		cleanupEvery: cleanupInterval,
-		stopCh:       make(chan struct{}),
+// newShardTable создает пустую таблицу шардов по правилам New: число шардов округляется вверх до степени двойки,
+// но не превышает maxItems, а ёмкость maxItems распределяется между шардами без остатка.
+func newShardTable(shardCount, maxItems int) *shardTable {
+	sc := nextPowerOfTwo(shardCount)
+	// каждому шарду нужна ёмкость хотя бы в один элемент
+	for maxItems > 0 && sc > maxItems {
+		sc >>= 1
 	}
+
+	t := &shardTable{shards: make([]*shard, sc), mask: uint32(sc - 1)}
 	for i := 0; i < sc; i++ {
-		c.shards[i] = &shard{
+		t.shards[i] = &shard{
 			items: make(map[string]*orderEntry),
 			lru:   list.New(),
 		}
 	}
 	if maxItems > 0 {
-		per := maxItems / sc
-		if per == 0 {
-			per = 1
+		// остаток от деления распределяется по одному элементу между первыми шардами
+		per, rem := maxItems/sc, maxItems%sc
+		for i, s := range t.shards {
+			s.cap = per
+			if i < rem {
+				s.cap++
+			}
 		}
-		c.perShardCap = per
-	}
-	if c.ttl > 0 && c.cleanupEvery <= 0 {
-		c.cleanupEvery = time.Minute
 	}
-	if c.ttl > 0 || c.perShardCap > 0 {
-		c.startCleaner()
+	return t
+}
+
+// touchLocked отмечает использование записи ent шарда s: по политике EvictLRU запись переносится в конец очереди
+// вытеснения. Вызывается под блокировкой шарда на запись.
+func (c *OrderCache) touchLocked(s *shard, ent *orderEntry) {
+	if c.eviction == EvictLRU {
+		s.lru.MoveToBack(ent.elem)
 	}
-	return c, nil
+}
+
+// shardFor вычисляет шард таблицы для данного ключа, используя хеш-функцию FNV-1a.
+func (t *shardTable) shardFor(key string) *shard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return t.shards[h.Sum32()&t.mask]
 }
 
 // startCleaner запускает фоновый процесс для периодической очистки кэша от устаревших и наименее используемых элементов.
@@ -96,135 +167,738 @@ func (c *OrderCache) startCleaner() {
 		if c.cleanupEvery <= 0 {
 			return
 		}
-		ticker := time.NewTicker(c.cleanupEvery)
-		go func() {
+		ticker := c.clock.NewTicker(c.cleanupEvery)
+		goroutines.Go("cache cleaner", c.stopCh, func() {
 			defer ticker.Stop()
 			for {
 				select {
-				case <-ticker.C:
-					c.evictExpired()
+				case <-ticker.C():
+					// Если в этот момент выполняется очистка, запущенная RunCleanup, период пропускается
+					if c.cleanupMu.TryLock() {
+						c.cleanup()
+						c.cleanupMu.Unlock()
+					}
 				case <-c.stopCh:
 					return
 				}
 			}
-		}()
+		})
 	})
 }
 
-// Close останавливает фоновый процесс очистки и закрывает кэш.
-func (c *OrderCache) Close() { close(c.stopCh) }
+// Close останавливает фоновый процесс очистки и закрывает кэш. Повторный вызов ничего не делает.
+func (c *OrderCache) Close() { c.stopOnce.Do(func() { close(c.stopCh) }) }
 
-// shardFor вычисляет шард для данного ключа, используя хеш-функцию FNV-1a.
-func (c *OrderCache) shardFor(key string) *shard {
-	h := fnv.New32a()
-	_, _ = h.Write([]byte(key))
-	idx := h.Sum32() & c.mask
-	return c.shards[idx]
+// table возвращает текущую таблицу шардов.
+func (c *OrderCache) table() *shardTable { return c.tbl.Load() }
+
+// lockShard возвращает шард ключа с захваченной блокировкой на запись. Если шард успел вывести из работы
+// конкурентный Resize, поиск повторяется в новой таблице.
+func (c *OrderCache) lockShard(key string) *shard {
+	for {
+		s := c.table().shardFor(key)
+		s.mu.Lock()
+		if !s.retired {
+			return s
+		}
+		s.mu.Unlock()
+	}
 }
 
-// Set добавляет или обновляет заказ в кэше. Если заказ уже существует, он обновляется, иначе добавляется новый.
-func (c *OrderCache) Set(o orders.Order) {
-	s := c.shardFor(o.OrderUid)
-	now := time.Now()
-	s.mu.Lock()
-	if ent, ok := s.items[o.OrderUid]; ok {
+// ShardCount возвращает текущее число шардов кэша.
+func (c *OrderCache) ShardCount() int { return len(c.table().shards) }
+
+// Resize перестраивает кэш под shardCount шардов (с округлением, как в New) и переносит в новые шарды все записи
+// вместе с временем создания и версией, поэтому лимит maxItems и TTL продолжают действовать как прежде.
+// Порядок LRU сохраняется в пределах каждого прежнего шарда; если записи распределятся по новым шардам неравномерно,
+// переполненные шарды вытесняют наименее недавно использованные записи.
+//
+// Операция дорогая: на время переноса всех записей блокируются все шарды, и любые обращения к кэшу ждут её завершения.
+// Вызывайте её только при изменении настройки, а не в ходе обычной работы.
+func (c *OrderCache) Resize(shardCount int) error {
+	if shardCount <= 0 {
+		return errors.New("shardCount must be > 0")
+	}
+	c.resizeMu.Lock()
+	defer c.resizeMu.Unlock()
+
+	old := c.table()
+	next := newShardTable(shardCount, c.maxItems)
+	// Все операции держат не больше одной блокировки шарда, поэтому захват всех шардов по порядку не приводит к взаимоблокировке
+	for _, s := range old.shards {
+		s.mu.Lock()
+	}
+	for _, s := range old.shards {
+		for e := s.lru.Front(); e != nil; e = e.Next() {
+			ent := e.Value.(*orderEntry)
+			ns := next.shardFor(ent.key)
+			moved := &orderEntry{key: ent.key, tenant: ent.tenant, value: ent.value, createdAt: ent.createdAt, version: ent.version,
+				encoded: ent.encoded, pinned: ent.pinned, accessedAt: ent.accessedAt, demoted: ent.demoted}
+			moved.elem = ns.lru.PushBack(moved)
+			ns.items[ent.key] = moved
+			if ns.cap > 0 && ns.lru.Len() > ns.cap {
+				c.evictLRULocked(ns, 1)
+			}
+		}
+		// Прежние записи остаются на месте для читателей, успевших получить старую таблицу
+		s.retired = true
+	}
+	c.tbl.Store(next)
+	for _, s := range old.shards {
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Set добавляет или обновляет заказ арендатора tenantID в кэше. Если заказ уже существует, он обновляется, иначе добавляется новый.
+// Set безусловно перезаписывает значение (last-write-wins) и сбрасывает его версию.
+func (c *OrderCache) Set(tenantID string, o orders.Order) {
+	c.set(tenantID, o, 0, setAlways)
+}
+
+// SetIfNewer добавляет заказ с версией version или обновляет существующий, только если его версия строго меньше version.
+// Возвращает false, если в кэше уже есть более новая (или такая же) версия заказа; устаревшие по TTL записи считаются отсутствующими.
+// Версии разных источников должны быть сопоставимы, например время чтения данных из источника в наносекундах.
+func (c *OrderCache) SetIfNewer(tenantID string, o orders.Order, version int64) bool {
+	return c.set(tenantID, o, version, setIfNewer)
+}
+
+// SetIfAbsent добавляет заказ арендатора tenantID, только если его ещё нет в кэше; устаревшие по TTL записи
+// считаются отсутствующими. Возвращает false, если заказ уже есть: записанное раньше значение, например
+// полученное консьюмером во время прогрева, новее снимка, из которого заказ добавляется.
+func (c *OrderCache) SetIfAbsent(tenantID string, o orders.Order) bool {
+	return c.set(tenantID, o, 0, setIfAbsent)
+}
+
+// setPolicy - условие, при котором set заменяет существующую запись
+type setPolicy int
+
+const (
+	setAlways   setPolicy = iota // всегда (Set)
+	setIfNewer                   // если версия записи меньше новой (SetIfNewer)
+	setIfAbsent                  // никогда, только добавление отсутствующей (SetIfAbsent)
+)
+
+// expired сообщает, устарела ли запись ent к моменту now по TTL. Закреплённые записи не устаревают.
+// Вызывается под блокировкой шарда записи.
+func (c *OrderCache) expired(ent *orderEntry, now time.Time) bool {
+	return c.ttl > 0 && !ent.pinned && now.Sub(ent.createdAt) > c.ttl
+}
+
+// orderKey - ключ заказа id арендатора tenantID: идентификатор приводится к нижнему регистру (ids.Normalize),
+// поэтому заказ находится независимо от регистра букв в запросе
+func orderKey(tenantID, id string) string {
+	return tenant.Key(tenantID, ids.Normalize(id))
+}
+
+// set реализует Set, SetIfNewer и SetIfAbsent.
+func (c *OrderCache) set(tenantID string, o orders.Order, version int64, policy setPolicy) bool {
+	now := c.clock.Now()
+	o.OrderUid = ids.Normalize(o.OrderUid)
+	key := orderKey(tenantID, o.OrderUid)
+	s := c.lockShard(key)
+	defer s.mu.Unlock()
+	s.accesses.Add(1)
+	c.l1.invalidate(key)
+	delete(s.missing, key)
+	if ent, ok := s.items[key]; ok {
+		expired := c.expired(ent, now)
+		switch {
+		case expired:
+		case policy == setIfNewer && ent.version >= version:
+			return false
+		case policy == setIfAbsent:
+			return false
+		}
 		ent.value = o
+		ent.version = version
+		ent.encoded = nil
+		ent.gen++
+		ent.accessedAt = now
 		if c.ttl > 0 {
 			ent.createdAt = now
 		}
-		s.lru.MoveToBack(ent.elem)
-		s.mu.Unlock()
-		return
+		if ent.demoted {
+			ent.demoted = false
+			c.demoted.Add(-1)
+			c.repromotions.Add(1)
+		}
+		c.touchLocked(s, ent)
+		return true
 	}
 	ent := &orderEntry{
-		key:       o.OrderUid,
-		value:     o,
-		createdAt: now,
+		key:        key,
+		tenant:     tenantID,
+		value:      o,
+		createdAt:  now,
+		accessedAt: now,
+		version:    version,
 	}
 	ent.elem = s.lru.PushBack(ent)
-	s.items[o.OrderUid] = ent
-	if c.perShardCap > 0 && s.lru.Len() > c.perShardCap {
+	s.items[key] = ent
+	if s.cap > 0 && s.lru.Len() > s.cap {
 		c.evictLRULocked(s, 1)
 	}
-	s.mu.Unlock()
+	return true
 }
 
-// Get извлекает заказ из кэша по его идентификатору. Если заказ существует и не устарел, он возвращается вместе с флагом успеха.
-func (c *OrderCache) Get(id string) (orders.Order, bool) {
-	s := c.shardFor(id)
-	now := time.Now()
+// Get извлекает заказ арендатора tenantID из кэша по его идентификатору. Если заказ существует и не устарел,
+// он возвращается вместе с флагом успеха. Пониженная запись (WithDemoteAfter) считается отсутствующей: заказ нужно
+// загрузить заново и записать Set или SetIfNewer, что вернёт запись к полному виду.
+// С WithL1 заказ сначала ищется в L1; попадание в L1 не продлевает жизнь записи в шарде и не учитывается в Stats.
+func (c *OrderCache) Get(tenantID, id string) (orders.Order, bool) {
+	key := orderKey(tenantID, id)
+	if c.l1 != nil {
+		return c.getL1(key)
+	}
+	return c.get(key)
+}
+
+// get реализует Get по ключу с префиксом арендатора.
+func (c *OrderCache) get(id string) (orders.Order, bool) {
+	s := c.table().shardFor(id)
+	s.accesses.Add(1)
+	now := c.clock.Now()
 	s.mu.RLock()
 	ent, ok := s.items[id]
-	if !ok {
+	if !ok || ent.demoted {
 		s.mu.RUnlock()
 		return orders.Order{}, false
 	}
-	if c.ttl > 0 && now.Sub(ent.createdAt) > c.ttl {
+	if c.expired(ent, now) {
 		s.mu.RUnlock()
 		s.mu.Lock()
-		if ent2, ok2 := s.items[id]; ok2 && now.Sub(ent2.createdAt) > c.ttl {
+		if s.retired {
+			// Запись перенесена конкурентным Resize: повторяем чтение из новой таблицы
+			s.mu.Unlock()
+			return c.get(id)
+		}
+		if ent2, ok2 := s.items[id]; ok2 && c.expired(ent2, now) {
 			c.removeEntryLocked(s, ent2)
 			s.mu.Unlock()
 			return orders.Order{}, false
 		}
-		s.lru.MoveToBack(ent.elem)
+		if ent.demoted {
+			// Запись понижена конкурентной очисткой
+			s.mu.Unlock()
+			return orders.Order{}, false
+		}
+		c.accessLocked(s, ent, now)
 		val := ent.value
 		s.mu.Unlock()
 		return val, true
 	}
 	val := ent.value
+	stale := now.Sub(ent.accessedAt) >= accessResolution
 	s.mu.RUnlock()
+	if c.eviction != EvictLRU && !stale {
+		return val, true
+	}
 	s.mu.Lock()
-	if ent2, ok2 := s.items[id]; ok2 {
-		s.lru.MoveToBack(ent2.elem)
+	if ent2, ok2 := s.items[id]; ok2 && !s.retired {
+		c.accessLocked(s, ent2, now)
 	}
 	s.mu.Unlock()
 	return val, true
 }
 
-// LoadFromSlice загружает список заказов в кэш. Каждый заказ добавляется или обновляется в кэше.
-func (c *OrderCache) LoadFromSlice(list []orders.Order) {
+// accessResolution - точность времени последнего обращения к записи: чтения записи, отмеченной позже, не берут
+// блокировку шарда на запись ради обновления accessedAt (по политике EvictFIFO)
+const accessResolution = time.Second
+
+// accessLocked отмечает чтение записи ent шарда s в момент now: обновляет время последнего обращения и порядок
+// вытеснения (touchLocked). Вызывается под блокировкой шарда на запись.
+func (c *OrderCache) accessLocked(s *shard, ent *orderEntry, now time.Time) {
+	if now.After(ent.accessedAt) {
+		ent.accessedAt = now
+	}
+	c.touchLocked(s, ent)
+}
+
+// Contains сообщает, есть ли в кэше неустаревшая запись заказа арендатора tenantID, в том числе пониженная
+// (WithDemoteAfter). Время последнего обращения к записи не меняется, поэтому проверка существования
+// не возвращает пониженную запись к полному виду и не удерживает запись от понижения.
+func (c *OrderCache) Contains(tenantID, id string) bool {
+	key := orderKey(tenantID, id)
+	s := c.table().shardFor(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ent, ok := s.items[key]
+	return ok && !c.expired(ent, c.clock.Now())
+}
+
+// SetKeepJSON включает или выключает хранение сериализованного JSON заказов для GetJSON. Сериализация удваивает
+// память, занимаемую часто читаемыми заказами, поэтому по умолчанию выключена.
+func (c *OrderCache) SetKeepJSON(enabled bool) {
+	c.keepJSON.Store(enabled)
+}
+
+// GetJSON возвращает заказ арендатора tenantID в JSON в том виде, в каком его пишет json.Encoder (с переводом строки
+// в конце). Заказ сериализуется при первом обращении, а результат хранится в кэше до изменения или удаления заказа.
+// Возвращённый срез нельзя изменять. false — хранение JSON выключено (SetKeepJSON), заказа нет в кэше, он устарел или
+// его не удалось сериализовать; тогда заказ нужно читать через Get. С WithL1 JSON сначала ищется в L1, как в Get.
+func (c *OrderCache) GetJSON(tenantID, id string) ([]byte, bool) {
+	if !c.keepJSON.Load() {
+		return nil, false
+	}
+	key := orderKey(tenantID, id)
+	if c.l1 != nil {
+		return c.getJSONL1(key)
+	}
+	encoded, _, ok := c.getJSON(key)
+	return encoded, ok
+}
+
+// getJSON реализует GetJSON по ключу с префиксом арендатора и возвращает вместе с JSON заказ, из которого он получен.
+func (c *OrderCache) getJSON(key string) ([]byte, orders.Order, bool) {
+	s := c.table().shardFor(key)
+	s.accesses.Add(1)
+	s.mu.RLock()
+	ent, ok := s.items[key]
+	now := c.clock.Now()
+	if !ok || ent.demoted || c.expired(ent, now) {
+		// Устаревшую запись удалит Get
+		s.mu.RUnlock()
+		return nil, orders.Order{}, false
+	}
+	encoded, value, gen := ent.encoded, ent.value, ent.gen
+	s.mu.RUnlock()
+
+	if encoded == nil {
+		// Буфер из пула не выделяет память под промежуточный JSON: выделяется только хранимая копия точного размера
+		data, err := jsonpool.Marshal(value)
+		if err != nil {
+			return nil, orders.Order{}, false
+		}
+		encoded = data
+	}
+	s.mu.Lock()
+	// Сериализация сохраняется, только если запись не изменилась и не перенесена Resize за время кодирования
+	if ent2, ok2 := s.items[key]; ok2 && ent2 == ent && !s.retired {
+		if ent.encoded == nil && ent.gen == gen {
+			ent.encoded = encoded
+		}
+		c.accessLocked(s, ent, now)
+	}
+	s.mu.Unlock()
+	return encoded, value, true
+}
+
+// SetMissingTTL задаёт срок, в течение которого кэш помнит подтверждённое MarkMissing отсутствие заказа;
+// 0 (по умолчанию) выключает запоминание. Уже запомненные заказы действуют до своего срока.
+func (c *OrderCache) SetMissingTTL(ttl time.Duration) {
+	c.missingTTL.Store(int64(ttl))
+}
+
+// MarkMissing запоминает, что заказа арендатора tenantID нет в источнике данных, на срок SetMissingTTL. Запись заказа
+// (Set, SetIfNewer, LoadFromSlice) отменяет отметку. Если шард уже помнит много отсутствующих заказов, отметка
+// не сохраняется. Resize отметки не переносит.
+func (c *OrderCache) MarkMissing(tenantID, id string) {
+	ttl := time.Duration(c.missingTTL.Load())
+	if ttl <= 0 {
+		return
+	}
+	key := orderKey(tenantID, id)
+	now := c.clock.Now()
+	s := c.lockShard(key)
+	defer s.mu.Unlock()
+	if _, ok := s.items[key]; ok {
+		return
+	}
+	if len(s.missing) >= maxMissingPerShard {
+		for k, expires := range s.missing {
+			if !now.Before(expires) {
+				delete(s.missing, k)
+			}
+		}
+		if len(s.missing) >= maxMissingPerShard {
+			return
+		}
+	}
+	if s.missing == nil {
+		s.missing = make(map[string]time.Time)
+	}
+	s.missing[key] = now.Add(ttl)
+}
+
+// IsMissing сообщает, отмечено ли MarkMissing отсутствие заказа арендатора tenantID и не истёк ли срок отметки.
+func (c *OrderCache) IsMissing(tenantID, id string) bool {
+	key := orderKey(tenantID, id)
+	s := c.table().shardFor(key)
+	s.mu.RLock()
+	expires, ok := s.missing[key]
+	s.mu.RUnlock()
+	return ok && c.clock.Now().Before(expires)
+}
+
+// Delete удаляет заказ арендатора tenantID из кэша по его идентификатору, в том числе закреплённый (Pin),
+// и отметку об его отсутствии (MarkMissing). Отсутствие ключа не считается ошибкой.
+func (c *OrderCache) Delete(tenantID, id string) {
+	id = orderKey(tenantID, id)
+	s := c.lockShard(id)
+	if ent, ok := s.items[id]; ok {
+		c.removeEntryLocked(s, ent)
+	}
+	delete(s.missing, id)
+	s.mu.Unlock()
+}
+
+// SetMaxPinned задаёт наибольшее число закреплённых записей; n <= 0 означает DefaultMaxPinned. Уже закреплённые
+// сверх нового лимита записи остаются закреплёнными.
+func (c *OrderCache) SetMaxPinned(n int) {
+	if n <= 0 {
+		n = DefaultMaxPinned
+	}
+	c.maxPinned.Store(int64(n))
+}
+
+// Pin закрепляет заказ арендатора tenantID в кэше: запись не вытесняется по LRU, не устаревает по TTL и не понижается,
+// пока не будет вызван Unpin, но удаляется Delete. Закрепление уже закреплённой записи не считается ошибкой. Если заказа
+// нет в кэше, он устарел или понижен, возвращается ErrNotCached, а если закреплено уже SetMaxPinned записей — ErrPinLimit.
+func (c *OrderCache) Pin(tenantID, id string) error {
+	key := orderKey(tenantID, id)
+	s := c.lockShard(key)
+	defer s.mu.Unlock()
+	ent, ok := s.items[key]
+	if !ok || ent.demoted || c.expired(ent, c.clock.Now()) {
+		return ErrNotCached
+	}
+	if ent.pinned {
+		return nil
+	}
+	for {
+		n := c.pinned.Load()
+		if n >= c.maxPinned.Load() {
+			return ErrPinLimit
+		}
+		if c.pinned.CompareAndSwap(n, n+1) {
+			break
+		}
+	}
+	ent.pinned = true
+	return nil
+}
+
+// Unpin снимает закрепление заказа арендатора tenantID, после чего запись снова вытесняется по LRU и TTL
+// (срок жизни отсчитывается от прежнего времени записи). Возвращает false, если запись не была закреплена.
+func (c *OrderCache) Unpin(tenantID, id string) bool {
+	key := orderKey(tenantID, id)
+	s := c.lockShard(key)
+	defer s.mu.Unlock()
+	ent, ok := s.items[key]
+	if !ok || !ent.pinned {
+		return false
+	}
+	ent.pinned = false
+	c.pinned.Add(-1)
+	return true
+}
+
+// Pinned возвращает отсортированные ключи закреплённых записей (идентификаторы с префиксом арендатора, tenant.Key).
+func (c *OrderCache) Pinned() []string {
+	var keys []string
+	for _, s := range c.table().shards {
+		s.mu.RLock()
+		for key, ent := range s.items {
+			if ent.pinned {
+				keys = append(keys, key)
+			}
+		}
+		s.mu.RUnlock()
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MaxPinned возвращает наибольшее число закреплённых записей (SetMaxPinned).
+func (c *OrderCache) MaxPinned() int {
+	return int(c.maxPinned.Load())
+}
+
+// Range вызывает fn для каждого актуального заказа в кэше с его арендатором, пока fn возвращает true.
+// Пониженные записи, как и в Get, пропускаются.
+// Обход выполняется пошардово: записи шарда копируются под RLock, после чего блокировка снимается
+// и только затем вызывается fn, поэтому fn может безопасно обращаться к кэшу (в том числе к Get и Set).
+// Итерация является слабо согласованным снимком: изменения, сделанные во время обхода, могут быть как видны, так и нет.
+func (c *OrderCache) Range(fn func(tenantID, id string, o orders.Order) bool) {
+	type rangeEntry struct {
+		tenant string
+		value  orders.Order
+	}
+	for _, s := range c.table().shards {
+		now := c.clock.Now()
+		s.mu.RLock()
+		snapshot := make([]rangeEntry, 0, len(s.items))
+		for _, ent := range s.items {
+			if ent.demoted || c.expired(ent, now) {
+				continue
+			}
+			snapshot = append(snapshot, rangeEntry{tenant: ent.tenant, value: ent.value})
+		}
+		s.mu.RUnlock()
+
+		for _, e := range snapshot {
+			if !fn(e.tenant, e.value.OrderUid, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// Keys возвращает ключи всех актуальных заказов в кэше (идентификаторы с префиксом арендатора, tenant.Key), включая
+// пониженные. Как и Range, результат является слабо согласованным снимком.
+func (c *OrderCache) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	for _, s := range c.table().shards {
+		now := c.clock.Now()
+		s.mu.RLock()
+		for key, ent := range s.items {
+			if c.expired(ent, now) {
+				continue
+			}
+			keys = append(keys, key)
+		}
+		s.mu.RUnlock()
+	}
+	return keys
+}
+
+// Len возвращает количество записей в кэше, включая пониженные и ещё не удалённые очисткой устаревшие записи.
+func (c *OrderCache) Len() int {
+	n := 0
+	for _, s := range c.table().shards {
+		s.mu.RLock()
+		n += len(s.items)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// LoadFromSlice загружает список заказов арендатора tenantID в кэш при прогреве. Заказы добавляются через SetIfAbsent:
+// снимок базы данных прочитан до начала загрузки, поэтому заказ, уже записанный в кэш консьюмером или обработчиком,
+// новее снимка и не перезаписывается.
+func (c *OrderCache) LoadFromSlice(tenantID string, list []orders.Order) {
 	for _, o := range list {
-		c.Set(o)
+		c.SetIfAbsent(tenantID, o)
 	}
 }
 
-// EvictExpired очищает кэш от устаревших элементов, если задано время жизни (TTL).
-func (c *OrderCache) evictExpired() {
+// evictExpiredLocked удаляет устаревшие по TTL записи шарда s и возвращает их число. Вызывается под блокировкой шарда.
+func (c *OrderCache) evictExpiredLocked(s *shard, now time.Time) int {
 	if c.ttl <= 0 {
-		return
+		return 0
 	}
-	now := time.Now()
-	for _, s := range c.shards {
-		s.mu.Lock()
-		for e := s.lru.Front(); e != nil; {
-			next := e.Next()
-			ent := e.Value.(*orderEntry)
-			if now.Sub(ent.createdAt) > c.ttl {
-				c.removeEntryLocked(s, ent)
-			} else {
+	n := 0
+	for e := s.lru.Front(); e != nil; {
+		next := e.Next()
+		ent := e.Value.(*orderEntry)
+		// закреплённая запись не устаревает, но следующие за ней могут быть устаревшими
+		if !ent.pinned {
+			if now.Sub(ent.createdAt) <= c.ttl {
 				break
 			}
-			e = next
+			c.removeEntryLocked(s, ent)
+			n++
 		}
-		s.mu.Unlock()
+		e = next
 	}
+	return n
 }
 
-// evictLRULocked удаляет n наименее недавно использованных элементов из шардированного кэша.
+// evictOverCapacityLocked вытесняет незакреплённые записи шарда s сверх его доли maxItems (например, оставшиеся
+// после открепления записей) и возвращает их число. Вызывается под блокировкой шарда.
+func (c *OrderCache) evictOverCapacityLocked(s *shard) int {
+	if s.cap <= 0 || s.lru.Len() <= s.cap {
+		return 0
+	}
+	before := s.lru.Len()
+	c.evictLRULocked(s, before-s.cap)
+	return before - s.lru.Len()
+}
+
+// evictLRULocked удаляет n наименее недавно использованных незакреплённых элементов из шардированного кэша.
+// Закреплённые элементы пропускаются; если незакреплённых не осталось, шард временно превышает свой лимит.
 func (c *OrderCache) evictLRULocked(s *shard, n int) {
+	e := s.lru.Front()
 	for i := 0; i < n; i++ {
-		front := s.lru.Front()
-		if front == nil {
+		for e != nil && e.Value.(*orderEntry).pinned {
+			e = e.Next()
+		}
+		if e == nil {
 			return
 		}
-		ent := front.Value.(*orderEntry)
-		c.removeEntryLocked(s, ent)
+		next := e.Next()
+		c.removeEntryLocked(s, e.Value.(*orderEntry))
+		e = next
 	}
 }
 
 // removeEntryLocked удаляет элемент из шардированного кэша, освобождая память и удаляя его из LRU списка.
 func (c *OrderCache) removeEntryLocked(s *shard, ent *orderEntry) {
+	if ent.pinned {
+		c.pinned.Add(-1)
+	}
+	if ent.demoted {
+		c.demoted.Add(-1)
+	}
+	c.l1.invalidate(ent.key)
 	delete(s.items, ent.key)
 	s.lru.Remove(ent.elem)
 }
+
+// demoteColdLocked понижает записи шарда s, к которым не обращались дольше WithDemoteAfter, до заголовка заказа:
+// товары и сериализованный JSON удаляются, а запись отмечается пониженной. Закреплённые записи и заказы без товаров
+// не понижаются. Возвращает число пониженных записей; вызывается под блокировкой шарда.
+func (c *OrderCache) demoteColdLocked(s *shard, now time.Time) int {
+	if c.demoteAfter <= 0 {
+		return 0
+	}
+	n := 0
+	for _, ent := range s.items {
+		if ent.demoted || ent.pinned || len(ent.value.Items) == 0 || now.Sub(ent.accessedAt) <= c.demoteAfter {
+			continue
+		}
+		c.l1.invalidate(ent.key)
+		ent.value.Items = nil
+		ent.encoded = nil
+		ent.gen++
+		ent.demoted = true
+		n++
+	}
+	c.demoted.Add(int64(n))
+	c.demotions.Add(uint64(n))
+	return n
+}
+
+// ErrCleanupRunning возвращается RunCleanup, если очистка уже выполняется: фоновая или запущенная другим вызовом.
+var ErrCleanupRunning = errors.New("cache cleanup is already running")
+
+// ShardCleanup - результат прохода очистки по одному шарду.
+type ShardCleanup struct {
+	Shard    int           // номер шарда в текущей таблице
+	Expired  int           // удалено устаревших по TTL записей
+	Evicted  int           // вытеснено записей сверх доли maxItems
+	Demoted  int           // понижено холодных записей (WithDemoteAfter)
+	Duration time.Duration // время прохода, включая ожидание блокировки шарда
+}
+
+// CleanupReport - результат прохода очистки по всем шардам: итоги и счётчики каждого шарда.
+type CleanupReport struct {
+	Expired  int
+	Evicted  int
+	Demoted  int
+	Duration time.Duration
+	Shards   []ShardCleanup
+}
+
+// RunCleanup синхронно выполняет проход очистки, который иначе выполняется раз в WithCleanupInterval: удаляет
+// устаревшие по TTL записи, вытесняет записи сверх лимита шардов и понижает холодные записи. Проходы не
+// накладываются: если очистка уже выполняется, возвращается ErrCleanupRunning, а фоновая очистка пропускает
+// период, пока выполняется RunCleanup.
+func (c *OrderCache) RunCleanup() (CleanupReport, error) {
+	if !c.cleanupMu.TryLock() {
+		return CleanupReport{}, ErrCleanupRunning
+	}
+	defer c.cleanupMu.Unlock()
+	return c.cleanup(), nil
+}
+
+// cleanup выполняет проход очистки по шардам текущей таблицы. Вызывается под cleanupMu.
+func (c *OrderCache) cleanup() CleanupReport {
+	start := time.Now()
+	now := c.clock.Now()
+	shards := c.table().shards
+	report := CleanupReport{Shards: make([]ShardCleanup, 0, len(shards))}
+	for i, s := range shards {
+		shardStart := time.Now()
+		sc := ShardCleanup{Shard: i}
+		s.mu.Lock()
+		// Выведенный из работы Resize шард пуст для новых операций: его записи уже в новой таблице
+		if !s.retired {
+			sc.Expired = c.evictExpiredLocked(s, now)
+			sc.Evicted = c.evictOverCapacityLocked(s)
+			sc.Demoted = c.demoteColdLocked(s, now)
+		}
+		s.mu.Unlock()
+		sc.Duration = time.Since(shardStart)
+
+		report.Expired += sc.Expired
+		report.Evicted += sc.Evicted
+		report.Demoted += sc.Demoted
+		report.Shards = append(report.Shards, sc)
+	}
+	report.Duration = time.Since(start)
+	return report
+}
+
+// DemotionStats - счётчики понижения холодных записей кэша (WithDemoteAfter).
+type DemotionStats struct {
+	Demoted      int    `json:"demoted"`      // пониженных записей сейчас
+	Demotions    uint64 `json:"demotions"`    // понижений за всё время
+	Repromotions uint64 `json:"repromotions"` // возвращений пониженных записей к полному виду после повторной загрузки
+}
+
+// DemotionStats возвращает счётчики понижения холодных записей.
+func (c *OrderCache) DemotionStats() DemotionStats {
+	return DemotionStats{Demoted: int(c.demoted.Load()), Demotions: c.demotions.Load(), Repromotions: c.repromotions.Load()}
+}
+
+// DemoteAfter возвращает срок без обращений, после которого запись понижается (WithDemoteAfter); 0 — не понижается.
+func (c *OrderCache) DemoteAfter() time.Duration { return c.demoteAfter }
+
+// ShardStats - заполненность и нагрузка одного шарда кэша.
+type ShardStats struct {
+	Shard    int    `json:"shard"`
+	Items    int    `json:"items"`    // записей, включая пониженные и ещё не удалённые очисткой устаревшие
+	Accesses uint64 `json:"accesses"` // чтений и записей с создания текущей таблицы шардов (Resize начинает счёт заново)
+}
+
+// Stats - распределение записей и обращений по шардам кэша. Неравномерность — отношение значения самого
+// загруженного шарда к среднему по шардам: 1 — нагрузка распределена поровну, число шардов — вся нагрузка
+// приходится на один шард, 0 — записей или обращений нет.
+type Stats struct {
+	Items           int          `json:"items"`
+	Accesses        uint64       `json:"accesses"`
+	ItemImbalance   float64      `json:"item_imbalance"`
+	AccessImbalance float64      `json:"access_imbalance"`
+	FullestShard    int          `json:"fullest_shard"` // шард с наибольшим числом записей
+	HottestShard    int          `json:"hottest_shard"` // шард с наибольшим числом обращений
+	Shards          []ShardStats `json:"shards,omitempty"`
+}
+
+// Stats возвращает число записей и обращений каждого шарда и неравномерность их распределения. Если идентификаторы
+// заказов имеют общую структуру, неудачно распределяемую хэшем FNV, один шард получает большую часть записей
+// и обращений: его блокировка становится общей точкой ожидания, а ёмкость (WithMaxItems) расходуется раньше
+// остальных, и записи вытесняются при незаполненном кэше.
+func (c *OrderCache) Stats() Stats {
+	shards := c.table().shards
+	stats := Stats{Shards: make([]ShardStats, len(shards))}
+	var maxItems int
+	var maxAccesses uint64
+	for i, s := range shards {
+		s.mu.RLock()
+		items := len(s.items)
+		s.mu.RUnlock()
+		accesses := s.accesses.Load()
+		stats.Shards[i] = ShardStats{Shard: i, Items: items, Accesses: accesses}
+		stats.Items += items
+		stats.Accesses += accesses
+		if items > maxItems {
+			maxItems, stats.FullestShard = items, i
+		}
+		if accesses > maxAccesses {
+			maxAccesses, stats.HottestShard = accesses, i
+		}
+	}
+	stats.ItemImbalance = imbalance(float64(maxItems), float64(stats.Items), len(shards))
+	stats.AccessImbalance = imbalance(float64(maxAccesses), float64(stats.Accesses), len(shards))
+	return stats
+}
+
+// imbalance - отношение наибольшего значения шарда top к среднему по shards шардам при сумме total; 0, если total равно 0
+func imbalance(top, total float64, shards int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return top * float64(shards) / total
+}
@@ -0,0 +1,625 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCache(t *testing.T, shards, maxItems int, ttl time.Duration) *OrderCache {
+	t.Helper()
+	c, err := New(shards, maxItems, ttl, 0)
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+	return c
+}
+
+// newFakeClock - управляемые часы кэша
+func newFakeClock() *clock.Fake {
+	return clock.NewFake(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+}
+
+// newClockedCache - кэш, как newTestCache, с управляемыми часами: фоновая очистка срабатывает только при переводе
+// часов на минуту вперёд
+func newClockedCache(t *testing.T, shards, maxItems int, ttl time.Duration) (*OrderCache, *clock.Fake) {
+	t.Helper()
+	clock := newFakeClock()
+	c, err := NewWithOptions(WithShards(shards), WithMaxItems(maxItems), WithTTL(ttl), WithClock(clock))
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+	return c, clock
+}
+
+func TestRangeKeysLen(t *testing.T) {
+	c := newTestCache(t, 4, 0, 0)
+	want, wantKeys := make([]string, 0, 20), make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("order-%d", i)
+		c.Set(tenant.Default, orders.Order{OrderUid: id})
+		want = append(want, id)
+		wantKeys = append(wantKeys, tenant.Key(tenant.Default, id))
+	}
+	sort.Strings(want)
+	sort.Strings(wantKeys)
+
+	assert.Equal(t, 20, c.Len())
+
+	keys := c.Keys()
+	sort.Strings(keys)
+	assert.Equal(t, wantKeys, keys)
+
+	var ranged []string
+	c.Range(func(tenantID, id string, o orders.Order) bool {
+		assert.Equal(t, tenant.Default, tenantID)
+		assert.Equal(t, id, o.OrderUid)
+		ranged = append(ranged, id)
+		return true
+	})
+	sort.Strings(ranged)
+	assert.Equal(t, want, ranged)
+}
+
+func TestRangeStopsEarly(t *testing.T) {
+	c := newTestCache(t, 4, 0, 0)
+	for i := 0; i < 10; i++ {
+		c.Set(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("order-%d", i)})
+	}
+
+	calls := 0
+	c.Range(func(string, string, orders.Order) bool {
+		calls++
+		return calls < 3
+	})
+	assert.Equal(t, 3, calls)
+}
+
+func TestRangeSkipsExpired(t *testing.T) {
+	c, clock := newClockedCache(t, 2, 0, time.Minute)
+	c.Set(tenant.Default, orders.Order{OrderUid: "old"})
+	clock.Advance(2 * time.Minute)
+	c.Set(tenant.Default, orders.Order{OrderUid: "new"})
+
+	assert.Equal(t, []string{tenant.Key(tenant.Default, "new")}, c.Keys())
+}
+
+func TestRangeCallbackMayUseCache(t *testing.T) {
+	c := newTestCache(t, 4, 0, 0)
+	for i := 0; i < 50; i++ {
+		c.Set(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("order-%d", i)})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Range(func(_, id string, o orders.Order) bool {
+			_, _ = c.Get(tenant.Default, id)
+			c.Set(tenant.Default, o)
+			return true
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Range deadlocked with a callback calling Get/Set")
+	}
+}
+
+func TestRangeConcurrentSetDelete(t *testing.T) {
+	c := newTestCache(t, 8, 0, 0)
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				id := fmt.Sprintf("w%d-%d", w, i%100)
+				c.Set(tenant.Default, orders.Order{OrderUid: id})
+				c.Delete(tenant.Default, id)
+				c.Set(tenant.Default, orders.Order{OrderUid: id})
+			}
+		}(w)
+	}
+
+	for i := 0; i < 50; i++ {
+		c.Range(func(_, id string, o orders.Order) bool {
+			return id == o.OrderUid
+		})
+		_ = c.Keys()
+		_ = c.Len()
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestCapacityDistribution(t *testing.T) {
+	tests := []struct {
+		name       string
+		shards     int
+		maxItems   int
+		wantShards int
+	}{
+		{name: "rounded shards exceed maxItems", shards: 6, maxItems: 7, wantShards: 4},
+		{name: "single item", shards: 4, maxItems: 1, wantShards: 1},
+		{name: "uneven remainder", shards: 8, maxItems: 30, wantShards: 8},
+		{name: "exact split", shards: 4, maxItems: 16, wantShards: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCache(t, tt.shards, tt.maxItems, 0)
+			require.Len(t, c.table().shards, tt.wantShards)
+
+			total := 0
+			for _, s := range c.table().shards {
+				assert.GreaterOrEqual(t, s.cap, 1)
+				total += s.cap
+			}
+			assert.Equal(t, tt.maxItems, total)
+		})
+	}
+}
+
+func TestGlobalBoundUnderConcurrentSets(t *testing.T) {
+	tests := []struct {
+		shards   int
+		maxItems int
+	}{
+		{shards: 6, maxItems: 7},
+		{shards: 4, maxItems: 1},
+		{shards: 32, maxItems: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("shards=%d/max=%d", tt.shards, tt.maxItems), func(t *testing.T) {
+			c := newTestCache(t, tt.shards, tt.maxItems, 0)
+
+			var wg sync.WaitGroup
+			for w := 0; w < 8; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < 500; i++ {
+						c.Set(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("w%d-%d", w, i)})
+						assert.LessOrEqual(t, c.Len(), tt.maxItems)
+					}
+				}(w)
+			}
+			wg.Wait()
+
+			assert.LessOrEqual(t, c.Len(), tt.maxItems)
+		})
+	}
+}
+
+func TestTenantsWithSameOrderUID(t *testing.T) {
+	c := newTestCache(t, 4, 0, 0)
+	c.Set("market-a", orders.Order{OrderUid: "o1", TrackNumber: "A"})
+	assert.True(t, c.SetIfNewer("market-b", orders.Order{OrderUid: "o1", TrackNumber: "B"}, 100), "versions are per tenant")
+	require.Equal(t, 2, c.Len())
+
+	got, ok := c.Get("market-a", "o1")
+	require.True(t, ok)
+	assert.Equal(t, "A", got.TrackNumber)
+	_, ok = c.Get(tenant.Default, "o1")
+	assert.False(t, ok)
+
+	require.NoError(t, c.Resize(8))
+	c.Delete("market-a", "o1")
+	got, ok = c.Get("market-b", "o1")
+	require.True(t, ok, "deleting one tenant's order keeps the other")
+	assert.Equal(t, "B", got.TrackNumber)
+	c.Range(func(tenantID, id string, o orders.Order) bool {
+		assert.Equal(t, "market-b", tenantID)
+		return true
+	})
+}
+
+func TestSetIfNewerRejectsStaleRefresh(t *testing.T) {
+	c := newTestCache(t, 4, 0, 0)
+
+	// Консьюмер записал новую версию, затем завершается медленное обновление, прочитавшее базу раньше
+	assert.True(t, c.SetIfNewer(tenant.Default, orders.Order{OrderUid: "o1", TrackNumber: "NEW"}, 200))
+	assert.False(t, c.SetIfNewer(tenant.Default, orders.Order{OrderUid: "o1", TrackNumber: "OLD"}, 100))
+	assert.False(t, c.SetIfNewer(tenant.Default, orders.Order{OrderUid: "o1", TrackNumber: "SAME"}, 200))
+
+	got, ok := c.Get(tenant.Default, "o1")
+	require.True(t, ok)
+	assert.Equal(t, "NEW", got.TrackNumber)
+
+	assert.True(t, c.SetIfNewer(tenant.Default, orders.Order{OrderUid: "o1", TrackNumber: "NEWER"}, 300))
+	got, _ = c.Get(tenant.Default, "o1")
+	assert.Equal(t, "NEWER", got.TrackNumber)
+}
+
+func TestSetIsLastWriteWins(t *testing.T) {
+	c := newTestCache(t, 4, 0, 0)
+
+	c.SetIfNewer(tenant.Default, orders.Order{OrderUid: "o1", TrackNumber: "VERSIONED"}, 500)
+	c.Set(tenant.Default, orders.Order{OrderUid: "o1", TrackNumber: "PLAIN"})
+
+	got, _ := c.Get(tenant.Default, "o1")
+	assert.Equal(t, "PLAIN", got.TrackNumber)
+
+	// После безусловной записи версия неизвестна, и любая версионированная запись принимается
+	assert.True(t, c.SetIfNewer(tenant.Default, orders.Order{OrderUid: "o1", TrackNumber: "AFTER"}, 1))
+}
+
+func TestSetIfNewerReplacesExpiredEntry(t *testing.T) {
+	c, clock := newClockedCache(t, 2, 0, time.Minute)
+
+	c.SetIfNewer(tenant.Default, orders.Order{OrderUid: "o1", TrackNumber: "NEW"}, 200)
+	clock.Advance(2 * time.Minute)
+
+	assert.True(t, c.SetIfNewer(tenant.Default, orders.Order{OrderUid: "o1", TrackNumber: "OLD"}, 100))
+	got, ok := c.Get(tenant.Default, "o1")
+	require.True(t, ok)
+	assert.Equal(t, "OLD", got.TrackNumber)
+}
+
+func TestSetIfAbsent(t *testing.T) {
+	c, clock := newClockedCache(t, 2, 0, time.Minute)
+
+	assert.True(t, c.SetIfAbsent(tenant.Default, orders.Order{OrderUid: "o1", TrackNumber: "FIRST"}))
+	assert.False(t, c.SetIfAbsent(tenant.Default, orders.Order{OrderUid: "o1", TrackNumber: "SECOND"}))
+	got, _ := c.Get(tenant.Default, "o1")
+	assert.Equal(t, "FIRST", got.TrackNumber)
+
+	// Заказ другого арендатора с тем же идентификатором — другая запись
+	assert.True(t, c.SetIfAbsent("market-b", orders.Order{OrderUid: "o1", TrackNumber: "OTHER"}))
+
+	// Устаревшая по TTL запись считается отсутствующей
+	clock.Advance(2 * time.Minute)
+	assert.True(t, c.SetIfAbsent(tenant.Default, orders.Order{OrderUid: "o1", TrackNumber: "THIRD"}))
+	got, ok := c.Get(tenant.Default, "o1")
+	require.True(t, ok)
+	assert.Equal(t, "THIRD", got.TrackNumber)
+
+	// Добавленная без версии запись заменяется любой версионированной
+	assert.True(t, c.SetIfNewer(tenant.Default, orders.Order{OrderUid: "o1", TrackNumber: "LIVE"}, 1))
+}
+
+func TestLoadFromSliceKeepsLiveUpdates(t *testing.T) {
+	const n = 500
+	snapshot := make([]orders.Order, n)
+	for i := range snapshot {
+		snapshot[i] = orders.Order{OrderUid: fmt.Sprintf("o%d", i), TrackNumber: "SNAPSHOT"}
+	}
+
+	for round := 0; round < 20; round++ {
+		c := newTestCache(t, 4, 0, 0)
+		// Прогрев снимком базы данных идёт одновременно с записью консьюмером новых версий тех же заказов
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-start
+			c.LoadFromSlice(tenant.Default, snapshot)
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+			for i := n - 1; i >= 0; i-- {
+				c.SetIfNewer(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("o%d", i), TrackNumber: "LIVE"}, time.Now().UnixNano())
+			}
+		}()
+		close(start)
+		wg.Wait()
+
+		for i := 0; i < n; i++ {
+			got, ok := c.Get(tenant.Default, fmt.Sprintf("o%d", i))
+			require.True(t, ok)
+			require.Equal(t, "LIVE", got.TrackNumber, "round %d, order o%d", round, i)
+		}
+	}
+}
+
+func TestAutoShardCount(t *testing.T) {
+	prev := runtime.GOMAXPROCS(3)
+	t.Cleanup(func() { runtime.GOMAXPROCS(prev) })
+	assert.Equal(t, 16, AutoShardCount(), "4 x 3 cores rounded up to a power of two")
+
+	runtime.GOMAXPROCS(1)
+	assert.Equal(t, 4, AutoShardCount())
+	runtime.GOMAXPROCS(16)
+	assert.Equal(t, 64, AutoShardCount())
+}
+
+func TestResizeKeepsEntries(t *testing.T) {
+	for _, tt := range []struct{ from, to, want int }{
+		{from: 4, to: 32, want: 32},
+		{from: 32, to: 2, want: 2},
+		{from: 8, to: 5, want: 8},
+	} {
+		t.Run(fmt.Sprintf("%d->%d", tt.from, tt.to), func(t *testing.T) {
+			c := newTestCache(t, tt.from, 0, 0)
+			for i := 0; i < 100; i++ {
+				c.SetIfNewer(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("order-%d", i), TrackNumber: "T"}, int64(i+1))
+			}
+
+			require.NoError(t, c.Resize(tt.to))
+			assert.Equal(t, tt.want, c.ShardCount())
+			assert.Equal(t, 100, c.Len())
+			for i := 0; i < 100; i++ {
+				o, ok := c.Get(tenant.Default, fmt.Sprintf("order-%d", i))
+				require.True(t, ok, i)
+				assert.Equal(t, "T", o.TrackNumber)
+			}
+
+			// Версии перенесены вместе с записями
+			assert.False(t, c.SetIfNewer(tenant.Default, orders.Order{OrderUid: "order-10"}, 11))
+			assert.True(t, c.SetIfNewer(tenant.Default, orders.Order{OrderUid: "order-10"}, 12))
+		})
+	}
+
+	c := newTestCache(t, 4, 0, 0)
+	assert.Error(t, c.Resize(0))
+	assert.Equal(t, 4, c.ShardCount())
+}
+
+func TestResizePreservesCapacityAndTTL(t *testing.T) {
+	c, clock := newClockedCache(t, 4, 10, time.Minute)
+	for i := 0; i < 10; i++ {
+		c.Set(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("order-%d", i)})
+	}
+
+	require.NoError(t, c.Resize(16))
+	// Число шардов не превышает maxItems, а сумма их лимитов равна maxItems
+	assert.Equal(t, 8, c.ShardCount())
+	total := 0
+	for _, s := range c.table().shards {
+		total += s.cap
+	}
+	assert.Equal(t, 10, total)
+	assert.LessOrEqual(t, c.Len(), 10)
+
+	for i := 0; i < 100; i++ {
+		c.Set(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("new-%d", i)})
+	}
+	assert.LessOrEqual(t, c.Len(), 10)
+
+	// Время создания записей переносится: TTL отсчитывается от исходной записи
+	c.Set(tenant.Default, orders.Order{OrderUid: "ttl"})
+	clock.Advance(40 * time.Second)
+	require.NoError(t, c.Resize(2))
+	clock.Advance(40 * time.Second)
+	_, ok := c.Get(tenant.Default, "ttl")
+	assert.False(t, ok, "entry expires on its original schedule")
+}
+
+func TestConcurrentAccessDuringResize(t *testing.T) {
+	c := newTestCache(t, 4, 0, 0)
+	for i := 0; i < 200; i++ {
+		c.Set(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("order-%d", i)})
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				id := fmt.Sprintf("order-%d", i%200)
+				if o, ok := c.Get(tenant.Default, id); ok {
+					assert.Equal(t, id, o.OrderUid)
+				}
+				if w%2 == 0 {
+					c.Set(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("w%d-%d", w, i%100)})
+				} else {
+					c.Delete(tenant.Default, fmt.Sprintf("w%d-%d", w-1, i%100))
+				}
+				c.Range(func(string, string, orders.Order) bool { return false })
+				c.Len()
+			}
+		}(w)
+	}
+
+	for _, n := range []int{16, 2, 64, 1, 8} {
+		require.NoError(t, c.Resize(n))
+	}
+	close(stop)
+	wg.Wait()
+
+	for i := 0; i < 200; i++ {
+		_, ok := c.Get(tenant.Default, fmt.Sprintf("order-%d", i))
+		assert.True(t, ok, "entries written before the resizes survive: %d", i)
+	}
+}
+
+func TestGetJSONDisabledByDefault(t *testing.T) {
+	c := newTestCache(t, 4, 0, 0)
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-1"})
+
+	_, ok := c.GetJSON(tenant.Default, "order-1")
+	assert.False(t, ok)
+}
+
+func TestGetJSONMatchesEncoderAndIsReused(t *testing.T) {
+	c := newTestCache(t, 4, 0, 0)
+	c.SetKeepJSON(true)
+	order := orders.Order{OrderUid: "order-1", TrackNumber: "TRACK-1", Items: []orders.Item{{ChrtId: 1, Price: 453}}}
+	c.Set(tenant.Default, order)
+
+	var want bytes.Buffer
+	require.NoError(t, json.NewEncoder(&want).Encode(order))
+	got, ok := c.GetJSON(tenant.Default, "order-1")
+	require.True(t, ok)
+	assert.Equal(t, want.String(), string(got))
+
+	again, ok := c.GetJSON(tenant.Default, "order-1")
+	require.True(t, ok)
+	assert.Same(t, &got[0], &again[0], "the serialized order is kept in the cache")
+
+	_, ok = c.GetJSON(tenant.Default, "missing")
+	assert.False(t, ok)
+	_, ok = c.GetJSON("market-b", "order-1")
+	assert.False(t, ok)
+}
+
+func TestGetJSONInvalidatedOnChange(t *testing.T) {
+	c := newTestCache(t, 4, 0, 0)
+	c.SetKeepJSON(true)
+	trackOf := func() string {
+		t.Helper()
+		data, ok := c.GetJSON(tenant.Default, "order-1")
+		require.True(t, ok)
+		var o orders.Order
+		require.NoError(t, json.Unmarshal(data, &o))
+		return o.TrackNumber
+	}
+
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-1", TrackNumber: "A"})
+	assert.Equal(t, "A", trackOf())
+
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-1", TrackNumber: "B"})
+	assert.Equal(t, "B", trackOf())
+
+	c.SetIfNewer(tenant.Default, orders.Order{OrderUid: "order-1", TrackNumber: "C"}, time.Now().UnixNano())
+	assert.Equal(t, "C", trackOf())
+
+	c.Delete(tenant.Default, "order-1")
+	_, ok := c.GetJSON(tenant.Default, "order-1")
+	assert.False(t, ok)
+}
+
+func TestGetJSONHonoursTTL(t *testing.T) {
+	c, clock := newClockedCache(t, 4, 0, time.Minute)
+	c.SetKeepJSON(true)
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-1"})
+	_, ok := c.GetJSON(tenant.Default, "order-1")
+	require.True(t, ok)
+
+	clock.Advance(2 * time.Minute)
+	_, ok = c.GetJSON(tenant.Default, "order-1")
+	assert.False(t, ok)
+}
+
+func TestMarkMissing(t *testing.T) {
+	c, clock := newClockedCache(t, 4, 0, 0)
+	c.MarkMissing(tenant.Default, "order-1")
+	assert.False(t, c.IsMissing(tenant.Default, "order-1"), "disabled by default")
+
+	c.SetMissingTTL(time.Minute)
+	c.MarkMissing(tenant.Default, "order-1")
+	assert.True(t, c.IsMissing(tenant.Default, "order-1"))
+	assert.False(t, c.IsMissing("market-b", "order-1"), "marks are per tenant")
+
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-1"})
+	assert.False(t, c.IsMissing(tenant.Default, "order-1"), "writing the order clears the mark")
+	c.MarkMissing(tenant.Default, "order-1")
+	assert.False(t, c.IsMissing(tenant.Default, "order-1"), "a cached order is never marked missing")
+
+	c.MarkMissing(tenant.Default, "order-3")
+	c.Delete(tenant.Default, "order-3")
+	assert.False(t, c.IsMissing(tenant.Default, "order-3"), "Delete clears the mark")
+
+	c.MarkMissing(tenant.Default, "order-2")
+	require.True(t, c.IsMissing(tenant.Default, "order-2"))
+	clock.Advance(time.Minute)
+	assert.False(t, c.IsMissing(tenant.Default, "order-2"), "marks expire after the missing TTL")
+}
+
+func TestMarkMissingIsBoundedPerShard(t *testing.T) {
+	c := newTestCache(t, 1, 0, 0)
+	c.SetMissingTTL(time.Minute)
+	for i := 0; i < maxMissingPerShard+10; i++ {
+		c.MarkMissing(tenant.Default, fmt.Sprintf("order-%d", i))
+	}
+	assert.Len(t, c.table().shards[0].missing, maxMissingPerShard)
+	assert.False(t, c.IsMissing(tenant.Default, fmt.Sprintf("order-%d", maxMissingPerShard)))
+}
+
+func TestPinnedEntrySurvivesTTL(t *testing.T) {
+	c, clock := newClockedCache(t, 1, 0, time.Minute)
+	c.Set(tenant.Default, orders.Order{OrderUid: "watched"})
+	c.Set(tenant.Default, orders.Order{OrderUid: "other"})
+	require.NoError(t, c.Pin(tenant.Default, "watched"))
+
+	clock.Advance(2 * time.Minute)
+	c.cleanup()
+	_, ok := c.Get(tenant.Default, "watched")
+	assert.True(t, ok, "pinned entry does not expire")
+	_, ok = c.Get(tenant.Default, "other")
+	assert.False(t, ok, "entries after a pinned one are still evicted")
+
+	// После Unpin срок жизни отсчитывается от времени записи, поэтому запись сразу устаревает
+	assert.True(t, c.Unpin(tenant.Default, "watched"))
+	assert.False(t, c.Unpin(tenant.Default, "watched"))
+	_, ok = c.Get(tenant.Default, "watched")
+	assert.False(t, ok)
+	assert.Empty(t, c.Pinned())
+}
+
+func TestPinnedEntrySurvivesCapacityPressure(t *testing.T) {
+	c := newTestCache(t, 1, 3, 0)
+	c.Set(tenant.Default, orders.Order{OrderUid: "watched"})
+	require.NoError(t, c.Pin(tenant.Default, "watched"))
+	for i := 0; i < 10; i++ {
+		c.Set(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("order-%d", i)})
+	}
+
+	_, ok := c.Get(tenant.Default, "watched")
+	assert.True(t, ok, "pinned entry is not an LRU victim")
+	assert.Equal(t, 3, c.Len(), "unpinned entries are still evicted to the limit")
+	for i := 8; i < 10; i++ {
+		_, ok := c.Get(tenant.Default, fmt.Sprintf("order-%d", i))
+		assert.True(t, ok, "order-%d", i)
+	}
+
+	// Без закрепления запись снова вытесняется как наименее недавно использованная
+	require.True(t, c.Unpin(tenant.Default, "watched"))
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-8"})
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-9"})
+	c.Set(tenant.Default, orders.Order{OrderUid: "order-10"})
+	_, ok = c.Get(tenant.Default, "watched")
+	assert.False(t, ok)
+}
+
+func TestPinLimitAndDelete(t *testing.T) {
+	c := newTestCache(t, 4, 0, 0)
+	c.SetMaxPinned(2)
+	for i := 0; i < 3; i++ {
+		c.Set(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("order-%d", i)})
+	}
+	assert.ErrorIs(t, c.Pin(tenant.Default, "missing"), ErrNotCached)
+	require.NoError(t, c.Pin(tenant.Default, "order-0"))
+	require.NoError(t, c.Pin(tenant.Default, "ORDER-1"))
+	require.NoError(t, c.Pin(tenant.Default, "order-1"), "pinning twice is not an error")
+	assert.ErrorIs(t, c.Pin(tenant.Default, "order-2"), ErrPinLimit)
+	assert.Equal(t, []string{tenant.Key(tenant.Default, "order-0"), tenant.Key(tenant.Default, "order-1")}, c.Pinned())
+
+	// Delete удаляет и закреплённую запись, освобождая место в лимите
+	c.Delete(tenant.Default, "order-0")
+	_, ok := c.Get(tenant.Default, "order-0")
+	assert.False(t, ok)
+	require.NoError(t, c.Pin(tenant.Default, "order-2"))
+
+	require.NoError(t, c.Resize(8))
+	assert.Equal(t, []string{tenant.Key(tenant.Default, "order-1"), tenant.Key(tenant.Default, "order-2")}, c.Pinned(), "Resize keeps pins")
+}
@@ -0,0 +1,318 @@
+// Package cachetest содержит общий набор проверок реализаций кэша заказов и их поддельную реализацию в памяти.
+// Реализации кэша (шардированный кэш, выключенный кэш, кэш с переключением) подставляются в сервер через один
+// интерфейс, и Run проверяет, что семантика у них одна: запись перезаписывает заказ, чтение возвращает копию,
+// записи устаревают по TTL и вытесняются при достижении лимита, а конкурентные обращения безопасны. Отступления
+// реализации от контракта объявляются явно в Deviations.
+package cachetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Cache - методы кэша заказов, которые проверяет Run; совпадает с интерфейсом кэша сервера.
+type Cache interface {
+	Set(tenantID string, order orders.Order)
+	SetIfNewer(tenantID string, order orders.Order, version int64) bool
+	Get(tenantID, id string) (orders.Order, bool)
+	GetJSON(tenantID, id string) ([]byte, bool)
+	MarkMissing(tenantID, id string)
+	IsMissing(tenantID, id string) bool
+	Contains(tenantID, id string) bool
+	Delete(tenantID, id string)
+	LoadFromSlice(tenantID string, list []orders.Order)
+	Range(fn func(tenantID, id string, o orders.Order) bool)
+	Len() int
+}
+
+// Options - настройки кэша, который создаёт Factory.
+type Options struct {
+	MaxItems   int           // лимит записей; 0 — без ограничения
+	TTL        time.Duration // время жизни записей; 0 — записи не устаревают
+	MissingTTL time.Duration // срок отметок MarkMissing; 0 — отсутствие заказов не запоминается
+	Clock      clock.Clock   // часы кэша
+}
+
+// Factory создает кэш с настройками opts для теста t. Закрыть кэш по завершении теста должна сама Factory
+// (например, через t.Cleanup).
+type Factory func(t *testing.T, opts Options) Cache
+
+// Deviations - объявленные отступления реализации от контракта. Нулевое значение означает полный контракт.
+type Deviations struct {
+	Discards   bool // кэш ничего не хранит: чтения промахиваются, SetIfNewer возвращает false, Len равен 0
+	NoTTL      bool // записи не устаревают по Options.TTL
+	NoEviction bool // лимит Options.MaxItems не соблюдается
+	NoLRU      bool // вытеснение не учитывает чтения: первыми вытесняются самые ранние записи
+}
+
+// clockStart - время, с которого Run запускает часы кэша
+var clockStart = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// Тенанты, заказы которых записывает Run
+const (
+	tenantA = "tenant-a"
+	tenantB = "tenant-b"
+)
+
+// order - заказ id с трек-номером track
+func order(id, track string) orders.Order {
+	return orders.Order{
+		OrderUid:    id,
+		TrackNumber: track,
+		Items:       []orders.Item{{ChrtId: 1, TrackNumber: track, Name: "Mascaras"}},
+	}
+}
+
+// Run проверяет реализацию кэша, которую создаёт factory, с учётом объявленных отступлений dev. Каждая проверка
+// выполняется подтестом с новым кэшем.
+func Run(t *testing.T, factory Factory, dev Deviations) {
+	newCache := func(t *testing.T, opts Options) (Cache, *clock.Fake) {
+		clk := clock.NewFake(clockStart)
+		opts.Clock = clk
+		return factory(t, opts), clk
+	}
+
+	t.Run("SetGetDelete", func(t *testing.T) {
+		c, _ := newCache(t, Options{})
+		c.Set(tenantA, order("order-1", "TRACK-1"))
+		got, ok := c.Get(tenantA, "order-1")
+		if dev.Discards {
+			assert.False(t, ok)
+			assert.False(t, c.Contains(tenantA, "order-1"))
+			assert.Zero(t, c.Len())
+			c.Delete(tenantA, "order-1")
+			return
+		}
+		require.True(t, ok)
+		assert.Equal(t, order("order-1", "TRACK-1"), got)
+		assert.True(t, c.Contains(tenantA, "order-1"))
+		assert.Equal(t, 1, c.Len())
+		_, ok = c.Get(tenantA, "ORDER-1")
+		assert.True(t, ok, "order ids are case-insensitive")
+		_, ok = c.Get(tenantB, "order-1")
+		assert.False(t, ok, "tenants do not see each other's orders")
+
+		c.Delete(tenantA, "order-1")
+		_, ok = c.Get(tenantA, "order-1")
+		assert.False(t, ok)
+		assert.False(t, c.Contains(tenantA, "order-1"))
+		assert.Zero(t, c.Len())
+		c.Delete(tenantA, "order-1")
+	})
+
+	t.Run("SetOverwrites", func(t *testing.T) {
+		c, _ := newCache(t, Options{})
+		c.Set(tenantA, order("order-1", "OLD"))
+		c.Set(tenantA, order("order-1", "NEW"))
+		if dev.Discards {
+			assert.False(t, c.SetIfNewer(tenantA, order("order-1", "V5"), 5))
+			return
+		}
+		got, _ := c.Get(tenantA, "order-1")
+		assert.Equal(t, "NEW", got.TrackNumber)
+		assert.Equal(t, 1, c.Len())
+
+		assert.True(t, c.SetIfNewer(tenantA, order("order-1", "V5"), 5))
+		assert.False(t, c.SetIfNewer(tenantA, order("order-1", "V3"), 3), "an older version is ignored")
+		got, _ = c.Get(tenantA, "order-1")
+		assert.Equal(t, "V5", got.TrackNumber)
+		assert.True(t, c.SetIfNewer(tenantA, order("order-1", "V6"), 6))
+		got, _ = c.Get(tenantA, "order-1")
+		assert.Equal(t, "V6", got.TrackNumber)
+	})
+
+	t.Run("CopyOnRead", func(t *testing.T) {
+		if dev.Discards {
+			t.Skip("the cache stores nothing")
+		}
+		c, _ := newCache(t, Options{})
+		o := order("order-1", "TRACK-1")
+		c.Set(tenantA, o)
+		o.TrackNumber = "CHANGED AFTER SET"
+		got, _ := c.Get(tenantA, "order-1")
+		assert.Equal(t, "TRACK-1", got.TrackNumber, "the cache keeps its own copy of the order")
+		got.TrackNumber = "CHANGED AFTER GET"
+		got, _ = c.Get(tenantA, "order-1")
+		assert.Equal(t, "TRACK-1", got.TrackNumber, "Get returns a copy of the order")
+	})
+
+	t.Run("GetJSON", func(t *testing.T) {
+		c, _ := newCache(t, Options{})
+		c.Set(tenantA, order("order-1", "OLD"))
+		data, ok := c.GetJSON(tenantA, "order-1")
+		if !ok {
+			// GetJSON вправе всегда промахиваться: тогда заказ читается через Get
+			return
+		}
+		require.False(t, dev.Discards, "a discarding cache returned JSON")
+		var got orders.Order
+		require.NoError(t, json.Unmarshal(data, &got))
+		assert.Equal(t, "OLD", got.TrackNumber)
+
+		c.Set(tenantA, order("order-1", "NEW"))
+		if data, ok = c.GetJSON(tenantA, "order-1"); ok {
+			require.NoError(t, json.Unmarshal(data, &got))
+			assert.Equal(t, "NEW", got.TrackNumber, "JSON of an overwritten order is not served")
+		}
+		c.Delete(tenantA, "order-1")
+		_, ok = c.GetJSON(tenantA, "order-1")
+		assert.False(t, ok)
+	})
+
+	t.Run("MissingMarks", func(t *testing.T) {
+		c, clk := newCache(t, Options{MissingTTL: time.Minute})
+		c.MarkMissing(tenantA, "absent")
+		if dev.Discards {
+			assert.False(t, c.IsMissing(tenantA, "absent"))
+			return
+		}
+		assert.True(t, c.IsMissing(tenantA, "absent"))
+		assert.False(t, c.IsMissing(tenantB, "absent"))
+		clk.Advance(time.Minute + time.Second)
+		assert.False(t, c.IsMissing(tenantA, "absent"), "marks expire after MissingTTL")
+
+		c.MarkMissing(tenantA, "absent")
+		c.Set(tenantA, order("absent", "TRACK-1"))
+		assert.False(t, c.IsMissing(tenantA, "absent"), "storing the order clears the mark")
+
+		c, _ = newCache(t, Options{})
+		c.MarkMissing(tenantA, "absent")
+		assert.False(t, c.IsMissing(tenantA, "absent"), "without MissingTTL nothing is remembered")
+	})
+
+	t.Run("LoadFromSliceAndRange", func(t *testing.T) {
+		c, _ := newCache(t, Options{})
+		c.Set(tenantA, order("order-1", "FRESH"))
+		c.LoadFromSlice(tenantA, []orders.Order{order("order-1", "SNAPSHOT"), order("order-2", "SNAPSHOT")})
+		c.Set(tenantB, order("order-1", "OTHER TENANT"))
+
+		seen := map[string]string{}
+		c.Range(func(tenantID, id string, o orders.Order) bool {
+			seen[tenantID+"/"+id] = o.TrackNumber
+			return true
+		})
+		calls := 0
+		c.Range(func(string, string, orders.Order) bool {
+			calls++
+			return false
+		})
+		if dev.Discards {
+			assert.Empty(t, seen)
+			assert.Zero(t, calls)
+			return
+		}
+		assert.Equal(t, map[string]string{
+			tenantA + "/order-1": "FRESH",
+			tenantA + "/order-2": "SNAPSHOT",
+			tenantB + "/order-1": "OTHER TENANT",
+		}, seen, "loading does not overwrite cached orders")
+		assert.Equal(t, 1, calls, "Range stops when fn returns false")
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		if dev.Discards || dev.NoTTL {
+			t.Skip("entries do not expire")
+		}
+		c, clk := newCache(t, Options{TTL: time.Minute})
+		c.Set(tenantA, order("order-1", "TRACK-1"))
+		clk.Advance(time.Minute - time.Second)
+		_, ok := c.Get(tenantA, "order-1")
+		assert.True(t, ok)
+
+		clk.Advance(2 * time.Second)
+		_, ok = c.Get(tenantA, "order-1")
+		assert.False(t, ok, "an entry expires TTL after it was stored")
+		assert.False(t, c.Contains(tenantA, "order-1"))
+		c.Range(func(_, id string, _ orders.Order) bool {
+			t.Errorf("Range visited expired order %s", id)
+			return true
+		})
+
+		c.Set(tenantA, order("order-1", "TRACK-2"))
+		got, ok := c.Get(tenantA, "order-1")
+		assert.True(t, ok, "storing the order again restarts its TTL")
+		assert.Equal(t, "TRACK-2", got.TrackNumber)
+	})
+
+	t.Run("Eviction", func(t *testing.T) {
+		if dev.Discards || dev.NoEviction {
+			t.Skip("the cache does not evict")
+		}
+		c, _ := newCache(t, Options{MaxItems: 3})
+		for _, id := range []string{"order-a", "order-b", "order-c"} {
+			c.Set(tenantA, order(id, "TRACK"))
+		}
+		_, ok := c.Get(tenantA, "order-a")
+		require.True(t, ok)
+		c.Set(tenantA, order("order-d", "TRACK"))
+
+		assert.LessOrEqual(t, c.Len(), 3)
+		assert.True(t, c.Contains(tenantA, "order-d"), "the newest entry is kept")
+		if dev.NoLRU {
+			assert.False(t, c.Contains(tenantA, "order-a"), "the oldest entry is evicted first")
+			assert.True(t, c.Contains(tenantA, "order-b"))
+		} else {
+			assert.True(t, c.Contains(tenantA, "order-a"), "a recently read entry is kept")
+			assert.False(t, c.Contains(tenantA, "order-b"), "the least recently used entry is evicted")
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		c, _ := newCache(t, Options{MaxItems: 64, TTL: time.Hour, MissingTTL: time.Minute})
+		var wg sync.WaitGroup
+		for g := range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range 200 {
+					id := fmt.Sprintf("order-%d", (g*i)%100)
+					switch i % 5 {
+					case 0:
+						c.Set(tenantA, order(id, strings.ToUpper(id)))
+					case 1:
+						c.SetIfNewer(tenantA, order(id, strings.ToUpper(id)), int64(i))
+					case 2:
+						c.Delete(tenantA, id)
+					case 3:
+						c.MarkMissing(tenantA, id)
+						c.IsMissing(tenantA, id)
+					default:
+						c.Contains(tenantA, id)
+						c.GetJSON(tenantA, id)
+					}
+					if got, ok := c.Get(tenantA, id); ok && got.TrackNumber != strings.ToUpper(got.OrderUid) {
+						t.Errorf("Get(%s) returned order %s with track %s", id, got.OrderUid, got.TrackNumber)
+					}
+					if i%50 == 0 {
+						c.Range(func(string, string, orders.Order) bool { return true })
+						c.Len()
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if !dev.NoEviction {
+			assert.LessOrEqual(t, c.Len(), 64)
+		}
+	})
+
+	t.Run("CloseIsIdempotent", func(t *testing.T) {
+		c, _ := newCache(t, Options{TTL: time.Minute, MaxItems: 8})
+		closer, ok := c.(interface{ Close() })
+		if !ok {
+			t.Skip("the cache has no Close")
+		}
+		closer.Close()
+		closer.Close()
+	})
+}
@@ -0,0 +1,188 @@
+package cachetest
+
+import (
+	"sync"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/ids"
+	"l0_test_self/internal/jsonpool"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+)
+
+// Fake - простая реализация кэша заказов в памяти для тестов: одна карта под одной блокировкой, без шардов и фоновой
+// очистки. Устаревшие записи удаляются при обращении к ним, а при достижении лимита вытесняется наименее недавно
+// использованная запись. Fake проходит Run без отступлений.
+type Fake struct {
+	opts Options
+
+	mu      sync.Mutex
+	items   map[string]*fakeEntry
+	missing map[string]time.Time // срок отметок MarkMissing по ключам заказов
+	tick    uint64               // счётчик обращений для порядка вытеснения
+}
+
+// fakeEntry - запись Fake
+type fakeEntry struct {
+	tenant   string
+	order    orders.Order
+	version  int64
+	storedAt time.Time
+	used     uint64
+}
+
+// NewFake создает пустой кэш с настройками opts; без Options.Clock используется clock.Real.
+func NewFake(opts Options) *Fake {
+	if opts.Clock == nil {
+		opts.Clock = clock.Real
+	}
+	return &Fake{opts: opts, items: make(map[string]*fakeEntry), missing: make(map[string]time.Time)}
+}
+
+// fakeKey - ключ заказа id арендатора tenantID, как в шардированном кэше
+func fakeKey(tenantID, id string) string {
+	return tenant.Key(tenantID, ids.Normalize(id))
+}
+
+// liveLocked возвращает актуальную запись key, удаляя устаревшую. Вызывается под блокировкой.
+func (f *Fake) liveLocked(key string) (*fakeEntry, bool) {
+	ent, ok := f.items[key]
+	if ok && f.opts.TTL > 0 && f.opts.Clock.Now().Sub(ent.storedAt) > f.opts.TTL {
+		delete(f.items, key)
+		return nil, false
+	}
+	return ent, ok
+}
+
+// set реализует Set, SetIfNewer и LoadFromSlice: запись выполняется, если allow разрешает её для текущей записи
+func (f *Fake) set(tenantID string, o orders.Order, version int64, allow func(cur *fakeEntry) bool) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	o.OrderUid = ids.Normalize(o.OrderUid)
+	key := fakeKey(tenantID, o.OrderUid)
+	delete(f.missing, key)
+	cur, ok := f.liveLocked(key)
+	if ok && !allow(cur) {
+		return false
+	}
+	f.tick++
+	f.items[key] = &fakeEntry{tenant: tenantID, order: o, version: version, storedAt: f.opts.Clock.Now(), used: f.tick}
+	if f.opts.MaxItems > 0 && len(f.items) > f.opts.MaxItems {
+		f.evictLocked()
+	}
+	return true
+}
+
+// evictLocked удаляет наименее недавно использованную запись. Вызывается под блокировкой.
+func (f *Fake) evictLocked() {
+	var oldest string
+	for key, ent := range f.items {
+		if oldest == "" || ent.used < f.items[oldest].used {
+			oldest = key
+		}
+	}
+	delete(f.items, oldest)
+}
+
+// Set записывает заказ арендатора tenantID, заменяя прежний.
+func (f *Fake) Set(tenantID string, o orders.Order) {
+	f.set(tenantID, o, 0, func(*fakeEntry) bool { return true })
+}
+
+// SetIfNewer записывает заказ, если в кэше нет его версии новее или равной version.
+func (f *Fake) SetIfNewer(tenantID string, o orders.Order, version int64) bool {
+	return f.set(tenantID, o, version, func(cur *fakeEntry) bool { return cur.version < version })
+}
+
+// LoadFromSlice добавляет заказы арендатора tenantID, которых ещё нет в кэше.
+func (f *Fake) LoadFromSlice(tenantID string, list []orders.Order) {
+	for _, o := range list {
+		f.set(tenantID, o, 0, func(*fakeEntry) bool { return false })
+	}
+}
+
+// Get возвращает заказ арендатора tenantID и продлевает жизнь записи при вытеснении.
+func (f *Fake) Get(tenantID, id string) (orders.Order, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ent, ok := f.liveLocked(fakeKey(tenantID, id))
+	if !ok {
+		return orders.Order{}, false
+	}
+	f.tick++
+	ent.used = f.tick
+	return ent.order, true
+}
+
+// GetJSON возвращает заказ в JSON, как его пишет json.Encoder.
+func (f *Fake) GetJSON(tenantID, id string) ([]byte, bool) {
+	o, ok := f.Get(tenantID, id)
+	if !ok {
+		return nil, false
+	}
+	data, err := jsonpool.Marshal(o)
+	return data, err == nil
+}
+
+// MarkMissing запоминает отсутствие заказа на Options.MissingTTL.
+func (f *Fake) MarkMissing(tenantID, id string) {
+	if f.opts.MissingTTL <= 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.missing[fakeKey(tenantID, id)] = f.opts.Clock.Now().Add(f.opts.MissingTTL)
+}
+
+// IsMissing сообщает, помнит ли кэш отсутствие заказа.
+func (f *Fake) IsMissing(tenantID, id string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	expires, ok := f.missing[fakeKey(tenantID, id)]
+	return ok && f.opts.Clock.Now().Before(expires)
+}
+
+// Contains сообщает, есть ли в кэше актуальный заказ, не продлевая жизнь записи.
+func (f *Fake) Contains(tenantID, id string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.liveLocked(fakeKey(tenantID, id))
+	return ok
+}
+
+// Delete удаляет заказ и отметку об его отсутствии.
+func (f *Fake) Delete(tenantID, id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := fakeKey(tenantID, id)
+	delete(f.items, key)
+	delete(f.missing, key)
+}
+
+// Range вызывает fn для снимка актуальных заказов, пока fn возвращает true; fn может обращаться к кэшу.
+func (f *Fake) Range(fn func(tenantID, id string, o orders.Order) bool) {
+	f.mu.Lock()
+	snapshot := make([]fakeEntry, 0, len(f.items))
+	for key := range f.items {
+		if ent, ok := f.liveLocked(key); ok {
+			snapshot = append(snapshot, *ent)
+		}
+	}
+	f.mu.Unlock()
+	for _, ent := range snapshot {
+		if !fn(ent.tenant, ent.order.OrderUid, ent.order) {
+			return
+		}
+	}
+}
+
+// Len возвращает число записей, включая ещё не удалённые устаревшие.
+func (f *Fake) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.items)
+}
+
+// Close ничего не делает: у Fake нет фоновой работы.
+func (f *Fake) Close() {}
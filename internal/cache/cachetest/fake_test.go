@@ -0,0 +1,7 @@
+package cachetest
+
+import "testing"
+
+func TestFakeConformance(t *testing.T) {
+	Run(t, func(t *testing.T, opts Options) Cache { return NewFake(opts) }, Deviations{})
+}
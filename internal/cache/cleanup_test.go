@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/tenant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shardIndex - номер шарда текущей таблицы, в который попадает заказ id арендатора по умолчанию
+func shardIndex(c *OrderCache, id string) int {
+	t := c.table()
+	s := t.shardFor(orderKey(tenant.Default, id))
+	for i := range t.shards {
+		if t.shards[i] == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestRunCleanupReport(t *testing.T) {
+	clock := newFakeClock()
+	c := newOptionsCache(t, WithShards(4), WithTTL(10*time.Minute), WithDemoteAfter(5*time.Minute), WithCleanupInterval(time.Hour), WithClock(clock))
+
+	want := make([]ShardCleanup, c.ShardCount())
+	for i := range want {
+		want[i].Shard = i
+	}
+	for i := 0; i < 6; i++ {
+		id := fmt.Sprintf("expired-%d", i)
+		c.Set(tenant.Default, itemsOrder(id, 1))
+		want[shardIndex(c, id)].Expired++
+	}
+	clock.Advance(11 * time.Minute)
+	for i := 0; i < 4; i++ {
+		id := fmt.Sprintf("cold-%d", i)
+		c.Set(tenant.Default, itemsOrder(id, 2))
+		want[shardIndex(c, id)].Demoted++
+	}
+	clock.Advance(6 * time.Minute)
+	c.Set(tenant.Default, itemsOrder("fresh", 2))
+
+	report, err := c.RunCleanup()
+	require.NoError(t, err)
+	assert.Equal(t, 6, report.Expired)
+	assert.Equal(t, 4, report.Demoted)
+	assert.Zero(t, report.Evicted)
+	require.Len(t, report.Shards, 4)
+	for i, got := range report.Shards {
+		assert.GreaterOrEqual(t, got.Duration, time.Duration(0))
+		got.Duration = 0
+		assert.Equal(t, want[i], got, "shard %d", i)
+	}
+	assert.Equal(t, 5, c.Len())
+	assert.Equal(t, 4, c.DemotionStats().Demoted)
+
+	// Повторный проход ничего не находит
+	report, err = c.RunCleanup()
+	require.NoError(t, err)
+	assert.Zero(t, report.Expired+report.Evicted+report.Demoted)
+}
+
+func TestRunCleanupEvictsOverCapacity(t *testing.T) {
+	c := newOptionsCache(t, WithShards(1), WithMaxItems(2))
+	// Два закреплённых заказа, которые после Resize до двух шардов попадут в один шард ёмкостью 1
+	next := newShardTable(2, 2)
+	var ids []string
+	for i := 0; len(ids) < 2; i++ {
+		id := fmt.Sprintf("order-%d", i)
+		if next.shardFor(orderKey(tenant.Default, id)) == next.shards[0] {
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range ids {
+		c.Set(tenant.Default, itemsOrder(id, 1))
+		require.NoError(t, c.Pin(tenant.Default, id))
+	}
+	require.NoError(t, c.Resize(2))
+	require.Equal(t, 2, c.Len(), "pinned entries are not evicted by Resize")
+	for _, id := range ids {
+		require.True(t, c.Unpin(tenant.Default, id))
+	}
+
+	report, err := c.RunCleanup()
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Evicted)
+	assert.Equal(t, 1, report.Shards[0].Evicted)
+	assert.Equal(t, 1, c.Len())
+	_, ok := c.Get(tenant.Default, ids[1])
+	assert.True(t, ok, "the least recently used entry is evicted")
+}
+
+func TestRunCleanupDoesNotOverlap(t *testing.T) {
+	clock := newFakeClock()
+	c := newOptionsCache(t, WithShards(4), WithTTL(time.Minute), WithCleanupInterval(time.Hour), WithClock(clock))
+	const seeded = 200
+	for i := 0; i < seeded; i++ {
+		c.Set(tenant.Default, itemsOrder(fmt.Sprintf("order-%d", i), 1))
+	}
+	clock.Advance(2 * time.Minute)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		expired int
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report, err := c.RunCleanup()
+			if err != nil {
+				assert.ErrorIs(t, err, ErrCleanupRunning)
+				return
+			}
+			mu.Lock()
+			expired += report.Expired
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, seeded, expired, "every expired entry is counted exactly once")
+	assert.Zero(t, c.Len())
+
+	// Пока выполняется фоновый проход, ручной запуск отклоняется
+	c.cleanupMu.Lock()
+	_, err := c.RunCleanup()
+	c.cleanupMu.Unlock()
+	assert.ErrorIs(t, err, ErrCleanupRunning)
+}
@@ -0,0 +1,41 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"l0_test_self/internal/cache"
+	"l0_test_self/internal/cache/cachetest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newConformanceFactory - фабрика кэша для cachetest.Run с политикой вытеснения policy. Кэш имеет один шард, чтобы
+// лимит записей и порядок вытеснения были общими для всех заказов, а фоновая очистка не успевает сработать
+func newConformanceFactory(policy cache.EvictionPolicy) cachetest.Factory {
+	return func(t *testing.T, opts cachetest.Options) cachetest.Cache {
+		options := []cache.Option{
+			cache.WithShards(1),
+			cache.WithTTL(opts.TTL),
+			cache.WithCleanupInterval(time.Hour),
+			cache.WithClock(opts.Clock),
+		}
+		if opts.MaxItems > 0 {
+			options = append(options, cache.WithMaxItems(opts.MaxItems), cache.WithEvictionPolicy(policy))
+		}
+		c, err := cache.NewWithOptions(options...)
+		require.NoError(t, err)
+		t.Cleanup(c.Close)
+		c.SetMissingTTL(opts.MissingTTL)
+		c.SetKeepJSON(true)
+		return c
+	}
+}
+
+func TestConformanceLRU(t *testing.T) {
+	cachetest.Run(t, newConformanceFactory(cache.EvictLRU), cachetest.Deviations{})
+}
+
+func TestConformanceFIFO(t *testing.T) {
+	cachetest.Run(t, newConformanceFactory(cache.EvictFIFO), cachetest.Deviations{NoLRU: true})
+}
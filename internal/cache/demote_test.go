@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// itemsOrder - заказ id с items товарами
+func itemsOrder(id string, items int) orders.Order {
+	o := orders.Order{OrderUid: id, TrackNumber: "WBILMTESTTRACK"}
+	for i := 0; i < items; i++ {
+		o.Items = append(o.Items, orders.Item{ChrtId: i + 1, Name: "Mascaras"})
+	}
+	return o
+}
+
+// newDemotingCache - кэш с понижением записей после demoteAfter без обращений и управляемым временем; фоновая
+// очистка не успевает сработать, понижение вызывается тестом
+func newDemotingCache(t *testing.T, demoteAfter time.Duration) (*OrderCache, *clock.Fake) {
+	t.Helper()
+	clock := newFakeClock()
+	c := newOptionsCache(t, WithDemoteAfter(demoteAfter), WithCleanupInterval(time.Hour), WithClock(clock))
+	return c, clock
+}
+
+func TestDemoteColdEntries(t *testing.T) {
+	c, clock := newDemotingCache(t, time.Hour)
+	c.Set(tenant.Default, itemsOrder("cold", 3))
+	c.Set(tenant.Default, itemsOrder("hot", 3))
+	c.Set(tenant.Default, itemsOrder("no-items", 0))
+	c.Set(tenant.Default, itemsOrder("pinned", 3))
+	require.NoError(t, c.Pin(tenant.Default, "pinned"))
+
+	clock.Advance(50 * time.Minute)
+	_, ok := c.Get(tenant.Default, "hot")
+	require.True(t, ok)
+	clock.Advance(10 * time.Minute)
+	c.cleanup()
+	assert.Equal(t, DemotionStats{}, c.DemotionStats(), "exactly demote_after without access is not cold yet")
+
+	clock.Advance(time.Second)
+	c.cleanup()
+	assert.Equal(t, DemotionStats{Demoted: 1, Demotions: 1}, c.DemotionStats())
+	_, ok = c.Get(tenant.Default, "cold")
+	assert.False(t, ok, "a demoted entry is a miss for Get")
+	for _, id := range []string{"hot", "no-items", "pinned"} {
+		got, ok := c.Get(tenant.Default, id)
+		assert.True(t, ok, id)
+		assert.Equal(t, itemsOrder(id, len(got.Items)), got, id)
+	}
+
+	// Уже пониженная запись повторно не учитывается; "hot" понижается через час после последнего чтения
+	clock.Advance(61 * time.Minute)
+	c.cleanup()
+	assert.Equal(t, DemotionStats{Demoted: 2, Demotions: 2}, c.DemotionStats())
+	assert.Equal(t, 4, c.Len(), "demoted entries stay in the cache")
+}
+
+func TestDemotedEntryAnswersExistence(t *testing.T) {
+	c, clock := newDemotingCache(t, time.Minute)
+	c.SetKeepJSON(true)
+	c.Set(tenant.Default, itemsOrder("order-1", 2))
+	clock.Advance(2 * time.Minute)
+	c.cleanup()
+
+	assert.True(t, c.Contains(tenant.Default, "order-1"))
+	assert.True(t, c.Contains(tenant.Default, "ORDER-1"), "ids are case-insensitive")
+	assert.False(t, c.Contains(tenant.Default, "order-2"))
+	assert.False(t, c.Contains("market-a", "order-1"))
+	_, ok := c.GetJSON(tenant.Default, "order-1")
+	assert.False(t, ok, "serialized JSON is dropped with the items")
+	assert.Equal(t, []string{tenant.Key(tenant.Default, "order-1")}, c.Keys())
+	c.Range(func(_, id string, _ orders.Order) bool {
+		t.Errorf("Range visits demoted order %s", id)
+		return true
+	})
+	assert.ErrorIs(t, c.Pin(tenant.Default, "order-1"), ErrNotCached, "a demoted order is reloaded before pinning")
+
+	// Проверка существования не возвращает запись к полному виду
+	assert.Equal(t, DemotionStats{Demoted: 1, Demotions: 1}, c.DemotionStats())
+}
+
+func TestRepromoteOnReload(t *testing.T) {
+	c, clock := newDemotingCache(t, time.Minute)
+	full := itemsOrder("order-1", 2)
+	require.True(t, c.SetIfNewer(tenant.Default, full, 1))
+	clock.Advance(2 * time.Minute)
+	c.cleanup()
+	_, ok := c.Get(tenant.Default, "order-1")
+	require.False(t, ok)
+
+	// Перезагрузка из базы данных записывает заказ с версией момента чтения
+	assert.True(t, c.SetIfNewer(tenant.Default, full, 2))
+	got, ok := c.Get(tenant.Default, "order-1")
+	require.True(t, ok)
+	assert.Equal(t, full, got)
+	assert.Equal(t, DemotionStats{Demoted: 0, Demotions: 1, Repromotions: 1}, c.DemotionStats())
+
+	// Возвращённая запись снова понижается, если к ней перестают обращаться
+	clock.Advance(2 * time.Minute)
+	c.cleanup()
+	assert.Equal(t, DemotionStats{Demoted: 1, Demotions: 2, Repromotions: 1}, c.DemotionStats())
+
+	// Удаление пониженной записи уменьшает счётчик пониженных
+	c.Delete(tenant.Default, "order-1")
+	assert.Equal(t, 0, c.DemotionStats().Demoted)
+}
+
+func TestWithDemoteAfter(t *testing.T) {
+	c := newOptionsCache(t, WithDemoteAfter(time.Hour))
+	assert.Equal(t, time.Hour, c.DemoteAfter())
+	assert.Equal(t, time.Minute, c.cleanupEvery, "the cleanup interval defaults to a minute when demotion is enabled")
+
+	_, err := NewWithOptions(WithDemoteAfter(-time.Second))
+	assert.Error(t, err)
+
+	// Без WithDemoteAfter записи не понижаются
+	c = newOptionsCache(t)
+	c.Set(tenant.Default, itemsOrder("order-1", 1))
+	c.cleanup()
+	assert.Equal(t, DemotionStats{}, c.DemotionStats())
+}
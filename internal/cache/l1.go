@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+
+	"l0_test_self/models/orders"
+)
+
+// L1Size - число слотов L1 (WithL1): на горячие заказы после рассылки хватает нескольких сотен
+const L1Size = 256
+
+// l1Entry - копия заказа в слоте L1. После публикации в слоте не изменяется.
+type l1Entry struct {
+	key     string
+	value   orders.Order
+	encoded []byte // JSON заказа, как в GetJSON; nil — запись заполнена Get
+	seq     uint64 // l1Slot.seq на момент чтения заказа из шарда
+	expires time.Time
+}
+
+// l1Slot - слот L1. seq увеличивается при каждом изменении заказов, попадающих в слот, поэтому запись, заполненная
+// по прочитанному до изменения значению, считается недействительной, даже если опубликована после инвалидации.
+type l1Slot struct {
+	entry atomic.Pointer[l1Entry]
+	seq   atomic.Uint64
+	_     [48]byte // слот занимает строку кэша процессора целиком: инвалидация не замедляет чтение соседних слотов
+}
+
+// l1Cache - небольшой слой перед шардами для самых горячих заказов: массив слотов с атомарными указателями, чтение
+// которых не берёт блокировок. Ключ занимает слот по хешу и вытесняет прежний; записи живут не дольше ttl, что
+// ограничивает время, в течение которого L1 может расходиться с шардами (например, после вытеснения записи по LRU).
+type l1Cache struct {
+	slots [L1Size]l1Slot
+	ttl   time.Duration
+}
+
+// slot возвращает слот ключа key. Хеш FNV-1a перемешивается, чтобы номер слота не совпадал с номером шарда (shardFor).
+func (l *l1Cache) slot(key string) *l1Slot {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	h ^= h >> 16
+	return &l.slots[h%L1Size]
+}
+
+// load возвращает действующую запись ключа key или nil.
+func (s *l1Slot) load(key string, now time.Time) *l1Entry {
+	e := s.entry.Load()
+	if e == nil || e.key != key || e.seq != s.seq.Load() || !now.Before(e.expires) {
+		return nil
+	}
+	return e
+}
+
+// store публикует запись e, если её seq ещё действителен.
+func (s *l1Slot) store(e *l1Entry) {
+	if e.seq == s.seq.Load() {
+		s.entry.Store(e)
+	}
+}
+
+// invalidate делает недействительной запись слота ключа key. Вызывается под блокировкой шарда ключа до изменения
+// записи: чтение шарда, начатое после инвалидации, увидит новое значение.
+func (l *l1Cache) invalidate(key string) {
+	if l == nil {
+		return
+	}
+	s := l.slot(key)
+	s.seq.Add(1)
+	s.entry.Store(nil)
+}
+
+// getL1 реализует Get с L1: попадание не обращается к шарду, промах заполняет слот прочитанным из шарда заказом.
+func (c *OrderCache) getL1(key string) (orders.Order, bool) {
+	now := c.clock.Now()
+	s := c.l1.slot(key)
+	if e := s.load(key, now); e != nil {
+		return e.value, true
+	}
+	seq := s.seq.Load()
+	o, ok := c.get(key)
+	if ok {
+		s.store(&l1Entry{key: key, value: o, seq: seq, expires: now.Add(c.l1.ttl)})
+	}
+	return o, ok
+}
+
+// getJSONL1 реализует GetJSON с L1. Запись, заполненная Get, не содержит JSON: тогда он читается из шарда и слот
+// заполняется заново вместе с JSON.
+func (c *OrderCache) getJSONL1(key string) ([]byte, bool) {
+	now := c.clock.Now()
+	s := c.l1.slot(key)
+	if e := s.load(key, now); e != nil && e.encoded != nil {
+		return e.encoded, true
+	}
+	seq := s.seq.Load()
+	encoded, o, ok := c.getJSON(key)
+	if ok {
+		s.store(&l1Entry{key: key, value: o, encoded: encoded, seq: seq, expires: now.Add(c.l1.ttl)})
+	}
+	return encoded, ok
+}
+
+// L1TTL возвращает срок жизни заказов в L1 (WithL1); 0 — L1 выключен.
+func (c *OrderCache) L1TTL() time.Duration {
+	if c.l1 == nil {
+		return 0
+	}
+	return c.l1.ttl
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"l0_test_self/internal/clock"
+	"l0_test_self/internal/tenant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newL1Cache - кэш с L1 со сроком ttl и управляемым временем
+func newL1Cache(t *testing.T, ttl time.Duration, opts ...Option) (*OrderCache, *clock.Fake) {
+	t.Helper()
+	clock := newFakeClock()
+	c := newOptionsCache(t, append(opts, WithL1(ttl), WithClock(clock))...)
+	return c, clock
+}
+
+func TestL1ServesHotReadsWithoutShard(t *testing.T) {
+	c, _ := newL1Cache(t, time.Second)
+	c.Set(tenant.Default, itemsOrder("hot", 2))
+
+	got, ok := c.Get(tenant.Default, "HOT")
+	require.True(t, ok)
+	assert.Len(t, got.Items, 2)
+	accesses := c.Stats().Accesses
+
+	for i := 0; i < 10; i++ {
+		got, ok = c.Get(tenant.Default, "hot")
+		require.True(t, ok)
+		assert.Equal(t, "hot", got.OrderUid)
+	}
+	assert.Equal(t, accesses, c.Stats().Accesses, "L1 hits do not touch the shard")
+
+	_, ok = c.Get("other-tenant", "hot")
+	assert.False(t, ok, "L1 keys include the tenant")
+	_, ok = c.Get(tenant.Default, "missing")
+	assert.False(t, ok)
+}
+
+func TestL1InvalidatedOnUpdateAndDelete(t *testing.T) {
+	c, _ := newL1Cache(t, time.Hour)
+	c.Set(tenant.Default, itemsOrder("a", 1))
+	_, ok := c.Get(tenant.Default, "a")
+	require.True(t, ok)
+
+	c.Set(tenant.Default, itemsOrder("a", 3))
+	got, ok := c.Get(tenant.Default, "a")
+	require.True(t, ok)
+	assert.Len(t, got.Items, 3, "Set invalidates the L1 copy")
+
+	require.True(t, c.SetIfNewer(tenant.Default, itemsOrder("a", 4), 10))
+	got, _ = c.Get(tenant.Default, "a")
+	assert.Len(t, got.Items, 4, "SetIfNewer invalidates the L1 copy")
+
+	c.Delete(tenant.Default, "a")
+	_, ok = c.Get(tenant.Default, "a")
+	assert.False(t, ok, "Delete invalidates the L1 copy")
+}
+
+func TestL1GetJSONInvalidatedOnUpdate(t *testing.T) {
+	c, _ := newL1Cache(t, time.Hour)
+	c.SetKeepJSON(true)
+	c.Set(tenant.Default, itemsOrder("a", 1))
+
+	// Запись, заполненная Get, дополняется JSON при первом GetJSON
+	_, ok := c.Get(tenant.Default, "a")
+	require.True(t, ok)
+	first, ok := c.GetJSON(tenant.Default, "a")
+	require.True(t, ok)
+	again, ok := c.GetJSON(tenant.Default, "a")
+	require.True(t, ok)
+	assert.Same(t, &first[0], &again[0], "the encoded order is served from L1")
+
+	c.Set(tenant.Default, itemsOrder("a", 2))
+	updated, ok := c.GetJSON(tenant.Default, "a")
+	require.True(t, ok)
+	assert.NotEqual(t, string(first), string(updated))
+	assert.Contains(t, string(updated), `"chrt_id":2`)
+}
+
+func TestL1DropsFillRacingWithUpdate(t *testing.T) {
+	c, _ := newL1Cache(t, time.Hour)
+	c.Set(tenant.Default, itemsOrder("a", 1))
+	key := orderKey(tenant.Default, "a")
+	s := c.l1.slot(key)
+
+	// Чтение из шарда началось до Set, а его результат публикуется после инвалидации
+	seq := s.seq.Load()
+	stale, _ := c.get(key)
+	c.Set(tenant.Default, itemsOrder("a", 2))
+	s.entry.Store(&l1Entry{key: key, value: stale, seq: seq, expires: c.clock.Now().Add(time.Hour)})
+
+	got, ok := c.Get(tenant.Default, "a")
+	require.True(t, ok)
+	assert.Len(t, got.Items, 2, "the stale fill is ignored")
+}
+
+func TestL1EntriesExpire(t *testing.T) {
+	c, clock := newL1Cache(t, 2*time.Second, WithShards(1), WithMaxItems(1))
+	c.Set(tenant.Default, itemsOrder("a", 1))
+	_, ok := c.Get(tenant.Default, "a")
+	require.True(t, ok)
+
+	// Вытеснение по LRU удаляет и копию в L1
+	c.Set(tenant.Default, itemsOrder("b", 1))
+	_, ok = c.Get(tenant.Default, "a")
+	assert.False(t, ok)
+
+	_, ok = c.Get(tenant.Default, "b")
+	require.True(t, ok)
+	accesses := c.Stats().Accesses
+	clock.Advance(time.Second)
+	c.Get(tenant.Default, "b")
+	assert.Equal(t, accesses, c.Stats().Accesses)
+	clock.Advance(time.Second)
+	c.Get(tenant.Default, "b")
+	assert.Equal(t, accesses+1, c.Stats().Accesses, "an expired L1 entry is read from the shard again")
+}
+
+func TestWithL1RejectsNegativeTTL(t *testing.T) {
+	_, err := NewWithOptions(WithL1(-time.Second))
+	assert.Error(t, err)
+	assert.Nil(t, newOptionsCache(t).l1, "L1 is disabled by default")
+}
+
+// BenchmarkHotKey - чтение нескольких сверхгорячих заказов (одна запись на сто чтений) без L1 и с L1
+func BenchmarkHotKey(b *testing.B) {
+	ids := []string{"hot-1", "hot-2", "hot-3", "hot-4"}
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"sharded", nil},
+		{"l1", []Option{WithL1(time.Second)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			c, err := NewWithOptions(bc.opts...)
+			require.NoError(b, err)
+			defer c.Close()
+			for _, id := range ids {
+				c.Set(tenant.Default, itemsOrder(id, 1))
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					id := ids[i%len(ids)]
+					if i%100 == 99 {
+						c.Set(tenant.Default, itemsOrder(id, 1))
+					} else {
+						c.Get(tenant.Default, id)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"l0_test_self/internal/clock"
+)
+
+// DefaultShardCount - число шардов кэша NewWithOptions без WithShards.
+const DefaultShardCount = 16
+
+// EvictionPolicy - порядок вытеснения записей при достижении лимита WithMaxItems.
+type EvictionPolicy int
+
+const (
+	// EvictLRU вытесняет наименее недавно использованные записи: чтение и обновление продлевают жизнь записи (по умолчанию).
+	EvictLRU EvictionPolicy = iota
+	// EvictFIFO вытесняет записи в порядке добавления независимо от чтений; чтения не берут блокировку шарда на запись.
+	EvictFIFO
+)
+
+// String возвращает имя политики вытеснения, как в ParseEvictionPolicy.
+func (p EvictionPolicy) String() string {
+	switch p {
+	case EvictLRU:
+		return "lru"
+	case EvictFIFO:
+		return "fifo"
+	default:
+		return fmt.Sprintf("EvictionPolicy(%d)", int(p))
+	}
+}
+
+// ParseEvictionPolicy разбирает политику вытеснения по имени: lru или fifo. Пустая строка означает EvictLRU.
+func ParseEvictionPolicy(s string) (EvictionPolicy, error) {
+	switch s {
+	case "", "lru":
+		return EvictLRU, nil
+	case "fifo":
+		return EvictFIFO, nil
+	default:
+		return 0, fmt.Errorf("unknown eviction policy %q: must be lru or fifo", s)
+	}
+}
+
+// options - настройки NewWithOptions
+type options struct {
+	shardCount      int
+	maxItems        int
+	ttl             time.Duration
+	cleanupInterval time.Duration
+	eviction        EvictionPolicy
+	evictionSet     bool // политика задана WithEvictionPolicy
+	demoteAfter     time.Duration
+	l1TTL           time.Duration
+	clock           clock.Clock
+}
+
+// Option - настройка кэша для NewWithOptions.
+type Option func(*options)
+
+// WithShards задаёт число шардов; оно округляется вверх до степени двойки, как в New. По умолчанию DefaultShardCount.
+func WithShards(n int) Option {
+	return func(o *options) { o.shardCount = n }
+}
+
+// WithMaxItems задаёт общий лимит записей кэша. По умолчанию 0 — без ограничения.
+func WithMaxItems(n int) Option {
+	return func(o *options) { o.maxItems = n }
+}
+
+// WithTTL задаёт время жизни записей. По умолчанию 0 — записи не устаревают.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) { o.ttl = ttl }
+}
+
+// WithCleanupInterval задаёт период фоновой очистки устаревших записей и понижения холодных. 0 при заданном TTL
+// или WithDemoteAfter означает одну минуту.
+func WithCleanupInterval(d time.Duration) Option {
+	return func(o *options) { o.cleanupInterval = d }
+}
+
+// WithEvictionPolicy задаёт порядок вытеснения записей. Политика действует только вместе с WithMaxItems.
+func WithEvictionPolicy(p EvictionPolicy) Option {
+	return func(o *options) { o.eviction, o.evictionSet = p, true }
+}
+
+// WithDemoteAfter включает понижение холодных записей: фоновая очистка удаляет товары заказов, к которым не обращались
+// дольше d, и оставляет только заголовок. Get считает пониженную запись отсутствующей, Contains — существующей, а запись
+// заказа (Set, SetIfNewer) возвращает её к полному виду. По умолчанию 0 — записи не понижаются.
+func WithDemoteAfter(d time.Duration) Option {
+	return func(o *options) { o.demoteAfter = d }
+}
+
+// WithL1 включает L1: перед шардами хранятся L1Size последних прочитанных Get и GetJSON заказов, чтение которых
+// не берёт блокировку шарда. Запись и удаление заказа сразу делают его копию в L1 недействительной, а остальные
+// расхождения с шардами (вытеснение, устаревание по TTL) ограничены сроком ttl, поэтому он должен быть коротким —
+// секунды. По умолчанию 0 — L1 выключен.
+func WithL1(ttl time.Duration) Option {
+	return func(o *options) { o.l1TTL = ttl }
+}
+
+// WithClock задаёт часы кэша: по ним считаются TTL, отметки MarkMissing, понижение записей и L1, и по их тикеру
+// запускается фоновая очистка. По умолчанию clock.Real.
+func WithClock(clk clock.Clock) Option {
+	return func(o *options) { o.clock = clk }
+}
+
+// NewWithOptions создает кэш с настройками opts. Без настроек кэш содержит DefaultShardCount шардов, не ограничивает
+// число записей и не устаревает их. Возвращает ошибку для недопустимых значений и сочетаний настроек, например
+// отрицательного TTL или политики вытеснения без лимита записей.
+func NewWithOptions(opts ...Option) (*OrderCache, error) {
+	o := options{shardCount: DefaultShardCount, clock: clock.Real}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	switch {
+	case o.shardCount <= 0:
+		return nil, errors.New("shardCount must be > 0")
+	case o.maxItems < 0:
+		return nil, errors.New("maxItems must be >= 0")
+	case o.ttl < 0:
+		return nil, errors.New("ttl must be >= 0")
+	case o.cleanupInterval < 0:
+		return nil, errors.New("cleanupInterval must be >= 0")
+	case o.demoteAfter < 0:
+		return nil, errors.New("demoteAfter must be >= 0")
+	case o.l1TTL < 0:
+		return nil, errors.New("l1 ttl must be >= 0")
+	case o.clock == nil:
+		return nil, errors.New("clock must not be nil")
+	case o.eviction != EvictLRU && o.eviction != EvictFIFO:
+		return nil, fmt.Errorf("unknown eviction policy %s", o.eviction)
+	case o.evictionSet && o.maxItems == 0:
+		return nil, fmt.Errorf("eviction policy %s requires maxItems > 0", o.eviction)
+	}
+
+	c := &OrderCache{
+		maxItems:     o.maxItems,
+		ttl:          o.ttl,
+		cleanupEvery: o.cleanupInterval,
+		eviction:     o.eviction,
+		demoteAfter:  o.demoteAfter,
+		stopCh:       make(chan struct{}),
+		clock:        o.clock,
+	}
+	c.tbl.Store(newShardTable(o.shardCount, o.maxItems))
+	if o.l1TTL > 0 {
+		c.l1 = &l1Cache{ttl: o.l1TTL}
+	}
+	c.maxPinned.Store(DefaultMaxPinned)
+	if (c.ttl > 0 || c.demoteAfter > 0) && c.cleanupEvery <= 0 {
+		c.cleanupEvery = time.Minute
+	}
+	if c.ttl > 0 || c.maxItems > 0 || c.demoteAfter > 0 {
+		c.startCleaner()
+	}
+	return c, nil
+}
+
+// EvictionPolicy возвращает политику вытеснения кэша.
+func (c *OrderCache) EvictionPolicy() EvictionPolicy { return c.eviction }
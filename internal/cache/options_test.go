@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newOptionsCache(t *testing.T, opts ...Option) *OrderCache {
+	t.Helper()
+	c, err := NewWithOptions(opts...)
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestNewWithOptionsDefaults(t *testing.T) {
+	c := newOptionsCache(t)
+	assert.Equal(t, DefaultShardCount, c.ShardCount())
+	assert.Equal(t, EvictLRU, c.EvictionPolicy())
+	assert.Equal(t, DefaultMaxPinned, c.MaxPinned())
+
+	for i := 0; i < 1000; i++ {
+		c.Set(tenant.Default, orders.Order{OrderUid: fmt.Sprintf("order-%d", i)})
+	}
+	assert.Equal(t, 1000, c.Len(), "the number of items is unlimited")
+	_, ok := c.Get(tenant.Default, "order-0")
+	assert.True(t, ok, "items do not expire")
+}
+
+func TestWithShards(t *testing.T) {
+	assert.Equal(t, 8, newOptionsCache(t, WithShards(8)).ShardCount())
+	assert.Equal(t, 8, newOptionsCache(t, WithShards(5)).ShardCount(), "rounded up to a power of two")
+	assert.Equal(t, 2, newOptionsCache(t, WithShards(8), WithMaxItems(3)).ShardCount(), "no more shards than items")
+}
+
+func TestWithMaxItems(t *testing.T) {
+	c := newOptionsCache(t, WithShards(1), WithMaxItems(2))
+	for _, id := range []string{"a", "b", "c"} {
+		c.Set(tenant.Default, orders.Order{OrderUid: id})
+	}
+	assert.Equal(t, 2, c.Len())
+	_, ok := c.Get(tenant.Default, "a")
+	assert.False(t, ok, "the oldest item is evicted")
+}
+
+func TestWithTTL(t *testing.T) {
+	clock := newFakeClock()
+	c := newOptionsCache(t, WithTTL(time.Hour), WithClock(clock))
+	assert.Equal(t, time.Minute, c.cleanupEvery, "the cleanup interval defaults to a minute when ttl is set")
+	c.Set(tenant.Default, orders.Order{OrderUid: "a"})
+	clock.Advance(time.Hour)
+	_, ok := c.Get(tenant.Default, "a")
+	require.True(t, ok)
+	clock.Advance(time.Second)
+	_, ok = c.Get(tenant.Default, "a")
+	assert.False(t, ok)
+}
+
+func TestWithCleanupInterval(t *testing.T) {
+	clock := newFakeClock()
+	c := newOptionsCache(t, WithTTL(time.Minute), WithCleanupInterval(30*time.Second), WithClock(clock))
+	assert.Equal(t, 30*time.Second, c.cleanupEvery)
+	c.Set(tenant.Default, orders.Order{OrderUid: "a"})
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	assert.Equal(t, 1, c.Len(), "the entry is still live at the tick")
+	clock.Advance(30 * time.Second)
+	assert.Eventually(t, func() bool { return c.Len() == 0 }, time.Second, time.Millisecond, "the cleaner removes expired items on its ticker")
+}
+
+func TestWithEvictionPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy  EvictionPolicy
+		evicted string
+	}{
+		// Чтение "a" продлевает его жизнь только по политике LRU
+		{policy: EvictLRU, evicted: "b"},
+		{policy: EvictFIFO, evicted: "a"},
+	} {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			c := newOptionsCache(t, WithShards(1), WithMaxItems(2), WithEvictionPolicy(tc.policy))
+			assert.Equal(t, tc.policy, c.EvictionPolicy())
+			c.Set(tenant.Default, orders.Order{OrderUid: "a"})
+			c.Set(tenant.Default, orders.Order{OrderUid: "b"})
+			_, ok := c.Get(tenant.Default, "a")
+			require.True(t, ok)
+			c.Set(tenant.Default, orders.Order{OrderUid: "c"})
+
+			_, ok = c.Get(tenant.Default, tc.evicted)
+			assert.False(t, ok)
+			_, ok = c.Get(tenant.Default, "c")
+			assert.True(t, ok)
+		})
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	clock := newFakeClock()
+	c := newOptionsCache(t, WithTTL(time.Minute), WithCleanupInterval(time.Hour), WithClock(clock))
+	c.Set(tenant.Default, orders.Order{OrderUid: "a"})
+	clock.Advance(time.Minute + time.Second)
+	_, ok := c.Get(tenant.Default, "a")
+	assert.False(t, ok, "expiry follows the injected clock")
+}
+
+func TestNewWithOptionsRejectsInvalidOptions(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"zero shards":                     {WithShards(0)},
+		"negative max items":              {WithMaxItems(-1)},
+		"negative ttl":                    {WithTTL(-time.Second)},
+		"negative cleanup interval":       {WithCleanupInterval(-time.Second)},
+		"unknown eviction policy":         {WithMaxItems(10), WithEvictionPolicy(EvictionPolicy(7))},
+		"eviction policy without a limit": {WithEvictionPolicy(EvictFIFO)},
+		"nil clock":                       {WithClock(nil)},
+	} {
+		c, err := NewWithOptions(opts...)
+		assert.Error(t, err, name)
+		assert.Nil(t, c, name)
+	}
+}
+
+func TestNewIsNewWithOptions(t *testing.T) {
+	c, err := New(4, 10, time.Hour, time.Minute)
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+	assert.Equal(t, 4, c.ShardCount())
+	assert.Equal(t, 10, c.maxItems)
+	assert.Equal(t, time.Hour, c.ttl)
+	assert.Equal(t, time.Minute, c.cleanupEvery)
+
+	_, err = New(0, 0, 0, 0)
+	assert.Error(t, err)
+}
+
+func TestParseEvictionPolicy(t *testing.T) {
+	for name, want := range map[string]EvictionPolicy{"": EvictLRU, "lru": EvictLRU, "fifo": EvictFIFO} {
+		got, err := ParseEvictionPolicy(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := ParseEvictionPolicy("random")
+	assert.ErrorContains(t, err, "unknown eviction policy")
+}
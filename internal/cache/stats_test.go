@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+
+	"l0_test_self/internal/tenant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collidingIDs - n идентификаторов с общим префиксом, которые текущий хэш (FNV-1a по младшим битам) помещает
+// в шард shard таблицы из shards шардов: худший случай для распределения записей
+func collidingIDs(shards, shard, n int) []string {
+	t := newShardTable(shards, 0)
+	var ids []string
+	for i := 0; len(ids) < n; i++ {
+		id := fmt.Sprintf("b563feb7b2b84b6test%06d", i)
+		if t.shardFor(orderKey(tenant.Default, id)) == t.shards[shard] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// spreadIDs - n последовательных идентификаторов с тем же префиксом без подбора
+func spreadIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("b563feb7b2b84b6test%06d", i)
+	}
+	return ids
+}
+
+func TestStatsDetectsShardImbalance(t *testing.T) {
+	c := newOptionsCache(t, WithShards(8))
+	stats := c.Stats()
+	assert.Zero(t, stats.ItemImbalance, "an empty cache has no imbalance")
+	require.Len(t, stats.Shards, 8)
+
+	for _, id := range spreadIDs(800) {
+		c.Set(tenant.Default, itemsOrder(id, 1))
+		c.Get(tenant.Default, id)
+	}
+	stats = c.Stats()
+	assert.Equal(t, 800, stats.Items)
+	assert.Equal(t, uint64(1600), stats.Accesses)
+	assert.Less(t, stats.ItemImbalance, 1.5, "sequential ids are spread evenly")
+	assert.Less(t, stats.AccessImbalance, 1.5)
+
+	// Подобранные ключи попадают в один шард: запись и чтение нагружают только его
+	c = newOptionsCache(t, WithShards(8))
+	for _, id := range collidingIDs(8, 3, 200) {
+		c.Set(tenant.Default, itemsOrder(id, 1))
+		for i := 0; i < 4; i++ {
+			c.Get(tenant.Default, id)
+		}
+	}
+	c.Set(tenant.Default, itemsOrder("other", 1))
+	stats = c.Stats()
+	assert.Equal(t, 3, stats.FullestShard)
+	assert.Equal(t, 3, stats.HottestShard)
+	assert.Equal(t, 200, stats.Shards[3].Items)
+	assert.Equal(t, uint64(1000), stats.Shards[3].Accesses)
+	assert.InDelta(t, 8*200.0/201, stats.ItemImbalance, 1e-9)
+	assert.Greater(t, stats.AccessImbalance, 7.9)
+
+	// Resize перераспределяет записи и начинает счёт обращений заново
+	require.NoError(t, c.Resize(16))
+	stats = c.Stats()
+	assert.Equal(t, 201, stats.Items)
+	assert.Zero(t, stats.Accesses)
+	assert.Zero(t, stats.AccessImbalance)
+}
+
+// BenchmarkHotShard - стоимость конкуренции за блокировку шарда: те же операции (девять чтений на одну запись)
+// над ключами, распределёнными по всем шардам, и над ключами, попадающими в один шард
+func BenchmarkHotShard(b *testing.B) {
+	const keys = 1024
+	for _, bc := range []struct {
+		name string
+		ids  []string
+	}{
+		{"spread", spreadIDs(keys)},
+		{"one_shard", collidingIDs(DefaultShardCount, 0, keys)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			c, err := NewWithOptions()
+			require.NoError(b, err)
+			defer c.Close()
+			for _, id := range bc.ids {
+				c.Set(tenant.Default, itemsOrder(id, 1))
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					id := bc.ids[i%keys]
+					if i%10 == 0 {
+						c.Set(tenant.Default, itemsOrder(id, 1))
+					} else {
+						c.Get(tenant.Default, id)
+					}
+					i++
+				}
+			})
+			b.ReportMetric(c.Stats().AccessImbalance, "imbalance")
+		})
+	}
+}
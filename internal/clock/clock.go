@@ -0,0 +1,42 @@
+// Package clock содержит источник времени, который можно подменить в тестах: Real обращается к пакету time, а Fake
+// показывает время, которое тест переводит вручную, и срабатывает таймерами и тикерами только при переводе. Кэш
+// и конвейер консьюмера получают время, паузы и тикеры через Clock, поэтому тесты TTL, повторов и задержек обходятся
+// без настоящих пауз.
+package clock
+
+import "time"
+
+// Clock - источник времени, пауз и тикеров.
+type Clock interface {
+	// Now возвращает текущее время.
+	Now() time.Time
+	// NewTicker создает тикер с периодом d, как time.NewTicker; d должен быть положительным.
+	NewTicker(d time.Duration) Ticker
+	// After возвращает канал, в который придёт время через d, как time.After.
+	After(d time.Duration) <-chan time.Time
+	// Sleep приостанавливает горутину на d, как time.Sleep.
+	Sleep(d time.Duration)
+}
+
+// Ticker - тикер, созданный Clock.NewTicker.
+type Ticker interface {
+	// C возвращает канал срабатываний тикера.
+	C() <-chan time.Time
+	// Stop останавливает тикер; канал при этом не закрывается.
+	Stop()
+}
+
+// Real - часы пакета time.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+func (t realTicker) Stop()               { t.t.Stop() }
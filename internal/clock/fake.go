@@ -0,0 +1,150 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake - часы, время которых переводит тест. Таймеры After и Sleep и тикеры NewTicker срабатывают при Advance,
+// когда время доходит до их срока. Как и у пакета time, канал тикера хранит одно срабатывание: пропущенные
+// при большом переводе срабатывания отбрасываются. Fake безопасен для конкурентного использования.
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond // оповещает BlockUntil о новых ожидающих
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter - ожидающий срока таймер или тикер
+type fakeWaiter struct {
+	at     time.Time
+	period time.Duration // период тикера; 0 — одноразовый таймер
+	ch     chan time.Time
+}
+
+// NewFake создает часы, показывающие start.
+func NewFake(start time.Time) *Fake {
+	f := &Fake{now: start}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now возвращает текущее время часов.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Set переводит часы на момент t и запускает таймеры и тикеры, срок которых наступил. Перевод назад таймеры
+// не запускает.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t.After(f.now) {
+		f.fireLocked(t)
+	}
+	f.now = t
+}
+
+// Advance переводит часы вперёд на d и запускает таймеры и тикеры, срок которых наступил.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	to := f.now.Add(d)
+	f.fireLocked(to)
+	f.now = to
+}
+
+// fireLocked запускает по порядку сроков таймеры и тикеры со сроком не позже to. Вызывается под блокировкой.
+func (f *Fake) fireLocked(to time.Time) {
+	sort.SliceStable(f.waiters, func(i, j int) bool { return f.waiters[i].at.Before(f.waiters[j].at) })
+	kept := f.waiters[:0]
+	for _, w := range f.waiters {
+		for !w.at.After(to) {
+			select {
+			case w.ch <- w.at:
+			default:
+			}
+			if w.period == 0 {
+				break
+			}
+			w.at = w.at.Add(w.period)
+		}
+		if w.at.After(to) {
+			kept = append(kept, w)
+		}
+	}
+	clear(f.waiters[len(kept):])
+	f.waiters = kept
+}
+
+// add регистрирует ожидающего w; срок, который уже наступил, срабатывает сразу
+func (f *Fake) add(w *fakeWaiter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if w.period == 0 && !w.at.After(f.now) {
+		w.ch <- f.now
+		return
+	}
+	f.waiters = append(f.waiters, w)
+	f.cond.Broadcast()
+}
+
+// After возвращает канал, в который придёт время, когда часы переведут на d вперёд.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	w := &fakeWaiter{at: f.Now().Add(d), ch: make(chan time.Time, 1)}
+	f.add(w)
+	return w.ch
+}
+
+// Sleep ждёт, пока часы переведут на d вперёд.
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// NewTicker создает тикер, срабатывающий каждый раз, когда часы проходят очередной период d.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	w := &fakeWaiter{at: f.Now().Add(d), period: d, ch: make(chan time.Time, 1)}
+	f.add(w)
+	return &fakeTicker{f: f, w: w}
+}
+
+// BlockUntil ждёт, пока у часов не окажется хотя бы n ожидающих таймеров и тикеров: так тест убеждается, что горутина
+// уже остановилась на паузе, прежде чем переводить часы.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+// Waiters возвращает число ожидающих таймеров и работающих тикеров.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+type fakeTicker struct {
+	f *Fake
+	w *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.w.ch }
+
+func (t *fakeTicker) Stop() {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	for i, w := range t.f.waiters {
+		if w == t.w {
+			t.f.waiters = append(t.f.waiters[:i], t.f.waiters[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// fired сообщает, пришло ли значение в канал ch, не дожидаясь его
+func fired(ch <-chan time.Time) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFakeAfterFiresOnAdvance(t *testing.T) {
+	f := NewFake(start)
+	ch := f.After(time.Minute)
+	assert.Equal(t, 1, f.Waiters())
+
+	f.Advance(59 * time.Second)
+	assert.False(t, fired(ch))
+	f.Advance(time.Second)
+	select {
+	case at := <-ch:
+		assert.Equal(t, start.Add(time.Minute), at)
+	default:
+		t.Fatal("timer did not fire at its deadline")
+	}
+	assert.Zero(t, f.Waiters())
+	assert.Equal(t, start.Add(time.Minute), f.Now())
+
+	assert.True(t, fired(f.After(0)), "an elapsed deadline fires immediately")
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(start)
+	tk := f.NewTicker(10 * time.Second)
+
+	f.Advance(5 * time.Second)
+	assert.False(t, fired(tk.C()))
+	f.Advance(5 * time.Second)
+	assert.True(t, fired(tk.C()))
+
+	f.Advance(time.Minute)
+	assert.True(t, fired(tk.C()))
+	assert.False(t, fired(tk.C()), "missed ticks are dropped like time.Ticker does")
+
+	tk.Stop()
+	assert.Zero(t, f.Waiters())
+	f.Advance(time.Minute)
+	assert.False(t, fired(tk.C()))
+	assert.Panics(t, func() { f.NewTicker(0) })
+}
+
+func TestFakeSleepAndBlockUntil(t *testing.T) {
+	f := NewFake(start)
+	done := make(chan struct{})
+	go func() {
+		f.Sleep(time.Hour)
+		close(done)
+	}()
+
+	f.BlockUntil(1)
+	select {
+	case <-done:
+		t.Fatal("Sleep returned before the clock advanced")
+	default:
+	}
+	f.Advance(time.Hour)
+	<-done
+}
+
+func TestFakeSet(t *testing.T) {
+	f := NewFake(start)
+	ch := f.After(time.Minute)
+	f.Set(start.Add(-time.Hour))
+	assert.False(t, fired(ch))
+	f.Set(start.Add(2 * time.Minute))
+	assert.True(t, fired(ch))
+	require.Equal(t, start.Add(2*time.Minute), f.Now())
+}
+
+func TestRealClock(t *testing.T) {
+	before := time.Now()
+	assert.False(t, Real.Now().Before(before))
+	tk := Real.NewTicker(time.Millisecond)
+	<-tk.C()
+	tk.Stop()
+	<-Real.After(time.Millisecond)
+}
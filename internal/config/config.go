@@ -2,30 +2,633 @@
 package config
 
 import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"l0_test_self/internal/breaker"
+	"l0_test_self/internal/cache"
+	"l0_test_self/internal/crypto"
+	"l0_test_self/internal/logging"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/internal/validation"
+	"l0_test_self/models/orders"
 	"l0_test_self/pkg/client/kafka"
 	"l0_test_self/pkg/client/postgres"
+	"l0_test_self/pkg/codec"
 
 	"gopkg.in/yaml.v3"
 )
 
 // CacheConfig содержит настройки кэша
 type CacheConfig struct {
-	ShardCount      int           `yaml:"shard_count"`
+	// Enabled - кэшировать заказы для ответов API; false — каждое чтение идёт в базу данных (для отладки).
+	// Не задано — true
+	Enabled         *bool         `yaml:"enabled"`
+	ShardCount      ShardCount    `yaml:"shard_count"` // число шардов или auto (по умолчанию)
 	MaxItems        int           `yaml:"max_items"`
 	TTL             time.Duration `yaml:"ttl"`
 	CleanupInterval time.Duration `yaml:"cleanup_interval"`
+	SerializedJSON  bool          `yaml:"serialized_json"` // хранить JSON заказов для ответов GET /order без повторного кодирования
+	NegativeTTL     time.Duration `yaml:"negative_ttl"`    // срок, в течение которого HEAD /orders/{id} помнит отсутствие заказа; 0 — не помнит
+	MaxPinned       int           `yaml:"max_pinned"`      // наибольшее число заказов, закреплённых POST /admin/cache/{id}/pin; 0 — cache.DefaultMaxPinned
+	EvictionPolicy  string        `yaml:"eviction_policy"` // порядок вытеснения при max_items: lru (по умолчанию) или fifo
+	DemoteAfter     time.Duration `yaml:"demote_after"`    // срок без обращений, после которого у заказа в кэше остаётся только заголовок; 0 — не понижать
+
+	// ShadowVerifyRate - доля попаданий в кэш GET /order (от 0 до 1), заказ которых в фоне сверяется с базой данных; 0 — без проверки
+	ShadowVerifyRate float64 `yaml:"shadow_verify_rate"`
+	// ShadowVerifyConcurrency - наибольшее число одновременных фоновых чтений теневой проверки; 0 — 4
+	ShadowVerifyConcurrency int `yaml:"shadow_verify_concurrency"`
+
+	// ImbalanceFactor - во сколько раз самый загруженный шард (по записям или по обращениям) может превышать среднее
+	// по шардам, прежде чем сервер предупредит в логе о неравномерном распределении; 0 — без проверки
+	ImbalanceFactor float64 `yaml:"imbalance_factor"`
+	// ImbalanceCheckInterval - период проверки распределения по шардам; 0 — DefaultImbalanceCheckInterval
+	ImbalanceCheckInterval time.Duration `yaml:"imbalance_check_interval"`
+
+	// L1Enabled - включить L1: последние прочитанные заказы хранятся перед шардами и читаются без блокировок
+	L1Enabled bool `yaml:"l1_enabled"`
+	// L1TTL - срок жизни заказа в L1, не больше MaxL1TTL; 0 — DefaultL1TTL
+	L1TTL time.Duration `yaml:"l1_ttl"`
+}
+
+// IsEnabled возвращает значение cache.enabled с учётом значения по умолчанию (true).
+func (c CacheConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// DefaultImbalanceCheckInterval - период cache.imbalance_check_interval по умолчанию
+const DefaultImbalanceCheckInterval = time.Minute
+
+// DefaultL1TTL и MaxL1TTL - срок cache.l1_ttl по умолчанию и наибольший допустимый: L1 может расходиться с шардами
+// в пределах этого срока, поэтому он измеряется секундами
+const (
+	DefaultL1TTL = 2 * time.Second
+	MaxL1TTL     = time.Minute
+)
+
+// EffectiveL1TTL возвращает срок жизни заказа в L1 с учётом значения по умолчанию.
+func (c CacheConfig) EffectiveL1TTL() time.Duration {
+	if c.L1TTL <= 0 {
+		return DefaultL1TTL
+	}
+	return c.L1TTL
+}
+
+// CheckInterval возвращает период проверки распределения по шардам с учётом значения по умолчанию.
+func (c CacheConfig) CheckInterval() time.Duration {
+	if c.ImbalanceCheckInterval <= 0 {
+		return DefaultImbalanceCheckInterval
+	}
+	return c.ImbalanceCheckInterval
+}
+
+// Options возвращает настройки cache.NewWithOptions по секции cache. Политика вытеснения передаётся, только если
+// задан max_items: без лимита записей она не действует.
+func (c CacheConfig) Options() []cache.Option {
+	opts := []cache.Option{
+		cache.WithShards(c.ShardCount.Resolve()),
+		cache.WithMaxItems(c.MaxItems),
+		cache.WithTTL(c.TTL),
+		cache.WithCleanupInterval(c.CleanupInterval),
+		cache.WithDemoteAfter(c.DemoteAfter),
+	}
+	if policy, err := cache.ParseEvictionPolicy(c.EvictionPolicy); err == nil && c.MaxItems > 0 {
+		opts = append(opts, cache.WithEvictionPolicy(policy))
+	}
+	if c.L1Enabled {
+		opts = append(opts, cache.WithL1(c.EffectiveL1TTL()))
+	}
+	return opts
+}
+
+// ShardCount - число шардов кэша: положительное число или auto, которому соответствует ShardCountAuto.
+type ShardCount int
+
+// ShardCountAuto - число шардов выбирается по числу процессоров (cache.AutoShardCount).
+const ShardCountAuto ShardCount = 0
+
+// ParseShardCount разбирает число шардов из строки: положительное число или auto.
+func ParseShardCount(s string) (ShardCount, error) {
+	if s == "auto" {
+		return ShardCountAuto, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid shard count %q: must be a positive number or auto", s)
+	}
+	return ShardCount(n), nil
+}
+
+// UnmarshalYAML принимает число шардов числом или строкой auto.
+func (s *ShardCount) UnmarshalYAML(node *yaml.Node) error {
+	n, err := ParseShardCount(node.Value)
+	if err != nil {
+		return err
+	}
+	*s = n
+	return nil
+}
+
+// Resolve возвращает число шардов для создания кэша, выбирая его для auto по числу процессоров.
+func (s ShardCount) Resolve() int {
+	if s == ShardCountAuto {
+		return cache.AutoShardCount()
+	}
+	return int(s)
+}
+
+// String возвращает число шардов или auto.
+func (s ShardCount) String() string {
+	if s == ShardCountAuto {
+		return "auto"
+	}
+	return strconv.Itoa(int(s))
 }
 
 // Config содержит настройки приложения, включая параметры подключения к базе данных PostgreSQL, конфигурацию Kafka и настройки сервера.
 type Config struct {
-	Database DatabaseConfig `yaml:"database"`
-	Kafka    KafkaConfig    `yaml:"kafka"`
-	Server   ServerConfig   `yaml:"server"`
-	Cache    CacheConfig    `yaml:"cache"`
-	Test     TestConfig     `yaml:"test"`
+	Database    DatabaseConfig    `yaml:"database"`
+	Kafka       KafkaConfig       `yaml:"kafka"`
+	Server      ServerConfig      `yaml:"server"`
+	Cache       CacheConfig       `yaml:"cache"`
+	Test        TestConfig        `yaml:"test"`
+	Admin       AdminConfig       `yaml:"admin"`
+	Pipeline    PipelineConfig    `yaml:"pipeline"`
+	RawPayloads RawPayloadsConfig `yaml:"raw_payloads"`
+	Validation  ValidationConfig  `yaml:"validation"`
+	Webhooks    WebhooksConfig    `yaml:"webhooks"`
+	Leader      LeaderConfig      `yaml:"leader"`
+	// Tenants - арендаторы со своими топиками заказов и ключами API. Пустой список означает одного арендатора
+	// tenant.Default, заказы которого читаются из kafka.topic
+	Tenants []TenantConfig `yaml:"tenants"`
+}
+
+// TenantConfig описывает арендатора: его заказы читаются из топика Topic, а запросы с ключами APIKeys
+// (в заголовке X-API-Key или Authorization: Bearer) относятся к нему и видят только его заказы.
+type TenantConfig struct {
+	ID      string   `yaml:"id"`
+	Topic   string   `yaml:"topic"`
+	APIKeys []string `yaml:"api_keys" secret:"true"`
+}
+
+// TenantIDs возвращает идентификаторы арендаторов в порядке конфигурации; без секции tenants — только tenant.Default.
+func (c *Config) TenantIDs() []string {
+	if len(c.Tenants) == 0 {
+		return []string{tenant.Default}
+	}
+	ids := make([]string, len(c.Tenants))
+	for i, t := range c.Tenants {
+		ids[i] = t.ID
+	}
+	return ids
+}
+
+// TenantTopics возвращает арендаторов по топикам заказов; без секции tenants топик kafka.topic принадлежит tenant.Default.
+func (c *Config) TenantTopics() map[string]string {
+	if len(c.Tenants) == 0 {
+		return map[string]string{c.Kafka.Topic: tenant.Default}
+	}
+	topics := make(map[string]string, len(c.Tenants))
+	for _, t := range c.Tenants {
+		topics[t.Topic] = t.ID
+	}
+	return topics
+}
+
+// KafkaTopics возвращает топики, которые читает и в которые пишет консьюмер: топики заказов (топики арендаторов
+// или kafka.topic), топик очереди недоставленных сообщений, если консьюмер в неё пишет (UsesDLQ), и топик
+// подтверждений записи заказов, если они включены (kafka.consumer.order_ack.enabled).
+func (c *Config) KafkaTopics() []string {
+	var topics []string
+	for _, t := range c.Tenants {
+		topics = append(topics, t.Topic)
+	}
+	if len(topics) == 0 {
+		topics = append(topics, c.Kafka.Topic)
+	}
+	if c.Kafka.Consumer.UsesDLQ() {
+		topics = append(topics, c.Kafka.DLQTopic)
+	}
+	if c.Kafka.Consumer.OrderAck.Enabled {
+		topics = append(topics, c.Kafka.Topics.OrderAck)
+	}
+	return topics
+}
+
+// TenantAPIKeys возвращает арендаторов по их ключам API.
+func (c *Config) TenantAPIKeys() map[string]string {
+	keys := make(map[string]string)
+	for _, t := range c.Tenants {
+		for _, k := range t.APIKeys {
+			keys[k] = t.ID
+		}
+	}
+	return keys
+}
+
+// ConsumerKafkaConfig возвращает настройки читателя группы: при объявленных арендаторах он подписывается на их топики.
+func (c *Config) ConsumerKafkaConfig() kafka.Config {
+	kc := c.Kafka.ToKafkaConfig()
+	for _, t := range c.Tenants {
+		kc.GroupTopics = append(kc.GroupTopics, t.Topic)
+	}
+	return kc
+}
+
+// ValidationConfig содержит настройки проверки входящих заказов.
+type ValidationConfig struct {
+	PaymentOptionalEntries []string          `yaml:"payment_optional_entries"` // значения entry, для которых заказ может не содержать платежей
+	AllowUnknownStatuses   bool              `yaml:"allow_unknown_statuses"`   // принимать неизвестные статусы товаров с меткой unknown вместо отклонения заказа
+	FutureDate             FutureDateConfig  `yaml:"future_date"`
+	TotalPrice             TotalPriceConfig  `yaml:"total_price"`
+	PostalCodes            PostalCodesConfig `yaml:"postal_codes"`
+	Currency               CurrencyConfig    `yaml:"currency"`
+	TrackNumber            TrackNumberConfig `yaml:"track_number"`
+	Rules                  RulesConfig       `yaml:"rules"`
+}
+
+// RulesConfig содержит правила валидации развёртывания поверх встроенных. Поля задаются путями JSON заказа,
+// например "customer_id", "delivery.zip" или "items.brand" (правило для каждого товара).
+type RulesConfig struct {
+	Optional []string                   `yaml:"optional"` // обязательные встроенными правилами поля, которые становятся необязательными
+	Fields   map[string]FieldRuleConfig `yaml:"fields"`   // дополнительные ограничения строковых полей
+}
+
+// FieldRuleConfig содержит дополнительные ограничения строкового поля заказа.
+type FieldRuleConfig struct {
+	MaxLength int    `yaml:"max_length"` // максимальная длина в символах, 0 — без ограничения
+	Pattern   string `yaml:"pattern"`    // регулярное выражение RE2; пустые значения ему не проверяются
+}
+
+// Compile проверяет и компилирует правила валидации развёртывания.
+func (c RulesConfig) Compile() (*validation.RuleSet, error) {
+	fields := make(map[string]validation.FieldRule, len(c.Fields))
+	for path, rule := range c.Fields {
+		fields[path] = validation.FieldRule{MaxLength: rule.MaxLength, Pattern: rule.Pattern}
+	}
+	rs, err := validation.CompileRules(validation.Rules{Optional: c.Optional, Fields: fields})
+	if err != nil {
+		return nil, fmt.Errorf("validation.rules: %w", err)
+	}
+	return rs, nil
+}
+
+// Действия с заказом, дата создания которого опережает время сервера больше допустимого.
+const (
+	FutureDateReject = "reject" // заказ отклоняется валидацией
+	FutureDateFlag   = "flag"   // заказ сохраняется с признаком карантина и не попадает в списки заказов
+)
+
+// FutureDateConfig содержит настройки проверки заказов с датой создания в будущем и проверки часов при запуске.
+type FutureDateConfig struct {
+	Mode          string        `yaml:"mode"`            // reject (по умолчанию) или flag
+	MaxSkew       time.Duration `yaml:"max_skew"`        // допустимое опережение date_created относительно времени сервера, 0 — 5m
+	ClockWarnSkew time.Duration `yaml:"clock_warn_skew"` // расхождение часов с PostgreSQL и Kafka, при котором запуск пишет предупреждение, 0 — 1m
+}
+
+// TotalPriceConfig содержит настройки сверки total_price товаров с ценой и скидкой.
+type TotalPriceConfig struct {
+	Mode string `yaml:"mode"` // off (по умолчанию), reject, correct или flag
+}
+
+// CurrencyConfig содержит настройки проверки валют платежей по таблице ISO 4217.
+type CurrencyConfig struct {
+	Mode string `yaml:"mode"` // reject (по умолчанию) или flag
+}
+
+// TrackNumberConfig содержит настройки проверки трек-номеров заказов после нормализации (trim, NFKC, верхний регистр).
+type TrackNumberConfig struct {
+	Mode    string `yaml:"mode"`    // reject (по умолчанию) или flag
+	Pattern string `yaml:"pattern"` // регулярное выражение RE2 для всего трек-номера, пустое — validation.DefaultTrackNumberPattern
+}
+
+// Compile проверяет и компилирует формат трек-номера и возвращает его вместе с режимом проверки.
+func (c TrackNumberConfig) Compile() (*regexp.Regexp, validation.TrackNumberMode, error) {
+	mode, err := validation.ParseTrackNumberMode(c.Mode)
+	if err != nil {
+		return nil, 0, fmt.Errorf("validation.track_number: %w", err)
+	}
+	pattern, err := validation.CompileTrackNumberPattern(c.Pattern)
+	if err != nil {
+		return nil, 0, fmt.Errorf("validation.track_number: %w", err)
+	}
+	return pattern, mode, nil
+}
+
+// PostalCodesConfig содержит настройки проверки почтовых индексов доставки по формату её региона.
+type PostalCodesConfig struct {
+	Mode string `yaml:"mode"` // off (по умолчанию), reject или flag
+	// Formats - регион доставки (значение delivery.region без учёта регистра) → регулярное выражение RE2,
+	// которому индекс должен соответствовать целиком. Индексы регионов не из списка не проверяются.
+	Formats map[string]string `yaml:"formats"`
+}
+
+// Compile проверяет и компилирует таблицу форматов индексов и возвращает её вместе с режимом проверки.
+func (c PostalCodesConfig) Compile() (*validation.PostalTable, validation.PostalMode, error) {
+	mode, err := validation.ParsePostalMode(c.Mode)
+	if err != nil {
+		return nil, 0, fmt.Errorf("validation.postal_codes: %w", err)
+	}
+	table, err := validation.CompilePostalTable(c.Formats)
+	if err != nil {
+		return nil, 0, fmt.Errorf("validation.postal_codes: %w", err)
+	}
+	return table, mode, nil
+}
+
+// RawPayloadsConfig содержит настройки хранения исходных сообщений Kafka вместе с заказами.
+type RawPayloadsConfig struct {
+	Enabled         bool          `yaml:"enabled"`          // сохранять исходные сообщения (можно отключить ради экономии места)
+	Retention       time.Duration `yaml:"retention"`        // сколько хранить сообщения, 0 — бессрочно
+	CleanupInterval time.Duration `yaml:"cleanup_interval"` // период удаления устаревших сообщений
+}
+
+// Значения по умолчанию секции leader.
+const (
+	DefaultLeaderLockName      = "l0-background-jobs"
+	DefaultLeaderRenewInterval = 5 * time.Second
+)
+
+// LeaderConfig содержит настройки выбора лидера среди экземпляров сервера: фоновые задачи, которые достаточно
+// выполнять одному экземпляру (удаление устаревших записей), выполняет только владелец рекомендательной блокировки
+// PostgreSQL.
+type LeaderConfig struct {
+	Enabled       bool          `yaml:"enabled"`        // выбирать лидера; выключено — задачи выполняет каждый экземпляр
+	LockName      string        `yaml:"lock_name"`      // имя блокировки, общее для экземпляров; пусто — DefaultLeaderLockName
+	RenewInterval time.Duration `yaml:"renew_interval"` // период проверки и захвата блокировки; 0 — DefaultLeaderRenewInterval
+}
+
+// Lock возвращает имя блокировки лидера с учётом значения по умолчанию.
+func (c LeaderConfig) Lock() string {
+	if c.LockName == "" {
+		return DefaultLeaderLockName
+	}
+	return c.LockName
+}
+
+// Interval возвращает период проверки и захвата блокировки лидера с учётом значения по умолчанию.
+func (c LeaderConfig) Interval() time.Duration {
+	if c.RenewInterval <= 0 {
+		return DefaultLeaderRenewInterval
+	}
+	return c.RenewInterval
+}
+
+// WebhookEventOrderStored - событие webhook: консьюмер записал полученный заказ в базу данных.
+const WebhookEventOrderStored = "order.stored"
+
+// WebhooksConfig содержит настройки HTTP уведомлений о записанных заказах. Доставка не гарантирована: уведомления
+// ставятся в очередь в памяти и отправляются фоновыми обработчиками, а неудачи не мешают записи заказов.
+type WebhooksConfig struct {
+	Endpoints   []WebhookEndpointConfig `yaml:"endpoints"`    // пустой список — уведомления выключены
+	QueueSize   int                     `yaml:"queue_size"`   // уведомлений в очереди; при заполнении новые отбрасываются; 0 — 1000
+	Workers     int                     `yaml:"workers"`      // фоновых обработчиков очереди; 0 — 4
+	MaxAttempts int                     `yaml:"max_attempts"` // попыток доставки одного уведомления; 0 — 5
+	Backoff     time.Duration           `yaml:"backoff"`      // пауза перед второй попыткой, удваивается с каждой следующей; 0 — 1s
+}
+
+// WebhookEndpointConfig - получатель уведомлений: тело запроса подписывается HMAC-SHA256 с ключом Secret.
+type WebhookEndpointConfig struct {
+	URL     string        `yaml:"url"`
+	Secret  string        `yaml:"secret" secret:"true"`
+	Events  []string      `yaml:"events"`  // события (WebhookEventOrderStored); пусто — все
+	Tenant  string        `yaml:"tenant"`  // уведомлять только о заказах арендатора; "" — всех арендаторов
+	Timeout time.Duration `yaml:"timeout"` // ограничение одной попытки; 0 — 5s
+}
+
+// Subscribed сообщает, подписан ли получатель на событие event.
+func (e WebhookEndpointConfig) Subscribed(event string) bool {
+	return len(e.Events) == 0 || slices.Contains(e.Events, event)
+}
+
+// validate проверяет настройки уведомлений; tenants - объявленные арендаторы
+func (c WebhooksConfig) validate(tenants []string) error {
+	if c.QueueSize < 0 || c.Workers < 0 || c.MaxAttempts < 0 || c.Backoff < 0 {
+		return fmt.Errorf("webhooks: queue_size, workers, max_attempts and backoff must not be negative")
+	}
+	for i, e := range c.Endpoints {
+		u, err := url.Parse(e.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhooks.endpoints[%d]: url must be an absolute http or https URL", i)
+		}
+		if e.Secret == "" {
+			return fmt.Errorf("webhooks.endpoints[%d]: secret is required", i)
+		}
+		for _, event := range e.Events {
+			if event != WebhookEventOrderStored {
+				return fmt.Errorf("webhooks.endpoints[%d]: unknown event %q: must be %q", i, event, WebhookEventOrderStored)
+			}
+		}
+		if e.Tenant != "" && !slices.Contains(tenants, e.Tenant) {
+			return fmt.Errorf("webhooks.endpoints[%d]: tenant %q is not declared", i, e.Tenant)
+		}
+		if e.Timeout < 0 {
+			return fmt.Errorf("webhooks.endpoints[%d]: timeout must not be negative", i)
+		}
+	}
+	return nil
+}
+
+// Режимы записи заказов консьюмером.
+const (
+	PipelineModeSync    = "sync"    // каждое сообщение сохраняется в базу данных до коммита смещения
+	PipelineModeBatched = "batched" // заказы кэшируются сразу, а в базу записываются пачками фоновым процессом
+)
+
+// PipelineConfig содержит настройки режима записи заказов. В режиме batched заказ доступен из кэша раньше, чем сохранён
+// в базе данных: при сбое процесса незаписанные заказы будут прочитаны из Kafka повторно, так как их смещения не закоммичены.
+type PipelineConfig struct {
+	Mode          string        `yaml:"mode"`
+	BatchSize     int           `yaml:"batch_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	QueueSize     int           `yaml:"queue_size"`
+	RetryDelay    time.Duration `yaml:"retry_delay"`
+	// Decode - строгость декодирования заказов из JSON (strict или lenient) в консьюмере и POST /orders
+	Decode string `yaml:"decode"`
+	// CacheOnIngest - какие полученные консьюмером заказы сразу помещаются в кэш (always, recent или never);
+	// пусто — always, а при повторе топика (-replay) — never
+	CacheOnIngest string `yaml:"cache_on_ingest"`
+	// CacheRecentWindow - насколько старым может быть date_created заказа, чтобы режим recent поместил его в кэш;
+	// 0 — DefaultCacheRecentWindow
+	CacheRecentWindow time.Duration `yaml:"cache_recent_window"`
+	// StartupGapCheck - проверка при запуске, что заказы последних закоммиченных группой сообщений есть в базе данных
+	StartupGapCheck StartupGapCheckConfig `yaml:"startup_gap_check"`
+	// Priority - первоочередная запись срочных заказов в пакетном режиме
+	Priority PriorityConfig `yaml:"priority"`
+}
+
+// PriorityConfig содержит настройки первоочередной записи срочных заказов в пакетном режиме: заказы служб доставки
+// DeliveryServices ставятся в отдельную очередь, которую процесс записи пачек разбирает раньше обычной.
+type PriorityConfig struct {
+	// DeliveryServices - службы доставки (delivery_service) срочных заказов без учёта регистра; пусто — приоритет выключен
+	DeliveryServices []string `yaml:"delivery_services"`
+	// Burst - сколько срочных сообщений подряд берётся из очереди, пока ждут обычные; 0 — DefaultPriorityBurst
+	Burst int `yaml:"burst"`
+}
+
+// DefaultPriorityBurst - значение pipeline.priority.burst по умолчанию
+const DefaultPriorityBurst = 4
+
+// Enabled сообщает, заданы ли службы доставки срочных заказов.
+func (c PriorityConfig) Enabled() bool {
+	return len(c.DeliveryServices) > 0
+}
+
+// BurstSize возвращает число срочных сообщений подряд с учётом значения по умолчанию.
+func (c PriorityConfig) BurstSize() int {
+	if c.Burst <= 0 {
+		return DefaultPriorityBurst
+	}
+	return c.Burst
+}
+
+// StartupGapCheckConfig содержит настройки проверки разрыва между смещениями группы и базой данных при запуске
+// (например, после восстановления базы из резервной копии).
+type StartupGapCheckConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Sample - сколько последних сообщений перед закоммиченным смещением проверяется в каждой партиции;
+	// 0 — DefaultGapCheckSample
+	Sample int `yaml:"sample"`
+	// AutoReplay - повторить сообщения партиции от первого отсутствующего в базе заказа до закоммиченного смещения
+	AutoReplay bool `yaml:"auto_replay"`
+	// Timeout - ограничение чтения образца и проверки заказов (без повтора); 0 — DefaultGapCheckTimeout
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Значения pipeline.startup_gap_check по умолчанию.
+const (
+	DefaultGapCheckSample  = 100
+	DefaultGapCheckTimeout = 30 * time.Second
+)
+
+// SampleSize возвращает число проверяемых сообщений партиции с учётом значения по умолчанию.
+func (c StartupGapCheckConfig) SampleSize() int {
+	if c.Sample <= 0 {
+		return DefaultGapCheckSample
+	}
+	return c.Sample
+}
+
+// CheckTimeout возвращает ограничение проверки с учётом значения по умолчанию.
+func (c StartupGapCheckConfig) CheckTimeout() time.Duration {
+	if c.Timeout <= 0 {
+		return DefaultGapCheckTimeout
+	}
+	return c.Timeout
+}
+
+// validatePriority - проверяет pipeline.priority: очереди по классам есть только в пакетном режиме
+func (c PipelineConfig) validatePriority() error {
+	p := c.Priority
+	if p.Burst < 0 {
+		return fmt.Errorf("pipeline.priority: burst must not be negative")
+	}
+	if !p.Enabled() {
+		return nil
+	}
+	if c.Mode != PipelineModeBatched {
+		return fmt.Errorf("pipeline.priority: delivery_services require mode %q", PipelineModeBatched)
+	}
+	for _, s := range p.DeliveryServices {
+		if strings.TrimSpace(s) == "" {
+			return fmt.Errorf("pipeline.priority: empty delivery service")
+		}
+	}
+	return nil
+}
+
+// Режимы кэширования заказов, полученных консьюмером (pipeline.cache_on_ingest).
+const (
+	CacheOnIngestAlways = "always" // каждый сохранённый заказ помещается в кэш
+	CacheOnIngestRecent = "recent" // только заказы с date_created не старше pipeline.cache_recent_window
+	CacheOnIngestNever  = "never"  // заказы попадают в кэш только при чтении
+)
+
+// DefaultCacheRecentWindow - окно pipeline.cache_recent_window по умолчанию
+const DefaultCacheRecentWindow = 24 * time.Hour
+
+// RecentWindow возвращает окно режима recent с учётом значения по умолчанию.
+func (c PipelineConfig) RecentWindow() time.Duration {
+	if c.CacheRecentWindow <= 0 {
+		return DefaultCacheRecentWindow
+	}
+	return c.CacheRecentWindow
+}
+
+// AdminConfig содержит настройки административного API.
+type AdminConfig struct {
+	APIKey  string        `yaml:"api_key" secret:"true"`
+	Export  ExportConfig  `yaml:"export"`
+	Preload PreloadConfig `yaml:"preload"`
+	Stats   StatsConfig   `yaml:"stats"`
+	// DeliveryHistory - хранение истории изменений доставки заказов
+	DeliveryHistory DeliveryHistoryConfig `yaml:"delivery_history"`
+	// RedactPII включает маскирование телефона и email доставки в ответах API для вызывающих без полного доступа
+	RedactPII bool `yaml:"redact_pii"`
+	// RoleKeys - дополнительные ключи API и их роли (full или support); ключ api_key всегда имеет роль full
+	RoleKeys map[string]string `yaml:"role_keys" secret:"true"`
+}
+
+// Роли ключей API, определяющие доступ к персональным данным в ответах.
+const (
+	RoleFull    = "full"    // данные заказа без изменений
+	RoleSupport = "support" // телефон и email доставки маскируются
+)
+
+// DeliveryHistoryConfig содержит настройки хранения истории доставки заказов (GET /admin/orders/{id}/delivery/history).
+type DeliveryHistoryConfig struct {
+	Retention       time.Duration `yaml:"retention"`        // сколько хранить записи истории, 0 — бессрочно
+	CleanupInterval time.Duration `yaml:"cleanup_interval"` // период удаления устаревших записей
+}
+
+// StatsConfig содержит настройки статистики заказов.
+type StatsConfig struct {
+	// USDRates - статические курсы валют к доллару (валюта → стоимость единицы в USD) для приблизительной суммы
+	// approx_total_usd в GET /admin/stats/breakdown; пусто — сумма не считается. Курс USD всегда 1.
+	USDRates map[string]float64 `yaml:"usd_rates"`
+}
+
+// Rates проверяет курсы и возвращает их с валютами, приведёнными к кодам ISO 4217 (validation.NormalizeCurrency),
+// и курсом USD. Для пустой таблицы возвращается nil.
+func (c StatsConfig) Rates() (map[string]float64, error) {
+	if len(c.USDRates) == 0 {
+		return nil, nil
+	}
+	rates := map[string]float64{"USD": 1}
+	for currency, rate := range c.USDRates {
+		code, ok := validation.NormalizeCurrency(currency)
+		if !ok {
+			return nil, fmt.Errorf("admin.stats.usd_rates: unknown currency %q", currency)
+		}
+		if rate <= 0 {
+			return nil, fmt.Errorf("admin.stats.usd_rates: rate of %s must be positive", code)
+		}
+		rates[code] = rate
+	}
+	return rates, nil
+}
+
+// PreloadConfig содержит ограничения предварительной загрузки заказов в кэш: максимальное число идентификаторов в запросе,
+// число параллельных чтений из базы данных и общий срок выполнения запроса (0 — только срок контекста запроса).
+type PreloadConfig struct {
+	MaxUIDs     int           `yaml:"max_uids"`
+	Concurrency int           `yaml:"concurrency"`
+	Timeout     time.Duration `yaml:"timeout"`
+}
+
+// ExportConfig содержит ограничения выгрузки заказов: максимальный интервал дат, максимальное число строк и размер страницы чтения.
+type ExportConfig struct {
+	MaxRange time.Duration `yaml:"max_range"`
+	MaxRows  int           `yaml:"max_rows"`
+	PageSize int           `yaml:"page_size"`
 }
 
 // TestConfig содержит настройки для тестов
@@ -35,32 +638,339 @@ type TestConfig struct {
 
 // TestKafkaConfig содержит настройки Kafka для тестов
 type TestKafkaConfig struct {
-	Brokers            []string `yaml:"brokers"`
-	Topic              string   `yaml:"topic"`
-	IntegrationGroupID string   `yaml:"integration_group_id"`
-	MultipleGroupID    string   `yaml:"multiple_group_id"`
-	BenchmarkGroupID   string   `yaml:"benchmark_group_id"`
-	BenchmarkTopic     string   `yaml:"benchmark_topic"`
+	Brokers          []string `yaml:"brokers"`
+	BenchmarkGroupID string   `yaml:"benchmark_group_id"`
+	BenchmarkTopic   string   `yaml:"benchmark_topic"`
 }
 
 // DatabaseConfig Config содержит настройки приложения, включая параметры подключения к базе данных PostgreSQL, конфигурацию Kafka и настройки сервера.
 type DatabaseConfig struct {
-	Host           string `yaml:"host"`
-	Port           string `yaml:"port"`
-	User           string `yaml:"user"`
-	Password       string `yaml:"password"`
-	DBName         string `yaml:"db_name"`
-	SSLMode        string `yaml:"ssl_mode"`
-	MaxConnections int    `yaml:"max_connections"`
+	Host                   string           `yaml:"host"`
+	Port                   string           `yaml:"port"`
+	User                   string           `yaml:"user"`
+	Password               string           `yaml:"password" secret:"true"`
+	DBName                 string           `yaml:"db_name"`
+	SSLMode                string           `yaml:"ssl_mode"`
+	MaxConnections         int              `yaml:"max_connections"`          // размер пула соединений, 0 — значение pgxpool по умолчанию
+	ConnectAttempts        int              `yaml:"connect_attempts"`         // число попыток подключения при запуске, 0 — одна попытка
+	StatementCacheMode     string           `yaml:"statement_cache_mode"`     // prepare (по умолчанию) или describe для PgBouncer в режиме transaction
+	StatementTimeout       time.Duration    `yaml:"statement_timeout"`        // ограничение выражений в транзакциях записи заказов, 0 — без ограничения
+	QueryTimeout           time.Duration    `yaml:"query_timeout"`            // ограничение каждого вызова репозитория, если дедлайн вызывающего не раньше; 0 — без ограничения
+	ServerStatementTimeout time.Duration    `yaml:"server_statement_timeout"` // statement_timeout всех соединений пула (страховка на сервере), 0 — значение сервера
+	Encryption             EncryptionConfig `yaml:"encryption"`
+	Replica                ReplicaConfig    `yaml:"replica"`
+	// Retention - срок хранения заказов по date_created: более старые выгружаются в архив и удаляются; 0 — бессрочно
+	Retention time.Duration `yaml:"retention"`
+	Archive   ArchiveConfig `yaml:"archive"`
+}
+
+// Значения database.archive по умолчанию.
+const (
+	DefaultArchiveInterval  = time.Hour
+	DefaultArchiveBatchSize = 500
+)
+
+// ArchiveConfig содержит настройки выгрузки заказов старше database.retention в сжатые файлы NDJSON перед удалением.
+type ArchiveConfig struct {
+	Dir       string        `yaml:"dir"`        // каталог файлов архива; обязателен, если задан retention и выключен dry_run
+	Interval  time.Duration `yaml:"interval"`   // период запуска, 0 — DefaultArchiveInterval
+	BatchSize int           `yaml:"batch_size"` // заказов в странице чтения и в транзакции удаления, 0 — DefaultArchiveBatchSize
+	DryRun    bool          `yaml:"dry_run"`    // только подсчитать заказы, которые были бы выгружены и удалены
+}
+
+// RunInterval возвращает период запуска с учётом значения по умолчанию.
+func (c ArchiveConfig) RunInterval() time.Duration {
+	if c.Interval <= 0 {
+		return DefaultArchiveInterval
+	}
+	return c.Interval
+}
+
+// Batch возвращает размер пачки с учётом значения по умолчанию.
+func (c ArchiveConfig) Batch() int {
+	if c.BatchSize <= 0 {
+		return DefaultArchiveBatchSize
+	}
+	return c.BatchSize
+}
+
+// DefaultReplicaHealthInterval - период проверки реплики, если database.replica.health_interval не задан
+const DefaultReplicaHealthInterval = 5 * time.Second
+
+// ReplicaConfig содержит настройки реплики PostgreSQL, с которой выполняются чтения эндпоинтов API. Реплика
+// включена, если задан host; незаданные port, user, password, db_name и ssl_mode берутся из настроек основной базы.
+type ReplicaConfig struct {
+	Host           string        `yaml:"host"`
+	Port           string        `yaml:"port"`
+	User           string        `yaml:"user"`
+	Password       string        `yaml:"password" secret:"true"`
+	DBName         string        `yaml:"db_name"`
+	SSLMode        string        `yaml:"ssl_mode"`
+	MaxConnections int           `yaml:"max_connections"` // размер пула реплики, 0 — как у основной базы
+	HealthInterval time.Duration `yaml:"health_interval"` // период проверки реплики, 0 — DefaultReplicaHealthInterval
+}
+
+// Enabled сообщает, настроена ли реплика.
+func (c ReplicaConfig) Enabled() bool {
+	return c.Host != ""
+}
+
+// Interval возвращает период проверки реплики.
+func (c ReplicaConfig) Interval() time.Duration {
+	if c.HealthInterval <= 0 {
+		return DefaultReplicaHealthInterval
+	}
+	return c.HealthInterval
+}
+
+// Переменные окружения с ключами шифрования; если заданы, заменяют значения database.encryption.
+const (
+	EncryptionKeysEnv      = "ORDER_ENCRYPTION_KEYS"
+	EncryptionActiveKeyEnv = "ORDER_ENCRYPTION_ACTIVE_KEY"
+)
+
+// EncryptionConfig содержит настройки шифрования телефона и email доставки в базе данных.
+// Ключи лучше задавать переменной окружения ORDER_ENCRYPTION_KEYS, а не в файле конфигурации.
+type EncryptionConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	ActiveKey string `yaml:"active_key"`         // идентификатор ключа, которым шифруются новые значения
+	Keys      string `yaml:"keys" secret:"true"` // ключи AES-256 в формате "id1:base64,id2:base64"; старые ключи нужны для чтения до перешифрования
+}
+
+// Keyring возвращает набор ключей шифрования или nil, если шифрование отключено. Значения переменных окружения
+// подставляет Load. Включённое шифрование без ключей или с некорректными ключами — ошибка.
+func (c EncryptionConfig) Keyring() (*crypto.Keyring, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	keys, err := crypto.ParseKeys(c.Keys)
+	if err != nil {
+		return nil, fmt.Errorf("database.encryption: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("database.encryption is enabled but no keys are set (set %s)", EncryptionKeysEnv)
+	}
+	kr, err := crypto.NewKeyring(keys, c.ActiveKey)
+	if err != nil {
+		return nil, fmt.Errorf("database.encryption: %w", err)
+	}
+	return kr, nil
 }
 
 // KafkaConfig DatabaseConfig содержит настройки для подключения к базе данных PostgreSQL, такие как хост, порт, пользователь, пароль, имя базы данных и режим SSL.
 type KafkaConfig struct {
-	Brokers []string     `yaml:"brokers"`
-	Topic   string       `yaml:"topic"`
-	GroupID string       `yaml:"group_id"`
-	Reader  ReaderConfig `yaml:"reader"`
-	Writer  WriterConfig `yaml:"writer"`
+	Brokers  []string       `yaml:"brokers"`
+	Topic    string         `yaml:"topic"`
+	GroupID  string         `yaml:"group_id"`
+	Reader   ReaderConfig   `yaml:"reader"`
+	Writer   WriterConfig   `yaml:"writer"`
+	Consumer ConsumerConfig `yaml:"consumer"`
+	// CloseTimeout ограничивает закрытие читателя при остановке: при недоступных брокерах Close может не завершиться, 0 — 5s.
+	CloseTimeout time.Duration `yaml:"close_timeout"`
+	// DLQTopic - топик очереди недоставленных сообщений (dead letter queue), куда консьюмер отправляет сообщения,
+	// которые не удалось записать за kafka.consumer.max_attempts попыток
+	DLQTopic string `yaml:"dlq_topic"`
+	// Replay - сохранение позиции чтения при повторе топика без группы (-replay)
+	Replay ReplayConfig `yaml:"replay"`
+	// EnsureTopics - создавать при запуске консьюмера отсутствующие топики (Config.KafkaTopics) с параметрами Topics;
+	// false — только проверять, что они существуют и содержат не меньше Topics.MinPartitions партиций
+	EnsureTopics bool         `yaml:"ensure_topics"`
+	Topics       TopicsConfig `yaml:"topics"`
+}
+
+// TopicsConfig содержит параметры топиков, создаваемых при kafka.ensure_topics, и минимальное число партиций
+// существующих топиков.
+type TopicsConfig struct {
+	Partitions        int `yaml:"partitions"`         // 0 — 1
+	ReplicationFactor int `yaml:"replication_factor"` // 0 — 1
+	MinPartitions     int `yaml:"min_partitions"`     // 0 — не проверяется
+	// OrderAck - топик подтверждений записи заказов (kafka.consumer.order_ack)
+	OrderAck string `yaml:"order_ack"`
+}
+
+// ToTopicSpec преобразует параметры топиков в kafka.TopicSpec с учётом значений по умолчанию.
+func (t TopicsConfig) ToTopicSpec() kafka.TopicSpec {
+	return kafka.TopicSpec{
+		Partitions:        max(t.Partitions, 1),
+		ReplicationFactor: max(t.ReplicationFactor, 1),
+		MinPartitions:     t.MinPartitions,
+	}
+}
+
+// ReplayConfig содержит настройки контрольных точек повтора топика: позиция чтения партиции сохраняется
+// каждые CheckpointEvery сообщений или не реже CheckpointInterval, а также при остановке.
+type ReplayConfig struct {
+	CheckpointEvery    int           `yaml:"checkpoint_every"`    // 0 — 1000
+	CheckpointInterval time.Duration `yaml:"checkpoint_interval"` // 0 — 5s
+}
+
+// ConsumerConfig содержит настройки обработки сообщений консьюмером: логирование тел сообщений и выборочное логирование ошибок.
+type ConsumerConfig struct {
+	LogPayloads        bool `yaml:"log_payloads"`          // логировать тела сообщений (только для отладки, PII маскируется)
+	LogPayloadMaxBytes int  `yaml:"log_payload_max_bytes"` // максимальная длина логируемого тела
+	ErrorLogFirst      int  `yaml:"error_log_first"`       // сколько первых ошибок каждого класса логировать всегда
+	ErrorLogEvery      int  `yaml:"error_log_every"`       // далее логировать каждую N-ю ошибку класса
+	// StartOffset задаёт позицию чтения для группы без сохранённых смещений: earliest или latest.
+	// Пустое значение сохраняет поведение kafka-go по умолчанию.
+	StartOffset string `yaml:"start_offset"`
+	// ResetOffsets однократно сбрасывает смещения группы на StartOffset перед запуском консьюмера.
+	// Требует подтверждения переменной окружения KAFKA_RESET_OFFSETS_CONFIRM, равной group_id.
+	ResetOffsets bool `yaml:"reset_offsets"`
+	// DedupSize и DedupWindow задают окно подавления повторной доставки одного и того же смещения (partition, offset)
+	DedupSize   int           `yaml:"dedup_size"`
+	DedupWindow time.Duration `yaml:"dedup_window"`
+	// RecentOrdersSize и RecentOrdersWindow задают окно недавно сохранённых заказов (order_uid → отпечаток содержимого):
+	// повтор заказа с тем же содержимым в пределах окна не записывается в базу данных (0 — выключено)
+	RecentOrdersSize   int           `yaml:"recent_orders_size"`
+	RecentOrdersWindow time.Duration `yaml:"recent_orders_window"`
+	// StatsInterval - период снятия статистики клиентов Kafka (читателя и писателя очереди недоставленных сообщений)
+	// для сводки в логе и метрик (0 — выключено)
+	StatsInterval time.Duration `yaml:"stats_interval"`
+	// StatsLogLevel - минимальный уровень сводок статистики в логе: info (по умолчанию) или debug.
+	// Сводки интервалов без активности пишутся с уровнем debug
+	StatsLogLevel string `yaml:"stats_log_level"`
+	// ErrorBufferSize - сколько последних ошибок обработки хранится для GET /admin/errors (0 — не хранятся)
+	ErrorBufferSize int `yaml:"error_buffer_size"`
+	// Format - формат сообщений без заголовка content-type: json (по умолчанию) или protobuf
+	Format string `yaml:"format"`
+	// MaxAttempts - сколько неудачных попыток записи в базу данных даётся сообщению, прежде чем оно отправляется
+	// в очередь недоставленных сообщений (0 — без ограничения: в режиме sync ошибка только логируется,
+	// в режиме batched пачка повторяется до успеха)
+	MaxAttempts int `yaml:"max_attempts"`
+	// SkipSpillFile - файл, в конец которого дописываются сообщения, пропущенные по указанию POST /admin/consumer/skip
+	// (пустое значение — skipped_messages.ndjson в рабочем каталоге)
+	SkipSpillFile string `yaml:"skip_spill_file"`
+	// Latency - учёт сквозной задержки от публикации сообщения в Kafka до появления заказа в кэше
+	Latency LatencyConfig `yaml:"latency"`
+	// OrderAck - публикация подтверждений записи заказов в топик kafka.topics.order_ack
+	OrderAck OrderAckConfig `yaml:"order_ack"`
+	// CustomerLimit - ограничение частоты заказов одного покупателя (customer_id) при приёме
+	CustomerLimit CustomerLimitConfig `yaml:"customer_limit"`
+	// IngestStats - почасовые счётчики сообщений по продюсерам и покупателям с отметкой всплесков некорректных сообщений
+	IngestStats IngestStatsConfig `yaml:"ingest_stats"`
+	// MaxReadyLag - отставание читателя (сообщений), при превышении которого дольше ReadyLagGrace GET /readyz сообщает
+	// о деградации консьюмера (0 — выключено). Отставание берётся из статистики клиентов Kafka и требует stats_interval
+	MaxReadyLag   int64         `yaml:"max_ready_lag"`
+	ReadyLagGrace time.Duration `yaml:"ready_lag_grace"`
+	// ReadyLagClear - отставание, при котором деградация снимается (0 — половина max_ready_lag): промежуток между
+	// порогами не даёт флагу переключаться при отставании около max_ready_lag
+	ReadyLagClear int64 `yaml:"ready_lag_clear"`
+	// ReadyLagUnready - при деградации по отставанию GET /readyz отвечает 503, а не только флагом в JSON
+	ReadyLagUnready bool `yaml:"ready_lag_unready"`
+}
+
+// UsesDLQ сообщает, отправляет ли консьюмер сообщения в очередь недоставленных kafka.dlq_topic: исчерпавшие
+// max_attempts или, при политике dlq, заказы покупателей сверх customer_limit.
+func (c ConsumerConfig) UsesDLQ() bool {
+	return c.MaxAttempts > 0 || c.CustomerLimit.Enabled() && c.CustomerLimit.Policy == CustomerLimitPolicyDLQ
+}
+
+// validateReadyLag - проверяет пороги отставания читателя для GET /readyz
+func (c ConsumerConfig) validateReadyLag() error {
+	if c.MaxReadyLag < 0 || c.ReadyLagClear < 0 || c.ReadyLagGrace < 0 {
+		return fmt.Errorf("kafka.consumer: max_ready_lag, ready_lag_clear and ready_lag_grace must not be negative")
+	}
+	if c.MaxReadyLag == 0 {
+		return nil
+	}
+	if c.ReadyLagClear >= c.MaxReadyLag {
+		return fmt.Errorf("kafka.consumer: ready_lag_clear (%d) must be less than max_ready_lag (%d)", c.ReadyLagClear, c.MaxReadyLag)
+	}
+	if c.StatsInterval <= 0 {
+		return fmt.Errorf("kafka.consumer: max_ready_lag requires stats_interval")
+	}
+	return nil
+}
+
+// Политики заказов покупателя сверх kafka.consumer.customer_limit.max_per_minute
+const (
+	CustomerLimitPolicyFlag = "flag" // заказ сохраняется с замечанием и не подтверждается (по умолчанию)
+	CustomerLimitPolicyDLQ  = "dlq"  // сообщение отправляется в очередь недоставленных без записи заказа
+)
+
+// CustomerLimitConfig содержит настройки защиты от продюсера, отправляющего заказы одного покупателя без остановки:
+// заказы покупателя сверх MaxPerMinute за скользящую минуту помечаются или отклоняются по Policy.
+type CustomerLimitConfig struct {
+	MaxPerMinute int    `yaml:"max_per_minute"` // 0 — ограничение выключено
+	Policy       string `yaml:"policy"`         // flag (по умолчанию) или dlq
+	Size         int    `yaml:"size"`           // сколько покупателей отслеживается одновременно; 0 — 10000
+}
+
+// Enabled сообщает, включено ли ограничение.
+func (c CustomerLimitConfig) Enabled() bool {
+	return c.MaxPerMinute > 0
+}
+
+// Значения kafka.consumer.ingest_stats по умолчанию
+const (
+	DefaultIngestStatsSize          = 10000
+	DefaultIngestStatsFlushInterval = time.Minute
+	DefaultIngestStatsThreshold     = 2.0
+	DefaultIngestStatsMinMessages   = 20
+)
+
+// IngestStatsConfig содержит настройки почасовых счётчиков принятых, некорректных и повторных сообщений по
+// отправителям (customer_id заказа и заголовок producer_id сообщения). Счётчики периодически дописываются в таблицу
+// ingest_stats; отправитель отмечается аномальным, если доля некорректных сообщений текущего часа больше средней
+// за предыдущие 24 часа в Threshold раз.
+type IngestStatsConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Size          int           `yaml:"size"`           // сколько отправителей отслеживается одновременно; 0 — 10000
+	FlushInterval time.Duration `yaml:"flush_interval"` // период записи счётчиков в ingest_stats; 0 — 1m
+	Threshold     float64       `yaml:"threshold"`      // во сколько раз доля ошибок часа должна превысить среднюю; 0 — 2
+	// MinMessages - сколько сообщений нужно в текущем часе и за предыдущие сутки, чтобы отправитель мог быть
+	// отмечен; 0 — 20
+	MinMessages int `yaml:"min_messages"`
+}
+
+// Keys возвращает, сколько отправителей отслеживается.
+func (c IngestStatsConfig) Keys() int {
+	if c.Size > 0 {
+		return c.Size
+	}
+	return DefaultIngestStatsSize
+}
+
+// Interval возвращает период записи счётчиков.
+func (c IngestStatsConfig) Interval() time.Duration {
+	if c.FlushInterval > 0 {
+		return c.FlushInterval
+	}
+	return DefaultIngestStatsFlushInterval
+}
+
+// Factor возвращает порог аномалии.
+func (c IngestStatsConfig) Factor() float64 {
+	if c.Threshold > 0 {
+		return c.Threshold
+	}
+	return DefaultIngestStatsThreshold
+}
+
+// Minimum возвращает минимум сообщений для отметки отправителя.
+func (c IngestStatsConfig) Minimum() int {
+	if c.MinMessages > 0 {
+		return c.MinMessages
+	}
+	return DefaultIngestStatsMinMessages
+}
+
+// OrderAckConfig содержит настройки подтверждений записи заказов: после записи заказа в базу данных и кэш консьюмер
+// публикует событие в топик kafka.topics.order_ack. Публикация не гарантирована: неудачные попытки повторяются
+// не больше Attempts раз, после чего подтверждение пропускается, а смещение сообщения коммитится.
+type OrderAckConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	InstanceID     string        `yaml:"instance_id"`     // идентификатор экземпляра консьюмера в событиях; "" — имя хоста
+	Attempts       int           `yaml:"attempts"`        // попытки публикации одного подтверждения или пачки; 0 — 3
+	AttemptTimeout time.Duration `yaml:"attempt_timeout"` // ограничение одной попытки; 0 — 2s
+}
+
+// LatencyConfig содержит настройки учёта сквозной задержки обработки заказов.
+type LatencyConfig struct {
+	SLO        time.Duration `yaml:"slo"`         // порог p99 задержки; превышение отмечается в /admin/consumer/status (0 — не проверяется)
+	Window     time.Duration `yaml:"window"`      // скользящее окно, по которому считается p99
+	WindowSize int           `yaml:"window_size"` // сколько последних измерений хранит окно
+	Record     bool          `yaml:"record"`      // сохранять последнюю задержку каждого заказа в таблицу order_audit
 }
 
 // ReaderConfig содержит настройки для Kafka Reader, такие как минимальный и максимальный размер сообщений, таймауты и интервал коммита.
@@ -80,11 +990,168 @@ type WriterConfig struct {
 
 // ServerConfig содержит настройки сервера, такие как порт.
 type ServerConfig struct {
-	Port            string        `yaml:"port"`
-	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	Port            string            `yaml:"port"`
+	HealthPort      string            `yaml:"health_port"` // порт проверки состояния и метрик в режиме consumer
+	ShutdownTimeout time.Duration     `yaml:"shutdown_timeout"`
+	DBFallback      DBFallbackConfig  `yaml:"db_fallback"`
+	Idempotency     IdempotencyConfig `yaml:"idempotency"`
+	// SecurityHeaders задаёт заголовки безопасности ответов. Пустое значение означает значение по умолчанию,
+	// SecurityHeaderOff — отключение заголовка.
+	SecurityHeaders SecurityHeadersConfig `yaml:"security_headers"`
+	Cursor          CursorConfig          `yaml:"cursor"`
+	// GoroutineLimit - число зарегистрированных горутин, начиная с которого обработчики запросов не запускают
+	// новых рабочих горутин (предзагрузка кэша отвечает 503); 0 — без ограничения
+	GoroutineLimit int       `yaml:"goroutine_limit"`
+	TLS            TLSConfig `yaml:"tls"`
+	// WebAPI - публичные эндпоинты страницы web/: последние заказы и подсказки идентификаторов
+	WebAPI WebAPIConfig `yaml:"web_api"`
+	// OrderValidate - проверка заказа без сохранения POST /orders/validate
+	OrderValidate OrderValidateConfig `yaml:"order_validate"`
+}
+
+// DefaultOrderValidateRatePerMinute - запросов POST /orders/validate в минуту с одного адреса по умолчанию
+const DefaultOrderValidateRatePerMinute = 60
+
+// OrderValidateConfig содержит настройки эндпоинта POST /orders/validate, которым партнёры проверяют заказы
+// без сохранения.
+type OrderValidateConfig struct {
+	// RatePerMinute - запросов в минуту с одного адреса клиента; 0 — DefaultOrderValidateRatePerMinute
+	RatePerMinute int `yaml:"rate_per_minute"`
+}
+
+// Rate возвращает ограничение запросов в минуту с одного адреса с учётом значения по умолчанию.
+func (c OrderValidateConfig) Rate() int {
+	if c.RatePerMinute <= 0 {
+		return DefaultOrderValidateRatePerMinute
+	}
+	return c.RatePerMinute
+}
+
+// Значения по умолчанию секции server.web_api.
+const (
+	DefaultWebAPIRecentSize    = 200
+	DefaultWebAPIRatePerMinute = 60
+)
+
+// WebAPIConfig содержит настройки публичных эндпоинтов GET /api/recent и GET /api/suggest страницы web/. Ответы
+// содержат только краткие сведения о заказах без персональных данных.
+type WebAPIConfig struct {
+	// RecentSize - число последних обработанных консьюмером заказов, которые хранятся в памяти для /api/recent;
+	// 0 — DefaultWebAPIRecentSize
+	RecentSize int `yaml:"recent_size"`
+	// RatePerMinute - запросов к эндпоинтам в минуту с одного адреса клиента; 0 — DefaultWebAPIRatePerMinute
+	RatePerMinute int `yaml:"rate_per_minute"`
+}
+
+// Recent возвращает размер кольца последних заказов с учётом значения по умолчанию.
+func (c WebAPIConfig) Recent() int {
+	if c.RecentSize <= 0 {
+		return DefaultWebAPIRecentSize
+	}
+	return c.RecentSize
+}
+
+// Rate возвращает ограничение запросов в минуту с одного адреса с учётом значения по умолчанию.
+func (c WebAPIConfig) Rate() int {
+	if c.RatePerMinute <= 0 {
+		return DefaultWebAPIRatePerMinute
+	}
+	return c.RatePerMinute
+}
+
+// TLSConfig содержит настройки HTTPS. Без cert_file сервер принимает соединения HTTP, а TLS завершает прокси.
+type TLSConfig struct {
+	CertFile   string `yaml:"cert_file"`   // сертификат PEM с цепочкой; перечитывается при изменении файла
+	KeyFile    string `yaml:"key_file"`    // закрытый ключ сертификата PEM
+	MinVersion string `yaml:"min_version"` // наименьшая версия TLS: 1.2 (по умолчанию) или 1.3
+	// ClientCA - сертификаты CA PEM, которыми подписаны сертификаты клиентов; если задан, маршруты /admin/
+	// доступны только с клиентским сертификатом (mTLS), остальные маршруты его не требуют
+	ClientCA string `yaml:"client_ca"`
 }
 
-// Load загружает конфигурацию из файла YAML по указанному пути.
+// Enabled сообщает, обслуживает ли сервер HTTPS.
+func (c TLSConfig) Enabled() bool { return c.CertFile != "" }
+
+// Version возвращает наименьшую версию TLS (tls.VersionTLS12 или tls.VersionTLS13) по min_version.
+func (c TLSConfig) Version() (uint16, error) {
+	switch c.MinVersion {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("invalid min_version %q: must be \"1.2\" or \"1.3\"", c.MinVersion)
+	}
+}
+
+// CursorSecretEnv - переменная окружения с секретом подписи курсоров; если задана, заменяет server.cursor.secret.
+const CursorSecretEnv = "ORDER_CURSOR_SECRET"
+
+// CursorConfig содержит настройки курсоров постраничной выдачи GET /orders.
+type CursorConfig struct {
+	// Secret - секрет подписи курсоров (HMAC-SHA256). Пустое значение означает случайный секрет процесса:
+	// курсоры не переживают перезапуск и не принимаются другими репликами.
+	Secret string        `yaml:"secret" secret:"true"`
+	TTL    time.Duration `yaml:"ttl"` // время жизни курсора, 0 — без ограничения
+}
+
+// SigningSecret возвращает секрет подписи курсоров или nil, если он не задан. Значение переменной окружения
+// подставляет Load.
+func (c CursorConfig) SigningSecret() []byte {
+	if c.Secret == "" {
+		return nil
+	}
+	return []byte(c.Secret)
+}
+
+// SecurityHeaderOff - значение заголовка безопасности в конфигурации, отключающее его.
+const SecurityHeaderOff = "off"
+
+// SecurityHeadersConfig содержит значения заголовков безопасности HTTP ответов.
+type SecurityHeadersConfig struct {
+	ContentTypeOptions    string `yaml:"content_type_options"`    // X-Content-Type-Options
+	FrameOptions          string `yaml:"frame_options"`           // X-Frame-Options
+	ReferrerPolicy        string `yaml:"referrer_policy"`         // Referrer-Policy
+	ContentSecurityPolicy string `yaml:"content_security_policy"` // Content-Security-Policy статических страниц
+}
+
+// IdempotencyConfig содержит настройки ключей идемпотентности запросов создания заказов (заголовок Idempotency-Key).
+type IdempotencyConfig struct {
+	TTL             time.Duration `yaml:"ttl"`              // сколько хранится результат запроса; повтор позже обрабатывается заново
+	CleanupInterval time.Duration `yaml:"cleanup_interval"` // период удаления истёкших ключей
+	WaitTimeout     time.Duration `yaml:"wait_timeout"`     // сколько повтор ждёт завершения исходного запроса с тем же ключом
+}
+
+// DBFallbackConfig содержит настройки чтения из базы данных HTTP обработчиками (в том числе при промахе кэша).
+type DBFallbackConfig struct {
+	Timeout time.Duration `yaml:"timeout"` // максимальное время запроса к базе; дедлайн HTTP запроса тоже учитывается
+	Breaker BreakerConfig `yaml:"breaker"`
+}
+
+// BreakerConfig содержит параметры автоматического выключателя чтений из базы данных.
+type BreakerConfig struct {
+	WindowSize       int           `yaml:"window_size"`
+	MinRequests      int           `yaml:"min_requests"`
+	FailureRate      float64       `yaml:"failure_rate"`
+	Cooldown         time.Duration `yaml:"cooldown"`
+	HalfOpenRequests int           `yaml:"half_open_requests"`
+}
+
+// Переменные окружения с секретами; если заданы, заменяют значения database.password, database.replica.password
+// и admin.api_key.
+const (
+	DatabasePasswordEnv        = "DATABASE_PASSWORD"
+	DatabaseReplicaPasswordEnv = "DATABASE_REPLICA_PASSWORD"
+	AdminAPIKeyEnv             = "ADMIN_API_KEY"
+)
+
+// SecretFileSuffix - суффикс переменной окружения секрета, значение которой — путь к файлу с секретом
+// (DATABASE_PASSWORD_FILE), как у секретов, смонтированных файлами в Kubernetes.
+const SecretFileSuffix = "_FILE"
+
+// Load загружает конфигурацию из файла YAML по указанному пути и подставляет секреты из переменных окружения.
+// Для каждого секрета переменная с суффиксом SecretFileSuffix важнее переменной без него, а та — значения из файла
+// конфигурации. Отсутствующий или нечитаемый файл секрета — ошибка с именем переменной.
 func Load(configPath string) (*Config, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
@@ -95,10 +1162,343 @@ func Load(configPath string) (*Config, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, err
 	}
+	if err := cfg.applySecretEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 
 	return &cfg, nil
 }
 
+// applySecretEnv - заменяет секреты конфигурации значениями переменных окружения
+func (c *Config) applySecretEnv() error {
+	for _, s := range []struct {
+		env   string
+		value *string
+	}{
+		{DatabasePasswordEnv, &c.Database.Password},
+		{DatabaseReplicaPasswordEnv, &c.Database.Replica.Password},
+		{AdminAPIKeyEnv, &c.Admin.APIKey},
+		{EncryptionKeysEnv, &c.Database.Encryption.Keys},
+		{EncryptionActiveKeyEnv, &c.Database.Encryption.ActiveKey},
+		{CursorSecretEnv, &c.Server.Cursor.Secret},
+	} {
+		v, ok, err := secretEnv(s.env)
+		if err != nil {
+			return err
+		}
+		if ok {
+			*s.value = v
+		}
+	}
+	return nil
+}
+
+// secretEnv - значение секрета из переменных окружения: содержимое файла из name_FILE без завершающих переводов
+// строки или значение name. false — ни одна из переменных не задана (пустое значение не учитывается)
+func secretEnv(name string) (string, bool, error) {
+	fileEnv := name + SecretFileSuffix
+	if path := os.Getenv(fileEnv); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s: read secret file: %w", fileEnv, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	}
+	if v := os.Getenv(name); v != "" {
+		return v, true, nil
+	}
+	return "", false, nil
+}
+
+// Validate проверяет значения конфигурации, которые невозможно корректно применить.
+func (c *Config) Validate() error {
+	if _, err := kafka.ParseStartOffset(c.Kafka.Consumer.StartOffset); err != nil {
+		return fmt.Errorf("kafka.consumer: %w", err)
+	}
+	if c.Server.GoroutineLimit < 0 {
+		return fmt.Errorf("server: goroutine_limit must not be negative")
+	}
+	if c.Server.WebAPI.RecentSize < 0 || c.Server.WebAPI.RatePerMinute < 0 {
+		return fmt.Errorf("server.web_api: recent_size and rate_per_minute must not be negative")
+	}
+	if c.Server.OrderValidate.RatePerMinute < 0 {
+		return fmt.Errorf("server.order_validate: rate_per_minute must not be negative")
+	}
+	if c.Server.Cursor.TTL < 0 {
+		return fmt.Errorf("server.cursor: ttl must not be negative")
+	}
+	if tlsCfg := c.Server.TLS; tlsCfg.Enabled() || tlsCfg.KeyFile != "" || tlsCfg.ClientCA != "" {
+		if tlsCfg.CertFile == "" || tlsCfg.KeyFile == "" {
+			return fmt.Errorf("server.tls: cert_file and key_file must be set together")
+		}
+		if _, err := tlsCfg.Version(); err != nil {
+			return fmt.Errorf("server.tls: %w", err)
+		}
+	}
+	if c.Leader.RenewInterval < 0 {
+		return fmt.Errorf("leader: renew_interval must not be negative")
+	}
+	if c.Cache.NegativeTTL < 0 {
+		return fmt.Errorf("cache: negative_ttl must not be negative")
+	}
+	if c.Cache.DemoteAfter < 0 {
+		return fmt.Errorf("cache: demote_after must not be negative")
+	}
+	if c.Cache.MaxPinned < 0 {
+		return fmt.Errorf("cache: max_pinned must not be negative")
+	}
+	if _, err := cache.ParseEvictionPolicy(c.Cache.EvictionPolicy); err != nil {
+		return fmt.Errorf("cache: eviction_policy: %w", err)
+	}
+	if !(c.Cache.ShadowVerifyRate >= 0 && c.Cache.ShadowVerifyRate <= 1) {
+		return fmt.Errorf("cache: shadow_verify_rate must be between 0 and 1")
+	}
+	if c.Cache.ShadowVerifyConcurrency < 0 {
+		return fmt.Errorf("cache: shadow_verify_concurrency must not be negative")
+	}
+	if c.Cache.ImbalanceFactor != 0 && !(c.Cache.ImbalanceFactor > 1) {
+		return fmt.Errorf("cache: imbalance_factor must be 0 (disabled) or greater than 1, got %v", c.Cache.ImbalanceFactor)
+	}
+	if c.Cache.ImbalanceCheckInterval < 0 {
+		return fmt.Errorf("cache: imbalance_check_interval must not be negative")
+	}
+	if c.Cache.L1TTL < 0 || c.Cache.L1TTL > MaxL1TTL {
+		return fmt.Errorf("cache: l1_ttl must be between 0 and %s, got %s", MaxL1TTL, c.Cache.L1TTL)
+	}
+	if c.Kafka.Consumer.RecentOrdersSize < 0 || c.Kafka.Consumer.RecentOrdersWindow < 0 {
+		return fmt.Errorf("kafka.consumer: recent_orders_size and recent_orders_window must not be negative")
+	}
+	if c.Kafka.Consumer.ErrorBufferSize < 0 {
+		return fmt.Errorf("kafka.consumer: error_buffer_size must not be negative")
+	}
+	if _, err := codec.ByName(c.Kafka.Consumer.Format); err != nil {
+		return fmt.Errorf("kafka.consumer: %w", err)
+	}
+	if _, err := logging.ParseLevel(c.Kafka.Consumer.StatsLogLevel); err != nil {
+		return fmt.Errorf("kafka.consumer: stats_log_level: %w", err)
+	}
+	if c.Kafka.Consumer.MaxAttempts < 0 {
+		return fmt.Errorf("kafka.consumer: max_attempts must not be negative")
+	}
+	if c.Kafka.Consumer.MaxAttempts > 0 && c.Kafka.DLQTopic == "" {
+		return fmt.Errorf("kafka: dlq_topic is required when consumer.max_attempts is set")
+	}
+	if l := c.Kafka.Consumer.CustomerLimit; l.MaxPerMinute < 0 || l.Size < 0 {
+		return fmt.Errorf("kafka.consumer.customer_limit: max_per_minute and size must not be negative")
+	}
+	switch c.Kafka.Consumer.CustomerLimit.Policy {
+	case "", CustomerLimitPolicyFlag, CustomerLimitPolicyDLQ:
+	default:
+		return fmt.Errorf("kafka.consumer.customer_limit: invalid policy %q: must be %q or %q",
+			c.Kafka.Consumer.CustomerLimit.Policy, CustomerLimitPolicyFlag, CustomerLimitPolicyDLQ)
+	}
+	if c.Kafka.Consumer.UsesDLQ() && c.Kafka.DLQTopic == "" {
+		return fmt.Errorf("kafka: dlq_topic is required when consumer.customer_limit.policy is dlq")
+	}
+	if s := c.Kafka.Consumer.IngestStats; s.Size < 0 || s.FlushInterval < 0 || s.Threshold < 0 || s.MinMessages < 0 {
+		return fmt.Errorf("kafka.consumer.ingest_stats: size, flush_interval, threshold and min_messages must not be negative")
+	}
+	if s := c.Kafka.Consumer.IngestStats; s.Threshold > 0 && s.Threshold < 1 {
+		return fmt.Errorf("kafka.consumer.ingest_stats: threshold must be at least 1, got %g", s.Threshold)
+	}
+	if err := c.Kafka.Consumer.validateReadyLag(); err != nil {
+		return err
+	}
+	if t := c.Kafka.Topics; t.Partitions < 0 || t.ReplicationFactor < 0 || t.MinPartitions < 0 {
+		return fmt.Errorf("kafka.topics: partitions, replication_factor and min_partitions must not be negative")
+	}
+	if spec := c.Kafka.Topics.ToTopicSpec(); c.Kafka.EnsureTopics && spec.Partitions < spec.MinPartitions {
+		return fmt.Errorf("kafka.topics: partitions (%d) must not be less than min_partitions (%d)", spec.Partitions, spec.MinPartitions)
+	}
+	if c.Kafka.Replay.CheckpointEvery < 0 || c.Kafka.Replay.CheckpointInterval < 0 {
+		return fmt.Errorf("kafka.replay: checkpoint_every and checkpoint_interval must not be negative")
+	}
+	if l := c.Kafka.Consumer.Latency; l.SLO < 0 || l.Window < 0 || l.WindowSize < 0 {
+		return fmt.Errorf("kafka.consumer.latency: slo, window and window_size must not be negative")
+	}
+	if a := c.Kafka.Consumer.OrderAck; a.Attempts < 0 || a.AttemptTimeout < 0 {
+		return fmt.Errorf("kafka.consumer.order_ack: attempts and attempt_timeout must not be negative")
+	}
+	if c.Kafka.Consumer.OrderAck.Enabled && c.Kafka.Topics.OrderAck == "" {
+		return fmt.Errorf("kafka: topics.order_ack is required when consumer.order_ack is enabled")
+	}
+	switch c.Database.StatementCacheMode {
+	case "", postgres.StatementCacheModePrepare, postgres.StatementCacheModeDescribe:
+	default:
+		return fmt.Errorf("database: invalid statement_cache_mode %q: must be %q or %q", c.Database.StatementCacheMode,
+			postgres.StatementCacheModePrepare, postgres.StatementCacheModeDescribe)
+	}
+	if c.Database.MaxConnections < 0 || c.Database.ConnectAttempts < 0 || c.Database.StatementTimeout < 0 ||
+		c.Database.QueryTimeout < 0 || c.Database.ServerStatementTimeout < 0 {
+		return fmt.Errorf("database: max_connections, connect_attempts, statement_timeout, query_timeout and server_statement_timeout must not be negative")
+	}
+	if c.Database.Replica.MaxConnections < 0 || c.Database.Replica.HealthInterval < 0 {
+		return fmt.Errorf("database.replica: max_connections and health_interval must not be negative")
+	}
+	if c.Database.Retention < 0 || c.Database.Archive.Interval < 0 || c.Database.Archive.BatchSize < 0 {
+		return fmt.Errorf("database: retention, archive.interval and archive.batch_size must not be negative")
+	}
+	if c.Database.Retention > 0 && c.Database.Archive.Dir == "" && !c.Database.Archive.DryRun {
+		return fmt.Errorf("database.archive: dir is required when retention is set (or enable dry_run)")
+	}
+	if c.Database.QueryTimeout > 0 && c.Database.ServerStatementTimeout > 0 && c.Database.ServerStatementTimeout < c.Database.QueryTimeout {
+		return fmt.Errorf("database: server_statement_timeout (%s) must not be less than query_timeout (%s)",
+			c.Database.ServerStatementTimeout, c.Database.QueryTimeout)
+	}
+	for _, role := range c.Admin.RoleKeys {
+		if role != RoleFull && role != RoleSupport {
+			return fmt.Errorf("admin.role_keys: invalid role %q: must be %q or %q", role, RoleFull, RoleSupport)
+		}
+	}
+	switch c.Validation.FutureDate.Mode {
+	case "", FutureDateReject, FutureDateFlag:
+	default:
+		return fmt.Errorf("validation.future_date: invalid mode %q: must be %q or %q", c.Validation.FutureDate.Mode, FutureDateReject, FutureDateFlag)
+	}
+	if c.Validation.FutureDate.MaxSkew < 0 || c.Validation.FutureDate.ClockWarnSkew < 0 {
+		return fmt.Errorf("validation.future_date: max_skew and clock_warn_skew must not be negative")
+	}
+	if _, err := validation.ParseTotalPriceMode(c.Validation.TotalPrice.Mode); err != nil {
+		return fmt.Errorf("validation.total_price: %w", err)
+	}
+	if _, _, err := c.Validation.PostalCodes.Compile(); err != nil {
+		return err
+	}
+	if _, err := validation.ParseCurrencyMode(c.Validation.Currency.Mode); err != nil {
+		return fmt.Errorf("validation.currency: %w", err)
+	}
+	if _, _, err := c.Validation.TrackNumber.Compile(); err != nil {
+		return err
+	}
+	if _, err := c.Admin.Stats.Rates(); err != nil {
+		return err
+	}
+	if _, err := c.Validation.Rules.Compile(); err != nil {
+		return err
+	}
+	switch c.Pipeline.Mode {
+	case "", PipelineModeSync:
+	case PipelineModeBatched:
+		if c.Pipeline.BatchSize <= 0 || c.Pipeline.FlushInterval <= 0 || c.Pipeline.RetryDelay <= 0 {
+			return fmt.Errorf("pipeline: batched mode requires positive batch_size, flush_interval and retry_delay")
+		}
+	default:
+		return fmt.Errorf("pipeline: invalid mode %q: must be %q or %q", c.Pipeline.Mode, PipelineModeSync, PipelineModeBatched)
+	}
+	if _, err := orders.ParseDecodeMode(c.Pipeline.Decode); err != nil {
+		return fmt.Errorf("pipeline.decode: %w", err)
+	}
+	switch c.Pipeline.CacheOnIngest {
+	case "", CacheOnIngestAlways, CacheOnIngestRecent, CacheOnIngestNever:
+	default:
+		return fmt.Errorf("pipeline: invalid cache_on_ingest %q: must be %q, %q or %q", c.Pipeline.CacheOnIngest,
+			CacheOnIngestAlways, CacheOnIngestRecent, CacheOnIngestNever)
+	}
+	if c.Pipeline.CacheRecentWindow < 0 {
+		return fmt.Errorf("pipeline: cache_recent_window must not be negative")
+	}
+	if gap := c.Pipeline.StartupGapCheck; gap.Sample < 0 || gap.Timeout < 0 {
+		return fmt.Errorf("pipeline.startup_gap_check: sample and timeout must not be negative")
+	}
+	if err := c.Pipeline.validatePriority(); err != nil {
+		return err
+	}
+	if err := c.Webhooks.validate(c.TenantIDs()); err != nil {
+		return err
+	}
+	return c.validateTenants()
+}
+
+// validateTenants проверяет, что идентификаторы, топики и ключи API арендаторов корректны и не повторяются.
+func (c *Config) validateTenants() error {
+	ids, topics, keys := make(map[string]bool), make(map[string]bool), make(map[string]bool)
+	for i, t := range c.Tenants {
+		if err := tenant.Validate(t.ID); err != nil {
+			return fmt.Errorf("tenants[%d]: %w", i, err)
+		}
+		if ids[t.ID] {
+			return fmt.Errorf("tenants[%d]: duplicate id %q", i, t.ID)
+		}
+		if t.Topic == "" {
+			return fmt.Errorf("tenants[%d]: topic is required", i)
+		}
+		if topics[t.Topic] {
+			return fmt.Errorf("tenants[%d]: topic %q is already used by another tenant", i, t.Topic)
+		}
+		for _, k := range t.APIKeys {
+			if k == "" {
+				return fmt.Errorf("tenants[%d]: api_keys must not be empty", i)
+			}
+			if keys[k] {
+				return fmt.Errorf("tenants[%d]: api key is already used by another tenant", i)
+			}
+			if k == c.Admin.APIKey {
+				return fmt.Errorf("tenants[%d]: api key must differ from admin.api_key", i)
+			}
+			keys[k] = true
+		}
+		ids[t.ID], topics[t.Topic] = true, true
+	}
+	return nil
+}
+
+// redactedValue подставляется вместо секретов при выводе конфигурации.
+const redactedValue = "***"
+
+// Redacted возвращает копию конфигурации, в которой секреты (поля с тегом secret:"true": пароли, API-ключи)
+// заменены на "***". Используйте её везде, где конфигурация попадает в логи или ответы API.
+func (c *Config) Redacted() Config {
+	out := *c
+	out.Kafka.Brokers = append([]string(nil), c.Kafka.Brokers...)
+	out.Test.Kafka.Brokers = append([]string(nil), c.Test.Kafka.Brokers...)
+	out.Database.Password = redactSecret(c.Database.Password)
+	out.Database.Replica.Password = redactSecret(c.Database.Replica.Password)
+	out.Database.Encryption.Keys = redactSecret(c.Database.Encryption.Keys)
+	out.Admin.APIKey = redactSecret(c.Admin.APIKey)
+	out.Server.Cursor.Secret = redactSecret(c.Server.Cursor.Secret)
+	out.Admin.RoleKeys = redactKeys(c.Admin.RoleKeys)
+	out.Webhooks.Endpoints = append([]WebhookEndpointConfig(nil), c.Webhooks.Endpoints...)
+	for i := range out.Webhooks.Endpoints {
+		out.Webhooks.Endpoints[i].Secret = redactSecret(c.Webhooks.Endpoints[i].Secret)
+	}
+	out.Tenants = append([]TenantConfig(nil), c.Tenants...)
+	for i := range out.Tenants {
+		out.Tenants[i].APIKeys = make([]string, len(c.Tenants[i].APIKeys))
+		for j := range out.Tenants[i].APIKeys {
+			out.Tenants[i].APIKeys[j] = redactedValue
+		}
+	}
+	return out
+}
+
+// redactKeys заменяет ключи карты ключ → роль на "***1", "***2", ... в порядке ключей, сохраняя роли.
+func redactKeys(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make(map[string]string, len(m))
+	for i, k := range keys {
+		out[redactedValue+strconv.Itoa(i+1)] = m[k]
+	}
+	return out
+}
+
+// redactSecret скрывает непустое значение секрета; пустое значение остаётся пустым, чтобы было видно, что секрет не задан.
+func redactSecret(v string) string {
+	if v == "" {
+		return ""
+	}
+	return redactedValue
+}
+
 // ToPostgresConfig преобразует DatabaseConfig в postgres.DBConfig.
 func (c *DatabaseConfig) ToPostgresConfig() postgres.DBConfig {
 	return postgres.DBConfig{
@@ -108,16 +1508,66 @@ func (c *DatabaseConfig) ToPostgresConfig() postgres.DBConfig {
 		Password: c.Password,
 		DBName:   c.DBName,
 		SSLMode:  c.SSLMode,
+
+		MaxConns:           int32(c.MaxConnections),
+		StatementCacheMode: c.StatementCacheMode,
+		StatementTimeout:   c.StatementTimeout,
+
+		SessionStatementTimeout: c.ServerStatementTimeout,
 	}
 }
 
+// ReplicaPostgresConfig преобразует настройки реплики в postgres.DBConfig, дополняя незаданные поля настройками
+// основной базы. Режим кэша выражений и statement_timeout соединений у реплики те же, что у основной базы.
+func (c *DatabaseConfig) ReplicaPostgresConfig() postgres.DBConfig {
+	cfg := c.ToPostgresConfig()
+	cfg.StatementTimeout = 0
+	r := c.Replica
+	cfg.Host = r.Host
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&cfg.Port, r.Port},
+		{&cfg.User, r.User},
+		{&cfg.Password, r.Password},
+		{&cfg.DBName, r.DBName},
+		{&cfg.SSLMode, r.SSLMode},
+	} {
+		if f.src != "" {
+			*f.dst = f.src
+		}
+	}
+	if r.MaxConnections > 0 {
+		cfg.MaxConns = int32(r.MaxConnections)
+	}
+	return cfg
+}
+
 // ToKafkaConfig NewKafkaReader создает новый Kafka Reader с использованием конфигурации из KafkaConfig.
 func (c *KafkaConfig) ToKafkaConfig() kafka.Config {
 	return kafka.Config{
 		Brokers: c.Brokers,
 		Topic:   c.Topic,
 		GroupID: c.GroupID,
-		Reader:  kafka.ReaderConfig(c.Reader),
-		Writer:  kafka.WriterConfig(c.Writer),
+		Reader: kafka.ReaderConfig{
+			MinBytes:         c.Reader.MinBytes,
+			MaxBytes:         c.Reader.MaxBytes,
+			ReadBatchTimeout: c.Reader.ReadBatchTimeout,
+			CommitInterval:   c.Reader.CommitInterval,
+			StartOffset:      c.Consumer.StartOffset,
+		},
+		Writer: kafka.WriterConfig(c.Writer),
+	}
+}
+
+// ToBreakerConfig преобразует конфигурацию выключателя в breaker.Config.
+func (b BreakerConfig) ToBreakerConfig() breaker.Config {
+	return breaker.Config{
+		WindowSize:       b.WindowSize,
+		MinRequests:      b.MinRequests,
+		FailureRate:      b.FailureRate,
+		Cooldown:         b.Cooldown,
+		HalfOpenRequests: b.HalfOpenRequests,
 	}
 }
@@ -0,0 +1,800 @@
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/cache"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/internal/validation"
+	"l0_test_self/pkg/client/kafka"
+	"l0_test_self/pkg/client/postgres"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRedactedHidesSecrets(t *testing.T) {
+	cfg := &Config{
+		Database: DatabaseConfig{Host: "db", User: "service_u", Password: "s3cr3t"},
+		Kafka:    KafkaConfig{Brokers: []string{"localhost:9092"}},
+		Admin:    AdminConfig{APIKey: "admin-key"},
+	}
+
+	red := cfg.Redacted()
+
+	assert.Equal(t, "***", red.Database.Password)
+	assert.Equal(t, "***", red.Admin.APIKey)
+	assert.Equal(t, "db", red.Database.Host)
+	assert.Equal(t, "service_u", red.Database.User)
+
+	dump := fmt.Sprintf("%+v", red)
+	assert.NotContains(t, dump, "s3cr3t")
+	assert.NotContains(t, dump, "admin-key")
+
+	// Исходная конфигурация не изменяется
+	assert.Equal(t, "s3cr3t", cfg.Database.Password)
+	red.Kafka.Brokers[0] = "changed"
+	assert.Equal(t, "localhost:9092", cfg.Kafka.Brokers[0])
+}
+
+func TestRedactedHidesEncryptionKeys(t *testing.T) {
+	cfg := &Config{Database: DatabaseConfig{Encryption: EncryptionConfig{Enabled: true, Keys: "k1:c2VjcmV0"}}}
+	red := cfg.Redacted()
+	assert.Equal(t, "***", red.Database.Encryption.Keys)
+	assert.NotContains(t, fmt.Sprintf("%+v", red), "c2VjcmV0")
+}
+
+func TestCursorSigningSecret(t *testing.T) {
+	assert.Nil(t, CursorConfig{}.SigningSecret())
+	assert.Equal(t, []byte("from-file"), CursorConfig{Secret: "from-file"}.SigningSecret())
+
+	t.Setenv(CursorSecretEnv, "from-env")
+	cfg := loadConfig(t, "server:\n  cursor:\n    secret: from-file\n")
+	assert.Equal(t, []byte("from-env"), cfg.Server.Cursor.SigningSecret())
+
+	red := (&Config{Server: ServerConfig{Cursor: CursorConfig{Secret: "from-file"}}}).Redacted()
+	assert.Equal(t, "***", red.Server.Cursor.Secret)
+}
+
+func TestEncryptionKeyring(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+
+	kr, err := EncryptionConfig{Keys: "k1:" + key, ActiveKey: "k1"}.Keyring()
+	require.NoError(t, err)
+	assert.Nil(t, kr, "disabled encryption has no keyring")
+
+	_, err = EncryptionConfig{Enabled: true, ActiveKey: "k1"}.Keyring()
+	assert.ErrorContains(t, err, "no keys are set")
+	_, err = EncryptionConfig{Enabled: true, Keys: "k1:" + key, ActiveKey: "k2"}.Keyring()
+	assert.ErrorContains(t, err, "active encryption key")
+	_, err = EncryptionConfig{Enabled: true, Keys: "k1:c2hvcnQ=", ActiveKey: "k1"}.Keyring()
+	assert.ErrorContains(t, err, "must be 32 bytes")
+
+	// Переменные окружения заменяют значения из файла
+	t.Setenv(EncryptionKeysEnv, "k1:"+key+",k2:"+key)
+	t.Setenv(EncryptionActiveKeyEnv, "k2")
+	cfg := loadConfig(t, "database:\n  encryption:\n    enabled: true\n    active_key: k1\n")
+	kr, err = cfg.Database.Encryption.Keyring()
+	require.NoError(t, err)
+	assert.Equal(t, "k2", kr.ActiveKeyID())
+	assert.Equal(t, []string{"k1", "k2"}, kr.KeyIDs())
+}
+
+// loadConfig - загружает конфигурацию из YAML data через временный файл
+func loadConfig(t *testing.T, data string) *Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	return cfg
+}
+
+// writeSecret - записывает секрет во временный файл и возвращает путь к нему
+func writeSecret(t *testing.T, value string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(path, []byte(value), 0o600))
+	return path
+}
+
+func TestLoadSecretEnvPrecedence(t *testing.T) {
+	const yamlData = "database:\n  password: from-yaml\nadmin:\n  api_key: from-yaml\n"
+
+	cfg := loadConfig(t, yamlData)
+	assert.Equal(t, "from-yaml", cfg.Database.Password)
+
+	t.Setenv(DatabasePasswordEnv, "from-env")
+	t.Setenv(AdminAPIKeyEnv, "from-env")
+	cfg = loadConfig(t, yamlData)
+	assert.Equal(t, "from-env", cfg.Database.Password)
+	assert.Equal(t, "from-env", cfg.Admin.APIKey)
+
+	// Файл важнее переменной без суффикса; завершающий перевод строки отбрасывается
+	t.Setenv(DatabasePasswordEnv+SecretFileSuffix, writeSecret(t, "from-file\n"))
+	t.Setenv(AdminAPIKeyEnv+SecretFileSuffix, writeSecret(t, "key with spaces \r\n"))
+	cfg = loadConfig(t, yamlData)
+	assert.Equal(t, "from-file", cfg.Database.Password)
+	assert.Equal(t, "key with spaces ", cfg.Admin.APIKey)
+
+	t.Setenv(CursorSecretEnv+SecretFileSuffix, writeSecret(t, "cursor"))
+	assert.Equal(t, []byte("cursor"), loadConfig(t, yamlData).Server.Cursor.SigningSecret())
+}
+
+func TestLoadSecretFileErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("database:\n  password: from-yaml\n"), 0o600))
+
+	t.Setenv(DatabasePasswordEnv+SecretFileSuffix, filepath.Join(t.TempDir(), "missing"))
+	_, err := Load(path)
+	assert.ErrorContains(t, err, "DATABASE_PASSWORD_FILE")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Каталог вместо файла не читается
+	t.Setenv(DatabasePasswordEnv+SecretFileSuffix, t.TempDir())
+	_, err = Load(path)
+	assert.ErrorContains(t, err, "DATABASE_PASSWORD_FILE")
+}
+
+// secretValues - заполняет каждое поле v (и вложенных структур и срезов) с тегом secret:"true" уникальным непустым
+// значением и возвращает эти значения
+func secretValues(t *testing.T, v reflect.Value, path string) []string {
+	t.Helper()
+	var values []string
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fv, fpath := v.Field(i), path+"."+field.Name
+			if field.Tag.Get("secret") != "true" {
+				values = append(values, secretValues(t, fv, fpath)...)
+				continue
+			}
+			value := "secret-value" + fpath
+			switch fv.Kind() {
+			case reflect.String:
+				fv.SetString(value)
+			case reflect.Slice:
+				fv.Set(reflect.ValueOf([]string{value}))
+			case reflect.Map:
+				fv.Set(reflect.ValueOf(map[string]string{value: RoleFull}))
+			default:
+				t.Fatalf("%s: unsupported secret field kind %s", fpath, fv.Kind())
+			}
+			values = append(values, value)
+		}
+	case reflect.Slice:
+		// В пустой срез структур добавляется элемент, чтобы проверить и его секреты
+		if v.Type().Elem().Kind() == reflect.Struct && v.Len() == 0 {
+			v.Set(reflect.Append(v, reflect.New(v.Type().Elem()).Elem()))
+		}
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, secretValues(t, v.Index(i), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return values
+}
+
+func TestRedactedMasksEverySecretField(t *testing.T) {
+	var cfg Config
+	secrets := secretValues(t, reflect.ValueOf(&cfg).Elem(), "Config")
+	require.GreaterOrEqual(t, len(secrets), 6, "secret fields are tagged")
+
+	dump := fmt.Sprintf("%+v", cfg.Redacted())
+	for _, secret := range secrets {
+		assert.NotContains(t, dump, secret)
+	}
+}
+
+func TestRedactedKeepsEmptySecretsEmpty(t *testing.T) {
+	cfg := &Config{}
+	red := cfg.Redacted()
+	assert.Empty(t, red.Database.Password)
+	assert.Empty(t, red.Admin.APIKey)
+}
+
+func TestValidateStartOffset(t *testing.T) {
+	for _, v := range []string{"", "earliest", "latest"} {
+		cfg := &Config{Kafka: KafkaConfig{Consumer: ConsumerConfig{StartOffset: v}}}
+		assert.NoError(t, cfg.Validate(), v)
+	}
+
+	cfg := &Config{Kafka: KafkaConfig{Consumer: ConsumerConfig{StartOffset: "beginning"}}}
+	assert.ErrorContains(t, cfg.Validate(), "start_offset")
+}
+
+func TestValidatePipelineCacheOnIngest(t *testing.T) {
+	for _, v := range []string{"", CacheOnIngestAlways, CacheOnIngestRecent, CacheOnIngestNever} {
+		cfg := &Config{Pipeline: PipelineConfig{CacheOnIngest: v}}
+		assert.NoError(t, cfg.Validate(), v)
+	}
+	cfg := &Config{Pipeline: PipelineConfig{CacheOnIngest: "sometimes"}}
+	assert.ErrorContains(t, cfg.Validate(), "cache_on_ingest")
+	cfg = &Config{Pipeline: PipelineConfig{CacheOnIngest: CacheOnIngestRecent, CacheRecentWindow: -time.Hour}}
+	assert.ErrorContains(t, cfg.Validate(), "cache_recent_window")
+
+	assert.Equal(t, DefaultCacheRecentWindow, PipelineConfig{}.RecentWindow())
+	assert.Equal(t, time.Hour, PipelineConfig{CacheRecentWindow: time.Hour}.RecentWindow())
+}
+
+func TestValidatePipelinePriority(t *testing.T) {
+	batched := PipelineConfig{Mode: PipelineModeBatched, BatchSize: 10, FlushInterval: time.Second, RetryDelay: time.Second}
+	p := batched
+	p.Priority = PriorityConfig{DeliveryServices: []string{"express"}, Burst: 2}
+	assert.NoError(t, (&Config{Pipeline: p}).Validate())
+
+	p.Priority.Burst = -1
+	assert.ErrorContains(t, (&Config{Pipeline: p}).Validate(), "burst")
+	p.Priority = PriorityConfig{DeliveryServices: []string{"express", " "}}
+	assert.ErrorContains(t, (&Config{Pipeline: p}).Validate(), "empty delivery service")
+	sync := PipelineConfig{Priority: PriorityConfig{DeliveryServices: []string{"express"}}}
+	assert.ErrorContains(t, (&Config{Pipeline: sync}).Validate(), "require mode")
+
+	assert.False(t, PriorityConfig{}.Enabled())
+	assert.Equal(t, DefaultPriorityBurst, PriorityConfig{}.BurstSize())
+	assert.Equal(t, 7, PriorityConfig{Burst: 7}.BurstSize())
+}
+
+func TestStartupGapCheckConfig(t *testing.T) {
+	cfg := &Config{Pipeline: PipelineConfig{StartupGapCheck: StartupGapCheckConfig{Enabled: true, Sample: -1}}}
+	assert.ErrorContains(t, cfg.Validate(), "startup_gap_check")
+
+	assert.Equal(t, DefaultGapCheckSample, StartupGapCheckConfig{}.SampleSize())
+	assert.Equal(t, 20, StartupGapCheckConfig{Sample: 20}.SampleSize())
+	assert.Equal(t, DefaultGapCheckTimeout, StartupGapCheckConfig{}.CheckTimeout())
+}
+
+func TestValidateConsumerFormat(t *testing.T) {
+	for _, v := range []string{"", "json", "protobuf"} {
+		cfg := &Config{Kafka: KafkaConfig{Consumer: ConsumerConfig{Format: v}}}
+		assert.NoError(t, cfg.Validate(), v)
+	}
+
+	cfg := &Config{Kafka: KafkaConfig{Consumer: ConsumerConfig{Format: "avro"}}}
+	assert.ErrorContains(t, cfg.Validate(), "message format")
+}
+
+func TestValidateStatsLogLevel(t *testing.T) {
+	for _, v := range []string{"", "info", "debug"} {
+		cfg := &Config{Kafka: KafkaConfig{Consumer: ConsumerConfig{StatsLogLevel: v}}}
+		assert.NoError(t, cfg.Validate(), v)
+	}
+
+	cfg := &Config{Kafka: KafkaConfig{Consumer: ConsumerConfig{StatsLogLevel: "verbose"}}}
+	assert.ErrorContains(t, cfg.Validate(), "stats_log_level")
+}
+
+func TestValidateMaxAttempts(t *testing.T) {
+	cfg := &Config{Kafka: KafkaConfig{DLQTopic: "orders.dlq", Consumer: ConsumerConfig{MaxAttempts: 5}}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Kafka.DLQTopic = ""
+	assert.ErrorContains(t, cfg.Validate(), "dlq_topic")
+
+	cfg.Kafka.Consumer.MaxAttempts = -1
+	assert.ErrorContains(t, cfg.Validate(), "max_attempts")
+}
+
+func TestValidateCacheNegativeTTL(t *testing.T) {
+	cfg := &Config{Cache: CacheConfig{NegativeTTL: 5 * time.Second}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Cache.NegativeTTL = -time.Second
+	assert.ErrorContains(t, cfg.Validate(), "negative_ttl")
+}
+
+func TestValidateCacheMaxPinned(t *testing.T) {
+	cfg := &Config{Cache: CacheConfig{MaxPinned: 10}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Cache.MaxPinned = -1
+	assert.ErrorContains(t, cfg.Validate(), "max_pinned")
+}
+
+func TestCacheEvictionPolicy(t *testing.T) {
+	cfg := &Config{Cache: CacheConfig{ShardCount: 2, MaxItems: 10, EvictionPolicy: "fifo"}}
+	require.NoError(t, cfg.Validate())
+	c, err := cache.NewWithOptions(cfg.Cache.Options()...)
+	require.NoError(t, err)
+	defer c.Close()
+	assert.Equal(t, cache.EvictFIFO, c.EvictionPolicy())
+	assert.Equal(t, 2, c.ShardCount())
+
+	// Без max_items политика не передаётся, и кэш создаётся без ошибки
+	cfg.Cache.MaxItems = 0
+	c, err = cache.NewWithOptions(cfg.Cache.Options()...)
+	require.NoError(t, err)
+	c.Close()
+
+	cfg.Cache.EvictionPolicy = "random"
+	assert.ErrorContains(t, cfg.Validate(), "cache: eviction_policy")
+}
+
+func TestCacheDemoteAfter(t *testing.T) {
+	cfg := &Config{Cache: CacheConfig{ShardCount: 2, DemoteAfter: time.Hour}}
+	require.NoError(t, cfg.Validate())
+	c, err := cache.NewWithOptions(cfg.Cache.Options()...)
+	require.NoError(t, err)
+	defer c.Close()
+	assert.Equal(t, time.Hour, c.DemoteAfter())
+
+	cfg.Cache.DemoteAfter = -time.Minute
+	assert.ErrorContains(t, cfg.Validate(), "demote_after")
+}
+
+func TestCacheEnabled(t *testing.T) {
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte("cache:\n  shard_count: 2\n"), &cfg))
+	assert.True(t, cfg.Cache.IsEnabled(), "the cache is enabled unless configured otherwise")
+	require.NoError(t, yaml.Unmarshal([]byte("cache:\n  enabled: false\n"), &cfg))
+	assert.False(t, cfg.Cache.IsEnabled())
+}
+
+func TestCacheL1(t *testing.T) {
+	cfg := &Config{Cache: CacheConfig{ShardCount: 2, L1TTL: 5 * time.Second}}
+	require.NoError(t, cfg.Validate())
+	c, err := cache.NewWithOptions(cfg.Cache.Options()...)
+	require.NoError(t, err)
+	assert.Zero(t, c.L1TTL(), "l1_ttl alone does not enable L1")
+	c.Close()
+
+	cfg.Cache.L1Enabled = true
+	c, err = cache.NewWithOptions(cfg.Cache.Options()...)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, c.L1TTL())
+	c.Close()
+	assert.Equal(t, DefaultL1TTL, CacheConfig{L1Enabled: true}.EffectiveL1TTL())
+
+	for _, ttl := range []time.Duration{-time.Second, 2 * time.Minute} {
+		cfg.Cache.L1TTL = ttl
+		assert.ErrorContains(t, cfg.Validate(), "cache: l1_ttl", ttl)
+	}
+}
+
+func TestValidateServerTLS(t *testing.T) {
+	cfg := &Config{}
+	require.NoError(t, cfg.Validate(), "TLS is optional")
+	assert.False(t, cfg.Server.TLS.Enabled())
+
+	cfg.Server.TLS = TLSConfig{CertFile: "server.crt", KeyFile: "server.key", MinVersion: "1.3", ClientCA: "clients.pem"}
+	require.NoError(t, cfg.Validate())
+	assert.True(t, cfg.Server.TLS.Enabled())
+	version, err := cfg.Server.TLS.Version()
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), version)
+
+	cfg.Server.TLS.MinVersion = "1.0"
+	assert.ErrorContains(t, cfg.Validate(), "server.tls: invalid min_version")
+	cfg.Server.TLS = TLSConfig{CertFile: "server.crt"}
+	assert.ErrorContains(t, cfg.Validate(), "cert_file and key_file")
+	cfg.Server.TLS = TLSConfig{ClientCA: "clients.pem"}
+	assert.ErrorContains(t, cfg.Validate(), "cert_file and key_file")
+}
+
+func TestValidateCacheShadowVerify(t *testing.T) {
+	cfg := &Config{Cache: CacheConfig{ShadowVerifyRate: 0.01, ShadowVerifyConcurrency: 2}}
+	assert.NoError(t, cfg.Validate())
+
+	for _, rate := range []float64{-0.1, 1.5, math.NaN()} {
+		cfg.Cache.ShadowVerifyRate = rate
+		assert.ErrorContains(t, cfg.Validate(), "shadow_verify_rate", rate)
+	}
+	cfg.Cache.ShadowVerifyRate = 1
+	cfg.Cache.ShadowVerifyConcurrency = -1
+	assert.ErrorContains(t, cfg.Validate(), "shadow_verify_concurrency")
+}
+
+func TestStatsRates(t *testing.T) {
+	rates, err := StatsConfig{}.Rates()
+	require.NoError(t, err)
+	assert.Nil(t, rates)
+
+	rates, err = StatsConfig{USDRates: map[string]float64{"eur": 1.08, "RUB": 0.011}}.Rates()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"USD": 1, "EUR": 1.08, "RUB": 0.011}, rates)
+
+	cfg := &Config{Admin: AdminConfig{Stats: StatsConfig{USDRates: map[string]float64{"XYZ": 2}}}}
+	assert.ErrorContains(t, cfg.Validate(), "unknown currency")
+	cfg.Admin.Stats.USDRates = map[string]float64{"EUR": 0}
+	assert.ErrorContains(t, cfg.Validate(), "must be positive")
+}
+
+func TestValidateCacheImbalance(t *testing.T) {
+	for _, factor := range []float64{0, 1.5, 4} {
+		cfg := &Config{Cache: CacheConfig{ImbalanceFactor: factor}}
+		assert.NoError(t, cfg.Validate(), factor)
+	}
+	for _, factor := range []float64{-1, 0.5, 1} {
+		cfg := &Config{Cache: CacheConfig{ImbalanceFactor: factor}}
+		assert.ErrorContains(t, cfg.Validate(), "imbalance_factor", factor)
+	}
+
+	cfg := &Config{Cache: CacheConfig{ImbalanceCheckInterval: -time.Second}}
+	assert.ErrorContains(t, cfg.Validate(), "imbalance_check_interval")
+	assert.Equal(t, DefaultImbalanceCheckInterval, CacheConfig{}.CheckInterval())
+	assert.Equal(t, 10*time.Second, CacheConfig{ImbalanceCheckInterval: 10 * time.Second}.CheckInterval())
+}
+
+func TestValidateGoroutineLimit(t *testing.T) {
+	cfg := &Config{Server: ServerConfig{GoroutineLimit: 1000}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Server.GoroutineLimit = -1
+	assert.ErrorContains(t, cfg.Validate(), "goroutine_limit")
+}
+
+func TestValidateReplayCheckpoints(t *testing.T) {
+	cfg := &Config{Kafka: KafkaConfig{Replay: ReplayConfig{CheckpointEvery: 100, CheckpointInterval: time.Second}}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Kafka.Replay.CheckpointInterval = -time.Second
+	assert.ErrorContains(t, cfg.Validate(), "kafka.replay")
+}
+
+func TestToKafkaConfigStartOffset(t *testing.T) {
+	cfg := KafkaConfig{Consumer: ConsumerConfig{StartOffset: "earliest"}}
+	assert.Equal(t, "earliest", cfg.ToKafkaConfig().Reader.StartOffset)
+}
+
+func TestLoadRepoConfig(t *testing.T) {
+	cfg, err := Load("../../config.yaml")
+	require.NoError(t, err)
+	assert.NotEmpty(t, cfg.Kafka.Topic)
+}
+
+func TestValidateStatementCacheMode(t *testing.T) {
+	for _, v := range []string{"", "prepare", "describe"} {
+		cfg := &Config{Database: DatabaseConfig{StatementCacheMode: v}}
+		assert.NoError(t, cfg.Validate(), v)
+	}
+
+	cfg := &Config{Database: DatabaseConfig{StatementCacheMode: "exec"}}
+	assert.ErrorContains(t, cfg.Validate(), "statement_cache_mode")
+}
+
+func TestValidateDatabaseTimeouts(t *testing.T) {
+	cfg := &Config{Database: DatabaseConfig{QueryTimeout: 5 * time.Second, ServerStatementTimeout: time.Minute}}
+	assert.NoError(t, cfg.Validate())
+	cfg.Database.ServerStatementTimeout = 0
+	assert.NoError(t, cfg.Validate(), "the server-side backstop is optional")
+
+	cfg.Database.QueryTimeout = -time.Second
+	assert.ErrorContains(t, cfg.Validate(), "must not be negative")
+
+	// Страховка на сервере, срабатывающая раньше ограничения клиента, подменила бы его
+	cfg.Database = DatabaseConfig{QueryTimeout: 5 * time.Second, ServerStatementTimeout: time.Second}
+	assert.ErrorContains(t, cfg.Validate(), "server_statement_timeout (1s) must not be less than query_timeout (5s)")
+}
+
+func TestValidateDatabaseRetention(t *testing.T) {
+	cfg := &Config{Database: DatabaseConfig{Retention: 365 * 24 * time.Hour, Archive: ArchiveConfig{Dir: "archive"}}}
+	assert.NoError(t, cfg.Validate())
+	cfg.Database.Archive = ArchiveConfig{DryRun: true}
+	assert.NoError(t, cfg.Validate(), "a dry run writes no files")
+	cfg.Database.Archive = ArchiveConfig{}
+	assert.ErrorContains(t, cfg.Validate(), "dir is required")
+	cfg.Database = DatabaseConfig{Retention: -time.Hour}
+	assert.ErrorContains(t, cfg.Validate(), "retention")
+
+	assert.Equal(t, DefaultArchiveInterval, ArchiveConfig{}.RunInterval())
+	assert.Equal(t, DefaultArchiveBatchSize, ArchiveConfig{}.Batch())
+	assert.Equal(t, 10, ArchiveConfig{BatchSize: 10}.Batch())
+}
+
+func TestReplicaPostgresConfig(t *testing.T) {
+	db := DatabaseConfig{Host: "primary", Port: "5432", User: "service_u", Password: "123", DBName: "service_db",
+		SSLMode: "disable", MaxConnections: 5, StatementTimeout: 5 * time.Second, ServerStatementTimeout: time.Minute}
+	assert.False(t, db.Replica.Enabled())
+	assert.Equal(t, DefaultReplicaHealthInterval, db.Replica.Interval())
+
+	db.Replica = ReplicaConfig{Host: "replica", User: "reader", MaxConnections: 10}
+	assert.True(t, db.Replica.Enabled())
+	got := db.ReplicaPostgresConfig()
+	assert.Equal(t, postgres.DBConfig{Host: "replica", Port: "5432", User: "reader", Password: "123", DBName: "service_db",
+		SSLMode: "disable", MaxConns: 10, SessionStatementTimeout: time.Minute}, got, "unset fields come from the primary")
+
+	cfg := &Config{Database: DatabaseConfig{Replica: ReplicaConfig{HealthInterval: -time.Second}}}
+	assert.ErrorContains(t, cfg.Validate(), "database.replica")
+}
+
+func TestValidateFutureDateMode(t *testing.T) {
+	for _, v := range []string{"", "reject", "flag"} {
+		cfg := &Config{Validation: ValidationConfig{FutureDate: FutureDateConfig{Mode: v}}}
+		assert.NoError(t, cfg.Validate(), v)
+	}
+
+	cfg := &Config{Validation: ValidationConfig{FutureDate: FutureDateConfig{Mode: "drop"}}}
+	assert.ErrorContains(t, cfg.Validate(), "future_date")
+	cfg = &Config{Validation: ValidationConfig{FutureDate: FutureDateConfig{MaxSkew: -time.Second}}}
+	assert.ErrorContains(t, cfg.Validate(), "max_skew")
+}
+
+func TestValidateTotalPriceMode(t *testing.T) {
+	for _, v := range []string{"", "off", "reject", "correct", "flag"} {
+		cfg := &Config{Validation: ValidationConfig{TotalPrice: TotalPriceConfig{Mode: v}}}
+		assert.NoError(t, cfg.Validate(), v)
+	}
+
+	cfg := &Config{Validation: ValidationConfig{TotalPrice: TotalPriceConfig{Mode: "fix"}}}
+	assert.ErrorContains(t, cfg.Validate(), "total_price")
+}
+
+func TestValidatePostalCodes(t *testing.T) {
+	cfg := &Config{Validation: ValidationConfig{PostalCodes: PostalCodesConfig{Mode: "flag", Formats: map[string]string{"Moscow": `\d{6}`}}}}
+	require.NoError(t, cfg.Validate())
+	table, mode, err := cfg.Validation.PostalCodes.Compile()
+	require.NoError(t, err)
+	assert.Equal(t, validation.PostalFlag, mode)
+	known, err := table.CheckPostalCode("moscow", "12345")
+	assert.True(t, known)
+	assert.Error(t, err)
+
+	for name, pc := range map[string]PostalCodesConfig{
+		"mode":      {Mode: "drop"},
+		"pattern":   {Formats: map[string]string{"Moscow": `[0-9`}},
+		"duplicate": {Formats: map[string]string{"Moscow": `\d{6}`, " moscow": `\d{6}`}},
+	} {
+		cfg := &Config{Validation: ValidationConfig{PostalCodes: pc}}
+		assert.ErrorContains(t, cfg.Validate(), "postal_codes", name)
+	}
+}
+
+func TestValidateTrackNumber(t *testing.T) {
+	cfg := &Config{Validation: ValidationConfig{TrackNumber: TrackNumberConfig{Mode: "flag", Pattern: `WB[A-Z]{12}`}}}
+	require.NoError(t, cfg.Validate())
+	pattern, mode, err := cfg.Validation.TrackNumber.Compile()
+	require.NoError(t, err)
+	assert.Equal(t, validation.TrackNumberFlag, mode)
+	assert.True(t, pattern.MatchString("WBILMTESTTRACK"))
+	assert.False(t, pattern.MatchString("XWBILMTESTTRACK"), "the pattern matches the whole track number")
+
+	for name, tn := range map[string]TrackNumberConfig{
+		"mode":    {Mode: "drop"},
+		"pattern": {Pattern: `[A-Z`},
+	} {
+		cfg := &Config{Validation: ValidationConfig{TrackNumber: tn}}
+		assert.ErrorContains(t, cfg.Validate(), "track_number", name)
+	}
+}
+
+func TestShardCountYAML(t *testing.T) {
+	var cfg CacheConfig
+	require.NoError(t, yaml.Unmarshal([]byte("shard_count: auto"), &cfg))
+	assert.Equal(t, ShardCountAuto, cfg.ShardCount)
+	assert.Equal(t, cache.AutoShardCount(), cfg.ShardCount.Resolve())
+	assert.Equal(t, "auto", cfg.ShardCount.String())
+
+	require.NoError(t, yaml.Unmarshal([]byte("shard_count: 16"), &cfg))
+	assert.Equal(t, ShardCount(16), cfg.ShardCount)
+	assert.Equal(t, 16, cfg.ShardCount.Resolve())
+
+	assert.Error(t, yaml.Unmarshal([]byte("shard_count: 0"), &cfg))
+	assert.Error(t, yaml.Unmarshal([]byte("shard_count: many"), &cfg))
+}
+
+func TestValidateRoleKeys(t *testing.T) {
+	cfg := &Config{Admin: AdminConfig{RoleKeys: map[string]string{"a": RoleFull, "b": RoleSupport}}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Admin.RoleKeys["c"] = "admin"
+	assert.ErrorContains(t, cfg.Validate(), "admin.role_keys")
+
+	red := cfg.Redacted()
+	assert.Len(t, red.Admin.RoleKeys, 3)
+	assert.NotContains(t, fmt.Sprintf("%+v", red), "map[a:")
+	assert.Equal(t, RoleFull, red.Admin.RoleKeys["***1"])
+}
+
+func TestValidateRules(t *testing.T) {
+	cfg := &Config{Validation: ValidationConfig{Rules: RulesConfig{
+		Optional: []string{"customer_id"},
+		Fields:   map[string]FieldRuleConfig{"delivery.zip": {MaxLength: 10, Pattern: `^[0-9]+$`}},
+	}}}
+	require.NoError(t, cfg.Validate())
+
+	cfg.Validation.Rules.Optional = append(cfg.Validation.Rules.Optional, "delivery.floor")
+	assert.ErrorContains(t, cfg.Validate(), `validation.rules: optional: unknown field path "delivery.floor"`)
+}
+
+func TestValidatePipelineDecode(t *testing.T) {
+	for _, v := range []string{"", "strict", "lenient"} {
+		cfg := &Config{Pipeline: PipelineConfig{Decode: v}}
+		assert.NoError(t, cfg.Validate(), v)
+	}
+
+	cfg := &Config{Pipeline: PipelineConfig{Decode: "loose"}}
+	assert.ErrorContains(t, cfg.Validate(), "pipeline.decode")
+}
+
+func TestValidateTenants(t *testing.T) {
+	valid := []TenantConfig{
+		{ID: "market-a", Topic: "orders-a", APIKeys: []string{"key-a"}},
+		{ID: "market-b", Topic: "orders-b"},
+	}
+	cfg := &Config{Tenants: valid, Admin: AdminConfig{APIKey: "admin-key"}}
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, []string{"market-a", "market-b"}, cfg.TenantIDs())
+	assert.Equal(t, map[string]string{"orders-a": "market-a", "orders-b": "market-b"}, cfg.TenantTopics())
+	assert.Equal(t, map[string]string{"key-a": "market-a"}, cfg.TenantAPIKeys())
+	assert.Equal(t, []string{"orders-a", "orders-b"}, cfg.ConsumerKafkaConfig().GroupTopics)
+
+	cases := map[string]struct {
+		tenant TenantConfig
+		want   string
+	}{
+		"missing id":     {TenantConfig{Topic: "orders-c"}, "tenant is required"},
+		"invalid id":     {TenantConfig{ID: "Market C", Topic: "orders-c"}, "invalid tenant"},
+		"duplicate id":   {TenantConfig{ID: "market-a", Topic: "orders-c"}, "duplicate id"},
+		"missing topic":  {TenantConfig{ID: "market-c"}, "topic is required"},
+		"shared topic":   {TenantConfig{ID: "market-c", Topic: "orders-b"}, "already used"},
+		"shared api key": {TenantConfig{ID: "market-c", Topic: "orders-c", APIKeys: []string{"key-a"}}, "already used"},
+		"admin api key":  {TenantConfig{ID: "market-c", Topic: "orders-c", APIKeys: []string{"admin-key"}}, "admin.api_key"},
+		"empty api key":  {TenantConfig{ID: "market-c", Topic: "orders-c", APIKeys: []string{""}}, "must not be empty"},
+	}
+	for name, tc := range cases {
+		cfg := &Config{Tenants: append(append([]TenantConfig(nil), valid...), tc.tenant), Admin: AdminConfig{APIKey: "admin-key"}}
+		assert.ErrorContains(t, cfg.Validate(), tc.want, name)
+	}
+}
+
+func TestSingleTenantDefaults(t *testing.T) {
+	cfg := &Config{Kafka: KafkaConfig{Topic: "orders"}}
+	assert.Equal(t, []string{tenant.Default}, cfg.TenantIDs())
+	assert.Equal(t, map[string]string{"orders": tenant.Default}, cfg.TenantTopics())
+	assert.Empty(t, cfg.TenantAPIKeys())
+	assert.Empty(t, cfg.ConsumerKafkaConfig().GroupTopics)
+}
+
+func TestRedactedHidesTenantAPIKeys(t *testing.T) {
+	cfg := &Config{Tenants: []TenantConfig{{ID: "market-a", Topic: "orders-a", APIKeys: []string{"tenant-secret"}}}}
+	red := cfg.Redacted()
+	assert.Equal(t, []string{"***"}, red.Tenants[0].APIKeys)
+	assert.NotContains(t, fmt.Sprintf("%+v", red), "tenant-secret")
+	assert.Equal(t, "tenant-secret", cfg.Tenants[0].APIKeys[0])
+}
+
+func TestValidateKafkaTopics(t *testing.T) {
+	cfg := &Config{Kafka: KafkaConfig{EnsureTopics: true}}
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, kafka.TopicSpec{Partitions: 1, ReplicationFactor: 1}, cfg.Kafka.Topics.ToTopicSpec(), "defaults")
+
+	cfg.Kafka.Topics = TopicsConfig{Partitions: 6, ReplicationFactor: 3, MinPartitions: 6}
+	require.NoError(t, cfg.Validate())
+
+	cfg.Kafka.Topics.MinPartitions = 12
+	assert.ErrorContains(t, cfg.Validate(), "must not be less than min_partitions")
+	cfg.Kafka.EnsureTopics = false
+	assert.NoError(t, cfg.Validate(), "existing topics are only verified")
+
+	cfg.Kafka.Topics = TopicsConfig{ReplicationFactor: -1}
+	assert.ErrorContains(t, cfg.Validate(), "kafka.topics")
+}
+
+func TestKafkaTopics(t *testing.T) {
+	cfg := &Config{Kafka: KafkaConfig{Topic: "orders", DLQTopic: "orders.dlq"}}
+	assert.Equal(t, []string{"orders"}, cfg.KafkaTopics())
+
+	cfg.Kafka.Consumer.MaxAttempts = 5
+	assert.Equal(t, []string{"orders", "orders.dlq"}, cfg.KafkaTopics())
+
+	cfg.Tenants = []TenantConfig{{ID: "market-a", Topic: "orders-a"}, {ID: "market-b", Topic: "orders-b"}}
+	assert.Equal(t, []string{"orders-a", "orders-b", "orders.dlq"}, cfg.KafkaTopics())
+
+	cfg.Kafka.Topics.OrderAck = "orders.ack"
+	assert.Equal(t, []string{"orders-a", "orders-b", "orders.dlq"}, cfg.KafkaTopics(), "acks are disabled")
+	cfg.Kafka.Consumer.OrderAck.Enabled = true
+	assert.Equal(t, []string{"orders-a", "orders-b", "orders.dlq", "orders.ack"}, cfg.KafkaTopics())
+}
+
+func TestValidateOrderAck(t *testing.T) {
+	cfg := &Config{Kafka: KafkaConfig{Consumer: ConsumerConfig{OrderAck: OrderAckConfig{Enabled: true}}}}
+	assert.ErrorContains(t, cfg.Validate(), "topics.order_ack is required")
+	cfg.Kafka.Topics.OrderAck = "orders.ack"
+	require.NoError(t, cfg.Validate())
+
+	cfg.Kafka.Consumer.OrderAck.Attempts = -1
+	assert.ErrorContains(t, cfg.Validate(), "kafka.consumer.order_ack")
+	cfg.Kafka.Consumer.OrderAck = OrderAckConfig{AttemptTimeout: -time.Second}
+	assert.ErrorContains(t, cfg.Validate(), "kafka.consumer.order_ack")
+}
+
+func TestValidateCustomerLimit(t *testing.T) {
+	cfg := &Config{Kafka: KafkaConfig{Consumer: ConsumerConfig{CustomerLimit: CustomerLimitConfig{MaxPerMinute: 100}}}}
+	require.NoError(t, cfg.Validate(), "the flag policy needs no dlq")
+	assert.False(t, cfg.Kafka.Consumer.UsesDLQ())
+
+	cfg.Kafka.Consumer.CustomerLimit.Policy = CustomerLimitPolicyDLQ
+	assert.True(t, cfg.Kafka.Consumer.UsesDLQ())
+	assert.ErrorContains(t, cfg.Validate(), "dlq_topic is required")
+	cfg.Kafka.DLQTopic = "orders.dlq"
+	require.NoError(t, cfg.Validate())
+	assert.Contains(t, cfg.KafkaTopics(), "orders.dlq")
+
+	cfg.Kafka.Consumer.CustomerLimit.Policy = "drop"
+	assert.ErrorContains(t, cfg.Validate(), "invalid policy")
+	cfg.Kafka.Consumer.CustomerLimit = CustomerLimitConfig{MaxPerMinute: -1}
+	assert.ErrorContains(t, cfg.Validate(), "kafka.consumer.customer_limit")
+
+	// Выключенное ограничение с политикой dlq очередь недоставленных не использует
+	cfg.Kafka.Consumer.CustomerLimit = CustomerLimitConfig{Policy: CustomerLimitPolicyDLQ}
+	assert.False(t, cfg.Kafka.Consumer.UsesDLQ())
+}
+
+func TestValidateIngestStats(t *testing.T) {
+	cfg := &Config{Kafka: KafkaConfig{Consumer: ConsumerConfig{IngestStats: IngestStatsConfig{Enabled: true}}}}
+	require.NoError(t, cfg.Validate())
+	s := cfg.Kafka.Consumer.IngestStats
+	assert.Equal(t, DefaultIngestStatsSize, s.Keys())
+	assert.Equal(t, DefaultIngestStatsFlushInterval, s.Interval())
+	assert.Equal(t, DefaultIngestStatsThreshold, s.Factor())
+	assert.Equal(t, DefaultIngestStatsMinMessages, s.Minimum())
+
+	cfg.Kafka.Consumer.IngestStats.Threshold = 0.5
+	assert.ErrorContains(t, cfg.Validate(), "threshold must be at least 1")
+	cfg.Kafka.Consumer.IngestStats = IngestStatsConfig{Enabled: true, Size: -1}
+	assert.ErrorContains(t, cfg.Validate(), "kafka.consumer.ingest_stats")
+	cfg.Kafka.Consumer.IngestStats = IngestStatsConfig{Enabled: true, FlushInterval: -time.Second}
+	assert.ErrorContains(t, cfg.Validate(), "kafka.consumer.ingest_stats")
+}
+
+func TestValidateReadyLag(t *testing.T) {
+	cfg := &Config{Kafka: KafkaConfig{Consumer: ConsumerConfig{MaxReadyLag: 1000}}}
+	assert.ErrorContains(t, cfg.Validate(), "requires stats_interval")
+	cfg.Kafka.Consumer.StatsInterval = 30 * time.Second
+	require.NoError(t, cfg.Validate())
+
+	cfg.Kafka.Consumer.ReadyLagClear = 1000
+	assert.ErrorContains(t, cfg.Validate(), "must be less than max_ready_lag")
+	cfg.Kafka.Consumer.ReadyLagClear = 200
+	require.NoError(t, cfg.Validate())
+
+	cfg.Kafka.Consumer.ReadyLagGrace = -time.Second
+	assert.ErrorContains(t, cfg.Validate(), "must not be negative")
+	cfg.Kafka.Consumer = ConsumerConfig{MaxReadyLag: -1}
+	assert.ErrorContains(t, cfg.Validate(), "must not be negative")
+}
+
+func TestValidateWebhooks(t *testing.T) {
+	endpoint := WebhookEndpointConfig{URL: "https://hooks.example.com/orders?token=t", Secret: "s", Events: []string{WebhookEventOrderStored}}
+	cfg := &Config{Webhooks: WebhooksConfig{Endpoints: []WebhookEndpointConfig{endpoint}}}
+	require.NoError(t, cfg.Validate())
+	assert.True(t, endpoint.Subscribed(WebhookEventOrderStored))
+	assert.False(t, endpoint.Subscribed("order.deleted"))
+	assert.True(t, WebhookEndpointConfig{}.Subscribed("order.deleted"), "no events subscribes to all")
+
+	for name, tc := range map[string]struct {
+		mutate func(w *WebhooksConfig)
+		want   string
+	}{
+		"relative url":  {func(w *WebhooksConfig) { w.Endpoints[0].URL = "/orders" }, "absolute http or https URL"},
+		"ftp url":       {func(w *WebhooksConfig) { w.Endpoints[0].URL = "ftp://hooks.example.com" }, "absolute http or https URL"},
+		"no secret":     {func(w *WebhooksConfig) { w.Endpoints[0].Secret = "" }, "secret is required"},
+		"unknown event": {func(w *WebhooksConfig) { w.Endpoints[0].Events = []string{"order.deleted"} }, "unknown event"},
+		"tenant":        {func(w *WebhooksConfig) { w.Endpoints[0].Tenant = "acme" }, `tenant "acme" is not declared`},
+		"timeout":       {func(w *WebhooksConfig) { w.Endpoints[0].Timeout = -time.Second }, "timeout must not be negative"},
+		"workers":       {func(w *WebhooksConfig) { w.Workers = -1 }, "must not be negative"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := &Config{Webhooks: WebhooksConfig{Endpoints: []WebhookEndpointConfig{endpoint}}}
+			tc.mutate(&c.Webhooks)
+			assert.ErrorContains(t, c.Validate(), tc.want)
+		})
+	}
+
+	redacted := cfg.Redacted()
+	assert.NotEqual(t, "s", redacted.Webhooks.Endpoints[0].Secret)
+	assert.Equal(t, "s", cfg.Webhooks.Endpoints[0].Secret, "Redacted does not modify the config")
+}
@@ -0,0 +1,178 @@
+// Package crypto реализует шифрование отдельных полей для хранения в базе данных (AES-256-GCM) с ротацией ключей:
+// идентификатор ключа записывается в префикс шифротекста, поэтому значения, зашифрованные старыми ключами, остаются читаемыми.
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Prefix - префикс зашифрованного значения. Полный формат: "enc:<key id>:<base64(nonce || шифротекст)>".
+const Prefix = "enc:"
+
+// KeySize - размер ключа AES-256 в байтах.
+const KeySize = 32
+
+var (
+	// ErrUnknownKey возвращается при расшифровке значения, зашифрованного ключом, которого нет в наборе.
+	ErrUnknownKey = errors.New("unknown encryption key")
+	// ErrDecrypt возвращается, если значение повреждено или зашифровано другим ключом с тем же идентификатором.
+	ErrDecrypt = errors.New("failed to decrypt value")
+	// ErrNoKeyring возвращается при расшифровке зашифрованного значения без набора ключей.
+	ErrNoKeyring = errors.New("encrypted value found but no encryption keys are configured")
+)
+
+// Keyring - набор ключей шифрования. Новые значения шифруются активным ключом, расшифровка выполняется ключом,
+// идентификатор которого указан в значении. Nil Keyring означает, что шифрование отключено.
+type Keyring struct {
+	aeads  map[string]cipher.AEAD
+	active string
+}
+
+// NewKeyring создаёт набор ключей. Каждый ключ должен иметь размер KeySize, идентификатор не может быть пустым
+// или содержать ':'; active должен быть одним из идентификаторов.
+func NewKeyring(keys map[string][]byte, active string) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no encryption keys")
+	}
+	kr := &Keyring{aeads: make(map[string]cipher.AEAD, len(keys)), active: active}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid encryption key id %q", id)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("encryption key %q: must be %d bytes, got %d", id, KeySize, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", id, err)
+		}
+		kr.aeads[id] = aead
+	}
+	if _, ok := kr.aeads[active]; !ok {
+		return nil, fmt.Errorf("active encryption key %q is not among configured keys", active)
+	}
+	return kr, nil
+}
+
+// ParseKeys разбирает ключи в формате "id1:base64,id2:base64" (стандартный base64 с дополнением).
+func ParseKeys(spec string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(part, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid encryption key entry: want id:base64")
+		}
+		if _, dup := keys[id]; dup {
+			return nil, fmt.Errorf("duplicate encryption key id %q", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: invalid base64: %w", id, err)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+// ActiveKeyID возвращает идентификатор ключа, которым шифруются новые значения.
+func (k *Keyring) ActiveKeyID() string {
+	if k == nil {
+		return ""
+	}
+	return k.active
+}
+
+// KeyIDs возвращает отсортированные идентификаторы ключей набора.
+func (k *Keyring) KeyIDs() []string {
+	if k == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(k.aeads))
+	for id := range k.aeads {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// IsEncrypted сообщает, записано ли значение в зашифрованном формате.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// KeyID возвращает идентификатор ключа зашифрованного значения или пустую строку для открытого текста.
+func KeyID(value string) string {
+	if !IsEncrypted(value) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, Prefix), ":")
+	return id
+}
+
+// Encrypt шифрует значение активным ключом. Пустая строка остаётся пустой, а без набора ключей значение
+// возвращается без изменений.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if k == nil || plaintext == "" {
+		return plaintext, nil
+	}
+	aead := k.aeads[k.active]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	// Идентификатор ключа аутентифицируется вместе с данными, чтобы значение нельзя было приписать другому ключу
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(k.active))
+	return Prefix + k.active + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt расшифровывает значение ключом из его префикса. Значение без префикса считается открытым текстом
+// (записанным до включения шифрования) и возвращается как есть.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if k == nil {
+		return "", ErrNoKeyring
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, Prefix), ":")
+	if !ok {
+		return "", fmt.Errorf("%w: malformed value", ErrDecrypt)
+	}
+	aead, ok := k.aeads[id]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("%w: malformed value", ErrDecrypt)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("%w with key %q", ErrDecrypt, id)
+	}
+	return string(plain), nil
+}
+
+// NeedsEncrypt сообщает, нужно ли (пере)шифровать значение: оно непустое и записано открытым текстом
+// или зашифровано неактивным ключом.
+func (k *Keyring) NeedsEncrypt(value string) bool {
+	if k == nil || value == "" {
+		return false
+	}
+	return KeyID(value) != k.active
+}
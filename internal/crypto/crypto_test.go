@@ -0,0 +1,133 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func mustKeyring(t *testing.T, keys map[string][]byte, active string) *Keyring {
+	t.Helper()
+	kr, err := NewKeyring(keys, active)
+	require.NoError(t, err)
+	return kr
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	kr := mustKeyring(t, map[string][]byte{"k1": testKey(1)}, "k1")
+
+	for _, plain := range []string{"+9720000000", "test@gmail.com", "юникод ✓"} {
+		enc, err := kr.Encrypt(plain)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(enc, "enc:k1:"), enc)
+		assert.NotContains(t, enc, plain)
+
+		got, err := kr.Decrypt(enc)
+		require.NoError(t, err)
+		assert.Equal(t, plain, got)
+	}
+
+	a, _ := kr.Encrypt("same")
+	b, _ := kr.Encrypt("same")
+	assert.NotEqual(t, a, b, "each value gets its own nonce")
+
+	enc, err := kr.Encrypt("")
+	require.NoError(t, err)
+	assert.Empty(t, enc)
+}
+
+func TestDecryptPlaintextPassthrough(t *testing.T) {
+	kr := mustKeyring(t, map[string][]byte{"k1": testKey(1)}, "k1")
+	got, err := kr.Decrypt("+9720000000")
+	require.NoError(t, err)
+	assert.Equal(t, "+9720000000", got)
+
+	var none *Keyring
+	got, err = none.Decrypt("plain")
+	require.NoError(t, err)
+	assert.Equal(t, "plain", got)
+	enc, err := none.Encrypt("plain")
+	require.NoError(t, err)
+	assert.Equal(t, "plain", enc, "without keys values are stored as is")
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := mustKeyring(t, map[string][]byte{"k1": testKey(1)}, "k1")
+	enc1, err := old.Encrypt("secret")
+	require.NoError(t, err)
+
+	rotated := mustKeyring(t, map[string][]byte{"k1": testKey(1), "k2": testKey(2)}, "k2")
+	enc2, err := rotated.Encrypt("secret")
+	require.NoError(t, err)
+	assert.Equal(t, "k2", KeyID(enc2))
+
+	for _, enc := range []string{enc1, enc2} {
+		got, err := rotated.Decrypt(enc)
+		require.NoError(t, err)
+		assert.Equal(t, "secret", got)
+	}
+	assert.True(t, rotated.NeedsEncrypt(enc1), "values under the old key are re-encrypted")
+	assert.False(t, rotated.NeedsEncrypt(enc2))
+	assert.True(t, rotated.NeedsEncrypt("plain"))
+	assert.False(t, rotated.NeedsEncrypt(""))
+
+	// После удаления старого ключа его значения не читаются
+	_, err = mustKeyring(t, map[string][]byte{"k2": testKey(2)}, "k2").Decrypt(enc1)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestDecryptFailures(t *testing.T) {
+	kr := mustKeyring(t, map[string][]byte{"k1": testKey(1)}, "k1")
+	enc, err := kr.Encrypt("secret")
+	require.NoError(t, err)
+
+	_, err = mustKeyring(t, map[string][]byte{"k1": testKey(9)}, "k1").Decrypt(enc)
+	assert.ErrorIs(t, err, ErrDecrypt, "wrong key under the same id")
+
+	var none *Keyring
+	_, err = none.Decrypt(enc)
+	assert.ErrorIs(t, err, ErrNoKeyring)
+
+	raw, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(enc, "enc:k1:"))
+	raw[len(raw)-1] ^= 1
+	_, err = kr.Decrypt("enc:k1:" + base64.StdEncoding.EncodeToString(raw))
+	assert.ErrorIs(t, err, ErrDecrypt, "tampered value")
+
+	for _, bad := range []string{"enc:k1", "enc:k1:!!!", "enc:k1:AAAA"} {
+		_, err = kr.Decrypt(bad)
+		assert.ErrorIs(t, err, ErrDecrypt, bad)
+	}
+}
+
+func TestNewKeyringErrors(t *testing.T) {
+	_, err := NewKeyring(nil, "k1")
+	assert.Error(t, err)
+	_, err = NewKeyring(map[string][]byte{"k1": testKey(1)}, "k2")
+	assert.ErrorContains(t, err, "active encryption key")
+	_, err = NewKeyring(map[string][]byte{"k1": []byte("short")}, "k1")
+	assert.ErrorContains(t, err, "must be 32 bytes")
+	_, err = NewKeyring(map[string][]byte{"a:b": testKey(1)}, "a:b")
+	assert.ErrorContains(t, err, "invalid encryption key id")
+}
+
+func TestParseKeys(t *testing.T) {
+	k1 := base64.StdEncoding.EncodeToString(testKey(1))
+	k2 := base64.StdEncoding.EncodeToString(testKey(2))
+
+	keys, err := ParseKeys(" k1:" + k1 + ", k2:" + k2 + ",")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"k1": testKey(1), "k2": testKey(2)}, keys)
+
+	for _, bad := range []string{"k1", ":" + k1, "k1:not-base64!", "k1:" + k1 + ",k1:" + k2} {
+		_, err := ParseKeys(bad)
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,136 @@
+package dedup
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// Hash - отпечаток содержимого: первые 16 байт SHA-256. Окно хранит только отпечатки, а не само содержимое.
+type Hash [16]byte
+
+// HashOf вычисляет отпечаток содержимого b.
+func HashOf(b []byte) Hash {
+	sum := sha256.Sum256(b)
+	var h Hash
+	copy(h[:], sum[:])
+	return h
+}
+
+// Verdict - результат проверки ключа и отпечатка по окну ContentWindow.
+type Verdict int
+
+const (
+	Miss      Verdict = iota // ключ не встречался в пределах окна
+	Duplicate                // ключ встречался с тем же отпечатком
+	Changed                  // ключ встречался с другим отпечатком
+)
+
+// contentEntry - элемент окна: ключ, отпечаток содержимого и момент регистрации.
+type contentEntry struct {
+	key    string
+	hash   Hash
+	seenAt time.Time
+}
+
+// ContentWindow хранит не более size последних ключей с отпечатками их содержимого, каждый не дольше ttl.
+// Повторная регистрация ключа делает его самым новым; при переполнении вытесняется самый давний.
+// ContentWindow безопасен для конкурентного использования.
+type ContentWindow struct {
+	mu         sync.Mutex
+	size       int
+	ttl        time.Duration
+	items      map[string]*list.Element
+	order      *list.List
+	now        func() time.Time
+	duplicates int64
+}
+
+// NewContentWindow создает окно на size ключей с временем жизни ttl. size <= 0 создаёт выключенное окно,
+// в котором любой ключ считается новым; ttl <= 0 означает отсутствие ограничения по времени.
+func NewContentWindow(size int, ttl time.Duration) *ContentWindow {
+	return &ContentWindow{
+		size:  size,
+		ttl:   ttl,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+		now:   time.Now,
+	}
+}
+
+// Check сравнивает hash с отпечатком, зарегистрированным для key в пределах окна. Окно не изменяется,
+// кроме удаления устаревшей записи key и учёта найденного дубликата в Duplicates.
+func (w *ContentWindow) Check(key string, hash Hash) Verdict {
+	if w.size <= 0 {
+		return Miss
+	}
+	now := w.now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	el, ok := w.items[key]
+	if !ok {
+		return Miss
+	}
+	e := el.Value.(*contentEntry)
+	if w.ttl > 0 && now.Sub(e.seenAt) > w.ttl {
+		w.order.Remove(el)
+		delete(w.items, key)
+		return Miss
+	}
+	if e.hash != hash {
+		return Changed
+	}
+	w.duplicates++
+	return Duplicate
+}
+
+// Remember регистрирует для key отпечаток hash, заменяя прежний.
+func (w *ContentWindow) Remember(key string, hash Hash) {
+	if w.size <= 0 {
+		return
+	}
+	now := w.now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if el, ok := w.items[key]; ok {
+		e := el.Value.(*contentEntry)
+		e.hash, e.seenAt = hash, now
+		w.order.MoveToBack(el)
+		return
+	}
+	w.items[key] = w.order.PushBack(&contentEntry{key: key, hash: hash, seenAt: now})
+	for w.order.Len() > w.size {
+		oldest := w.order.Front()
+		w.order.Remove(oldest)
+		delete(w.items, oldest.Value.(*contentEntry).key)
+	}
+}
+
+// Forget удаляет key из окна: следующее сообщение с этим ключом будет обработано как новое.
+func (w *ContentWindow) Forget(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if el, ok := w.items[key]; ok {
+		w.order.Remove(el)
+		delete(w.items, key)
+	}
+}
+
+// Len возвращает количество ключей в окне, включая ещё не вытесненные устаревшие.
+func (w *ContentWindow) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.order.Len()
+}
+
+// Duplicates возвращает количество проверок Check, нашедших дубликат.
+func (w *ContentWindow) Duplicates() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.duplicates
+}
@@ -0,0 +1,84 @@
+package dedup
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentWindowCheck(t *testing.T) {
+	w := NewContentWindow(10, time.Minute)
+	v1, v2 := HashOf([]byte(`{"v":1}`)), HashOf([]byte(`{"v":2}`))
+
+	assert.Equal(t, Miss, w.Check("a", v1))
+	assert.Equal(t, Miss, w.Check("a", v1), "Check does not register the key")
+
+	w.Remember("a", v1)
+	assert.Equal(t, Duplicate, w.Check("a", v1))
+	assert.Equal(t, Changed, w.Check("a", v2))
+	assert.Equal(t, Miss, w.Check("b", v1))
+
+	w.Remember("a", v2)
+	assert.Equal(t, Duplicate, w.Check("a", v2))
+	assert.Equal(t, Changed, w.Check("a", v1))
+	assert.Equal(t, int64(2), w.Duplicates())
+}
+
+func TestContentWindowForget(t *testing.T) {
+	w := NewContentWindow(10, time.Minute)
+	h := HashOf([]byte(`{"v":1}`))
+	w.Remember("a", h)
+	w.Remember("b", h)
+
+	w.Forget("a")
+	w.Forget("missing")
+	assert.Equal(t, Miss, w.Check("a", h))
+	assert.Equal(t, Duplicate, w.Check("b", h))
+	assert.Equal(t, 1, w.Len())
+}
+
+func TestContentWindowTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := NewContentWindow(10, time.Second)
+	w.now = func() time.Time { return now }
+	h := HashOf([]byte("x"))
+
+	w.Remember("a", h)
+	now = now.Add(time.Second)
+	assert.Equal(t, Duplicate, w.Check("a", h))
+	now = now.Add(2 * time.Second)
+	assert.Equal(t, Miss, w.Check("a", h))
+	assert.Zero(t, w.Len(), "expired entry is dropped")
+}
+
+func TestContentWindowBounded(t *testing.T) {
+	w := NewContentWindow(3, 0)
+	h := HashOf([]byte("x"))
+	for i := 0; i < 5; i++ {
+		w.Remember(fmt.Sprintf("k%d", i), h)
+	}
+	assert.Equal(t, 3, w.Len())
+	assert.Equal(t, Miss, w.Check("k0", h), "oldest key should have been evicted")
+
+	// Повторная регистрация делает ключ самым новым
+	w.Remember("k2", h)
+	w.Remember("k5", h)
+	assert.Equal(t, Miss, w.Check("k3", h))
+	assert.Equal(t, Duplicate, w.Check("k2", h))
+
+	for i := 0; i < 10000; i++ {
+		w.Remember(fmt.Sprintf("bulk%d", i), HashOf([]byte(fmt.Sprint(i))))
+	}
+	assert.Equal(t, 3, w.Len())
+	assert.Len(t, w.items, 3)
+}
+
+func TestContentWindowDisabled(t *testing.T) {
+	w := NewContentWindow(0, time.Minute)
+	h := HashOf([]byte("x"))
+	w.Remember("a", h)
+	assert.Equal(t, Miss, w.Check("a", h))
+	assert.Zero(t, w.Len())
+}
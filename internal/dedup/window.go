@@ -0,0 +1,72 @@
+// Package dedup реализует ограниченное по размеру и времени окно недавно обработанных ключей
+// для подавления повторной обработки одних и тех же сообщений.
+package dedup
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// entry - элемент окна: ключ и момент его регистрации.
+type entry struct {
+	key    string
+	seenAt time.Time
+}
+
+// Window хранит не более size последних ключей, каждый не дольше ttl. При переполнении вытесняется самый старый ключ.
+// Window безопасен для конкурентного использования.
+type Window struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	items map[string]*list.Element
+	order *list.List
+	now   func() time.Time
+}
+
+// NewWindow создает окно на size ключей с временем жизни ttl. size <= 0 создаёт выключенное окно,
+// которое ничего не запоминает; ttl <= 0 означает отсутствие ограничения по времени.
+func NewWindow(size int, ttl time.Duration) *Window {
+	return &Window{
+		size:  size,
+		ttl:   ttl,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+		now:   time.Now,
+	}
+}
+
+// Seen сообщает, встречался ли key в пределах окна, и регистрирует его, если нет.
+func (w *Window) Seen(key string) bool {
+	if w.size <= 0 {
+		return false
+	}
+	now := w.now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if el, ok := w.items[key]; ok {
+		if w.ttl <= 0 || now.Sub(el.Value.(*entry).seenAt) <= w.ttl {
+			return true
+		}
+		w.order.Remove(el)
+		delete(w.items, key)
+	}
+
+	w.items[key] = w.order.PushBack(&entry{key: key, seenAt: now})
+	for w.order.Len() > w.size {
+		oldest := w.order.Front()
+		w.order.Remove(oldest)
+		delete(w.items, oldest.Value.(*entry).key)
+	}
+	return false
+}
+
+// Len возвращает количество ключей в окне, включая ещё не вытесненные устаревшие.
+func (w *Window) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.order.Len()
+}
@@ -0,0 +1,70 @@
+package dedup
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowSeen(t *testing.T) {
+	w := NewWindow(10, time.Minute)
+
+	assert.False(t, w.Seen("a"))
+	assert.True(t, w.Seen("a"))
+	assert.False(t, w.Seen("b"))
+}
+
+func TestWindowTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := NewWindow(10, time.Second)
+	w.now = func() time.Time { return now }
+
+	assert.False(t, w.Seen("a"))
+	now = now.Add(time.Second)
+	assert.True(t, w.Seen("a"))
+	now = now.Add(2 * time.Second)
+	assert.False(t, w.Seen("a"))
+}
+
+func TestWindowBounded(t *testing.T) {
+	w := NewWindow(3, 0)
+	for i := 0; i < 5; i++ {
+		w.Seen(fmt.Sprintf("k%d", i))
+	}
+
+	assert.Equal(t, 3, w.Len())
+	assert.False(t, w.Seen("k0"), "oldest key should have been evicted")
+	assert.True(t, w.Seen("k4"))
+}
+
+func TestWindowDisabled(t *testing.T) {
+	w := NewWindow(0, time.Minute)
+	assert.False(t, w.Seen("a"))
+	assert.False(t, w.Seen("a"))
+	assert.Zero(t, w.Len())
+}
+
+func TestWindowConcurrent(t *testing.T) {
+	w := NewWindow(1000, time.Minute)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	firsts := 0
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if !w.Seen(fmt.Sprintf("k%d", i)) {
+					mu.Lock()
+					firsts++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 100, firsts)
+}
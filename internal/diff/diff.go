@@ -0,0 +1,144 @@
+// Package diff сравнивает значения по их JSON представлению и возвращает различия с путями полей.
+// Значения сравниваются так, как их видят клиенты API: учитываются собственные методы MarshalJSON,
+// а поля, которые не попадают в JSON, не сравниваются.
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// Kind - вид различия.
+type Kind string
+
+const (
+	// Changed - значение есть в обоих сравниваемых, но отличается.
+	Changed Kind = "changed"
+	// Added - значение есть только во втором сравниваемом (b).
+	Added Kind = "added"
+	// Removed - значение есть только в первом сравниваемом (a).
+	Removed Kind = "removed"
+)
+
+// Difference - различие в одном поле. Path - путь поля в JSON представлении, например "items[1].price";
+// A и B - значения в первом и втором сравниваемом (nil, если значения нет).
+type Difference struct {
+	Path string
+	Kind Kind
+	A    any
+	B    any
+}
+
+// Compare возвращает различия значений a и b в порядке обхода: поля объектов по алфавиту, элементы массивов по индексу.
+// Массивы сравниваются поэлементно: лишние элементы более длинного массива возвращаются как Added или Removed.
+// Пустой результат означает, что JSON представления значений совпадают.
+func Compare(a, b any) ([]Difference, error) {
+	va, err := toTree(a)
+	if err != nil {
+		return nil, fmt.Errorf("diff: encode a: %w", err)
+	}
+	vb, err := toTree(b)
+	if err != nil {
+		return nil, fmt.Errorf("diff: encode b: %w", err)
+	}
+	var diffs []Difference
+	walk("", va, vb, &diffs)
+	return diffs, nil
+}
+
+// toTree - переводит значение в дерево из map[string]any, []any и скаляров; числа остаются json.Number,
+// чтобы большие целые сравнивались без потери точности
+func toTree(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var tree any
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// walk - сравнивает поддеревья a и b по пути path и добавляет различия в diffs
+func walk(path string, a, b any, diffs *[]Difference) {
+	switch av := a.(type) {
+	case map[string]any:
+		if bv, ok := b.(map[string]any); ok {
+			walkObject(path, av, bv, diffs)
+			return
+		}
+	case []any:
+		if bv, ok := b.([]any); ok {
+			walkArray(path, av, bv, diffs)
+			return
+		}
+	default:
+		if isScalar(b) && a == b {
+			return
+		}
+	}
+	*diffs = append(*diffs, Difference{Path: path, Kind: Changed, A: a, B: b})
+}
+
+func walkObject(path string, a, b map[string]any, diffs *[]Difference) {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		av, inA := a[k]
+		bv, inB := b[k]
+		p := joinKey(path, k)
+		switch {
+		case !inB:
+			*diffs = append(*diffs, Difference{Path: p, Kind: Removed, A: av})
+		case !inA:
+			*diffs = append(*diffs, Difference{Path: p, Kind: Added, B: bv})
+		default:
+			walk(p, av, bv, diffs)
+		}
+	}
+}
+
+func walkArray(path string, a, b []any, diffs *[]Difference) {
+	for i := 0; i < max(len(a), len(b)); i++ {
+		p := path + "[" + strconv.Itoa(i) + "]"
+		switch {
+		case i >= len(b):
+			*diffs = append(*diffs, Difference{Path: p, Kind: Removed, A: a[i]})
+		case i >= len(a):
+			*diffs = append(*diffs, Difference{Path: p, Kind: Added, B: b[i]})
+		default:
+			walk(p, a[i], b[i], diffs)
+		}
+	}
+}
+
+// isScalar - true для значений, которые можно сравнить оператором ==
+func isScalar(v any) bool {
+	switch v.(type) {
+	case map[string]any, []any:
+		return false
+	}
+	return true
+}
+
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
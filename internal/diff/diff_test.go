@@ -0,0 +1,84 @@
+package diff
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareIdenticalOrders(t *testing.T) {
+	order := testorders.NewGenerator(1).Order(testorders.ScenarioDefault)
+	order.Extras = map[string]any{"utm_source": "partner"}
+	copied := order
+	copied.Items = append([]orders.Item(nil), order.Items...)
+
+	diffs, err := Compare(order, copied)
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+}
+
+func TestCompareNestedStructs(t *testing.T) {
+	a := testorders.NewGenerator(2).Order(testorders.ScenarioDefault)
+	b := a
+	b.Delivery.City = "Казань"
+	b.SmId = a.SmId + 1
+	b.Extras = map[string]any{"note": "new"}
+
+	diffs, err := Compare(a, b)
+	require.NoError(t, err)
+	assert.Equal(t, []Difference{
+		{Path: "delivery.city", Kind: Changed, A: a.Delivery.City, B: "Казань"},
+		{Path: "note", Kind: Added, B: "new"},
+		{Path: "sm_id", Kind: Changed, A: jsonNumber(a.SmId), B: jsonNumber(b.SmId)},
+	}, diffs)
+}
+
+func TestCompareItemSlices(t *testing.T) {
+	base := orders.Order{OrderUid: "o1", Items: []orders.Item{{ChrtId: 1, Price: 100}, {ChrtId: 2, Price: 200}}}
+
+	changed := base
+	changed.Items = []orders.Item{{ChrtId: 1, Price: 150}, {ChrtId: 2, Price: 200}}
+	diffs, err := Compare(base, changed)
+	require.NoError(t, err)
+	assert.Equal(t, []Difference{{Path: "items[0].price", Kind: Changed, A: jsonNumber(100), B: jsonNumber(150)}}, diffs)
+
+	added := base
+	added.Items = append(append([]orders.Item(nil), base.Items...), orders.Item{ChrtId: 3})
+	diffs, err = Compare(base, added)
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	assert.Equal(t, "items[2]", diffs[0].Path)
+	assert.Equal(t, Added, diffs[0].Kind)
+	assert.Nil(t, diffs[0].A)
+	assert.Equal(t, jsonNumber(3), diffs[0].B.(map[string]any)["chrt_id"])
+
+	removed := base
+	removed.Items = base.Items[:1]
+	diffs, err = Compare(base, removed)
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	assert.Equal(t, "items[1]", diffs[0].Path)
+	assert.Equal(t, Removed, diffs[0].Kind)
+	assert.Nil(t, diffs[0].B)
+}
+
+func TestCompareTypeMismatch(t *testing.T) {
+	diffs, err := Compare(map[string]any{"v": []int{1}}, map[string]any{"v": "1"})
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	assert.Equal(t, Changed, diffs[0].Kind)
+	assert.Equal(t, "v", diffs[0].Path)
+}
+
+func TestCompareEncodeError(t *testing.T) {
+	_, err := Compare(make(chan int), 1)
+	assert.Error(t, err)
+}
+
+func jsonNumber(n int) json.Number { return json.Number(strconv.Itoa(n)) }
@@ -0,0 +1,165 @@
+// Package goroutines ведёт реестр фоновых горутин процесса. Каждая горутина запускается с именем и каналом остановки,
+// поэтому реестр показывает, какие горутины работают, какие уже получили сигнал остановки, но ещё не завершились,
+// и сколько их осталось после остановки компонентов.
+package goroutines
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// State - состояние зарегистрированной горутины.
+type State string
+
+// Состояния горутин.
+const (
+	StateRunning  State = "running"  // канал остановки не закрыт
+	StateStopping State = "stopping" // канал остановки закрыт, но горутина ещё не завершилась
+)
+
+// ErrLimitReached возвращается TryGo, если число зарегистрированных горутин достигло лимита SetLimit.
+var ErrLimitReached = errors.New("goroutine limit reached")
+
+// Info - описание зарегистрированной горутины.
+type Info struct {
+	ID        uint64    `json:"id"`
+	Name      string    `json:"name"`
+	StartedAt time.Time `json:"started_at"`
+	State     State     `json:"state"`
+}
+
+// entry - запись реестра о работающей горутине
+type entry struct {
+	id        uint64
+	name      string
+	startedAt time.Time
+	stop      <-chan struct{}
+}
+
+// Registry - реестр горутин. Горутина находится в реестре от запуска до возврата из своей функции.
+type Registry struct {
+	mu      sync.Mutex
+	nextID  uint64
+	limit   int
+	entries map[uint64]*entry
+}
+
+// NewRegistry создает пустой реестр горутин без лимита.
+func NewRegistry() *Registry {
+	return &Registry{entries: make(map[uint64]*entry)}
+}
+
+// SetLimit задаёт наибольшее число зарегистрированных горутин, при котором TryGo ещё запускает новые; 0 — без лимита.
+// Go лимит не учитывает: им запускаются компоненты процесса, число которых не зависит от нагрузки.
+func (r *Registry) SetLimit(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limit = n
+}
+
+// Limit возвращает лимит SetLimit; 0 — без лимита.
+func (r *Registry) Limit() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.limit
+}
+
+// Go запускает fn в горутине с именем name. stop - канал, закрытие которого просит горутину завершиться
+// (обычно ctx.Done()); nil означает, что горутина завершается сама по окончании работы.
+func (r *Registry) Go(name string, stop <-chan struct{}, fn func()) {
+	r.mu.Lock()
+	e := r.add(name, stop)
+	r.mu.Unlock()
+	go r.run(e, fn)
+}
+
+// TryGo запускает fn, как Go, если число зарегистрированных горутин меньше лимита SetLimit,
+// и возвращает ErrLimitReached, не запуская fn, в противном случае.
+func (r *Registry) TryGo(name string, stop <-chan struct{}, fn func()) error {
+	r.mu.Lock()
+	if r.limit > 0 && len(r.entries) >= r.limit {
+		r.mu.Unlock()
+		return ErrLimitReached
+	}
+	e := r.add(name, stop)
+	r.mu.Unlock()
+	go r.run(e, fn)
+	return nil
+}
+
+// add - регистрирует горутину; вызывается под r.mu
+func (r *Registry) add(name string, stop <-chan struct{}) *entry {
+	r.nextID++
+	e := &entry{id: r.nextID, name: name, startedAt: time.Now(), stop: stop}
+	r.entries[e.id] = e
+	return e
+}
+
+// run - выполняет fn и удаляет горутину из реестра, в том числе при панике
+func (r *Registry) run(e *entry, fn func()) {
+	defer func() {
+		r.mu.Lock()
+		delete(r.entries, e.id)
+		r.mu.Unlock()
+	}()
+	fn()
+}
+
+// Len возвращает число зарегистрированных горутин.
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entries)
+}
+
+// Snapshot возвращает зарегистрированные горутины в порядке запуска.
+func (r *Registry) Snapshot() []Info {
+	r.mu.Lock()
+	list := make([]Info, 0, len(r.entries))
+	for _, e := range r.entries {
+		list = append(list, Info{ID: e.id, Name: e.name, StartedAt: e.startedAt, State: stateOf(e.stop)})
+	}
+	r.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// CountByName возвращает число зарегистрированных горутин с каждым именем.
+func (r *Registry) CountByName() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]int, len(r.entries))
+	for _, e := range r.entries {
+		counts[e.name]++
+	}
+	return counts
+}
+
+// stateOf - состояние горутины по её каналу остановки
+func stateOf(stop <-chan struct{}) State {
+	if stop == nil {
+		return StateRunning
+	}
+	select {
+	case <-stop:
+		return StateStopping
+	default:
+		return StateRunning
+	}
+}
+
+// defaultRegistry - реестр, в котором регистрируют горутины все компоненты процесса
+var defaultRegistry = NewRegistry()
+
+// Default возвращает общий реестр горутин процесса.
+func Default() *Registry { return defaultRegistry }
+
+// Go запускает fn в горутине с именем name в общем реестре (см. Registry.Go).
+func Go(name string, stop <-chan struct{}, fn func()) { defaultRegistry.Go(name, stop, fn) }
+
+// TryGo запускает fn в горутине с именем name в общем реестре, если не достигнут его лимит (см. Registry.TryGo).
+func TryGo(name string, stop <-chan struct{}, fn func()) error {
+	return defaultRegistry.TryGo(name, stop, fn)
+}
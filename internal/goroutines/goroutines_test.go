@@ -0,0 +1,61 @@
+package goroutines
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryTracksGoroutines(t *testing.T) {
+	r := NewRegistry()
+	stop, release := make(chan struct{}), make(chan struct{})
+	started := make(chan struct{}, 2)
+	r.Go("worker", stop, func() {
+		started <- struct{}{}
+		<-release
+	})
+	r.Go("once", nil, func() {
+		started <- struct{}{}
+		<-release
+	})
+	<-started
+	<-started
+
+	list := r.Snapshot()
+	require.Len(t, list, 2)
+	assert.Equal(t, "worker", list[0].Name, "ordered by start")
+	assert.Equal(t, StateRunning, list[0].State)
+	assert.False(t, list[0].StartedAt.IsZero())
+	assert.Equal(t, map[string]int{"worker": 1, "once": 1}, r.CountByName())
+
+	close(stop)
+	list = r.Snapshot()
+	assert.Equal(t, StateStopping, list[0].State, "asked to stop but not returned yet")
+	assert.Equal(t, StateRunning, list[1].State, "no stop channel")
+
+	close(release)
+	require.Eventually(t, func() bool { return r.Len() == 0 }, time.Second, time.Millisecond)
+	assert.Empty(t, r.Snapshot())
+}
+
+func TestRegistryTryGoLimit(t *testing.T) {
+	r := NewRegistry()
+	r.SetLimit(1)
+	assert.Equal(t, 1, r.Limit())
+	release := make(chan struct{})
+	defer close(release)
+
+	require.NoError(t, r.TryGo("first", nil, func() { <-release }))
+	assert.ErrorIs(t, r.TryGo("second", nil, func() { t.Error("must not run") }), ErrLimitReached)
+	assert.Equal(t, 1, r.Len())
+
+	// Go запускает компоненты процесса независимо от лимита
+	done := make(chan struct{})
+	r.Go("component", nil, func() { close(done) })
+	<-done
+
+	r.SetLimit(0)
+	assert.NoError(t, r.TryGo("third", nil, func() {}))
+}
@@ -0,0 +1,196 @@
+// Package i18n содержит каталог локализованных сообщений об ошибках API и выбор языка ответа по заголовку
+// Accept-Language. Каталог встроен в бинарный файл: по файлу messages/<язык>.json на язык, код ошибки → шаблон fmt.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLanguage - язык сообщений, если клиент не принимает ни одного языка каталога.
+const DefaultLanguage = "en"
+
+//go:embed messages/*.json
+var embedded embed.FS
+
+// verbPattern - глаголы fmt в шаблоне сообщения: переводы одного кода должны принимать те же аргументы
+var verbPattern = regexp.MustCompile(`%[-+# 0]*[0-9]*(\.[0-9]+)?[a-zA-Z%]`)
+
+// Catalog - сообщения об ошибках по языкам. Методы nil каталога возвращают код ошибки вместо сообщения.
+type Catalog struct {
+	messages  map[string]map[string]string // язык → код ошибки → шаблон сообщения
+	languages []string
+}
+
+// Parse читает каталог из файлов messages/*.json файловой системы fsys и проверяет его полноту: каталог содержит
+// DefaultLanguage, каждый код есть во всех языках с непустым сообщением и одинаковыми глаголами fmt.
+func Parse(fsys fs.FS) (*Catalog, error) {
+	files, err := fs.Glob(fsys, "messages/*.json")
+	if err != nil {
+		return nil, err
+	}
+	c := &Catalog{messages: make(map[string]map[string]string)}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("i18n: %s: %w", file, err)
+		}
+		lang := strings.TrimSuffix(path.Base(file), ".json")
+		c.messages[lang] = messages
+		c.languages = append(c.languages, lang)
+	}
+	sort.Strings(c.languages)
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// validate - проверяет полноту каталога
+func (c *Catalog) validate() error {
+	base, ok := c.messages[DefaultLanguage]
+	if !ok {
+		return fmt.Errorf("i18n: default language %q is missing", DefaultLanguage)
+	}
+	codes := c.Codes()
+	var problems []string
+	for _, lang := range c.languages {
+		for _, code := range codes {
+			msg, ok := c.messages[lang][code]
+			switch {
+			case !ok || msg == "":
+				problems = append(problems, fmt.Sprintf("%s: %s is missing", lang, code))
+			case base[code] != "" && !slices.Equal(verbs(msg), verbs(base[code])):
+				problems = append(problems, fmt.Sprintf("%s: %s has arguments %v, %s has %v", lang, code, verbs(msg), DefaultLanguage, verbs(base[code])))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("i18n: incomplete catalog: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// verbs - глаголы fmt шаблона по порядку
+func verbs(format string) []string {
+	found := verbPattern.FindAllString(format, -1)
+	return slices.DeleteFunc(found, func(v string) bool { return v == "%%" })
+}
+
+// embeddedCatalog - встроенный каталог, разобранный один раз
+var embeddedCatalog = sync.OnceValues(func() (*Catalog, error) { return Parse(embedded) })
+
+// Embedded возвращает встроенный каталог или ошибку, если он неполон. Сервер вызывает его при запуске.
+func Embedded() (*Catalog, error) {
+	return embeddedCatalog()
+}
+
+// Languages возвращает языки каталога по алфавиту.
+func (c *Catalog) Languages() []string {
+	if c == nil {
+		return nil
+	}
+	return slices.Clone(c.languages)
+}
+
+// Codes возвращает коды ошибок всех языков каталога по алфавиту.
+func (c *Catalog) Codes() []string {
+	if c == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var codes []string
+	for _, messages := range c.messages {
+		for code := range messages {
+			if !seen[code] {
+				seen[code] = true
+				codes = append(codes, code)
+			}
+		}
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Message возвращает сообщение с кодом code на языке lang, подставляя args в шаблон. Неизвестный язык заменяется
+// DefaultLanguage, а неизвестный код возвращается как есть.
+func (c *Catalog) Message(lang, code string, args ...any) string {
+	if c == nil {
+		return code
+	}
+	format, ok := c.messages[lang][code]
+	if !ok {
+		if format, ok = c.messages[DefaultLanguage][code]; !ok {
+			return code
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Negotiate выбирает язык каталога по заголовку Accept-Language (RFC 9110): языки перебираются по убыванию веса q,
+// тег с регионом (ru-RU) подходит к языку без региона, а * — к DefaultLanguage. Если ни один язык не подходит,
+// возвращается DefaultLanguage.
+func (c *Catalog) Negotiate(acceptLanguage string) string {
+	if c == nil || acceptLanguage == "" {
+		return DefaultLanguage
+	}
+	type candidate struct {
+		tag string
+		q   float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.TrimSpace(name) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				parsed = 0
+			}
+			q = parsed
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{tag: tag, q: q})
+		}
+	}
+	// Порядок тегов с равным весом сохраняется: клиент перечисляет предпочтительные раньше
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	for _, cand := range candidates {
+		if cand.tag == "*" {
+			return DefaultLanguage
+		}
+		if _, ok := c.messages[cand.tag]; ok {
+			return cand.tag
+		}
+		if primary, _, _ := strings.Cut(cand.tag, "-"); primary != cand.tag {
+			if _, ok := c.messages[primary]; ok {
+				return primary
+			}
+		}
+	}
+	return DefaultLanguage
+}
@@ -0,0 +1,91 @@
+package i18n
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedCatalogIsComplete(t *testing.T) {
+	c, err := Embedded()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"en", "ru"}, c.Languages())
+	assert.Contains(t, c.Codes(), "order_not_found")
+	assert.Equal(t, "заказ не найден", c.Message("ru", "order_not_found"))
+	assert.Equal(t, "limit должен быть от 1 до 100", c.Message("ru", "limit_invalid", 100))
+	assert.Equal(t, "order not found", c.Message("de", "order_not_found"), "unknown languages fall back to en")
+	assert.Equal(t, "no_such_code", c.Message("en", "no_such_code"))
+}
+
+func TestParseRejectsIncompleteCatalog(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		files fstest.MapFS
+		err   string
+	}{
+		{
+			name:  "missing code",
+			files: fstest.MapFS{"messages/en.json": {Data: []byte(`{"a": "A", "b": "B"}`)}, "messages/ru.json": {Data: []byte(`{"a": "А"}`)}},
+			err:   "ru: b is missing",
+		},
+		{
+			name:  "code only in a translation",
+			files: fstest.MapFS{"messages/en.json": {Data: []byte(`{"a": "A"}`)}, "messages/ru.json": {Data: []byte(`{"a": "А", "c": "В"}`)}},
+			err:   "en: c is missing",
+		},
+		{
+			name:  "empty message",
+			files: fstest.MapFS{"messages/en.json": {Data: []byte(`{"a": "A"}`)}, "messages/ru.json": {Data: []byte(`{"a": ""}`)}},
+			err:   "ru: a is missing",
+		},
+		{
+			name:  "different arguments",
+			files: fstest.MapFS{"messages/en.json": {Data: []byte(`{"a": "limit %d"}`)}, "messages/ru.json": {Data: []byte(`{"a": "лимит %q"}`)}},
+			err:   "ru: a has arguments [%q], en has [%d]",
+		},
+		{
+			name:  "no default language",
+			files: fstest.MapFS{"messages/ru.json": {Data: []byte(`{"a": "А"}`)}},
+			err:   `default language "en" is missing`,
+		},
+		{
+			name:  "invalid json",
+			files: fstest.MapFS{"messages/en.json": {Data: []byte(`{"a":`)}},
+			err:   "messages/en.json",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.files)
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	c, err := Embedded()
+	require.NoError(t, err)
+	for header, want := range map[string]string{
+		"":                               "en",
+		"ru":                             "ru",
+		"RU-ru":                          "ru",
+		"ru-RU,ru;q=0.9,en-US;q=0.8":     "ru",
+		"en-US,en;q=0.9,ru;q=0.8":        "en",
+		"de-DE,de;q=0.9":                 "en",
+		"de, ru;q=0.5":                   "ru",
+		"en;q=0.1, ru;q=0.7":             "ru",
+		"ru;q=0, en":                     "en",
+		"fr, *;q=0.5, ru;q=0.2":          "en",
+		"zh-Hant-TW, ru-Latn-RU;q=0.3":   "ru",
+		"ru;q=oops":                      "en",
+		" ,;q=1, ru ; q=0.4 ":            "ru",
+		"ru-RU;level=1;q=0.8, en;q=0.79": "ru",
+	} {
+		assert.Equal(t, want, c.Negotiate(header), "Accept-Language: %q", header)
+	}
+
+	var none *Catalog
+	assert.Equal(t, DefaultLanguage, none.Negotiate("ru"))
+	assert.Equal(t, "order_not_found", none.Message("ru", "order_not_found"))
+}
@@ -0,0 +1,81 @@
+// Package ids задаёт единые правила идентификаторов заказов для продюсера, консьюмера и API: допустимые длину
+// и символы, приведение к нижнему регистру и генерацию новых идентификаторов.
+package ids
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Границы длины идентификатора заказа в байтах.
+const (
+	MinLen = 1
+	MaxLen = 64
+)
+
+// ErrInvalid возвращается Parse для идентификатора, не соответствующего правилам.
+var ErrInvalid = errors.New("invalid order id")
+
+// OrderID - идентификатор заказа, прошедший проверку Parse и приведённый к нижнему регистру.
+type OrderID string
+
+// String возвращает идентификатор строкой.
+func (id OrderID) String() string { return string(id) }
+
+// Parse проверяет идентификатор заказа — от MinLen до MaxLen латинских букв, цифр и '-' — и возвращает его
+// в нижнем регистре. Идентификаторы, различающиеся только регистром, обозначают один заказ.
+func Parse(s string) (OrderID, error) {
+	if len(s) < MinLen || len(s) > MaxLen {
+		return "", fmt.Errorf("%w: length %d, must be from %d to %d", ErrInvalid, len(s), MinLen, MaxLen)
+	}
+	for i, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r == '-') {
+			return "", fmt.Errorf("%w: character %q at %d, only latin letters, digits and '-' are allowed", ErrInvalid, r, i)
+		}
+	}
+	return OrderID(Normalize(s)), nil
+}
+
+// Normalize приводит идентификатор заказа к нижнему регистру без проверки. Используется для ключей кэша
+// и идентификаторов, прочитанных из базы данных, где могут оставаться заказы с буквами в верхнем регистре.
+func Normalize(s string) string {
+	return strings.ToLower(s)
+}
+
+// Generate возвращает новый случайный идентификатор заказа — UUID версии 4 в нижнем регистре.
+func Generate() OrderID {
+	var b [16]byte
+	_, _ = crand.Read(b[:]) // crypto/rand.Read не возвращает ошибок
+	return formatUUID(b)
+}
+
+// GenerateFrom возвращает идентификатор заказа, как Generate, но из источника r: одинаковый seed даёт одинаковую
+// последовательность идентификаторов (генератор тестовых заказов).
+func GenerateFrom(r *rand.Rand) OrderID {
+	var b [16]byte
+	for i := range b {
+		b[i] = byte(r.Intn(256))
+	}
+	return formatUUID(b)
+}
+
+// formatUUID - UUID версии 4 из случайных байтов b в виде xxxxxxxx-xxxx-4xxx-yxxx-xxxxxxxxxxxx
+func formatUUID(b [16]byte) OrderID {
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	var buf [36]byte
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return OrderID(buf[:])
+}
@@ -0,0 +1,64 @@
+package ids
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	for in, want := range map[string]OrderID{
+		"b563feb7b2b84b6test":                  "b563feb7b2b84b6test",
+		"order-1":                              "order-1",
+		"B563FEB7B2B84B6Test":                  "b563feb7b2b84b6test",
+		"0E5F9A4C-1D2B-4C3E-8F7A-6B5C4D3E2F10": "0e5f9a4c-1d2b-4c3e-8f7a-6b5c4d3e2f10",
+		strings.Repeat("a", MaxLen):            OrderID(strings.Repeat("a", MaxLen)),
+	} {
+		got, err := Parse(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	for _, in := range []string{"", "order 1", "order\r\n1", "order_1", "заказ", "a/b", strings.Repeat("a", MaxLen+1)} {
+		_, err := Parse(in)
+		assert.ErrorIs(t, err, ErrInvalid, in)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "b563feb7b2b84b6test", Normalize("B563feb7B2B84B6TEST"))
+	assert.Equal(t, "order-1", Normalize("order-1"))
+	id, err := Parse("ABC-1")
+	require.NoError(t, err)
+	assert.Equal(t, Normalize("ABC-1"), id.String(), "Parse and Normalize agree")
+}
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestGenerate(t *testing.T) {
+	seen := make(map[OrderID]bool)
+	for i := 0; i < 100; i++ {
+		id := Generate()
+		assert.Regexp(t, uuidV4, id.String())
+		parsed, err := Parse(id.String())
+		require.NoError(t, err)
+		assert.Equal(t, id, parsed, "generated ids are already normalized")
+		assert.False(t, seen[id], "duplicate id %s", id)
+		seen[id] = true
+	}
+}
+
+func TestGenerateFromIsDeterministic(t *testing.T) {
+	a, b := rand.New(rand.NewSource(7)), rand.New(rand.NewSource(7))
+	for i := 0; i < 10; i++ {
+		id := GenerateFrom(a)
+		assert.Regexp(t, uuidV4, id.String())
+		assert.Equal(t, id, GenerateFrom(b))
+	}
+	// Генератор тестовых заказов раньше брал идентификаторы из gofakeit: последовательности для seed сохраняются
+	assert.Equal(t, gofakeit.New(42).UUID(), GenerateFrom(gofakeit.New(42).Rand).String())
+}
@@ -0,0 +1,293 @@
+// Package ingeststats ведёт почасовые счётчики принятых, некорректных и повторных сообщений по отправителям
+// (арендатор, продюсер и покупатель) за последние сутки и отмечает отправителей, доля некорректных сообщений
+// которых в текущем часе резко выросла. Число отслеживаемых отправителей ограничено: при переполнении вытесняется
+// отправитель, сообщений от которого не было дольше всех.
+package ingeststats
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WindowHours - за сколько предыдущих часов хранятся счётчики и считается средняя доля некорректных сообщений.
+const WindowHours = 24
+
+// Outcome - итог обработки сообщения.
+type Outcome int
+
+const (
+	Accepted  Outcome = iota // заказ записан
+	Invalid                  // сообщение не декодировано или заказ не прошёл валидацию
+	Duplicate                // заказ уже сохранён: повтор пропущен или не записан
+)
+
+// Key - отправитель сообщений: арендатор, продюсер из заголовка сообщения ("" — заголовка нет) и покупатель
+// (customer_id заказа; "" — сообщение не декодировано).
+type Key struct {
+	Tenant   string `json:"tenant"`
+	Producer string `json:"producer_id"`
+	Customer string `json:"customer_id"`
+}
+
+// Counts - счётчики сообщений отправителя.
+type Counts struct {
+	Accepted  uint64 `json:"accepted"`
+	Invalid   uint64 `json:"invalid"`
+	Duplicate uint64 `json:"duplicate"`
+}
+
+// Total возвращает число сообщений.
+func (c Counts) Total() uint64 {
+	return c.Accepted + c.Invalid + c.Duplicate
+}
+
+// ErrorRate возвращает долю некорректных сообщений; 0, если сообщений нет.
+func (c Counts) ErrorRate() float64 {
+	if c.Total() == 0 {
+		return 0
+	}
+	return float64(c.Invalid) / float64(c.Total())
+}
+
+func (c Counts) add(o Counts) Counts {
+	return Counts{Accepted: c.Accepted + o.Accepted, Invalid: c.Invalid + o.Invalid, Duplicate: c.Duplicate + o.Duplicate}
+}
+
+func (c Counts) sub(o Counts) Counts {
+	return Counts{Accepted: c.Accepted - o.Accepted, Invalid: c.Invalid - o.Invalid, Duplicate: c.Duplicate - o.Duplicate}
+}
+
+// Row - прирост счётчиков отправителя за час Hour (UTC), ещё не переданный в Flush.
+type Row struct {
+	Key
+	Hour time.Time
+	Counts
+}
+
+// Anomaly - отправитель, доля некорректных сообщений которого в текущем часе больше средней за предыдущие
+// WindowHours часов в Threshold раз.
+type Anomaly struct {
+	Key
+	Hour      time.Time `json:"hour"`       // текущий час (UTC)
+	Current   Counts    `json:"current"`    // сообщения текущего часа
+	ErrorRate float64   `json:"error_rate"` // доля некорректных сообщений текущего часа
+	// TrailingErrorRate - доля некорректных среди всех сообщений предыдущих WindowHours часов
+	TrailingErrorRate float64 `json:"trailing_error_rate"`
+	Trailing          Counts  `json:"trailing"` // сообщения предыдущих WindowHours часов
+}
+
+// bucket - счётчики отправителя за один час
+type bucket struct {
+	hour    time.Time
+	counts  Counts
+	flushed Counts // часть counts, уже переданная в Flush
+}
+
+// series - счётчики отправителя за текущий и WindowHours предыдущих часов; час h хранится в hours[h % len(hours)]
+type series struct {
+	key   Key
+	hours [WindowHours + 1]bucket
+}
+
+// Tracker ведёт счётчики не более чем size отправителей и отмечает аномалии по порогу threshold. Отправитель
+// не отмечается, пока в текущем часе или за предыдущие WindowHours часов от него меньше minMessages сообщений.
+// Tracker безопасен для конкурентного использования.
+type Tracker struct {
+	mu          sync.Mutex
+	size        int
+	threshold   float64
+	minMessages uint64
+	items       map[Key]*list.Element
+	order       *list.List // от давно не присылавших сообщений отправителей к недавним
+	// orphans - непереданный прирост вытесненных отправителей и перезаписанных часов, не больше size строк
+	orphans []Row
+	evicted uint64 // вытесненных отправителей
+	dropped uint64 // строк прироста, отброшенных при переполнении orphans
+}
+
+// NewTracker создает Tracker на size отправителей (size <= 0 означает один) с порогом threshold и минимумом
+// сообщений minMessages.
+func NewTracker(size int, threshold float64, minMessages int) *Tracker {
+	return &Tracker{
+		size:        max(size, 1),
+		threshold:   threshold,
+		minMessages: uint64(max(minMessages, 0)),
+		items:       make(map[Key]*list.Element),
+		order:       list.New(),
+	}
+}
+
+// hourOf - час момента now (UTC) и его место в series.hours
+func hourOf(now time.Time) (time.Time, int) {
+	hour := now.UTC().Truncate(time.Hour)
+	return hour, int(hour.Unix()/3600) % (WindowHours + 1)
+}
+
+// Record учитывает сообщение отправителя key с итогом outcome, полученное в момент now.
+func (t *Tracker) Record(key Key, outcome Outcome, now time.Time) {
+	hour, i := hourOf(now)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var s *series
+	if el, ok := t.items[key]; ok {
+		s = el.Value.(*series)
+		t.order.MoveToBack(el)
+	} else {
+		s = &series{key: key}
+		t.items[key] = t.order.PushBack(s)
+		for t.order.Len() > t.size {
+			oldest := t.order.Front()
+			t.order.Remove(oldest)
+			evicted := oldest.Value.(*series)
+			delete(t.items, evicted.key)
+			t.evicted++
+			for j := range evicted.hours {
+				t.orphan(evicted.key, &evicted.hours[j])
+			}
+		}
+	}
+
+	b := &s.hours[i]
+	if !b.hour.Equal(hour) {
+		t.orphan(key, b)
+		*b = bucket{hour: hour}
+	}
+	switch outcome {
+	case Accepted:
+		b.counts.Accepted++
+	case Invalid:
+		b.counts.Invalid++
+	case Duplicate:
+		b.counts.Duplicate++
+	}
+}
+
+// orphan - сохраняет непереданный прирост часа b отправителя key, который вытесняется или перезаписывается
+func (t *Tracker) orphan(key Key, b *bucket) {
+	delta := b.counts.sub(b.flushed)
+	if delta.Total() == 0 {
+		return
+	}
+	if len(t.orphans) >= t.size {
+		t.dropped++
+		return
+	}
+	t.orphans = append(t.orphans, Row{Key: key, Hour: b.hour, Counts: delta})
+}
+
+// Flush передаёт в persist прирост счётчиков с прошлой успешной передачи. Если persist возвращает ошибку,
+// прирост передаётся ещё раз при следующем вызове. persist вызывается без блокировки: счётчики в это время
+// продолжают расти. Flush не должен вызываться конкурентно с самим собой.
+func (t *Tracker) Flush(persist func([]Row) error) error {
+	t.mu.Lock()
+	rows := make([]Row, 0, len(t.orphans))
+	for el := t.order.Front(); el != nil; el = el.Next() {
+		s := el.Value.(*series)
+		for i := range s.hours {
+			b := &s.hours[i]
+			if delta := b.counts.sub(b.flushed); delta.Total() > 0 {
+				rows = append(rows, Row{Key: s.key, Hour: b.hour, Counts: delta})
+				b.flushed = b.counts
+			}
+		}
+	}
+	fromSeries := len(rows)
+	rows = append(rows, t.orphans...)
+	t.orphans = nil
+	t.mu.Unlock()
+
+	if len(rows) == 0 {
+		return nil
+	}
+	err := persist(rows)
+	if err == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, r := range rows {
+		if i < fromSeries {
+			if el, ok := t.items[r.Key]; ok {
+				_, j := hourOf(r.Hour)
+				if b := &el.Value.(*series).hours[j]; b.hour.Equal(r.Hour) {
+					b.flushed = b.flushed.sub(r.Counts)
+					continue
+				}
+			}
+		}
+		// Час вытеснен или перезаписан во время передачи: прирост ждёт следующей передачи отдельно
+		if len(t.orphans) >= t.size {
+			t.dropped++
+			continue
+		}
+		t.orphans = append(t.orphans, r)
+	}
+	return err
+}
+
+// Anomalies возвращает отправителей с аномальной долей некорректных сообщений в час момента now, начиная
+// с наибольшей доли.
+func (t *Tracker) Anomalies(now time.Time) []Anomaly {
+	hour, _ := hourOf(now)
+	since := hour.Add(-WindowHours * time.Hour)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var list []Anomaly
+	for el := t.order.Front(); el != nil; el = el.Next() {
+		s := el.Value.(*series)
+		var current, trailing Counts
+		for _, b := range s.hours {
+			switch {
+			case b.hour.Equal(hour):
+				current = b.counts
+			case !b.hour.Before(since) && b.hour.Before(hour):
+				trailing = trailing.add(b.counts)
+			}
+		}
+		if current.Total() < t.minMessages || trailing.Total() < t.minMessages || trailing.Total() == 0 {
+			continue
+		}
+		if current.ErrorRate() <= t.threshold*trailing.ErrorRate() {
+			continue
+		}
+		list = append(list, Anomaly{
+			Key:               s.key,
+			Hour:              hour,
+			Current:           current,
+			ErrorRate:         current.ErrorRate(),
+			TrailingErrorRate: trailing.ErrorRate(),
+			Trailing:          trailing,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ErrorRate > list[j].ErrorRate })
+	return list
+}
+
+// Len возвращает число отслеживаемых отправителей.
+func (t *Tracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.order.Len()
+}
+
+// Evicted возвращает число отправителей, вытесненных при переполнении.
+func (t *Tracker) Evicted() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.evicted
+}
+
+// Dropped возвращает число строк прироста, отброшенных без передачи в Flush: вытесненные отправители
+// и перезаписанные часы копили прирост быстрее, чем он передавался.
+func (t *Tracker) Dropped() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
@@ -0,0 +1,113 @@
+package ingeststats
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// start - начало суток в тестах
+var start = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+// recordN - учитывает n сообщений отправителя key с итогом outcome в момент at
+func recordN(tr *Tracker, key Key, outcome Outcome, n int, at time.Time) {
+	for i := 0; i < n; i++ {
+		tr.Record(key, outcome, at)
+	}
+}
+
+// collect - прирост счётчиков, переданный в Flush
+func collect(t *testing.T, tr *Tracker) map[string]Counts {
+	t.Helper()
+	got := make(map[string]Counts)
+	require.NoError(t, tr.Flush(func(rows []Row) error {
+		for _, r := range rows {
+			k := fmt.Sprintf("%s/%s/%s@%s", r.Tenant, r.Producer, r.Customer, r.Hour.Format("15"))
+			got[k] = got[k].add(r.Counts)
+		}
+		return nil
+	}))
+	return got
+}
+
+func TestTrackerFlushesHourlyDeltas(t *testing.T) {
+	tr := NewTracker(10, 2, 1)
+	a := Key{Tenant: "default", Producer: "p1", Customer: "c1"}
+	recordN(tr, a, Accepted, 3, start.Add(10*time.Minute))
+	recordN(tr, a, Invalid, 1, start.Add(20*time.Minute))
+	recordN(tr, a, Duplicate, 2, start.Add(70*time.Minute))
+
+	assert.Equal(t, map[string]Counts{
+		"default/p1/c1@00": {Accepted: 3, Invalid: 1},
+		"default/p1/c1@01": {Duplicate: 2},
+	}, collect(t, tr))
+	assert.Empty(t, collect(t, tr), "nothing is passed twice")
+
+	recordN(tr, a, Accepted, 1, start.Add(80*time.Minute))
+	assert.Equal(t, map[string]Counts{"default/p1/c1@01": {Accepted: 1}}, collect(t, tr))
+}
+
+func TestTrackerRetriesFailedFlush(t *testing.T) {
+	tr := NewTracker(1, 2, 1)
+	a, b := Key{Customer: "a"}, Key{Customer: "b"}
+	recordN(tr, a, Accepted, 2, start)
+
+	require.Error(t, tr.Flush(func(rows []Row) error {
+		// Пока прирост передаётся, отправитель вытесняется другим
+		recordN(tr, b, Invalid, 1, start)
+		return errors.New("db is down")
+	}))
+	recordN(tr, b, Invalid, 1, start)
+	assert.Equal(t, map[string]Counts{"//a@00": {Accepted: 2}, "//b@00": {Invalid: 2}}, collect(t, tr))
+	assert.Equal(t, uint64(1), tr.Evicted())
+	assert.Zero(t, tr.Dropped())
+}
+
+func TestTrackerBoundsKeysByLRU(t *testing.T) {
+	tr := NewTracker(2, 2, 1)
+	recordN(tr, Key{Customer: "a"}, Accepted, 1, start)
+	recordN(tr, Key{Customer: "b"}, Accepted, 1, start)
+	recordN(tr, Key{Customer: "a"}, Accepted, 1, start)
+	recordN(tr, Key{Customer: "c"}, Accepted, 1, start)
+
+	assert.Equal(t, 2, tr.Len())
+	assert.Equal(t, uint64(1), tr.Evicted(), "b saw no messages for the longest time")
+	// Прирост вытесненного отправителя не теряется
+	assert.Equal(t, map[string]Counts{"//a@00": {Accepted: 2}, "//b@00": {Accepted: 1}, "//c@00": {Accepted: 1}}, collect(t, tr))
+}
+
+func TestTrackerAnomalies(t *testing.T) {
+	tr := NewTracker(10, 2, 20)
+	steady, spiking, quiet := Key{Customer: "steady"}, Key{Customer: "spiking"}, Key{Customer: "quiet"}
+	// Сутки по 20 сообщений в час, из них одно некорректное: средняя доля 5%
+	for h := 0; h < WindowHours; h++ {
+		at := start.Add(time.Duration(h) * time.Hour)
+		for _, k := range []Key{steady, spiking, quiet} {
+			recordN(tr, k, Accepted, 19, at)
+			recordN(tr, k, Invalid, 1, at)
+		}
+	}
+	now := start.Add(WindowHours*time.Hour + 30*time.Minute)
+	recordN(tr, steady, Accepted, 18, now)
+	recordN(tr, steady, Invalid, 2, now) // 10%: ровно в два раза больше, не аномалия
+	recordN(tr, spiking, Accepted, 17, now)
+	recordN(tr, spiking, Invalid, 3, now) // 15%
+	recordN(tr, quiet, Invalid, 5, now)   // меньше min_messages сообщений
+
+	list := tr.Anomalies(now)
+	require.Len(t, list, 1)
+	a := list[0]
+	assert.Equal(t, spiking, a.Key)
+	assert.Equal(t, start.Add(WindowHours*time.Hour), a.Hour)
+	assert.Equal(t, Counts{Accepted: 17, Invalid: 3}, a.Current)
+	assert.InDelta(t, 0.15, a.ErrorRate, 1e-9)
+	assert.InDelta(t, 0.05, a.TrailingErrorRate, 1e-9)
+	assert.Equal(t, uint64(WindowHours*20), a.Trailing.Total())
+
+	// Через сутки тишины предыдущих часов с сообщениями нет
+	assert.Empty(t, tr.Anomalies(now.Add(WindowHours*time.Hour)))
+}
@@ -0,0 +1,124 @@
+// Package jsonpool содержит пул буферов для кодирования JSON на нагруженных путях: ответы с заказами, сериализация
+// заказов в кэше, выгрузка, подтверждения записи и уведомления webhooks консьюмера. Буфер из пула переиспользует
+// память прошлых кодирований, а буферы, выросшие больше предела, в пул не возвращаются, чтобы один огромный заказ
+// не удерживал память.
+package jsonpool
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	"l0_test_self/internal/metrics"
+)
+
+// DefaultMaxRetained - предел ёмкости буфера, возвращаемого в пул Default.
+const DefaultMaxRetained = 256 << 10
+
+// Buffer - буфер с кодировщиком JSON, пишущим в него.
+type Buffer struct {
+	bytes.Buffer
+	enc *json.Encoder
+}
+
+// Encode дописывает в буфер JSON значения v с переводом строки в конце, как json.Encoder. При ошибке буфер
+// не изменяется.
+func (b *Buffer) Encode(v any) error {
+	return b.enc.Encode(v)
+}
+
+// Pool - пул буферов Buffer. Pool безопасен для конкурентного использования.
+type Pool struct {
+	pool        sync.Pool
+	maxRetained int
+
+	gets      *metrics.Counter
+	hits      *metrics.Counter
+	discarded *metrics.Counter
+}
+
+// New создает пул, в который возвращаются буферы ёмкостью не больше maxRetained байт; maxRetained <= 0 означает
+// DefaultMaxRetained.
+func New(maxRetained int) *Pool {
+	if maxRetained <= 0 {
+		maxRetained = DefaultMaxRetained
+	}
+	return &Pool{maxRetained: maxRetained, gets: &metrics.Counter{}, hits: &metrics.Counter{}, discarded: &metrics.Counter{}}
+}
+
+// Get возвращает пустой буфер: из пула, если там есть свободный, иначе новый. Буфер нужно вернуть через Put,
+// когда его содержимое больше не используется.
+func (p *Pool) Get() *Buffer {
+	p.gets.Inc()
+	if b, ok := p.pool.Get().(*Buffer); ok {
+		p.hits.Inc()
+		return b
+	}
+	b := &Buffer{}
+	b.enc = json.NewEncoder(&b.Buffer)
+	return b
+}
+
+// Put очищает буфер и возвращает его в пул. Буфер ёмкостью больше предела пула отбрасывается. После Put нельзя
+// использовать ни буфер, ни срезы, полученные из его Bytes.
+func (p *Pool) Put(b *Buffer) {
+	if b.Cap() > p.maxRetained {
+		p.discarded.Inc()
+		return
+	}
+	b.Reset()
+	p.pool.Put(b)
+}
+
+// Marshal возвращает JSON значения v с переводом строки в конце, как его пишет json.Encoder. Значение кодируется
+// в буфер из пула, а результат копируется в срез точного размера, который можно хранить.
+func (p *Pool) Marshal(v any) ([]byte, error) {
+	b := p.Get()
+	defer p.Put(b)
+	if err := b.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(b.Bytes()), nil
+}
+
+// Stats - счётчики обращений к пулу.
+type Stats struct {
+	Gets      uint64 // вызовы Get
+	Hits      uint64 // вызовы Get, получившие буфер из пула
+	Discarded uint64 // буферы, не возвращённые в пул из-за размера
+}
+
+// HitRatio возвращает долю вызовов Get, получивших буфер из пула, или 0, если Get не вызывался.
+func (s Stats) HitRatio() float64 {
+	if s.Gets == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Gets)
+}
+
+// Stats возвращает счётчики обращений к пулу.
+func (p *Pool) Stats() Stats {
+	return Stats{Gets: p.gets.Value(), Hits: p.hits.Value(), Discarded: p.discarded.Value()}
+}
+
+// RegisterMetrics регистрирует счётчики пула в реестре reg под именами с префиксом prefix.
+func (p *Pool) RegisterMetrics(reg *metrics.Registry, prefix string) {
+	reg.RegisterCounter(prefix+"_gets_total", "Buffers taken from the JSON buffer pool.", p.gets)
+	reg.RegisterCounter(prefix+"_hits_total", "Buffers taken from the JSON buffer pool that reused a pooled buffer.", p.hits)
+	reg.RegisterCounter(prefix+"_discarded_total", "Buffers not returned to the JSON buffer pool because they outgrew the size cap.", p.discarded)
+	reg.GaugeFunc(prefix+"_hit_ratio", "Share of JSON buffer pool gets that reused a pooled buffer.", func() float64 {
+		return p.Stats().HitRatio()
+	})
+}
+
+// Default - пул буферов процесса.
+var Default = New(DefaultMaxRetained)
+
+// Get возвращает буфер из пула Default.
+func Get() *Buffer { return Default.Get() }
+
+// Put возвращает буфер в пул Default.
+func Put(b *Buffer) { Default.Put(b) }
+
+// Marshal кодирует v буфером из пула Default, как Pool.Marshal.
+func Marshal(v any) ([]byte, error) { return Default.Marshal(v) }
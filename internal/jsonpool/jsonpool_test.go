@@ -0,0 +1,122 @@
+package jsonpool
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalMatchesEncoder(t *testing.T) {
+	p := New(0)
+	for _, v := range []any{
+		map[string]any{"a": 1, "html": "<b>&</b>"},
+		[]string{"x", "y"},
+		nil,
+	} {
+		want, err := json.Marshal(v)
+		require.NoError(t, err)
+		got, err := p.Marshal(v)
+		require.NoError(t, err)
+		assert.Equal(t, string(want)+"\n", string(got))
+	}
+
+	_, err := p.Marshal(func() {})
+	assert.Error(t, err)
+	b := p.Get()
+	assert.Zero(t, b.Len(), "a failed encode leaves no bytes in the returned buffer")
+}
+
+func TestPoolReusesAndCapsBuffers(t *testing.T) {
+	p := New(1 << 10)
+
+	b := p.Get()
+	require.NoError(t, b.Encode("small"))
+	p.Put(b)
+	b = p.Get()
+	assert.Zero(t, b.Len(), "pooled buffers are reset")
+	require.NoError(t, b.Encode(strings.Repeat("x", 4<<10)))
+	p.Put(b)
+
+	stats := p.Stats()
+	assert.Equal(t, uint64(2), stats.Gets)
+	assert.LessOrEqual(t, stats.Hits, stats.Gets)
+	assert.Equal(t, uint64(1), stats.Discarded, "a buffer over the cap is not retained")
+	assert.InDelta(t, float64(stats.Hits)/2, stats.HitRatio(), 1e-9)
+	assert.Zero(t, Stats{}.HitRatio())
+}
+
+func TestMarshalResultIsOwned(t *testing.T) {
+	p := New(0)
+	first, err := p.Marshal("first")
+	require.NoError(t, err)
+	for range 10 {
+		_, err := p.Marshal("overwrite")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "\"first\"\n", string(first))
+}
+
+func TestConcurrentBuffersDoNotBleed(t *testing.T) {
+	p := New(0)
+	var wg sync.WaitGroup
+	errs := make(chan string, 64)
+	for g := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				v := map[string]string{"id": fmt.Sprintf("%d-%d", g, i), "pad": strings.Repeat("p", (g*i)%512)}
+				b := p.Get()
+				if err := b.Encode(v); err != nil {
+					errs <- err.Error()
+					p.Put(b)
+					return
+				}
+				var got map[string]string
+				if err := json.Unmarshal(b.Bytes(), &got); err != nil || got["id"] != v["id"] || got["pad"] != v["pad"] {
+					errs <- fmt.Sprintf("buffer of %s holds %q", v["id"], b.String())
+				}
+				p.Put(b)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		t.Error(e)
+	}
+}
+
+// BenchmarkMarshal - кодирование крупного значения json.Marshal с переводом строки против буфера из пула
+func BenchmarkMarshal(b *testing.B) {
+	v := make([]map[string]any, 200)
+	for i := range v {
+		v[i] = map[string]any{"chrt_id": i, "name": strings.Repeat("n", 32), "price": i * 10}
+	}
+	p := New(0)
+	b.Run("json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			data, err := json.Marshal(v)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_ = append(data, '\n')
+		}
+	})
+	b.Run("pool", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := p.Get()
+			if err := buf.Encode(v); err != nil {
+				b.Fatal(err)
+			}
+			p.Put(buf)
+		}
+	})
+}
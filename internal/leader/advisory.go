@@ -0,0 +1,95 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// AdvisoryLock - рекомендательная блокировка PostgreSQL уровня сеанса. Пока блокировка удерживается, её соединение
+// не возвращается в пул; при обрыве соединения сервер освобождает блокировку сам, и её может захватить другой экземпляр.
+type AdvisoryLock struct {
+	pool *pgxpool.Pool
+	key  int64
+
+	mu   sync.Mutex
+	conn *pgxpool.Conn // соединение, удерживающее блокировку; nil — блокировка не удерживается
+}
+
+// NewAdvisoryLock создает рекомендательную блокировку с ключом, вычисленным из имени name, на соединениях пула pool.
+func NewAdvisoryLock(pool *pgxpool.Pool, name string) *AdvisoryLock {
+	return &AdvisoryLock{pool: pool, key: LockKey(name)}
+}
+
+// LockKey возвращает ключ рекомендательной блокировки для имени name: неотрицательный хэш FNV-1a.
+func LockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64() & math.MaxInt64)
+}
+
+// TryLock захватывает блокировку на отдельном соединении пула, если её не удерживает другой сеанс.
+func (l *AdvisoryLock) TryLock(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn != nil {
+		return true, nil
+	}
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection for advisory lock: %w", err)
+	}
+	var ok bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&ok); err != nil {
+		conn.Release()
+		return false, fmt.Errorf("failed to try advisory lock: %w", err)
+	}
+	if !ok {
+		conn.Release()
+		return false, nil
+	}
+	l.conn = conn
+	return true, nil
+}
+
+// Held проверяет, что сеанс, захвативший блокировку, жив и по-прежнему её удерживает.
+func (l *AdvisoryLock) Held(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return false, nil
+	}
+	// Ключ bigint хранится в pg_locks двумя половинами: старшая в classid, младшая в objid
+	heldSQL := `SELECT EXISTS (
+                    SELECT 1 FROM pg_locks
+                    WHERE locktype = 'advisory' AND pid = pg_backend_pid() AND granted AND objsubid = 1
+                      AND ((classid::bigint << 32) | objid::bigint) = $1
+                )`
+	var held bool
+	if err := l.conn.QueryRow(ctx, heldSQL, l.key).Scan(&held); err != nil {
+		return false, fmt.Errorf("failed to check advisory lock: %w", err)
+	}
+	return held, nil
+}
+
+// Unlock освобождает блокировку и возвращает соединение в пул. Если освободить блокировку не удалось,
+// соединение закрывается: сервер освобождает блокировки закрытого сеанса сам.
+func (l *AdvisoryLock) Unlock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	conn := l.conn
+	if conn == nil {
+		return nil
+	}
+	l.conn = nil
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_unlock($1)`, l.key); err != nil {
+		_ = conn.Conn().Close(ctx)
+		return fmt.Errorf("failed to release advisory lock: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package leader_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/leader"
+	"l0_test_self/pkg/client/postgres"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newInstancePool - отдельный пул экземпляра к базе данных из config.yaml
+func newInstancePool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	cfg, err := config.Load("../../config.yaml")
+	require.NoError(t, err)
+	pool, err := postgres.NewClient(context.Background(), cfg.Database.ToPostgresConfig(), 1)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestAdvisoryLockElectsSingleLeader(t *testing.T) {
+	ctx := context.Background()
+	lockName := fmt.Sprintf("leader-test-%d", time.Now().UnixNano())
+	a := leader.NewElector("instance-a", leader.NewAdvisoryLock(newInstancePool(t), lockName), nil)
+	b := leader.NewElector("instance-b", leader.NewAdvisoryLock(newInstancePool(t), lockName), nil)
+	t.Cleanup(func() {
+		_ = a.Release(ctx)
+		_ = b.Release(ctx)
+	})
+	var ran atomic.Int32
+	job := func(context.Context) { ran.Add(1) }
+
+	ok, err := a.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = b.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok, "the lock is held by another session")
+	require.NoError(t, a.KeepAlive(ctx))
+	a.Do(ctx, job)
+	b.Do(ctx, job)
+	assert.Equal(t, int32(1), ran.Load(), "exactly one instance runs the job")
+
+	// После освобождения блокировки лидером её захватывает второй экземпляр
+	require.NoError(t, a.Release(ctx))
+	ok, err = b.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, b.KeepAlive(ctx))
+	ok, err = a.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	a.Do(ctx, job)
+	b.Do(ctx, job)
+	assert.Equal(t, int32(2), ran.Load())
+}
@@ -0,0 +1,217 @@
+// Package leader выбирает среди экземпляров сервера одного лидера для фоновых задач, которые достаточно выполнять
+// одному экземпляру: лидер — экземпляр, удерживающий общую блокировку (например, рекомендательную блокировку PostgreSQL).
+package leader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"l0_test_self/internal/metrics"
+)
+
+// Lock - блокировка, которую одновременно удерживает не более одного экземпляра.
+type Lock interface {
+	// TryLock захватывает блокировку, если она свободна, не дожидаясь её освобождения другим экземпляром.
+	TryLock(ctx context.Context) (bool, error)
+	// Held проверяет, что блокировка всё ещё удерживается этим экземпляром.
+	Held(ctx context.Context) (bool, error)
+	// Unlock освобождает блокировку; освобождение неудерживаемой блокировки не является ошибкой.
+	Unlock(ctx context.Context) error
+}
+
+// Instance возвращает идентификатор экземпляра: имя хоста и случайный суффикс, различающий процессы одного хоста.
+func Instance() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return host + "-" + hex.EncodeToString(suffix)
+}
+
+// ErrLost - лидер обнаружил, что больше не удерживает блокировку.
+var ErrLost = errors.New("leadership lost")
+
+// Status - состояние лидерства экземпляра для диагностики.
+type Status struct {
+	Leader bool       `json:"leader"`
+	Since  *time.Time `json:"since,omitempty"` // когда экземпляр стал лидером; пусто, если он не лидер
+}
+
+// Elector - участник выбора лидера: экземпляр становится лидером, захватив блокировку, и перестаёт им быть, освободив
+// её или обнаружив, что она потеряна. Elector безопасен для конкурентного использования; nil Elector означает, что
+// лидер не выбирается и каждый экземпляр считается лидером.
+type Elector struct {
+	instance string
+	lock     Lock
+	onChange func(leader bool) // вызывается при смене лидерства (вне блокировки Elector); может быть nil
+	changes  *metrics.Counter
+
+	mu      sync.Mutex
+	leader  bool
+	since   time.Time
+	term    context.Context    // отменяется при потере лидерства; nil, если экземпляр не лидер
+	endTerm context.CancelFunc // отменяет term
+}
+
+// NewElector создает участника выбора лидера с идентификатором instance, соревнующегося за блокировку lock.
+// onChange, если задан, вызывается с новым состоянием при каждой смене лидерства.
+func NewElector(instance string, lock Lock, onChange func(leader bool)) *Elector {
+	return &Elector{instance: instance, lock: lock, onChange: onChange, changes: &metrics.Counter{}}
+}
+
+// Instance возвращает идентификатор экземпляра.
+func (e *Elector) Instance() string { return e.instance }
+
+// Changes возвращает счётчик смен лидерства этого экземпляра (получений и потерь).
+func (e *Elector) Changes() *metrics.Counter { return e.changes }
+
+// IsLeader сообщает, является ли экземпляр лидером; для nil Elector — всегда true.
+func (e *Elector) IsLeader() bool {
+	if e == nil {
+		return true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Status возвращает состояние лидерства экземпляра.
+func (e *Elector) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := Status{Leader: e.leader}
+	if e.leader {
+		since := e.since
+		s.Since = &since
+	}
+	return s
+}
+
+// TryAcquire пытается стать лидером, захватив блокировку; true — экземпляр лидер (в том числе был им раньше).
+func (e *Elector) TryAcquire(ctx context.Context) (bool, error) {
+	if e.IsLeader() {
+		return true, nil
+	}
+	ok, err := e.lock.TryLock(ctx)
+	if err != nil || !ok {
+		return false, err
+	}
+	e.mu.Lock()
+	e.leader, e.since = true, time.Now()
+	e.term, e.endTerm = context.WithCancel(context.Background())
+	e.mu.Unlock()
+	e.changed(true)
+	return true, nil
+}
+
+// KeepAlive проверяет, что лидер всё ещё удерживает блокировку. Если блокировка потеряна или проверить её
+// не удалось, экземпляр перестаёт быть лидером: задачи, запущенные через Do, отменяются, а блокировка освобождается,
+// чтобы её мог захватить другой экземпляр. Для экземпляра, не являющегося лидером, ничего не делает.
+func (e *Elector) KeepAlive(ctx context.Context) error {
+	if !e.IsLeader() {
+		return nil
+	}
+	held, err := e.lock.Held(ctx)
+	if err == nil && held {
+		return nil
+	}
+	e.resign()
+	if uerr := e.lock.Unlock(ctx); err == nil {
+		err = uerr
+	}
+	if err == nil {
+		err = ErrLost
+	}
+	return err
+}
+
+// Release освобождает лидерство: задачи, запущенные через Do, отменяются, а блокировка освобождается.
+func (e *Elector) Release(ctx context.Context) error {
+	if !e.IsLeader() {
+		return nil
+	}
+	e.resign()
+	return e.lock.Unlock(ctx)
+}
+
+// Do вызывает fn, если экземпляр — лидер, и возвращает false, если нет. Контекст fn отменяется при потере лидерства,
+// чтобы задача уступила новому лидеру, не дожидаясь своего завершения. Для nil Elector fn вызывается всегда.
+func (e *Elector) Do(ctx context.Context, fn func(ctx context.Context)) bool {
+	if e == nil {
+		fn(ctx)
+		return true
+	}
+	e.mu.Lock()
+	term := e.term
+	e.mu.Unlock()
+	if term == nil {
+		return false
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(term, cancel)
+	defer stop()
+	fn(ctx)
+	return true
+}
+
+// Run каждые interval пытается стать лидером или, будучи им, проверяет блокировку, до отмены ctx, после чего
+// освобождает лидерство. Первая попытка выполняется сразу. Ошибки передаются onError, если он задан.
+func (e *Elector) Run(ctx context.Context, interval time.Duration, onError func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var err error
+		if e.IsLeader() {
+			err = e.KeepAlive(ctx)
+		} else {
+			_, err = e.TryAcquire(ctx)
+		}
+		if err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			releaseCtx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+			defer cancel()
+			if err := e.Release(releaseCtx); err != nil && onError != nil {
+				onError(err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// releaseTimeout - ограничение освобождения блокировки при остановке Run
+const releaseTimeout = 5 * time.Second
+
+// resign - снимает лидерство и отменяет задачи текущего срока
+func (e *Elector) resign() {
+	e.mu.Lock()
+	if !e.leader {
+		e.mu.Unlock()
+		return
+	}
+	e.leader, e.since = false, time.Time{}
+	e.endTerm()
+	e.term, e.endTerm = nil, nil
+	e.mu.Unlock()
+	e.changed(false)
+}
+
+// changed - учитывает смену лидерства и сообщает о ней
+func (e *Elector) changed(leader bool) {
+	e.changes.Inc()
+	if e.onChange != nil {
+		e.onChange(leader)
+	}
+}
@@ -0,0 +1,192 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memLocks - блокировки в памяти, общие для нескольких экземпляров одного процесса
+type memLocks struct {
+	mu    sync.Mutex
+	owner *memLock
+	err   error // ошибка проверки блокировки
+}
+
+// memLock - блокировка экземпляра из набора memLocks
+type memLock struct{ locks *memLocks }
+
+func (l *memLock) TryLock(context.Context) (bool, error) {
+	l.locks.mu.Lock()
+	defer l.locks.mu.Unlock()
+	if l.locks.owner != nil && l.locks.owner != l {
+		return false, nil
+	}
+	l.locks.owner = l
+	return true, nil
+}
+
+func (l *memLock) Held(context.Context) (bool, error) {
+	l.locks.mu.Lock()
+	defer l.locks.mu.Unlock()
+	return l.locks.owner == l, l.locks.err
+}
+
+func (l *memLock) Unlock(context.Context) error {
+	l.locks.mu.Lock()
+	defer l.locks.mu.Unlock()
+	if l.locks.owner == l {
+		l.locks.owner = nil
+	}
+	return nil
+}
+
+// newInstances - n участников выбора лидера, соревнующихся за одну блокировку
+func newInstances(locks *memLocks, n int) []*Elector {
+	list := make([]*Elector, n)
+	for i := range list {
+		list[i] = NewElector(Instance(), &memLock{locks: locks}, nil)
+	}
+	return list
+}
+
+// runJob - запускает задачу на каждом экземпляре и возвращает число экземпляров, которые её выполнили
+func runJob(ctx context.Context, instances []*Elector) int {
+	var ran atomic.Int32
+	for _, e := range instances {
+		e.Do(ctx, func(context.Context) { ran.Add(1) })
+	}
+	return int(ran.Load())
+}
+
+func TestInstance(t *testing.T) {
+	a, b := Instance(), Instance()
+	assert.NotEqual(t, a, b, "instances of one host differ by the suffix")
+	assert.Equal(t, a[:strings.LastIndex(a, "-")], b[:strings.LastIndex(b, "-")])
+}
+
+func TestElectorSingleLeaderRunsJob(t *testing.T) {
+	ctx := context.Background()
+	locks := &memLocks{}
+	instances := newInstances(locks, 2)
+	a, b := instances[0], instances[1]
+
+	ok, err := a.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = b.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 1, runJob(ctx, instances), "exactly one instance runs the job")
+	assert.True(t, a.Status().Leader)
+	assert.NotNil(t, a.Status().Since)
+	assert.Equal(t, Status{}, b.Status())
+
+	// После освобождения лидерство переходит к другому экземпляру
+	require.NoError(t, a.Release(ctx))
+	assert.Zero(t, runJob(ctx, instances))
+	ok, err = b.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, a.IsLeader())
+	assert.Equal(t, 1, runJob(ctx, instances))
+	assert.Equal(t, uint64(2), a.Changes().Value())
+	assert.Equal(t, uint64(1), b.Changes().Value())
+}
+
+func TestElectorKeepAliveYieldsLostLeadership(t *testing.T) {
+	ctx := context.Background()
+	locks := &memLocks{}
+	var changes []bool
+	e := NewElector("host-1", &memLock{locks: locks}, func(leader bool) { changes = append(changes, leader) })
+	_, err := e.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.NoError(t, e.KeepAlive(ctx))
+
+	// Задача лидера прерывается, как только он теряет блокировку
+	started, done := make(chan struct{}), make(chan error)
+	go func() {
+		e.Do(ctx, func(ctx context.Context) {
+			close(started)
+			<-ctx.Done()
+			done <- ctx.Err()
+		})
+	}()
+	<-started
+	locks.mu.Lock()
+	locks.err = errors.New("connection reset")
+	locks.mu.Unlock()
+	err = e.KeepAlive(ctx)
+	assert.ErrorContains(t, err, "connection reset")
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job did not yield after leadership was lost")
+	}
+	assert.False(t, e.IsLeader())
+	assert.Nil(t, locks.owner, "the lock is released for other instances")
+	assert.Equal(t, []bool{true, false}, changes)
+
+	// Блокировку захватил другой экземпляр
+	locks.err = nil
+	_, err = e.TryAcquire(ctx)
+	require.NoError(t, err)
+	locks.owner = &memLock{locks: locks}
+	assert.ErrorIs(t, e.KeepAlive(ctx), ErrLost)
+}
+
+func TestElectorRunFailover(t *testing.T) {
+	locks := &memLocks{}
+	instances := newInstances(locks, 2)
+	ctx := context.Background()
+	cancels := make([]context.CancelFunc, len(instances))
+	var wg sync.WaitGroup
+	for i, e := range instances {
+		runCtx, cancel := context.WithCancel(ctx)
+		cancels[i] = cancel
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.Run(runCtx, time.Millisecond, nil)
+		}()
+	}
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+		wg.Wait()
+	}()
+
+	leaderIndex := func() int {
+		for i, e := range instances {
+			if e.IsLeader() {
+				return i
+			}
+		}
+		return -1
+	}
+	require.Eventually(t, func() bool { return leaderIndex() >= 0 }, 5*time.Second, time.Millisecond)
+	first := leaderIndex()
+	assert.Equal(t, 1, runJob(ctx, instances))
+
+	// Остановленный лидер освобождает блокировку, и её захватывает оставшийся экземпляр
+	cancels[first]()
+	require.Eventually(t, func() bool { return leaderIndex() == 1-first }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, 1, runJob(ctx, instances))
+}
+
+func TestNilElectorRunsJobs(t *testing.T) {
+	var e *Elector
+	assert.True(t, e.IsLeader())
+	ran := false
+	assert.True(t, e.Do(context.Background(), func(context.Context) { ran = true }))
+	assert.True(t, ran)
+}
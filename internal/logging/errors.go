@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+// ErrorEntry - ошибка обработки в кольцевом буфере ErrorRing. Тело сообщения (с персональными данными) не хранится:
+// только его координаты в Kafka и текст ошибки.
+type ErrorEntry struct {
+	Time     time.Time `json:"time"`
+	Stage    string    `json:"stage"` // этап обработки, например decode или store
+	Class    string    `json:"class"` // класс ошибки, как в логе
+	OrderUid string    `json:"order_uid,omitempty"`
+	Kafka    *KafkaRef `json:"kafka,omitempty"` // сообщение, если ошибка относится к одному сообщению
+	Message  string    `json:"message"`
+}
+
+// KafkaRef - координаты сообщения Kafka.
+type KafkaRef struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// ErrorRing хранит последние size ошибок: новая ошибка вытесняет самую старую. ErrorRing безопасен для конкурентного
+// использования; буфер нулевого размера ничего не хранит.
+type ErrorRing struct {
+	mu      sync.Mutex
+	entries []ErrorEntry
+	next    int // позиция следующей записи
+	full    bool
+	total   uint64
+}
+
+// NewErrorRing создает буфер на size ошибок (size <= 0 — буфер выключен).
+func NewErrorRing(size int) *ErrorRing {
+	return &ErrorRing{entries: make([]ErrorEntry, max(size, 0))}
+}
+
+// Add добавляет ошибку, вытесняя самую старую при заполненном буфере.
+func (r *ErrorRing) Add(e ErrorEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.total++
+	if len(r.entries) == 0 {
+		return
+	}
+	r.entries[r.next] = e
+	r.next++
+	if r.next == len(r.entries) {
+		r.next, r.full = 0, true
+	}
+}
+
+// Entries возвращает ошибки этапа stage (пустой stage — все) от старых к новым.
+func (r *ErrorRing) Entries(stage string) []ErrorEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ordered := r.entries[:r.next]
+	if r.full {
+		ordered = append(append([]ErrorEntry(nil), r.entries[r.next:]...), r.entries[:r.next]...)
+	}
+	result := make([]ErrorEntry, 0, len(ordered))
+	for _, e := range ordered {
+		if stage == "" || e.Stage == stage {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Clear удаляет все ошибки из буфера и возвращает их количество.
+func (r *ErrorRing) Clear() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.next
+	if r.full {
+		n = len(r.entries)
+	}
+	clear(r.entries)
+	r.next, r.full = 0, false
+	return n
+}
+
+// Size возвращает вместимость буфера.
+func (r *ErrorRing) Size() int { return len(r.entries) }
+
+// Total возвращает число ошибок, добавленных за всё время, включая вытесненные и удалённые.
+func (r *ErrorRing) Total() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.total
+}
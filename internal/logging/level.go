@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+)
+
+// Level - уровень важности записи в лог.
+type Level int
+
+// Уровни записей в лог.
+const (
+	LevelDebug Level = iota // подробности для отладки, по умолчанию не выводятся
+	LevelInfo               // сообщения о работе сервиса
+)
+
+// ParseLevel преобразует уровень из конфигурации: debug или info (пустая строка — info).
+func ParseLevel(s string) (Level, error) {
+	switch s {
+	case "", "info":
+		return LevelInfo, nil
+	case "debug":
+		return LevelDebug, nil
+	default:
+		return 0, fmt.Errorf("invalid log level %q: must be debug or info", s)
+	}
+}
+
+// Leveled - логгер, пропускающий записи ниже заданного уровня.
+type Leveled struct {
+	logger *log.Logger
+	min    Level
+}
+
+// NewLeveled создает Leveled, записывающий в logger записи уровня min и выше.
+func NewLeveled(logger *log.Logger, min Level) *Leveled {
+	return &Leveled{logger: logger, min: min}
+}
+
+// Logf записывает в лог сообщение уровня level, если он не ниже минимального. Записи уровня LevelDebug
+// помечаются префиксом "debug: ".
+func (l *Leveled) Logf(level Level, format string, args ...any) {
+	if level < l.min {
+		return
+	}
+	if level == LevelDebug {
+		format = "debug: " + format
+	}
+	l.logger.Printf(format, args...)
+}
@@ -0,0 +1,179 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactPayload(t *testing.T) {
+	body := []byte(`{"order_uid":"abc","delivery":{"name":"Test","phone":"+9720000000","email":"test@gmail.com"}}`)
+
+	got := RedactPayload(body, 0)
+
+	assert.NotContains(t, got, "+9720000000")
+	assert.NotContains(t, got, "test@gmail.com")
+	assert.Contains(t, got, `"phone":"***"`)
+	assert.Contains(t, got, `"email":"***"`)
+	assert.Contains(t, got, `"order_uid":"abc"`)
+}
+
+func TestRedactPayloadInvalidJSONAndEscapes(t *testing.T) {
+	body := []byte(`{"delivery": {"email" : "a\"b@c.d", "phone": "123"`)
+
+	got := RedactPayload(body, 0)
+
+	assert.NotContains(t, got, "b@c.d")
+	assert.NotContains(t, got, "123")
+}
+
+func TestRedactPayloadTruncates(t *testing.T) {
+	body := []byte(`{"email":"x@y.z","name":"` + strings.Repeat("a", 100) + `"}`)
+
+	got := RedactPayload(body, 20)
+
+	assert.True(t, strings.HasPrefix(got, `{"email":"***"`))
+	assert.True(t, strings.HasSuffix(got, "...(truncated)"))
+	assert.Len(t, got, 20+len("...(truncated)"))
+}
+
+func TestPayloadHashStable(t *testing.T) {
+	assert.Equal(t, PayloadHash([]byte("a")), PayloadHash([]byte("a")))
+	assert.NotEqual(t, PayloadHash([]byte("a")), PayloadHash([]byte("b")))
+	assert.Len(t, PayloadHash([]byte("a")), 16)
+}
+
+func TestSampler(t *testing.T) {
+	s := NewSampler(3, 5)
+
+	var logged []uint64
+	for i := 0; i < 20; i++ {
+		if ok, n := s.Allow("decode"); ok {
+			logged = append(logged, n)
+		}
+	}
+
+	assert.Equal(t, []uint64{1, 2, 3, 8, 13, 18}, logged)
+	assert.Equal(t, map[string]uint64{"decode": 20}, s.Counts())
+}
+
+func TestSamplerClassesIndependent(t *testing.T) {
+	s := NewSampler(1, 100)
+
+	ok, _ := s.Allow("decode")
+	assert.True(t, ok)
+	ok, _ = s.Allow("decode")
+	assert.False(t, ok)
+	ok, _ = s.Allow("validation")
+	assert.True(t, ok)
+
+	assert.Equal(t, map[string]uint64{"decode": 2, "validation": 1}, s.Counts())
+}
+
+func TestSamplerDefaults(t *testing.T) {
+	s := NewSampler(-1, 0)
+	for i := 0; i < 5; i++ {
+		ok, _ := s.Allow("x")
+		assert.True(t, ok)
+	}
+}
+
+// errorMessages - тексты ошибок в порядке буфера
+func errorMessages(entries []ErrorEntry) []string {
+	msgs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		msgs = append(msgs, e.Message)
+	}
+	return msgs
+}
+
+func TestErrorRingWrapsAround(t *testing.T) {
+	r := NewErrorRing(3)
+	assert.Empty(t, r.Entries(""))
+
+	for i := 1; i <= 5; i++ {
+		r.Add(ErrorEntry{Stage: "decode", Message: fmt.Sprintf("e%d", i)})
+	}
+	assert.Equal(t, []string{"e3", "e4", "e5"}, errorMessages(r.Entries("")))
+	assert.Equal(t, uint64(5), r.Total())
+
+	assert.Equal(t, 3, r.Clear())
+	assert.Empty(t, r.Entries(""))
+	r.Add(ErrorEntry{Message: "e6"})
+	assert.Equal(t, []string{"e6"}, errorMessages(r.Entries("")))
+	assert.Equal(t, uint64(6), r.Total(), "clear keeps the total")
+}
+
+func TestErrorRingFiltersByStage(t *testing.T) {
+	r := NewErrorRing(10)
+	r.Add(ErrorEntry{Stage: "decode", Message: "d1"})
+	r.Add(ErrorEntry{Stage: "store", Message: "s1"})
+	r.Add(ErrorEntry{Stage: "decode", Message: "d2"})
+
+	assert.Equal(t, []string{"d1", "d2"}, errorMessages(r.Entries("decode")))
+	assert.Equal(t, []string{"s1"}, errorMessages(r.Entries("store")))
+	assert.Empty(t, r.Entries("commit"))
+	assert.Len(t, r.Entries(""), 3)
+}
+
+func TestErrorRingDisabled(t *testing.T) {
+	r := NewErrorRing(0)
+	r.Add(ErrorEntry{Message: "e1"})
+	assert.Empty(t, r.Entries(""))
+	assert.Equal(t, uint64(1), r.Total())
+	assert.Zero(t, r.Clear())
+}
+
+func TestErrorRingConcurrentAdds(t *testing.T) {
+	const writers, perWriter = 8, 500
+	r := NewErrorRing(100)
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				r.Add(ErrorEntry{Stage: "store", Message: fmt.Sprintf("w%d-%d", w, i)})
+				if i%100 == 0 {
+					_ = r.Entries("store")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries := r.Entries("")
+	require.Len(t, entries, 100)
+	assert.Equal(t, uint64(writers*perWriter), r.Total())
+	// Ни одна запись не потеряна и не продублирована при конкурентной записи
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		assert.False(t, seen[e.Message], e.Message)
+		seen[e.Message] = true
+	}
+}
+
+func TestLeveled(t *testing.T) {
+	var buf strings.Builder
+	l := NewLeveled(log.New(&buf, "", 0), LevelInfo)
+	l.Logf(LevelDebug, "idle %d", 1)
+	l.Logf(LevelInfo, "busy %d", 2)
+	assert.Equal(t, "busy 2\n", buf.String())
+
+	buf.Reset()
+	l = NewLeveled(log.New(&buf, "", 0), LevelDebug)
+	l.Logf(LevelDebug, "idle %d", 1)
+	assert.Equal(t, "debug: idle 1\n", buf.String())
+
+	level, err := ParseLevel("")
+	require.NoError(t, err)
+	assert.Equal(t, LevelInfo, level)
+	_, err = ParseLevel("trace")
+	assert.Error(t, err)
+}
@@ -0,0 +1,26 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+)
+
+// piiFieldRe находит строковые значения полей email и phone в JSON (в том числе в невалидном JSON).
+var piiFieldRe = regexp.MustCompile(`("(?:email|phone)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// PayloadHash возвращает короткий стабильный хэш тела сообщения для ссылок в логах вместо самого тела.
+func PayloadHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:8])
+}
+
+// RedactPayload маскирует значения полей email и phone в теле сообщения и обрезает результат до maxBytes байт.
+// maxBytes <= 0 означает отсутствие ограничения длины.
+func RedactPayload(body []byte, maxBytes int) string {
+	redacted := piiFieldRe.ReplaceAll(body, []byte(`$1"***"`))
+	if maxBytes > 0 && len(redacted) > maxBytes {
+		return string(redacted[:maxBytes]) + "...(truncated)"
+	}
+	return string(redacted)
+}
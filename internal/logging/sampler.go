@@ -0,0 +1,54 @@
+// Package logging содержит вспомогательные средства для безопасного и экономного логирования:
+// выборочное логирование повторяющихся ошибок, маскирование персональных данных в теле сообщений и буфер последних ошибок.
+package logging
+
+import "sync"
+
+// Sampler ограничивает количество записей в лог для повторяющихся классов ошибок:
+// первые first появлений класса логируются всегда, далее — каждое every-е.
+// Счётчики ведутся по всем появлениям, в том числе не попавшим в лог.
+type Sampler struct {
+	mu     sync.Mutex
+	first  uint64
+	every  uint64
+	counts map[string]uint64
+}
+
+// NewSampler создает Sampler. Значения first < 0 трактуются как 0, every <= 0 — как 1 (логировать всё).
+func NewSampler(first, every int) *Sampler {
+	if first < 0 {
+		first = 0
+	}
+	if every <= 0 {
+		every = 1
+	}
+	return &Sampler{
+		first:  uint64(first),
+		every:  uint64(every),
+		counts: make(map[string]uint64),
+	}
+}
+
+// Allow регистрирует очередное появление класса class и сообщает, нужно ли его логировать.
+// Второе значение — порядковый номер появления (начиная с 1), его удобно выводить в лог.
+func (s *Sampler) Allow(class string) (bool, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[class]++
+	n := s.counts[class]
+	if n <= s.first {
+		return true, n
+	}
+	return (n-s.first)%s.every == 0, n
+}
+
+// Counts возвращает копию счётчиков появлений по классам.
+func (s *Sampler) Counts() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]uint64, len(s.counts))
+	for k, v := range s.counts {
+		out[k] = v
+	}
+	return out
+}
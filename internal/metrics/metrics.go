@@ -0,0 +1,264 @@
+// Package metrics содержит минимальный реестр метрик приложения с выводом в текстовом формате Prometheus.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry хранит метрики, зарегистрированные под уникальными именами. Registry безопасен для конкурентного использования.
+type Registry struct {
+	mu      sync.RWMutex
+	metrics map[string]metric
+}
+
+// metric - метрика, умеющая записать своё значение.
+type metric struct {
+	help  string
+	kind  string // gauge, counter или histogram
+	value func() float64
+	// samples - строки значений метрики из нескольких рядов (гистограмма); если задано, value не используется
+	samples func(name string) []string
+}
+
+// NewRegistry создает пустой реестр.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// register добавляет метрику. Повторная регистрация имени — ошибка программирования, поэтому вызывает панику.
+func (r *Registry) register(name, help, kind string, value func() float64) {
+	r.add(name, metric{help: help, kind: kind, value: value})
+}
+
+// add добавляет метрику m под именем name.
+func (r *Registry) add(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic(fmt.Sprintf("metrics: %q already registered", name))
+	}
+	r.metrics[name] = m
+}
+
+// GaugeFunc регистрирует gauge, значение которого вычисляется fn при каждом снятии метрик.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(name, help, "gauge", fn)
+}
+
+// GaugeVecFunc регистрирует gauge с рядами по значениям метки label: fn при каждом снятии метрик возвращает
+// значение для каждого значения метки. Ряды выводятся отсортированными по значению метки.
+func (r *Registry) GaugeVecFunc(name, help, label string, fn func() map[string]float64) {
+	r.add(name, metric{help: help, kind: "gauge", samples: vecSamples(label, fn)})
+}
+
+// CounterVecFunc регистрирует счётчик с рядами по значениям метки label, как GaugeVecFunc. Значения, возвращаемые fn,
+// не должны уменьшаться.
+func (r *Registry) CounterVecFunc(name, help, label string, fn func() map[string]float64) {
+	r.add(name, metric{help: help, kind: "counter", samples: vecSamples(label, fn)})
+}
+
+// vecSamples - строки значений рядов метрики по значениям метки label, отсортированные по значению метки
+func vecSamples(label string, fn func() map[string]float64) func(name string) []string {
+	return func(name string) []string {
+		values := fn()
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		lines := make([]string, 0, len(keys))
+		for _, k := range keys {
+			lines = append(lines, fmt.Sprintf("%s{%s=%q} %s", name, label, k, formatValue(values[k])))
+		}
+		return lines
+	}
+}
+
+// Gauge регистрирует и возвращает gauge с явно устанавливаемым значением.
+func (r *Registry) Gauge(name, help string) *Gauge {
+	g := &Gauge{}
+	r.register(name, help, "gauge", g.Value)
+	return g
+}
+
+// Counter регистрирует и возвращает монотонно растущий счётчик.
+func (r *Registry) Counter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(name, help, "counter", func() float64 { return float64(c.Value()) })
+	return c
+}
+
+// RegisterCounter регистрирует счётчик c, созданный вне реестра, например компонентом, запущенным раньше HTTP сервера.
+func (r *Registry) RegisterCounter(name, help string, c *Counter) {
+	r.register(name, help, "counter", func() float64 { return float64(c.Value()) })
+}
+
+// RegisterHistogram регистрирует гистограмму h, созданную NewHistogram. Гистограмма создаётся отдельно от реестра,
+// чтобы её могли заполнять компоненты, запущенные раньше HTTP сервера.
+func (r *Registry) RegisterHistogram(name, help string, h *Histogram) {
+	r.add(name, metric{help: help, kind: "histogram", samples: h.samples})
+}
+
+// RegisterHistogramVec регистрирует гистограммы hs с рядами по значениям метки label: ключ hs — значение метки.
+// Ряды выводятся отсортированными по значению метки.
+func (r *Registry) RegisterHistogramVec(name, help, label string, hs map[string]*Histogram) {
+	values := make([]string, 0, len(hs))
+	for v := range hs {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	r.add(name, metric{help: help, kind: "histogram", samples: func(name string) []string {
+		var lines []string
+		for _, v := range values {
+			lines = append(lines, hs[v].labeledSamples(name, fmt.Sprintf("%s=%q", label, v))...)
+		}
+		return lines
+	}})
+}
+
+// WriteText записывает все метрики в текстовом формате Prometheus, отсортированными по имени.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make([]metric, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		metrics = append(metrics, r.metrics[name])
+	}
+	r.mu.RUnlock()
+
+	for i, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", names[i], m.help, names[i], m.kind); err != nil {
+			return err
+		}
+		var lines []string
+		if m.samples != nil {
+			lines = m.samples(names[i])
+		} else {
+			lines = []string{names[i] + " " + formatValue(m.value())}
+		}
+		for _, line := range lines {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Handler возвращает HTTP обработчик, отдающий метрики реестра.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WriteText(w)
+	})
+}
+
+// formatValue форматирует значение метрики так, как этого ожидает Prometheus.
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Gauge - метрика с произвольно меняющимся значением.
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// Set устанавливает значение.
+func (g *Gauge) Set(v float64) { g.bits.Store(math.Float64bits(v)) }
+
+// Value возвращает текущее значение.
+func (g *Gauge) Value() float64 { return math.Float64frombits(g.bits.Load()) }
+
+// Counter - монотонно растущий счётчик.
+type Counter struct {
+	n atomic.Uint64
+}
+
+// Inc увеличивает счётчик на единицу.
+func (c *Counter) Inc() { c.n.Add(1) }
+
+// Add увеличивает счётчик на n.
+func (c *Counter) Add(n uint64) { c.n.Add(n) }
+
+// Value возвращает текущее значение.
+func (c *Counter) Value() uint64 { return c.n.Load() }
+
+// Histogram - распределение наблюдаемых значений по корзинам с верхними границами buckets.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64 // верхние границы корзин по возрастанию, без +Inf
+	counts  []uint64  // число значений в каждой корзине (не накопленное); последний элемент — корзина +Inf
+	sum     float64
+	count   uint64
+}
+
+// NewHistogram создает гистограмму с верхними границами корзин buckets; границы сортируются по возрастанию.
+func NewHistogram(buckets []float64) *Histogram {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &Histogram{buckets: b, counts: make([]uint64, len(b)+1)}
+}
+
+// Observe учитывает значение v.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v) // первая граница >= v
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+// Count возвращает число учтённых значений.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// samples - ряды гистограммы в формате Prometheus: накопленные корзины, сумма и количество
+func (h *Histogram) samples(name string) []string {
+	return h.labeledSamples(name, "")
+}
+
+// labeledSamples - ряды гистограммы, как samples, с дополнительными метками labels (например, class="priority")
+func (h *Histogram) labeledSamples(name, labels string) []string {
+	bucketLabels, totalLabels := "", ""
+	if labels != "" {
+		bucketLabels, totalLabels = labels+",", "{"+labels+"}"
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	lines := make([]string, 0, len(h.counts)+2)
+	var cumulative uint64
+	for i, n := range h.counts {
+		cumulative += n
+		le := math.Inf(1)
+		if i < len(h.buckets) {
+			le = h.buckets[i]
+		}
+		lines = append(lines, fmt.Sprintf("%s_bucket{%sle=%q} %d", name, bucketLabels, formatValue(le), cumulative))
+	}
+	return append(lines,
+		fmt.Sprintf("%s_sum%s %s", name, totalLabels, formatValue(h.sum)),
+		fmt.Sprintf("%s_count%s %d", name, totalLabels, h.count))
+}
@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryWriteText(t *testing.T) {
+	reg := NewRegistry()
+	g := reg.Gauge("b_gauge", "A gauge.")
+	c := reg.Counter("a_total", "A counter.")
+	reg.GaugeFunc("c_func", "A computed gauge.", func() float64 { return 2 })
+
+	g.Set(1.5)
+	c.Inc()
+	c.Add(2)
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.WriteText(&buf))
+	assert.Equal(t, `# HELP a_total A counter.
+# TYPE a_total counter
+a_total 3
+# HELP b_gauge A gauge.
+# TYPE b_gauge gauge
+b_gauge 1.5
+# HELP c_func A computed gauge.
+# TYPE c_func gauge
+c_func 2
+`, buf.String())
+}
+
+func TestHistogramWriteText(t *testing.T) {
+	reg := NewRegistry()
+	h := NewHistogram([]float64{1, 0.1})
+	reg.RegisterHistogram("latency_seconds", "A histogram.", h)
+
+	for _, v := range []float64{0.05, 0.1, 0.5, 3} {
+		h.Observe(v)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.WriteText(&buf))
+	assert.Equal(t, `# HELP latency_seconds A histogram.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="1"} 3
+latency_seconds_bucket{le="+Inf"} 4
+latency_seconds_sum 3.65
+latency_seconds_count 4
+`, buf.String())
+	assert.Equal(t, uint64(4), h.Count())
+}
+
+func TestHistogramVecWriteText(t *testing.T) {
+	reg := NewRegistry()
+	fast, slow := NewHistogram([]float64{1}), NewHistogram([]float64{1})
+	reg.RegisterHistogramVec("queue_seconds", "Histograms by class.", "class", map[string]*Histogram{"slow": slow, "fast": fast})
+	fast.Observe(0.5)
+	slow.Observe(2)
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.WriteText(&buf))
+	assert.Equal(t, `# HELP queue_seconds Histograms by class.
+# TYPE queue_seconds histogram
+queue_seconds_bucket{class="fast",le="1"} 1
+queue_seconds_bucket{class="fast",le="+Inf"} 1
+queue_seconds_sum{class="fast"} 0.5
+queue_seconds_count{class="fast"} 1
+queue_seconds_bucket{class="slow",le="1"} 0
+queue_seconds_bucket{class="slow",le="+Inf"} 1
+queue_seconds_sum{class="slow"} 2
+queue_seconds_count{class="slow"} 1
+`, buf.String())
+}
+
+func TestGaugeVecFuncWriteText(t *testing.T) {
+	reg := NewRegistry()
+	reg.GaugeVecFunc("in_flight", "A labeled gauge.", "route", func() map[string]float64 {
+		return map[string]float64{"GET /order": 2, "GET /healthz": 0}
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.WriteText(&buf))
+	assert.Equal(t, `# HELP in_flight A labeled gauge.
+# TYPE in_flight gauge
+in_flight{route="GET /healthz"} 0
+in_flight{route="GET /order"} 2
+`, buf.String())
+}
+
+func TestCounterVecFuncWriteText(t *testing.T) {
+	reg := NewRegistry()
+	reg.CounterVecFunc("kafka_bytes_total", "A labeled counter.", "client", func() map[string]float64 {
+		return map[string]float64{"reader": 1024, "dlq": 0}
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.WriteText(&buf))
+	assert.Equal(t, `# HELP kafka_bytes_total A labeled counter.
+# TYPE kafka_bytes_total counter
+kafka_bytes_total{client="dlq"} 0
+kafka_bytes_total{client="reader"} 1024
+`, buf.String())
+}
+
+func TestRegistryRejectsDuplicateNames(t *testing.T) {
+	reg := NewRegistry()
+	reg.Gauge("dup", "")
+	assert.Panics(t, func() { reg.Counter("dup", "") })
+}
+
+func TestRegistryHandler(t *testing.T) {
+	reg := NewRegistry()
+	reg.GaugeFunc("up", "Always one.", func() float64 { return 1 })
+
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, rec.Body.String(), "up 1\n")
+}
+
+func TestQuantileWindow(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	w := NewQuantileWindow(time.Minute, 1000)
+
+	_, n := w.Quantile(0.99, start)
+	assert.Zero(t, n)
+
+	// 1..100 за первые 100 секунд: в минутное окно на момент start+100s попадают значения 40..100
+	for i := 1; i <= 100; i++ {
+		w.Observe(float64(i), start.Add(time.Duration(i)*time.Second))
+	}
+	p99, n := w.Quantile(0.99, start.Add(100*time.Second))
+	assert.Equal(t, 61, n)
+	assert.Equal(t, 100.0, p99)
+	p50, _ := w.Quantile(0.5, start.Add(100*time.Second))
+	assert.Equal(t, 70.0, p50)
+
+	_, n = w.Quantile(0.99, start.Add(time.Hour))
+	assert.Zero(t, n, "all samples expired")
+}
+
+func TestQuantileWindowKeepsLatestSamples(t *testing.T) {
+	now := time.Now()
+	w := NewQuantileWindow(0, 3)
+	for _, v := range []float64{100, 1, 2, 3} {
+		w.Observe(v, now)
+	}
+	p99, n := w.Quantile(0.99, now)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 3.0, p99, "the oldest sample was overwritten")
+}
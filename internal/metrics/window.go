@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// QuantileWindow хранит значения, наблюдавшиеся за последние span, и вычисляет по ним квантили.
+// Хранится не больше capacity последних значений: при большем потоке квантиль считается по самым свежим.
+// QuantileWindow безопасен для конкурентного использования.
+type QuantileWindow struct {
+	mu      sync.Mutex
+	span    time.Duration
+	samples []windowSample // кольцевой буфер
+	next    int            // позиция следующей записи
+	full    bool
+}
+
+// windowSample - значение и момент его наблюдения
+type windowSample struct {
+	at    time.Time
+	value float64
+}
+
+// NewQuantileWindow создает окно длительностью span (<= 0 — без ограничения по времени) на capacity значений (минимум одно).
+func NewQuantileWindow(span time.Duration, capacity int) *QuantileWindow {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &QuantileWindow{span: span, samples: make([]windowSample, capacity)}
+}
+
+// Observe учитывает значение v, наблюдавшееся в момент at.
+func (w *QuantileWindow) Observe(v float64, at time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.samples[w.next] = windowSample{at: at, value: v}
+	w.next++
+	if w.next == len(w.samples) {
+		w.next, w.full = 0, true
+	}
+}
+
+// Quantile возвращает квантиль q (0 < q <= 1) значений, наблюдавшихся не раньше now-span, методом ближайшего ранга
+// и число таких значений. Без значений в окне возвращает NaN и 0.
+func (w *QuantileWindow) Quantile(q float64, now time.Time) (float64, int) {
+	w.mu.Lock()
+	n := w.next
+	if w.full {
+		n = len(w.samples)
+	}
+	values := make([]float64, 0, n)
+	for _, s := range w.samples[:n] {
+		if w.span <= 0 || !s.at.Before(now.Add(-w.span)) {
+			values = append(values, s.value)
+		}
+	}
+	w.mu.Unlock()
+
+	if len(values) == 0 {
+		return math.NaN(), 0
+	}
+	sort.Float64s(values)
+	rank := int(math.Ceil(q*float64(len(values)))) - 1
+	rank = min(max(rank, 0), len(values)-1)
+	return values[rank], len(values)
+}
@@ -0,0 +1,75 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSigner(t *testing.T, ttl time.Duration) *Signer {
+	t.Helper()
+	s, err := NewSigner([]byte("test-secret"), ttl)
+	require.NoError(t, err)
+	return s
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	s := newTestSigner(t, time.Hour)
+	c := Cursor{Scope: "orders?track_number=WB1", Sort: "updated_at", Value: time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC), OrderUid: "order-1"}
+
+	got, err := s.Decode(s.Encode(c))
+	require.NoError(t, err)
+	assert.Equal(t, c.Scope, got.Scope)
+	assert.Equal(t, c.Sort, got.Sort)
+	assert.Equal(t, c.OrderUid, got.OrderUid)
+	assert.True(t, c.Value.Equal(got.Value), "microseconds are kept")
+}
+
+func TestCursorRejectsTampering(t *testing.T) {
+	s := newTestSigner(t, time.Hour)
+	token := s.Encode(Cursor{Scope: "orders?track_number=WB1", Sort: "date_created", OrderUid: "order-1"})
+	body, sig, _ := strings.Cut(token, ".")
+
+	raw, err := base64.RawURLEncoding.DecodeString(body)
+	require.NoError(t, err)
+	forged := base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(raw), "order-1", "order-9", 1)))
+
+	other, err := NewSigner([]byte("other-secret"), time.Hour)
+	require.NoError(t, err)
+
+	for name, tok := range map[string]string{
+		"forged body":    forged + "." + sig,
+		"no signature":   body,
+		"bad base64":     "!!!." + sig,
+		"empty":          "",
+		"truncated sig":  body + "." + sig[:10],
+		"foreign secret": other.Encode(Cursor{Scope: "orders?track_number=WB1", OrderUid: "order-1"}),
+	} {
+		_, err := s.Decode(tok)
+		assert.ErrorIs(t, err, ErrInvalidCursor, name)
+	}
+}
+
+func TestCursorExpires(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := newTestSigner(t, time.Hour)
+	s.now = func() time.Time { return now }
+	token := s.Encode(Cursor{Scope: "q", OrderUid: "order-1"})
+
+	now = now.Add(59 * time.Minute)
+	_, err := s.Decode(token)
+	require.NoError(t, err)
+
+	now = now.Add(2 * time.Minute)
+	_, err = s.Decode(token)
+	assert.ErrorIs(t, err, ErrExpiredCursor)
+}
+
+func TestNewSignerRequiresSecret(t *testing.T) {
+	_, err := NewSigner(nil, time.Hour)
+	assert.Error(t, err)
+}
@@ -0,0 +1,136 @@
+// Package ratelimit реализует ограниченные по памяти счётчики частоты событий по ключам (например, заказов
+// одного покупателя) со скользящим окном.
+package ratelimit
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+// counter - счётчик ключа: события текущего и предыдущего интервалов длиной в окно и учёт превышений.
+type counter struct {
+	key       string
+	start     time.Time // начало текущего интервала
+	current   int
+	previous  int
+	throttled uint64    // события, превысившие ограничение
+	lastAt    time.Time // момент последнего превышения
+}
+
+// Offender - ключ, события которого превышали ограничение.
+type Offender struct {
+	Key             string    `json:"key"`
+	Throttled       uint64    `json:"throttled"`         // события сверх ограничения, пока ключ хранится в лимитере
+	LastThrottledAt time.Time `json:"last_throttled_at"` // момент последнего превышения
+}
+
+// Limiter ограничивает частоту событий каждого ключа: не больше limit за скользящее окно window. Окно
+// приближается двумя соседними интервалами длиной window: события предыдущего учитываются с весом оставшейся
+// в окне доли, поэтому на ключ хранится фиксированный счётчик, а не время каждого события.
+// Limiter хранит не более size ключей; при переполнении вытесняется ключ, события которого были давнее всего.
+// Limiter безопасен для конкурентного использования.
+type Limiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	size   int
+	items  map[string]*list.Element
+	order  *list.List
+	now    func() time.Time
+}
+
+// NewLimiter создает лимитер на limit событий за window для не более чем size ключей. limit <= 0 или window <= 0
+// создаёт выключенный лимитер, который разрешает любые события; size <= 0 означает один ключ.
+func NewLimiter(limit int, window time.Duration, size int) *Limiter {
+	return &Limiter{
+		limit:  limit,
+		window: window,
+		size:   max(size, 1),
+		items:  make(map[string]*list.Element),
+		order:  list.New(),
+		now:    time.Now,
+	}
+}
+
+// Allow учитывает событие ключа key и сообщает, укладывается ли оно в ограничение. Событие сверх ограничения
+// тоже учитывается: ключ, события которого не прекращаются, остаётся ограниченным.
+func (l *Limiter) Allow(key string) bool {
+	if l.limit <= 0 || l.window <= 0 {
+		return true
+	}
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var c *counter
+	if el, ok := l.items[key]; ok {
+		c = el.Value.(*counter)
+		l.order.MoveToBack(el)
+	} else {
+		c = &counter{key: key, start: now}
+		l.items[key] = l.order.PushBack(c)
+		for l.order.Len() > l.size {
+			oldest := l.order.Front()
+			l.order.Remove(oldest)
+			delete(l.items, oldest.Value.(*counter).key)
+		}
+	}
+	l.advance(c, now)
+	c.current++
+
+	elapsed := now.Sub(c.start)
+	rate := float64(c.current) + float64(c.previous)*float64(l.window-elapsed)/float64(l.window)
+	if rate <= float64(l.limit) {
+		return true
+	}
+	c.throttled++
+	c.lastAt = now
+	return false
+}
+
+// advance - сдвигает интервалы счётчика c к моменту now
+func (l *Limiter) advance(c *counter, now time.Time) {
+	elapsed := now.Sub(c.start)
+	switch {
+	case elapsed < l.window:
+	case elapsed < 2*l.window:
+		c.previous, c.current = c.current, 0
+		c.start = c.start.Add(l.window)
+	default:
+		c.previous, c.current = 0, 0
+		c.start = now
+	}
+}
+
+// Top возвращает не более n ключей с наибольшим числом событий сверх ограничения, начиная с наибольшего.
+func (l *Limiter) Top(n int) []Offender {
+	l.mu.Lock()
+	var offenders []Offender
+	for el := l.order.Front(); el != nil; el = el.Next() {
+		if c := el.Value.(*counter); c.throttled > 0 {
+			offenders = append(offenders, Offender{Key: c.key, Throttled: c.throttled, LastThrottledAt: c.lastAt})
+		}
+	}
+	l.mu.Unlock()
+
+	sort.Slice(offenders, func(i, j int) bool {
+		if offenders[i].Throttled != offenders[j].Throttled {
+			return offenders[i].Throttled > offenders[j].Throttled
+		}
+		return offenders[i].Key < offenders[j].Key
+	})
+	if len(offenders) > n {
+		offenders = offenders[:n]
+	}
+	return offenders
+}
+
+// Len возвращает количество хранимых ключей.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestLimiter - лимитер на limit событий в минуту с управляемыми часами
+func newTestLimiter(limit, size int) (*Limiter, *time.Time) {
+	l := NewLimiter(limit, time.Minute, size)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLimiterAllow(t *testing.T) {
+	l, now := newTestLimiter(3, 10)
+	for i := 0; i < 3; i++ {
+		assert.True(t, l.Allow("a"), "event %d", i)
+	}
+	assert.False(t, l.Allow("a"))
+	assert.True(t, l.Allow("b"), "other keys are counted separately")
+
+	// Через полминуты половина событий предыдущего интервала ещё в окне
+	*now = now.Add(90 * time.Second)
+	assert.True(t, l.Allow("a"), "1 + 4*0.5 = 3 events in the window")
+	assert.False(t, l.Allow("a"))
+
+	*now = now.Add(3 * time.Minute)
+	assert.True(t, l.Allow("a"), "the window is empty after a long pause")
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	for _, l := range []*Limiter{NewLimiter(0, time.Minute, 10), NewLimiter(1, 0, 10)} {
+		for i := 0; i < 10; i++ {
+			assert.True(t, l.Allow("a"))
+		}
+		assert.Empty(t, l.Top(10))
+	}
+}
+
+func TestLimiterEvictsLeastRecentKey(t *testing.T) {
+	l, _ := newTestLimiter(1, 2)
+	l.Allow("a")
+	l.Allow("a")
+	l.Allow("b")
+	l.Allow("a")
+	l.Allow("c") // вытесняет b
+	assert.Equal(t, 2, l.Len())
+	assert.Equal(t, []Offender{{Key: "a", Throttled: 2, LastThrottledAt: l.now()}}, l.Top(10))
+	assert.True(t, l.Allow("b"), "an evicted key starts over")
+}
+
+func TestLimiterTop(t *testing.T) {
+	l, _ := newTestLimiter(1, 10)
+	for i, key := range []string{"a", "b", "c"} {
+		for j := 0; j <= i+1; j++ {
+			l.Allow(key)
+		}
+	}
+	l.Allow("d")
+	top := l.Top(2)
+	require.Len(t, top, 2)
+	assert.Equal(t, "c", top[0].Key)
+	assert.Equal(t, uint64(3), top[0].Throttled)
+	assert.Equal(t, Offender{Key: "b", Throttled: 2, LastThrottledAt: l.now()}, top[1])
+}
+
+func TestLimiterConcurrentUse(t *testing.T) {
+	l := NewLimiter(100, time.Minute, 8)
+	var wg sync.WaitGroup
+	allowed := make([]int, 4)
+	for g := range allowed {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if l.Allow("hot") {
+					allowed[g]++
+				}
+				l.Allow(fmt.Sprintf("k%d", i%16))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 100, allowed[0]+allowed[1]+allowed[2]+allowed[3])
+	assert.LessOrEqual(t, l.Len(), 8)
+}
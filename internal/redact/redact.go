@@ -0,0 +1,43 @@
+// Package redact содержит функции маскирования персональных данных в ответах API.
+// Функции работают с символами (рунами), а не байтами, поэтому не разрывают многобайтовые символы.
+package redact
+
+import "strings"
+
+const (
+	// phoneVisiblePrefix и phoneVisibleSuffix - сколько символов телефона остаются видимыми в начале и в конце
+	phoneVisiblePrefix = 4
+	phoneVisibleSuffix = 2
+	// phoneMinVisibleLen - телефон короче этого маскируется полностью: иначе видимая часть раскрывала бы почти весь номер
+	phoneMinVisibleLen = 8
+	// emailMask - замена скрытой части адреса; фиксированной длины, чтобы не раскрывать длину имени
+	emailMask = "***"
+)
+
+// Phone маскирует номер телефона, оставляя первые 4 и последние 2 символа: "+9720000000" -> "+972*****00".
+// Короткие значения заменяются звёздочками целиком, пустая строка остаётся пустой.
+func Phone(s string) string {
+	runes := []rune(s)
+	if len(runes) < phoneMinVisibleLen {
+		return strings.Repeat("*", len(runes))
+	}
+	hidden := len(runes) - phoneVisiblePrefix - phoneVisibleSuffix
+	return string(runes[:phoneVisiblePrefix]) + strings.Repeat("*", hidden) + string(runes[len(runes)-phoneVisibleSuffix:])
+}
+
+// Email маскирует имя почтового адреса, оставляя первый символ и домен: "test@gmail.com" -> "t***@gmail.com".
+// Имя из одного символа скрывается полностью; значение без '@' маскируется как имя. Пустая строка остаётся пустой.
+func Email(s string) string {
+	if s == "" {
+		return ""
+	}
+	local, domain := s, ""
+	if at := strings.LastIndexByte(s, '@'); at >= 0 {
+		local, domain = s[:at], s[at:]
+	}
+	runes := []rune(local)
+	if len(runes) < 2 {
+		return emailMask + domain
+	}
+	return string(runes[0]) + emailMask + domain
+}
@@ -0,0 +1,45 @@
+package redact
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhone(t *testing.T) {
+	cases := map[string]string{
+		"+9720000000": "+972*****00",
+		"89161234567": "8916*****67",
+		"12345678":    "1234**78",
+		"1234567":     "*******",
+		"12":          "**",
+		"":            "",
+		"+٩٧٢٠٠٠٠٠٠٠": "+٩٧٢*****٠٠",
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, Phone(in), in)
+	}
+}
+
+func TestEmail(t *testing.T) {
+	cases := map[string]string{
+		"test@gmail.com":       "t***@gmail.com",
+		"ab@x.io":              "a***@x.io",
+		"a@x.io":               "***@x.io",
+		"@x.io":                "***@x.io",
+		"no-at-sign":           "n***",
+		"x":                    "***",
+		"":                     "",
+		"quoted@at\"@x.io":     "q***@x.io",
+		"иван.петров@почта.рф": "и***@почта.рф",
+		"日本@例え.jp":             "日***@例え.jp",
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, Email(in), in)
+	}
+}
+
+func TestMaskedValuesDoNotLeakOriginal(t *testing.T) {
+	assert.NotContains(t, Phone("+79990001122"), "99900011")
+	assert.NotContains(t, Email("secret.name@example.com"), "secret")
+}
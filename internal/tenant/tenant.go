@@ -0,0 +1,39 @@
+// Package tenant описывает арендаторов — маркетплейсы, заказы которых обрабатываются одним сервисом,
+// но хранятся и читаются раздельно. Идентификатор заказа уникален только в пределах арендатора.
+package tenant
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Default - арендатор развёртывания без секции tenants; ему принадлежат заказы, сохранённые до появления арендаторов.
+const Default = "default"
+
+// maxIDLength - максимальная длина идентификатора арендатора
+const maxIDLength = 32
+
+// ErrRequired возвращается функциями чтения и записи заказов, вызванными без арендатора.
+var ErrRequired = errors.New("tenant is required")
+
+// Validate проверяет идентификатор арендатора: от 1 до 32 символов из строчных латинских букв, цифр, '-' и '_'.
+// Разделитель ключа Key в идентификаторе недопустим, поэтому ключи разных арендаторов не совпадают.
+func Validate(id string) error {
+	if id == "" {
+		return ErrRequired
+	}
+	if len(id) > maxIDLength {
+		return fmt.Errorf("invalid tenant %q: longer than %d characters", id, maxIDLength)
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r == '-' || r == '_') {
+			return fmt.Errorf("invalid tenant %q: only lowercase letters, digits, '-' and '_' are allowed", id)
+		}
+	}
+	return nil
+}
+
+// Key возвращает ключ заказа uid арендатора id, уникальный среди всех арендаторов, например "market-b/b563feb7".
+func Key(id, uid string) string {
+	return id + "/" + uid
+}
@@ -0,0 +1,23 @@
+package tenant
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	for _, id := range []string{Default, "market-b", "wb_2", strings.Repeat("a", maxIDLength)} {
+		assert.NoError(t, Validate(id), id)
+	}
+	assert.ErrorIs(t, Validate(""), ErrRequired)
+	for _, id := range []string{"Market", "market/b", "market b", strings.Repeat("a", maxIDLength+1)} {
+		assert.Error(t, Validate(id), id)
+	}
+}
+
+func TestKeysOfDifferentTenantsDiffer(t *testing.T) {
+	assert.Equal(t, "market-b/b563feb7", Key("market-b", "b563feb7"))
+	assert.NotEqual(t, Key("a", "b-c"), Key("a-b", "c"))
+}
@@ -0,0 +1,121 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"l0_test_self/internal/metrics"
+	"l0_test_self/models/orders"
+)
+
+// CurrencyMode - действие с платежом, валюта которого не найдена в таблице ISO 4217.
+type CurrencyMode int32
+
+// Режимы проверки валют платежей.
+const (
+	CurrencyReject CurrencyMode = iota // заказ отклоняется (по умолчанию)
+	CurrencyFlag                       // заказ принимается, валюта сохраняется как есть с замечанием в Order.Warnings
+)
+
+// ErrUnknownCurrency возвращается в режиме CurrencyReject, если валюта платежа не найдена в таблице ISO 4217.
+var ErrUnknownCurrency = errors.New("unknown payment currency")
+
+// isoCurrencies - действующие коды валют ISO 4217
+var isoCurrencies = makeCurrencySet(`
+	AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF BMD BND BOB BRL BSD BTN BWP BYN BZD
+	CAD CDF CHF CLP CNY COP CRC CUP CVE CZK DJF DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD
+	GNF GTQ GYD HKD HNL HTG HUF IDR ILS INR IQD IRR ISK JMD JOD JPY KES KGS KHR KMF KPW KRW KWD KYD KZT
+	LAK LBP LKR LRD LSL LYD MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MYR MZN NAD NGN NIO NOK NPR
+	NZD OMR PAB PEN PGK PHP PKR PLN PYG QAR RON RSD RUB RWF SAR SBD SCR SDG SEK SGD SHP SLE SOS SRD SSP
+	STN SVC SYP SZL THB TJS TMT TND TOP TRY TTD TWD TZS UAH UGX USD UYU UZS VES VND VUV WST XAF XCD XOF
+	XPF YER ZAR ZMW ZWL`)
+
+// currencyAliases - встречающиеся во входящих сообщениях обозначения валют (в верхнем регистре) и их коды ISO 4217
+var currencyAliases = map[string]string{
+	"US$":  "USD",
+	"€":    "EUR",
+	"EURO": "EUR",
+	"£":    "GBP",
+	"₽":    "RUB",
+	"RUR":  "RUB",
+	"РУБ":  "RUB",
+	"BYR":  "BYN",
+	"₸":    "KZT",
+}
+
+// makeCurrencySet - множество кодов из строки, разделённой пробелами
+func makeCurrencySet(codes string) map[string]bool {
+	set := make(map[string]bool)
+	for _, code := range strings.Fields(codes) {
+		set[code] = true
+	}
+	return set
+}
+
+var currencyMode atomic.Int32
+
+// unknownCurrencies - число платежей с валютой не из таблицы ISO 4217 (отклонённых и отмеченных)
+var unknownCurrencies = &metrics.Counter{}
+
+// ParseCurrencyMode преобразует значение validation.currency.mode из конфигурации: reject (или пустая строка) или flag.
+func ParseCurrencyMode(s string) (CurrencyMode, error) {
+	switch s {
+	case "", "reject":
+		return CurrencyReject, nil
+	case "flag":
+		return CurrencyFlag, nil
+	default:
+		return 0, fmt.Errorf("invalid currency mode %q: must be reject or flag", s)
+	}
+}
+
+// SetCurrencyMode задаёт действие с платежом, валюта которого не найдена в таблице ISO 4217.
+func SetCurrencyMode(mode CurrencyMode) {
+	currencyMode.Store(int32(mode))
+}
+
+// UnknownCurrencies возвращает счётчик платежей с валютой не из таблицы ISO 4217 для регистрации в реестре метрик.
+func UnknownCurrencies() *metrics.Counter {
+	return unknownCurrencies
+}
+
+// NormalizeCurrency приводит обозначение валюты к коду ISO 4217: пробелы по краям отбрасываются, буквы переводятся
+// в верхний регистр, а известные обозначения вроде "US$" заменяются кодом. false — код не найден в таблице ISO 4217.
+func NormalizeCurrency(s string) (string, bool) {
+	code := strings.ToUpper(strings.TrimSpace(s))
+	if alias, ok := currencyAliases[code]; ok {
+		code = alias
+	}
+	return code, isoCurrencies[code]
+}
+
+// CheckCurrencies приводит валюты платежей заказа к кодам ISO 4217 (NormalizeCurrency). Платёж без валюты
+// не проверяется. Валюта не из таблицы в режиме CurrencyReject возвращается как ErrUnknownCurrency, а в режиме
+// CurrencyFlag остаётся без изменений и добавляется в o.Warnings.
+func CheckCurrencies(o *orders.Order) error {
+	mode := CurrencyMode(currencyMode.Load())
+	for i := range o.Payments {
+		p := &o.Payments[i]
+		if p.Currency == "" {
+			continue
+		}
+		code, ok := NormalizeCurrency(p.Currency)
+		if ok {
+			p.Currency = code
+			continue
+		}
+		unknownCurrencies.Inc()
+		if mode == CurrencyReject {
+			return atField(fmt.Sprintf("payments[%d].currency", i), "currency",
+				fmt.Errorf("%w: payments[%d] currency %q", ErrUnknownCurrency, i, p.Currency))
+		}
+		o.Warnings = append(o.Warnings, orders.Warning{
+			Field:   fmt.Sprintf("payments[%d].currency", i),
+			Value:   p.Currency,
+			Message: "currency is not an ISO 4217 code",
+		})
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package validation
+
+import (
+	"testing"
+
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeCurrency(t *testing.T) {
+	for in, want := range map[string]string{"usd": "USD", "USD": "USD", " Eur ": "EUR", "US$": "USD", "us$": "USD", "€": "EUR", "rur": "RUB"} {
+		got, ok := NormalizeCurrency(in)
+		assert.True(t, ok, in)
+		assert.Equal(t, want, got, in)
+	}
+	for _, junk := range []string{"", "XXX", "dollars", "US", "12$"} {
+		_, ok := NormalizeCurrency(junk)
+		assert.False(t, ok, junk)
+	}
+}
+
+func TestParseCurrencyMode(t *testing.T) {
+	for s, want := range map[string]CurrencyMode{"": CurrencyReject, "reject": CurrencyReject, "flag": CurrencyFlag} {
+		got, err := ParseCurrencyMode(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	_, err := ParseCurrencyMode("off")
+	assert.Error(t, err)
+}
+
+// currencyOrder - корректный заказ с платежами в валютах currencies
+func currencyOrder(currencies ...string) orders.Order {
+	o := testorders.NewGenerator(7).Order(testorders.ScenarioDefault)
+	payment := o.Payments[0]
+	o.Payments = nil
+	for _, c := range currencies {
+		payment.Currency = c
+		o.Payments = append(o.Payments, payment)
+	}
+	return o
+}
+
+func TestValidateOrderNormalizesCurrencies(t *testing.T) {
+	SetCurrencyMode(CurrencyReject)
+	o := currencyOrder("usd", "US$", "Eur")
+	require.NoError(t, ValidateOrder(&o))
+	assert.Equal(t, "USD", o.Payments[0].Currency)
+	assert.Equal(t, "USD", o.Payments[1].Currency)
+	assert.Equal(t, "EUR", o.Payments[2].Currency)
+	assert.Empty(t, o.Warnings)
+}
+
+func TestValidateOrderUnknownCurrency(t *testing.T) {
+	t.Cleanup(func() { SetCurrencyMode(CurrencyReject) })
+	before := UnknownCurrencies().Value()
+
+	SetCurrencyMode(CurrencyReject)
+	o := currencyOrder("usd", "monopoly money")
+	assert.ErrorIs(t, ValidateOrder(&o), ErrUnknownCurrency)
+
+	SetCurrencyMode(CurrencyFlag)
+	o = currencyOrder("usd", "monopoly money")
+	require.NoError(t, ValidateOrder(&o))
+	assert.Equal(t, "USD", o.Payments[0].Currency)
+	assert.Equal(t, "monopoly money", o.Payments[1].Currency, "unknown currency is stored as received")
+	require.Len(t, o.Warnings, 1)
+	assert.Equal(t, "payments[1].currency", o.Warnings[0].Field)
+	assert.Equal(t, before+2, UnknownCurrencies().Value())
+}
@@ -0,0 +1,151 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"l0_test_self/internal/metrics"
+	"l0_test_self/models/orders"
+)
+
+// ErrInvalidPostalCode возвращается в режиме PostalReject, если индекс доставки не соответствует формату её региона.
+var ErrInvalidPostalCode = errors.New("invalid delivery postal code")
+
+// PostalValidator проверяет почтовые индексы доставки по региону.
+type PostalValidator interface {
+	// CheckPostalCode проверяет индекс zip региона region. known равно false, если формат индексов региона
+	// неизвестен и индекс не проверялся; err описывает несоответствие индекса формату.
+	CheckPostalCode(region, zip string) (known bool, err error)
+}
+
+// PostalMode - действие при несоответствии индекса доставки формату её региона.
+type PostalMode int
+
+// Режимы проверки индексов доставки.
+const (
+	PostalOff    PostalMode = iota // индексы не проверяются
+	PostalReject                   // заказ отклоняется
+	PostalFlag                     // заказ принимается, несоответствие сохраняется в Order.Warnings
+)
+
+// ParsePostalMode преобразует значение validation.postal_codes.mode из конфигурации: off (или пустая строка), reject или flag.
+func ParsePostalMode(s string) (PostalMode, error) {
+	switch s {
+	case "", "off":
+		return PostalOff, nil
+	case "reject":
+		return PostalReject, nil
+	case "flag":
+		return PostalFlag, nil
+	default:
+		return 0, fmt.Errorf("invalid postal code mode %q: must be off, reject or flag", s)
+	}
+}
+
+// PostalTable - PostalValidator по таблице регулярных выражений индексов регионов.
+// Регионы сравниваются без учёта регистра и пробелов по краям.
+type PostalTable struct {
+	formats map[string]*regexp.Regexp
+}
+
+// CompilePostalTable компилирует таблицу форматов индексов: регион → регулярное выражение (синтаксис RE2),
+// которому индекс должен соответствовать целиком. Пустой регион, регионы, совпадающие без учёта регистра,
+// и некорректные выражения — ошибки.
+func CompilePostalTable(formats map[string]string) (*PostalTable, error) {
+	t := &PostalTable{formats: make(map[string]*regexp.Regexp, len(formats))}
+	for region, pattern := range formats {
+		key := normalizeRegion(region)
+		if key == "" {
+			return nil, errors.New("empty region")
+		}
+		if _, dup := t.formats[key]; dup {
+			return nil, fmt.Errorf("region %q is listed more than once", region)
+		}
+		re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("region %q: invalid pattern: %w", region, err)
+		}
+		t.formats[key] = re
+	}
+	return t, nil
+}
+
+// CheckPostalCode проверяет индекс zip по формату региона region.
+func (t *PostalTable) CheckPostalCode(region, zip string) (bool, error) {
+	re, ok := t.formats[normalizeRegion(region)]
+	if !ok {
+		return false, nil
+	}
+	if !re.MatchString(zip) {
+		return true, fmt.Errorf("zip %q does not match the format of region %q", zip, region)
+	}
+	return true, nil
+}
+
+// normalizeRegion - ключ региона в таблице форматов
+func normalizeRegion(region string) string {
+	return strings.ToLower(strings.TrimSpace(region))
+}
+
+var (
+	postalMu        sync.RWMutex
+	postalValidator PostalValidator
+	postalMode      PostalMode
+)
+
+var (
+	// postalUnknownRegions - число проверенных заказов, формат индексов региона которых неизвестен
+	postalUnknownRegions = &metrics.Counter{}
+	// postalInvalidCodes - число заказов с индексом, не соответствующим формату региона
+	postalInvalidCodes = &metrics.Counter{}
+)
+
+// SetPostalValidator задаёт проверку индексов доставки и действие при несоответствии. nil или PostalOff отключают проверку.
+func SetPostalValidator(pv PostalValidator, mode PostalMode) {
+	postalMu.Lock()
+	postalValidator, postalMode = pv, mode
+	postalMu.Unlock()
+}
+
+// PostalUnknownRegions возвращает счётчик заказов, индекс которых не проверен из-за неизвестного региона,
+// для регистрации в реестре метрик.
+func PostalUnknownRegions() *metrics.Counter {
+	return postalUnknownRegions
+}
+
+// PostalInvalidCodes возвращает счётчик заказов с индексом, не соответствующим формату региона (отклонённых и отмеченных),
+// для регистрации в реестре метрик.
+func PostalInvalidCodes() *metrics.Counter {
+	return postalInvalidCodes
+}
+
+// CheckPostalCode проверяет индекс доставки заказа валидатором SetPostalValidator, если у доставки заданы и регион, и индекс.
+// Заказ с неизвестным регионом принимается без проверки. В режиме PostalReject несоответствие возвращается как
+// ErrInvalidPostalCode, а в режиме PostalFlag добавляется в o.Warnings.
+func CheckPostalCode(o *orders.Order) error {
+	postalMu.RLock()
+	pv, mode := postalValidator, postalMode
+	postalMu.RUnlock()
+
+	region, zip := o.Delivery.Region, o.Delivery.Zip
+	if pv == nil || mode == PostalOff || region == "" || zip == "" {
+		return nil
+	}
+	known, err := pv.CheckPostalCode(region, zip)
+	if !known {
+		postalUnknownRegions.Inc()
+		return nil
+	}
+	if err == nil {
+		return nil
+	}
+	postalInvalidCodes.Inc()
+	if mode == PostalReject {
+		return atField("delivery.zip", "postal_code", fmt.Errorf("%w: %v", ErrInvalidPostalCode, err))
+	}
+	o.Warnings = append(o.Warnings, orders.Warning{Field: "delivery.zip", Value: zip, Message: err.Error()})
+	return nil
+}
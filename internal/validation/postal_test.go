@@ -0,0 +1,154 @@
+package validation
+
+import (
+	"testing"
+
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPostalFormats - форматы индексов нескольких стран и регионов, как в config.yaml
+var testPostalFormats = map[string]string{
+	"Московская область": `\d{6}`,
+	"Zürich":             `\d{4}`,
+	"California":         `9[0-6]\d{3}(-\d{4})?`,
+	"United Kingdom":     `[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}`,
+	"Canada":             `[A-Z]\d[A-Z] ?\d[A-Z]\d`,
+}
+
+func TestPostalTable(t *testing.T) {
+	table, err := CompilePostalTable(testPostalFormats)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		region, zip string
+		known, ok   bool
+	}{
+		{"Московская область", "141700", true, true},
+		{"Московская область", "14170", true, false},
+		{"Московская область", "1417000", true, false},
+		{"московская область", "141700", true, true}, // регион без учёта регистра
+		{"Zürich", "8001", true, true},
+		{"Zürich", "80011", true, false},
+		{" california ", "94103", true, true},
+		{"California", "94103-1234", true, true},
+		{"California", "10001", true, false},
+		{"California", "941O3", true, false},
+		{"United Kingdom", "SW1A 1AA", true, true},
+		{"United Kingdom", "SW1A1AA", true, true},
+		{"United Kingdom", "12345", true, false},
+		{"Canada", "K1A 0B1", true, true},
+		{"Canada", "K1A-0B1", true, false},
+		{"Bavaria", "garbage", false, true},
+	} {
+		known, err := table.CheckPostalCode(tc.region, tc.zip)
+		assert.Equal(t, tc.known, known, "%s %s", tc.region, tc.zip)
+		assert.Equal(t, tc.ok, err == nil, "%s %s: %v", tc.region, tc.zip, err)
+	}
+
+	_, err = CompilePostalTable(map[string]string{"Zürich": `\d{4}`, "ZÜRICH": `\d{4}`})
+	assert.Error(t, err, "duplicate region")
+	_, err = CompilePostalTable(map[string]string{" ": `\d{4}`})
+	assert.Error(t, err, "empty region")
+	_, err = CompilePostalTable(map[string]string{"Zürich": `[0-9`})
+	assert.Error(t, err, "invalid pattern")
+}
+
+// postalOrder - заказ с доставкой в регион region с индексом zip
+func postalOrder(region, zip string) orders.Order {
+	o := testorders.NewGenerator(7).Order(testorders.ScenarioDefault)
+	o.Delivery.Region, o.Delivery.Zip = region, zip
+	return o
+}
+
+func TestCheckPostalCode(t *testing.T) {
+	table, err := CompilePostalTable(testPostalFormats)
+	require.NoError(t, err)
+	t.Cleanup(func() { SetPostalValidator(nil, PostalOff) })
+
+	t.Run("off", func(t *testing.T) {
+		SetPostalValidator(table, PostalOff)
+		o := postalOrder("Zürich", "garbage")
+		require.NoError(t, ValidateOrder(&o))
+		assert.Empty(t, o.Warnings)
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		SetPostalValidator(table, PostalReject)
+		invalid := PostalInvalidCodes().Value()
+		o := postalOrder("Zürich", "garbage")
+		err := ValidateOrder(&o)
+		require.ErrorIs(t, err, ErrInvalidPostalCode)
+		assert.Contains(t, err.Error(), `zip "garbage" does not match the format of region "Zürich"`)
+		assert.Equal(t, invalid+1, PostalInvalidCodes().Value())
+
+		o = postalOrder("Zürich", "8001")
+		assert.NoError(t, ValidateOrder(&o))
+	})
+
+	t.Run("flag", func(t *testing.T) {
+		SetPostalValidator(table, PostalFlag)
+		o := postalOrder("California", "1")
+		require.NoError(t, ValidateOrder(&o))
+		require.Len(t, o.Warnings, 1)
+		assert.Equal(t, "delivery.zip", o.Warnings[0].Field)
+		assert.Equal(t, "1", o.Warnings[0].Value)
+
+		// Замечания из входящего сообщения не сохраняются
+		o.Delivery.Zip = "94103"
+		require.NoError(t, ValidateOrder(&o))
+		assert.Empty(t, o.Warnings)
+	})
+
+	t.Run("unknown region passes through", func(t *testing.T) {
+		SetPostalValidator(table, PostalReject)
+		unknown := PostalUnknownRegions().Value()
+		o := postalOrder("Bavaria", "garbage")
+		require.NoError(t, ValidateOrder(&o))
+		assert.Empty(t, o.Warnings)
+		assert.Equal(t, unknown+1, PostalUnknownRegions().Value())
+
+		// Без региона или индекса проверять нечего, и неизвестным регионом это не считается
+		o = postalOrder("", "garbage")
+		require.NoError(t, ValidateOrder(&o))
+		assert.Equal(t, unknown+1, PostalUnknownRegions().Value())
+	})
+}
+
+// stubPostalValidator - PostalValidator, принимающий только индекс "ok" любого региона
+type stubPostalValidator struct{}
+
+func (stubPostalValidator) CheckPostalCode(_, zip string) (bool, error) {
+	if zip != "ok" {
+		return true, assert.AnError
+	}
+	return true, nil
+}
+
+func TestCheckPostalCodeCustomValidator(t *testing.T) {
+	t.Cleanup(func() { SetPostalValidator(nil, PostalOff) })
+	SetPostalValidator(stubPostalValidator{}, PostalReject)
+
+	o := postalOrder("Anywhere", "ok")
+	assert.NoError(t, ValidateOrder(&o))
+	o = postalOrder("Anywhere", "12345")
+	assert.ErrorIs(t, ValidateOrder(&o), ErrInvalidPostalCode)
+}
+
+func TestValidateDelivery(t *testing.T) {
+	table, err := CompilePostalTable(testPostalFormats)
+	require.NoError(t, err)
+	t.Cleanup(func() { SetPostalValidator(nil, PostalOff) })
+
+	d := orders.Delivery{Region: "Zürich", Zip: "garbage"}
+	SetPostalValidator(table, PostalOff)
+	assert.NoError(t, ValidateDelivery(d))
+	// Изменение, внесённое вручную, отклоняется и в режиме flag
+	SetPostalValidator(table, PostalFlag)
+	assert.ErrorIs(t, ValidateDelivery(d), ErrInvalidPostalCode)
+	d.Zip = "8001"
+	assert.NoError(t, ValidateDelivery(d))
+}
@@ -0,0 +1,96 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError - нарушение правила валидации в одном поле заказа.
+type FieldError struct {
+	Path    string // путь поля в JSON заказа с индексами элементов, например "items[0].total_price"; пусто — заказ целиком
+	Rule    string // нарушенное правило: тег validate (required, email, …) или проверка (track_number, currency, …)
+	Message string
+}
+
+// fieldError - ошибка проверки, относящаяся к полю path; текст и цепочка ошибок — те же, что у err
+type fieldError struct {
+	path string
+	rule string
+	err  error
+}
+
+func (e *fieldError) Error() string { return e.err.Error() }
+func (e *fieldError) Unwrap() error { return e.err }
+
+// atField - отмечает ошибку err проверки rule полем path, не меняя её текста
+func atField(path, rule string, err error) error {
+	return &fieldError{path: path, rule: rule, err: err}
+}
+
+// structError - нарушения тегов validate, найденные одной проверкой структуры заказа
+type structError struct {
+	fields []FieldError
+	text   string
+}
+
+func (e *structError) Error() string { return e.text }
+
+// newStructError - ошибка с нарушениями errs и текстом "validation failed: Field(tag param) …"
+func newStructError(errs validator.ValidationErrors) *structError {
+	e := &structError{fields: make([]FieldError, len(errs))}
+	var b strings.Builder
+	b.WriteString("validation failed:")
+	for i, fe := range errs {
+		fmt.Fprintf(&b, " %s(%s %s)", fe.Field(), fe.Tag(), fe.Param())
+		// StructNamespace имеет вид "Order.Items[0].Rid": корень в путь не входит
+		_, ns, _ := strings.Cut(fe.StructNamespace(), ".")
+		message := "failed on the " + fe.Tag() + " rule"
+		if fe.Param() != "" {
+			message += " " + fe.Param()
+		}
+		e.fields[i] = FieldError{Path: jsonPath(ns), Rule: fe.Tag(), Message: message}
+	}
+	e.text = b.String()
+	return e
+}
+
+// jsonPath - путь JSON поля по пространству имён validator без корня ("Items[0].Rid" → "items[0].rid"). Поля вне
+// каталога orderFields остаются с именами полей Go.
+func jsonPath(ns string) string {
+	var structPath, path []string
+	for _, part := range strings.Split(ns, ".") {
+		name, index, indexed := strings.Cut(part, "[")
+		structPath = append(structPath, name)
+		full, ok := namespaces[strings.Join(structPath, ".")]
+		if !ok {
+			return ns
+		}
+		segment := full[strings.LastIndex(full, ".")+1:]
+		if indexed {
+			segment += "[" + index
+		}
+		path = append(path, segment)
+	}
+	return strings.Join(path, ".")
+}
+
+// FieldErrors возвращает нарушения из ошибки ValidateOrder по полям: все нарушения тегов validate или одно
+// нарушение остальных проверок, на котором ValidateOrder остановилась. Ошибка, не относящаяся к полю,
+// возвращается нарушением без Path; nil — пустой список.
+func FieldErrors(err error) []FieldError {
+	if err == nil {
+		return nil
+	}
+	var se *structError
+	if errors.As(err, &se) {
+		return append([]FieldError(nil), se.fields...)
+	}
+	var fe *fieldError
+	if errors.As(err, &fe) {
+		return []FieldError{{Path: fe.path, Rule: fe.rule, Message: err.Error()}}
+	}
+	return []FieldError{{Rule: "order", Message: err.Error()}}
+}
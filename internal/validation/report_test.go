@@ -0,0 +1,51 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldErrorsStructRules(t *testing.T) {
+	o := testorders.NewGenerator(40).Order(testorders.ScenarioDefault)
+	o.CustomerId = ""
+	o.SmId = 0
+	o.Locale = ""
+
+	err := ValidateOrder(&o)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "validation failed: ", "the error text is unchanged")
+	fields := FieldErrors(err)
+	paths := make([]string, len(fields))
+	for i, f := range fields {
+		paths[i] = f.Path
+	}
+	assert.ElementsMatch(t, []string{"locale", "customer_id", "sm_id"}, paths)
+	for _, f := range fields {
+		assert.NotEmpty(t, f.Rule, f.Path)
+		assert.Contains(t, f.Message, f.Rule, f.Path)
+	}
+}
+
+func TestFieldErrorsChecks(t *testing.T) {
+	t.Cleanup(func() { SetTotalPriceMode(TotalPriceOff) })
+	o := testorders.NewGenerator(41).Order(testorders.ScenarioDefault)
+	o.Items[0].TotalPrice++
+	SetTotalPriceMode(TotalPriceReject)
+
+	err := ValidateOrder(&o)
+	require.ErrorIs(t, err, ErrTotalPriceMismatch)
+	assert.Equal(t, []FieldError{{Path: "items[0].total_price", Rule: "total_price", Message: err.Error()}}, FieldErrors(err))
+
+	mustSetRules(t, Rules{Fields: map[string]FieldRule{"items.brand": {MaxLength: 2}}})
+	err = ValidateOrder(&o)
+	require.ErrorIs(t, err, ErrFieldRule)
+	assert.Equal(t, "items[0].brand", FieldErrors(err)[0].Path)
+
+	assert.Equal(t, []FieldError{{Rule: "order", Message: "boom"}}, FieldErrors(errors.New("boom")))
+	assert.Nil(t, FieldErrors(nil))
+}
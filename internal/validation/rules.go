@@ -0,0 +1,258 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"l0_test_self/models/orders"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ErrFieldRule возвращается, если значение поля заказа нарушает дополнительное правило развёртывания.
+var ErrFieldRule = errors.New("field rule violated")
+
+// paymentsPath - путь платежей заказа; их обязательность проверяет ValidatePayments, а не тег validate
+const paymentsPath = "payments"
+
+// FieldRule - дополнительные ограничения строкового поля заказа. Пустое значение проверяется только по MaxLength,
+// поэтому шаблон не делает необязательное поле обязательным.
+type FieldRule struct {
+	MaxLength int    // максимальная длина в символах, 0 — без ограничения
+	Pattern   string // регулярное выражение (синтаксис RE2), которому должно соответствовать значение
+}
+
+// Rules - правила валидации конкретного развёртывания поверх встроенных. Поля задаются путями JSON заказа:
+// "customer_id", "delivery.zip", "items.brand" (правило для каждого товара).
+type Rules struct {
+	Optional []string             // обязательные встроенными правилами поля, которые становятся необязательными
+	Fields   map[string]FieldRule // дополнительные ограничения полей
+}
+
+// RuleSet - скомпилированные правила развёртывания.
+type RuleSet struct {
+	optional map[string]bool
+	checks   []fieldCheck
+}
+
+// fieldCheck - скомпилированное правило одного поля
+type fieldCheck struct {
+	field     orderField
+	maxLength int
+	pattern   *regexp.Regexp
+}
+
+// orderField - поле заказа, доступное для правил
+type orderField struct {
+	path     string
+	index    []int // индекс поля в Order
+	elem     []int // индекс поля в элементе среза, если поле принадлежит товарам или платежам
+	kind     reflect.Kind
+	required bool // обязательно по встроенным правилам
+}
+
+// orderFields - поля заказа по путям JSON; namespaces - пути по пространствам имён ошибок validator ("Delivery.Name")
+var orderFields, namespaces = collectOrderFields()
+
+// collectOrderFields - строит каталог полей заказа по JSON тегам модели
+func collectOrderFields() (map[string]orderField, map[string]string) {
+	fields := make(map[string]orderField)
+	ns := make(map[string]string)
+	add := func(f orderField, namespace string) {
+		fields[f.path] = f
+		ns[namespace] = f.path
+	}
+
+	orderType := reflect.TypeOf(orders.Order{})
+	for i := 0; i < orderType.NumField(); i++ {
+		sf := orderType.Field(i)
+		name := jsonName(sf)
+		if name == "" {
+			continue
+		}
+		top := orderField{path: name, index: sf.Index, kind: sf.Type.Kind(), required: strings.Contains(sf.Tag.Get("validate"), "required")}
+		if name == paymentsPath {
+			top.required = true
+		}
+		add(top, sf.Name)
+
+		t := sf.Type
+		if t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || t.PkgPath() != orderType.PkgPath() {
+			continue
+		}
+		for j := 0; j < t.NumField(); j++ {
+			inner := t.Field(j)
+			innerName := jsonName(inner)
+			if innerName == "" {
+				continue
+			}
+			f := orderField{path: name + "." + innerName, index: sf.Index, kind: inner.Type.Kind(),
+				required: strings.Contains(inner.Tag.Get("validate"), "required")}
+			if sf.Type.Kind() == reflect.Slice {
+				f.elem = inner.Index
+			} else {
+				f.index = append(append([]int(nil), sf.Index...), inner.Index...)
+			}
+			add(f, sf.Name+"."+inner.Name)
+		}
+	}
+	return fields, ns
+}
+
+// jsonName - имя поля в JSON или пустая строка, если поле не сериализуется
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "-" || !sf.IsExported() {
+		return ""
+	}
+	return name
+}
+
+// CompileRules проверяет правила и компилирует их. Неизвестный путь поля, ослабление поля, которое и так
+// необязательно, ограничение нестрокового поля и некорректное регулярное выражение — ошибки.
+func CompileRules(r Rules) (*RuleSet, error) {
+	rs := &RuleSet{optional: make(map[string]bool, len(r.Optional))}
+	for _, path := range r.Optional {
+		f, ok := orderFields[path]
+		if !ok {
+			return nil, fmt.Errorf("optional: unknown field path %q", path)
+		}
+		if !f.required {
+			return nil, fmt.Errorf("optional: field %q is not required by built-in rules", path)
+		}
+		rs.optional[path] = true
+	}
+
+	paths := make([]string, 0, len(r.Fields))
+	for path := range r.Fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		rule := r.Fields[path]
+		f, ok := orderFields[path]
+		if !ok {
+			return nil, fmt.Errorf("fields: unknown field path %q", path)
+		}
+		if f.kind != reflect.String {
+			return nil, fmt.Errorf("fields: %q is not a string field", path)
+		}
+		if rule.MaxLength < 0 {
+			return nil, fmt.Errorf("fields: %q: max_length must not be negative", path)
+		}
+		check := fieldCheck{field: f, maxLength: rule.MaxLength}
+		if rule.Pattern != "" {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("fields: %q: invalid pattern: %w", path, err)
+			}
+			check.pattern = re
+		}
+		if check.maxLength == 0 && check.pattern == nil {
+			return nil, fmt.Errorf("fields: %q: rule has no constraints", path)
+		}
+		rs.checks = append(rs.checks, check)
+	}
+	return rs, nil
+}
+
+// rules - правила развёртывания, заданные SetRules; nil — только встроенные правила
+var rules atomic.Pointer[RuleSet]
+
+// SetRules задаёт правила развёртывания, с которыми работает ValidateOrder. nil возвращает встроенные правила.
+func SetRules(rs *RuleSet) {
+	rules.Store(rs)
+}
+
+// isOptional - сообщает, ослаблено ли правилами обязательное поле
+func (rs *RuleSet) isOptional(path string) bool {
+	return rs != nil && rs.optional[path]
+}
+
+// filterRelaxed - убирает из ошибок validator нарушения required для полей, ослабленных правилами
+func (rs *RuleSet) filterRelaxed(errs validator.ValidationErrors) validator.ValidationErrors {
+	if rs == nil || len(rs.optional) == 0 {
+		return errs
+	}
+	kept := errs[:0:0]
+	for _, fe := range errs {
+		// StructNamespace имеет вид "Order.Items[0].Rid": корень и индексы не входят в каталог
+		_, ns, _ := strings.Cut(fe.StructNamespace(), ".")
+		if fe.Tag() == "required" && rs.optional[namespaces[stripIndexes(ns)]] {
+			continue
+		}
+		kept = append(kept, fe)
+	}
+	return kept
+}
+
+// stripIndexes - убирает индексы элементов срезов из пространства имён поля
+func stripIndexes(ns string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range ns {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// check - проверяет дополнительные ограничения полей заказа
+func (rs *RuleSet) check(o *orders.Order) error {
+	return rs.checkPrefix(o, "")
+}
+
+// checkPrefix - проверяет дополнительные ограничения полей заказа, путь которых начинается с prefix
+func (rs *RuleSet) checkPrefix(o *orders.Order, prefix string) error {
+	if rs == nil {
+		return nil
+	}
+	root := reflect.ValueOf(o).Elem()
+	for _, c := range rs.checks {
+		if !strings.HasPrefix(c.field.path, prefix) {
+			continue
+		}
+		v := root.FieldByIndex(c.field.index)
+		if c.field.elem == nil {
+			if err := c.checkValue(c.field.path, v.String()); err != nil {
+				return err
+			}
+			continue
+		}
+		slice, field, _ := strings.Cut(c.field.path, ".")
+		for i := 0; i < v.Len(); i++ {
+			name := fmt.Sprintf("%s[%d].%s", slice, i, field)
+			if err := c.checkValue(name, v.Index(i).FieldByIndex(c.field.elem).String()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkValue - проверяет значение поля name по правилу
+func (c fieldCheck) checkValue(name, value string) error {
+	if c.maxLength > 0 {
+		if n := len([]rune(value)); n > c.maxLength {
+			return atField(name, "max_length", fmt.Errorf("%w: %s is %d characters long, limit %d", ErrFieldRule, name, n, c.maxLength))
+		}
+	}
+	if c.pattern != nil && value != "" && !c.pattern.MatchString(value) {
+		return atField(name, "pattern", fmt.Errorf("%w: %s does not match pattern %s", ErrFieldRule, name, c.pattern))
+	}
+	return nil
+}
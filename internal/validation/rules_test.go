@@ -0,0 +1,88 @@
+package validation
+
+import (
+	"testing"
+
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustSetRules(t *testing.T, r Rules) {
+	t.Helper()
+	rs, err := CompileRules(r)
+	require.NoError(t, err)
+	SetRules(rs)
+	t.Cleanup(func() { SetRules(nil) })
+}
+
+func TestRulesRelaxRequiredField(t *testing.T) {
+	g := testorders.NewGenerator(20)
+	o := g.Order(testorders.ScenarioDefault)
+	o.CustomerId = ""
+	assert.ErrorContains(t, ValidateOrder(&o), "CustomerId(required")
+
+	mustSetRules(t, Rules{Optional: []string{"customer_id"}})
+	assert.NoError(t, ValidateOrder(&o))
+
+	// Остальные обязательные поля по-прежнему проверяются
+	o.Locale = ""
+	err := ValidateOrder(&o)
+	assert.ErrorContains(t, err, "Locale(required")
+	assert.NotContains(t, err.Error(), "CustomerId")
+}
+
+func TestRulesRelaxPayments(t *testing.T) {
+	o := testorders.NewGenerator(21).Order(testorders.ScenarioDefault)
+	o.Payments = nil
+	assert.ErrorIs(t, ValidateOrder(&o), ErrNoPayments)
+
+	mustSetRules(t, Rules{Optional: []string{"payments"}})
+	assert.NoError(t, ValidateOrder(&o))
+}
+
+func TestRulesRegexAndMaxLength(t *testing.T) {
+	o := testorders.NewGenerator(22).Order(testorders.ScenarioDefault)
+	o.Delivery.Phone = "+9720000000"
+	o.Items[0].Brand = "Vivienne Sabo"
+	mustSetRules(t, Rules{Fields: map[string]FieldRule{
+		"delivery.phone": {Pattern: `^\+[0-9]{10,15}$`},
+		"items.brand":    {MaxLength: 20},
+	}})
+	require.NoError(t, ValidateOrder(&o))
+
+	o.Delivery.Phone = "call me"
+	err := ValidateOrder(&o)
+	require.ErrorIs(t, err, ErrFieldRule)
+	assert.ErrorContains(t, err, "delivery.phone does not match pattern")
+
+	// Пустое значение шаблону не проверяется
+	o.Delivery.Phone = ""
+	require.NoError(t, ValidateOrder(&o))
+
+	o.Items = append(o.Items, o.Items[0])
+	o.Items[1].Brand = "Очень длинное название бренда"
+	err = ValidateOrder(&o)
+	require.ErrorIs(t, err, ErrFieldRule)
+	assert.ErrorContains(t, err, "items[1].brand is 29 characters long, limit 20")
+}
+
+func TestCompileRulesRejectsInvalidDefinitions(t *testing.T) {
+	cases := map[string]Rules{
+		"unknown field path":         {Optional: []string{"delivery.fax"}},
+		"not required":               {Optional: []string{"delivery.email"}},
+		"unknown field path \"foo\"": {Fields: map[string]FieldRule{"foo": {MaxLength: 1}}},
+		"not a string field":         {Fields: map[string]FieldRule{"sm_id": {MaxLength: 1}}},
+		"invalid pattern":            {Fields: map[string]FieldRule{"delivery.zip": {Pattern: "[0-9"}}},
+		"no constraints":             {Fields: map[string]FieldRule{"delivery.zip": {}}},
+		"must not be negative":       {Fields: map[string]FieldRule{"delivery.zip": {MaxLength: -1}}},
+	}
+	for want, r := range cases {
+		_, err := CompileRules(r)
+		assert.ErrorContains(t, err, want, want)
+	}
+
+	_, err := CompileRules(Rules{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,96 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"l0_test_self/internal/metrics"
+	"l0_test_self/models/orders"
+)
+
+// TotalPriceMode - действие при расхождении total_price товара с ценой и скидкой.
+type TotalPriceMode int32
+
+// Режимы проверки total_price товаров.
+const (
+	TotalPriceOff     TotalPriceMode = iota // total_price не проверяется
+	TotalPriceReject                        // заказ отклоняется
+	TotalPriceCorrect                       // total_price заменяется рассчитанным, исходное значение сохраняется в Order.Corrections
+	TotalPriceFlag                          // total_price не изменяется, расхождение сохраняется в Order.Corrections
+)
+
+// ErrTotalPriceMismatch возвращается в режиме TotalPriceReject, если total_price товара не совпадает с ExpectedTotalPrice.
+var ErrTotalPriceMismatch = errors.New("item total_price does not match price and sale")
+
+var totalPriceMode atomic.Int32
+
+// totalPriceCorrections - число товаров с расхождением total_price, исправленных или отмеченных проверкой
+var totalPriceCorrections = &metrics.Counter{}
+
+// ParseTotalPriceMode преобразует значение validation.total_price.mode из конфигурации: off (или пустая строка),
+// reject, correct или flag.
+func ParseTotalPriceMode(s string) (TotalPriceMode, error) {
+	switch s {
+	case "", "off":
+		return TotalPriceOff, nil
+	case "reject":
+		return TotalPriceReject, nil
+	case "correct":
+		return TotalPriceCorrect, nil
+	case "flag":
+		return TotalPriceFlag, nil
+	default:
+		return 0, fmt.Errorf("invalid total_price mode %q: must be off, reject, correct or flag", s)
+	}
+}
+
+// SetTotalPriceMode задаёт действие при расхождении total_price товара с ценой и скидкой.
+func SetTotalPriceMode(mode TotalPriceMode) {
+	totalPriceMode.Store(int32(mode))
+}
+
+// TotalPriceCorrections возвращает счётчик товаров, total_price которых исправлен или отмечен проверкой,
+// для регистрации в реестре метрик.
+func TotalPriceCorrections() *metrics.Counter {
+	return totalPriceCorrections
+}
+
+// ExpectedTotalPrice возвращает стоимость товара с ценой price и скидкой sale процентов: price*(100-sale)/100
+// с отбрасыванием дробной части (округлением к нулю), как её считают продавцы.
+func ExpectedTotalPrice(price, sale int) int {
+	return price * (100 - sale) / 100
+}
+
+// CheckTotalPrices сверяет total_price товаров заказа с ExpectedTotalPrice в режиме SetTotalPriceMode. Найденные
+// расхождения перечисляются в o.Corrections (значение из входящего сообщения не учитывается); в режиме
+// TotalPriceCorrect total_price заменяется рассчитанным, а в режиме TotalPriceReject возвращается ErrTotalPriceMismatch.
+func CheckTotalPrices(o *orders.Order) error {
+	o.Corrections = nil
+	mode := TotalPriceMode(totalPriceMode.Load())
+	if mode == TotalPriceOff {
+		return nil
+	}
+	for i := range o.Items {
+		item := &o.Items[i]
+		expected := ExpectedTotalPrice(item.Price, item.Sale)
+		if item.TotalPrice == expected {
+			continue
+		}
+		if mode == TotalPriceReject {
+			return atField(fmt.Sprintf("items[%d].total_price", i), "total_price", fmt.Errorf("%w: items[%d] total_price %d, expected %d (price %d, sale %d)",
+				ErrTotalPriceMismatch, i, item.TotalPrice, expected, item.Price, item.Sale))
+		}
+		o.Corrections = append(o.Corrections, orders.Correction{
+			Field:     fmt.Sprintf("items[%d].total_price", i),
+			Original:  item.TotalPrice,
+			Corrected: expected,
+			Applied:   mode == TotalPriceCorrect,
+		})
+		if mode == TotalPriceCorrect {
+			item.TotalPrice = expected
+		}
+	}
+	totalPriceCorrections.Add(uint64(len(o.Corrections)))
+	return nil
+}
@@ -0,0 +1,106 @@
+package validation
+
+import (
+	"encoding/json"
+	"testing"
+
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectedTotalPrice(t *testing.T) {
+	for _, tc := range []struct{ price, sale, want int }{
+		{453, 30, 317}, // 317.1 отбрасывается до 317
+		{199, 50, 99},  // 99.5 не округляется вверх
+		{1, 50, 0},
+		{1000, 0, 1000},
+		{1000, 100, 0},
+	} {
+		assert.Equal(t, tc.want, ExpectedTotalPrice(tc.price, tc.sale), "price %d sale %d", tc.price, tc.sale)
+	}
+}
+
+func TestParseTotalPriceMode(t *testing.T) {
+	for s, want := range map[string]TotalPriceMode{"": TotalPriceOff, "off": TotalPriceOff, "reject": TotalPriceReject,
+		"correct": TotalPriceCorrect, "flag": TotalPriceFlag} {
+		got, err := ParseTotalPriceMode(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	_, err := ParseTotalPriceMode("fix")
+	assert.Error(t, err)
+}
+
+// mismatchedOrder - заказ, total_price второго товара которого не совпадает с ценой и скидкой
+func mismatchedOrder() orders.Order {
+	o := testorders.NewGenerator(6).Order(testorders.ScenarioDefault)
+	o.Items = append(o.Items, o.Items[0])
+	for i := range o.Items {
+		o.Items[i].Price, o.Items[i].Sale = 453, 30
+		o.Items[i].TotalPrice = 317
+	}
+	o.Items[1].TotalPrice = 400
+	return o
+}
+
+func TestCheckTotalPrices(t *testing.T) {
+	t.Cleanup(func() { SetTotalPriceMode(TotalPriceOff) })
+
+	t.Run("off", func(t *testing.T) {
+		SetTotalPriceMode(TotalPriceOff)
+		o := mismatchedOrder()
+		require.NoError(t, ValidateOrder(&o))
+		assert.Equal(t, 400, o.Items[1].TotalPrice)
+		assert.Empty(t, o.Corrections)
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		SetTotalPriceMode(TotalPriceReject)
+		o := mismatchedOrder()
+		err := ValidateOrder(&o)
+		require.ErrorIs(t, err, ErrTotalPriceMismatch)
+		assert.Contains(t, err.Error(), "items[1] total_price 400, expected 317")
+
+		o.Items[1].TotalPrice = 317
+		assert.NoError(t, ValidateOrder(&o))
+	})
+
+	t.Run("correct", func(t *testing.T) {
+		SetTotalPriceMode(TotalPriceCorrect)
+		before := TotalPriceCorrections().Value()
+		o := mismatchedOrder()
+		require.NoError(t, ValidateOrder(&o))
+		assert.Equal(t, 317, o.Items[1].TotalPrice)
+		assert.Equal(t, []orders.Correction{{Field: "items[1].total_price", Original: 400, Corrected: 317, Applied: true}}, o.Corrections)
+		assert.Equal(t, before+1, TotalPriceCorrections().Value())
+
+		// Повторная проверка исправленного заказа ничего не находит
+		require.NoError(t, ValidateOrder(&o))
+		assert.Empty(t, o.Corrections)
+	})
+
+	t.Run("flag", func(t *testing.T) {
+		SetTotalPriceMode(TotalPriceFlag)
+		o := mismatchedOrder()
+		require.NoError(t, ValidateOrder(&o))
+		assert.Equal(t, 400, o.Items[1].TotalPrice, "the value is kept")
+		assert.Equal(t, []orders.Correction{{Field: "items[1].total_price", Original: 400, Corrected: 317}}, o.Corrections)
+	})
+
+	t.Run("corrections from the message are not trusted", func(t *testing.T) {
+		SetTotalPriceMode(TotalPriceFlag)
+		o := mismatchedOrder()
+		o.Items[1].TotalPrice = 317
+		data, err := json.Marshal(o)
+		require.NoError(t, err)
+		data = append(data[:len(data)-1], []byte(`,"corrections":[{"field":"items[0].total_price","original":1,"corrected":2,"applied":true}]}`)...)
+		var decoded orders.Order
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		require.NotEmpty(t, decoded.Corrections)
+		require.NoError(t, ValidateOrder(&decoded))
+		assert.Empty(t, decoded.Corrections)
+	})
+}
@@ -0,0 +1,116 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"l0_test_self/internal/metrics"
+	"l0_test_self/models/orders"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultTrackNumberPattern - формат трек-номера по умолчанию: от 8 до 32 латинских букв и цифр после нормализации.
+const DefaultTrackNumberPattern = `[A-Z0-9]{8,32}`
+
+// ErrInvalidTrackNumber возвращается в режиме TrackNumberReject, если трек-номер заказа не соответствует формату.
+var ErrInvalidTrackNumber = errors.New("invalid track number")
+
+// TrackNumberMode - действие с заказом, трек-номер которого не соответствует формату.
+type TrackNumberMode int
+
+// Режимы проверки трек-номеров.
+const (
+	TrackNumberReject TrackNumberMode = iota // заказ отклоняется (по умолчанию)
+	TrackNumberFlag                          // заказ принимается, несоответствие сохраняется в Order.Warnings
+)
+
+// ParseTrackNumberMode преобразует значение validation.track_number.mode из конфигурации: reject (или пустая строка) или flag.
+func ParseTrackNumberMode(s string) (TrackNumberMode, error) {
+	switch s {
+	case "", "reject":
+		return TrackNumberReject, nil
+	case "flag":
+		return TrackNumberFlag, nil
+	default:
+		return 0, fmt.Errorf("invalid track number mode %q: must be reject or flag", s)
+	}
+}
+
+// CompileTrackNumberPattern компилирует формат трек-номера (синтаксис RE2), которому нормализованный трек-номер
+// должен соответствовать целиком. Пустая строка означает DefaultTrackNumberPattern.
+func CompileTrackNumberPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = DefaultTrackNumberPattern
+	}
+	re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid track number pattern: %w", err)
+	}
+	return re, nil
+}
+
+var (
+	trackNumberMu      sync.RWMutex
+	trackNumberPattern = regexp.MustCompile(`^(?:` + DefaultTrackNumberPattern + `)$`)
+	trackNumberMode    = TrackNumberReject
+
+	// invalidTrackNumbers - число заказов с трек-номером, не соответствующим формату (отклонённых и отмеченных)
+	invalidTrackNumbers = &metrics.Counter{}
+)
+
+// SetTrackNumberPolicy задаёт формат трек-номера (CompileTrackNumberPattern) и действие при несоответствии.
+// nil pattern означает DefaultTrackNumberPattern.
+func SetTrackNumberPolicy(pattern *regexp.Regexp, mode TrackNumberMode) {
+	if pattern == nil {
+		pattern, _ = CompileTrackNumberPattern("")
+	}
+	trackNumberMu.Lock()
+	trackNumberPattern, trackNumberMode = pattern, mode
+	trackNumberMu.Unlock()
+}
+
+// InvalidTrackNumbers возвращает счётчик заказов с трек-номером, не соответствующим формату (отклонённых и отмеченных),
+// для регистрации в реестре метрик.
+func InvalidTrackNumbers() *metrics.Counter {
+	return invalidTrackNumbers
+}
+
+// NormalizeTrackNumber приводит трек-номер к виду, в котором он хранится и ищется: Unicode NFKC (полноширинные
+// буквы и цифры заменяются обычными), без пробелов по краям, в верхнем регистре. Повторная нормализация
+// результат не меняет.
+func NormalizeTrackNumber(s string) string {
+	s = strings.ToUpper(strings.TrimSpace(norm.NFKC.String(s)))
+	// Перевод в верхний регистр может дать символы, которые NFKC записывает иначе
+	return norm.NFKC.String(s)
+}
+
+// CheckTrackNumber нормализует трек-номера заказа и его товаров (NormalizeTrackNumber) и проверяет трек-номер заказа
+// по формату SetTrackNumberPolicy. В режиме TrackNumberReject несоответствие возвращается как ErrInvalidTrackNumber,
+// а в режиме TrackNumberFlag добавляется в o.Warnings.
+func CheckTrackNumber(o *orders.Order) error {
+	trackNumberMu.RLock()
+	pattern, mode := trackNumberPattern, trackNumberMode
+	trackNumberMu.RUnlock()
+
+	o.TrackNumber = NormalizeTrackNumber(o.TrackNumber)
+	for i := range o.Items {
+		o.Items[i].TrackNumber = NormalizeTrackNumber(o.Items[i].TrackNumber)
+	}
+	if pattern.MatchString(o.TrackNumber) {
+		return nil
+	}
+	invalidTrackNumbers.Inc()
+	if mode == TrackNumberReject {
+		return atField("track_number", "track_number", fmt.Errorf("%w: %q does not match %s", ErrInvalidTrackNumber, o.TrackNumber, pattern))
+	}
+	o.Warnings = append(o.Warnings, orders.Warning{
+		Field:   "track_number",
+		Value:   o.TrackNumber,
+		Message: fmt.Sprintf("track number does not match %s", pattern),
+	})
+	return nil
+}
@@ -0,0 +1,72 @@
+package validation
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeTrackNumber(t *testing.T) {
+	for in, want := range map[string]string{
+		"WBILMTESTTRACK":     "WBILMTESTTRACK",
+		"wbilmtesttrack":     "WBILMTESTTRACK",
+		"  WbIlmTestTrack\t": "WBILMTESTTRACK",
+		"ＷＢ１２３４５６７８":         "WB12345678",
+		" wb12345678　":       "WB12345678",
+		"":                   "",
+	} {
+		got := NormalizeTrackNumber(in)
+		assert.Equal(t, want, got, "%q", in)
+		assert.Equal(t, got, NormalizeTrackNumber(got), "normalization of %q is idempotent", in)
+	}
+}
+
+func TestParseTrackNumberMode(t *testing.T) {
+	for s, want := range map[string]TrackNumberMode{"": TrackNumberReject, "reject": TrackNumberReject, "flag": TrackNumberFlag} {
+		got, err := ParseTrackNumberMode(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	_, err := ParseTrackNumberMode("off")
+	assert.Error(t, err)
+}
+
+func TestValidateOrderNormalizesTrackNumbers(t *testing.T) {
+	o := testorders.NewGenerator(7).Order(testorders.ScenarioDefault)
+	o.TrackNumber = " wbilmtesttrack "
+	o.Items[0].TrackNumber = "ｗｂｉｌｍｔｅｓｔｔｒａｃｋ"
+	require.NoError(t, ValidateOrder(&o))
+	assert.Equal(t, "WBILMTESTTRACK", o.TrackNumber)
+	assert.Equal(t, "WBILMTESTTRACK", o.Items[0].TrackNumber)
+	assert.Empty(t, o.Warnings)
+}
+
+func TestValidateOrderTrackNumberPattern(t *testing.T) {
+	t.Cleanup(func() { SetTrackNumberPolicy(nil, TrackNumberReject) })
+	before := InvalidTrackNumbers().Value()
+
+	for _, track := range []string{"WB1234", "WB-12345678", "WB" + strings.Repeat("0", 31)} {
+		o := testorders.NewGenerator(7).Order(testorders.ScenarioDefault)
+		o.TrackNumber = track
+		assert.ErrorIs(t, ValidateOrder(&o), ErrInvalidTrackNumber, "%q", track)
+	}
+	assert.Equal(t, before+3, InvalidTrackNumbers().Value())
+
+	SetTrackNumberPolicy(regexp.MustCompile(`^(?:WB\d{8})$`), TrackNumberFlag)
+	o := testorders.NewGenerator(7).Order(testorders.ScenarioDefault)
+	o.TrackNumber = "wbilmtesttrack"
+	require.NoError(t, ValidateOrder(&o))
+	require.Len(t, o.Warnings, 1)
+	assert.Equal(t, "track_number", o.Warnings[0].Field)
+	assert.Equal(t, "WBILMTESTTRACK", o.Warnings[0].Value)
+
+	o = testorders.NewGenerator(7).Order(testorders.ScenarioDefault)
+	o.TrackNumber = "wb12345678"
+	require.NoError(t, ValidateOrder(&o))
+	assert.Empty(t, o.Warnings)
+}
@@ -2,41 +2,223 @@
 package validation
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"l0_test_self/internal/ids"
+	"l0_test_self/models/orders"
 
 	"github.com/go-playground/validator/v10"
 )
 
 var v = validator.New()
 
-// ValidateOrder проверяет, соответствует ли структура заказа правилам валидации.
+// MaxExtrasBytes - максимальный размер дополнительных полей заказа (Extras) в закодированном JSON виде.
+const MaxExtrasBytes = 16 << 10
+
+// ErrExtrasTooLarge возвращается, если дополнительные поля заказа превышают MaxExtrasBytes.
+var ErrExtrasTooLarge = errors.New("order extras too large")
+
+// ErrNoPayments возвращается, если заказ не содержит платежей, а его entry не входит в список разрешённых.
+var ErrNoPayments = errors.New("order has no payments")
+
+// ErrUnknownItemStatus возвращается, если статус товара не входит в число известных, а неизвестные статусы не разрешены.
+var ErrUnknownItemStatus = errors.New("unknown item status")
+
+// ErrFutureDateCreated возвращается, если дата создания заказа опережает время сервера больше допустимого.
+var ErrFutureDateCreated = errors.New("order date_created is in the future")
+
+// DefaultMaxFutureSkew - допустимое опережение даты создания заказа относительно времени сервера по умолчанию.
+const DefaultMaxFutureSkew = 5 * time.Minute
+
+var (
+	futureDateMu         sync.RWMutex
+	maxFutureSkew        = DefaultMaxFutureSkew
+	quarantineFutureDate bool
+
+	// now - текущее время сервера, заменяется в тестах
+	now = time.Now
+)
+
+// allowUnknownStatuses - принимать заказы с неизвестными статусами товаров
+var allowUnknownStatuses atomic.Bool
+
+var (
+	paymentOptionalMu      sync.RWMutex
+	paymentOptionalEntries map[string]bool
+)
+
+// SetPaymentOptionalEntries задаёт значения entry, для которых заказ может не содержать платежей. Вызов заменяет предыдущий список.
+func SetPaymentOptionalEntries(entries ...string) {
+	set := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		set[entry] = true
+	}
+	paymentOptionalMu.Lock()
+	paymentOptionalEntries = set
+	paymentOptionalMu.Unlock()
+}
+
+// SetAllowUnknownStatuses задаёт, принимаются ли заказы с неизвестными статусами товаров. Такие статусы сохраняются
+// с исходным кодом и получают метку "unknown".
+func SetAllowUnknownStatuses(allow bool) {
+	allowUnknownStatuses.Store(allow)
+}
+
+// SetFutureDatePolicy задаёт допустимое опережение даты создания заказа относительно времени сервера
+// (0 — DefaultMaxFutureSkew) и действие при его превышении: при quarantine заказ не отклоняется,
+// а помечается признаком Quarantined.
+func SetFutureDatePolicy(maxSkew time.Duration, quarantine bool) {
+	if maxSkew <= 0 {
+		maxSkew = DefaultMaxFutureSkew
+	}
+	futureDateMu.Lock()
+	maxFutureSkew, quarantineFutureDate = maxSkew, quarantine
+	futureDateMu.Unlock()
+}
+
+// ValidateOrder проверяет, соответствует ли структура заказа правилам валидации: встроенным с учётом правил
+// развёртывания, заданных SetRules.
 func ValidateOrder(o interface{}) error {
+	rs := rules.Load()
 	if err := v.Struct(o); err != nil {
 		var invalidValidationError *validator.InvalidValidationError
 		if errors.As(err, &invalidValidationError) {
 			return err
 		}
-		// Aggregate readable message
-		out := "validation failed:"
-		for _, fe := range err.(validator.ValidationErrors) {
-			out += fmt.Sprintf(" %s(%s %s)", fe.Field(), fe.Tag(), fe.Param())
+		if errs := rs.filterRelaxed(err.(validator.ValidationErrors)); len(errs) > 0 {
+			return newStructError(errs)
+		}
+	}
+
+	switch o := o.(type) {
+	case *orders.Order:
+		return validateOrderFields(o, rs)
+	case orders.Order:
+		return validateOrderFields(&o, rs)
+	}
+	return nil
+}
+
+// validateOrderFields проверяет правила заказа, которые не выражаются тегами validate.
+func validateOrderFields(o *orders.Order, rs *RuleSet) error {
+	// Замечания выставляют проверки ниже, значение из входящего сообщения не учитывается
+	o.Warnings = nil
+	o.ItemsMissing = len(o.Items) == 0
+	id, err := ids.Parse(o.OrderUid)
+	if err != nil {
+		return atField("order_uid", "order_uid", fmt.Errorf("order_uid: %w", err))
+	}
+	// Заказ сохраняется и кэшируется с идентификатором в нижнем регистре
+	o.OrderUid = id.String()
+	// Трек-номер нормализуется до правил развёртывания: они проверяют сохраняемое значение
+	if err := CheckTrackNumber(o); err != nil {
+		return err
+	}
+	if !rs.isOptional(paymentsPath) {
+		if err := ValidatePayments(o); err != nil {
+			return err
 		}
-		return fmt.Errorf(out)
+	}
+	if err := rs.check(o); err != nil {
+		return err
+	}
+	if err := CheckCurrencies(o); err != nil {
+		return err
+	}
+	if err := ValidateItemStatuses(o.Items); err != nil {
+		return err
+	}
+	if err := CheckTotalPrices(o); err != nil {
+		return err
+	}
+	if err := CheckPostalCode(o); err != nil {
+		return err
+	}
+	if err := ValidateDateCreated(o); err != nil {
+		return err
+	}
+	return ValidateExtras(o.Extras)
+}
+
+// ValidateDelivery проверяет доставку, которую администратор задаёт заказу вместо текущей: правила развёртывания
+// для полей delivery.* и формат индекса региона. Индекс, не соответствующий формату, отклоняется и в режиме PostalFlag:
+// отмечать замечанием исправление, внесённое вручную, незачем.
+func ValidateDelivery(d orders.Delivery) error {
+	o := orders.Order{Delivery: d}
+	if err := rules.Load().checkPrefix(&o, "delivery."); err != nil {
+		return err
+	}
+	if err := CheckPostalCode(&o); err != nil {
+		return err
+	}
+	if len(o.Warnings) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidPostalCode, o.Warnings[0].Message)
 	}
 	return nil
 }
 
-// ValidateOrderID проверяет, соответствует ли идентификатор заказа допустимым символам (буквы и цифры).
-func ValidateOrderID(id string) bool {
-	if len(id) == 0 {
-		return false
+// ValidatePayments проверяет, что заказ содержит хотя бы один платёж, если его entry не разрешает заказы без платежей.
+func ValidatePayments(o *orders.Order) error {
+	if len(o.Payments) > 0 {
+		return nil
+	}
+	paymentOptionalMu.RLock()
+	optional := paymentOptionalEntries[o.Entry]
+	paymentOptionalMu.RUnlock()
+	if !optional {
+		return atField(paymentsPath, "payments", fmt.Errorf("%w: entry %q requires a payment", ErrNoPayments, o.Entry))
 	}
+	return nil
+}
+
+// ValidateDateCreated проверяет, что дата создания заказа опережает время сервера не больше допустимого.
+// В режиме карантина такой заказ не отклоняется: вместо ошибки выставляется o.Quarantined.
+func ValidateDateCreated(o *orders.Order) error {
+	futureDateMu.RLock()
+	skew, quarantine := maxFutureSkew, quarantineFutureDate
+	futureDateMu.RUnlock()
 
-	for _, r := range id {
-		if !(r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r == '-') {
-			return false
+	ahead := o.DateCreated.Sub(now())
+	o.Quarantined = false
+	if ahead <= skew {
+		return nil
+	}
+	if quarantine {
+		o.Quarantined = true
+		return nil
+	}
+	return atField("date_created", "future_date", fmt.Errorf("%w: %s ahead of server time, limit %s", ErrFutureDateCreated, ahead.Round(time.Second), skew))
+}
+
+// ValidateItemStatuses проверяет, что статусы товаров входят в число известных, если неизвестные статусы не разрешены.
+func ValidateItemStatuses(items []orders.Item) error {
+	if allowUnknownStatuses.Load() {
+		return nil
+	}
+	for i, item := range items {
+		if !item.Status.Known() {
+			return atField(fmt.Sprintf("items[%d].status", i), "item_status", fmt.Errorf("%w: items[%d] status %d", ErrUnknownItemStatus, i, int(item.Status)))
 		}
 	}
-	return true
+	return nil
+}
+
+// ValidateExtras проверяет, что дополнительные поля заказа в закодированном виде не превышают MaxExtrasBytes.
+func ValidateExtras(extras map[string]any) error {
+	if len(extras) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(extras)
+	if err != nil {
+		return atField("extras", "extras", fmt.Errorf("invalid extras: %w", err))
+	}
+	if len(data) > MaxExtrasBytes {
+		return atField("extras", "extras", fmt.Errorf("%w: %d bytes, limit %d", ErrExtrasTooLarge, len(data), MaxExtrasBytes))
+	}
+	return nil
 }
@@ -0,0 +1,147 @@
+package validation
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/ids"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateOrderExtrasSizeLimit(t *testing.T) {
+	o := testorders.NewGenerator(1).Order(testorders.ScenarioDefault)
+	require.NoError(t, ValidateOrder(&o))
+
+	o.Extras = map[string]any{"marketing": map[string]any{"tags": []any{"promo"}}}
+	require.NoError(t, ValidateOrder(&o))
+
+	o.Extras = map[string]any{"blob": strings.Repeat("x", MaxExtrasBytes)}
+	err := ValidateOrder(&o)
+	require.ErrorIs(t, err, ErrExtrasTooLarge)
+	assert.ErrorIs(t, ValidateOrder(o), ErrExtrasTooLarge)
+}
+
+func TestValidateOrderExtrasFromJSON(t *testing.T) {
+	o := testorders.NewGenerator(2).Order(testorders.ScenarioDefault)
+	data, err := json.Marshal(o)
+	require.NoError(t, err)
+
+	// Неизвестное поле верхнего уровня размером больше лимита
+	data = append(data[:len(data)-1], []byte(`,"hints":"`+strings.Repeat("y", MaxExtrasBytes)+`"}`)...)
+	var decoded orders.Order
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.ErrorIs(t, ValidateOrder(&decoded), ErrExtrasTooLarge)
+}
+
+func TestValidateOrderPayments(t *testing.T) {
+	t.Cleanup(func() { SetPaymentOptionalEntries() })
+	g := testorders.NewGenerator(3)
+
+	one := g.Order(testorders.ScenarioDefault)
+	require.NoError(t, ValidateOrder(&one))
+
+	two := g.Order(testorders.ScenarioDefault)
+	two.Payments = append(two.Payments, two.Payments[0])
+	require.NoError(t, ValidateOrder(&two))
+
+	none := g.Order(testorders.ScenarioDefault)
+	none.Payments = nil
+	assert.ErrorIs(t, ValidateOrder(&none), ErrNoPayments)
+
+	SetPaymentOptionalEntries("gift", none.Entry)
+	assert.NoError(t, ValidateOrder(&none))
+	assert.NoError(t, ValidateOrder(none))
+
+	SetPaymentOptionalEntries("gift")
+	assert.ErrorIs(t, ValidateOrder(&none), ErrNoPayments)
+}
+
+func TestValidateOrderNormalizesOrderUID(t *testing.T) {
+	o := testorders.NewGenerator(1).Order(testorders.ScenarioDefault)
+	o.OrderUid = "B563FEB7B2B84B6Test"
+	require.NoError(t, ValidateOrder(&o))
+	assert.Equal(t, "b563feb7b2b84b6test", o.OrderUid)
+
+	for _, uid := range []string{"order 1", "order\r\n1", "order_1", strings.Repeat("a", 65)} {
+		o := testorders.NewGenerator(1).Order(testorders.ScenarioDefault)
+		o.OrderUid = uid
+		assert.ErrorIs(t, ValidateOrder(&o), ids.ErrInvalid, "%q", uid)
+	}
+}
+
+func TestValidateOrderItemsMissing(t *testing.T) {
+	o := testorders.NewGenerator(6).Order(testorders.ScenarioDefault)
+	o.ItemsMissing = true
+	require.NoError(t, ValidateOrder(&o))
+	assert.False(t, o.ItemsMissing, "the flag from the producer is not trusted")
+
+	o.Items = []orders.Item{}
+	require.NoError(t, ValidateOrder(&o), "an empty items array is accepted")
+	assert.True(t, o.ItemsMissing)
+}
+
+func TestValidateOrderItemStatuses(t *testing.T) {
+	t.Cleanup(func() { SetAllowUnknownStatuses(false) })
+	o := testorders.NewGenerator(4).Order(testorders.ScenarioDefault)
+	require.NoError(t, ValidateOrder(&o))
+
+	o.Items[0].Status = 999
+	err := ValidateOrder(&o)
+	require.ErrorIs(t, err, ErrUnknownItemStatus)
+	assert.Contains(t, err.Error(), "items[0] status 999")
+
+	o.Items[0].Status = orders.ItemStatusUnknown
+	assert.ErrorIs(t, ValidateOrder(&o), ErrUnknownItemStatus, "missing status is not accepted either")
+
+	SetAllowUnknownStatuses(true)
+	o.Items[0].Status = 999
+	require.NoError(t, ValidateOrder(&o))
+	assert.Equal(t, orders.ItemStatus(999), o.Items[0].Status, "unknown code is kept")
+	assert.Equal(t, "unknown", o.Items[0].Status.String())
+}
+
+func TestValidateOrderFutureDateCreated(t *testing.T) {
+	serverNow := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return serverNow }
+	t.Cleanup(func() {
+		now = time.Now
+		SetFutureDatePolicy(0, false)
+	})
+	SetFutureDatePolicy(time.Minute, false)
+	o := testorders.NewGenerator(5).Order(testorders.ScenarioDefault)
+
+	o.DateCreated = serverNow.Add(time.Minute)
+	require.NoError(t, ValidateOrder(&o), "skew equal to the limit is accepted")
+	assert.False(t, o.Quarantined)
+
+	o.DateCreated = serverNow.Add(time.Minute + time.Nanosecond)
+	assert.ErrorIs(t, ValidateOrder(&o), ErrFutureDateCreated)
+	o.DateCreated = serverNow.AddDate(10, 0, 0)
+	assert.ErrorIs(t, ValidateOrder(&o), ErrFutureDateCreated)
+
+	o.DateCreated = serverNow.AddDate(-1, 0, 0)
+	assert.NoError(t, ValidateOrder(&o), "past dates are not limited")
+
+	// Режим карантина: заказ принимается, но помечается
+	SetFutureDatePolicy(time.Minute, true)
+	o.DateCreated = serverNow.Add(time.Minute + time.Nanosecond)
+	require.NoError(t, ValidateOrder(&o))
+	assert.True(t, o.Quarantined)
+
+	o.DateCreated = serverNow.Add(time.Minute)
+	require.NoError(t, ValidateOrder(&o))
+	assert.False(t, o.Quarantined, "the flag from the producer is not trusted")
+
+	// Нулевое значение означает допустимое опережение по умолчанию
+	SetFutureDatePolicy(0, false)
+	o.DateCreated = serverNow.Add(DefaultMaxFutureSkew)
+	assert.NoError(t, ValidateOrder(&o))
+	o.DateCreated = serverNow.Add(DefaultMaxFutureSkew + time.Second)
+	assert.ErrorIs(t, ValidateOrder(&o), ErrFutureDateCreated)
+}
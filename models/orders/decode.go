@@ -0,0 +1,316 @@
+package orders
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// DecodeMode - строгость декодирования заказа из JSON.
+type DecodeMode string
+
+const (
+	// DecodeStrict - неизвестные поля на любом уровне и несовпадение типов отклоняют заказ.
+	DecodeStrict DecodeMode = "strict"
+	// DecodeLenient - типичные несовпадения типов приводятся (строка с целым числом к числу, число к строке,
+	// отсутствующий необязательный список к пустому), приведённые поля перечисляются в Order.Coerced.
+	// Неизвестные поля верхнего уровня сохраняются в Extras, вложенные — отбрасываются.
+	DecodeLenient DecodeMode = "lenient"
+)
+
+// decodeMode - режим, заданный SetDecodeMode; до её вызова заказы декодируются без проверки полей, как encoding/json
+var decodeMode atomic.Value
+
+// SetDecodeMode задаёт режим декодирования заказов из JSON для всего процесса.
+func SetDecodeMode(mode DecodeMode) {
+	decodeMode.Store(mode)
+}
+
+// CurrentDecodeMode возвращает режим, заданный SetDecodeMode, или пустую строку, если режим не задан.
+func CurrentDecodeMode() DecodeMode {
+	mode, _ := decodeMode.Load().(DecodeMode)
+	return mode
+}
+
+// ParseDecodeMode проверяет имя режима декодирования из конфигурации; пустое значение означает DecodeLenient.
+func ParseDecodeMode(s string) (DecodeMode, error) {
+	switch DecodeMode(s) {
+	case "":
+		return DecodeLenient, nil
+	case DecodeStrict, DecodeLenient:
+		return DecodeMode(s), nil
+	default:
+		return "", fmt.Errorf("invalid decode mode %q: must be %q or %q", s, DecodeStrict, DecodeLenient)
+	}
+}
+
+// FieldError - ошибка декодирования одного поля заказа. Path - путь поля в JSON, например "items[1].price".
+type FieldError struct {
+	Path   string
+	Reason string
+}
+
+func (e FieldError) Error() string { return e.Path + ": " + e.Reason }
+
+// DecodeError - ошибки декодирования полей заказа в порядке их обнаружения.
+type DecodeError struct {
+	Fields []FieldError
+}
+
+func (e *DecodeError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Error()
+	}
+	return "invalid order: " + strings.Join(parts, "; ")
+}
+
+// orderShape - поля JSON представления заказа: поля Order и одиночный платёж payment
+var orderShape = reflect.TypeOf(orderJSON{})
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// checkOrderJSON - сверяет JSON заказа с типами полей в режиме mode. Возвращает данные для декодирования
+// (в режиме DecodeLenient — с приведёнными значениями), список приведённых полей и DecodeError при несовпадениях.
+func checkOrderJSON(data []byte, mode DecodeMode) ([]byte, []string, error) {
+	if mode != DecodeStrict && mode != DecodeLenient {
+		return data, nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var tree any
+	if err := dec.Decode(&tree); err != nil {
+		// Синтаксические ошибки сообщает encoding/json при декодировании
+		return data, nil, nil
+	}
+
+	w := shapeWalker{lenient: mode == DecodeLenient}
+	tree = w.walk("", tree, orderShape)
+	sort.Slice(w.errs, func(i, j int) bool { return w.errs[i].Path < w.errs[j].Path })
+	sort.Strings(w.coerced)
+	if len(w.errs) > 0 {
+		return nil, nil, &DecodeError{Fields: w.errs}
+	}
+	if len(w.coerced) == 0 {
+		return data, nil, nil
+	}
+	coerced, err := json.Marshal(tree)
+	if err != nil {
+		return nil, nil, err
+	}
+	return coerced, w.coerced, nil
+}
+
+// shapeWalker - обходит дерево JSON значения вместе с типом Go, в который оно декодируется
+type shapeWalker struct {
+	lenient bool
+	errs    []FieldError
+	coerced []string
+}
+
+// walk - проверяет значение v по пути path для типа t и возвращает его (в нестрогом режиме — приведённым)
+func (w *shapeWalker) walk(path string, v any, t reflect.Type) any {
+	if v == nil {
+		// null оставляет поле нулевым
+		return nil
+	}
+	if w.lenient {
+		v = w.coerce(path, v, t)
+	}
+	if t.Kind() != reflect.Interface && reflect.PointerTo(t).Implements(unmarshalerType) {
+		raw, _ := json.Marshal(v)
+		if err := json.Unmarshal(raw, reflect.New(t).Interface()); err != nil {
+			w.fail(path, err.Error())
+		}
+		return v
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return w.walk(path, v, t.Elem())
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			w.mismatch(path, "object", v)
+			return v
+		}
+		w.walkObject(path, obj, t)
+		return obj
+	case reflect.Slice:
+		arr, ok := v.([]any)
+		if !ok {
+			w.mismatch(path, "array", v)
+			return v
+		}
+		for i := range arr {
+			arr[i] = w.walk(path+"["+strconv.Itoa(i)+"]", arr[i], t.Elem())
+		}
+		return arr
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := v.(json.Number)
+		if !ok {
+			w.mismatch(path, "integer", v)
+			return v
+		}
+		if _, err := strconv.ParseInt(n.String(), 10, t.Bits()); err != nil {
+			w.fail(path, fmt.Sprintf("expected integer, got %s", n))
+		}
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			w.mismatch(path, "string", v)
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			w.mismatch(path, "boolean", v)
+		}
+	}
+	return v
+}
+
+// walkObject - проверяет поля объекта obj для структуры t: ключи сопоставляются с тегами json без учёта регистра,
+// как это делает encoding/json
+func (w *shapeWalker) walkObject(path string, obj map[string]any, t reflect.Type) {
+	fields := jsonFields(t)
+	for key, value := range obj {
+		f, ok := fields[strings.ToLower(key)]
+		if !ok {
+			if !w.lenient {
+				w.fail(joinPath(path, key), "unknown field")
+			}
+			continue
+		}
+		obj[key] = w.walk(joinPath(path, f.name), value, f.typ)
+	}
+}
+
+// fillEmptySlices - заменяет пустыми списками отсутствующие в JSON необязательные списки структуры v и вложенных
+// в неё структур; возвращает приведённые поля. Обязательные списки не заполняются: их отсутствие отклоняет валидация.
+func fillEmptySlices(path string, v reflect.Value) []string {
+	var coerced []string
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf, fv := t.Field(i), v.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" || !sf.IsExported() {
+			continue
+		}
+		switch sf.Type.Kind() {
+		case reflect.Struct:
+			if !reflect.PointerTo(sf.Type).Implements(unmarshalerType) {
+				coerced = append(coerced, fillEmptySlices(joinPath(path, name), fv)...)
+			}
+		case reflect.Slice:
+			if fv.IsNil() {
+				// Список с omitempty (например, выставляемые сервером Corrections) пустым не выводится, поэтому не заполняется
+				if !strings.Contains(sf.Tag.Get("validate"), "required") && !strings.Contains(sf.Tag.Get("json"), ",omitempty") {
+					fv.Set(reflect.MakeSlice(sf.Type, 0, 0))
+					coerced = append(coerced, joinPath(path, name)+": missing array to empty")
+				}
+				continue
+			}
+			if sf.Type.Elem().Kind() == reflect.Struct {
+				for j := 0; j < fv.Len(); j++ {
+					coerced = append(coerced, fillEmptySlices(joinPath(path, name)+"["+strconv.Itoa(j)+"]", fv.Index(j))...)
+				}
+			}
+		}
+	}
+	return coerced
+}
+
+// coerce - приводит значение v к типу t, если это типичное несовпадение: строка с целым числом к числу, число к строке
+func (w *shapeWalker) coerce(path string, v any, t reflect.Type) any {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s, ok := v.(string)
+		if !ok {
+			return v
+		}
+		if _, err := strconv.ParseInt(strings.TrimSpace(s), 10, t.Bits()); err != nil {
+			return v
+		}
+		w.coerced = append(w.coerced, path+": string to integer")
+		return json.Number(strings.TrimSpace(s))
+	case reflect.String:
+		n, ok := v.(json.Number)
+		if !ok {
+			return v
+		}
+		w.coerced = append(w.coerced, path+": number to string")
+		return n.String()
+	}
+	return v
+}
+
+func (w *shapeWalker) mismatch(path, want string, v any) {
+	w.fail(path, fmt.Sprintf("expected %s, got %s", want, jsonKind(v)))
+}
+
+func (w *shapeWalker) fail(path, reason string) {
+	if path == "" {
+		path = "$"
+	}
+	w.errs = append(w.errs, FieldError{Path: path, Reason: reason})
+}
+
+// jsonField - поле структуры в JSON представлении
+type jsonField struct {
+	name string
+	typ  reflect.Type
+}
+
+// jsonFields - поля структуры t по именам JSON в нижнем регистре; поля встроенных структур поднимаются на уровень t,
+// а одноимённые поля внешней структуры их скрывают
+func jsonFields(t reflect.Type) map[string]jsonField {
+	fields := make(map[string]jsonField)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			for k, f := range jsonFields(sf.Type) {
+				if _, ok := fields[k]; !ok {
+					fields[k] = f
+				}
+			}
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" || !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields[strings.ToLower(name)] = jsonField{name: name, typ: sf.Type}
+	}
+	return fields
+}
+
+// jsonKind - название типа JSON значения для сообщений об ошибках
+func jsonKind(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return "null"
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
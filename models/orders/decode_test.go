@@ -0,0 +1,159 @@
+package orders
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withDecodeMode - задаёт режим декодирования на время теста
+func withDecodeMode(t *testing.T, mode DecodeMode) {
+	t.Helper()
+	prev := CurrentDecodeMode()
+	SetDecodeMode(mode)
+	t.Cleanup(func() { SetDecodeMode(prev) })
+}
+
+// decodeFieldErrors - пути и причины ошибок декодирования заказа
+func decodeFieldErrors(t *testing.T, data string) []string {
+	t.Helper()
+	var o Order
+	err := json.Unmarshal([]byte(data), &o)
+	var decodeErr *DecodeError
+	require.True(t, errors.As(err, &decodeErr), "expected *DecodeError, got %v", err)
+	var fields []string
+	for _, f := range decodeErr.Fields {
+		fields = append(fields, f.Error())
+	}
+	return fields
+}
+
+func TestLenientDecodeCoercions(t *testing.T) {
+	withDecodeMode(t, DecodeLenient)
+
+	cases := map[string]struct {
+		data    string
+		check   func(t *testing.T, o Order)
+		coerced []string
+	}{
+		"numeric string to int": {
+			data:    `{"order_uid": "o1", "sm_id": " 99 ", "items": [{"price": "453"}]}`,
+			check:   func(t *testing.T, o Order) { assert.Equal(t, 99, o.SmId); assert.Equal(t, 453, o.Items[0].Price) },
+			coerced: []string{"items[0].price: string to integer", "payments: missing array to empty", "sm_id: string to integer"},
+		},
+		"numeric status string": {
+			data:    `{"items": [{"status": "202"}], "payments": []}`,
+			check:   func(t *testing.T, o Order) { assert.Equal(t, ItemStatusInTransit, o.Items[0].Status) },
+			coerced: []string{"items[0].status: string to integer"},
+		},
+		"number to string": {
+			data:    `{"delivery": {"zip": 2639809}, "items": [], "payments": []}`,
+			check:   func(t *testing.T, o Order) { assert.Equal(t, "2639809", o.Delivery.Zip) },
+			coerced: []string{"delivery.zip: number to string"},
+		},
+		"null payments to empty": {
+			data:    `{"items": [], "payments": null}`,
+			check:   func(t *testing.T, o Order) { assert.Equal(t, []Payment{}, o.Payments) },
+			coerced: []string{"payments: missing array to empty"},
+		},
+		"single payment is not coerced": {
+			data:    `{"items": [], "payment": {"amount": "10"}}`,
+			check:   func(t *testing.T, o Order) { assert.Equal(t, []Payment{{Amount: 10}}, o.Payments) },
+			coerced: []string{"payment.amount: string to integer"},
+		},
+		"required items stay missing": {
+			data:    `{"payments": []}`,
+			check:   func(t *testing.T, o Order) { assert.Nil(t, o.Items, "validation rejects the order") },
+			coerced: nil,
+		},
+		"unknown fields are kept as before": {
+			data: `{"items": [{"chrt_id": 1, "weight": 3}], "payments": [], "gift": true}`,
+			check: func(t *testing.T, o Order) {
+				assert.Equal(t, map[string]any{"gift": true}, o.Extras)
+				assert.Equal(t, 1, o.Items[0].ChrtId)
+			},
+			coerced: nil,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var o Order
+			require.NoError(t, json.Unmarshal([]byte(tc.data), &o))
+			tc.check(t, o)
+			assert.Equal(t, tc.coerced, o.Coerced)
+		})
+	}
+}
+
+func TestLenientDecodeRejectsUncoercibleValues(t *testing.T) {
+	withDecodeMode(t, DecodeLenient)
+
+	assert.Equal(t, []string{
+		"delivery: expected object, got array",
+		"items[0].price: expected integer, got string",
+		"sm_id: expected integer, got 1.5",
+	}, decodeFieldErrors(t, `{"sm_id": 1.5, "delivery": [], "items": [{"price": "4 53"}]}`))
+}
+
+func TestStrictDecodeRejections(t *testing.T) {
+	withDecodeMode(t, DecodeStrict)
+
+	cases := map[string]struct {
+		data string
+		want []string
+	}{
+		"unknown top-level field": {`{"order_uid": "o1", "gift": true}`, []string{"gift: unknown field"}},
+		"unknown nested field":    {`{"delivery": {"floor": 3}, "items": [{}, {"weight": 1}]}`, []string{"delivery.floor: unknown field", "items[1].weight: unknown field"}},
+		"numeric string":          {`{"items": [{"price": 1}, {"price": "453"}]}`, []string{"items[1].price: expected integer, got string"}},
+		"number for string":       {`{"delivery": {"zip": 2639809}}`, []string{"delivery.zip: expected string, got number"}},
+		"fraction for int":        {`{"sm_id": 1.5}`, []string{"sm_id: expected integer, got 1.5"}},
+		"int overflow":            {`{"payment": {"amount": 99999999999999999999}}`, []string{"payment.amount: expected integer, got 99999999999999999999"}},
+		"array for object":        {`{"delivery": []}`, []string{"delivery: expected object, got array"}},
+		"object for array":        {`{"items": {}}`, []string{"items: expected array, got object"}},
+		"not an object":           {`[1]`, []string{"$: expected object, got array"}},
+		"bad date":                {`{"date_created": "yesterday"}`, []string{`date_created: parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`}},
+		"string status":           {`{"items": [{"status": "202"}]}`, []string{"items[0].status: json: cannot unmarshal string into Go value of type int"}},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, decodeFieldErrors(t, tc.data))
+		})
+	}
+}
+
+func TestStrictDecodeAcceptsWellFormedOrders(t *testing.T) {
+	withDecodeMode(t, DecodeStrict)
+
+	order := Order{
+		OrderUid:    "o1",
+		Delivery:    Delivery{Zip: "2639809"},
+		Payments:    []Payment{{Amount: 10}},
+		Items:       []Item{{Price: 453, Status: ItemStatusDelivered}},
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+	}
+	data, err := json.Marshal(order)
+	require.NoError(t, err)
+
+	var got Order
+	require.NoError(t, json.Unmarshal(data, &got), "API output, including status objects, is accepted")
+	assert.Equal(t, order, got)
+	assert.Nil(t, got.Coerced)
+
+	// Ключи сопоставляются без учёта регистра, как в encoding/json
+	require.NoError(t, json.Unmarshal([]byte(`{"Order_UID": "o2", "items": [{"PRICE": 1}]}`), &got))
+	assert.Equal(t, "o2", got.OrderUid)
+}
+
+func TestParseDecodeMode(t *testing.T) {
+	for in, want := range map[string]DecodeMode{"": DecodeLenient, "strict": DecodeStrict, "lenient": DecodeLenient} {
+		mode, err := ParseDecodeMode(in)
+		require.NoError(t, err)
+		assert.Equal(t, want, mode)
+	}
+	_, err := ParseDecodeMode("loose")
+	assert.Error(t, err)
+}
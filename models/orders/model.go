@@ -1,46 +1,54 @@
 // Package orders определяет структуры и типы, используемые для представления заказов в системе.
 package orders
 
-import "time"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
 
 // Delivery holds delivery information.
 type Delivery struct {
-	Name    string `json:"name"`
-	Phone   string `json:"phone"`
-	Zip     string `json:"zip"`
-	City    string `json:"city"`
-	Address string `json:"address"`
-	Region  string `json:"region"`
-	Email   string `json:"email"`
+	Name    string `json:"name" xml:"name"`
+	Phone   string `json:"phone" xml:"phone"`
+	Zip     string `json:"zip" xml:"zip"`
+	City    string `json:"city" xml:"city"`
+	Address string `json:"address" xml:"address"`
+	Region  string `json:"region" xml:"region"`
+	Email   string `json:"email" xml:"email"`
 }
 
 // Payment holds payment information.
 type Payment struct {
-	Transaction  string `json:"transaction"`
-	RequestId    string `json:"request_id"`
-	Currency     string `json:"currency"`
-	Provider     string `json:"provider"`
-	Amount       int    `json:"amount"`
-	PaymentDt    int    `json:"payment_dt"`
-	Bank         string `json:"bank"`
-	DeliveryCost int    `json:"delivery_cost"`
-	GoodsTotal   int    `json:"goods_total"`
-	CustomFee    int    `json:"custom_fee"`
+	Transaction  string `json:"transaction" xml:"transaction"`
+	RequestId    string `json:"request_id" xml:"request_id"`
+	Currency     string `json:"currency" xml:"currency"`
+	Provider     string `json:"provider" xml:"provider"`
+	Amount       int    `json:"amount" xml:"amount"`
+	PaymentDt    int    `json:"payment_dt" xml:"payment_dt"`
+	Bank         string `json:"bank" xml:"bank"`
+	DeliveryCost int    `json:"delivery_cost" xml:"delivery_cost"`
+	GoodsTotal   int    `json:"goods_total" xml:"goods_total"`
+	CustomFee    int    `json:"custom_fee" xml:"custom_fee"`
 }
 
 // Item holds information about a single item in an order.
 type Item struct {
-	ChrtId      int    `json:"chrt_id"`
-	TrackNumber string `json:"track_number"`
-	Price       int    `json:"price"`
-	Rid         string `json:"rid"`
-	Name        string `json:"name"`
-	Sale        int    `json:"sale"`
-	Size        string `json:"size"`
-	TotalPrice  int    `json:"total_price"`
-	NmId        int    `json:"nm_id"`
-	Brand       string `json:"brand"`
-	Status      int    `json:"status"`
+	ChrtId      int        `json:"chrt_id" xml:"chrt_id"`
+	TrackNumber string     `json:"track_number" xml:"track_number"`
+	Price       int        `json:"price" xml:"price"`
+	Rid         string     `json:"rid" xml:"rid"`
+	Name        string     `json:"name" xml:"name"`
+	Sale        int        `json:"sale" xml:"sale"`
+	Size        string     `json:"size" xml:"size"`
+	TotalPrice  int        `json:"total_price" xml:"total_price"`
+	NmId        int        `json:"nm_id" xml:"nm_id"`
+	Brand       string     `json:"brand" xml:"brand"`
+	Status      ItemStatus `json:"status" xml:"status"`
 }
 
 // Order represents the main order structure.
@@ -49,14 +57,308 @@ type Order struct {
 	TrackNumber       string    `json:"track_number" validate:"required"`
 	Entry             string    `json:"entry" validate:"required"`
 	Delivery          Delivery  `json:"delivery" validate:"required"`
-	Payment           Payment   `json:"payment" validate:"required"`
+	Payments          []Payment `json:"payments"`
 	Items             []Item    `json:"items" validate:"required"`
 	Locale            string    `json:"locale" validate:"required"`
-	InternalSignature string    `json:"internal_signature" validate:"omitempty"`
+	InternalSignature string    `json:"internal_signature,omitempty" validate:"omitempty"`
 	CustomerId        string    `json:"customer_id" validate:"required"`
 	DeliveryService   string    `json:"delivery_service" validate:"required"`
 	Shardkey          string    `json:"shardkey" validate:"required"`
 	SmId              int       `json:"sm_id" validate:"required"`
 	DateCreated       time.Time `json:"date_created" validate:"required"`
 	OofShard          string    `json:"oof_shard" validate:"required"`
+
+	// Quarantined - заказ помещён в карантин (например, из-за даты создания в будущем) и не попадает в списки заказов.
+	// Признак выставляется сервером при валидации, значение из входящего сообщения не учитывается.
+	Quarantined bool `json:"quarantined,omitempty"`
+
+	// ItemsMissing - у заказа нет ни одного товара. Признак выставляется хранилищем при загрузке товаров заказа
+	// и сервером при валидации, значение из входящего сообщения не учитывается.
+	ItemsMissing bool `json:"items_missing,omitempty"`
+
+	// Corrections - значения полей заказа, расходящиеся с рассчитанными сервером при валидации (например, total_price
+	// товара), исправленные или только отмеченные. Выставляются сервером, значение из входящего сообщения не учитывается.
+	Corrections []Correction `json:"corrections,omitempty"`
+
+	// Warnings - замечания валидации, с которыми заказ принят (например, индекс доставки, не соответствующий формату
+	// региона). Выставляются сервером, значение из входящего сообщения не учитывается.
+	Warnings []Warning `json:"warnings,omitempty"`
+
+	// StoredAt и UpdatedAt - время первого сохранения заказа и его последнего изменения в базе данных, в отличие
+	// от бизнес-даты DateCreated. Их выставляет хранилище, значения из входящего сообщения не сохраняются.
+	// Заказ, ещё не сохранённый в базу данных (например, закэшированный до записи пачки), выводится без них.
+	StoredAt  time.Time `json:"stored_at,omitzero"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+
+	// Source и SourceDetail - путь, которым заказ поступил в сервис (SourceKafka, SourceHTTP, SourceReplay,
+	// SourceDLQReplay), и его подробности: сообщение Kafka topic/partition/offset или идентификатор HTTP запроса.
+	// Их выставляет сервер при приёме заказа и сохраняет хранилище; в JSON, XML и MessagePack заказа они не выводятся,
+	// а одноимённые поля входящего сообщения не учитываются.
+	Source       string `json:"-"`
+	SourceDetail string `json:"-"`
+
+	// Extras содержит дополнительные поля верхнего уровня, не описанные в структуре (например, маркетинговые метки).
+	// Они заполняются при декодировании JSON и выводятся обратно на верхний уровень при кодировании (в XML — элементами
+	// extra, см. MarshalXML).
+	Extras map[string]any `json:"-"`
+
+	// Omitted - разделы, не загруженные из хранилища (например, в списках заказов). Они пустые и не выводятся в JSON,
+	// XML и MessagePack, чтобы не выдавать незагруженные данные за отсутствующие.
+	Omitted Sections `json:"-"`
+
+	// Coerced - поля, приведённые к нужному типу при нестрогом декодировании (DecodeLenient), например
+	// "items[0].price: string to integer". Не сохраняется и не выводится в JSON.
+	Coerced []string `json:"-"`
+}
+
+// Источники заказа (Order.Source).
+const (
+	SourceKafka     = "kafka"      // сообщение топика заказов, прочитанное консьюмером
+	SourceHTTP      = "http"       // запрос POST /orders
+	SourceReplay    = "replay"     // повтор топика (-replay, проверка разрыва при запуске)
+	SourceDLQReplay = "dlq_replay" // повтор очереди недоставленных сообщений (-replay с -replay-dlq)
+	SourceUnknown   = "unknown"    // заказ сохранён до появления источников или без источника
+)
+
+// Correction - расхождение числового поля заказа с рассчитанным сервером значением.
+type Correction struct {
+	Field     string `json:"field" xml:"field"`         // путь поля в JSON заказа, например "items[0].total_price"
+	Original  int    `json:"original" xml:"original"`   // значение из входящего сообщения
+	Corrected int    `json:"corrected" xml:"corrected"` // рассчитанное значение
+	Applied   bool   `json:"applied" xml:"applied"`     // поле заменено рассчитанным значением; false — расхождение только отмечено
+}
+
+// Warning - замечание валидации к значению поля заказа.
+type Warning struct {
+	Field   string `json:"field" xml:"field"`     // путь поля в JSON заказа, например "delivery.zip"
+	Value   string `json:"value" xml:"value"`     // значение из входящего сообщения
+	Message string `json:"message" xml:"message"` // описание нарушения
+}
+
+// Sections - набор разделов заказа, хранящихся отдельно от его заголовка.
+type Sections uint8
+
+// Разделы заказа.
+const (
+	SectionDelivery Sections = 1 << iota // доставка
+	SectionPayments                      // платежи
+	SectionItems                         // товары
+
+	AllSections = SectionDelivery | SectionPayments | SectionItems
+)
+
+// Omit возвращает копию заказа без разделов s: они обнуляются и отмечаются в Omitted.
+func (o Order) Omit(s Sections) Order {
+	s &= AllSections
+	if s&SectionDelivery != 0 {
+		o.Delivery = Delivery{}
+	}
+	if s&SectionPayments != 0 {
+		o.Payments = nil
+	}
+	if s&SectionItems != 0 {
+		// Без загруженных товаров отсутствие товаров не установлено
+		o.Items, o.ItemsMissing = nil, false
+	}
+	o.Omitted |= s
+	return o
+}
+
+// Payment возвращает основной (первый) платёж заказа или nil, если платежей нет.
+//
+// Deprecated: заказ может содержать несколько платежей, используйте Payments.
+func (o *Order) Payment() *Payment {
+	if len(o.Payments) == 0 {
+		return nil
+	}
+	return &o.Payments[0]
+}
+
+// plainOrder - Order без собственных методов кодирования, чтобы избежать рекурсии в UnmarshalJSON и MarshalJSON.
+type plainOrder Order
+
+// orderJSON - JSON представление заказа. Помимо списка payments оно содержит основной платёж payment
+// (null, если платежей нет) для producers и клиентов, знающих только об одном платеже.
+type orderJSON struct {
+	plainOrder
+	Payment *Payment `json:"payment"`
+}
+
+// partialOrderJSON - JSON представление заказа с незагруженными разделами: поля разделов из Omitted не выводятся,
+// а загруженные выводятся так же, как в orderJSON. Поля верхнего уровня скрывают одноимённые поля plainOrder.
+type partialOrderJSON struct {
+	plainOrder
+	Delivery *Delivery       `json:"delivery,omitempty"`
+	Payments *[]Payment      `json:"payments,omitempty"`
+	Payment  json.RawMessage `json:"payment,omitempty"`
+	Items    *[]Item         `json:"items,omitempty"`
+}
+
+// knownOrderFields - имена JSON полей Order в нижнем регистре: encoding/json сопоставляет ключи без учёта регистра.
+var knownOrderFields = func() map[string]bool {
+	known := make(map[string]bool)
+	t := reflect.TypeOf(Order{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		known[strings.ToLower(name)] = true
+	}
+	known["payment"] = true
+	for name := range internalOrderFields {
+		known[name] = true
+	}
+	return known
+}()
+
+// internalOrderFields - поля заказа, которые не выводятся в его представлениях (Source, SourceDetail), но считаются
+// известными: одноимённые ключи входящего сообщения не попадают в Extras и не выводятся как дополнительные поля.
+var internalOrderFields = map[string]bool{"source": true, "source_detail": true}
+
+// UnmarshalJSON декодирует известные поля заказа, а остальные ключи верхнего уровня сохраняет в Extras.
+// Числа в Extras сохраняются как json.Number, чтобы не терять точность при повторном кодировании.
+// Одиночный платёж payment принимается, если список payments не задан.
+// Строгость проверки полей задаёт SetDecodeMode; несовпадения типов возвращаются как *DecodeError с путями полей.
+func (o *Order) UnmarshalJSON(data []byte) error {
+	mode := CurrentDecodeMode()
+	data, coerced, err := checkOrderJSON(data, mode)
+	if err != nil {
+		return err
+	}
+
+	var p orderJSON
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	if len(p.Payments) == 0 && p.Payment != nil {
+		p.Payments = []Payment{*p.Payment}
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	var extras map[string]any
+	for key, raw := range fields {
+		if knownOrderFields[strings.ToLower(key)] {
+			continue
+		}
+		value, err := decodeExtrasValue(raw)
+		if err != nil {
+			return err
+		}
+		if extras == nil {
+			extras = make(map[string]any)
+		}
+		extras[key] = value
+	}
+
+	*o = Order(p.plainOrder)
+	o.Extras = extras
+	if mode == DecodeLenient {
+		coerced = append(coerced, fillEmptySlices("", reflect.ValueOf(o).Elem())...)
+		sort.Strings(coerced)
+	}
+	o.Coerced = coerced
+	return nil
+}
+
+// MarshalJSON кодирует заказ, добавляя поля из Extras на верхний уровень объекта. Разделы из Omitted не выводятся.
+// Вывод не зависит от того, откуда получен заказ (кэш, база данных, входящее сообщение): поля следуют в порядке
+// структуры, дополнительные поля — по алфавиту, списки items и payments всегда выводятся массивами (пустыми, а не null),
+// payment равен null без платежей, а пустые internal_signature, corrections, warnings и нулевые stored_at, updated_at
+// не выводятся. Формат закреплён golden файлами testdata/*.golden.json.
+func (o Order) MarshalJSON() ([]byte, error) {
+	data, err := o.marshalKnown()
+	if err != nil || len(o.Extras) == 0 {
+		return data, err
+	}
+
+	extras := make(map[string]any, len(o.Extras))
+	for key, value := range o.Extras {
+		// Известные поля имеют приоритет, иначе в объекте появились бы дублирующиеся ключи
+		if !knownOrderFields[strings.ToLower(key)] {
+			extras[key] = value
+		}
+	}
+	if len(extras) == 0 {
+		return data, nil
+	}
+	extra, err := json.Marshal(extras)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(data) + len(extra))
+	buf.Write(data[:len(data)-1])
+	buf.WriteByte(',')
+	buf.Write(extra[1:])
+	return buf.Bytes(), nil
+}
+
+// marshalKnown - кодирует поля структуры заказа без Extras
+func (o Order) marshalKnown() ([]byte, error) {
+	o = o.withSectionLists()
+	if o.Omitted&AllSections == 0 {
+		return json.Marshal(orderJSON{plainOrder: plainOrder(o), Payment: o.Payment()})
+	}
+	p := partialOrderJSON{plainOrder: plainOrder(o)}
+	if o.Omitted&SectionDelivery == 0 {
+		p.Delivery = &o.Delivery
+	}
+	if o.Omitted&SectionPayments == 0 {
+		primary, err := json.Marshal(o.Payment())
+		if err != nil {
+			return nil, err
+		}
+		p.Payments, p.Payment = &o.Payments, primary
+	}
+	if o.Omitted&SectionItems == 0 {
+		p.Items = &o.Items
+	}
+	return json.Marshal(p)
+}
+
+// withSectionLists - копия заказа, в которой списки items и payments загруженных разделов не nil, чтобы они
+// выводились пустыми списками. Незагруженные разделы остаются nil.
+func (o Order) withSectionLists() Order {
+	if o.Items == nil && o.Omitted&SectionItems == 0 {
+		o.Items = []Item{}
+	}
+	if o.Payments == nil && o.Omitted&SectionPayments == 0 {
+		o.Payments = []Payment{}
+	}
+	return o
+}
+
+// DecodeExtras декодирует JSON объект дополнительных полей (например, из хранилища). Пустые данные и null дают nil.
+func DecodeExtras(data []byte) (map[string]any, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	value, err := decodeExtrasValue(data)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	extras, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("extras must be a JSON object, got %T", value)
+	}
+	if len(extras) == 0 {
+		return nil, nil
+	}
+	return extras, nil
+}
+
+// decodeExtrasValue декодирует JSON значение дополнительного поля, сохраняя числа как json.Number.
+func decodeExtrasValue(raw []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
 }
@@ -0,0 +1,340 @@
+package orders
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderUnmarshalCollectsUnknownFields(t *testing.T) {
+	data := []byte(`{
+		"order_uid": "b563feb7b2b84b6test",
+		"track_number": "WBILMTESTTRACK",
+		"items": [{"chrt_id": 9934930, "price": 453}],
+		"marketing": {"tags": ["promo", "autumn"], "campaign": {"id": 12345678901234567890, "ratio": 0.25}},
+		"warehouse_hint": "KZN-2",
+		"gift": null
+	}`)
+
+	var o Order
+	require.NoError(t, json.Unmarshal(data, &o))
+	assert.Equal(t, "b563feb7b2b84b6test", o.OrderUid)
+	require.Len(t, o.Items, 1)
+	assert.Equal(t, 453, o.Items[0].Price)
+
+	require.Len(t, o.Extras, 3)
+	assert.Equal(t, "KZN-2", o.Extras["warehouse_hint"])
+	assert.Contains(t, o.Extras, "gift")
+	marketing := o.Extras["marketing"].(map[string]any)
+	assert.Equal(t, []any{"promo", "autumn"}, marketing["tags"])
+	// Большие числа не теряют точность
+	assert.Equal(t, json.Number("12345678901234567890"), marketing["campaign"].(map[string]any)["id"])
+
+	out, err := json.Marshal(o)
+	require.NoError(t, err)
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(out, &fields))
+	assert.JSONEq(t, `{"tags": ["promo", "autumn"], "campaign": {"id": 12345678901234567890, "ratio": 0.25}}`, string(fields["marketing"]))
+	assert.JSONEq(t, `"KZN-2"`, string(fields["warehouse_hint"]))
+	assert.JSONEq(t, `null`, string(fields["gift"]))
+	assert.JSONEq(t, `"WBILMTESTTRACK"`, string(fields["track_number"]))
+	assert.NotContains(t, fields, "Extras")
+	assert.JSONEq(t, `[]`, string(fields["payments"]), "a missing payments list is encoded as an empty array")
+
+	var again Order
+	require.NoError(t, json.Unmarshal(out, &again))
+	o.Payments = []Payment{}
+	assert.Equal(t, o, again)
+}
+
+func TestOrderWithoutExtras(t *testing.T) {
+	o := Order{OrderUid: "order-1", DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC), Payments: []Payment{}, Items: []Item{}}
+	out, err := json.Marshal(o)
+	require.NoError(t, err)
+
+	plain, err := json.Marshal(orderJSON{plainOrder: plainOrder(o)})
+	require.NoError(t, err)
+	assert.Equal(t, string(plain), string(out), "orders without extras encode without additional fields")
+
+	var got Order
+	require.NoError(t, json.Unmarshal(out, &got))
+	assert.Nil(t, got.Extras)
+	assert.Equal(t, o, got)
+}
+
+func TestOrderKnownFieldsAreMatchedCaseInsensitively(t *testing.T) {
+	var o Order
+	require.NoError(t, json.Unmarshal([]byte(`{"Order_UID": "order-1", "LOCALE": "en"}`), &o))
+	assert.Equal(t, "order-1", o.OrderUid)
+	assert.Equal(t, "en", o.Locale)
+	assert.Nil(t, o.Extras)
+}
+
+func TestOrderMarshalSkipsExtrasShadowingKnownFields(t *testing.T) {
+	o := Order{OrderUid: "order-1", Extras: map[string]any{"order_uid": "spoofed", "tag": "x"}}
+	out, err := json.Marshal(o)
+	require.NoError(t, err)
+
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(out, &fields))
+	assert.Equal(t, "order-1", fields["order_uid"])
+	assert.Equal(t, "x", fields["tag"])
+}
+
+func TestDecodeExtras(t *testing.T) {
+	extras, err := DecodeExtras(nil)
+	require.NoError(t, err)
+	assert.Nil(t, extras)
+
+	extras, err = DecodeExtras([]byte(`null`))
+	require.NoError(t, err)
+	assert.Nil(t, extras)
+
+	extras, err = DecodeExtras([]byte(`{"n": 1.50}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"n": json.Number("1.50")}, extras)
+
+	_, err = DecodeExtras([]byte(`[1]`))
+	assert.Error(t, err)
+}
+
+func TestOrderPayments(t *testing.T) {
+	first := Payment{Transaction: "t-1", Amount: 100}
+	second := Payment{Transaction: "t-2", Amount: 0}
+
+	for _, tc := range []struct {
+		name     string
+		payments []Payment
+		primary  string
+	}{
+		{name: "none", payments: nil, primary: `null`},
+		{name: "one", payments: []Payment{first}, primary: `{"transaction":"t-1","request_id":"","currency":"","provider":"","amount":100,"payment_dt":0,"bank":"","delivery_cost":0,"goods_total":0,"custom_fee":0}`},
+		{name: "two", payments: []Payment{first, second}, primary: `{"transaction":"t-1","request_id":"","currency":"","provider":"","amount":100,"payment_dt":0,"bank":"","delivery_cost":0,"goods_total":0,"custom_fee":0}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := Order{OrderUid: "order-1", Payments: tc.payments}
+			out, err := json.Marshal(o)
+			require.NoError(t, err)
+
+			var fields map[string]json.RawMessage
+			require.NoError(t, json.Unmarshal(out, &fields))
+			assert.JSONEq(t, tc.primary, string(fields["payment"]))
+
+			var got Order
+			require.NoError(t, json.Unmarshal(out, &got))
+			if tc.payments == nil {
+				assert.JSONEq(t, `[]`, string(fields["payments"]))
+				assert.Empty(t, got.Payments)
+			} else {
+				assert.Equal(t, tc.payments, got.Payments)
+			}
+			assert.Nil(t, got.Extras)
+		})
+	}
+}
+
+func TestOrderOmittedSections(t *testing.T) {
+	full := Order{
+		OrderUid: "order-1",
+		Delivery: Delivery{Name: "Test"},
+		Payments: []Payment{{Transaction: "t-1"}},
+		Items:    []Item{{ChrtId: 1}},
+		Extras:   map[string]any{"campaign": "spring"},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		omit    Sections
+		present []string
+		absent  []string
+	}{
+		{name: "none", omit: 0, present: []string{"delivery", "payments", "payment", "items"}},
+		{name: "items", omit: SectionItems, present: []string{"delivery", "payments", "payment"}, absent: []string{"items"}},
+		{name: "all", omit: AllSections, absent: []string{"delivery", "payments", "payment", "items"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := full.Omit(tc.omit)
+			assert.Equal(t, tc.omit, o.Omitted)
+			if tc.omit&SectionItems != 0 {
+				assert.Nil(t, o.Items)
+			}
+			if tc.omit&SectionDelivery != 0 {
+				assert.Zero(t, o.Delivery)
+			}
+
+			out, err := json.Marshal(o)
+			require.NoError(t, err)
+			var fields map[string]json.RawMessage
+			require.NoError(t, json.Unmarshal(out, &fields))
+			for _, key := range tc.present {
+				assert.Contains(t, fields, key)
+			}
+			for _, key := range tc.absent {
+				assert.NotContains(t, fields, key)
+			}
+			assert.Contains(t, fields, "campaign")
+			assert.JSONEq(t, `"order-1"`, string(fields["order_uid"]))
+		})
+	}
+
+	// Загруженный раздел без данных выводится как обычно, а не пропускается
+	out, err := json.Marshal(Order{OrderUid: "order-1"}.Omit(SectionItems))
+	require.NoError(t, err)
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(out, &fields))
+	assert.JSONEq(t, `[]`, string(fields["payments"]))
+	assert.JSONEq(t, `null`, string(fields["payment"]))
+	assert.NotContains(t, fields, "items")
+}
+
+func TestOrderWithoutItemsJSON(t *testing.T) {
+	for _, o := range []Order{
+		{OrderUid: "order-1", ItemsMissing: true},
+		{OrderUid: "order-1", Items: []Item{}, ItemsMissing: true},
+	} {
+		out, err := json.Marshal(o)
+		require.NoError(t, err)
+		var fields map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal(out, &fields))
+		assert.JSONEq(t, `[]`, string(fields["items"]), "items is never null")
+		assert.JSONEq(t, `true`, string(fields["items_missing"]))
+	}
+
+	// Признак выводится только у заказов без товаров, а у незагруженных товаров сбрасывается
+	out, err := json.Marshal(Order{OrderUid: "order-1", Items: []Item{{ChrtId: 1}}})
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "items_missing")
+	omitted := Order{OrderUid: "order-1", ItemsMissing: true}.Omit(SectionItems)
+	assert.False(t, omitted.ItemsMissing)
+}
+
+func TestOrderAcceptsSinglePayment(t *testing.T) {
+	var o Order
+	require.NoError(t, json.Unmarshal([]byte(`{"order_uid": "order-1", "payment": {"transaction": "t-1", "amount": 0}}`), &o))
+	require.Len(t, o.Payments, 1)
+	assert.Equal(t, "t-1", o.Payments[0].Transaction)
+	assert.Same(t, &o.Payments[0], o.Payment())
+
+	// Явный список платежей имеет приоритет над одиночным платежом
+	require.NoError(t, json.Unmarshal([]byte(`{"payment": {"transaction": "t-1"}, "payments": [{"transaction": "t-2"}, {"transaction": "t-3"}]}`), &o))
+	require.Len(t, o.Payments, 2)
+	assert.Equal(t, "t-2", o.Payment().Transaction)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"payment": null}`), &o))
+	assert.Empty(t, o.Payments)
+	assert.Nil(t, o.Payment())
+}
+
+func TestItemStatusJSON(t *testing.T) {
+	// Producers присылают статус числом
+	var item Item
+	require.NoError(t, json.Unmarshal([]byte(`{"chrt_id": 1, "status": 202}`), &item))
+	assert.Equal(t, ItemStatusInTransit, item.Status)
+	assert.Equal(t, "in_transit", item.Status.String())
+
+	out, err := json.Marshal(item)
+	require.NoError(t, err)
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(out, &fields))
+	assert.JSONEq(t, `{"code": 202, "label": "in_transit"}`, string(fields["status"]))
+
+	// Закодированный объект декодируется обратно в тот же статус
+	var again Item
+	require.NoError(t, json.Unmarshal(out, &again))
+	assert.Equal(t, item, again)
+
+	// Неизвестный код сохраняется с меткой unknown
+	unknown, err := json.Marshal(ItemStatus(999))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"code": 999, "label": "unknown"}`, string(unknown))
+	assert.False(t, ItemStatus(999).Known())
+	assert.False(t, ItemStatusUnknown.Known())
+
+	assert.Error(t, json.Unmarshal([]byte(`{"label": "delivered"}`), &again.Status))
+	assert.Error(t, json.Unmarshal([]byte(`"delivered"`), &again.Status))
+}
+
+func TestItemStatuses(t *testing.T) {
+	statuses := ItemStatuses()
+	require.NotEmpty(t, statuses)
+	assert.Equal(t, StatusLabel{Code: ItemStatusAccepted, Label: "accepted"}, statuses[0])
+	for _, s := range statuses {
+		assert.True(t, s.Code.Known(), s.Label)
+		assert.Equal(t, s.Label, s.Code.String())
+	}
+
+	// Возвращается копия: изменение не затрагивает известные статусы
+	statuses[0].Label = "changed"
+	assert.Equal(t, "accepted", ItemStatusAccepted.String())
+}
+
+// fullOrder - заказ, в котором заполнены все выводимые поля, включая дополнительные
+func fullOrder() Order {
+	date := time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)
+	return Order{
+		OrderUid:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: Delivery{Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com"},
+		Payments: []Payment{
+			{Transaction: "b563feb7b2b84b6test", Currency: "USD", Provider: "wbpay", Amount: 1817, PaymentDt: 1637907727,
+				Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317},
+			{Transaction: "b563feb7b2b84b6test-2", RequestId: "r-2", Currency: "USD", Provider: "wbpay", Amount: 100,
+				PaymentDt: 1637907800, Bank: "alpha", CustomFee: 10},
+		},
+		Items: []Item{{ChrtId: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, Rid: "ab4219087a764ae0btest",
+			Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: 317, NmId: 2389212, Brand: "Vivienne Sabo", Status: 202}},
+		Locale:            "en",
+		InternalSignature: "sig-1",
+		CustomerId:        "test",
+		DeliveryService:   "meest",
+		Shardkey:          "9",
+		SmId:              99,
+		DateCreated:       date,
+		OofShard:          "1",
+		Quarantined:       true,
+		Corrections:       []Correction{{Field: "items[0].total_price", Original: 300, Corrected: 317, Applied: true}},
+		Warnings:          []Warning{{Field: "delivery.zip", Value: "2639809", Message: "zip does not match the region format"}},
+		StoredAt:          date.Add(time.Minute),
+		UpdatedAt:         date.Add(time.Hour),
+		Extras:            map[string]any{"warehouse_hint": "KZN-2", "campaign": map[string]any{"id": json.Number("42")}},
+	}
+}
+
+// updateGolden - перезаписывает golden файлы testdata/*.golden.json текущим выводом: go test ./models/orders -update
+var updateGolden = flag.Bool("update", false, "rewrite testdata/*.golden.json with the current JSON output")
+
+// TestOrderJSONGolden закрепляет формат заказа в ответах API: случайное изменение порядка полей, omitempty
+// или null вместо пустого списка должно менять golden файл явно.
+func TestOrderJSONGolden(t *testing.T) {
+	date := time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)
+	full := fullOrder()
+	minimal := Order{OrderUid: "order-1", DateCreated: date}
+
+	for name, o := range map[string]Order{"order_full": full, "order_minimal": minimal} {
+		t.Run(name, func(t *testing.T) {
+			out, err := json.Marshal(o)
+			require.NoError(t, err)
+			var indented bytes.Buffer
+			require.NoError(t, json.Indent(&indented, out, "", "  "))
+			indented.WriteByte('\n')
+
+			path := filepath.Join("testdata", name+".golden.json")
+			if *updateGolden {
+				require.NoError(t, os.MkdirAll("testdata", 0o755))
+				require.NoError(t, os.WriteFile(path, indented.Bytes(), 0o644))
+			}
+			golden, err := os.ReadFile(path)
+			require.NoError(t, err, "run go test ./models/orders -update to create the golden file")
+			assert.Equal(t, string(golden), indented.String(), "the order wire format changed; rerun with -update if intended")
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package orders
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+// msgpackField - поле Order в MessagePack представлении
+type msgpackField struct {
+	index     int      // номер поля в структуре Order
+	name      string   // ключ: JSON имя поля
+	omitEmpty bool     // пустое значение не выводится, как с omitempty и omitzero в JSON
+	section   Sections // раздел, к которому относится поле; пустой раздел — заголовок заказа
+}
+
+// msgpackFieldSections - разделы заказа по ключам их полей
+var msgpackFieldSections = map[string]Sections{
+	"delivery": SectionDelivery,
+	"payments": SectionPayments,
+	"items":    SectionItems,
+}
+
+// msgpackFields и msgpackFieldsByName - поля Order, выводимые в MessagePack, в порядке структуры и по ключам
+var msgpackFields, msgpackFieldsByName = func() ([]msgpackField, map[string]msgpackField) {
+	var list []msgpackField
+	byName := make(map[string]msgpackField)
+	t := reflect.TypeOf(Order{})
+	for i := 0; i < t.NumField(); i++ {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		f := msgpackField{index: i, name: name, omitEmpty: opts == "omitempty" || opts == "omitzero", section: msgpackFieldSections[name]}
+		list = append(list, f)
+		byName[name] = f
+	}
+	return list, byName
+}()
+
+// NewMsgpackEncoder создает кодировщик MessagePack, в котором ключи структур совпадают с JSON (берутся из тегов json),
+// а целые числа кодируются в наименьшем формате. Так кодируются заказы и ответы API в формате MessagePack.
+func NewMsgpackEncoder(w io.Writer) *msgpack.Encoder {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	return enc
+}
+
+// NewMsgpackDecoder создает декодер MessagePack для данных, закодированных NewMsgpackEncoder.
+func NewMsgpackDecoder(r io.Reader) *msgpack.Decoder {
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+	return dec
+}
+
+// EncodeMsgpack кодирует заказ словарём с теми же ключами и по тем же правилам, что и MarshalJSON: дополнительные поля
+// на верхнем уровне, основной платёж payment, пустые списки вместо nil, без разделов из Omitted. Даты кодируются
+// расширением timestamp, числа дополнительных полей — числами MessagePack. Вложенные структуры выводятся с ключами
+// из тегов json, если кодировщик создан NewMsgpackEncoder.
+func (o Order) EncodeMsgpack(enc *msgpack.Encoder) error {
+	o = o.withSectionLists()
+	type entry struct {
+		key   string
+		value any
+	}
+	entries := make([]entry, 0, len(msgpackFields)+1+len(o.Extras))
+	v := reflect.ValueOf(o)
+	for _, f := range msgpackFields {
+		if o.Omitted&f.section != 0 {
+			continue
+		}
+		value := v.Field(f.index)
+		if f.omitEmpty && (value.IsZero() || value.Kind() == reflect.Slice && value.Len() == 0) {
+			continue
+		}
+		entries = append(entries, entry{key: f.name, value: value.Interface()})
+	}
+	if o.Omitted&SectionPayments == 0 {
+		entries = append(entries, entry{key: "payment", value: o.Payment()})
+	}
+	extras := make([]string, 0, len(o.Extras))
+	for key := range o.Extras {
+		if !knownOrderFields[strings.ToLower(key)] {
+			extras = append(extras, key)
+		}
+	}
+	sort.Strings(extras)
+	for _, key := range extras {
+		entries = append(entries, entry{key: key, value: msgpackExtrasValue(o.Extras[key])})
+	}
+
+	if err := enc.EncodeMapLen(len(entries)); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := enc.EncodeString(e.key); err != nil {
+			return err
+		}
+		if err := enc.Encode(e.value); err != nil {
+			return fmt.Errorf("%s: %w", e.key, err)
+		}
+	}
+	return nil
+}
+
+// DecodeMsgpack декодирует заказ, закодированный EncodeMsgpack. Как и в UnmarshalJSON, неизвестные ключи сохраняются
+// в Extras (числа — как json.Number), а одиночный платёж payment принимается, если список payments не задан.
+// Даты приводятся к UTC: timestamp MessagePack не хранит часовой пояс.
+func (o *Order) DecodeMsgpack(dec *msgpack.Decoder) error {
+	n, err := dec.DecodeMapLen()
+	if err != nil {
+		return err
+	}
+	var decoded Order
+	var primary *Payment
+	v := reflect.ValueOf(&decoded).Elem()
+	for i := 0; i < n; i++ {
+		key, err := dec.DecodeString()
+		if err != nil {
+			return err
+		}
+		if f, ok := msgpackFieldsByName[key]; ok {
+			if err := dec.DecodeValue(v.Field(f.index)); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			continue
+		}
+		if key == "payment" {
+			if err := dec.Decode(&primary); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			continue
+		}
+		value, err := dec.DecodeInterface()
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if decoded.Extras == nil {
+			decoded.Extras = make(map[string]any)
+		}
+		decoded.Extras[key] = extrasNumbers(value)
+	}
+	if len(decoded.Payments) == 0 && primary != nil {
+		decoded.Payments = []Payment{*primary}
+	}
+	for _, t := range []*time.Time{&decoded.DateCreated, &decoded.StoredAt, &decoded.UpdatedAt} {
+		if !t.IsZero() {
+			*t = t.UTC()
+		}
+	}
+	*o = decoded
+	return nil
+}
+
+// msgpackExtrasValue - значение дополнительного поля для MessagePack: json.Number заменяется целым числом, если оно
+// представимо int64 или uint64, иначе числом с плавающей точкой
+func msgpackExtrasValue(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if n, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return n
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return string(v)
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[key] = msgpackExtrasValue(item)
+		}
+		return m
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = msgpackExtrasValue(item)
+		}
+		return list
+	default:
+		return value
+	}
+}
+
+// extrasNumbers - значение дополнительного поля, декодированное из MessagePack, с числами в виде json.Number,
+// как после декодирования JSON
+func extrasNumbers(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = extrasNumbers(item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = extrasNumbers(item)
+		}
+		return v
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return json.Number(strconv.FormatInt(rv.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return json.Number(strconv.FormatUint(rv.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		return json.Number(strconv.FormatFloat(rv.Float(), 'g', -1, 64))
+	default:
+		return value
+	}
+}
+
+// EncodeMsgpack кодирует статус словарём {"code": 202, "label": "in_transit"}, как MarshalJSON.
+func (s ItemStatus) EncodeMsgpack(enc *msgpack.Encoder) error {
+	if err := enc.EncodeMapLen(2); err != nil {
+		return err
+	}
+	if err := enc.EncodeString("code"); err != nil {
+		return err
+	}
+	if err := enc.EncodeInt(int64(s)); err != nil {
+		return err
+	}
+	if err := enc.EncodeString("label"); err != nil {
+		return err
+	}
+	return enc.EncodeString(s.String())
+}
+
+// DecodeMsgpack принимает как число, так и словарь с кодом, полученный от EncodeMsgpack; метка не учитывается.
+func (s *ItemStatus) DecodeMsgpack(dec *msgpack.Decoder) error {
+	c, err := dec.PeekCode()
+	if err != nil {
+		return err
+	}
+	if !msgpcode.IsFixedMap(c) && c != msgpcode.Map16 && c != msgpcode.Map32 {
+		code, err := dec.DecodeInt()
+		*s = ItemStatus(code)
+		return err
+	}
+	n, err := dec.DecodeMapLen()
+	if err != nil {
+		return err
+	}
+	found := false
+	for i := 0; i < n; i++ {
+		key, err := dec.DecodeString()
+		if err != nil {
+			return err
+		}
+		if key != "code" {
+			if err := dec.Skip(); err != nil {
+				return err
+			}
+			continue
+		}
+		code, err := dec.DecodeInt()
+		if err != nil {
+			return err
+		}
+		*s, found = ItemStatus(code), true
+	}
+	if !found {
+		return errItemStatusNoCode
+	}
+	return nil
+}
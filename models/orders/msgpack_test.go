@@ -0,0 +1,73 @@
+package orders
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// encodeMsgpack - кодирует v кодировщиком NewMsgpackEncoder
+func encodeMsgpack(t *testing.T, v any) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, NewMsgpackEncoder(&buf).Encode(v))
+	return buf.Bytes()
+}
+
+// sortedKeys - ключи словаря по алфавиту
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestOrderMsgpackRoundTrip(t *testing.T) {
+	full := fullOrder()
+	var again Order
+	require.NoError(t, NewMsgpackDecoder(bytes.NewReader(encodeMsgpack(t, full))).Decode(&again))
+	assert.Equal(t, full, again)
+}
+
+func TestOrderMsgpackMatchesJSONKeys(t *testing.T) {
+	for name, o := range map[string]Order{
+		"full":    fullOrder(),
+		"minimal": {OrderUid: "order-1"},
+		"partial": fullOrder().Omit(SectionDelivery | SectionPayments),
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(o)
+			require.NoError(t, err)
+			var jsonFields map[string]json.RawMessage
+			require.NoError(t, json.Unmarshal(data, &jsonFields))
+
+			// Ключи читаются любым декодером MessagePack, без настройки тегов
+			var fields map[string]any
+			require.NoError(t, msgpack.Unmarshal(encodeMsgpack(t, o), &fields))
+			assert.Equal(t, sortedKeys(jsonFields), sortedKeys(fields))
+		})
+	}
+
+	var fields map[string]any
+	require.NoError(t, msgpack.Unmarshal(encodeMsgpack(t, fullOrder()), &fields))
+	item := fields["items"].([]any)[0].(map[string]any)
+	assert.EqualValues(t, 9934930, item["chrt_id"])
+	status := item["status"].(map[string]any)
+	assert.EqualValues(t, 202, status["code"])
+	assert.Equal(t, "in_transit", status["label"])
+	assert.Equal(t, map[string]any{"id": int8(42)}, fields["campaign"], "extras numbers are encoded as numbers")
+}
+
+func TestItemStatusMsgpack(t *testing.T) {
+	var s ItemStatus
+	require.NoError(t, NewMsgpackDecoder(bytes.NewReader(encodeMsgpack(t, 203))).Decode(&s))
+	assert.Equal(t, ItemStatusDelivered, s)
+	assert.Error(t, NewMsgpackDecoder(bytes.NewReader(encodeMsgpack(t, map[string]string{"label": "delivered"}))).Decode(&s))
+}
@@ -0,0 +1,205 @@
+package orders
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema - JSON Schema (подмножество draft 2020-12), описывающая JSON представление заказа: типы полей, обязательные
+// поля и вложенные объекты. Строится по тегам json структур заказа функцией OrderSchema.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 []string           `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"` // date-time для времени в RFC 3339
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+}
+
+// schemaDialect - версия JSON Schema в поле $schema
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// OrderSchema возвращает JSON Schema заказа в том виде, в котором его кодирует MarshalJSON: поля без omitempty
+// и omitzero обязательны, списки и указатели допускают null. Неизвестные поля не допускаются ни на каком уровне,
+// как при DecodeStrict, поэтому переименование поля в одном из участников обмена нарушает схему. Дополнительные
+// поля верхнего уровня (Extras) в схему не входят.
+func OrderSchema() *Schema {
+	s := schemaOf(orderShape)
+	s.Schema, s.Title = schemaDialect, "Order"
+	return s
+}
+
+// schemaOf - схема значений типа t
+func schemaOf(t reflect.Type) *Schema {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return &Schema{Type: []string{"string"}, Format: "date-time"}
+	case reflect.TypeOf(ItemStatus(0)):
+		// Producers присылают код числом, а MarshalJSON выводит объект с кодом и меткой
+		return &Schema{
+			Type: []string{"integer", "object"},
+			Properties: map[string]*Schema{
+				"code":  {Type: []string{"integer"}},
+				"label": {Type: []string{"string"}},
+			},
+			Required:             []string{"code"},
+			AdditionalProperties: new(bool),
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := schemaOf(t.Elem())
+		s.Type = append(s.Type, "null")
+		return s
+	case reflect.Slice:
+		return &Schema{Type: []string{"array", "null"}, Items: schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: []string{"object", "null"}}
+	case reflect.Struct:
+		s := &Schema{Type: []string{"object"}, Properties: make(map[string]*Schema), AdditionalProperties: new(bool)}
+		for _, f := range schemaFields(t) {
+			s.Properties[f.name] = schemaOf(f.typ)
+			if !f.optional {
+				s.Required = append(s.Required, f.name)
+			}
+		}
+		return s
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: []string{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: []string{"number"}}
+	case reflect.Bool:
+		return &Schema{Type: []string{"boolean"}}
+	case reflect.String:
+		return &Schema{Type: []string{"string"}}
+	default:
+		return &Schema{}
+	}
+}
+
+// schemaField - поле JSON объекта структуры
+type schemaField struct {
+	name     string
+	typ      reflect.Type
+	optional bool // omitempty или omitzero: поле может отсутствовать
+}
+
+// schemaFields - поля JSON объекта структуры t в порядке объявления; поля встроенных структур поднимаются
+// на уровень t, а одноимённые поля внешней структуры их скрывают, как в jsonFields
+func schemaFields(t reflect.Type) []schemaField {
+	var fields []schemaField
+	index := make(map[string]int)
+	add := func(f schemaField, outer bool) {
+		if i, ok := index[f.name]; ok {
+			if outer {
+				fields[i] = f
+			}
+			return
+		}
+		index[f.name] = len(fields)
+		fields = append(fields, f)
+	}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			for _, f := range schemaFields(sf.Type) {
+				add(f, false)
+			}
+			continue
+		}
+		name, opts, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" || !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		flags := strings.Split(opts, ",")
+		optional := slices.Contains(flags, "omitempty") || slices.Contains(flags, "omitzero")
+		add(schemaField{name: name, typ: sf.Type, optional: optional}, true)
+	}
+	return fields
+}
+
+// Validate проверяет JSON документ data по схеме. Несоответствия возвращаются DecodeError с путями полей,
+// отсортированными по пути, например "items[1].price: expected integer, got string".
+func (s *Schema) Validate(data []byte) error {
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	var errs []FieldError
+	s.validate("", v, &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+	return &DecodeError{Fields: errs}
+}
+
+// validate - проверяет значение v по пути path и добавляет несоответствия в errs
+func (s *Schema) validate(path string, v any, errs *[]FieldError) {
+	kind := schemaKind(v)
+	if len(s.Type) > 0 && !slices.Contains(s.Type, kind) && !(kind == "integer" && slices.Contains(s.Type, "number")) {
+		*errs = append(*errs, FieldError{Path: path, Reason: fmt.Sprintf("expected %s, got %s", strings.Join(s.Type, " or "), kind)})
+		return
+	}
+
+	switch v := v.(type) {
+	case string:
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+				*errs = append(*errs, FieldError{Path: path, Reason: "expected RFC 3339 date-time"})
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(path+"["+strconv.Itoa(i)+"]", item, errs)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, FieldError{Path: joinPath(path, name), Reason: "required field is missing"})
+			}
+		}
+		for key, value := range v {
+			prop, ok := s.Properties[key]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					*errs = append(*errs, FieldError{Path: joinPath(path, key), Reason: "unknown field"})
+				}
+				continue
+			}
+			prop.validate(joinPath(path, key), value, errs)
+		}
+	}
+}
+
+// schemaKind - тип JSON Schema значения, декодированного с UseNumber
+func schemaKind(v any) string {
+	switch v := v.(type) {
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case nil:
+		return "null"
+	default:
+		return jsonKind(v)
+	}
+}
@@ -0,0 +1,111 @@
+package orders
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOrderSchemaGolden закрепляет схему заказа: переименование поля, изменение его типа или omitempty меняет
+// golden файл testdata/order_schema.golden.json, который перезаписывается явно (go test ./models/orders -update).
+func TestOrderSchemaGolden(t *testing.T) {
+	out, err := json.MarshalIndent(OrderSchema(), "", "  ")
+	require.NoError(t, err)
+	out = append(out, '\n')
+
+	path := filepath.Join("testdata", "order_schema.golden.json")
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(path, out, 0o644))
+	}
+	golden, err := os.ReadFile(path)
+	require.NoError(t, err, "run go test ./models/orders -update to create the golden file")
+	assert.Equal(t, string(golden), string(out), "the order schema changed; rerun with -update if intended")
+}
+
+func TestOrderSchemaShape(t *testing.T) {
+	s := OrderSchema()
+	assert.Equal(t, []string{"object"}, s.Type)
+	assert.Contains(t, s.Required, "order_uid")
+	assert.Contains(t, s.Required, "payment", "the primary payment is always written, null without payments")
+	assert.NotContains(t, s.Required, "internal_signature", "omitempty fields are optional")
+	assert.NotContains(t, s.Required, "stored_at", "omitzero fields are optional")
+	assert.Equal(t, []string{"object", "null"}, s.Properties["payment"].Type)
+	assert.Equal(t, []string{"array", "null"}, s.Properties["items"].Type)
+	assert.Equal(t, []string{"integer", "object"}, s.Properties["items"].Items.Properties["status"].Type)
+	assert.Equal(t, "date-time", s.Properties["date_created"].Format)
+}
+
+func TestOrderSchemaValidatesWireFormat(t *testing.T) {
+	for _, name := range []string{"order_full", "order_minimal"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name+".golden.json"))
+		require.NoError(t, err)
+		if name == "order_full" {
+			// Дополнительные поля других producers в схему не входят
+			var obj map[string]any
+			require.NoError(t, json.Unmarshal(data, &obj))
+			delete(obj, "warehouse_hint")
+			delete(obj, "campaign")
+			data, err = json.Marshal(obj)
+			require.NoError(t, err)
+		}
+		assert.NoError(t, OrderSchema().Validate(data), name)
+	}
+
+	// Статус товара в формате producers — число
+	o := Order{OrderUid: "order-1", DateCreated: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), Items: []Item{{Status: ItemStatusAccepted}}}
+	data, err := json.Marshal(o)
+	require.NoError(t, err)
+	data = bytes.Replace(data, []byte(`{"code":200,"label":"accepted"}`), []byte(`200`), 1)
+	assert.NoError(t, OrderSchema().Validate(data))
+}
+
+func TestOrderSchemaRejectsDrift(t *testing.T) {
+	valid, err := json.Marshal(Order{OrderUid: "order-1", DateCreated: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+	var base map[string]any
+	require.NoError(t, json.Unmarshal(valid, &base))
+
+	for name, tc := range map[string]struct {
+		edit func(obj map[string]any)
+		want []FieldError
+	}{
+		"renamed field": {
+			edit: func(obj map[string]any) { obj["orderUID"] = obj["order_uid"]; delete(obj, "order_uid") },
+			want: []FieldError{{Path: "orderUID", Reason: "unknown field"}, {Path: "order_uid", Reason: "required field is missing"}},
+		},
+		"changed type": {
+			edit: func(obj map[string]any) { obj["sm_id"] = "99" },
+			want: []FieldError{{Path: "sm_id", Reason: "expected integer, got string"}},
+		},
+		"nested field": {
+			edit: func(obj map[string]any) {
+				obj["items"] = []any{map[string]any{"chrt_id": 1.5, "track_number": "", "price": 0, "rid": "", "name": "",
+					"sale": 0, "size": "", "total_price": 0, "nm_id": 0, "brand": "", "status": 0}}
+			},
+			want: []FieldError{{Path: "items[0].chrt_id", Reason: "expected integer, got number"}},
+		},
+		"date format": {
+			edit: func(obj map[string]any) { obj["date_created"] = "01.05.2024" },
+			want: []FieldError{{Path: "date_created", Reason: "expected RFC 3339 date-time"}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			obj := make(map[string]any, len(base))
+			for k, v := range base {
+				obj[k] = v
+			}
+			tc.edit(obj)
+			data, err := json.Marshal(obj)
+			require.NoError(t, err)
+			var decodeErr *DecodeError
+			require.ErrorAs(t, OrderSchema().Validate(data), &decodeErr)
+			assert.Equal(t, tc.want, decodeErr.Fields)
+		})
+	}
+}
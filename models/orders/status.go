@@ -0,0 +1,102 @@
+package orders
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// ItemStatus - код статуса товара в жизненном цикле заказа.
+type ItemStatus int
+
+// Известные статусы товара.
+const (
+	ItemStatusUnknown    ItemStatus = 0   // статус не задан или не распознан
+	ItemStatusAccepted   ItemStatus = 200 // заказ принят
+	ItemStatusAssembling ItemStatus = 201 // товар собирается на складе
+	ItemStatusInTransit  ItemStatus = 202 // товар передан в доставку
+	ItemStatusDelivered  ItemStatus = 203 // товар получен покупателем
+	ItemStatusCancelled  ItemStatus = 204 // заказ товара отменён
+	ItemStatusReturned   ItemStatus = 205 // товар возвращён продавцу
+)
+
+// itemStatusLabels - метки известных статусов в порядке жизненного цикла
+var itemStatusLabels = []StatusLabel{
+	{Code: ItemStatusAccepted, Label: "accepted"},
+	{Code: ItemStatusAssembling, Label: "assembling"},
+	{Code: ItemStatusInTransit, Label: "in_transit"},
+	{Code: ItemStatusDelivered, Label: "delivered"},
+	{Code: ItemStatusCancelled, Label: "cancelled"},
+	{Code: ItemStatusReturned, Label: "returned"},
+}
+
+// unknownStatusLabel - метка статуса, которого нет среди известных
+const unknownStatusLabel = "unknown"
+
+// errItemStatusNoCode - в закодированном объектом статусе нет кода
+var errItemStatusNoCode = errors.New("item status has no code")
+
+// StatusLabel - код статуса товара и его метка. Так статус представлен в JSON.
+type StatusLabel struct {
+	Code  ItemStatus `json:"code"`
+	Label string     `json:"label"`
+}
+
+// ItemStatuses возвращает известные статусы товара с метками в порядке жизненного цикла.
+func ItemStatuses() []StatusLabel {
+	return append([]StatusLabel(nil), itemStatusLabels...)
+}
+
+// Known сообщает, входит ли статус в число известных.
+func (s ItemStatus) Known() bool {
+	for _, l := range itemStatusLabels {
+		if l.Code == s {
+			return true
+		}
+	}
+	return false
+}
+
+// String возвращает метку статуса или "unknown", если статус неизвестен.
+func (s ItemStatus) String() string {
+	for _, l := range itemStatusLabels {
+		if l.Code == s {
+			return l.Label
+		}
+	}
+	return unknownStatusLabel
+}
+
+// MarshalJSON кодирует статус объектом {"code": 202, "label": "in_transit"}. Код неизвестного статуса сохраняется
+// с меткой "unknown".
+func (s ItemStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Code  int    `json:"code"`
+		Label string `json:"label"`
+	}{Code: int(s), Label: s.String()})
+}
+
+// UnmarshalJSON принимает как число (формат сообщений producers), так и объект с кодом, полученный от MarshalJSON.
+// Метка объекта не учитывается: значение определяется кодом.
+func (s *ItemStatus) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var obj struct {
+			Code *int `json:"code"`
+		}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return err
+		}
+		if obj.Code == nil {
+			return errItemStatusNoCode
+		}
+		*s = ItemStatus(*obj.Code)
+		return nil
+	}
+	var code int
+	if err := json.Unmarshal(data, &code); err != nil {
+		return err
+	}
+	*s = ItemStatus(code)
+	return nil
+}
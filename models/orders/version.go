@@ -0,0 +1,167 @@
+package orders
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CurrentSchemaVersion - версия схемы JSON заказа, которую декодирует и выводит Order.
+const CurrentSchemaVersion = 1
+
+// SchemaVersionField - необязательное поле верхнего уровня JSON заказа с версией его схемы.
+const SchemaVersionField = "schema_version"
+
+// ErrUnknownSchemaVersion возвращается для заказа в версии схемы, которую нельзя перевести в CurrentSchemaVersion:
+// обычно это версия, появившаяся у отправителей раньше, чем у сервиса.
+var ErrUnknownSchemaVersion = errors.New("unknown schema version")
+
+// schemaTransformer - перевод объекта верхнего уровня JSON заказа в соседнюю версию схемы на месте
+type schemaTransformer func(obj map[string]json.RawMessage) error
+
+// schemaStep - переход между соседними версиями схемы
+type schemaStep struct{ from, to int }
+
+// schemaTransformers - переводы между соседними версиями схемы в обе стороны. Версия схемы известна, если из неё
+// есть цепочка переводов в CurrentSchemaVersion.
+var schemaTransformers = map[schemaStep]schemaTransformer{
+	{from: 2, to: 1}: customerFromV2,
+	{from: 1, to: 2}: customerToV2,
+}
+
+// ParseSchemaVersion разбирает версию схемы из заголовка сообщения или параметра запроса: целое число от 1.
+// Пустая строка означает, что версия не задана, и возвращается 0.
+func ParseSchemaVersion(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || v < 1 {
+		return 0, fmt.Errorf("invalid schema version %q: must be a positive integer", s)
+	}
+	return v, nil
+}
+
+// UpgradeOrderJSON переводит JSON заказа в версию CurrentSchemaVersion и удаляет из него поле schema_version.
+// Версия берётся из version (заголовок или параметр запроса; 0 — не задана), поля schema_version или, без них,
+// считается равной 1; поле, противоречащее version, — ошибка. Возвращает данные для декодирования и версию заказа.
+// Версия без цепочки переводов — ErrUnknownSchemaVersion. Данные, не являющиеся объектом JSON, возвращаются
+// без изменений: ошибку сообщит декодирование.
+func UpgradeOrderJSON(data []byte, version int) ([]byte, int, error) {
+	// Заказы текущей версии без поля schema_version — обычный случай: данные не разбираются лишний раз
+	if (version == 0 || version == CurrentSchemaVersion) && !bytes.Contains(data, []byte(`"`+SchemaVersionField+`"`)) {
+		return data, CurrentSchemaVersion, nil
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(data, &obj) != nil || obj == nil {
+		if version == 0 {
+			version = CurrentSchemaVersion
+		}
+		if !knownSchemaVersion(version) {
+			return nil, version, fmt.Errorf("%w %d", ErrUnknownSchemaVersion, version)
+		}
+		return data, version, nil
+	}
+
+	if raw, ok := obj[SchemaVersionField]; ok {
+		var field int
+		if err := json.Unmarshal(raw, &field); err != nil || field < 1 {
+			return nil, version, &DecodeError{Fields: []FieldError{{Path: SchemaVersionField, Reason: "must be a positive integer"}}}
+		}
+		if version != 0 && version != field {
+			return nil, version, &DecodeError{Fields: []FieldError{{Path: SchemaVersionField,
+				Reason: fmt.Sprintf("version %d contradicts the requested schema version %d", field, version)}}}
+		}
+		version = field
+		delete(obj, SchemaVersionField)
+	}
+	if version == 0 {
+		version = CurrentSchemaVersion
+	}
+	if err := translateSchema(obj, version, CurrentSchemaVersion); err != nil {
+		return nil, version, err
+	}
+	out, err := json.Marshal(obj)
+	return out, version, err
+}
+
+// knownSchemaVersion - сообщает, есть ли цепочка переводов из версии v в CurrentSchemaVersion
+func knownSchemaVersion(v int) bool {
+	return translateSchema(map[string]json.RawMessage{}, v, CurrentSchemaVersion) == nil
+}
+
+// translateSchema - переводит объект JSON заказа из версии from в версию to по цепочке соседних версий
+func translateSchema(obj map[string]json.RawMessage, from, to int) error {
+	if from < 1 {
+		return fmt.Errorf("%w %d", ErrUnknownSchemaVersion, from)
+	}
+	for v := from; v != to; {
+		next := v - 1
+		if to > v {
+			next = v + 1
+		}
+		transform, ok := schemaTransformers[schemaStep{from: v, to: next}]
+		if !ok {
+			return fmt.Errorf("%w %d", ErrUnknownSchemaVersion, from)
+		}
+		if err := transform(obj); err != nil {
+			return err
+		}
+		v = next
+	}
+	return nil
+}
+
+// customerV2 - покупатель в версии 2: customer_id версии 1 перенесён в customer.id
+type customerV2 struct {
+	ID json.RawMessage `json:"id"`
+}
+
+// customerFromV2 - версия 2 → 1: customer.id становится customer_id
+func customerFromV2(obj map[string]json.RawMessage) error {
+	raw, ok := obj["customer"]
+	if !ok {
+		return nil
+	}
+	if _, ok := obj["customer_id"]; ok {
+		return &DecodeError{Fields: []FieldError{{Path: "customer_id", Reason: "replaced by customer.id in schema version 2"}}}
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return &DecodeError{Fields: []FieldError{{Path: "customer", Reason: "must be an object"}}}
+	}
+	var unknown []FieldError
+	for name := range fields {
+		if name != "id" {
+			unknown = append(unknown, FieldError{Path: "customer." + name, Reason: "unknown field"})
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Slice(unknown, func(i, j int) bool { return unknown[i].Path < unknown[j].Path })
+		return &DecodeError{Fields: unknown}
+	}
+	delete(obj, "customer")
+	if id, ok := fields["id"]; ok {
+		obj["customer_id"] = id
+	}
+	return nil
+}
+
+// customerToV2 - версия 1 → 2: customer_id переносится в customer.id
+func customerToV2(obj map[string]json.RawMessage) error {
+	id, ok := obj["customer_id"]
+	if !ok {
+		return nil
+	}
+	raw, err := json.Marshal(customerV2{ID: id})
+	if err != nil {
+		return err
+	}
+	delete(obj, "customer_id")
+	obj["customer"] = raw
+	return nil
+}
@@ -0,0 +1,130 @@
+package orders
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaTransformers(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		step    schemaStep
+		in      string
+		want    string
+		wantErr string
+	}{
+		{"v2 customer.id to customer_id", schemaStep{2, 1}, `{"order_uid":"a","customer":{"id":"c1"}}`, `{"order_uid":"a","customer_id":"c1"}`, ""},
+		{"v2 without customer", schemaStep{2, 1}, `{"order_uid":"a"}`, `{"order_uid":"a"}`, ""},
+		{"v2 customer without id", schemaStep{2, 1}, `{"customer":{}}`, `{}`, ""},
+		{"v2 customer not an object", schemaStep{2, 1}, `{"customer":"c1"}`, "", "customer: must be an object"},
+		{"v2 unknown customer fields", schemaStep{2, 1}, `{"customer":{"id":"c1","name":"x","age":1}}`, "", "customer.age: unknown field; customer.name: unknown field"},
+		{"v2 with v1 customer_id", schemaStep{2, 1}, `{"customer":{"id":"c1"},"customer_id":"c1"}`, "", "customer_id: replaced by customer.id"},
+		{"v1 customer_id to customer.id", schemaStep{1, 2}, `{"order_uid":"a","customer_id":"c1"}`, `{"order_uid":"a","customer":{"id":"c1"}}`, ""},
+		{"v1 without customer_id", schemaStep{1, 2}, `{"order_uid":"a"}`, `{"order_uid":"a"}`, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			transform, ok := schemaTransformers[tc.step]
+			require.True(t, ok)
+			var obj map[string]json.RawMessage
+			require.NoError(t, json.Unmarshal([]byte(tc.in), &obj))
+
+			err := transform(obj)
+			if tc.wantErr != "" {
+				var decodeErr *DecodeError
+				require.ErrorAs(t, err, &decodeErr)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			out, err := json.Marshal(obj)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.want, string(out))
+		})
+	}
+}
+
+func TestSchemaTransformersRoundTrip(t *testing.T) {
+	in := `{"order_uid":"a","customer_id":"c1","track_number":"T"}`
+	var obj map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal([]byte(in), &obj))
+	require.NoError(t, translateSchema(obj, 1, 2))
+	require.NoError(t, translateSchema(obj, 2, 1))
+	out, err := json.Marshal(obj)
+	require.NoError(t, err)
+	assert.JSONEq(t, in, string(out))
+}
+
+func TestUpgradeOrderJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		in          string
+		version     int
+		want        string
+		wantVersion int
+		unknown     bool
+		wantErr     string
+	}{
+		{"no version", `{"customer_id":"c1"}`, 0, `{"customer_id":"c1"}`, 1, false, ""},
+		{"header v1", `{"customer_id":"c1"}`, 1, `{"customer_id":"c1"}`, 1, false, ""},
+		{"field v1 is removed", `{"schema_version":1,"customer_id":"c1"}`, 0, `{"customer_id":"c1"}`, 1, false, ""},
+		{"header v2", `{"customer":{"id":"c1"}}`, 2, `{"customer_id":"c1"}`, 2, false, ""},
+		{"field v2", `{"schema_version":2,"customer":{"id":"c1"}}`, 0, `{"customer_id":"c1"}`, 2, false, ""},
+		{"header and field agree", `{"schema_version":2,"customer":{"id":"c1"}}`, 2, `{"customer_id":"c1"}`, 2, false, ""},
+		{"header and field disagree", `{"schema_version":1}`, 2, "", 2, false, "contradicts the requested schema version 2"},
+		{"field not an integer", `{"schema_version":"2"}`, 0, "", 0, false, "schema_version: must be a positive integer"},
+		{"field zero", `{"schema_version":0}`, 0, "", 0, false, "schema_version: must be a positive integer"},
+		{"unknown header version", `{"customer_id":"c1"}`, 3, "", 3, true, ""},
+		{"unknown field version", `{"schema_version":7}`, 0, "", 7, true, ""},
+		{"unknown version of invalid json", `not json`, 3, "", 3, true, ""},
+		{"invalid json is left to the decoder", `not json`, 2, `not json`, 2, false, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, version, err := UpgradeOrderJSON([]byte(tc.in), tc.version)
+			assert.Equal(t, tc.wantVersion, version)
+			switch {
+			case tc.unknown:
+				assert.ErrorIs(t, err, ErrUnknownSchemaVersion)
+			case tc.wantErr != "":
+				assert.ErrorContains(t, err, tc.wantErr)
+			default:
+				require.NoError(t, err)
+				if tc.want == "not json" {
+					assert.Equal(t, tc.want, string(out))
+				} else {
+					assert.JSONEq(t, tc.want, string(out))
+				}
+			}
+		})
+	}
+}
+
+func TestUpgradeOrderJSONKeepsCurrentPayload(t *testing.T) {
+	data := []byte(`{"order_uid":"b","customer_id":"c1"}`)
+	out, version, err := UpgradeOrderJSON(data, 0)
+	require.NoError(t, err)
+	assert.Equal(t, CurrentSchemaVersion, version)
+	assert.Same(t, &data[0], &out[0], "payloads of the current version are not re-encoded")
+
+	// Заказ версии 2 декодируется в ту же модель, что и версии 1
+	out, _, err = UpgradeOrderJSON([]byte(`{"order_uid":"b","schema_version":2,"customer":{"id":"c1"}}`), 0)
+	require.NoError(t, err)
+	var order Order
+	require.NoError(t, json.Unmarshal(out, &order))
+	assert.Equal(t, "c1", order.CustomerId)
+	assert.Empty(t, order.Extras)
+}
+
+func TestParseSchemaVersion(t *testing.T) {
+	for in, want := range map[string]int{"": 0, "1": 1, " 2 ": 2} {
+		got, err := ParseSchemaVersion(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	for _, in := range []string{"0", "-1", "v2", "1.0"} {
+		_, err := ParseSchemaVersion(in)
+		assert.Error(t, err, in)
+	}
+}
@@ -0,0 +1,206 @@
+package orders
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// orderXML - XML представление заказа с элементами в порядке полей JSON. Списки обёрнуты элементами во множественном
+// числе, а необязательные элементы заданы указателями и не выводятся, если равны nil.
+type orderXML struct {
+	OrderUid          string          `xml:"order_uid"`
+	TrackNumber       string          `xml:"track_number"`
+	Entry             string          `xml:"entry"`
+	Delivery          *Delivery       `xml:"delivery"`
+	Payments          *paymentsXML    `xml:"payments"`
+	Items             *itemsXML       `xml:"items"`
+	Locale            string          `xml:"locale"`
+	InternalSignature string          `xml:"internal_signature,omitempty"`
+	CustomerId        string          `xml:"customer_id"`
+	DeliveryService   string          `xml:"delivery_service"`
+	Shardkey          string          `xml:"shardkey"`
+	SmId              int             `xml:"sm_id"`
+	DateCreated       time.Time       `xml:"date_created"`
+	OofShard          string          `xml:"oof_shard"`
+	Quarantined       bool            `xml:"quarantined,omitempty"`
+	ItemsMissing      bool            `xml:"items_missing,omitempty"`
+	Corrections       *correctionsXML `xml:"corrections"`
+	Warnings          *warningsXML    `xml:"warnings"`
+	StoredAt          *time.Time      `xml:"stored_at"`
+	UpdatedAt         *time.Time      `xml:"updated_at"`
+	Extras            *extrasXML      `xml:"extras"`
+}
+
+// Обёртки списков заказа в XML.
+type (
+	paymentsXML struct {
+		Payment []Payment `xml:"payment"`
+	}
+	itemsXML struct {
+		Item []Item `xml:"item"`
+	}
+	correctionsXML struct {
+		Correction []Correction `xml:"correction"`
+	}
+	warningsXML struct {
+		Warning []Warning `xml:"warning"`
+	}
+	extrasXML struct {
+		Extra []extraXML `xml:"extra"`
+	}
+)
+
+// extraXML - дополнительное поле заказа в XML: имя в атрибуте, значение в JSON, так как XML не передаёт его тип
+type extraXML struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+// MarshalXML кодирует заказ элементом order с теми же именами полей, что и в JSON. Списки оборачиваются элементами
+// во множественном числе (<items><item>…</item></items>), статус товара выводится меткой с кодом в атрибуте,
+// а дополнительные поля — элементами <extras><extra name="…">значение в JSON</extra></extras> по алфавиту.
+// Разделы из Omitted не выводятся, как и пустые internal_signature, corrections, warnings и нулевые stored_at,
+// updated_at; основного платежа payment, в отличие от JSON, нет.
+func (o Order) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	x := orderXML{
+		OrderUid:          o.OrderUid,
+		TrackNumber:       o.TrackNumber,
+		Entry:             o.Entry,
+		Locale:            o.Locale,
+		InternalSignature: o.InternalSignature,
+		CustomerId:        o.CustomerId,
+		DeliveryService:   o.DeliveryService,
+		Shardkey:          o.Shardkey,
+		SmId:              o.SmId,
+		DateCreated:       o.DateCreated,
+		OofShard:          o.OofShard,
+		Quarantined:       o.Quarantined,
+		ItemsMissing:      o.ItemsMissing,
+	}
+	if o.Omitted&SectionDelivery == 0 {
+		x.Delivery = &o.Delivery
+	}
+	if o.Omitted&SectionPayments == 0 {
+		x.Payments = &paymentsXML{Payment: o.Payments}
+	}
+	if o.Omitted&SectionItems == 0 {
+		x.Items = &itemsXML{Item: o.Items}
+	}
+	if len(o.Corrections) > 0 {
+		x.Corrections = &correctionsXML{Correction: o.Corrections}
+	}
+	if len(o.Warnings) > 0 {
+		x.Warnings = &warningsXML{Warning: o.Warnings}
+	}
+	if !o.StoredAt.IsZero() {
+		x.StoredAt = &o.StoredAt
+	}
+	if !o.UpdatedAt.IsZero() {
+		x.UpdatedAt = &o.UpdatedAt
+	}
+	names := make([]string, 0, len(o.Extras))
+	for name := range o.Extras {
+		// Как и в JSON, известные поля имеют приоритет над одноимёнными дополнительными
+		if !knownOrderFields[strings.ToLower(name)] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, err := json.Marshal(o.Extras[name])
+		if err != nil {
+			return err
+		}
+		if x.Extras == nil {
+			x.Extras = &extrasXML{}
+		}
+		x.Extras.Extra = append(x.Extras.Extra, extraXML{Name: name, Value: string(value)})
+	}
+	start.Name = xml.Name{Local: "order"}
+	return e.EncodeElement(x, start)
+}
+
+// UnmarshalXML декодирует заказ, закодированный MarshalXML. Числа в Extras сохраняются как json.Number.
+func (o *Order) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var x orderXML
+	if err := d.DecodeElement(&x, &start); err != nil {
+		return err
+	}
+	decoded := Order{
+		OrderUid:          x.OrderUid,
+		TrackNumber:       x.TrackNumber,
+		Entry:             x.Entry,
+		Locale:            x.Locale,
+		InternalSignature: x.InternalSignature,
+		CustomerId:        x.CustomerId,
+		DeliveryService:   x.DeliveryService,
+		Shardkey:          x.Shardkey,
+		SmId:              x.SmId,
+		DateCreated:       x.DateCreated,
+		OofShard:          x.OofShard,
+		Quarantined:       x.Quarantined,
+		ItemsMissing:      x.ItemsMissing,
+	}
+	if x.Delivery != nil {
+		decoded.Delivery = *x.Delivery
+	}
+	// Пустой элемент списка декодируется пустым списком, как [] в JSON
+	if x.Payments != nil {
+		decoded.Payments = append([]Payment{}, x.Payments.Payment...)
+	}
+	if x.Items != nil {
+		decoded.Items = append([]Item{}, x.Items.Item...)
+	}
+	if x.Corrections != nil {
+		decoded.Corrections = x.Corrections.Correction
+	}
+	if x.Warnings != nil {
+		decoded.Warnings = x.Warnings.Warning
+	}
+	if x.StoredAt != nil {
+		decoded.StoredAt = *x.StoredAt
+	}
+	if x.UpdatedAt != nil {
+		decoded.UpdatedAt = *x.UpdatedAt
+	}
+	if x.Extras != nil {
+		for _, extra := range x.Extras.Extra {
+			value, err := decodeExtrasValue([]byte(extra.Value))
+			if err != nil {
+				return fmt.Errorf("extra %s: %w", extra.Name, err)
+			}
+			if decoded.Extras == nil {
+				decoded.Extras = make(map[string]any)
+			}
+			decoded.Extras[extra.Name] = value
+		}
+	}
+	*o = decoded
+	return nil
+}
+
+// MarshalXML кодирует статус меткой с кодом в атрибуте: <status code="202">in_transit</status>.
+func (s ItemStatus) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "code"}, Value: strconv.Itoa(int(s))})
+	return e.EncodeElement(s.String(), start)
+}
+
+// UnmarshalXML декодирует статус по атрибуту code; метка не учитывается, как и в UnmarshalJSON.
+func (s *ItemStatus) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var v struct {
+		Code *int `xml:"code,attr"`
+	}
+	if err := d.DecodeElement(&v, &start); err != nil {
+		return err
+	}
+	if v.Code == nil {
+		return errItemStatusNoCode
+	}
+	*s = ItemStatus(*v.Code)
+	return nil
+}
@@ -0,0 +1,75 @@
+package orders
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderXMLRoundTrip(t *testing.T) {
+	full := fullOrder()
+	out, err := xml.Marshal(full)
+	require.NoError(t, err)
+	body := string(out)
+	assert.Contains(t, body, "<order><order_uid>b563feb7b2b84b6test</order_uid>")
+	assert.Contains(t, body, "<payments><payment><transaction>b563feb7b2b84b6test</transaction>")
+	assert.Contains(t, body, "<items><item><chrt_id>9934930</chrt_id>")
+	assert.Contains(t, body, `<status code="202">in_transit</status>`)
+	assert.Contains(t, body, "<date_created>2021-11-26T06:22:19Z</date_created>")
+	assert.Contains(t, body, `<extras><extra name="campaign">{&#34;id&#34;:42}</extra><extra name="warehouse_hint">&#34;KZN-2&#34;</extra></extras>`)
+
+	var again Order
+	require.NoError(t, xml.Unmarshal(out, &again))
+	assert.Equal(t, full, again)
+}
+
+func TestOrderXMLOmitsEmptyValues(t *testing.T) {
+	minimal := Order{OrderUid: "order-1", DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)}
+	out, err := xml.Marshal(minimal)
+	require.NoError(t, err)
+	body := string(out)
+	assert.Contains(t, body, "<delivery><name></name>")
+	// Пустые списки выводятся пустыми элементами, как [] в JSON
+	assert.Contains(t, body, "<payments></payments><items></items>")
+	for _, element := range []string{"<internal_signature>", "<stored_at>", "<updated_at>", "<extras>", "<corrections>", "<warnings>", "<quarantined>"} {
+		assert.NotContains(t, body, element)
+	}
+	var again Order
+	require.NoError(t, xml.Unmarshal(out, &again))
+	minimal.Payments, minimal.Items = []Payment{}, []Item{}
+	assert.Equal(t, minimal, again)
+
+	// Незагруженные разделы не выводятся, в том числе доставка
+	partial, err := xml.Marshal(fullOrder().Omit(SectionDelivery | SectionItems))
+	require.NoError(t, err)
+	assert.NotContains(t, string(partial), "<delivery>")
+	assert.NotContains(t, string(partial), "<items>")
+	assert.Contains(t, string(partial), "<payments>")
+}
+
+// TestOrderXMLCoversJSONFields - новое поле заказа должно попасть и в XML представление
+func TestOrderXMLCoversJSONFields(t *testing.T) {
+	elements := make(map[string]bool)
+	v := reflect.TypeOf(orderXML{})
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Field(i).Tag.Get("xml"), ",")
+		elements[name] = true
+	}
+	for name := range knownOrderFields {
+		if name != "payment" && !internalOrderFields[name] {
+			assert.True(t, elements[name], "orderXML has no element for %s", name)
+		}
+	}
+}
+
+func TestItemStatusXML(t *testing.T) {
+	var item Item
+	require.NoError(t, xml.Unmarshal([]byte(`<item><chrt_id>1</chrt_id><status code="205">ignored</status></item>`), &item))
+	assert.Equal(t, ItemStatusReturned, item.Status)
+	assert.Error(t, xml.Unmarshal([]byte(`<item><status>delivered</status></item>`), &item))
+}
@@ -0,0 +1,346 @@
+// Package apiclient предоставляет клиент HTTP API сервиса заказов для других Go сервисов.
+package apiclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/buildinfo"
+)
+
+// Значения Config по умолчанию.
+const (
+	DefaultTimeout      = 10 * time.Second
+	DefaultMaxRetries   = 2
+	DefaultRetryBackoff = 100 * time.Millisecond
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	apiKeyHeader    = "X-API-Key"
+
+	// maxErrorBodyBytes - сколько байт тела ответа с ошибкой читается для сообщения об ошибке
+	maxErrorBodyBytes = 4 << 10
+)
+
+// ErrNotFound возвращается, когда запрошенный заказ отсутствует (ответ 404).
+var ErrNotFound = errors.New("apiclient: not found")
+
+// APIError - ответ сервера с кодом ошибки, для которого нет отдельного типа.
+type APIError struct {
+	StatusCode int
+	Code       string // стабильный код ошибки из JSON ответа, например db_unavailable; пуст для текстовых ответов
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("apiclient: server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// ValidationError - запрос отклонён проверкой сервера (ответ 400 или 422): повтор того же запроса не поможет.
+type ValidationError struct {
+	StatusCode int
+	Code       string // стабильный код ошибки из JSON ответа, например limit_invalid; пуст для текстовых ответов
+	Message    string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("apiclient: invalid request (%d): %s", e.StatusCode, e.Message)
+}
+
+// Config содержит настройки клиента.
+type Config struct {
+	BaseURL      string        // адрес сервиса, например http://orders:8080
+	Timeout      time.Duration // ограничение одной попытки запроса, 0 — DefaultTimeout
+	APIKey       string        // ключ административного API, нужен для ListOrders
+	MaxRetries   int           // число повторов при ответе 5xx или сетевой ошибке, 0 — DefaultMaxRetries, < 0 — без повторов
+	RetryBackoff time.Duration // пауза перед первым повтором, удваивается с каждым следующим, 0 — DefaultRetryBackoff
+	HTTPClient   *http.Client  // транспорт, nil — новый http.Client
+	// AcceptLanguage - заголовок Accept-Language запросов: язык сообщений об ошибках (en или ru), пусто — en
+	AcceptLanguage string
+}
+
+// Client - клиент API сервиса заказов. Client безопасен для конкурентного использования.
+type Client struct {
+	baseURL    *url.URL
+	apiKey     string
+	language   string
+	timeout    time.Duration
+	maxRetries int
+	backoff    time.Duration
+	http       *http.Client
+	userAgent  string
+}
+
+// New создает клиент по конфигурации. Возвращает ошибку, если BaseURL не является абсолютным http(s) адресом.
+func New(cfg Config) (*Client, error) {
+	base, err := url.Parse(strings.TrimRight(cfg.BaseURL, "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("apiclient: invalid base url %q", cfg.BaseURL)
+	}
+	c := &Client{
+		baseURL:    base,
+		apiKey:     cfg.APIKey,
+		language:   cfg.AcceptLanguage,
+		timeout:    cfg.Timeout,
+		maxRetries: cfg.MaxRetries,
+		backoff:    cfg.RetryBackoff,
+		http:       cfg.HTTPClient,
+		userAgent:  "l0-apiclient/" + buildinfo.Version,
+	}
+	if c.timeout <= 0 {
+		c.timeout = DefaultTimeout
+	}
+	if c.maxRetries == 0 {
+		c.maxRetries = DefaultMaxRetries
+	} else if c.maxRetries < 0 {
+		c.maxRetries = 0
+	}
+	if c.backoff <= 0 {
+		c.backoff = DefaultRetryBackoff
+	}
+	if c.http == nil {
+		c.http = &http.Client{}
+	}
+	return c, nil
+}
+
+type requestIDKey struct{}
+
+// WithRequestID возвращает контекст, запросы с которым передают серверу идентификатор id в заголовке X-Request-ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// GetOrder возвращает заказ по идентификатору или ErrNotFound.
+func (c *Client) GetOrder(ctx context.Context, id string) (*orders.Order, error) {
+	var order orders.Order
+	if err := c.getJSON(ctx, "/order", url.Values{"id": {id}}, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// SearchByTrack возвращает заказы с трек-номером tn полностью, включая доставку, платежи и товары, запрашивая
+// все страницы выдачи; если совпадений нет, возвращается пустой список.
+func (c *Client) SearchByTrack(ctx context.Context, tn string) ([]orders.Order, error) {
+	list := []orders.Order{}
+	q := url.Values{"track_number": {tn}, "include": {"all"}}
+	for {
+		var page struct {
+			Orders     []orders.Order `json:"orders"`
+			NextCursor string         `json:"next_cursor"`
+		}
+		if err := c.getJSON(ctx, "/orders", q, &page); err != nil {
+			return nil, err
+		}
+		list = append(list, page.Orders...)
+		if page.NextCursor == "" {
+			return list, nil
+		}
+		q.Set("cursor", page.NextCursor)
+	}
+}
+
+// CreateOrder создаёт заказ через POST /orders и возвращает его идентификатор. Запрос не повторяется: повтор уже
+// записанного заказа получил бы 409. Отклонённый проверкой заказ возвращается как *ValidationError с кодом ошибки,
+// например order_invalid.
+func (c *Client) CreateOrder(ctx context.Context, order *orders.Order) (string, error) {
+	body, err := json.Marshal(order)
+	if err != nil {
+		return "", fmt.Errorf("apiclient: encode order: %w", err)
+	}
+	var created struct {
+		OrderUid string `json:"order_uid"`
+	}
+	err = c.attempt(ctx, http.MethodPost, c.baseURL.JoinPath("/orders").String(), body, func(r io.Reader) error {
+		if err := json.NewDecoder(r).Decode(&created); err != nil {
+			return fmt.Errorf("apiclient: decode response: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return created.OrderUid, nil
+}
+
+// ListFilter задаёт интервал дат создания заказов [From, To) для ListOrders. Нулевой To означает текущий момент,
+// нулевой From — начало интервала по умолчанию на сервере (admin.export.max_range до To).
+type ListFilter struct {
+	From time.Time
+	To   time.Time
+}
+
+// ListOrders возвращает заказы за интервал filter через административную выгрузку (требуется Config.APIKey).
+// Сервер ограничивает длину интервала и число заказов в выгрузке.
+func (c *Client) ListOrders(ctx context.Context, filter ListFilter) ([]orders.Order, error) {
+	q := url.Values{"format": {"ndjson"}}
+	if !filter.From.IsZero() {
+		q.Set("from", filter.From.Format(time.RFC3339))
+	}
+	if !filter.To.IsZero() {
+		q.Set("to", filter.To.Format(time.RFC3339))
+	}
+
+	list := []orders.Order{}
+	err := c.do(ctx, "/admin/orders/export", q, func(body io.Reader) error {
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 64<<10), 16<<20)
+		for scanner.Scan() {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			var o orders.Order
+			if err := json.Unmarshal(scanner.Bytes(), &o); err != nil {
+				return fmt.Errorf("apiclient: decode order: %w", err)
+			}
+			list = append(list, o)
+		}
+		return scanner.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// getJSON - выполняет GET запрос и декодирует JSON ответ в v
+func (c *Client) getJSON(ctx context.Context, path string, q url.Values, v any) error {
+	return c.do(ctx, path, q, func(body io.Reader) error {
+		if err := json.NewDecoder(body).Decode(v); err != nil {
+			return fmt.Errorf("apiclient: decode response: %w", err)
+		}
+		return nil
+	})
+}
+
+// do - выполняет GET запрос, повторяя его при ответе 5xx или сетевой ошибке с экспоненциальной паузой,
+// и передаёт тело успешного ответа в decode. Все запросы клиента идемпотентны, поэтому повтор безопасен.
+func (c *Client) do(ctx context.Context, path string, q url.Values, decode func(body io.Reader) error) error {
+	u := c.baseURL.JoinPath(path)
+	u.RawQuery = q.Encode()
+
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		err := c.attempt(ctx, http.MethodGet, u.String(), nil, decode)
+		if !retryable(err) || attempt >= c.maxRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// attempt - одна попытка запроса method с телом JSON body (nil — без тела), ограниченная Config.Timeout
+func (c *Client) attempt(ctx context.Context, method, rawURL string, body []byte, decode func(body io.Reader) error) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, reqBody)
+	if err != nil {
+		return fmt.Errorf("apiclient: build request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Accept", "application/json")
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok && id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+	if c.apiKey != "" {
+		req.Header.Set(apiKeyHeader, c.apiKey)
+	}
+	if c.language != "" {
+		req.Header.Set("Accept-Language", c.language)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return &transportError{err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return responseError(resp)
+	}
+	return decode(resp.Body)
+}
+
+// transportError - сетевая ошибка запроса, после которой запрос можно повторить
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string { return "apiclient: request failed: " + e.err.Error() }
+func (e *transportError) Unwrap() error { return e.err }
+
+// retryable - сообщает, стоит ли повторить запрос после ошибки err
+func retryable(err error) bool {
+	var apiErr *APIError
+	var tErr *transportError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	case errors.As(err, &tErr):
+		return !errors.Is(err, context.Canceled)
+	default:
+		return false
+	}
+}
+
+// errorEnvelope - JSON тело ответа с ошибкой: {"code": "...", "message": "..."} или {"error": "..."}
+type errorEnvelope struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Error   string `json:"error"`
+}
+
+// responseError - преобразует ответ с кодом ошибки в типизированную ошибку. Код и сообщение берутся из JSON конверта,
+// если ответ в JSON, иначе сообщение - текст ответа. Язык сообщения выбирается сервером по Config.AcceptLanguage.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	msg := strings.TrimSpace(string(body))
+	var code string
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "application/json" {
+		var env errorEnvelope
+		if json.Unmarshal(body, &env) == nil {
+			code = env.Code
+			switch {
+			case env.Message != "":
+				msg = env.Message
+			case env.Error != "":
+				msg = env.Error
+			}
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, msg)
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return &ValidationError{StatusCode: resp.StatusCode, Code: code, Message: msg}
+	default:
+		return &APIError{StatusCode: resp.StatusCode, Code: code, Message: msg}
+	}
+}
@@ -0,0 +1,157 @@
+package apiclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc, cfg Config) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	cfg.BaseURL = srv.URL
+	if cfg.RetryBackoff == 0 {
+		cfg.RetryBackoff = time.Millisecond
+	}
+	c, err := New(cfg)
+	require.NoError(t, err)
+	return c
+}
+
+func TestNewRejectsInvalidBaseURL(t *testing.T) {
+	for _, u := range []string{"", "orders:8080", "ftp://orders", "http://"} {
+		_, err := New(Config{BaseURL: u})
+		assert.Error(t, err, u)
+	}
+}
+
+func TestRetriesServerErrorsWithBackoff(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"order_uid":"order-1"}`))
+	}, Config{MaxRetries: 2})
+
+	order, err := c.GetOrder(context.Background(), "order-1")
+	require.NoError(t, err)
+	assert.Equal(t, "order-1", order.OrderUid)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestGivesUpAfterMaxRetries(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}, Config{MaxRetries: 1})
+
+	_, err := c.GetOrder(context.Background(), "order-1")
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusInternalServerError, apiErr.StatusCode)
+	assert.Equal(t, "internal error", apiErr.Message)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestClientErrorsAreNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"error":"items: must not be empty"}`))
+	}, Config{})
+
+	_, err := c.GetOrder(context.Background(), "order-1")
+	var vErr *ValidationError
+	require.ErrorAs(t, err, &vErr)
+	assert.Equal(t, http.StatusUnprocessableEntity, vErr.StatusCode)
+	assert.Equal(t, "items: must not be empty", vErr.Message)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestErrorCodeAndLocalizedMessage(t *testing.T) {
+	var language string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		language = r.Header.Get("Accept-Language")
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"code":"order_id_invalid","message":"некорректный формат идентификатора заказа"}`))
+	}, Config{AcceptLanguage: "ru"})
+
+	_, err := c.GetOrder(context.Background(), "order-1")
+	var vErr *ValidationError
+	require.ErrorAs(t, err, &vErr)
+	assert.Equal(t, "ru", language)
+	assert.Equal(t, "order_id_invalid", vErr.Code)
+	assert.Equal(t, "некорректный формат идентификатора заказа", vErr.Message)
+}
+
+func TestCreateOrderIsNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	var method, contentType string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			method, contentType = r.Method, r.Header.Get("Content-Type")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"order_uid":"order-1"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"code":"internal_error","message":"internal error"}`))
+	}, Config{})
+
+	uid, err := c.CreateOrder(context.Background(), &orders.Order{OrderUid: "order-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "order-1", uid)
+	assert.Equal(t, http.MethodPost, method)
+	assert.Equal(t, "application/json", contentType)
+
+	_, err = c.CreateOrder(context.Background(), &orders.Order{OrderUid: "order-2"})
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "internal_error", apiErr.Code)
+	assert.Equal(t, int32(2), calls.Load(), "a failed create is not retried")
+}
+
+func TestSetsHeaders(t *testing.T) {
+	var got http.Header
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		_, _ = w.Write([]byte(`{"orders":[]}`))
+	}, Config{APIKey: "secret"})
+
+	_, err := c.SearchByTrack(WithRequestID(context.Background(), "req-42"), "WBILMTESTTRACK")
+	require.NoError(t, err)
+	assert.Equal(t, "req-42", got.Get("X-Request-ID"))
+	assert.Equal(t, "secret", got.Get("X-API-Key"))
+	assert.Contains(t, got.Get("User-Agent"), "l0-apiclient/")
+}
+
+func TestRespectsContextCancellation(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}, Config{MaxRetries: 100, RetryBackoff: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.GetOrder(ctx, "order-1")
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrNotFound))
+	assert.Less(t, time.Since(start), time.Second)
+}
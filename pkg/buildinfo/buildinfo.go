@@ -0,0 +1,39 @@
+// Package buildinfo хранит метаданные сборки (версия, коммит, дата), подставляемые при компиляции через -ldflags:
+//
+//	go build -ldflags "-X l0_test_self/pkg/buildinfo.Version=1.2.3 -X l0_test_self/pkg/buildinfo.Commit=$(git rev-parse --short HEAD) -X l0_test_self/pkg/buildinfo.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Значения по умолчанию используются при сборке без -ldflags (например, go run).
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// Info содержит метаданные сборки и версию Go, которой собран бинарный файл.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get возвращает метаданные текущей сборки.
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// String возвращает метаданные сборки в виде одной строки для логов.
+func (i Info) String() string {
+	return fmt.Sprintf("version=%s commit=%s build_date=%s go=%s", i.Version, i.Commit, i.BuildDate, i.GoVersion)
+}
@@ -2,6 +2,10 @@
 package kafka
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"time"
 
 	"github.com/segmentio/kafka-go"
@@ -14,6 +18,8 @@ type Config struct {
 	GroupID string       `yaml:"group_id"`
 	Reader  ReaderConfig `yaml:"reader"`
 	Writer  WriterConfig `yaml:"writer"`
+	// GroupTopics - топики, на которые подписывается читатель группы вместо Topic (пусто — только Topic)
+	GroupTopics []string `yaml:"group_topics"`
 }
 
 // ReaderConfig содержит настройки для Kafka Reader, такие, как минимальный и максимальный размер сообщений, таймауты и интервал коммита.
@@ -22,6 +28,28 @@ type ReaderConfig struct {
 	MaxBytes         int           `yaml:"max_bytes"`
 	ReadBatchTimeout time.Duration `yaml:"read_batch_timeout"`
 	CommitInterval   time.Duration `yaml:"commit_interval"`
+	StartOffset      string        `yaml:"start_offset"`
+}
+
+// Допустимые значения ReaderConfig.StartOffset.
+const (
+	StartOffsetEarliest = "earliest"
+	StartOffsetLatest   = "latest"
+)
+
+// ParseStartOffset преобразует значение start_offset из конфигурации в смещение kafka-go.
+// Пустая строка означает поведение kafka-go по умолчанию (0, что для новой группы соответствует FirstOffset).
+func ParseStartOffset(s string) (int64, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case StartOffsetEarliest:
+		return kafka.FirstOffset, nil
+	case StartOffsetLatest:
+		return kafka.LastOffset, nil
+	default:
+		return 0, fmt.Errorf("invalid start_offset %q: must be %q or %q", s, StartOffsetEarliest, StartOffsetLatest)
+	}
 }
 
 // WriterConfig содержит настройки для Kafka Writer, такие, как таймауты и балансировщик нагрузки.
@@ -32,20 +60,263 @@ type WriterConfig struct {
 }
 
 // NewKafkaReader создает новый Kafka Reader с использованием конфигурации из Config.
+// Некорректное значение StartOffset должно отсекаться при загрузке конфигурации; здесь оно трактуется как значение по умолчанию.
+// Если заданы GroupTopics, читатель подписывается на них, а Topic не используется.
 func NewKafkaReader(cfg Config) *kafka.Reader {
+	startOffset, _ := ParseStartOffset(cfg.Reader.StartOffset)
+	topic := cfg.Topic
+	if len(cfg.GroupTopics) > 0 {
+		topic = ""
+	}
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:          cfg.Brokers,
-		Topic:            cfg.Topic,
+		Topic:            topic,
+		GroupTopics:      cfg.GroupTopics,
 		GroupID:          cfg.GroupID,
 		MinBytes:         cfg.Reader.MinBytes,
 		MaxBytes:         cfg.Reader.MaxBytes,
 		ReadBatchTimeout: cfg.Reader.ReadBatchTimeout,
 		CommitInterval:   cfg.Reader.CommitInterval,
+		StartOffset:      startOffset,
 	})
 	return reader
 }
 
-// NewWriter создает новый Kafka Writer с использованием конфигурации из Config.
+// NewPartitionReader создает Kafka Reader без группы, читающий партицию partition топика cfg.Topic со смещения offset.
+// Смещения такого читателя не коммитятся в Kafka: сохранять позицию чтения должен вызывающий код.
+func NewPartitionReader(cfg Config, partition int, offset int64) (*kafka.Reader, error) {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:          cfg.Brokers,
+		Topic:            cfg.Topic,
+		Partition:        partition,
+		MinBytes:         cfg.Reader.MinBytes,
+		MaxBytes:         cfg.Reader.MaxBytes,
+		ReadBatchTimeout: cfg.Reader.ReadBatchTimeout,
+	})
+	if err := reader.SetOffset(offset); err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("partition reader: set offset %d of partition %d: %w", offset, partition, err)
+	}
+	return reader, nil
+}
+
+// newClient - клиент брокеров brokers с собственным транспортом. Общий транспорт kafka-go держит соединения и горутину
+// обновления метаданных до конца процесса, поэтому транспорт клиента закрывается возвращённой функцией.
+func newClient(brokers []string) (*kafka.Client, func()) {
+	transport := &kafka.Transport{}
+	return &kafka.Client{Addr: kafka.TCP(brokers...), Transport: transport}, transport.CloseIdleConnections
+}
+
+// PartitionOffsets - границы партиции: смещение первого доступного сообщения и смещение, которое получит следующее сообщение.
+type PartitionOffsets struct {
+	First int64
+	Last  int64
+}
+
+// ListPartitionOffsets возвращает границы всех партиций топика cfg.Topic.
+func ListPartitionOffsets(ctx context.Context, cfg Config) (map[int]PartitionOffsets, error) {
+	client, closeClient := newClient(cfg.Brokers)
+	defer closeClient()
+
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{cfg.Topic}})
+	if err != nil {
+		return nil, fmt.Errorf("list partition offsets: metadata: %w", err)
+	}
+	if len(meta.Topics) != 1 || meta.Topics[0].Error != nil {
+		return nil, fmt.Errorf("list partition offsets: topic %s unavailable: %v", cfg.Topic, topicError(meta.Topics))
+	}
+
+	requests := make([]kafka.OffsetRequest, 0, len(meta.Topics[0].Partitions))
+	for _, p := range meta.Topics[0].Partitions {
+		requests = append(requests, kafka.FirstOffsetOf(p.ID), kafka.LastOffsetOf(p.ID))
+	}
+	listed, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{cfg.Topic: requests}})
+	if err != nil {
+		return nil, fmt.Errorf("list partition offsets: list offsets: %w", err)
+	}
+
+	result := make(map[int]PartitionOffsets, len(meta.Topics[0].Partitions))
+	for _, po := range listed.Topics[cfg.Topic] {
+		if po.Error != nil {
+			return nil, fmt.Errorf("list partition offsets: partition %d: %w", po.Partition, po.Error)
+		}
+		result[po.Partition] = PartitionOffsets{First: po.FirstOffset, Last: po.LastOffset}
+	}
+	return result, nil
+}
+
+// GroupOffsets возвращает смещения, закоммиченные группой cfg.GroupID в партициях partitions топика cfg.Topic.
+// Партиции, в которых группа ещё ничего не закоммитила, в результат не входят.
+func GroupOffsets(ctx context.Context, cfg Config, partitions []int) (map[int]int64, error) {
+	if cfg.GroupID == "" {
+		return nil, fmt.Errorf("group offsets: group id is required")
+	}
+	client, closeClient := newClient(cfg.Brokers)
+	defer closeClient()
+
+	resp, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: cfg.GroupID, Topics: map[string][]int{cfg.Topic: partitions}})
+	if err != nil {
+		return nil, fmt.Errorf("group offsets: offset fetch: %w", err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("group offsets: offset fetch: %w", resp.Error)
+	}
+	result := make(map[int]int64, len(partitions))
+	for _, p := range resp.Topics[cfg.Topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("group offsets: partition %d: %w", p.Partition, p.Error)
+		}
+		if p.CommittedOffset >= 0 {
+			result[p.Partition] = p.CommittedOffset
+		}
+	}
+	return result, nil
+}
+
+// ResetGroupOffsets фиксирует для группы cfg.GroupID смещения начала (или конца для StartOffset = latest) всех партиций топика.
+// Группа не должна иметь активных участников: коммит выполняется вне поколения группы (generation -1).
+// Возвращает зафиксированные смещения по партициям.
+func ResetGroupOffsets(ctx context.Context, cfg Config) (map[int]int64, error) {
+	if cfg.GroupID == "" {
+		return nil, fmt.Errorf("reset offsets: group id is required")
+	}
+	startOffset, err := ParseStartOffset(cfg.Reader.StartOffset)
+	if err != nil {
+		return nil, err
+	}
+	if startOffset == 0 {
+		startOffset = kafka.FirstOffset
+	}
+
+	client, closeClient := newClient(cfg.Brokers)
+	defer closeClient()
+
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{cfg.Topic}})
+	if err != nil {
+		return nil, fmt.Errorf("reset offsets: metadata: %w", err)
+	}
+	if len(meta.Topics) != 1 || meta.Topics[0].Error != nil {
+		return nil, fmt.Errorf("reset offsets: topic %s unavailable: %v", cfg.Topic, topicError(meta.Topics))
+	}
+
+	requests := make([]kafka.OffsetRequest, 0, len(meta.Topics[0].Partitions))
+	for _, p := range meta.Topics[0].Partitions {
+		requests = append(requests, kafka.OffsetRequest{Partition: p.ID, Timestamp: startOffset})
+	}
+	listed, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{cfg.Topic: requests}})
+	if err != nil {
+		return nil, fmt.Errorf("reset offsets: list offsets: %w", err)
+	}
+
+	result := make(map[int]int64, len(requests))
+	commits := make([]kafka.OffsetCommit, 0, len(requests))
+	for _, po := range listed.Topics[cfg.Topic] {
+		if po.Error != nil {
+			return nil, fmt.Errorf("reset offsets: partition %d: %w", po.Partition, po.Error)
+		}
+		offset := po.FirstOffset
+		if startOffset == kafka.LastOffset {
+			offset = po.LastOffset
+		}
+		result[po.Partition] = offset
+		commits = append(commits, kafka.OffsetCommit{Partition: po.Partition, Offset: offset})
+	}
+
+	resp, err := client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      cfg.GroupID,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{cfg.Topic: commits},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reset offsets: commit: %w", err)
+	}
+	for _, parts := range resp.Topics {
+		for _, p := range parts {
+			if p.Error != nil {
+				return nil, fmt.Errorf("reset offsets: commit partition %d: %w", p.Partition, p.Error)
+			}
+		}
+	}
+	return result, nil
+}
+
+// LatestMessageTime возвращает наибольшую метку времени среди последних сообщений партиций топика cfg.Topic.
+// Для топика с message.timestamp.type=LogAppendTime это время брокера на момент записи, иначе — время producer.
+// Для пустого топика возвращается нулевое время.
+func LatestMessageTime(ctx context.Context, cfg Config) (time.Time, error) {
+	client, closeClient := newClient(cfg.Brokers)
+	defer closeClient()
+
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{cfg.Topic}})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("latest message time: metadata: %w", err)
+	}
+	if len(meta.Topics) != 1 || meta.Topics[0].Error != nil {
+		return time.Time{}, fmt.Errorf("latest message time: topic %s unavailable: %v", cfg.Topic, topicError(meta.Topics))
+	}
+
+	requests := make([]kafka.OffsetRequest, 0, len(meta.Topics[0].Partitions))
+	for _, p := range meta.Topics[0].Partitions {
+		requests = append(requests, kafka.LastOffsetOf(p.ID))
+	}
+	listed, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{cfg.Topic: requests}})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("latest message time: list offsets: %w", err)
+	}
+
+	var latest time.Time
+	for _, po := range listed.Topics[cfg.Topic] {
+		if po.Error != nil {
+			return time.Time{}, fmt.Errorf("latest message time: partition %d: %w", po.Partition, po.Error)
+		}
+		if po.LastOffset <= po.FirstOffset {
+			continue
+		}
+		t, err := messageTime(ctx, client, cfg.Topic, po.Partition, po.LastOffset-1)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	return latest, nil
+}
+
+// messageTime возвращает метку времени сообщения по смещению offset партиции.
+func messageTime(ctx context.Context, client *kafka.Client, topic string, partition int, offset int64) (time.Time, error) {
+	resp, err := client.Fetch(ctx, &kafka.FetchRequest{Topic: topic, Partition: partition, Offset: offset, MaxBytes: 1 << 20})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("latest message time: fetch partition %d: %w", partition, err)
+	}
+	if resp.Error != nil {
+		return time.Time{}, fmt.Errorf("latest message time: fetch partition %d: %w", partition, resp.Error)
+	}
+	// Брокер может вернуть пачку, начинающуюся раньше запрошенного смещения
+	for {
+		rec, err := resp.Records.ReadRecord()
+		if errors.Is(err, io.EOF) {
+			return time.Time{}, fmt.Errorf("latest message time: partition %d: message at offset %d not found", partition, offset)
+		}
+		if err != nil {
+			return time.Time{}, fmt.Errorf("latest message time: read partition %d: %w", partition, err)
+		}
+		if rec.Offset >= offset {
+			return rec.Time, nil
+		}
+	}
+}
+
+// topicError возвращает ошибку из метаданных топика для сообщения об ошибке.
+func topicError(topics []kafka.Topic) error {
+	if len(topics) == 0 {
+		return fmt.Errorf("no metadata")
+	}
+	return topics[0].Error
+}
+
+// NewWriter создает новый Kafka Writer с использованием конфигурации из Config. Балансировщик Writer.Balancer:
+// least_bytes (по умолчанию), round_robin или hash (KeyHashBalancer).
 func NewWriter(cfg Config) *kafka.Writer {
 	var balancer kafka.Balancer
 	switch cfg.Writer.Balancer {
@@ -53,6 +324,8 @@ func NewWriter(cfg Config) *kafka.Writer {
 		balancer = &kafka.LeastBytes{}
 	case "round_robin":
 		balancer = &kafka.RoundRobin{}
+	case "hash":
+		balancer = KeyHashBalancer()
 	default:
 		balancer = &kafka.LeastBytes{}
 	}
@@ -0,0 +1,83 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStartOffset(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "", want: 0},
+		{in: "earliest", want: kafka.FirstOffset},
+		{in: "latest", want: kafka.LastOffset},
+		{in: "newest", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseStartOffset(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestEarliestStartOffsetReadsExistingMessages - новая группа со start_offset=earliest читает сообщения, записанные до её создания
+func TestEarliestStartOffsetReadsExistingMessages(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	suffix := time.Now().UnixNano()
+	cfg := Config{
+		Brokers: []string{"localhost:9092"},
+		Topic:   fmt.Sprintf("start_offset_test_%d", suffix),
+		GroupID: fmt.Sprintf("start_offset_group_%d", suffix),
+		Reader:  ReaderConfig{MinBytes: 1, MaxBytes: 10e6, StartOffset: StartOffsetEarliest},
+	}
+
+	writer := NewWriter(cfg)
+	writer.AllowAutoTopicCreation = true
+	defer writer.Close()
+
+	want := []string{"first", "second", "third"}
+	for _, v := range want {
+		require.NoError(t, writer.WriteMessages(ctx, kafka.Message{Value: []byte(v)}))
+	}
+
+	reader := NewKafkaReader(cfg)
+	defer reader.Close()
+
+	got := make([]string, 0, len(want))
+	for len(got) < len(want) {
+		msg, err := reader.ReadMessage(ctx)
+		require.NoError(t, err)
+		got = append(got, string(msg.Value))
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestVerifyTopicsUnreachableBrokers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := VerifyTopics(ctx, []string{"127.0.0.1:1"}, []string{"orders"}, 1)
+	assert.ErrorContains(t, err, "metadata")
+}
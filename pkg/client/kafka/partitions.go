@@ -0,0 +1,128 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Стратегии выбора партиции для сообщений writer'а (ParsePartitionStrategy).
+const (
+	PartitionKeyHash    = "key-hash"    // партиция определяется хэшем ключа сообщения (PartitionForKey)
+	PartitionRoundRobin = "round-robin" // сообщения раскладываются по партициям по очереди
+	PartitionExplicit   = "explicit"    // все сообщения пишутся в одну партицию, заданную как explicit:N
+)
+
+// PartitionStrategy - стратегия выбора партиции для сообщений writer'а.
+type PartitionStrategy struct {
+	Name      string // PartitionKeyHash, PartitionRoundRobin или PartitionExplicit
+	Partition int    // номер партиции для PartitionExplicit
+}
+
+// ParsePartitionStrategy разбирает стратегию выбора партиции: key-hash, round-robin или explicit:N, где N — номер партиции.
+func ParsePartitionStrategy(s string) (PartitionStrategy, error) {
+	switch s {
+	case PartitionKeyHash, PartitionRoundRobin:
+		return PartitionStrategy{Name: s}, nil
+	}
+	if n, ok := strings.CutPrefix(s, PartitionExplicit+":"); ok {
+		partition, err := strconv.Atoi(n)
+		if err != nil || partition < 0 {
+			return PartitionStrategy{}, fmt.Errorf("invalid partition strategy %q: partition must be a non-negative integer", s)
+		}
+		return PartitionStrategy{Name: PartitionExplicit, Partition: partition}, nil
+	}
+	return PartitionStrategy{}, fmt.Errorf("invalid partition strategy %q: must be %s, %s or %s:N", s, PartitionKeyHash, PartitionRoundRobin, PartitionExplicit)
+}
+
+// String возвращает стратегию в виде, который принимает ParsePartitionStrategy.
+func (s PartitionStrategy) String() string {
+	if s.Name == PartitionExplicit {
+		return fmt.Sprintf("%s:%d", PartitionExplicit, s.Partition)
+	}
+	return s.Name
+}
+
+// Balancer возвращает балансировщик kafka-go, реализующий стратегию.
+func (s PartitionStrategy) Balancer() kafka.Balancer {
+	switch s.Name {
+	case PartitionRoundRobin:
+		return &kafka.RoundRobin{}
+	case PartitionExplicit:
+		return explicitPartition(s.Partition)
+	default:
+		return KeyHashBalancer()
+	}
+}
+
+// explicitPartition - балансировщик, отправляющий все сообщения в одну партицию. Если у топика нет такой партиции,
+// запись завершается ошибкой брокера.
+type explicitPartition int
+
+// Balance возвращает заданную партицию независимо от сообщения и списка партиций.
+func (p explicitPartition) Balance(kafka.Message, ...int) int { return int(p) }
+
+// KeyHashBalancer возвращает балансировщик, выбирающий партицию по хэшу ключа сообщения (FNV-1a, как kafka.Hash);
+// сообщения без ключа раскладываются по очереди. Тот же хэш использует PartitionForKey.
+func KeyHashBalancer() kafka.Balancer {
+	return &kafka.Hash{}
+}
+
+// PartitionForKey возвращает партицию топика из numPartitions партиций, в которую KeyHashBalancer отправит сообщение
+// с ключом key. Writer передаёт балансировщику номера партиций от 0 до numPartitions-1, поэтому результат совпадает
+// с партицией, которую выберет writer.
+func PartitionForKey(key []byte, numPartitions int) int {
+	partitions := make([]int, numPartitions)
+	for i := range partitions {
+		partitions[i] = i
+	}
+	return KeyHashBalancer().Balance(kafka.Message{Key: key}, partitions...)
+}
+
+// PartitionInfo - партиция топика по метаданным брокеров: лидер и реплики.
+type PartitionInfo struct {
+	ID         int    `json:"partition"`
+	Leader     int    `json:"leader"`      // идентификатор брокера-лидера, -1 — лидера нет
+	LeaderHost string `json:"leader_host"` // адрес брокера-лидера host:port
+	Replicas   []int  `json:"replicas"`
+	ISR        []int  `json:"isr"` // синхронные реплики
+}
+
+// TopicPartitions возвращает партиции топика cfg.Topic с их лидерами по метаданным брокеров, по возрастанию номера.
+func TopicPartitions(ctx context.Context, cfg Config) ([]PartitionInfo, error) {
+	client, closeClient := newClient(cfg.Brokers)
+	defer closeClient()
+
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{cfg.Topic}})
+	if err != nil {
+		return nil, fmt.Errorf("topic partitions: metadata: %w", err)
+	}
+	if len(meta.Topics) != 1 || meta.Topics[0].Error != nil {
+		return nil, fmt.Errorf("topic partitions: topic %s unavailable: %v", cfg.Topic, topicError(meta.Topics))
+	}
+
+	list := make([]PartitionInfo, 0, len(meta.Topics[0].Partitions))
+	for _, p := range meta.Topics[0].Partitions {
+		info := PartitionInfo{ID: p.ID, Leader: -1, Replicas: brokerIDs(p.Replicas), ISR: brokerIDs(p.Isr)}
+		if p.Leader.Host != "" {
+			info.Leader = p.Leader.ID
+			info.LeaderHost = fmt.Sprintf("%s:%d", p.Leader.Host, p.Leader.Port)
+		}
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// brokerIDs возвращает идентификаторы брокеров.
+func brokerIDs(brokers []kafka.Broker) []int {
+	ids := make([]int, 0, len(brokers))
+	for _, b := range brokers {
+		ids = append(ids, b.ID)
+	}
+	return ids
+}
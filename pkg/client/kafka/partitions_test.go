@@ -0,0 +1,47 @@
+package kafka
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePartitionStrategy(t *testing.T) {
+	for in, want := range map[string]PartitionStrategy{
+		"key-hash":    {Name: PartitionKeyHash},
+		"round-robin": {Name: PartitionRoundRobin},
+		"explicit:0":  {Name: PartitionExplicit},
+		"explicit:12": {Name: PartitionExplicit, Partition: 12},
+	} {
+		got, err := ParsePartitionStrategy(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+		assert.Equal(t, in, got.String())
+	}
+	for _, in := range []string{"", "hash", "explicit", "explicit:", "explicit:-1", "explicit:x"} {
+		_, err := ParsePartitionStrategy(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestPartitionForKeyMatchesWriter(t *testing.T) {
+	w := NewWriter(Config{Topic: "orders", Writer: WriterConfig{Balancer: "hash"}})
+	for _, n := range []int{1, 3, 12} {
+		partitions := make([]int, n)
+		for i := range partitions {
+			partitions[i] = i
+		}
+		hits := make(map[int]int)
+		for i := 0; i < 200; i++ {
+			key := []byte(fmt.Sprintf("order-%d", i))
+			p := PartitionForKey(key, n)
+			require.Equal(t, w.Balancer.Balance(kafka.Message{Key: key}, partitions...), p, "key %s of %d partitions", key, n)
+			assert.Equal(t, p, PartitionForKey(key, n), "the partition of a key is stable")
+			hits[p]++
+		}
+		assert.Len(t, hits, n, "keys spread over all %d partitions", n)
+	}
+}
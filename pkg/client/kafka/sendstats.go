@@ -0,0 +1,323 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Границы гистограммы задержек: корзины растут в 2^(1/8) раза (погрешность квантиля не больше 9%) от 10µs
+// до latencyBuckets корзин (около 2.5 минут); более долгие задержки попадают в последнюю корзину.
+const (
+	latencyMin            = 10 * time.Microsecond
+	latencyBucketsPerStep = 8 // корзин на удвоение задержки
+	latencyBuckets        = 192
+)
+
+// LatencyHistogram - гистограмма задержек с логарифмическими корзинами постоянного размера: память не зависит
+// от числа наблюдений, а квантиль оценивается верхней границей корзины. Не безопасна для конкурентного использования.
+type LatencyHistogram struct {
+	counts [latencyBuckets + 1]uint64 // последняя корзина — задержки больше верхней границы
+	count  uint64
+	max    time.Duration
+}
+
+// latencyBucket - номер корзины задержки d: наименьший i, верхняя граница которого не меньше d
+func latencyBucket(d time.Duration) int {
+	if d <= latencyMin {
+		return 0
+	}
+	i := int(math.Ceil(latencyBucketsPerStep * math.Log2(float64(d)/float64(latencyMin))))
+	// Граница, вычисленная с погрешностью округления, может оказаться чуть меньше d
+	for i < latencyBuckets && latencyUpperBound(i) < d {
+		i++
+	}
+	return min(i, latencyBuckets)
+}
+
+// latencyUpperBound - верхняя граница корзины i
+func latencyUpperBound(i int) time.Duration {
+	return time.Duration(float64(latencyMin) * math.Exp2(float64(i)/latencyBucketsPerStep))
+}
+
+// ObserveN учитывает n наблюдений задержки d.
+func (h *LatencyHistogram) ObserveN(d time.Duration, n int) {
+	if n <= 0 {
+		return
+	}
+	h.counts[latencyBucket(d)] += uint64(n)
+	h.count += uint64(n)
+	h.max = max(h.max, d)
+}
+
+// Count возвращает число наблюдений.
+func (h *LatencyHistogram) Count() uint64 { return h.count }
+
+// Max возвращает наибольшую наблюдавшуюся задержку.
+func (h *LatencyHistogram) Max() time.Duration { return h.max }
+
+// Quantile возвращает оценку квантиля q (от 0 до 1) методом ближайшего ранга: верхнюю границу корзины,
+// в которую попадает наблюдение с этим рангом, но не больше Max. Без наблюдений возвращает 0.
+func (h *LatencyHistogram) Quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.count)))
+	rank = min(max(rank, 1), h.count)
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			if i == latencyBuckets {
+				return h.max
+			}
+			return min(latencyUpperBound(i), h.max)
+		}
+	}
+	return h.max
+}
+
+// Коды ошибок отправки, не являющихся ошибками протокола Kafka (SendSummary.Errors).
+const (
+	SendErrorTimeout  = "timeout"  // истёк дедлайн контекста или WriteTimeout
+	SendErrorCanceled = "canceled" // контекст отменён
+	SendErrorOther    = "other"    // сетевые и прочие ошибки
+)
+
+// SendErrorCode возвращает код ошибки отправки для сводки: название ошибки протокола Kafka
+// (например, "Not Leader For Partition") или SendErrorTimeout, SendErrorCanceled, SendErrorOther.
+func SendErrorCode(err error) string {
+	var kerr kafka.Error
+	switch {
+	case errors.As(err, &kerr):
+		return kerr.Title()
+	case errors.Is(err, context.DeadlineExceeded):
+		return SendErrorTimeout
+	case errors.Is(err, context.Canceled):
+		return SendErrorCanceled
+	default:
+		return SendErrorOther
+	}
+}
+
+// SendStats - статистика отправки сообщений: задержка подтверждения каждого сообщения, ошибки по кодам и объём.
+// Память постоянна при любом числе сообщений. Безопасна для конкурентного использования.
+type SendStats struct {
+	mu        sync.Mutex
+	latencies LatencyHistogram // задержка подтверждения каждого отправленного сообщения
+	writes    int
+	sent      int
+	failed    int
+	bytes     int64
+	errors    map[string]int
+}
+
+// NewSendStats создает пустую статистику отправки.
+func NewSendStats() *SendStats {
+	return &SendStats{errors: map[string]int{}}
+}
+
+// Record учитывает отправку пачки batch одним вызовом WriteMessages, занявшую latency. Задержка относится к каждому
+// сообщению пачки: подтверждение любого из них пришло не раньше, чем закончился вызов. Ошибка kafka.WriteErrors
+// относится к сообщениям по отдельности (успешные учитываются как отправленные), любая другая — ко всей пачке.
+func (s *SendStats) Record(batch []kafka.Message, latency time.Duration, err error) {
+	var perMessage kafka.WriteErrors
+	if !errors.As(err, &perMessage) || len(perMessage) != len(batch) {
+		perMessage = nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes++
+	sent := 0
+	for i, msg := range batch {
+		msgErr := err
+		if perMessage != nil {
+			msgErr = perMessage[i]
+		}
+		if msgErr != nil {
+			s.failed++
+			s.errors[SendErrorCode(msgErr)]++
+			continue
+		}
+		sent++
+		s.bytes += int64(len(msg.Key) + len(msg.Value))
+	}
+	s.sent += sent
+	s.latencies.ObserveN(latency, sent)
+}
+
+// Summary возвращает сводку отправки за время elapsed.
+func (s *SendStats) Summary(elapsed time.Duration) SendSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sum := SendSummary{
+		Sent:    s.sent,
+		Failed:  s.failed,
+		Writes:  s.writes,
+		Bytes:   s.bytes,
+		Elapsed: elapsed,
+		P50:     s.latencies.Quantile(0.50),
+		P90:     s.latencies.Quantile(0.90),
+		P99:     s.latencies.Quantile(0.99),
+		Max:     s.latencies.Max(),
+		Errors:  make(map[string]int, len(s.errors)),
+	}
+	for code, n := range s.errors {
+		sum.Errors[code] = n
+	}
+	return sum
+}
+
+// SendSummary - итог отправки: число сообщений, квантили задержки подтверждения сообщений, ошибки по кодам и объём.
+type SendSummary struct {
+	Sent    int // подтверждённых сообщений
+	Failed  int // сообщений, отправка которых завершилась ошибкой
+	Writes  int // вызовов WriteMessages (в асинхронном режиме — подтверждённых пачек)
+	Bytes   int64
+	Elapsed time.Duration
+	P50     time.Duration
+	P90     time.Duration
+	P99     time.Duration
+	Max     time.Duration
+	Errors  map[string]int // число неотправленных сообщений по кодам ошибок (SendErrorCode)
+}
+
+// Throughput возвращает число подтверждённых сообщений в секунду.
+func (s SendSummary) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Sent) / s.Elapsed.Seconds()
+}
+
+// BytesPerSecond возвращает объём ключей и значений подтверждённых сообщений в секунду.
+func (s SendSummary) BytesPerSecond() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Elapsed.Seconds()
+}
+
+func (s SendSummary) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "sent %d messages in %s (%.0f msg/s, %.0f B/s) over %d writes, errors %d; message latency p50 %s, p90 %s, p99 %s, max %s",
+		s.Sent, s.Elapsed.Round(time.Millisecond), s.Throughput(), s.BytesPerSecond(), s.Writes, s.Failed,
+		s.P50.Round(time.Microsecond), s.P90.Round(time.Microsecond), s.P99.Round(time.Microsecond), s.Max.Round(time.Microsecond))
+	if len(s.Errors) > 0 {
+		codes := make([]string, 0, len(s.Errors))
+		for code := range s.Errors {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		b.WriteString("; errors by code:")
+		for i, code := range codes {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, " %s %d", code, s.Errors[code])
+		}
+	}
+	return b.String()
+}
+
+// MessageWriter - отправка сообщений в Kafka, реализуется *kafka.Writer.
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// MeasuredWriter - MessageWriter, учитывающий каждый вызов WriteMessages в SendStats. Для синхронного writer'а
+// возврат из WriteMessages означает подтверждение брокером (с учётом RequiredAcks).
+type MeasuredWriter struct {
+	w     MessageWriter
+	stats *SendStats
+}
+
+// NewMeasuredWriter оборачивает w, учитывая его отправки в stats.
+func NewMeasuredWriter(w MessageWriter, stats *SendStats) *MeasuredWriter {
+	return &MeasuredWriter{w: w, stats: stats}
+}
+
+// WriteMessages отправляет сообщения и учитывает время вызова, отнесённое к каждому сообщению, и ошибки.
+func (m *MeasuredWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	start := time.Now()
+	err := m.w.WriteMessages(ctx, msgs...)
+	m.stats.Record(msgs, time.Since(start), err)
+	return err
+}
+
+// Close закрывает обёрнутый writer.
+func (m *MeasuredWriter) Close() error { return m.w.Close() }
+
+// asyncSentAt - время передачи сообщения асинхронному writer'у, хранится в kafka.Message.WriterData
+type asyncSentAt struct{ time.Time }
+
+// MeasureAsync переводит w в асинхронный режим и учитывает подтверждения сообщений в stats: WriteMessages
+// возвращается сразу, а задержка каждого сообщения считается от вызова WriteMessages до вызова Writer.Completion.
+// Возвращённый MessageWriter отмечает время передачи сообщений и должен использоваться вместо w; Close дожидается
+// подтверждения всех переданных сообщений. Прежний Writer.Completion, если задан, вызывается после учёта.
+func MeasureAsync(w *kafka.Writer, stats *SendStats) MessageWriter {
+	w.Async = true
+	next := w.Completion
+	w.Completion = func(messages []kafka.Message, err error) {
+		now := time.Now()
+		// Сообщения одной отправки в Kafka могли быть переданы разными вызовами WriteMessages: учитываем
+		// подряд идущие сообщения с одинаковым временем передачи одной группой
+		for start := 0; start < len(messages); {
+			sentAt, _ := messages[start].WriterData.(asyncSentAt)
+			end := start + 1
+			for end < len(messages) && messages[end].WriterData == messages[start].WriterData {
+				end++
+			}
+			stats.Record(messages[start:end], now.Sub(sentAt.Time), err)
+			start = end
+		}
+		if next != nil {
+			next(messages, err)
+		}
+	}
+	return asyncWriter{w: w, stats: stats}
+}
+
+// asyncWriter - асинхронный writer, отмечающий время передачи сообщений для MeasureAsync
+type asyncWriter struct {
+	w     *kafka.Writer
+	stats *SendStats
+}
+
+func (a asyncWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	// Сообщения копируются: WriterData не должен изменять срез вызывающего
+	sentAt := asyncSentAt{time.Now()}
+	marked := make([]kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		msg.WriterData = sentAt
+		marked[i] = msg
+	}
+	err := a.w.WriteMessages(ctx, marked...)
+	if err != nil {
+		// Сообщения не переданы writer'у (контекст отменён или writer закрыт), Completion для них не вызывается
+		a.stats.Record(msgs, time.Since(sentAt.Time), err)
+	}
+	return err
+}
+
+func (a asyncWriter) Close() error { return a.w.Close() }
+
+// ParseRequiredAcks разбирает число подтверждений, которого writer ждёт от брокеров: none, one или all.
+func ParseRequiredAcks(s string) (kafka.RequiredAcks, error) {
+	var acks kafka.RequiredAcks
+	switch s {
+	case "none", "one", "all":
+		err := acks.UnmarshalText([]byte(s))
+		return acks, err
+	default:
+		return 0, fmt.Errorf("invalid acks %q: must be none, one or all", s)
+	}
+}
@@ -0,0 +1,168 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencyHistogramQuantiles(t *testing.T) {
+	var h LatencyHistogram
+	assert.Zero(t, h.Quantile(0.5), "no observations")
+
+	// 1ms, 2ms, ..., 1000ms: точные квантили p50=500ms, p90=900ms, p99=990ms
+	for i := 1; i <= 1000; i++ {
+		h.ObserveN(time.Duration(i)*time.Millisecond, 1)
+	}
+	require.Equal(t, uint64(1000), h.Count())
+	assert.Equal(t, time.Second, h.Max())
+	for q, exact := range map[float64]time.Duration{0.5: 500 * time.Millisecond, 0.9: 900 * time.Millisecond, 0.99: 990 * time.Millisecond} {
+		got := h.Quantile(q)
+		assert.GreaterOrEqual(t, got, exact, "q=%v", q)
+		assert.LessOrEqual(t, float64(got), float64(exact)*1.095, "q=%v is within one bucket", q)
+	}
+	assert.Equal(t, time.Second, h.Quantile(1), "the top quantile is capped at max")
+
+	// Память не растёт с числом наблюдений
+	size := unsafe.Sizeof(h)
+	h.ObserveN(time.Millisecond, 1_000_000)
+	assert.Equal(t, size, unsafe.Sizeof(h))
+	assert.Equal(t, uint64(1_001_000), h.Count())
+}
+
+func TestLatencyHistogramBounds(t *testing.T) {
+	var h LatencyHistogram
+	h.ObserveN(time.Nanosecond, 1)
+	assert.Equal(t, time.Nanosecond, h.Quantile(0.5), "below the first bucket bound the max is reported")
+
+	h.ObserveN(time.Hour, 3)
+	assert.Equal(t, time.Hour, h.Quantile(0.9), "overflow bucket reports max")
+	h.ObserveN(time.Second, 0)
+	assert.Equal(t, uint64(4), h.Count())
+
+	for _, d := range []time.Duration{latencyMin, 11 * time.Microsecond, time.Millisecond, 123456789, time.Minute} {
+		i := latencyBucket(d)
+		assert.GreaterOrEqual(t, latencyUpperBound(i), d, "%s", d)
+		if i > 0 {
+			assert.Less(t, latencyUpperBound(i-1), d, "%s", d)
+		}
+	}
+}
+
+func TestSendStatsAttributesBatchLatency(t *testing.T) {
+	stats := NewSendStats()
+	batch := make([]kafka.Message, 10)
+	for i := range batch {
+		batch[i] = kafka.Message{Key: []byte("k"), Value: []byte(fmt.Sprint(i))}
+	}
+	stats.Record(batch, 20*time.Millisecond, nil)
+
+	// Ошибки отдельных сообщений: 8 отправлены, 2 не отправлены с разными кодами
+	perMessage := make(kafka.WriteErrors, 10)
+	perMessage[3] = kafka.NotLeaderForPartition
+	perMessage[7] = context.DeadlineExceeded
+	stats.Record(batch, 100*time.Millisecond, perMessage)
+
+	// Ошибка всей пачки
+	stats.Record(batch[:5], time.Second, errors.New("connection refused"))
+
+	sum := stats.Summary(2 * time.Second)
+	assert.Equal(t, 18, sum.Sent)
+	assert.Equal(t, 7, sum.Failed)
+	assert.Equal(t, 3, sum.Writes)
+	assert.Equal(t, int64(18*2), sum.Bytes)
+	assert.Equal(t, map[string]int{kafka.NotLeaderForPartition.Title(): 1, SendErrorTimeout: 1, SendErrorOther: 5}, sum.Errors)
+	assert.Equal(t, 100*time.Millisecond, sum.Max, "failed batches do not count as latency")
+	assert.InEpsilon(t, float64(20*time.Millisecond), float64(sum.P50), 0.095, "10 of 18 messages took 20ms")
+	assert.Equal(t, 100*time.Millisecond, sum.P90)
+	assert.InDelta(t, 9.0, sum.Throughput(), 1e-9)
+	assert.InDelta(t, 18.0, sum.BytesPerSecond(), 1e-9)
+	assert.Contains(t, sum.String(), "sent 18 messages in 2s (9 msg/s, 18 B/s) over 3 writes, errors 7")
+	assert.Contains(t, sum.String(), "; errors by code: Not Leader For Partition 1, other 5, timeout 1")
+
+	// Сводка — копия: дальнейший учёт её не меняет
+	sum.Errors[SendErrorOther] = 0
+	assert.Equal(t, 5, stats.Summary(time.Second).Errors[SendErrorOther])
+	assert.Zero(t, NewSendStats().Summary(0).Throughput())
+}
+
+func TestSendErrorCode(t *testing.T) {
+	assert.Equal(t, "Leader Not Available", SendErrorCode(fmt.Errorf("write: %w", kafka.LeaderNotAvailable)))
+	assert.Equal(t, SendErrorTimeout, SendErrorCode(context.DeadlineExceeded))
+	assert.Equal(t, SendErrorCanceled, SendErrorCode(context.Canceled))
+	assert.Equal(t, SendErrorOther, SendErrorCode(errors.New("dial tcp: connection refused")))
+}
+
+func TestParseRequiredAcks(t *testing.T) {
+	for in, want := range map[string]kafka.RequiredAcks{"none": kafka.RequireNone, "one": kafka.RequireOne, "all": kafka.RequireAll} {
+		got, err := ParseRequiredAcks(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	for _, in := range []string{"", "1", "-1", "ALL"} {
+		_, err := ParseRequiredAcks(in)
+		assert.Error(t, err, in)
+	}
+}
+
+// stubWriter - MessageWriter, возвращающий err после задержки delay
+type stubWriter struct {
+	delay time.Duration
+	err   error
+}
+
+func (w stubWriter) WriteMessages(context.Context, ...kafka.Message) error {
+	time.Sleep(w.delay)
+	return w.err
+}
+
+func (w stubWriter) Close() error { return nil }
+
+func TestMeasuredWriter(t *testing.T) {
+	stats := NewSendStats()
+	msgs := []kafka.Message{{Value: []byte("a")}, {Value: []byte("b")}}
+
+	require.NoError(t, NewMeasuredWriter(stubWriter{delay: 5 * time.Millisecond}, stats).WriteMessages(context.Background(), msgs...))
+	err := NewMeasuredWriter(stubWriter{err: kafka.RequestTimedOut}, stats).WriteMessages(context.Background(), msgs...)
+	assert.ErrorIs(t, err, kafka.RequestTimedOut)
+
+	sum := stats.Summary(time.Second)
+	assert.Equal(t, 2, sum.Sent)
+	assert.Equal(t, 2, sum.Failed)
+	assert.Equal(t, map[string]int{"Request Timed Out": 2}, sum.Errors)
+	assert.GreaterOrEqual(t, sum.P50, 5*time.Millisecond)
+}
+
+func TestMeasureAsyncGroupsCompletions(t *testing.T) {
+	stats := NewSendStats()
+	var forwarded int
+	w := &kafka.Writer{Completion: func(messages []kafka.Message, _ error) { forwarded += len(messages) }}
+	MeasureAsync(w, stats)
+	require.True(t, w.Async)
+
+	// Одна отправка в Kafka объединяет сообщения двух вызовов WriteMessages
+	now := time.Now()
+	first, second := asyncSentAt{now.Add(-300 * time.Millisecond)}, asyncSentAt{now.Add(-10 * time.Millisecond)}
+	w.Completion([]kafka.Message{
+		{Value: []byte("1"), WriterData: first},
+		{Value: []byte("2"), WriterData: first},
+		{Value: []byte("3"), WriterData: second},
+	}, nil)
+	w.Completion([]kafka.Message{{Value: []byte("4"), WriterData: second}}, kafka.MessageSizeTooLarge)
+
+	sum := stats.Summary(time.Second)
+	assert.Equal(t, 3, sum.Sent)
+	assert.Equal(t, 1, sum.Failed)
+	assert.Equal(t, 3, sum.Writes, "one record per group of messages from the same call")
+	assert.Equal(t, map[string]int{kafka.MessageSizeTooLarge.Title(): 1}, sum.Errors)
+	assert.GreaterOrEqual(t, sum.Max, 300*time.Millisecond)
+	assert.GreaterOrEqual(t, sum.P50, 300*time.Millisecond, "two of three messages waited since the first call")
+	assert.Equal(t, 4, forwarded, "the previous Completion is still called")
+}
@@ -0,0 +1,117 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// TopicSpec содержит параметры топиков, создаваемых EnsureTopics, и минимальное число партиций, которое проверяет VerifyTopics.
+type TopicSpec struct {
+	Partitions        int // число партиций создаваемого топика
+	ReplicationFactor int // фактор репликации создаваемого топика
+	MinPartitions     int // наименьшее допустимое число партиций существующего топика; 0 — не проверяется
+}
+
+// Ожидание метаданных созданных топиков: брокер отвечает на CreateTopics раньше, чем топик появляется в метаданных
+// всех брокеров и у его партиций выбираются лидеры.
+const (
+	topicWaitAttempts = 20
+	topicWaitDelay    = 250 * time.Millisecond
+)
+
+// EnsureTopics создает отсутствующие топики topics с параметрами spec и проверяет все топики, как VerifyTopics.
+// Создание идемпотентно: топик, который уже существует или одновременно создан другим экземпляром, не считается ошибкой,
+// а его параметры не изменяются.
+func EnsureTopics(ctx context.Context, brokers []string, topics []string, spec TopicSpec) error {
+	client, closeClient := newClient(brokers)
+	defer closeClient()
+	configs := make([]kafka.TopicConfig, len(topics))
+	for i, topic := range topics {
+		configs[i] = kafka.TopicConfig{Topic: topic, NumPartitions: spec.Partitions, ReplicationFactor: spec.ReplicationFactor}
+	}
+	resp, err := client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: configs})
+	if err != nil {
+		return fmt.Errorf("ensure topics: create: %w", err)
+	}
+	var problems []string
+	for _, topic := range topics {
+		if terr := resp.Errors[topic]; terr != nil && !errors.Is(terr, kafka.TopicAlreadyExists) {
+			problems = append(problems, fmt.Sprintf("%s: %v", topic, terr))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("ensure topics: create: %s", strings.Join(problems, "; "))
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = VerifyTopics(ctx, brokers, topics, spec.MinPartitions)
+		if err == nil || !errors.Is(err, ErrTopicNotReady) || attempt == topicWaitAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(topicWaitDelay):
+		}
+	}
+}
+
+// VerifyTopics проверяет, что топики topics существуют и в каждом не меньше minPartitions партиций.
+// Возвращает ошибку с перечислением всех отсутствующих и неподходящих топиков.
+func VerifyTopics(ctx context.Context, brokers []string, topics []string, minPartitions int) error {
+	client, closeClient := newClient(brokers)
+	defer closeClient()
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: topics})
+	if err != nil {
+		return fmt.Errorf("verify topics: metadata: %w", err)
+	}
+	return checkTopicMetadata(topics, meta.Topics, minPartitions)
+}
+
+// ErrTopicNotReady соответствует (errors.Is) ошибке VerifyTopics, если все найденные проблемы — отсутствующие топики
+// или топики, у партиций которых ещё нет лидера, то есть их может исправить создание топиков.
+var ErrTopicNotReady = errors.New("topic is not ready")
+
+// topicsError - ошибка проверки топиков; fatal - среди проблем есть такие, которые не исправит создание топиков
+type topicsError struct {
+	problems []string
+	fatal    bool
+}
+
+func (e *topicsError) Error() string { return "verify topics: " + strings.Join(e.problems, "; ") }
+
+func (e *topicsError) Is(target error) bool { return !e.fatal && target == ErrTopicNotReady }
+
+// checkTopicMetadata проверяет метаданные meta топиков topics: каждый топик должен быть в метаданных без ошибки
+// и содержать не меньше minPartitions партиций.
+func checkTopicMetadata(topics []string, meta []kafka.Topic, minPartitions int) error {
+	found := make(map[string]kafka.Topic, len(meta))
+	for _, t := range meta {
+		found[t.Name] = t
+	}
+	e := &topicsError{}
+	for _, topic := range topics {
+		t, ok := found[topic]
+		switch {
+		case !ok || errors.Is(t.Error, kafka.UnknownTopicOrPartition):
+			e.problems = append(e.problems, topic+": not found")
+		case errors.Is(t.Error, kafka.LeaderNotAvailable):
+			e.problems = append(e.problems, fmt.Sprintf("%s: %v", topic, t.Error))
+		case t.Error != nil:
+			e.problems = append(e.problems, fmt.Sprintf("%s: %v", topic, t.Error))
+			e.fatal = true
+		case len(t.Partitions) < minPartitions:
+			e.problems = append(e.problems, fmt.Sprintf("%s: %d partitions, at least %d required", topic, len(t.Partitions), minPartitions))
+			e.fatal = true
+		}
+	}
+	if len(e.problems) == 0 {
+		return nil
+	}
+	return e
+}
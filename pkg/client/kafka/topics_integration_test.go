@@ -0,0 +1,59 @@
+//go:build integration
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEnsureTopicsCreatesTopicsOnce - одновременный запуск нескольких экземпляров создает топики один раз,
+// повторный вызов не изменяет их, а проверка минимального числа партиций видит созданные топики.
+// Запуск: go test -tags integration -run EnsureTopics ./pkg/client/kafka/
+func TestEnsureTopicsCreatesTopicsOnce(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	brokers := []string{"localhost:9092"}
+	suffix := time.Now().UnixNano()
+	topics := []string{fmt.Sprintf("ensure_test_%d", suffix), fmt.Sprintf("ensure_test_%d.dlq", suffix)}
+	t.Cleanup(func() {
+		client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+		_, _ = client.DeleteTopics(context.Background(), &kafka.DeleteTopicsRequest{Topics: topics})
+	})
+
+	spec := TopicSpec{Partitions: 3, ReplicationFactor: 1, MinPartitions: 3}
+	require.ErrorIs(t, VerifyTopics(ctx, brokers, topics, spec.MinPartitions), ErrTopicNotReady)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = EnsureTopics(ctx, brokers, topics, spec)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	// Повторный вызов с другими параметрами не пересоздаёт топики
+	require.NoError(t, EnsureTopics(ctx, brokers, topics, TopicSpec{Partitions: 1, ReplicationFactor: 1}))
+	require.NoError(t, VerifyTopics(ctx, brokers, topics, 3))
+
+	err := VerifyTopics(ctx, brokers, topics, 4)
+	assert.ErrorContains(t, err, "3 partitions, at least 4 required")
+	assert.NotErrorIs(t, err, ErrTopicNotReady)
+}
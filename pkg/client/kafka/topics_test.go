@@ -0,0 +1,76 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTopic - метаданные топика с n партициями
+func fakeTopic(name string, n int, err error) kafka.Topic {
+	t := kafka.Topic{Name: name, Error: err}
+	for i := 0; i < n; i++ {
+		t.Partitions = append(t.Partitions, kafka.Partition{Topic: name, ID: i})
+	}
+	return t
+}
+
+func TestCheckTopicMetadata(t *testing.T) {
+	topics := []string{"orders", "orders.dlq"}
+	cases := map[string]struct {
+		meta     []kafka.Topic
+		min      int
+		want     string // подстрока ошибки; пусто — проверка проходит
+		notReady bool   // ошибку исправит создание топиков
+	}{
+		"all present": {
+			meta: []kafka.Topic{fakeTopic("orders", 3, nil), fakeTopic("orders.dlq", 3, nil)},
+			min:  3,
+		},
+		"minimum not checked": {
+			meta: []kafka.Topic{fakeTopic("orders", 1, nil), fakeTopic("orders.dlq", 1, nil)},
+		},
+		"missing from metadata": {
+			meta:     []kafka.Topic{fakeTopic("orders", 3, nil)},
+			want:     "orders.dlq: not found",
+			notReady: true,
+		},
+		"unknown topic": {
+			meta:     []kafka.Topic{fakeTopic("orders", 0, kafka.UnknownTopicOrPartition), fakeTopic("orders.dlq", 1, nil)},
+			want:     "orders: not found",
+			notReady: true,
+		},
+		"leader not elected yet": {
+			meta:     []kafka.Topic{fakeTopic("orders", 3, kafka.LeaderNotAvailable), fakeTopic("orders.dlq", 3, nil)},
+			want:     "orders: [5] Leader Not Available",
+			notReady: true,
+		},
+		"too few partitions": {
+			meta: []kafka.Topic{fakeTopic("orders", 2, nil), fakeTopic("orders.dlq", 6, nil)},
+			min:  3,
+			want: "orders: 2 partitions, at least 3 required",
+		},
+		"not authorized": {
+			meta: []kafka.Topic{fakeTopic("orders", 3, nil), fakeTopic("orders.dlq", 0, kafka.TopicAuthorizationFailed)},
+			want: "orders.dlq: [29] Topic Authorization Failed",
+		},
+		"missing and too few partitions": {
+			meta: []kafka.Topic{fakeTopic("orders", 1, nil)},
+			min:  3,
+			want: "verify topics: orders: 1 partitions, at least 3 required; orders.dlq: not found",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := checkTopicMetadata(topics, tc.meta, tc.min)
+			if tc.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tc.want)
+			assert.Equal(t, tc.notReady, errors.Is(err, ErrTopicNotReady))
+		})
+	}
+}
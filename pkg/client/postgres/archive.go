@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"l0_test_self/internal/tenant"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// DeleteArchivedOrders удаляет в одной транзакции заказы арендатора tenantID с идентификаторами uids вместе с доставкой,
+// платежами, товарами и исходными сообщениями и возвращает число удалённых заказов. Удаляются только заказы
+// с date_created раньше before: заказ, дату которого успели изменить после выгрузки в архив, остаётся в базе.
+func DeleteArchivedOrders(ctx context.Context, pool *pgxpool.Pool, tenantID string, uids []string, before time.Time) (int64, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return 0, err
+	}
+	if len(uids) == 0 {
+		return 0, nil
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `DELETE FROM orders WHERE tenant_id = $1 AND order_uid = ANY($2) AND date_created < $3 RETURNING order_uid`,
+		tenantID, uids, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete from orders: %w", err)
+	}
+	var deleted []string
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan deleted order: %w", err)
+		}
+		deleted = append(deleted, uid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to delete from orders: %w", err)
+	}
+
+	for _, table := range []string{"delivery", "payment", "items", "raw_payloads"} {
+		if _, err := tx.Exec(ctx, `DELETE FROM `+table+` WHERE tenant_id = $1 AND order_uid = ANY($2)`, tenantID, deleted); err != nil {
+			return 0, fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return int64(len(deleted)), nil
+}
@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"l0_test_self/internal/tenant"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// LatencyRecord - сквозная задержка обработки заказа: от публикации сообщения в Kafka до появления заказа в кэше.
+type LatencyRecord struct {
+	OrderUid   string
+	Latency    time.Duration
+	MeasuredAt time.Time
+}
+
+// RecordLatencies сохраняет в журнал order_audit последнюю измеренную задержку каждого заказа арендатора tenantID из list.
+// Если заказ встречается в list несколько раз, сохраняется последнее значение.
+func RecordLatencies(ctx context.Context, pool *pgxpool.Pool, tenantID string, list []LatencyRecord) error {
+	if err := tenant.Validate(tenantID); err != nil {
+		return err
+	}
+	// Одна вставка не может обновить строку дважды, поэтому повторы заказа внутри list схлопываются
+	index := make(map[string]int, len(list))
+	uids := make([]string, 0, len(list))
+	latencies := make([]int64, 0, len(list))
+	measured := make([]time.Time, 0, len(list))
+	for _, rec := range list {
+		if i, ok := index[rec.OrderUid]; ok {
+			latencies[i], measured[i] = rec.Latency.Milliseconds(), rec.MeasuredAt
+			continue
+		}
+		index[rec.OrderUid] = len(uids)
+		uids = append(uids, rec.OrderUid)
+		latencies = append(latencies, rec.Latency.Milliseconds())
+		measured = append(measured, rec.MeasuredAt)
+	}
+	if len(uids) == 0 {
+		return nil
+	}
+
+	auditSQL := `INSERT INTO order_audit (tenant_id, order_uid, e2e_latency_ms, measured_at)
+                 SELECT $1, * FROM unnest($2::text[], $3::bigint[], $4::timestamptz[])
+                 ON CONFLICT (tenant_id, order_uid) DO UPDATE SET e2e_latency_ms = EXCLUDED.e2e_latency_ms, measured_at = EXCLUDED.measured_at`
+	if _, err := pool.Exec(ctx, auditSQL, tenantID, uids, latencies, measured); err != nil {
+		return fmt.Errorf("failed to record order latencies: %w", err)
+	}
+	return nil
+}
+
+// GetOrderLatency возвращает последнюю сохранённую задержку обработки заказа арендатора tenantID или ErrOrderNotFound.
+func GetOrderLatency(ctx context.Context, pool *pgxpool.Pool, tenantID, uid string) (LatencyRecord, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return LatencyRecord{}, err
+	}
+	rec := LatencyRecord{OrderUid: uid}
+	var ms int64
+	err := pool.QueryRow(ctx, `SELECT e2e_latency_ms, measured_at FROM order_audit WHERE tenant_id = $1 AND order_uid = $2`, tenantID, uid).Scan(&ms, &rec.MeasuredAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return LatencyRecord{}, ErrOrderNotFound
+		}
+		return LatencyRecord{}, fmt.Errorf("failed to query order latency: %w", err)
+	}
+	rec.Latency = time.Duration(ms) * time.Millisecond
+	return rec, nil
+}
+
+// MessageKey - положение сообщения Kafka: топик, партиция и смещение.
+type MessageKey struct {
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+// RecordMessageAttempt увеличивает в журнале message_attempts число неудачных попыток записи сообщения key и
+// возвращает его. Счётчик переживает перезапуск сервиса: сообщение, прочитанное повторно, продолжает его.
+func RecordMessageAttempt(ctx context.Context, pool *pgxpool.Pool, key MessageKey, orderUID, lastErr string) (int, error) {
+	attemptSQL := `INSERT INTO message_attempts (topic, kafka_partition, kafka_offset, order_uid, attempts, last_error, updated_at)
+                   VALUES ($1, $2, $3, $4, 1, $5, now())
+                   ON CONFLICT (topic, kafka_partition, kafka_offset) DO UPDATE
+                   SET attempts = message_attempts.attempts + 1, order_uid = EXCLUDED.order_uid,
+                       last_error = EXCLUDED.last_error, updated_at = EXCLUDED.updated_at
+                   RETURNING attempts`
+	var attempts int
+	if err := pool.QueryRow(ctx, attemptSQL, key.Topic, key.Partition, key.Offset, orderUID, lastErr).Scan(&attempts); err != nil {
+		return 0, fmt.Errorf("failed to record message attempt: %w", err)
+	}
+	return attempts, nil
+}
+
+// ClearMessageAttempts удаляет из журнала message_attempts счётчики попыток сообщений keys.
+func ClearMessageAttempts(ctx context.Context, pool *pgxpool.Pool, keys []MessageKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	topics := make([]string, len(keys))
+	partitions := make([]int32, len(keys))
+	offsets := make([]int64, len(keys))
+	for i, k := range keys {
+		topics[i], partitions[i], offsets[i] = k.Topic, int32(k.Partition), k.Offset
+	}
+	clearSQL := `DELETE FROM message_attempts m
+                 USING unnest($1::text[], $2::int[], $3::bigint[]) AS k(topic, kafka_partition, kafka_offset)
+                 WHERE m.topic = k.topic AND m.kafka_partition = k.kafka_partition AND m.kafka_offset = k.kafka_offset`
+	if _, err := pool.Exec(ctx, clearSQL, topics, partitions, offsets); err != nil {
+		return fmt.Errorf("failed to clear message attempts: %w", err)
+	}
+	return nil
+}
+
+// WebhookFailure - уведомление webhook, доставка которого прекращена: после всех попыток или постоянной ошибки получателя.
+type WebhookFailure struct {
+	Tenant    string
+	OrderUid  string
+	Event     string
+	Endpoint  string // адрес получателя без параметров запроса
+	Attempts  int
+	LastError string
+	FailedAt  time.Time
+}
+
+// RecordWebhookFailure сохраняет в журнал webhook_failures недоставленное уведомление.
+func RecordWebhookFailure(ctx context.Context, pool *pgxpool.Pool, f WebhookFailure) error {
+	if err := tenant.Validate(f.Tenant); err != nil {
+		return err
+	}
+	failureSQL := `INSERT INTO webhook_failures (tenant_id, order_uid, event, endpoint, attempts, last_error, failed_at)
+                   VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	if _, err := pool.Exec(ctx, failureSQL, f.Tenant, f.OrderUid, f.Event, f.Endpoint, f.Attempts, f.LastError, f.FailedAt); err != nil {
+		return fmt.Errorf("failed to record webhook failure: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Checkpoint - позиция чтения партиции читателем Kafka без группы: Offset - смещение следующего непрочитанного сообщения.
+type Checkpoint struct {
+	Reader    string
+	Topic     string
+	Partition int
+	Offset    int64
+	UpdatedAt time.Time
+}
+
+// SaveCheckpoint сохраняет позицию чтения партиции, заменяя предыдущую.
+func SaveCheckpoint(ctx context.Context, pool *pgxpool.Pool, cp Checkpoint) error {
+	checkpointSQL := `INSERT INTO checkpoints (reader_name, topic, kafka_partition, next_offset, updated_at)
+                      VALUES ($1, $2, $3, $4, $5)
+                      ON CONFLICT (reader_name, topic, kafka_partition) DO UPDATE
+                      SET next_offset = EXCLUDED.next_offset, updated_at = EXCLUDED.updated_at`
+	if _, err := pool.Exec(ctx, checkpointSQL, cp.Reader, cp.Topic, cp.Partition, cp.Offset, cp.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to save checkpoint of %s (%s/%d): %w", cp.Reader, cp.Topic, cp.Partition, err)
+	}
+	return nil
+}
+
+// LoadCheckpoints возвращает сохранённые позиции чтения топика topic читателем reader по партициям.
+func LoadCheckpoints(ctx context.Context, pool *pgxpool.Pool, reader, topic string) (map[int]int64, error) {
+	rows, err := pool.Query(ctx, `SELECT kafka_partition, next_offset FROM checkpoints WHERE reader_name = $1 AND topic = $2`, reader, topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query checkpoints of %s: %w", reader, err)
+	}
+	defer rows.Close()
+
+	offsets := make(map[int]int64)
+	for rows.Next() {
+		var partition int
+		var offset int64
+		if err := rows.Scan(&partition, &offset); err != nil {
+			return nil, fmt.Errorf("failed to scan checkpoint of %s: %w", reader, err)
+		}
+		offsets[partition] = offset
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoints of %s: %w", reader, err)
+	}
+	return offsets, nil
+}
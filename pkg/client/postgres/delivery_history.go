@@ -0,0 +1,119 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// ChangedByOrderUpdate - автор изменений доставки, сделанных заменой заказа целиком (UpsertOrder)
+const ChangedByOrderUpdate = "order update"
+
+// DeliveryChange - запись истории доставки заказа: значения доставки до изменения, время и автор изменения.
+type DeliveryChange struct {
+	Previous  *orders.Delivery `json:"previous"` // nil — до изменения у заказа не было доставки
+	ChangedAt time.Time        `json:"changed_at"`
+	ChangedBy string           `json:"changed_by"`
+}
+
+// deliveryTx возвращает доставку заказа uid (хранимый идентификатор) внутри транзакции tx или nil, если её нет
+func deliveryTx(ctx context.Context, tx pgx.Tx, tenantID, uid string) (*orders.Delivery, error) {
+	var d orders.Delivery
+	err := tx.QueryRow(ctx, `SELECT name, phone, zip, city, address, region, email FROM delivery WHERE tenant_id = $1 AND order_uid = $2`, tenantID, uid).
+		Scan(&d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to query delivery: %w", err)
+	}
+	if err := decryptDeliveryPII(fieldKeyring.Load(), uid, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// recordDeliveryChangeTx записывает в delivery_history прежнюю доставку заказа uid (хранимый идентификатор), если она
+// отличается от next. Вызывается в транзакции изменения до записи next, поэтому история не расходится с доставкой.
+func recordDeliveryChangeTx(ctx context.Context, tx pgx.Tx, tenantID, uid string, next orders.Delivery, changedBy string) error {
+	prev, err := deliveryTx(ctx, tx, tenantID, uid)
+	if err != nil {
+		return err
+	}
+	if prev != nil && *prev == next {
+		return nil
+	}
+
+	historySQL := `INSERT INTO delivery_history (tenant_id, order_uid, had_delivery, name, phone, zip, city, address, region, email, changed_at, changed_by)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, now(), $11)`
+	if prev == nil {
+		_, err = tx.Exec(ctx, historySQL, tenantID, uid, false, nil, nil, nil, nil, nil, nil, nil, changedBy)
+	} else {
+		var phone, email string
+		if phone, email, err = encryptDeliveryPII(fieldKeyring.Load(), *prev); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, historySQL, tenantID, uid, true, prev.Name, phone, prev.Zip, prev.City, prev.Address, prev.Region, email, changedBy)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert into delivery_history: %w", err)
+	}
+	return nil
+}
+
+// ListDeliveryHistory возвращает историю доставки заказа арендатора tenantID от старых изменений к новым. Пустой
+// список — доставку заказа не меняли; если нет самого заказа, возвращается ErrOrderNotFound.
+func ListDeliveryHistory(ctx context.Context, pool *pgxpool.Pool, tenantID, uid string) ([]DeliveryChange, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return nil, err
+	}
+	rows, err := pool.Query(ctx, `SELECT order_uid, had_delivery, COALESCE(name, ''), COALESCE(phone, ''), COALESCE(zip, ''), COALESCE(city, ''),
+		COALESCE(address, ''), COALESCE(region, ''), COALESCE(email, ''), changed_at, changed_by FROM delivery_history WHERE `+sectionOwnerSQL+` ORDER BY changed_at, id`, tenantID, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query delivery history: %w", err)
+	}
+	defer rows.Close()
+
+	var list []DeliveryChange
+	for rows.Next() {
+		var (
+			storedUID   string
+			hadDelivery bool
+			d           orders.Delivery
+			c           DeliveryChange
+		)
+		if err := rows.Scan(&storedUID, &hadDelivery, &d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email, &c.ChangedAt, &c.ChangedBy); err != nil {
+			return nil, fmt.Errorf("failed to scan delivery history: %w", err)
+		}
+		if hadDelivery {
+			if err := decryptDeliveryPII(fieldKeyring.Load(), storedUID, &d); err != nil {
+				return nil, err
+			}
+			c.Previous = &d
+		}
+		list = append(list, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating delivery history: %w", err)
+	}
+	if len(list) == 0 {
+		return nil, sectionAbsent(ctx, pool, tenantID, uid)
+	}
+	return list, nil
+}
+
+// DeleteDeliveryHistoryBefore удаляет записи истории доставки, сделанные раньше before, и возвращает их количество.
+func DeleteDeliveryHistoryBefore(ctx context.Context, pool *pgxpool.Pool, before time.Time) (int64, error) {
+	tag, err := pool.Exec(ctx, `DELETE FROM delivery_history WHERE changed_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete delivery history: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,160 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"l0_test_self/internal/crypto"
+	"l0_test_self/models/orders"
+)
+
+// fieldKeyring - ключи шифрования телефона и email доставки; nil — шифрование отключено
+var fieldKeyring atomic.Pointer[crypto.Keyring]
+
+// SetFieldEncryption задаёт ключи, которыми шифруются телефон и email доставки при записи и расшифровываются при чтении.
+// nil отключает шифрование новых записей; уже зашифрованные значения без ключей не читаются.
+func SetFieldEncryption(kr *crypto.Keyring) {
+	fieldKeyring.Store(kr)
+}
+
+// encryptDeliveryPII возвращает телефон и email доставки в виде для записи в базу данных: зашифрованными ключом kr
+func encryptDeliveryPII(kr *crypto.Keyring, d orders.Delivery) (phone, email string, err error) {
+	if phone, err = kr.Encrypt(d.Phone); err != nil {
+		return "", "", fmt.Errorf("failed to encrypt delivery phone: %w", err)
+	}
+	if email, err = kr.Encrypt(d.Email); err != nil {
+		return "", "", fmt.Errorf("failed to encrypt delivery email: %w", err)
+	}
+	return phone, email, nil
+}
+
+// decryptDeliveryPII расшифровывает телефон и email доставки, прочитанные из базы данных; открытый текст остаётся как есть
+func decryptDeliveryPII(kr *crypto.Keyring, orderUID string, d *orders.Delivery) error {
+	var err error
+	if d.Phone, err = kr.Decrypt(d.Phone); err != nil {
+		return fmt.Errorf("failed to decrypt delivery phone of order %s: %w", orderUID, err)
+	}
+	if d.Email, err = kr.Decrypt(d.Email); err != nil {
+		return fmt.Errorf("failed to decrypt delivery email of order %s: %w", orderUID, err)
+	}
+	return nil
+}
+
+// encryptionCheckSample - сколько зашифрованных строк доставки проверяет VerifyFieldEncryption
+const encryptionCheckSample = 100
+
+// VerifyFieldEncryption проверяет при запуске, что зашифрованные строки доставки читаются ключами kr (nil — шифрование
+// отключено): расшифровывает выборку зашифрованных значений и возвращает ошибку, если ключа нет или он не подходит.
+func VerifyFieldEncryption(ctx context.Context, db Client, kr *crypto.Keyring) error {
+	rows, err := db.Query(ctx, `SELECT order_uid, phone, email FROM delivery
+		WHERE phone LIKE 'enc:%' OR email LIKE 'enc:%' LIMIT $1`, encryptionCheckSample)
+	if err != nil {
+		return fmt.Errorf("failed to query encrypted deliveries: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var uid, phone, email string
+		if err := rows.Scan(&uid, &phone, &email); err != nil {
+			return fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		for _, v := range []string{phone, email} {
+			if _, err := kr.Decrypt(v); err != nil {
+				return fmt.Errorf("delivery of order %s cannot be decrypted with configured keys: %w", uid, err)
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// EncryptionProgress - итог пачки EncryptDeliveryPII
+type EncryptionProgress struct {
+	Scanned    int    // просмотрено строк доставки
+	Encrypted  int    // строк, в которых значения (пере)зашифрованы активным ключом
+	LastTenant string // арендатор последней просмотренной строки
+	LastUID    string // order_uid последней просмотренной строки
+}
+
+// EncryptDeliveryPII шифрует активным ключом kr телефон и email существующих строк доставки: открытый текст и значения,
+// зашифрованные другими ключами (после ротации). Строки всех арендаторов обходятся пачками по batchSize в порядке
+// (tenant_id, order_uid), каждая пачка записывается своей транзакцией (точкой сохранения, если db — транзакция), поэтому
+// прерванный проход можно продолжить. После каждой пачки вызывается progress.
+func EncryptDeliveryPII(ctx context.Context, db Client, kr *crypto.Keyring, batchSize int, progress func(EncryptionProgress)) (EncryptionProgress, error) {
+	if kr == nil {
+		return EncryptionProgress{}, fmt.Errorf("encryption keys are not configured")
+	}
+	if batchSize <= 0 {
+		return EncryptionProgress{}, fmt.Errorf("batch size must be positive")
+	}
+
+	var total EncryptionProgress
+	for {
+		batch, err := encryptDeliveryBatch(ctx, db, kr, total.LastTenant, total.LastUID, batchSize)
+		if err != nil {
+			return total, err
+		}
+		if batch.Scanned == 0 {
+			return total, nil
+		}
+		total.Scanned += batch.Scanned
+		total.Encrypted += batch.Encrypted
+		total.LastTenant, total.LastUID = batch.LastTenant, batch.LastUID
+		if progress != nil {
+			progress(total)
+		}
+	}
+}
+
+// encryptDeliveryBatch шифрует одну пачку строк доставки с (tenant_id, order_uid) больше (afterTenant, afterUID)
+func encryptDeliveryBatch(ctx context.Context, db Client, kr *crypto.Keyring, afterTenant, afterUID string, limit int) (EncryptionProgress, error) {
+	var res EncryptionProgress
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return res, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// FOR UPDATE защищает пачку от одновременной записи сервисом
+	rows, err := tx.Query(ctx, `SELECT tenant_id, order_uid, phone, email FROM delivery
+		WHERE (tenant_id, order_uid) > ($1, $2) ORDER BY tenant_id, order_uid LIMIT $3 FOR UPDATE`, afterTenant, afterUID, limit)
+	if err != nil {
+		return res, fmt.Errorf("failed to query deliveries: %w", err)
+	}
+	type row struct{ tenant, uid, phone, email string }
+	var pending []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.tenant, &r.uid, &r.phone, &r.email); err != nil {
+			rows.Close()
+			return res, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		res.Scanned++
+		res.LastTenant, res.LastUID = r.tenant, r.uid
+		if kr.NeedsEncrypt(r.phone) || kr.NeedsEncrypt(r.email) {
+			pending = append(pending, r)
+		}
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return res, fmt.Errorf("error iterating delivery rows: %w", rows.Err())
+	}
+
+	for _, r := range pending {
+		d := orders.Delivery{Phone: r.phone, Email: r.email}
+		if err := decryptDeliveryPII(kr, r.uid, &d); err != nil {
+			return res, err
+		}
+		phone, email, err := encryptDeliveryPII(kr, d)
+		if err != nil {
+			return res, err
+		}
+		if _, err := tx.Exec(ctx, `UPDATE delivery SET phone = $3, email = $4 WHERE tenant_id = $1 AND order_uid = $2`, r.tenant, r.uid, phone, email); err != nil {
+			return res, fmt.Errorf("failed to update delivery of order %s: %w", r.uid, err)
+		}
+		res.Encrypted++
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return res, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return res, nil
+}
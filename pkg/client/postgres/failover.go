@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// connectionLostStates - коды ошибок PostgreSQL, с которыми сервер обрывает соединения при остановке или переключении
+// основного сервера. Класс 08 (connection exception) проверяется отдельно.
+var connectionLostStates = map[string]bool{
+	"57P01": true, // admin_shutdown: terminating connection due to administrator command
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now: сервер запускается или останавливается
+	"25006": true, // read_only_sql_transaction: соединение ведёт к бывшему основному серверу, ставшему репликой
+}
+
+// IsConnectionLost сообщает, вызвана ли ошибка потерей соединения с сервером (остановка, перезапуск или переключение
+// основного сервера PostgreSQL, обрыв сети), а не запросом: после восстановления соединений тот же запрос выполнится.
+// Истечение времени запроса и отмена контекста потерей соединения не считаются.
+func IsConnectionLost(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return connectionLostStates[pgErr.Code] || strings.HasPrefix(pgErr.Code, "08")
+	}
+	if pgconn.Timeout(err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	// Запрос через соединение, уже закрытое после ошибки, pgconn отклоняет ошибкой без типа
+	return strings.Contains(err.Error(), "conn closed")
+}
+
+// ResetIdleConns закрывает все простаивающие соединения пула и возвращает их число. После переключения основного
+// сервера такие соединения ведут к остановленному серверу: без сброса каждое из них дало бы ещё одну ошибку запроса,
+// прежде чем пул заменит его новым. Занятые соединения закрываются пулом при возврате, если запрос на них не удался.
+func ResetIdleConns(ctx context.Context, pool *pgxpool.Pool) int {
+	conns := pool.AcquireAllIdle(ctx)
+	for _, conn := range conns {
+		// Закрытое соединение при возврате удаляется из пула; ошибка закрытия мёртвого соединения не важна
+		_ = conn.Conn().Close(ctx)
+		conn.Release()
+	}
+	return len(conns)
+}
@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"l0_test_self/internal/tenant"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// IdempotencyRecord - запрос арендатора Tenant, выполненный с ключом идемпотентности, и его результат.
+// Status 0 означает, что запрос ещё обрабатывается владельцем ключа.
+type IdempotencyRecord struct {
+	Tenant      string
+	Key         string
+	RequestHash string
+	OrderUid    string
+	Status      int
+	Response    []byte
+	CreatedAt   time.Time
+}
+
+// reserveAttempts - сколько раз повторяется резервирование, если существующая запись исчезла между вставкой и чтением
+const reserveAttempts = 3
+
+// ReserveIdempotencyKey резервирует ключ арендатора tenantID за запросом с хэшем тела requestHash. Уникальность ключа
+// в пределах арендатора обеспечивает первичный ключ таблицы, поэтому из конкурирующих запросов ключ получает ровно один.
+// Запись, созданная раньше expiredBefore, считается истёкшей и заменяется. Возвращает true, если ключ зарезервирован
+// этим вызовом, иначе — существующую запись.
+func ReserveIdempotencyKey(ctx context.Context, pool *pgxpool.Pool, tenantID, key, requestHash string, expiredBefore time.Time) (IdempotencyRecord, bool, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	reserveSQL := `INSERT INTO idempotency_keys (tenant_id, key, request_hash, created_at) VALUES ($1, $2, $3, now())
+                   ON CONFLICT (tenant_id, key) DO UPDATE
+                   SET request_hash = EXCLUDED.request_hash, order_uid = '', status = 0, response = NULL, created_at = EXCLUDED.created_at
+                   WHERE idempotency_keys.created_at < $4
+                   RETURNING created_at`
+	selectSQL := `SELECT request_hash, order_uid, status, response, created_at FROM idempotency_keys WHERE tenant_id = $1 AND key = $2`
+
+	var err error
+	for attempt := 0; attempt < reserveAttempts; attempt++ {
+		rec := IdempotencyRecord{Tenant: tenantID, Key: key, RequestHash: requestHash}
+		err = pool.QueryRow(ctx, reserveSQL, tenantID, key, requestHash, expiredBefore).Scan(&rec.CreatedAt)
+		if err == nil {
+			return rec, true, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return IdempotencyRecord{}, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+		}
+
+		err = pool.QueryRow(ctx, selectSQL, tenantID, key).Scan(&rec.RequestHash, &rec.OrderUid, &rec.Status, &rec.Response, &rec.CreatedAt)
+		if err == nil {
+			return rec, false, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return IdempotencyRecord{}, false, fmt.Errorf("failed to query idempotency key: %w", err)
+		}
+		// Владелец освободил ключ между вставкой и чтением: пробуем зарезервировать снова
+	}
+	return IdempotencyRecord{}, false, fmt.Errorf("failed to reserve idempotency key after %d attempts: %w", reserveAttempts, err)
+}
+
+// CompleteIdempotencyKey сохраняет результат запроса, зарезервировавшего ключ rec.Key арендатора rec.Tenant.
+func CompleteIdempotencyKey(ctx context.Context, pool *pgxpool.Pool, rec IdempotencyRecord) error {
+	if err := tenant.Validate(rec.Tenant); err != nil {
+		return err
+	}
+	completeSQL := `UPDATE idempotency_keys SET order_uid = $3, status = $4, response = $5 WHERE tenant_id = $1 AND key = $2 AND request_hash = $6`
+	if _, err := pool.Exec(ctx, completeSQL, rec.Tenant, rec.Key, rec.OrderUid, rec.Status, rec.Response, rec.RequestHash); err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey удаляет незавершённую резервацию ключа арендатора tenantID, чтобы повтор запроса был обработан заново.
+func ReleaseIdempotencyKey(ctx context.Context, pool *pgxpool.Pool, tenantID, key string) error {
+	if err := tenant.Validate(tenantID); err != nil {
+		return err
+	}
+	if _, err := pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE tenant_id = $1 AND key = $2 AND status = 0`, tenantID, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteIdempotencyKeysBefore удаляет ключи идемпотентности, созданные раньше before, и возвращает их количество.
+func DeleteIdempotencyKeysBefore(ctx context.Context, pool *pgxpool.Pool, before time.Time) (int64, error) {
+	tag, err := pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete idempotency keys: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"l0_test_self/internal/ids"
+	"l0_test_self/internal/tenant"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// IncompleteOrder - заказ без товаров, доставки или платежей
+type IncompleteOrder struct {
+	OrderUid        string `json:"order_uid"`
+	ItemsMissing    bool   `json:"items_missing"`
+	DeliveryMissing bool   `json:"delivery_missing"`
+	PaymentMissing  bool   `json:"payment_missing"`
+}
+
+// ListIncompleteOrders возвращает до limit заказов арендатора tenantID, у которых нет ни одного товара, доставки
+// или платежа, в порядке идентификаторов (без учёта регистра) после after; пустой after — с начала. Заказы в карантине
+// тоже учитываются. Идентификаторы возвращаются в нижнем регистре.
+func ListIncompleteOrders(ctx context.Context, pool *pgxpool.Pool, tenantID, after string, limit int) ([]IncompleteOrder, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return nil, err
+	}
+	incompleteSQL := `SELECT order_uid, items_missing, delivery_missing, payment_missing FROM (
+                          SELECT o.order_uid,
+                                 NOT EXISTS (SELECT 1 FROM items i WHERE i.tenant_id = o.tenant_id AND i.order_uid = o.order_uid) AS items_missing,
+                                 NOT EXISTS (SELECT 1 FROM delivery d WHERE d.tenant_id = o.tenant_id AND d.order_uid = o.order_uid) AS delivery_missing,
+                                 NOT EXISTS (SELECT 1 FROM payment p WHERE p.tenant_id = o.tenant_id AND p.order_uid = o.order_uid) AS payment_missing
+                          FROM orders o
+                          WHERE o.tenant_id = $1 AND lower(o.order_uid) > lower($2)
+                      ) c
+                      WHERE items_missing OR delivery_missing OR payment_missing
+                      ORDER BY lower(order_uid), order_uid
+                      LIMIT $3`
+	rows, err := pool.Query(ctx, incompleteSQL, tenantID, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incomplete orders: %w", err)
+	}
+	defer rows.Close()
+
+	var list []IncompleteOrder
+	for rows.Next() {
+		var o IncompleteOrder
+		if err := rows.Scan(&o.OrderUid, &o.ItemsMissing, &o.DeliveryMissing, &o.PaymentMissing); err != nil {
+			return nil, fmt.Errorf("failed to scan incomplete order: %w", err)
+		}
+		o.OrderUid = ids.Normalize(o.OrderUid)
+		list = append(list, o)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating incomplete order rows: %w", rows.Err())
+	}
+	return list, nil
+}
@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"l0_test_self/internal/tenant"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// IngestStats - счётчики сообщений консьюмера от продюсера и покупателя за час.
+type IngestStats struct {
+	Tenant    string    `json:"tenant"`
+	Producer  string    `json:"producer_id"` // заголовок producer_id сообщения; "" — заголовка не было
+	Customer  string    `json:"customer_id"` // "" — сообщение не декодировано
+	Hour      time.Time `json:"hour"`
+	Accepted  int64     `json:"accepted"`
+	Invalid   int64     `json:"invalid"`
+	Duplicate int64     `json:"duplicate"`
+}
+
+// ingestStatsKey - строка таблицы ingest_stats
+type ingestStatsKey struct {
+	tenant, producer, customer string
+	hour                       int64
+}
+
+// AddIngestStats прибавляет счётчики list к строкам таблицы ingest_stats, создавая недостающие. Строки одного
+// продюсера, покупателя и часа внутри list складываются.
+func AddIngestStats(ctx context.Context, pool *pgxpool.Pool, list []IngestStats) error {
+	// Одна вставка не может обновить строку дважды, поэтому повторы строки внутри list схлопываются
+	index := make(map[ingestStatsKey]int, len(list))
+	merged := make([]IngestStats, 0, len(list))
+	for _, s := range list {
+		if err := tenant.Validate(s.Tenant); err != nil {
+			return err
+		}
+		s.Hour = s.Hour.UTC().Truncate(time.Hour)
+		key := ingestStatsKey{tenant: s.Tenant, producer: s.Producer, customer: s.Customer, hour: s.Hour.Unix()}
+		if i, ok := index[key]; ok {
+			merged[i].Accepted += s.Accepted
+			merged[i].Invalid += s.Invalid
+			merged[i].Duplicate += s.Duplicate
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, s)
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	tenants := make([]string, len(merged))
+	producers := make([]string, len(merged))
+	customers := make([]string, len(merged))
+	hours := make([]time.Time, len(merged))
+	accepted := make([]int64, len(merged))
+	invalid := make([]int64, len(merged))
+	duplicate := make([]int64, len(merged))
+	for i, s := range merged {
+		tenants[i], producers[i], customers[i], hours[i] = s.Tenant, s.Producer, s.Customer, s.Hour
+		accepted[i], invalid[i], duplicate[i] = s.Accepted, s.Invalid, s.Duplicate
+	}
+
+	statsSQL := `INSERT INTO ingest_stats (tenant_id, producer_id, customer_id, hour, accepted, invalid, duplicate, updated_at)
+                 SELECT *, now() FROM unnest($1::text[], $2::text[], $3::text[], $4::timestamptz[], $5::bigint[], $6::bigint[], $7::bigint[])
+                 ON CONFLICT (tenant_id, producer_id, customer_id, hour) DO UPDATE
+                 SET accepted = ingest_stats.accepted + EXCLUDED.accepted, invalid = ingest_stats.invalid + EXCLUDED.invalid,
+                     duplicate = ingest_stats.duplicate + EXCLUDED.duplicate, updated_at = EXCLUDED.updated_at`
+	if _, err := pool.Exec(ctx, statsSQL, tenants, producers, customers, hours, accepted, invalid, duplicate); err != nil {
+		return fmt.Errorf("failed to add ingest stats: %w", err)
+	}
+	return nil
+}
+
+// IngestStatsFilter - отбор строк ingest_stats: часы [From, To) и, если заданы, продюсер и покупатель.
+type IngestStatsFilter struct {
+	Producer string
+	Customer string
+	From     time.Time
+	To       time.Time
+}
+
+// ListIngestStats возвращает до limit строк ingest_stats арендатора tenantID, отобранных filter, от новых часов
+// к старым.
+func ListIngestStats(ctx context.Context, pool *pgxpool.Pool, tenantID string, filter IngestStatsFilter, limit int) ([]IngestStats, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return nil, err
+	}
+	listSQL := `SELECT producer_id, customer_id, hour, accepted, invalid, duplicate FROM ingest_stats
+                WHERE tenant_id = $1 AND hour >= $2 AND hour < $3
+                  AND ($4::text = '' OR producer_id = $4) AND ($5::text = '' OR customer_id = $5)
+                ORDER BY hour DESC, producer_id, customer_id
+                LIMIT $6`
+	rows, err := pool.Query(ctx, listSQL, tenantID, filter.From, filter.To, filter.Producer, filter.Customer, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ingest stats: %w", err)
+	}
+	defer rows.Close()
+
+	var list []IngestStats
+	for rows.Next() {
+		s := IngestStats{Tenant: tenantID}
+		if err := rows.Scan(&s.Producer, &s.Customer, &s.Hour, &s.Accepted, &s.Invalid, &s.Duplicate); err != nil {
+			return nil, fmt.Errorf("failed to scan ingest stats: %w", err)
+		}
+		list = append(list, s)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating ingest stats rows: %w", rows.Err())
+	}
+	return list, nil
+}
@@ -0,0 +1,87 @@
+//go:build integration
+
+package postgres_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+	"l0_test_self/pkg/testorders"
+)
+
+// BenchmarkInsertOrderConcurrent - бенчмарк InsertOrder при 1/4/16 параллельных воркерах.
+// Помимо ns/op сообщает перцентили задержки вставки, число ошибок и ожиданий свободного соединения пула.
+// Запуск: go test -tags integration -run '^$' -bench InsertOrderConcurrent ./pkg/client/postgres/
+func BenchmarkInsertOrderConcurrent(b *testing.B) {
+	pool := newIntegrationPool(b)
+	g := testorders.NewGenerator(time.Now().UnixNano())
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			ctx := context.Background()
+			list := make([]orders.Order, b.N)
+			uids := make([]string, b.N)
+			for i := range list {
+				list[i] = g.Order(testorders.ScenarioDefault)
+				uids[i] = list[i].OrderUid
+			}
+			b.Cleanup(func() {
+				for _, table := range []string{"items", "payment", "delivery", "raw_payloads", "orders"} {
+					if _, err := pool.Exec(ctx, `DELETE FROM `+table+` WHERE order_uid = ANY($1)`, uids); err != nil {
+						b.Errorf("cleanup %s: %v", table, err)
+					}
+				}
+			})
+
+			latencies := make([]time.Duration, b.N)
+			var next, failed atomic.Int64
+			before := pool.Stat()
+
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						i := int(next.Add(1)) - 1
+						if i >= len(list) {
+							return
+						}
+						start := time.Now()
+						if err := postgres.InsertOrder(ctx, pool, tenant.Default, &list[i], nil); err != nil {
+							failed.Add(1)
+						}
+						latencies[i] = time.Since(start)
+					}
+				}()
+			}
+			wg.Wait()
+			b.StopTimer()
+
+			after := pool.Stat()
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			b.ReportMetric(float64(percentile(latencies, 0.50).Microseconds()), "p50-µs")
+			b.ReportMetric(float64(percentile(latencies, 0.99).Microseconds()), "p99-µs")
+			b.ReportMetric(float64(failed.Load()), "errors")
+			b.ReportMetric(float64(after.EmptyAcquireCount()-before.EmptyAcquireCount()), "pool-waits")
+			b.ReportMetric(float64((after.AcquireDuration()-before.AcquireDuration()).Microseconds())/float64(b.N), "acquire-µs/op")
+		})
+	}
+}
+
+// percentile - значение перцентиля p (0..1) в отсортированном списке задержек
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
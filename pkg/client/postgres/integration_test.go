@@ -0,0 +1,1237 @@
+package postgres_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/config"
+	"l0_test_self/internal/crypto"
+	"l0_test_self/internal/ids"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/internal/validation"
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/client/postgres"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newIntegrationPool - подключается к базе данных из config.yaml и применяет изменения схемы
+func newIntegrationPool(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	cfg, err := config.Load("../../../config.yaml")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	pool, err := postgres.NewClient(ctx, cfg.Database.ToPostgresConfig(), 1)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	require.NoError(t, postgres.EnsureSchema(ctx, pool))
+	return pool
+}
+
+// deleteOrder - удаляет тестовый заказ со всеми связанными строками
+func deleteOrder(t testing.TB, pool *pgxpool.Pool, uid string) {
+	t.Helper()
+	for _, table := range []string{"items", "payment", "delivery", "delivery_history", "raw_payloads", "order_audit", "orders"} {
+		_, err := pool.Exec(context.Background(), `DELETE FROM `+table+` WHERE order_uid = $1`, uid)
+		assert.NoError(t, err, table)
+	}
+}
+
+func TestPaymentsRoundTrip(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	g := testorders.NewGenerator(time.Now().UnixNano())
+
+	for _, count := range []int{0, 1, 2} {
+		t.Run(fmt.Sprintf("%d payments", count), func(t *testing.T) {
+			order := g.Order(testorders.ScenarioDefault)
+			order.DateCreated = order.DateCreated.UTC().Truncate(time.Microsecond)
+			primary := order.Payments[0]
+			order.Payments = nil
+			for i := 0; i < count; i++ {
+				p := primary
+				p.Transaction = fmt.Sprintf("%s-%d", order.OrderUid, i)
+				p.PaymentDt = primary.PaymentDt + i
+				order.Payments = append(order.Payments, p)
+			}
+			t.Cleanup(func() { deleteOrder(t, pool, order.OrderUid) })
+
+			require.NoError(t, postgres.InsertOrder(ctx, pool, tenant.Default, &order, nil))
+
+			got, err := postgres.GetOrderByUID(ctx, pool, tenant.Default, order.OrderUid)
+			require.NoError(t, err)
+			assert.Equal(t, order.Payments, got.Payments)
+			if count == 0 {
+				assert.Nil(t, got.Payment())
+			} else {
+				assert.Equal(t, order.Payments[0], *got.Payment())
+			}
+
+			page, err := postgres.ListOrdersAfter(ctx, pool, tenant.Default, nil, order.DateCreated, order.DateCreated.Add(time.Microsecond), 100, postgres.IncludeAll, "")
+			require.NoError(t, err)
+			for _, o := range page {
+				if o.OrderUid == order.OrderUid {
+					assert.Equal(t, order.Payments, o.Payments)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyReservation(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	key := fmt.Sprintf("test-key-%d", time.Now().UnixNano())
+	t.Cleanup(func() { _, _ = pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE key = $1`, key) })
+	expiredBefore := time.Now().Add(-time.Hour)
+
+	rec, reserved, err := postgres.ReserveIdempotencyKey(ctx, pool, tenant.Default, key, "hash-1", expiredBefore)
+	require.NoError(t, err)
+	require.True(t, reserved)
+
+	got, reserved, err := postgres.ReserveIdempotencyKey(ctx, pool, tenant.Default, key, "hash-1", expiredBefore)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Zero(t, got.Status, "reservation is still in progress")
+
+	rec.OrderUid, rec.Status, rec.Response = "order-1", 201, []byte(`{"order_uid":"order-1"}`)
+	require.NoError(t, postgres.CompleteIdempotencyKey(ctx, pool, rec))
+	got, reserved, err = postgres.ReserveIdempotencyKey(ctx, pool, tenant.Default, key, "hash-2", expiredBefore)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Equal(t, "hash-1", got.RequestHash)
+	assert.Equal(t, rec.Response, got.Response)
+
+	// Запись старше expiredBefore заменяется новой резервацией
+	_, reserved, err = postgres.ReserveIdempotencyKey(ctx, pool, tenant.Default, key, "hash-2", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, reserved)
+}
+
+func TestItemStatusRoundTrip(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+
+	order := testorders.NewGenerator(time.Now().UnixNano()).Order(testorders.ScenarioDefault)
+	order.Items[0].Status = orders.ItemStatusReturned
+	order.Items = append(order.Items, order.Items[0])
+	order.Items[1].ChrtId++
+	order.Items[1].Status = 999
+	t.Cleanup(func() { deleteOrder(t, pool, order.OrderUid) })
+	require.NoError(t, postgres.InsertOrder(ctx, pool, tenant.Default, &order, nil))
+
+	got, err := postgres.GetOrderByUID(ctx, pool, tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+	statuses := map[int]orders.ItemStatus{}
+	for _, item := range got.Items {
+		statuses[item.ChrtId] = item.Status
+	}
+	assert.Equal(t, orders.ItemStatusReturned, statuses[order.Items[0].ChrtId])
+	assert.Equal(t, orders.ItemStatus(999), statuses[order.Items[1].ChrtId])
+}
+
+func TestQuarantinedOrdersExcludedFromListings(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	g := testorders.NewGenerator(time.Now().UnixNano())
+
+	track := fmt.Sprintf("QUARANTINE-%d", time.Now().UnixNano())
+	normal, quarantined := g.Order(testorders.ScenarioDefault), g.Order(testorders.ScenarioDefault)
+	normal.TrackNumber, quarantined.TrackNumber = track, track
+	quarantined.Quarantined = true
+	for _, o := range []*orders.Order{&normal, &quarantined} {
+		o.DateCreated = o.DateCreated.UTC().Truncate(time.Microsecond)
+		uid := o.OrderUid
+		t.Cleanup(func() { deleteOrder(t, pool, uid) })
+		require.NoError(t, postgres.InsertOrder(ctx, pool, tenant.Default, o, nil))
+	}
+
+	got, err := postgres.GetOrderByUID(ctx, pool, tenant.Default, quarantined.OrderUid)
+	require.NoError(t, err)
+	assert.True(t, got.Quarantined, "quarantined orders stay readable by id")
+
+	found, err := postgres.FindOrdersByTrackNumber(ctx, pool, tenant.Default, track, "", nil, 0, postgres.IncludeAll, "")
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, normal.OrderUid, found[0].OrderUid)
+
+	page, err := postgres.ListOrdersAfter(ctx, pool, tenant.Default, nil, quarantined.DateCreated, quarantined.DateCreated.Add(time.Microsecond), 100, postgres.IncludeAll, "")
+	require.NoError(t, err)
+	for _, o := range page {
+		assert.NotEqual(t, quarantined.OrderUid, o.OrderUid)
+	}
+}
+
+func TestUpsertOrderBookkeeping(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	g := testorders.NewGenerator(time.Now().UnixNano())
+
+	order := g.Order(testorders.ScenarioDefault)
+	order.StoredAt = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC) // значение из сообщения не сохраняется
+	t.Cleanup(func() { deleteOrder(t, pool, order.OrderUid) })
+	require.NoError(t, postgres.InsertOrder(ctx, pool, tenant.Default, &order, nil))
+	require.WithinDuration(t, time.Now(), order.StoredAt, time.Minute)
+	assert.True(t, order.StoredAt.Equal(order.UpdatedAt))
+
+	stored, err := postgres.GetOrderByUID(ctx, pool, tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+	assert.True(t, order.StoredAt.Equal(stored.StoredAt))
+	assert.True(t, order.UpdatedAt.Equal(stored.UpdatedAt))
+
+	changed := order
+	changed.Entry = "UPDATED"
+	changed.Items = changed.Items[:1]
+	created, err := postgres.UpsertOrder(ctx, pool, tenant.Default, &changed)
+	require.NoError(t, err)
+	assert.False(t, created)
+
+	got, err := postgres.GetOrderByUID(ctx, pool, tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+	assert.Equal(t, "UPDATED", got.Entry)
+	assert.Len(t, got.Items, 1)
+	assert.True(t, got.StoredAt.Equal(stored.StoredAt), "created_at does not change on upsert")
+	assert.True(t, got.UpdatedAt.After(stored.UpdatedAt), "updated_at advances on upsert")
+	assert.True(t, got.UpdatedAt.Equal(changed.UpdatedAt))
+
+	fresh := g.Order(testorders.ScenarioDefault)
+	fresh.TrackNumber = order.TrackNumber
+	t.Cleanup(func() { deleteOrder(t, pool, fresh.OrderUid) })
+	created, err = postgres.UpsertOrder(ctx, pool, tenant.Default, &fresh)
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	// fresh сохранён позже order, но order изменён ещё позже
+	_, err = postgres.UpsertOrder(ctx, pool, tenant.Default, &changed)
+	require.NoError(t, err)
+	for sortBy, want := range map[string][]string{
+		postgres.SortStoredAt:  {order.OrderUid, fresh.OrderUid},
+		postgres.SortUpdatedAt: {fresh.OrderUid, order.OrderUid},
+	} {
+		found, err := postgres.FindOrdersByTrackNumber(ctx, pool, tenant.Default, order.TrackNumber, sortBy, nil, 0, postgres.IncludeAll, "")
+		require.NoError(t, err)
+		require.Len(t, found, 2)
+		assert.Equal(t, want, []string{found[0].OrderUid, found[1].OrderUid}, sortBy)
+	}
+
+	_, err = postgres.FindOrdersByTrackNumber(ctx, pool, tenant.Default, order.TrackNumber, "price", nil, 0, postgres.IncludeAll, "")
+	assert.Error(t, err)
+
+	// Постраничная выдача по курсору последнего заказа страницы
+	first, err := postgres.FindOrdersByTrackNumber(ctx, pool, tenant.Default, order.TrackNumber, postgres.SortUpdatedAt, nil, 1, postgres.IncludeAll, "")
+	require.NoError(t, err)
+	require.Len(t, first, 1)
+	after := &postgres.SortCursor{Value: postgres.SortValue(first[0], postgres.SortUpdatedAt), OrderUid: first[0].OrderUid}
+	second, err := postgres.FindOrdersByTrackNumber(ctx, pool, tenant.Default, order.TrackNumber, postgres.SortUpdatedAt, after, 1, postgres.IncludeAll, "")
+	require.NoError(t, err)
+	require.Len(t, second, 1)
+	assert.Equal(t, []string{fresh.OrderUid, order.OrderUid}, []string{first[0].OrderUid, second[0].OrderUid})
+	rest, err := postgres.FindOrdersByTrackNumber(ctx, pool, tenant.Default, order.TrackNumber, postgres.SortUpdatedAt,
+		&postgres.SortCursor{Value: second[0].UpdatedAt, OrderUid: second[0].OrderUid}, 1, postgres.IncludeAll, "")
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+}
+
+func TestFindOrdersByCustomerPages(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	g := testorders.NewGenerator(time.Now().UnixNano())
+	customer := fmt.Sprintf("customer-%d", time.Now().UnixNano())
+	base := time.Now().UTC().Truncate(time.Second)
+
+	var want []string
+	for i := 0; i < 3; i++ {
+		o := g.Order(testorders.ScenarioDefault)
+		o.CustomerId = customer
+		o.DateCreated = base.Add(time.Duration(i) * time.Minute)
+		uid := o.OrderUid
+		t.Cleanup(func() { deleteOrder(t, pool, uid) })
+		require.NoError(t, postgres.InsertOrder(ctx, pool, tenant.Default, &o, nil))
+		want = append(want, uid)
+	}
+	other := g.Order(testorders.ScenarioDefault)
+	other.CustomerId = customer
+	t.Cleanup(func() { deleteOrder(t, pool, other.OrderUid) })
+	require.NoError(t, postgres.InsertOrder(ctx, pool, "market-b", &other, nil))
+
+	first, err := postgres.FindOrdersByCustomer(ctx, pool, tenant.Default, customer, "", nil, 2, postgres.IncludeNone)
+	require.NoError(t, err)
+	require.Len(t, first, 2)
+	assert.Empty(t, first[0].Items, "sections are not loaded")
+	last := first[1]
+	rest, err := postgres.FindOrdersByCustomer(ctx, pool, tenant.Default, customer, postgres.SortDateCreated,
+		&postgres.SortCursor{Value: last.DateCreated, OrderUid: last.OrderUid}, 2, postgres.IncludeAll)
+	require.NoError(t, err)
+	require.Len(t, rest, 1, "orders of other tenants are not listed")
+	assert.NotEmpty(t, rest[0].Items)
+	assert.Equal(t, want, []string{first[0].OrderUid, first[1].OrderUid, rest[0].OrderUid})
+}
+
+// newTestKeyring - набор ключей шифрования из байтов-заполнителей ключей
+func newTestKeyring(t *testing.T, active string, keys map[string]byte) *crypto.Keyring {
+	t.Helper()
+	m := make(map[string][]byte, len(keys))
+	for id, b := range keys {
+		m[id] = bytes.Repeat([]byte{b}, crypto.KeySize)
+	}
+	kr, err := crypto.NewKeyring(m, active)
+	require.NoError(t, err)
+	return kr
+}
+
+// rawDeliveryPII - телефон и email доставки в том виде, в котором они хранятся в базе
+func rawDeliveryPII(t *testing.T, db postgres.Client, uid string) (phone, email string) {
+	t.Helper()
+	require.NoError(t, db.QueryRow(context.Background(), `SELECT phone, email FROM delivery WHERE order_uid = $1`, uid).Scan(&phone, &email))
+	return phone, email
+}
+
+func TestDeliveryPIIEncryptionRoundTrip(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	postgres.SetFieldEncryption(newTestKeyring(t, "k1", map[string]byte{"k1": 1}))
+	t.Cleanup(func() { postgres.SetFieldEncryption(nil) })
+
+	order := testorders.NewGenerator(time.Now().UnixNano()).Order(testorders.ScenarioDefault)
+	t.Cleanup(func() { deleteOrder(t, pool, order.OrderUid) })
+	require.NoError(t, postgres.InsertOrder(ctx, pool, tenant.Default, &order, nil))
+
+	phone, email := rawDeliveryPII(t, pool, order.OrderUid)
+	assert.Equal(t, "k1", crypto.KeyID(phone))
+	assert.Equal(t, "k1", crypto.KeyID(email))
+
+	got, err := postgres.GetOrderByUID(ctx, pool, tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+	assert.Equal(t, order.Delivery, got.Delivery)
+
+	// Без ключей зашифрованные значения не читаются
+	postgres.SetFieldEncryption(nil)
+	_, err = postgres.GetOrderByUID(ctx, pool, tenant.Default, order.OrderUid)
+	assert.ErrorIs(t, err, crypto.ErrNoKeyring)
+}
+
+func TestEncryptDeliveryPIIMigratesPlaintextRows(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	g := testorders.NewGenerator(time.Now().UnixNano())
+
+	// Заказы записываются открытым текстом, как до включения шифрования
+	postgres.SetFieldEncryption(nil)
+	seeded := make(map[string]orders.Delivery)
+	var uids []string
+	for i := 0; i < 5; i++ {
+		o := g.Order(testorders.ScenarioDefault)
+		uid := o.OrderUid
+		t.Cleanup(func() { deleteOrder(t, pool, uid) })
+		require.NoError(t, postgres.InsertOrder(ctx, pool, tenant.Default, &o, nil))
+		seeded[uid] = o.Delivery
+		uids = append(uids, uid)
+	}
+
+	// Проход выполняется в транзакции, которая откатывается, и видит только засеянные строки
+	tx, err := pool.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(ctx, `DELETE FROM delivery WHERE order_uid <> ALL($1)`, uids)
+	require.NoError(t, err)
+
+	k1 := newTestKeyring(t, "k1", map[string]byte{"k1": 1})
+	var batches int
+	total, err := postgres.EncryptDeliveryPII(ctx, tx, k1, 2, func(postgres.EncryptionProgress) { batches++ })
+	require.NoError(t, err)
+	assert.Equal(t, postgres.EncryptionProgress{Scanned: 5, Encrypted: 5, LastTenant: tenant.Default, LastUID: total.LastUID}, total)
+	assert.Equal(t, 3, batches)
+
+	check := func(kr *crypto.Keyring, keyID string) {
+		t.Helper()
+		for uid, d := range seeded {
+			phone, email := rawDeliveryPII(t, tx, uid)
+			assert.Equal(t, keyID, crypto.KeyID(phone), uid)
+			assert.Equal(t, keyID, crypto.KeyID(email), uid)
+			plain, err := kr.Decrypt(phone)
+			require.NoError(t, err)
+			assert.Equal(t, d.Phone, plain)
+			plain, err = kr.Decrypt(email)
+			require.NoError(t, err)
+			assert.Equal(t, d.Email, plain)
+		}
+	}
+	check(k1, "k1")
+
+	// Повторный проход ничего не меняет
+	total, err = postgres.EncryptDeliveryPII(ctx, tx, k1, 2, nil)
+	require.NoError(t, err)
+	assert.Zero(t, total.Encrypted)
+
+	// После ротации значения перешифровываются новым ключом
+	rotated := newTestKeyring(t, "k2", map[string]byte{"k1": 1, "k2": 2})
+	total, err = postgres.EncryptDeliveryPII(ctx, tx, rotated, 10, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 5, total.Encrypted)
+	check(rotated, "k2")
+
+	// Проверка при запуске отвергает отсутствующие и неверные ключи
+	require.NoError(t, postgres.VerifyFieldEncryption(ctx, tx, rotated))
+	assert.ErrorIs(t, postgres.VerifyFieldEncryption(ctx, tx, nil), crypto.ErrNoKeyring)
+	assert.ErrorIs(t, postgres.VerifyFieldEncryption(ctx, tx, k1), crypto.ErrUnknownKey)
+	assert.ErrorIs(t, postgres.VerifyFieldEncryption(ctx, tx, newTestKeyring(t, "k2", map[string]byte{"k2": 9})), crypto.ErrDecrypt)
+}
+
+func TestNormalizeTrackNumbersMigratesExistingRows(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	g := testorders.NewGenerator(time.Now().UnixNano())
+
+	// Заказы записаны до нормализации при приёме: трек-номера в разном регистре и с пробелами
+	tracks := []string{"wbMixedCase01", " WBSPACED0002 ", "WBALREADY0003"}
+	var uids []string
+	for _, track := range tracks {
+		o := g.Order(testorders.ScenarioDefault)
+		o.TrackNumber = track
+		for i := range o.Items {
+			o.Items[i].TrackNumber = track
+		}
+		uid := o.OrderUid
+		t.Cleanup(func() { deleteOrder(t, pool, uid) })
+		require.NoError(t, postgres.InsertOrder(ctx, pool, tenant.Default, &o, nil))
+		uids = append(uids, uid)
+	}
+
+	// Проход выполняется в транзакции, которая откатывается, и видит только засеянные заказы
+	tx, err := pool.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(ctx, `DELETE FROM orders WHERE order_uid <> ALL($1)`, uids)
+	require.NoError(t, err)
+	var items int
+	require.NoError(t, tx.QueryRow(ctx, `SELECT count(*) FROM items WHERE order_uid = ANY($1) AND track_number <> upper(trim(track_number))`, uids).Scan(&items))
+
+	total, err := postgres.NormalizeTrackNumbers(ctx, tx, validation.NormalizeTrackNumber, 2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, total.Scanned)
+	assert.Equal(t, 2, total.Orders)
+	assert.Equal(t, items, total.Items)
+
+	// Поиск по трек-номеру в другом регистре после нормализации запроса находит заказ
+	var found string
+	require.NoError(t, tx.QueryRow(ctx, `SELECT order_uid FROM orders WHERE tenant_id = $1 AND track_number = $2`,
+		tenant.Default, validation.NormalizeTrackNumber("WBmixedcase01")).Scan(&found))
+	assert.Equal(t, uids[0], found)
+
+	// Повторный проход ничего не меняет
+	total, err = postgres.NormalizeTrackNumbers(ctx, tx, validation.NormalizeTrackNumber, 2, nil)
+	require.NoError(t, err)
+	assert.Zero(t, total.Orders)
+	assert.Zero(t, total.Items)
+}
+
+func TestCheckSchemaAfterEnsureSchema(t *testing.T) {
+	pool := newIntegrationPool(t)
+
+	report, err := postgres.CheckSchema(context.Background(), pool)
+	require.NoError(t, err)
+	assert.Empty(t, report.Missing)
+	assert.Empty(t, report.Pending)
+}
+
+func TestOrderSectionsReferenceOrdersAfterEnsureSchema(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	// Повторное применение не создаёт ключи второй раз
+	require.NoError(t, postgres.EnsureSchema(ctx, pool))
+
+	for _, table := range []string{"delivery", "payment", "items"} {
+		var columns, onDelete string
+		err := pool.QueryRow(ctx, `SELECT string_agg(a.attname, ',' ORDER BY k.ord), c.confdeltype::text
+			FROM pg_constraint c
+			CROSS JOIN LATERAL unnest(c.conkey) WITH ORDINALITY AS k(attnum, ord)
+			JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+			WHERE c.conrelid = $1::regclass AND c.contype = 'f' AND c.confrelid = 'orders'::regclass
+			GROUP BY c.conname, c.confdeltype`, table).Scan(&columns, &onDelete)
+		require.NoError(t, err, table)
+		assert.Equal(t, "tenant_id,order_uid", columns, table)
+		assert.Equal(t, "c", onDelete, "%s rows are deleted with the order", table)
+	}
+
+	order := testorders.NewGenerator(time.Now().UnixNano()).Order(testorders.ScenarioDefault)
+	t.Cleanup(func() { deleteOrder(t, pool, order.OrderUid) })
+	require.NoError(t, postgres.InsertOrder(ctx, pool, tenant.Default, &order, nil))
+
+	// Раздел не может ссылаться на заказ другого арендатора
+	_, err := pool.Exec(ctx, `INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email, tenant_id)
+		VALUES ($1, '', '', '', '', '', '', '', 'market-b')`, order.OrderUid)
+	var pgErr *pgconn.PgError
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "23503", pgErr.Code)
+
+	_, err = pool.Exec(ctx, `DELETE FROM orders WHERE tenant_id = $1 AND order_uid = $2`, tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+	for _, table := range []string{"delivery", "payment", "items"} {
+		var n int
+		require.NoError(t, pool.QueryRow(ctx, `SELECT count(*) FROM `+table+` WHERE tenant_id = $1 AND order_uid = $2`, tenant.Default, order.OrderUid).Scan(&n))
+		assert.Zero(t, n, table)
+	}
+}
+
+func TestEnsureSchemaRefusesOrphanSections(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	uid := fmt.Sprintf("orphan-%d", time.Now().UnixNano())
+
+	// Строка доставки без заказа, записанная, пока внешнего ключа не было
+	_, err := pool.Exec(ctx, `ALTER TABLE delivery DROP CONSTRAINT delivery_tenant_order_fkey`)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = pool.Exec(context.Background(), `DELETE FROM delivery WHERE order_uid = $1`, uid)
+		assert.NoError(t, postgres.EnsureSchema(context.Background(), pool), "the foreign key is restored")
+	})
+	_, err = pool.Exec(ctx, `INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email, tenant_id)
+		VALUES ($1, '', '', '', '', '', '', '', $2)`, uid, tenant.Default)
+	require.NoError(t, err)
+
+	err = postgres.EnsureSchema(ctx, pool)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "table delivery has 1 rows without an order")
+	var n int
+	require.NoError(t, pool.QueryRow(ctx, `SELECT count(*) FROM delivery WHERE order_uid = $1`, uid).Scan(&n))
+	assert.Equal(t, 1, n, "orphan rows are not deleted")
+}
+
+func TestRecordLatenciesKeepsLatestValue(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	uid := fmt.Sprintf("latency-%d", time.Now().UnixNano())
+	t.Cleanup(func() { deleteOrder(t, pool, uid) })
+
+	_, err := postgres.GetOrderLatency(ctx, pool, tenant.Default, uid)
+	require.ErrorIs(t, err, postgres.ErrOrderNotFound)
+
+	first := time.Now().UTC().Truncate(time.Microsecond)
+	require.NoError(t, postgres.RecordLatencies(ctx, pool, tenant.Default, []postgres.LatencyRecord{
+		{OrderUid: uid, Latency: 120 * time.Millisecond, MeasuredAt: first},
+		// повтор заказа в одной пачке: сохраняется последнее значение
+		{OrderUid: uid, Latency: 80 * time.Millisecond, MeasuredAt: first.Add(time.Millisecond)},
+	}))
+	rec, err := postgres.GetOrderLatency(ctx, pool, tenant.Default, uid)
+	require.NoError(t, err)
+	assert.Equal(t, 80*time.Millisecond, rec.Latency)
+
+	require.NoError(t, postgres.RecordLatencies(ctx, pool, tenant.Default, []postgres.LatencyRecord{
+		{OrderUid: uid, Latency: 3 * time.Second, MeasuredAt: first.Add(time.Second)},
+	}))
+	rec, err = postgres.GetOrderLatency(ctx, pool, tenant.Default, uid)
+	require.NoError(t, err)
+	assert.Equal(t, 3*time.Second, rec.Latency)
+	assert.True(t, first.Add(time.Second).Equal(rec.MeasuredAt))
+}
+
+func TestRecordMessageAttemptCounts(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	key := postgres.MessageKey{Topic: fmt.Sprintf("attempts-%d", time.Now().UnixNano()), Partition: 3, Offset: 42}
+	other := postgres.MessageKey{Topic: key.Topic, Partition: 3, Offset: 43}
+	t.Cleanup(func() {
+		_ = postgres.ClearMessageAttempts(context.Background(), pool, []postgres.MessageKey{key, other})
+	})
+
+	for want := 1; want <= 3; want++ {
+		n, err := postgres.RecordMessageAttempt(ctx, pool, key, "order-1", "constraint violated")
+		require.NoError(t, err)
+		assert.Equal(t, want, n)
+	}
+	n, err := postgres.RecordMessageAttempt(ctx, pool, other, "order-2", "constraint violated")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "attempts are counted per message")
+
+	require.NoError(t, postgres.ClearMessageAttempts(ctx, pool, []postgres.MessageKey{key}))
+	n, err = postgres.RecordMessageAttempt(ctx, pool, key, "order-1", "constraint violated")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "cleared counter starts over")
+	n, err = postgres.RecordMessageAttempt(ctx, pool, other, "order-2", "constraint violated")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestRecordWebhookFailure(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	uid := fmt.Sprintf("webhook-%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		_, _ = pool.Exec(context.Background(), `DELETE FROM webhook_failures WHERE order_uid = $1`, uid)
+	})
+
+	failedAt := time.Now().UTC().Truncate(time.Microsecond)
+	require.NoError(t, postgres.RecordWebhookFailure(ctx, pool, postgres.WebhookFailure{
+		Tenant: tenant.Default, OrderUid: uid, Event: "order.stored", Endpoint: "https://example.com/hook",
+		Attempts: 5, LastError: "HTTP 503", FailedAt: failedAt,
+	}))
+	var attempts int
+	var lastError string
+	var at time.Time
+	require.NoError(t, pool.QueryRow(ctx, `SELECT attempts, last_error, failed_at FROM webhook_failures WHERE tenant_id = $1 AND order_uid = $2`,
+		tenant.Default, uid).Scan(&attempts, &lastError, &at))
+	assert.Equal(t, 5, attempts)
+	assert.Equal(t, "HTTP 503", lastError)
+	assert.True(t, failedAt.Equal(at))
+
+	assert.Error(t, postgres.RecordWebhookFailure(ctx, pool, postgres.WebhookFailure{Tenant: "", OrderUid: uid}), "tenant is validated")
+}
+
+func TestCheckpointsSaveAndLoad(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	name := fmt.Sprintf("replay-%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		_, _ = pool.Exec(context.Background(), `DELETE FROM checkpoints WHERE reader_name = $1`, name)
+	})
+
+	offsets, err := postgres.LoadCheckpoints(ctx, pool, name, "orders")
+	require.NoError(t, err)
+	assert.Empty(t, offsets)
+
+	now := time.Now()
+	require.NoError(t, postgres.SaveCheckpoint(ctx, pool, postgres.Checkpoint{Reader: name, Topic: "orders", Partition: 0, Offset: 10, UpdatedAt: now}))
+	require.NoError(t, postgres.SaveCheckpoint(ctx, pool, postgres.Checkpoint{Reader: name, Topic: "orders", Partition: 1, Offset: 5, UpdatedAt: now}))
+	require.NoError(t, postgres.SaveCheckpoint(ctx, pool, postgres.Checkpoint{Reader: name, Topic: "orders", Partition: 0, Offset: 25, UpdatedAt: now}))
+	require.NoError(t, postgres.SaveCheckpoint(ctx, pool, postgres.Checkpoint{Reader: name, Topic: "other", Partition: 0, Offset: 99, UpdatedAt: now}))
+
+	offsets, err = postgres.LoadCheckpoints(ctx, pool, name, "orders")
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{0: 25, 1: 5}, offsets)
+}
+
+func TestOrderHeadersLoadSelectedSections(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	g := testorders.NewGenerator(time.Now().UnixNano())
+
+	order := g.Order(testorders.ScenarioDefault)
+	t.Cleanup(func() { deleteOrder(t, pool, order.OrderUid) })
+	require.NoError(t, postgres.InsertOrder(ctx, pool, tenant.Default, &order, nil))
+	full, err := postgres.GetOrderByUID(ctx, pool, tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+
+	header, err := postgres.GetOrderHeader(ctx, pool, tenant.Default, order.OrderUid, postgres.IncludeNone)
+	require.NoError(t, err)
+	assert.Equal(t, full.TrackNumber, header.TrackNumber)
+	assert.Zero(t, header.Delivery)
+	assert.Nil(t, header.Payments)
+	assert.Nil(t, header.Items)
+	assert.Equal(t, orders.AllSections, header.Omitted)
+
+	withItems, err := postgres.GetOrderHeader(ctx, pool, tenant.Default, order.OrderUid, postgres.IncludeItems)
+	require.NoError(t, err)
+	assert.Equal(t, full.Items, withItems.Items)
+	assert.Zero(t, withItems.Delivery)
+	assert.Nil(t, withItems.Payments)
+	assert.Equal(t, orders.SectionDelivery|orders.SectionPayments, withItems.Omitted)
+
+	list, err := postgres.GetOrderHeaders(ctx, pool, tenant.Default, []string{order.OrderUid, "missing-" + order.OrderUid}, postgres.IncludeAll)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, full, list[0])
+
+	_, err = postgres.GetOrderHeader(ctx, pool, tenant.Default, "missing-"+order.OrderUid, postgres.IncludeNone)
+	assert.ErrorIs(t, err, postgres.ErrOrderNotFound)
+}
+
+func TestTenantsWithSameOrderUIDAreIsolated(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	g := testorders.NewGenerator(time.Now().UnixNano())
+
+	a := g.Order(testorders.ScenarioDefault)
+	a.DateCreated = a.DateCreated.UTC().Truncate(time.Microsecond)
+	b := g.Order(testorders.ScenarioDefault)
+	b.OrderUid, b.TrackNumber, b.DateCreated = a.OrderUid, a.TrackNumber, a.DateCreated
+	b.Delivery.Name = "Tenant B"
+	t.Cleanup(func() { deleteOrder(t, pool, a.OrderUid) })
+
+	require.NoError(t, postgres.InsertOrder(ctx, pool, "market-a", &a, &postgres.RawPayload{OrderUid: a.OrderUid, Payload: []byte(`"a"`), ReceivedAt: time.Now()}))
+	require.NoError(t, postgres.InsertOrder(ctx, pool, "market-b", &b, &postgres.RawPayload{OrderUid: b.OrderUid, Payload: []byte(`"b"`), ReceivedAt: time.Now()}))
+	err := postgres.InsertOrder(ctx, pool, "market-a", &a, nil)
+	assert.ErrorIs(t, err, postgres.ErrOrderExists)
+
+	gotA, err := postgres.GetOrderByUID(ctx, pool, "market-a", a.OrderUid)
+	require.NoError(t, err)
+	assert.Equal(t, a.Delivery.Name, gotA.Delivery.Name)
+	assert.Equal(t, a.Items, gotA.Items)
+	gotB, err := postgres.GetOrderByUID(ctx, pool, "market-b", a.OrderUid)
+	require.NoError(t, err)
+	assert.Equal(t, "Tenant B", gotB.Delivery.Name)
+	assert.Equal(t, b.Items, gotB.Items)
+	_, err = postgres.GetOrderByUID(ctx, pool, "market-c", a.OrderUid)
+	assert.ErrorIs(t, err, postgres.ErrOrderNotFound)
+
+	rawB, err := postgres.GetRawPayload(ctx, pool, "market-b", a.OrderUid)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(`"b"`), rawB.Payload)
+
+	found, err := postgres.FindOrdersByTrackNumber(ctx, pool, "market-a", a.TrackNumber, "", nil, 0, postgres.IncludeAll, "")
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, a.Delivery.Name, found[0].Delivery.Name)
+
+	// Замена заказа одного арендатора не затрагивает заказ другого
+	b.Delivery.Name = "Tenant B updated"
+	created, err := postgres.UpsertOrder(ctx, pool, "market-b", &b)
+	require.NoError(t, err)
+	assert.False(t, created)
+	gotA, err = postgres.GetOrderByUID(ctx, pool, "market-a", a.OrderUid)
+	require.NoError(t, err)
+	assert.Equal(t, a.Delivery.Name, gotA.Delivery.Name)
+	assert.Equal(t, a.Items, gotA.Items)
+}
+
+func TestExistsOrder(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	order := testorders.NewGenerator(time.Now().UnixNano()).Order(testorders.ScenarioDefault)
+	t.Cleanup(func() { deleteOrder(t, pool, order.OrderUid) })
+
+	exists, err := postgres.ExistsOrder(ctx, pool, tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	require.NoError(t, postgres.InsertOrder(ctx, pool, tenant.Default, &order, nil))
+	exists, err = postgres.ExistsOrder(ctx, pool, tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = postgres.ExistsOrder(ctx, pool, "market-b", order.OrderUid)
+	require.NoError(t, err)
+	assert.False(t, exists, "orders of other tenants are not visible")
+}
+
+func TestUpdateDeliveryOptimisticConcurrency(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	order := testorders.NewGenerator(time.Now().UnixNano()).Order(testorders.ScenarioDefault)
+	t.Cleanup(func() { deleteOrder(t, pool, order.OrderUid) })
+
+	_, err := postgres.UpdateDelivery(ctx, pool, tenant.Default, order.OrderUid, time.Now(), order.Delivery, "test")
+	require.ErrorIs(t, err, postgres.ErrOrderNotFound)
+
+	require.NoError(t, postgres.InsertOrder(ctx, pool, tenant.Default, &order, nil))
+	stored, err := postgres.GetOrderByUID(ctx, pool, tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+
+	d := stored.Delivery
+	d.City = "Haifa"
+	updatedAt, err := postgres.UpdateDelivery(ctx, pool, tenant.Default, order.OrderUid, stored.UpdatedAt, d, "test")
+	require.NoError(t, err)
+	assert.True(t, updatedAt.After(stored.UpdatedAt))
+
+	got, err := postgres.GetOrderByUID(ctx, pool, tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+	assert.Equal(t, d, got.Delivery)
+	assert.True(t, updatedAt.Equal(got.UpdatedAt))
+
+	// Повторное изменение с прочитанным ранее updated_at отклоняется
+	d.City = "Akko"
+	_, err = postgres.UpdateDelivery(ctx, pool, tenant.Default, order.OrderUid, stored.UpdatedAt, d, "test")
+	assert.ErrorIs(t, err, postgres.ErrConflict)
+	got, err = postgres.GetOrderByUID(ctx, pool, tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+	assert.Equal(t, "Haifa", got.Delivery.City)
+}
+
+func TestDeliveryHistoryRecordsChanges(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	order := testorders.NewGenerator(time.Now().UnixNano()).Order(testorders.ScenarioDefault)
+	t.Cleanup(func() { deleteOrder(t, pool, order.OrderUid) })
+	require.NoError(t, postgres.InsertOrder(ctx, pool, tenant.Default, &order, nil))
+
+	list, err := postgres.ListDeliveryHistory(ctx, pool, tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+	_, err = postgres.ListDeliveryHistory(ctx, pool, tenant.Default, "missing-"+order.OrderUid)
+	assert.ErrorIs(t, err, postgres.ErrOrderNotFound)
+
+	stored, err := postgres.GetOrderByUID(ctx, pool, tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+	first := stored.Delivery
+	second := first
+	second.City = "Haifa"
+	updatedAt, err := postgres.UpdateDelivery(ctx, pool, tenant.Default, order.OrderUid, stored.UpdatedAt, second, "key:alice")
+	require.NoError(t, err)
+	third := second
+	third.Zip = "3100000"
+	_, err = postgres.UpdateDelivery(ctx, pool, tenant.Default, order.OrderUid, updatedAt, third, "key:bob")
+	require.NoError(t, err)
+
+	// Замена заказа с той же доставкой историю не пополняет, а с другой — записывает её с автором ChangedByOrderUpdate
+	replaced := order
+	replaced.Delivery = third
+	_, err = postgres.UpsertOrder(ctx, pool, tenant.Default, &replaced)
+	require.NoError(t, err)
+	replaced.Delivery.City = "Akko"
+	_, err = postgres.UpsertOrder(ctx, pool, tenant.Default, &replaced)
+	require.NoError(t, err)
+
+	list, err = postgres.ListDeliveryHistory(ctx, pool, tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	assert.Equal(t, &first, list[0].Previous)
+	assert.Equal(t, "key:alice", list[0].ChangedBy)
+	assert.Equal(t, &second, list[1].Previous)
+	assert.Equal(t, "key:bob", list[1].ChangedBy)
+	assert.Equal(t, &third, list[2].Previous)
+	assert.Equal(t, postgres.ChangedByOrderUpdate, list[2].ChangedBy)
+
+	deleted, err := postgres.DeleteDeliveryHistoryBefore(ctx, pool, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, deleted, int64(3))
+	list, err = postgres.ListDeliveryHistory(ctx, pool, tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestMessageSkipsAddListDelete(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	topic := fmt.Sprintf("skips-%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		_, _ = pool.Exec(context.Background(), `DELETE FROM message_skips WHERE topic = $1`, topic)
+	})
+	ofTopic := func() []postgres.MessageSkip {
+		list, err := postgres.ListMessageSkips(ctx, pool)
+		require.NoError(t, err)
+		var out []postgres.MessageSkip
+		for _, s := range list {
+			if s.Key.Topic == topic {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	first := postgres.MessageKey{Topic: topic, Partition: 1, Offset: 7}
+	second := postgres.MessageKey{Topic: topic, Partition: 0, Offset: 3}
+	require.NoError(t, postgres.AddMessageSkip(ctx, pool, postgres.MessageSkip{Key: first, Reason: "bad", CreatedAt: now}))
+	require.NoError(t, postgres.AddMessageSkip(ctx, pool, postgres.MessageSkip{Key: second, CreatedAt: now}))
+	require.NoError(t, postgres.AddMessageSkip(ctx, pool, postgres.MessageSkip{Key: first, Reason: "worse", CreatedAt: now}))
+
+	list := ofTopic()
+	require.Len(t, list, 2)
+	assert.Equal(t, second, list[0].Key)
+	assert.Equal(t, first, list[1].Key)
+	assert.Equal(t, "worse", list[1].Reason, "repeated instruction replaces the reason")
+	assert.True(t, now.Equal(list[1].CreatedAt))
+
+	require.NoError(t, postgres.DeleteMessageSkip(ctx, pool, first))
+	require.NoError(t, postgres.DeleteMessageSkip(ctx, pool, first), "deleting a missing instruction is not an error")
+	list = ofTopic()
+	require.Len(t, list, 1)
+	assert.Equal(t, second, list[0].Key)
+}
+
+func TestMixedCaseOrderUIDReadAsLowercase(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	// Заказ, сохранённый до ids.Parse: идентификатор с буквами в верхнем регистре записывается как есть
+	legacy := testorders.NewGenerator(time.Now().UnixNano()).Order(testorders.ScenarioDefault)
+	legacy.OrderUid = "MiXeD-" + strings.ToUpper(legacy.OrderUid)
+	uid := ids.Normalize(legacy.OrderUid)
+	t.Cleanup(func() { deleteOrder(t, pool, legacy.OrderUid) })
+	require.NoError(t, postgres.InsertOrder(ctx, pool, tenant.Default, &legacy, nil))
+
+	for _, id := range []string{uid, legacy.OrderUid} {
+		got, err := postgres.GetOrderByUID(ctx, pool, tenant.Default, id)
+		require.NoError(t, err, id)
+		assert.Equal(t, uid, got.OrderUid)
+		assert.Equal(t, legacy.Delivery, got.Delivery)
+		assert.Len(t, got.Items, len(legacy.Items))
+
+		exists, err := postgres.ExistsOrder(ctx, pool, tenant.Default, id)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	}
+	headers, err := postgres.GetOrderHeaders(ctx, pool, tenant.Default, []string{uid}, postgres.IncludeAll)
+	require.NoError(t, err)
+	require.Len(t, headers, 1)
+	assert.Equal(t, uid, headers[0].OrderUid)
+
+	// Повторный приём того же заказа с нормализованным идентификатором не создаёт второй заказ
+	again := legacy
+	again.OrderUid = uid
+	assert.ErrorIs(t, postgres.InsertOrder(ctx, pool, tenant.Default, &again, nil), postgres.ErrOrderExists)
+	created, err := postgres.UpsertOrder(ctx, pool, tenant.Default, &again)
+	require.NoError(t, err)
+	assert.False(t, created, "legacy order is replaced under its stored uid")
+
+	stored, err := postgres.GetOrderByUID(ctx, pool, tenant.Default, uid)
+	require.NoError(t, err)
+	d := stored.Delivery
+	d.City = "Eilat"
+	_, err = postgres.UpdateDelivery(ctx, pool, tenant.Default, uid, stored.UpdatedAt, d, "test")
+	require.NoError(t, err)
+	got, err := postgres.GetOrderByUID(ctx, pool, tenant.Default, uid)
+	require.NoError(t, err)
+	assert.Equal(t, "Eilat", got.Delivery.City)
+}
+
+func TestOrderSectionsReadSeparately(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	g := testorders.NewGenerator(time.Now().UnixNano())
+	order := g.Order(testorders.ScenarioDefault)
+	bare := g.Order(testorders.ScenarioDefault)
+	bare.Payments, bare.Items = nil, nil
+	t.Cleanup(func() {
+		deleteOrder(t, pool, order.OrderUid)
+		deleteOrder(t, pool, bare.OrderUid)
+	})
+	require.NoError(t, postgres.InsertOrder(ctx, pool, tenant.Default, &order, nil))
+	require.NoError(t, postgres.InsertOrder(ctx, pool, tenant.Default, &bare, nil))
+	full, err := postgres.GetOrderByUID(ctx, pool, tenant.Default, order.OrderUid)
+	require.NoError(t, err)
+
+	id := strings.ToUpper(order.OrderUid)
+	d, err := postgres.GetDelivery(ctx, pool, tenant.Default, id)
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Equal(t, full.Delivery, *d)
+	payments, err := postgres.GetPayments(ctx, pool, tenant.Default, id)
+	require.NoError(t, err)
+	assert.Equal(t, full.Payments, payments)
+	items, err := postgres.GetItems(ctx, pool, tenant.Default, id)
+	require.NoError(t, err)
+	assert.Equal(t, full.Items, items)
+
+	// Пустой раздел существующего заказа — не ошибка
+	payments, err = postgres.GetPayments(ctx, pool, tenant.Default, bare.OrderUid)
+	require.NoError(t, err)
+	assert.Empty(t, payments)
+	items, err = postgres.GetItems(ctx, pool, tenant.Default, bare.OrderUid)
+	require.NoError(t, err)
+	assert.Empty(t, items)
+
+	_, err = postgres.GetDelivery(ctx, pool, "market-b", order.OrderUid)
+	assert.ErrorIs(t, err, postgres.ErrOrderNotFound, "orders of other tenants are not visible")
+	_, err = postgres.GetPayments(ctx, pool, tenant.Default, "missing-"+order.OrderUid)
+	assert.ErrorIs(t, err, postgres.ErrOrderNotFound)
+	_, err = postgres.GetItems(ctx, pool, tenant.Default, "missing-"+order.OrderUid)
+	assert.ErrorIs(t, err, postgres.ErrOrderNotFound)
+}
+
+func TestQueryTimeoutClassification(t *testing.T) {
+	newIntegrationPool(t)
+	cfg, err := config.Load("../../../config.yaml")
+	require.NoError(t, err)
+	dbCfg := cfg.Database.ToPostgresConfig()
+	dbCfg.SessionStatementTimeout = 200 * time.Millisecond
+	pool, err := postgres.NewClient(context.Background(), dbCfg, 1)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	sleep := func(ctx context.Context, seconds float64) error {
+		_, err := pool.Exec(ctx, `SELECT pg_sleep($1)`, seconds)
+		return postgres.ClassifyError(ctx, err)
+	}
+
+	// Дедлайн клиента раньше statement_timeout: запрос отменяет pgx
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = sleep(ctx, 1)
+	require.ErrorIs(t, err, postgres.ErrQueryTimeout)
+	assert.Contains(t, err.Error(), "client deadline")
+	assert.False(t, postgres.IsConnectionLost(err))
+
+	// Без дедлайна клиента выражение отменяет сервер по statement_timeout соединений пула
+	err = sleep(context.Background(), 1)
+	require.ErrorIs(t, err, postgres.ErrQueryTimeout)
+	assert.Contains(t, err.Error(), "statement_timeout")
+	var pgErr *pgconn.PgError
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "57014", pgErr.Code)
+
+	// Соединение после отмены остаётся рабочим, а быстрые запросы не затрагиваются
+	assert.NoError(t, sleep(context.Background(), 0.01))
+
+	// Отмена вызывающим — не истечение времени
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err = sleep(ctx, 1)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, postgres.ErrQueryTimeout)
+}
+
+func TestIncompleteOrders(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	g := testorders.NewGenerator(time.Now().UnixNano())
+	tenantID := fmt.Sprintf("incomplete-%d", time.Now().UnixNano())
+
+	complete, noItems, noDelivery, noPayments := g.Order(testorders.ScenarioDefault), g.Order(testorders.ScenarioDefault),
+		g.Order(testorders.ScenarioDefault), g.Order(testorders.ScenarioDefault)
+	noItems.Items = []orders.Item{}
+	noPayments.Payments = nil
+	for _, o := range []*orders.Order{&complete, &noItems, &noDelivery, &noPayments} {
+		uid := o.OrderUid
+		t.Cleanup(func() { deleteOrder(t, pool, uid) })
+		require.NoError(t, postgres.InsertOrder(ctx, pool, tenantID, o, nil))
+	}
+	_, err := pool.Exec(ctx, `DELETE FROM delivery WHERE tenant_id = $1 AND order_uid = $2`, tenantID, noDelivery.OrderUid)
+	require.NoError(t, err)
+
+	// Заказ без товаров читается с признаком items_missing и пустым списком товаров
+	got, err := postgres.GetOrderByUID(ctx, pool, tenantID, noItems.OrderUid)
+	require.NoError(t, err)
+	assert.True(t, got.ItemsMissing)
+	assert.Empty(t, got.Items)
+	got, err = postgres.GetOrderByUID(ctx, pool, tenantID, complete.OrderUid)
+	require.NoError(t, err)
+	assert.False(t, got.ItemsMissing)
+	headers, err := postgres.GetOrderHeaders(ctx, pool, tenantID, []string{noItems.OrderUid}, postgres.IncludeItems)
+	require.NoError(t, err)
+	require.Len(t, headers, 1)
+	assert.True(t, headers[0].ItemsMissing)
+
+	want := map[string]postgres.IncompleteOrder{
+		noItems.OrderUid:    {OrderUid: noItems.OrderUid, ItemsMissing: true},
+		noDelivery.OrderUid: {OrderUid: noDelivery.OrderUid, DeliveryMissing: true},
+		noPayments.OrderUid: {OrderUid: noPayments.OrderUid, PaymentMissing: true},
+	}
+	first, err := postgres.ListIncompleteOrders(ctx, pool, tenantID, "", 2)
+	require.NoError(t, err)
+	require.Len(t, first, 2)
+	rest, err := postgres.ListIncompleteOrders(ctx, pool, tenantID, first[1].OrderUid, 2)
+	require.NoError(t, err)
+	require.Len(t, rest, 1)
+	for _, o := range append(first, rest...) {
+		assert.Equal(t, want[o.OrderUid], o)
+	}
+
+	other, err := postgres.ListIncompleteOrders(ctx, pool, "market-c", "", 100)
+	require.NoError(t, err)
+	for _, o := range other {
+		assert.NotContains(t, want, o.OrderUid, "orders of other tenants are not reported")
+	}
+}
+
+func TestInsertOrderCommitHooks(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	g := testorders.NewGenerator(time.Now().UnixNano())
+
+	// Последний товар повторяет первичный ключ первого: транзакция откатывается на последней вставке
+	broken := g.Order(testorders.ScenarioDefault)
+	broken.Items = append(broken.Items, broken.Items[0])
+	t.Cleanup(func() { deleteOrder(t, pool, broken.OrderUid) })
+	called := 0
+	hook := func() { called++ }
+
+	err := postgres.InsertOrder(ctx, pool, tenant.Default, &broken, nil, hook)
+	var pgErr *pgconn.PgError
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "23505", pgErr.Code)
+	_, err = postgres.InsertOrders(ctx, pool, []postgres.OrderRecord{{Tenant: tenant.Default, Order: broken}}, hook)
+	require.Error(t, err)
+	assert.Zero(t, called, "hooks do not run when the transaction rolls back")
+	exists, err := postgres.ExistsOrder(ctx, pool, tenant.Default, broken.OrderUid)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// После фиксации хук вызывается один раз, и заказ уже виден другим соединениям
+	for _, insert := range []func(*orders.Order, func()) error{
+		func(o *orders.Order, hook func()) error {
+			return postgres.InsertOrder(ctx, pool, tenant.Default, o, nil, hook)
+		},
+		func(o *orders.Order, hook func()) error {
+			_, err := postgres.InsertOrders(ctx, pool, []postgres.OrderRecord{{Tenant: tenant.Default, Order: *o}}, hook)
+			return err
+		},
+	} {
+		order := g.Order(testorders.ScenarioDefault)
+		t.Cleanup(func() { deleteOrder(t, pool, order.OrderUid) })
+		visible := 0
+		require.NoError(t, insert(&order, func() {
+			exists, err := postgres.ExistsOrder(ctx, pool, tenant.Default, order.OrderUid)
+			if err == nil && exists {
+				visible++
+			}
+		}))
+		assert.Equal(t, 1, visible)
+	}
+}
+
+func TestRecentOrdersAndPrefixSearch(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	g := testorders.NewGenerator(time.Now().UnixNano())
+	tenantID := fmt.Sprintf("recent-%d", time.Now().UnixNano())
+
+	prefix := fmt.Sprintf("pfx%d", time.Now().UnixNano()%1_000_000)
+	var inserted []string
+	for i, suffix := range []string{"-b", "-A", "-c"} {
+		o := g.Order(testorders.ScenarioDefault)
+		o.OrderUid = prefix + suffix
+		if i == 2 {
+			o.Quarantined = true
+		}
+		t.Cleanup(func() { deleteOrder(t, pool, o.OrderUid) })
+		require.NoError(t, postgres.InsertOrder(ctx, pool, tenantID, &o, nil))
+		inserted = append(inserted, ids.Normalize(o.OrderUid))
+	}
+
+	recent, err := postgres.RecentOrders(ctx, pool, tenantID, 10)
+	require.NoError(t, err)
+	require.Len(t, recent, 2, "quarantined orders are not listed")
+	assert.Equal(t, inserted[1], recent[0].OrderUid, "the newest order comes first")
+	assert.Equal(t, inserted[0], recent[1].OrderUid)
+	assert.Positive(t, recent[0].ItemCount)
+	assert.False(t, recent[0].StoredAt.IsZero())
+
+	uids, err := postgres.OrderUIDsWithPrefix(ctx, pool, tenantID, strings.ToUpper(prefix), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{inserted[1], inserted[0]}, uids)
+	uids, err = postgres.OrderUIDsWithPrefix(ctx, pool, tenantID, prefix+"-b", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{inserted[0]}, uids)
+	_, err = postgres.OrderUIDsWithPrefix(ctx, pool, tenantID, "a%", 10)
+	assert.ErrorIs(t, err, ids.ErrInvalid)
+}
+
+func TestOrderSourceStoredAndFiltered(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	g := testorders.NewGenerator(time.Now().UnixNano())
+	tenantID := fmt.Sprintf("source-%d", time.Now().UnixNano())
+
+	unknown := g.Order(testorders.ScenarioDefault)
+	t.Cleanup(func() { deleteOrder(t, pool, unknown.OrderUid) })
+	require.NoError(t, postgres.InsertOrder(ctx, pool, tenantID, &unknown, nil))
+
+	order := g.Order(testorders.ScenarioDefault)
+	order.TrackNumber = unknown.TrackNumber
+	order.Source, order.SourceDetail = orders.SourceKafka, "orders/0/7"
+	t.Cleanup(func() { deleteOrder(t, pool, order.OrderUid) })
+	require.NoError(t, postgres.InsertOrder(ctx, pool, tenantID, &order, nil))
+
+	got, err := postgres.GetOrderByUID(ctx, pool, tenantID, unknown.OrderUid)
+	require.NoError(t, err)
+	assert.Equal(t, orders.SourceUnknown, got.Source, "orders without a source are stored as unknown")
+	got, err = postgres.GetOrderByUID(ctx, pool, tenantID, order.OrderUid)
+	require.NoError(t, err)
+	assert.Equal(t, orders.SourceKafka, got.Source)
+	assert.Equal(t, "orders/0/7", got.SourceDetail)
+
+	order.Source, order.SourceDetail = orders.SourceReplay, "orders/0/9"
+	_, err = postgres.UpsertOrder(ctx, pool, tenantID, &order)
+	require.NoError(t, err)
+	got, err = postgres.GetOrderByUID(ctx, pool, tenantID, order.OrderUid)
+	require.NoError(t, err)
+	assert.Equal(t, orders.SourceReplay, got.Source, "an upsert records the source of the last write")
+	assert.Equal(t, "orders/0/9", got.SourceDetail)
+
+	from := time.Unix(0, 0)
+	to := time.Now().Add(24 * time.Hour)
+	for source, want := range map[string][]string{
+		orders.SourceReplay:    {order.OrderUid},
+		orders.SourceUnknown:   {unknown.OrderUid},
+		orders.SourceHTTP:      nil,
+		orders.SourceDLQReplay: nil,
+	} {
+		page, err := postgres.ListOrdersAfter(ctx, pool, tenantID, nil, from, to, 100, postgres.IncludeAll, source)
+		require.NoError(t, err)
+		var uids []string
+		for _, o := range page {
+			uids = append(uids, o.OrderUid)
+		}
+		assert.Equal(t, want, uids, source)
+
+		found, err := postgres.FindOrdersByTrackNumber(ctx, pool, tenantID, unknown.TrackNumber, "", nil, 0, postgres.IncludeNone, source)
+		require.NoError(t, err)
+		uids = nil
+		for _, o := range found {
+			uids = append(uids, o.OrderUid)
+		}
+		assert.Equal(t, want, uids, source)
+	}
+}
+
+func TestDeleteArchivedOrders(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	g := testorders.NewGenerator(time.Now().UnixNano())
+	tenantID := fmt.Sprintf("archive-%d", time.Now().UnixNano())
+
+	old := g.Order(testorders.ScenarioDefault)
+	old.DateCreated = time.Now().Add(-400 * 24 * time.Hour).UTC().Truncate(time.Second)
+	recent := g.Order(testorders.ScenarioDefault)
+	recent.DateCreated = time.Now().UTC().Truncate(time.Second)
+	for _, o := range []*orders.Order{&old, &recent} {
+		uid := o.OrderUid
+		t.Cleanup(func() { deleteOrder(t, pool, uid) })
+		raw := &postgres.RawPayload{OrderUid: uid, Payload: []byte(`{}`), ReceivedAt: time.Now()}
+		require.NoError(t, postgres.InsertOrder(ctx, pool, tenantID, o, raw))
+	}
+
+	// Недавний заказ в списке не удаляется: его дата не раньше границы
+	deleted, err := postgres.DeleteArchivedOrders(ctx, pool, tenantID, []string{old.OrderUid, recent.OrderUid}, time.Now().Add(-24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	_, err = postgres.GetOrderByUID(ctx, pool, tenantID, old.OrderUid)
+	assert.ErrorIs(t, err, postgres.ErrOrderNotFound)
+	_, err = postgres.GetRawPayload(ctx, pool, tenantID, old.OrderUid)
+	assert.ErrorIs(t, err, postgres.ErrRawPayloadNotFound)
+	for _, table := range []string{"delivery", "payment", "items"} {
+		var n int
+		require.NoError(t, pool.QueryRow(ctx, `SELECT count(*) FROM `+table+` WHERE tenant_id = $1 AND order_uid = $2`, tenantID, old.OrderUid).Scan(&n))
+		assert.Zero(t, n, table)
+	}
+	got, err := postgres.GetOrderByUID(ctx, pool, tenantID, recent.OrderUid)
+	require.NoError(t, err)
+	assert.Len(t, got.Items, len(recent.Items))
+	_, err = postgres.GetRawPayload(ctx, pool, tenantID, recent.OrderUid)
+	assert.NoError(t, err)
+}
+
+func TestAddIngestStats(t *testing.T) {
+	pool := newIntegrationPool(t)
+	ctx := context.Background()
+	tenantID := fmt.Sprintf("stats-%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		_, _ = pool.Exec(context.Background(), `DELETE FROM ingest_stats WHERE tenant_id = $1`, tenantID)
+	})
+	hour := time.Now().UTC().Truncate(time.Hour)
+
+	// Прирост двух экземпляров консьюмера и повтор строки внутри одной записи складываются
+	require.NoError(t, postgres.AddIngestStats(ctx, pool, []postgres.IngestStats{
+		{Tenant: tenantID, Producer: "p1", Customer: "c1", Hour: hour.Add(5 * time.Minute), Accepted: 3, Invalid: 1},
+		{Tenant: tenantID, Producer: "p1", Customer: "c1", Hour: hour, Duplicate: 2},
+		{Tenant: tenantID, Customer: "c2", Hour: hour.Add(-time.Hour), Accepted: 1},
+	}))
+	require.NoError(t, postgres.AddIngestStats(ctx, pool, []postgres.IngestStats{
+		{Tenant: tenantID, Producer: "p1", Customer: "c1", Hour: hour, Accepted: 1, Invalid: 1},
+	}))
+
+	list, err := postgres.ListIngestStats(ctx, pool, tenantID, postgres.IngestStatsFilter{From: hour.Add(-2 * time.Hour), To: hour.Add(time.Hour)}, 10)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "c1", list[0].Customer, "newest hours first")
+	assert.True(t, hour.Equal(list[0].Hour))
+	assert.Equal(t, [3]int64{4, 2, 2}, [3]int64{list[0].Accepted, list[0].Invalid, list[0].Duplicate})
+
+	list, err = postgres.ListIngestStats(ctx, pool, tenantID, postgres.IngestStatsFilter{Customer: "c2", From: hour.Add(-2 * time.Hour), To: hour.Add(time.Hour)}, 10)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "", list[0].Producer)
+}
@@ -0,0 +1,63 @@
+//go:build integration
+
+package postgres_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/tenant"
+	"l0_test_self/pkg/client/postgres"
+	"l0_test_self/pkg/testorders"
+)
+
+// BenchmarkFindOrdersByTrackNumberInclude - бенчмарк страницы списка заказов (100 из 200 заказов с одним трек-номером)
+// с загрузкой всех разделов и только заголовков.
+// Запуск: go test -tags integration -run '^$' -bench FindOrdersByTrackNumberInclude ./pkg/client/postgres/
+func BenchmarkFindOrdersByTrackNumberInclude(b *testing.B) {
+	const seeded, page = 200, 100
+	pool := newIntegrationPool(b)
+	ctx := context.Background()
+	g := testorders.NewGenerator(time.Now().UnixNano())
+
+	track := fmt.Sprintf("BENCH-%d", time.Now().UnixNano())
+	uids := make([]string, 0, seeded)
+	b.Cleanup(func() {
+		for _, table := range []string{"items", "payment", "delivery", "orders"} {
+			if _, err := pool.Exec(ctx, `DELETE FROM `+table+` WHERE order_uid = ANY($1)`, uids); err != nil {
+				b.Errorf("cleanup %s: %v", table, err)
+			}
+		}
+	})
+	for i := 0; i < seeded; i++ {
+		o := g.Order(testorders.ScenarioDefault)
+		o.TrackNumber = track
+		if err := postgres.InsertOrder(ctx, pool, tenant.Default, &o, nil); err != nil {
+			b.Fatal(err)
+		}
+		uids = append(uids, o.OrderUid)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		include postgres.Include
+	}{
+		{"all", postgres.IncludeAll},
+		{"items", postgres.IncludeItems},
+		{"headers", postgres.IncludeNone},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				list, err := postgres.FindOrdersByTrackNumber(ctx, pool, tenant.Default, track, "", nil, page, tc.include, "")
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(list) != page {
+					b.Fatalf("got %d orders, want %d", len(list), page)
+				}
+			}
+		})
+	}
+}
@@ -3,9 +3,16 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"l0_test_self/internal/ids"
+	"l0_test_self/internal/tenant"
 	"l0_test_self/models/orders"
 	"l0_test_self/pkg/utils"
+	"runtime"
+	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgconn"
@@ -14,6 +21,18 @@ import (
 	_ "github.com/jackc/pgx/v4/pgxpool"
 )
 
+// ErrOrderNotFound возвращается, когда заказ с указанным идентификатором отсутствует в базе данных.
+var ErrOrderNotFound = errors.New("order not found")
+
+// ErrOrderExists возвращается InsertOrder, когда заказ с таким идентификатором уже сохранён.
+var ErrOrderExists = errors.New("order already exists")
+
+// ErrConflict возвращается UpdateDelivery, когда updated_at заказа не совпадает с ожидаемым: заказ изменён после чтения.
+var ErrConflict = errors.New("order was modified concurrently")
+
+// uniqueViolation - код ошибки PostgreSQL при нарушении ограничения уникальности
+const uniqueViolation = "23505"
+
 // DBConfig хранит параметры подключения к базе данных PostgreSQL.
 type DBConfig struct {
 	Host     string
@@ -22,8 +41,41 @@ type DBConfig struct {
 	Password string
 	DBName   string
 	SSLMode  string
+
+	MaxConns           int32         // размер пула, 0 — значение pgxpool по умолчанию
+	StatementCacheMode string        // режим кэша подготовленных выражений: prepare или describe, пусто — prepare
+	StatementTimeout   time.Duration // ограничение каждого выражения в транзакциях записи, 0 — без ограничения
+	// SessionStatementTimeout - statement_timeout каждого соединения пула: страховка на стороне сервера для запросов,
+	// ограничение времени которых на стороне клиента не сработало. 0 — значение сервера.
+	SessionStatementTimeout time.Duration
+}
+
+// Режимы кэша подготовленных выражений pgx.
+const (
+	StatementCacheModePrepare  = "prepare"  // именованные подготовленные выражения (быстрее при прямом подключении)
+	StatementCacheModeDescribe = "describe" // только описание выражений, совместимо с PgBouncer в режиме transaction
+)
+
+// RecommendedConnsPerWriter - рекомендуемое число соединений пула на одного пишущего воркера: одно удерживается его
+// транзакцией записи, второе остаётся для чтений HTTP обработчиков, экспорта и очистки, чтобы они не ждали в очереди пула.
+const RecommendedConnsPerWriter = 2
+
+// PoolSizeWarning возвращает предупреждение, если размер пула maxConns (0 — значение pgxpool по умолчанию) меньше
+// рекомендованного для writers пишущих воркеров, иначе пустую строку.
+func PoolSizeWarning(maxConns, writers int) string {
+	if maxConns <= 0 {
+		maxConns = max(4, runtime.NumCPU()) // значение pgxpool по умолчанию
+	}
+	if want := writers * RecommendedConnsPerWriter; maxConns < want {
+		return fmt.Sprintf("database pool max_connections=%d is below recommended %d for %d writer(s) (%d per writer)",
+			maxConns, want, writers, RecommendedConnsPerWriter)
+	}
+	return ""
 }
 
+// writeStatementTimeout - statement_timeout транзакций записи в миллисекундах, задаётся NewClient
+var writeStatementTimeout atomic.Int64
+
 // Client это интерфейс для работы с PostgreSQL клиентом, который позволяет выполнять SQL команды и транзакции.
 type Client interface {
 	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
@@ -34,8 +86,8 @@ type Client interface {
 
 // NewClient создает новый клиент для подключения к базе данных PostgreSQL с использованием пула соединений.
 func NewClient(ctx context.Context, config DBConfig, maxAttempts int) (pool *pgxpool.Pool, err error) {
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		config.User, config.Password, config.Host, config.Port, config.DBName, config.SSLMode)
+	dsn := config.dsn()
+	writeStatementTimeout.Store(config.StatementTimeout.Milliseconds())
 
 	err = repeatable.DoWithTries(func() error {
 		ctx, cancel := context.WithTimeout(ctx, time.Second*5)
@@ -55,56 +107,448 @@ func NewClient(ctx context.Context, config DBConfig, maxAttempts int) (pool *pgx
 	return pool, nil
 }
 
-// InsertOrder вставляет новый заказ в базу данных PostgreSQL, включая связанные данные о доставке, оплате и товарах.
-func InsertOrder(ctx context.Context, pool *pgxpool.Pool, order *orders.Order) error {
+// NewReplicaClient создает пул соединений с репликой PostgreSQL, не подключаясь к ней: соединения устанавливаются
+// при первых запросах, поэтому недоступная при запуске реплика не останавливает сервер. StatementTimeout
+// к пулу реплики не относится: через него заказы не записываются.
+func NewReplicaClient(config DBConfig) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(config.dsn())
+	if err != nil {
+		return nil, fmt.Errorf("parse replica connection config: %w", err)
+	}
+	poolConfig.LazyConnect = true
+	return pgxpool.ConnectConfig(context.Background(), poolConfig)
+}
+
+// dsn - строка подключения pgxpool по настройкам config
+func (config DBConfig) dsn() string {
+	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
+		config.User, config.Password, config.Host, config.Port, config.DBName, config.SSLMode)
+	if config.MaxConns > 0 {
+		dsn += fmt.Sprintf("&pool_max_conns=%d", config.MaxConns)
+	}
+	if config.StatementCacheMode != "" {
+		dsn += "&statement_cache_mode=" + config.StatementCacheMode
+	}
+	if ms := config.SessionStatementTimeout.Milliseconds(); ms > 0 {
+		// Неизвестные pgx параметры строки подключения передаются серверу как параметры сеанса
+		dsn += fmt.Sprintf("&statement_timeout=%d", ms)
+	}
+	return dsn
+}
+
+// ServerVersion возвращает строку версии сервера PostgreSQL (результат SELECT version()).
+func ServerVersion(ctx context.Context, pool *pgxpool.Pool) (string, error) {
+	var version string
+	if err := pool.QueryRow(ctx, "SELECT version()").Scan(&version); err != nil {
+		return "", fmt.Errorf("failed to query server version: %w", err)
+	}
+	return version, nil
+}
+
+// ServerTime возвращает текущее время сервера PostgreSQL (clock_timestamp(), в отличие от now() не привязанное к началу транзакции).
+func ServerTime(ctx context.Context, pool *pgxpool.Pool) (time.Time, error) {
+	var now time.Time
+	if err := pool.QueryRow(ctx, "SELECT clock_timestamp()").Scan(&now); err != nil {
+		return time.Time{}, fmt.Errorf("failed to query server time: %w", err)
+	}
+	return now, nil
+}
+
+// InsertOrder вставляет новый заказ арендатора tenantID в базу данных PostgreSQL, включая связанные данные о доставке,
+// оплате и товарах. Если raw не nil, исходное сообщение сохраняется в raw_payloads в той же транзакции.
+// Если заказ с таким идентификатором у арендатора уже сохранён, возвращается ошибка, обёртывающая ErrOrderExists.
+// Функции onCommit вызываются по порядку только после успешной фиксации транзакции (см. runCommitHooks).
+func InsertOrder(ctx context.Context, pool *pgxpool.Pool, tenantID string, order *orders.Order, raw *RawPayload, onCommit ...func()) error {
+	if err := tenant.Validate(tenantID); err != nil {
+		return err
+	}
+	tx, err := beginWrite(ctx, pool)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := insertOrderTx(ctx, tx, tenantID, order, false); err != nil {
+		return err
+	}
+	if err := insertRawPayloadTx(ctx, tx, tenantID, raw); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	runCommitHooks(onCommit)
+	return nil
+}
+
+// runCommitHooks вызывает функции onCommit после фиксации транзакции записи. Через них вызывающий публикует записанные
+// данные (кэш, подтверждения, уведомления): при ошибке записи, в том числе откате транзакции, они не вызываются,
+// поэтому наружу не попадают данные, которых нет в базе.
+func runCommitHooks(onCommit []func()) {
+	for _, fn := range onCommit {
+		if fn != nil {
+			fn()
+		}
+	}
+}
+
+// beginWrite начинает транзакцию записи. Если задан StatementTimeout, он действует только внутри этой транзакции (SET LOCAL),
+// чтобы зависшая вставка не удерживала соединение пула, не затрагивая чтения на том же соединении.
+func beginWrite(ctx context.Context, pool *pgxpool.Pool) (pgx.Tx, error) {
 	tx, err := pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if ms := writeStatementTimeout.Load(); ms > 0 {
+		if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", ms)); err != nil {
+			_ = tx.Rollback(ctx)
+			return nil, fmt.Errorf("failed to set statement timeout: %w", err)
+		}
+	}
+	return tx, nil
+}
+
+// Идентификаторы заказов приводятся к нижнему регистру при приёме (ids.Parse), но в базе могут оставаться заказы,
+// сохранённые раньше с буквами в верхнем регистре. Поэтому заказ ищется по lower(order_uid) (индекс
+// orders_tenant_lower_order_uid_idx), связанные строки читаются и меняются по хранимому идентификатору,
+// а в прочитанных заказах идентификатор приводится к нижнему регистру (ids.Normalize).
+
+// storedUIDSQL - хранимый идентификатор заказа арендатора $1, совпадающий с $2 без учёта регистра; точное совпадение
+// предпочитается, если заказы различаются только регистром
+const storedUIDSQL = `SELECT order_uid FROM orders WHERE tenant_id = $1 AND lower(order_uid) = lower($2) ORDER BY order_uid = $2 DESC LIMIT 1`
+
+// storedUID возвращает хранимый идентификатор заказа арендатора tenantID, совпадающий с uid без учёта регистра,
+// или uid, если такого заказа нет.
+func storedUID(ctx context.Context, tx pgx.Tx, tenantID, uid string) (string, error) {
+	var stored string
+	err := tx.QueryRow(ctx, storedUIDSQL, tenantID, uid).Scan(&stored)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return uid, nil
+	case err != nil:
+		return "", fmt.Errorf("failed to look up order: %w", err)
+	}
+	return stored, nil
+}
+
+// UpsertOrder сохраняет заказ: новый заказ вставляется, а у существующего заменяются поля, доставка, платежи и товары.
+// При замене updated_at выставляется в текущее время, а created_at не меняется; оба значения записываются в order.
+// Заказы других арендаторов с тем же идентификатором не затрагиваются. Возвращает true, если заказ был создан.
+// Заказ, сохранённый раньше с идентификатором в другом регистре, заменяется под прежним идентификатором.
+// Изменение доставки существующего заказа записывается в историю доставки с автором ChangedByOrderUpdate.
+func UpsertOrder(ctx context.Context, pool *pgxpool.Pool, tenantID string, order *orders.Order) (bool, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return false, err
+	}
+	extras, err := encodeExtras(order.Extras)
+	if err != nil {
+		return false, err
+	}
+	corrections, err := encodeList("corrections", order.Corrections)
+	if err != nil {
+		return false, err
+	}
+	warnings, err := encodeList("warnings", order.Warnings)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := beginWrite(ctx, pool)
+	if err != nil {
+		return false, err
 	}
 	defer tx.Rollback(ctx)
 
+	uid, err := storedUID(ctx, tx, tenantID, order.OrderUid)
+	if err != nil {
+		return false, err
+	}
+	stored := *order
+	stored.OrderUid = uid
+
+	orderSQL := `INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, extras, quarantined, corrections, warnings, tenant_id, source, source_detail)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+              ON CONFLICT (tenant_id, order_uid) DO UPDATE SET track_number = EXCLUDED.track_number, entry = EXCLUDED.entry, locale = EXCLUDED.locale,
+                  internal_signature = EXCLUDED.internal_signature, customer_id = EXCLUDED.customer_id, delivery_service = EXCLUDED.delivery_service,
+                  shardkey = EXCLUDED.shardkey, sm_id = EXCLUDED.sm_id, date_created = EXCLUDED.date_created, oof_shard = EXCLUDED.oof_shard,
+                  extras = EXCLUDED.extras, quarantined = EXCLUDED.quarantined, corrections = EXCLUDED.corrections, warnings = EXCLUDED.warnings,
+                  source = EXCLUDED.source, source_detail = EXCLUDED.source_detail, updated_at = now()
+              RETURNING created_at, updated_at, xmax = 0`
+	var created bool
+	err = tx.QueryRow(ctx, orderSQL, uid, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature, order.CustomerId, order.DeliveryService, order.Shardkey, order.SmId, order.DateCreated, order.OofShard, extras, order.Quarantined, corrections, warnings, tenantID, orderSource(order), order.SourceDetail).
+		Scan(&order.StoredAt, &order.UpdatedAt, &created)
+	if err != nil {
+		return false, fmt.Errorf("failed to upsert into orders: %w", err)
+	}
+
+	if !created {
+		if err := recordDeliveryChangeTx(ctx, tx, tenantID, uid, order.Delivery, ChangedByOrderUpdate); err != nil {
+			return false, err
+		}
+		// детали заказа заменяются целиком
+		for _, table := range []string{"delivery", "payment", "items"} {
+			if _, err := tx.Exec(ctx, `DELETE FROM `+table+` WHERE tenant_id = $1 AND order_uid = $2`, tenantID, uid); err != nil {
+				return false, fmt.Errorf("failed to delete from %s: %w", table, err)
+			}
+		}
+	}
+	if err := insertOrderDetailsTx(ctx, tx, tenantID, &stored); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return created, nil
+}
+
+// UpdateDelivery заменяет доставку заказа арендатора tenantID с идентификатором uid на d, только если updated_at заказа
+// равен expected, и возвращает новое значение updated_at. Если заказ изменён с тех пор, возвращается ErrConflict,
+// а если его нет — ErrOrderNotFound; в обоих случаях доставка не меняется. Прежняя доставка записывается в историю
+// (ListDeliveryHistory) с автором changedBy в той же транзакции.
+func UpdateDelivery(ctx context.Context, pool *pgxpool.Pool, tenantID, uid string, expected time.Time, d orders.Delivery, changedBy string) (time.Time, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return time.Time{}, err
+	}
+	phone, email, err := encryptDeliveryPII(fieldKeyring.Load(), d)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	tx, err := beginWrite(ctx, pool)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	// updated_at растёт и при изменениях в пределах одной микросекунды, поэтому прочитанное значение не совпадёт с новым
+	orderSQL := `UPDATE orders SET updated_at = GREATEST(now(), updated_at + interval '1 microsecond')
+              WHERE tenant_id = $1 AND order_uid = $2 AND updated_at = $3
+              RETURNING updated_at`
+	stored, err := storedUID(ctx, tx, tenantID, uid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var updatedAt time.Time
+	err = tx.QueryRow(ctx, orderSQL, tenantID, stored, expected).Scan(&updatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var one int
+		err = tx.QueryRow(ctx, `SELECT 1 FROM orders WHERE tenant_id = $1 AND order_uid = $2`, tenantID, stored).Scan(&one)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return time.Time{}, ErrOrderNotFound
+		case err != nil:
+			return time.Time{}, fmt.Errorf("failed to check order: %w", err)
+		}
+		return time.Time{}, fmt.Errorf("%w: %s", ErrConflict, uid)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to update order: %w", err)
+	}
+
+	if err := recordDeliveryChangeTx(ctx, tx, tenantID, stored, d, changedBy); err != nil {
+		return time.Time{}, err
+	}
+	deliverySQL := `INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email, tenant_id)
+                 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+                 ON CONFLICT (tenant_id, order_uid) DO UPDATE SET name = EXCLUDED.name, phone = EXCLUDED.phone, zip = EXCLUDED.zip,
+                     city = EXCLUDED.city, address = EXCLUDED.address, region = EXCLUDED.region, email = EXCLUDED.email`
+	if _, err := tx.Exec(ctx, deliverySQL, stored, d.Name, phone, d.Zip, d.City, d.Address, d.Region, email, tenantID); err != nil {
+		return time.Time{}, fmt.Errorf("failed to update delivery: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return time.Time{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return updatedAt, nil
+}
+
+// OrderRecord - заказ арендатора Tenant для пакетной вставки вместе с исходным сообщением (Raw может быть nil).
+type OrderRecord struct {
+	Tenant string
+	Order  orders.Order
+	Raw    *RawPayload
+}
+
+// InsertOrders вставляет пачку заказов в одной транзакции. Заказы, уже присутствующие в базе (в том числе повторы внутри пачки),
+// пропускаются, поэтому повторная вставка той же пачки после сбоя безопасна. Возвращает количество вставленных заказов.
+// Функции onCommit вызываются только после успешной фиксации транзакции всей пачки.
+func InsertOrders(ctx context.Context, pool *pgxpool.Pool, list []OrderRecord, onCommit ...func()) (int, error) {
+	for i := range list {
+		if err := tenant.Validate(list[i].Tenant); err != nil {
+			return 0, fmt.Errorf("order %s: %w", list[i].Order.OrderUid, err)
+		}
+	}
+	tx, err := beginWrite(ctx, pool)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	inserted := 0
+	for i := range list {
+		ok, err := insertOrderTx(ctx, tx, list[i].Tenant, &list[i].Order, true)
+		if err != nil {
+			return 0, fmt.Errorf("order %s: %w", list[i].Order.OrderUid, err)
+		}
+		if !ok {
+			continue
+		}
+		if err := insertRawPayloadTx(ctx, tx, list[i].Tenant, list[i].Raw); err != nil {
+			return 0, fmt.Errorf("order %s: %w", list[i].Order.OrderUid, err)
+		}
+		inserted++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	runCommitHooks(onCommit)
+	return inserted, nil
+}
+
+// insertOrderTx вставляет заказ арендатора tenantID и связанные данные в рамках транзакции tx. При skipExisting заказ
+// с уже существующим у арендатора order_uid пропускается без ошибки и возвращается false. Заказ, сохранённый раньше
+// с идентификатором в другом регистре, считается уже существующим.
+func insertOrderTx(ctx context.Context, tx pgx.Tx, tenantID string, order *orders.Order, skipExisting bool) (bool, error) {
 	// вставляем в orders таблицу
-	orderSQL := `INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard)
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
-	_, err = tx.Exec(ctx, orderSQL, order.OrderUid, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature, order.CustomerId, order.DeliveryService, order.Shardkey, order.SmId, order.DateCreated, order.OofShard)
+	extras, err := encodeExtras(order.Extras)
+	if err != nil {
+		return false, err
+	}
+	corrections, err := encodeList("corrections", order.Corrections)
+	if err != nil {
+		return false, err
+	}
+	warnings, err := encodeList("warnings", order.Warnings)
+	if err != nil {
+		return false, err
+	}
+	orderSQL := `INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, extras, quarantined, corrections, warnings, tenant_id, source, source_detail)
+              SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18
+              WHERE NOT EXISTS (SELECT 1 FROM orders WHERE tenant_id = $16 AND lower(order_uid) = lower($1) AND order_uid <> $1)`
+	if skipExisting {
+		orderSQL += ` ON CONFLICT (tenant_id, order_uid) DO NOTHING`
+	}
+	// created_at и updated_at заполняются базой данных, значения из заказа не сохраняются
+	orderSQL += ` RETURNING created_at, updated_at`
+	err = tx.QueryRow(ctx, orderSQL, order.OrderUid, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature, order.CustomerId, order.DeliveryService, order.Shardkey, order.SmId, order.DateCreated, order.OofShard, extras, order.Quarantined, corrections, warnings, tenantID, orderSource(order), order.SourceDetail).
+		Scan(&order.StoredAt, &order.UpdatedAt)
 	if err != nil {
-		return fmt.Errorf("failed to insert into orders: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// ON CONFLICT DO NOTHING или NOT EXISTS: заказ уже сохранён
+			if !skipExisting {
+				return false, fmt.Errorf("%w: %s", ErrOrderExists, order.OrderUid)
+			}
+			return false, nil
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return false, fmt.Errorf("%w: %s", ErrOrderExists, order.OrderUid)
+		}
+		return false, fmt.Errorf("failed to insert into orders: %w", err)
+	}
+
+	if err := insertOrderDetailsTx(ctx, tx, tenantID, order); err != nil {
+		return false, err
 	}
+	return true, nil
+}
 
+// insertOrderDetailsTx вставляет доставку, платежи и товары заказа арендатора tenantID в рамках транзакции tx.
+func insertOrderDetailsTx(ctx context.Context, tx pgx.Tx, tenantID string, order *orders.Order) error {
 	// вставляем в delivery таблицу
-	deliverySQL := `INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email)
-                 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-	_, err = tx.Exec(ctx, deliverySQL, order.OrderUid, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip, order.Delivery.City, order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
+	deliverySQL := `INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email, tenant_id)
+                 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	phone, email, err := encryptDeliveryPII(fieldKeyring.Load(), order.Delivery)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, deliverySQL, order.OrderUid, order.Delivery.Name, phone, order.Delivery.Zip, order.Delivery.City, order.Delivery.Address, order.Delivery.Region, email, tenantID)
 	if err != nil {
 		return fmt.Errorf("failed to insert into delivery: %w", err)
 	}
 
-	// вставляем в payment таблицу
-	paymentSQL := `INSERT INTO payment (transaction_id, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
-                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
-	_, err = tx.Exec(ctx, paymentSQL, order.Payment.Transaction, order.Payment.RequestId, order.Payment.Currency, order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDt, order.Payment.Bank, order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee)
-	if err != nil {
-		return fmt.Errorf("failed to insert into payment: %w", err)
+	// вставляем в payment таблицу все платежи заказа
+	paymentSQL := `INSERT INTO payment (transaction_id, order_uid, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee, tenant_id)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	for _, p := range order.Payments {
+		_, err = tx.Exec(ctx, paymentSQL, p.Transaction, order.OrderUid, p.RequestId, p.Currency, p.Provider, p.Amount, p.PaymentDt, p.Bank, p.DeliveryCost, p.GoodsTotal, p.CustomFee, tenantID)
+		if err != nil {
+			return fmt.Errorf("failed to insert payment %s: %w", p.Transaction, err)
+		}
 	}
 
 	// вставляем в items таблицу
-	itemSQL := `INSERT INTO items (chrt_id, order_uid, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)
-             VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	itemSQL := `INSERT INTO items (chrt_id, order_uid, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status, tenant_id)
+             VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
 	for _, item := range order.Items {
-		_, err = tx.Exec(ctx, itemSQL, item.ChrtId, order.OrderUid, item.TrackNumber, item.Price, item.Rid, item.Name, item.Sale, item.Size, item.TotalPrice, item.NmId, item.Brand, item.Status)
+		_, err = tx.Exec(ctx, itemSQL, item.ChrtId, order.OrderUid, item.TrackNumber, item.Price, item.Rid, item.Name, item.Sale, item.Size, item.TotalPrice, item.NmId, item.Brand, item.Status, tenantID)
 		if err != nil {
 			return fmt.Errorf("failed to insert item with chrt_id %d: %w", item.ChrtId, err)
 		}
 	}
 
-	return tx.Commit(ctx)
+	return nil
+}
+
+// paymentOrder - порядок платежей заказа при чтении: первым идёт основной (самый ранний) платёж
+const paymentOrder = `payment_dt, transaction_id`
+
+// encodeExtras кодирует дополнительные поля заказа для колонки extras (JSONB). Пустой набор сохраняется как NULL.
+func encodeExtras(extras map[string]any) ([]byte, error) {
+	if len(extras) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(extras)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode extras: %w", err)
+	}
+	return data, nil
+}
+
+// encodeList кодирует исправления или замечания заказа для колонки JSONB name. Пустой список сохраняется как NULL.
+func encodeList[T any](name string, list []T) ([]byte, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	return data, nil
 }
 
-// GetAllOrders извлекает все заказы из базы данных PostgreSQL, включая связанные данные о доставке, оплате и товарах.
-func GetAllOrders(ctx context.Context, pool *pgxpool.Pool) ([]orders.Order, error) {
+// orderSource - источник заказа для колонки source: заказ без источника сохраняется с orders.SourceUnknown
+func orderSource(order *orders.Order) string {
+	if order.Source == "" {
+		return orders.SourceUnknown
+	}
+	return order.Source
+}
+
+// decodeList декодирует колонку JSONB со списком исправлений или замечаний заказа; NULL означает пустой список.
+func decodeList[T any](data []byte) ([]T, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var list []T
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetAllOrders извлекает все заказы арендатора tenantID из базы данных PostgreSQL, включая связанные данные о доставке,
+// оплате и товарах.
+func GetAllOrders(ctx context.Context, pool *pgxpool.Pool, tenantID string) ([]orders.Order, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return nil, err
+	}
 	// 1. Получаем все заказы
-	orderSQL := `SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard FROM orders`
-	rows, err := pool.Query(ctx, orderSQL)
+	orderSQL := `SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, extras, quarantined, corrections, warnings, source, source_detail, created_at, updated_at FROM orders WHERE tenant_id = $1`
+	rows, err := pool.Query(ctx, orderSQL, tenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query orders: %w", err)
 	}
@@ -114,10 +558,20 @@ func GetAllOrders(ctx context.Context, pool *pgxpool.Pool) ([]orders.Order, erro
 
 	for rows.Next() {
 		var o orders.Order
-		err := rows.Scan(&o.OrderUid, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature, &o.CustomerId, &o.DeliveryService, &o.Shardkey, &o.SmId, &o.DateCreated, &o.OofShard)
+		var extras, corrections, warnings []byte
+		err := rows.Scan(&o.OrderUid, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature, &o.CustomerId, &o.DeliveryService, &o.Shardkey, &o.SmId, &o.DateCreated, &o.OofShard, &extras, &o.Quarantined, &corrections, &warnings, &o.Source, &o.SourceDetail, &o.StoredAt, &o.UpdatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan order: %w", err)
 		}
+		if o.Extras, err = orders.DecodeExtras(extras); err != nil {
+			return nil, fmt.Errorf("failed to decode extras of order %s: %w", o.OrderUid, err)
+		}
+		if o.Corrections, err = decodeList[orders.Correction](corrections); err != nil {
+			return nil, fmt.Errorf("failed to decode corrections of order %s: %w", o.OrderUid, err)
+		}
+		if o.Warnings, err = decodeList[orders.Warning](warnings); err != nil {
+			return nil, fmt.Errorf("failed to decode warnings of order %s: %w", o.OrderUid, err)
+		}
 		orderMap[o.OrderUid] = &o
 	}
 	if rows.Err() != nil {
@@ -125,8 +579,9 @@ func GetAllOrders(ctx context.Context, pool *pgxpool.Pool) ([]orders.Order, erro
 	}
 
 	// 2. получаем все доставки и мапим их
-	deliverySQL := `SELECT order_uid, name, phone, zip, city, address, region, email FROM delivery`
-	deliveryRows, err := pool.Query(ctx, deliverySQL)
+	deliverySQL := `SELECT order_uid, name, phone, zip, city, address, region, email FROM delivery WHERE tenant_id = $1`
+	kr := fieldKeyring.Load()
+	deliveryRows, err := pool.Query(ctx, deliverySQL, tenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query deliveries: %w", err)
 	}
@@ -139,6 +594,9 @@ func GetAllOrders(ctx context.Context, pool *pgxpool.Pool) ([]orders.Order, erro
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan delivery: %w", err)
 		}
+		if err := decryptDeliveryPII(kr, orderUid, &d); err != nil {
+			return nil, err
+		}
 		if order, ok := orderMap[orderUid]; ok {
 			order.Delivery = d
 		}
@@ -148,22 +606,22 @@ func GetAllOrders(ctx context.Context, pool *pgxpool.Pool) ([]orders.Order, erro
 	}
 
 	// 3. получаем все платежи и мапим их
-	paymentSQL := `SELECT transaction_id, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee FROM payment`
-	paymentRows, err := pool.Query(ctx, paymentSQL)
+	paymentSQL := `SELECT order_uid, transaction_id, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee FROM payment WHERE tenant_id = $1 ORDER BY order_uid, ` + paymentOrder
+	paymentRows, err := pool.Query(ctx, paymentSQL, tenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query payments: %w", err)
 	}
 	defer paymentRows.Close()
 
 	for paymentRows.Next() {
+		var orderUid string
 		var p orders.Payment
-		err := paymentRows.Scan(&p.Transaction, &p.RequestId, &p.Currency, &p.Provider, &p.Amount, &p.PaymentDt, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee)
+		err := paymentRows.Scan(&orderUid, &p.Transaction, &p.RequestId, &p.Currency, &p.Provider, &p.Amount, &p.PaymentDt, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan payment: %w", err)
 		}
-		// The key for the map is order_uid, which is in p.Transaction
-		if order, ok := orderMap[p.Transaction]; ok {
-			order.Payment = p
+		if order, ok := orderMap[orderUid]; ok {
+			order.Payments = append(order.Payments, p)
 		}
 	}
 	if paymentRows.Err() != nil {
@@ -171,8 +629,8 @@ func GetAllOrders(ctx context.Context, pool *pgxpool.Pool) ([]orders.Order, erro
 	}
 
 	// 4. получаем все товары и мапим их
-	itemSQL := `SELECT chrt_id, order_uid, track_number, price, rid, name, sale, "size", total_price, nm_id, brand, status FROM items`
-	itemRows, err := pool.Query(ctx, itemSQL)
+	itemSQL := `SELECT chrt_id, order_uid, track_number, price, rid, name, sale, "size", total_price, nm_id, brand, status FROM items WHERE tenant_id = $1`
+	itemRows, err := pool.Query(ctx, itemSQL, tenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query items: %w", err)
 	}
@@ -196,8 +654,568 @@ func GetAllOrders(ctx context.Context, pool *pgxpool.Pool) ([]orders.Order, erro
 	// 5. Преобразуем map в срез
 	var orderList []orders.Order
 	for _, order := range orderMap {
+		order.OrderUid = ids.Normalize(order.OrderUid)
+		order.ItemsMissing = len(order.Items) == 0
 		orderList = append(orderList, *order)
 	}
 
 	return orderList, nil
 }
+
+// ExistsOrder сообщает, есть ли у арендатора tenantID заказ с идентификатором uid (без учёта регистра). В отличие
+// от GetOrderByUID читает одну строку индекса таблицы orders, не загружая сам заказ.
+func ExistsOrder(ctx context.Context, pool *pgxpool.Pool, tenantID, uid string) (bool, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return false, err
+	}
+	var one int
+	err := pool.QueryRow(ctx, `SELECT 1 FROM orders WHERE tenant_id = $1 AND lower(order_uid) = lower($2) LIMIT 1`, tenantID, uid).Scan(&one)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("failed to check order: %w", err)
+	}
+	return true, nil
+}
+
+// GetOrderByUID извлекает один заказ арендатора tenantID по его идентификатору (без учёта регистра), включая связанные
+// данные о доставке, оплате и товарах. Если у арендатора нет такого заказа, возвращается ErrOrderNotFound.
+func GetOrderByUID(ctx context.Context, pool *pgxpool.Pool, tenantID, uid string) (orders.Order, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return orders.Order{}, err
+	}
+	var o orders.Order
+
+	orderSQL := `SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, extras, quarantined, corrections, warnings, source, source_detail, created_at, updated_at FROM orders
+              WHERE tenant_id = $1 AND lower(order_uid) = lower($2) ORDER BY order_uid = $2 DESC LIMIT 1`
+	var extras, corrections, warnings []byte
+	err := pool.QueryRow(ctx, orderSQL, tenantID, uid).Scan(&o.OrderUid, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature, &o.CustomerId, &o.DeliveryService, &o.Shardkey, &o.SmId, &o.DateCreated, &o.OofShard, &extras, &o.Quarantined, &corrections, &warnings, &o.Source, &o.SourceDetail, &o.StoredAt, &o.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return orders.Order{}, ErrOrderNotFound
+		}
+		return orders.Order{}, fmt.Errorf("failed to query order: %w", err)
+	}
+	if o.Extras, err = orders.DecodeExtras(extras); err != nil {
+		return orders.Order{}, fmt.Errorf("failed to decode extras of order %s: %w", o.OrderUid, err)
+	}
+	if o.Corrections, err = decodeList[orders.Correction](corrections); err != nil {
+		return orders.Order{}, fmt.Errorf("failed to decode corrections of order %s: %w", o.OrderUid, err)
+	}
+	if o.Warnings, err = decodeList[orders.Warning](warnings); err != nil {
+		return orders.Order{}, fmt.Errorf("failed to decode warnings of order %s: %w", o.OrderUid, err)
+	}
+	// связанные строки хранятся под исходным идентификатором заказа
+	uid = o.OrderUid
+	o.OrderUid = ids.Normalize(uid)
+
+	deliverySQL := `SELECT name, phone, zip, city, address, region, email FROM delivery WHERE tenant_id = $1 AND order_uid = $2`
+	err = pool.QueryRow(ctx, deliverySQL, tenantID, uid).Scan(&o.Delivery.Name, &o.Delivery.Phone, &o.Delivery.Zip, &o.Delivery.City, &o.Delivery.Address, &o.Delivery.Region, &o.Delivery.Email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return orders.Order{}, fmt.Errorf("failed to query delivery: %w", err)
+	}
+	if err := decryptDeliveryPII(fieldKeyring.Load(), uid, &o.Delivery); err != nil {
+		return orders.Order{}, err
+	}
+
+	paymentSQL := `SELECT transaction_id, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee FROM payment WHERE tenant_id = $1 AND order_uid = $2 ORDER BY ` + paymentOrder
+	paymentRows, err := pool.Query(ctx, paymentSQL, tenantID, uid)
+	if err != nil {
+		return orders.Order{}, fmt.Errorf("failed to query payments: %w", err)
+	}
+	defer paymentRows.Close()
+
+	for paymentRows.Next() {
+		var p orders.Payment
+		err := paymentRows.Scan(&p.Transaction, &p.RequestId, &p.Currency, &p.Provider, &p.Amount, &p.PaymentDt, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee)
+		if err != nil {
+			return orders.Order{}, fmt.Errorf("failed to scan payment: %w", err)
+		}
+		o.Payments = append(o.Payments, p)
+	}
+	if paymentRows.Err() != nil {
+		return orders.Order{}, fmt.Errorf("error iterating payment rows: %w", paymentRows.Err())
+	}
+
+	itemSQL := `SELECT chrt_id, track_number, price, rid, name, sale, "size", total_price, nm_id, brand, status FROM items WHERE tenant_id = $1 AND order_uid = $2`
+	itemRows, err := pool.Query(ctx, itemSQL, tenantID, uid)
+	if err != nil {
+		return orders.Order{}, fmt.Errorf("failed to query items: %w", err)
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var i orders.Item
+		err := itemRows.Scan(&i.ChrtId, &i.TrackNumber, &i.Price, &i.Rid, &i.Name, &i.Sale, &i.Size, &i.TotalPrice, &i.NmId, &i.Brand, &i.Status)
+		if err != nil {
+			return orders.Order{}, fmt.Errorf("failed to scan item: %w", err)
+		}
+		o.Items = append(o.Items, i)
+	}
+	if itemRows.Err() != nil {
+		return orders.Order{}, fmt.Errorf("error iterating item rows: %w", itemRows.Err())
+	}
+	o.ItemsMissing = len(o.Items) == 0
+
+	return o, nil
+}
+
+// OrderCursor задаёт позицию постраничного (keyset) чтения заказов по паре (date_created, order_uid).
+type OrderCursor struct {
+	DateCreated time.Time
+	OrderUid    string
+}
+
+// ListOrdersAfter возвращает до limit заказов с date_created в интервале [from, to), упорядоченных по (date_created, order_uid)
+// и расположенных строго после курсора after (nil — с начала интервала). Из доставки, оплаты и товаров загружаются
+// только разделы include. Следующую страницу можно запросить с курсором по последнему заказу.
+// Возвращаются только заказы арендатора tenantID; заказы в карантине не возвращаются. Непустой source оставляет
+// только заказы с этим источником (orders.SourceKafka и другие).
+func ListOrdersAfter(ctx context.Context, pool *pgxpool.Pool, tenantID string, after *OrderCursor, from, to time.Time, limit int, include Include, source string) ([]orders.Order, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return nil, err
+	}
+	afterDate, afterUID := from, ""
+	if after != nil {
+		afterDate, afterUID = after.DateCreated, after.OrderUid
+	}
+
+	orderSQL := `SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, extras, quarantined, corrections, warnings, source, source_detail, created_at, updated_at
+              FROM orders
+              WHERE tenant_id = $1 AND date_created >= $2 AND date_created < $3 AND (date_created, order_uid) > ($4, $5) AND NOT quarantined
+                  AND ($7 = '' OR source = $7)
+              ORDER BY date_created, order_uid
+              LIMIT $6`
+	page, err := queryOrders(ctx, pool, tenantID, include, orderSQL, tenantID, from, to, afterDate, afterUID, limit, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders page: %w", err)
+	}
+	return page, nil
+}
+
+// maxTrackNumberMatches - число заказов, возвращаемых FindOrdersByTrackNumber при limit <= 0
+const maxTrackNumberMatches = 100
+
+// Порядок сортировки списков заказов
+const (
+	SortDateCreated = "date_created" // по бизнес-дате создания заказа
+	SortStoredAt    = "stored_at"    // по времени сохранения заказа в базе данных
+	SortUpdatedAt   = "updated_at"   // по времени последнего изменения заказа в базе данных
+)
+
+// sortColumns - колонки orders для порядков сортировки
+var sortColumns = map[string]string{
+	SortDateCreated: "date_created",
+	SortStoredAt:    "created_at",
+	SortUpdatedAt:   "updated_at",
+}
+
+// ValidSort сообщает, поддерживается ли порядок сортировки sortBy.
+func ValidSort(sortBy string) bool {
+	_, ok := sortColumns[sortBy]
+	return ok
+}
+
+// SortValue возвращает значение колонки сортировки sortBy заказа o (для неизвестного порядка — DateCreated).
+func SortValue(o orders.Order, sortBy string) time.Time {
+	switch sortBy {
+	case SortStoredAt:
+		return o.StoredAt
+	case SortUpdatedAt:
+		return o.UpdatedAt
+	}
+	return o.DateCreated
+}
+
+// SortCursor - позиция в списке заказов: значение колонки сортировки и идентификатор последнего полученного заказа.
+type SortCursor struct {
+	Value    time.Time
+	OrderUid string
+}
+
+// FindOrdersByTrackNumber возвращает до limit заказов (limit <= 0 — до 100) с трек-номером trackNumber,
+// упорядоченных по (sortBy, order_uid) и расположенных строго после курсора after (nil — с начала списка);
+// пустой sortBy означает SortDateCreated. Из доставки, оплаты и товаров загружаются только разделы include;
+// если совпадений нет, возвращается пустой список. Ищутся только заказы арендатора tenantID; заказы в карантине не возвращаются.
+// Непустой source оставляет только заказы с этим источником (orders.SourceKafka и другие).
+func FindOrdersByTrackNumber(ctx context.Context, pool *pgxpool.Pool, tenantID, trackNumber, sortBy string, after *SortCursor, limit int, include Include, source string) ([]orders.Order, error) {
+	list, err := findOrdersPage(ctx, pool, tenantID, "track_number", trackNumber, sortBy, after, limit, include, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders by track number: %w", err)
+	}
+	return list, nil
+}
+
+// FindOrdersByCustomer возвращает до limit заказов (limit <= 0 — до 100) покупателя customerID так же, как
+// FindOrdersByTrackNumber: в порядке (sortBy, order_uid) строго после курсора after, с разделами include, только заказы
+// арендатора tenantID и без заказов в карантине.
+func FindOrdersByCustomer(ctx context.Context, pool *pgxpool.Pool, tenantID, customerID, sortBy string, after *SortCursor, limit int, include Include) ([]orders.Order, error) {
+	list, err := findOrdersPage(ctx, pool, tenantID, "customer_id", customerID, sortBy, after, limit, include, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders by customer: %w", err)
+	}
+	return list, nil
+}
+
+// findOrdersPage - страница заказов арендатора tenantID с value в колонке column (постоянное имя колонки orders)
+// в порядке (sortBy, order_uid) после курсора after; непустой source оставляет заказы с этим источником
+func findOrdersPage(ctx context.Context, pool *pgxpool.Pool, tenantID, column, value, sortBy string, after *SortCursor, limit int, include Include, source string) ([]orders.Order, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return nil, err
+	}
+	if sortBy == "" {
+		sortBy = SortDateCreated
+	}
+	sortColumn, ok := sortColumns[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort order %q", sortBy)
+	}
+	if limit <= 0 {
+		limit = maxTrackNumberMatches
+	}
+	orderSQL := `SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, extras, quarantined, corrections, warnings, source, source_detail, created_at, updated_at
+              FROM orders
+              WHERE tenant_id = $1 AND ` + column + ` = $2 AND NOT quarantined AND ($4 = '' OR source = $4)`
+	args := []interface{}{tenantID, value, limit, source}
+	if after != nil {
+		orderSQL += ` AND (` + sortColumn + `, order_uid) > ($5, $6)`
+		args = append(args, after.Value, after.OrderUid)
+	}
+	orderSQL += ` ORDER BY ` + sortColumn + `, order_uid LIMIT $3`
+	return queryOrders(ctx, pool, tenantID, include, orderSQL, args...)
+}
+
+// Include - разделы заказа, загружаемые вместе с заголовком (строкой таблицы orders). Незагруженные разделы
+// пустые и отмечены в Order.Omitted.
+type Include = orders.Sections
+
+// Разделы заказа для Include.
+const (
+	IncludeDelivery         = orders.SectionDelivery
+	IncludePayment          = orders.SectionPayments
+	IncludeItems            = orders.SectionItems
+	IncludeAll              = orders.AllSections
+	IncludeNone     Include = 0
+)
+
+// GetOrderHeader возвращает заказ арендатора tenantID по идентификатору только с разделами include или ErrOrderNotFound.
+// Заказ в карантине тоже возвращается.
+func GetOrderHeader(ctx context.Context, pool *pgxpool.Pool, tenantID, uid string, include Include) (orders.Order, error) {
+	list, err := GetOrderHeaders(ctx, pool, tenantID, []string{uid}, include)
+	if err != nil {
+		return orders.Order{}, err
+	}
+	if len(list) == 0 {
+		return orders.Order{}, ErrOrderNotFound
+	}
+	return list[0], nil
+}
+
+// GetOrderHeaders возвращает найденные заказы арендатора tenantID из uids (без учёта регистра), упорядоченные по order_uid,
+// только с разделами include. Отсутствующие идентификаторы пропускаются.
+func GetOrderHeaders(ctx context.Context, pool *pgxpool.Pool, tenantID string, uids []string, include Include) ([]orders.Order, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return nil, err
+	}
+	orderSQL := `SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, extras, quarantined, corrections, warnings, source, source_detail, created_at, updated_at
+              FROM orders
+              WHERE tenant_id = $1 AND lower(order_uid) = ANY($2)
+              ORDER BY lower(order_uid), order_uid`
+	lower := make([]string, len(uids))
+	for i, uid := range uids {
+		lower[i] = ids.Normalize(uid)
+	}
+	list, err := queryOrders(ctx, pool, tenantID, include, orderSQL, tenantID, lower)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order headers: %w", err)
+	}
+	return list, nil
+}
+
+// queryOrders выполняет запрос строк таблицы orders арендатора tenantID (в порядке колонок ListOrdersAfter) и дозагружает
+// разделы include. Идентификаторы возвращаемых заказов приводятся к нижнему регистру.
+func queryOrders(ctx context.Context, pool *pgxpool.Pool, tenantID string, include Include, orderSQL string, args ...interface{}) ([]orders.Order, error) {
+	rows, err := pool.Query(ctx, orderSQL, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []orders.Order
+	for rows.Next() {
+		var o orders.Order
+		var extras, corrections, warnings []byte
+		err := rows.Scan(&o.OrderUid, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature, &o.CustomerId, &o.DeliveryService, &o.Shardkey, &o.SmId, &o.DateCreated, &o.OofShard, &extras, &o.Quarantined, &corrections, &warnings, &o.Source, &o.SourceDetail, &o.StoredAt, &o.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		if o.Extras, err = orders.DecodeExtras(extras); err != nil {
+			return nil, fmt.Errorf("failed to decode extras of order %s: %w", o.OrderUid, err)
+		}
+		if o.Corrections, err = decodeList[orders.Correction](corrections); err != nil {
+			return nil, fmt.Errorf("failed to decode corrections of order %s: %w", o.OrderUid, err)
+		}
+		if o.Warnings, err = decodeList[orders.Warning](warnings); err != nil {
+			return nil, fmt.Errorf("failed to decode warnings of order %s: %w", o.OrderUid, err)
+		}
+		list = append(list, o)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating order rows: %w", rows.Err())
+	}
+
+	if err := loadOrderDetails(ctx, pool, tenantID, list, include); err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i].OrderUid = ids.Normalize(list[i].OrderUid)
+	}
+	return list, nil
+}
+
+// loadOrderDetails дозагружает разделы include (доставку, оплату и товары) для переданных заказов арендатора tenantID
+// одним запросом на каждую таблицу; остальные разделы отмечаются в Omitted.
+func loadOrderDetails(ctx context.Context, pool *pgxpool.Pool, tenantID string, list []orders.Order, include Include) error {
+	if len(list) == 0 {
+		return nil
+	}
+	uids := make([]string, len(list))
+	byUID := make(map[string]*orders.Order, len(list))
+	for i := range list {
+		list[i].Omitted = IncludeAll &^ include
+		uids[i] = list[i].OrderUid
+		byUID[list[i].OrderUid] = &list[i]
+	}
+
+	if include&IncludeDelivery != 0 {
+		if err := loadDeliveries(ctx, pool, tenantID, uids, byUID); err != nil {
+			return err
+		}
+	}
+	if include&IncludePayment != 0 {
+		if err := loadPayments(ctx, pool, tenantID, uids, byUID); err != nil {
+			return err
+		}
+	}
+	if include&IncludeItems != 0 {
+		return loadItems(ctx, pool, tenantID, uids, byUID)
+	}
+	return nil
+}
+
+// loadDeliveries дозагружает доставку заказов byUID арендатора tenantID с идентификаторами uids.
+func loadDeliveries(ctx context.Context, pool *pgxpool.Pool, tenantID string, uids []string, byUID map[string]*orders.Order) error {
+	kr := fieldKeyring.Load()
+	deliveryRows, err := pool.Query(ctx, `SELECT order_uid, name, phone, zip, city, address, region, email FROM delivery WHERE tenant_id = $1 AND order_uid = ANY($2)`, tenantID, uids)
+	if err != nil {
+		return fmt.Errorf("failed to query deliveries: %w", err)
+	}
+	for deliveryRows.Next() {
+		var orderUid string
+		var d orders.Delivery
+		if err := deliveryRows.Scan(&orderUid, &d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email); err != nil {
+			deliveryRows.Close()
+			return fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		if err := decryptDeliveryPII(kr, orderUid, &d); err != nil {
+			deliveryRows.Close()
+			return err
+		}
+		if o, ok := byUID[orderUid]; ok {
+			o.Delivery = d
+		}
+	}
+	deliveryRows.Close()
+	if deliveryRows.Err() != nil {
+		return fmt.Errorf("error iterating delivery rows: %w", deliveryRows.Err())
+	}
+	return nil
+}
+
+// loadPayments дозагружает платежи заказов byUID арендатора tenantID с идентификаторами uids.
+func loadPayments(ctx context.Context, pool *pgxpool.Pool, tenantID string, uids []string, byUID map[string]*orders.Order) error {
+	paymentRows, err := pool.Query(ctx, `SELECT order_uid, transaction_id, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee FROM payment WHERE tenant_id = $1 AND order_uid = ANY($2) ORDER BY order_uid, `+paymentOrder, tenantID, uids)
+	if err != nil {
+		return fmt.Errorf("failed to query payments: %w", err)
+	}
+	for paymentRows.Next() {
+		var orderUid string
+		var p orders.Payment
+		if err := paymentRows.Scan(&orderUid, &p.Transaction, &p.RequestId, &p.Currency, &p.Provider, &p.Amount, &p.PaymentDt, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee); err != nil {
+			paymentRows.Close()
+			return fmt.Errorf("failed to scan payment: %w", err)
+		}
+		if o, ok := byUID[orderUid]; ok {
+			o.Payments = append(o.Payments, p)
+		}
+	}
+	paymentRows.Close()
+	if paymentRows.Err() != nil {
+		return fmt.Errorf("error iterating payment rows: %w", paymentRows.Err())
+	}
+	return nil
+}
+
+// loadItems дозагружает товары заказов byUID арендатора tenantID с идентификаторами uids и отмечает заказы без товаров
+// признаком ItemsMissing.
+func loadItems(ctx context.Context, pool *pgxpool.Pool, tenantID string, uids []string, byUID map[string]*orders.Order) error {
+	itemRows, err := pool.Query(ctx, `SELECT chrt_id, order_uid, track_number, price, rid, name, sale, "size", total_price, nm_id, brand, status FROM items WHERE tenant_id = $1 AND order_uid = ANY($2)`, tenantID, uids)
+	if err != nil {
+		return fmt.Errorf("failed to query items: %w", err)
+	}
+	defer itemRows.Close()
+	for itemRows.Next() {
+		var orderUid string
+		var i orders.Item
+		if err := itemRows.Scan(&i.ChrtId, &orderUid, &i.TrackNumber, &i.Price, &i.Rid, &i.Name, &i.Sale, &i.Size, &i.TotalPrice, &i.NmId, &i.Brand, &i.Status); err != nil {
+			return fmt.Errorf("failed to scan item: %w", err)
+		}
+		if o, ok := byUID[orderUid]; ok {
+			o.Items = append(o.Items, i)
+		}
+	}
+	if itemRows.Err() != nil {
+		return fmt.Errorf("error iterating item rows: %w", itemRows.Err())
+	}
+	for _, o := range byUID {
+		o.ItemsMissing = len(o.Items) == 0
+	}
+	return nil
+}
+
+// ErrUnknownGroupKey возвращается CountOrdersBy для ключа группировки не из белого списка.
+var ErrUnknownGroupKey = errors.New("unknown group key")
+
+// GroupCount - количество заказов для одного значения ключа группировки и суммы их платежей по валютам.
+type GroupCount struct {
+	Key    string          `json:"key"`
+	Count  int             `json:"count"`
+	Totals []CurrencyTotal `json:"totals"`
+}
+
+// CurrencyTotal - сумма платежей (amount) в одной валюте. Суммы в разных валютах не складываются.
+type CurrencyTotal struct {
+	Currency string `json:"currency"`
+	Amount   int64  `json:"amount"`
+}
+
+// breakdownQuery - запросы статистики для одного ключа группировки: количество заказов и суммы платежей
+// по паре (значение ключа, валюта)
+type breakdownQuery struct {
+	count  string
+	totals string
+}
+
+// breakdownQueries - белый список ключей группировки и соответствующих запросов.
+// Ключ никогда не подставляется в SQL, поэтому внедрение SQL через него невозможно.
+// Валюты платежей, сохранённых до их нормализации, приводятся к верхнему регистру.
+var breakdownQueries = map[string]breakdownQuery{
+	"delivery_service": {
+		count: `SELECT delivery_service, COUNT(*) FROM orders
+               WHERE tenant_id = $1 AND date_created >= $2 AND date_created < $3 AND NOT quarantined
+               GROUP BY delivery_service ORDER BY 2 DESC, 1`,
+		totals: `SELECT o.delivery_service, upper(p.currency), SUM(p.amount) FROM orders o
+                JOIN payment p ON p.tenant_id = o.tenant_id AND p.order_uid = o.order_uid
+                WHERE o.tenant_id = $1 AND o.date_created >= $2 AND o.date_created < $3 AND NOT o.quarantined
+                GROUP BY 1, 2 ORDER BY 1, 2`,
+	},
+	"locale": {
+		count: `SELECT locale, COUNT(*) FROM orders
+               WHERE tenant_id = $1 AND date_created >= $2 AND date_created < $3 AND NOT quarantined
+               GROUP BY locale ORDER BY 2 DESC, 1`,
+		totals: `SELECT o.locale, upper(p.currency), SUM(p.amount) FROM orders o
+                JOIN payment p ON p.tenant_id = o.tenant_id AND p.order_uid = o.order_uid
+                WHERE o.tenant_id = $1 AND o.date_created >= $2 AND o.date_created < $3 AND NOT o.quarantined
+                GROUP BY 1, 2 ORDER BY 1, 2`,
+	},
+	// заказ с товарами в разных статусах учитывается в каждом из них
+	"status": {
+		count: `SELECT i.status::text, COUNT(DISTINCT o.order_uid) FROM orders o
+               JOIN items i ON i.tenant_id = o.tenant_id AND i.order_uid = o.order_uid
+               WHERE o.tenant_id = $1 AND o.date_created >= $2 AND o.date_created < $3 AND NOT o.quarantined
+               GROUP BY i.status ORDER BY 2 DESC, 1`,
+		totals: `SELECT s.status, upper(p.currency), SUM(p.amount) FROM (
+                    SELECT DISTINCT i.status::text AS status, o.order_uid FROM orders o
+                    JOIN items i ON i.tenant_id = o.tenant_id AND i.order_uid = o.order_uid
+                    WHERE o.tenant_id = $1 AND o.date_created >= $2 AND o.date_created < $3 AND NOT o.quarantined
+                ) s
+                JOIN payment p ON p.tenant_id = $1 AND p.order_uid = s.order_uid
+                GROUP BY 1, 2 ORDER BY 1, 2`,
+	},
+	// заказ с платежами в разных валютах учитывается в каждой из них
+	"currency": {
+		count: `SELECT upper(p.currency), COUNT(DISTINCT o.order_uid) FROM orders o
+               JOIN payment p ON p.tenant_id = o.tenant_id AND p.order_uid = o.order_uid
+               WHERE o.tenant_id = $1 AND o.date_created >= $2 AND o.date_created < $3 AND NOT o.quarantined
+               GROUP BY 1 ORDER BY 2 DESC, 1`,
+		totals: `SELECT upper(p.currency), upper(p.currency), SUM(p.amount) FROM orders o
+                JOIN payment p ON p.tenant_id = o.tenant_id AND p.order_uid = o.order_uid
+                WHERE o.tenant_id = $1 AND o.date_created >= $2 AND o.date_created < $3 AND NOT o.quarantined
+                GROUP BY 1 ORDER BY 1`,
+	},
+}
+
+// BreakdownKeys возвращает допустимые ключи группировки для CountOrdersBy в алфавитном порядке.
+func BreakdownKeys() []string {
+	keys := make([]string, 0, len(breakdownQueries))
+	for k := range breakdownQueries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CountOrdersBy возвращает количество заказов с date_created в интервале [from, to), сгруппированных по ключу groupBy
+// (currency, delivery_service, locale или status товаров), и суммы их платежей отдельно по каждой валюте; учитываются
+// только заказы арендатора tenantID, заказы в карантине не учитываются. Для ключа не из белого списка возвращается
+// ErrUnknownGroupKey.
+func CountOrdersBy(ctx context.Context, pool *pgxpool.Pool, tenantID, groupBy string, from, to time.Time) ([]GroupCount, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return nil, err
+	}
+	query, ok := breakdownQueries[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownGroupKey, groupBy)
+	}
+
+	rows, err := pool.Query(ctx, query.count, tenantID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count orders by %s: %w", groupBy, err)
+	}
+	defer rows.Close()
+
+	var counts []GroupCount
+	byKey := make(map[string]int)
+	for rows.Next() {
+		var gc GroupCount
+		if err := rows.Scan(&gc.Key, &gc.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan group count: %w", err)
+		}
+		byKey[gc.Key] = len(counts)
+		counts = append(counts, gc)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating group count rows: %w", rows.Err())
+	}
+
+	totalRows, err := pool.Query(ctx, query.totals, tenantID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum payments by %s: %w", groupBy, err)
+	}
+	defer totalRows.Close()
+	for totalRows.Next() {
+		var key string
+		var total CurrencyTotal
+		if err := totalRows.Scan(&key, &total.Currency, &total.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan payment total: %w", err)
+		}
+		if i, ok := byKey[key]; ok {
+			counts[i].Totals = append(counts[i].Totals, total)
+		}
+	}
+	if totalRows.Err() != nil {
+		return nil, fmt.Errorf("error iterating payment total rows: %w", totalRows.Err())
+	}
+	return counts, nil
+}
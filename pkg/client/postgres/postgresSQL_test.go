@@ -0,0 +1,182 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreakdownKeys(t *testing.T) {
+	assert.Equal(t, []string{"currency", "delivery_service", "locale", "status"}, BreakdownKeys())
+}
+
+func TestMissingColumns(t *testing.T) {
+	want := map[string][]string{"orders": {"order_uid", "extras"}, "items": {"rid"}}
+	existing := map[string]bool{"orders.order_uid": true}
+	assert.Equal(t, []string{"items.rid", "orders.extras"}, missingColumns(want, existing))
+
+	existing["orders.extras"], existing["items.rid"] = true, true
+	assert.Empty(t, missingColumns(want, existing))
+}
+
+func TestPoolSizeWarning(t *testing.T) {
+	assert.Empty(t, PoolSizeWarning(2, 1))
+	assert.Empty(t, PoolSizeWarning(8, 4))
+	assert.Contains(t, PoolSizeWarning(1, 1), "below recommended 2")
+	assert.Contains(t, PoolSizeWarning(7, 4), "below recommended 8")
+
+	// 0 означает размер пула pgxpool по умолчанию, не меньше 4 соединений
+	assert.Empty(t, PoolSizeWarning(0, 2))
+	assert.NotEmpty(t, PoolSizeWarning(0, 1000))
+}
+
+func TestIsConnectionLost(t *testing.T) {
+	lost := []error{
+		fmt.Errorf("failed to insert into orders: %w", &pgconn.PgError{Code: "57P01", Message: "terminating connection due to administrator command"}),
+		&pgconn.PgError{Code: "57P03", Message: "the database system is starting up"},
+		&pgconn.PgError{Code: "08006"},
+		&pgconn.PgError{Code: "25006", Message: "cannot execute INSERT in a read-only transaction"},
+		fmt.Errorf("begin: %w", io.ErrUnexpectedEOF),
+		&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED},
+		fmt.Errorf("write: %w", syscall.ECONNRESET),
+		errors.New("conn closed"),
+	}
+	for _, err := range lost {
+		assert.True(t, IsConnectionLost(err), err.Error())
+	}
+	kept := []error{
+		nil,
+		ErrOrderExists,
+		&pgconn.PgError{Code: uniqueViolation},
+		&pgconn.PgError{Code: "57014", Message: "canceling statement due to statement timeout"},
+		fmt.Errorf("query: %w", context.DeadlineExceeded),
+		context.Canceled,
+	}
+	for _, err := range kept {
+		assert.False(t, IsConnectionLost(err), fmt.Sprint(err))
+	}
+}
+
+func TestCountOrdersByRejectsUnknownKey(t *testing.T) {
+	for _, key := range []string{"", "customer_id", "locale; DROP TABLE orders"} {
+		// Пул не нужен: ключ отклоняется до обращения к базе данных
+		_, err := CountOrdersBy(context.Background(), nil, tenant.Default, key, time.Time{}, time.Now())
+		assert.True(t, errors.Is(err, ErrUnknownGroupKey), key)
+	}
+}
+
+func TestOrderQueriesRequireTenant(t *testing.T) {
+	// Пул не нужен: запрос без арендатора отклоняется до обращения к базе данных
+	ctx := context.Background()
+	_, err := GetOrderByUID(ctx, nil, "", "o1")
+	assert.ErrorIs(t, err, tenant.ErrRequired)
+	_, err = GetAllOrders(ctx, nil, "")
+	assert.ErrorIs(t, err, tenant.ErrRequired)
+	_, err = ListOrdersAfter(ctx, nil, "", nil, time.Time{}, time.Now(), 10, IncludeAll, "")
+	assert.ErrorIs(t, err, tenant.ErrRequired)
+	_, err = FindOrdersByTrackNumber(ctx, nil, "", "TRACK", "", nil, 0, IncludeAll, "")
+	assert.ErrorIs(t, err, tenant.ErrRequired)
+	_, err = GetRawPayload(ctx, nil, "", "o1")
+	assert.ErrorIs(t, err, tenant.ErrRequired)
+	assert.ErrorIs(t, InsertOrder(ctx, nil, "", &orders.Order{OrderUid: "o1"}, nil), tenant.ErrRequired)
+	_, err = InsertOrders(ctx, nil, []OrderRecord{{Order: orders.Order{OrderUid: "o1"}}})
+	assert.ErrorIs(t, err, tenant.ErrRequired)
+	_, _, err = ReserveIdempotencyKey(ctx, nil, "", "key", "hash", time.Time{})
+	assert.ErrorIs(t, err, tenant.ErrRequired)
+	_, err = UpdateDelivery(ctx, nil, "", "o1", time.Now(), orders.Delivery{}, "")
+	assert.ErrorIs(t, err, tenant.ErrRequired)
+	_, err = ListDeliveryHistory(ctx, nil, "", "o1")
+	assert.ErrorIs(t, err, tenant.ErrRequired)
+}
+
+func TestExtrasColumnRoundTrip(t *testing.T) {
+	data, err := encodeExtras(nil)
+	require.NoError(t, err)
+	assert.Nil(t, data, "orders without extras store NULL")
+
+	extras := map[string]any{
+		"marketing":      map[string]any{"tags": []any{"promo"}, "budget": json.Number("100.50")},
+		"warehouse_hint": "KZN-2",
+	}
+	data, err = encodeExtras(extras)
+	require.NoError(t, err)
+
+	decoded, err := orders.DecodeExtras(data)
+	require.NoError(t, err)
+	assert.Equal(t, extras, decoded)
+}
+
+func TestListColumnsRoundTrip(t *testing.T) {
+	data, err := encodeList[orders.Correction]("corrections", nil)
+	require.NoError(t, err)
+	assert.Nil(t, data, "orders without corrections store NULL")
+	decoded, err := decodeList[orders.Correction](nil)
+	require.NoError(t, err)
+	assert.Nil(t, decoded)
+
+	corrections := []orders.Correction{{Field: "items[0].total_price", Original: 400, Corrected: 317, Applied: true}}
+	data, err = encodeList("corrections", corrections)
+	require.NoError(t, err)
+	decoded, err = decodeList[orders.Correction](data)
+	require.NoError(t, err)
+	assert.Equal(t, corrections, decoded)
+
+	warnings := []orders.Warning{{Field: "delivery.zip", Value: "12", Message: "zip does not match"}}
+	data, err = encodeList("warnings", warnings)
+	require.NoError(t, err)
+	decodedWarnings, err := decodeList[orders.Warning](data)
+	require.NoError(t, err)
+	assert.Equal(t, warnings, decodedWarnings)
+}
+
+func TestClassifyError(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, ClassifyError(ctx, nil))
+	assert.Same(t, ErrOrderExists, ClassifyError(ctx, ErrOrderExists))
+
+	// Истёкший дедлайн клиента: в ошибке или только в контексте (pgx может вернуть ошибку обрыва чтения)
+	expired, cancel := context.WithTimeout(ctx, -time.Second)
+	defer cancel()
+	for _, err := range []error{
+		fmt.Errorf("failed to query orders: %w", context.DeadlineExceeded),
+		fmt.Errorf("failed to query orders: %w", io.ErrUnexpectedEOF),
+	} {
+		got := ClassifyError(expired, err)
+		assert.ErrorIs(t, got, ErrQueryTimeout)
+		assert.ErrorIs(t, got, err)
+		assert.Contains(t, got.Error(), "client deadline")
+	}
+
+	// Выражение отменено сервером по statement_timeout
+	stmt := fmt.Errorf("failed to query orders: %w", &pgconn.PgError{Code: "57014", Message: "canceling statement due to statement timeout"})
+	got := ClassifyError(ctx, stmt)
+	assert.ErrorIs(t, got, ErrQueryTimeout)
+	assert.Contains(t, got.Error(), "statement_timeout")
+	var pgErr *pgconn.PgError
+	assert.ErrorAs(t, got, &pgErr)
+	assert.Same(t, got, ClassifyError(ctx, got), "classification is idempotent")
+
+	// Отмена вызывающим — не отказ базы, даже если сервер ответил 57014 на запрос отмены
+	canceled, cancelNow := context.WithCancel(ctx)
+	cancelNow()
+	assert.Same(t, stmt, ClassifyError(canceled, stmt))
+	assert.NotErrorIs(t, ClassifyError(ctx, context.Canceled), ErrQueryTimeout)
+
+	lost := fmt.Errorf("failed to query orders: %w", &pgconn.PgError{Code: "57P01"})
+	got = ClassifyError(ctx, lost)
+	assert.ErrorIs(t, got, ErrUnavailable)
+	assert.True(t, IsConnectionLost(got))
+}
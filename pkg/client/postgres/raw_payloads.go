@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"l0_test_self/internal/ids"
+	"l0_test_self/internal/tenant"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// ErrRawPayloadNotFound возвращается, когда для заказа не сохранено исходное сообщение.
+var ErrRawPayloadNotFound = errors.New("raw payload not found")
+
+// RawPayload - исходное сообщение Kafka, из которого получен заказ, с его координатами в топике.
+// Payload хранится побайтово, без повторной сериализации.
+type RawPayload struct {
+	OrderUid   string
+	Payload    []byte
+	ReceivedAt time.Time
+	Topic      string
+	Partition  int
+	Offset     int64
+}
+
+// insertRawPayloadTx сохраняет исходное сообщение заказа арендатора tenantID в рамках транзакции tx; nil пропускается.
+// Повторно доставленное сообщение не перезаписывает уже сохранённое.
+func insertRawPayloadTx(ctx context.Context, tx pgx.Tx, tenantID string, raw *RawPayload) error {
+	if raw == nil {
+		return nil
+	}
+	rawSQL := `INSERT INTO raw_payloads (order_uid, payload, received_at, topic, kafka_partition, kafka_offset, tenant_id)
+               VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (tenant_id, order_uid) DO NOTHING`
+	if _, err := tx.Exec(ctx, rawSQL, raw.OrderUid, raw.Payload, raw.ReceivedAt, raw.Topic, raw.Partition, raw.Offset, tenantID); err != nil {
+		return fmt.Errorf("failed to insert into raw_payloads: %w", err)
+	}
+	return nil
+}
+
+// GetRawPayload возвращает исходное сообщение заказа арендатора tenantID или ErrRawPayloadNotFound.
+func GetRawPayload(ctx context.Context, pool *pgxpool.Pool, tenantID, uid string) (RawPayload, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return RawPayload{}, err
+	}
+	raw := RawPayload{OrderUid: ids.Normalize(uid)}
+	rawSQL := `SELECT payload, received_at, topic, kafka_partition, kafka_offset FROM raw_payloads
+               WHERE tenant_id = $1 AND lower(order_uid) = lower($2) ORDER BY order_uid = $2 DESC LIMIT 1`
+	err := pool.QueryRow(ctx, rawSQL, tenantID, uid).Scan(&raw.Payload, &raw.ReceivedAt, &raw.Topic, &raw.Partition, &raw.Offset)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return RawPayload{}, ErrRawPayloadNotFound
+		}
+		return RawPayload{}, fmt.Errorf("failed to query raw payload: %w", err)
+	}
+	return raw, nil
+}
+
+// DeleteRawPayloadsBefore удаляет исходные сообщения, полученные раньше before, и возвращает их количество.
+func DeleteRawPayloadsBefore(ctx context.Context, pool *pgxpool.Pool, before time.Time) (int64, error) {
+	tag, err := pool.Exec(ctx, `DELETE FROM raw_payloads WHERE received_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete raw payloads: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,310 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// schemaMigrations - идемпотентные изменения схемы, добавленные поверх исходных таблиц orders, delivery, payment и items.
+// Новые изменения добавляются в конец списка; каждое должно быть безопасно при повторном выполнении.
+var schemaMigrations = []string{
+	// дополнительные поля заказа, не описанные в модели
+	`ALTER TABLE orders ADD COLUMN IF NOT EXISTS extras JSONB`,
+	// исходные сообщения Kafka, из которых получены заказы
+	`CREATE TABLE IF NOT EXISTS raw_payloads (
+		order_uid       TEXT PRIMARY KEY,
+		payload         BYTEA NOT NULL,
+		received_at     TIMESTAMPTZ NOT NULL,
+		topic           TEXT NOT NULL,
+		kafka_partition INTEGER NOT NULL,
+		kafka_offset    BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS raw_payloads_received_at_idx ON raw_payloads (received_at)`,
+	// у заказа может быть несколько платежей (или ни одного): платёж ссылается на заказ через order_uid,
+	// а для существующих платежей order_uid совпадал с transaction_id
+	`ALTER TABLE payment ADD COLUMN IF NOT EXISTS order_uid TEXT`,
+	`UPDATE payment SET order_uid = transaction_id WHERE order_uid IS NULL`,
+	`CREATE INDEX IF NOT EXISTS payment_order_uid_idx ON payment (order_uid)`,
+	// ключи идемпотентности HTTP запросов создания заказов: status 0 — запрос ещё обрабатывается
+	`CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key          TEXT PRIMARY KEY,
+		request_hash TEXT NOT NULL,
+		order_uid    TEXT NOT NULL DEFAULT '',
+		status       INTEGER NOT NULL DEFAULT 0,
+		response     BYTEA,
+		created_at   TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at)`,
+	// поиск заказов по трек-номеру
+	`CREATE INDEX IF NOT EXISTS orders_track_number_idx ON orders (track_number)`,
+	// заказы в карантине (например, с датой создания в будущем) не попадают в списки заказов
+	`ALTER TABLE orders ADD COLUMN IF NOT EXISTS quarantined BOOLEAN NOT NULL DEFAULT false`,
+	// исправления и замечания проверки total_price товаров; NULL, если их нет
+	`ALTER TABLE orders ADD COLUMN IF NOT EXISTS corrections JSONB`,
+	// замечания валидации, с которыми заказ принят (например, индекс доставки не по формату региона); NULL, если их нет
+	`ALTER TABLE orders ADD COLUMN IF NOT EXISTS warnings JSONB`,
+	// зашифрованные телефон и email доставки длиннее исходных значений
+	`ALTER TABLE delivery ALTER COLUMN phone TYPE TEXT, ALTER COLUMN email TYPE TEXT`,
+	// служебное время сохранения и последнего изменения заказа; updated_at обновляет UpsertOrder, а не триггер.
+	// Для уже сохранённых заказов оба значения заполняются бизнес-датой date_created
+	`ALTER TABLE orders ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ, ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ`,
+	`UPDATE orders SET created_at = COALESCE(created_at, date_created), updated_at = COALESCE(updated_at, created_at, date_created)
+		WHERE created_at IS NULL OR updated_at IS NULL`,
+	`ALTER TABLE orders ALTER COLUMN created_at SET DEFAULT now(), ALTER COLUMN created_at SET NOT NULL,
+		ALTER COLUMN updated_at SET DEFAULT now(), ALTER COLUMN updated_at SET NOT NULL`,
+	`CREATE INDEX IF NOT EXISTS orders_updated_at_idx ON orders (updated_at)`,
+	// журнал обработки заказов: последняя сквозная задержка от публикации в Kafka до появления заказа в кэше
+	`CREATE TABLE IF NOT EXISTS order_audit (
+		order_uid      TEXT PRIMARY KEY,
+		e2e_latency_ms BIGINT NOT NULL,
+		measured_at    TIMESTAMPTZ NOT NULL
+	)`,
+	// журнал неудачных попыток записи сообщений Kafka: по нему консьюмер отправляет в очередь недоставленных
+	// сообщения, которые не удаётся записать (kafka.consumer.max_attempts)
+	`CREATE TABLE IF NOT EXISTS message_attempts (
+		topic           TEXT NOT NULL,
+		kafka_partition INT NOT NULL,
+		kafka_offset    BIGINT NOT NULL,
+		order_uid       TEXT NOT NULL DEFAULT '',
+		attempts        INT NOT NULL,
+		last_error      TEXT NOT NULL DEFAULT '',
+		updated_at      TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (topic, kafka_partition, kafka_offset)
+	)`,
+	// позиции чтения читателей Kafka без группы (повтор топика -replay): следующее смещение каждой партиции
+	`CREATE TABLE IF NOT EXISTS checkpoints (
+		reader_name     TEXT NOT NULL,
+		topic           TEXT NOT NULL,
+		kafka_partition INT NOT NULL,
+		next_offset     BIGINT NOT NULL,
+		updated_at      TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (reader_name, topic, kafka_partition)
+	)`,
+	// указания пропустить сообщения Kafka (POST /admin/consumer/skip), которые ещё не прочитаны консьюмером
+	`CREATE TABLE IF NOT EXISTS message_skips (
+		topic           TEXT NOT NULL,
+		kafka_partition INT NOT NULL,
+		kafka_offset    BIGINT NOT NULL,
+		reason          TEXT NOT NULL DEFAULT '',
+		created_at      TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (topic, kafka_partition, kafka_offset)
+	)`,
+	// арендаторы: идентификатор заказа уникален только в пределах арендатора (tenant.Default для заказов,
+	// сохранённых до появления арендаторов), поэтому tenant_id становится первой колонкой первичных ключей
+	`ALTER TABLE orders ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default'`,
+	`ALTER TABLE delivery ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default'`,
+	`ALTER TABLE payment ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default'`,
+	`ALTER TABLE items ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default'`,
+	`ALTER TABLE raw_payloads ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default'`,
+	`ALTER TABLE order_audit ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default'`,
+	`ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default'`,
+	tenantPrimaryKey("orders"),
+	tenantPrimaryKey("delivery"),
+	tenantPrimaryKey("payment"),
+	tenantPrimaryKey("items"),
+	tenantPrimaryKey("raw_payloads"),
+	tenantPrimaryKey("order_audit"),
+	tenantPrimaryKey("idempotency_keys"),
+	// внешние ключи разделов заказа, удалённые вместе с прежним первичным ключом orders, связывают строку
+	// с заказом того же арендатора
+	tenantForeignKey("delivery"),
+	tenantForeignKey("payment"),
+	tenantForeignKey("items"),
+	`CREATE INDEX IF NOT EXISTS orders_tenant_track_number_idx ON orders (tenant_id, track_number)`,
+	`CREATE INDEX IF NOT EXISTS orders_tenant_date_created_idx ON orders (tenant_id, date_created, order_uid)`,
+	`CREATE INDEX IF NOT EXISTS payment_tenant_order_uid_idx ON payment (tenant_id, order_uid)`,
+	// поиск заказов без учёта регистра: идентификаторы, сохранённые до ids.Parse, могут содержать буквы в верхнем регистре
+	`CREATE INDEX IF NOT EXISTS orders_tenant_lower_order_uid_idx ON orders (tenant_id, lower(order_uid))`,
+	`CREATE INDEX IF NOT EXISTS raw_payloads_tenant_lower_order_uid_idx ON raw_payloads (tenant_id, lower(order_uid))`,
+	// история доставки: значения до каждого изменения (PATCH /admin/orders/{id}/delivery, UpsertOrder); had_delivery
+	// false — до изменения доставки не было. Телефон и email шифруются так же, как в delivery
+	`CREATE TABLE IF NOT EXISTS delivery_history (
+		id           BIGSERIAL PRIMARY KEY,
+		tenant_id    TEXT NOT NULL,
+		order_uid    TEXT NOT NULL,
+		had_delivery BOOLEAN NOT NULL,
+		name         TEXT,
+		phone        TEXT,
+		zip          TEXT,
+		city         TEXT,
+		address      TEXT,
+		region       TEXT,
+		email        TEXT,
+		changed_at   TIMESTAMPTZ NOT NULL,
+		changed_by   TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS delivery_history_order_idx ON delivery_history (tenant_id, order_uid, changed_at)`,
+	`CREATE INDEX IF NOT EXISTS delivery_history_changed_at_idx ON delivery_history (changed_at)`,
+	// последние сохранённые заказы и подсказки идентификаторов по началу для страницы web/ (/api/recent, /api/suggest)
+	`CREATE INDEX IF NOT EXISTS orders_tenant_created_at_idx ON orders (tenant_id, created_at, order_uid)`,
+	`CREATE INDEX IF NOT EXISTS orders_tenant_lower_order_uid_pattern_idx ON orders (tenant_id, lower(order_uid) text_pattern_ops)`,
+	// журнал уведомлений webhooks, доставка которых прекращена после всех попыток или постоянной ошибки получателя
+	`CREATE TABLE IF NOT EXISTS webhook_failures (
+		id         BIGSERIAL PRIMARY KEY,
+		tenant_id  TEXT NOT NULL,
+		order_uid  TEXT NOT NULL,
+		event      TEXT NOT NULL,
+		endpoint   TEXT NOT NULL,
+		attempts   INT NOT NULL,
+		last_error TEXT NOT NULL,
+		failed_at  TIMESTAMPTZ NOT NULL
+	)`,
+	// источник заказа (orders.SourceKafka и другие) и его подробности; заказы, сохранённые раньше, получают source unknown
+	`ALTER TABLE orders ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'unknown',
+		ADD COLUMN IF NOT EXISTS source_detail TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS orders_tenant_source_date_created_idx ON orders (tenant_id, source, date_created, order_uid)`,
+	// почасовые счётчики сообщений консьюмера по продюсерам (заголовок producer_id) и покупателям; экземпляры
+	// консьюмера дописывают в строку часа свой прирост
+	`CREATE TABLE IF NOT EXISTS ingest_stats (
+		tenant_id   TEXT NOT NULL,
+		producer_id TEXT NOT NULL,
+		customer_id TEXT NOT NULL,
+		hour        TIMESTAMPTZ NOT NULL,
+		accepted    BIGINT NOT NULL DEFAULT 0,
+		invalid     BIGINT NOT NULL DEFAULT 0,
+		duplicate   BIGINT NOT NULL DEFAULT 0,
+		updated_at  TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (tenant_id, producer_id, customer_id, hour)
+	)`,
+	`CREATE INDEX IF NOT EXISTS ingest_stats_tenant_hour_idx ON ingest_stats (tenant_id, hour)`,
+	// заказы покупателя (GET /customers/{id}/orders) постранично по дате создания
+	`CREATE INDEX IF NOT EXISTS orders_tenant_customer_date_created_idx ON orders (tenant_id, customer_id, date_created, order_uid)`,
+}
+
+// tenantPrimaryKey - изменение схемы, добавляющее tenant_id первой колонкой первичного ключа таблицы table, если ключ
+// есть и колонки в нём ещё нет. Внешние ключи, ссылающиеся на прежний первичный ключ, удаляются вместе с ним
+// и создаются заново tenantForeignKey.
+func tenantPrimaryKey(table string) string {
+	return strings.ReplaceAll(`DO $$
+	DECLARE
+		pk   name;
+		cols text;
+	BEGIN
+		SELECT c.conname, string_agg(quote_ident(a.attname), ', ' ORDER BY k.ord) INTO pk, cols
+		FROM pg_constraint c
+		CROSS JOIN LATERAL unnest(c.conkey) WITH ORDINALITY AS k(attnum, ord)
+		JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+		WHERE c.conrelid = '{table}'::regclass AND c.contype = 'p'
+		GROUP BY c.conname;
+		IF pk IS NULL OR split_part(cols, ', ', 1) = 'tenant_id' THEN
+			RETURN;
+		END IF;
+		EXECUTE format('ALTER TABLE {table} DROP CONSTRAINT %I CASCADE', pk);
+		EXECUTE format('ALTER TABLE {table} ADD PRIMARY KEY (tenant_id, %s)', cols);
+	END $$`, "{table}", table)
+}
+
+// tenantForeignKey - изменение схемы, создающее внешний ключ (tenant_id, order_uid) таблицы table на orders
+// с каскадным удалением, если его ещё нет. Строки без заказа своего арендатора, которые могли появиться, пока ключа
+// не было, не удаляются: изменение завершается ошибкой с их числом, и запуск не продолжается, пока их не исправят
+// или не удалят вручную.
+func tenantForeignKey(table string) string {
+	return strings.ReplaceAll(`DO $$
+	DECLARE
+		orphans bigint;
+	BEGIN
+		IF EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = '{table}'::regclass AND conname = '{table}_tenant_order_fkey') THEN
+			RETURN;
+		END IF;
+		SELECT count(*) INTO orphans FROM {table} t WHERE t.order_uid IS NOT NULL
+			AND NOT EXISTS (SELECT 1 FROM orders o WHERE o.tenant_id = t.tenant_id AND o.order_uid = t.order_uid);
+		IF orphans > 0 THEN
+			RAISE EXCEPTION 'table {table} has % rows without an order with the same (tenant_id, order_uid); fix or delete them to add foreign key {table}_tenant_order_fkey', orphans
+				USING ERRCODE = 'foreign_key_violation';
+		END IF;
+		ALTER TABLE {table} ADD CONSTRAINT {table}_tenant_order_fkey FOREIGN KEY (tenant_id, order_uid)
+			REFERENCES orders (tenant_id, order_uid) ON DELETE CASCADE;
+	END $$`, "{table}", table)
+}
+
+// EnsureSchema применяет к базе данных изменения схемы, необходимые текущей версии сервиса.
+func EnsureSchema(ctx context.Context, pool *pgxpool.Pool) error {
+	for _, stmt := range schemaMigrations {
+		if _, err := pool.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to apply schema change %q: %w", stmt, err)
+		}
+	}
+	return nil
+}
+
+// baseColumns - колонки исходных таблиц, которые сервис использует, но не создаёт сам
+var baseColumns = map[string][]string{
+	"orders":   {"order_uid", "track_number", "entry", "locale", "internal_signature", "customer_id", "delivery_service", "shardkey", "sm_id", "date_created", "oof_shard"},
+	"delivery": {"order_uid", "name", "phone", "zip", "city", "address", "region", "email"},
+	"payment":  {"transaction_id", "request_id", "currency", "provider", "amount", "payment_dt", "bank", "delivery_cost", "goods_total", "custom_fee"},
+	"items":    {"chrt_id", "order_uid", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status"},
+}
+
+// migratedColumns - колонки, которые добавляет EnsureSchema при запуске сервиса
+var migratedColumns = map[string][]string{
+	"orders":           {"extras", "quarantined", "corrections", "warnings", "created_at", "updated_at", "tenant_id", "source", "source_detail"},
+	"delivery":         {"tenant_id"},
+	"payment":          {"order_uid", "tenant_id"},
+	"items":            {"tenant_id"},
+	"raw_payloads":     {"order_uid", "payload", "received_at", "topic", "kafka_partition", "kafka_offset", "tenant_id"},
+	"idempotency_keys": {"key", "request_hash", "order_uid", "status", "response", "created_at", "tenant_id"},
+	"order_audit":      {"order_uid", "e2e_latency_ms", "measured_at", "tenant_id"},
+	"message_attempts": {"topic", "kafka_partition", "kafka_offset", "order_uid", "attempts", "last_error", "updated_at"},
+	"checkpoints":      {"reader_name", "topic", "kafka_partition", "next_offset", "updated_at"},
+	"message_skips":    {"topic", "kafka_partition", "kafka_offset", "reason", "created_at"},
+	"delivery_history": {"id", "tenant_id", "order_uid", "had_delivery", "name", "phone", "zip", "city", "address", "region", "email", "changed_at", "changed_by"},
+	"webhook_failures": {"id", "tenant_id", "order_uid", "event", "endpoint", "attempts", "last_error", "failed_at"},
+	"ingest_stats":     {"tenant_id", "producer_id", "customer_id", "hour", "accepted", "invalid", "duplicate", "updated_at"},
+}
+
+// SchemaReport - результат сверки схемы базы данных с ожидаемой кодом. Колонки указываются как "таблица.колонка".
+type SchemaReport struct {
+	Missing []string `json:"missing,omitempty"` // отсутствующие колонки исходных таблиц: сервис с ними не работает
+	Pending []string `json:"pending,omitempty"` // отсутствующие колонки, которые добавит EnsureSchema при запуске
+}
+
+// CheckSchema сверяет колонки таблиц текущей схемы (information_schema) с колонками, которые использует код.
+// База данных не изменяется.
+func CheckSchema(ctx context.Context, db Client) (SchemaReport, error) {
+	tables := make([]string, 0, len(baseColumns)+len(migratedColumns))
+	for _, m := range []map[string][]string{baseColumns, migratedColumns} {
+		for table := range m {
+			tables = append(tables, table)
+		}
+	}
+	rows, err := db.Query(ctx, `SELECT table_name, column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ANY($1)`, tables)
+	if err != nil {
+		return SchemaReport{}, fmt.Errorf("failed to query information_schema: %w", err)
+	}
+	defer rows.Close()
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return SchemaReport{}, fmt.Errorf("failed to scan column: %w", err)
+		}
+		existing[table+"."+column] = true
+	}
+	if err := rows.Err(); err != nil {
+		return SchemaReport{}, fmt.Errorf("error iterating columns: %w", err)
+	}
+
+	var report SchemaReport
+	report.Missing = missingColumns(baseColumns, existing)
+	report.Pending = missingColumns(migratedColumns, existing)
+	return report, nil
+}
+
+// missingColumns - отсутствующие в existing колонки из want в порядке таблиц и колонок
+func missingColumns(want map[string][]string, existing map[string]bool) []string {
+	var missing []string
+	for table, columns := range want {
+		for _, column := range columns {
+			if name := table + "." + column; !existing[name] {
+				missing = append(missing, name)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
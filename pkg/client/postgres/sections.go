@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// sectionOwnerSQL - условие на строки раздела заказа арендатора $1 с идентификатором $2 (без учёта регистра):
+// связанные строки хранятся под исходным идентификатором заказа
+const sectionOwnerSQL = `tenant_id = $1 AND order_uid = (` + storedUIDSQL + `)`
+
+// GetDelivery возвращает доставку заказа арендатора tenantID, не загружая остальные разделы заказа. nil — у заказа
+// нет доставки; если нет самого заказа, возвращается ErrOrderNotFound.
+func GetDelivery(ctx context.Context, pool *pgxpool.Pool, tenantID, uid string) (*orders.Delivery, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return nil, err
+	}
+	var storedUID string
+	var d orders.Delivery
+	err := pool.QueryRow(ctx, `SELECT order_uid, name, phone, zip, city, address, region, email FROM delivery WHERE `+sectionOwnerSQL, tenantID, uid).
+		Scan(&storedUID, &d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, sectionAbsent(ctx, pool, tenantID, uid)
+	case err != nil:
+		return nil, fmt.Errorf("failed to query delivery: %w", err)
+	}
+	if err := decryptDeliveryPII(fieldKeyring.Load(), storedUID, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// GetPayments возвращает платежи заказа арендатора tenantID в порядке GetOrderByUID, не загружая остальные разделы
+// заказа. Пустой список — у заказа нет платежей; если нет самого заказа, возвращается ErrOrderNotFound.
+func GetPayments(ctx context.Context, pool *pgxpool.Pool, tenantID, uid string) ([]orders.Payment, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return nil, err
+	}
+	rows, err := pool.Query(ctx, `SELECT transaction_id, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee FROM payment WHERE `+sectionOwnerSQL+` ORDER BY `+paymentOrder, tenantID, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query payments: %w", err)
+	}
+	defer rows.Close()
+	var list []orders.Payment
+	for rows.Next() {
+		var p orders.Payment
+		if err := rows.Scan(&p.Transaction, &p.RequestId, &p.Currency, &p.Provider, &p.Amount, &p.PaymentDt, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee); err != nil {
+			return nil, fmt.Errorf("failed to scan payment: %w", err)
+		}
+		list = append(list, p)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating payment rows: %w", rows.Err())
+	}
+	if len(list) == 0 {
+		return nil, sectionAbsent(ctx, pool, tenantID, uid)
+	}
+	return list, nil
+}
+
+// GetItems возвращает товары заказа арендатора tenantID, не загружая остальные разделы заказа. Пустой список —
+// у заказа нет товаров; если нет самого заказа, возвращается ErrOrderNotFound.
+func GetItems(ctx context.Context, pool *pgxpool.Pool, tenantID, uid string) ([]orders.Item, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return nil, err
+	}
+	rows, err := pool.Query(ctx, `SELECT chrt_id, track_number, price, rid, name, sale, "size", total_price, nm_id, brand, status FROM items WHERE `+sectionOwnerSQL, tenantID, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query items: %w", err)
+	}
+	defer rows.Close()
+	var list []orders.Item
+	for rows.Next() {
+		var i orders.Item
+		if err := rows.Scan(&i.ChrtId, &i.TrackNumber, &i.Price, &i.Rid, &i.Name, &i.Sale, &i.Size, &i.TotalPrice, &i.NmId, &i.Brand, &i.Status); err != nil {
+			return nil, fmt.Errorf("failed to scan item: %w", err)
+		}
+		list = append(list, i)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating item rows: %w", rows.Err())
+	}
+	if len(list) == 0 {
+		return nil, sectionAbsent(ctx, pool, tenantID, uid)
+	}
+	return list, nil
+}
+
+// sectionAbsent - ошибка чтения раздела, строк которого не нашлось: nil, если заказ есть, и ErrOrderNotFound, если нет.
+// Проверка нужна только для пустого раздела, поэтому обычное чтение раздела обходится одним запросом
+func sectionAbsent(ctx context.Context, pool *pgxpool.Pool, tenantID, uid string) error {
+	exists, err := ExistsOrder(ctx, pool, tenantID, uid)
+	switch {
+	case err != nil:
+		return err
+	case !exists:
+		return ErrOrderNotFound
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// MessageSkip - указание пропустить сообщение Kafka: консьюмер, прочитав сообщение Key, не обрабатывает его,
+// а сохраняет в файл пропущенных сообщений и коммитит смещение.
+type MessageSkip struct {
+	Key       MessageKey
+	Reason    string
+	CreatedAt time.Time
+}
+
+// AddMessageSkip сохраняет указание пропустить сообщение; повторное указание для того же сообщения заменяет причину.
+func AddMessageSkip(ctx context.Context, pool *pgxpool.Pool, skip MessageSkip) error {
+	skipSQL := `INSERT INTO message_skips (topic, kafka_partition, kafka_offset, reason, created_at)
+                VALUES ($1, $2, $3, $4, $5)
+                ON CONFLICT (topic, kafka_partition, kafka_offset) DO UPDATE
+                SET reason = EXCLUDED.reason, created_at = EXCLUDED.created_at`
+	k := skip.Key
+	if _, err := pool.Exec(ctx, skipSQL, k.Topic, k.Partition, k.Offset, skip.Reason, skip.CreatedAt); err != nil {
+		return fmt.Errorf("failed to add message skip %s/%d@%d: %w", k.Topic, k.Partition, k.Offset, err)
+	}
+	return nil
+}
+
+// ListMessageSkips возвращает все сохранённые указания пропустить сообщения в порядке топика, партиции и смещения.
+func ListMessageSkips(ctx context.Context, pool *pgxpool.Pool) ([]MessageSkip, error) {
+	rows, err := pool.Query(ctx, `SELECT topic, kafka_partition, kafka_offset, reason, created_at FROM message_skips
+                                  ORDER BY topic, kafka_partition, kafka_offset`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message skips: %w", err)
+	}
+	defer rows.Close()
+
+	var list []MessageSkip
+	for rows.Next() {
+		var s MessageSkip
+		if err := rows.Scan(&s.Key.Topic, &s.Key.Partition, &s.Key.Offset, &s.Reason, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan message skip: %w", err)
+		}
+		list = append(list, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read message skips: %w", err)
+	}
+	return list, nil
+}
+
+// DeleteMessageSkip удаляет указание пропустить сообщение key; отсутствие указания ошибкой не считается.
+func DeleteMessageSkip(ctx context.Context, pool *pgxpool.Pool, key MessageKey) error {
+	if _, err := pool.Exec(ctx, `DELETE FROM message_skips WHERE topic = $1 AND kafka_partition = $2 AND kafka_offset = $3`,
+		key.Topic, key.Partition, key.Offset); err != nil {
+		return fmt.Errorf("failed to delete message skip %s/%d@%d: %w", key.Topic, key.Partition, key.Offset, err)
+	}
+	return nil
+}
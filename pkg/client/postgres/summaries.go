@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"l0_test_self/internal/ids"
+	"l0_test_self/internal/tenant"
+	"l0_test_self/models/orders"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// OrderSummary - краткие сведения о заказе без персональных данных покупателя, доставки и платежей
+type OrderSummary struct {
+	OrderUid    string    `json:"order_uid"`
+	TrackNumber string    `json:"track_number"`
+	DateCreated time.Time `json:"date_created"`
+	StoredAt    time.Time `json:"stored_at"`
+	ItemCount   int       `json:"item_count"`
+}
+
+// Summarize возвращает краткие сведения о заказе order.
+func Summarize(order *orders.Order) OrderSummary {
+	return OrderSummary{
+		OrderUid:    ids.Normalize(order.OrderUid),
+		TrackNumber: order.TrackNumber,
+		DateCreated: order.DateCreated,
+		StoredAt:    order.StoredAt,
+		ItemCount:   len(order.Items),
+	}
+}
+
+// RecentOrders возвращает краткие сведения о limit последних сохранённых заказах арендатора tenantID, начиная
+// с самого нового. Заказы в карантине не возвращаются.
+func RecentOrders(ctx context.Context, pool *pgxpool.Pool, tenantID string, limit int) ([]OrderSummary, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return nil, err
+	}
+	recentSQL := `SELECT o.order_uid, o.track_number, o.date_created, o.created_at,
+                         (SELECT count(*) FROM items i WHERE i.tenant_id = o.tenant_id AND i.order_uid = o.order_uid)
+                  FROM orders o
+                  WHERE o.tenant_id = $1 AND NOT o.quarantined
+                  ORDER BY o.created_at DESC, o.order_uid DESC
+                  LIMIT $2`
+	rows, err := pool.Query(ctx, recentSQL, tenantID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recent orders: %w", err)
+	}
+	defer rows.Close()
+
+	var list []OrderSummary
+	for rows.Next() {
+		var s OrderSummary
+		if err := rows.Scan(&s.OrderUid, &s.TrackNumber, &s.DateCreated, &s.StoredAt, &s.ItemCount); err != nil {
+			return nil, fmt.Errorf("failed to scan recent order: %w", err)
+		}
+		s.OrderUid = ids.Normalize(s.OrderUid)
+		list = append(list, s)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating recent order rows: %w", rows.Err())
+	}
+	return list, nil
+}
+
+// OrderUIDsWithPrefix возвращает до limit идентификаторов заказов арендатора tenantID, начинающихся с prefix
+// (без учёта регистра), в нижнем регистре по возрастанию. prefix должен состоять из символов идентификатора
+// заказа (ids.Parse). Заказы в карантине не возвращаются.
+func OrderUIDsWithPrefix(ctx context.Context, pool *pgxpool.Pool, tenantID, prefix string, limit int) ([]string, error) {
+	if err := tenant.Validate(tenantID); err != nil {
+		return nil, err
+	}
+	if _, err := ids.Parse(prefix); err != nil {
+		return nil, err
+	}
+	// Символы идентификатора упорядочены побайтно, поэтому все идентификаторы с началом prefix лежат между prefix
+	// и prefix с увеличенным последним байтом; операторы ~>=~ и ~<~ сравнивают побайтно и используют индекс text_pattern_ops
+	from := ids.Normalize(prefix)
+	to := from[:len(from)-1] + string(from[len(from)-1]+1)
+	prefixSQL := `SELECT lower(order_uid) FROM orders
+                  WHERE tenant_id = $1 AND lower(order_uid) ~>=~ $2 AND lower(order_uid) ~<~ $3 AND NOT quarantined
+                  ORDER BY lower(order_uid) USING ~<~
+                  LIMIT $4`
+	rows, err := pool.Query(ctx, prefixSQL, tenantID, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order ids by prefix: %w", err)
+	}
+	defer rows.Close()
+
+	var list []string
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			return nil, fmt.Errorf("failed to scan order id: %w", err)
+		}
+		list = append(list, uid)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating order id rows: %w", rows.Err())
+	}
+	return list, nil
+}
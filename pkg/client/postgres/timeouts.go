@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgconn"
+)
+
+// ErrQueryTimeout - запрос не уложился в отведённое время: истёк дедлайн контекста (database.query_timeout или дедлайн
+// вызывающего) либо сервер отменил выражение по statement_timeout. Ошибка от ClassifyError обёртывает и исходную,
+// поэтому errors.Is(err, context.DeadlineExceeded) и errors.As(err, *pgconn.PgError) продолжают работать.
+var ErrQueryTimeout = errors.New("database query timed out")
+
+// ErrUnavailable - база данных недоступна: соединение потеряно или не устанавливается (см. IsConnectionLost).
+var ErrUnavailable = errors.New("database unavailable")
+
+// queryCanceled - код ошибки PostgreSQL, с которым сервер отменяет выражение по statement_timeout или по запросу отмены
+const queryCanceled = "57014"
+
+// ClassifyError приводит ошибку запроса, выполненного с контекстом ctx, к доменной: истечение времени на стороне клиента
+// или сервера обёртывается в ErrQueryTimeout, потеря соединения — в ErrUnavailable. Остальные ошибки, отмена контекста
+// вызывающим и nil возвращаются без изменений.
+func ClassifyError(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, ErrQueryTimeout) || errors.Is(err, ErrUnavailable) {
+		return err
+	}
+	// Отменённый вызывающим запрос (например, клиент HTTP закрыл соединение) не отказ базы. pgx отменяет выражение
+	// на сервере, и ответ 57014 приходит и в этом случае, поэтому контекст проверяется до кода ошибки.
+	if errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled) {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) || pgconn.Timeout(err) {
+		return fmt.Errorf("%w (client deadline): %w", ErrQueryTimeout, err)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == queryCanceled {
+		// Контекст не истёк, значит выражение отменил сам сервер: statement_timeout соединения или транзакции записи
+		return fmt.Errorf("%w (statement_timeout): %w", ErrQueryTimeout, err)
+	}
+	if IsConnectionLost(err) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,136 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+)
+
+// TrackNumberProgress - итог пачки NormalizeTrackNumbers
+type TrackNumberProgress struct {
+	Scanned    int    // просмотрено заказов
+	Orders     int    // заказов, трек-номер которых изменён
+	Items      int    // товаров, трек-номер которых изменён
+	LastTenant string // арендатор последнего просмотренного заказа
+	LastUID    string // order_uid последнего просмотренного заказа
+}
+
+// NormalizeTrackNumbers приводит функцией normalize трек-номера существующих заказов и их товаров к виду, в котором
+// их записывает приём заказов. Заказы всех арендаторов обходятся пачками по batchSize в порядке (tenant_id, order_uid),
+// каждая пачка записывается своей транзакцией (точкой сохранения, если db — транзакция), поэтому прерванный проход
+// можно продолжить, а повторный ничего не меняет. У изменённых заказов растёт updated_at. После каждой пачки
+// вызывается progress.
+func NormalizeTrackNumbers(ctx context.Context, db Client, normalize func(string) string, batchSize int, progress func(TrackNumberProgress)) (TrackNumberProgress, error) {
+	if batchSize <= 0 {
+		return TrackNumberProgress{}, fmt.Errorf("batch size must be positive")
+	}
+
+	var total TrackNumberProgress
+	for {
+		batch, err := normalizeTrackNumberBatch(ctx, db, normalize, total.LastTenant, total.LastUID, batchSize)
+		if err != nil {
+			return total, err
+		}
+		if batch.Scanned == 0 {
+			return total, nil
+		}
+		total.Scanned += batch.Scanned
+		total.Orders += batch.Orders
+		total.Items += batch.Items
+		total.LastTenant, total.LastUID = batch.LastTenant, batch.LastUID
+		if progress != nil {
+			progress(total)
+		}
+	}
+}
+
+// normalizeTrackNumberBatch нормализует трек-номера одной пачки заказов с (tenant_id, order_uid) больше (afterTenant, afterUID)
+func normalizeTrackNumberBatch(ctx context.Context, db Client, normalize func(string) string, afterTenant, afterUID string, limit int) (TrackNumberProgress, error) {
+	var res TrackNumberProgress
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return res, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// FOR UPDATE защищает пачку от одновременной записи сервисом
+	rows, err := tx.Query(ctx, `SELECT tenant_id, order_uid, track_number FROM orders
+		WHERE (tenant_id, order_uid) > ($1, $2) ORDER BY tenant_id, order_uid LIMIT $3 FOR UPDATE`, afterTenant, afterUID, limit)
+	if err != nil {
+		return res, fmt.Errorf("failed to query orders: %w", err)
+	}
+	type row struct{ tenant, uid, track string }
+	var scanned []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.tenant, &r.uid, &r.track); err != nil {
+			rows.Close()
+			return res, fmt.Errorf("failed to scan order: %w", err)
+		}
+		res.Scanned++
+		res.LastTenant, res.LastUID = r.tenant, r.uid
+		scanned = append(scanned, r)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return res, fmt.Errorf("error iterating order rows: %w", rows.Err())
+	}
+
+	for _, r := range scanned {
+		items, err := normalizeItemTrackNumbers(ctx, tx, normalize, r.tenant, r.uid)
+		if err != nil {
+			return res, err
+		}
+		res.Items += items
+		track := normalize(r.track)
+		if track == r.track && items == 0 {
+			continue
+		}
+		if _, err := tx.Exec(ctx, `UPDATE orders SET track_number = $3, updated_at = GREATEST(now(), updated_at + interval '1 microsecond')
+			WHERE tenant_id = $1 AND order_uid = $2`, r.tenant, r.uid, track); err != nil {
+			return res, fmt.Errorf("failed to update order %s: %w", r.uid, err)
+		}
+		if track != r.track {
+			res.Orders++
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return res, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return res, nil
+}
+
+// normalizeItemTrackNumbers нормализует трек-номера товаров заказа и возвращает число изменённых товаров
+func normalizeItemTrackNumbers(ctx context.Context, db Client, normalize func(string) string, tenantID, uid string) (int, error) {
+	rows, err := db.Query(ctx, `SELECT DISTINCT track_number FROM items WHERE tenant_id = $1 AND order_uid = $2`, tenantID, uid)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query items of order %s: %w", uid, err)
+	}
+	var tracks []string
+	for rows.Next() {
+		var track string
+		if err := rows.Scan(&track); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan item of order %s: %w", uid, err)
+		}
+		tracks = append(tracks, track)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return 0, fmt.Errorf("error iterating items of order %s: %w", uid, rows.Err())
+	}
+
+	var changed int
+	for _, track := range tracks {
+		normalized := normalize(track)
+		if normalized == track {
+			continue
+		}
+		tag, err := db.Exec(ctx, `UPDATE items SET track_number = $4 WHERE tenant_id = $1 AND order_uid = $2 AND track_number = $3`,
+			tenantID, uid, track, normalized)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update items of order %s: %w", uid, err)
+		}
+		changed += int(tag.RowsAffected())
+	}
+	return changed, nil
+}
@@ -0,0 +1,106 @@
+// Package codec реализует форматы сообщений Kafka с заказами. Формат сообщения выбирается по заголовку
+// content-type, а сообщения без заголовка декодируются форматом по умолчанию.
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"l0_test_self/models/orders"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ContentTypeHeader - заголовок сообщения Kafka с форматом тела.
+const ContentTypeHeader = "content-type"
+
+// Имена форматов в конфигурации (kafka.consumer.format) и флаге -format продюсера.
+const (
+	FormatJSON     = "json"
+	FormatProtobuf = "protobuf"
+)
+
+// ErrUnknownContentType возвращается для сообщения, заголовок content-type которого не соответствует ни одному формату.
+var ErrUnknownContentType = errors.New("unknown content type")
+
+// Codec кодирует и декодирует заказы в одном формате. Реализации безопасны для конкурентного использования.
+type Codec interface {
+	// Name возвращает имя формата для конфигурации и сообщений об ошибках.
+	Name() string
+	// ContentType возвращает значение заголовка content-type сообщений этого формата.
+	ContentType() string
+	Encode(order *orders.Order) ([]byte, error)
+	Decode(data []byte, order *orders.Order) error
+}
+
+var (
+	// JSON - формат JSON, в котором заказы публикуются по умолчанию.
+	JSON Codec = jsonCodec{}
+	// Protobuf - формат Protobuf по схеме order.proto.
+	Protobuf Codec = protobufCodec{}
+)
+
+// codecs - известные форматы
+var codecs = []Codec{JSON, Protobuf}
+
+// ByName возвращает формат по имени; пустое имя означает JSON.
+func ByName(name string) (Codec, error) {
+	if name == "" {
+		return JSON, nil
+	}
+	for _, c := range codecs {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown message format %q: must be %q or %q", name, FormatJSON, FormatProtobuf)
+}
+
+// ForMessage возвращает формат сообщения по заголовку content-type или def, если заголовка нет.
+// Параметры типа (например, "; charset=utf-8") и регистр не учитываются.
+func ForMessage(headers []kafka.Header, def Codec) (Codec, error) {
+	for _, h := range headers {
+		if !strings.EqualFold(h.Key, ContentTypeHeader) {
+			continue
+		}
+		mediaType, _, _ := strings.Cut(string(h.Value), ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		for _, c := range codecs {
+			if c.ContentType() == mediaType {
+				return c, nil
+			}
+		}
+		return nil, fmt.Errorf("%w %q", ErrUnknownContentType, mediaType)
+	}
+	return def, nil
+}
+
+// SchemaVersionHeader - заголовок сообщения Kafka с версией схемы JSON заказа (orders.UpgradeOrderJSON).
+const SchemaVersionHeader = "schema-version"
+
+// SchemaVersion возвращает версию схемы заказа из заголовка schema-version или 0, если заголовка нет.
+func SchemaVersion(headers []kafka.Header) (int, error) {
+	for _, h := range headers {
+		if strings.EqualFold(h.Key, SchemaVersionHeader) {
+			return orders.ParseSchemaVersion(string(h.Value))
+		}
+	}
+	return 0, nil
+}
+
+// Header возвращает заголовок content-type для сообщений формата c.
+func Header(c Codec) kafka.Header {
+	return kafka.Header{Key: ContentTypeHeader, Value: []byte(c.ContentType())}
+}
+
+// jsonCodec - формат JSON: кодирование заказа определяют методы orders.Order
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string        { return FormatJSON }
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Encode(order *orders.Order) ([]byte, error) { return json.Marshal(order) }
+
+func (jsonCodec) Decode(data []byte, order *orders.Order) error { return json.Unmarshal(data, order) }
@@ -0,0 +1,127 @@
+package codec
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"l0_test_self/models/orders"
+	"l0_test_self/pkg/testorders"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTrip - кодирует и декодирует заказ форматом c
+func roundTrip(t *testing.T, c Codec, order orders.Order) orders.Order {
+	t.Helper()
+	data, err := c.Encode(&order)
+	require.NoError(t, err)
+	var got orders.Order
+	require.NoError(t, c.Decode(data, &got))
+	return got
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	gen := testorders.NewGenerator(17)
+	for _, c := range []Codec{JSON, Protobuf} {
+		for _, scenario := range []testorders.Scenario{testorders.ScenarioDefault, testorders.ScenarioMinimal,
+			testorders.ScenarioUnicode, testorders.ScenarioMaxAmounts, testorders.ScenarioZeroAmounts} {
+			order := gen.Order(scenario)
+			order.DateCreated = order.DateCreated.UTC()
+			order.Extras = map[string]any{"utm_source": "partner", "weight": json.Number("1.25")}
+
+			got := roundTrip(t, c, order)
+			assert.Equal(t, order, got, "%s/%s", c.Name(), scenario)
+		}
+	}
+}
+
+func TestProtobufKeepsEdgeValues(t *testing.T) {
+	order := orders.Order{
+		OrderUid:    "edge",
+		SmId:        -1,
+		DateCreated: time.Date(1969, 12, 31, 23, 59, 59, 999999999, time.UTC),
+		Payments:    []orders.Payment{{}, {Amount: -5}},
+		Items:       []orders.Item{{Status: orders.ItemStatusReturned, Price: 1 << 40}},
+	}
+	assert.Equal(t, order, roundTrip(t, Protobuf, order), "empty repeated elements and negative values survive")
+
+	assert.Equal(t, orders.Order{}, roundTrip(t, Protobuf, orders.Order{}))
+}
+
+func TestProtobufWireFormat(t *testing.T) {
+	// order_uid = 1 (строка), sm_id = 12 (varint 150), items = 6 с nm_id = 9
+	data, err := Protobuf.Encode(&orders.Order{OrderUid: "a", SmId: 150, Items: []orders.Item{{NmId: 3}}})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x0a, 0x01, 'a', 0x32, 0x02, 0x48, 0x03, 0x60, 0x96, 0x01}, data)
+
+	// Незнакомые поля всех типов пропускаются
+	withUnknown := append([]byte{0xa0, 0x06, 0x01, 0xaa, 0x06, 0x01, 'x', 0xb1, 0x06, 0, 0, 0, 0, 0, 0, 0, 0, 0xbd, 0x06, 0, 0, 0, 0}, data...)
+	var order orders.Order
+	require.NoError(t, Protobuf.Decode(withUnknown, &order))
+	assert.Equal(t, "a", order.OrderUid)
+	assert.Equal(t, 150, order.SmId)
+}
+
+func TestProtobufRejectsMalformedMessages(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"truncated string": {0x0a, 0x05, 'a'},
+		"truncated varint": {0x60, 0x96},
+		"wrong wire type":  {0x08, 0x01},
+		"bad nanos":        {0x6a, 0x06, 0x10, 0x80, 0x94, 0xeb, 0xdc, 0x03}, // nanos = 1e9
+		"json body":        []byte(`{"order_uid": "a"}`),
+	} {
+		order := orders.Order{OrderUid: "kept"}
+		err := Protobuf.Decode(data, &order)
+		assert.ErrorIs(t, err, errMalformed, name)
+		assert.Equal(t, "kept", order.OrderUid, "%s: order is not changed on error", name)
+	}
+}
+
+func TestForMessage(t *testing.T) {
+	header := func(v string) []kafka.Header { return []kafka.Header{{Key: "Content-Type", Value: []byte(v)}} }
+
+	for value, want := range map[string]Codec{
+		"application/json":                JSON,
+		"application/json; charset=utf-8": JSON,
+		"Application/X-Protobuf":          Protobuf,
+	} {
+		c, err := ForMessage(header(value), JSON)
+		require.NoError(t, err, value)
+		assert.Equal(t, want.Name(), c.Name(), value)
+	}
+
+	c, err := ForMessage(nil, Protobuf)
+	require.NoError(t, err)
+	assert.Equal(t, Protobuf, c, "default without header")
+
+	_, err = ForMessage(header("application/avro"), JSON)
+	assert.ErrorIs(t, err, ErrUnknownContentType)
+
+	assert.Equal(t, header("application/x-protobuf")[0].Value, Header(Protobuf).Value)
+}
+
+func TestSchemaVersion(t *testing.T) {
+	v, err := SchemaVersion(nil)
+	require.NoError(t, err)
+	assert.Zero(t, v, "no header")
+
+	v, err = SchemaVersion([]kafka.Header{{Key: "content-type", Value: []byte("application/json")}, {Key: "Schema-Version", Value: []byte("2")}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, v)
+
+	_, err = SchemaVersion([]kafka.Header{{Key: SchemaVersionHeader, Value: []byte("two")}})
+	assert.Error(t, err)
+}
+
+func TestByName(t *testing.T) {
+	for name, want := range map[string]Codec{"": JSON, "json": JSON, "protobuf": Protobuf} {
+		c, err := ByName(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, c)
+	}
+	_, err := ByName("avro")
+	assert.Error(t, err)
+}
@@ -0,0 +1,402 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"l0_test_self/models/orders"
+)
+
+// protobufCodec - формат Protobuf по схеме order.proto. Сообщения кодируются и разбираются по спецификации
+// wire format вручную, поэтому они совместимы с кодом, сгенерированным protoc для этой схемы.
+// Незнакомые поля пропускаются, как это делает сгенерированный код.
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string        { return FormatProtobuf }
+func (protobufCodec) ContentType() string { return "application/x-protobuf" }
+
+// Типы полей wire format
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// errMalformed - ошибка разбора сообщения, не соответствующего wire format
+var errMalformed = errors.New("protobuf: malformed message")
+
+// protoWriter - буфер кодируемого сообщения. Поля с нулевыми значениями не записываются, как в proto3.
+type protoWriter struct {
+	buf []byte
+}
+
+func (w *protoWriter) tag(num, wireType int) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(num)<<3|uint64(wireType))
+}
+
+func (w *protoWriter) int(num int, v int64) {
+	if v == 0 {
+		return
+	}
+	w.tag(num, wireVarint)
+	// int64 кодируется дополнительным кодом, отрицательные значения занимают 10 байт
+	w.buf = binary.AppendUvarint(w.buf, uint64(v))
+}
+
+func (w *protoWriter) bytes(num int, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	w.tag(num, wireBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *protoWriter) string(num int, s string) {
+	if s == "" {
+		return
+	}
+	w.tag(num, wireBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// message - записывает вложенное сообщение; в отличие от скалярных полей пустое сообщение записывается,
+// если always истинно (элементы repeated полей)
+func (w *protoWriter) message(num int, always bool, encode func(*protoWriter)) {
+	var sub protoWriter
+	encode(&sub)
+	if len(sub.buf) == 0 && !always {
+		return
+	}
+	w.tag(num, wireBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(sub.buf)))
+	w.buf = append(w.buf, sub.buf...)
+}
+
+// protoField - поле разобранного сообщения: значение varint или содержимое поля с длиной
+type protoField struct {
+	num      int
+	wireType int
+	varint   uint64
+	data     []byte
+}
+
+// readFields - разбирает поля сообщения по порядку и передаёт их fn. Поля фиксированной длины пропускаются:
+// в схеме заказа их нет.
+func readFields(data []byte, fn func(f protoField) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errMalformed
+		}
+		data = data[n:]
+		f := protoField{num: int(key >> 3), wireType: int(key & 7)}
+		if f.num <= 0 || f.num > math.MaxInt32 {
+			return fmt.Errorf("%w: invalid field number %d", errMalformed, f.num)
+		}
+		switch f.wireType {
+		case wireVarint:
+			if f.varint, n = binary.Uvarint(data); n <= 0 {
+				return errMalformed
+			}
+			data = data[n:]
+		case wireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return fmt.Errorf("%w: field %d truncated", errMalformed, f.num)
+			}
+			f.data, data = data[n:n+int(size)], data[n+int(size):]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if f.wireType == wireFixed32 {
+				size = 4
+			}
+			if len(data) < size {
+				return fmt.Errorf("%w: field %d truncated", errMalformed, f.num)
+			}
+			data = data[size:]
+			continue
+		default:
+			return fmt.Errorf("%w: unsupported wire type %d of field %d", errMalformed, f.wireType, f.num)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expect - проверяет тип поля: поле известного номера с другим типом означает несовместимую схему
+func (f protoField) expect(wireType int) error {
+	if f.wireType != wireType {
+		return fmt.Errorf("%w: field %d has wire type %d, want %d", errMalformed, f.num, f.wireType, wireType)
+	}
+	return nil
+}
+
+// int - значение поля int64/int32 (отрицательные int32 кодируются так же, как int64)
+func (f protoField) int() (int, error) {
+	return int(int64(f.varint)), f.expect(wireVarint)
+}
+
+// string - значение строкового поля
+func (f protoField) string() (string, error) {
+	return string(f.data), f.expect(wireBytes)
+}
+
+func (protobufCodec) Encode(order *orders.Order) ([]byte, error) {
+	var w protoWriter
+	w.string(1, order.OrderUid)
+	w.string(2, order.TrackNumber)
+	w.string(3, order.Entry)
+	w.message(4, false, func(w *protoWriter) { encodeDelivery(w, &order.Delivery) })
+	for i := range order.Payments {
+		w.message(5, true, func(w *protoWriter) { encodePayment(w, &order.Payments[i]) })
+	}
+	for i := range order.Items {
+		w.message(6, true, func(w *protoWriter) { encodeItem(w, &order.Items[i]) })
+	}
+	w.string(7, order.Locale)
+	w.string(8, order.InternalSignature)
+	w.string(9, order.CustomerId)
+	w.string(10, order.DeliveryService)
+	w.string(11, order.Shardkey)
+	w.int(12, int64(order.SmId))
+	if !order.DateCreated.IsZero() {
+		// google.protobuf.Timestamp: seconds = 1, nanos = 2
+		w.message(13, true, func(w *protoWriter) {
+			w.int(1, order.DateCreated.Unix())
+			w.int(2, int64(order.DateCreated.Nanosecond()))
+		})
+	}
+	w.string(14, order.OofShard)
+	if len(order.Extras) > 0 {
+		extras, err := json.Marshal(order.Extras)
+		if err != nil {
+			return nil, fmt.Errorf("protobuf: encode extras: %w", err)
+		}
+		w.bytes(15, extras)
+	}
+	return w.buf, nil
+}
+
+func encodeDelivery(w *protoWriter, d *orders.Delivery) {
+	w.string(1, d.Name)
+	w.string(2, d.Phone)
+	w.string(3, d.Zip)
+	w.string(4, d.City)
+	w.string(5, d.Address)
+	w.string(6, d.Region)
+	w.string(7, d.Email)
+}
+
+func encodePayment(w *protoWriter, p *orders.Payment) {
+	w.string(1, p.Transaction)
+	w.string(2, p.RequestId)
+	w.string(3, p.Currency)
+	w.string(4, p.Provider)
+	w.int(5, int64(p.Amount))
+	w.int(6, int64(p.PaymentDt))
+	w.string(7, p.Bank)
+	w.int(8, int64(p.DeliveryCost))
+	w.int(9, int64(p.GoodsTotal))
+	w.int(10, int64(p.CustomFee))
+}
+
+func encodeItem(w *protoWriter, it *orders.Item) {
+	w.int(1, int64(it.ChrtId))
+	w.string(2, it.TrackNumber)
+	w.int(3, int64(it.Price))
+	w.string(4, it.Rid)
+	w.string(5, it.Name)
+	w.int(6, int64(it.Sale))
+	w.string(7, it.Size)
+	w.int(8, int64(it.TotalPrice))
+	w.int(9, int64(it.NmId))
+	w.string(10, it.Brand)
+	w.int(11, int64(it.Status))
+}
+
+// Decode разбирает заказ. Дата создания декодируется в UTC: часовой пояс в Timestamp не передаётся.
+func (protobufCodec) Decode(data []byte, order *orders.Order) error {
+	var o orders.Order
+	err := readFields(data, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			o.OrderUid, err = f.string()
+		case 2:
+			o.TrackNumber, err = f.string()
+		case 3:
+			o.Entry, err = f.string()
+		case 4:
+			// Повторное вложенное сообщение объединяется с предыдущим, как в сгенерированном коде
+			if err = f.expect(wireBytes); err == nil {
+				err = decodeDelivery(f.data, &o.Delivery)
+			}
+		case 5:
+			var p orders.Payment
+			if err = f.expect(wireBytes); err == nil {
+				err = decodePayment(f.data, &p)
+			}
+			o.Payments = append(o.Payments, p)
+		case 6:
+			var it orders.Item
+			if err = f.expect(wireBytes); err == nil {
+				err = decodeItem(f.data, &it)
+			}
+			o.Items = append(o.Items, it)
+		case 7:
+			o.Locale, err = f.string()
+		case 8:
+			o.InternalSignature, err = f.string()
+		case 9:
+			o.CustomerId, err = f.string()
+		case 10:
+			o.DeliveryService, err = f.string()
+		case 11:
+			o.Shardkey, err = f.string()
+		case 12:
+			o.SmId, err = f.int()
+		case 13:
+			if err = f.expect(wireBytes); err == nil {
+				o.DateCreated, err = decodeTimestamp(f.data)
+			}
+		case 14:
+			o.OofShard, err = f.string()
+		case 15:
+			if err = f.expect(wireBytes); err == nil {
+				o.Extras, err = decodeExtras(f.data)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	*order = o
+	return nil
+}
+
+func decodeDelivery(data []byte, d *orders.Delivery) error {
+	return readFields(data, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			d.Name, err = f.string()
+		case 2:
+			d.Phone, err = f.string()
+		case 3:
+			d.Zip, err = f.string()
+		case 4:
+			d.City, err = f.string()
+		case 5:
+			d.Address, err = f.string()
+		case 6:
+			d.Region, err = f.string()
+		case 7:
+			d.Email, err = f.string()
+		}
+		return err
+	})
+}
+
+func decodePayment(data []byte, p *orders.Payment) error {
+	return readFields(data, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			p.Transaction, err = f.string()
+		case 2:
+			p.RequestId, err = f.string()
+		case 3:
+			p.Currency, err = f.string()
+		case 4:
+			p.Provider, err = f.string()
+		case 5:
+			p.Amount, err = f.int()
+		case 6:
+			p.PaymentDt, err = f.int()
+		case 7:
+			p.Bank, err = f.string()
+		case 8:
+			p.DeliveryCost, err = f.int()
+		case 9:
+			p.GoodsTotal, err = f.int()
+		case 10:
+			p.CustomFee, err = f.int()
+		}
+		return err
+	})
+}
+
+func decodeItem(data []byte, it *orders.Item) error {
+	return readFields(data, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			it.ChrtId, err = f.int()
+		case 2:
+			it.TrackNumber, err = f.string()
+		case 3:
+			it.Price, err = f.int()
+		case 4:
+			it.Rid, err = f.string()
+		case 5:
+			it.Name, err = f.string()
+		case 6:
+			it.Sale, err = f.int()
+		case 7:
+			it.Size, err = f.string()
+		case 8:
+			it.TotalPrice, err = f.int()
+		case 9:
+			it.NmId, err = f.int()
+		case 10:
+			it.Brand, err = f.string()
+		case 11:
+			var status int
+			status, err = f.int()
+			it.Status = orders.ItemStatus(int32(status))
+		}
+		return err
+	})
+}
+
+// decodeTimestamp - разбирает google.protobuf.Timestamp
+func decodeTimestamp(data []byte) (time.Time, error) {
+	var seconds, nanos int
+	err := readFields(data, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			seconds, err = f.int()
+		case 2:
+			nanos, err = f.int()
+		}
+		return err
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if nanos < 0 || nanos >= int(time.Second) {
+		return time.Time{}, fmt.Errorf("%w: timestamp nanos %d out of range", errMalformed, nanos)
+	}
+	return time.Unix(int64(seconds), int64(nanos)).UTC(), nil
+}
+
+// decodeExtras - разбирает дополнительные поля так же, как orders.Order.UnmarshalJSON: числа остаются json.Number
+func decodeExtras(data []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var extras map[string]any
+	if err := dec.Decode(&extras); err != nil {
+		return nil, fmt.Errorf("%w: extras: %v", errMalformed, err)
+	}
+	if len(extras) == 0 {
+		return nil, nil
+	}
+	return extras, nil
+}
@@ -0,0 +1,172 @@
+// Package kafkatest содержит окружение интеграционных тестов с Kafka: отдельный топик на каждый тест, ожидание
+// готовности брокера опросом метаданных и отправку и чтение сообщений с ограничением по времени.
+package kafkatest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	kafkaClient "l0_test_self/pkg/client/kafka"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DefaultTimeout - ограничение ожидания брокера, создания топика, отправки и чтения сообщений, если Harness.Timeout не задан
+const DefaultTimeout = 30 * time.Second
+
+const (
+	// pollInterval - пауза между запросами метаданных при ожидании брокера
+	pollInterval = 250 * time.Millisecond
+	// maxTopicNameLength - наибольшая длина имени теста в имени топика; Kafka ограничивает имя топика 249 символами
+	maxTopicNameLength = 100
+)
+
+// Harness - топик, созданный для одного теста. Топик имеет одну партицию, поэтому сообщения читаются в порядке отправки.
+type Harness struct {
+	Brokers []string
+	Topic   string
+	Timeout time.Duration // ограничение каждой операции; 0 — DefaultTimeout
+
+	t testing.TB
+}
+
+// New дожидается готовности брокеров brokers, создает топик с уникальным для теста t именем и удаляет его
+// по завершении теста. Тест завершается с ошибкой, если брокер не стал доступен за DefaultTimeout.
+func New(t testing.TB, brokers []string) *Harness {
+	t.Helper()
+	h := &Harness{Brokers: brokers, Topic: TopicName(t), t: t}
+	ctx, cancel := h.context()
+	defer cancel()
+
+	if err := WaitReady(ctx, brokers); err != nil {
+		t.Fatalf("kafkatest: %v", err)
+	}
+	spec := kafkaClient.TopicSpec{Partitions: 1, ReplicationFactor: 1, MinPartitions: 1}
+	if err := kafkaClient.EnsureTopics(ctx, brokers, []string{h.Topic}, spec); err != nil {
+		t.Fatalf("kafkatest: create topic %s: %v", h.Topic, err)
+	}
+	t.Cleanup(h.deleteTopic)
+	return h
+}
+
+// TopicName возвращает имя топика для теста t: имя теста, приведённое к допустимым в Kafka символам, и метку времени,
+// чтобы повторные запуски не видели сообщений друг друга.
+func TopicName(t testing.TB) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '_'
+		}
+	}, t.Name())
+	if len(name) > maxTopicNameLength {
+		name = name[:maxTopicNameLength]
+	}
+	return "kafkatest_" + name + "_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// WaitReady опрашивает метаданные брокеров brokers, пока они не ответят или не истечёт ctx.
+// Возвращает последнюю ошибку запроса метаданных, если брокер так и не стал доступен.
+func WaitReady(ctx context.Context, brokers []string) error {
+	transport := &kafka.Transport{}
+	defer transport.CloseIdleConnections()
+	client := &kafka.Client{Addr: kafka.TCP(brokers...), Transport: transport}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		meta, err := client.Metadata(ctx, &kafka.MetadataRequest{})
+		if err == nil && len(meta.Brokers) == 0 {
+			err = errors.New("no brokers in metadata")
+		}
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("brokers %v not ready: %w", brokers, err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// Produce отправляет сообщения msgs в топик теста, дожидаясь подтверждения всех реплик.
+func (h *Harness) Produce(msgs ...kafka.Message) {
+	h.t.Helper()
+	ctx, cancel := h.context()
+	defer cancel()
+
+	w := &kafka.Writer{Addr: kafka.TCP(h.Brokers...), Topic: h.Topic, RequiredAcks: kafka.RequireAll}
+	defer w.Close()
+	if err := w.WriteMessages(ctx, msgs...); err != nil {
+		h.t.Fatalf("kafkatest: produce to %s: %v", h.Topic, err)
+	}
+}
+
+// ProduceJSON отправляет в топик теста по сообщению с JSON представлением каждого значения values.
+func (h *Harness) ProduceJSON(values ...any) {
+	h.t.Helper()
+	msgs := make([]kafka.Message, len(values))
+	for i, v := range values {
+		data, err := json.Marshal(v)
+		if err != nil {
+			h.t.Fatalf("kafkatest: marshal message %d: %v", i, err)
+		}
+		msgs[i] = kafka.Message{Value: data}
+	}
+	h.Produce(msgs...)
+}
+
+// ConsumeN читает первые n сообщений топика теста без группы консьюмеров, то есть не влияя на смещения групп.
+// Тест завершается с ошибкой, если за Timeout получено меньше n сообщений.
+func (h *Harness) ConsumeN(n int) []kafka.Message {
+	h.t.Helper()
+	ctx, cancel := h.context()
+	defer cancel()
+
+	r := kafka.NewReader(kafka.ReaderConfig{Brokers: h.Brokers, Topic: h.Topic, Partition: 0, MaxWait: pollInterval})
+	defer r.Close()
+	msgs := make([]kafka.Message, 0, n)
+	for len(msgs) < n {
+		msg, err := r.ReadMessage(ctx)
+		if err != nil {
+			h.t.Fatalf("kafkatest: consume from %s: got %d of %d messages: %v", h.Topic, len(msgs), n, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// context - контекст одной операции, ограниченный Timeout
+func (h *Harness) context() (context.Context, context.CancelFunc) {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// deleteTopic - удаляет топик теста; ошибка удаления не проваливает тест, а только попадает в его лог
+func (h *Harness) deleteTopic() {
+	ctx, cancel := h.context()
+	defer cancel()
+
+	transport := &kafka.Transport{}
+	defer transport.CloseIdleConnections()
+	client := &kafka.Client{Addr: kafka.TCP(h.Brokers...), Transport: transport}
+	resp, err := client.DeleteTopics(ctx, &kafka.DeleteTopicsRequest{Topics: []string{h.Topic}})
+	if err == nil {
+		err = resp.Errors[h.Topic]
+	}
+	if err != nil {
+		h.t.Logf("kafkatest: delete topic %s: %v", h.Topic, err)
+	}
+}
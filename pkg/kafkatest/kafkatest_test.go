@@ -0,0 +1,31 @@
+package kafkatest
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicName(t *testing.T) {
+	t.Run("Sub Test/with SPACES", func(t *testing.T) {
+		name := TopicName(t)
+		assert.True(t, strings.HasPrefix(name, "kafkatest_testtopicname_sub_test_with_spaces_"), name)
+		assert.Regexp(t, regexp.MustCompile(`^[a-z0-9_-]+$`), name)
+		assert.NotEqual(t, name, TopicName(t), "every run gets its own topic")
+	})
+	t.Run(strings.Repeat("x", 300), func(t *testing.T) {
+		assert.Less(t, len(TopicName(t)), 249)
+	})
+}
+
+func TestWaitReadyUnreachableBrokers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	err := WaitReady(ctx, []string{"127.0.0.1:1"})
+	assert.ErrorContains(t, err, "not ready")
+}
@@ -0,0 +1,17 @@
+// Package kafkautil содержит вспомогательные функции для работы с сообщениями Kafka.
+package kafkautil
+
+import (
+	"fmt"
+
+	"l0_test_self/internal/logging"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// MessageRef возвращает ссылку на сообщение для логов: топик, партицию, смещение и стабильный хэш тела.
+// По ссылке сообщение можно найти в топике для ручного восстановления, не записывая в лог его содержимое.
+func MessageRef(msg kafka.Message) string {
+	return fmt.Sprintf("topic=%s partition=%d offset=%d hash=%s",
+		msg.Topic, msg.Partition, msg.Offset, logging.PayloadHash(msg.Value))
+}
@@ -0,0 +1,20 @@
+package kafkautil
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageRef(t *testing.T) {
+	msg := kafka.Message{Topic: "orders", Partition: 3, Offset: 42, Value: []byte(`{"order_uid":"abc"}`)}
+
+	ref := MessageRef(msg)
+
+	assert.Regexp(t, `^topic=orders partition=3 offset=42 hash=[0-9a-f]{16}$`, ref)
+	assert.Equal(t, ref, MessageRef(msg), "reference is stable for the same message")
+
+	msg.Value = []byte(`{"order_uid":"abd"}`)
+	assert.NotEqual(t, ref, MessageRef(msg))
+}
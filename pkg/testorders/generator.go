@@ -0,0 +1,225 @@
+// Package testorders генерирует тестовые заказы для продюсера и тестов: как обычные корректные заказы,
+// так и пограничные сценарии для проверки валидации и обработки ошибок.
+// Для одного и того же seed (и фиксированного Now) генератор выдаёт одинаковую последовательность заказов.
+package testorders
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"l0_test_self/internal/ids"
+	"l0_test_self/models/orders"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// Scenario определяет вид генерируемого заказа.
+type Scenario string
+
+// Доступные сценарии генерации.
+const (
+	ScenarioDefault          Scenario = "default"           // корректный заказ с согласованными суммами
+	ScenarioMinimal          Scenario = "minimal"           // один товар, необязательные поля пустые/нулевые
+	ScenarioMaximal          Scenario = "maximal"           // Generator.MaxItems товаров
+	ScenarioUnicode          Scenario = "unicode"           // имена и адреса с не-ASCII символами
+	ScenarioZeroAmounts      Scenario = "zero-amounts"      // все суммы равны 0
+	ScenarioMaxAmounts       Scenario = "max-amounts"       // суммы равны math.MaxInt
+	ScenarioMismatchedTotals Scenario = "mismatched-totals" // суммы оплаты не сходятся с товарами
+)
+
+// DefaultMaxItems - количество товаров в сценарии maximal по умолчанию.
+const DefaultMaxItems = 1000
+
+// Scenarios возвращает все поддерживаемые сценарии.
+func Scenarios() []Scenario {
+	return []Scenario{
+		ScenarioDefault, ScenarioMinimal, ScenarioMaximal, ScenarioUnicode,
+		ScenarioZeroAmounts, ScenarioMaxAmounts, ScenarioMismatchedTotals,
+	}
+}
+
+// ParseScenario проверяет имя сценария и возвращает его.
+func ParseScenario(s string) (Scenario, error) {
+	for _, sc := range Scenarios() {
+		if string(sc) == s {
+			return sc, nil
+		}
+	}
+	return "", fmt.Errorf("unknown scenario %q (available: %v)", s, Scenarios())
+}
+
+// Generator генерирует заказы. Методы безопасны для конкурентного использования,
+// но детерминированность последовательности гарантируется только при вызовах из одной горутины.
+type Generator struct {
+	faker  *gofakeit.Faker
+	random bool // seed = 0: идентификаторы заказов генерируются ids.Generate, а не из seed
+
+	// Now возвращает время, используемое для date_created и payment_dt. По умолчанию time.Now.
+	Now func() time.Time
+	// MaxItems - количество товаров в сценарии maximal.
+	MaxItems int
+}
+
+// NewGenerator создает генератор с заданным seed. seed = 0 означает случайный seed.
+func NewGenerator(seed int64) *Generator {
+	return &Generator{
+		faker:    gofakeit.New(seed),
+		random:   seed == 0,
+		Now:      time.Now,
+		MaxItems: DefaultMaxItems,
+	}
+}
+
+// Order генерирует заказ для указанного сценария. Неизвестный сценарий трактуется как ScenarioDefault.
+func (g *Generator) Order(s Scenario) orders.Order {
+	switch s {
+	case ScenarioMinimal:
+		return g.minimal()
+	case ScenarioMaximal:
+		return g.build(g.MaxItems, false)
+	case ScenarioUnicode:
+		return g.build(g.faker.Number(1, 5), true)
+	case ScenarioZeroAmounts:
+		return g.withAmounts(0)
+	case ScenarioMaxAmounts:
+		return g.withAmounts(math.MaxInt)
+	case ScenarioMismatchedTotals:
+		o := g.build(g.faker.Number(1, 5), false)
+		o.Payments[0].GoodsTotal += g.faker.Number(1, 1000)
+		o.Payments[0].Amount -= g.faker.Number(1, 100)
+		return o
+	default:
+		return g.build(g.faker.Number(1, 5), false)
+	}
+}
+
+// OrderJSON генерирует заказ для указанного сценария и сериализует его в JSON.
+func (g *Generator) OrderJSON(s Scenario) ([]byte, error) {
+	return json.MarshalIndent(g.Order(s), "", "  ")
+}
+
+// orderID генерирует идентификатор заказа по правилам ids: из seed генератора или, при случайном seed, ids.Generate.
+func (g *Generator) orderID() string {
+	if g.random {
+		return ids.Generate().String()
+	}
+	return ids.GenerateFrom(g.faker.Rand).String()
+}
+
+// build генерирует корректный заказ с itemsCount товарами и согласованными суммами:
+// goods_total равен сумме total_price товаров, amount = goods_total + delivery_cost + custom_fee.
+func (g *Generator) build(itemsCount int, unicode bool) orders.Order {
+	f := g.faker
+	now := g.Now()
+
+	order := orders.Order{
+		OrderUid:          g.orderID(),
+		TrackNumber:       "WB" + strings.ToUpper(f.LetterN(10)), // трек-номера хранятся в верхнем регистре
+		Entry:             "WBIL",
+		Locale:            "en",
+		InternalSignature: "",
+		CustomerId:        f.LetterN(4),
+		DeliveryService:   "meest",
+		Shardkey:          strconv.Itoa(f.Number(1, 10)),
+		SmId:              f.Number(1, 100),
+		DateCreated:       now,
+		OofShard:          strconv.Itoa(f.Number(1, 10)),
+	}
+
+	order.Delivery = orders.Delivery{
+		Name:    f.Name(),
+		Phone:   f.Phone(),
+		Zip:     f.Zip(),
+		City:    f.City(),
+		Address: f.Address().Address,
+		Region:  f.State(),
+		Email:   f.Email(),
+	}
+	if unicode {
+		order.Locale = "ru"
+		order.Delivery.Name = f.RandomString(unicodeNames)
+		order.Delivery.City = f.RandomString(unicodeCities)
+		order.Delivery.Address = f.RandomString(unicodeAddresses)
+		order.Delivery.Region = f.RandomString(unicodeRegions)
+	}
+
+	goodsTotal := 0
+	for i := 0; i < itemsCount; i++ {
+		price := f.Number(100, 1000)
+		sale := f.Number(0, 50)
+		item := orders.Item{
+			ChrtId:      f.Number(1000000, 9999999),
+			TrackNumber: order.TrackNumber,
+			Price:       price,
+			Rid:         f.UUID(),
+			Name:        f.ProductName(),
+			Sale:        sale,
+			Size:        f.RandomString([]string{"S", "M", "L", "XL", "0"}),
+			TotalPrice:  price * (100 - sale) / 100,
+			NmId:        f.Number(1000000, 9999999),
+			Brand:       f.Company(),
+			Status:      orders.ItemStatus(f.Number(200, 202)),
+		}
+		if unicode {
+			item.Name = f.RandomString(unicodeProducts)
+		}
+		goodsTotal += item.TotalPrice
+		order.Items = append(order.Items, item)
+	}
+
+	deliveryCost := f.Number(10, 200)
+	order.Payments = []orders.Payment{{
+		Transaction:  order.OrderUid,
+		RequestId:    "",
+		Currency:     "USD",
+		Provider:     "wbpay",
+		Amount:       goodsTotal + deliveryCost,
+		PaymentDt:    int(now.Unix()),
+		Bank:         "alpha",
+		DeliveryCost: deliveryCost,
+		GoodsTotal:   goodsTotal,
+		CustomFee:    0,
+	}}
+
+	return order
+}
+
+// minimal генерирует заказ с одним товаром и нулевыми необязательными полями.
+func (g *Generator) minimal() orders.Order {
+	o := g.build(1, false)
+	o.InternalSignature = ""
+	o.Payments[0].RequestId = ""
+	o.Payments[0].Bank = ""
+	o.Payments[0].CustomFee = 0
+	o.Payments[0].DeliveryCost = 0
+	o.Items[0].Sale = 0
+	o.Items[0].TotalPrice = o.Items[0].Price
+	o.Payments[0].GoodsTotal = o.Items[0].TotalPrice
+	o.Payments[0].Amount = o.Payments[0].GoodsTotal
+	return o
+}
+
+// withAmounts генерирует заказ, в котором все денежные поля равны amount.
+func (g *Generator) withAmounts(amount int) orders.Order {
+	o := g.build(1, false)
+	o.Items[0].Price = amount
+	o.Items[0].Sale = 0
+	o.Items[0].TotalPrice = amount
+	o.Payments[0].Amount = amount
+	o.Payments[0].GoodsTotal = amount
+	o.Payments[0].DeliveryCost = 0
+	o.Payments[0].CustomFee = 0
+	return o
+}
+
+var (
+	unicodeNames     = []string{"Иван Петров", "Zoë Ünal", "山田 太郎", "Ολυμπία Παπαδοπούλου", "محمد علي"}
+	unicodeCities    = []string{"Москва", "Zürich", "東京", "Αθήνα", "القاهرة"}
+	unicodeAddresses = []string{"ул. Льва Толстого, 16", "Bahnhofstraße 1", "千代田区1-1", "Οδός Ερμού 5", "شارع التحرير 10"}
+	unicodeRegions   = []string{"Московская область", "Zürich", "東京都", "Αττική", "القاهرة"}
+	unicodeProducts  = []string{"Футболка 👕", "Schürze", "傘", "Καπέλο", "حقيبة"}
+)
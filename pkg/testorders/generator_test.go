@@ -0,0 +1,128 @@
+package testorders
+
+import (
+	"math"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"l0_test_self/internal/ids"
+	"l0_test_self/models/orders"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fixedNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newFixedGenerator(seed int64) *Generator {
+	g := NewGenerator(seed)
+	g.Now = func() time.Time { return fixedNow }
+	return g
+}
+
+func itemsTotal(o orders.Order) int {
+	total := 0
+	for _, it := range o.Items {
+		total += it.TotalPrice
+	}
+	return total
+}
+
+func TestScenarioDefaultConsistentTotals(t *testing.T) {
+	o := newFixedGenerator(1).Order(ScenarioDefault)
+
+	require.NotEmpty(t, o.Items)
+	assert.Equal(t, itemsTotal(o), o.Payments[0].GoodsTotal)
+	assert.Equal(t, o.Payments[0].GoodsTotal+o.Payments[0].DeliveryCost+o.Payments[0].CustomFee, o.Payments[0].Amount)
+	assert.Equal(t, o.OrderUid, o.Payments[0].Transaction)
+	assert.Equal(t, fixedNow, o.DateCreated)
+}
+
+func TestScenarioMinimal(t *testing.T) {
+	o := newFixedGenerator(2).Order(ScenarioMinimal)
+
+	require.Len(t, o.Items, 1)
+	assert.Empty(t, o.InternalSignature)
+	assert.Empty(t, o.Payments[0].RequestId)
+	assert.Empty(t, o.Payments[0].Bank)
+	assert.Zero(t, o.Payments[0].CustomFee)
+	assert.Zero(t, o.Payments[0].DeliveryCost)
+	assert.Zero(t, o.Items[0].Sale)
+	assert.Equal(t, o.Items[0].Price, o.Payments[0].Amount)
+}
+
+func TestScenarioMaximal(t *testing.T) {
+	g := newFixedGenerator(3)
+	g.MaxItems = 2500
+	o := g.Order(ScenarioMaximal)
+
+	assert.Len(t, o.Items, 2500)
+	assert.Equal(t, itemsTotal(o), o.Payments[0].GoodsTotal)
+}
+
+func TestScenarioUnicode(t *testing.T) {
+	o := newFixedGenerator(4).Order(ScenarioUnicode)
+
+	for _, s := range []string{o.Delivery.Name, o.Delivery.City, o.Delivery.Address, o.Delivery.Region} {
+		assert.True(t, utf8.ValidString(s))
+		assert.Greater(t, len(s), utf8.RuneCountInString(s), "expected non-ASCII characters in %q", s)
+	}
+}
+
+func TestScenarioBoundaryAmounts(t *testing.T) {
+	zero := newFixedGenerator(5).Order(ScenarioZeroAmounts)
+	assert.Zero(t, zero.Payments[0].Amount)
+	assert.Zero(t, zero.Payments[0].GoodsTotal)
+	assert.Zero(t, zero.Items[0].Price)
+
+	max := newFixedGenerator(5).Order(ScenarioMaxAmounts)
+	assert.Equal(t, math.MaxInt, max.Payments[0].Amount)
+	assert.Equal(t, math.MaxInt, max.Payments[0].GoodsTotal)
+	assert.Equal(t, math.MaxInt, max.Items[0].TotalPrice)
+}
+
+func TestScenarioMismatchedTotals(t *testing.T) {
+	o := newFixedGenerator(6).Order(ScenarioMismatchedTotals)
+
+	assert.NotEqual(t, itemsTotal(o), o.Payments[0].GoodsTotal)
+	assert.NotEqual(t, o.Payments[0].GoodsTotal+o.Payments[0].DeliveryCost+o.Payments[0].CustomFee, o.Payments[0].Amount)
+}
+
+func TestSeedDeterminism(t *testing.T) {
+	for _, sc := range Scenarios() {
+		a := newFixedGenerator(42)
+		b := newFixedGenerator(42)
+		a.MaxItems, b.MaxItems = 20, 20
+
+		for i := 0; i < 3; i++ {
+			ja, err := a.OrderJSON(sc)
+			require.NoError(t, err)
+			jb, err := b.OrderJSON(sc)
+			require.NoError(t, err)
+			assert.Equal(t, string(ja), string(jb), "scenario %s, order %d", sc, i)
+		}
+	}
+
+	assert.NotEqual(t, newFixedGenerator(1).Order(ScenarioDefault).OrderUid, newFixedGenerator(2).Order(ScenarioDefault).OrderUid)
+}
+
+func TestOrderUIDsFollowIDPolicy(t *testing.T) {
+	for _, g := range []*Generator{newFixedGenerator(42), NewGenerator(0)} {
+		for _, sc := range Scenarios() {
+			uid := g.Order(sc).OrderUid
+			id, err := ids.Parse(uid)
+			require.NoError(t, err, "scenario %s", sc)
+			assert.Equal(t, id.String(), uid, "generated uids are already normalized")
+		}
+	}
+}
+
+func TestParseScenario(t *testing.T) {
+	sc, err := ParseScenario("unicode")
+	require.NoError(t, err)
+	assert.Equal(t, ScenarioUnicode, sc)
+
+	_, err = ParseScenario("nope")
+	assert.Error(t, err)
+}
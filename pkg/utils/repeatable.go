@@ -4,16 +4,25 @@ package repeatable
 import (
 	"fmt"
 	"time"
+
+	"l0_test_self/internal/clock"
 )
 
 // DoWithTries запускает функцию fn несколько раз, пока она не выполнится успешно или не исчерпает максимальное количество попыток.
-func DoWithTries(fn func() error, maxAttempts int, delay time.Duration) (err error) {
+func DoWithTries(fn func() error, maxAttempts int, delay time.Duration) error {
+	return DoWithTriesClock(clock.Real, fn, maxAttempts, delay)
+}
+
+// DoWithTriesClock работает как DoWithTries, но выдерживает паузы между попытками по часам clk.
+func DoWithTriesClock(clk clock.Clock, fn func() error, maxAttempts int, delay time.Duration) (err error) {
 	for i := 0; i < maxAttempts; i++ {
 		err = fn()
 		if err == nil {
 			return nil
 		}
-		time.Sleep(delay)
+		if i < maxAttempts-1 {
+			clk.Sleep(delay)
+		}
 	}
 	return fmt.Errorf("failed after %d attempts: %w", maxAttempts, err)
 }
@@ -0,0 +1,48 @@
+package repeatable
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"l0_test_self/internal/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoWithTriesClockWaitsBetweenAttempts(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	errBusy := errors.New("busy")
+	var attempts []time.Time
+	done := make(chan error, 1)
+	go func() {
+		done <- DoWithTriesClock(clk, func() error {
+			attempts = append(attempts, clk.Now())
+			if len(attempts) < 3 {
+				return errBusy
+			}
+			return nil
+		}, 5, time.Minute)
+	}()
+
+	for range 2 {
+		clk.BlockUntil(1)
+		clk.Advance(time.Minute)
+	}
+	require.NoError(t, <-done)
+	assert.Equal(t, []time.Time{start, start.Add(time.Minute), start.Add(2 * time.Minute)}, attempts)
+}
+
+func TestDoWithTriesClockGivesUp(t *testing.T) {
+	clk := clock.NewFake(time.Time{})
+	errBusy := errors.New("busy")
+	calls := 0
+	err := DoWithTriesClock(clk, func() error {
+		calls++
+		return errBusy
+	}, 1, time.Hour)
+	assert.ErrorIs(t, err, errBusy)
+	assert.Equal(t, 1, calls, "no pause after the last attempt")
+}
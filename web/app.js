@@ -0,0 +1,26 @@
+document.getElementById('orderForm').addEventListener('submit', function(e) {
+    e.preventDefault();
+    const orderId = document.getElementById('orderId').value;
+    const resultDiv = document.getElementById('result');
+    resultDiv.textContent = 'Loading...';
+
+    fetch('/order?id=' + encodeURIComponent(orderId))
+        .then(response => {
+            if (!response.ok) {
+                return response.text().then(text => {
+                    let message = text;
+                    try {
+                        message = JSON.parse(text).message || text;
+                    } catch (_) {}
+                    throw new Error(message);
+                });
+            }
+            return response.json();
+        })
+        .then(data => {
+            resultDiv.textContent = JSON.stringify(data, null, 2);
+        })
+        .catch(error => {
+            resultDiv.textContent = error.message;
+        });
+});